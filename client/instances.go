@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -28,31 +29,49 @@ type Instance struct {
 		Rev string `json:"rev"`
 	} `json:"meta"`
 	Attrs struct {
-		Domain               string    `json:"domain"`
-		DomainAliases        []string  `json:"domain_aliases,omitempty"`
-		Prefix               string    `json:"prefix,omitempty"`
-		Locale               string    `json:"locale"`
-		UUID                 string    `json:"uuid,omitempty"`
-		OIDCID               string    `json:"oidc_id,omitempty"`
-		ContextName          string    `json:"context,omitempty"`
-		TOSSigned            string    `json:"tos,omitempty"`
-		TOSLatest            string    `json:"tos_latest,omitempty"`
-		AuthMode             int       `json:"auth_mode,omitempty"`
-		NoAutoUpdate         bool      `json:"no_auto_update,omitempty"`
-		Blocked              bool      `json:"blocked,omitempty"`
-		OnboardingFinished   bool      `json:"onboarding_finished"`
-		PasswordDefined      *bool     `json:"password_defined"`
-		MagicLink            bool      `json:"magic_link,omitempty"`
-		BytesDiskQuota       int64     `json:"disk_quota,string,omitempty"`
-		IndexViewsVersion    int       `json:"indexes_version"`
-		CouchCluster         int       `json:"couch_cluster,omitempty"`
-		SwiftLayout          int       `json:"swift_cluster,omitempty"`
-		PassphraseResetToken []byte    `json:"passphrase_reset_token"`
-		PassphraseResetTime  time.Time `json:"passphrase_reset_time"`
-		RegisterToken        []byte    `json:"register_token,omitempty"`
+		Domain               string               `json:"domain"`
+		DomainAliases        []string             `json:"domain_aliases,omitempty"`
+		Prefix               string               `json:"prefix,omitempty"`
+		Locale               string               `json:"locale"`
+		UUID                 string               `json:"uuid,omitempty"`
+		OIDCID               string               `json:"oidc_id,omitempty"`
+		ContextName          string               `json:"context,omitempty"`
+		TOSSigned            string               `json:"tos,omitempty"`
+		TOSLatest            string               `json:"tos_latest,omitempty"`
+		AuthMode             int                  `json:"auth_mode,omitempty"`
+		NoAutoUpdate         bool                 `json:"no_auto_update,omitempty"`
+		Blocked              bool                 `json:"blocked,omitempty"`
+		OnboardingFinished   bool                 `json:"onboarding_finished"`
+		PasswordDefined      *bool                `json:"password_defined"`
+		MagicLink            bool                 `json:"magic_link,omitempty"`
+		BytesDiskQuota       int64                `json:"disk_quota,string,omitempty"`
+		IndexViewsVersion    int                  `json:"indexes_version"`
+		CouchCluster         int                  `json:"couch_cluster,omitempty"`
+		SwiftLayout          int                  `json:"swift_cluster,omitempty"`
+		PassphraseResetToken []byte               `json:"passphrase_reset_token"`
+		PassphraseResetTime  time.Time            `json:"passphrase_reset_time"`
+		RegisterToken        []byte               `json:"register_token,omitempty"`
+		Maintenance          *InstanceMaintenance `json:"maintenance,omitempty"`
+		LegalHold            *InstanceLegalHold   `json:"legal_hold,omitempty"`
 	} `json:"attributes"`
 }
 
+// InstanceMaintenance contains the informations about the maintenance of an
+// instance.
+type InstanceMaintenance struct {
+	Message    string    `json:"message,omitempty"`
+	AllowedIPs []string  `json:"allowed_ips,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+}
+
+// InstanceLegalHold contains the informations about the legal hold of an
+// instance.
+type InstanceLegalHold struct {
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
 // InstanceOptions contains the options passed on instance creation.
 type InstanceOptions struct {
 	Domain             string
@@ -274,14 +293,104 @@ func (ac *AdminClient) ModifyInstance(opts *InstanceOptions) (*Instance, error)
 	return readInstance(res)
 }
 
-// DestroyInstance is used to delete an instance and all its data.
-func (ac *AdminClient) DestroyInstance(domain string) error {
+// DestroyInstance is used to delete an instance and all its data. If a grace
+// period is configured on the stack, the instance is only scheduled for
+// deletion, unless now is true.
+func (ac *AdminClient) DestroyInstance(domain string, now bool) error {
 	if !validDomain(domain) {
 		return fmt.Errorf("Invalid domain: %s", domain)
 	}
+	var q url.Values
+	if now {
+		q = url.Values{"Now": {"true"}}
+	}
 	_, err := ac.Req(&request.Options{
 		Method:     "DELETE",
 		Path:       "/instances/" + domain,
+		Queries:    q,
+		NoResponse: true,
+	})
+	return err
+}
+
+// RestoreInstance is used to cancel the deletion of an instance that is
+// scheduled for deletion.
+func (ac *AdminClient) RestoreInstance(domain string) (*Instance, error) {
+	if !validDomain(domain) {
+		return nil, fmt.Errorf("Invalid domain: %s", domain)
+	}
+	res, err := ac.Req(&request.Options{
+		Method: "POST",
+		Path:   "/instances/" + domain + "/restore",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readInstance(res)
+}
+
+// ActivateInstanceMaintenance puts an instance in maintenance: the routes are
+// closed, except for the allowed IP addresses, and the jobs are paused.
+func (ac *AdminClient) ActivateInstanceMaintenance(domain string, maintenance *InstanceMaintenance) error {
+	if !validDomain(domain) {
+		return fmt.Errorf("Invalid domain: %s", domain)
+	}
+	body, err := json.Marshal(maintenance)
+	if err != nil {
+		return err
+	}
+	_, err = ac.Req(&request.Options{
+		Method:     "PUT",
+		Path:       "/instances/" + domain + "/maintenance",
+		Headers:    request.Headers{"Content-Type": "application/json"},
+		Body:       bytes.NewReader(body),
+		NoResponse: true,
+	})
+	return err
+}
+
+// DeactivateInstanceMaintenance ends the maintenance of an instance, and
+// resumes the paused jobs.
+func (ac *AdminClient) DeactivateInstanceMaintenance(domain string) error {
+	if !validDomain(domain) {
+		return fmt.Errorf("Invalid domain: %s", domain)
+	}
+	_, err := ac.Req(&request.Options{
+		Method:     "DELETE",
+		Path:       "/instances/" + domain + "/maintenance",
+		NoResponse: true,
+	})
+	return err
+}
+
+// ActivateInstanceLegalHold puts an instance under legal hold: the
+// destructive operations are rejected until the hold is lifted.
+func (ac *AdminClient) ActivateInstanceLegalHold(domain string, hold *InstanceLegalHold) error {
+	if !validDomain(domain) {
+		return fmt.Errorf("Invalid domain: %s", domain)
+	}
+	body, err := json.Marshal(hold)
+	if err != nil {
+		return err
+	}
+	_, err = ac.Req(&request.Options{
+		Method:     "PUT",
+		Path:       "/instances/" + domain + "/legal_hold",
+		Headers:    request.Headers{"Content-Type": "application/json"},
+		Body:       bytes.NewReader(body),
+		NoResponse: true,
+	})
+	return err
+}
+
+// DeactivateInstanceLegalHold lifts the legal hold of an instance.
+func (ac *AdminClient) DeactivateInstanceLegalHold(domain string) error {
+	if !validDomain(domain) {
+		return fmt.Errorf("Invalid domain: %s", domain)
+	}
+	_, err := ac.Req(&request.Options{
+		Method:     "DELETE",
+		Path:       "/instances/" + domain + "/legal_hold",
 		NoResponse: true,
 	})
 	return err
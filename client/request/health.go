@@ -0,0 +1,95 @@
+package request
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrHostBlacklisted is used when a request is not made because the remote
+// host has failed too many times recently.
+var ErrHostBlacklisted = errors.New("the host is temporarily blacklisted after too many failures")
+
+// hostsHealth tracks the consecutive failures of the requests per host. When
+// a host has failed threshold times in a row, it is blacklisted for a while,
+// so that the requests to the other hosts are not stuck behind the requests
+// to a host that is down.
+type hostsHealth struct {
+	mu        sync.Mutex
+	threshold int
+	duration  time.Duration
+	hosts     map[string]*hostHealth
+}
+
+type hostHealth struct {
+	failures int
+	until    time.Time
+}
+
+var health = &hostsHealth{hosts: make(map[string]*hostHealth)}
+
+// ConfigureHealth sets the number of consecutive failures after which a host
+// is blacklisted, and for how long. A threshold of 0 disables the
+// blacklisting.
+func ConfigureHealth(threshold int, duration time.Duration) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.threshold = threshold
+	health.duration = duration
+	health.hosts = make(map[string]*hostHealth)
+}
+
+func (h *hostsHealth) isBlacklisted(host string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.threshold <= 0 {
+		return false
+	}
+	state, ok := h.hosts[host]
+	if !ok || state.until.IsZero() {
+		return false
+	}
+	if now.Before(state.until) {
+		return true
+	}
+	// The blacklisting has expired, and the next request will tell if the
+	// host is healthy again. If it fails, the host is blacklisted again
+	// immediately.
+	state.until = time.Time{}
+	state.failures = h.threshold - 1
+	return false
+}
+
+func (h *hostsHealth) failure(host string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.threshold <= 0 {
+		return
+	}
+	state, ok := h.hosts[host]
+	if !ok {
+		state = &hostHealth{}
+		h.hosts[host] = state
+	}
+	state.failures++
+	if state.failures >= h.threshold {
+		state.until = now.Add(h.duration)
+	}
+}
+
+func (h *hostsHealth) success(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.hosts, host)
+}
+
+// isUnhealthyStatus returns true for the status codes that are sent when the
+// remote host is down or overloaded.
+func isUnhealthyStatus(code int) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package request
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostsHealth(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Disabled", func(t *testing.T) {
+		h := &hostsHealth{hosts: make(map[string]*hostHealth)}
+		for i := 0; i < 10; i++ {
+			h.failure("alice.example.net", now)
+		}
+		assert.False(t, h.isBlacklisted("alice.example.net", now))
+	})
+
+	t.Run("Blacklisted", func(t *testing.T) {
+		h := &hostsHealth{threshold: 3, duration: time.Minute, hosts: make(map[string]*hostHealth)}
+		h.failure("alice.example.net", now)
+		h.failure("alice.example.net", now)
+		assert.False(t, h.isBlacklisted("alice.example.net", now))
+		h.failure("alice.example.net", now)
+		assert.True(t, h.isBlacklisted("alice.example.net", now))
+		assert.False(t, h.isBlacklisted("bob.example.net", now))
+
+		// After the blacklist duration, a request can be tried again, and a
+		// single failure blacklists the host again
+		later := now.Add(2 * time.Minute)
+		assert.False(t, h.isBlacklisted("alice.example.net", later))
+		h.failure("alice.example.net", later)
+		assert.True(t, h.isBlacklisted("alice.example.net", later))
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		h := &hostsHealth{threshold: 2, duration: time.Minute, hosts: make(map[string]*hostHealth)}
+		h.failure("alice.example.net", now)
+		h.success("alice.example.net")
+		h.failure("alice.example.net", now)
+		assert.False(t, h.isBlacklisted("alice.example.net", now))
+	})
+
+	t.Run("UnhealthyStatus", func(t *testing.T) {
+		assert.True(t, isUnhealthyStatus(503))
+		assert.True(t, isUnhealthyStatus(502))
+		assert.False(t, isUnhealthyStatus(500))
+		assert.False(t, isUnhealthyStatus(404))
+	})
+}
@@ -0,0 +1,51 @@
+package request
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/cozy/cozy-stack/pkg/safehttp"
+)
+
+// instancesClients are the http clients used for the requests between
+// instances (sharings, moves). They share the same connection pool, with
+// keep-alive, but the streaming one has no timeout, as the transfer of a file
+// content can take longer than the timeout of the API calls.
+type instancesClients struct {
+	mu        sync.RWMutex
+	api       *http.Client
+	streaming *http.Client
+}
+
+var instances = &instancesClients{
+	api:       safehttp.ClientWithKeepAlive,
+	streaming: safehttp.ClientWithKeepAlive,
+}
+
+// ConfigureInstancesClients creates the http clients used for the requests
+// between instances with the given options. The other requests still use
+// safehttp.DefaultClient by default.
+func ConfigureInstancesClients(opts safehttp.ClientOptions) {
+	api := safehttp.NewClient(opts)
+	streaming := &http.Client{Transport: api.Transport}
+	instances.mu.Lock()
+	defer instances.mu.Unlock()
+	instances.api = api
+	instances.streaming = streaming
+}
+
+// InstancesClient returns the http client for the API calls to another
+// instance.
+func InstancesClient() *http.Client {
+	instances.mu.RLock()
+	defer instances.mu.RUnlock()
+	return instances.api
+}
+
+// InstancesStreamingClient returns the http client for sending or receiving
+// a file content to or from another instance. It has no timeout.
+func InstancesStreamingClient() *http.Client {
+	instances.mu.RLock()
+	defer instances.mu.RUnlock()
+	return instances.streaming
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/cozy/cozy-stack/pkg/safehttp"
 )
@@ -148,10 +149,19 @@ func Req(opts *Options) (*http.Response, error) {
 		client = safehttp.DefaultClient
 	}
 
+	if health.isBlacklisted(host, time.Now()) {
+		return nil, ErrHostBlacklisted
+	}
 	res, err := client.Do(req)
 	if err != nil {
+		health.failure(host, time.Now())
 		return nil, err
 	}
+	if isUnhealthyStatus(res.StatusCode) {
+		health.failure(host, time.Now())
+	} else {
+		health.success(host)
+	}
 
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
 		return res, parseError(opts, res)
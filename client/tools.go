@@ -17,3 +17,14 @@ func (ac *AdminClient) ProfileHeap() (io.ReadCloser, error) {
 	}
 	return res.Body, nil
 }
+
+// ReloadSecrets asks the stack to fetch again the secrets of its
+// configuration from Vault and the SOPS files.
+func (ac *AdminClient) ReloadSecrets() error {
+	_, err := ac.Req(&request.Options{
+		Method:     "POST",
+		Path:       "/tools/secrets/reload",
+		NoResponse: true,
+	})
+	return err
+}
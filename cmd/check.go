@@ -16,6 +16,7 @@ var flagCheckFSIndexIntegrity bool
 var flagCheckFSFilesConsistensy bool
 var flagCheckFSFailFast bool
 var flagCheckSharingsFast bool
+var flagCheckSharingsRepair bool
 
 var checkCmdGroup = &cobra.Command{
 	Use:   "check <command>",
@@ -192,6 +193,11 @@ There are 2 steps:
 
 By default, both operations are done, but you can choose to skip the consistency
 check via the flags.
+
+With the --repair flag, the problems that can be fixed safely are repaired: the
+missing triggers are recreated, the files missing for a member are pushed
+again, and the names and parents of the files are reconciled with the version
+of the owner. Each repair is recorded in the output.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
@@ -205,6 +211,7 @@ check via the flags.
 			Path:   "/instances/" + url.PathEscape(domain) + "/checks/sharings",
 			Queries: url.Values{
 				"SkipFSConsistency": {strconv.FormatBool(flagCheckSharingsFast)},
+				"Repair":            {strconv.FormatBool(flagCheckSharingsRepair)},
 			},
 		})
 		if err != nil {
@@ -237,6 +244,7 @@ func init() {
 	checkFSCmd.Flags().BoolVar(&flagCheckFSFilesConsistensy, "files-consistency", false, "Check the files consistency only (between CouchDB and Swift)")
 	checkFSCmd.Flags().BoolVar(&flagCheckFSFailFast, "fail-fast", false, "Stop the FSCK on the first error")
 	checkSharingsCmd.Flags().BoolVar(&flagCheckSharingsFast, "fast", false, "Skip the sharings FS consistency check")
+	checkSharingsCmd.Flags().BoolVar(&flagCheckSharingsRepair, "repair", false, "Repair the problems that can be fixed safely")
 
 	RootCmd.AddCommand(checkCmdGroup)
 }
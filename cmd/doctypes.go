@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/spf13/cobra"
+)
+
+var flagQuerySelector string
+var flagQueryFields []string
+var flagQuerySort string
+var flagQueryUseIndex string
+var flagQueryLimit int
+var flagQueryUnoptimized bool
+
+var doctypesCmdGroup = &cobra.Command{
+	Use:   "doctypes <command>",
+	Short: "Inspect the documents of an instance",
+}
+
+var queryDoctypeCmd = &cobra.Command{
+	Use:   "query <domain> <doctype>",
+	Short: "Execute a read-only Mango query on a doctype",
+	Long: `
+cozy-stack doctypes query executes a Mango query on the database of an
+instance for the given doctype, and prints the documents, one JSON per line.
+
+The query must be able to use an index, except if the --unoptimized flag is
+given. The number of documents is limited by the --limit flag (100 by default,
+10000 at most).
+`,
+	Example: `$ cozy-stack doctypes query alice.cozy.localhost io.cozy.files --selector '{"dir_id": "io.cozy.files.root-dir"}' --fields _id,name`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return cmd.Usage()
+		}
+		var selector map[string]interface{}
+		if err := json.Unmarshal([]byte(flagQuerySelector), &selector); err != nil {
+			return errors.New("The selector is not valid JSON")
+		}
+		query := map[string]interface{}{"selector": selector}
+		if len(flagQueryFields) > 0 {
+			query["fields"] = flagQueryFields
+		}
+		if flagQuerySort != "" {
+			var sort interface{}
+			if err := json.Unmarshal([]byte(flagQuerySort), &sort); err != nil {
+				return errors.New("The sort is not valid JSON")
+			}
+			query["sort"] = sort
+		}
+		if flagQueryUseIndex != "" {
+			query["use_index"] = flagQueryUseIndex
+		}
+		body, err := json.Marshal(query)
+		if err != nil {
+			return err
+		}
+
+		ac := newAdminClient()
+		res, err := ac.Req(&request.Options{
+			Method: "POST",
+			Path:   "/instances/" + url.PathEscape(args[0]) + "/doctypes/" + url.PathEscape(args[1]) + "/query",
+			Queries: url.Values{
+				"Limit":       {strconv.Itoa(flagQueryLimit)},
+				"Unoptimized": {strconv.FormatBool(flagQueryUnoptimized)},
+			},
+			Body: bytes.NewReader(body),
+		})
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, err = io.Copy(os.Stdout, res.Body)
+		return err
+	},
+}
+
+func init() {
+	doctypesCmdGroup.AddCommand(queryDoctypeCmd)
+	queryDoctypeCmd.Flags().StringVar(&flagQuerySelector, "selector", "{}", "The Mango selector, in JSON")
+	queryDoctypeCmd.Flags().StringSliceVar(&flagQueryFields, "fields", nil, "The fields to return (all by default)")
+	queryDoctypeCmd.Flags().StringVar(&flagQuerySort, "sort", "", "The sort, in JSON (e.g. '[{\"name\": \"asc\"}]')")
+	queryDoctypeCmd.Flags().StringVar(&flagQueryUseIndex, "use-index", "", "The design doc of the index to use")
+	queryDoctypeCmd.Flags().IntVar(&flagQueryLimit, "limit", 100, "The maximal number of documents")
+	queryDoctypeCmd.Flags().BoolVar(&flagQueryUnoptimized, "unoptimized", false, "Allow the queries that cannot use an index")
+	RootCmd.AddCommand(doctypesCmdGroup)
+}
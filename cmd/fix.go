@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/cozy/cozy-stack/client"
@@ -414,9 +415,94 @@ this instance are correctly set.
 	},
 }
 
+var referencesFixer = &cobra.Command{
+	Use:   "references <domain>",
+	Short: "Remove the references to deleted documents on files",
+	Long: `
+This fixer pushes a job to remove the references on the files and directories
+to the albums and sharings that have been deleted. The number of dangling
+references for each doctype is written in the logs of the job.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return cmd.Usage()
+		}
+		domain := args[0]
+
+		buf := new(bytes.Buffer)
+		body := struct {
+			DryRun bool `json:"dry_run"`
+		}{
+			DryRun: dryRunFlag,
+		}
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+
+		c := newAdminClient()
+		res, err := c.Req(&request.Options{
+			Method: "POST",
+			Path:   "/instances/" + url.PathEscape(domain) + "/fixers/references",
+			Body:   bytes.NewReader(buf.Bytes()),
+		})
+		if err != nil {
+			return err
+		}
+		out, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	},
+}
+
+var sharingCheckpointsFixer = &cobra.Command{
+	Use:   "sharing-checkpoints <domain> <sharing-id> <member-index>",
+	Short: "Reset the replication checkpoints of a sharing for a member",
+	Long: `
+This fixer resets the checkpoints of the replication of a sharing to a member
+(0 for the owner, 1 for the first recipient, etc.). The shared documents are
+compared with those of the member, the missing documents are sent, and the
+files are checked again for the upload.
+`,
+	Example: `$ cozy-stack fix sharing-checkpoints alice.cozy.localhost 7f47c470c7b1013a8a8818c04daba326 1`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 3 {
+			return cmd.Usage()
+		}
+		domain := args[0]
+		index, err := strconv.Atoi(args[2])
+		if err != nil {
+			return cmd.Usage()
+		}
+
+		buf := new(bytes.Buffer)
+		body := struct {
+			SharingID   string `json:"sharing_id"`
+			MemberIndex int    `json:"member_index"`
+		}{
+			SharingID:   args[1],
+			MemberIndex: index,
+		}
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+
+		c := newAdminClient()
+		_, err = c.Req(&request.Options{
+			Method: "POST",
+			Path:   "/instances/" + url.PathEscape(domain) + "/fixers/sharing-checkpoints",
+			Body:   bytes.NewReader(buf.Bytes()),
+		})
+		return err
+	},
+}
+
 func init() {
 	thumbnailsFixer.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Dry run")
 	thumbnailsFixer.Flags().BoolVar(&withMetadataFlag, "with-metadata", false, "Recalculate images metadata")
+	referencesFixer.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Only count the dangling references")
 	contentMismatch64Kfixer.Flags().BoolVar(&noDryRunFlag, "no-dry-run", false, "Do not dry run")
 
 	fixerCmdGroup.AddCommand(jobsFixer)
@@ -429,6 +515,8 @@ func init() {
 	fixerCmdGroup.AddCommand(orphanAccountFixer)
 	fixerCmdGroup.AddCommand(serviceTriggersFixer)
 	fixerCmdGroup.AddCommand(indexesFixer)
+	fixerCmdGroup.AddCommand(referencesFixer)
+	fixerCmdGroup.AddCommand(sharingCheckpointsFixer)
 
 	RootCmd.AddCommand(fixerCmdGroup)
 }
@@ -41,6 +41,7 @@ var flagDev bool
 var flagTrace bool
 var flagPassphrase string
 var flagForce bool
+var flagNow bool
 var flagJSON bool
 var flagForceRegistry bool
 var flagOnlyRegistry bool
@@ -64,6 +65,10 @@ var flagOnboardingApp string
 var flagOnboardingPermissions string
 var flagOnboardingState string
 var flagPath string
+var flagMaintenanceMessage string
+var flagAllowedIPs []string
+var flagLegalHoldReason string
+var flagLegalHoldActor string
 
 // instanceCmdGroup represents the instances command
 var instanceCmdGroup = &cobra.Command{
@@ -609,6 +614,11 @@ var destroyInstanceCmd = &cobra.Command{
 	Long: `
 cozy-stack instances destroy allows to remove an instance
 and all its data.
+
+If a grace period is configured (destroy_grace_period), the instance is
+only scheduled for deletion and can be restored with
+cozy-stack instances restore until the end of this period. Use --now to
+remove it immediately.
 `,
 	Aliases: []string{"rm", "delete", "remove"},
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -628,14 +638,149 @@ and all its data.
 		}
 
 		ac := newAdminClient()
-		err := ac.DestroyInstance(domain)
+		err := ac.DestroyInstance(domain, flagNow)
 		if err != nil {
 			errPrintfln(
 				"An error occurred while destroying instance for domain %s", domain)
 			return err
 		}
 
-		fmt.Printf("Instance for domain %s has been destroyed with success\n", domain)
+		if flagNow {
+			fmt.Printf("Instance for domain %s has been destroyed with success\n", domain)
+		} else {
+			fmt.Printf("Deletion of the instance for domain %s has been requested with success\n", domain)
+		}
+		return nil
+	},
+}
+
+var restoreInstanceCmd = &cobra.Command{
+	Use:   "restore <domain>",
+	Short: "Cancel the scheduled deletion of an instance",
+	Long: `
+cozy-stack instances restore allows to cancel the deletion of an instance
+that has been scheduled for deletion and is still in its grace period.
+`,
+	Example: "$ cozy-stack instances restore alice.cozy.localhost:8080",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return cmd.Usage()
+		}
+		domain := args[0]
+		ac := newAdminClient()
+		if _, err := ac.RestoreInstance(domain); err != nil {
+			errPrintfln(
+				"An error occurred while restoring instance for domain %s", domain)
+			return err
+		}
+		fmt.Printf("Instance for domain %s has been restored with success\n", domain)
+		return nil
+	},
+}
+
+var maintenanceInstanceCmd = &cobra.Command{
+	Use:   "maintenance <domain>",
+	Short: "Put an instance in maintenance",
+	Long: `
+cozy-stack instances maintenance puts an instance in maintenance: all the
+routes respond with a 503 and a maintenance page, except for the requests made
+via the CLI and from the allowed IP addresses. The jobs are paused, and they
+will be resumed when the maintenance is deactivated.
+
+It can also be used to update the message and the allowlist of an instance
+already in maintenance.
+`,
+	Example: "$ cozy-stack instances maintenance alice.cozy.localhost:8080 --message 'Back in 1 hour' --allowed-ips 192.168.0.0/24",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return cmd.Usage()
+		}
+		domain := args[0]
+		ac := newAdminClient()
+		err := ac.ActivateInstanceMaintenance(domain, &client.InstanceMaintenance{
+			Message:    flagMaintenanceMessage,
+			AllowedIPs: flagAllowedIPs,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Instance for domain %s is now in maintenance\n", domain)
+		return nil
+	},
+}
+
+var deactivateMaintenanceInstanceCmd = &cobra.Command{
+	Use:   "deactivate-maintenance <domain>",
+	Short: "End the maintenance of an instance",
+	Long: `
+cozy-stack instances deactivate-maintenance ends the maintenance of an
+instance, and resumes the jobs that have been paused during the maintenance
+(only one job is resumed for each trigger).
+`,
+	Example: "$ cozy-stack instances deactivate-maintenance alice.cozy.localhost:8080",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return cmd.Usage()
+		}
+		domain := args[0]
+		ac := newAdminClient()
+		if err := ac.DeactivateInstanceMaintenance(domain); err != nil {
+			return err
+		}
+		fmt.Printf("Instance for domain %s is no longer in maintenance\n", domain)
+		return nil
+	},
+}
+
+var legalHoldInstanceCmd = &cobra.Command{
+	Use:   "legal-hold <domain>",
+	Short: "Put an instance under legal hold",
+	Long: `
+cozy-stack instances legal-hold freezes an instance for a legal investigation:
+the destructive operations (destroying a file, deleting a document or an
+account, revoking a sharing, destroying the instance) are rejected with a 423
+Locked error, while the data can still be read and created.
+
+The reason and the actor who has asked for the hold are required. It can also
+be used to update them for an instance already under legal hold.
+`,
+	Example: "$ cozy-stack instances legal-hold alice.cozy.localhost:8080 --reason 'Investigation #42' --actor 'Legal department'",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return cmd.Usage()
+		}
+		domain := args[0]
+		ac := newAdminClient()
+		err := ac.ActivateInstanceLegalHold(domain, &client.InstanceLegalHold{
+			Reason: flagLegalHoldReason,
+			Actor:  flagLegalHoldActor,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Instance for domain %s is now under legal hold\n", domain)
+		return nil
+	},
+}
+
+var liftLegalHoldInstanceCmd = &cobra.Command{
+	Use:   "lift-legal-hold <domain>",
+	Short: "Lift the legal hold of an instance",
+	Long: `
+cozy-stack instances lift-legal-hold lifts the legal hold of an instance: the
+destructive operations are allowed again.
+`,
+	Example: "$ cozy-stack instances lift-legal-hold alice.cozy.localhost:8080",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return cmd.Usage()
+		}
+		domain := args[0]
+		ac := newAdminClient()
+		if err := ac.DeactivateInstanceLegalHold(domain); err != nil {
+			return err
+		}
+		fmt.Printf("Instance for domain %s is no longer under legal hold\n", domain)
 		return nil
 	},
 }
@@ -1097,6 +1242,11 @@ func init() {
 	instanceCmdGroup.AddCommand(quotaInstanceCmd)
 	instanceCmdGroup.AddCommand(debugInstanceCmd)
 	instanceCmdGroup.AddCommand(destroyInstanceCmd)
+	instanceCmdGroup.AddCommand(restoreInstanceCmd)
+	instanceCmdGroup.AddCommand(maintenanceInstanceCmd)
+	instanceCmdGroup.AddCommand(deactivateMaintenanceInstanceCmd)
+	instanceCmdGroup.AddCommand(legalHoldInstanceCmd)
+	instanceCmdGroup.AddCommand(liftLegalHoldInstanceCmd)
 	instanceCmdGroup.AddCommand(fsckInstanceCmd)
 	instanceCmdGroup.AddCommand(appTokenInstanceCmd)
 	instanceCmdGroup.AddCommand(konnectorTokenInstanceCmd)
@@ -1151,6 +1301,11 @@ func init() {
 	modifyInstanceCmd.Flags().BoolVar(&flagDeleting, "deleting", false, "Set (or remove) the deleting flag (ex: `--deleting=false`)")
 	modifyInstanceCmd.Flags().BoolVar(&flagOnboardingFinished, "onboarding-finished", false, "Force the finishing of the onboarding")
 	destroyInstanceCmd.Flags().BoolVar(&flagForce, "force", false, "Force the deletion without asking for confirmation")
+	destroyInstanceCmd.Flags().BoolVar(&flagNow, "now", false, "Destroy the instance immediately, without waiting for the grace period")
+	maintenanceInstanceCmd.Flags().StringVar(&flagMaintenanceMessage, "message", "", "The message displayed to the user on the maintenance page")
+	maintenanceInstanceCmd.Flags().StringSliceVar(&flagAllowedIPs, "allowed-ips", nil, "IP addresses or CIDR ranges that can still access the instance (separated by ',')")
+	legalHoldInstanceCmd.Flags().StringVar(&flagLegalHoldReason, "reason", "", "The reason of the legal hold")
+	legalHoldInstanceCmd.Flags().StringVar(&flagLegalHoldActor, "actor", "", "The person or the organization that has asked for the legal hold")
 	debugInstanceCmd.Flags().StringVar(&flagDomain, "domain", cozyDomain(), "Specify the domain name of the instance")
 	debugInstanceCmd.Flags().DurationVar(&flagTTL, "ttl", 24*time.Hour, "Specify how long the debug mode will last")
 	fsckInstanceCmd.Flags().BoolVar(&flagCheckFSIndexIntegrity, "index-integrity", false, "Check the index integrity only")
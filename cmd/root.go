@@ -16,7 +16,6 @@ import (
 	"github.com/cozy/cozy-stack/pkg/tlsclient"
 	"github.com/howeyc/gopass"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // DefaultStorageDir is the default directory name in which data
@@ -138,16 +137,16 @@ func init() {
 	flags.StringVarP(&cfgFile, "config", "c", "", "configuration file (default \"$HOME/.cozy.yaml\")")
 
 	flags.String("host", "localhost", "server host")
-	checkNoErr(viper.BindPFlag("host", flags.Lookup("host")))
+	checkNoErr(config.BindPFlag("host", flags.Lookup("host")))
 
 	flags.IntP("port", "p", 8080, "server port")
-	checkNoErr(viper.BindPFlag("port", flags.Lookup("port")))
+	checkNoErr(config.BindPFlag("port", flags.Lookup("port")))
 
 	flags.String("admin-host", "localhost", "administration server host")
-	checkNoErr(viper.BindPFlag("admin.host", flags.Lookup("admin-host")))
+	checkNoErr(config.BindPFlag("admin.host", flags.Lookup("admin-host")))
 
 	flags.Int("admin-port", 6060, "administration server port")
-	checkNoErr(viper.BindPFlag("admin.port", flags.Lookup("admin-port")))
+	checkNoErr(config.BindPFlag("admin.port", flags.Lookup("admin-port")))
 }
 
 func checkNoErr(err error) {
@@ -10,15 +10,16 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/cozy/cozy-stack/model/stack"
 	build "github.com/cozy/cozy-stack/pkg/config"
 	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/utils"
 	"github.com/cozy/cozy-stack/web"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var flagAllowRoot bool
@@ -84,9 +85,14 @@ example), you can use the --appdir flag like this:
 		}
 
 		if flagMailhog {
-			cfg := config.GetConfig()
-			cfg.Mail.DisableTLS = true
-			cfg.Mail.Port = 1025
+			useMailhog := func() error {
+				cfg := config.GetConfig()
+				cfg.Mail.DisableTLS = true
+				cfg.Mail.Port = 1025
+				return nil
+			}
+			_ = useMailhog()
+			config.OnSecretsReload(useMailhog)
 		}
 
 		processes, services, err := stack.Start()
@@ -106,8 +112,21 @@ example), you can use the --appdir flag like this:
 
 		group := utils.NewGroupShutdown(servers, processes)
 
+		// The jobs that have not been started, or not finished before the
+		// end of the shutdown delay, are given back to the broker.
 		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, os.Interrupt)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+		// The secrets can be rotated without a restart with a SIGHUP.
+		hups := make(chan os.Signal, 1)
+		signal.Notify(hups, syscall.SIGHUP)
+		go func() {
+			for range hups {
+				if err := config.ReloadSecrets(); err != nil {
+					logger.WithNamespace("config").Errorf("Cannot reload the secrets: %s", err)
+				}
+			}
+		}()
 
 		select {
 		case err := <-servers.Wait():
@@ -133,113 +152,113 @@ func init() {
 
 	flags := serveCmd.PersistentFlags()
 	flags.String("subdomains", "nested", "how to structure the subdomains for apps (can be nested or flat)")
-	checkNoErr(viper.BindPFlag("subdomains", flags.Lookup("subdomains")))
+	checkNoErr(config.BindPFlag("subdomains", flags.Lookup("subdomains")))
 
 	flags.String("assets", "", "path to the directory with the assets (use the packed assets by default)")
-	checkNoErr(viper.BindPFlag("assets", flags.Lookup("assets")))
+	checkNoErr(config.BindPFlag("assets", flags.Lookup("assets")))
 
 	flags.String("doctypes", "", "path to the directory with the doctypes (for developing/testing a remote doctype)")
-	checkNoErr(viper.BindPFlag("doctypes", flags.Lookup("doctypes")))
+	checkNoErr(config.BindPFlag("doctypes", flags.Lookup("doctypes")))
 
 	defaultFsURL := &url.URL{
 		Scheme: "file",
 		Path:   path.Join(filepath.ToSlash(binDir), DefaultStorageDir),
 	}
 	flags.String("fs-url", defaultFsURL.String(), "filesystem url")
-	checkNoErr(viper.BindPFlag("fs.url", flags.Lookup("fs-url")))
+	checkNoErr(config.BindPFlag("fs.url", flags.Lookup("fs-url")))
 
 	flags.Int("fs-default-layout", -1, "Default layout for Swift (2 for layout v3)")
-	checkNoErr(viper.BindPFlag("fs.default_layout", flags.Lookup("fs-default-layout")))
+	checkNoErr(config.BindPFlag("fs.default_layout", flags.Lookup("fs-default-layout")))
 
 	flags.String("couchdb-url", "http://localhost:5984/", "CouchDB URL")
-	checkNoErr(viper.BindPFlag("couchdb.url", flags.Lookup("couchdb-url")))
+	checkNoErr(config.BindPFlag("couchdb.url", flags.Lookup("couchdb-url")))
 
 	flags.String("lock-url", "", "URL for the locks, redis or in-memory")
-	checkNoErr(viper.BindPFlag("lock.url", flags.Lookup("lock-url")))
+	checkNoErr(config.BindPFlag("lock.url", flags.Lookup("lock-url")))
 
 	flags.String("sessions-url", "", "URL for the sessions storage, redis or in-memory")
-	checkNoErr(viper.BindPFlag("sessions.url", flags.Lookup("sessions-url")))
+	checkNoErr(config.BindPFlag("sessions.url", flags.Lookup("sessions-url")))
 
 	flags.String("downloads-url", "", "URL for the download secret storage, redis or in-memory")
-	checkNoErr(viper.BindPFlag("downloads.url", flags.Lookup("downloads-url")))
+	checkNoErr(config.BindPFlag("downloads.url", flags.Lookup("downloads-url")))
 
 	flags.String("jobs-url", "", "URL for the jobs system synchronization, redis or in-memory")
-	checkNoErr(viper.BindPFlag("jobs.url", flags.Lookup("jobs-url")))
+	checkNoErr(config.BindPFlag("jobs.url", flags.Lookup("jobs-url")))
 
 	flags.String("konnectors-cmd", "", "konnectors command to be executed")
-	checkNoErr(viper.BindPFlag("konnectors.cmd", flags.Lookup("konnectors-cmd")))
+	checkNoErr(config.BindPFlag("konnectors.cmd", flags.Lookup("konnectors-cmd")))
 
 	flags.String("konnectors-oauthstate", "", "URL for the storage of OAuth state for konnectors, redis or in-memory")
-	checkNoErr(viper.BindPFlag("konnectors.oauthstate", flags.Lookup("konnectors-oauthstate")))
+	checkNoErr(config.BindPFlag("konnectors.oauthstate", flags.Lookup("konnectors-oauthstate")))
 
 	flags.String("realtime-url", "", "URL for realtime in the browser via webocket, redis or in-memory")
-	checkNoErr(viper.BindPFlag("realtime.url", flags.Lookup("realtime-url")))
+	checkNoErr(config.BindPFlag("realtime.url", flags.Lookup("realtime-url")))
 
 	flags.String("rate-limiting-url", "", "URL for rate-limiting counters, redis or in-memory")
-	checkNoErr(viper.BindPFlag("rate_limiting.url", flags.Lookup("rate-limiting-url")))
+	checkNoErr(config.BindPFlag("rate_limiting.url", flags.Lookup("rate-limiting-url")))
 
 	flags.String("log-level", "info", "define the log level")
-	checkNoErr(viper.BindPFlag("log.level", flags.Lookup("log-level")))
+	checkNoErr(config.BindPFlag("log.level", flags.Lookup("log-level")))
 
 	flags.Bool("log-syslog", false, "use the local syslog for logging")
-	checkNoErr(viper.BindPFlag("log.syslog", flags.Lookup("log-syslog")))
+	checkNoErr(config.BindPFlag("log.syslog", flags.Lookup("log-syslog")))
 
 	flags.StringSlice("flagship-apk-package-names", []string{"io.cozy.drive.mobile", "io.cozy.flagship.mobile"}, "Package name for the flagship app on android")
-	checkNoErr(viper.BindPFlag("flagship.apk_package_names", flags.Lookup("flagship-apk-package-names")))
+	checkNoErr(config.BindPFlag("flagship.apk_package_names", flags.Lookup("flagship-apk-package-names")))
 
 	flags.StringSlice("flagship-apk-certificate-digests", []string{"u2eUUnfB4Y7k7eqQL7u2jiYDJeVBwZoSV3PZSs8pttc="}, "SHA-256 hash (base64 encoded) of the flagship app's signing certificate on android")
-	checkNoErr(viper.BindPFlag("flagship.apk_certificate_digests", flags.Lookup("flagship-apk-certificate-digests")))
+	checkNoErr(config.BindPFlag("flagship.apk_certificate_digests", flags.Lookup("flagship-apk-certificate-digests")))
 
 	flags.StringSlice("flagship-apple-app-ids", []string{"3AKXFMV43J.io.cozy.drive.mobile", "3AKXFMV43J.io.cozy.flagship.mobile"}, "App ID of the flagship app on iOS")
-	checkNoErr(viper.BindPFlag("flagship.apple_app_ids", flags.Lookup("flagship-apple-app-ids")))
+	checkNoErr(config.BindPFlag("flagship.apple_app_ids", flags.Lookup("flagship-apple-app-ids")))
 
 	flags.String("hooks", ".", "define the directory used for hook scripts")
-	checkNoErr(viper.BindPFlag("hooks", flags.Lookup("hooks")))
+	checkNoErr(config.BindPFlag("hooks", flags.Lookup("hooks")))
 
 	flags.String("geodb", ".", "define the location of the database for IP -> City lookups")
-	checkNoErr(viper.BindPFlag("geodb", flags.Lookup("geodb")))
+	checkNoErr(config.BindPFlag("geodb", flags.Lookup("geodb")))
 
 	flags.String("mail-alert-address", "", "mail address used for alerts (instance deletion failure for example)")
-	checkNoErr(viper.BindPFlag("mail.alert_address", flags.Lookup("mail-alert-address")))
+	checkNoErr(config.BindPFlag("mail.alert_address", flags.Lookup("mail-alert-address")))
 
 	flags.String("mail-noreply-address", "", "mail address used for sending mail as a noreply (forgot passwords for example)")
-	checkNoErr(viper.BindPFlag("mail.noreply_address", flags.Lookup("mail-noreply-address")))
+	checkNoErr(config.BindPFlag("mail.noreply_address", flags.Lookup("mail-noreply-address")))
 
 	flags.String("mail-noreply-name", "", "mail name used for sending mail as a noreply (forgot passwords for example)")
-	checkNoErr(viper.BindPFlag("mail.noreply_name", flags.Lookup("mail-noreply-name")))
+	checkNoErr(config.BindPFlag("mail.noreply_name", flags.Lookup("mail-noreply-name")))
 
 	flags.String("mail-reply-to", "", "mail address used to the reply-to (support for example)")
-	checkNoErr(viper.BindPFlag("mail.reply_to", flags.Lookup("mail-reply-to")))
+	checkNoErr(config.BindPFlag("mail.reply_to", flags.Lookup("mail-reply-to")))
 
 	flags.String("mail-host", "localhost", "mail smtp host")
-	checkNoErr(viper.BindPFlag("mail.host", flags.Lookup("mail-host")))
+	checkNoErr(config.BindPFlag("mail.host", flags.Lookup("mail-host")))
 
 	flags.Int("mail-port", 465, "mail smtp port")
-	checkNoErr(viper.BindPFlag("mail.port", flags.Lookup("mail-port")))
+	checkNoErr(config.BindPFlag("mail.port", flags.Lookup("mail-port")))
 
 	flags.String("mail-username", "", "mail smtp username")
-	checkNoErr(viper.BindPFlag("mail.username", flags.Lookup("mail-username")))
+	checkNoErr(config.BindPFlag("mail.username", flags.Lookup("mail-username")))
 
 	flags.String("mail-password", "", "mail smtp password")
-	checkNoErr(viper.BindPFlag("mail.password", flags.Lookup("mail-password")))
+	checkNoErr(config.BindPFlag("mail.password", flags.Lookup("mail-password")))
 
 	flags.Bool("mail-disable-tls", false, "disable smtp over tls")
-	checkNoErr(viper.BindPFlag("mail.disable_tls", flags.Lookup("mail-disable-tls")))
+	checkNoErr(config.BindPFlag("mail.disable_tls", flags.Lookup("mail-disable-tls")))
 
 	flags.String("move-url", "https://move.cozycloud.cc/", "URL for the move wizard")
-	checkNoErr(viper.BindPFlag("move.url", flags.Lookup("move-url")))
+	checkNoErr(config.BindPFlag("move.url", flags.Lookup("move-url")))
 
 	flags.String("onlyoffice-url", "", "URL for the OnlyOffice server")
-	checkNoErr(viper.BindPFlag("office.default.onlyoffice_url", flags.Lookup("onlyoffice-url")))
+	checkNoErr(config.BindPFlag("office.default.onlyoffice_url", flags.Lookup("onlyoffice-url")))
 
 	flags.String("onlyoffice-outbox-secret", "", "Secret used for verifying requests from the OnlyOffice server")
-	checkNoErr(viper.BindPFlag("office.default.onlyoffice_outbox_secret", flags.Lookup("onlyoffice-outbox-secret")))
+	checkNoErr(config.BindPFlag("office.default.onlyoffice_outbox_secret", flags.Lookup("onlyoffice-outbox-secret")))
 
 	flags.String("onlyoffice-inbox-secret", "", "Secret used for signing requests to the OnlyOffice server")
-	checkNoErr(viper.BindPFlag("office.default.onlyoffice_inbox_secret", flags.Lookup("onlyoffice-inbox-secret")))
+	checkNoErr(config.BindPFlag("office.default.onlyoffice_inbox_secret", flags.Lookup("onlyoffice-inbox-secret")))
 
 	flags.String("password-reset-interval", "15m", "minimal duration between two password reset")
-	checkNoErr(viper.BindPFlag("password_reset_interval", flags.Lookup("password-reset-interval")))
+	checkNoErr(config.BindPFlag("password_reset_interval", flags.Lookup("password-reset-interval")))
 
 	flags.BoolVar(&flagMailhog, "mailhog", false, "Alias of --mail-disable-tls --mail-port 1025, useful for MailHog")
 	flags.BoolVar(&flagDevMode, "dev", false, "Allow to run in dev mode for a prod release (disabled by default)")
@@ -247,19 +266,19 @@ func init() {
 	flags.StringSliceVar(&flagAppdirs, "appdir", nil, "Mount a directory as the 'app' application")
 
 	flags.Bool("remote-allow-custom-port", false, "Allow to specify a port in request files for remote doctypes")
-	checkNoErr(viper.BindPFlag("remote_allow_custom_port", flags.Lookup("remote-allow-custom-port")))
+	checkNoErr(config.BindPFlag("remote_allow_custom_port", flags.Lookup("remote-allow-custom-port")))
 
 	flags.Bool("disable-csp", false, "Disable the Content Security Policy (only available for development)")
-	checkNoErr(viper.BindPFlag("disable_csp", flags.Lookup("disable-csp")))
+	checkNoErr(config.BindPFlag("disable_csp", flags.Lookup("disable-csp")))
 
 	flags.String("csp-allowlist", "", "Add domains for the default allowed origins of the Content Secury Policy")
-	checkNoErr(viper.BindPFlag("csp_allowlist", flags.Lookup("csp-allowlist")))
+	checkNoErr(config.BindPFlag("csp_allowlist", flags.Lookup("csp-allowlist")))
 
 	flags.String("vault-decryptor-key", "", "the path to the key used to decrypt credentials")
-	checkNoErr(viper.BindPFlag("vault.credentials_decryptor_key", flags.Lookup("vault-decryptor-key")))
+	checkNoErr(config.BindPFlag("vault.credentials_decryptor_key", flags.Lookup("vault-decryptor-key")))
 
 	flags.String("vault-encryptor-key", "", "the path to the key used to encrypt credentials")
-	checkNoErr(viper.BindPFlag("vault.credentials_encryptor_key", flags.Lookup("vault-encryptor-key")))
+	checkNoErr(config.BindPFlag("vault.credentials_encryptor_key", flags.Lookup("vault-encryptor-key")))
 
 	RootCmd.AddCommand(serveCmd)
 }
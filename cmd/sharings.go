@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/spf13/cobra"
+)
+
+var flagSharingsDebugFast bool
+
+var sharingsCmdGroup = &cobra.Command{
+	Use:     "sharings <command>",
+	Aliases: []string{"sharing"},
+	Short:   "Inspect the sharings",
+}
+
+var sharingsDebugCmd = &cobra.Command{
+	Use:   "debug <domain> <sharing-id>",
+	Short: "Dump everything about a sharing",
+	Long: `
+This command inspects a sharing on all the instances of this stack that are
+members of it, starting from the given instance. It can be used for the
+support escalations, as a focused version of "cozy-stack check sharings".
+
+It dumps:
+
+- the members of the sharing, and if their instances are on this stack
+- the triggers of the sharing on each instance, and if they still exist
+- the credentials for the members, with an introspection of the tokens when
+  they have been issued by an instance of this stack
+- the checkpoints of the replications, with the number of shared documents
+  that have changed since
+- the problems found by the checks, including a diff of the trees of files
+  between the owner and the recipients (it can be skipped with --fast).
+
+The command exits with a non-zero status if a problem has been found.
+`,
+	Example: `$ cozy-stack sharings debug alice.cozy.localhost:8080 7f47c470c7b1013a8a8818c04daba326`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return cmd.Usage()
+		}
+		ac := newAdminClient()
+		res, err := ac.Req(&request.Options{
+			Method: "GET",
+			Path:   "/instances/" + url.PathEscape(args[0]) + "/sharings/" + url.PathEscape(args[1]) + "/debug",
+			Queries: url.Values{
+				"SkipFSConsistency": {strconv.FormatBool(flagSharingsDebugFast)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		var report struct {
+			Checks []map[string]interface{} `json:"checks"`
+		}
+		var raw json.RawMessage
+		if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, &report); err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		if len(report.Checks) > 0 {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func init() {
+	sharingsDebugCmd.Flags().BoolVar(&flagSharingsDebugFast, "fast", false, "Skip the diff of the trees of files")
+	sharingsCmdGroup.AddCommand(sharingsDebugCmd)
+	RootCmd.AddCommand(sharingsCmdGroup)
+}
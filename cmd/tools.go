@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
@@ -17,7 +18,9 @@ import (
 
 	"github.com/cozy/cozy-stack/client/request"
 	"github.com/cozy/cozy-stack/cmd/browser"
+	"github.com/cozy/cozy-stack/model/move"
 	build "github.com/cozy/cozy-stack/pkg/config"
+	"github.com/howeyc/gopass"
 	"github.com/spf13/cobra"
 )
 
@@ -53,6 +56,25 @@ See https://go.dev/doc/diagnostics#profiling.
 	},
 }
 
+var reloadSecretsCmd = &cobra.Command{
+	Use:   "reload-secrets",
+	Short: "Fetch again the secrets of the configuration",
+	Long: `
+This command asks the stack to read again its configuration files, with fresh
+values for the secrets taken from Vault and the SOPS files, and to use them
+without a restart. It is the same as sending a SIGHUP to the stack.
+
+The credentials for CouchDB, Swift and the SMTP servers, the keys for the push
+notifications, and the contexts are reloaded. The other parameters of the
+configuration still need a restart to be changed.
+`,
+	Example: "$ cozy-stack tools reload-secrets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ac := newAdminClient()
+		return ac.ReloadSecrets()
+	},
+}
+
 var unxorDocumentID = &cobra.Command{
 	Use:   "unxor-document-id <domain> <sharing_id> <document_id>",
 	Short: "transform the id of a shared document",
@@ -134,6 +156,53 @@ func getEncryptKey(key []byte) (*rsa.PublicKey, error) {
 	return &privateKey.(*rsa.PrivateKey).PublicKey, nil
 }
 
+var decryptExportCmd = &cobra.Command{
+	Use:   "decrypt-export <input> <output>",
+	Short: "decrypt a part of an export protected by a passphrase",
+	Long: `
+This command can be used to decrypt a part of an export that has been requested
+with a passphrase. The input is the downloaded file (.zip.enc), and the output
+is the zip file. The passphrase is asked on the terminal, or it can be given
+with the COZY_EXPORT_PASSPHRASE env variable.
+
+It can also decrypt the archive of an escrow export, with the passphrase from
+the escrow section of the configuration file.
+`,
+	Example: `$ cozy-stack tools decrypt-export "My Cozy.zip.enc" "My Cozy.zip"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return cmd.Usage()
+		}
+		passphrase := os.Getenv("COZY_EXPORT_PASSPHRASE")
+		if passphrase == "" {
+			errPrintf("Passphrase: ")
+			pass, err := gopass.GetPasswdPrompt("", false, os.Stdin, os.Stderr)
+			if err != nil {
+				return err
+			}
+			passphrase = string(pass)
+		}
+
+		in, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		err = move.DecryptArchive(out, bufio.NewReader(in), passphrase)
+		if errc := out.Close(); errc != nil && err == nil {
+			err = errc
+		}
+		if err != nil {
+			_ = os.Remove(args[1])
+		}
+		return err
+	},
+}
+
 const bugHeader = `Please answer these questions before submitting your issue. Thanks!
 
 
@@ -200,8 +269,10 @@ The report includes useful system information.
 
 func init() {
 	toolsCmdGroup.AddCommand(heapCmd)
+	toolsCmdGroup.AddCommand(reloadSecretsCmd)
 	toolsCmdGroup.AddCommand(unxorDocumentID)
 	toolsCmdGroup.AddCommand(encryptRSACmd)
+	toolsCmdGroup.AddCommand(decryptExportCmd)
 	toolsCmdGroup.AddCommand(bugCmd)
 	RootCmd.AddCommand(toolsCmdGroup)
 }
@@ -0,0 +1,204 @@
+// Package accesslog is used to record the reads made via the data API on the
+// doctypes for which the user has enabled the access logs, like the bank
+// operations, so that the user can know which apps have read their data.
+package accesslog
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// batchSize is the number of entries loaded at once for the summary and the
+// clean of the access logs.
+const batchSize = 1000
+
+// Entry is a document of the access logs. These documents are never modified
+// after their creation, they are only deleted after the retention period.
+type Entry struct {
+	DocID   string `json:"_id,omitempty"`
+	DocRev  string `json:"_rev,omitempty"`
+	Doctype string `json:"doctype"`
+	// Kind is the kind of token used for the request (app, konnector, oauth,
+	// cli, share, etc.)
+	Kind string `json:"kind,omitempty"`
+	// Subject identifies the app or client, like io.cozy.apps/banks
+	Subject string `json:"subject,omitempty"`
+	// Slug is the slug of the app or konnector, or the software ID of the
+	// OAuth client
+	Slug string `json:"slug,omitempty"`
+	// Query describes what has been read: the identifier of the document, or
+	// the selector of a mango query
+	Query     string    `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (e *Entry) ID() string { return e.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (e *Entry) Rev() string { return e.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (e *Entry) DocType() string { return consts.AccessLogs }
+
+// Clone implements couchdb.Doc
+func (e *Entry) Clone() couchdb.Doc {
+	cloned := *e
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (e *Entry) SetID(id string) { e.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (e *Entry) SetRev(rev string) { e.DocRev = rev }
+
+// Record adds an entry to the access logs of the instance, if the user has
+// enabled them for the doctype of the entry. An error is only logged, as it
+// should not prevent the data to be read.
+func Record(inst *instance.Instance, entry *Entry) {
+	if !inst.HasAccessLogs(entry.Doctype) {
+		return
+	}
+	entry.CreatedAt = time.Now().UTC()
+	if err := couchdb.CreateDoc(inst, entry); err != nil {
+		inst.Logger().WithNamespace("accesslog").
+			Errorf("Cannot record the access to %s by %s: %s", entry.Doctype, entry.Subject, err)
+		return
+	}
+	job.EnsureDailyTrigger(inst, "clean-access-logs", nil)
+}
+
+// List returns the entries of the access logs for the given doctype, from the
+// most recent to the oldest. The bookmark can be used to get the next page.
+func List(db prefixer.Prefixer, doctype string, since time.Time, bookmark string, limit int) ([]*Entry, string, error) {
+	var entries []*Entry
+	req := &couchdb.FindRequest{
+		UseIndex: "by-doctype-and-created-at",
+		Selector: mango.And(
+			mango.Equal("doctype", doctype),
+			mango.Gt("created_at", since.UTC().Format(time.RFC3339Nano)),
+		),
+		Sort: mango.SortBy{
+			{Field: "doctype", Direction: mango.Desc},
+			{Field: "created_at", Direction: mango.Desc},
+		},
+		Limit:    limit,
+		Bookmark: bookmark,
+	}
+	res, err := couchdb.FindDocsRaw(db, consts.AccessLogs, req, &entries)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*Entry{}, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) < limit {
+		return entries, "", nil
+	}
+	return entries, res.Bookmark, nil
+}
+
+// AppSummary is the number of reads made by an app or client on a doctype.
+type AppSummary struct {
+	Kind       string    `json:"kind,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	Slug       string    `json:"slug,omitempty"`
+	Count      int       `json:"count"`
+	LastReadAt time.Time `json:"last_read_at"`
+}
+
+// Summary returns the apps and clients that have read documents of the given
+// doctype since the given date, with the number of reads, from the one that
+// has made the most reads to the one that has made the least.
+func Summary(db prefixer.Prefixer, doctype string, since time.Time) ([]*AppSummary, error) {
+	var all []*Entry
+	bookmark := ""
+	for {
+		entries, next, err := List(db, doctype, since, bookmark, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+		if next == "" {
+			break
+		}
+		bookmark = next
+	}
+	return summarize(all), nil
+}
+
+func summarize(entries []*Entry) []*AppSummary {
+	bySubject := make(map[string]*AppSummary)
+	list := []*AppSummary{}
+	for _, entry := range entries {
+		summary, ok := bySubject[entry.Subject]
+		if !ok {
+			summary = &AppSummary{
+				Kind:    entry.Kind,
+				Subject: entry.Subject,
+				Slug:    entry.Slug,
+			}
+			bySubject[entry.Subject] = summary
+			list = append(list, summary)
+		}
+		summary.Count++
+		if summary.LastReadAt.Before(entry.CreatedAt) {
+			summary.LastReadAt = entry.CreatedAt
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Count > list[j].Count
+	})
+	return list
+}
+
+// CleanOld deletes the entries of the access logs that are older than the
+// retention period configured for the stack. It returns the number of
+// deleted entries.
+func CleanOld(db prefixer.Prefixer) (int, error) {
+	retention := config.GetConfig().AccessLogsRetention
+	if retention <= 0 {
+		return 0, nil
+	}
+	before := time.Now().Add(-retention).UTC()
+
+	count := 0
+	for {
+		var entries []*Entry
+		req := &couchdb.FindRequest{
+			UseIndex: "by-created-at",
+			Selector: mango.Lt("created_at", before.Format(time.RFC3339Nano)),
+			Fields:   []string{"_id", "_rev"},
+			Limit:    batchSize,
+		}
+		err := couchdb.FindDocs(db, consts.AccessLogs, req, &entries)
+		if couchdb.IsNoDatabaseError(err) {
+			return count, nil
+		}
+		if err != nil || len(entries) == 0 {
+			return count, err
+		}
+		docs := make([]couchdb.Doc, len(entries))
+		for i, entry := range entries {
+			docs[i] = entry
+		}
+		if err := couchdb.BulkDeleteDocs(db, consts.AccessLogs, docs); err != nil {
+			return count, err
+		}
+		count += len(entries)
+		if len(entries) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+var _ couchdb.Doc = &Entry{}
@@ -0,0 +1,31 @@
+package accesslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	t.Run("Summarize", func(t *testing.T) {
+		now := time.Now()
+		entries := []*Entry{
+			{Kind: "app", Subject: "io.cozy.apps/banks", Slug: "banks", CreatedAt: now},
+			{Kind: "oauth", Subject: "client-id", Slug: "budget", CreatedAt: now.Add(-2 * time.Hour)},
+			{Kind: "app", Subject: "io.cozy.apps/banks", Slug: "banks", CreatedAt: now.Add(-1 * time.Hour)},
+		}
+
+		list := summarize(entries)
+		if assert.Len(t, list, 2) {
+			assert.Equal(t, "banks", list[0].Slug)
+			assert.Equal(t, 2, list[0].Count)
+			assert.Equal(t, now, list[0].LastReadAt)
+			assert.Equal(t, "budget", list[1].Slug)
+			assert.Equal(t, "oauth", list[1].Kind)
+			assert.Equal(t, 1, list[1].Count)
+		}
+
+		assert.Empty(t, summarize(nil))
+	})
+}
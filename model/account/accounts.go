@@ -47,6 +47,10 @@ type Account struct {
 	// to not try doing the cleaning in the hook as it is already too late (the
 	// konnector is no longer available).
 	ManualCleaning bool `json:"manual_cleaning,omitempty"`
+
+	// CredentialsNeeded is set on an account received via a sharing, until
+	// the member fills their own credentials.
+	CredentialsNeeded bool `json:"credentials_needed,omitempty"`
 }
 
 // OauthInfo holds configuration information for an oauth account
@@ -185,6 +189,16 @@ func CleanAndWait(inst *instance.Instance, toClean []CleanEntry) error {
 			errm = multierror.Append(errm, err)
 		}
 	}
+	// The aggregator accounts are released when all the accounts have been
+	// deleted, as several of them can share the same aggregator account.
+	released := make(map[string]bool)
+	for _, entry := range toClean {
+		aggID := entry.Account.AggregatorID()
+		if aggID != "" && !released[aggID] {
+			released[aggID] = true
+			releaseAggregator(inst, aggID)
+		}
+	}
 	return errm
 }
 
@@ -320,6 +334,10 @@ func init() {
 				return nil
 			}
 
+			if aggID := aggregatorIDOf(old); aggID != "" {
+				releaseAggregator(db, aggID)
+			}
+
 			var konnector string
 			switch v := old.(type) {
 			case *Account:
@@ -0,0 +1,198 @@
+package account
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/app"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// The secrets of an aggregator account that can be put in the scope of a
+// konnector.
+const (
+	// ScopeAccessToken gives access to the OAuth access token, its type and
+	// its expiration date, but never to the refresh token.
+	ScopeAccessToken = "access_token"
+	// ScopeToken gives access to the token field, used by the bi-aggregator.
+	ScopeToken = "token"
+	// ScopeUserID gives access to the user_id field.
+	ScopeUserID = "user_id"
+)
+
+// DefaultAggregatorScope is the scope of a konnector that declares an
+// aggregator in its manifest without a scope.
+var DefaultAggregatorScope = []string{ScopeAccessToken}
+
+// aggregatorRefreshMargin is the delay before the expiration of the token of
+// an aggregator account where it is already refreshed.
+const aggregatorRefreshMargin = time.Minute
+
+var (
+	// ErrNoAggregator is used when an account is not related to an
+	// aggregator account.
+	ErrNoAggregator = errors.New("The account is not related to an aggregator account")
+	// ErrAggregatorMismatch is used when the aggregator account of an account
+	// is not the one declared in the manifest of its konnector.
+	ErrAggregatorMismatch = errors.New("The aggregator account is not the one of the konnector")
+)
+
+// AggregatorID returns the identifier of the aggregator account related to
+// this account via the parent relationship, or an empty string.
+func (ac *Account) AggregatorID() string {
+	return parentID(ac.Relationships)
+}
+
+func parentID(rels map[string]interface{}) string {
+	parent, _ := rels["parent"].(map[string]interface{})
+	data, _ := parent["data"].(map[string]interface{})
+	id, _ := data["_id"].(string)
+	return id
+}
+
+func aggregatorIDOf(doc couchdb.Doc) string {
+	switch v := doc.(type) {
+	case *Account:
+		return v.AggregatorID()
+	case *couchdb.JSONDoc:
+		rels, _ := v.M["relationships"].(map[string]interface{})
+		return parentID(rels)
+	}
+	return ""
+}
+
+// AggregatorView returns a copy of an aggregator account with only the
+// secrets in the given scope.
+func AggregatorView(agg *Account, scope []string) *Account {
+	if scope == nil {
+		scope = DefaultAggregatorScope
+	}
+	view := &Account{
+		DocID:       agg.DocID,
+		DocRev:      agg.DocRev,
+		AccountType: agg.AccountType,
+		Name:        agg.Name,
+	}
+	for _, field := range scope {
+		switch field {
+		case ScopeAccessToken:
+			if agg.Oauth != nil {
+				view.Oauth = &OauthInfo{
+					AccessToken: agg.Oauth.AccessToken,
+					TokenType:   agg.Oauth.TokenType,
+					ExpiresAt:   agg.Oauth.ExpiresAt,
+				}
+			}
+		case ScopeToken:
+			view.Token = agg.Token
+		case ScopeUserID:
+			view.UserID = agg.UserID
+		}
+	}
+	return view
+}
+
+// GetAggregatorView returns the view of the aggregator account of an account,
+// with the secrets in the scope declared by its konnector. The token of the
+// aggregator account is refreshed first if it has expired.
+func GetAggregatorView(inst *instance.Instance, acc *Account) (*Account, error) {
+	aggID := acc.AggregatorID()
+	if aggID == "" {
+		return nil, ErrNoAggregator
+	}
+	man, err := app.GetKonnectorBySlug(inst, acc.AccountType)
+	if err != nil {
+		return nil, err
+	}
+	declared := man.Aggregator()
+	if declared == nil || declared.AccountID != aggID {
+		return nil, ErrAggregatorMismatch
+	}
+	agg, err := RefreshAggregator(inst, aggID)
+	if err != nil {
+		return nil, err
+	}
+	return AggregatorView(agg, declared.Scope), nil
+}
+
+// RefreshAggregator refreshes the OAuth token of an aggregator account, if it
+// has expired. It is done under a lock, so that the konnectors sharing the
+// account don't refresh it concurrently: the token is refreshed once, and the
+// other konnectors use the new token.
+func RefreshAggregator(inst *instance.Instance, aggregatorID string) (*Account, error) {
+	mu := config.Lock().ReadWrite(inst, "accounts/aggregator/"+aggregatorID)
+	if err := mu.Lock(); err != nil {
+		return nil, err
+	}
+	defer mu.Unlock()
+
+	agg := &Account{}
+	if err := couchdb.GetDoc(inst, consts.Accounts, aggregatorID, agg); err != nil {
+		return nil, err
+	}
+	if agg.Oauth == nil || agg.Oauth.RefreshToken == "" {
+		return agg, nil
+	}
+	if !agg.Oauth.ExpiresAt.IsZero() &&
+		agg.Oauth.ExpiresAt.After(time.Now().Add(aggregatorRefreshMargin)) {
+		return agg, nil
+	}
+
+	accountType, err := TypeInfo(agg.AccountType, inst.ContextName)
+	if err != nil {
+		return nil, err
+	}
+	if err := accountType.RefreshAccount(*agg); err != nil {
+		return nil, err
+	}
+	if err := couchdb.UpdateDoc(inst, agg); err != nil {
+		return nil, err
+	}
+	return agg, nil
+}
+
+// releaseAggregator deletes an aggregator account when it is no longer
+// referenced by an account.
+func releaseAggregator(db prefixer.Prefixer, aggregatorID string) {
+	log := logger.WithDomain(db.DomainName()).
+		WithNamespace("accounts").
+		WithField("account_id", aggregatorID)
+
+	var accounts []*Account
+	if err := couchdb.GetAllDocs(db, consts.Accounts, nil, &accounts); err != nil {
+		log.Warnf("Cannot check the references to the aggregator account: %s", err)
+		return
+	}
+	agg := findAccount(accounts, aggregatorID)
+	if agg == nil {
+		return
+	}
+	for _, acc := range accounts {
+		if acc.AggregatorID() == aggregatorID {
+			return
+		}
+	}
+
+	// The aggregator account has no konnector, and no trigger: there is
+	// nothing to clean in the deletion hook.
+	agg.ManualCleaning = true
+	if err := couchdb.DeleteDoc(db, agg); err != nil && !couchdb.IsNotFoundError(err) {
+		log.Errorf("Cannot delete the aggregator account: %s", err)
+		return
+	}
+	log.Infof("Aggregator account deleted as it is no longer used")
+}
+
+func findAccount(accounts []*Account, id string) *Account {
+	for _, acc := range accounts {
+		if acc.ID() == id {
+			return acc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package account
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator(t *testing.T) {
+	t.Run("AggregatorID", func(t *testing.T) {
+		acc := &Account{
+			Relationships: map[string]interface{}{
+				"parent": map[string]interface{}{
+					"data": map[string]interface{}{
+						"_id":   "bank-aggregator",
+						"_type": consts.Accounts,
+					},
+				},
+			},
+		}
+		assert.Equal(t, "bank-aggregator", acc.AggregatorID())
+		assert.Equal(t, "", (&Account{}).AggregatorID())
+
+		doc := &couchdb.JSONDoc{
+			Type: consts.Accounts,
+			M: map[string]interface{}{
+				"relationships": acc.Relationships,
+			},
+		}
+		assert.Equal(t, "bank-aggregator", aggregatorIDOf(doc))
+	})
+
+	t.Run("AggregatorView", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		agg := &Account{
+			DocID:       "bank-aggregator",
+			AccountType: "bank-aggregator",
+			Name:        "Aggregator",
+			Oauth: &OauthInfo{
+				AccessToken:  "access",
+				TokenType:    "Bearer",
+				ExpiresAt:    expiresAt,
+				RefreshToken: "refresh",
+				ClientSecret: "secret",
+			},
+			Token:  "token",
+			UserID: "42",
+		}
+
+		view := AggregatorView(agg, nil)
+		assert.Equal(t, "bank-aggregator", view.ID())
+		if assert.NotNil(t, view.Oauth) {
+			assert.Equal(t, "access", view.Oauth.AccessToken)
+			assert.Equal(t, "Bearer", view.Oauth.TokenType)
+			assert.Equal(t, expiresAt, view.Oauth.ExpiresAt)
+			assert.Empty(t, view.Oauth.RefreshToken)
+			assert.Empty(t, view.Oauth.ClientSecret)
+		}
+		assert.Empty(t, view.Token)
+		assert.Empty(t, view.UserID)
+
+		view = AggregatorView(agg, []string{ScopeToken, ScopeUserID})
+		assert.Nil(t, view.Oauth)
+		assert.Equal(t, "token", view.Token)
+		assert.Equal(t, "42", view.UserID)
+
+		view = AggregatorView(agg, []string{})
+		assert.Nil(t, view.Oauth)
+		assert.Empty(t, view.Token)
+	})
+}
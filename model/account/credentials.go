@@ -234,6 +234,50 @@ func Decrypt(doc couchdb.JSONDoc) bool {
 	return false
 }
 
+// minSecretLength is the minimal length of a secret to be masked: the shorter
+// values would mask too many things in the logs.
+const minSecretLength = 4
+
+// Secrets returns the decrypted values of the secrets of an account, like the
+// password or the tokens, so that they can be masked in the logs of its
+// konnector.
+func (ac *Account) Secrets() []string {
+	doc, err := ac.toJSONDoc()
+	if err != nil {
+		return nil
+	}
+	Decrypt(*doc)
+
+	var secrets []string
+	add := func(value interface{}) {
+		if str, ok := value.(string); ok && len(str) >= minSecretLength {
+			secrets = append(secrets, str)
+		}
+	}
+	addAuth := func(auth map[string]interface{}) {
+		for k, v := range auth {
+			if isSecretField(k) {
+				add(v)
+			}
+		}
+	}
+	if auth, ok := doc.M["auth"].(map[string]interface{}); ok {
+		addAuth(auth)
+	}
+	if data, ok := doc.M["data"].(map[string]interface{}); ok {
+		if auth, ok := data["auth"].(map[string]interface{}); ok {
+			addAuth(auth)
+		}
+	}
+	if ac.Oauth != nil {
+		add(ac.Oauth.AccessToken)
+		add(ac.Oauth.RefreshToken)
+		add(ac.Oauth.ClientSecret)
+	}
+	add(ac.Token)
+	return secrets
+}
+
 func encryptMap(m map[string]interface{}) (encrypted bool) {
 	auth, ok := m["auth"].(map[string]interface{})
 	if !ok {
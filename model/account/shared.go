@@ -0,0 +1,130 @@
+package account
+
+import "strings"
+
+// memberFields are the fields of an account that are specific to each member
+// of a sharing: the secrets, the tokens, and the state of the konnector. They
+// are never sent to the other members.
+var memberFields = []string{
+	"auth",
+	"oauth",
+	"oauth_callback_results",
+	"token",
+	"user_id",
+	"twoFACode",
+	"state",
+	"mutedErrors",
+	"relationships",
+	"credentials_needed",
+}
+
+// identifierFields are the fields of the auth that identifies the user on the
+// remote service. They are kept blank in a shared account, so that the konnector
+// can show which fields must be filled.
+var identifierFields = []string{"login", "email", "identifier", "new_identifier"}
+
+// secretFields are the fields of the auth that must never leave the instance.
+var secretFields = []string{
+	"password", "secret", "dob", "code", "answer", "access_token",
+	"refresh_token", "appSecret", "session", "token",
+}
+
+// StripSecrets removes the secrets and the fields specific to a member from
+// an account, so that it can be shared with another member. The identifiers
+// are blanked, and the account is flagged as needing credentials if it had
+// some. The document is modified in place.
+func StripSecrets(doc map[string]interface{}) {
+	auth, _ := doc["auth"].(map[string]interface{})
+	needed := hasCredentials(auth)
+	for _, field := range memberFields {
+		delete(doc, field)
+	}
+	if auth != nil {
+		doc["auth"] = blankAuth(auth)
+	}
+	if data, ok := doc["data"].(map[string]interface{}); ok {
+		if dataAuth, ok := data["auth"].(map[string]interface{}); ok {
+			needed = needed || hasCredentials(dataAuth)
+			data["auth"] = blankAuth(dataAuth)
+		}
+	}
+	if needed {
+		doc["credentials_needed"] = true
+	}
+}
+
+// KeepMemberFields copies the fields specific to a member from the local
+// version of an account to the version received from another member.
+func KeepMemberFields(doc, local map[string]interface{}) {
+	for _, field := range memberFields {
+		delete(doc, field)
+		if v, ok := local[field]; ok {
+			doc[field] = v
+		}
+	}
+	if data, ok := doc["data"].(map[string]interface{}); ok {
+		delete(data, "auth")
+		if localData, ok := local["data"].(map[string]interface{}); ok {
+			if v, ok := localData["auth"]; ok {
+				data["auth"] = v
+			}
+		}
+	}
+}
+
+// ClearCredentialsNeeded removes the credentials_needed flag of an account
+// when the user has filled the credentials.
+func ClearCredentialsNeeded(doc map[string]interface{}) {
+	auth, _ := doc["auth"].(map[string]interface{})
+	if hasCredentials(auth) {
+		delete(doc, "credentials_needed")
+	}
+}
+
+func blankAuth(auth map[string]interface{}) map[string]interface{} {
+	blanked := make(map[string]interface{}, len(auth))
+	for k, v := range auth {
+		if isSecretField(k) {
+			continue
+		}
+		if isIdentifierField(k) {
+			blanked[k] = ""
+		} else {
+			blanked[k] = v
+		}
+	}
+	return blanked
+}
+
+func hasCredentials(auth map[string]interface{}) bool {
+	for k, v := range auth {
+		if !isSecretField(k) && !isIdentifierField(k) {
+			continue
+		}
+		if str, ok := v.(string); !ok || str != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecretField(key string) bool {
+	if strings.HasSuffix(key, "_encrypted") {
+		return true
+	}
+	for _, field := range secretFields {
+		if key == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentifierField(key string) bool {
+	for _, field := range identifierFields {
+		if key == field {
+			return true
+		}
+	}
+	return false
+}
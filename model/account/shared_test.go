@@ -0,0 +1,79 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedAccount(t *testing.T) {
+	t.Run("StripSecrets", func(t *testing.T) {
+		doc := map[string]interface{}{
+			"_id":               "account1",
+			"account_type":      "bank",
+			"name":              "My bank",
+			"defaultFolderPath": "/Administrative/My bank",
+			"state":             "LOGIN_SUCCESS",
+			"oauth":             map[string]interface{}{"access_token": "xxx"},
+			"auth": map[string]interface{}{
+				"login":                 "alice",
+				"credentials_encrypted": "bmFjbHNlY3JldA==",
+				"secret_encrypted":      "c2VjcmV0",
+				"branchName":            "Paris",
+			},
+			"data": map[string]interface{}{
+				"auth": map[string]interface{}{"password": "p4ssw0rd"},
+			},
+		}
+		StripSecrets(doc)
+		assert.Equal(t, "bank", doc["account_type"])
+		assert.Equal(t, "/Administrative/My bank", doc["defaultFolderPath"])
+		assert.Equal(t, map[string]interface{}{
+			"login":      "",
+			"branchName": "Paris",
+		}, doc["auth"])
+		assert.Equal(t, map[string]interface{}{}, doc["data"].(map[string]interface{})["auth"])
+		assert.NotContains(t, doc, "state")
+		assert.NotContains(t, doc, "oauth")
+		assert.Equal(t, true, doc["credentials_needed"])
+
+		noCreds := map[string]interface{}{
+			"auth": map[string]interface{}{"accountName": "Alice"},
+		}
+		StripSecrets(noCreds)
+		assert.NotContains(t, noCreds, "credentials_needed")
+	})
+
+	t.Run("KeepMemberFields", func(t *testing.T) {
+		doc := map[string]interface{}{
+			"name":               "My bank (renamed)",
+			"auth":               map[string]interface{}{"login": ""},
+			"credentials_needed": true,
+		}
+		local := map[string]interface{}{
+			"name":  "My bank",
+			"state": "LOGIN_SUCCESS",
+			"auth": map[string]interface{}{
+				"login":                 "bob",
+				"credentials_encrypted": "Ym9i",
+			},
+		}
+		KeepMemberFields(doc, local)
+		assert.Equal(t, "My bank (renamed)", doc["name"])
+		assert.Equal(t, "LOGIN_SUCCESS", doc["state"])
+		assert.Equal(t, local["auth"], doc["auth"])
+		assert.NotContains(t, doc, "credentials_needed")
+	})
+
+	t.Run("ClearCredentialsNeeded", func(t *testing.T) {
+		doc := map[string]interface{}{
+			"auth":               map[string]interface{}{"login": "", "branchName": "Paris"},
+			"credentials_needed": true,
+		}
+		ClearCredentialsNeeded(doc)
+		assert.Equal(t, true, doc["credentials_needed"])
+		doc["auth"] = map[string]interface{}{"login": "bob", "password": "secret"}
+		ClearCredentialsNeeded(doc)
+		assert.NotContains(t, doc, "credentials_needed")
+	})
+}
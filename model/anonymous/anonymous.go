@@ -0,0 +1,133 @@
+// Package anonymous gives a stable identifier for an instance, that can be
+// used by the apps for the telemetry or the support without exposing its
+// domain or the email of its owner.
+package anonymous
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+)
+
+// nonceLength is the number of random characters of the nonce.
+const nonceLength = 32
+
+// idLength is the number of hexadecimal characters of the identifier.
+const idLength = 32
+
+// Identifier is the settings document used to compute the anonymous
+// identifier of an instance. The nonce is random, and it is never sent to the
+// apps: they only see the identifier derived from it with the salt of the
+// context. A new nonce is generated when the identifier is rotated.
+type Identifier struct {
+	DocID     string    `json:"_id,omitempty"`
+	DocRev    string    `json:"_rev,omitempty"`
+	Nonce     string    `json:"nonce"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// ID implements the couchdb.Doc interface
+func (i *Identifier) ID() string { return i.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (i *Identifier) Rev() string { return i.DocRev }
+
+// DocType implements the couchdb.Doc interface
+func (i *Identifier) DocType() string { return consts.Settings }
+
+// SetID implements the couchdb.Doc interface
+func (i *Identifier) SetID(id string) { i.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (i *Identifier) SetRev(rev string) { i.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (i *Identifier) Clone() couchdb.Doc {
+	cloned := *i
+	return &cloned
+}
+
+// Value returns the anonymous identifier for the instance, salted with the
+// secret of its context. The same nonce gives different identifiers in two
+// contexts, so that they can't be correlated.
+func (i *Identifier) Value(contextName string) string {
+	mac := hmac.New(sha256.New, []byte(contextSalt(contextName)))
+	mac.Write([]byte(i.Nonce))
+	return hex.EncodeToString(mac.Sum(nil))[:idLength]
+}
+
+// contextSalt returns the salt for the anonymous identifiers of the given
+// context, from the config file, or the salt of the default context.
+func contextSalt(contextName string) string {
+	contexts := config.GetConfig().Contexts
+	if ctx, ok := contexts[contextName].(map[string]interface{}); ok {
+		if salt, ok := ctx["anonymous_id_salt"].(string); ok {
+			return salt
+		}
+	}
+	if ctx, ok := contexts[config.DefaultInstanceContext].(map[string]interface{}); ok {
+		if salt, ok := ctx["anonymous_id_salt"].(string); ok {
+			return salt
+		}
+	}
+	return ""
+}
+
+func newIdentifier() *Identifier {
+	return &Identifier{
+		DocID:     consts.AnonymousIDSettingsID,
+		Nonce:     crypto.GenerateRandomString(nonceLength),
+		RotatedAt: time.Now().UTC(),
+	}
+}
+
+// Get returns the identifier document of the instance. It is created the
+// first time.
+func Get(inst *instance.Instance) (*Identifier, error) {
+	var doc Identifier
+	err := couchdb.GetDoc(inst, consts.Settings, consts.AnonymousIDSettingsID, &doc)
+	if err == nil {
+		return &doc, nil
+	}
+	if !couchdb.IsNotFoundError(err) {
+		return nil, err
+	}
+
+	created := newIdentifier()
+	err = couchdb.CreateNamedDocWithDB(inst, created)
+	if couchdb.IsConflictError(err) {
+		// Another request has created it in the meantime
+		err = couchdb.GetDoc(inst, consts.Settings, consts.AnonymousIDSettingsID, &doc)
+		if err != nil {
+			return nil, err
+		}
+		return &doc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Rotate replaces the anonymous identifier of the instance by a new one, that
+// can't be linked to the previous one.
+func Rotate(inst *instance.Instance) (*Identifier, error) {
+	doc, err := Get(inst)
+	if err != nil {
+		return nil, err
+	}
+	fresh := newIdentifier()
+	doc.Nonce = fresh.Nonce
+	doc.RotatedAt = fresh.RotatedAt
+	if err := couchdb.UpdateDoc(inst, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,43 @@
+package anonymous
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymousID(t *testing.T) {
+	config.UseTestFile(t)
+	cfg := config.GetConfig()
+	cfg.Contexts = map[string]interface{}{
+		"default": map[string]interface{}{"anonymous_id_salt": "default-salt"},
+		"beta":    map[string]interface{}{"anonymous_id_salt": "beta-salt"},
+	}
+	defer func() { cfg.Contexts = nil }()
+
+	t.Run("Salt", func(t *testing.T) {
+		assert.Equal(t, "beta-salt", contextSalt("beta"))
+		assert.Equal(t, "default-salt", contextSalt("other"))
+		assert.Equal(t, "default-salt", contextSalt(""))
+	})
+
+	t.Run("Value", func(t *testing.T) {
+		doc := &Identifier{Nonce: "a-random-nonce"}
+		id := doc.Value("beta")
+		assert.Len(t, id, idLength)
+		assert.Equal(t, id, doc.Value("beta"))
+		assert.NotEqual(t, id, doc.Value("default"))
+		assert.NotContains(t, id, doc.Nonce)
+
+		rotated := &Identifier{Nonce: "another-nonce"}
+		assert.NotEqual(t, id, rotated.Value("beta"))
+	})
+
+	t.Run("NewIdentifier", func(t *testing.T) {
+		a, b := newIdentifier(), newIdentifier()
+		assert.Len(t, a.Nonce, nonceLength)
+		assert.NotEqual(t, a.Nonce, b.Nonce)
+		assert.False(t, a.RotatedAt.IsZero())
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/model/vfs/vfsafero"
@@ -16,6 +17,8 @@ import (
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/prefixer"
 	"github.com/spf13/afero"
 )
@@ -86,6 +89,7 @@ type Manifest interface {
 	Name() string
 	Icon() string
 	Notifications() Notifications
+	CustomMetadata() vfs.CustomMetadataSchema
 
 	SetError(err error)
 	Error() error
@@ -198,3 +202,49 @@ func KonnectorsFileServer(i *instance.Instance) appfs.FileServer {
 		panic(fmt.Sprintf("instance: unknown storage provider %s", fsURL.Scheme))
 	}
 }
+
+// defineCustomMetadataIndexes creates the mango indexes for the searchable
+// fields of the custom metadata declared by an app, and removes the indexes
+// for the fields that are no longer searchable.
+func defineCustomMetadataIndexes(db prefixer.Prefixer, slug string, schema vfs.CustomMetadataSchema) error {
+	indexes := vfs.CustomMetadataIndexes(slug, schema)
+	for _, index := range indexes {
+		if err := couchdb.DefineIndex(db, index); err != nil {
+			return err
+		}
+	}
+	if err := vfs.DeleteObsoleteCustomMetadataIndexes(db, slug, schema); err != nil {
+		return err
+	}
+	if len(indexes) > 0 {
+		pushWarmUpJob(db, indexes)
+	}
+	return nil
+}
+
+// deleteCustomMetadataIndexes removes the mango indexes for the custom
+// metadata of an app that is uninstalled. The errors are only logged, as they
+// should not prevent the uninstall.
+func deleteCustomMetadataIndexes(db prefixer.Prefixer, slug string) {
+	if err := vfs.DeleteObsoleteCustomMetadataIndexes(db, slug, nil); err != nil {
+		logger.WithDomain(db.DomainName()).WithNamespace("apps").
+			Warnf("Cannot delete the custom metadata indexes of %s: %s", slug, err)
+	}
+}
+
+// pushWarmUpJob pushes a job to build the new indexes in background. The
+// errors are only logged, as the indexes will be built on the first query
+// anyway.
+func pushWarmUpJob(db prefixer.Prefixer, indexes []*mango.Index) {
+	msg, err := job.NewMessage(&couchdb.WarmUpMessage{Indexes: indexes})
+	if err == nil {
+		_, err = job.System().PushJob(db, &job.JobRequest{
+			WorkerType: "warmup",
+			Message:    msg,
+		})
+	}
+	if err != nil {
+		logger.WithDomain(db.DomainName()).WithNamespace("apps").
+			Warnf("Cannot push the warmup job: %s", err)
+	}
+}
@@ -0,0 +1,245 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// maxShifts is the maximal number of windows that can be skipped when looking
+// for the next moment where a provider is available. It avoids looping
+// forever if the windows cover the whole week.
+const maxShifts = 14
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// UnavailabilityWindow is a period where the provider of a konnector is known
+// to be unavailable, like a daily maintenance between 00:00 and 02:00. The
+// days are optional (every day by default). When to is before from, the
+// window ends the next day. When from and to are empty, the window covers the
+// whole day.
+type UnavailabilityWindow struct {
+	Days     []string `json:"days,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
+// Unavailability is the list of the windows where the provider of a konnector
+// is unavailable.
+type Unavailability []UnavailabilityWindow
+
+// Validate checks that the windows are well formed.
+func (u Unavailability) Validate() error {
+	for _, w := range u {
+		for _, day := range w.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("invalid day %q", day)
+			}
+		}
+		if _, err := parseClock(w.From, 0); err != nil {
+			return err
+		}
+		if _, err := parseClock(w.To, 24*60); err != nil {
+			return err
+		}
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q", w.Timezone)
+		}
+	}
+	return nil
+}
+
+// NextAvailable returns the first moment after t (or t itself) where the
+// provider is not in one of the unavailability windows.
+func (u Unavailability) NextAvailable(t time.Time) time.Time {
+	for i := 0; i < maxShifts; i++ {
+		shifted := false
+		for _, w := range u {
+			if end, ok := w.end(t); ok {
+				t = end
+				shifted = true
+			}
+		}
+		if !shifted {
+			break
+		}
+	}
+	return t
+}
+
+// end returns the end of the window if t is inside it.
+func (w UnavailabilityWindow) end(t time.Time) (time.Time, bool) {
+	from, err := parseClock(w.From, 0)
+	if err != nil {
+		return t, false
+	}
+	to, err := parseClock(w.To, 24*60)
+	if err != nil {
+		return t, false
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return t, false
+	}
+	local := t.In(loc)
+	// A window that started the day before can still be running
+	for _, delta := range []int{-1, 0} {
+		day := time.Date(local.Year(), local.Month(), local.Day()+delta, 0, 0, 0, 0, loc)
+		if !w.onDay(day.Weekday()) {
+			continue
+		}
+		start := day.Add(time.Duration(from) * time.Minute)
+		end := day.Add(time.Duration(to) * time.Minute)
+		if to <= from {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !local.Before(start) && local.Before(end) {
+			return end.In(t.Location()), true
+		}
+	}
+	return t, false
+}
+
+func (w UnavailabilityWindow) onDay(weekday time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if weekdays[strings.ToLower(day)] == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses a time like 02:30, and returns the number of minutes
+// since midnight.
+func parseClock(clock string, defaultValue int) (int, error) {
+	if clock == "" {
+		return defaultValue, nil
+	}
+	var hours, minutes int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &hours, &minutes); err != nil {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	if hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	return hours*60 + minutes, nil
+}
+
+// availabilityOverride is the document used by the administrators to replace
+// the unavailability windows of a konnector given by its manifest.
+type availabilityOverride struct {
+	DocID          string         `json:"_id,omitempty"`
+	DocRev         string         `json:"_rev,omitempty"`
+	Unavailability Unavailability `json:"unavailability"`
+}
+
+func (o *availabilityOverride) ID() string        { return o.DocID }
+func (o *availabilityOverride) Rev() string       { return o.DocRev }
+func (o *availabilityOverride) DocType() string   { return consts.KonnectorsAvailability }
+func (o *availabilityOverride) SetID(id string)   { o.DocID = id }
+func (o *availabilityOverride) SetRev(rev string) { o.DocRev = rev }
+func (o *availabilityOverride) Clone() couchdb.Doc {
+	cloned := *o
+	cloned.Unavailability = make(Unavailability, len(o.Unavailability))
+	copy(cloned.Unavailability, o.Unavailability)
+	return &cloned
+}
+
+// GetAvailabilityOverride returns the unavailability windows configured by an
+// administrator for the given konnector. The boolean is false if there is no
+// override for this konnector.
+func GetAvailabilityOverride(slug string) (Unavailability, bool, error) {
+	var doc availabilityOverride
+	err := couchdb.GetDoc(prefixer.GlobalPrefixer, consts.KonnectorsAvailability, slug, &doc)
+	if couchdb.IsNotFoundError(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return doc.Unavailability, true, nil
+}
+
+// ListAvailabilityOverrides returns the unavailability windows configured by
+// the administrators, indexed by the slug of the konnectors.
+func ListAvailabilityOverrides() (map[string]Unavailability, error) {
+	var docs []*availabilityOverride
+	req := &couchdb.AllDocsRequest{Limit: 10000}
+	err := couchdb.GetAllDocs(prefixer.GlobalPrefixer, consts.KonnectorsAvailability, req, &docs)
+	if err != nil && !couchdb.IsNotFoundError(err) {
+		return nil, err
+	}
+	list := make(map[string]Unavailability, len(docs))
+	for _, doc := range docs {
+		list[doc.DocID] = doc.Unavailability
+	}
+	return list, nil
+}
+
+// SetAvailabilityOverride replaces the unavailability windows of the given
+// konnector by the ones given by an administrator. An empty list can be used
+// to ignore the windows of the manifest.
+func SetAvailabilityOverride(slug string, windows Unavailability) error {
+	if windows == nil {
+		windows = Unavailability{}
+	}
+	if err := windows.Validate(); err != nil {
+		return err
+	}
+	doc := &availabilityOverride{DocID: slug, Unavailability: windows}
+	return couchdb.Upsert(prefixer.GlobalPrefixer, doc)
+}
+
+// DeleteAvailabilityOverride removes the override of the unavailability
+// windows for the given konnector: the windows of its manifest are used again.
+func DeleteAvailabilityOverride(slug string) error {
+	doc := &availabilityOverride{}
+	err := couchdb.GetDoc(prefixer.GlobalPrefixer, consts.KonnectorsAvailability, slug, doc)
+	if couchdb.IsNotFoundError(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return couchdb.DeleteDoc(prefixer.GlobalPrefixer, doc)
+}
+
+// KonnectorNextAvailable returns the first moment after t where the provider
+// of the konnector is available, according to the override of the
+// administrators, or else to the manifest of the installed konnector.
+func KonnectorNextAvailable(db prefixer.Prefixer, slug string, t time.Time) (time.Time, error) {
+	windows, ok, err := GetAvailabilityOverride(slug)
+	if err != nil {
+		return t, err
+	}
+	if !ok {
+		man, err := GetKonnectorBySlug(db, slug)
+		if errors.Is(err, ErrNotFound) {
+			return t, nil
+		}
+		if err != nil {
+			return t, err
+		}
+		windows = man.Unavailability()
+	}
+	return windows.NextAvailable(t), nil
+}
+
+var _ couchdb.Doc = &availabilityOverride{}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnavailability(t *testing.T) {
+	t.Run("Validate", func(t *testing.T) {
+		windows := Unavailability{
+			{From: "00:00", To: "02:00", Timezone: "Europe/Paris"},
+			{Days: []string{"sat", "sun"}},
+		}
+		assert.NoError(t, windows.Validate())
+		assert.Error(t, Unavailability{{Days: []string{"someday"}}}.Validate())
+		assert.Error(t, Unavailability{{From: "25:00"}}.Validate())
+		assert.Error(t, Unavailability{{Timezone: "Mars/Olympus"}}.Validate())
+	})
+
+	t.Run("NextAvailable", func(t *testing.T) {
+		// 2023-06-14 is a wednesday
+		at := func(day, hour, min int) time.Time {
+			return time.Date(2023, time.June, day, hour, min, 0, 0, time.UTC)
+		}
+		nightly := Unavailability{{From: "00:00", To: "02:00"}}
+		assert.Equal(t, at(14, 2, 0), nightly.NextAvailable(at(14, 1, 30)))
+		assert.Equal(t, at(14, 3, 0), nightly.NextAvailable(at(14, 3, 0)))
+
+		overnight := Unavailability{{From: "23:00", To: "01:00"}}
+		assert.Equal(t, at(15, 1, 0), overnight.NextAvailable(at(14, 23, 30)))
+		assert.Equal(t, at(15, 1, 0), overnight.NextAvailable(at(15, 0, 30)))
+
+		weekend := Unavailability{{Days: []string{"sat", "sun"}}}
+		assert.Equal(t, at(19, 0, 0), weekend.NextAvailable(at(17, 10, 0)))
+		assert.Equal(t, at(16, 10, 0), weekend.NextAvailable(at(16, 10, 0)))
+
+		// The windows are chained: monday night is also unavailable
+		both := append(weekend, nightly...)
+		assert.Equal(t, at(19, 2, 0), both.NextAvailable(at(18, 12, 0)))
+
+		always := Unavailability{{}}
+		assert.False(t, always.NextAvailable(at(14, 12, 0)).IsZero())
+	})
+}
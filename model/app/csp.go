@@ -0,0 +1,214 @@
+package app
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// ErrInvalidCSPPolicy is used when a CSP policy has an unknown directive or
+// a source that is not allowed.
+var ErrInvalidCSPPolicy = errors.New("Invalid CSP policy")
+
+// cspDirectives are the directives that can be extended by a CSP policy,
+// with the names used in the csp_allowlist parameter of the config file.
+var cspDirectives = map[string]string{
+	"default": "default-src",
+	"script":  "script-src",
+	"connect": "connect-src",
+	"style":   "style-src",
+	"font":    "font-src",
+	"img":     "img-src",
+	"media":   "media-src",
+	"frame":   "frame-src",
+	"worker":  "worker-src",
+	"form":    "form-action",
+}
+
+// CSPPolicy is a document, stored in the global database, with some sources
+// that are added to the Content-Security-Policy of a webapp, for all the
+// instances or only for the instances of a context.
+type CSPPolicy struct {
+	DocID     string              `json:"_id,omitempty"`
+	DocRev    string              `json:"_rev,omitempty"`
+	Slug      string              `json:"slug"`
+	Context   string              `json:"context,omitempty"`
+	Sources   map[string][]string `json:"sources"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (p *CSPPolicy) ID() string { return p.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (p *CSPPolicy) Rev() string { return p.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (p *CSPPolicy) DocType() string { return consts.CSPPolicies }
+
+// Clone implements couchdb.Doc
+func (p *CSPPolicy) Clone() couchdb.Doc {
+	cloned := *p
+	cloned.Sources = make(map[string][]string, len(p.Sources))
+	for k, v := range p.Sources {
+		cloned.Sources[k] = append([]string{}, v...)
+	}
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (p *CSPPolicy) SetID(id string) { p.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (p *CSPPolicy) SetRev(rev string) { p.DocRev = rev }
+
+// Validate checks that the directives are known, and that the sources are
+// hosts or schemes. The keywords like 'unsafe-eval' and the wildcard source
+// are rejected, as a policy should only allow some specific domains.
+func (p *CSPPolicy) Validate() error {
+	if p.Slug == "" {
+		return ErrInvalidSlugName
+	}
+	for directive, sources := range p.Sources {
+		if _, ok := cspDirectives[directive]; !ok {
+			return ErrInvalidCSPPolicy
+		}
+		for _, source := range sources {
+			if !validCSPSource(source) {
+				return ErrInvalidCSPPolicy
+			}
+		}
+	}
+	return nil
+}
+
+func validCSPSource(source string) bool {
+	if source == "" || strings.ContainsAny(source, " \t\n;,'\"*") {
+		return false
+	}
+	// A scheme source, like data: or cozydrive:
+	if strings.HasSuffix(source, ":") && !strings.Contains(source, "/") {
+		return true
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" || u.Host == "*" {
+		return false
+	}
+	return u.Scheme == "https" || u.Scheme == "wss" || u.Scheme == "http" || u.Scheme == "ws"
+}
+
+func cspPolicyID(context, slug string) string {
+	if context == "" {
+		return slug
+	}
+	return context + "/" + slug
+}
+
+// GetCSPPolicy returns the CSP policy for the given webapp and context (empty
+// for all the contexts), or nil if there is none.
+func GetCSPPolicy(context, slug string) (*CSPPolicy, error) {
+	var doc CSPPolicy
+	err := couchdb.GetDoc(prefixer.GlobalPrefixer, consts.CSPPolicies, cspPolicyID(context, slug), &doc)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// SaveCSPPolicy validates and persists a CSP policy.
+func SaveCSPPolicy(policy *CSPPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	policy.DocID = cspPolicyID(policy.Context, policy.Slug)
+	policy.UpdatedAt = time.Now().UTC()
+	return couchdb.Upsert(prefixer.GlobalPrefixer, policy)
+}
+
+// DeleteCSPPolicy removes the CSP policy for the given webapp and context.
+func DeleteCSPPolicy(context, slug string) error {
+	policy, err := GetCSPPolicy(context, slug)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return ErrNotFound
+	}
+	return couchdb.DeleteDoc(prefixer.GlobalPrefixer, policy)
+}
+
+// ListCSPPolicies returns all the CSP policies stored in the global database.
+func ListCSPPolicies() ([]*CSPPolicy, error) {
+	var docs []*CSPPolicy
+	req := &couchdb.AllDocsRequest{Limit: 1000}
+	err := couchdb.GetAllDocs(prefixer.GlobalPrefixer, consts.CSPPolicies, req, &docs)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*CSPPolicy{}, nil
+	}
+	return docs, err
+}
+
+// CSPRulesFor returns the sources to add to the CSP headers of a webapp, by
+// directive (like connect-src). They come from the csp_allowlist.apps
+// parameter of the config file, and from the CSP policies for this webapp for
+// all the contexts and for the given context.
+func CSPRulesFor(context, slug string) (map[string][]string, error) {
+	rules := map[string][]string{}
+	if perApp, ok := config.GetConfig().CSPPerApp[slug]; ok {
+		for directive, list := range perApp {
+			if header, ok := cspDirectives[directive]; ok {
+				rules[header] = append(rules[header], strings.Fields(list)...)
+			}
+		}
+	}
+
+	keys := []string{cspPolicyID("", slug)}
+	if context != "" {
+		keys = append(keys, cspPolicyID(context, slug))
+	}
+	var docs []*CSPPolicy
+	req := &couchdb.AllDocsRequest{Keys: keys}
+	err := couchdb.GetAllDocs(prefixer.GlobalPrefixer, consts.CSPPolicies, req, &docs)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for directive, sources := range doc.Sources {
+			if header, ok := cspDirectives[directive]; ok {
+				rules[header] = append(rules[header], sources...)
+			}
+		}
+	}
+
+	for header, sources := range rules {
+		rules[header] = uniqueSources(sources)
+	}
+	return rules, nil
+}
+
+func uniqueSources(sources []string) []string {
+	seen := make(map[string]struct{}, len(sources))
+	unique := sources[:0]
+	for _, s := range sources {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		unique = append(unique, s)
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSPPolicy(t *testing.T) {
+	t.Run("Validate", func(t *testing.T) {
+		policy := &CSPPolicy{
+			Slug: "drive",
+			Sources: map[string][]string{
+				"connect": {"https://analytics.example.net/", "wss://ws.example.net"},
+				"img":     {"data:", "https://tiles.example.net"},
+			},
+		}
+		assert.NoError(t, policy.Validate())
+
+		policy.Slug = ""
+		assert.Equal(t, ErrInvalidSlugName, policy.Validate())
+
+		policy.Slug = "drive"
+		policy.Sources["unknown"] = []string{"https://example.net/"}
+		assert.Equal(t, ErrInvalidCSPPolicy, policy.Validate())
+
+		delete(policy.Sources, "unknown")
+		policy.Sources["img"] = []string{"https://*.tiles.example.net"}
+		assert.Equal(t, ErrInvalidCSPPolicy, policy.Validate())
+	})
+
+	t.Run("ValidCSPSource", func(t *testing.T) {
+		assert.True(t, validCSPSource("https://example.net"))
+		assert.True(t, validCSPSource("wss://example.net/socket"))
+		assert.True(t, validCSPSource("cozydrive:"))
+		assert.True(t, validCSPSource("https://tiles.example.net:8443"))
+		assert.False(t, validCSPSource(""))
+		assert.False(t, validCSPSource("*"))
+		assert.False(t, validCSPSource("https://*"))
+		assert.False(t, validCSPSource("https://*.tiles.example.net"))
+		assert.False(t, validCSPSource("https://tiles.example.net:*"))
+		assert.False(t, validCSPSource("'unsafe-eval'"))
+		assert.False(t, validCSPSource("https://example.net; script-src *"))
+		assert.False(t, validCSPSource("ftp://example.net"))
+		assert.False(t, validCSPSource("example.net"))
+	})
+
+	t.Run("UniqueSources", func(t *testing.T) {
+		sources := []string{"https://b.example.net", "https://a.example.net", "https://b.example.net"}
+		assert.Equal(t, []string{"https://a.example.net", "https://b.example.net"}, uniqueSources(sources))
+	})
+
+	t.Run("CSPPolicyID", func(t *testing.T) {
+		assert.Equal(t, "drive", cspPolicyID("", "drive"))
+		assert.Equal(t, "beta/drive", cspPolicyID("beta", "drive"))
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/appfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -16,6 +17,14 @@ import (
 	"github.com/cozy/cozy-stack/pkg/prefixer"
 )
 
+// Aggregator is the declaration, in the manifest of a konnector, of the
+// aggregator account that it shares with other konnectors. The scope is the
+// list of the secrets of the aggregator account that the konnector can read.
+type Aggregator struct {
+	AccountID string   `json:"accountId"`
+	Scope     []string `json:"scope,omitempty"`
+}
+
 // KonnManifest contains all the informations associated with an installed
 // konnector.
 type KonnManifest struct {
@@ -42,9 +51,13 @@ type KonnManifest struct {
 		OnDeleteAccount string `json:"on_delete_account"`
 
 		// Fields with complex types
-		Permissions   permission.Set `json:"permissions"`
-		Terms         Terms          `json:"terms"`
-		Notifications Notifications  `json:"notifications"`
+		Aggregator     *Aggregator    `json:"aggregator"`
+		Permissions    permission.Set `json:"permissions"`
+		Terms          Terms          `json:"terms"`
+		Notifications  Notifications  `json:"notifications"`
+		Unavailability Unavailability `json:"unavailability"`
+
+		CustomMetadata vfs.CustomMetadataSchema `json:"custom_metadata"`
 	}
 }
 
@@ -146,6 +159,12 @@ func (m *KonnManifest) Notifications() Notifications {
 	return m.val.Notifications
 }
 
+// Unavailability returns the windows where the provider of the konnector is
+// known to be unavailable, as declared in the manifest.
+func (m *KonnManifest) Unavailability() Unavailability {
+	return m.val.Unavailability
+}
+
 // Parameters returns the parameters for executing the konnector.
 func (m *KonnManifest) Parameters() map[string]interface{} {
 	return m.val.Parameters
@@ -165,6 +184,15 @@ func (m *KonnManifest) Language() string { return m.val.Language }
 // when an account associated with the konnector is deleted.
 func (m *KonnManifest) OnDeleteAccount() string { return m.val.OnDeleteAccount }
 
+// Aggregator returns the aggregator account declared by the konnector, or nil
+// if the konnector is not based on an aggregator.
+func (m *KonnManifest) Aggregator() *Aggregator { return m.val.Aggregator }
+
+// CustomMetadata is part of the Manifest interface
+func (m *KonnManifest) CustomMetadata() vfs.CustomMetadataSchema {
+	return m.val.CustomMetadata
+}
+
 // VendorLink returns the vendor link.
 func (m *KonnManifest) VendorLink() interface{} {
 	return m.doc.M["vendor_link"]
@@ -221,6 +249,10 @@ func (m *KonnManifest) ReadManifest(r io.Reader, slug, sourceURL string) (Manife
 		return nil, ErrBadManifest
 	}
 
+	if err := newManifest.val.CustomMetadata.Check(); err != nil {
+		return nil, err
+	}
+
 	newManifest.SetID(consts.Konnectors + "/" + slug)
 	newManifest.SetRev(m.Rev())
 	newManifest.SetState(m.State())
@@ -243,6 +275,10 @@ func (m *KonnManifest) Create(db prefixer.Prefixer) error {
 		return err
 	}
 
+	if err := defineCustomMetadataIndexes(db, m.Slug(), m.val.CustomMetadata); err != nil {
+		return err
+	}
+
 	_, err := permission.CreateKonnectorSet(db, m.Slug(), m.Permissions(), m.Version())
 	return err
 }
@@ -254,6 +290,9 @@ func (m *KonnManifest) Update(db prefixer.Prefixer, extraPerms permission.Set) e
 	if err != nil {
 		return err
 	}
+	if err := defineCustomMetadataIndexes(db, m.Slug(), m.val.CustomMetadata); err != nil {
+		return err
+	}
 
 	perms := m.Permissions()
 
@@ -274,6 +313,7 @@ func (m *KonnManifest) Delete(db prefixer.Prefixer) error {
 	if err != nil && !couchdb.IsNotFoundError(err) {
 		return err
 	}
+	deleteCustomMetadataIndexes(db, m.Slug())
 	return couchdb.DeleteDoc(db, m)
 }
 
@@ -0,0 +1,257 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+// provisioningReportID is the identifier of the document with the report of
+// the last provisioning of an instance.
+const provisioningReportID = "report"
+
+const (
+	// ProvisioningInstalled is the action when an app has been installed.
+	ProvisioningInstalled = "installed"
+	// ProvisioningUpdated is the action when an app has been moved to the
+	// version or channel of the profile.
+	ProvisioningUpdated = "updated"
+	// ProvisioningUpToDate is the action when an app is already as defined by
+	// the profile.
+	ProvisioningUpToDate = "up-to-date"
+	// ProvisioningSkipped is the action when an app has been left untouched,
+	// as it was installed or removed by the user.
+	ProvisioningSkipped = "skipped"
+	// ProvisioningFailed is the action when an app cannot be installed or
+	// updated.
+	ProvisioningFailed = "failed"
+)
+
+// ProvisioningItem is an app or konnector of a provisioning profile. The
+// version and channel are optional: the stable channel is used by default.
+// The mandatory apps are installed when they are missing, even if the
+// instance has already been provisioned.
+type ProvisioningItem struct {
+	Slug      string `json:"slug"`
+	Version   string `json:"version,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Mandatory bool   `json:"mandatory,omitempty"`
+}
+
+// Source returns the registry URL for installing the app.
+func (item ProvisioningItem) Source() string {
+	if item.Version != "" {
+		return "registry://" + item.Slug + "/" + item.Version
+	}
+	channel := item.Channel
+	if channel == "" {
+		channel = "stable"
+	}
+	return "registry://" + item.Slug + "/" + channel
+}
+
+// ProvisioningProfile is the list of apps and konnectors that a context
+// installs on its instances. It is defined in the provisioning section of the
+// context in the config file. The schedule is a cron spec for converging the
+// instances toward the profile.
+type ProvisioningProfile struct {
+	Schedule   string             `json:"schedule,omitempty"`
+	Webapps    []ProvisioningItem `json:"apps,omitempty"`
+	Konnectors []ProvisioningItem `json:"konnectors,omitempty"`
+}
+
+// ProvisioningResult is what has been done for an app during a provisioning.
+type ProvisioningResult struct {
+	Type   string `json:"type"`
+	Slug   string `json:"slug"`
+	Action string `json:"action"`
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ProvisioningReport is the report of the last provisioning of an instance.
+// It also keeps the list of the apps installed by the provisioning, as the
+// apps installed by the user must never be touched.
+type ProvisioningReport struct {
+	DocID   string               `json:"_id,omitempty"`
+	DocRev  string               `json:"_rev,omitempty"`
+	RanAt   time.Time            `json:"ran_at"`
+	Managed []string             `json:"managed"`
+	Results []ProvisioningResult `json:"results"`
+}
+
+// ID implements the couchdb.Doc interface
+func (r *ProvisioningReport) ID() string { return r.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (r *ProvisioningReport) Rev() string { return r.DocRev }
+
+// DocType implements the couchdb.Doc interface
+func (r *ProvisioningReport) DocType() string { return consts.AppsProvisioning }
+
+// SetID implements the couchdb.Doc interface
+func (r *ProvisioningReport) SetID(id string) { r.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (r *ProvisioningReport) SetRev(rev string) { r.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (r *ProvisioningReport) Clone() couchdb.Doc {
+	cloned := *r
+	cloned.Managed = make([]string, len(r.Managed))
+	copy(cloned.Managed, r.Managed)
+	cloned.Results = make([]ProvisioningResult, len(r.Results))
+	copy(cloned.Results, r.Results)
+	return &cloned
+}
+
+func (r *ProvisioningReport) isManaged(key string) bool {
+	for _, managed := range r.Managed {
+		if managed == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProvisioningProfile returns the provisioning profile of the context of
+// the instance. The boolean is false if the context has no profile.
+func GetProvisioningProfile(inst *instance.Instance) (*ProvisioningProfile, bool) {
+	ctxSettings, ok := inst.SettingsContext()
+	if !ok {
+		return nil, false
+	}
+	raw, ok := ctxSettings["provisioning"]
+	if !ok {
+		return nil, false
+	}
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false
+	}
+	var profile ProvisioningProfile
+	if err := json.Unmarshal(buf, &profile); err != nil {
+		inst.Logger().WithNamespace("provisioning").
+			Warnf("Invalid provisioning profile for the context %s: %s", inst.ContextName, err)
+		return nil, false
+	}
+	return &profile, true
+}
+
+// GetProvisioningReport returns the report of the last provisioning of the
+// instance.
+func GetProvisioningReport(inst *instance.Instance) (*ProvisioningReport, error) {
+	var report ProvisioningReport
+	err := couchdb.GetDoc(inst, consts.AppsProvisioning, provisioningReportID, &report)
+	if couchdb.IsNotFoundError(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Provision installs the apps and konnectors of the provisioning profile of
+// the context of the instance. For the initial provisioning (at the creation
+// of the instance), all the apps of the profile are installed. After that,
+// only the mandatory apps are installed if they are missing, and the apps
+// installed by a previous provisioning are moved to the version or channel of
+// the profile. The apps installed by the user are never touched.
+func Provision(inst *instance.Instance, profile *ProvisioningProfile, initial bool) (*ProvisioningReport, error) {
+	report, err := GetProvisioningReport(inst)
+	if errors.Is(err, ErrNotFound) {
+		report = &ProvisioningReport{DocID: provisioningReportID}
+	} else if err != nil {
+		return nil, err
+	}
+
+	managed := make([]string, 0, len(profile.Webapps)+len(profile.Konnectors))
+	results := make([]ProvisioningResult, 0, cap(managed))
+	for _, appType := range []consts.AppType{consts.WebappType, consts.KonnectorType} {
+		items := profile.Webapps
+		if appType == consts.KonnectorType {
+			items = profile.Konnectors
+		}
+		for _, item := range items {
+			key := appType.String() + "/" + item.Slug
+			wasManaged := report.isManaged(key)
+			result := provisionApp(inst, appType, item, initial, wasManaged)
+			results = append(results, result)
+			isManaged := result.Action == ProvisioningInstalled ||
+				result.Action == ProvisioningUpdated ||
+				result.Action == ProvisioningUpToDate ||
+				(result.Action == ProvisioningFailed && wasManaged)
+			if isManaged {
+				managed = append(managed, key)
+			}
+		}
+	}
+
+	report.RanAt = time.Now().UTC()
+	report.Managed = managed
+	report.Results = results
+	if err := couchdb.Upsert(inst, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func provisionApp(inst *instance.Instance, appType consts.AppType, item ProvisioningItem, initial, managed bool) ProvisioningResult {
+	result := ProvisioningResult{
+		Type:   appType.String(),
+		Slug:   item.Slug,
+		Source: item.Source(),
+	}
+
+	man, err := GetBySlug(inst, item.Slug, appType)
+	op := Update
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// An app removed by the user is only reinstalled if it is mandatory
+		if !initial && !item.Mandatory {
+			result.Action = ProvisioningSkipped
+			return result
+		}
+		op = Install
+	case err != nil:
+		result.Action = ProvisioningFailed
+		result.Error = err.Error()
+		return result
+	case !managed && !initial:
+		result.Action = ProvisioningSkipped
+		return result
+	case man.Source() == result.Source:
+		result.Action = ProvisioningUpToDate
+		return result
+	}
+
+	installer, err := NewInstaller(inst, Copier(appType, inst), &InstallerOptions{
+		Operation:        op,
+		Type:             appType,
+		SourceURL:        result.Source,
+		Slug:             item.Slug,
+		Registries:       inst.Registries(),
+		PermissionsAcked: true,
+	})
+	if err == nil {
+		_, err = installer.RunSync()
+	}
+	if err != nil {
+		result.Action = ProvisioningFailed
+		result.Error = err.Error()
+		return result
+	}
+	if op == Install {
+		result.Action = ProvisioningInstalled
+	} else {
+		result.Action = ProvisioningUpdated
+	}
+	return result
+}
+
+var _ couchdb.Doc = &ProvisioningReport{}
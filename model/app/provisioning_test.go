@@ -0,0 +1,50 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvisioning(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("Source", func(t *testing.T) {
+		assert.Equal(t, "registry://drive/stable", ProvisioningItem{Slug: "drive"}.Source())
+		assert.Equal(t, "registry://drive/beta", ProvisioningItem{Slug: "drive", Channel: "beta"}.Source())
+		assert.Equal(t, "registry://drive/1.42.0", ProvisioningItem{Slug: "drive", Channel: "beta", Version: "1.42.0"}.Source())
+	})
+
+	t.Run("GetProvisioningProfile", func(t *testing.T) {
+		conf := config.GetConfig()
+		conf.Contexts = map[string]interface{}{
+			"provisioned": map[string]interface{}{
+				"provisioning": map[string]interface{}{
+					"schedule": "0 0 3 * * *",
+					"apps": []interface{}{
+						map[string]interface{}{"slug": "drive", "mandatory": true},
+					},
+					"konnectors": []interface{}{
+						map[string]interface{}{"slug": "impots", "version": "1.0.0"},
+					},
+				},
+			},
+			"bare": map[string]interface{}{},
+		}
+
+		profile, ok := GetProvisioningProfile(&instance.Instance{ContextName: "provisioned"})
+		require.True(t, ok)
+		assert.Equal(t, "0 0 3 * * *", profile.Schedule)
+		require.Len(t, profile.Webapps, 1)
+		assert.Equal(t, "drive", profile.Webapps[0].Slug)
+		assert.True(t, profile.Webapps[0].Mandatory)
+		require.Len(t, profile.Konnectors, 1)
+		assert.Equal(t, "registry://impots/1.0.0", profile.Konnectors[0].Source())
+
+		_, ok = GetProvisioningProfile(&instance.Instance{ContextName: "bare"})
+		assert.False(t, ok)
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/model/notification"
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/appfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -106,6 +107,8 @@ type WebappManifest struct {
 		Services      Services       `json:"services"`
 		Locales       Locales        `json:"locales"`
 		Notifications Notifications  `json:"notifications"`
+
+		CustomMetadata vfs.CustomMetadataSchema `json:"custom_metadata"`
 	}
 
 	FromAppsDir bool        `json:"-"` // Used in development
@@ -207,6 +210,11 @@ func (m *WebappManifest) Services() Services {
 	return m.val.Services
 }
 
+// CustomMetadata is part of the Manifest interface
+func (m *WebappManifest) CustomMetadata() vfs.CustomMetadataSchema {
+	return m.val.CustomMetadata
+}
+
 // SetError is part of the Manifest interface
 func (m *WebappManifest) SetError(err error) {
 	m.SetState(Errored)
@@ -292,6 +300,10 @@ func (m *WebappManifest) ReadManifest(r io.Reader, slug, sourceURL string) (Mani
 		return nil, ErrBadManifest
 	}
 
+	if err := newManifest.val.CustomMetadata.Check(); err != nil {
+		return nil, err
+	}
+
 	newManifest.SetID(consts.Apps + "/" + slug)
 	newManifest.SetRev(m.Rev())
 	newManifest.SetState(m.State())
@@ -328,6 +340,10 @@ func (m *WebappManifest) Create(db prefixer.Prefixer) error {
 		_ = couchdb.UpdateDoc(db, m)
 	}
 
+	if err := defineCustomMetadataIndexes(db, m.Slug(), m.val.CustomMetadata); err != nil {
+		return err
+	}
+
 	_, err := permission.CreateWebappSet(db, m.Slug(), m.Permissions(), m.Version())
 	return err
 }
@@ -341,6 +357,9 @@ func (m *WebappManifest) Update(db prefixer.Prefixer, extraPerms permission.Set)
 	if err := couchdb.UpdateDoc(db, m); err != nil {
 		return err
 	}
+	if err := defineCustomMetadataIndexes(db, m.Slug(), m.val.CustomMetadata); err != nil {
+		return err
+	}
 
 	var err error
 	perms := m.Permissions()
@@ -367,6 +386,7 @@ func (m *WebappManifest) Delete(db prefixer.Prefixer) error {
 	if err != nil && !couchdb.IsNotFoundError(err) {
 		return err
 	}
+	deleteCustomMetadataIndexes(db, m.Slug())
 	return couchdb.DeleteDoc(db, m)
 }
 
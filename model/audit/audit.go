@@ -0,0 +1,222 @@
+// Package audit is used to record the changes made on the permissions and the
+// sharings of an instance, so that it is possible to know later who has
+// created a share link or added a member to a sharing, and when.
+package audit
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// ActionCreate is used when a document is created.
+	ActionCreate = "create"
+	// ActionUpdate is used when a document is modified.
+	ActionUpdate = "update"
+	// ActionRevoke is used when a document is revoked or deleted.
+	ActionRevoke = "revoke"
+	// ActionAccess is used for a request made with a session opened by the
+	// support.
+	ActionAccess = "access"
+)
+
+// ActorSupport is the kind of actor for an operator of the support, with a
+// session opened from the admin API.
+const ActorSupport = "support"
+
+// ActorOperator is the kind of actor for an operator using the admin API,
+// like for the escrow exports.
+const ActorOperator = "operator"
+
+// Actor describes who has made a change.
+type Actor struct {
+	// Kind is the kind of token used for the request (app, konnector, oauth,
+	// cli, share, etc.)
+	Kind string `json:"kind,omitempty"`
+	// ID identifies the app or client, like io.cozy.apps/drive
+	ID string `json:"id,omitempty"`
+	IP string `json:"ip,omitempty"`
+	// Support is the operator of the support when the request has been made
+	// with a support session
+	Support string `json:"support,omitempty"`
+}
+
+// Entry is a document of the audit trail. These documents are never modified
+// after their creation, they are only deleted after the retention period.
+type Entry struct {
+	DocID  string `json:"_id,omitempty"`
+	DocRev string `json:"_rev,omitempty"`
+	Action string `json:"action"`
+	// ObjectType and ObjectID identify the document that has been changed
+	ObjectType string      `json:"object_type"`
+	ObjectID   string      `json:"object_id"`
+	Actor      Actor       `json:"actor"`
+	Before     interface{} `json:"before,omitempty"`
+	After      interface{} `json:"after,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (e *Entry) ID() string { return e.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (e *Entry) Rev() string { return e.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (e *Entry) DocType() string { return consts.Audit }
+
+// Clone implements couchdb.Doc
+func (e *Entry) Clone() couchdb.Doc {
+	cloned := *e
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (e *Entry) SetID(id string) { e.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (e *Entry) SetRev(rev string) { e.DocRev = rev }
+
+// Record adds an entry to the audit trail of the instance. An error is only
+// logged, as it should not prevent the change to be made.
+func Record(inst *instance.Instance, action, objectType, objectID string, actor Actor, before, after interface{}) {
+	entry := &Entry{
+		Action:     action,
+		ObjectType: objectType,
+		ObjectID:   objectID,
+		Actor:      actor,
+		Before:     before,
+		After:      after,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := couchdb.CreateDoc(inst, entry); err != nil {
+		inst.Logger().WithNamespace("audit").
+			Errorf("Cannot record %s of %s %s: %s", action, objectType, objectID, err)
+		return
+	}
+	job.EnsureDailyTrigger(inst, "clean-audit", nil)
+}
+
+// RecordGlobal adds an entry to the audit trail of the stack, in the global
+// database, for the actions that must be kept after the destruction of an
+// instance, like the accesses to the escrow exports.
+func RecordGlobal(action, objectType, objectID string, actor Actor, before, after interface{}) error {
+	entry := &Entry{
+		Action:     action,
+		ObjectType: objectType,
+		ObjectID:   objectID,
+		Actor:      actor,
+		Before:     before,
+		After:      after,
+		CreatedAt:  time.Now().UTC(),
+	}
+	return couchdb.CreateDoc(prefixer.GlobalPrefixer, entry)
+}
+
+// PermissionState returns the state of a permission document to record in
+// the audit trail. The codes are replaced by their names, as the audit trail
+// must not contain secrets.
+func PermissionState(p *permission.Permission) interface{} {
+	if p == nil {
+		return nil
+	}
+	state := map[string]interface{}{
+		"type":        p.Type,
+		"source_id":   p.SourceID,
+		"permissions": p.Permissions,
+	}
+	if p.ExpiresAt != nil {
+		state["expires_at"] = p.ExpiresAt
+	}
+	if len(p.Codes) > 0 {
+		names := make([]string, 0, len(p.Codes))
+		for name := range p.Codes {
+			names = append(names, name)
+		}
+		state["codes"] = names
+	}
+	return state
+}
+
+// SharingState returns the state of a sharing to record in the audit trail.
+// The credentials are not included.
+func SharingState(s *sharing.Sharing) interface{} {
+	if s == nil {
+		return nil
+	}
+	members := make([]sharing.Member, len(s.Members))
+	copy(members, s.Members)
+	return map[string]interface{}{
+		"description": s.Description,
+		"app_slug":    s.AppSlug,
+		"rules":       s.Rules,
+		"members":     members,
+	}
+}
+
+// List returns the entries of the audit trail created after the given date,
+// from the oldest to the newest.
+func List(db prefixer.Prefixer, since time.Time, limit int) ([]*Entry, error) {
+	var entries []*Entry
+	req := &couchdb.FindRequest{
+		UseIndex: "by-created-at",
+		Selector: mango.Gt("created_at", since.UTC().Format(time.RFC3339Nano)),
+		Sort: mango.SortBy{
+			{Field: "created_at", Direction: mango.Asc},
+		},
+		Limit: limit,
+	}
+	err := couchdb.FindDocs(db, consts.Audit, req, &entries)
+	if couchdb.IsNoDatabaseError(err) {
+		return nil, nil
+	}
+	return entries, err
+}
+
+// CleanOld deletes the entries of the audit trail that are older than the
+// retention period configured for the stack. It returns the number of deleted
+// entries.
+func CleanOld(db prefixer.Prefixer) (int, error) {
+	retention := config.GetConfig().AuditRetention
+	if retention <= 0 {
+		return 0, nil
+	}
+	before := time.Now().Add(-retention).UTC()
+
+	count := 0
+	for {
+		var entries []*Entry
+		req := &couchdb.FindRequest{
+			UseIndex: "by-created-at",
+			Selector: mango.Lt("created_at", before.Format(time.RFC3339Nano)),
+			Limit:    1000,
+		}
+		err := couchdb.FindDocs(db, consts.Audit, req, &entries)
+		if couchdb.IsNoDatabaseError(err) {
+			return count, nil
+		}
+		if err != nil || len(entries) == 0 {
+			return count, err
+		}
+		docs := make([]couchdb.Doc, len(entries))
+		for i, entry := range entries {
+			docs[i] = entry
+		}
+		if err := couchdb.BulkDeleteDocs(db, consts.Audit, docs); err != nil {
+			return count, err
+		}
+		count += len(entries)
+		if len(entries) < 1000 {
+			return count, nil
+		}
+	}
+}
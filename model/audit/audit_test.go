@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	t.Run("PermissionStateHidesCodes", func(t *testing.T) {
+		p := &permission.Permission{
+			Type:     permission.TypeShareByLink,
+			SourceID: "io.cozy.apps/drive",
+			Codes:    map[string]string{"bob": "secret-code"},
+			Permissions: permission.Set{
+				permission.Rule{Type: "io.cozy.files", Values: []string{"foo"}},
+			},
+		}
+		data, err := json.Marshal(PermissionState(p))
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "secret-code")
+		assert.Contains(t, string(data), `"codes":["bob"]`)
+		assert.Contains(t, string(data), `"source_id":"io.cozy.apps/drive"`)
+		assert.Nil(t, PermissionState(nil))
+	})
+
+	t.Run("SharingStateIsACopy", func(t *testing.T) {
+		s := &sharing.Sharing{
+			Description: "Holidays",
+			Members: []sharing.Member{
+				{Status: sharing.MemberStatusOwner, Email: "alice@example.net"},
+				{Status: sharing.MemberStatusReady, Email: "bob@example.net"},
+			},
+		}
+		before := SharingState(s)
+		s.Members[1].Status = sharing.MemberStatusRevoked
+		members := before.(map[string]interface{})["members"].([]sharing.Member)
+		assert.Equal(t, sharing.MemberStatusReady, members[1].Status)
+	})
+}
@@ -27,6 +27,38 @@ const (
 	OrgMemberConfirmed OrgMemberStatus = 2
 )
 
+// OrgMemberRole is a type for the role of a member in an organization (the
+// owner has all the rights, whatever their role)
+type OrgMemberRole string
+
+const (
+	// OrgRoleAdmin is used for a member that can read and write the ciphers,
+	// and confirm the other members.
+	OrgRoleAdmin OrgMemberRole = "admin"
+	// OrgRoleUser is used for a member that can read and write the ciphers.
+	OrgRoleUser OrgMemberRole = "user"
+	// OrgRoleReadOnly is used for a member that receives the ciphers, but
+	// cannot modify them.
+	OrgRoleReadOnly OrgMemberRole = "read_only"
+)
+
+// ErrInvalidOrgRole is used when a role for a member of an organization is
+// not one of the known roles.
+var ErrInvalidOrgRole = errors.New("invalid role")
+
+// ErrReadOnlyMember is used when a member with the read-only role tries to
+// modify a cipher of an organization.
+var ErrReadOnlyMember = errors.New("the member has a read-only access to the organization")
+
+// ParseOrgMemberRole returns the role for the given string.
+func ParseOrgMemberRole(role string) (OrgMemberRole, error) {
+	switch r := OrgMemberRole(role); r {
+	case OrgRoleAdmin, OrgRoleUser, OrgRoleReadOnly:
+		return r, nil
+	}
+	return "", ErrInvalidOrgRole
+}
+
 // OrgMember is a struct for describing a member of an organization.
 type OrgMember struct {
 	UserID   string          `json:"user_id"`
@@ -36,6 +68,37 @@ type OrgMember struct {
 	Status   OrgMemberStatus `json:"status"`
 	Owner    bool            `json:"owner,omitempty"`
 	ReadOnly bool            `json:"read_only,omitempty"`
+	Role     OrgMemberRole   `json:"role,omitempty"`
+}
+
+// EffectiveRole returns the role of the member. The members added before the
+// roles have only the read-only flag.
+func (m *OrgMember) EffectiveRole() OrgMemberRole {
+	if m.ReadOnly {
+		return OrgRoleReadOnly
+	}
+	if m.Role == "" || m.Role == OrgRoleReadOnly {
+		return OrgRoleUser
+	}
+	return m.Role
+}
+
+// SetRole changes the role of the member, and keeps the read-only flag in
+// sync with it.
+func (m *OrgMember) SetRole(role OrgMemberRole) {
+	m.Role = role
+	m.ReadOnly = role == OrgRoleReadOnly
+}
+
+// CanWrite returns true if the member can modify the ciphers of the
+// organization.
+func (m *OrgMember) CanWrite() bool {
+	return m.Owner || m.EffectiveRole() != OrgRoleReadOnly
+}
+
+// CanManageMembers returns true if the member can confirm the other members.
+func (m *OrgMember) CanManageMembers() bool {
+	return m.Owner || m.EffectiveRole() == OrgRoleAdmin
 }
 
 // Collection is used to regroup ciphers.
@@ -115,6 +178,27 @@ func (o *Organization) Delete(inst *instance.Instance) error {
 	return couchdb.DeleteDoc(inst, o)
 }
 
+// CheckWritable returns ErrReadOnlyMember if the instance is a read-only member
+// of the organization. The ciphers that are not in a shared organization can
+// always be modified.
+func CheckWritable(inst *instance.Instance, orgID string) error {
+	if orgID == "" {
+		return nil
+	}
+	org := &Organization{}
+	if err := couchdb.GetDoc(inst, consts.BitwardenOrganizations, orgID, org); err != nil {
+		if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+			return nil
+		}
+		return err
+	}
+	m, ok := org.Members[inst.Domain]
+	if ok && !m.CanWrite() {
+		return ErrReadOnlyMember
+	}
+	return nil
+}
+
 // GetCozyOrganization returns the organization used to store the credentials
 // for the konnectors running on the Cozy server.
 func GetCozyOrganization(inst *instance.Instance, setting *settings.Settings) (*Organization, error) {
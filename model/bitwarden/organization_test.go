@@ -0,0 +1,44 @@
+package bitwarden
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrgMemberRoles(t *testing.T) {
+	t.Run("ParseOrgMemberRole", func(t *testing.T) {
+		role, err := ParseOrgMemberRole("read_only")
+		assert.NoError(t, err)
+		assert.Equal(t, OrgRoleReadOnly, role)
+		_, err = ParseOrgMemberRole("owner")
+		assert.ErrorIs(t, err, ErrInvalidOrgRole)
+	})
+
+	t.Run("EffectiveRole", func(t *testing.T) {
+		// Members added before the roles
+		assert.Equal(t, OrgRoleUser, (&OrgMember{}).EffectiveRole())
+		assert.Equal(t, OrgRoleReadOnly, (&OrgMember{ReadOnly: true}).EffectiveRole())
+
+		m := &OrgMember{}
+		m.SetRole(OrgRoleReadOnly)
+		assert.True(t, m.ReadOnly)
+		assert.False(t, m.CanWrite())
+		assert.False(t, m.CanManageMembers())
+
+		m.SetRole(OrgRoleAdmin)
+		assert.False(t, m.ReadOnly)
+		assert.True(t, m.CanWrite())
+		assert.True(t, m.CanManageMembers())
+
+		m.SetRole(OrgRoleUser)
+		assert.True(t, m.CanWrite())
+		assert.False(t, m.CanManageMembers())
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		owner := &OrgMember{Owner: true}
+		assert.True(t, owner.CanWrite())
+		assert.True(t, owner.CanManageMembers())
+	})
+}
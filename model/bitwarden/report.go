@@ -0,0 +1,347 @@
+package bitwarden
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/safehttp"
+)
+
+const (
+	// passwordHealthReportID is the identifier of the document for the last
+	// password health report of the instance.
+	passwordHealthReportID = "password-health"
+
+	// defaultHIBPURL is the URL of the range API of Have I Been Pwned. Only
+	// the first 5 characters of the SHA-1 of a password are sent to it (k-
+	// anonymity), and the matching is made by the client.
+	defaultHIBPURL = "https://api.pwnedpasswords.com/range/"
+
+	// defaultOldPasswordDays is the number of days after which a password
+	// that has not been changed is reported as old.
+	defaultOldPasswordDays = 365
+)
+
+// ErrInvalidHashPrefix is used when the prefix of a password hash sent by
+// the client is not made of 5 hexadecimal characters.
+var ErrInvalidHashPrefix = errors.New("invalid hash prefix")
+
+// ErrBreachCheckDisabled is used when the range API is asked for a context
+// where the check against the data breaches has been disabled.
+var ErrBreachCheckDisabled = errors.New("the breach check is disabled")
+
+// ErrNoPasswordHealthReport is used when the password health report is asked
+// but none has been computed for the instance.
+var ErrNoPasswordHealthReport = errors.New("no password health report")
+
+// ExposedCipher is a cipher with a password that has been found in the data
+// breaches, and the number of times it has been seen.
+type ExposedCipher struct {
+	CipherID string `json:"cipher_id"`
+	Count    int    `json:"count"`
+}
+
+// PasswordHealthReport is the result of the analysis of the passwords of the
+// ciphers. The ciphers are end-to-end encrypted, so the reused and exposed
+// passwords are found by the client, and the stack only knows the identifiers
+// of the ciphers: it never sees the passwords, nor their hashes.
+type PasswordHealthReport struct {
+	CouchID     string          `json:"_id,omitempty"`
+	CouchRev    string          `json:"_rev,omitempty"`
+	Total       int             `json:"total"`
+	Reused      []string        `json:"reused"`
+	Old         []string        `json:"old"`
+	Exposed     []ExposedCipher `json:"exposed"`
+	BreachCheck bool            `json:"breach_check"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ID returns the report identifier
+func (r *PasswordHealthReport) ID() string { return r.CouchID }
+
+// Rev returns the report revision
+func (r *PasswordHealthReport) Rev() string { return r.CouchRev }
+
+// DocType returns the report document type
+func (r *PasswordHealthReport) DocType() string { return consts.BitwardenReports }
+
+// Clone implements couchdb.Doc
+func (r *PasswordHealthReport) Clone() couchdb.Doc {
+	cloned := *r
+	cloned.Reused = make([]string, len(r.Reused))
+	copy(cloned.Reused, r.Reused)
+	cloned.Old = make([]string, len(r.Old))
+	copy(cloned.Old, r.Old)
+	cloned.Exposed = make([]ExposedCipher, len(r.Exposed))
+	copy(cloned.Exposed, r.Exposed)
+	return &cloned
+}
+
+// SetID changes the report identifier
+func (r *PasswordHealthReport) SetID(id string) { r.CouchID = id }
+
+// SetRev changes the report revision
+func (r *PasswordHealthReport) SetRev(rev string) { r.CouchRev = rev }
+
+// PasswordHealthOptions are the options for computing the password health
+// report. They can be overridden in the context of the instance with the
+// password_health parameter.
+type PasswordHealthOptions struct {
+	// OldAfter is the duration after which a password is reported as old (0
+	// to disable this check).
+	OldAfter time.Duration
+	// BreachCheck tells if the passwords are checked against the data
+	// breaches.
+	BreachCheck bool
+	// HIBPURL is the URL of the range API used for the breach check.
+	HIBPURL string
+}
+
+// PasswordHealthOptionsFor returns the options for the password health
+// report of the given instance.
+func PasswordHealthOptionsFor(inst *instance.Instance) PasswordHealthOptions {
+	opts := PasswordHealthOptions{
+		OldAfter:    defaultOldPasswordDays * 24 * time.Hour,
+		BreachCheck: true,
+		HIBPURL:     defaultHIBPURL,
+	}
+	ctxSettings, ok := inst.SettingsContext()
+	if !ok {
+		return opts
+	}
+	params, ok := ctxSettings["password_health"].(map[string]interface{})
+	if !ok {
+		return opts
+	}
+	if check, ok := params["breach_check"].(bool); ok {
+		opts.BreachCheck = check
+	}
+	if u, ok := params["hibp_url"].(string); ok && u != "" {
+		if !strings.HasSuffix(u, "/") {
+			u += "/"
+		}
+		opts.HIBPURL = u
+	}
+	switch days := params["old_password_days"].(type) {
+	case int:
+		opts.OldAfter = time.Duration(days) * 24 * time.Hour
+	case float64:
+		opts.OldAfter = time.Duration(days) * 24 * time.Hour
+	case string:
+		if n, err := strconv.Atoi(days); err == nil {
+			opts.OldAfter = time.Duration(n) * 24 * time.Hour
+		}
+	}
+	return opts
+}
+
+// PasswordHealthChecks are the results of the checks made by the client on
+// the decrypted passwords: the ciphers that share their password with another
+// cipher, and the ciphers whose password has been found in the data breaches
+// with the range API.
+type PasswordHealthChecks struct {
+	Reused      []string
+	Exposed     []ExposedCipher
+	BreachCheck bool
+}
+
+// NormalizeHashPrefix checks that the given prefix is made of the 5 first
+// characters of a SHA-1 encoded in hexadecimal, and returns it in upper case,
+// like the range API.
+func NormalizeHashPrefix(prefix string) (string, error) {
+	if len(prefix) != 5 {
+		return "", ErrInvalidHashPrefix
+	}
+	if _, err := hex.DecodeString(prefix + "0"); err != nil {
+		return "", ErrInvalidHashPrefix
+	}
+	return strings.ToUpper(prefix), nil
+}
+
+// PasswordRange returns the suffixes of the hashes of the breached passwords
+// that start with the given prefix, with their number of occurrences. The
+// stack acts as a proxy for the range API, so that the clients don't have to
+// know its URL, and the matching is made by the client.
+func PasswordRange(inst *instance.Instance, prefix string) (map[string]int, error) {
+	prefix, err := NormalizeHashPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	opts := PasswordHealthOptionsFor(inst)
+	if !opts.BreachCheck {
+		return nil, ErrBreachCheckDisabled
+	}
+	return fetchHIBPRange(opts.HIBPURL, prefix)
+}
+
+// ComputePasswordHealth analyzes the login ciphers of the instance with the
+// results of the checks made by the client, and saves the report.
+func ComputePasswordHealth(inst *instance.Instance, checks *PasswordHealthChecks) (*PasswordHealthReport, error) {
+	var ciphers []*Cipher
+	err := couchdb.ForeachDocs(inst, consts.BitwardenCiphers, func(_ string, data json.RawMessage) error {
+		var c Cipher
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		ciphers = append(ciphers, &c)
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+
+	opts := PasswordHealthOptionsFor(inst)
+	report := buildPasswordHealthReport(ciphers, checks, opts, time.Now().UTC())
+
+	old, err := GetPasswordHealth(inst)
+	if err == nil {
+		report.SetRev(old.Rev())
+		err = couchdb.UpdateDoc(inst, report)
+	} else if errors.Is(err, ErrNoPasswordHealthReport) {
+		err = couchdb.CreateNamedDocWithDB(inst, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetPasswordHealth returns the last password health report of the instance.
+func GetPasswordHealth(inst *instance.Instance) (*PasswordHealthReport, error) {
+	report := &PasswordHealthReport{}
+	err := couchdb.GetDoc(inst, consts.BitwardenReports, passwordHealthReportID, report)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, ErrNoPasswordHealthReport
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// buildPasswordHealthReport makes the report for the given ciphers. The
+// results of the checks of the client are kept only for the active login
+// ciphers.
+func buildPasswordHealthReport(
+	ciphers []*Cipher,
+	checks *PasswordHealthChecks,
+	opts PasswordHealthOptions,
+	now time.Time,
+) *PasswordHealthReport {
+	report := &PasswordHealthReport{
+		CouchID:   passwordHealthReportID,
+		Reused:    []string{},
+		Old:       []string{},
+		Exposed:   []ExposedCipher{},
+		CreatedAt: now,
+	}
+
+	logins := make(map[string]bool)
+	for _, c := range ciphers {
+		if c.Type != LoginType || c.Login == nil || c.DeletedDate != nil {
+			continue
+		}
+		report.Total++
+		logins[c.CouchID] = true
+		if opts.OldAfter > 0 {
+			if date, ok := passwordDate(c); ok && now.Sub(date) > opts.OldAfter {
+				report.Old = append(report.Old, c.CouchID)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range checks.Reused {
+		if logins[id] && !seen[id] {
+			seen[id] = true
+			report.Reused = append(report.Reused, id)
+		}
+	}
+
+	if opts.BreachCheck && checks.BreachCheck {
+		report.BreachCheck = true
+		seen = make(map[string]bool)
+		for _, exposed := range checks.Exposed {
+			if logins[exposed.CipherID] && !seen[exposed.CipherID] && exposed.Count > 0 {
+				seen[exposed.CipherID] = true
+				report.Exposed = append(report.Exposed, exposed)
+			}
+		}
+	}
+
+	sort.Strings(report.Reused)
+	sort.Strings(report.Old)
+	sort.Slice(report.Exposed, func(i, j int) bool {
+		return report.Exposed[i].CipherID < report.Exposed[j].CipherID
+	})
+	return report
+}
+
+// passwordDate returns the date of the last change of the password of the
+// cipher, or its creation date for a password that has never been changed.
+func passwordDate(c *Cipher) (time.Time, bool) {
+	if c.Login.RevDate != "" {
+		if date, err := time.Parse(time.RFC3339, c.Login.RevDate); err == nil {
+			return date, true
+		}
+	}
+	if c.Metadata != nil && !c.Metadata.CreatedAt.IsZero() {
+		return c.Metadata.CreatedAt, true
+	}
+	return time.Time{}, false
+}
+
+// fetchHIBPRange returns the suffixes of the hashes of the breached passwords
+// that start with the given prefix, with their number of occurrences.
+func fetchHIBPRange(baseURL, prefix string) (map[string]int, error) {
+	req, err := http.NewRequest(http.MethodGet, baseURL+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The padding makes all the responses have a similar size, and the
+	// padded entries have a count of 0
+	req.Header.Set("Add-Padding", "true")
+	res, err := safehttp.ClientWithKeepAlive.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from the range API: %d", res.StatusCode)
+	}
+	return parseHIBPRange(res.Body)
+}
+
+func parseHIBPRange(r io.Reader) (map[string]int, error) {
+	suffixes := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		count, err := strconv.Atoi(parts[1])
+		if err != nil || count == 0 {
+			continue
+		}
+		suffixes[strings.ToUpper(parts[0])] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return suffixes, nil
+}
+
+var _ couchdb.Doc = &PasswordHealthReport{}
@@ -0,0 +1,82 @@
+package bitwarden
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHealth(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	longAgo := now.Add(-400 * 24 * time.Hour)
+	recently := now.Add(-10 * 24 * time.Hour)
+	deleted := now
+
+	ciphers := []*Cipher{
+		{CouchID: "a", Type: LoginType, Login: &LoginData{RevDate: longAgo.Format(time.RFC3339)}},
+		{CouchID: "b", Type: LoginType, Login: &LoginData{RevDate: recently.Format(time.RFC3339)}},
+		{CouchID: "c", Type: LoginType, Login: &LoginData{}, Metadata: &metadata.CozyMetadata{CreatedAt: longAgo}},
+		{CouchID: "d", Type: LoginType, Login: &LoginData{}, DeletedDate: &deleted},
+		{CouchID: "e", Type: SecureNoteType},
+	}
+	checks := &PasswordHealthChecks{
+		Reused: []string{"b", "a", "d", "unknown", "a"},
+		Exposed: []ExposedCipher{
+			{CipherID: "b", Count: 42},
+			{CipherID: "a", Count: 42},
+			{CipherID: "d", Count: 42},
+			{CipherID: "c", Count: 0},
+		},
+		BreachCheck: true,
+	}
+	opts := PasswordHealthOptions{OldAfter: 365 * 24 * time.Hour, BreachCheck: true}
+
+	t.Run("Report", func(t *testing.T) {
+		report := buildPasswordHealthReport(ciphers, checks, opts, now)
+		assert.Equal(t, 3, report.Total)
+		// The deleted and unknown ciphers are ignored
+		assert.Equal(t, []string{"a", "b"}, report.Reused)
+		assert.Equal(t, []string{"a", "c"}, report.Old)
+		assert.True(t, report.BreachCheck)
+		assert.Equal(t, []ExposedCipher{{"a", 42}, {"b", 42}}, report.Exposed)
+	})
+
+	t.Run("BreachCheckNotMade", func(t *testing.T) {
+		notMade := &PasswordHealthChecks{Reused: checks.Reused, Exposed: checks.Exposed}
+		report := buildPasswordHealthReport(ciphers, notMade, opts, now)
+		assert.False(t, report.BreachCheck)
+		assert.Empty(t, report.Exposed)
+		assert.Equal(t, []string{"a", "b"}, report.Reused)
+	})
+
+	t.Run("BreachCheckDisabled", func(t *testing.T) {
+		opts := PasswordHealthOptions{BreachCheck: false}
+		report := buildPasswordHealthReport(ciphers, checks, opts, now)
+		assert.False(t, report.BreachCheck)
+		assert.Empty(t, report.Exposed)
+		assert.Empty(t, report.Old)
+	})
+
+	t.Run("NormalizeHashPrefix", func(t *testing.T) {
+		prefix, err := NormalizeHashPrefix("5baa6")
+		require.NoError(t, err)
+		assert.Equal(t, "5BAA6", prefix)
+		_, err = NormalizeHashPrefix("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8")
+		assert.ErrorIs(t, err, ErrInvalidHashPrefix)
+		_, err = NormalizeHashPrefix("zzzzz")
+		assert.ErrorIs(t, err, ErrInvalidHashPrefix)
+	})
+
+	t.Run("ParseHIBPRange", func(t *testing.T) {
+		body := "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n" +
+			"011053FD0102E94D6AE2F8B83D76FAF94F6:0\r\n" +
+			"invalid\r\n"
+		suffixes, err := parseHIBPRange(strings.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 3861493}, suffixes)
+	})
+}
@@ -0,0 +1,318 @@
+// Package cloudimport is used to import the files of a Google Drive or a
+// OneDrive in the VFS of an instance. The import is done by the stack in a
+// long-lived job, and not by a konnector, as the konnectors have a timeout
+// that is too short for the large accounts.
+package cloudimport
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// GoogleDrive is the provider for importing the files from Google Drive.
+	GoogleDrive = "google_drive"
+	// OneDrive is the provider for importing the files from OneDrive.
+	OneDrive = "onedrive"
+)
+
+const (
+	// ConflictSkip keeps the existing file, and ignores the remote one.
+	ConflictSkip = "skip"
+	// ConflictRename imports the remote file with a new name.
+	ConflictRename = "rename"
+	// ConflictOverwrite writes the remote file as a new version of the
+	// existing file.
+	ConflictOverwrite = "overwrite"
+)
+
+const (
+	// StateQueued is the state of an import waiting for its job.
+	StateQueued = "queued"
+	// StateRunning is the state of an import in progress.
+	StateRunning = "running"
+	// StateDone is the state of an import that has finished successfully.
+	StateDone = "done"
+	// StateErrored is the state of an import that has been stopped by an
+	// error. It can be resumed.
+	StateErrored = "errored"
+	// StateCanceled is the state of an import that has been canceled.
+	StateCanceled = "canceled"
+)
+
+// WorkerType is the type of the jobs used for the imports.
+const WorkerType = "cloud-import"
+
+// rootFolderID is the identifier used by both providers for the root of the
+// drive.
+const rootFolderID = "root"
+
+// maxFailures is the maximal number of failures kept in the import document.
+const maxFailures = 50
+
+// staleDelay is the delay after which an import in the running state without
+// progress is considered as stale, and can be resumed.
+const staleDelay = 10 * time.Minute
+
+var (
+	// ErrUnknownProvider is used when the provider is not Google Drive or
+	// OneDrive.
+	ErrUnknownProvider = errors.New("Unknown provider")
+	// ErrInvalidConflictPolicy is used when the conflict policy is unknown.
+	ErrInvalidConflictPolicy = errors.New("Invalid conflict policy")
+	// ErrNoOAuthCredentials is used when the account has no OAuth token.
+	ErrNoOAuthCredentials = errors.New("The account has no OAuth credentials")
+	// ErrImportNotResumable is used when trying to resume an import that is
+	// still running, or that has been finished.
+	ErrImportNotResumable = errors.New("The import cannot be resumed")
+	// ErrImportFinished is used when trying to cancel an import that has
+	// already been finished.
+	ErrImportFinished = errors.New("The import has already been finished")
+	// errCanceled is used internally to stop the import when it has been
+	// canceled.
+	errCanceled = errors.New("The import has been canceled")
+)
+
+// Import is a document used to persist the state of an import, with the
+// folders that remain to be imported and the progress. It is updated
+// regularly by the job, which sends realtime events for the progress.
+type Import struct {
+	DocID      string     `json:"_id,omitempty"`
+	DocRev     string     `json:"_rev,omitempty"`
+	Provider   string     `json:"provider"`
+	AccountID  string     `json:"account_id"`
+	DirID      string     `json:"dir_id"`
+	Conflict   string     `json:"conflict"`
+	State      string     `json:"state"`
+	Error      string     `json:"error,omitempty"`
+	Folders    []*Folder  `json:"folders,omitempty"`
+	Progress   Progress   `json:"progress"`
+	Failures   []Failure  `json:"failures,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Folder is a remote folder that has not been fully imported yet. The page
+// token is saved after each page of children, so that an interrupted import
+// can be resumed where it has stopped.
+type Folder struct {
+	RemoteID  string `json:"remote_id"`
+	DirID     string `json:"dir_id"`
+	Path      string `json:"path"`
+	PageToken string `json:"page_token,omitempty"`
+}
+
+// Progress gives some counters about the import.
+type Progress struct {
+	Folders     int    `json:"folders"`
+	Files       int    `json:"files"`
+	Bytes       int64  `json:"bytes"`
+	Skipped     int    `json:"skipped"`
+	Renamed     int    `json:"renamed"`
+	Overwritten int    `json:"overwritten"`
+	Errors      int    `json:"errors"`
+	Current     string `json:"current,omitempty"`
+}
+
+// Failure is a remote file that has not been imported.
+type Failure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (i *Import) ID() string { return i.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (i *Import) Rev() string { return i.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (i *Import) DocType() string { return consts.FilesImports }
+
+// Clone is used to implement the couchdb.Doc interface
+func (i *Import) Clone() couchdb.Doc {
+	cloned := *i
+	cloned.Folders = make([]*Folder, len(i.Folders))
+	for k, folder := range i.Folders {
+		f := *folder
+		cloned.Folders[k] = &f
+	}
+	cloned.Failures = make([]Failure, len(i.Failures))
+	copy(cloned.Failures, i.Failures)
+	if i.FinishedAt != nil {
+		at := *i.FinishedAt
+		cloned.FinishedAt = &at
+	}
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (i *Import) SetID(id string) { i.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (i *Import) SetRev(rev string) { i.DocRev = rev }
+
+// Included is part of the jsonapi.Object interface
+func (i *Import) Included() []jsonapi.Object { return nil }
+
+// Relationships is part of the jsonapi.Object interface
+func (i *Import) Relationships() jsonapi.RelationshipMap { return nil }
+
+// Links is part of the jsonapi.Object interface
+func (i *Import) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/files/imports/" + i.DocID}
+}
+
+// Finished returns true if the import is done or has been canceled.
+func (i *Import) Finished() bool {
+	return i.State == StateDone || i.State == StateCanceled
+}
+
+func (i *Import) addFailure(path string, err error) {
+	i.Progress.Errors++
+	if len(i.Failures) < maxFailures {
+		i.Failures = append(i.Failures, Failure{Path: path, Error: err.Error()})
+	}
+}
+
+// Message is the message of the cloud-import jobs.
+type Message struct {
+	ImportID string `json:"import_id"`
+}
+
+// Options are the parameters given by the user for starting an import.
+type Options struct {
+	Provider  string `json:"provider"`
+	AccountID string `json:"account_id"`
+	DirID     string `json:"dir_id"`
+	Conflict  string `json:"conflict"`
+}
+
+// Start creates the import document, and pushes a job to import the files.
+// The account must have the OAuth tokens for the provider, and the files are
+// imported in the given directory.
+func Start(inst *instance.Instance, opts Options) (*Import, error) {
+	if opts.Provider != GoogleDrive && opts.Provider != OneDrive {
+		return nil, ErrUnknownProvider
+	}
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ConflictSkip
+	case ConflictSkip, ConflictRename, ConflictOverwrite:
+		// OK
+	default:
+		return nil, ErrInvalidConflictPolicy
+	}
+	if opts.DirID == "" {
+		opts.DirID = consts.RootDirID
+	}
+	if _, err := inst.VFS().DirByID(opts.DirID); err != nil {
+		return nil, err
+	}
+	if _, err := getAccount(inst, opts.AccountID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	doc := &Import{
+		Provider:  opts.Provider,
+		AccountID: opts.AccountID,
+		DirID:     opts.DirID,
+		Conflict:  opts.Conflict,
+		State:     StateQueued,
+		Folders: []*Folder{
+			{RemoteID: rootFolderID, DirID: opts.DirID, Path: "/"},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := couchdb.CreateDoc(inst, doc); err != nil {
+		return nil, err
+	}
+	if err := pushJob(inst, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Get returns the import with the given identifier.
+func Get(db prefixer.Prefixer, id string) (*Import, error) {
+	doc := &Import{}
+	if err := couchdb.GetDoc(db, consts.FilesImports, id, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// List returns the imports, the most recent first.
+func List(db prefixer.Prefixer) ([]*Import, error) {
+	var docs []*Import
+	err := couchdb.GetAllDocs(db, consts.FilesImports, nil, &docs)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].CreatedAt.After(docs[j].CreatedAt)
+	})
+	return docs, nil
+}
+
+// Resume pushes a new job for an import that has been stopped by an error,
+// or whose job has been lost.
+func Resume(inst *instance.Instance, doc *Import) error {
+	switch doc.State {
+	case StateErrored:
+		// OK
+	case StateQueued, StateRunning:
+		if time.Since(doc.UpdatedAt) < staleDelay {
+			return ErrImportNotResumable
+		}
+	default:
+		return ErrImportNotResumable
+	}
+	doc.State = StateQueued
+	doc.Error = ""
+	doc.UpdatedAt = time.Now()
+	if err := couchdb.UpdateDoc(inst, doc); err != nil {
+		return err
+	}
+	return pushJob(inst, doc)
+}
+
+// Cancel stops an import. The files that have already been imported are
+// kept.
+func Cancel(db prefixer.Prefixer, doc *Import) error {
+	if doc.Finished() {
+		return ErrImportFinished
+	}
+	now := time.Now()
+	doc.State = StateCanceled
+	doc.Folders = nil
+	doc.Progress.Current = ""
+	doc.UpdatedAt = now
+	doc.FinishedAt = &now
+	return couchdb.UpdateDoc(db, doc)
+}
+
+func pushJob(inst *instance.Instance, doc *Import) error {
+	msg, err := job.NewMessage(&Message{ImportID: doc.ID()})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: WorkerType,
+		Message:    msg,
+	})
+	return err
+}
+
+var _ jsonapi.Object = (*Import)(nil)
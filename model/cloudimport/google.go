@@ -0,0 +1,133 @@
+package cloudimport
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// googleDriveURL is the base URL of the Google Drive API.
+var googleDriveURL = "https://www.googleapis.com/drive/v3"
+
+const googleFolderMime = "application/vnd.google-apps.folder"
+
+// googleExports are the formats used for downloading the Google documents,
+// that have no content in Google Drive, with the extension to add to their
+// names.
+var googleExports = map[string]struct{ mime, ext string }{
+	"application/vnd.google-apps.document": {
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx",
+	},
+	"application/vnd.google-apps.spreadsheet": {
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx",
+	},
+	"application/vnd.google-apps.presentation": {
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx",
+	},
+	"application/vnd.google-apps.drawing": {"image/png", ".png"},
+}
+
+type googleDrive struct {
+	*client
+	baseURL string
+}
+
+type googleFile struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+	Size         string `json:"size"`
+	MD5Checksum  string `json:"md5Checksum"`
+	ModifiedTime string `json:"modifiedTime"`
+}
+
+func (g *googleDrive) List(ctx context.Context, folderID, pageToken string) (*Page, error) {
+	params := url.Values{
+		"q":        {"'" + strings.ReplaceAll(folderID, "'", `\'`) + "' in parents and trashed = false"},
+		"fields":   {"nextPageToken,files(id,name,mimeType,size,md5Checksum,modifiedTime)"},
+		"pageSize": {"1000"},
+	}
+	if pageToken != "" {
+		params.Set("pageToken", pageToken)
+	}
+	res, err := g.get(ctx, g.baseURL+"/files?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var out struct {
+		NextPageToken string        `json:"nextPageToken"`
+		Files         []*googleFile `json:"files"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	page := &Page{
+		Items:         make([]*Item, 0, len(out.Files)),
+		NextPageToken: out.NextPageToken,
+	}
+	for _, f := range out.Files {
+		page.Items = append(page.Items, f.toItem())
+	}
+	return page, nil
+}
+
+func (f *googleFile) toItem() *Item {
+	item := &Item{ID: f.ID, Name: f.Name, Size: -1}
+	item.UpdatedAt, _ = time.Parse(time.RFC3339, f.ModifiedTime)
+	if f.MimeType == googleFolderMime {
+		item.Dir = true
+		return item
+	}
+	if strings.HasPrefix(f.MimeType, "application/vnd.google-apps.") {
+		export, ok := googleExports[f.MimeType]
+		if !ok {
+			item.Unsupported = true
+			return item
+		}
+		item.ExportMime = export.mime
+		if !strings.HasSuffix(item.Name, export.ext) {
+			item.Name += export.ext
+		}
+		return item
+	}
+	if size, err := strconv.ParseInt(f.Size, 10, 64); err == nil {
+		item.Size = size
+	}
+	if sum, err := hex.DecodeString(f.MD5Checksum); err == nil && len(sum) > 0 {
+		item.MD5Sum = sum
+	}
+	return item
+}
+
+func (g *googleDrive) Download(ctx context.Context, item *Item) (io.ReadCloser, error) {
+	u := g.baseURL + "/files/" + url.PathEscape(item.ID)
+	if item.ExportMime != "" {
+		u += "/export?" + url.Values{"mimeType": {item.ExportMime}}.Encode()
+	} else {
+		u += "?alt=media"
+	}
+	res, err := g.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return downloadBody(res, item), nil
+}
+
+// googleRateLimited detects the rate-limit errors of Google Drive, that are
+// sent with a 403 status code.
+func googleRateLimited(res *http.Response, body []byte) bool {
+	if res.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return bytes.Contains(body, []byte("rateLimitExceeded")) ||
+		bytes.Contains(body, []byte("userRateLimitExceeded"))
+}
@@ -0,0 +1,407 @@
+package cloudimport
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+const (
+	// continuationMargin is the remaining time of the job under which the
+	// import is stopped and continued in a new job.
+	continuationMargin = 10 * time.Minute
+	// saveInterval is the minimal delay between two saves of the progress.
+	saveInterval = 5 * time.Second
+)
+
+// errContinue is used internally to stop the current job and push a new one
+// to continue the import.
+var errContinue = errors.New("The import continues in a new job")
+
+type importer struct {
+	ctx      context.Context
+	inst     *instance.Instance
+	fs       vfs.VFS
+	doc      *Import
+	provider Provider
+	dirs     map[string]*vfs.DirDoc
+	lastSave time.Time
+}
+
+// Run imports the files for the given import, from where it has stopped. The
+// remote folders are imported one after the other, and the state is saved
+// after each page of children. When the job is close to its timeout, a new
+// job is pushed to continue the import.
+func Run(ctx context.Context, inst *instance.Instance, importID string) error {
+	doc, err := Get(inst, importID)
+	if err != nil {
+		return err
+	}
+	if doc.Finished() {
+		return nil
+	}
+
+	im := &importer{
+		ctx:  ctx,
+		inst: inst,
+		fs:   inst.VFS(),
+		doc:  doc,
+		dirs: make(map[string]*vfs.DirDoc),
+	}
+	im.provider, err = NewProvider(inst, doc)
+	if err != nil {
+		return im.fail(err)
+	}
+	doc.State = StateRunning
+	doc.Error = ""
+	if err := im.save(); err != nil {
+		if errors.Is(err, errCanceled) {
+			return nil
+		}
+		return err
+	}
+
+	err = im.run()
+	switch {
+	case err == nil:
+		now := time.Now()
+		doc.State = StateDone
+		doc.Progress.Current = ""
+		doc.FinishedAt = &now
+		err = im.save()
+		if errors.Is(err, errCanceled) {
+			return nil
+		}
+		return err
+	case errors.Is(err, errCanceled):
+		return nil
+	case errors.Is(err, errContinue):
+		if err := im.save(); err != nil {
+			return im.fail(err)
+		}
+		if err := pushJob(inst, doc); err != nil {
+			return im.fail(err)
+		}
+		return nil
+	default:
+		return im.fail(err)
+	}
+}
+
+func (im *importer) run() error {
+	for len(im.doc.Folders) > 0 {
+		if err := im.checkDeadline(); err != nil {
+			return err
+		}
+		folder := im.doc.Folders[0]
+		im.doc.Progress.Current = folder.Path
+		page, err := im.provider.List(im.ctx, folder.RemoteID, folder.PageToken)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			if err := im.importItem(folder, item); err != nil {
+				return err
+			}
+			if time.Since(im.lastSave) > saveInterval {
+				if err := im.save(); err != nil {
+					return err
+				}
+			}
+		}
+		if page.NextPageToken != "" {
+			folder.PageToken = page.NextPageToken
+		} else {
+			im.doc.Folders = im.doc.Folders[1:]
+			im.doc.Progress.Folders++
+		}
+		if err := im.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) checkDeadline() error {
+	if err := im.ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := im.ctx.Deadline(); ok && time.Until(deadline) < continuationMargin {
+		return errContinue
+	}
+	return nil
+}
+
+// save persists the import document. If the document has been modified by
+// someone else, it was to cancel the import, or else the save is retried on
+// the last revision.
+func (im *importer) save() error {
+	im.lastSave = time.Now()
+	im.doc.UpdatedAt = im.lastSave
+	err := couchdb.UpdateDoc(im.inst, im.doc)
+	if !couchdb.IsConflictError(err) {
+		return err
+	}
+	latest, err := Get(im.inst, im.doc.ID())
+	if err != nil {
+		return err
+	}
+	if latest.State == StateCanceled {
+		return errCanceled
+	}
+	im.doc.SetRev(latest.Rev())
+	return couchdb.UpdateDoc(im.inst, im.doc)
+}
+
+func (im *importer) fail(err error) error {
+	im.inst.Logger().WithNamespace("cloud-import").
+		Warnf("Import %s has failed: %s", im.doc.ID(), err)
+	im.doc.State = StateErrored
+	im.doc.Error = err.Error()
+	im.doc.Progress.Current = ""
+	if serr := im.save(); serr != nil && !errors.Is(serr, errCanceled) {
+		im.inst.Logger().WithNamespace("cloud-import").
+			Errorf("Cannot save import %s: %s", im.doc.ID(), serr)
+	}
+	return err
+}
+
+func (im *importer) importItem(folder *Folder, item *Item) error {
+	itemPath := path.Join(folder.Path, item.Name)
+	if item.Unsupported {
+		im.doc.Progress.Skipped++
+		return nil
+	}
+
+	var err error
+	if item.Dir {
+		var dir *vfs.DirDoc
+		dir, err = im.mkdir(folder.DirID, item.Name)
+		if err == nil {
+			im.enqueue(&Folder{RemoteID: item.ID, DirID: dir.ID(), Path: itemPath})
+		}
+	} else {
+		err = im.importFile(folder.DirID, item)
+	}
+	if err == nil {
+		return nil
+	}
+	if isFatal(err) || errors.Is(err, vfs.ErrFileTooBig) {
+		return err
+	}
+	im.doc.addFailure(itemPath, err)
+	return nil
+}
+
+// enqueue adds a folder to the list of the folders to import, unless it is
+// already here (when a page is imported a second time after a resume).
+func (im *importer) enqueue(folder *Folder) {
+	for _, f := range im.doc.Folders {
+		if f.RemoteID == folder.RemoteID {
+			return
+		}
+	}
+	im.doc.Folders = append(im.doc.Folders, folder)
+}
+
+func (im *importer) parentDir(id string) (*vfs.DirDoc, error) {
+	if dir, ok := im.dirs[id]; ok {
+		return dir, nil
+	}
+	dir, err := im.fs.DirByID(id)
+	if err != nil {
+		return nil, err
+	}
+	im.dirs[id] = dir
+	return dir, nil
+}
+
+// mkdir returns the directory for a remote folder. If a directory with the
+// same name already exists, it is reused, so that the folders are merged.
+func (im *importer) mkdir(parentID, name string) (*vfs.DirDoc, error) {
+	parent, err := im.parentDir(parentID)
+	if err != nil {
+		return nil, err
+	}
+	name = sanitizeName(name)
+	d, f, err := im.fs.DirOrFileByPath(path.Join(parent.Fullpath, name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if d != nil {
+		return d, nil
+	}
+	if f != nil {
+		name = vfs.ConflictName(im.fs, parent.ID(), name, false)
+	}
+	dir, err := vfs.NewDirDocWithParent(name, parent, nil)
+	if err != nil {
+		return nil, err
+	}
+	dir.CozyMetadata = vfs.NewCozyMetadata(im.inst.PageURL("/", nil))
+	if err := im.fs.CreateDir(dir); err != nil {
+		return nil, err
+	}
+	return dir, nil
+}
+
+func (im *importer) importFile(parentID string, item *Item) error {
+	parent, err := im.parentDir(parentID)
+	if err != nil {
+		return err
+	}
+	name := sanitizeName(item.Name)
+	d, f, err := im.fs.DirOrFileByPath(path.Join(parent.Fullpath, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// The file may have already been imported before a resume
+	if f != nil && sameContent(f, item) {
+		im.doc.Progress.Skipped++
+		return nil
+	}
+
+	var olddoc *vfs.FileDoc
+	renamed := false
+	if d != nil || f != nil {
+		switch im.doc.Conflict {
+		case ConflictSkip:
+			im.doc.Progress.Skipped++
+			return nil
+		case ConflictOverwrite:
+			olddoc = f
+		}
+		if olddoc == nil {
+			name = vfs.ConflictName(im.fs, parent.ID(), name, true)
+			renamed = true
+		}
+	}
+
+	updatedAt := item.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	mime, class := vfs.ExtractMimeAndClassFromFilename(name)
+	newdoc, err := vfs.NewFileDoc(name, parent.ID(), item.Size, item.MD5Sum,
+		mime, class, updatedAt, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	instanceURL := im.inst.PageURL("/", nil)
+	if olddoc != nil {
+		newdoc.Tags = olddoc.Tags
+		newdoc.ReferencedBy = olddoc.ReferencedBy
+		newdoc.CustomMetadata = olddoc.CustomMetadata
+		if olddoc.CozyMetadata != nil {
+			newdoc.CozyMetadata = olddoc.CozyMetadata.Clone()
+			newdoc.CozyMetadata.UpdatedAt = now
+		}
+	}
+	if newdoc.CozyMetadata == nil {
+		newdoc.CozyMetadata = vfs.NewCozyMetadata(instanceURL)
+	}
+	newdoc.CozyMetadata.SourceAccount = im.doc.AccountID
+	newdoc.CozyMetadata.UploadedAt = &now
+	newdoc.CozyMetadata.UploadedOn = instanceURL
+
+	content, err := im.provider.Download(im.ctx, item)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	file, err := im.fs.CreateFile(newdoc, olddoc)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(file, newVerifiedReader(content, item))
+	if err != nil {
+		// Nothing is committed for a truncated or corrupted download
+		vfs.CancelWithError(file, err)
+	}
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	im.doc.Progress.Files++
+	im.doc.Progress.Bytes += n
+	if renamed {
+		im.doc.Progress.Renamed++
+	} else if olddoc != nil {
+		im.doc.Progress.Overwritten++
+	}
+	return nil
+}
+
+// verifiedReader checks the content downloaded from the provider: the size
+// and the checksum are compared to the ones given by the provider (in the
+// listing or with the Content-Length header) when the end is reached.
+type verifiedReader struct {
+	r    io.Reader
+	size int64
+	sum  []byte
+	n    int64
+	hash hash.Hash
+}
+
+func newVerifiedReader(r io.Reader, item *Item) *verifiedReader {
+	return &verifiedReader{r: r, size: item.Size, sum: item.MD5Sum, hash: md5.New()}
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.n += int64(n)
+	_, _ = v.hash.Write(p[:n])
+	if v.size >= 0 && v.n > v.size {
+		return n, vfs.ErrContentLengthMismatch
+	}
+	if errors.Is(err, io.EOF) {
+		if v.size >= 0 && v.n != v.size {
+			return n, vfs.ErrContentLengthMismatch
+		}
+		if len(v.sum) > 0 && !bytes.Equal(v.sum, v.hash.Sum(nil)) {
+			return n, vfs.ErrInvalidHash
+		}
+	}
+	return n, err
+}
+
+// sameContent returns true if the file has the same content as the remote
+// item, as far as we can tell without downloading it.
+func sameContent(file *vfs.FileDoc, item *Item) bool {
+	if item.Size < 0 || file.ByteSize != item.Size {
+		return false
+	}
+	return len(item.MD5Sum) == 0 || bytes.Equal(file.MD5Sum, item.MD5Sum)
+}
+
+// sanitizeName replaces the characters that are not allowed in the names of
+// the files and directories of the VFS.
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(vfs.ForbiddenFilenameChars, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	return name
+}
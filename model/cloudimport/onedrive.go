@@ -0,0 +1,105 @@
+package cloudimport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+// oneDriveURL is the base URL of the Microsoft Graph API for the drive of
+// the user.
+var oneDriveURL = "https://graph.microsoft.com/v1.0/me/drive"
+
+// errInvalidPageToken is used when the page token for OneDrive is not a URL
+// of the Microsoft Graph API.
+var errInvalidPageToken = errors.New("Invalid page token")
+
+type oneDrive struct {
+	*client
+	baseURL string
+}
+
+type oneDriveItem struct {
+	ID                   string    `json:"id"`
+	Name                 string    `json:"name"`
+	Size                 int64     `json:"size"`
+	LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+	Folder               *struct{} `json:"folder"`
+	File                 *struct{} `json:"file"`
+}
+
+func (o *oneDrive) List(ctx context.Context, folderID, pageToken string) (*Page, error) {
+	u := pageToken
+	if u == "" {
+		if folderID == rootFolderID {
+			u = o.baseURL + "/root/children"
+		} else {
+			u = o.baseURL + "/items/" + url.PathEscape(folderID) + "/children"
+		}
+		u += "?" + url.Values{
+			"$top":    {"1000"},
+			"$select": {"id,name,size,lastModifiedDateTime,folder,file"},
+		}.Encode()
+	} else if !sameOrigin(u, o.baseURL) {
+		// The next link is given by the API, but we check it to be sure that
+		// the access token is not sent elsewhere.
+		return nil, errInvalidPageToken
+	}
+	res, err := o.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var out struct {
+		NextLink string          `json:"@odata.nextLink"`
+		Value    []*oneDriveItem `json:"value"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	page := &Page{
+		Items:         make([]*Item, 0, len(out.Value)),
+		NextPageToken: out.NextLink,
+	}
+	for _, i := range out.Value {
+		item := &Item{
+			ID:        i.ID,
+			Name:      i.Name,
+			Size:      i.Size,
+			UpdatedAt: i.LastModifiedDateTime,
+		}
+		switch {
+		case i.Folder != nil:
+			item.Dir = true
+		case i.File == nil:
+			// OneNote notebooks are packages without content
+			item.Unsupported = true
+		}
+		page.Items = append(page.Items, item)
+	}
+	return page, nil
+}
+
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
+
+func (o *oneDrive) Download(ctx context.Context, item *Item) (io.ReadCloser, error) {
+	res, err := o.get(ctx, o.baseURL+"/items/"+url.PathEscape(item.ID)+"/content")
+	if err != nil {
+		return nil, err
+	}
+	return downloadBody(res, item), nil
+}
@@ -0,0 +1,280 @@
+package cloudimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/account"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+// Provider is the interface for listing and downloading the files of a
+// remote drive.
+type Provider interface {
+	// List returns a page of the children of a folder. The page token is
+	// empty for the first page.
+	List(ctx context.Context, folderID, pageToken string) (*Page, error)
+	// Download returns the content of a file.
+	Download(ctx context.Context, item *Item) (io.ReadCloser, error)
+}
+
+// Item is a file or a folder on the remote drive.
+type Item struct {
+	ID        string
+	Name      string
+	Dir       bool
+	Size      int64 // -1 when the size is not known in advance
+	MD5Sum    []byte
+	UpdatedAt time.Time
+	// Unsupported is true for the items that cannot be downloaded, like the
+	// Google forms.
+	Unsupported bool
+	// ExportMime is the format used for downloading the Google documents.
+	ExportMime string
+}
+
+// Page is a list of items, with the token for the next page if the listing
+// is not finished.
+type Page struct {
+	Items         []*Item
+	NextPageToken string
+}
+
+// NewProvider returns the provider for the given import.
+func NewProvider(inst *instance.Instance, doc *Import) (Provider, error) {
+	acc, err := getAccount(inst, doc.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{tokens: &accountTokens{inst: inst, acc: acc}}
+	switch doc.Provider {
+	case GoogleDrive:
+		c.rateLimited = googleRateLimited
+		return &googleDrive{client: c, baseURL: googleDriveURL}, nil
+	case OneDrive:
+		return &oneDrive{client: c, baseURL: oneDriveURL}, nil
+	}
+	return nil, ErrUnknownProvider
+}
+
+// downloadBody returns the body of the response for a download. When the
+// size of the item was not given in the listing, the Content-Length is used
+// to check that the content has not been truncated.
+func downloadBody(res *http.Response, item *Item) io.ReadCloser {
+	if item.Size < 0 && res.ContentLength >= 0 {
+		item.Size = res.ContentLength
+	}
+	return res.Body
+}
+
+func getAccount(inst *instance.Instance, id string) (*account.Account, error) {
+	acc := &account.Account{}
+	if err := couchdb.GetDoc(inst, consts.Accounts, id, acc); err != nil {
+		return nil, err
+	}
+	if acc.Oauth == nil || acc.Oauth.AccessToken == "" {
+		return nil, ErrNoOAuthCredentials
+	}
+	return acc, nil
+}
+
+// tokenSource gives the OAuth access token for the requests to the provider.
+type tokenSource interface {
+	Token() (string, error)
+	Refresh() error
+}
+
+// accountTokens is a tokenSource that uses the tokens of an io.cozy.accounts
+// document, and persists them when they are refreshed.
+type accountTokens struct {
+	inst *instance.Instance
+	acc  *account.Account
+}
+
+func (t *accountTokens) Token() (string, error) {
+	expiresAt := t.acc.Oauth.ExpiresAt
+	if !expiresAt.IsZero() && time.Until(expiresAt) < time.Minute {
+		if err := t.Refresh(); err != nil {
+			return "", err
+		}
+	}
+	return t.acc.Oauth.AccessToken, nil
+}
+
+func (t *accountTokens) Refresh() error {
+	typ, err := account.TypeInfo(t.acc.AccountType, t.inst.ContextName)
+	if err != nil {
+		return err
+	}
+	if err := typ.RefreshAccount(*t.acc); err != nil {
+		return err
+	}
+	err = couchdb.UpdateDoc(t.inst, t.acc)
+	if !couchdb.IsConflictError(err) {
+		return err
+	}
+	// The account has been modified by someone else: save the new tokens on
+	// the last revision.
+	latest := &account.Account{}
+	if err := couchdb.GetDoc(t.inst, consts.Accounts, t.acc.ID(), latest); err != nil {
+		return err
+	}
+	latest.Oauth = t.acc.Oauth
+	t.acc = latest
+	return couchdb.UpdateDoc(t.inst, t.acc)
+}
+
+const (
+	// maxAttempts is the maximal number of tries for a request to the
+	// provider, when it responds with a rate-limit or server error.
+	maxAttempts = 8
+	// maxBackoff is the maximal delay between two tries.
+	maxBackoff = 64 * time.Second
+)
+
+// backoffBase is the delay before the first retry. It is doubled at each
+// retry.
+var backoffBase = 1 * time.Second
+
+// httpClient is used for the requests to the providers. There is no timeout,
+// as downloading a large file can take a long time, but the requests are
+// made with the context of the job.
+var httpClient = &http.Client{}
+
+// client makes the HTTP requests to a provider, with the OAuth token, and
+// retries with an exponential backoff when the provider asks to slow down.
+type client struct {
+	tokens tokenSource
+	// rateLimited can be used to detect the rate-limit errors that are not
+	// sent with a 429 status code.
+	rateLimited func(res *http.Response, body []byte) bool
+}
+
+// HTTPError is used when the provider has responded with an error.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("the provider has responded with %d: %s", e.StatusCode, e.Body)
+}
+
+// get makes a GET request to the provider. The caller must close the body of
+// the response.
+func (c *client) get(ctx context.Context, u string) (*http.Response, error) {
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		token, err := c.tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt+1 >= maxAttempts {
+				return nil, err
+			}
+			if err := sleep(ctx, backoff(attempt, nil)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if res.StatusCode < 400 {
+			return res, nil
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		res.Body.Close()
+		httpErr := &HTTPError{StatusCode: res.StatusCode, Body: string(body)}
+		if res.StatusCode == http.StatusUnauthorized && !refreshed {
+			refreshed = true
+			if err := c.tokens.Refresh(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !c.shouldRetry(res, body) || attempt+1 >= maxAttempts {
+			return nil, httpErr
+		}
+		if err := sleep(ctx, backoff(attempt, res)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *client) shouldRetry(res *http.Response, body []byte) bool {
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return c.rateLimited != nil && c.rateLimited(res, body)
+}
+
+// backoff returns the delay before the next try, from the Retry-After header
+// if the provider has sent it, or else with an exponential backoff and some
+// jitter.
+func backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if after := res.Header.Get("Retry-After"); after != "" {
+			if secs, err := strconv.Atoi(after); err == nil && secs >= 0 {
+				return time.Duration(secs) * time.Second
+			}
+			if at, err := http.ParseTime(after); err == nil {
+				if d := time.Until(at); d > 0 {
+					return d
+				}
+				return 0
+			}
+		}
+	}
+	d := backoffBase << uint(attempt)
+	if d > maxBackoff || d < 0 {
+		d = maxBackoff
+	}
+	if backoffBase > 0 {
+		d += time.Duration(rand.Int63n(int64(backoffBase)))
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isFatal returns true for the errors that must stop the import, and not
+// only skip the current file.
+func isFatal(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusUnauthorized ||
+			httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, account.ErrUnrefreshable)
+}
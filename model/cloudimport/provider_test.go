@@ -0,0 +1,218 @@
+package cloudimport
+
+import (
+	"context"
+	"crypto/md5"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTokens struct {
+	token     string
+	refreshed int
+}
+
+func (f *fakeTokens) Token() (string, error) { return f.token, nil }
+
+func (f *fakeTokens) Refresh() error {
+	f.refreshed++
+	f.token = "refreshed"
+	return nil
+}
+
+func TestProvider(t *testing.T) {
+	backoffBase = 0
+
+	t.Run("RetryOnRateLimit", func(t *testing.T) {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer ts.Close()
+
+		c := &client{tokens: &fakeTokens{token: "token"}}
+		res, err := c.get(context.Background(), ts.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, "ok", string(body))
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("GiveUpAfterMaxAttempts", func(t *testing.T) {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+
+		c := &client{tokens: &fakeTokens{token: "token"}}
+		_, err := c.get(context.Background(), ts.URL)
+		require.Error(t, err)
+		assert.Equal(t, maxAttempts, calls)
+		assert.False(t, isFatal(err))
+	})
+
+	t.Run("GoogleRateLimitWith403", func(t *testing.T) {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`))
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer ts.Close()
+
+		c := &client{tokens: &fakeTokens{token: "token"}, rateLimited: googleRateLimited}
+		res, err := c.get(context.Background(), ts.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("RefreshTokenOn401", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer refreshed" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer ts.Close()
+
+		tokens := &fakeTokens{token: "expired"}
+		c := &client{tokens: tokens}
+		res, err := c.get(context.Background(), ts.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, 1, tokens.refreshed)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		res := &http.Response{Header: http.Header{}}
+		res.Header.Set("Retry-After", "12")
+		assert.Equal(t, 12*time.Second, backoff(0, res))
+
+		backoffBase = time.Second
+		defer func() { backoffBase = 0 }()
+		d := backoff(2, nil)
+		assert.True(t, d >= 4*time.Second && d < 5*time.Second)
+		d = backoff(10, nil)
+		assert.True(t, d >= maxBackoff && d < maxBackoff+time.Second)
+	})
+
+	t.Run("GoogleDriveList", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/files", r.URL.Path)
+			assert.Equal(t, "'root' in parents and trashed = false", r.URL.Query().Get("q"))
+			_, _ = w.Write([]byte(`{
+  "nextPageToken": "next",
+  "files": [
+    {"id": "1", "name": "Photos", "mimeType": "application/vnd.google-apps.folder"},
+    {"id": "2", "name": "cat.jpg", "mimeType": "image/jpeg", "size": "1234",
+     "md5Checksum": "d41d8cd98f00b204e9800998ecf8427e", "modifiedTime": "2023-05-12T10:00:00Z"},
+    {"id": "3", "name": "Report", "mimeType": "application/vnd.google-apps.document"},
+    {"id": "4", "name": "Survey", "mimeType": "application/vnd.google-apps.form"}
+  ]
+}`))
+		}))
+		defer ts.Close()
+
+		g := &googleDrive{client: &client{tokens: &fakeTokens{token: "token"}}, baseURL: ts.URL}
+		page, err := g.List(context.Background(), rootFolderID, "")
+		require.NoError(t, err)
+		assert.Equal(t, "next", page.NextPageToken)
+		require.Len(t, page.Items, 4)
+		assert.True(t, page.Items[0].Dir)
+		assert.EqualValues(t, 1234, page.Items[1].Size)
+		assert.Len(t, page.Items[1].MD5Sum, 16)
+		assert.Equal(t, 2023, page.Items[1].UpdatedAt.Year())
+		assert.Equal(t, "Report.docx", page.Items[2].Name)
+		assert.EqualValues(t, -1, page.Items[2].Size)
+		assert.NotEmpty(t, page.Items[2].ExportMime)
+		assert.True(t, page.Items[3].Unsupported)
+	})
+
+	t.Run("OneDriveList", func(t *testing.T) {
+		var ts *httptest.Server
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/root/children", r.URL.Path)
+			_, _ = w.Write([]byte(`{
+  "@odata.nextLink": "` + ts.URL + `/root/children?$skiptoken=abc",
+  "value": [
+    {"id": "A", "name": "Documents", "folder": {"childCount": 2}},
+    {"id": "B", "name": "notes.txt", "size": 42, "file": {"mimeType": "text/plain"},
+     "lastModifiedDateTime": "2023-05-12T10:00:00Z"},
+    {"id": "C", "name": "Notebook", "package": {"type": "oneNote"}}
+  ]
+}`))
+		}))
+		defer ts.Close()
+
+		o := &oneDrive{client: &client{tokens: &fakeTokens{token: "token"}}, baseURL: ts.URL}
+		page, err := o.List(context.Background(), rootFolderID, "")
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+"/root/children?$skiptoken=abc", page.NextPageToken)
+		require.Len(t, page.Items, 3)
+		assert.True(t, page.Items[0].Dir)
+		assert.EqualValues(t, 42, page.Items[1].Size)
+		assert.True(t, page.Items[2].Unsupported)
+
+		_, err = o.List(context.Background(), rootFolderID, "https://evil.example.com/next")
+		assert.ErrorIs(t, err, errInvalidPageToken)
+	})
+
+	t.Run("SanitizeName", func(t *testing.T) {
+		assert.Equal(t, "a_b", sanitizeName("a/b"))
+		assert.Equal(t, "_..", sanitizeName(".."))
+		assert.Equal(t, "_", sanitizeName("  "))
+		assert.Equal(t, "report.pdf", sanitizeName("report.pdf"))
+	})
+
+	t.Run("DownloadWithContentLength", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "11")
+			_, _ = w.Write([]byte("hello"))
+		}))
+		defer ts.Close()
+
+		o := &oneDrive{client: &client{tokens: &fakeTokens{token: "t"}}, baseURL: ts.URL}
+		item := &Item{ID: "file-1", Size: -1}
+		body, err := o.Download(context.Background(), item)
+		require.NoError(t, err)
+		defer body.Close()
+		assert.EqualValues(t, 11, item.Size)
+		_, err = io.ReadAll(newVerifiedReader(body, item))
+		assert.Error(t, err)
+	})
+
+	t.Run("VerifiedReader", func(t *testing.T) {
+		sum := md5.Sum([]byte("hello"))
+		_, err := io.ReadAll(newVerifiedReader(strings.NewReader("hello"), &Item{Size: 5, MD5Sum: sum[:]}))
+		assert.NoError(t, err)
+		_, err = io.ReadAll(newVerifiedReader(strings.NewReader("hel"), &Item{Size: 5}))
+		assert.ErrorIs(t, err, vfs.ErrContentLengthMismatch)
+		_, err = io.ReadAll(newVerifiedReader(strings.NewReader("hello world"), &Item{Size: 5}))
+		assert.ErrorIs(t, err, vfs.ErrContentLengthMismatch)
+		_, err = io.ReadAll(newVerifiedReader(strings.NewReader("hellO"), &Item{Size: -1, MD5Sum: sum[:]}))
+		assert.ErrorIs(t, err, vfs.ErrInvalidHash)
+	})
+}
@@ -0,0 +1,209 @@
+// Package comment is used for the comments posted on a file. The members of
+// a sharing that preview it can comment the shared files with their
+// sharecode, and the owner of the instance can moderate these comments.
+package comment
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+)
+
+const (
+	// StatusPublished is the status of a comment visible by everyone that
+	// can read the file.
+	StatusPublished = "published"
+	// StatusHidden is the status of a comment hidden by the owner. It is
+	// only visible by the owner.
+	StatusHidden = "hidden"
+)
+
+// MaxBodyLength is the maximal number of characters of a comment.
+const MaxBodyLength = 10000
+
+var (
+	// ErrInvalidBody is used when the body of a comment is empty or too long.
+	ErrInvalidBody = errors.New("The body of the comment is empty or too long")
+	// ErrInvalidStatus is used when moderating a comment with an unknown
+	// status.
+	ErrInvalidStatus = errors.New("Invalid status for a comment")
+	// ErrNotFound is used when the comment does not exist, or is not attached
+	// to the given file.
+	ErrNotFound = errors.New("Comment not found")
+)
+
+// Author identifies who has posted a comment.
+type Author struct {
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Owner is true when the comment has been posted by the owner of the
+	// instance.
+	Owner bool `json:"owner,omitempty"`
+}
+
+// Comment is a message posted on a file.
+type Comment struct {
+	DocID     string    `json:"_id,omitempty"`
+	DocRev    string    `json:"_rev,omitempty"`
+	FileID    string    `json:"file_id"`
+	SharingID string    `json:"sharing_id,omitempty"`
+	Author    Author    `json:"author"`
+	Body      string    `json:"body"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (c *Comment) ID() string { return c.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (c *Comment) Rev() string { return c.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (c *Comment) DocType() string { return consts.Comments }
+
+// Clone implements couchdb.Doc
+func (c *Comment) Clone() couchdb.Doc {
+	cloned := *c
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (c *Comment) SetID(id string) { c.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (c *Comment) SetRev(rev string) { c.DocRev = rev }
+
+// HideAuthorContact removes the email and the Cozy instance of the author,
+// for a viewer that is not a member of the sharing of the comment.
+func (c *Comment) HideAuthorContact() {
+	c.Author.Email = ""
+	c.Author.Instance = ""
+}
+
+// event is used to send a comment in the realtime hub, for the clients that
+// watch the comments of a file: its identifier is the one of the file.
+type event struct {
+	*Comment
+}
+
+func (e event) ID() string      { return e.FileID }
+func (e event) DocType() string { return consts.CommentsEvents }
+
+// publish sends the comment to the realtime hub. The body of a hidden
+// comment is not sent, as the viewers must not see it, and neither is the
+// contact of the author, as the viewers can be members of other sharings.
+func (c *Comment) publish(inst *instance.Instance, verb string) {
+	cloned := *c
+	if cloned.Status == StatusHidden {
+		cloned.Body = ""
+	}
+	cloned.HideAuthorContact()
+	go realtime.GetHub().Publish(inst, verb, event{&cloned}, nil)
+}
+
+// Create validates and saves a new comment, and sends it to the clients that
+// watch the comments of the file.
+func Create(inst *instance.Instance, c *Comment) error {
+	c.Body = strings.TrimSpace(c.Body)
+	if c.Body == "" || utf8.RuneCountInString(c.Body) > MaxBodyLength {
+		return ErrInvalidBody
+	}
+	c.DocID = ""
+	c.DocRev = ""
+	c.Status = StatusPublished
+	c.CreatedAt = time.Now().UTC()
+	c.UpdatedAt = c.CreatedAt
+	if err := couchdb.CreateDoc(inst, c); err != nil {
+		return err
+	}
+	c.publish(inst, realtime.EventCreate)
+	return nil
+}
+
+// Get returns the comment with the given identifier, if it is attached to
+// the given file.
+func Get(inst *instance.Instance, fileID, commentID string) (*Comment, error) {
+	var c Comment
+	err := couchdb.GetDoc(inst, consts.Comments, commentID, &c)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.FileID != fileID {
+		return nil, ErrNotFound
+	}
+	return &c, nil
+}
+
+// List returns the comments of a file, from the oldest to the newest. The
+// hidden comments are included only if withHidden is true.
+func List(inst *instance.Instance, fileID string, withHidden bool) ([]*Comment, error) {
+	var comments []*Comment
+	req := &couchdb.FindRequest{
+		UseIndex: "by-file-id",
+		Selector: mango.And(
+			mango.Equal("file_id", fileID),
+			mango.Exists("created_at"),
+		),
+		Sort: mango.SortBy{
+			{Field: "file_id", Direction: mango.Asc},
+			{Field: "created_at", Direction: mango.Asc},
+		},
+		Limit: 1000,
+	}
+	err := couchdb.FindDocs(inst, consts.Comments, req, &comments)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*Comment{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if withHidden {
+		return comments, nil
+	}
+	visible := comments[:0]
+	for _, c := range comments {
+		if c.Status != StatusHidden {
+			visible = append(visible, c)
+		}
+	}
+	return visible, nil
+}
+
+// Moderate changes the status of a comment, to hide it or publish it again.
+func Moderate(inst *instance.Instance, c *Comment, status string) error {
+	if status != StatusPublished && status != StatusHidden {
+		return ErrInvalidStatus
+	}
+	if c.Status == status {
+		return nil
+	}
+	c.Status = status
+	c.UpdatedAt = time.Now().UTC()
+	if err := couchdb.UpdateDoc(inst, c); err != nil {
+		return err
+	}
+	c.publish(inst, realtime.EventUpdate)
+	return nil
+}
+
+// Delete removes a comment.
+func Delete(inst *instance.Instance, c *Comment) error {
+	if err := couchdb.DeleteDoc(inst, c); err != nil {
+		return err
+	}
+	c.publish(inst, realtime.EventDelete)
+	return nil
+}
@@ -0,0 +1,61 @@
+package comment
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComment(t *testing.T) {
+	config.UseTestFile(t)
+	inst := &instance.Instance{Domain: "alice.cozy.example"}
+
+	t.Run("CreateWithInvalidBody", func(t *testing.T) {
+		err := Create(inst, &Comment{FileID: "file-1", Body: "  \n "})
+		assert.Equal(t, ErrInvalidBody, err)
+
+		err = Create(inst, &Comment{FileID: "file-1", Body: strings.Repeat("a", MaxBodyLength+1)})
+		assert.Equal(t, ErrInvalidBody, err)
+	})
+
+	t.Run("ModerateWithInvalidStatus", func(t *testing.T) {
+		c := &Comment{FileID: "file-1", Status: StatusPublished}
+		assert.Equal(t, ErrInvalidStatus, Moderate(inst, c, "deleted"))
+		assert.NoError(t, Moderate(inst, c, StatusPublished))
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		sub := realtime.GetHub().Subscriber(inst)
+		defer sub.Close()
+		sub.Watch(consts.CommentsEvents, "file-1")
+
+		author := Author{Name: "Bob", Email: "bob@example.net", Instance: "https://bob.cozy.example"}
+		c := &Comment{DocID: "comment-1", FileID: "file-1", Author: author, Body: "Nice picture", Status: StatusHidden}
+		c.publish(inst, realtime.EventUpdate)
+
+		select {
+		case e := <-sub.Channel:
+			assert.Equal(t, realtime.EventUpdate, e.Verb)
+			assert.Equal(t, "file-1", e.Doc.ID())
+			assert.Equal(t, consts.CommentsEvents, e.Doc.DocType())
+			ev, ok := e.Doc.(event)
+			require.True(t, ok)
+			assert.Equal(t, "comment-1", ev.Comment.ID())
+			assert.Empty(t, ev.Body)
+			assert.Equal(t, "Bob", ev.Author.Name)
+			assert.Empty(t, ev.Author.Email)
+			assert.Empty(t, ev.Author.Instance)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no realtime event")
+		}
+		assert.Equal(t, "Nice picture", c.Body)
+		assert.Equal(t, author, c.Author)
+	})
+}
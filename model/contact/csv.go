@@ -0,0 +1,211 @@
+package contact
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+)
+
+// csvNameFields are the fields of a CSV mapping that go in the name of the
+// contact.
+var csvNameFields = map[string]bool{
+	"givenName":      true,
+	"familyName":     true,
+	"additionalName": true,
+	"namePrefix":     true,
+	"nameSuffix":     true,
+}
+
+// csvAddressFields are the fields of a CSV mapping that go in the address of
+// the contact.
+var csvAddressFields = map[string]bool{
+	"street":   true,
+	"pobox":    true,
+	"city":     true,
+	"region":   true,
+	"postcode": true,
+	"country":  true,
+	"address":  true,
+}
+
+// csvSimpleFields are the fields of a CSV mapping that are copied as is.
+var csvSimpleFields = map[string]bool{
+	"fullname": true,
+	"company":  true,
+	"jobTitle": true,
+	"birthday": true,
+	"note":     true,
+}
+
+// CheckCSVMapping returns an error if a field of the mapping is unknown. The
+// mapping associates the headers of the columns to the fields of the
+// contacts, like "E-mail 1" => "email:work". The email and phone fields can
+// have a type after a colon.
+func CheckCSVMapping(mapping map[string]string) error {
+	for _, field := range mapping {
+		if !validCSVField(field) {
+			return ErrInvalidMapping
+		}
+	}
+	return nil
+}
+
+func validCSVField(field string) bool {
+	field, _ = splitCSVField(field)
+	return field == "email" || field == "phone" ||
+		csvNameFields[field] || csvAddressFields[field] || csvSimpleFields[field]
+}
+
+func splitCSVField(field string) (string, string) {
+	parts := strings.SplitN(field, ":", 2)
+	if len(parts) == 2 {
+		return parts[0], strings.ToLower(parts[1])
+	}
+	return parts[0], ""
+}
+
+// defaultCSVMapping returns a mapping for the columns whose header is the
+// name of a field, like "email" or "givenName".
+func defaultCSVMapping(headers []string) map[string]string {
+	fields := []string{"email", "phone"}
+	for _, set := range []map[string]bool{csvNameFields, csvAddressFields, csvSimpleFields} {
+		for field := range set {
+			fields = append(fields, field)
+		}
+	}
+	mapping := make(map[string]string)
+	for _, header := range headers {
+		for _, field := range fields {
+			if strings.EqualFold(strings.TrimSpace(header), field) {
+				mapping[header] = field
+			}
+		}
+	}
+	return mapping
+}
+
+// ParseCSV reads a CSV file where the first line is the headers of the
+// columns, and returns the contacts. The mapping says which column goes in
+// which field of a contact, and the columns that are not in the mapping are
+// ignored. Without mapping, the headers must be the names of the fields.
+func ParseCSV(r io.Reader, mapping map[string]string) ([]*Contact, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	headers, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 {
+		// Remove the BOM written by some spreadsheets
+		headers[0] = strings.TrimPrefix(headers[0], "\ufeff")
+	}
+
+	if len(mapping) == 0 {
+		mapping = defaultCSVMapping(headers)
+	} else {
+		// The headers are compared without the case and the spaces
+		normalized := make(map[string]string, len(mapping))
+		for header, field := range mapping {
+			normalized[strings.ToLower(strings.TrimSpace(header))] = field
+		}
+		mapping = make(map[string]string, len(headers))
+		for _, header := range headers {
+			if field, ok := normalized[strings.ToLower(strings.TrimSpace(header))]; ok {
+				mapping[header] = field
+			}
+		}
+	}
+	if err := CheckCSVMapping(mapping); err != nil {
+		return nil, err
+	}
+
+	var contacts []*Contact
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c := contactFromCSV(headers, record, mapping); c != nil {
+			contacts = append(contacts, c)
+		}
+	}
+	return contacts, nil
+}
+
+func contactFromCSV(headers, record []string, mapping map[string]string) *Contact {
+	c := New()
+	name := make(map[string]interface{})
+	addr := make(map[string]interface{})
+	var emails, phones []map[string]interface{}
+
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		if i >= len(headers) || value == "" {
+			continue
+		}
+		field, kind := splitCSVField(mapping[headers[i]])
+		var item map[string]interface{}
+		switch {
+		case field == "email":
+			item = map[string]interface{}{"address": value}
+			emails = append(emails, item)
+		case field == "phone":
+			item = map[string]interface{}{"number": value}
+			phones = append(phones, item)
+		case csvNameFields[field]:
+			name[field] = value
+		case field == "address":
+			addr["formattedAddress"] = value
+		case csvAddressFields[field]:
+			addr[field] = value
+		case field == "birthday":
+			if bday := normalizeBirthday(value); bday != "" {
+				c.M["birthday"] = bday
+			}
+		case csvSimpleFields[field]:
+			c.M[field] = value
+		}
+		if item != nil && kind != "" {
+			item["type"] = kind
+		}
+	}
+
+	if len(name) > 0 {
+		c.M["name"] = name
+	}
+	if len(addr) > 0 {
+		if _, ok := addr["formattedAddress"]; !ok {
+			var parts []string
+			for _, key := range []string{"pobox", "street", "postcode", "city", "region", "country"} {
+				if v, ok := addr[key].(string); ok {
+					parts = append(parts, v)
+				}
+			}
+			addr["formattedAddress"] = strings.Join(parts, ", ")
+		}
+		c.M["address"] = markPrimary([]map[string]interface{}{addr}, 0)
+	}
+	if len(emails) > 0 {
+		c.M["email"] = markPrimary(emails, 0)
+	}
+	if len(phones) > 0 {
+		c.M["phone"] = markPrimary(phones, 0)
+	}
+	if _, ok := c.M["fullname"]; !ok {
+		if fullname := c.PrimaryName(); fullname != "" {
+			c.M["fullname"] = fullname
+		}
+	}
+	if len(c.M) == 0 {
+		return nil
+	}
+	return c
+}
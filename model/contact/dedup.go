@@ -0,0 +1,467 @@
+package contact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// ReasonEmail is used when two contacts have a common email address.
+	ReasonEmail = "email"
+	// ReasonPhone is used when two contacts have a common phone number.
+	ReasonPhone = "phone"
+	// ReasonName is used when two contacts have the same name.
+	ReasonName = "name"
+	// ReasonSimilarName is used when two contacts have close names.
+	ReasonSimilarName = "similar_name"
+
+	// minNameSimilarity is the minimal similarity between two names, from 0
+	// to 1, to consider them close.
+	minNameSimilarity = 0.85
+	// maxGroupSize is the maximal number of contacts in a group (same email,
+	// same name, names starting the same way, etc.) that are compared, to
+	// avoid a quadratic explosion.
+	maxGroupSize = 500
+	// dedupDebounce is the delay before looking for the duplicates after a
+	// contact has been created, as the konnectors import the contacts in
+	// batches.
+	dedupDebounce = "10m"
+	// phoneSuffixLength is the number of digits compared for the phone
+	// numbers, to ignore the international prefixes.
+	phoneSuffixLength = 9
+)
+
+// scores are the points given to a pair of contacts for each reason.
+var scores = map[string]float64{
+	ReasonEmail:       0.6,
+	ReasonPhone:       0.5,
+	ReasonName:        0.4,
+	ReasonSimilarName: 0.3,
+}
+
+// Duplicate is a document for a pair of contacts that may be duplicates. The
+// pairs dismissed by the user are kept, so that they are not proposed again.
+type Duplicate struct {
+	DocID     string    `json:"_id,omitempty"`
+	DocRev    string    `json:"_rev,omitempty"`
+	Contacts  []string  `json:"contacts"`
+	Score     float64   `json:"score"`
+	Reasons   []string  `json:"reasons"`
+	Dismissed bool      `json:"dismissed,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (d *Duplicate) ID() string { return d.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (d *Duplicate) Rev() string { return d.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (d *Duplicate) DocType() string { return consts.ContactsDuplicates }
+
+// Clone implements couchdb.Doc
+func (d *Duplicate) Clone() couchdb.Doc {
+	cloned := *d
+	cloned.Contacts = append([]string{}, d.Contacts...)
+	cloned.Reasons = append([]string{}, d.Reasons...)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (d *Duplicate) SetID(id string) { d.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (d *Duplicate) SetRev(rev string) { d.DocRev = rev }
+
+// DuplicateID returns the identifier of the document for a pair of contacts.
+// It doesn't depend of the order of the contacts.
+func DuplicateID(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	sum := sha256.Sum256([]byte(a + "|" + b))
+	return hex.EncodeToString(sum[:16])
+}
+
+// NormalizeEmail returns the email address in a form that can be compared.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone returns the last digits of a phone number, so that the
+// numbers with and without the international prefix can be compared. It
+// returns an empty string for the numbers that are too short.
+func NormalizePhone(number string) string {
+	var digits []rune
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) < phoneSuffixLength {
+		return ""
+	}
+	return string(digits[len(digits)-phoneSuffixLength:])
+}
+
+// NormalizeName returns the name in lower case, without the accents and the
+// punctuation, with the words sorted, so that "Doe, John" and "john doe" are
+// the same.
+func NormalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Skip the accents
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// NameSimilarity returns a similarity between 0 and 1 for two normalized
+// names, based on the Levenshtein distance.
+func NameSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// Emails returns the email addresses of the contact.
+func (c *Contact) Emails() []string {
+	return c.listValues("email", "address")
+}
+
+// PhoneNumbers returns the phone numbers of the contact.
+func (c *Contact) PhoneNumbers() []string {
+	return c.listValues("phone", "number")
+}
+
+func (c *Contact) listValues(field, key string) []string {
+	items, _ := c.Get(field).([]interface{})
+	var values []string
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := obj[key].(string); ok && value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// IsTrashed returns true if the contact has been moved to the trash by the
+// contacts application.
+func (c *Contact) IsTrashed() bool {
+	trashed, _ := c.Get("trashed").(bool)
+	return trashed
+}
+
+// FindDuplicates returns the pairs of contacts that may be duplicates, with
+// the most probable ones first. The contacts are grouped by email address,
+// phone number and name, and the names starting with the same letters are
+// compared to find the close ones.
+func FindDuplicates(contacts []*Contact) []*Duplicate {
+	pairs := make(map[string]*Duplicate)
+	addPair := func(a, b *Contact, reason string) {
+		if a.ID() == b.ID() {
+			return
+		}
+		id := DuplicateID(a.ID(), b.ID())
+		dup, ok := pairs[id]
+		if !ok {
+			ids := []string{a.ID(), b.ID()}
+			sort.Strings(ids)
+			dup = &Duplicate{DocID: id, Contacts: ids}
+			pairs[id] = dup
+		}
+		for _, r := range dup.Reasons {
+			if r == reason {
+				return
+			}
+		}
+		dup.Reasons = append(dup.Reasons, reason)
+		dup.Score += scores[reason]
+		if dup.Score > 1 {
+			dup.Score = 1
+		}
+	}
+	addGroups := func(groups map[string][]*Contact, reason string) {
+		for _, group := range groups {
+			if len(group) > maxGroupSize {
+				continue
+			}
+			for i := 0; i < len(group); i++ {
+				for j := i + 1; j < len(group); j++ {
+					addPair(group[i], group[j], reason)
+				}
+			}
+		}
+	}
+
+	byEmail := make(map[string][]*Contact)
+	byPhone := make(map[string][]*Contact)
+	byName := make(map[string][]*Contact)
+	for _, c := range contacts {
+		seen := make(map[string]bool)
+		for _, email := range c.Emails() {
+			if key := NormalizeEmail(email); key != "" && !seen["e:"+key] {
+				seen["e:"+key] = true
+				byEmail[key] = append(byEmail[key], c)
+			}
+		}
+		for _, number := range c.PhoneNumbers() {
+			if key := NormalizePhone(number); key != "" && !seen["p:"+key] {
+				seen["p:"+key] = true
+				byPhone[key] = append(byPhone[key], c)
+			}
+		}
+		if key := NormalizeName(c.PrimaryName()); key != "" {
+			byName[key] = append(byName[key], c)
+		}
+	}
+	addGroups(byEmail, ReasonEmail)
+	addGroups(byPhone, ReasonPhone)
+	addGroups(byName, ReasonName)
+
+	// Compare the names that are not equal, but start with the same letters
+	blocks := make(map[string][]string)
+	for name := range byName {
+		prefix := []rune(name)
+		if len(prefix) > 2 {
+			prefix = prefix[:2]
+		}
+		blocks[string(prefix)] = append(blocks[string(prefix)], name)
+	}
+	for _, names := range blocks {
+		if len(names) > maxGroupSize {
+			continue
+		}
+		sort.Strings(names)
+		for i := 0; i < len(names); i++ {
+			for j := i + 1; j < len(names); j++ {
+				if NameSimilarity(names[i], names[j]) < minNameSimilarity {
+					continue
+				}
+				for _, a := range byName[names[i]] {
+					for _, b := range byName[names[j]] {
+						addPair(a, b, ReasonSimilarName)
+					}
+				}
+			}
+		}
+	}
+
+	dups := make([]*Duplicate, 0, len(pairs))
+	for _, dup := range pairs {
+		sort.Strings(dup.Reasons)
+		dups = append(dups, dup)
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		if dups[i].Score == dups[j].Score {
+			return dups[i].DocID < dups[j].DocID
+		}
+		return dups[i].Score > dups[j].Score
+	})
+	return dups
+}
+
+// ScanDuplicates computes the pairs of contacts that may be duplicates, and
+// saves them. The pairs that are no longer detected are removed, except the
+// ones that have been dismissed. It returns the number of pairs found.
+func ScanDuplicates(db prefixer.Prefixer) (int, error) {
+	var contacts []*Contact
+	err := couchdb.ForeachDocs(db, consts.Contacts, func(_ string, raw json.RawMessage) error {
+		c := New()
+		if err := json.Unmarshal(raw, c); err != nil {
+			return err
+		}
+		if !c.IsTrashed() {
+			contacts = append(contacts, c)
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return 0, err
+	}
+	found := FindDuplicates(contacts)
+
+	existing, err := ListDuplicates(db, true)
+	if err != nil {
+		return 0, err
+	}
+	byID := make(map[string]*Duplicate, len(existing))
+	for _, dup := range existing {
+		byID[dup.DocID] = dup
+	}
+
+	now := time.Now().UTC()
+	docs := make([]interface{}, 0, len(found))
+	olds := make([]interface{}, 0, len(found))
+	for _, dup := range found {
+		old, ok := byID[dup.DocID]
+		delete(byID, dup.DocID)
+		if !ok {
+			dup.CreatedAt = now
+			dup.UpdatedAt = now
+			docs = append(docs, dup)
+			olds = append(olds, nil)
+			continue
+		}
+		if old.Score == dup.Score && strings.Join(old.Reasons, ",") == strings.Join(dup.Reasons, ",") {
+			continue
+		}
+		updated := old.Clone().(*Duplicate)
+		updated.Score = dup.Score
+		updated.Reasons = dup.Reasons
+		updated.UpdatedAt = now
+		docs = append(docs, updated)
+		olds = append(olds, old)
+	}
+	if err := couchdb.BulkUpdateDocs(db, consts.ContactsDuplicates, docs, olds); err != nil {
+		return 0, err
+	}
+
+	var stale []couchdb.Doc
+	for _, dup := range byID {
+		if !dup.Dismissed {
+			stale = append(stale, dup)
+		}
+	}
+	if err := couchdb.BulkDeleteDocs(db, consts.ContactsDuplicates, stale); err != nil {
+		return 0, err
+	}
+	return len(found), nil
+}
+
+// ListDuplicates returns the pairs of contacts that may be duplicates, with
+// the most probable ones first. The dismissed pairs are included only if
+// withDismissed is true.
+func ListDuplicates(db prefixer.Prefixer, withDismissed bool) ([]*Duplicate, error) {
+	dups := []*Duplicate{}
+	err := couchdb.ForeachDocs(db, consts.ContactsDuplicates, func(_ string, raw json.RawMessage) error {
+		var dup Duplicate
+		if err := json.Unmarshal(raw, &dup); err != nil {
+			return err
+		}
+		if withDismissed || !dup.Dismissed {
+			dups = append(dups, &dup)
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	sort.SliceStable(dups, func(i, j int) bool {
+		return dups[i].Score > dups[j].Score
+	})
+	return dups, nil
+}
+
+// GetDuplicate returns the pair of contacts with the given identifier.
+func GetDuplicate(db prefixer.Prefixer, id string) (*Duplicate, error) {
+	var dup Duplicate
+	if err := couchdb.GetDoc(db, consts.ContactsDuplicates, id, &dup); err != nil {
+		if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+			return nil, ErrDuplicateNotFound
+		}
+		return nil, err
+	}
+	return &dup, nil
+}
+
+// Dismiss marks a pair of contacts as not being duplicates.
+func (d *Duplicate) Dismiss(db prefixer.Prefixer) error {
+	d.Dismissed = true
+	d.UpdatedAt = time.Now().UTC()
+	return couchdb.UpdateDoc(db, d)
+}
+
+// PushDedupJob adds a job to look for the duplicate contacts.
+func PushDedupJob(inst *instance.Instance) error {
+	msg, err := job.NewMessage(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "contacts-dedup",
+		Message:    msg,
+	})
+	return err
+}
+
+// EnsureDedupTrigger adds a trigger to look for the duplicates when contacts
+// are created, like when a konnector imports them.
+func EnsureDedupTrigger(inst *instance.Instance) {
+	sched := job.System()
+	infos := job.TriggerInfos{
+		Type:       "@event",
+		WorkerType: "contacts-dedup",
+		Arguments:  consts.Contacts + ":CREATED",
+		Debounce:   dedupDebounce,
+	}
+	if sched.HasTrigger(inst, infos) {
+		return
+	}
+	t, err := job.NewTrigger(inst, infos, nil)
+	if err == nil {
+		err = sched.AddTrigger(t)
+	}
+	if err != nil {
+		inst.Logger().WithNamespace("contacts").
+			Errorf("Cannot create contacts-dedup trigger: %s", err)
+	}
+}
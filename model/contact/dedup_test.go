@@ -0,0 +1,165 @@
+package contact
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newContact(id string, fields map[string]interface{}) *Contact {
+	fields["_id"] = id
+	return &Contact{JSONDoc: couchdb.JSONDoc{M: fields}}
+}
+
+func TestDedup(t *testing.T) {
+	t.Run("Normalize", func(t *testing.T) {
+		assert.Equal(t, "alice@example.com", NormalizeEmail(" Alice@Example.com "))
+		assert.Equal(t, "612345678", NormalizePhone("+33 6 12 34 56 78"))
+		assert.Equal(t, "612345678", NormalizePhone("06.12.34.56.78"))
+		assert.Equal(t, "", NormalizePhone("112"))
+		assert.Equal(t, "doe john", NormalizeName("John DOE"))
+		assert.Equal(t, "doe john", NormalizeName("Doe, John"))
+		assert.Equal(t, "helene martin", NormalizeName("Hélène Martin"))
+	})
+
+	t.Run("NameSimilarity", func(t *testing.T) {
+		assert.Equal(t, 1.0, NameSimilarity("doe john", "doe john"))
+		assert.Greater(t, NameSimilarity("doe jonathan", "doe jonathn"), 0.85)
+		assert.Less(t, NameSimilarity("doe john", "smith jane"), 0.5)
+		assert.Equal(t, 0.0, NameSimilarity("", ""))
+	})
+
+	t.Run("FindDuplicates", func(t *testing.T) {
+		a := newContact("a", map[string]interface{}{
+			"fullname": "John Doe",
+			"email":    []interface{}{map[string]interface{}{"address": "john@example.com"}},
+		})
+		b := newContact("b", map[string]interface{}{
+			"name":  map[string]interface{}{"givenName": "John", "familyName": "Doe"},
+			"email": []interface{}{map[string]interface{}{"address": "JOHN@example.com"}},
+			"phone": []interface{}{map[string]interface{}{"number": "+33 6 12 34 56 78"}},
+		})
+		c := newContact("c", map[string]interface{}{
+			"fullname": "Jane Smith",
+			"phone":    []interface{}{map[string]interface{}{"number": "06 12 34 56 78"}},
+		})
+		d := newContact("d", map[string]interface{}{
+			"fullname": "Someone Else",
+		})
+
+		dups := FindDuplicates([]*Contact{a, b, c, d})
+		require.Len(t, dups, 2)
+		assert.Equal(t, []string{"a", "b"}, dups[0].Contacts)
+		assert.Equal(t, []string{ReasonEmail, ReasonName}, dups[0].Reasons)
+		assert.Equal(t, 1.0, dups[0].Score)
+		assert.Equal(t, DuplicateID("b", "a"), dups[0].DocID)
+		assert.Equal(t, []string{"b", "c"}, dups[1].Contacts)
+		assert.Equal(t, []string{ReasonPhone}, dups[1].Reasons)
+	})
+
+	t.Run("MergeFields", func(t *testing.T) {
+		kept := newContact("kept", map[string]interface{}{
+			"_rev":     "1-abc",
+			"fullname": "John Doe",
+			"email": []interface{}{
+				map[string]interface{}{"address": "john@example.com", "primary": true},
+			},
+			"name": map[string]interface{}{"givenName": "John"},
+			"relationships": map[string]interface{}{
+				"groups": map[string]interface{}{
+					"data": []interface{}{
+						map[string]interface{}{"_id": "g1", "_type": "io.cozy.contacts.groups"},
+					},
+				},
+			},
+		})
+		removed := newContact("removed", map[string]interface{}{
+			"_rev":     "3-def",
+			"fullname": "Johnny",
+			"favorite": true,
+			"company":  "Cozy",
+			"email": []interface{}{
+				map[string]interface{}{"address": "JOHN@example.com"},
+				map[string]interface{}{"address": "jd@work.example", "primary": true},
+			},
+			"name": map[string]interface{}{"givenName": "Johnny", "familyName": "Doe"},
+			"relationships": map[string]interface{}{
+				"groups": map[string]interface{}{
+					"data": []interface{}{
+						map[string]interface{}{"_id": "g1", "_type": "io.cozy.contacts.groups"},
+						map[string]interface{}{"_id": "g2", "_type": "io.cozy.contacts.groups"},
+					},
+				},
+			},
+		})
+
+		merged := MergeFields(kept, removed)
+		assert.Equal(t, "kept", merged["_id"])
+		assert.Equal(t, "1-abc", merged["_rev"])
+		assert.Equal(t, "John Doe", merged["fullname"])
+		assert.Equal(t, "Cozy", merged["company"])
+		assert.Equal(t, true, merged["favorite"])
+		assert.Equal(t, map[string]interface{}{"givenName": "John", "familyName": "Doe"}, merged["name"])
+		emails := merged["email"].([]interface{})
+		require.Len(t, emails, 2)
+		assert.Equal(t, "jd@work.example", emails[1].(map[string]interface{})["address"])
+		assert.Equal(t, false, emails[1].(map[string]interface{})["primary"])
+		groups := merged["relationships"].(map[string]interface{})["groups"].(map[string]interface{})["data"].([]interface{})
+		assert.Len(t, groups, 2)
+
+		// The contacts are not modified
+		assert.Len(t, kept.M["email"], 1)
+		assert.Nil(t, kept.M["company"])
+		assert.Equal(t, true, removed.M["email"].([]interface{})[1].(map[string]interface{})["primary"])
+	})
+
+	t.Run("KeepLinkedEmails", func(t *testing.T) {
+		kept := newContact("kept", map[string]interface{}{
+			"email": []interface{}{
+				map[string]interface{}{"address": "john@example.com", "primary": true},
+			},
+		})
+		removed := newContact("removed", map[string]interface{}{
+			"email": []interface{}{
+				map[string]interface{}{"address": "JOHN@example.com", "primary": true},
+				map[string]interface{}{"address": "John@Example.com"},
+			},
+		})
+		merged := MergeFields(kept, removed)
+		require.Len(t, merged["email"], 1)
+
+		linked := map[string]bool{"JOHN@example.com": true}
+		keepLinkedEmails(merged, removed, linked)
+		emails := merged["email"].([]interface{})
+		require.Len(t, emails, 2)
+		assert.Equal(t, "john@example.com", emails[0].(map[string]interface{})["address"])
+		assert.Equal(t, "JOHN@example.com", emails[1].(map[string]interface{})["address"])
+		assert.Equal(t, false, emails[1].(map[string]interface{})["primary"])
+		assert.Equal(t, true, removed.M["email"].([]interface{})[0].(map[string]interface{})["primary"])
+
+		keepLinkedEmails(merged, removed, linked)
+		assert.Len(t, merged["email"], 2)
+	})
+
+	t.Run("ReplaceCandidateContact", func(t *testing.T) {
+		candidates := []interface{}{
+			map[string]interface{}{"key": "bob@example.com", "contact_id": "removed"},
+			map[string]interface{}{"key": "alice@example.com", "contact_id": "other"},
+			map[string]interface{}{"key": "bob.cozy.example", "contact_id": "removed"},
+		}
+		moved := replaceCandidateContact(candidates, "removed", "kept", nil)
+		assert.Equal(t, []string{"bob@example.com", "bob.cozy.example"}, moved)
+		assert.Equal(t, "kept", candidates[0].(map[string]interface{})["contact_id"])
+		assert.Equal(t, "other", candidates[1].(map[string]interface{})["contact_id"])
+		assert.Equal(t, "kept", candidates[2].(map[string]interface{})["contact_id"])
+
+		// Undo only the candidates that were moved
+		candidates = append(candidates, map[string]interface{}{"key": "new", "contact_id": "kept"})
+		moved = replaceCandidateContact(candidates, "kept", "removed", moved)
+		assert.Equal(t, []string{"bob@example.com", "bob.cozy.example"}, moved)
+		assert.Equal(t, "removed", candidates[0].(map[string]interface{})["contact_id"])
+		assert.Equal(t, "kept", candidates[3].(map[string]interface{})["contact_id"])
+	})
+}
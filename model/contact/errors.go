@@ -8,4 +8,27 @@ var (
 	ErrNoMailAddress = errors.New("The contact has no email address")
 	// ErrNotFound is returned when no contact has been found for a query
 	ErrNotFound = errors.New("No contact has been found")
+	// ErrDuplicateNotFound is returned when a pair of duplicates cannot be
+	// found
+	ErrDuplicateNotFound = errors.New("No duplicate contacts have been found")
+	// ErrMergeNotFound is returned when a merge cannot be found, or cannot be
+	// undone anymore
+	ErrMergeNotFound = errors.New("The merge cannot be undone")
+	// ErrCannotMerge is returned when two contacts cannot be merged, like two
+	// contacts that are both shared
+	ErrCannotMerge = errors.New("These contacts cannot be merged")
+	// ErrInvalidMapping is returned when the mapping of the columns of a CSV
+	// file has an unknown field
+	ErrInvalidMapping = errors.New("The mapping of the CSV columns is invalid")
+	// ErrInvalidStrategy is returned when the strategy for the conflicts of
+	// an import is unknown
+	ErrInvalidStrategy = errors.New("The conflict strategy is unknown")
+	// ErrInvalidFormat is returned when the format of an import is neither
+	// vCard nor CSV
+	ErrInvalidFormat = errors.New("The format must be vCard or CSV")
+	// ErrImportNotFound is returned when an import cannot be found
+	ErrImportNotFound = errors.New("The import has not been found")
+	// ErrImportExpired is returned when the content of an import is no longer
+	// available
+	ErrImportExpired = errors.New("The content of the import has expired")
 )
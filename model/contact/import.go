@@ -0,0 +1,466 @@
+package contact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/metadata"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// FormatVCard is the format of an import of vCards
+	FormatVCard = "vcard"
+	// FormatCSV is the format of an import of a CSV file
+	FormatCSV = "csv"
+)
+
+const (
+	// StrategySkip keeps the existing contact, and ignores the imported one
+	StrategySkip = "skip"
+	// StrategyMerge completes the existing contact with the imported one
+	StrategyMerge = "merge"
+	// StrategyDuplicate creates the imported contact, even if it already
+	// exists
+	StrategyDuplicate = "duplicate"
+)
+
+const (
+	// ImportQueued is the state of an import waiting for its job
+	ImportQueued = "queued"
+	// ImportRunning is the state of an import while the contacts are saved
+	ImportRunning = "running"
+	// ImportDone is the state of an import that has finished
+	ImportDone = "done"
+	// ImportErrored is the state of an import that has failed
+	ImportErrored = "errored"
+)
+
+// MaxImportSize is the maximal size of a file of contacts that can be
+// imported.
+const MaxImportSize = 20 * 1024 * 1024
+
+// importBatchSize is the number of contacts saved at once, and the progress
+// of the import is updated after each batch.
+const importBatchSize = 200
+
+// Import is a document with the state of an import of contacts. It is
+// updated after each batch of contacts, and the apps can follow its progress
+// with the realtime events on the io.cozy.contacts.imports doctype.
+type Import struct {
+	DocID     string            `json:"_id,omitempty"`
+	DocRev    string            `json:"_rev,omitempty"`
+	Format    string            `json:"format"`
+	Strategy  string            `json:"strategy"`
+	Mapping   map[string]string `json:"mapping,omitempty"`
+	State     string            `json:"state"`
+	Total     int               `json:"total"`
+	Processed int               `json:"processed"`
+	Created   int               `json:"created"`
+	Merged    int               `json:"merged"`
+	Skipped   int               `json:"skipped"`
+	Failed    int               `json:"failed"`
+	Error     string            `json:"error,omitempty"`
+	// FileID is the identifier of the file with the content of the import,
+	// kept in the trash until the import has finished
+	FileID string `json:"file_id,omitempty"`
+	// CreatedByApp is the slug of the app that has asked for the import, for
+	// the cozyMetadata of the imported contacts
+	CreatedByApp string     `json:"created_by_app,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (i *Import) ID() string { return i.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (i *Import) Rev() string { return i.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (i *Import) DocType() string { return consts.ContactsImports }
+
+// Clone is used to implement the couchdb.Doc interface
+func (i *Import) Clone() couchdb.Doc {
+	cloned := *i
+	if i.Mapping != nil {
+		cloned.Mapping = make(map[string]string, len(i.Mapping))
+		for k, v := range i.Mapping {
+			cloned.Mapping[k] = v
+		}
+	}
+	if i.FinishedAt != nil {
+		finished := *i.FinishedAt
+		cloned.FinishedAt = &finished
+	}
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (i *Import) SetID(id string) { i.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (i *Import) SetRev(rev string) { i.DocRev = rev }
+
+// ImportMessage is the message of the contacts-import jobs.
+type ImportMessage struct {
+	ImportID string `json:"import_id"`
+}
+
+// CheckImportOptions returns an error if the format, the strategy, or the
+// mapping of an import are invalid.
+func CheckImportOptions(format, strategy string, mapping map[string]string) error {
+	switch format {
+	case FormatVCard, FormatCSV:
+	default:
+		return ErrInvalidFormat
+	}
+	switch strategy {
+	case StrategySkip, StrategyMerge, StrategyDuplicate:
+	default:
+		return ErrInvalidStrategy
+	}
+	return CheckCSVMapping(mapping)
+}
+
+// StartImport creates the import document, keeps the content in a file of
+// the VFS, and pushes the job that will parse and save the contacts.
+func StartImport(inst *instance.Instance, imp *Import, content []byte) error {
+	if err := CheckImportOptions(imp.Format, imp.Strategy, imp.Mapping); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	imp.State = ImportQueued
+	imp.CreatedAt = now
+	imp.UpdatedAt = now
+	if err := couchdb.CreateDoc(inst, imp); err != nil {
+		return err
+	}
+
+	file, err := stageContent(inst, imp.DocID, content)
+	if err != nil {
+		_ = imp.fail(inst, err)
+		return err
+	}
+	imp.FileID = file.DocID
+	if err := imp.save(inst); err != nil {
+		_ = inst.VFS().DestroyFile(file)
+		return err
+	}
+
+	msg, err := job.NewMessage(&ImportMessage{ImportID: imp.DocID})
+	if err == nil {
+		_, err = job.System().PushJob(inst, &job.JobRequest{
+			WorkerType: "contacts-import",
+			Message:    msg,
+		})
+	}
+	if err != nil {
+		_ = inst.VFS().DestroyFile(file)
+		_ = imp.fail(inst, err)
+		return err
+	}
+	return nil
+}
+
+// stageContent writes the content of an import to a file in the trash, as
+// the job can run on another server. The file is counted in the disk quota
+// of the instance while it exists, and it is destroyed by the job.
+func stageContent(inst *instance.Instance, id string, content []byte) (*vfs.FileDoc, error) {
+	fs := inst.VFS()
+	doc, err := vfs.NewFileDoc("contacts-import-"+id, consts.TrashDirID, int64(len(content)),
+		nil, "text/plain", "text", time.Now(), false, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	doc.RestorePath = "/"
+	f, err := fs.CreateFile(doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// readContent returns the content of an import, from its file.
+func readContent(fs vfs.VFS, file *vfs.FileDoc) ([]byte, error) {
+	f, err := fs.OpenFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, MaxImportSize))
+}
+
+// GetImport returns the import with the given identifier.
+func GetImport(db prefixer.Prefixer, id string) (*Import, error) {
+	var imp Import
+	if err := couchdb.GetDoc(db, consts.ContactsImports, id, &imp); err != nil {
+		if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+			return nil, ErrImportNotFound
+		}
+		return nil, err
+	}
+	return &imp, nil
+}
+
+func (i *Import) save(db prefixer.Prefixer) error {
+	i.UpdatedAt = time.Now().UTC()
+	return couchdb.UpdateDoc(db, i)
+}
+
+func (i *Import) fail(db prefixer.Prefixer, err error) error {
+	now := time.Now().UTC()
+	i.State = ImportErrored
+	i.Error = err.Error()
+	i.FinishedAt = &now
+	return i.save(db)
+}
+
+// RunImport is called by the contacts-import worker. It parses the content of
+// the import, and saves the contacts by batches, with the conflict strategy
+// of the import for the contacts that already exist. The checkQuota function
+// is called before each batch with the number of contacts to create.
+func RunImport(inst *instance.Instance, id string, checkQuota func(count int) error) error {
+	imp, err := GetImport(inst, id)
+	if err != nil {
+		return err
+	}
+	if imp.State == ImportDone || imp.State == ImportErrored {
+		return nil
+	}
+
+	fs := inst.VFS()
+	file, err := fs.FileByID(imp.FileID)
+	if err != nil {
+		return imp.fail(inst, ErrImportExpired)
+	}
+	// The import is not retried, so the content is no longer needed after
+	// this job
+	defer func() {
+		if err := fs.DestroyFile(file); err != nil {
+			inst.Logger().WithNamespace("contacts").
+				Warnf("Cannot destroy the content of the import %s: %s", id, err)
+		}
+	}()
+	content, err := readContent(fs, file)
+	if err != nil {
+		return imp.fail(inst, err)
+	}
+
+	var contacts []*Contact
+	if imp.Format == FormatCSV {
+		contacts, err = ParseCSV(bytes.NewReader(content), imp.Mapping)
+	} else {
+		contacts, err = ParseVCards(bytes.NewReader(content))
+	}
+	if err != nil {
+		return imp.fail(inst, err)
+	}
+
+	imp.State = ImportRunning
+	imp.Total = len(contacts)
+	imp.Processed, imp.Created, imp.Merged, imp.Skipped, imp.Failed = 0, 0, 0, 0, 0
+	if err := imp.save(inst); err != nil {
+		return err
+	}
+
+	idx := newContactsIndex()
+	if imp.Strategy != StrategyDuplicate {
+		if err := idx.load(inst); err != nil {
+			return imp.fail(inst, err)
+		}
+	}
+
+	for len(contacts) > 0 {
+		n := importBatchSize
+		if len(contacts) < n {
+			n = len(contacts)
+		}
+		batch := contacts[:n]
+		contacts = contacts[n:]
+		if err := imp.importBatch(inst, idx, batch, checkQuota); err != nil {
+			return imp.fail(inst, err)
+		}
+		imp.Processed += n
+		if err := imp.save(inst); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	imp.State = ImportDone
+	imp.FinishedAt = &now
+	return imp.save(inst)
+}
+
+// importEntry is what a document of a batch is for the counters: an imported
+// contact to create, and/or the number of imported contacts merged into it.
+type importEntry struct {
+	created bool
+	merged  int
+}
+
+func (i *Import) importBatch(db prefixer.Prefixer, idx *contactsIndex, batch []*Contact, checkQuota func(count int) error) error {
+	docs := make([]interface{}, 0, len(batch))
+	olds := make([]interface{}, 0, len(batch))
+	entries := make(map[*Contact]*importEntry, len(batch))
+	created := 0
+	for _, c := range batch {
+		var existing *Contact
+		if i.Strategy != StrategyDuplicate {
+			existing = idx.find(c)
+		}
+		switch {
+		case existing == nil:
+			c.M["cozyMetadata"] = i.newMetadata()
+			idx.add(c)
+			entries[c] = &importEntry{created: true}
+			docs = append(docs, c)
+			olds = append(olds, nil)
+			created++
+		case i.Strategy == StrategySkip:
+			i.Skipped++
+		default:
+			entry, ok := entries[existing]
+			if !ok {
+				entry = &importEntry{}
+				entries[existing] = entry
+				olds = append(olds, existing.clone())
+				docs = append(docs, existing)
+			}
+			existing.M = MergeFields(existing, c)
+			touchMetadata(existing)
+			idx.add(existing)
+			entry.merged++
+		}
+	}
+
+	if created > 0 && checkQuota != nil {
+		if err := checkQuota(created); err != nil {
+			return err
+		}
+	}
+	if err := couchdb.BulkUpdateDocs(db, consts.Contacts, docs, olds); err != nil {
+		return err
+	}
+
+	// BulkUpdateDocs doesn't return the errors for the documents, but it sets
+	// the new revision of the documents that have been saved.
+	for k, doc := range docs {
+		c := doc.(*Contact)
+		saved := c.Rev() != ""
+		if old, ok := olds[k].(*Contact); ok && old.Rev() == c.Rev() {
+			saved = false
+		}
+		entry := entries[c]
+		switch {
+		case saved:
+			if entry.created {
+				i.Created++
+			}
+			i.Merged += entry.merged
+		default:
+			if entry.created {
+				i.Failed++
+			}
+			i.Failed += entry.merged
+		}
+	}
+	return nil
+}
+
+func (i *Import) newMetadata() map[string]interface{} {
+	md := metadata.New()
+	md.CreatedByApp = i.CreatedByApp
+	buf, _ := json.Marshal(md)
+	var m map[string]interface{}
+	_ = json.Unmarshal(buf, &m)
+	return m
+}
+
+func touchMetadata(c *Contact) {
+	md, ok := c.M["cozyMetadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	md["updatedAt"] = time.Now().UTC()
+}
+
+// contactsIndex is used to find the existing contacts that are the same as
+// an imported one, by their email addresses and phone numbers.
+type contactsIndex struct {
+	byEmail map[string]*Contact
+	byPhone map[string]*Contact
+}
+
+func newContactsIndex() *contactsIndex {
+	return &contactsIndex{
+		byEmail: make(map[string]*Contact),
+		byPhone: make(map[string]*Contact),
+	}
+}
+
+func (idx *contactsIndex) load(db prefixer.Prefixer) error {
+	err := couchdb.ForeachDocs(db, consts.Contacts, func(_ string, raw json.RawMessage) error {
+		c := New()
+		if err := json.Unmarshal(raw, c); err != nil {
+			return err
+		}
+		if !c.IsTrashed() {
+			idx.add(c)
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+	return nil
+}
+
+func (idx *contactsIndex) add(c *Contact) {
+	for _, email := range c.Emails() {
+		if key := NormalizeEmail(email); key != "" {
+			if _, ok := idx.byEmail[key]; !ok {
+				idx.byEmail[key] = c
+			}
+		}
+	}
+	for _, number := range c.PhoneNumbers() {
+		if key := NormalizePhone(number); key != "" {
+			if _, ok := idx.byPhone[key]; !ok {
+				idx.byPhone[key] = c
+			}
+		}
+	}
+}
+
+func (idx *contactsIndex) find(c *Contact) *Contact {
+	for _, email := range c.Emails() {
+		if found, ok := idx.byEmail[NormalizeEmail(email)]; ok {
+			return found
+		}
+	}
+	for _, number := range c.PhoneNumbers() {
+		if key := NormalizePhone(number); key != "" {
+			if found, ok := idx.byPhone[key]; ok {
+				return found
+			}
+		}
+	}
+	return nil
+}
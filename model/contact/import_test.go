@@ -0,0 +1,141 @@
+package contact
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	t.Run("ParseVCard4", func(t *testing.T) {
+		vcf := "BEGIN:VCARD\r\n" +
+			"VERSION:4.0\r\n" +
+			"FN:Alice Martin\r\n" +
+			"N:Martin;Alice;;Dr.;\r\n" +
+			"EMAIL;TYPE=home:alice@example.net\r\n" +
+			"EMAIL;TYPE=work;PREF=1:alice@work.example\r\n" +
+			"TEL;VALUE=uri;TYPE=cell:tel:+33-6-12-34-56-78\r\n" +
+			"ADR;TYPE=home:;;12 rue de la Paix;Paris;;75002;France\r\n" +
+			"ORG:Cozy Cloud;R&D\r\n" +
+			"TITLE:Developer\r\n" +
+			"BDAY:19850412\r\n" +
+			"NOTE:First line\\nSecond line\\, with a comma\r\n" +
+			"  and a folded end\r\n" +
+			"PHOTO;ENCODING=b;TYPE=JPEG:MIICajCCAdOgAwIBAgICBEUwDQYJKoZIhvcNAQEE\r\n" +
+			"END:VCARD\r\n"
+		contacts, err := ParseVCards(strings.NewReader(vcf))
+		require.NoError(t, err)
+		require.Len(t, contacts, 1)
+		c := contacts[0]
+		assert.Equal(t, "Alice Martin", c.M["fullname"])
+		assert.Equal(t, map[string]interface{}{
+			"familyName": "Martin",
+			"givenName":  "Alice",
+			"namePrefix": "Dr.",
+		}, c.M["name"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"address": "alice@example.net", "type": "home", "primary": false},
+			map[string]interface{}{"address": "alice@work.example", "type": "work", "primary": true},
+		}, c.M["email"])
+		addr, err := c.ToMailAddress()
+		require.NoError(t, err)
+		assert.Equal(t, "alice@work.example", addr.Email)
+		assert.Equal(t, []string{"+33-6-12-34-56-78"}, c.PhoneNumbers())
+		postal := c.M["address"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "Paris", postal["city"])
+		assert.Equal(t, "12 rue de la Paix, 75002, Paris, France", postal["formattedAddress"])
+		assert.Equal(t, "Cozy Cloud", c.M["company"])
+		assert.Equal(t, "Developer", c.M["jobTitle"])
+		assert.Equal(t, "1985-04-12", c.M["birthday"])
+		assert.Equal(t, "First line\nSecond line, with a comma and a folded end", c.M["note"])
+		assert.NotContains(t, c.M, "photo")
+	})
+
+	t.Run("ParseVCard21", func(t *testing.T) {
+		vcf := "BEGIN:VCARD\n" +
+			"VERSION:2.1\n" +
+			"N:Dupont;Ren=C3=A9\n" +
+			"N;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:Dupont;Ren=C3=A9\n" +
+			"TEL;WORK;VOICE:0612345678\n" +
+			"NOTE;ENCODING=QUOTED-PRINTABLE:A long note that is=\n" +
+			" split\n" +
+			"END:VCARD\n" +
+			"BEGIN:VCARD\n" +
+			"VERSION:3.0\n" +
+			"UID:nothing-useful\n" +
+			"END:VCARD\n"
+		contacts, err := ParseVCards(strings.NewReader(vcf))
+		require.NoError(t, err)
+		require.Len(t, contacts, 1)
+		c := contacts[0]
+		assert.Equal(t, "René Dupont", c.M["fullname"])
+		phone := c.M["phone"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "work", phone["type"])
+		assert.Equal(t, true, phone["primary"])
+		assert.Equal(t, "A long note that is split", c.M["note"])
+	})
+
+	t.Run("ParseCSV", func(t *testing.T) {
+		csv := "\ufeffFirst Name,Last Name,E-mail 1,E-mail 2,Mobile,City,Ignored\n" +
+			"Bob,Smith,bob@example.net,bob@work.example,06 12 34 56 78,Lyon,x\n" +
+			",,,,,,y\n"
+		mapping := map[string]string{
+			"first name": "givenName",
+			"Last Name":  "familyName",
+			"E-mail 1":   "email:home",
+			"E-mail 2":   "email:work",
+			"Mobile":     "phone:cell",
+			"City":       "city",
+		}
+		contacts, err := ParseCSV(strings.NewReader(csv), mapping)
+		require.NoError(t, err)
+		require.Len(t, contacts, 1)
+		c := contacts[0]
+		assert.Equal(t, "Bob Smith", c.M["fullname"])
+		assert.Equal(t, []string{"bob@example.net", "bob@work.example"}, c.Emails())
+		mailAddr, err := c.ToMailAddress()
+		require.NoError(t, err)
+		assert.Equal(t, "bob@example.net", mailAddr.Email)
+		phone := c.M["phone"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "cell", phone["type"])
+		addr := c.M["address"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "Lyon", addr["formattedAddress"])
+
+		_, err = ParseCSV(strings.NewReader(csv), map[string]string{"City": "town"})
+		assert.Equal(t, ErrInvalidMapping, err)
+
+		contacts, err = ParseCSV(strings.NewReader("fullname,EMAIL\nCarol,carol@example.net\n"), nil)
+		require.NoError(t, err)
+		require.Len(t, contacts, 1)
+		assert.Equal(t, "Carol", contacts[0].M["fullname"])
+		assert.Equal(t, []string{"carol@example.net"}, contacts[0].Emails())
+	})
+
+	t.Run("CheckOptions", func(t *testing.T) {
+		assert.NoError(t, CheckImportOptions(FormatVCard, StrategyMerge, nil))
+		assert.Equal(t, ErrInvalidFormat, CheckImportOptions("xls", StrategyMerge, nil))
+		assert.Equal(t, ErrInvalidStrategy, CheckImportOptions(FormatCSV, "replace", nil))
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		existing := newContact("a", map[string]interface{}{
+			"email": []interface{}{map[string]interface{}{"address": "Alice@Example.net"}},
+			"phone": []interface{}{map[string]interface{}{"number": "+33 6 12 34 56 78"}},
+		})
+		idx := newContactsIndex()
+		idx.add(existing)
+
+		byEmail := newContact("", map[string]interface{}{
+			"email": []interface{}{map[string]interface{}{"address": "alice@example.net"}},
+		})
+		assert.Equal(t, existing, idx.find(byEmail))
+		byPhone := newContact("", map[string]interface{}{
+			"phone": []interface{}{map[string]interface{}{"number": "06.12.34.56.78"}},
+		})
+		assert.Equal(t, existing, idx.find(byPhone))
+		other := newContact("", map[string]interface{}{"fullname": "Alice"})
+		assert.Nil(t, idx.find(other))
+	})
+}
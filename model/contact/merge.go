@@ -0,0 +1,728 @@
+package contact
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/hashicorp/go-multierror"
+)
+
+// UndoWindow is the duration during which a merge of two contacts can be
+// undone.
+const UndoWindow = 7 * 24 * time.Hour
+
+// suggestionsDocID is the identifier of the document with the sharing
+// suggestions (it is computed by the sharing package, which depends on this
+// one).
+const suggestionsDocID = "suggestions"
+
+// listKeys are the fields of the items of the lists used to know if two items
+// are the same, like two email addresses.
+var listKeys = map[string]func(map[string]interface{}) string{
+	"email": func(item map[string]interface{}) string {
+		address, _ := item["address"].(string)
+		return NormalizeEmail(address)
+	},
+	"phone": func(item map[string]interface{}) string {
+		number, _ := item["number"].(string)
+		if n := NormalizePhone(number); n != "" {
+			return n
+		}
+		return number
+	},
+	"cozy": func(item map[string]interface{}) string {
+		url, _ := item["url"].(string)
+		return url
+	},
+}
+
+// skippedFields are the fields of the removed contact that are never copied
+// to the merged contact.
+var skippedFields = map[string]bool{
+	"_id":          true,
+	"_rev":         true,
+	"cozyMetadata": true,
+	"trashed":      true,
+}
+
+// Merge is a document with the state of two contacts before their merge, so
+// that the merge can be undone for some time.
+type Merge struct {
+	DocID         string                 `json:"_id,omitempty"`
+	DocRev        string                 `json:"_rev,omitempty"`
+	Kept          string                 `json:"kept"`
+	Removed       string                 `json:"removed"`
+	KeptBefore    map[string]interface{} `json:"kept_before"`
+	RemovedBefore map[string]interface{} `json:"removed_before"`
+	Duplicate     *Duplicate             `json:"duplicate,omitempty"`
+	// MovedFiles are the files that referenced the removed contact, and now
+	// reference the kept contact.
+	MovedFiles []string `json:"moved_files,omitempty"`
+	// CleanedFiles are the files that referenced both contacts, and now
+	// reference only the kept contact.
+	CleanedFiles []string `json:"cleaned_files,omitempty"`
+	// MovedSuggestions are the keys of the sharing suggestions that were
+	// linked to the removed contact, and are now linked to the kept contact.
+	MovedSuggestions []string  `json:"moved_suggestions,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (m *Merge) ID() string { return m.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (m *Merge) Rev() string { return m.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (m *Merge) DocType() string { return consts.ContactsMerges }
+
+// Clone implements couchdb.Doc
+func (m *Merge) Clone() couchdb.Doc {
+	cloned := *m
+	cloned.KeptBefore = deepCopy(m.KeptBefore)
+	cloned.RemovedBefore = deepCopy(m.RemovedBefore)
+	cloned.MovedFiles = append([]string{}, m.MovedFiles...)
+	cloned.CleanedFiles = append([]string{}, m.CleanedFiles...)
+	cloned.MovedSuggestions = append([]string{}, m.MovedSuggestions...)
+	if m.Duplicate != nil {
+		cloned.Duplicate = m.Duplicate.Clone().(*Duplicate)
+	}
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (m *Merge) SetID(id string) { m.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (m *Merge) SetRev(rev string) { m.DocRev = rev }
+
+// MergeFields returns the fields of a contact that would result of the merge
+// of the removed contact in the kept one. The fields of the kept contact win,
+// the missing fields are taken from the removed contact, and the lists (email
+// addresses, phone numbers, etc.) are concatenated without the duplicates.
+// The contacts are not modified.
+func MergeFields(kept, removed *Contact) map[string]interface{} {
+	merged := deepCopy(kept.M)
+	for k, v := range removed.M {
+		if skippedFields[k] {
+			continue
+		}
+		merged[k] = mergeValue(k, merged[k], v)
+	}
+	if isTrue(kept.M["favorite"]) || isTrue(removed.M["favorite"]) {
+		merged["favorite"] = true
+	}
+	if isTrue(kept.M["me"]) || isTrue(removed.M["me"]) {
+		merged["me"] = true
+	}
+	return merged
+}
+
+func mergeValue(key string, kept, removed interface{}) interface{} {
+	switch k := kept.(type) {
+	case nil:
+		return deepCopyValue(removed)
+	case string:
+		if k == "" {
+			return deepCopyValue(removed)
+		}
+	case map[string]interface{}:
+		if r, ok := removed.(map[string]interface{}); ok {
+			for field, value := range r {
+				k[field] = mergeValue(field, k[field], value)
+			}
+		}
+	case []interface{}:
+		if r, ok := removed.([]interface{}); ok {
+			return mergeList(key, k, r)
+		}
+	}
+	return kept
+}
+
+func mergeList(key string, kept, removed []interface{}) []interface{} {
+	keyOf := func(item interface{}) string {
+		if obj, ok := item.(map[string]interface{}); ok {
+			if fn, ok := listKeys[key]; ok {
+				if k := fn(obj); k != "" {
+					return k
+				}
+			}
+			// The relationships are lists of {_id, _type}
+			if id, ok := obj["_id"].(string); ok {
+				return id
+			}
+		}
+		buf, _ := json.Marshal(item)
+		return string(buf)
+	}
+	hasPrimary := false
+	seen := make(map[string]bool, len(kept))
+	for _, item := range kept {
+		seen[keyOf(item)] = true
+		if obj, ok := item.(map[string]interface{}); ok && isTrue(obj["primary"]) {
+			hasPrimary = true
+		}
+	}
+	merged := kept
+	for _, item := range removed {
+		k := keyOf(item)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		item = deepCopyValue(item)
+		if obj, ok := item.(map[string]interface{}); ok && hasPrimary && isTrue(obj["primary"]) {
+			obj["primary"] = false
+		}
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// Preview returns the contact that would result of the merge of a pair of
+// duplicates, and the contact that would be removed.
+func (d *Duplicate) Preview(db prefixer.Prefixer) (*Contact, *Contact, error) {
+	kept, removed, err := d.chooseKept(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	linked, err := linkedEmails(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged := New()
+	merged.M = MergeFields(kept, removed)
+	keepLinkedEmails(merged.M, removed, linked)
+	return merged, removed, nil
+}
+
+// chooseKept returns the contacts of the pair: the kept one first, then the
+// one that will be removed. The myself contact is always kept, then the
+// contact that is shared, and finally the contact with the more fields.
+func (d *Duplicate) chooseKept(db prefixer.Prefixer) (*Contact, *Contact, error) {
+	if len(d.Contacts) != 2 {
+		return nil, nil, ErrDuplicateNotFound
+	}
+	a, err := Find(db, d.Contacts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := Find(db, d.Contacts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	if isTrue(a.M["me"]) && isTrue(b.M["me"]) {
+		return nil, nil, ErrCannotMerge
+	}
+	if isTrue(b.M["me"]) {
+		return b, a, nil
+	}
+	if isTrue(a.M["me"]) {
+		return a, b, nil
+	}
+	sharedA, sharedB := isShared(db, a.ID()), isShared(db, b.ID())
+	switch {
+	case sharedA && sharedB:
+		return nil, nil, ErrCannotMerge
+	case sharedB:
+		return b, a, nil
+	case sharedA:
+		return a, b, nil
+	}
+	if len(b.M) > len(a.M) {
+		return b, a, nil
+	}
+	return a, b, nil
+}
+
+// MergeDuplicate merges the two contacts of the pair. The kept contact gets
+// the fields of the other one, which is moved to the trash, and the files and
+// the sharing suggestions that referenced the removed contact now reference
+// the kept contact. The merge can be undone during the UndoWindow. If a step
+// fails, the previous ones are rolled back.
+func MergeDuplicate(db prefixer.Prefixer, dup *Duplicate) (*Contact, *Merge, error) {
+	kept, removed, err := dup.chooseKept(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	linked, err := linkedEmails(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	record := &Merge{
+		Kept:          kept.ID(),
+		Removed:       removed.ID(),
+		KeptBefore:    deepCopy(kept.M),
+		RemovedBefore: deepCopy(removed.M),
+		Duplicate:     dup.Clone().(*Duplicate),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(UndoWindow),
+	}
+	record.Duplicate.DocRev = ""
+	if err := couchdb.CreateDoc(db, record); err != nil {
+		return nil, nil, err
+	}
+
+	olddoc := kept.clone()
+	kept.M = MergeFields(kept, removed)
+	keepLinkedEmails(kept.M, removed, linked)
+	if md, ok := kept.M["cozyMetadata"].(map[string]interface{}); ok {
+		md["updatedAt"] = now
+	}
+	if err := couchdb.UpdateDocWithOld(db, kept, olddoc); err != nil {
+		_ = couchdb.DeleteDoc(db, record)
+		return nil, nil, err
+	}
+
+	record.MovedFiles, record.CleanedFiles, err = moveReferences(db, removed.ID(), kept.ID())
+	if err == nil {
+		record.MovedSuggestions, err = moveSuggestions(db, removed.ID(), kept.ID(), nil)
+	}
+	if err == nil {
+		err = couchdb.UpdateDoc(db, record)
+	}
+	if err == nil {
+		oldremoved := removed.clone()
+		removed.M["trashed"] = true
+		err = couchdb.UpdateDocWithOld(db, removed, oldremoved)
+	}
+	if err != nil {
+		if errm := record.rollback(db, kept); errm != nil {
+			err = multierror.Append(err, errm)
+		}
+		return nil, nil, err
+	}
+
+	if err := couchdb.DeleteDoc(db, dup); err != nil && !couchdb.IsNotFoundError(err) {
+		return nil, nil, err
+	}
+	return kept, record, nil
+}
+
+// rollback restores the state before a merge that has failed halfway: the
+// kept contact, the references of the files and the sharing suggestions. The
+// failures are collected, and the merge record is kept if some of them can't
+// be restored, so that the merge can still be undone later.
+func (m *Merge) rollback(db prefixer.Prefixer, kept *Contact) error {
+	var errm error
+	if len(m.MovedSuggestions) > 0 {
+		if _, err := moveSuggestions(db, m.Kept, m.Removed, m.MovedSuggestions); err != nil {
+			errm = multierror.Append(errm, err)
+		}
+	}
+	if err := restoreReferences(db, m.Removed, m.Kept, m.MovedFiles, m.CleanedFiles); err != nil {
+		errm = multierror.Append(errm, err)
+	}
+	olddoc := kept.clone()
+	kept.M = deepCopy(m.KeptBefore)
+	kept.M["_id"] = kept.ID()
+	kept.M["_rev"] = olddoc.Rev()
+	if err := couchdb.UpdateDocWithOld(db, kept, olddoc); err != nil {
+		errm = multierror.Append(errm, err)
+	}
+	if errm != nil {
+		return errm
+	}
+	return couchdb.DeleteDoc(db, m)
+}
+
+// GetMerge returns the merge with the given identifier, if it can still be
+// undone.
+func GetMerge(db prefixer.Prefixer, id string) (*Merge, error) {
+	var record Merge
+	if err := couchdb.GetDoc(db, consts.ContactsMerges, id, &record); err != nil {
+		if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+			return nil, ErrMergeNotFound
+		}
+		return nil, err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrMergeNotFound
+	}
+	return &record, nil
+}
+
+// Undo restores the two contacts as they were before the merge, and the
+// references of the files and of the sharing suggestions to the removed
+// contact.
+func (m *Merge) Undo(db prefixer.Prefixer) error {
+	kept, err := Find(db, m.Kept)
+	if err != nil {
+		return err
+	}
+	olddoc := kept.clone()
+	kept.M = deepCopy(m.KeptBefore)
+	kept.M["_id"] = kept.ID()
+	kept.M["_rev"] = olddoc.Rev()
+	if err := couchdb.UpdateDocWithOld(db, kept, olddoc); err != nil {
+		return err
+	}
+
+	// The removed contact is in the trash, except if the trash has been
+	// emptied in the meantime
+	removed, err := Find(db, m.Removed)
+	switch {
+	case err == nil:
+		oldremoved := removed.clone()
+		removed.M = deepCopy(m.RemovedBefore)
+		removed.M["_id"] = m.Removed
+		removed.M["_rev"] = oldremoved.Rev()
+		err = couchdb.UpdateDocWithOld(db, removed, oldremoved)
+	case couchdb.IsNotFoundError(err):
+		removed = New()
+		removed.M = deepCopy(m.RemovedBefore)
+		delete(removed.M, "_rev")
+		removed.SetID(m.Removed)
+		err = couchdb.CreateNamedDocWithDB(db, removed)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := restoreReferences(db, m.Removed, m.Kept, m.MovedFiles, m.CleanedFiles); err != nil {
+		return err
+	}
+	if len(m.MovedSuggestions) > 0 {
+		if _, err := moveSuggestions(db, m.Kept, m.Removed, m.MovedSuggestions); err != nil {
+			return err
+		}
+	}
+	if m.Duplicate != nil {
+		dup := m.Duplicate.Clone().(*Duplicate)
+		dup.DocRev = ""
+		if err := couchdb.CreateNamedDocWithDB(db, dup); err != nil && !couchdb.IsConflictError(err) {
+			return err
+		}
+	}
+	return couchdb.DeleteDoc(db, m)
+}
+
+// CleanExpiredMerges deletes the merges that can no longer be undone.
+func CleanExpiredMerges(db prefixer.Prefixer) error {
+	now := time.Now()
+	var expired []couchdb.Doc
+	err := couchdb.ForeachDocs(db, consts.ContactsMerges, func(_ string, raw json.RawMessage) error {
+		var record Merge
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return err
+		}
+		if now.After(record.ExpiresAt) {
+			expired = append(expired, &record)
+		}
+		return nil
+	})
+	if couchdb.IsNoDatabaseError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return couchdb.BulkDeleteDocs(db, consts.ContactsMerges, expired)
+}
+
+// moveReferences replaces the references to the removed contact by
+// references to the kept contact on the files. It returns the identifiers of
+// the files where the reference has been moved, and of the files where the
+// reference to the removed contact has just been deleted as they were
+// already referencing the kept contact. The identifiers are also returned on
+// error, so that the references can be restored.
+func moveReferences(db prefixer.Prefixer, removedID, keptID string) ([]string, []string, error) {
+	files, err := filesReferencing(db, removedID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var moved, cleaned []string
+	docs := make([]interface{}, 0, len(files))
+	olds := make([]interface{}, 0, len(files))
+	for _, file := range files {
+		refs, _ := file.M["referenced_by"].([]interface{})
+		hasKept := false
+		for _, ref := range refs {
+			if isContactRef(ref, keptID) {
+				hasKept = true
+			}
+		}
+		var updated []interface{}
+		for _, ref := range refs {
+			if !isContactRef(ref, removedID) {
+				updated = append(updated, ref)
+			} else if !hasKept {
+				updated = append(updated, map[string]interface{}{
+					"type": consts.Contacts,
+					"id":   keptID,
+				})
+			}
+		}
+		if hasKept {
+			cleaned = append(cleaned, file.ID())
+		} else {
+			moved = append(moved, file.ID())
+		}
+		old := file.Clone()
+		file.M["referenced_by"] = updated
+		docs = append(docs, file)
+		olds = append(olds, old)
+	}
+	err = couchdb.BulkUpdateDocs(db, consts.Files, docs, olds)
+	return moved, cleaned, err
+}
+
+// restoreReferences puts back the references to the removed contact on the
+// files after an undo, or after a merge that has failed. The files that
+// still reference the removed contact are left untouched.
+func restoreReferences(db prefixer.Prefixer, removedID, keptID string, moved, cleaned []string) error {
+	ids := append(append([]string{}, moved...), cleaned...)
+	if len(ids) == 0 {
+		return nil
+	}
+	wasMoved := make(map[string]bool, len(moved))
+	for _, id := range moved {
+		wasMoved[id] = true
+	}
+	docs := make([]interface{}, 0, len(ids))
+	olds := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		file := &couchdb.JSONDoc{}
+		if err := couchdb.GetDoc(db, consts.Files, id, file); err != nil {
+			if couchdb.IsNotFoundError(err) {
+				continue
+			}
+			return err
+		}
+		file.Type = consts.Files
+		refs, _ := file.M["referenced_by"].([]interface{})
+		restored := false
+		for _, ref := range refs {
+			if isContactRef(ref, removedID) {
+				restored = true
+			}
+		}
+		if restored {
+			continue
+		}
+		var updated []interface{}
+		for _, ref := range refs {
+			if wasMoved[id] && isContactRef(ref, keptID) {
+				continue
+			}
+			updated = append(updated, ref)
+		}
+		updated = append(updated, map[string]interface{}{
+			"type": consts.Contacts,
+			"id":   removedID,
+		})
+		old := file.Clone()
+		file.M["referenced_by"] = updated
+		docs = append(docs, file)
+		olds = append(olds, old)
+	}
+	return couchdb.BulkUpdateDocs(db, consts.Files, docs, olds)
+}
+
+// moveSuggestions replaces the identifier of a contact by another one in the
+// candidates of the sharing suggestions. If keys is not nil, only the
+// candidates with these keys are modified. It returns the keys of the
+// modified candidates.
+func moveSuggestions(db prefixer.Prefixer, fromID, toID string, keys []string) ([]string, error) {
+	doc := &couchdb.JSONDoc{}
+	err := couchdb.GetDoc(db, consts.SharingsSuggestions, suggestionsDocID, doc)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Type = consts.SharingsSuggestions
+	old := doc.Clone()
+	candidates, _ := doc.M["candidates"].([]interface{})
+	moved := replaceCandidateContact(candidates, fromID, toID, keys)
+	if len(moved) == 0 {
+		return nil, nil
+	}
+	if err := couchdb.UpdateDocWithOld(db, doc, old); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+func replaceCandidateContact(candidates []interface{}, fromID, toID string, keys []string) []string {
+	var allowed map[string]bool
+	if keys != nil {
+		allowed = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			allowed[k] = true
+		}
+	}
+	var moved []string
+	for _, c := range candidates {
+		candidate, ok := c.(map[string]interface{})
+		if !ok || candidate["contact_id"] != fromID {
+			continue
+		}
+		key, _ := candidate["key"].(string)
+		if allowed != nil && !allowed[key] {
+			continue
+		}
+		candidate["contact_id"] = toID
+		moved = append(moved, key)
+	}
+	return moved
+}
+
+// linkedEmails returns the email addresses used by the members of the
+// sharings and by the bitwarden contacts. They are linked to the contacts by
+// these addresses, so they must still be found on the merged contact.
+func linkedEmails(db prefixer.Prefixer) (map[string]bool, error) {
+	linked := make(map[string]bool)
+	err := couchdb.ForeachDocs(db, consts.Sharings, func(_ string, raw json.RawMessage) error {
+		var doc struct {
+			Members []struct {
+				Email string `json:"email"`
+			} `json:"members"`
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		for _, m := range doc.Members {
+			if m.Email != "" {
+				linked[m.Email] = true
+			}
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	err = couchdb.ForeachDocs(db, consts.BitwardenContacts, func(_ string, raw json.RawMessage) error {
+		var doc struct {
+			Email string `json:"email"`
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		if doc.Email != "" {
+			linked[doc.Email] = true
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	return linked, nil
+}
+
+// keepLinkedEmails adds to the merged fields the addresses of the removed
+// contact that are linked to a sharing member or a bitwarden contact, when
+// they have been skipped as duplicates of an address of the kept contact
+// written differently (like JOHN@example.com and john@example.com).
+func keepLinkedEmails(merged map[string]interface{}, removed *Contact, linked map[string]bool) {
+	emails, _ := merged["email"].([]interface{})
+	present := make(map[string]bool, len(emails))
+	for _, item := range emails {
+		if obj, ok := item.(map[string]interface{}); ok {
+			if address, ok := obj["address"].(string); ok {
+				present[address] = true
+			}
+		}
+	}
+	removedEmails, _ := removed.M["email"].([]interface{})
+	for _, item := range removedEmails {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := obj["address"].(string)
+		if address == "" || present[address] || !linked[address] {
+			continue
+		}
+		obj = deepCopy(obj)
+		obj["primary"] = false
+		emails = append(emails, obj)
+		present[address] = true
+	}
+	if len(emails) > 0 {
+		merged["email"] = emails
+	}
+}
+
+func filesReferencing(db prefixer.Prefixer, contactID string) ([]*couchdb.JSONDoc, error) {
+	req := &couchdb.ViewRequest{
+		Key:         []string{consts.Contacts, contactID},
+		IncludeDocs: true,
+		Reduce:      false,
+	}
+	var res couchdb.ViewResponse
+	if err := couchdb.ExecView(db, couchdb.FilesReferencedByView, req, &res); err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	files := make([]*couchdb.JSONDoc, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		file := &couchdb.JSONDoc{}
+		if err := json.Unmarshal(row.Doc, file); err != nil {
+			return nil, err
+		}
+		file.Type = consts.Files
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func isContactRef(ref interface{}, id string) bool {
+	obj, ok := ref.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	return obj["type"] == consts.Contacts && obj["id"] == id
+}
+
+func (c *Contact) clone() *Contact {
+	cloned := c.JSONDoc.Clone().(*couchdb.JSONDoc)
+	return &Contact{JSONDoc: *cloned}
+}
+
+func isShared(db prefixer.Prefixer, id string) bool {
+	var doc couchdb.JSONDoc
+	err := couchdb.GetDoc(db, consts.Shared, consts.Contacts+"/"+id, &doc)
+	return err == nil
+}
+
+func isTrue(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+func deepCopy(m map[string]interface{}) map[string]interface{} {
+	copied, _ := deepCopyValue(m).(map[string]interface{})
+	if copied == nil {
+		copied = make(map[string]interface{})
+	}
+	return copied
+}
+
+func deepCopyValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			copied[k] = deepCopyValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = deepCopyValue(item)
+		}
+		return copied
+	}
+	return v
+}
@@ -0,0 +1,434 @@
+package contact
+
+import (
+	"bufio"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// maxVCardLineSize is the maximal size of a line of a vCard, after the
+// unfolding. The photos are the longest lines, and they are ignored.
+const maxVCardLineSize = 1024 * 1024
+
+// vcardProperty is a line of a vCard, like:
+//
+//	EMAIL;TYPE=work,pref:alice@example.net
+type vcardProperty struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// types returns the values of the TYPE parameter, lowercased. The vCard 2.1
+// parameters without a name are also types.
+func (p *vcardProperty) types() []string {
+	var types []string
+	for _, t := range p.Params["TYPE"] {
+		for _, v := range strings.Split(t, ",") {
+			if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+				types = append(types, v)
+			}
+		}
+	}
+	return types
+}
+
+// isPreferred returns true if the property is the preferred one of its kind,
+// with a PREF parameter (vCard 4.0) or a pref type (vCard 3.0).
+func (p *vcardProperty) isPreferred() bool {
+	if len(p.Params["PREF"]) > 0 {
+		return true
+	}
+	for _, t := range p.types() {
+		if t == "pref" {
+			return true
+		}
+	}
+	return false
+}
+
+// kind returns the first type of the property that can be used as the type
+// of an email, phone number or address for io.cozy.contacts.
+func (p *vcardProperty) kind() string {
+	for _, t := range p.types() {
+		switch t {
+		case "pref", "internet", "voice", "x400":
+			continue
+		}
+		if strings.HasPrefix(t, "x-") {
+			continue
+		}
+		return t
+	}
+	return ""
+}
+
+// ParseVCards reads a stream of vCards (versions 2.1, 3.0 and 4.0), and
+// returns the contacts. The fields that have no equivalent in the
+// io.cozy.contacts doctype, like the photos, are ignored.
+func ParseVCards(r io.Reader) ([]*Contact, error) {
+	var contacts []*Contact
+	var props []*vcardProperty
+	inCard := false
+	depth := 0
+
+	err := unfoldVCardLines(r, func(line string) {
+		prop := parseVCardLine(line)
+		if prop == nil {
+			return
+		}
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VCARD"):
+			if inCard {
+				depth++ // Nested vCard, like an AGENT in vCard 2.1
+				return
+			}
+			inCard = true
+			props = props[:0]
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VCARD"):
+			if depth > 0 {
+				depth--
+				return
+			}
+			if inCard {
+				if c := contactFromVCard(props); c != nil {
+					contacts = append(contacts, c)
+				}
+			}
+			inCard = false
+		case inCard && depth == 0:
+			props = append(props, prop)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
+
+// unfoldVCardLines calls fn for each logical line of the vCards: the lines
+// starting with a space or a tab are the continuation of the previous line.
+// The quoted-printable values of vCard 2.1 use a = at the end of the line for
+// the soft line breaks.
+func unfoldVCardLines(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxVCardLineSize)
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			fn(current.String())
+			current.Reset()
+		}
+	}
+	qpContinuation := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case qpContinuation:
+			// Keep the soft line break for the quoted-printable decoder
+			current.WriteString("\r\n")
+			current.WriteString(line)
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			current.WriteString(line[1:])
+		default:
+			flush()
+			current.WriteString(line)
+		}
+		qpContinuation = strings.HasSuffix(line, "=") &&
+			strings.Contains(strings.ToUpper(current.String()), "QUOTED-PRINTABLE")
+	}
+	flush()
+	return scanner.Err()
+}
+
+// parseVCardLine parses a line like GROUP.NAME;PARAM=VALUE:VALUE. The colons
+// in the quoted parameter values are not the separator of the value.
+func parseVCardLine(line string) *vcardProperty {
+	sep := -1
+	quoted := false
+	for i, ch := range line {
+		if ch == '"' {
+			quoted = !quoted
+		} else if ch == ':' && !quoted {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 {
+		return nil
+	}
+
+	parts := splitUnquoted(line[:sep], ';')
+	name := strings.ToUpper(strings.TrimSpace(parts[0]))
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		name = name[dot+1:]
+	}
+	if name == "" {
+		return nil
+	}
+	prop := &vcardProperty{
+		Name:   name,
+		Params: make(map[string][]string),
+		Value:  line[sep+1:],
+	}
+	for _, param := range parts[1:] {
+		key, value := param, ""
+		if eq := strings.IndexByte(param, '='); eq >= 0 {
+			key, value = param[:eq], param[eq+1:]
+		} else {
+			// vCard 2.1: TEL;WORK;VOICE:... or EMAIL;INTERNET:...
+			key, value = "TYPE", param
+			switch strings.ToUpper(param) {
+			case "QUOTED-PRINTABLE", "BASE64":
+				key = "ENCODING"
+			}
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		prop.Params[key] = append(prop.Params[key], value)
+	}
+	for _, encoding := range prop.Params["ENCODING"] {
+		if strings.EqualFold(encoding, "QUOTED-PRINTABLE") {
+			decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(prop.Value)))
+			if err == nil {
+				prop.Value = string(decoded)
+			}
+		}
+	}
+	return prop
+}
+
+func splitUnquoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, ch := range s {
+		if ch == '"' {
+			quoted = !quoted
+		} else if ch == sep && !quoted {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitVCardValue splits a structured value, like N or ADR, on the semicolons
+// that are not escaped, and unescapes the components.
+func splitVCardValue(value string) []string {
+	var parts []string
+	var current strings.Builder
+	escaped := false
+	for _, ch := range value {
+		switch {
+		case escaped:
+			current.WriteRune('\\')
+			current.WriteRune(ch)
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case ch == ';':
+			parts = append(parts, unescapeVCardValue(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(ch)
+		}
+	}
+	return append(parts, unescapeVCardValue(current.String()))
+}
+
+func unescapeVCardValue(value string) string {
+	if !strings.ContainsRune(value, '\\') {
+		return strings.TrimSpace(value)
+	}
+	var b strings.Builder
+	escaped := false
+	for _, ch := range value {
+		if escaped {
+			switch ch {
+			case 'n', 'N':
+				b.WriteRune('\n')
+			default:
+				b.WriteRune(ch)
+			}
+			escaped = false
+		} else if ch == '\\' {
+			escaped = true
+		} else {
+			b.WriteRune(ch)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// contactFromVCard converts the properties of a vCard to a contact. It
+// returns nil if the vCard has no name, email, phone number, nor address.
+func contactFromVCard(props []*vcardProperty) *Contact {
+	c := New()
+	var emails, phones, addresses []map[string]interface{}
+	emailPref, phonePref, addressPref := -1, -1, -1
+
+	for _, prop := range props {
+		switch prop.Name {
+		case "FN":
+			if fn := unescapeVCardValue(prop.Value); fn != "" {
+				c.M["fullname"] = fn
+			}
+		case "N":
+			parts := splitVCardValue(prop.Value)
+			keys := []string{"familyName", "givenName", "additionalName", "namePrefix", "nameSuffix"}
+			name := make(map[string]interface{})
+			for i, key := range keys {
+				if i < len(parts) && parts[i] != "" {
+					name[key] = parts[i]
+				}
+			}
+			if len(name) > 0 {
+				c.M["name"] = name
+			}
+		case "EMAIL":
+			address := unescapeVCardValue(prop.Value)
+			address = strings.TrimPrefix(address, "mailto:")
+			if address == "" {
+				continue
+			}
+			if emailPref < 0 && prop.isPreferred() {
+				emailPref = len(emails)
+			}
+			emails = append(emails, withKind(map[string]interface{}{"address": address}, prop))
+		case "TEL":
+			number := unescapeVCardValue(prop.Value)
+			number = strings.TrimPrefix(number, "tel:")
+			if number == "" {
+				continue
+			}
+			if phonePref < 0 && prop.isPreferred() {
+				phonePref = len(phones)
+			}
+			phones = append(phones, withKind(map[string]interface{}{"number": number}, prop))
+		case "ADR":
+			addr := addressFromVCard(prop)
+			if addr == nil {
+				continue
+			}
+			if addressPref < 0 && prop.isPreferred() {
+				addressPref = len(addresses)
+			}
+			addresses = append(addresses, withKind(addr, prop))
+		case "ORG":
+			if parts := splitVCardValue(prop.Value); parts[0] != "" {
+				c.M["company"] = parts[0]
+			}
+		case "TITLE":
+			if title := unescapeVCardValue(prop.Value); title != "" {
+				c.M["jobTitle"] = title
+			}
+		case "BDAY":
+			if bday := normalizeBirthday(unescapeVCardValue(prop.Value)); bday != "" {
+				c.M["birthday"] = bday
+			}
+		case "NOTE":
+			if note := unescapeVCardValue(prop.Value); note != "" {
+				c.M["note"] = note
+			}
+		}
+	}
+
+	if len(emails) > 0 {
+		c.M["email"] = markPrimary(emails, emailPref)
+	}
+	if len(phones) > 0 {
+		c.M["phone"] = markPrimary(phones, phonePref)
+	}
+	if len(addresses) > 0 {
+		c.M["address"] = markPrimary(addresses, addressPref)
+	}
+	if _, ok := c.M["fullname"]; !ok {
+		if name := c.PrimaryName(); name != "" {
+			c.M["fullname"] = name
+		}
+	}
+	if len(c.M) == 0 {
+		return nil
+	}
+	return c
+}
+
+// addressFromVCard converts an ADR property, with the components: post
+// office box, extended address, street, locality, region, postal code, and
+// country.
+func addressFromVCard(prop *vcardProperty) map[string]interface{} {
+	parts := splitVCardValue(prop.Value)
+	for len(parts) < 7 {
+		parts = append(parts, "")
+	}
+	street := strings.TrimSpace(strings.Join([]string{parts[1], parts[2]}, " "))
+	addr := make(map[string]interface{})
+	fields := map[string]string{
+		"pobox":    parts[0],
+		"street":   street,
+		"city":     parts[3],
+		"region":   parts[4],
+		"postcode": parts[5],
+		"country":  parts[6],
+	}
+	var formatted []string
+	for _, key := range []string{"pobox", "street", "postcode", "city", "region", "country"} {
+		if v := fields[key]; v != "" {
+			addr[key] = v
+			formatted = append(formatted, v)
+		}
+	}
+	if len(addr) == 0 {
+		return nil
+	}
+	if labels := prop.Params["LABEL"]; len(labels) > 0 && labels[0] != "" {
+		addr["formattedAddress"] = unescapeVCardValue(labels[0])
+	} else {
+		addr["formattedAddress"] = strings.Join(formatted, ", ")
+	}
+	return addr
+}
+
+func withKind(item map[string]interface{}, prop *vcardProperty) map[string]interface{} {
+	if kind := prop.kind(); kind != "" {
+		item["type"] = kind
+	}
+	return item
+}
+
+// markPrimary flags the preferred item of a list as the primary one, or the
+// first item if none is preferred.
+func markPrimary(items []map[string]interface{}, pref int) []interface{} {
+	if pref < 0 {
+		pref = 0
+	}
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		item["primary"] = i == pref
+		list[i] = item
+	}
+	return list
+}
+
+// normalizeBirthday returns the birthday in the YYYY-MM-DD format, from the
+// formats used in the vCards (19850412, 1985-04-12, or 1985-04-12T00:00:00Z).
+func normalizeBirthday(bday string) string {
+	if len(bday) >= 10 && bday[4] == '-' && bday[7] == '-' {
+		return bday[:10]
+	}
+	if len(bday) >= 8 && isDigits(bday[:8]) {
+		return bday[:4] + "-" + bday[4:6] + "-" + bday[6:8]
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -1,6 +1,7 @@
 package feature
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,10 +11,13 @@ import (
 	"time"
 
 	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/realtime"
 )
 
 // Flags is a struct for a set of feature flags.
@@ -252,6 +256,9 @@ func applyRatio(inst *instance.Instance, key string, data interface{}) interface
 		if !ok {
 			continue
 		}
+		if !matchTargeting(inst, item) {
+			continue
+		}
 		ratio, ok := item["ratio"].(float64)
 		if !ok || ratio == 0.0 {
 			continue
@@ -268,6 +275,48 @@ func applyRatio(inst *instance.Instance, key string, data interface{}) interface
 	return nil
 }
 
+// matchTargeting returns false if the item has some targeting rules on the
+// instance attributes that are not satisfied. The rules are:
+//   - feature_sets: the instance must have at least one of these feature
+//     sets (ie the offers from the manager)
+//   - created_after / created_before: the instance must have been created
+//     after / before the given date.
+func matchTargeting(inst *instance.Instance, item map[string]interface{}) bool {
+	if sets, ok := item["feature_sets"].([]interface{}); ok {
+		found := false
+		for _, set := range sets {
+			for _, s := range inst.FeatureSets {
+				if set == s {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if after, ok := item["created_after"].(string); ok {
+		date, err := parseTargetingDate(after)
+		if err != nil || inst.CreatedAt == nil || !inst.CreatedAt.After(date) {
+			return false
+		}
+	}
+	if before, ok := item["created_before"].(string); ok {
+		date, err := parseTargetingDate(before)
+		if err != nil || inst.CreatedAt == nil || !inst.CreatedAt.Before(date) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTargetingDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
 func (f *Flags) addDefaults(inst *instance.Instance) error {
 	var defaults Flags
 	err := couchdb.GetDoc(prefixer.GlobalPrefixer, consts.Settings, consts.DefaultFlagsSettingsID, &defaults)
@@ -289,4 +338,95 @@ func (f *Flags) addDefaults(inst *instance.Instance) error {
 	return nil
 }
 
+// GetBool returns the value of a boolean flag. It returns false if the flag is
+// not set or is not a boolean.
+func (f *Flags) GetBool(name string) bool {
+	value, _ := f.M[name].(bool)
+	return value
+}
+
+// GetInt returns the value of a numeric flag, and false if the flag is not
+// set or is not a number.
+func (f *Flags) GetInt(name string) (int, bool) {
+	value, ok := f.M[name].(float64)
+	if !ok {
+		if i, ok := f.M[name].(int); ok {
+			return i, true
+		}
+		return 0, false
+	}
+	return int(value), true
+}
+
+// GetString returns the value of a string flag, and false if the flag is not
+// set or is not a string.
+func (f *Flags) GetString(name string) (string, bool) {
+	value, ok := f.M[name].(string)
+	return value, ok
+}
+
+// IsEnabled is a shortcut to know if a boolean flag is enabled for the given
+// instance.
+func IsEnabled(inst *instance.Instance, name string) bool {
+	flags, err := GetFlags(inst)
+	if err != nil {
+		return false
+	}
+	return flags.GetBool(name)
+}
+
+// PublishChanges sends the computed feature flags of the instance on the
+// realtime hub, so that the apps can react to a change of the flags without
+// reloading.
+func PublishChanges(inst *instance.Instance) {
+	flags, err := GetFlags(inst)
+	if err != nil {
+		return
+	}
+	flags.Sources = nil
+	realtime.GetHub().Publish(inst, realtime.EventUpdate, flags, nil)
+}
+
+// PublishWorkerType is the type of the job that sends the computed feature
+// flags of the instances of a context on the realtime hub.
+const PublishWorkerType = "publish-flags"
+
+// PublishMessage is the message of the publish-flags jobs.
+type PublishMessage struct {
+	ContextName string `json:"context_name,omitempty"`
+}
+
+// PublishContextChanges pushes a job to send the computed feature flags on
+// the realtime hub for all the instances of the given context (or all the
+// instances if the context name is empty). It can be used after the flags of
+// a context or the default flags have been modified.
+func PublishContextChanges(contextName string) {
+	msg, err := job.NewMessage(&PublishMessage{ContextName: contextName})
+	if err == nil {
+		_, err = job.System().PushJob(prefixer.GlobalPrefixer, &job.JobRequest{
+			WorkerType: PublishWorkerType,
+			Message:    msg,
+		})
+	}
+	if err != nil {
+		logger.WithNamespace("flags").
+			Warnf("Cannot push a job to publish the flags for %q: %s", contextName, err)
+	}
+}
+
+// PublishAllChanges sends the computed feature flags on the realtime hub for
+// all the instances of the given context (or all the instances if the context
+// name is empty). It is called by the publish-flags worker.
+func PublishAllChanges(ctx context.Context, contextName string) error {
+	return instance.ForeachInstances(func(inst *instance.Instance) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if contextName == "" || inst.ContextName == contextName {
+			PublishChanges(inst)
+		}
+		return nil
+	})
+}
+
 var _ couchdb.Doc = &Flags{}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/gofrs/uuid"
@@ -39,3 +40,57 @@ func TestFeatureFlagRatio(t *testing.T) {
 	assert.InDelta(t, 4000, results[float64(4)], 100)
 	assert.InDelta(t, 3000, results[nil], 100)
 }
+
+func TestFeatureFlagTargeting(t *testing.T) {
+	created := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	inst := instance.Instance{
+		DocID:       uuidv4(),
+		ContextName: "testing",
+		FeatureSets: []string{"premium"},
+		CreatedAt:   &created,
+	}
+	legacy := instance.Instance{
+		DocID:       uuidv4(),
+		ContextName: "testing",
+	}
+
+	var data []interface{}
+	err := json.Unmarshal([]byte(`[
+	{"ratio": 1, "value": "premium", "feature_sets": ["premium", "pro"]},
+	{"ratio": 1, "value": "default"}
+]`), &data)
+	assert.NoError(t, err)
+	assert.Equal(t, "premium", applyRatio(&inst, "offer", data))
+	assert.Equal(t, "default", applyRatio(&legacy, "offer", data))
+
+	err = json.Unmarshal([]byte(`[
+	{"ratio": 1, "value": "new", "created_after": "2023-01-01"},
+	{"ratio": 1, "value": "old", "created_before": "2023-01-01T00:00:00Z"}
+]`), &data)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", applyRatio(&inst, "creation", data))
+	assert.Nil(t, applyRatio(&legacy, "creation", data))
+}
+
+func TestFeatureFlagTypedAccessors(t *testing.T) {
+	flags := &Flags{M: map[string]interface{}{
+		"enabled": true,
+		"max":     float64(12),
+		"name":    "foo",
+	}}
+	assert.True(t, flags.GetBool("enabled"))
+	assert.False(t, flags.GetBool("name"))
+	assert.False(t, flags.GetBool("missing"))
+
+	max, ok := flags.GetInt("max")
+	assert.True(t, ok)
+	assert.Equal(t, 12, max)
+	_, ok = flags.GetInt("name")
+	assert.False(t, ok)
+
+	name, ok := flags.GetString("name")
+	assert.True(t, ok)
+	assert.Equal(t, "foo", name)
+	_, ok = flags.GetString("max")
+	assert.False(t, ok)
+}
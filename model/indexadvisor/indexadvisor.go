@@ -0,0 +1,442 @@
+// Package indexadvisor records the shapes of the _find queries that cannot use
+// an index, and suggests the indexes that would avoid the full scans of the
+// databases. The suggested indexes can be created automatically for some
+// doctypes, depending on the context of the instance.
+package indexadvisor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/utils"
+)
+
+// OperatorEq is the operator used in a shape for the fields compared to a
+// value without an explicit operator.
+const OperatorEq = "$eq"
+
+// indexableOperators are the operators for which an index on the field can be
+// used by CouchDB.
+var indexableOperators = map[string]bool{
+	"$eq":     true,
+	"$gt":     true,
+	"$gte":    true,
+	"$lt":     true,
+	"$lte":    true,
+	"$in":     true,
+	"$exists": true,
+}
+
+// Record is a document with the shape of a query that cannot use an index:
+// the fields of the selector with their operators, but without the values.
+// The queries with the same shape share the same record.
+type Record struct {
+	DocID       string            `json:"_id,omitempty"`
+	DocRev      string            `json:"_rev,omitempty"`
+	Doctype     string            `json:"doctype"`
+	Selector    map[string]string `json:"selector"`
+	Sort        []string          `json:"sort,omitempty"`
+	Count       int               `json:"count"`
+	Suggestion  []string          `json:"suggested_fields,omitempty"`
+	AutoCreated bool              `json:"auto_created,omitempty"`
+	FirstSeenAt time.Time         `json:"first_seen_at"`
+	LastSeenAt  time.Time         `json:"last_seen_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (r *Record) ID() string { return r.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (r *Record) Rev() string { return r.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (r *Record) DocType() string { return consts.UnoptimalQueries }
+
+// Clone implements couchdb.Doc
+func (r *Record) Clone() couchdb.Doc {
+	cloned := *r
+	cloned.Selector = make(map[string]string, len(r.Selector))
+	for k, v := range r.Selector {
+		cloned.Selector[k] = v
+	}
+	cloned.Sort = append([]string{}, r.Sort...)
+	cloned.Suggestion = append([]string{}, r.Suggestion...)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (r *Record) SetID(id string) { r.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (r *Record) SetRev(rev string) { r.DocRev = rev }
+
+// Advice is the part of the report for a doctype: the suggested indexes,
+// from the most used query shape to the least used one.
+type Advice struct {
+	Doctype string    `json:"doctype"`
+	Count   int       `json:"count"`
+	Records []*Record `json:"queries"`
+}
+
+// flushInterval is the delay between two flushes of the counters to CouchDB.
+const flushInterval = time.Minute
+
+// maxPending is the maximal number of query shapes kept in memory between two
+// flushes. The shapes seen after this limit are ignored until the next flush.
+const maxPending = 10000
+
+// The queries are counted in memory, and the counters are written to CouchDB
+// periodically, to keep the round-trips out of the requests that are already
+// slow.
+type pendingKey struct {
+	prefix string
+	id     string
+}
+
+type pendingRecord struct {
+	db     prefixer.Prefixer
+	record Record
+}
+
+var (
+	mu      sync.Mutex
+	pending = make(map[pendingKey]*pendingRecord)
+)
+
+var log = logger.WithNamespace("indexadvisor")
+
+func init() {
+	couchdb.AddUnoptimalQueryHook(recordQuery)
+}
+
+func recordQuery(db prefixer.Prefixer, doctype string, req interface{}) {
+	if doctype == consts.UnoptimalQueries {
+		return
+	}
+	if err := Track(db, doctype, req); err != nil {
+		log.WithDomain(db.DomainName()).
+			Infof("Cannot record the unoptimal query on %s: %s", doctype, err)
+	}
+}
+
+// Track counts the shape of a _find query that cannot use an index. The
+// counters are kept in memory, and saved by Flush.
+func Track(db prefixer.Prefixer, doctype string, req interface{}) error {
+	var query struct {
+		Selector map[string]interface{} `json:"selector"`
+		Sort     json.RawMessage        `json:"sort"`
+	}
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(buf, &query); err != nil {
+		return err
+	}
+	selector := Shape(query.Selector)
+	sortFields := SortFields(query.Sort)
+	id := recordID(doctype, selector, sortFields)
+	now := time.Now().UTC()
+
+	mu.Lock()
+	defer mu.Unlock()
+	k := pendingKey{prefix: db.DBPrefix(), id: id}
+	p, ok := pending[k]
+	if !ok {
+		if len(pending) >= maxPending {
+			return nil
+		}
+		p = &pendingRecord{
+			db: db,
+			record: Record{
+				DocID:       id,
+				Doctype:     doctype,
+				Selector:    selector,
+				Sort:        sortFields,
+				FirstSeenAt: now,
+			},
+		}
+		pending[k] = p
+	}
+	p.record.Count++
+	p.record.LastSeenAt = now
+	return nil
+}
+
+// Flush saves the counters of the queries tracked since the last flush, and
+// creates the suggested indexes when it is enabled for their doctypes.
+func Flush() {
+	mu.Lock()
+	records := pending
+	pending = make(map[pendingKey]*pendingRecord)
+	mu.Unlock()
+
+	for _, p := range records {
+		if err := save(p.db, &p.record); err != nil {
+			log.WithDomain(p.db.DomainName()).
+				Infof("Cannot save the unoptimal query on %s: %s", p.record.Doctype, err)
+		}
+	}
+}
+
+func save(db prefixer.Prefixer, seen *Record) error {
+	var rec Record
+	err := couchdb.GetDoc(db, consts.UnoptimalQueries, seen.DocID, &rec)
+	if err != nil && !couchdb.IsNotFoundError(err) && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+	isNew := err != nil
+	if isNew {
+		rec = *seen
+		rec.Count = 0
+		rec.Suggestion = Suggest(seen.Selector, seen.Sort)
+	}
+	rec.Count += seen.Count
+	rec.LastSeenAt = seen.LastSeenAt
+	if !rec.AutoCreated && len(rec.Suggestion) > 0 && autoIndexEnabled(db, rec.Doctype) {
+		if err := createIndex(db, &rec); err != nil {
+			return err
+		}
+		rec.AutoCreated = true
+	}
+	if isNew {
+		return couchdb.CreateNamedDocWithDB(db, &rec)
+	}
+	return couchdb.UpdateDoc(db, &rec)
+}
+
+// Start launches a goroutine that flushes the counters periodically. The last
+// flush is made when the stack is shut down.
+func Start() utils.Shutdowner {
+	closed := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				Flush()
+			case <-closed:
+				return
+			}
+		}
+	}()
+	return &flusher{closed}
+}
+
+type flusher struct {
+	closed chan struct{}
+}
+
+func (f *flusher) Shutdown(ctx context.Context) error {
+	select {
+	case f.closed <- struct{}{}:
+	case <-ctx.Done():
+		return nil
+	}
+	Flush()
+	return nil
+}
+
+// Shape returns the fields of a selector with their operators. The nested
+// objects are flattened with dotted paths, and the $and operators are merged.
+// The other combination operators ($or, $nor, $not) are kept as is, as they
+// cannot be used for an index.
+func Shape(selector map[string]interface{}) map[string]string {
+	shape := make(map[string]string)
+	addShape(shape, "", selector)
+	return shape
+}
+
+func addShape(shape map[string]string, prefix string, selector map[string]interface{}) {
+	for key, value := range selector {
+		if key == "$and" {
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					if sub, ok := item.(map[string]interface{}); ok {
+						addShape(shape, prefix, sub)
+					}
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			shape[prefix+key] = key
+			continue
+		}
+		field := prefix + key
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			shape[field] = OperatorEq
+			continue
+		}
+		var ops []string
+		for k := range obj {
+			if strings.HasPrefix(k, "$") {
+				ops = append(ops, k)
+			}
+		}
+		if len(ops) == 0 {
+			addShape(shape, field+".", obj)
+			continue
+		}
+		sort.Strings(ops)
+		shape[field] = strings.Join(ops, ",")
+	}
+}
+
+// SortFields returns the fields of the sort of a _find query, that can be
+// given as a list of fields or as a list of {field: direction}.
+func SortFields(raw json.RawMessage) []string {
+	var items []interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &items) != nil {
+		return nil
+	}
+	var fields []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			fields = append(fields, v)
+		case map[string]interface{}:
+			for field := range v {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// Suggest returns the fields of an index that can be used for a query with
+// the given shape and sort: the fields compared for equality first, then the
+// sort fields, and finally the fields used for ranges. It returns nil if no
+// field of the query can be indexed.
+func Suggest(selector map[string]string, sortFields []string) []string {
+	var eq, ranges []string
+	for field, ops := range selector {
+		if strings.HasPrefix(field, "$") || strings.Contains(field, ".$") {
+			continue
+		}
+		indexable := true
+		for _, op := range strings.Split(ops, ",") {
+			if !indexableOperators[op] {
+				indexable = false
+			}
+		}
+		if !indexable {
+			continue
+		}
+		if ops == OperatorEq {
+			eq = append(eq, field)
+		} else {
+			ranges = append(ranges, field)
+		}
+	}
+	sort.Strings(eq)
+	sort.Strings(ranges)
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, list := range [][]string{eq, sortFields, ranges} {
+		for _, field := range list {
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func recordID(doctype string, selector map[string]string, sortFields []string) string {
+	// json.Marshal sorts the keys of the map, so the hash is stable
+	buf, _ := json.Marshal([]interface{}{doctype, selector, sortFields})
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:16])
+}
+
+func autoIndexEnabled(db prefixer.Prefixer, doctype string) bool {
+	autoIndexes := config.GetConfig().CouchDB.AutoIndexes
+	if len(autoIndexes) == 0 {
+		return false
+	}
+	inst, ok := db.(*instance.Instance)
+	if !ok {
+		return false
+	}
+	contextName := inst.ContextName
+	if contextName == "" {
+		contextName = config.DefaultInstanceContext
+	}
+	for _, d := range autoIndexes[contextName] {
+		if d == doctype {
+			return true
+		}
+	}
+	return false
+}
+
+func createIndex(db prefixer.Prefixer, rec *Record) error {
+	req := &mango.IndexRequest{
+		DDoc:  "advisor-" + rec.DocID,
+		Index: mango.IndexDef{Fields: rec.Suggestion},
+	}
+	_, err := couchdb.DefineIndexRaw(db, rec.Doctype, req)
+	return err
+}
+
+// Report returns the suggested indexes of an instance, grouped by doctype.
+// The doctypes with the most unoptimal queries come first.
+func Report(db prefixer.Prefixer) ([]*Advice, error) {
+	var records []*Record
+	req := &couchdb.AllDocsRequest{Limit: 1000}
+	err := couchdb.GetAllDocs(db, consts.UnoptimalQueries, req, &records)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*Advice{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Aggregate(records), nil
+}
+
+// Aggregate groups the records by doctype, and sorts them by count.
+func Aggregate(records []*Record) []*Advice {
+	byDoctype := make(map[string]*Advice)
+	advices := []*Advice{}
+	for _, rec := range records {
+		advice, ok := byDoctype[rec.Doctype]
+		if !ok {
+			advice = &Advice{Doctype: rec.Doctype}
+			byDoctype[rec.Doctype] = advice
+			advices = append(advices, advice)
+		}
+		advice.Count += rec.Count
+		advice.Records = append(advice.Records, rec)
+	}
+	for _, advice := range advices {
+		sort.SliceStable(advice.Records, func(i, j int) bool {
+			return advice.Records[i].Count > advice.Records[j].Count
+		})
+	}
+	sort.SliceStable(advices, func(i, j int) bool {
+		if advices[i].Count == advices[j].Count {
+			return advices[i].Doctype < advices[j].Doctype
+		}
+		return advices[i].Count > advices[j].Count
+	})
+	return advices
+}
@@ -0,0 +1,96 @@
+package indexadvisor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexAdvisor(t *testing.T) {
+	t.Run("Shape", func(t *testing.T) {
+		var selector map[string]interface{}
+		err := json.Unmarshal([]byte(`{
+			"dir_id": "io.cozy.files.root-dir",
+			"metadata": {"datetime": {"$gt": "2023", "$lt": "2024"}},
+			"$and": [{"trashed": false}, {"tags": {"$in": ["foo"]}}],
+			"$or": [{"name": "a"}, {"name": "b"}]
+		}`), &selector)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"dir_id":            "$eq",
+			"metadata.datetime": "$gt,$lt",
+			"trashed":           "$eq",
+			"tags":              "$in",
+			"$or":               "$or",
+		}, Shape(selector))
+	})
+
+	t.Run("SortFields", func(t *testing.T) {
+		sort, err := json.Marshal(mango.SortBy{
+			{Field: "type", Direction: mango.Asc},
+			{Field: "name", Direction: mango.Desc},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"type", "name"}, SortFields(sort))
+		assert.Equal(t, []string{"updated_at"}, SortFields(json.RawMessage(`["updated_at"]`)))
+		assert.Nil(t, SortFields(nil))
+	})
+
+	t.Run("Suggest", func(t *testing.T) {
+		selector := map[string]string{
+			"updated_at": "$gt",
+			"dir_id":     "$eq",
+			"class":      "$eq",
+			"name":       "$regex",
+			"$or":        "$or",
+		}
+		fields := Suggest(selector, []string{"name"})
+		assert.Equal(t, []string{"class", "dir_id", "name", "updated_at"}, fields)
+		assert.Nil(t, Suggest(map[string]string{"name": "$regex"}, nil))
+	})
+
+	t.Run("RecordIDIsStable", func(t *testing.T) {
+		shape := map[string]string{"a": "$eq", "b": "$gt"}
+		id := recordID("io.cozy.files", shape, nil)
+		assert.Equal(t, id, recordID("io.cozy.files", map[string]string{"b": "$gt", "a": "$eq"}, nil))
+		assert.NotEqual(t, id, recordID("io.cozy.contacts", shape, nil))
+		assert.NotEqual(t, id, recordID("io.cozy.files", shape, []string{"a"}))
+	})
+
+	t.Run("TrackInMemory", func(t *testing.T) {
+		db := prefixer.NewPrefixer(0, "alice.cozy.localhost", "alice-cozy-localhost")
+		req := map[string]interface{}{
+			"selector": map[string]interface{}{"name": map[string]interface{}{"$regex": "^foo"}},
+		}
+		require.NoError(t, Track(db, "io.cozy.files", req))
+		require.NoError(t, Track(db, "io.cozy.files", req))
+		require.NoError(t, Track(db, "io.cozy.contacts", req))
+
+		mu.Lock()
+		defer mu.Unlock()
+		id := recordID("io.cozy.files", map[string]string{"name": "$regex"}, nil)
+		p, ok := pending[pendingKey{prefix: db.DBPrefix(), id: id}]
+		require.True(t, ok)
+		assert.Equal(t, 2, p.record.Count)
+		assert.Len(t, pending, 2)
+		pending = make(map[pendingKey]*pendingRecord)
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		records := []*Record{
+			{Doctype: "io.cozy.files", Count: 2},
+			{Doctype: "io.cozy.contacts", Count: 1},
+			{Doctype: "io.cozy.files", Count: 5},
+		}
+		advices := Aggregate(records)
+		require.Len(t, advices, 2)
+		assert.Equal(t, "io.cozy.files", advices[0].Doctype)
+		assert.Equal(t, 7, advices[0].Count)
+		assert.Equal(t, 5, advices[0].Records[0].Count)
+		assert.Equal(t, "io.cozy.contacts", advices[1].Doctype)
+	})
+}
@@ -31,4 +31,16 @@ var (
 	ErrInvalidSwiftLayout = errors.New("Invalid Swift layout")
 	// ErrDeletionAlreadyRequested is returned when a deletion has already been requested.
 	ErrDeletionAlreadyRequested = errors.New("The deletion has already been requested")
+	// ErrDeletionNotScheduled is returned when trying to restore an instance
+	// that has not been scheduled for deletion.
+	ErrDeletionNotScheduled = errors.New("The instance is not scheduled for deletion")
+	// ErrInvalidAllowedIPs is returned when the allowlist of a maintenance
+	// contains something that is not an IP address or a CIDR range.
+	ErrInvalidAllowedIPs = errors.New("Invalid IP address or CIDR range in the allowlist")
+	// ErrLegalHold is returned when trying to delete some data of an instance
+	// under legal hold.
+	ErrLegalHold = errors.New("The instance is under legal hold: the data can't be deleted")
+	// ErrMissingLegalHoldReason is returned when an instance is put under
+	// legal hold without a reason or an actor.
+	ErrMissingLegalHoldReason = errors.New("The reason and the actor of the legal hold are required")
 )
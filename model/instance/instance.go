@@ -62,9 +62,36 @@ type Instance struct {
 	OnboardingFinished bool  `json:"onboarding_finished,omitempty"` // Whether or not the onboarding is complete.
 	PasswordDefined    *bool `json:"password_defined"`              // 3 possibles states: true, false, and unknown (for legacy reasons)
 
+	// CreatedAt is the date of creation of the instance (it is empty for the
+	// instances created before this field was introduced)
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// DeletionScheduledAt is set when the instance has been scheduled for
+	// deletion: the login is blocked, but the data are kept until this date,
+	// and the instance can be restored until then.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+
+	// Maintenance is set when an operator has put the instance in
+	// maintenance: the routes are closed, except for an allowlist, and the
+	// jobs are paused until the end of the maintenance.
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+
+	// LegalHold is set when an operator has frozen the instance for a legal
+	// investigation: the destructive operations are rejected until the hold
+	// is lifted.
+	LegalHold *LegalHold `json:"legal_hold,omitempty"`
+
 	BytesDiskQuota    int64 `json:"disk_quota,string,omitempty"` // The total size in bytes allowed to the user
 	IndexViewsVersion int   `json:"indexes_version,omitempty"`
 
+	// Versioning overrides the rules of the context for the old versions of
+	// the files
+	Versioning *vfs.VersioningOverride `json:"versioning,omitempty"`
+
+	// AccessLogs is the list of the doctypes for which the user has enabled
+	// the logs of the reads made via the data API
+	AccessLogs []string `json:"access_logs,omitempty"`
+
 	// Swift layout number:
 	// - 0 for layout v1
 	// - 1 for layout v2
@@ -321,6 +348,20 @@ func (i *Instance) SettingsPublicName() (string, error) {
 	return name, nil
 }
 
+// SettingsTimezone returns the timezone defined in the settings of this
+// instance, or an empty string if there is no valid timezone.
+func (i *Instance) SettingsTimezone() string {
+	settings, err := i.SettingsDocument()
+	if err != nil {
+		return ""
+	}
+	tz, _ := settings.M["tz"].(string)
+	if _, err := time.LoadLocation(tz); err != nil {
+		return ""
+	}
+	return tz
+}
+
 // GetFromContexts returns the parameters specific to the instance context
 func (i *Instance) GetFromContexts(contexts map[string]interface{}) (interface{}, bool) {
 	if contexts == nil {
@@ -437,6 +478,23 @@ func (i *Instance) DiskQuota() int64 {
 	return i.BytesDiskQuota
 }
 
+// VersioningPolicy returns the rules for keeping the old versions of the
+// files, from the config of the context and the overrides for this instance.
+func (i *Instance) VersioningPolicy() vfs.VersioningPolicy {
+	return i.Versioning.Apply(vfs.ContextVersioningPolicy(i.ContextName))
+}
+
+// HasAccessLogs returns true if the reads on the given doctype must be
+// recorded in the access logs.
+func (i *Instance) HasAccessLogs(doctype string) bool {
+	for _, typ := range i.AccessLogs {
+		if typ == doctype {
+			return true
+		}
+	}
+	return false
+}
+
 // WithContextualDomain the current instance context with the given hostname.
 func (i *Instance) WithContextualDomain(domain string) *Instance {
 	if i.HasDomain(domain) {
@@ -652,7 +710,7 @@ func (i *Instance) PickKey(audience string) ([]byte, error) {
 	switch audience {
 	case consts.AppAudience, consts.KonnectorAudience:
 		return i.SessionSecret(), nil
-	case consts.RefreshTokenAudience, consts.AccessTokenAudience, consts.ShareAudience:
+	case consts.RefreshTokenAudience, consts.AccessTokenAudience, consts.ShareAudience, consts.DelegatedAudience, consts.UploadAudience:
 		return i.OAuthSecret, nil
 	case consts.CLIAudience:
 		return i.CLISecret, nil
@@ -709,6 +767,24 @@ func (i *Instance) CreateShareCode(subject string) (string, error) {
 	return i.MakeJWT(consts.ShareAudience, subject, scope, sessionID, time.Now())
 }
 
+// CreateDelegatedToken returns a new token for a third party, that gives the
+// permissions of the given permission document.
+func (i *Instance) CreateDelegatedToken(permID string) (string, error) {
+	return i.MakeJWT(consts.DelegatedAudience, permID, "", "", time.Now())
+}
+
+// CreateUploadToken returns a new token for a device, like a scanner, that
+// gives the permissions of the given upload-only permission document.
+func (i *Instance) CreateUploadToken(permID string) (string, error) {
+	return i.MakeJWT(consts.UploadAudience, permID, "", "", time.Now())
+}
+
+// IsDeletionScheduled returns true if the instance has been scheduled for
+// deletion.
+func (i *Instance) IsDeletionScheduled() bool {
+	return i.DeletionScheduledAt != nil
+}
+
 // MovedError is used to return an error when the instance has been moved to a
 // new domain/hoster.
 func (i *Instance) MovedError() *jsonapi.Error {
@@ -5,7 +5,10 @@ import (
 
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -51,4 +54,38 @@ func TestInstance(t *testing.T) {
 		assert.Equal(t, "test-ctx-token.example.com", claims["iss"])
 		assert.Equal(t, "my-app", claims["sub"])
 	})
+	t.Run("MaintenanceAllowIP", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "maintenance.example.com"}
+		assert.False(t, inst.InMaintenance())
+
+		inst.Maintenance = &instance.Maintenance{
+			AllowedIPs: []string{"192.168.0.0/24", "10.0.0.12", "2001:db8::/32"},
+		}
+		assert.True(t, inst.InMaintenance())
+		assert.True(t, inst.Maintenance.CheckAllowedIPs())
+		assert.True(t, inst.Maintenance.AllowIP("192.168.0.42"))
+		assert.True(t, inst.Maintenance.AllowIP("10.0.0.12"))
+		assert.True(t, inst.Maintenance.AllowIP("2001:db8::1"))
+		assert.False(t, inst.Maintenance.AllowIP("10.0.0.13"))
+		assert.False(t, inst.Maintenance.AllowIP("192.168.1.1"))
+		assert.False(t, inst.Maintenance.AllowIP("not-an-ip"))
+
+		invalid := &instance.Maintenance{AllowedIPs: []string{"10.0.0.300"}}
+		assert.False(t, invalid.CheckAllowedIPs())
+		invalid = &instance.Maintenance{AllowedIPs: []string{"10.0.0.0/33"}}
+		assert.False(t, invalid.CheckAllowedIPs())
+	})
+	t.Run("LegalHold", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "legal-hold.example.com"}
+		assert.False(t, inst.UnderLegalHold())
+		assert.NoError(t, couchdb.CheckDeletion(inst, consts.Files))
+
+		inst.LegalHold = &instance.LegalHold{Reason: "Investigation", Actor: "Legal"}
+		assert.True(t, inst.UnderLegalHold())
+		assert.Equal(t, instance.ErrLegalHold, couchdb.CheckDeletion(inst, consts.Files))
+		assert.Equal(t, instance.ErrLegalHold, couchdb.CheckDeletion(inst, consts.Accounts))
+		assert.NoError(t, couchdb.CheckDeletion(couchdb.WithoutDeletionGuards(inst), consts.Files))
+		assert.NoError(t, couchdb.CheckDeletion(inst, consts.Sessions))
+		assert.NoError(t, couchdb.CheckDeletion(prefixer.GlobalPrefixer, consts.Instances))
+	})
 }
@@ -0,0 +1,73 @@
+package instance
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// LegalHold describes the freeze of an instance, put by an operator during a
+// legal investigation: the destructive operations are rejected, but the data
+// can still be read and created.
+type LegalHold struct {
+	// Reason explains why the instance has been put under legal hold
+	Reason string `json:"reason"`
+	// Actor is the person or the organization that has asked for the hold
+	Actor     string    `json:"actor"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// UnderLegalHold returns true if the instance has been put under legal hold.
+func (i *Instance) UnderLegalHold() bool {
+	return i.LegalHold != nil
+}
+
+// legalHoldExemptedDoctypes is the list of the technical doctypes whose
+// documents can still be deleted during a legal hold, as the stack needs to
+// delete them for its normal operations.
+var legalHoldExemptedDoctypes = []string{
+	consts.Sessions,
+	consts.SessionsLogins,
+	consts.Jobs,
+	consts.Triggers,
+	consts.Permissions,
+	consts.OAuthClients,
+	consts.Archives,
+	consts.FilesPreparedArchives,
+	consts.NotesSteps,
+	consts.NotesEvents,
+}
+
+func init() {
+	couchdb.AddDeletionGuard(checkLegalHold)
+}
+
+// checkLegalHold forbids the deletion of the documents of an instance under
+// legal hold.
+func checkLegalHold(db prefixer.Prefixer, doctype string) error {
+	if db.DomainName() == "" {
+		return nil
+	}
+	for _, exempted := range legalHoldExemptedDoctypes {
+		if doctype == exempted {
+			return nil
+		}
+	}
+	inst, ok := db.(*Instance)
+	if !ok {
+		if service == nil {
+			return nil
+		}
+		var err error
+		inst, err = service.Get(db.DomainName())
+		if err != nil {
+			return nil
+		}
+	}
+	if inst.UnderLegalHold() {
+		return ErrLegalHold
+	}
+	return nil
+}
@@ -11,8 +11,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cozy/cozy-stack/model/app"
 	"github.com/cozy/cozy-stack/model/contact"
 	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -136,6 +138,8 @@ func CreateWithoutHooks(opts *Options) (*instance.Instance, error) {
 	i.TOSSigned = opts.TOSSigned
 	i.TOSLatest = opts.TOSLatest
 	i.ContextName = opts.ContextName
+	now := time.Now().UTC()
+	i.CreatedAt = &now
 	i.BytesDiskQuota = opts.DiskQuota
 	i.IndexViewsVersion = couchdb.IndexViewsVersion
 	opts.trace("generate secrets", func() {
@@ -281,9 +285,51 @@ func CreateWithoutHooks(opts *Options) (*instance.Instance, error) {
 		}
 	})
 
+	opts.trace("push warmup job", func() {
+		if err := pushWarmUpJob(i); err != nil {
+			i.Logger().Errorf("Failed to push the warmup job: %s", err)
+		}
+	})
+
+	if _, ok := app.GetProvisioningProfile(i); ok {
+		opts.trace("push provisioning job", func() {
+			if err := pushProvisioningJob(i); err != nil {
+				i.Logger().Errorf("Failed to push the provisioning job: %s", err)
+			}
+		})
+	}
+
 	return i, nil
 }
 
+// pushProvisioningJob pushes a job for the initial provisioning of the apps
+// and konnectors defined by the context of the instance.
+func pushProvisioningJob(inst *instance.Instance) error {
+	msg, err := job.NewMessage(map[string]interface{}{"initial": true})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "provisioning",
+		Message:    msg,
+	})
+	return err
+}
+
+// pushWarmUpJob pushes a job to build the indexes and views of the new
+// instance in background, before the first queries of the user.
+func pushWarmUpJob(inst *instance.Instance) error {
+	msg, err := job.NewMessage(&couchdb.WarmUpMessage{All: true})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "warmup",
+		Message:    msg,
+	})
+	return err
+}
+
 func ChooseCouchCluster(clusters []config.CouchDBCluster) (int, error) {
 	index := -1
 	var count uint32 = 0
@@ -10,6 +10,7 @@ import (
 	"github.com/cozy/cozy-stack/model/app"
 	"github.com/cozy/cozy-stack/model/instance"
 	job "github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -49,13 +50,122 @@ func AskDeletion(inst *instance.Instance) error {
 	return res.Body.Close()
 }
 
+// DestroyWorkerType is the type of the worker that destroys an instance at
+// the end of the grace period.
+const DestroyWorkerType = "destroy-instance"
+
+// ScheduleDestroy is used to ask for the deletion of an instance, with a
+// grace period. During this grace period, the login is blocked, but the data
+// are kept, and the instance can be restored. When the grace period is over,
+// a job will destroy the instance. If no grace period has been configured,
+// the instance is destroyed immediately.
+func ScheduleDestroy(domain string) (*instance.Instance, error) {
+	grace := config.GetConfig().DestroyGracePeriod
+	if grace <= 0 {
+		return nil, Destroy(domain)
+	}
+
+	inst, err := instance.GetFromCouch(domain)
+	if err != nil {
+		return nil, err
+	}
+	if inst.Deleting || inst.IsDeletionScheduled() {
+		return nil, instance.ErrDeletionAlreadyRequested
+	}
+	if inst.UnderLegalHold() {
+		return nil, instance.ErrLegalHold
+	}
+
+	at := time.Now().Add(grace).UTC()
+	inst.DeletionScheduledAt = &at
+	if err := instance.Update(inst); err != nil {
+		return nil, err
+	}
+
+	t, err := job.NewTrigger(inst, job.TriggerInfos{
+		Type:       "@at",
+		WorkerType: DestroyWorkerType,
+		Arguments:  at.Format(time.RFC3339),
+	}, nil)
+	if err == nil {
+		err = job.System().AddTrigger(t)
+	}
+	if err != nil {
+		inst.Logger().WithNamespace("lifecycle").
+			Errorf("Cannot add the trigger for destroying the instance: %s", err)
+		// Without the trigger, nothing would destroy the instance at the end
+		// of the grace period: the deletion request is cancelled, so that it
+		// can be retried.
+		inst.DeletionScheduledAt = nil
+		if erru := instance.Update(inst); erru != nil {
+			inst.Logger().WithNamespace("lifecycle").
+				Errorf("Cannot cancel the deletion request: %s", erru)
+		}
+		return nil, err
+	}
+	return inst, nil
+}
+
+// RestoreScheduledDestroy cancels the deletion of an instance that has been
+// scheduled for deletion.
+func RestoreScheduledDestroy(domain string) (*instance.Instance, error) {
+	inst, err := instance.GetFromCouch(domain)
+	if err != nil {
+		return nil, err
+	}
+	if !inst.IsDeletionScheduled() {
+		return nil, instance.ErrDeletionNotScheduled
+	}
+	inst.DeletionScheduledAt = nil
+	if err := instance.Update(inst); err != nil {
+		return nil, err
+	}
+
+	sched := job.System()
+	triggers, err := sched.GetAllTriggers(inst)
+	if err == nil {
+		for _, t := range triggers {
+			infos := t.Infos()
+			if infos.WorkerType != DestroyWorkerType {
+				continue
+			}
+			if err = sched.DeleteTrigger(inst, infos.TID); err != nil {
+				inst.Logger().WithNamespace("lifecycle").
+					Errorf("Failed to remove trigger: %s", err)
+			}
+		}
+	}
+	return inst, nil
+}
+
+// DestroyIfScheduled destroys the instance if it has been scheduled for
+// deletion and the grace period is over. It is used by the worker that runs
+// at the end of the grace period.
+func DestroyIfScheduled(domain string) error {
+	inst, err := instance.GetFromCouch(domain)
+	if err != nil {
+		return err
+	}
+	if !inst.IsDeletionScheduled() {
+		return instance.ErrDeletionNotScheduled
+	}
+	if time.Now().Before(*inst.DeletionScheduledAt) {
+		return nil
+	}
+	return Destroy(domain)
+}
+
 // Destroy is used to remove the instance. All the data linked to this
-// instance will be permanently deleted.
+// instance will be permanently deleted. An instance under legal hold can't be
+// destroyed.
 func Destroy(domain string) error {
 	domain, err := validateDomain(domain)
 	if err != nil {
 		return err
 	}
+	if inst, err := instance.GetFromCouch(domain); err == nil && inst.UnderLegalHold() {
+		return instance.ErrLegalHold
+	}
 	return hooks.Execute("remove-instance", []string{domain}, func() error {
 		return destroyWithoutHooks(domain)
 	})
@@ -105,6 +215,7 @@ func destroyWithoutHooks(domain string) error {
 		inst.Logger().Errorf("Could not delete VFS: %s", err.Error())
 		return err
 	}
+	vfs.ClearDiskUsage(inst)
 
 	err = instance.Delete(inst)
 	if couchdb.IsConflictError(err) {
@@ -58,9 +58,11 @@ func DefineViewsAndIndex(inst *instance.Instance) error {
 
 // UpdateViewsAndIndex can be used to ensure that the CouchDB views and indexes
 // used by the stack are correctly set. It has the same effect as
-// DefineViewsAndIndex, but it expect most index/views already exist.
+// DefineViewsAndIndex, but it expect most index/views already exist, and only
+// the indexes and views modified since the version of the instance are
+// migrated.
 func UpdateViewsAndIndex(inst *instance.Instance) error {
-	err := couchdb.UpdateIndexesAndViews(inst, couchdb.Indexes, couchdb.Views)
+	err := couchdb.MigrateIndexesAndViews(inst, inst.IndexViewsVersion)
 	if err != nil {
 		return err
 	}
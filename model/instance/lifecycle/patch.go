@@ -10,6 +10,7 @@ import (
 
 	"github.com/cozy/cozy-stack/model/cloudery"
 	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/labstack/echo/v4"
@@ -262,6 +263,82 @@ func Unblock(inst *instance.Instance) error {
 	return update(inst)
 }
 
+// StartMaintenance puts an instance in maintenance: the routes are closed,
+// except for the allowed IP addresses, and the jobs are paused.
+func StartMaintenance(inst *instance.Instance, message string, allowedIPs []string) error {
+	maintenance := &instance.Maintenance{
+		Message:    message,
+		AllowedIPs: allowedIPs,
+		StartedAt:  time.Now().UTC(),
+	}
+	if !maintenance.CheckAllowedIPs() {
+		return instance.ErrInvalidAllowedIPs
+	}
+	if inst.Maintenance != nil {
+		maintenance.StartedAt = inst.Maintenance.StartedAt
+	}
+	inst.Maintenance = maintenance
+	return update(inst)
+}
+
+// EndMaintenance ends the maintenance of an instance, and resumes the jobs
+// that have been paused during the maintenance.
+func EndMaintenance(inst *instance.Instance) error {
+	if inst.Maintenance == nil {
+		return nil
+	}
+	inst.Maintenance = nil
+	if err := update(inst); err != nil {
+		return err
+	}
+	resumed, err := job.ResumePausedJobs(inst)
+	if err != nil {
+		inst.Logger().WithNamespace("lifecycle").
+			Errorf("Cannot resume the paused jobs: %s", err)
+		return err
+	}
+	inst.Logger().WithNamespace("lifecycle").
+		Infof("End of maintenance: %d jobs resumed", resumed)
+	return nil
+}
+
+// StartLegalHold puts an instance under legal hold: the destructive
+// operations, like destroying a file or revoking a sharing, are rejected until
+// the hold is lifted.
+func StartLegalHold(inst *instance.Instance, reason, actor string) error {
+	if reason == "" || actor == "" {
+		return instance.ErrMissingLegalHoldReason
+	}
+	hold := &instance.LegalHold{
+		Reason:    reason,
+		Actor:     actor,
+		StartedAt: time.Now().UTC(),
+	}
+	if inst.LegalHold != nil {
+		hold.StartedAt = inst.LegalHold.StartedAt
+	}
+	inst.LegalHold = hold
+	if err := update(inst); err != nil {
+		return err
+	}
+	inst.Logger().WithNamespace("lifecycle").
+		Infof("Start of legal hold by %q: %s", actor, reason)
+	return nil
+}
+
+// EndLegalHold lifts the legal hold of an instance.
+func EndLegalHold(inst *instance.Instance) error {
+	if inst.LegalHold == nil {
+		return nil
+	}
+	inst.LegalHold = nil
+	if err := update(inst); err != nil {
+		return err
+	}
+	inst.Logger().WithNamespace("lifecycle").Infof("End of legal hold")
+	return nil
+}
+
 // ManagerSignTOS make a request to the manager in order to finalize the TOS
 // signing flow.
 func ManagerSignTOS(inst *instance.Instance, originalReq *http.Request) error {
@@ -0,0 +1,57 @@
+package instance
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// Maintenance describes the maintenance of an instance, started by an
+// operator.
+type Maintenance struct {
+	// Message is displayed to the user on the maintenance page
+	Message string `json:"message,omitempty"`
+	// AllowedIPs is a list of IP addresses or CIDR ranges that can still
+	// access the instance during the maintenance
+	AllowedIPs []string  `json:"allowed_ips,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// InMaintenance returns true if the instance has been put in maintenance.
+func (i *Instance) InMaintenance() bool {
+	return i.Maintenance != nil
+}
+
+// AllowIP returns true if the given IP address is in the allowlist of the
+// maintenance.
+func (m *Maintenance) AllowIP(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range m.AllowedIPs {
+		if strings.Contains(allowed, "/") {
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if other := net.ParseIP(allowed); other != nil && other.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAllowedIPs returns false if one of the items of the allowlist is not
+// a valid IP address or CIDR range.
+func (m *Maintenance) CheckAllowedIPs() bool {
+	for _, allowed := range m.AllowedIPs {
+		if strings.Contains(allowed, "/") {
+			if _, _, err := net.ParseCIDR(allowed); err != nil {
+				return false
+			}
+		} else if net.ParseIP(allowed) == nil {
+			return false
+		}
+	}
+	return true
+}
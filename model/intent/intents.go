@@ -41,6 +41,10 @@ type Intent struct {
 	Client        string         `json:"client"`
 	Services      []Service      `json:"services"`
 	AvailableApps []AvailableApp `json:"availableApps"`
+	// The fields below are used when the intent is relayed by the stack
+	Handler string          `json:"handler,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Status  string          `json:"status,omitempty"`
 }
 
 // ID is used to implement the couchdb.Doc interface
@@ -61,6 +65,9 @@ func (in *Intent) Clone() couchdb.Doc {
 	copy(cloned.Services, in.Services)
 	cloned.AvailableApps = make([]AvailableApp, len(in.AvailableApps))
 	copy(cloned.AvailableApps, in.AvailableApps)
+	if in.Payload != nil {
+		cloned.Payload = append(json.RawMessage{}, in.Payload...)
+	}
 	return &cloned
 }
 
@@ -0,0 +1,163 @@
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+)
+
+// The statuses of an intent relayed by the stack
+const (
+	// StatusPending is used when the payload has been sent by the client and
+	// the handler has not finished to respond.
+	StatusPending = "pending"
+	// StatusDone is used when the handler has sent its last response.
+	StatusDone = "done"
+	// StatusAborted is used when the client has stopped waiting for the
+	// responses of the handler.
+	StatusAborted = "aborted"
+)
+
+var (
+	// ErrServiceNotFound is used when the service asked by the client cannot
+	// handle the intent.
+	ErrServiceNotFound = errors.New("No service found for this intent")
+	// ErrAlreadyRelayed is used when the client tries to send a payload for an
+	// intent that has already been relayed.
+	ErrAlreadyRelayed = errors.New("The intent has already been relayed")
+	// ErrNotPending is used when the handler responds to an intent that is not
+	// waiting for a response.
+	ErrNotPending = errors.New("The intent is not waiting for a response")
+)
+
+// Response is a message sent by the handler of an intent to the client. The
+// handler can send several responses, the last one with done set to true.
+type Response struct {
+	IntentID string          `json:"intent_id"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Done     bool            `json:"done"`
+}
+
+// ID is used to implement the realtime.Doc interface
+func (r *Response) ID() string { return r.IntentID }
+
+// DocType is used to implement the realtime.Doc interface
+func (r *Response) DocType() string { return consts.Intents }
+
+// FindService returns the service with the given slug. If the slug is empty
+// and there is only one service for this intent, this service is returned.
+func (in *Intent) FindService(slug string) (*Service, error) {
+	if slug == "" {
+		if len(in.Services) != 1 {
+			return nil, ErrServiceNotFound
+		}
+		return &in.Services[0], nil
+	}
+	for i := range in.Services {
+		if in.Services[i].Slug == slug {
+			return &in.Services[i], nil
+		}
+	}
+	return nil, ErrServiceNotFound
+}
+
+// Relay saves the payload sent by the client for the given service. The
+// handler can then read it and respond with Respond.
+func (in *Intent) Relay(inst *instance.Instance, slug string, payload json.RawMessage) error {
+	if in.Status != "" {
+		return ErrAlreadyRelayed
+	}
+	service, err := in.FindService(slug)
+	if err != nil {
+		return err
+	}
+	in.Handler = service.Slug
+	in.Payload = payload
+	in.Status = StatusPending
+	return in.Save(inst)
+}
+
+// Respond sends a response of the handler to the client that is waiting for
+// it. When done is true, the intent is marked as done and the handler cannot
+// respond again.
+func (in *Intent) Respond(inst *instance.Instance, res *Response) error {
+	if in.Status != StatusPending {
+		return ErrNotPending
+	}
+	res.IntentID = in.ID()
+	if res.Done {
+		in.Status = StatusDone
+		if err := in.Save(inst); err != nil {
+			return err
+		}
+	}
+	realtime.GetHub().Publish(inst, realtime.EventNotify, res, nil)
+	return nil
+}
+
+// Abort marks a pending intent as aborted, when the client is no longer
+// waiting for the responses.
+func Abort(inst *instance.Instance, intentID string) error {
+	in := &Intent{}
+	if err := couchdb.GetDoc(inst, consts.Intents, intentID, in); err != nil {
+		return err
+	}
+	if in.Status != StatusPending {
+		return nil
+	}
+	in.Status = StatusAborted
+	return in.Save(inst)
+}
+
+// Listener receives the responses sent by the handler of an intent.
+type Listener struct {
+	sub *realtime.Subscriber
+}
+
+// Listen starts listening for the responses to the given intent. It must be
+// called before the payload is relayed, to not miss a response.
+func Listen(db prefixer.Prefixer, intentID string) *Listener {
+	sub := realtime.GetHub().Subscriber(db)
+	sub.Watch(consts.Intents, intentID)
+	return &Listener{sub: sub}
+}
+
+// Next waits for the next response of the handler, or until the context is
+// done.
+func (l *Listener) Next(ctx context.Context) (*Response, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case e, ok := <-l.sub.Channel:
+			if !ok {
+				return nil, context.Canceled
+			}
+			if e.Verb != realtime.EventNotify {
+				continue
+			}
+			// With redis, the event is received as a JSONDoc
+			buf, err := json.Marshal(e.Doc)
+			if err != nil {
+				return nil, err
+			}
+			var res Response
+			if err := json.Unmarshal(buf, &res); err != nil {
+				return nil, err
+			}
+			return &res, nil
+		}
+	}
+}
+
+// Close stops listening for the responses.
+func (l *Listener) Close() {
+	l.sub.Close()
+}
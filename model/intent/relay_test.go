@@ -0,0 +1,63 @@
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelay(t *testing.T) {
+	config.UseTestFile(t)
+	ins := &instance.Instance{Domain: "cozy.example.net"}
+
+	t.Run("FindService", func(t *testing.T) {
+		in := &Intent{Services: []Service{{Slug: "drive"}}}
+		service, err := in.FindService("")
+		require.NoError(t, err)
+		assert.Equal(t, "drive", service.Slug)
+		_, err = in.FindService("photos")
+		assert.Equal(t, ErrServiceNotFound, err)
+
+		in.Services = append(in.Services, Service{Slug: "photos"})
+		_, err = in.FindService("")
+		assert.Equal(t, ErrServiceNotFound, err)
+		service, err = in.FindService("photos")
+		require.NoError(t, err)
+		assert.Equal(t, "photos", service.Slug)
+	})
+
+	t.Run("Respond", func(t *testing.T) {
+		in := &Intent{IID: "relay-intent", Status: StatusDone}
+		assert.Equal(t, ErrNotPending, in.Respond(ins, &Response{}))
+	})
+
+	t.Run("Listener", func(t *testing.T) {
+		listener := Listen(ins, "relay-intent")
+		defer listener.Close()
+
+		other := &Response{IntentID: "other-intent", Data: json.RawMessage(`"ignored"`)}
+		realtime.GetHub().Publish(ins, realtime.EventNotify, other, nil)
+		sent := &Response{IntentID: "relay-intent", Data: json.RawMessage(`{"id":"123"}`)}
+		realtime.GetHub().Publish(ins, realtime.EventNotify, sent, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		res, err := listener.Next(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "relay-intent", res.IntentID)
+		assert.JSONEq(t, `{"id":"123"}`, string(res.Data))
+		assert.False(t, res.Done)
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = listener.Next(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
@@ -0,0 +1,80 @@
+package job
+
+import (
+	"time"
+)
+
+// WorkerStats contains the metrics of a worker type that can be used by an
+// autoscaler: the length and age of the queue, shared by all the stack
+// processes, and the jobs running on this process.
+type WorkerStats struct {
+	WorkerType string `json:"worker_type"`
+	// QueueLen is the number of jobs waiting in the queue.
+	QueueLen int `json:"queue_len"`
+	// QueueAge is the number of seconds since the oldest job of the queue
+	// has been queued, or 0 if the queue is empty.
+	QueueAge float64 `json:"queue_age"`
+	// InFlight is the number of jobs running on this process.
+	InFlight int `json:"in_flight"`
+	// Concurrency is the maximal number of jobs running at the same time on
+	// this process.
+	Concurrency int `json:"concurrency"`
+	// Draining is true when this process doesn't take new jobs.
+	Draining bool `json:"draining"`
+}
+
+// drainPollDelay is the delay between two checks of the drain mode by a
+// worker that doesn't take new jobs.
+var drainPollDelay = time.Second
+
+// selectWorkers returns the workers with the given types, or all the workers
+// if no type is given.
+func selectWorkers(workers []*Worker, workerTypes []string) ([]*Worker, error) {
+	if len(workerTypes) == 0 {
+		return workers, nil
+	}
+	selected := make([]*Worker, 0, len(workerTypes))
+	for _, workerType := range workerTypes {
+		var found *Worker
+		for _, w := range workers {
+			if w.Type == workerType {
+				found = w
+				break
+			}
+		}
+		if found == nil {
+			return nil, ErrUnknownWorker
+		}
+		selected = append(selected, found)
+	}
+	return selected, nil
+}
+
+func drainWorkers(workers []*Worker, workerTypes []string, draining bool) ([]*Worker, error) {
+	selected, err := selectWorkers(workers, workerTypes)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range selected {
+		if draining {
+			w.Drain()
+		} else {
+			w.Resume()
+		}
+	}
+	return selected, nil
+}
+
+func newWorkerStats(w *Worker, queueLen int, oldest time.Time) *WorkerStats {
+	stats := &WorkerStats{
+		WorkerType:  w.Type,
+		QueueLen:    queueLen,
+		InFlight:    w.InFlight(),
+		Concurrency: w.Conf.Concurrency,
+		Draining:    w.Draining(),
+	}
+	if queueLen > 0 && !oldest.IsZero() {
+		stats.QueueAge = time.Since(oldest).Seconds()
+	}
+	return stats
+}
@@ -0,0 +1,80 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoscaling(t *testing.T) {
+	t.Run("DrainWorkers", func(t *testing.T) {
+		thumb := NewWorker(&WorkerConfig{WorkerType: "thumbnail", Concurrency: 2})
+		mail := NewWorker(&WorkerConfig{WorkerType: "sendmail", Concurrency: 1})
+		workers := []*Worker{thumb, mail}
+
+		drained, err := drainWorkers(workers, []string{"sendmail"}, true)
+		require.NoError(t, err)
+		assert.Len(t, drained, 1)
+		assert.False(t, thumb.Draining())
+		assert.True(t, mail.Draining())
+
+		_, err = drainWorkers(workers, nil, true)
+		require.NoError(t, err)
+		assert.True(t, thumb.Draining())
+
+		_, err = drainWorkers(workers, nil, false)
+		require.NoError(t, err)
+		assert.False(t, thumb.Draining())
+		assert.False(t, mail.Draining())
+
+		_, err = drainWorkers(workers, []string{"unknown"}, true)
+		assert.Equal(t, ErrUnknownWorker, err)
+	})
+
+	t.Run("MemQueueDraining", func(t *testing.T) {
+		q := newMemQueue("thumbnail")
+		q.setDraining(true)
+		queuedAt := time.Now().Add(-time.Minute)
+		require.NoError(t, q.Enqueue(&Job{JobID: "foo", QueuedAt: queuedAt}))
+
+		select {
+		case <-q.Jobs:
+			t.Fatal("the job should not be sent while draining")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.Equal(t, 1, q.Len())
+		assert.True(t, q.Oldest().Equal(queuedAt))
+
+		q.setDraining(false)
+		select {
+		case job := <-q.Jobs:
+			assert.Equal(t, "foo", job.ID())
+		case <-time.After(time.Second):
+			t.Fatal("the job should be sent after the end of the drain mode")
+		}
+	})
+
+	t.Run("WorkerStats", func(t *testing.T) {
+		w := NewWorker(&WorkerConfig{WorkerType: "thumbnail", Concurrency: 4})
+		w.trackJob(&Job{JobID: "foo"})
+		w.trackJob(&Job{JobID: "bar"})
+		w.untrackJob(&Job{JobID: "foo"})
+
+		stats := newWorkerStats(w, 3, time.Now().Add(-10*time.Second))
+		assert.Equal(t, "thumbnail", stats.WorkerType)
+		assert.Equal(t, 3, stats.QueueLen)
+		assert.InDelta(t, 10, stats.QueueAge, 1)
+		assert.Equal(t, 1, stats.InFlight)
+		assert.Equal(t, 4, stats.Concurrency)
+
+		stats = newWorkerStats(w, 0, time.Time{})
+		assert.Zero(t, stats.QueueAge)
+
+		jobs := w.takeInFlightJobs()
+		require.Len(t, jobs, 1)
+		assert.Equal(t, "bar", jobs[0].ID())
+		assert.Equal(t, 0, w.InFlight())
+	})
+}
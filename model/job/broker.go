@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
@@ -26,6 +27,9 @@ const (
 	Done State = "done"
 	// Errored state
 	Errored State = "errored"
+	// Paused state, for the jobs consumed while their instance was in
+	// maintenance
+	Paused State = "paused"
 )
 
 // defaultMaxLimits defines the maximum limit of how much jobs will be returned
@@ -35,6 +39,7 @@ var defaultMaxLimits map[State]int = map[State]int{
 	Running: 50,
 	Done:    50,
 	Errored: 50,
+	Paused:  50,
 }
 
 type (
@@ -55,11 +60,25 @@ type (
 		// WorkerQueueLen returns the total element in the queue of the specified
 		// worker type.
 		WorkerQueueLen(workerType string) (int, error)
+		// WorkerInFlight returns the number of jobs of the specified worker
+		// type that are currently running for the given instance.
+		WorkerInFlight(db prefixer.Prefixer, workerType string) (int, error)
 		// WorkerIsReserved returns true if the given worker type is reserved
 		// (ie clients should not push jobs to it, only the stack).
 		WorkerIsReserved(workerType string) (bool, error)
 		// WorkersTypes returns the list of registered workers types.
 		WorkersTypes() []string
+
+		// DrainWorkers puts the workers of the given types (or all the workers
+		// if no type is given) of this process in drain mode: they finish
+		// their running jobs, but don't take new ones.
+		DrainWorkers(workerTypes ...string) error
+		// ResumeWorkers ends the drain mode for the workers of the given
+		// types (or all the workers if no type is given).
+		ResumeWorkers(workerTypes ...string) error
+		// WorkersStats returns the metrics of the workers running on this
+		// process, like the length and age of their queues.
+		WorkersStats() ([]*WorkerStats, error)
 	}
 
 	// State represent the state of a job.
@@ -96,6 +115,8 @@ type (
 		FinishedAt  time.Time   `json:"finished_at"`
 		Error       string      `json:"error,omitempty"`
 		ForwardLogs bool        `json:"forward_logs,omitempty"`
+		DedupKey    string      `json:"dedup_key,omitempty"`
+		Retry       *JobRetry   `json:"retry,omitempty"`
 	}
 
 	// JobRequest struct is used to represent a new job request.
@@ -110,12 +131,19 @@ type (
 		Debounced   bool
 		ForwardLogs bool
 		Options     *JobOptions
+		// DedupKey is used to coalesce the jobs: when a job with the same key
+		// has been pushed for the instance during the coalescing window, and
+		// is still queued, this job is returned instead of a new one. The
+		// message, event and payload of the coalesced request are dropped:
+		// the worker must not depend on them, but fetch the current state.
+		DedupKey string
 	}
 
 	// JobOptions struct contains the execution properties of the jobs.
 	JobOptions struct {
 		MaxExecCount int           `json:"max_exec_count"`
 		Timeout      time.Duration `json:"timeout"`
+		Retry        *RetryOptions `json:"retry,omitempty"`
 	}
 )
 
@@ -243,6 +271,14 @@ func (j *Job) Nack(errorMessage string) error {
 	return j.Update()
 }
 
+// Pause sets the job infos state to Paused. The job will be pushed again at
+// the end of the maintenance of its instance.
+func (j *Job) Pause() error {
+	j.Logger().Debugf("pause %s", j.ID())
+	j.State = Paused
+	return j.Update()
+}
+
 // Update updates the job in couchdb
 func (j *Job) Update() error {
 	err := couchdb.UpdateDoc(j, j)
@@ -258,6 +294,9 @@ func (j *Job) Update() error {
 
 // Create creates the job in couchdb
 func (j *Job) Create() error {
+	if j.JobID != "" {
+		return couchdb.CreateNamedDocWithDB(j, j)
+	}
 	return couchdb.CreateDoc(j, j)
 }
 
@@ -338,11 +377,48 @@ func NewJob(db prefixer.Prefixer, req *JobRequest) *Job {
 		Payload:     req.Payload,
 		Options:     req.Options,
 		ForwardLogs: req.ForwardLogs,
+		DedupKey:    req.DedupKey,
 		State:       Queued,
 		QueuedAt:    time.Now(),
 	}
 }
 
+// coalescingWindow returns the duration during which the jobs with the same
+// dedup key are coalesced, or 0 if they must not be coalesced.
+func coalescingWindow(req *JobRequest) time.Duration {
+	if req.DedupKey == "" || req.Manual {
+		return 0
+	}
+	return config.GetConfig().Jobs.CoalescingWindow
+}
+
+// coalescedJob returns the job with the given ID if it is still waiting in the
+// queue, or nil if it has already started. A job that is not found is being
+// created by a concurrent push with the same dedup key, and a job with this ID
+// is returned for it.
+func coalescedJob(db prefixer.Prefixer, req *JobRequest, jobID string) *Job {
+	job, err := Get(db, jobID)
+	if errors.Is(err, ErrNotFoundJob) {
+		job = NewJob(db, req)
+		job.JobID = jobID
+		return job
+	}
+	if err != nil || job.State != Queued {
+		return nil
+	}
+	return job
+}
+
+// queuedJob returns the job with the given ID if it is still waiting in the
+// queue, or nil.
+func queuedJob(db prefixer.Prefixer, jobID string) *Job {
+	job, err := Get(db, jobID)
+	if err != nil || job.State != Queued {
+		return nil
+	}
+	return job
+}
+
 // Get returns the informations about a job.
 func Get(db prefixer.Prefixer, jobID string) (*Job, error) {
 	var job Job
@@ -377,6 +453,61 @@ func GetQueuedJobs(db prefixer.Prefixer, workerType string) ([]*Job, error) {
 	return results, nil
 }
 
+// ResumePausedJobs pushes again the jobs that have been paused during the
+// maintenance of the instance, and returns the number of resumed jobs. Only
+// one job is resumed for each trigger, as the paused jobs of a trigger are
+// just several occurrences of the same work.
+func ResumePausedJobs(db prefixer.Prefixer) (int, error) {
+	resumed := 0
+	triggers := make(map[string]bool)
+	for {
+		var jobs []*Job
+		req := &couchdb.FindRequest{
+			UseIndex: "by-worker-and-state",
+			Selector: mango.And(
+				mango.Exists("worker"), // XXX it is needed by couchdb to use the index
+				mango.Equal("state", Paused),
+			),
+			Limit: 200,
+		}
+		if err := couchdb.FindDocs(db, consts.Jobs, req, &jobs); err != nil {
+			if couchdb.IsNoDatabaseError(err) {
+				return resumed, nil
+			}
+			return resumed, err
+		}
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].QueuedAt.Before(jobs[j].QueuedAt) })
+
+		for _, j := range jobs {
+			if j.TriggerID == "" || !triggers[j.TriggerID] {
+				req := &JobRequest{
+					WorkerType:  j.WorkerType,
+					TriggerID:   j.TriggerID,
+					Message:     j.Message,
+					Event:       j.Event,
+					Payload:     j.Payload,
+					Manual:      j.Manual,
+					Debounced:   j.Debounced,
+					ForwardLogs: j.ForwardLogs,
+					Options:     j.Options,
+				}
+				if _, err := System().PushJob(db, req); err != nil {
+					return resumed, err
+				}
+				triggers[j.TriggerID] = true
+				resumed++
+			}
+			if err := couchdb.DeleteDoc(db, j); err != nil {
+				return resumed, err
+			}
+		}
+
+		if len(jobs) < req.Limit {
+			return resumed, nil
+		}
+	}
+}
+
 // GetAllJobs returns the list of all the jobs on the given instance.
 func GetAllJobs(db prefixer.Prefixer) ([]*Job, error) {
 	var startkey string
@@ -456,7 +587,7 @@ func GetLastsJobs(jobs []*Job, workerType string) ([]*Job, error) {
 	// Ordering by QueuedAt before filtering jobs
 	sort.Slice(jobs, func(i, j int) bool { return jobs[i].QueuedAt.Before(jobs[j].QueuedAt) })
 
-	for _, state := range []State{Queued, Running, Done, Errored} {
+	for _, state := range []State{Queued, Running, Done, Errored, Paused} {
 		limit := defaultMaxLimits[state]
 
 		filtered := FilterByWorkerAndState(jobs, workerType, state, limit)
@@ -50,6 +50,13 @@ func (m *BrokerMock) WorkerQueueLen(workerType string) (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+// WorkerInFlight mock method.
+func (m *BrokerMock) WorkerInFlight(db prefixer.Prefixer, workerType string) (int, error) {
+	args := m.Called(db, workerType)
+
+	return args.Int(0), args.Error(1)
+}
+
 // WorkerIsReserved mock method.
 func (m *BrokerMock) WorkerIsReserved(workerType string) (bool, error) {
 	args := m.Called(workerType)
@@ -67,3 +74,24 @@ func (m *BrokerMock) WorkersTypes() []string {
 
 	return args.Get(0).([]string)
 }
+
+// DrainWorkers mock method.
+func (m *BrokerMock) DrainWorkers(workerTypes ...string) error {
+	return m.Called(workerTypes).Error(0)
+}
+
+// ResumeWorkers mock method.
+func (m *BrokerMock) ResumeWorkers(workerTypes ...string) error {
+	return m.Called(workerTypes).Error(0)
+}
+
+// WorkersStats mock method.
+func (m *BrokerMock) WorkersStats() ([]*WorkerStats, error) {
+	args := m.Called()
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*WorkerStats), args.Error(1)
+}
@@ -0,0 +1,133 @@
+package job
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// requeueDelay is the delay before a job that cannot be run, because its
+// instance has reached its limit of concurrent jobs, is put back in the
+// queue. It avoids the workers spinning on the queue when it contains only
+// such jobs.
+var requeueDelay = 10 * time.Second
+
+// concurrencyLimiter is implemented by the brokers to limit the number of jobs
+// of a worker type that can run at the same time for an instance. When the
+// limit is reached, the job is put back in the queue instead of being
+// rejected.
+type concurrencyLimiter interface {
+	// acquire takes a slot for the given holder (a job) and worker type, and
+	// returns false if the limit has already been reached.
+	acquire(db prefixer.Prefixer, workerType, holder string, limit int) (bool, error)
+	// release gives back the slot taken by acquire for this holder.
+	release(db prefixer.Prefixer, workerType, holder string) error
+	// inFlight returns the number of slots currently taken.
+	inFlight(db prefixer.Prefixer, workerType string) (int, error)
+	// requeue puts the job back at the end of its queue after the given
+	// delay.
+	requeue(job *Job, delay time.Duration) error
+}
+
+// concurrencyLimit returns the maximal number of jobs of the given worker type
+// that can run at the same time for the instance, or 0 if there is no limit.
+// Only the konnectors are limited, with a default from the configuration that
+// can be overridden in the context with konnectors_max_concurrent.
+func concurrencyLimit(inst *instance.Instance, workerType string) int {
+	if inst == nil || workerType != "konnector" {
+		return 0
+	}
+	limit := config.GetConfig().Konnectors.MaxConcurrentPerInstance
+	if ctxSettings, ok := inst.SettingsContext(); ok {
+		switch l := ctxSettings["konnectors_max_concurrent"].(type) {
+		case int:
+			limit = l
+		case float64:
+			limit = int(l)
+		case string:
+			if n, err := strconv.Atoi(l); err == nil {
+				limit = n
+			}
+		}
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// memConcurrency is the in-memory implementation of the concurrencyLimiter,
+// used by the in-memory broker.
+type memConcurrency struct {
+	mu      sync.Mutex
+	running map[string]map[string]struct{}
+	queues  map[string]*memQueue
+}
+
+func newMemConcurrency(queues map[string]*memQueue) *memConcurrency {
+	return &memConcurrency{
+		running: make(map[string]map[string]struct{}),
+		queues:  queues,
+	}
+}
+
+func concurrencyKey(db prefixer.Prefixer, workerType string) string {
+	return workerType + "/" + db.DBPrefix()
+}
+
+func (m *memConcurrency) acquire(db prefixer.Prefixer, workerType, holder string, limit int) (bool, error) {
+	key := concurrencyKey(db, workerType)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	holders := m.running[key]
+	if _, ok := holders[holder]; ok {
+		return true, nil
+	}
+	if len(holders) >= limit {
+		return false, nil
+	}
+	if holders == nil {
+		holders = make(map[string]struct{})
+		m.running[key] = holders
+	}
+	holders[holder] = struct{}{}
+	return true, nil
+}
+
+func (m *memConcurrency) release(db prefixer.Prefixer, workerType, holder string) error {
+	key := concurrencyKey(db, workerType)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.running[key], holder)
+	if len(m.running[key]) == 0 {
+		delete(m.running, key)
+	}
+	return nil
+}
+
+func (m *memConcurrency) inFlight(db prefixer.Prefixer, workerType string) (int, error) {
+	key := concurrencyKey(db, workerType)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.running[key]), nil
+}
+
+func (m *memConcurrency) requeue(job *Job, delay time.Duration) error {
+	q, ok := m.queues[job.WorkerType]
+	if !ok {
+		return ErrUnknownWorker
+	}
+	if delay <= 0 {
+		return q.Enqueue(job)
+	}
+	time.AfterFunc(delay, func() {
+		if err := q.Enqueue(job); err != nil {
+			joblog.Errorf("Cannot requeue job %s for %s: %s", job.ID(), job.Domain, err)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,88 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrency(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("Limit", func(t *testing.T) {
+		cfg := config.GetConfig()
+		previous := cfg.Konnectors.MaxConcurrentPerInstance
+		cfg.Konnectors.MaxConcurrentPerInstance = 3
+		cfg.Contexts = map[string]interface{}{
+			"beta": map[string]interface{}{"konnectors_max_concurrent": 5},
+		}
+		defer func() {
+			cfg.Konnectors.MaxConcurrentPerInstance = previous
+			cfg.Contexts = nil
+		}()
+
+		inst := &instance.Instance{Domain: "alice.cozy.example"}
+		assert.Equal(t, 3, concurrencyLimit(inst, "konnector"))
+		assert.Equal(t, 0, concurrencyLimit(inst, "service"))
+		assert.Equal(t, 0, concurrencyLimit(nil, "konnector"))
+
+		inst.ContextName = "beta"
+		assert.Equal(t, 5, concurrencyLimit(inst, "konnector"))
+	})
+
+	t.Run("MemLimiter", func(t *testing.T) {
+		q := newMemQueue("konnector")
+		m := newMemConcurrency(map[string]*memQueue{"konnector": q})
+		alice := prefixer.NewPrefixer(0, "alice.cozy.example", "alice")
+		bob := prefixer.NewPrefixer(0, "bob.cozy.example", "bob")
+
+		for _, holder := range []string{"j1", "j2"} {
+			ok, err := m.acquire(alice, "konnector", holder, 2)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		}
+		ok, err := m.acquire(alice, "konnector", "j3", 2)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		// A holder can take its slot again
+		ok, err = m.acquire(alice, "konnector", "j1", 2)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = m.acquire(bob, "konnector", "j4", 2)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		n, err := m.inFlight(alice, "konnector")
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		require.NoError(t, m.release(alice, "konnector", "j1"))
+		// Releasing twice doesn't free another slot
+		require.NoError(t, m.release(alice, "konnector", "j1"))
+		n, err = m.inFlight(alice, "konnector")
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		ok, err = m.acquire(alice, "konnector", "j3", 2)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		j := &Job{JobID: "123", WorkerType: "konnector", Domain: "alice.cozy.example"}
+		require.NoError(t, m.requeue(j, 10*time.Millisecond))
+		select {
+		case <-q.Jobs:
+			t.Fatal("the job should be requeued after the delay")
+		default:
+		}
+		requeued := <-q.Jobs
+		assert.Equal(t, "123", requeued.JobID)
+
+		err = m.requeue(&Job{JobID: "456", WorkerType: "unknown"}, 0)
+		assert.ErrorIs(t, err, ErrUnknownWorker)
+	})
+}
@@ -23,6 +23,9 @@ var (
 	// ErrAbort can be used to abort the execution of the job without causing
 	// errors.
 	ErrAbort = errors.New("jobs: abort")
+	// ErrDeletionScheduled is used for the jobs that are not executed, as
+	// their instance is scheduled for deletion.
+	ErrDeletionScheduled = errors.New("jobs: the instance is scheduled for deletion")
 
 	// ErrUnknownTrigger is used when the trigger type is not recognized
 	ErrUnknownTrigger = errors.New("Unknown trigger type")
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/limits"
@@ -22,9 +23,10 @@ type (
 		Jobs        chan *Job
 		closed      chan struct{}
 
-		list *list.List
-		run  bool
-		jmu  sync.RWMutex
+		list     *list.List
+		run      bool
+		draining bool
+		jmu      sync.RWMutex
 	}
 
 	// memBroker is an in-memory broker implementation of the Broker interface.
@@ -33,6 +35,20 @@ type (
 		workers      []*Worker
 		workersTypes []string
 		running      uint32
+
+		// dedup keeps the last job pushed for a dedup key, with the
+		// deadline of its coalescing window
+		dedup   map[string]memDedup
+		dedupMu sync.Mutex
+
+		// concurrency limits the number of jobs running at the same time
+		// for an instance
+		concurrency *memConcurrency
+	}
+
+	memDedup struct {
+		jobID    string
+		deadline time.Time
 	}
 )
 
@@ -50,7 +66,7 @@ func (q *memQueue) Enqueue(job *Job) error {
 	q.jmu.Lock()
 	defer q.jmu.Unlock()
 	q.list.PushBack(job.Clone())
-	if !q.run {
+	if !q.run && !q.draining {
 		q.run = true
 		go q.send()
 	}
@@ -61,7 +77,7 @@ func (q *memQueue) send() {
 	for {
 		q.jmu.Lock()
 		e := q.list.Front()
-		if e == nil || !q.run {
+		if e == nil || !q.run || q.draining {
 			q.run = false
 			q.jmu.Unlock()
 			return
@@ -93,13 +109,38 @@ func (q *memQueue) Len() int {
 	return q.list.Len()
 }
 
+// Oldest returns the date when the first job of the queue has been queued.
+func (q *memQueue) Oldest() time.Time {
+	q.jmu.RLock()
+	defer q.jmu.RUnlock()
+	if e := q.list.Front(); e != nil {
+		return e.Value.(*Job).QueuedAt
+	}
+	return time.Time{}
+}
+
+// setDraining stops sending the jobs to the workers when draining is true,
+// and restarts it when draining is false.
+func (q *memQueue) setDraining(draining bool) {
+	q.jmu.Lock()
+	defer q.jmu.Unlock()
+	q.draining = draining
+	if !draining && !q.run && q.list.Len() > 0 {
+		q.run = true
+		go q.send()
+	}
+}
+
 // NewMemBroker creates a new in-memory broker system.
 //
 // The in-memory implementation of the job system has the specifity that
 // workers are actually launched by the broker at its creation.
 func NewMemBroker() Broker {
+	queues := make(map[string]*memQueue)
 	return &memBroker{
-		queues: make(map[string]*memQueue),
+		queues:      queues,
+		dedup:       make(map[string]memDedup),
+		concurrency: newMemConcurrency(queues),
 	}
 }
 
@@ -117,6 +158,7 @@ func (b *memBroker) StartWorkers(ws WorkersList) error {
 		w := NewWorker(conf)
 		b.queues[conf.WorkerType] = q
 		b.workers = append(b.workers, w)
+		w.limiter = b.concurrency
 		if err := w.Start(q.Jobs); err != nil {
 			return err
 		}
@@ -188,6 +230,21 @@ func (b *memBroker) PushJob(db prefixer.Prefixer, req *JobRequest) (*Job, error)
 		return nil, ErrUnknownWorker
 	}
 
+	window := coalescingWindow(req)
+	dedupKey := db.DBPrefix() + "/" + req.DedupKey
+	if window > 0 {
+		// The lock is kept until the job is queued, so that two concurrent
+		// pushes can't both create a job for the same dedup key.
+		b.dedupMu.Lock()
+		defer b.dedupMu.Unlock()
+		entry, ok := b.dedup[dedupKey]
+		if ok && time.Now().Before(entry.deadline) {
+			if job := queuedJob(db, entry.jobID); job != nil {
+				return job, nil
+			}
+		}
+	}
+
 	// Check for limits
 	ct, err := GetCounterTypeFromWorkerType(req.WorkerType)
 	if err == nil {
@@ -228,6 +285,15 @@ func (b *memBroker) PushJob(db prefixer.Prefixer, req *JobRequest) (*Job, error)
 	if err := q.Enqueue(job); err != nil {
 		return nil, err
 	}
+	if window > 0 {
+		now := time.Now()
+		for key, entry := range b.dedup {
+			if now.After(entry.deadline) {
+				delete(b.dedup, key)
+			}
+		}
+		b.dedup[dedupKey] = memDedup{jobID: job.JobID, deadline: now.Add(window)}
+	}
 	return job, nil
 }
 
@@ -241,6 +307,15 @@ func (b *memBroker) WorkerQueueLen(workerType string) (int, error) {
 	return q.Len(), nil
 }
 
+// WorkerInFlight returns the number of jobs of the specified worker type that
+// are currently running for the given instance.
+func (b *memBroker) WorkerInFlight(db prefixer.Prefixer, workerType string) (int, error) {
+	if _, ok := b.queues[workerType]; !ok {
+		return 0, ErrUnknownWorker
+	}
+	return b.concurrency.inFlight(db, workerType)
+}
+
 func (b *memBroker) WorkerIsReserved(workerType string) (bool, error) {
 	for _, w := range b.workers {
 		if w.Type == workerType {
@@ -254,4 +329,37 @@ func (b *memBroker) WorkersTypes() []string {
 	return b.workersTypes
 }
 
+// DrainWorkers puts the workers of the given types (or all the workers if no
+// type is given) in drain mode.
+func (b *memBroker) DrainWorkers(workerTypes ...string) error {
+	return b.setDraining(workerTypes, true)
+}
+
+// ResumeWorkers ends the drain mode for the workers of the given types (or
+// all the workers if no type is given).
+func (b *memBroker) ResumeWorkers(workerTypes ...string) error {
+	return b.setDraining(workerTypes, false)
+}
+
+func (b *memBroker) setDraining(workerTypes []string, draining bool) error {
+	workers, err := drainWorkers(b.workers, workerTypes, draining)
+	if err != nil {
+		return err
+	}
+	for _, w := range workers {
+		b.queues[w.Type].setDraining(draining)
+	}
+	return nil
+}
+
+// WorkersStats returns the metrics of the workers running on this process.
+func (b *memBroker) WorkersStats() ([]*WorkerStats, error) {
+	stats := make([]*WorkerStats, 0, len(b.workers))
+	for _, w := range b.workers {
+		q := b.queues[w.Type]
+		stats = append(stats, newWorkerStats(w, q.Len(), q.Oldest()))
+	}
+	return stats, nil
+}
+
 var _ Broker = &memBroker{}
@@ -314,6 +314,82 @@ func TestMemBroker(t *testing.T) {
 		w.Wait()
 	})
 
+	t.Run("Coalescing", func(t *testing.T) {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		broker := job.NewMemBroker()
+		assert.NoError(t, broker.StartWorkers(job.WorkersList{
+			{
+				WorkerType:  "coalesced",
+				Concurrency: 1,
+				WorkerFunc: func(ctx *job.WorkerContext) error {
+					started <- struct{}{}
+					<-release
+					return nil
+				},
+			},
+		}))
+
+		req := &job.JobRequest{WorkerType: "coalesced", DedupKey: "konnector/foo/bar"}
+		first, err := broker.PushJob(testInstance, req)
+		assert.NoError(t, err)
+		<-started
+
+		// The first job is running, so a new job is queued
+		second, err := broker.PushJob(testInstance, req)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.ID(), second.ID())
+		third, err := broker.PushJob(testInstance, req)
+		assert.NoError(t, err)
+		assert.Equal(t, second.ID(), third.ID())
+
+		other, err := broker.PushJob(testInstance, &job.JobRequest{WorkerType: "coalesced"})
+		assert.NoError(t, err)
+		assert.NotEqual(t, second.ID(), other.ID())
+
+		close(release)
+		<-started
+		<-started
+	})
+
+	t.Run("ConcurrentCoalescing", func(t *testing.T) {
+		release := make(chan struct{})
+		broker := job.NewMemBroker()
+		assert.NoError(t, broker.StartWorkers(job.WorkersList{
+			{
+				WorkerType:  "coalesced-concurrent",
+				Concurrency: 1,
+				WorkerFunc: func(ctx *job.WorkerContext) error {
+					<-release
+					return nil
+				},
+			},
+		}))
+		defer close(release)
+
+		req := &job.JobRequest{WorkerType: "coalesced-concurrent", DedupKey: "konnector/foo/baz"}
+		blocker, err := broker.PushJob(testInstance, &job.JobRequest{WorkerType: "coalesced-concurrent"})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		ids := make([]string, 10)
+		for i := range ids {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				j, err := broker.PushJob(testInstance, req)
+				if assert.NoError(t, err) {
+					ids[i] = j.ID()
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, id := range ids {
+			assert.Equal(t, ids[0], id)
+		}
+		assert.NotEqual(t, blocker.ID(), ids[0])
+	})
+
 	t.Run("MemAddJobRateLimitExceeded", func(t *testing.T) {
 		workersTestList := job.WorkersList{
 			{
@@ -24,6 +24,7 @@ type memScheduler struct {
 
 	ts    map[string]Trigger
 	thumb *ThumbnailTrigger
+	photo *PhotoGroupTrigger
 	mu    sync.RWMutex
 	log   *logger.Entry
 }
@@ -51,6 +52,8 @@ func (s *memScheduler) StartScheduler(b Broker) error {
 
 	s.thumb = NewThumbnailTrigger(s.broker)
 	go s.thumb.Schedule()
+	s.photo = NewPhotoGroupTrigger(s.broker)
+	go s.photo.Schedule()
 
 	// XXX The memory scheduler loads the triggers from CouchDB when the stack
 	// is started. This can cause some stability issues when running
@@ -117,6 +120,7 @@ func (s *memScheduler) ShutdownScheduler(ctx context.Context) error {
 		t.Unschedule()
 	}
 	s.thumb.Unschedule()
+	s.photo.Unschedule()
 	fmt.Println("ok.")
 	return nil
 }
@@ -175,6 +179,7 @@ func (s *memScheduler) DeleteTrigger(db prefixer.Prefixer, id string) error {
 	}
 	delete(s.ts, db.DBPrefix()+"/"+id)
 	t.Unschedule()
+	deleteTriggerHistory(db, id)
 	return couchdb.DeleteDoc(db, t.Infos())
 }
 
@@ -273,6 +278,11 @@ func (s *memScheduler) pushJob(t Trigger, req *JobRequest) {
 	defer s.mu.Unlock()
 
 	log := s.log.WithField("domain", t.DomainName())
+	if pausedByMaintenance(t) {
+		log.Infof("trigger %s(%s): Paused during the maintenance",
+			t.Type(), t.Infos().TID)
+		return
+	}
 	log.Infof("trigger %s(%s): Pushing new job %s",
 		t.Type(), t.Infos().TID, req.WorkerType)
 	if _, err := s.broker.PushJob(t, req); err != nil {
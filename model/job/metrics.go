@@ -34,6 +34,42 @@ func (i *workersQueuesCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
+type workersQueuesAgeCollector struct {
+	prometheus.Desc
+}
+
+func newWorkersQueuesAgeCollector() prometheus.Collector {
+	desc := prometheus.NewDesc(
+		prometheus.BuildFQName("workers", "queues", "age_seconds"),
+		`Age of the oldest job of the workers queues by worker type`,
+		[]string{"worker_type"},
+		prometheus.Labels{},
+	)
+	return &workersQueuesAgeCollector{*desc}
+}
+
+func (i *workersQueuesAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- &i.Desc
+}
+
+func (i *workersQueuesAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	broker := globalJobSystem
+	if broker == nil {
+		return
+	}
+	stats, err := broker.WorkersStats()
+	if err != nil {
+		return
+	}
+	for _, s := range stats {
+		ch <- prometheus.MustNewConstMetric(
+			&i.Desc, prometheus.GaugeValue, s.QueueAge,
+			s.WorkerType,
+		)
+	}
+}
+
 func init() {
 	prometheus.MustRegister(newWorkersQueuesCollector())
+	prometheus.MustRegister(newWorkersQueuesAgeCollector())
 }
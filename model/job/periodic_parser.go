@@ -7,17 +7,20 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// PeriodicParser can be used to parse @weekly and @monthly trigger arguments.
-// It can parse a string like "on monday between 8am and 6pm".
+// PeriodicParser can be used to parse @weekly, @monthly and @yearly trigger
+// arguments. It can parse a string like "on monday between 8am and 6pm".
 type PeriodicParser struct{}
 
 // PeriodicSpec is the result of a successful parsing
 type PeriodicSpec struct {
 	Frequency   FrequencyKind
+	Months      []int // a slice of acceptable months (1 to 12), for yearly
 	DaysOfMonth []int // empty for *, or a slice of acceptable days (1 to 31)
 	DaysOfWeek  []int // a slice of acceptable days, from 0 for sunday to 6 for saturday
+	WeekOfMonth int   // 0 for any, 1 to 4 for the first to fourth week, -1 for the last week
 	AfterHour   int   // an hour between 0 and 23
 	BeforeHour  int   // an hour between 1 and 24
 }
@@ -30,8 +33,17 @@ const (
 	WeeklyKind
 	DailyKind
 	HourlyKind
+	YearlyKind
 )
 
+var weeksOfMonth = map[string]int{
+	"first":  1,
+	"second": 2,
+	"third":  3,
+	"fourth": 4,
+	"last":   -1,
+}
+
 // NewPeriodicParser creates a PeriodicParser.
 func NewPeriodicParser() PeriodicParser {
 	return PeriodicParser{}
@@ -41,6 +53,7 @@ func NewPeriodicSpec() *PeriodicSpec {
 	return &PeriodicSpec{
 		DaysOfMonth: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28},
 		DaysOfWeek:  []int{0, 1, 2, 3, 4, 5, 6},
+		Months:      []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
 		AfterHour:   0,
 		BeforeHour:  24,
 	}
@@ -60,12 +73,25 @@ func (p *PeriodicParser) Parse(frequency FrequencyKind, periodic string) (*Perio
 				return nil, errors.New("expecting a day after 'on' keyword")
 			}
 			if fields[1] == "the" {
-				if frequency != MonthlyKind {
-					return nil, errors.New("day if month is only available for monthly")
+				if frequency != MonthlyKind && frequency != YearlyKind {
+					return nil, errors.New("day if month is only available for monthly and yearly")
 				}
 				if len(fields) == 2 {
 					return nil, errors.New("expecting a day after 'on the' keywords")
 				}
+				if week, ok := weeksOfMonth[fields[2]]; ok {
+					if len(fields) == 3 {
+						return nil, fmt.Errorf("expecting a day after 'on the %s' keywords", fields[2])
+					}
+					dow, err := p.parseDayOfWeek(fields[3])
+					if err != nil {
+						return nil, err
+					}
+					spec.WeekOfMonth = week
+					spec.DaysOfWeek = []int{dow}
+					fields = fields[4:]
+					continue
+				}
 				dom, err := p.parseDaysOfMonth(fields[2])
 				if err != nil {
 					return nil, err
@@ -83,6 +109,30 @@ func (p *PeriodicParser) Parse(frequency FrequencyKind, periodic string) (*Perio
 				spec.DaysOfWeek = dow
 				fields = fields[2:]
 			}
+		case "in":
+			if frequency != YearlyKind {
+				return nil, errors.New("month is only available for yearly")
+			}
+			if len(fields) == 1 {
+				return nil, errors.New("expecting a month after 'in' keyword")
+			}
+			months, err := p.parseMonths(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			spec.Months = months
+			fields = fields[2:]
+		case "at":
+			if len(fields) == 1 {
+				return nil, errors.New("expecting an hour after 'at' keyword")
+			}
+			hour, err := p.parseHour(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			spec.AfterHour = hour
+			spec.BeforeHour = hour + 1
+			fields = fields[2:]
 		case "before", "and":
 			if len(fields) == 1 {
 				return nil, fmt.Errorf("expecting an hour after '%s' keyword", fields[0])
@@ -115,9 +165,33 @@ func (p *PeriodicParser) Parse(frequency FrequencyKind, periodic string) (*Perio
 		return nil, errors.New("invalid hours range")
 	}
 
+	if frequency == YearlyKind && spec.WeekOfMonth == 0 {
+		if err := checkDaysInMonths(spec.Months, spec.DaysOfMonth); err != nil {
+			return nil, err
+		}
+	}
+
 	return spec, nil
 }
 
+// daysInMonths is the number of days of each month, with 28 for february, as
+// a yearly job on the 29th of february would run only once every 4 years.
+var daysInMonths = []int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// checkDaysInMonths returns an error if one of the days doesn't exist in one
+// of the months: the month and the day of a yearly job are taken randomly,
+// and the job would never run for an impossible date (like the 30 february).
+func checkDaysInMonths(months, days []int) error {
+	for _, month := range months {
+		for _, day := range days {
+			if day > daysInMonths[month-1] {
+				return fmt.Errorf("invalid day %d for month %d", day, month)
+			}
+		}
+	}
+	return nil
+}
+
 func (p *PeriodicParser) parseDaysOfMonth(field string) ([]int, error) {
 	var days []int
 	parts := strings.Split(field, ",")
@@ -218,6 +292,47 @@ func (p *PeriodicParser) parseDayOfWeek(day string) (int, error) {
 	}
 }
 
+func (p *PeriodicParser) parseMonths(field string) ([]int, error) {
+	var months []int
+	parts := strings.Split(field, ",")
+	for _, part := range parts {
+		if strings.Contains(part, "-") {
+			splitted := strings.SplitN(part, "-", 2)
+			from, err := p.parseMonth(splitted[0])
+			if err != nil {
+				return nil, err
+			}
+			to, err := p.parseMonth(splitted[1])
+			if err != nil {
+				return nil, err
+			}
+			if from >= to {
+				return nil, errors.New("invalid range")
+			}
+			for i := from; i <= to; i++ {
+				months = append(months, i)
+			}
+		} else {
+			month, err := p.parseMonth(part)
+			if err != nil {
+				return nil, err
+			}
+			months = append(months, month)
+		}
+	}
+	return months, nil
+}
+
+func (p *PeriodicParser) parseMonth(month string) (int, error) {
+	for i := time.January; i <= time.December; i++ {
+		name := strings.ToLower(i.String())
+		if month == name || month == name[:3] {
+			return int(i), nil
+		}
+	}
+	return -1, fmt.Errorf("cannot parse %q as a month", month)
+}
+
 func (p *PeriodicParser) parseHour(hour string) (int, error) {
 	if strings.HasSuffix(hour, "am") {
 		h, err := strconv.Atoi(strings.TrimSuffix(hour, "am"))
@@ -263,6 +378,24 @@ func (s *PeriodicSpec) ToRandomCrontab(seed string) string {
 	minute := rnd.Intn(60)
 	hour := s.AfterHour + rnd.Intn(s.BeforeHour-s.AfterHour)
 
+	if s.WeekOfMonth != 0 {
+		// The week of the month cannot be expressed with the cron syntax:
+		// the crontab is for the day of the week, and the schedule must be
+		// restricted to the right week (see ToRandomSchedule).
+		dow := s.DaysOfWeek[rnd.Intn(len(s.DaysOfWeek))]
+		if s.Frequency == YearlyKind {
+			month := s.Months[rnd.Intn(len(s.Months))]
+			return fmt.Sprintf("%d %d %d * %d %d", second, minute, hour, month, dow)
+		}
+		return fmt.Sprintf("%d %d %d * * %d", second, minute, hour, dow)
+	}
+
+	if s.Frequency == YearlyKind {
+		month := s.Months[rnd.Intn(len(s.Months))]
+		dom := s.DaysOfMonth[rnd.Intn(len(s.DaysOfMonth))]
+		return fmt.Sprintf("%d %d %d %d %d *", second, minute, hour, dom, month)
+	}
+
 	if s.Frequency == MonthlyKind {
 		dom := s.DaysOfMonth[rnd.Intn(len(s.DaysOfMonth))]
 		return fmt.Sprintf("%d %d %d %d * *", second, minute, hour, dom)
@@ -118,7 +118,57 @@ func TestPeriodicParser(t *testing.T) {
 	assert.Equal(t, spec.AfterHour, 0)
 	assert.Equal(t, spec.BeforeHour, 9)
 
+	spec, err = p.Parse(job.MonthlyKind, "on the first monday at 8am")
+	require.NoError(t, err)
+	assert.Equal(t, spec.WeekOfMonth, 1)
+	assert.Equal(t, spec.DaysOfWeek, []int{1})
+	assert.Equal(t, spec.AfterHour, 8)
+	assert.Equal(t, spec.BeforeHour, 9)
+
+	spec, err = p.Parse(job.MonthlyKind, "on the last friday")
+	require.NoError(t, err)
+	assert.Equal(t, spec.WeekOfMonth, -1)
+	assert.Equal(t, spec.DaysOfWeek, []int{5})
+
+	// Months
+	spec, err = p.Parse(job.YearlyKind, "")
+	require.NoError(t, err)
+	assert.Equal(t, spec.Months, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12})
+
+	spec, err = p.Parse(job.YearlyKind, "in april on the 1-15 after 6pm")
+	require.NoError(t, err)
+	assert.Equal(t, spec.Months, []int{4})
+	assert.Equal(t, spec.DaysOfMonth, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	assert.Equal(t, spec.AfterHour, 18)
+	assert.Equal(t, spec.BeforeHour, 24)
+
+	spec, err = p.Parse(job.YearlyKind, "in jan-mar,dec")
+	require.NoError(t, err)
+	assert.Equal(t, spec.Months, []int{1, 2, 3, 12})
+
+	spec, err = p.Parse(job.YearlyKind, "in jan,mar on the 31")
+	require.NoError(t, err)
+	assert.Equal(t, spec.DaysOfMonth, []int{31})
+
 	// Errors
+	_, err = p.Parse(job.MonthlyKind, "in april")
+	assert.Error(t, err)
+	_, err = p.Parse(job.YearlyKind, "in xyz")
+	assert.Error(t, err)
+	_, err = p.Parse(job.YearlyKind, "in mar-jan")
+	assert.Error(t, err)
+	_, err = p.Parse(job.YearlyKind, "in feb on the 30")
+	assert.Error(t, err)
+	_, err = p.Parse(job.YearlyKind, "in apr-may on the 31")
+	assert.Error(t, err)
+	_, err = p.Parse(job.YearlyKind, "in feb on the 29")
+	assert.Error(t, err)
+	_, err = p.Parse(job.WeeklyKind, "on the first monday")
+	assert.Error(t, err)
+	_, err = p.Parse(job.MonthlyKind, "on the first")
+	assert.Error(t, err)
+	_, err = p.Parse(job.MonthlyKind, "at")
+	assert.Error(t, err)
 	_, err = p.Parse(job.DailyKind, "on monday")
 	assert.Error(t, err)
 	_, err = p.Parse(job.WeeklyKind, "xyz")
@@ -283,3 +333,69 @@ func TestToRandomCrontab(t *testing.T) {
 	next = schedule.Next(exec)
 	assert.WithinDuration(t, exec.Add(day), next, 3*time.Minute)
 }
+
+func TestToRandomSchedule(t *testing.T) {
+	p := job.NewPeriodicParser()
+	seed := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	t.Run("WeekOfMonth", func(t *testing.T) {
+		spec, err := p.Parse(job.MonthlyKind, "on the first monday at 8am")
+		require.NoError(t, err)
+		schedule, err := spec.ToRandomSchedule(seed)
+		require.NoError(t, err)
+
+		next := time.Date(2023, time.June, 6, 0, 0, 0, 0, time.UTC)
+		for _, expected := range []int{3, 7, 4} { // July, August, September
+			next = schedule.Next(next)
+			assert.Equal(t, time.Monday, next.Weekday())
+			assert.Equal(t, expected, next.Day())
+			assert.Equal(t, 8, next.Hour())
+		}
+	})
+
+	t.Run("LastWeekOfMonth", func(t *testing.T) {
+		spec, err := p.Parse(job.MonthlyKind, "on the last friday")
+		require.NoError(t, err)
+		schedule, err := spec.ToRandomSchedule(seed)
+		require.NoError(t, err)
+
+		next := schedule.Next(time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC))
+		assert.Equal(t, time.February, next.Month())
+		assert.Equal(t, 24, next.Day())
+	})
+
+	t.Run("Yearly", func(t *testing.T) {
+		spec, err := p.Parse(job.YearlyKind, "in april")
+		require.NoError(t, err)
+		schedule, err := spec.ToRandomSchedule(seed)
+		require.NoError(t, err)
+
+		next := schedule.Next(time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC))
+		assert.Equal(t, 2024, next.Year())
+		assert.Equal(t, time.April, next.Month())
+	})
+
+	t.Run("Timezone", func(t *testing.T) {
+		infos := &job.TriggerInfos{
+			Type:      "@cron",
+			Arguments: "0 0 8 * * *",
+			Timezone:  "Europe/Paris",
+		}
+		trigger, err := job.NewCronTrigger(infos)
+		require.NoError(t, err)
+
+		// The DST change in Paris was on the 26th of March 2023
+		paris, err := time.LoadLocation("Europe/Paris")
+		require.NoError(t, err)
+		next := trigger.NextExecution(time.Date(2023, time.March, 24, 12, 0, 0, 0, time.UTC))
+		assert.Equal(t, 7, next.UTC().Hour())
+		assert.Equal(t, 8, next.In(paris).Hour())
+		next = trigger.NextExecution(next)
+		assert.Equal(t, 6, next.UTC().Hour())
+		assert.Equal(t, 8, next.In(paris).Hour())
+
+		infos.Timezone = "Mars/Olympus_Mons"
+		_, err = job.NewCronTrigger(infos)
+		assert.Error(t, err)
+	})
+}
@@ -27,6 +27,8 @@ func GetCounterTypeFromWorkerType(workerType string) (limits.CounterType, error)
 		return limits.JobServiceType, nil
 	case "push":
 		return limits.JobNotificationType, nil
+	case "sms":
+		return limits.JobSMSType, nil
 	case "notes-persist":
 		return limits.JobNotesPersistType, nil
 	case "client":
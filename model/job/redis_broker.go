@@ -2,6 +2,7 @@ package job
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -14,6 +15,8 @@ import (
 	"github.com/cozy/cozy-stack/pkg/limits"
 	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/utils"
+	"github.com/gofrs/uuid"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/redis/go-redis/v9"
 )
@@ -23,6 +26,35 @@ const (
 	redisPrefix = "j/"
 	// redisHighPrioritySuffix suffix is the suffix used for prioritized queue.
 	redisHighPrioritySuffix = "/p0"
+	// redisDedupPrefix is the prefix for the keys used to coalesce the jobs
+	// with the same dedup key.
+	redisDedupPrefix = "jd/"
+	// redisConcurrencyPrefix is the prefix for the sorted sets of the jobs
+	// running at the same time for an instance, with the date when their
+	// slot expires as score.
+	redisConcurrencyPrefix = "jc/"
+	// redisConcurrencyTTL is a safety net for the slots of the running jobs:
+	// if a stack process is killed while running a job, its slot is freed
+	// when this delay has elapsed.
+	redisConcurrencyTTL = time.Hour
+	// redisDelayedPrefix is the prefix for the sorted sets of the jobs that
+	// will be put back in their queue later, with the date as score.
+	redisDelayedPrefix = "jw/"
+	// redisHeartbeatPrefix is the prefix for the keys used by the stack
+	// processes to say that they are still alive.
+	redisHeartbeatPrefix = "jh/"
+	// redisOrphansKey is the key of the hash where the jobs still running
+	// when a stack process stops are kept, with the owner process as value.
+	redisOrphansKey = "jo"
+)
+
+var (
+	// redisHeartbeatInterval is the delay between two heartbeats of a stack
+	// process, and between two checks of the orphan jobs.
+	redisHeartbeatInterval = 10 * time.Second
+	// redisHeartbeatTTL is the delay after which a stack process that has
+	// not sent a heartbeat is considered as dead.
+	redisHeartbeatTTL = 30 * time.Second
 )
 
 type redisBroker struct {
@@ -33,15 +65,21 @@ type redisBroker struct {
 	workersTypes   []string
 	running        uint32
 	closed         chan struct{}
+	stopping       chan struct{}
+	stopped        chan struct{}
+	owner          string
 }
 
 // NewRedisBroker creates a new broker that will use redis to distribute
 // the jobs among several cozy-stack processes.
 func NewRedisBroker(client redis.UniversalClient) Broker {
 	return &redisBroker{
-		client: client,
-		ctx:    context.Background(),
-		closed: make(chan struct{}),
+		client:   client,
+		ctx:      context.Background(),
+		closed:   make(chan struct{}),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+		owner:    utils.RandomString(16),
 	}
 }
 
@@ -59,15 +97,17 @@ func (b *redisBroker) StartWorkers(ws WorkersList) error {
 			continue
 		}
 		b.workersRunning = append(b.workersRunning, w)
+		w.limiter = &redisConcurrency{broker: b}
 		ch := make(chan *Job)
 		if err := w.Start(ch); err != nil {
 			return err
 		}
-		go b.pollLoop(redisPrefix+conf.WorkerType, ch)
+		go b.pollLoop(w, redisPrefix+conf.WorkerType, ch)
 	}
 
 	if len(b.workersRunning) > 0 {
 		joblog.Infof("Started redis broker for %d workers type", len(b.workersRunning))
+		go b.heartbeatLoop()
 	}
 
 	// XXX for retro-compat
@@ -88,9 +128,13 @@ func (b *redisBroker) ShutdownWorkers(ctx context.Context) error {
 	if !atomic.CompareAndSwapUint32(&b.running, 1, 0) {
 		return ErrClosed
 	}
+	close(b.stopping)
 	if len(b.workersRunning) == 0 {
 		return nil
 	}
+	// The heartbeats are sent until the end of the shutdown, as the jobs
+	// that are still running must not be taken by another process before.
+	defer close(b.stopped)
 
 	fmt.Print("  shutting down redis broker...")
 	defer b.client.Close()
@@ -98,6 +142,7 @@ func (b *redisBroker) ShutdownWorkers(ctx context.Context) error {
 	for i := 0; i < len(b.workersRunning); i++ {
 		select {
 		case <-ctx.Done():
+			b.handBackInFlightJobs()
 			fmt.Println("failed:", ctx.Err())
 			return ctx.Err()
 		case <-b.closed:
@@ -117,6 +162,7 @@ func (b *redisBroker) ShutdownWorkers(ctx context.Context) error {
 	}
 
 	if errm != nil {
+		b.handBackInFlightJobs()
 		fmt.Println("failed: ", errm)
 	} else {
 		fmt.Println("ok")
@@ -127,12 +173,14 @@ func (b *redisBroker) ShutdownWorkers(ctx context.Context) error {
 var redisBRPopTimeout = 10 * time.Second
 
 // SetRedisTimeoutForTest is used by unit test to avoid waiting 10 seconds on
-// cleanup.
+// cleanup, and 30 seconds for the heartbeats.
 func SetRedisTimeoutForTest() {
 	redisBRPopTimeout = 1 * time.Second
+	redisHeartbeatInterval = 100 * time.Millisecond
+	redisHeartbeatTTL = 300 * time.Millisecond
 }
 
-func (b *redisBroker) pollLoop(key string, ch chan<- *Job) {
+func (b *redisBroker) pollLoop(w *Worker, key string, ch chan<- *Job) {
 	defer func() {
 		b.closed <- struct{}{}
 	}()
@@ -143,6 +191,13 @@ func (b *redisBroker) pollLoop(key string, ch chan<- *Job) {
 			return
 		}
 
+		// In drain mode, the jobs are left in the queue for the other stack
+		// processes.
+		if w.Draining() {
+			time.Sleep(drainPollDelay)
+			continue
+		}
+
 		// The brpop redis command will always take elements in priority from the
 		// first key containing elements at the call. By always priorizing the
 		// manual queue, this would cause a starvation for our main queue if too
@@ -166,27 +221,161 @@ func (b *redisBroker) pollLoop(key string, ch chan<- *Job) {
 			continue
 		}
 
-		parts := strings.SplitN(val, "/", 2)
-		if len(parts) != 2 {
-			joblog.Warnf("Invalid val %s", val)
+		job, err := jobFromQueueValue(val)
+		if err != nil {
+			joblog.Warnf("%s", err)
 			continue
 		}
 
-		jobID := parts[1]
-		parts = strings.SplitN(parts[0], "%", 2)
-		prefix := parts[0]
-		var cluster int
-		if len(parts) > 1 {
-			cluster, _ = strconv.Atoi(parts[1])
+		// When the stack is shutting down, the job is given back to the
+		// queue for another stack process, instead of waiting for a worker.
+		select {
+		case <-b.stopping:
+			b.handBack(key, val)
+			return
+		default:
+		}
+		select {
+		case ch <- job:
+		case <-b.stopping:
+			b.handBack(key, val)
+			return
+		}
+	}
+}
+
+// jobFromQueueValue loads the job from a value of a redis queue.
+func jobFromQueueValue(val string) (*Job, error) {
+	parts := strings.SplitN(val, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid val %s", val)
+	}
+
+	jobID := parts[1]
+	parts = strings.SplitN(parts[0], "%", 2)
+	prefix := parts[0]
+	var cluster int
+	if len(parts) > 1 {
+		cluster, _ = strconv.Atoi(parts[1])
+	}
+	job, err := Get(prefixer.NewPrefixer(cluster, "", prefix), jobID)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find job %s on domain %s (%d): %s",
+			jobID, prefix, cluster, err)
+	}
+	return job, nil
+}
+
+// handBack puts a job back at the head of its queue, so that it will be the
+// next one taken by another stack process.
+func (b *redisBroker) handBack(key, val string) {
+	if err := b.client.RPush(b.ctx, key, val).Err(); err != nil {
+		joblog.Errorf("Cannot hand back job %s: %s", val, err)
+	}
+}
+
+// handBackInFlightJobs is called when the workers have not finished their
+// jobs before the end of the shutdown delay. The running jobs can't be given
+// back to the broker right now, as they are still executed by this process
+// until it exits: they are kept as orphans, and another stack process will
+// give them back to the broker when the heartbeat of this one has expired.
+func (b *redisBroker) handBackInFlightJobs() {
+	for _, w := range b.workersRunning {
+		for _, job := range w.takeInFlightJobs() {
+			if err := b.client.HSet(b.ctx, redisOrphansKey, queueValue(job), b.owner).Err(); err != nil {
+				joblog.Errorf("Cannot hand back job %s: %s", job.ID(), err)
+				continue
+			}
+			joblog.Infof("Job %s will be handed back to the broker", job.ID())
+		}
+	}
+}
+
+// heartbeatLoop says regularly that this stack process is alive, and gives
+// back to the broker the orphan jobs of the processes that are dead.
+func (b *redisBroker) heartbeatLoop() {
+	ticker := time.NewTicker(redisHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		key := redisHeartbeatPrefix + b.owner
+		if err := b.client.Set(b.ctx, key, "1", redisHeartbeatTTL).Err(); err != nil {
+			joblog.Warnf("Cannot send heartbeat: %s", err)
 		}
-		job, err := Get(prefixer.NewPrefixer(cluster, "", prefix), jobID)
+		b.handBackOrphanJobs()
+		b.requeueDelayedJobs()
+		select {
+		case <-b.stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handBackOrphanJobs gives back to the broker the jobs that were still
+// running when a stack process has stopped, once its heartbeat has expired.
+// The jobs that have finished before the process exited are just forgotten.
+func (b *redisBroker) handBackOrphanJobs() {
+	orphans, err := b.client.HGetAll(b.ctx, redisOrphansKey).Result()
+	if err != nil {
+		return
+	}
+	for val, owner := range orphans {
+		n, err := b.client.Exists(b.ctx, redisHeartbeatPrefix+owner).Result()
+		if err != nil || n > 0 {
+			continue
+		}
+		// Only the process that removes the orphan can hand it back
+		if n, err := b.client.HDel(b.ctx, redisOrphansKey, val).Result(); err != nil || n == 0 {
+			continue
+		}
+		job, err := jobFromQueueValue(val)
 		if err != nil {
-			joblog.Warnf("Cannot find job %s on domain %s (%d): %s",
-				jobID, prefix, cluster, err)
+			joblog.Warnf("%s", err)
+			continue
+		}
+		if job.State != Running {
+			continue
+		}
+		job.State = Queued
+		job.StartedAt = time.Time{}
+		if err := job.Update(); err != nil {
+			joblog.Errorf("Cannot hand back job %s: %s", job.ID(), err)
 			continue
 		}
+		key := redisPrefix + job.WorkerType
+		if job.Manual {
+			key += redisHighPrioritySuffix
+		}
+		b.handBack(key, val)
+		joblog.Infof("Job %s has been handed back to the broker", job.ID())
+	}
+}
 
-		ch <- job
+// requeueDelayedJobs puts back in their queue the jobs that were delayed and
+// whose delay has elapsed.
+func (b *redisBroker) requeueDelayedJobs() {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for _, w := range b.workersRunning {
+		for _, suffix := range []string{"", redisHighPrioritySuffix} {
+			key := redisPrefix + w.Type + suffix
+			delayed := redisDelayedPrefix + w.Type + suffix
+			vals, err := b.client.ZRangeByScore(b.ctx, delayed, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: now,
+			}).Result()
+			if err != nil {
+				continue
+			}
+			for _, val := range vals {
+				// Only the process that removes the job can requeue it
+				if n, err := b.client.ZRem(b.ctx, delayed, val).Result(); err != nil || n == 0 {
+					continue
+				}
+				if err := b.client.LPush(b.ctx, key, val).Err(); err != nil {
+					joblog.Errorf("Cannot requeue job %s: %s", val, err)
+				}
+			}
+		}
 	}
 }
 
@@ -208,6 +397,9 @@ func (b *redisBroker) PushJob(db prefixer.Prefixer, req *JobRequest) (*Job, erro
 		return nil, ErrUnknownWorker
 	}
 
+	window := coalescingWindow(req)
+	dedupKey := redisDedupPrefix + db.DBPrefix() + "/" + req.DedupKey
+
 	// Check for limits
 	ct, err := GetCounterTypeFromWorkerType(req.WorkerType)
 	if err == nil {
@@ -235,7 +427,29 @@ func (b *redisBroker) PushJob(db prefixer.Prefixer, req *JobRequest) (*Job, erro
 		}
 	}
 
+	// The identifier of the job is chosen before its creation, to be stored
+	// atomically in the dedup key.
+	reserved := false
+	if window > 0 {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		job.JobID = hex.EncodeToString(id.Bytes())
+		other, err := b.reserveDedupKey(db, req, dedupKey, job.JobID, window)
+		if err != nil {
+			joblog.Warnf("Cannot set the dedup key for job %s: %s", job.JobID, err)
+		} else if other != nil {
+			return other, nil
+		} else {
+			reserved = true
+		}
+	}
+
 	if err := job.Create(); err != nil {
+		if reserved {
+			b.releaseDedupKey(dedupKey, job.JobID)
+		}
 		return nil, err
 	}
 
@@ -244,12 +458,75 @@ func (b *redisBroker) PushJob(db prefixer.Prefixer, req *JobRequest) (*Job, erro
 		return job, nil
 	}
 
-	key := redisPrefix + job.WorkerType
-	prefix := job.DBPrefix()
-	if cluster := job.DBCluster(); cluster > 0 {
-		prefix = fmt.Sprintf("%s%%%d", prefix, cluster)
+	if err := b.enqueue(job); err != nil {
+		if reserved {
+			b.releaseDedupKey(dedupKey, job.JobID)
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// swapDedupScript replaces the job of a dedup key, only if it has not been
+// changed by a concurrent push.
+var swapDedupScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+  return 1
+end
+return 0
+`)
+
+// releaseDedupScript deletes a dedup key, only if it is still for the given
+// job.
+var releaseDedupScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// reserveDedupKey stores the job ID in the dedup key for the coalescing
+// window, if there is no other job waiting in the queue for this key. If there
+// is one, this other job is returned.
+func (b *redisBroker) reserveDedupKey(db prefixer.Prefixer, req *JobRequest, key, jobID string, window time.Duration) (*Job, error) {
+	for i := 0; i < 3; i++ {
+		ok, err := b.client.SetNX(b.ctx, key, jobID, window).Result()
+		if err != nil || ok {
+			return nil, err
+		}
+		otherID, err := b.client.Get(b.ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			// The key has just expired
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if other := coalescedJob(db, req, otherID); other != nil {
+			return other, nil
+		}
+		// The other job has already started, this one takes its place
+		swapped, err := swapDedupScript.Run(b.ctx, b.client, []string{key},
+			otherID, jobID, window.Milliseconds()).Int()
+		if err != nil || swapped == 1 {
+			return nil, err
+		}
 	}
-	val := prefix + "/" + job.JobID
+	return nil, nil
+}
+
+// releaseDedupKey deletes the dedup key of a job that has not been queued.
+func (b *redisBroker) releaseDedupKey(key, jobID string) {
+	if err := releaseDedupScript.Run(b.ctx, b.client, []string{key}, jobID).Err(); err != nil {
+		joblog.Warnf("Cannot release the dedup key for job %s: %s", jobID, err)
+	}
+}
+
+// enqueue pushes the job in the redis queue of its worker type.
+func (b *redisBroker) enqueue(job *Job) error {
+	key := redisPrefix + job.WorkerType
 
 	// When the job is manual, it is being pushed in a specific prioritized
 	// queue.
@@ -257,11 +534,16 @@ func (b *redisBroker) PushJob(db prefixer.Prefixer, req *JobRequest) (*Job, erro
 		key += redisHighPrioritySuffix
 	}
 
-	if err := b.client.LPush(b.ctx, key, val).Err(); err != nil {
-		return nil, err
-	}
+	return b.client.LPush(b.ctx, key, queueValue(job)).Err()
+}
 
-	return job, nil
+// queueValue returns the value used for the job in the redis queue.
+func queueValue(job *Job) string {
+	prefix := job.DBPrefix()
+	if cluster := job.DBCluster(); cluster > 0 {
+		prefix = fmt.Sprintf("%s%%%d", prefix, cluster)
+	}
+	return prefix + "/" + job.JobID
 }
 
 // QueueLen returns the size of the number of elements in queue of the
@@ -279,6 +561,71 @@ func (b *redisBroker) WorkerQueueLen(workerType string) (int, error) {
 	return int(l1 + l2), nil
 }
 
+// WorkerInFlight returns the number of jobs of the specified worker type that
+// are currently running for the given instance.
+func (b *redisBroker) WorkerInFlight(db prefixer.Prefixer, workerType string) (int, error) {
+	for _, w := range b.workers {
+		if w.Type == workerType {
+			return (&redisConcurrency{broker: b}).inFlight(db, workerType)
+		}
+	}
+	return 0, ErrUnknownWorker
+}
+
+// workerQueueOldest returns the date when the oldest job of the queues of the
+// specified worker type has been queued.
+func (b *redisBroker) workerQueueOldest(workerType string) time.Time {
+	var oldest time.Time
+	key := redisPrefix + workerType
+	for _, k := range []string{key, key + redisHighPrioritySuffix} {
+		// The jobs are taken from the right of the list
+		val, err := b.client.LIndex(b.ctx, k, -1).Result()
+		if err != nil {
+			continue
+		}
+		job, err := jobFromQueueValue(val)
+		if err != nil {
+			continue
+		}
+		if oldest.IsZero() || job.QueuedAt.Before(oldest) {
+			oldest = job.QueuedAt
+		}
+	}
+	return oldest
+}
+
+// DrainWorkers puts the workers of the given types (or all the workers if no
+// type is given) in drain mode.
+func (b *redisBroker) DrainWorkers(workerTypes ...string) error {
+	_, err := drainWorkers(b.workersRunning, workerTypes, true)
+	return err
+}
+
+// ResumeWorkers ends the drain mode for the workers of the given types (or
+// all the workers if no type is given).
+func (b *redisBroker) ResumeWorkers(workerTypes ...string) error {
+	_, err := drainWorkers(b.workersRunning, workerTypes, false)
+	return err
+}
+
+// WorkersStats returns the metrics of the workers running on this process.
+// The queues are shared by all the stack processes.
+func (b *redisBroker) WorkersStats() ([]*WorkerStats, error) {
+	stats := make([]*WorkerStats, 0, len(b.workersRunning))
+	for _, w := range b.workersRunning {
+		queueLen, err := b.WorkerQueueLen(w.Type)
+		if err != nil {
+			return nil, err
+		}
+		var oldest time.Time
+		if queueLen > 0 {
+			oldest = b.workerQueueOldest(w.Type)
+		}
+		stats = append(stats, newWorkerStats(w, queueLen, oldest))
+	}
+	return stats, nil
+}
+
 func (b *redisBroker) WorkerIsReserved(workerType string) (bool, error) {
 	for _, w := range b.workers {
 		if w.Type == workerType {
@@ -287,3 +634,69 @@ func (b *redisBroker) WorkerIsReserved(workerType string) (bool, error) {
 	}
 	return false, ErrUnknownWorker
 }
+
+// acquireScript removes the expired slots, and adds a slot for the holder if
+// the limit has not been reached. It returns 1 if the slot has been taken, or
+// 0 if the limit has been reached.
+var acquireScript = redis.NewScript(`
+local now = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+  if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+    return 0
+  end
+end
+local ttl = tonumber(ARGV[4])
+redis.call("ZADD", KEYS[1], now + ttl, ARGV[1])
+if redis.call("PTTL", KEYS[1]) < ttl then
+  redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// redisConcurrency is the implementation of the concurrencyLimiter with redis,
+// where the counters are shared by all the stack processes.
+type redisConcurrency struct {
+	broker *redisBroker
+}
+
+func (r *redisConcurrency) acquire(db prefixer.Prefixer, workerType, holder string, limit int) (bool, error) {
+	key := redisConcurrencyPrefix + concurrencyKey(db, workerType)
+	now := time.Now().UnixMilli()
+	ttl := redisConcurrencyTTL.Milliseconds()
+	ok, err := acquireScript.Run(r.broker.ctx, r.broker.client, []string{key}, holder, limit, now, ttl).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (r *redisConcurrency) release(db prefixer.Prefixer, workerType, holder string) error {
+	key := redisConcurrencyPrefix + concurrencyKey(db, workerType)
+	return r.broker.client.ZRem(r.broker.ctx, key, holder).Err()
+}
+
+func (r *redisConcurrency) inFlight(db prefixer.Prefixer, workerType string) (int, error) {
+	key := redisConcurrencyPrefix + concurrencyKey(db, workerType)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	n, err := r.broker.client.ZCount(r.broker.ctx, key, "("+now, "+inf").Result()
+	return int(n), err
+}
+
+// requeue puts the job in a sorted set of delayed jobs, and the heartbeat
+// loop of the stack processes will put it back in its queue when the delay
+// has elapsed.
+func (r *redisConcurrency) requeue(job *Job, delay time.Duration) error {
+	b := r.broker
+	if delay <= 0 {
+		return b.enqueue(job)
+	}
+	key := redisDelayedPrefix + job.WorkerType
+	if job.Manual {
+		key += redisHighPrioritySuffix
+	}
+	return b.client.ZAdd(b.ctx, key, redis.Z{
+		Score:  float64(time.Now().Add(delay).UnixMilli()),
+		Member: queueValue(job),
+	}).Err()
+}
@@ -120,6 +120,65 @@ func TestRedisBroker(t *testing.T) {
 		time.Sleep(1 * time.Second)
 	})
 
+	t.Run("RedisHandBackInFlightJobs", func(t *testing.T) {
+		job.SetRedisTimeoutForTest()
+		opts1, _ := redis.ParseURL(redisURL1)
+		client1 := redis.NewClient(opts1)
+
+		started := make(chan string, 2)
+		release := make(chan struct{})
+		defer close(release)
+		workersTestList := job.WorkersList{
+			{
+				WorkerType:   "handback",
+				Concurrency:  1,
+				MaxExecCount: 1,
+				Timeout:      time.Minute,
+				WorkerFunc: func(ctx *job.WorkerContext) error {
+					started <- ctx.JobID()
+					<-release
+					return nil
+				},
+			},
+		}
+
+		broker1 := job.NewRedisBroker(client1)
+		err := broker1.StartWorkers(workersTestList)
+		assert.NoError(t, err)
+		msg, _ := job.NewMessage("slow")
+		j, err := broker1.PushJob(testInstance, &job.JobRequest{
+			WorkerType: "handback",
+			Message:    msg,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, j.ID(), <-started)
+
+		// The job is still running when the shutdown delay is over
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		err = broker1.ShutdownWorkers(ctx)
+		assert.Error(t, err)
+
+		// It is not given back while its process is alive
+		broker2 := job.NewRedisBroker(client1)
+		err = broker2.StartWorkers(workersTestList)
+		assert.NoError(t, err)
+		defer func() { _ = broker2.ShutdownWorkers(context.Background()) }()
+		select {
+		case <-started:
+			t.Fatal("the job should not be given back before the heartbeat has expired")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		// But it is after the heartbeat of the process has expired
+		select {
+		case id := <-started:
+			assert.Equal(t, j.ID(), id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the job should have been given back to the broker")
+		}
+	})
+
 	t.Run("RedisAddJobRateLimitExceeded", func(t *testing.T) {
 		opts1, _ := redis.ParseURL(redisURL1)
 		client1 := redis.NewClient(opts1)
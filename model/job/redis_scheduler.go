@@ -59,6 +59,7 @@ type redisScheduler struct {
 	client  redis.UniversalClient
 	ctx     context.Context
 	thumb   *ThumbnailTrigger
+	photo   *PhotoGroupTrigger
 	closed  chan struct{}
 	stopped chan struct{}
 	log     *logger.Entry
@@ -99,6 +100,8 @@ func (s *redisScheduler) StartScheduler(b Broker) error {
 	s.startEventDispatcher()
 	s.thumb = NewThumbnailTrigger(s.broker)
 	go s.thumb.Schedule()
+	s.photo = NewPhotoGroupTrigger(s.broker)
+	go s.photo.Schedule()
 	go s.pollLoop()
 	return nil
 }
@@ -179,6 +182,9 @@ func (s *redisScheduler) eventLoop(eventsCh <-chan *realtime.Event) {
 				_ = s.deleteTrigger(t)
 				continue
 			}
+			if pausedByMaintenance(t) {
+				continue
+			}
 			et := t.(*EventTrigger)
 			if et.Infos().Debounce != "" {
 				var d time.Duration
@@ -252,6 +258,7 @@ func (s *redisScheduler) ShutdownScheduler(ctx context.Context) error {
 	fmt.Print("  shutting down redis scheduler...")
 	close(s.closed)
 	s.thumb.Unschedule()
+	s.photo.Unschedule()
 	select {
 	case <-ctx.Done():
 		fmt.Println("failed: ", ctx.Err())
@@ -304,6 +311,10 @@ func (s *redisScheduler) PollScheduler(now int64) error {
 			if err = s.client.ZRem(s.ctx, SchedKey, results[0]).Err(); err != nil {
 				return err
 			}
+			if pausedByMaintenance(t) {
+				s.client.Del(s.ctx, payloadKey(t))
+				continue
+			}
 			switch t.CombineRequest() {
 			case appendPayload:
 				pipe := s.client.Pipeline()
@@ -336,15 +347,19 @@ func (s *redisScheduler) PollScheduler(now int64) error {
 				return err
 			}
 		case *CronTrigger:
-			job := t.Infos().JobRequest()
-			if _, err = s.broker.PushJob(t, job); err != nil {
-				// Remove the cron trigger from redis if it is invalid, as it
-				// may block other cron triggers
-				if errors.Is(err, ErrUnknownWorker) || limits.IsLimitReachedOrExceeded(err) {
-					s.client.ZRem(s.ctx, SchedKey, results[0])
-					continue
+			// During the maintenance, the occurrence is skipped, and the
+			// next one is scheduled
+			if !pausedByMaintenance(t) {
+				job := t.Infos().JobRequest()
+				if _, err = s.broker.PushJob(t, job); err != nil {
+					// Remove the cron trigger from redis if it is invalid, as it
+					// may block other cron triggers
+					if errors.Is(err, ErrUnknownWorker) || limits.IsLimitReachedOrExceeded(err) {
+						s.client.ZRem(s.ctx, SchedKey, results[0])
+						continue
+					}
+					return err
 				}
-				return err
 			}
 			score, err := strconv.ParseInt(results[1].(string), 10, 64)
 			var prev time.Time
@@ -465,6 +480,7 @@ func (s *redisScheduler) deleteTrigger(t Trigger) error {
 	if err := couchdb.DeleteDoc(t, t.Infos()); err != nil {
 		return err
 	}
+	deleteTriggerHistory(t, t.ID())
 	switch t.(type) {
 	case *EventTrigger:
 		return s.client.HDel(s.ctx, eventsKey(t), t.ID()).Err()
@@ -511,6 +511,10 @@ func (b *mockBroker) WorkerQueueLen(workerType string) (int, error) {
 	return count, nil
 }
 
+func (b *mockBroker) WorkerInFlight(db prefixer.Prefixer, workerType string) (int, error) {
+	return 0, nil
+}
+
 func (b *mockBroker) WorkerIsReserved(workerType string) (bool, error) {
 	return false, nil
 }
@@ -519,6 +523,18 @@ func (b *mockBroker) WorkersTypes() []string {
 	return []string{}
 }
 
+func (b *mockBroker) DrainWorkers(workerTypes ...string) error {
+	return nil
+}
+
+func (b *mockBroker) ResumeWorkers(workerTypes ...string) error {
+	return nil
+}
+
+func (b *mockBroker) WorkersStats() ([]*job.WorkerStats, error) {
+	return []*job.WorkerStats{}, nil
+}
+
 func (d fakeFilePather) FilePath(doc *vfs.FileDoc) (string, error) {
 	return d.Fullpath, nil
 }
@@ -0,0 +1,121 @@
+package job
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+)
+
+// DefaultErrorClass is the error class used for the errors that have no
+// specific retry policy.
+const DefaultErrorClass = "default"
+
+type (
+	// RetryOptions are the options of a job that retries a failed job.
+	RetryOptions struct {
+		// Attempt is the number of the retry, starting at 1
+		Attempt int `json:"attempt"`
+		// JobID is the identifier of the failed job
+		JobID string `json:"job_id"`
+		// TriggerID is the identifier of the trigger of the failed job
+		TriggerID string `json:"trigger_id,omitempty"`
+	}
+
+	// JobRetry is the retry schedule of a failed job, as given by the retry
+	// policy for its error class. NextAt is empty when the job won't be
+	// retried.
+	JobRetry struct {
+		ErrorClass string     `json:"error_class"`
+		Attempt    int        `json:"attempt,omitempty"`
+		NextAt     *time.Time `json:"next_at,omitempty"`
+	}
+)
+
+// retryPolicyFor returns the retry policy for the given error class. For an
+// error class like VENDOR_DOWN.BANK_DOWN, the policy for VENDOR_DOWN is used
+// when there is no specific policy, and the policy for the DefaultErrorClass
+// is the last fallback. The classes are case-insensitive, as the keys of the
+// configuration file are lowercased.
+func retryPolicyFor(policies map[string]config.RetryPolicy, class string) (config.RetryPolicy, bool) {
+	for {
+		for k, policy := range policies {
+			if strings.EqualFold(k, class) {
+				return policy, true
+			}
+		}
+		idx := strings.LastIndex(class, ".")
+		if idx < 0 {
+			break
+		}
+		class = class[:idx]
+	}
+	policy, ok := policies[DefaultErrorClass]
+	return policy, ok
+}
+
+// retryDelay returns the delay before the given retry attempt (starting at
+// 1), with an exponential backoff.
+func retryDelay(policy config.RetryPolicy, attempt int) time.Duration {
+	delay := policy.Delay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if policy.MaxDelay > 0 && delay >= policy.MaxDelay {
+			break
+		}
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
+
+// scheduleRetry adds an @at trigger to retry the failed job later, if the
+// retry policy of the worker for the error class allows it. The retry
+// schedule is kept in the job document.
+func (t *task) scheduleRetry(errjob error) {
+	if len(t.conf.Retries) == 0 || t.job.Manual || globalJobSystem == nil {
+		return
+	}
+	class := DefaultErrorClass
+	if t.conf.ErrorClass != nil {
+		class = t.conf.ErrorClass(errjob)
+	}
+	attempt := 1
+	if t.job.Options != nil && t.job.Options.Retry != nil {
+		attempt = t.job.Options.Retry.Attempt + 1
+	}
+	t.job.Retry = &JobRetry{ErrorClass: class}
+	policy, ok := retryPolicyFor(t.conf.Retries, class)
+	if !ok || t.noRetry || attempt > policy.MaxRetries {
+		return
+	}
+
+	opts := &JobOptions{}
+	if t.job.Options != nil {
+		*opts = *t.job.Options
+	}
+	opts.Retry = &RetryOptions{
+		Attempt:   attempt,
+		JobID:     t.job.ID(),
+		TriggerID: t.job.TriggerID,
+	}
+	at := time.Now().Add(retryDelay(policy, attempt)).UTC()
+	trigger, err := NewTrigger(t.job, TriggerInfos{
+		Type:       "@at",
+		WorkerType: t.job.WorkerType,
+		Arguments:  at.Format(time.RFC3339),
+		Options:    opts,
+		Message:    t.job.Message,
+	}, nil)
+	if err == nil {
+		err = globalJobSystem.AddTrigger(trigger)
+	}
+	if err != nil {
+		t.ctx.Logger().Warnf("Cannot schedule the retry of the job: %s", err)
+		return
+	}
+	t.job.Retry.Attempt = attempt
+	t.job.Retry.NextAt = &at
+	t.ctx.Logger().Infof("Job retry %d for %s scheduled at %s", attempt, class, at)
+}
@@ -0,0 +1,43 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	policies := map[string]config.RetryPolicy{
+		"network":     {MaxRetries: 3, Delay: 5 * time.Minute, MaxDelay: 15 * time.Minute},
+		"VENDOR_DOWN": {MaxRetries: 1, Delay: 24 * time.Hour},
+	}
+
+	t.Run("RetryPolicyFor", func(t *testing.T) {
+		policy, ok := retryPolicyFor(policies, "NETWORK")
+		assert.True(t, ok)
+		assert.Equal(t, 3, policy.MaxRetries)
+
+		policy, ok = retryPolicyFor(policies, "VENDOR_DOWN.BANK_DOWN")
+		assert.True(t, ok)
+		assert.Equal(t, 24*time.Hour, policy.Delay)
+
+		_, ok = retryPolicyFor(policies, "LOGIN_FAILED")
+		assert.False(t, ok)
+
+		policies[DefaultErrorClass] = config.RetryPolicy{MaxRetries: 1, Delay: time.Hour}
+		defer delete(policies, DefaultErrorClass)
+		policy, ok = retryPolicyFor(policies, "LOGIN_FAILED")
+		assert.True(t, ok)
+		assert.Equal(t, time.Hour, policy.Delay)
+	})
+
+	t.Run("RetryDelay", func(t *testing.T) {
+		policy := policies["network"]
+		assert.Equal(t, 5*time.Minute, retryDelay(policy, 1))
+		assert.Equal(t, 10*time.Minute, retryDelay(policy, 2))
+		assert.Equal(t, 15*time.Minute, retryDelay(policy, 3))
+		assert.Equal(t, 24*time.Hour, retryDelay(policies["VENDOR_DOWN"], 1))
+	})
+}
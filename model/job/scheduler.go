@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -68,6 +69,7 @@ type (
 		Arguments    string                 `json:"arguments"`
 		Debounce     string                 `json:"debounce"`
 		Options      *JobOptions            `json:"options"`
+		Timezone     string                 `json:"timezone,omitempty"`
 		Message      Message                `json:"message"`
 		CurrentState *TriggerState          `json:"current_state,omitempty"`
 		Metadata     *metadata.CozyMetadata `json:"cozyMetadata,omitempty"`
@@ -107,6 +109,33 @@ func (t *TriggerInfos) DomainName() string {
 	return t.Domain
 }
 
+// isCalendarAware returns true for the triggers whose executions depend on
+// the timezone (like "every monday at 8am").
+func (t *TriggerInfos) isCalendarAware() bool {
+	switch t.Type {
+	case "@cron", "@daily", "@weekly", "@monthly", "@yearly":
+		return true
+	}
+	return false
+}
+
+// pausedByMaintenance returns true if the trigger must not fire because its
+// instance is in maintenance. Only the recurring triggers (cron and event)
+// are paused: the @at triggers fire, and their jobs are paused by the
+// workers until the end of the maintenance.
+func pausedByMaintenance(t Trigger) bool {
+	switch t.(type) {
+	case *CronTrigger, *EventTrigger:
+	default:
+		return false
+	}
+	if isWorkerTypeIn(t.Infos().WorkerType, maintenanceWorkers) {
+		return false
+	}
+	inst, err := instance.Get(t.DomainName())
+	return err == nil && inst.InMaintenance()
+}
+
 func (t *TriggerInfos) IsKonnectorTrigger() bool {
 	return t.WorkerType == "konnector" || t.WorkerType == "client"
 }
@@ -127,6 +156,13 @@ func NewTrigger(db prefixer.Prefixer, infos TriggerInfos, data interface{}) (Tri
 	infos.Prefix = db.DBPrefix()
 	infos.Domain = db.DomainName()
 
+	// The calendar-aware triggers use the timezone of the user by default
+	if infos.Timezone == "" && infos.isCalendarAware() {
+		if inst, ok := db.(*instance.Instance); ok {
+			infos.Timezone = inst.SettingsTimezone()
+		}
+	}
+
 	// Adding metadata
 	md := metadata.New()
 	md.DocTypeVersion = DocTypeVersionTrigger
@@ -153,6 +189,8 @@ func fromTriggerInfos(infos *TriggerInfos) (Trigger, error) {
 		return NewWeeklyTrigger(infos)
 	case "@monthly":
 		return NewMonthlyTrigger(infos)
+	case "@yearly":
+		return NewYearlyTrigger(infos)
 	case "@cron":
 		return NewCronTrigger(infos)
 	case "@every":
@@ -205,13 +243,19 @@ func (t *TriggerInfos) Clone() couchdb.Doc {
 // JobRequest returns a job request associated with the scheduler informations.
 func (t *TriggerInfos) JobRequest() *JobRequest {
 	trigger, _ := fromTriggerInfos(t)
-	return &JobRequest{
+	req := &JobRequest{
 		WorkerType: t.WorkerType,
 		TriggerID:  t.ID(),
 		Trigger:    trigger,
 		Message:    t.Message,
 		Options:    t.Options,
 	}
+	// The retry of a failed job is attached to the trigger of this job, not
+	// to the @at trigger used for scheduling the retry.
+	if t.Options != nil && t.Options.Retry != nil {
+		req.TriggerID = t.Options.Retry.TriggerID
+	}
+	return req
 }
 
 // JobRequestWithEvent returns a job request associated with the scheduler
@@ -223,9 +267,29 @@ func (t *TriggerInfos) JobRequestWithEvent(event *realtime.Event) (*JobRequest,
 	}
 	req := t.JobRequest()
 	req.Event = evt
+	if t.WorkerType == "konnector" {
+		req.DedupKey = konnectorDedupKey(t.Message)
+	}
 	return req, nil
 }
 
+// konnectorDedupKey returns the key used to coalesce the konnector jobs for
+// the same account, or an empty string if the message has no account.
+func konnectorDedupKey(msg Message) string {
+	var data struct {
+		Konnector      string `json:"konnector"`
+		Account        string `json:"account"`
+		AccountDeleted bool   `json:"account_deleted"`
+	}
+	if err := msg.Unmarshal(&data); err != nil {
+		return ""
+	}
+	if data.Konnector == "" || data.Account == "" || data.AccountDeleted {
+		return ""
+	}
+	return "konnector/" + data.Konnector + "/" + data.Account
+}
+
 // SetID implements the couchdb.Doc interface
 func (t *TriggerInfos) SetID(id string) { t.TID = id }
 
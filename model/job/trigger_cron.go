@@ -3,7 +3,11 @@ package job
 import (
 	"fmt"
 	"time"
+	_ "time/tzdata" // for the timezones of the triggers
 
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
 	"github.com/robfig/cron/v3"
 )
 
@@ -15,6 +19,12 @@ type CronTrigger struct {
 	done  chan struct{}
 }
 
+// KonnectorNextAvailable is used to shift the executions of the konnectors
+// out of the windows where their provider is known to be unavailable. It
+// returns the first moment after t where the provider of the konnector is
+// available. It is set by the konnector worker.
+var KonnectorNextAvailable func(db prefixer.Prefixer, slug string, t time.Time) (time.Time, error)
+
 var (
 	cronParser     = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
 	periodicParser = NewPeriodicParser()
@@ -26,6 +36,9 @@ func NewCronTrigger(infos *TriggerInfos) (*CronTrigger, error) {
 	if err != nil {
 		return nil, ErrMalformedTrigger
 	}
+	if err := withTimezone(schedule, infos.Timezone); err != nil {
+		return nil, ErrMalformedTrigger
+	}
 	return &CronTrigger{
 		TriggerInfos: infos,
 		sched:        schedule,
@@ -54,6 +67,13 @@ func NewMonthlyTrigger(infos *TriggerInfos) (*CronTrigger, error) {
 	return newPeriodicTrigger(infos, MonthlyKind)
 }
 
+// NewYearlyTrigger returns a new instance of CronTrigger given the specified
+// options as @yearly. It will take a random month/day/hour in the possible
+// range to spread the triggers from the same app manifest.
+func NewYearlyTrigger(infos *TriggerInfos) (*CronTrigger, error) {
+	return newPeriodicTrigger(infos, YearlyKind)
+}
+
 // NewWeeklyTrigger returns a new instance of CronTrigger given the specified
 // options as @weekly. It will take a random day/hour in the possible range to
 // spread the triggers from the same app manifest.
@@ -81,11 +101,13 @@ func newPeriodicTrigger(infos *TriggerInfos, frequency FrequencyKind) (*CronTrig
 		return nil, ErrMalformedTrigger
 	}
 	seed := fmt.Sprintf("%s/%s/%v", infos.Domain, infos.WorkerType, infos.Message)
-	crontab := spec.ToRandomCrontab(seed)
-	schedule, err := cronParser.Parse(crontab)
+	schedule, err := spec.ToRandomSchedule(seed)
 	if err != nil {
 		return nil, ErrMalformedTrigger
 	}
+	if err := withTimezone(schedule, infos.Timezone); err != nil {
+		return nil, ErrMalformedTrigger
+	}
 	return &CronTrigger{
 		TriggerInfos: infos,
 		sched:        schedule,
@@ -93,14 +115,94 @@ func newPeriodicTrigger(infos *TriggerInfos, frequency FrequencyKind) (*CronTrig
 	}, nil
 }
 
+// ToRandomSchedule returns a schedule for the crontab generated by
+// ToRandomCrontab, restricted to the week of the month if needed.
+func (s *PeriodicSpec) ToRandomSchedule(seed string) (cron.Schedule, error) {
+	schedule, err := cronParser.Parse(s.ToRandomCrontab(seed))
+	if err != nil {
+		return nil, err
+	}
+	if s.WeekOfMonth == 0 {
+		return schedule, nil
+	}
+	return &weekOfMonthSchedule{week: s.WeekOfMonth, weekly: schedule}, nil
+}
+
+// withTimezone sets the location of the schedule to the given timezone. The
+// cron library computes the next executions in this location, so that a
+// trigger "at 8am" is still fired at 8am local time after a DST change.
+func withTimezone(schedule cron.Schedule, timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return err
+	}
+	switch s := schedule.(type) {
+	case *cron.SpecSchedule:
+		s.Location = loc
+	case *weekOfMonthSchedule:
+		return withTimezone(s.weekly, timezone)
+	}
+	return nil
+}
+
+// weekOfMonthSchedule is used for the triggers like "on the first monday":
+// the weekly schedule gives the mondays, and only the mondays in the right
+// week of the month are kept.
+type weekOfMonthSchedule struct {
+	week   int // 1 to 4, or -1 for the last week
+	weekly cron.Schedule
+}
+
+// Next implements the cron.Schedule interface.
+func (s *weekOfMonthSchedule) Next(t time.Time) time.Time {
+	// A day of the week is in the same week of the month at least once every
+	// 5 weeks, and once a year when a month is also required.
+	for i := 0; i < 60; i++ {
+		t = s.weekly.Next(t)
+		if t.IsZero() || s.inWeek(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *weekOfMonthSchedule) inWeek(t time.Time) bool {
+	day := t.Day()
+	if s.week < 0 {
+		daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		return day+7 > daysInMonth
+	}
+	return (day-1)/7+1 == s.week
+}
+
 // Type implements the Type method of the Trigger interface.
 func (c *CronTrigger) Type() string {
 	return c.TriggerInfos.Type
 }
 
-// NextExecution returns the next time when a job should be fired for this trigger
+// NextExecution returns the next time when a job should be fired for this
+// trigger. For a konnector, the execution can be delayed until its provider
+// is available.
 func (c *CronTrigger) NextExecution(last time.Time) time.Time {
-	return c.sched.Next(last)
+	next := c.sched.Next(last)
+	if next.IsZero() || c.WorkerType != "konnector" || KonnectorNextAvailable == nil {
+		return next
+	}
+	var msg struct {
+		Konnector string `json:"konnector"`
+	}
+	if err := c.Message.Unmarshal(&msg); err != nil || msg.Konnector == "" {
+		return next
+	}
+	shifted, err := KonnectorNextAvailable(c.TriggerInfos, msg.Konnector, next)
+	if err != nil {
+		joblog.Warnf("Cannot check the availability of the konnector %s: %s", msg.Konnector, err)
+		return next
+	}
+	return shifted
 }
 
 // Schedule implements the Schedule method of the Trigger interface.
@@ -137,4 +239,46 @@ func (c *CronTrigger) CombineRequest() string {
 	return keepOriginalRequest
 }
 
+// dailyTriggerCheckedTTL is how long the stack remembers that a daily trigger
+// of an instance exists, before checking it again.
+const dailyTriggerCheckedTTL = 24 * time.Hour
+
+// EnsureDailyTrigger adds a @cron trigger that runs the worker once a day for
+// the instance, if it doesn't exist yet. It is called on the hot paths, so
+// the check is remembered in the cache for a day.
+func EnsureDailyTrigger(inst *instance.Instance, workerType string, msg interface{}) {
+	// 1. Check if the trigger has already been checked recently
+	cache := config.GetConfig().CacheStorage
+	cacheKey := workerType + "-trigger:" + inst.Domain
+	if _, ok := cache.Get(cacheKey); ok {
+		return
+	}
+
+	// 2. Check if the trigger already exists
+	sched := System()
+	infos := TriggerInfos{
+		Type:       "@cron",
+		WorkerType: workerType,
+	}
+	if sched.HasTrigger(inst, infos) {
+		cache.Set(cacheKey, []byte("1"), dailyTriggerCheckedTTL)
+		return
+	}
+
+	// 3. Create the trigger
+	now := time.Now()
+	hours := (now.Hour() + 12) % 24
+	infos.Arguments = fmt.Sprintf("0 %d %d * * *", now.Minute(), hours)
+	trigger, err := NewTrigger(inst, infos, msg)
+	if err != nil {
+		inst.Logger().Errorf("Cannot create %s trigger: %s", workerType, err)
+		return
+	}
+	if err = sched.AddTrigger(trigger); err != nil {
+		inst.Logger().Errorf("Cannot create %s trigger: %s", workerType, err)
+		return
+	}
+	cache.Set(cacheKey, []byte("1"), dailyTriggerCheckedTTL)
+}
+
 var _ Trigger = &CronTrigger{}
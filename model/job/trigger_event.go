@@ -2,6 +2,7 @@ package job
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/cozy/cozy-stack/model/permission"
@@ -157,13 +158,13 @@ func eventMatchRule(e *realtime.Event, rule *permission.Rule) bool {
 	} else {
 		// Selector with normal values
 		if v, ok := e.Doc.(permission.Fetcher); ok {
-			if rule.ValuesMatch(v) {
+			if valuesMatch(rule, v) {
 				return true
 			}
 			// Particular case where the new doc is not valid but the old one was.
 			if e.OldDoc != nil {
 				if vOld, okOld := e.OldDoc.(permission.Fetcher); okOld {
-					return rule.ValuesMatch(vOld)
+					return valuesMatch(rule, vOld)
 				}
 			}
 		}
@@ -172,6 +173,58 @@ func eventMatchRule(e *realtime.Event, rule *permission.Rule) bool {
 	return false
 }
 
+// valuesMatch is like permission.Rule.ValuesMatch, with the extensions used
+// by the sharing rules: the selector can be a dotted path to a field inside a
+// nested object of a JSON document, and a value ending with a * matches all
+// the values that start with this prefix.
+func valuesMatch(rule *permission.Rule, doc permission.Fetcher) bool {
+	var candidates []string
+	if j, ok := doc.(*couchdb.JSONDoc); ok && strings.Contains(rule.Selector, ".") {
+		candidates = fetchNested(j.M, rule.Selector)
+	} else {
+		candidates = doc.Fetch(rule.Selector)
+	}
+	for _, v := range rule.Values {
+		prefix := strings.TrimSuffix(v, "*")
+		for _, candidate := range candidates {
+			if candidate == v {
+				return true
+			}
+			if prefix != v && prefix != "" && strings.HasPrefix(candidate, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fetchNested returns the values of the field at the given dotted path.
+func fetchNested(doc map[string]interface{}, path string) []string {
+	var obj interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		obj = m[key]
+	}
+	switch val := obj.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{val}
+	case []interface{}:
+		var values []string
+		for _, v := range val {
+			if str, ok := v.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	}
+	return []string{fmt.Sprintf("%v", obj)}
+}
+
 // DumpFilePather is a struct made for calling the Path method of a FileDoc and
 // relying on the cached fullpath of this document (not trying to rebuild it)
 type DumpFilePather struct{}
@@ -0,0 +1,42 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventMatchRuleWithSharingSelectors(t *testing.T) {
+	bill := func(vendor, provider string) *couchdb.JSONDoc {
+		return &couchdb.JSONDoc{
+			Type: "io.cozy.bills",
+			M: map[string]interface{}{
+				"_id":      "bill1",
+				"vendor":   vendor,
+				"metadata": map[string]interface{}{"provider": provider},
+			},
+		}
+	}
+	match := func(args string, doc, old *couchdb.JSONDoc) bool {
+		rule, err := permission.UnmarshalRuleString(args)
+		require.NoError(t, err)
+		evt := &realtime.Event{Verb: realtime.EventUpdate, Doc: doc}
+		if old != nil {
+			evt.OldDoc = old
+		}
+		return eventMatchRule(evt, &rule)
+	}
+
+	assert.True(t, match("io.cozy.bills:UPDATED:EDF*:vendor", bill("EDF Pro", ""), nil))
+	assert.False(t, match("io.cozy.bills:UPDATED:EDF*:vendor", bill("Engie", ""), nil))
+	assert.True(t, match("io.cozy.bills:UPDATED:EDF*:vendor", bill("Engie", ""), bill("EDF", "")))
+	assert.False(t, match("io.cozy.bills:UPDATED:EDF:vendor", bill("EDF Pro", ""), nil))
+
+	assert.True(t, match("io.cozy.bills:UPDATED:EDF:metadata.provider", bill("", "EDF"), nil))
+	assert.False(t, match("io.cozy.bills:UPDATED:EDF:metadata.provider", bill("", "Engie"), nil))
+	assert.True(t, match("io.cozy.bills:UPDATED:ED*:metadata.provider", bill("", "EDF"), nil))
+}
@@ -214,6 +214,31 @@ func TestTrigger(t *testing.T) {
 		err := sch.ShutdownScheduler(context.Background())
 		assert.NoError(t, err)
 	})
+
+	t.Run("KonnectorDedupKey", func(t *testing.T) {
+		evt := &realtime.Event{Verb: realtime.EventUpdate, Doc: &couchdb.JSONDoc{Type: "io.cozy.files"}}
+		msg, err := job.NewMessage(map[string]interface{}{
+			"konnector": "foo",
+			"account":   "123",
+		})
+		require.NoError(t, err)
+		infos := &job.TriggerInfos{Type: "@event", WorkerType: "konnector", Message: msg}
+		req, err := infos.JobRequestWithEvent(evt)
+		require.NoError(t, err)
+		assert.Equal(t, "konnector/foo/123", req.DedupKey)
+
+		msg, err = job.NewMessage(map[string]interface{}{"konnector": "foo"})
+		require.NoError(t, err)
+		infos.Message = msg
+		req, err = infos.JobRequestWithEvent(evt)
+		require.NoError(t, err)
+		assert.Empty(t, req.DedupKey)
+
+		infos = &job.TriggerInfos{Type: "@event", WorkerType: "service", Message: msg}
+		req, err = infos.JobRequestWithEvent(evt)
+		require.NoError(t, err)
+		assert.Empty(t, req.DedupKey)
+	})
 }
 
 func makeMessage(t *testing.T, msg string) job.Message {
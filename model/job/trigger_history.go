@@ -0,0 +1,164 @@
+package job
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// historyMaxEntries is the number of executions kept in the history of a
+// trigger: the oldest entries are removed when this number is reached.
+const historyMaxEntries = 100
+
+// HistoryEntry is an execution of a trigger, kept in its history.
+type HistoryEntry struct {
+	FiredAt  time.Time `json:"fired_at"`
+	JobID    string    `json:"job_id"`
+	Outcome  State     `json:"outcome"`
+	Duration float64   `json:"duration"` // in seconds
+	Manual   bool      `json:"manual,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// TriggerHistory is a rolling store of the last executions of a trigger. It
+// is kept even when the jobs are purged, and the document has the same ID as
+// the trigger.
+type TriggerHistory struct {
+	DocID   string          `json:"_id,omitempty"`
+	DocRev  string          `json:"_rev,omitempty"`
+	Entries []*HistoryEntry `json:"entries"`
+}
+
+// TriggerStats are the statistics computed from the history of a trigger.
+type TriggerStats struct {
+	Executions      int        `json:"executions"`
+	Successes       int        `json:"successes"`
+	Failures        int        `json:"failures"`
+	SuccessRate     float64    `json:"success_rate"`
+	AverageDuration float64    `json:"average_duration"` // in seconds
+	LastSuccess     *time.Time `json:"last_success,omitempty"`
+	LastFailure     *time.Time `json:"last_failure,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// ID implements the couchdb.Doc interface
+func (h *TriggerHistory) ID() string { return h.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (h *TriggerHistory) Rev() string { return h.DocRev }
+
+// DocType implements the couchdb.Doc interface
+func (h *TriggerHistory) DocType() string { return consts.TriggersHistory }
+
+// SetID implements the couchdb.Doc interface
+func (h *TriggerHistory) SetID(id string) { h.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (h *TriggerHistory) SetRev(rev string) { h.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (h *TriggerHistory) Clone() couchdb.Doc {
+	cloned := *h
+	cloned.Entries = make([]*HistoryEntry, len(h.Entries))
+	for i, entry := range h.Entries {
+		e := *entry
+		cloned.Entries[i] = &e
+	}
+	return &cloned
+}
+
+// Add appends an entry to the history, and removes the oldest entries if
+// the history is full.
+func (h *TriggerHistory) Add(entry *HistoryEntry) {
+	h.Entries = append(h.Entries, entry)
+	if extra := len(h.Entries) - historyMaxEntries; extra > 0 {
+		h.Entries = h.Entries[extra:]
+	}
+}
+
+// Stats computes the statistics of the executions in the history.
+func (h *TriggerHistory) Stats() *TriggerStats {
+	stats := &TriggerStats{}
+	var total float64
+	for _, entry := range h.Entries {
+		stats.Executions++
+		total += entry.Duration
+		firedAt := entry.FiredAt
+		switch entry.Outcome {
+		case Done:
+			stats.Successes++
+			stats.LastSuccess = &firedAt
+		case Errored:
+			stats.Failures++
+			stats.LastFailure = &firedAt
+			stats.LastError = entry.Error
+		}
+	}
+	if stats.Executions > 0 {
+		stats.SuccessRate = float64(stats.Successes) / float64(stats.Executions)
+		stats.AverageDuration = total / float64(stats.Executions)
+	}
+	return stats
+}
+
+// GetTriggerHistory returns the history of the executions of a trigger. An
+// empty history is returned if the trigger has never been executed.
+func GetTriggerHistory(db prefixer.Prefixer, triggerID string) (*TriggerHistory, error) {
+	var history TriggerHistory
+	err := couchdb.GetDoc(db, consts.TriggersHistory, triggerID, &history)
+	if couchdb.IsNotFoundError(err) {
+		return &TriggerHistory{DocID: triggerID, Entries: []*HistoryEntry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// RecordExecution adds a finished job to the history of its trigger.
+func RecordExecution(j *Job) error {
+	entry := &HistoryEntry{
+		FiredAt: j.QueuedAt,
+		JobID:   j.ID(),
+		Outcome: j.State,
+		Manual:  j.Manual,
+		Error:   j.Error,
+	}
+	if !j.StartedAt.IsZero() && j.FinishedAt.After(j.StartedAt) {
+		entry.Duration = j.FinishedAt.Sub(j.StartedAt).Seconds()
+	}
+
+	// The jobs of a trigger can be executed concurrently, so we retry on
+	// conflicts.
+	var err error
+	for i := 0; i < 3; i++ {
+		var history *TriggerHistory
+		history, err = GetTriggerHistory(j, j.TriggerID)
+		if err != nil {
+			return err
+		}
+		history.Add(entry)
+		if history.Rev() == "" {
+			err = couchdb.CreateNamedDocWithDB(j, history)
+		} else {
+			err = couchdb.UpdateDoc(j, history)
+		}
+		if !couchdb.IsConflictError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// deleteTriggerHistory removes the history of a trigger, when the trigger is
+// deleted.
+func deleteTriggerHistory(db prefixer.Prefixer, triggerID string) {
+	var history TriggerHistory
+	if err := couchdb.GetDoc(db, consts.TriggersHistory, triggerID, &history); err == nil {
+		_ = couchdb.DeleteDoc(db, &history)
+	}
+}
+
+var _ couchdb.Doc = &TriggerHistory{}
@@ -0,0 +1,51 @@
+package job_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggerHistory(t *testing.T) {
+	t.Run("Stats", func(t *testing.T) {
+		now := time.Now()
+		history := &job.TriggerHistory{}
+		history.Add(&job.HistoryEntry{FiredAt: now.Add(-3 * time.Hour), JobID: "1", Outcome: job.Errored, Duration: 2, Error: "LOGIN_FAILED"})
+		history.Add(&job.HistoryEntry{FiredAt: now.Add(-2 * time.Hour), JobID: "2", Outcome: job.Done, Duration: 10})
+		history.Add(&job.HistoryEntry{FiredAt: now.Add(-1 * time.Hour), JobID: "3", Outcome: job.Errored, Duration: 3, Error: "VENDOR_DOWN"})
+		history.Add(&job.HistoryEntry{FiredAt: now, JobID: "4", Outcome: job.Done, Duration: 25})
+
+		stats := history.Stats()
+		assert.Equal(t, 4, stats.Executions)
+		assert.Equal(t, 2, stats.Successes)
+		assert.Equal(t, 2, stats.Failures)
+		assert.Equal(t, 0.5, stats.SuccessRate)
+		assert.Equal(t, 10.0, stats.AverageDuration)
+		require.NotNil(t, stats.LastSuccess)
+		assert.True(t, stats.LastSuccess.Equal(now))
+		require.NotNil(t, stats.LastFailure)
+		assert.True(t, stats.LastFailure.Equal(now.Add(-1*time.Hour)))
+		assert.Equal(t, "VENDOR_DOWN", stats.LastError)
+	})
+
+	t.Run("EmptyStats", func(t *testing.T) {
+		stats := (&job.TriggerHistory{}).Stats()
+		assert.Equal(t, 0, stats.Executions)
+		assert.Equal(t, 0.0, stats.SuccessRate)
+		assert.Nil(t, stats.LastSuccess)
+	})
+
+	t.Run("RollingStore", func(t *testing.T) {
+		history := &job.TriggerHistory{}
+		for i := 0; i < 150; i++ {
+			history.Add(&job.HistoryEntry{JobID: strconv.Itoa(i), Outcome: job.Done})
+		}
+		require.Len(t, history.Entries, 100)
+		assert.Equal(t, "50", history.Entries[0].JobID)
+		assert.Equal(t, "149", history.Entries[99].JobID)
+	})
+}
@@ -0,0 +1,99 @@
+package job
+
+import (
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+)
+
+// PhotoGroupTrigger pushes a job for grouping the live photos and bursts when
+// an image or a video is created or renamed.
+type PhotoGroupTrigger struct {
+	broker      Broker
+	log         *logger.Entry
+	unscheduled chan struct{}
+}
+
+func NewPhotoGroupTrigger(broker Broker) *PhotoGroupTrigger {
+	return &PhotoGroupTrigger{
+		broker:      broker,
+		log:         logger.WithNamespace("scheduler"),
+		unscheduled: make(chan struct{}),
+	}
+}
+
+func (t *PhotoGroupTrigger) Schedule() {
+	sub := realtime.GetHub().SubscribeFirehose()
+	defer sub.Close()
+	for {
+		select {
+		case e := <-sub.Channel:
+			if t.match(e) {
+				t.pushJob(e)
+			}
+		case <-t.unscheduled:
+			return
+		}
+	}
+}
+
+func (t *PhotoGroupTrigger) match(e *realtime.Event) bool {
+	if e.Doc.DocType() != consts.Files {
+		return false
+	}
+	if e.Verb != realtime.EventCreate && e.Verb != realtime.EventUpdate {
+		return false
+	}
+
+	doc, ok := e.Doc.(permission.Fetcher)
+	if !ok {
+		return false
+	}
+	// The metadata are updated by the worker, and it must not loop on them
+	if e.Verb == realtime.EventUpdate {
+		old, ok := e.OldDoc.(permission.Fetcher)
+		if !ok || equalValues(old.Fetch("name"), doc.Fetch("name")) {
+			return false
+		}
+	}
+	for _, class := range doc.Fetch("class") {
+		if class == "image" || class == "video" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *PhotoGroupTrigger) pushJob(e *realtime.Event) {
+	event, err := NewEvent(e)
+	if err != nil {
+		return
+	}
+	req := &JobRequest{
+		WorkerType: "photo-group",
+		Message:    Message("{}"),
+		Event:      event,
+	}
+	log := t.log.WithField("domain", e.Domain)
+	log.Infof("trigger photo-group: Pushing new job")
+	if _, err := t.broker.PushJob(e, req); err != nil {
+		log.Errorf("trigger photo-group: Could not schedule a new job: %s", err.Error())
+	}
+}
+
+func (t *PhotoGroupTrigger) Unschedule() {
+	close(t.unscheduled)
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -8,10 +8,12 @@ import (
 	"math/rand"
 	"runtime"
 	"runtime/debug"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/metrics"
@@ -27,6 +29,35 @@ var (
 	defaultTimeout      = 10 * time.Second
 )
 
+var (
+	// deletionScheduledWorkers are the worker types that still run for an
+	// instance scheduled for deletion: the mails (to notify the sharing
+	// members) and the final destruction.
+	deletionScheduledWorkers = []string{"sendmail", "destroy-instance"}
+	// maintenanceWorkers are the worker types that still run for an instance
+	// in maintenance: the jobs pushed by the operators.
+	maintenanceWorkers = []string{"migrations", "destroy-instance"}
+	// legalHoldSkippedWorkers are the cleanup workers that are not run for an
+	// instance under legal hold: the data they would delete must be kept
+	// until the end of the hold, and they would fail halfway through.
+	legalHoldSkippedWorkers = []string{
+		"clean-audit",
+		"clean-access-logs",
+		"clean-konnector-logs",
+		"clean-old-trashed",
+		"clean-old-versions",
+	}
+)
+
+func isWorkerTypeIn(workerType string, list []string) bool {
+	for _, typ := range list {
+		if typ == workerType {
+			return true
+		}
+	}
+	return false
+}
+
 type (
 	// WorkerInitFunc is called at the start of the worker system, only once. It
 	// is not called before every job process. It can be useful to initialize a
@@ -70,6 +101,14 @@ type (
 		Reserved     bool // true when the clients must not push jobs for this worker
 		Timeout      time.Duration
 		RetryDelay   time.Duration
+
+		// ErrorClass returns the class of an error, used to choose the retry
+		// policy of a failed job. The DefaultErrorClass is used if it is nil.
+		ErrorClass func(err error) string
+		// Retries are the retry policies, by error class, for the jobs that
+		// have failed after MaxExecCount executions: a new job is scheduled
+		// later instead of waiting for the next execution of the trigger.
+		Retries map[string]config.RetryPolicy
 	}
 
 	// Worker is a unit of work that will consume from a queue and execute the do
@@ -80,6 +119,17 @@ type (
 		jobs    chan *Job
 		running uint32
 		closed  chan struct{}
+
+		// limiter is set by the broker to limit the number of jobs running
+		// at the same time for an instance
+		limiter concurrencyLimiter
+
+		// draining is 1 when the worker finishes its running jobs but doesn't
+		// take new ones
+		draining uint32
+		// inFlight are the jobs running on this worker, by ID
+		inFlight   map[string]*Job
+		inFlightMu sync.Mutex
 	}
 
 	// WorkerContext is a context.Context passed to the worker for each job
@@ -175,6 +225,11 @@ func (c *WorkerContext) ID() string {
 	return c.id
 }
 
+// JobID returns the identifier of the job executed by the worker.
+func (c *WorkerContext) JobID() string {
+	return c.job.ID()
+}
+
 // Logger return the logger associated with the worker context.
 func (c *WorkerContext) Logger() logger.Logger {
 	return c.log
@@ -222,8 +277,9 @@ func (c *WorkerContext) Manual() bool {
 // NewWorker creates a new instance of Worker with the given configuration.
 func NewWorker(conf *WorkerConfig) *Worker {
 	return &Worker{
-		Type: conf.WorkerType,
-		Conf: conf,
+		Type:     conf.WorkerType,
+		Conf:     conf,
+		inFlight: make(map[string]*Job),
 	}
 }
 
@@ -263,6 +319,92 @@ func (w *Worker) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// Drain puts the worker in drain mode: the running jobs are finished, but no
+// new job is taken from the queue.
+func (w *Worker) Drain() {
+	atomic.StoreUint32(&w.draining, 1)
+}
+
+// Resume ends the drain mode of the worker.
+func (w *Worker) Resume() {
+	atomic.StoreUint32(&w.draining, 0)
+}
+
+// Draining returns true if the worker is in drain mode.
+func (w *Worker) Draining() bool {
+	return atomic.LoadUint32(&w.draining) == 1
+}
+
+// InFlight returns the number of jobs running on this worker.
+func (w *Worker) InFlight() int {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	return len(w.inFlight)
+}
+
+func (w *Worker) trackJob(job *Job) {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	w.inFlight[job.ID()] = job
+}
+
+func (w *Worker) untrackJob(job *Job) {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	delete(w.inFlight, job.ID())
+}
+
+// takeInFlightJobs returns the jobs that are still running, and forgets them.
+// It is used on shutdown to give them back to the broker.
+func (w *Worker) takeInFlightJobs() []*Job {
+	w.inFlightMu.Lock()
+	defer w.inFlightMu.Unlock()
+	jobs := make([]*Job, 0, len(w.inFlight))
+	for id, job := range w.inFlight {
+		jobs = append(jobs, job)
+		delete(w.inFlight, id)
+	}
+	return jobs
+}
+
+// acquireSlot takes a slot for running the job when its instance has a limit
+// on the number of jobs running at the same time. If the limit has been
+// reached, the job is put back in the queue after a delay and requeued is
+// true.
+func (w *Worker) acquireSlot(job *Job, inst *instance.Instance) (acquired, requeued bool) {
+	if w.limiter == nil {
+		return false, false
+	}
+	limit := concurrencyLimit(inst, w.Type)
+	if limit <= 0 {
+		return false, false
+	}
+	ok, err := w.limiter.acquire(job, w.Type, job.ID(), limit)
+	if err != nil {
+		// Do not block the jobs if the counters are not available
+		joblog.Warnf("Cannot check the running jobs for %s: %s", job.Domain, err)
+		return false, false
+	}
+	if ok {
+		return true, false
+	}
+	if err := w.limiter.requeue(job, requeueDelay); err != nil {
+		joblog.Errorf("Cannot requeue job %s for %s: %s", job.ID(), job.Domain, err)
+		return false, false
+	}
+	return false, true
+}
+
+// releaseSlot gives back the slot taken by acquireSlot.
+func (w *Worker) releaseSlot(job *Job, acquired bool) {
+	if !acquired {
+		return
+	}
+	if err := w.limiter.release(job, w.Type, job.ID()); err != nil {
+		joblog.Warnf("Cannot release the slot of job %s for %s: %s", job.ID(), job.Domain, err)
+	}
+}
+
 func (w *Worker) work(workerID string, closed chan<- struct{}) {
 	for job := range w.jobs {
 		domain := job.Domain
@@ -290,13 +432,48 @@ func (w *Worker) work(workerID string, closed chan<- struct{}) {
 					continue
 				}
 			}
+			// Do not execute jobs for instances scheduled for deletion, and
+			// mark them as errored.
+			if inst.IsDeletionScheduled() && !isWorkerTypeIn(w.Type, deletionScheduledWorkers) {
+				joblog.Infof("Job %s for %s is not executed: %s", job.ID(), job.Domain, ErrDeletionScheduled)
+				if err := job.Nack(ErrDeletionScheduled.Error()); err != nil {
+					joblog.Errorf("Cannot nack job %s for %s: %s", job.ID(), job.Domain, err)
+				}
+				continue
+			}
+			// Skip the cleanup jobs for instances under legal hold.
+			if inst.UnderLegalHold() && isWorkerTypeIn(w.Type, legalHoldSkippedWorkers) {
+				joblog.Infof("Job %s for %s is skipped: %s", job.ID(), job.Domain, instance.ErrLegalHold)
+				if err := job.Ack(); err != nil {
+					joblog.Errorf("Cannot ack job %s for %s: %s", job.ID(), job.Domain, err)
+				}
+				continue
+			}
+			// Pause the jobs for instances in maintenance, except for the
+			// jobs pushed by the operators, and resume them at the end of the
+			// maintenance.
+			if inst.InMaintenance() && !isWorkerTypeIn(w.Type, maintenanceWorkers) {
+				if err := job.Pause(); err != nil {
+					joblog.Errorf("Cannot pause job %s for %s: %s", job.ID(), job.Domain, err)
+				}
+				continue
+			}
+		}
+		// Put the job back in the queue, after a delay, when its instance has
+		// already reached its limit of jobs running at the same time for this
+		// worker type.
+		acquired, requeued := w.acquireSlot(job, inst)
+		if requeued {
+			continue
 		}
 		parentCtx := NewWorkerContext(workerID, job, inst)
 		if err := job.AckConsumed(); err != nil {
 			parentCtx.Logger().Errorf("error acking consume job: %s",
 				err.Error())
+			w.releaseSlot(job, acquired)
 			continue
 		}
+		w.trackJob(job)
 		t := &task{
 			w:    w,
 			ctx:  parentCtx,
@@ -306,6 +483,8 @@ func (w *Worker) work(workerID string, closed chan<- struct{}) {
 		var runResultLabel string
 		var errAck error
 		errRun := t.run()
+		w.releaseSlot(job, acquired)
+		w.untrackJob(job)
 		if errRun == ErrAbort {
 			errRun = nil
 		}
@@ -313,6 +492,7 @@ func (w *Worker) work(workerID string, closed chan<- struct{}) {
 			parentCtx.Logger().Errorf("error while performing job: %s",
 				errRun.Error())
 			runResultLabel = metrics.WorkerExecResultErrored
+			t.scheduleRetry(errRun)
 			errAck = job.Nack(errRun.Error())
 		} else {
 			runResultLabel = metrics.WorkerExecResultSuccess
@@ -339,6 +519,12 @@ func (w *Worker) work(workerID string, closed chan<- struct{}) {
 				errAck.Error())
 		}
 
+		if job.TriggerID != "" && errAck == nil {
+			if err := RecordExecution(job); err != nil {
+				parentCtx.Logger().Warnf("cannot record the execution in the trigger history: %s", err)
+			}
+		}
+
 		// Delete the trigger associated with the job (if any) when we receive a
 		// ErrBadTrigger.
 		if job.TriggerID != "" && globalJobSystem != nil {
@@ -386,6 +572,7 @@ type task struct {
 	startTime time.Time
 	endTime   time.Time
 	execCount int
+	noRetry   bool
 }
 
 func (t *task) run() (err error) {
@@ -481,6 +668,7 @@ func (t *task) run() (err error) {
 		t.execCount++
 
 		if ctx.NoRetry() {
+			t.noRetry = true
 			break
 		}
 	}
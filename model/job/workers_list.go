@@ -2,6 +2,7 @@ package job
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/logger"
@@ -81,6 +82,21 @@ func applyWorkerConfig(w *WorkerConfig, c config.Worker) *WorkerConfig {
 	if c.Timeout != nil {
 		w.Timeout = *c.Timeout
 	}
+	if len(c.Retries) > 0 {
+		retries := make(map[string]config.RetryPolicy, len(w.Retries)+len(c.Retries))
+		for class, policy := range w.Retries {
+			retries[class] = policy
+		}
+		for class, policy := range c.Retries {
+			for existing := range retries {
+				if strings.EqualFold(existing, class) {
+					delete(retries, existing)
+				}
+			}
+			retries[class] = policy
+		}
+		w.Retries = retries
+	}
 	return w
 }
 
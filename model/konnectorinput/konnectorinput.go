@@ -0,0 +1,210 @@
+// Package konnectorinput is used by the running konnectors to ask the user for
+// an input, like a 2FA code or the answer to a captcha. The request is saved
+// in CouchDB, so that the harvest app can display it, and the answer of the
+// user is relayed to the konnector via the cache, until the konnector stops
+// waiting. The answers are never saved in CouchDB, nor published on the
+// realtime hub.
+package konnectorinput
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// KindOTP is used for asking a one-time password (2FA code).
+	KindOTP = "otp"
+	// KindCaptcha is used for asking the answer to a captcha, whose image is
+	// sent with the request.
+	KindCaptcha = "captcha"
+	// KindText is used for asking any other text.
+	KindText = "text"
+)
+
+// maxValueLength is the maximal length of an answer.
+const maxValueLength = 1024
+
+// answerPollInterval is the delay between two checks of the answer by the
+// konnector worker.
+const answerPollInterval = 500 * time.Millisecond
+
+var (
+	// ErrInvalidKind is used when a konnector asks for an unknown kind of
+	// input.
+	ErrInvalidKind = errors.New("Invalid kind of input")
+	// ErrInvalidValue is used when the answer of the user is empty or too
+	// long.
+	ErrInvalidValue = errors.New("Invalid value for the input")
+	// ErrExpired is used when the user answers after the konnector has
+	// stopped waiting, or when the input has already been answered.
+	ErrExpired = errors.New("The konnector is no longer waiting for this input")
+	// ErrTimeout is used when the user has not answered in time.
+	ErrTimeout = errors.New("The user has not answered in time")
+)
+
+// Request is an input asked by a konnector to the user.
+type Request struct {
+	DocID     string    `json:"_id,omitempty"`
+	DocRev    string    `json:"_rev,omitempty"`
+	JobID     string    `json:"job_id"`
+	Konnector string    `json:"konnector"`
+	Account   string    `json:"account,omitempty"`
+	Kind      string    `json:"kind"`
+	Label     string    `json:"label,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (r *Request) ID() string { return r.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (r *Request) Rev() string { return r.DocRev }
+
+// SetID is used to implement the couchdb.Doc interface
+func (r *Request) SetID(id string) { r.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (r *Request) SetRev(rev string) { r.DocRev = rev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (r *Request) DocType() string { return consts.KonnectorsInputs }
+
+// Clone is used to implement the couchdb.Doc interface
+func (r *Request) Clone() couchdb.Doc {
+	cloned := *r
+	return &cloned
+}
+
+// Fetch is used to implement the permission.Fetcher interface
+func (r *Request) Fetch(field string) []string {
+	switch field {
+	case "konnector":
+		return []string{r.Konnector}
+	case "account":
+		return []string{r.Account}
+	case "job_id":
+		return []string{r.JobID}
+	case "kind":
+		return []string{r.Kind}
+	}
+	return nil
+}
+
+// Expired returns true if the konnector is no longer waiting for the input.
+func (r *Request) Expired() bool {
+	return time.Now().After(r.ExpiresAt)
+}
+
+// answerKey is the key in the cache of the answer to an input request.
+func answerKey(inst *instance.Instance, id string) string {
+	return "konnector-input:" + inst.Domain + ":" + id
+}
+
+// Timeout returns the duration that a konnector can wait for an input. The
+// konnector can ask for a shorter duration than the one in the config.
+func Timeout(asked time.Duration) time.Duration {
+	timeout := config.GetConfig().Konnectors.InputTimeout
+	if asked > 0 && (timeout <= 0 || asked < timeout) {
+		return asked
+	}
+	return timeout
+}
+
+// Ask saves the request, waits for the answer of the user, and returns the
+// value. The request is removed when the user has answered or when the
+// timeout is reached.
+func Ask(ctx context.Context, inst *instance.Instance, req *Request, timeout time.Duration) (string, error) {
+	switch req.Kind {
+	case KindOTP, KindCaptcha, KindText:
+	default:
+		return "", ErrInvalidKind
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	req.DocID = id.String()
+	req.DocRev = ""
+	req.CreatedAt = time.Now().UTC()
+	req.ExpiresAt = req.CreatedAt.Add(timeout)
+	if err := couchdb.CreateNamedDocWithDB(inst, req); err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := couchdb.DeleteDoc(inst, req); err != nil {
+			inst.Logger().WithNamespace("konnectorinput").
+				Warnf("Cannot delete input request %s: %s", req.DocID, err)
+		}
+	}()
+	return waitAnswer(ctx, inst, req.DocID)
+}
+
+// waitAnswer checks the cache regularly until the answer of the user is here,
+// and removes it from the cache.
+func waitAnswer(ctx context.Context, inst *instance.Instance, id string) (string, error) {
+	cache := config.GetConfig().CacheStorage
+	key := answerKey(inst, id)
+	defer cache.Clear(key)
+
+	ticker := time.NewTicker(answerPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", ErrTimeout
+			}
+			return "", ctx.Err()
+		case <-ticker.C:
+			if value, ok := cache.Get(key); ok {
+				return string(value), nil
+			}
+		}
+	}
+}
+
+// Get returns the pending request with the given identifier.
+func Get(inst *instance.Instance, id string) (*Request, error) {
+	var req Request
+	if err := couchdb.GetDoc(inst, consts.KonnectorsInputs, id, &req); err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil, ErrExpired
+		}
+		return nil, err
+	}
+	if req.Expired() {
+		return nil, ErrExpired
+	}
+	return &req, nil
+}
+
+// Answer relays the value given by the user to the konnector that is waiting
+// for it. Only the first answer is kept.
+func Answer(inst *instance.Instance, req *Request, value string) error {
+	if value == "" || len(value) > maxValueLength {
+		return ErrInvalidValue
+	}
+	ttl := time.Until(req.ExpiresAt)
+	if ttl <= 0 {
+		return ErrExpired
+	}
+	cache := config.GetConfig().CacheStorage
+	if !cache.SetNX(answerKey(inst, req.DocID), []byte(value), ttl) {
+		return ErrExpired
+	}
+	return nil
+}
+
+var _ couchdb.Doc = &Request{}
@@ -0,0 +1,68 @@
+package konnectorinput
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKonnectorInput(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("Timeout", func(t *testing.T) {
+		conf := config.GetConfig()
+		conf.Konnectors.InputTimeout = 5 * time.Minute
+		assert.Equal(t, 5*time.Minute, Timeout(0))
+		assert.Equal(t, 2*time.Minute, Timeout(2*time.Minute))
+		assert.Equal(t, 5*time.Minute, Timeout(time.Hour))
+	})
+
+	t.Run("Answer", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "input.example.net"}
+		req := &Request{DocID: "request-id", ExpiresAt: time.Now().Add(time.Minute)}
+
+		assert.ErrorIs(t, Answer(inst, req, ""), ErrInvalidValue)
+		assert.ErrorIs(t, Answer(inst, req, strings.Repeat("x", maxValueLength+1)), ErrInvalidValue)
+
+		done := make(chan string)
+		go func() {
+			value, err := waitAnswer(context.Background(), inst, req.DocID)
+			assert.NoError(t, err)
+			done <- value
+		}()
+		require.NoError(t, Answer(inst, req, "123456"))
+		// Only the first answer is relayed
+		assert.ErrorIs(t, Answer(inst, req, "654321"), ErrExpired)
+		select {
+		case value := <-done:
+			assert.Equal(t, "123456", value)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no answer relayed")
+		}
+		_, ok := config.GetConfig().CacheStorage.Get(answerKey(inst, req.DocID))
+		assert.False(t, ok)
+
+		req.ExpiresAt = time.Now().Add(-time.Second)
+		assert.ErrorIs(t, Answer(inst, req, "123456"), ErrExpired)
+	})
+
+	t.Run("WaitTimeout", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "input.example.net"}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := waitAnswer(ctx, inst, "no-answer")
+		assert.ErrorIs(t, err, ErrTimeout)
+	})
+
+	t.Run("AskWithInvalidKind", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "input.example.net"}
+		_, err := Ask(context.Background(), inst, &Request{Kind: "fingerprint"}, time.Minute)
+		assert.ErrorIs(t, err, ErrInvalidKind)
+	})
+}
@@ -0,0 +1,434 @@
+// Package konnectorlog is used to keep the logs of the executions of the
+// konnectors, so that they can be consulted later by the user or the support
+// when a konnector has failed. There is one document per execution, with the
+// lines written by the konnector, where the secrets of the account are masked.
+package konnectorlog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// MaxLines is the maximal number of lines kept for an execution. When a
+	// konnector writes more lines, the oldest ones are dropped, as the last
+	// lines are often the most useful to understand an error.
+	MaxLines = 500
+	// MaxRuns is the maximal number of executions kept for a konnector.
+	MaxRuns = 50
+	// MaxArtifacts is the maximal number of artifacts kept for an execution.
+	MaxArtifacts = 20
+	// MaxArtifactsSize is the maximal size of the content of the artifacts
+	// kept for an execution. The artifacts over this limit are kept without
+	// their content.
+	MaxArtifactsSize = 1 << 20
+
+	// ArtifactsDirName is the directory where the artifacts are stored, with
+	// a sub-directory per konnector and per execution.
+	ArtifactsDirName = "/.cozy_konnector_artifacts"
+
+	// StateDone is used for an execution that has succeeded.
+	StateDone = "done"
+	// StateErrored is used for an execution that has failed.
+	StateErrored = "errored"
+
+	// Mask replaces the secrets in the messages.
+	Mask = "[REDACTED]"
+)
+
+// Line is a line of log written by a konnector.
+type Line struct {
+	Level   string    `json:"level"`
+	Time    time.Time `json:"timestamp"`
+	Message string    `json:"message"`
+}
+
+// Artifact is a file produced by an execution of a konnector on a remote
+// agent, like a screenshot of the page where the konnector has failed. Its
+// content is stored in the VFS, and FileID is the identifier of the file.
+type Artifact struct {
+	Name   string `json:"name"`
+	Mime   string `json:"mime,omitempty"`
+	Size   int64  `json:"size"`
+	FileID string `json:"file_id,omitempty"`
+
+	// content is kept in memory until the execution is saved
+	content []byte
+}
+
+// Run is a document with the logs of an execution of a konnector. Its
+// identifier is the identifier of the job.
+type Run struct {
+	DocID      string    `json:"_id,omitempty"`
+	DocRev     string    `json:"_rev,omitempty"`
+	Slug       string    `json:"slug"`
+	Account    string    `json:"account,omitempty"`
+	State      string    `json:"state,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Truncated  bool      `json:"truncated,omitempty"`
+	Lines      []Line    `json:"lines,omitempty"`
+
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (r *Run) ID() string { return r.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (r *Run) Rev() string { return r.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (r *Run) DocType() string { return consts.KonnectorsLogs }
+
+// Clone implements couchdb.Doc
+func (r *Run) Clone() couchdb.Doc {
+	cloned := *r
+	cloned.Lines = make([]Line, len(r.Lines))
+	copy(cloned.Lines, r.Lines)
+	cloned.Artifacts = make([]Artifact, len(r.Artifacts))
+	copy(cloned.Artifacts, r.Artifacts)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (r *Run) SetID(id string) { r.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (r *Run) SetRev(rev string) { r.DocRev = rev }
+
+// AddLine adds a line at the end of the logs, and drops the oldest line if
+// there are too many of them.
+func (r *Run) AddLine(line Line) {
+	if len(r.Lines) >= MaxLines {
+		r.Lines = append(r.Lines[:0], r.Lines[len(r.Lines)-MaxLines+1:]...)
+		r.Truncated = true
+	}
+	r.Lines = append(r.Lines, line)
+}
+
+// AddArtifact adds an artifact to the execution. Its content is dropped if
+// the artifacts are too large, and the artifact itself is dropped if there
+// are too many of them.
+func (r *Run) AddArtifact(artifact Artifact) {
+	if len(r.Artifacts) >= MaxArtifacts {
+		return
+	}
+	total := int64(len(artifact.content))
+	for _, a := range r.Artifacts {
+		if a.FileID != "" || a.content != nil {
+			total += a.Size
+		}
+	}
+	if total > MaxArtifactsSize {
+		artifact.content = nil
+	}
+	r.Artifacts = append(r.Artifacts, artifact)
+}
+
+// artifactsDir returns the path of the directory for the artifacts of the
+// execution.
+func (r *Run) artifactsDir() string {
+	return path.Join(ArtifactsDirName, r.Slug, r.DocID)
+}
+
+// storeArtifacts writes the content of the new artifacts in the VFS. The
+// errors are only logged, and the artifacts that have not been written are
+// kept without their content.
+func storeArtifacts(inst *instance.Instance, run *Run) {
+	if err := run.storeArtifacts(inst.VFS()); err != nil {
+		inst.Logger().WithNamespace("konnectors").
+			Warnf("Cannot store the artifacts of %s: %s", run.DocID, err)
+	}
+}
+
+func (r *Run) storeArtifacts(fs vfs.VFS) error {
+	var dir *vfs.DirDoc
+	for i := range r.Artifacts {
+		artifact := &r.Artifacts[i]
+		if artifact.content == nil {
+			continue
+		}
+		if dir == nil {
+			var err error
+			if dir, err = vfs.MkdirAll(fs, r.artifactsDir()); err != nil {
+				return err
+			}
+		}
+		name := path.Base("/" + artifact.Name)
+		if name == "/" || name == "." || name == ".." {
+			name = "artifact"
+		}
+		name = vfs.ConflictName(fs, dir.ID(), name, true)
+		mime, class := vfs.ExtractMimeAndClassFromFilename(name)
+		if artifact.Mime != "" {
+			mime = artifact.Mime
+		}
+		doc, err := vfs.NewFileDoc(name, dir.ID(), int64(len(artifact.content)),
+			nil, mime, class, time.Now(), false, false, false, nil)
+		if err != nil {
+			return err
+		}
+		f, err := fs.CreateFile(doc, nil)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(artifact.content)
+		if errc := f.Close(); err == nil {
+			err = errc
+		}
+		if err != nil {
+			return err
+		}
+		artifact.FileID = doc.ID()
+		artifact.content = nil
+	}
+	return nil
+}
+
+// Recorder collects the lines of log of an execution of a konnector. It is
+// safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	run     *Run
+	secrets []string
+}
+
+// NewRecorder returns a recorder for the given job. The secrets will be
+// masked in the messages.
+func NewRecorder(jobID, slug, accountID string, secrets []string) *Recorder {
+	return &Recorder{
+		run: &Run{
+			DocID:     jobID,
+			Slug:      slug,
+			Account:   accountID,
+			StartedAt: time.Now().UTC(),
+		},
+		secrets: secrets,
+	}
+}
+
+// Add records a line of log.
+func (r *Recorder) Add(level, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.AddLine(Line{
+		Level:   level,
+		Time:    time.Now().UTC(),
+		Message: MaskSecrets(message, r.secrets),
+	})
+}
+
+// AddArtifact records a file produced by the execution.
+func (r *Recorder) AddArtifact(name, mime string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.AddArtifact(Artifact{
+		Name:    name,
+		Mime:    mime,
+		Size:    int64(len(data)),
+		content: data,
+	})
+}
+
+// Save persists the logs of the execution. When a job is retried, the lines
+// of the new execution are added after the lines of the previous one. The
+// oldest executions of the konnector are then deleted to keep the store
+// capped.
+func (r *Recorder) Save(inst *instance.Instance, errjob error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.run
+	run.FinishedAt = time.Now().UTC()
+	if errjob == nil {
+		run.State = StateDone
+		run.Error = ""
+	} else {
+		run.State = StateErrored
+		run.Error = MaskSecrets(errjob.Error(), r.secrets)
+	}
+
+	var previous Run
+	err := couchdb.GetDoc(inst, consts.KonnectorsLogs, run.DocID, &previous)
+	switch {
+	case err == nil:
+		merged := previous
+		merged.State = run.State
+		merged.Error = run.Error
+		merged.FinishedAt = run.FinishedAt
+		merged.Truncated = previous.Truncated || run.Truncated
+		for _, line := range run.Lines {
+			merged.AddLine(line)
+		}
+		for _, artifact := range run.Artifacts {
+			merged.AddArtifact(artifact)
+		}
+		storeArtifacts(inst, &merged)
+		err = couchdb.UpdateDoc(inst, &merged)
+	case couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err):
+		storeArtifacts(inst, run)
+		err = couchdb.CreateNamedDocWithDB(inst, run)
+	}
+	if err != nil {
+		return err
+	}
+	// The lines are persisted, they can be released
+	run.Lines = nil
+	run.Artifacts = nil
+
+	job.EnsureDailyTrigger(inst, "clean-konnector-logs", nil)
+	return deleteOldRuns(inst, run.Slug)
+}
+
+// MaskSecrets replaces the secrets in a message.
+func MaskSecrets(message string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			message = strings.ReplaceAll(message, secret, Mask)
+		}
+	}
+	return message
+}
+
+// Get returns the logs of an execution of the konnector with the given slug.
+func Get(db prefixer.Prefixer, slug, jobID string) (*Run, error) {
+	var run Run
+	if err := couchdb.GetDoc(db, consts.KonnectorsLogs, jobID, &run); err != nil {
+		return nil, err
+	}
+	if run.Slug != slug {
+		return nil, &couchdb.Error{
+			StatusCode: http.StatusNotFound,
+			Name:       "not_found",
+			Reason:     fmt.Sprintf("no logs of %s for job %s", slug, jobID),
+		}
+	}
+	return &run, nil
+}
+
+// List returns the executions of a konnector, from the most recent to the
+// oldest, without their lines. The bookmark can be used to get the next page.
+func List(db prefixer.Prefixer, slug, bookmark string, limit int) ([]*Run, string, error) {
+	var runs []*Run
+	req := &couchdb.FindRequest{
+		UseIndex: "by-slug-and-started-at",
+		Selector: mango.And(
+			mango.Equal("slug", slug),
+			mango.Exists("started_at"),
+		),
+		Sort: mango.SortBy{
+			{Field: "slug", Direction: mango.Desc},
+			{Field: "started_at", Direction: mango.Desc},
+		},
+		Fields: []string{
+			"_id", "_rev", "slug", "account", "state", "error",
+			"started_at", "finished_at", "truncated",
+		},
+		Limit:    limit,
+		Bookmark: bookmark,
+	}
+	res, err := couchdb.FindDocsRaw(db, consts.KonnectorsLogs, req, &runs)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*Run{}, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(runs) < limit {
+		return runs, "", nil
+	}
+	return runs, res.Bookmark, nil
+}
+
+func deleteOldRuns(inst *instance.Instance, slug string) error {
+	var runs []*Run
+	req := &couchdb.FindRequest{
+		UseIndex: "by-slug-and-started-at",
+		Selector: mango.And(
+			mango.Equal("slug", slug),
+			mango.Exists("started_at"),
+		),
+		Sort: mango.SortBy{
+			{Field: "slug", Direction: mango.Desc},
+			{Field: "started_at", Direction: mango.Desc},
+		},
+		Fields: []string{"_id", "_rev", "slug", "artifacts"},
+		Skip:   MaxRuns,
+		Limit:  1000,
+	}
+	if err := couchdb.FindDocs(inst, consts.KonnectorsLogs, req, &runs); err != nil {
+		return err
+	}
+	return bulkDelete(inst, runs)
+}
+
+// CleanOld deletes the logs of the executions, and their artifacts, that are
+// older than the retention period configured for the stack. It returns the
+// number of deleted documents.
+func CleanOld(inst *instance.Instance) (int, error) {
+	retention := config.GetConfig().Konnectors.LogsRetention
+	if retention <= 0 {
+		return 0, nil
+	}
+	before := time.Now().Add(-retention).UTC()
+
+	count := 0
+	for {
+		var runs []*Run
+		req := &couchdb.FindRequest{
+			UseIndex: "by-started-at",
+			Selector: mango.Lt("started_at", before.Format(time.RFC3339Nano)),
+			Fields:   []string{"_id", "_rev", "slug", "artifacts"},
+			Limit:    1000,
+		}
+		err := couchdb.FindDocs(inst, consts.KonnectorsLogs, req, &runs)
+		if couchdb.IsNoDatabaseError(err) {
+			return count, nil
+		}
+		if err != nil || len(runs) == 0 {
+			return count, err
+		}
+		if err := bulkDelete(inst, runs); err != nil {
+			return count, err
+		}
+		count += len(runs)
+		if len(runs) < 1000 {
+			return count, nil
+		}
+	}
+}
+
+func bulkDelete(inst *instance.Instance, runs []*Run) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	fs := inst.VFS()
+	docs := make([]couchdb.Doc, len(runs))
+	for i, run := range runs {
+		docs[i] = run
+		if len(run.Artifacts) == 0 {
+			continue
+		}
+		err := vfs.RemoveAll(fs, run.artifactsDir(), fs.EnsureErased)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return couchdb.BulkDeleteDocs(inst, consts.KonnectorsLogs, docs)
+}
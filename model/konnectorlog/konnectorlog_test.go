@@ -0,0 +1,64 @@
+package konnectorlog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKonnectorLog(t *testing.T) {
+	t.Run("MaskSecrets", func(t *testing.T) {
+		secrets := []string{"hunter2", "s3cr3t-token"}
+		msg := MaskSecrets("login with hunter2 and s3cr3t-token", secrets)
+		assert.Equal(t, "login with [REDACTED] and [REDACTED]", msg)
+		assert.Equal(t, "nothing to hide", MaskSecrets("nothing to hide", secrets))
+		assert.Equal(t, "no secrets", MaskSecrets("no secrets", nil))
+	})
+
+	t.Run("Recorder", func(t *testing.T) {
+		rec := NewRecorder("job-id", "konn", "account-id", []string{"hunter2"})
+		rec.Add("info", "password is hunter2")
+		require.Len(t, rec.run.Lines, 1)
+		line := rec.run.Lines[0]
+		assert.Equal(t, "info", line.Level)
+		assert.Equal(t, "password is [REDACTED]", line.Message)
+		assert.False(t, line.Time.IsZero())
+		assert.Equal(t, "job-id", rec.run.ID())
+		assert.Equal(t, "konn", rec.run.Slug)
+	})
+
+	t.Run("AddLineIsCapped", func(t *testing.T) {
+		run := &Run{}
+		for i := 0; i < MaxLines+10; i++ {
+			run.AddLine(Line{Message: fmt.Sprintf("line %d", i)})
+		}
+		require.Len(t, run.Lines, MaxLines)
+		assert.True(t, run.Truncated)
+		assert.Equal(t, "line 10", run.Lines[0].Message)
+		assert.Equal(t, fmt.Sprintf("line %d", MaxLines+9), run.Lines[MaxLines-1].Message)
+	})
+
+	t.Run("AddArtifactIsCapped", func(t *testing.T) {
+		run := &Run{}
+		run.AddArtifact(Artifact{Name: "small.png", Size: 10, content: make([]byte, 10)})
+		run.AddArtifact(Artifact{Name: "big.html", Size: MaxArtifactsSize, content: make([]byte, MaxArtifactsSize)})
+		require.Len(t, run.Artifacts, 2)
+		assert.Len(t, run.Artifacts[0].content, 10)
+		assert.Nil(t, run.Artifacts[1].content)
+		assert.EqualValues(t, MaxArtifactsSize, run.Artifacts[1].Size)
+
+		// The artifacts already stored count in the limit
+		run = &Run{Artifacts: []Artifact{{Name: "stored.png", Size: MaxArtifactsSize, FileID: "file-id"}}}
+		run.AddArtifact(Artifact{Name: "small.png", Size: 10, content: make([]byte, 10)})
+		require.Len(t, run.Artifacts, 2)
+		assert.Nil(t, run.Artifacts[1].content)
+
+		run = &Run{}
+		for i := 0; i < MaxArtifacts+5; i++ {
+			run.AddArtifact(Artifact{Name: fmt.Sprintf("%d.png", i), Size: 1, content: []byte{0}})
+		}
+		assert.Len(t, run.Artifacts, MaxArtifacts)
+	})
+}
@@ -0,0 +1,278 @@
+// Package konnectorsummary is used for the summaries of the executions of the
+// konnectors, that are displayed in the timeline of the Home app: how many
+// documents have been imported, the period covered, and the warnings. A
+// konnector can send its own summary, and the stack generates a default one
+// from the files created for the account when it has not.
+package konnectorsummary
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// MaxPerAccount is the maximal number of summaries kept for an account.
+	MaxPerAccount = 100
+	// MaxWarnings is the maximal number of warnings kept in a summary.
+	MaxWarnings = 20
+	// MaxWarningLength is the maximal length of a warning.
+	MaxWarningLength = 500
+	// MaxCountedFiles is the maximal number of created files counted for a
+	// default summary.
+	MaxCountedFiles = 1000
+
+	// SourceKonnector is used for a summary sent by the konnector.
+	SourceKonnector = "konnector"
+	// SourceStack is used for a summary generated by the stack, when the
+	// konnector has not sent one.
+	SourceStack = "stack"
+
+	// StateDone is used for an execution that has succeeded.
+	StateDone = "done"
+	// StateErrored is used for an execution that has failed.
+	StateErrored = "errored"
+)
+
+// ErrInvalidSummary is used when the summary sent by a konnector is not valid.
+var ErrInvalidSummary = errors.New("Invalid summary")
+
+// Period is the period covered by the documents imported by an execution.
+type Period struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// Summary is a document with the summary of an execution of a konnector. Its
+// identifier is the identifier of the job.
+type Summary struct {
+	DocID        string         `json:"_id,omitempty"`
+	DocRev       string         `json:"_rev,omitempty"`
+	Slug         string         `json:"slug"`
+	Account      string         `json:"account,omitempty"`
+	State        string         `json:"state"`
+	Source       string         `json:"source"`
+	NewDocuments int            `json:"new_documents"`
+	Documents    map[string]int `json:"documents,omitempty"`
+	Period       *Period        `json:"period,omitempty"`
+	Warnings     []string       `json:"warnings,omitempty"`
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   time.Time      `json:"finished_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (s *Summary) ID() string { return s.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (s *Summary) Rev() string { return s.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (s *Summary) DocType() string { return consts.KonnectorsSummaries }
+
+// Clone implements couchdb.Doc
+func (s *Summary) Clone() couchdb.Doc {
+	cloned := *s
+	if s.Documents != nil {
+		cloned.Documents = make(map[string]int, len(s.Documents))
+		for k, v := range s.Documents {
+			cloned.Documents[k] = v
+		}
+	}
+	if s.Period != nil {
+		period := *s.Period
+		cloned.Period = &period
+	}
+	cloned.Warnings = make([]string, len(s.Warnings))
+	copy(cloned.Warnings, s.Warnings)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (s *Summary) SetID(id string) { s.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (s *Summary) SetRev(rev string) { s.DocRev = rev }
+
+// Parse reads the summary sent by a konnector on its stdout, as a JSON line
+// with the summary type.
+func Parse(line []byte) (*Summary, error) {
+	var msg struct {
+		NewDocuments *int           `json:"new_documents"`
+		Documents    map[string]int `json:"documents"`
+		Period       *Period        `json:"period"`
+		Warnings     []string       `json:"warnings"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, ErrInvalidSummary
+	}
+
+	summary := &Summary{Source: SourceKonnector}
+	total := 0
+	for doctype, count := range msg.Documents {
+		if doctype == "" || count < 0 {
+			return nil, ErrInvalidSummary
+		}
+		total += count
+	}
+	if len(msg.Documents) > 0 {
+		summary.Documents = msg.Documents
+	}
+	if msg.NewDocuments != nil {
+		if *msg.NewDocuments < 0 {
+			return nil, ErrInvalidSummary
+		}
+		total = *msg.NewDocuments
+	}
+	summary.NewDocuments = total
+
+	if p := msg.Period; p != nil && (p.Start != nil || p.End != nil) {
+		if p.Start != nil && p.End != nil && p.End.Before(*p.Start) {
+			return nil, ErrInvalidSummary
+		}
+		summary.Period = p
+	}
+
+	for _, warning := range msg.Warnings {
+		if warning == "" {
+			continue
+		}
+		if len(summary.Warnings) >= MaxWarnings {
+			break
+		}
+		if len(warning) > MaxWarningLength {
+			warning = warning[:MaxWarningLength]
+		}
+		summary.Warnings = append(summary.Warnings, warning)
+	}
+	return summary, nil
+}
+
+// Default returns the summary generated by the stack for an execution where
+// the konnector has not sent one: the new documents are the files created
+// for the account since the start of the execution.
+func Default(db prefixer.Prefixer, accountID string, startedAt time.Time) (*Summary, error) {
+	summary := &Summary{Source: SourceStack}
+	if accountID == "" {
+		return summary, nil
+	}
+	count, err := countCreatedFiles(db, accountID, startedAt)
+	if err != nil {
+		return nil, err
+	}
+	summary.NewDocuments = count
+	if count > 0 {
+		summary.Documents = map[string]int{consts.Files: count}
+	}
+	return summary, nil
+}
+
+func countCreatedFiles(db prefixer.Prefixer, accountID string, since time.Time) (int, error) {
+	var files []struct {
+		ID string `json:"_id"`
+	}
+	req := &couchdb.FindRequest{
+		UseIndex: "by-source-account-created-at",
+		Selector: mango.And(
+			mango.Equal("cozyMetadata.sourceAccount", accountID),
+			mango.Gte("cozyMetadata.createdAt", since.UTC().Format(time.RFC3339Nano)),
+		),
+		Fields: []string{"_id"},
+		Limit:  MaxCountedFiles,
+	}
+	err := couchdb.FindDocs(db, consts.Files, req, &files)
+	if couchdb.IsNoDatabaseError(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(files), nil
+}
+
+// Save persists the summary of an execution. When a job is retried, the
+// summary of the new execution replaces the previous one. The oldest
+// summaries of the account are then deleted.
+func Save(db prefixer.Prefixer, summary *Summary) error {
+	var previous Summary
+	err := couchdb.GetDoc(db, consts.KonnectorsSummaries, summary.DocID, &previous)
+	switch {
+	case err == nil:
+		summary.DocRev = previous.DocRev
+		err = couchdb.UpdateDoc(db, summary)
+	case couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err):
+		err = couchdb.CreateNamedDocWithDB(db, summary)
+	}
+	if err != nil {
+		return err
+	}
+	return deleteOldSummaries(db, summary.Account)
+}
+
+// List returns the summaries of the executions, from the most recent to the
+// oldest, optionally filtered by account. The bookmark can be used to get the
+// next page.
+func List(db prefixer.Prefixer, accountID, bookmark string, limit int) ([]*Summary, string, error) {
+	var summaries []*Summary
+	req := listRequest(accountID)
+	req.Limit = limit
+	req.Bookmark = bookmark
+	res, err := couchdb.FindDocsRaw(db, consts.KonnectorsSummaries, req, &summaries)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*Summary{}, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(summaries) < limit {
+		return summaries, "", nil
+	}
+	return summaries, res.Bookmark, nil
+}
+
+func listRequest(accountID string) *couchdb.FindRequest {
+	if accountID == "" {
+		return &couchdb.FindRequest{
+			UseIndex: "by-finished-at",
+			Selector: mango.Exists("finished_at"),
+			Sort:     mango.SortBy{{Field: "finished_at", Direction: mango.Desc}},
+		}
+	}
+	return &couchdb.FindRequest{
+		UseIndex: "by-account-and-finished-at",
+		Selector: mango.And(
+			mango.Equal("account", accountID),
+			mango.Exists("finished_at"),
+		),
+		Sort: mango.SortBy{
+			{Field: "account", Direction: mango.Desc},
+			{Field: "finished_at", Direction: mango.Desc},
+		},
+	}
+}
+
+func deleteOldSummaries(db prefixer.Prefixer, accountID string) error {
+	if accountID == "" {
+		return nil
+	}
+	var summaries []*Summary
+	req := listRequest(accountID)
+	req.Fields = []string{"_id", "_rev"}
+	req.Skip = MaxPerAccount
+	req.Limit = 1000
+	if err := couchdb.FindDocs(db, consts.KonnectorsSummaries, req, &summaries); err != nil {
+		return err
+	}
+	if len(summaries) == 0 {
+		return nil
+	}
+	docs := make([]couchdb.Doc, len(summaries))
+	for i, summary := range summaries {
+		docs[i] = summary
+	}
+	return couchdb.BulkDeleteDocs(db, consts.KonnectorsSummaries, docs)
+}
@@ -0,0 +1,58 @@
+package konnectorsummary
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Full", func(t *testing.T) {
+		line := `{"type":"summary","documents":{"io.cozy.bills":3,"io.cozy.files":4},
+"period":{"start":"2026-09-01T00:00:00Z","end":"2026-09-30T23:59:59Z"},
+"warnings":["","The invoice of September is not available yet"]}`
+		summary, err := Parse([]byte(strings.ReplaceAll(line, "\n", "")))
+		require.NoError(t, err)
+		assert.Equal(t, SourceKonnector, summary.Source)
+		assert.Equal(t, 7, summary.NewDocuments)
+		assert.Equal(t, 3, summary.Documents["io.cozy.bills"])
+		require.NotNil(t, summary.Period)
+		assert.Equal(t, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), summary.Period.Start.UTC())
+		assert.Equal(t, []string{"The invoice of September is not available yet"}, summary.Warnings)
+	})
+
+	t.Run("NewDocuments", func(t *testing.T) {
+		summary, err := Parse([]byte(`{"type":"summary","new_documents":2,"period":{}}`))
+		require.NoError(t, err)
+		assert.Equal(t, 2, summary.NewDocuments)
+		assert.Nil(t, summary.Documents)
+		assert.Nil(t, summary.Period)
+	})
+
+	t.Run("Warnings", func(t *testing.T) {
+		warnings := make([]string, MaxWarnings+5)
+		for i := range warnings {
+			warnings[i] = `"` + strings.Repeat("w", MaxWarningLength+10) + `"`
+		}
+		line := `{"type":"summary","warnings":[` + strings.Join(warnings, ",") + `]}`
+		summary, err := Parse([]byte(line))
+		require.NoError(t, err)
+		assert.Len(t, summary.Warnings, MaxWarnings)
+		assert.Len(t, summary.Warnings[0], MaxWarningLength)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, line := range []string{
+			`not json`,
+			`{"type":"summary","new_documents":-1}`,
+			`{"type":"summary","documents":{"io.cozy.bills":-3}}`,
+			`{"type":"summary","period":{"start":"2026-09-30T00:00:00Z","end":"2026-09-01T00:00:00Z"}}`,
+		} {
+			_, err := Parse([]byte(line))
+			assert.Equal(t, ErrInvalidSummary, err, line)
+		}
+	})
+}
@@ -0,0 +1,284 @@
+// Package konnectortelemetry collects the success and failure rates of the
+// konnectors, by version, and reports them to the apps registry when the
+// operator has opted in. The reports are anonymized: they have no instance
+// identifier, only the counters aggregated for the whole stack, with an
+// optional differential privacy noise.
+package konnectortelemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	build "github.com/cozy/cozy-stack/pkg/config"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/utils"
+)
+
+// ErrNoURL is used when the telemetry is enabled, but there is no URL where
+// the reports can be sent.
+var ErrNoURL = errors.New("konnectortelemetry: no URL for the reports")
+
+var log = logger.WithNamespace("konnector-telemetry")
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Report is the payload sent to the apps registry.
+type Report struct {
+	StackVersion string           `json:"stack_version"`
+	PeriodStart  time.Time        `json:"period_start"`
+	PeriodEnd    time.Time        `json:"period_end"`
+	Konnectors   []KonnectorStats `json:"konnectors"`
+}
+
+// KonnectorStats are the counters for a version of a konnector. The failures
+// are also counted by error class, like LOGIN_FAILED or VENDOR_DOWN.
+type KonnectorStats struct {
+	Slug    string         `json:"slug"`
+	Version string         `json:"version"`
+	Success int            `json:"success"`
+	Failure int            `json:"failure"`
+	Errors  map[string]int `json:"errors,omitempty"`
+}
+
+// The counters are kept by context, as the noise can be configured per
+// context.
+type key struct {
+	context string
+	slug    string
+	version string
+}
+
+type counter struct {
+	success int
+	failure int
+	errors  map[string]int
+}
+
+var (
+	mu          sync.Mutex
+	counters    = make(map[key]*counter)
+	periodStart = time.Now().UTC()
+)
+
+// Enabled returns true if the operator has opted in for the telemetry.
+func Enabled() bool {
+	return config.GetConfig().Konnectors.Telemetry.Enabled
+}
+
+// Record counts an execution of a konnector. The errorClass is empty for a
+// success. It does nothing if the telemetry is not enabled.
+func Record(contextName, slug, version, errorClass string) {
+	if !Enabled() || slug == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	k := key{context: contextName, slug: slug, version: version}
+	c, ok := counters[k]
+	if !ok {
+		c = &counter{errors: make(map[string]int)}
+		counters[k] = c
+	}
+	if errorClass == "" {
+		c.success++
+	} else {
+		c.failure++
+		c.errors[errorClass]++
+	}
+}
+
+// Preview returns the report that would be sent now, without resetting the
+// counters. As the noise is random, it is not the same for each call.
+func Preview() *Report {
+	mu.Lock()
+	defer mu.Unlock()
+	return buildReport(counters, periodStart, time.Now().UTC(), rand.Float64)
+}
+
+// Send reports the counters to the apps registry, and resets them.
+func Send() error {
+	u, err := reportURL()
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	report := buildReport(counters, periodStart, time.Now().UTC(), rand.Float64)
+	counters = make(map[key]*counter)
+	periodStart = report.PeriodEnd
+	mu.Unlock()
+	if len(report.Konnectors) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("konnectortelemetry: unexpected status %d from %s", res.StatusCode, u)
+	}
+	return nil
+}
+
+// ReportURL returns the URL where the reports are sent.
+func ReportURL() string {
+	u, _ := reportURL()
+	return u
+}
+
+func reportURL() (string, error) {
+	if u := config.GetConfig().Konnectors.Telemetry.URL; u != "" {
+		return u, nil
+	}
+	registries := config.GetConfig().Registries[config.DefaultInstanceContext]
+	if len(registries) == 0 {
+		return "", ErrNoURL
+	}
+	u := *registries[0]
+	u.Path = path.Join(u.Path, "registry", "telemetry")
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// buildReport aggregates the counters of the contexts by version of the
+// konnectors, with the noise configured for each context.
+func buildReport(counters map[key]*counter, start, end time.Time, random func() float64) *Report {
+	byVersion := make(map[[2]string]*KonnectorStats)
+	for k, c := range counters {
+		epsilon := epsilonFor(k.context)
+		noisy := func(n int) int { return addNoise(n, epsilon, random) }
+		id := [2]string{k.slug, k.version}
+		stats, ok := byVersion[id]
+		if !ok {
+			stats = &KonnectorStats{Slug: k.slug, Version: k.version}
+			byVersion[id] = stats
+		}
+		stats.Success += noisy(c.success)
+		stats.Failure += noisy(c.failure)
+		for class, n := range c.errors {
+			if stats.Errors == nil {
+				stats.Errors = make(map[string]int)
+			}
+			stats.Errors[class] += noisy(n)
+		}
+	}
+
+	report := &Report{
+		StackVersion: build.Version,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		Konnectors:   make([]KonnectorStats, 0, len(byVersion)),
+	}
+	for _, stats := range byVersion {
+		report.Konnectors = append(report.Konnectors, *stats)
+	}
+	sort.Slice(report.Konnectors, func(i, j int) bool {
+		a, b := report.Konnectors[i], report.Konnectors[j]
+		if a.Slug != b.Slug {
+			return a.Slug < b.Slug
+		}
+		return a.Version < b.Version
+	})
+	return report
+}
+
+// epsilonFor returns the privacy budget for the given context, or 0 if no
+// noise should be added.
+func epsilonFor(contextName string) float64 {
+	epsilon := config.GetConfig().Konnectors.Telemetry.Epsilon
+	if ctx, ok := config.GetConfig().Contexts[contextName].(map[string]interface{}); ok {
+		switch v := ctx["konnectors_telemetry_epsilon"].(type) {
+		case float64:
+			epsilon = v
+		case int:
+			epsilon = float64(v)
+		}
+	}
+	return epsilon
+}
+
+// addNoise adds a noise from the Laplace distribution to a counter, with a
+// scale of 1/epsilon, as an execution changes a counter by at most 1. The
+// result is rounded and can't be negative.
+func addNoise(n int, epsilon float64, random func() float64) int {
+	if epsilon <= 0 {
+		return n
+	}
+	u := random() - 0.5
+	sign := 1.0
+	if u < 0 {
+		sign = -1.0
+	}
+	r := 1 - 2*math.Abs(u)
+	if r <= 0 {
+		r = math.SmallestNonzeroFloat64
+	}
+	noise := -sign * math.Log(r) / epsilon
+	noisy := int(math.Round(float64(n) + noise))
+	if noisy < 0 {
+		return 0
+	}
+	return noisy
+}
+
+// Start launches a goroutine that sends the reports periodically. The last
+// report is sent when the stack is shut down.
+func Start() utils.Shutdowner {
+	interval := config.GetConfig().Konnectors.Telemetry.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	closed := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := Send(); err != nil {
+					log.Warnf("Cannot send the report: %s", err)
+				}
+			case <-closed:
+				return
+			}
+		}
+	}()
+	return &reporter{closed}
+}
+
+type reporter struct {
+	closed chan struct{}
+}
+
+func (r *reporter) Shutdown(ctx context.Context) error {
+	select {
+	case r.closed <- struct{}{}:
+	case <-ctx.Done():
+		return nil
+	}
+	if err := Send(); err != nil {
+		log.Warnf("Cannot send the last report: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package konnectortelemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetry(t *testing.T) {
+	config.UseTestFile(t)
+	cfg := config.GetConfig()
+
+	t.Run("Disabled", func(t *testing.T) {
+		cfg.Konnectors.Telemetry.Enabled = false
+		Record("default", "bank", "1.0.0", "")
+		assert.Empty(t, Preview().Konnectors)
+	})
+
+	t.Run("Preview", func(t *testing.T) {
+		cfg.Konnectors.Telemetry.Enabled = true
+		Record("default", "bank", "1.0.0", "")
+		Record("default", "bank", "1.0.0", "LOGIN_FAILED")
+		Record("beta", "bank", "1.0.0", "")
+		Record("default", "bank", "1.1.0", "VENDOR_DOWN")
+		Record("default", "", "1.0.0", "")
+
+		report := Preview()
+		require.Len(t, report.Konnectors, 2)
+		assert.Equal(t, KonnectorStats{
+			Slug:    "bank",
+			Version: "1.0.0",
+			Success: 2,
+			Failure: 1,
+			Errors:  map[string]int{"LOGIN_FAILED": 1},
+		}, report.Konnectors[0])
+		assert.Equal(t, "1.1.0", report.Konnectors[1].Version)
+		assert.Equal(t, 1, report.Konnectors[1].Errors["VENDOR_DOWN"])
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		var received Report
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer ts.Close()
+		cfg.Konnectors.Telemetry.URL = ts.URL
+
+		require.NoError(t, Send())
+		assert.Len(t, received.Konnectors, 2)
+		assert.Empty(t, Preview().Konnectors)
+	})
+
+	t.Run("Noise", func(t *testing.T) {
+		assert.Equal(t, 10, addNoise(10, 0, func() float64 { return 0.9 }))
+		assert.Equal(t, 10, addNoise(10, 1, func() float64 { return 0.5 }))
+		assert.Greater(t, addNoise(10, 1, func() float64 { return 0.99 }), 10)
+		assert.Less(t, addNoise(10, 1, func() float64 { return 0.01 }), 10)
+		assert.Equal(t, 0, addNoise(0, 0.1, func() float64 { return 0 }))
+
+		cfg.Contexts = map[string]interface{}{
+			"beta": map[string]interface{}{"konnectors_telemetry_epsilon": 0.5},
+		}
+		cfg.Konnectors.Telemetry.Epsilon = 2
+		assert.Equal(t, 0.5, epsilonFor("beta"))
+		assert.Equal(t, 2.0, epsilonFor("default"))
+	})
+}
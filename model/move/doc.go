@@ -51,6 +51,13 @@ type ExportDoc struct {
 	TotalSize        int64         `json:"total_size,omitempty"`
 	CreationDuration time.Duration `json:"creation_duration,omitempty"`
 	Error            string        `json:"error,omitempty"`
+
+	// QuarantinedFiles is the list of the identifiers of the files whose
+	// content has not been exported, as they have been quarantined.
+	QuarantinedFiles []string `json:"quarantined_files,omitempty"`
+
+	Encryption *ArchiveEncryption `json:"encryption,omitempty"`
+	Signature  []byte             `json:"signature,omitempty"`
 }
 
 // DocType implements the couchdb.Doc interface
@@ -78,9 +85,30 @@ func (e *ExportDoc) Clone() couchdb.Doc {
 	clone.WithDoctypes = make([]string, len(e.WithDoctypes))
 	copy(clone.WithDoctypes, e.WithDoctypes)
 
+	if e.QuarantinedFiles != nil {
+		clone.QuarantinedFiles = make([]string, len(e.QuarantinedFiles))
+		copy(clone.QuarantinedFiles, e.QuarantinedFiles)
+	}
+
+	if e.Encryption != nil {
+		clone.Encryption = e.Encryption.Clone()
+	}
+	clone.Signature = make([]byte, len(e.Signature))
+	copy(clone.Signature, e.Signature)
+
 	return &clone
 }
 
+// Manifest returns a copy of the export document that can be given to the
+// importer: the wrapped key of the archive is removed.
+func (e *ExportDoc) Manifest() *ExportDoc {
+	clone := e.Clone().(*ExportDoc)
+	if clone.Encryption != nil {
+		clone.Encryption.WrappedKey = nil
+	}
+	return clone
+}
+
 // Links implements the jsonapi.Object interface
 func (e *ExportDoc) Links() *jsonapi.LinksList { return nil }
 
@@ -114,6 +142,10 @@ func (e *ExportDoc) AcceptDoctype(doctype string) bool {
 // MarksAsFinished saves the document when the export is done.
 func (e *ExportDoc) MarksAsFinished(i *instance.Instance, size int64, err error) error {
 	e.CreationDuration = time.Since(e.CreatedAt)
+	if err == nil && e.Encryption != nil {
+		e.TotalSize = size
+		err = e.sign(i)
+	}
 	if err == nil {
 		e.State = ExportStateDone
 		e.TotalSize = size
@@ -255,6 +287,7 @@ func prepareExportDoc(i *instance.Instance, opts ExportOptions) *ExportDoc {
 		WithDoctypes: opts.WithDoctypes,
 		TotalSize:    -1,
 		PartsSize:    bucketSize,
+		Encryption:   opts.Encryption,
 	}
 }
 
@@ -282,6 +315,11 @@ func GetExport(inst *instance.Instance, mac []byte) (*ExportDoc, error) {
 	if exportDoc.HasExpired() {
 		return nil, ErrExportExpired
 	}
+	if exportDoc.State == ExportStateDone {
+		if err := exportDoc.verifySignature(inst); err != nil {
+			return nil, err
+		}
+	}
 	return &exportDoc, nil
 }
 
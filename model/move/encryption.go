@@ -0,0 +1,502 @@
+package move
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The encrypted archives start with a header made of:
+//   - the magic string
+//   - the salt used to derive the key from the passphrase
+//   - the number of the part (big endian uint32).
+//
+// And then, the content is split in chunks, each chunk being prefixed by its
+// length (big endian uint32, with the highest bit set for the last chunk) and
+// sealed with AES-256-GCM. Each part is sealed with its own key, derived with
+// HKDF from the key of the archive, the salt and the number of the part, so
+// that the nonces can be made of the chunk counter and of the last chunk flag
+// without being reused across the parts. The header is used as additional
+// data: it is not possible to reorder, truncate or swap chunks or parts
+// without the decryption failing.
+const (
+	encryptedMagic     = "COZYENC1"
+	encryptedSaltLen   = 16
+	encryptedHeaderLen = len(encryptedMagic) + encryptedSaltLen + 4
+	encryptedChunkSize = 64 * 1024
+	encryptedLastChunk = 1 << 31
+)
+
+// Scrypt parameters for deriving the key of an archive from the passphrase.
+// They are not stored in the archives, so changing them requires a new magic
+// string.
+const (
+	archiveScryptN = 32768
+	archiveScryptR = 8
+	archiveScryptP = 1
+	archiveKeyLen  = 32
+)
+
+// ArchiveEncryption contains the parameters for an export encrypted with a
+// passphrase. The key derived from the passphrase is kept wrapped by a key of
+// the instance, as the export parts are encrypted when they are downloaded.
+// The check value allows an importer to verify the passphrase.
+type ArchiveEncryption struct {
+	Salt       []byte `json:"salt"`
+	Check      []byte `json:"check,omitempty"`
+	WrappedKey []byte `json:"wrapped_key,omitempty"`
+}
+
+// NewArchiveEncryption derives a key from the passphrase chosen by the user
+// for encrypting an export.
+func NewArchiveEncryption(inst *instance.Instance, passphrase string) (*ArchiveEncryption, error) {
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	salt := crypto.GenerateRandomBytes(encryptedSaltLen)
+	key, err := deriveArchiveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	encryption, err := newArchiveEncryptionWithKey(inst, salt, key)
+	if err != nil {
+		return nil, err
+	}
+	encryption.Check, err = passphraseCheck(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return encryption, nil
+}
+
+func newArchiveEncryptionWithKey(inst *instance.Instance, salt, key []byte) (*ArchiveEncryption, error) {
+	wrapped, err := wrapArchiveKey(inst, key)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveEncryption{Salt: salt, WrappedKey: wrapped}, nil
+}
+
+// Key returns the key of the archive, unwrapped with the key of the instance.
+func (a *ArchiveEncryption) Key(inst *instance.Instance) ([]byte, error) {
+	aead, err := newGCM(instanceWrappingKey(inst))
+	if err != nil {
+		return nil, err
+	}
+	size := aead.NonceSize()
+	if len(a.WrappedKey) < size {
+		return nil, ErrInvalidPassphrase
+	}
+	nonce, sealed := a.WrappedKey[:size], a.WrappedKey[size:]
+	key, err := aead.Open(nil, nonce, sealed, []byte(inst.Domain))
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	return key, nil
+}
+
+// Clone returns a copy of the encryption parameters.
+func (a *ArchiveEncryption) Clone() *ArchiveEncryption {
+	clone := ArchiveEncryption{
+		Salt:       make([]byte, len(a.Salt)),
+		WrappedKey: make([]byte, len(a.WrappedKey)),
+	}
+	copy(clone.Salt, a.Salt)
+	copy(clone.WrappedKey, a.WrappedKey)
+	if a.Check != nil {
+		clone.Check = make([]byte, len(a.Check))
+		copy(clone.Check, a.Check)
+	}
+	return &clone
+}
+
+func deriveArchiveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, archiveScryptN, archiveScryptR, archiveScryptP, archiveKeyLen)
+}
+
+// archiveSubkey derives a subkey from the key of an archive with HKDF, so
+// that the key derived from the passphrase is never used directly, and never
+// for two purposes.
+func archiveSubkey(key, salt []byte, info string) ([]byte, error) {
+	subkey := make([]byte, archiveKeyLen)
+	r := hkdf.New(sha256.New, key, salt, []byte(info))
+	if _, err := io.ReadFull(r, subkey); err != nil {
+		return nil, err
+	}
+	return subkey, nil
+}
+
+// partKey returns the key used to encrypt the given part of an archive.
+func partKey(key, salt []byte, part int) ([]byte, error) {
+	return archiveSubkey(key, salt, fmt.Sprintf("cozy-export-part-%d", part))
+}
+
+// passphraseCheck returns the value used by an importer to check that the
+// passphrase gives the key of the archive.
+func passphraseCheck(key, salt []byte) ([]byte, error) {
+	checkKey, err := archiveSubkey(key, salt, "cozy-export-passphrase-check")
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, checkKey)
+	_, _ = h.Write(salt)
+	return h.Sum(nil), nil
+}
+
+// instanceManifestKey returns the key used by the instance to sign the
+// manifests of its exports. It is derived from the session secret, and it is
+// never saved.
+func instanceManifestKey(inst *instance.Instance) ([]byte, error) {
+	key := make([]byte, archiveKeyLen)
+	r := hkdf.New(sha256.New, inst.SessionSecret(), []byte(inst.Domain), []byte("cozy-export-manifest"))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// instanceWrappingKey returns the key used by the instance to wrap the keys
+// of the archives. It is derived from the session secret.
+func instanceWrappingKey(inst *instance.Instance) []byte {
+	h := hmac.New(sha256.New, inst.SessionSecret())
+	_, _ = h.Write([]byte("exports-key"))
+	return h.Sum(nil)
+}
+
+func wrapArchiveKey(inst *instance.Instance, key []byte) ([]byte, error) {
+	aead, err := newGCM(instanceWrappingKey(inst))
+	if err != nil {
+		return nil, err
+	}
+	nonce := crypto.GenerateRandomBytes(aead.NonceSize())
+	return aead.Seal(nonce, nonce, key, []byte(inst.Domain)), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// signedManifest is the list of fields of an export document that are
+// covered by its signature. The slices are never nil, as the export document
+// can be serialized with an empty list or without the field.
+type signedManifest struct {
+	ID           string   `json:"id"`
+	Domain       string   `json:"domain"`
+	PartsCursors []string `json:"parts_cursors"`
+	WithDoctypes []string `json:"with_doctypes"`
+	CreatedAt    int64    `json:"created_at"`
+	ExpiresAt    int64    `json:"expires_at"`
+	TotalSize    int64    `json:"total_size"`
+	Salt         []byte   `json:"salt"`
+	Check        []byte   `json:"check"`
+	// Omitted when empty, to keep the signatures of the older exports valid
+	QuarantinedFiles []string `json:"quarantined_files,omitempty"`
+}
+
+// manifestSignature computes the signature of the export document, with the
+// key of the instance. As this key is not saved with the export, a manifest
+// can't be forged by someone who knows the passphrase or who can write the
+// export document.
+func (e *ExportDoc) manifestSignature(inst *instance.Instance) ([]byte, error) {
+	if e.Encryption == nil {
+		return nil, ErrPassphraseRequired
+	}
+	payload, err := json.Marshal(signedManifest{
+		ID:           e.ID(),
+		Domain:       e.Domain,
+		PartsCursors: append([]string{}, e.PartsCursors...),
+		WithDoctypes: append([]string{}, e.WithDoctypes...),
+		CreatedAt:    e.CreatedAt.UnixNano(),
+		ExpiresAt:    e.ExpiresAt.UnixNano(),
+		TotalSize:    e.TotalSize,
+		Salt:         e.Encryption.Salt,
+		Check:        e.Encryption.Check,
+
+		QuarantinedFiles: e.QuarantinedFiles,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := instanceManifestKey(inst)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, signingKey)
+	_, _ = h.Write(payload)
+	return h.Sum(nil), nil
+}
+
+// sign adds the signature to the manifest of an encrypted export.
+func (e *ExportDoc) sign(inst *instance.Instance) error {
+	var err error
+	e.Signature, err = e.manifestSignature(inst)
+	return err
+}
+
+// verifySignature checks that the manifest of an encrypted export has been
+// signed by the instance, before it is given to an importer.
+func (e *ExportDoc) verifySignature(inst *instance.Instance) error {
+	if e.Encryption == nil {
+		return nil
+	}
+	expected, err := e.manifestSignature(inst)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, e.Signature) {
+		return ErrInvalidEncryptedArchive
+	}
+	return nil
+}
+
+// VerifyPassphrase derives the key of the archive from the passphrase, and
+// checks it with the check value of the manifest. It returns the key.
+func (e *ExportDoc) VerifyPassphrase(passphrase string) ([]byte, error) {
+	if e.Encryption == nil {
+		return nil, nil
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	key, err := deriveArchiveKey(passphrase, e.Encryption.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.verifyPassphraseKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (e *ExportDoc) verifyPassphraseKey(key []byte) error {
+	if e.Encryption == nil {
+		return ErrPassphraseRequired
+	}
+	expected, err := passphraseCheck(key, e.Encryption.Salt)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, e.Encryption.Check) {
+		return ErrInvalidPassphrase
+	}
+	return nil
+}
+
+// encryptedWriter encrypts what is written to it, in the format of the
+// encrypted archives. It must be closed to write the last chunk.
+type encryptedWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint64
+}
+
+func newEncryptedWriter(w io.Writer, key, salt []byte, part int) (*encryptedWriter, error) {
+	if len(salt) != encryptedSaltLen {
+		return nil, errors.New("export: invalid salt")
+	}
+	pkey, err := partKey(key, salt, part)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(pkey)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, encryptedHeaderLen)
+	header = append(header, encryptedMagic...)
+	header = append(header, salt...)
+	var number [4]byte
+	binary.BigEndian.PutUint32(number[:], uint32(part))
+	header = append(header, number[:]...)
+	if len(header) != encryptedHeaderLen {
+		return nil, errors.New("export: invalid salt")
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptedWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, encryptedChunkSize),
+	}, nil
+}
+
+func (ew *encryptedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// The buffer is flushed only when there is more data, so that the
+		// last chunk is never empty (except for an empty content).
+		if len(ew.buf) == encryptedChunkSize {
+			if err := ew.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(ew.buf[len(ew.buf):encryptedChunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (ew *encryptedWriter) Close() error {
+	return ew.flush(true)
+}
+
+func (ew *encryptedWriter) flush(last bool) error {
+	sealed := ew.aead.Seal(nil, chunkNonce(ew.counter, last), ew.buf, ew.header)
+	length := uint32(len(sealed))
+	if last {
+		length |= encryptedLastChunk
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], length)
+	if _, err := ew.w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := ew.w.Write(sealed); err != nil {
+		return err
+	}
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	return nil
+}
+
+// encryptedReader decrypts an encrypted archive.
+type encryptedReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+// readEncryptedHeader reads the header of an encrypted archive, and returns
+// the salt and the number of the part.
+func readEncryptedHeader(r io.Reader) ([]byte, []byte, int, error) {
+	header := make([]byte, encryptedHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, 0, ErrNotEncrypted
+	}
+	if !bytes.Equal(header[:len(encryptedMagic)], []byte(encryptedMagic)) {
+		return nil, nil, 0, ErrNotEncrypted
+	}
+	salt := header[len(encryptedMagic) : len(encryptedMagic)+encryptedSaltLen]
+	part := binary.BigEndian.Uint32(header[len(encryptedMagic)+encryptedSaltLen:])
+	return header, salt, int(part), nil
+}
+
+func newEncryptedReader(r io.Reader, key, header []byte) (*encryptedReader, error) {
+	salt := header[len(encryptedMagic) : len(encryptedMagic)+encryptedSaltLen]
+	part := binary.BigEndian.Uint32(header[len(encryptedMagic)+encryptedSaltLen:])
+	pkey, err := partKey(key, salt, int(part))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(pkey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedReader{r: r, aead: aead, header: header}, nil
+}
+
+// newDecryptingReader checks the header of the encrypted part of an export,
+// and returns a reader for its decrypted content.
+func newDecryptingReader(r io.Reader, key []byte, part int) (io.Reader, error) {
+	header, _, number, err := readEncryptedHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if number != part {
+		return nil, ErrInvalidEncryptedArchive
+	}
+	return newEncryptedReader(r, key, header)
+}
+
+func (er *encryptedReader) Read(p []byte) (int, error) {
+	for len(er.buf) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, er.buf)
+	er.buf = er.buf[n:]
+	return n, nil
+}
+
+func (er *encryptedReader) next() error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(er.r, prefix[:]); err != nil {
+		// The last chunk has not been seen: the archive has been truncated
+		return ErrInvalidEncryptedArchive
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	last := length&encryptedLastChunk != 0
+	length &^= encryptedLastChunk
+	if length > uint32(encryptedChunkSize+er.aead.Overhead()) {
+		return ErrInvalidEncryptedArchive
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(er.r, sealed); err != nil {
+		return ErrInvalidEncryptedArchive
+	}
+	plain, err := er.aead.Open(sealed[:0], chunkNonce(er.counter, last), sealed, er.header)
+	if err != nil {
+		return ErrInvalidEncryptedArchive
+	}
+	er.counter++
+	er.buf = plain
+	er.done = last
+	return nil
+}
+
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// DecryptArchive can be used to decrypt a part of an export that has been
+// downloaded, with the passphrase chosen by the user.
+func DecryptArchive(dst io.Writer, src io.Reader, passphrase string) error {
+	header, salt, _, err := readEncryptedHeader(src)
+	if err != nil {
+		return err
+	}
+	key, err := deriveArchiveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	er, err := newEncryptedReader(src, key, header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, er)
+	return err
+}
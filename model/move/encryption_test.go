@@ -0,0 +1,156 @@
+package move
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedArchives(t *testing.T) {
+	inst := &instance.Instance{
+		Domain:     "alice.cozy.example",
+		SessSecret: crypto.GenerateRandomBytes(64),
+	}
+	encryption, err := NewArchiveEncryption(inst, "my secret passphrase")
+	require.NoError(t, err)
+	key, err := encryption.Key(inst)
+	require.NoError(t, err)
+
+	encrypt := func(t *testing.T, content []byte, part int) []byte {
+		var buf bytes.Buffer
+		ew, err := newEncryptedWriter(&buf, key, encryption.Salt, part)
+		require.NoError(t, err)
+		_, err = ew.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, ew.Close())
+		return buf.Bytes()
+	}
+
+	t.Run("WrappedKey", func(t *testing.T) {
+		_, err := NewArchiveEncryption(inst, "")
+		assert.ErrorIs(t, err, ErrPassphraseRequired)
+
+		other := &instance.Instance{
+			Domain:     "bob.cozy.example",
+			SessSecret: crypto.GenerateRandomBytes(64),
+		}
+		_, err = encryption.Key(other)
+		assert.ErrorIs(t, err, ErrInvalidPassphrase)
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		sizes := []int{0, 1, encryptedChunkSize, encryptedChunkSize + 1, 3*encryptedChunkSize + 42}
+		for _, size := range sizes {
+			content := crypto.GenerateRandomBytes(size)
+			encrypted := encrypt(t, content, 2)
+			assert.Equal(t, encryptedMagic, string(encrypted[:len(encryptedMagic)]))
+
+			r, err := newDecryptingReader(bytes.NewReader(encrypted), key, 2)
+			require.NoError(t, err)
+			decrypted, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, content, decrypted)
+
+			var out bytes.Buffer
+			err = DecryptArchive(&out, bytes.NewReader(encrypted), "my secret passphrase")
+			require.NoError(t, err)
+			assert.Equal(t, content, out.Bytes())
+		}
+	})
+
+	t.Run("KeyPerPart", func(t *testing.T) {
+		content := crypto.GenerateRandomBytes(encryptedChunkSize + 10)
+		first := encrypt(t, content, 1)
+		second := encrypt(t, content, 2)
+		require.Equal(t, len(first), len(second))
+		// Same chunk counters, but not the same keystream
+		assert.NotEqual(t, first[encryptedHeaderLen:], second[encryptedHeaderLen:])
+
+		// A part with the header of another part can't be decrypted
+		swapped := make([]byte, len(second))
+		copy(swapped, second)
+		copy(swapped, first[:encryptedHeaderLen])
+		r, err := newDecryptingReader(bytes.NewReader(swapped), key, 1)
+		require.NoError(t, err)
+		_, err = io.ReadAll(r)
+		assert.ErrorIs(t, err, ErrInvalidEncryptedArchive)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		content := crypto.GenerateRandomBytes(2*encryptedChunkSize + 10)
+		encrypted := encrypt(t, content, 1)
+
+		var out bytes.Buffer
+		err := DecryptArchive(&out, bytes.NewReader(encrypted), "wrong passphrase")
+		assert.ErrorIs(t, err, ErrInvalidEncryptedArchive)
+
+		err = DecryptArchive(&out, bytes.NewReader([]byte("PK\x03\x04 not encrypted")), "my secret passphrase")
+		assert.ErrorIs(t, err, ErrNotEncrypted)
+
+		_, err = newDecryptingReader(bytes.NewReader(encrypted), key, 0)
+		assert.ErrorIs(t, err, ErrInvalidEncryptedArchive)
+
+		truncated := encrypted[:len(encrypted)-encryptedChunkSize/2]
+		err = DecryptArchive(&out, bytes.NewReader(truncated), "my secret passphrase")
+		assert.ErrorIs(t, err, ErrInvalidEncryptedArchive)
+
+		altered := make([]byte, len(encrypted))
+		copy(altered, encrypted)
+		altered[encryptedHeaderLen+100] ^= 0xff
+		err = DecryptArchive(&out, bytes.NewReader(altered), "my secret passphrase")
+		assert.ErrorIs(t, err, ErrInvalidEncryptedArchive)
+	})
+
+	t.Run("Signature", func(t *testing.T) {
+		now := time.Now()
+		doc := &ExportDoc{
+			DocID:        "0123456789",
+			Domain:       inst.Domain,
+			PartsCursors: []string{"io.cozy.files/abc"},
+			CreatedAt:    now,
+			ExpiresAt:    now.Add(archiveMaxAge),
+			TotalSize:    12345,
+			Encryption:   encryption,
+		}
+		require.NoError(t, doc.sign(inst))
+		assert.NotEmpty(t, doc.Signature)
+		assert.NoError(t, doc.verifySignature(inst))
+
+		manifest := doc.Manifest()
+		assert.Empty(t, manifest.Encryption.WrappedKey)
+		assert.NotEmpty(t, doc.Encryption.WrappedKey)
+
+		verified, err := manifest.VerifyPassphrase("my secret passphrase")
+		require.NoError(t, err)
+		assert.Equal(t, key, verified)
+
+		_, err = manifest.VerifyPassphrase("")
+		assert.ErrorIs(t, err, ErrPassphraseRequired)
+		_, err = manifest.VerifyPassphrase("wrong passphrase")
+		assert.ErrorIs(t, err, ErrInvalidPassphrase)
+
+		// The signature is made with a key of the instance, not with the
+		// passphrase: it can't be forged by someone who knows the passphrase.
+		other := &instance.Instance{
+			Domain:     inst.Domain,
+			SessSecret: crypto.GenerateRandomBytes(64),
+		}
+		assert.ErrorIs(t, doc.verifySignature(other), ErrInvalidEncryptedArchive)
+
+		tampered := doc.Manifest()
+		tampered.PartsCursors = nil
+		assert.ErrorIs(t, tampered.verifySignature(inst), ErrInvalidEncryptedArchive)
+
+		plain := &ExportDoc{DocID: "0123456789"}
+		verified, err = plain.VerifyPassphrase("")
+		assert.NoError(t, err)
+		assert.Nil(t, verified)
+		assert.NoError(t, plain.verifySignature(inst))
+	})
+}
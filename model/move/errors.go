@@ -23,4 +23,16 @@ var (
 	ErrExportInvalidCursor = echo.NewHTTPError(http.StatusBadRequest, "export: cursor is invalid")
 	// ErrNotEnoughSpace is used when the quota is too small to import the files
 	ErrNotEnoughSpace = echo.NewHTTPError(http.StatusRequestEntityTooLarge, "import: not enough disk space")
+	// ErrPassphraseRequired is used when the export is encrypted and no
+	// passphrase has been given
+	ErrPassphraseRequired = echo.NewHTTPError(http.StatusUnprocessableEntity, "export: a passphrase is required")
+	// ErrInvalidPassphrase is used when the passphrase does not match the
+	// signature of the manifest, or when the manifest has been tampered
+	ErrInvalidPassphrase = echo.NewHTTPError(http.StatusUnprocessableEntity, "export: invalid passphrase")
+	// ErrNotEncrypted is used when trying to decrypt a file that is not an
+	// encrypted archive
+	ErrNotEncrypted = echo.NewHTTPError(http.StatusBadRequest, "export: the archive is not encrypted")
+	// ErrInvalidEncryptedArchive is used when an encrypted archive cannot be
+	// decrypted, because it has been truncated or altered
+	ErrInvalidEncryptedArchive = echo.NewHTTPError(http.StatusBadRequest, "export: the encrypted archive is invalid")
 )
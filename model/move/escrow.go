@@ -0,0 +1,482 @@
+package move
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/note"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/labstack/echo/v4"
+	"github.com/ncw/swift/v2"
+	"github.com/spf13/afero"
+)
+
+var (
+	// ErrEscrowDisabled is used when an escrow export is asked, but no
+	// passphrase has been configured for encrypting them.
+	ErrEscrowDisabled = echo.NewHTTPError(http.StatusForbidden, "escrow: no passphrase in the configuration")
+	// ErrEscrowJustification is used when the operator or the reason of a
+	// request on the escrow exports is missing.
+	ErrEscrowJustification = echo.NewHTTPError(http.StatusBadRequest, "escrow: the operator and the reason are required")
+	// ErrEscrowNotFound is used when an escrow export could not be found
+	ErrEscrowNotFound = echo.NewHTTPError(http.StatusNotFound, "escrow: not found")
+	// ErrEscrowExpired is used when the retention of an escrow export is over
+	ErrEscrowExpired = echo.NewHTTPError(http.StatusGone, "escrow: has expired")
+	// ErrEscrowNotReady is used when the archive of an escrow export has not
+	// been successfully written
+	ErrEscrowNotReady = echo.NewHTTPError(http.StatusConflict, "escrow: the archive is not available")
+)
+
+// EscrowDoc is the metadata of an escrow export: a snapshot of an instance,
+// made by an operator before destroying it, and kept for the legal requests.
+// It is stored in the global database, as it must outlive the instance.
+type EscrowDoc struct {
+	DocID       string    `json:"_id,omitempty"`
+	DocRev      string    `json:"_rev,omitempty"`
+	Domain      string    `json:"domain"`
+	UUID        string    `json:"uuid,omitempty"`
+	ContextName string    `json:"context,omitempty"`
+	Operator    string    `json:"operator"`
+	Reason      string    `json:"reason"`
+	State       string    `json:"state"`
+	Error       string    `json:"error,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// DocType implements the couchdb.Doc interface
+func (e *EscrowDoc) DocType() string { return consts.Escrows }
+
+// ID implements the couchdb.Doc interface
+func (e *EscrowDoc) ID() string { return e.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (e *EscrowDoc) Rev() string { return e.DocRev }
+
+// SetID implements the couchdb.Doc interface
+func (e *EscrowDoc) SetID(id string) { e.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (e *EscrowDoc) SetRev(rev string) { e.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (e *EscrowDoc) Clone() couchdb.Doc {
+	clone := *e
+	return &clone
+}
+
+// HasExpired returns true if the retention of the escrow export is over.
+func (e *EscrowDoc) HasExpired() bool {
+	return time.Until(e.ExpiresAt) <= 0
+}
+
+// Filename returns the name of the file for downloading the archive.
+func (e *EscrowDoc) Filename() string {
+	return fmt.Sprintf("%s-%s.tar.gz.enc", e.Domain, e.CreatedAt.UTC().Format("20060102T150405Z"))
+}
+
+// EscrowArchiver is used to store the archives of the escrow exports. They are
+// kept apart from the exports requested by the users.
+type EscrowArchiver interface {
+	OpenEscrow(doc *EscrowDoc) (io.ReadCloser, error)
+	CreateEscrow(doc *EscrowDoc) (io.WriteCloser, error)
+	RemoveEscrows(docs []*EscrowDoc) error
+}
+
+// SystemEscrowArchiver returns the archiver for the escrow exports, using the
+// container from the configuration.
+func SystemEscrowArchiver() EscrowArchiver {
+	container := config.GetConfig().Escrow.Container
+	fsURL := config.FsURL()
+	switch fsURL.Scheme {
+	case config.SchemeFile, config.SchemeMem:
+		fs := afero.NewBasePathFs(afero.NewOsFs(), path.Join(fsURL.Path, container))
+		return aferoEscrowArchiver{fs}
+	case config.SchemeSwift, config.SchemeSwiftSecure:
+		return &swiftEscrowArchiver{
+			c:         config.GetSwiftConnection(),
+			container: container,
+			ctx:       context.Background(),
+		}
+	default:
+		panic(fmt.Errorf("escrow: unknown storage provider %s", fsURL.Scheme))
+	}
+}
+
+type aferoEscrowArchiver struct {
+	fs afero.Fs
+}
+
+func (a aferoEscrowArchiver) fileName(doc *EscrowDoc) string {
+	return path.Join(doc.Domain, doc.ID()+".tar.gz.enc")
+}
+
+func (a aferoEscrowArchiver) OpenEscrow(doc *EscrowDoc) (io.ReadCloser, error) {
+	return a.fs.Open(a.fileName(doc))
+}
+
+func (a aferoEscrowArchiver) CreateEscrow(doc *EscrowDoc) (io.WriteCloser, error) {
+	if err := a.fs.MkdirAll(path.Join("/", doc.Domain), 0700); err != nil {
+		return nil, err
+	}
+	return a.fs.OpenFile(a.fileName(doc), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+}
+
+func (a aferoEscrowArchiver) RemoveEscrows(docs []*EscrowDoc) error {
+	var errm error
+	for _, doc := range docs {
+		if err := a.fs.Remove(a.fileName(doc)); err != nil && !os.IsNotExist(err) {
+			errm = multierror.Append(errm, err)
+		}
+	}
+	return errm
+}
+
+type swiftEscrowArchiver struct {
+	c         *swift.Connection
+	container string
+	ctx       context.Context
+}
+
+func (a *swiftEscrowArchiver) init() error {
+	if _, _, err := a.c.Container(a.ctx, a.container); errors.Is(err, swift.ContainerNotFound) {
+		if err = a.c.ContainerCreate(a.ctx, a.container, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *swiftEscrowArchiver) OpenEscrow(doc *EscrowDoc) (io.ReadCloser, error) {
+	if err := a.init(); err != nil {
+		return nil, err
+	}
+	f, _, err := a.c.ObjectOpen(a.ctx, a.container, doc.Domain+"/"+doc.ID(), false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (a *swiftEscrowArchiver) CreateEscrow(doc *EscrowDoc) (io.WriteCloser, error) {
+	if err := a.init(); err != nil {
+		return nil, err
+	}
+	objectMeta := swift.Metadata{
+		"created-at": doc.CreatedAt.Format(time.RFC3339),
+		"operator":   doc.Operator,
+	}
+	headers := objectMeta.ObjectHeaders()
+	headers["X-Delete-At"] = strconv.FormatInt(doc.ExpiresAt.Unix(), 10)
+	return a.c.ObjectCreate(a.ctx, a.container, doc.Domain+"/"+doc.ID(), true, "",
+		"application/octet-stream", headers)
+}
+
+func (a *swiftEscrowArchiver) RemoveEscrows(docs []*EscrowDoc) error {
+	if err := a.init(); err != nil {
+		return err
+	}
+	var objectNames []string
+	for _, doc := range docs {
+		objectNames = append(objectNames, doc.Domain+"/"+doc.ID())
+	}
+	if len(objectNames) > 0 {
+		_, err := a.c.BulkDelete(a.ctx, a.container, objectNames)
+		return err
+	}
+	return nil
+}
+
+// CreateEscrow makes an escrow export of the instance. The archive is a
+// tarball with all the documents and files of the instance, encrypted with
+// the passphrase from the configuration, in the same format as the encrypted
+// exports. The expired escrow exports are removed at the same time.
+func CreateEscrow(inst *instance.Instance, operator, reason string, archiver EscrowArchiver) (*EscrowDoc, error) {
+	cfg := config.GetConfig().Escrow
+	if cfg.Passphrase == "" {
+		return nil, ErrEscrowDisabled
+	}
+	if operator == "" || reason == "" {
+		return nil, ErrEscrowJustification
+	}
+	if err := CleanExpiredEscrows(archiver); err != nil {
+		inst.Logger().WithNamespace("escrow").
+			Warnf("Cannot clean the expired escrow exports: %s", err)
+	}
+
+	now := time.Now().UTC()
+	doc := &EscrowDoc{
+		Domain:      inst.Domain,
+		UUID:        inst.UUID,
+		ContextName: inst.ContextName,
+		Operator:    operator,
+		Reason:      reason,
+		State:       ExportStateExporting,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(cfg.Retention),
+	}
+	if err := couchdb.CreateDoc(prefixer.GlobalPrefixer, doc); err != nil {
+		return nil, err
+	}
+
+	size, err := writeEscrow(inst, doc, cfg.Passphrase, archiver)
+	if err != nil {
+		doc.State = ExportStateError
+		doc.Error = err.Error()
+	} else {
+		doc.State = ExportStateDone
+		doc.Size = size
+	}
+	if erru := couchdb.UpdateDoc(prefixer.GlobalPrefixer, doc); erru != nil && err == nil {
+		err = erru
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func writeEscrow(inst *instance.Instance, doc *EscrowDoc, passphrase string, archiver EscrowArchiver) (int64, error) {
+	salt := crypto.GenerateRandomBytes(encryptedSaltLen)
+	key, err := deriveArchiveKey(passphrase, salt)
+	if err != nil {
+		return 0, err
+	}
+	out, err := archiver.CreateEscrow(doc)
+	if err != nil {
+		return 0, err
+	}
+	ew, err := newEncryptedWriter(out, key, salt, 0)
+	if err != nil {
+		_ = out.Close()
+		return 0, err
+	}
+	size, err := writeEscrowContent(inst, doc, ew)
+	if err == nil {
+		err = ew.Close()
+	}
+	if errc := out.Close(); errc != nil && err == nil {
+		err = errc
+	}
+	if err != nil {
+		_ = archiver.RemoveEscrows([]*EscrowDoc{doc})
+		return 0, err
+	}
+	return size, nil
+}
+
+func writeEscrowContent(inst *instance.Instance, doc *EscrowDoc, out io.Writer) (int64, error) {
+	gw, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(gw)
+
+	var size int64
+	n, err := writeInstanceDoc(inst, "instance", doc.CreatedAt, tw)
+	if err != nil {
+		return 0, err
+	}
+	size += n
+	// All the doctypes are accepted by an export document without
+	// WithDoctypes
+	n, err = exportDocuments(inst, &ExportDoc{}, doc.CreatedAt, tw)
+	if err != nil {
+		return 0, err
+	}
+	size += n
+	n, err = escrowFiles(inst, doc.CreatedAt, tw)
+	if err != nil {
+		return 0, err
+	}
+	size += n
+
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// escrowFiles writes the documents of the files and directories, and the
+// content of the files and of their old versions.
+func escrowFiles(inst *instance.Instance, now time.Time, tw *tar.Writer) (int64, error) {
+	_ = note.FlushPendings(inst)
+
+	fs := inst.VFS()
+	var size int64
+	err := vfs.Walk(fs, "/", func(fullpath string, dir *vfs.DirDoc, file *vfs.FileDoc, err error) error {
+		if err != nil {
+			return err
+		}
+		if dir != nil {
+			n, err := writeDoc(consts.Files, dir.DocID, dir, now, tw)
+			size += n
+			return err
+		}
+		n, err := writeDoc(consts.Files, file.DocID, file, now, tw)
+		size += n
+		if err != nil {
+			return err
+		}
+		// The escrow keeps the content of the quarantined files too
+		content, err := vfs.OpenQuarantinedFile(fs, file)
+		if os.IsNotExist(err) {
+			// The file may have been deleted while the export is running
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		n, err = writeContent(path.Join(ExportFilesDir, fullpath), file.ByteSize, file.UpdatedAt, content, tw)
+		size += n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = couchdb.ForeachDocs(inst, consts.FilesVersions, func(id string, raw json.RawMessage) error {
+		n, err := writeMarshaledDoc(consts.FilesVersions, id, raw, now, tw)
+		size += n
+		if err != nil {
+			return err
+		}
+		var version vfs.Version
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return err
+		}
+		file, err := fs.FileByID(version.Rels.File.Data.ID)
+		if err != nil {
+			return nil
+		}
+		content, err := fs.OpenFileVersion(file, &version)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		n, err = writeContent(path.Join(consts.FilesVersions, id), version.ByteSize, version.UpdatedAt, content, tw)
+		size += n
+		return err
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return 0, err
+	}
+	return size, nil
+}
+
+func writeContent(name string, length int64, modTime time.Time, content io.Reader, tw *tar.Writer) (int64, error) {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0640,
+		Size:     length,
+		Typeflag: tar.TypeReg,
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return 0, err
+	}
+	return io.CopyN(tw, content, length)
+}
+
+// GetEscrow returns the escrow export with the given identifier.
+func GetEscrow(id string) (*EscrowDoc, error) {
+	doc := &EscrowDoc{}
+	err := couchdb.GetDoc(prefixer.GlobalPrefixer, consts.Escrows, id, doc)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, ErrEscrowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ListEscrows returns the escrow exports, from the newest to the oldest. If a
+// domain is given, only the escrow exports of this domain are returned.
+func ListEscrows(domain string) ([]*EscrowDoc, error) {
+	var docs []*EscrowDoc
+	var err error
+	if domain == "" {
+		err = couchdb.GetAllDocs(prefixer.GlobalPrefixer, consts.Escrows, &couchdb.AllDocsRequest{}, &docs)
+	} else {
+		req := &couchdb.FindRequest{
+			UseIndex: "by-domain",
+			Selector: mango.Equal("domain", domain),
+			Sort: mango.SortBy{
+				{Field: "domain", Direction: mango.Desc},
+				{Field: "created_at", Direction: mango.Desc},
+			},
+			Limit: 1000,
+		}
+		err = couchdb.FindDocs(prefixer.GlobalPrefixer, consts.Escrows, req, &docs)
+	}
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// OpenEscrowArchive returns the encrypted archive of an escrow export.
+func OpenEscrowArchive(doc *EscrowDoc, archiver EscrowArchiver) (io.ReadCloser, error) {
+	if doc.HasExpired() {
+		return nil, ErrEscrowExpired
+	}
+	if doc.State != ExportStateDone {
+		return nil, ErrEscrowNotReady
+	}
+	return archiver.OpenEscrow(doc)
+}
+
+// CleanExpiredEscrows removes the escrow exports when their retention is
+// over.
+func CleanExpiredEscrows(archiver EscrowArchiver) error {
+	docs, err := ListEscrows("")
+	if err != nil {
+		return err
+	}
+	var expired []*EscrowDoc
+	for _, doc := range docs {
+		if doc.HasExpired() {
+			expired = append(expired, doc)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	if err := archiver.RemoveEscrows(expired); err != nil {
+		return err
+	}
+	toDelete := make([]couchdb.Doc, len(expired))
+	for i, doc := range expired {
+		toDelete[i] = doc
+	}
+	return couchdb.BulkDeleteDocs(prefixer.GlobalPrefixer, consts.Escrows, toDelete)
+}
+
+var _ couchdb.Doc = &EscrowDoc{}
@@ -0,0 +1,67 @@
+package move
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscrow(t *testing.T) {
+	archiver := aferoEscrowArchiver{afero.NewMemMapFs()}
+	doc := &EscrowDoc{
+		DocID:     "123",
+		Domain:    "alice.cozy.example",
+		State:     ExportStateDone,
+		CreatedAt: time.Date(2026, 10, 16, 9, 12, 31, 0, time.UTC),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	t.Run("Archive", func(t *testing.T) {
+		passphrase := "the passphrase of the legal team"
+		salt := crypto.GenerateRandomBytes(encryptedSaltLen)
+		key, err := deriveArchiveKey(passphrase, salt)
+		require.NoError(t, err)
+
+		out, err := archiver.CreateEscrow(doc)
+		require.NoError(t, err)
+		ew, err := newEncryptedWriter(out, key, salt, 0)
+		require.NoError(t, err)
+		_, err = ew.Write([]byte("snapshot of the instance"))
+		require.NoError(t, err)
+		require.NoError(t, ew.Close())
+		require.NoError(t, out.Close())
+
+		// The archive can be decrypted with the tool for the exports
+		content, err := OpenEscrowArchive(doc, archiver)
+		require.NoError(t, err)
+		defer content.Close()
+		var decrypted bytes.Buffer
+		require.NoError(t, DecryptArchive(&decrypted, content, passphrase))
+		assert.Equal(t, "snapshot of the instance", decrypted.String())
+
+		require.NoError(t, archiver.RemoveEscrows([]*EscrowDoc{doc}))
+		_, err = archiver.OpenEscrow(doc)
+		assert.Error(t, err)
+	})
+
+	t.Run("NotAvailable", func(t *testing.T) {
+		expired := *doc
+		expired.ExpiresAt = time.Now().Add(-time.Minute)
+		_, err := OpenEscrowArchive(&expired, archiver)
+		assert.ErrorIs(t, err, ErrEscrowExpired)
+
+		failed := *doc
+		failed.State = ExportStateError
+		_, err = OpenEscrowArchive(&failed, archiver)
+		assert.ErrorIs(t, err, ErrEscrowNotReady)
+	})
+
+	t.Run("Filename", func(t *testing.T) {
+		assert.Equal(t, "alice.cozy.example-20261016T091231Z.tar.gz.enc", doc.Filename())
+	})
+}
@@ -6,8 +6,10 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
+	"os"
 	"path"
 	"time"
 
@@ -32,6 +34,28 @@ type ExportOptions struct {
 	IgnoreVault      bool           `json:"ignore_vault,omitempty"`
 	MoveTo           *MoveToOptions `json:"move_to,omitempty"`
 	AdminReq         bool           `json:"admin_req,omitempty"`
+
+	// Passphrase is only used when the export is requested: it is replaced by
+	// the encryption parameters before the job is pushed.
+	Passphrase string             `json:"passphrase,omitempty"`
+	Encryption *ArchiveEncryption `json:"encryption,omitempty"`
+}
+
+// EncryptWithPassphrase replaces the passphrase in the options by the
+// encryption parameters for the archives, so that the passphrase is not saved
+// in the job message.
+func (o *ExportOptions) EncryptWithPassphrase(inst *instance.Instance) error {
+	if o.Passphrase == "" {
+		o.Encryption = nil
+		return nil
+	}
+	encryption, err := NewArchiveEncryption(inst, o.Passphrase)
+	if err != nil {
+		return err
+	}
+	o.Passphrase = ""
+	o.Encryption = encryption
+	return nil
 }
 
 // MoveToOptions is used when the export must be sent to another Cozy.
@@ -72,8 +96,48 @@ const (
 	ExportVersionsDir = "My Cozy/Versions"
 )
 
-// ExportCopyData does an HTTP copy of a part of the file indexes.
+// ExportCopyData does an HTTP copy of a part of the file indexes. If the
+// export has been requested with a passphrase, the part is encrypted.
 func ExportCopyData(w io.Writer, inst *instance.Instance, exportDoc *ExportDoc, archiver Archiver, cursor Cursor) error {
+	if exportDoc.Encryption == nil {
+		return copyData(w, inst, exportDoc, archiver, cursor)
+	}
+	key, err := exportDoc.Encryption.Key(inst)
+	if err != nil {
+		return err
+	}
+	ew, err := newEncryptedWriter(w, key, exportDoc.Encryption.Salt, cursor.Number)
+	if err != nil {
+		return err
+	}
+	if err := copyData(ew, inst, exportDoc, archiver, cursor); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// ExportFilename returns the name of the file for downloading a part of the
+// export.
+func ExportFilename(exportDoc *ExportDoc, name string, cursor Cursor) string {
+	filename := name + ".zip"
+	if len(exportDoc.PartsCursors) > 0 {
+		filename = fmt.Sprintf("%s - part%03d.zip", name, cursor.Number)
+	}
+	if exportDoc.Encryption != nil {
+		filename += ".enc"
+	}
+	return filename
+}
+
+// ExportContentType returns the content-type for a part of the export.
+func ExportContentType(exportDoc *ExportDoc) string {
+	if exportDoc.Encryption != nil {
+		return "application/octet-stream"
+	}
+	return "application/zip"
+}
+
+func copyData(w io.Writer, inst *instance.Instance, exportDoc *ExportDoc, archiver Archiver, cursor Cursor) error {
 	zw := zip.NewWriter(w)
 	defer func() {
 		_ = zw.Close()
@@ -179,13 +243,21 @@ func copyFiles(zw *zip.Writer, inst *instance.Instance, exportDoc *ExportDoc, cu
 			return err
 		}
 
+		if file.Quarantined() {
+			// The content of a quarantined file is not exported, and the
+			// file is listed in the manifest instead
+			continue
+		}
 		f, err := fs.OpenFile(file)
-		if err != nil {
+		if os.IsNotExist(err) {
 			// Ignore missing file, as it may happen that a file is deleted
 			// while an export is running as we are not always locking the
 			// VFS or blocking the instance (or the file system is not clean)
 			continue
 		}
+		if err != nil {
+			return err
+		}
 		defer func() {
 			_ = f.Close()
 		}()
@@ -379,6 +451,10 @@ func exportFiles(i *instance.Instance, exportDoc *ExportDoc, tw *tar.Writer) (in
 			size += n
 			return err
 		}
+		if file.Quarantined() {
+			exportDoc.QuarantinedFiles = append(exportDoc.QuarantinedFiles, file.DocID)
+			return nil
+		}
 		filesizes[file.DocID] = file.ByteSize
 		return nil
 	})
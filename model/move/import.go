@@ -25,6 +25,11 @@ type ImportOptions struct {
 	ManifestURL string       `json:"manifest_url,omitempty"`
 	Vault       bool         `json:"vault,omitempty"`
 	MoveFrom    *FromOptions `json:"move_from,omitempty"`
+
+	// Passphrase is used for an encrypted export: it is replaced by the
+	// encryption parameters before the job is pushed.
+	Passphrase string             `json:"passphrase,omitempty"`
+	Encryption *ArchiveEncryption `json:"encryption,omitempty"`
 }
 
 // FromOptions is used when the import finishes to notify the source Cozy.
@@ -34,8 +39,9 @@ type FromOptions struct {
 }
 
 // CheckImport returns an error if an exports cannot be found at the given URL,
-// or if the instance has not enough disk space to import the files.
-func CheckImport(inst *instance.Instance, settingsURL string) error {
+// if the passphrase is missing or invalid for an encrypted export, or if the
+// instance has not enough disk space to import the files.
+func CheckImport(inst *instance.Instance, settingsURL, passphrase string) error {
 	manifestURL, err := transformSettingsURLToManifestURL(settingsURL)
 	if err != nil {
 		inst.Logger().WithNamespace("move").
@@ -48,6 +54,9 @@ func CheckImport(inst *instance.Instance, settingsURL string) error {
 			Warnf("Cannot fetch manifest: %s", err)
 		return ErrExportNotFound
 	}
+	if _, err := manifest.VerifyPassphrase(passphrase); err != nil {
+		return err
+	}
 	if inst.BytesDiskQuota > 0 && manifest.TotalSize > inst.BytesDiskQuota {
 		return ErrNotEnoughSpace
 	}
@@ -63,6 +72,9 @@ func ScheduleImport(inst *instance.Instance, options ImportOptions) error {
 	}
 	options.ManifestURL = manifestURL
 	options.SettingsURL = ""
+	if err := options.encryptWithPassphrase(inst); err != nil {
+		return err
+	}
 	msg, err := job.NewMessage(options)
 	if err != nil {
 		return err
@@ -84,6 +96,25 @@ func ScheduleImport(inst *instance.Instance, options ImportOptions) error {
 	return nil
 }
 
+// encryptWithPassphrase checks the passphrase against the check value of the
+// manifest, and replaces it with the key of the archive, wrapped by the key
+// of the instance, so that the passphrase is not saved in the job message.
+func (o *ImportOptions) encryptWithPassphrase(inst *instance.Instance) error {
+	passphrase := o.Passphrase
+	o.Passphrase = ""
+	o.Encryption = nil
+	manifest, err := fetchManifest(o.ManifestURL)
+	if err != nil {
+		return ErrExportNotFound
+	}
+	key, err := manifest.VerifyPassphrase(passphrase)
+	if err != nil || key == nil {
+		return err
+	}
+	o.Encryption, err = newArchiveEncryptionWithKey(inst, manifest.Encryption.Salt, key)
+	return err
+}
+
 func transformSettingsURLToManifestURL(settingsURL string) (string, error) {
 	u, err := url.Parse(strings.TrimSpace(settingsURL))
 	if err != nil {
@@ -144,6 +175,18 @@ func Import(inst *instance.Instance, options ImportOptions) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	var key []byte
+	if doc.Encryption != nil {
+		if options.Encryption == nil {
+			return nil, ErrPassphraseRequired
+		}
+		if key, err = options.Encryption.Key(inst); err != nil {
+			return nil, err
+		}
+		if err = doc.verifyPassphraseKey(key); err != nil {
+			return nil, err
+		}
+	}
 
 	if err = GetStore().SetAllowDeleteAccounts(inst); err != nil {
 		return nil, err
@@ -160,13 +203,14 @@ func Import(inst *instance.Instance, options ImportOptions) ([]string, error) {
 		fs:              inst.VFS(),
 		options:         options,
 		doc:             doc,
+		key:             key,
 		servicesInError: make(map[string]bool),
 	}
-	if err = im.importPart(""); err != nil {
+	if err = im.importPart("", 0); err != nil {
 		return nil, err
 	}
-	for _, cursor := range doc.PartsCursors {
-		if erri := im.importPart(cursor); erri != nil {
+	for i, cursor := range doc.PartsCursors {
+		if erri := im.importPart(cursor, i+1); erri != nil {
 			err = multierror.Append(err, erri)
 		}
 	}
@@ -29,6 +29,7 @@ type importer struct {
 	fs              vfs.VFS
 	options         ImportOptions
 	doc             *ExportDoc
+	key             []byte          // the key for decrypting an encrypted export
 	servicesInError map[string]bool // a map, not a slice, to have unique values
 	tmpFile         string
 	doctype         string
@@ -36,7 +37,7 @@ type importer struct {
 	triggers        []*job.TriggerInfos
 }
 
-func (im *importer) importPart(cursor string) error {
+func (im *importer) importPart(cursor string, number int) error {
 	defer func() {
 		if im.tmpFile != "" {
 			if err := os.Remove(im.tmpFile); err != nil {
@@ -45,7 +46,7 @@ func (im *importer) importPart(cursor string) error {
 			}
 		}
 	}()
-	if err := im.downloadFile(cursor); err != nil {
+	if err := im.downloadFile(cursor, number); err != nil {
 		return err
 	}
 	zr, err := zip.OpenReader(im.tmpFile)
@@ -59,7 +60,7 @@ func (im *importer) importPart(cursor string) error {
 	return err
 }
 
-func (im *importer) downloadFile(cursor string) error {
+func (im *importer) downloadFile(cursor string, number int) error {
 	u, err := url.Parse(im.options.ManifestURL)
 	if err != nil {
 		return err
@@ -81,7 +82,15 @@ func (im *importer) downloadFile(cursor string) error {
 		return err
 	}
 	im.tmpFile = f.Name()
-	_, err = io.Copy(f, res.Body)
+	var body io.Reader = res.Body
+	if im.key != nil {
+		body, err = newDecryptingReader(res.Body, im.key, number)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	_, err = io.Copy(f, body)
 	if errc := f.Close(); err == nil {
 		err = errc
 	}
@@ -115,6 +115,7 @@ func notifyMember(inst *instance.Instance, s *sharing.Sharing, index int) error
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: sharing.ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
@@ -20,4 +20,18 @@ var (
 	ErrTooOld = errors.New("The revision is too old")
 	// ErrMissingSessionID is used when a telepointer has no identifier.
 	ErrMissingSessionID = errors.New("The session id is missing")
+	// ErrInvalidPresence is used when a presence has an unknown status.
+	ErrInvalidPresence = errors.New("Invalid status for the presence")
+	// ErrInvalidExportFormat is used when a note is exported to an unknown
+	// format.
+	ErrInvalidExportFormat = errors.New("Invalid format for the export")
+	// ErrPDFExportDisabled is used when a note is exported to PDF, but no
+	// command has been configured for the conversion.
+	ErrPDFExportDisabled = errors.New("The export to PDF is not available")
+	// ErrExportTooLarge is used when the note, or the PDF generated for it,
+	// is too large to be exported.
+	ErrExportTooLarge = errors.New("The note is too large to be exported")
+	// ErrTemplateNotFound is used when a note is created from a template that
+	// doesn't exist.
+	ErrTemplateNotFound = errors.New("The template is not found")
 )
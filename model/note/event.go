@@ -79,6 +79,36 @@ func PutTelepointer(inst *instance.Instance, t Event) error {
 	return nil
 }
 
+// List of possible status for a presence
+const (
+	// PresenceJoined is used when a user opens the note
+	PresenceJoined = "joined"
+	// PresenceActive is used as a heartbeat, and to answer to a joined
+	// presence, so that the new user knows who is already editing the note
+	PresenceActive = "active"
+	// PresenceLeft is used when a user closes the note
+	PresenceLeft = "left"
+)
+
+// PutPresence sends an ephemeral presence message (who has the note opened,
+// with which name and color) in the realtime hub. Nothing is persisted.
+func PutPresence(inst *instance.Instance, p Event) error {
+	if p["sessionID"] == nil || p["sessionID"] == "" {
+		return ErrMissingSessionID
+	}
+	if p["status"] == nil || p["status"] == "" {
+		p["status"] = PresenceActive
+	}
+	switch p["status"] {
+	case PresenceJoined, PresenceActive, PresenceLeft:
+	default:
+		return ErrInvalidPresence
+	}
+	p["doctype"] = consts.NotesPresences
+	p.publish(inst)
+	return nil
+}
+
 func publishUpdatedTitle(inst *instance.Instance, fileID, title, sessionID string) {
 	event := Event{
 		"title":     title,
@@ -0,0 +1,178 @@
+package note
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+)
+
+const (
+	// ExportMarkdown is the format for exporting a note to markdown.
+	ExportMarkdown = "markdown"
+	// ExportPDF is the format for exporting a note to PDF.
+	ExportPDF = "pdf"
+)
+
+const (
+	// pdfConversionTimeout is the maximal duration of the conversion of a
+	// note to PDF.
+	pdfConversionTimeout = 2 * time.Minute
+	// maxExportHTMLSize is the maximal size of the HTML document, with its
+	// embedded images, sent to the PDF converter.
+	maxExportHTMLSize = 64 << 20
+	// maxExportPDFSize is the maximal size of the PDF generated for a note.
+	maxExportPDFSize = 64 << 20
+)
+
+// Export is the result of the export of a note.
+type Export struct {
+	Filename string
+	Mime     string
+	Content  []byte
+}
+
+// ExportFile converts the content of a note to the given format (markdown or
+// PDF). The images of the note are embedded in the exported document.
+func ExportFile(inst *instance.Instance, file *vfs.FileDoc, format string) (*Export, error) {
+	if format != ExportMarkdown && format != ExportPDF {
+		return nil, ErrInvalidExportFormat
+	}
+	if format == ExportPDF && config.GetConfig().Jobs.HTMLToPDFCmd == "" {
+		return nil, ErrPDFExportDisabled
+	}
+
+	lock := inst.NotesLock()
+	if err := lock.Lock(); err != nil {
+		return nil, err
+	}
+	doc, err := get(inst, file)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	images, err := getImages(inst, file.ID())
+	lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := loadImagesDataURI(inst, images); err != nil {
+		return nil, err
+	}
+
+	title := doc.Title
+	if title == "" {
+		title = strings.TrimSuffix(file.DocName, ".cozy-note")
+	}
+	if format == ExportMarkdown {
+		md, err := doc.Markdown(images)
+		if err != nil {
+			return nil, err
+		}
+		return &Export{
+			Filename: title + ".md",
+			Mime:     "text/markdown; charset=utf-8",
+			Content:  md,
+		}, nil
+	}
+
+	content, err := doc.Content()
+	if err != nil {
+		return nil, err
+	}
+	pdf, err := convertToPDF(renderHTML(title, content, images))
+	if err != nil {
+		return nil, err
+	}
+	return &Export{
+		Filename: title + ".pdf",
+		Mime:     "application/pdf",
+		Content:  pdf,
+	}, nil
+}
+
+// loadImagesDataURI reads the content of the images from the VFS, and keeps
+// them as data URI, so that they can be embedded in the exported document.
+func loadImagesDataURI(inst *instance.Instance, images []*Image) error {
+	fs := inst.ThumbsFS()
+	for _, image := range images {
+		if image.ToRemove {
+			continue
+		}
+		th, err := fs.OpenNoteThumb(image.ID(), consts.NoteImageOriginalFormat)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(th)
+		if errc := th.Close(); err == nil && errc != nil {
+			err = errc
+		}
+		if err != nil {
+			return err
+		}
+		image.dataURI = fmt.Sprintf("data:%s;base64,%s", image.Mime,
+			base64.StdEncoding.EncodeToString(data))
+	}
+	return nil
+}
+
+// convertToPDF uses the command configured in jobs.html_to_pdf_cmd to convert
+// an HTML document to PDF. The command is killed if it takes too long, or if
+// it generates a too large PDF.
+func convertToPDF(html []byte) ([]byte, error) {
+	if len(html) > maxExportHTMLSize {
+		return nil, ErrExportTooLarge
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pdfConversionTimeout)
+	defer cancel()
+
+	stdout := &limitedBuffer{max: maxExportPDFSize, cancel: cancel}
+	stderr := &limitedBuffer{max: 4096}
+	cmd := exec.CommandContext(ctx, config.GetConfig().Jobs.HTMLToPDFCmd, "-", "-")
+	cmd.Stdin = bytes.NewReader(html)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if stdout.exceeded {
+		return nil, ErrExportTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert the note to PDF: %w (%s)", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer is a buffer that keeps at most max bytes. When a cancel
+// function is given, it is called when the limit is exceeded, to kill the
+// command that writes in the buffer. Else, the extra bytes are discarded.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	cancel   context.CancelFunc
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrExportTooLarge
+	}
+	if b.Len()+len(p) > b.max {
+		if b.cancel == nil {
+			b.Buffer.Write(p[:b.max-b.Len()])
+			return len(p), nil
+		}
+		b.exceeded = true
+		b.cancel()
+		return 0, ErrExportTooLarge
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,246 @@
+package note
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cozy/prosemirror-go/model"
+)
+
+// cssColorRegexp matches the colors that can be used in the style of the
+// exported notes: #rgb, #rrggbb (with an optional alpha), rgb() and rgba().
+var cssColorRegexp = regexp.MustCompile(`^(#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})|rgba?\(\s*\d{1,3}%?\s*,\s*\d{1,3}%?\s*,\s*\d{1,3}%?\s*(,\s*(0|1|0?\.\d+))?\s*\))$`)
+
+// exportCSS is the stylesheet of the HTML document used for exporting a note
+// to PDF.
+const exportCSS = `
+body { font-family: sans-serif; font-size: 11pt; line-height: 1.5; color: #1d1d1d; }
+h1.title { border-bottom: 1px solid #d6d8da; padding-bottom: 0.3em; }
+blockquote { border-left: 3px solid #d6d8da; margin-left: 0; padding-left: 1em; color: #5d6165; }
+pre { background: #f5f6f7; padding: 0.8em; white-space: pre-wrap; }
+code { font-family: monospace; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #d6d8da; padding: 0.3em 0.6em; vertical-align: top; }
+th { background: #f5f6f7; }
+img { max-width: 100%; }
+ul.tasks, ul.decisions { list-style: none; padding-left: 1em; }
+.panel { border-radius: 4px; padding: 0.5em 1em; margin: 1em 0; background: #f5f6f7; }
+.panel-info { background: #e5f2ff; }
+.panel-note { background: #f2ebff; }
+.panel-success { background: #e3fcef; }
+.panel-warning { background: #fffae6; }
+.panel-error { background: #ffebe6; }
+.status { border-radius: 3px; padding: 0 0.3em; font-size: 0.8em; font-weight: bold; text-transform: uppercase; background: #dfe1e6; }
+.center { text-align: center; }
+.right { text-align: right; }
+`
+
+// renderHTML returns a standalone HTML document for the content of a note.
+// The images are embedded in the document with their data URI.
+func renderHTML(title string, content *model.Node, images []*Image) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&buf, "<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(&buf, "<style>%s</style>\n", exportCSS)
+	buf.WriteString("</head>\n<body>\n")
+	if title != "" {
+		fmt.Fprintf(&buf, "<h1 class=\"title\">%s</h1>\n", html.EscapeString(title))
+	}
+	writeHTMLChildren(&buf, content, images)
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes()
+}
+
+func writeHTMLChildren(buf *bytes.Buffer, node *model.Node, images []*Image) {
+	node.ForEach(func(child *model.Node, _, _ int) {
+		writeHTMLNode(buf, child, images)
+	})
+}
+
+func writeHTMLNode(buf *bytes.Buffer, node *model.Node, images []*Image) {
+	switch node.Type.Name {
+	case "text":
+		writeHTMLText(buf, node)
+	case "paragraph":
+		class := ""
+		for _, mark := range node.Marks {
+			if mark.Type.Name == "alignment" {
+				switch mark.Attrs["align"] {
+				case "center":
+					class = ` class="center"`
+				case "end":
+					class = ` class="right"`
+				}
+			}
+		}
+		fmt.Fprintf(buf, "<p%s>", class)
+		writeHTMLChildren(buf, node, images)
+		buf.WriteString("</p>\n")
+	case "heading":
+		level := 1
+		if l, ok := node.Attrs["level"].(float64); ok && l >= 1 && l <= 6 {
+			level = int(l)
+		}
+		fmt.Fprintf(buf, "<h%d>", level)
+		writeHTMLChildren(buf, node, images)
+		fmt.Fprintf(buf, "</h%d>\n", level)
+	case "bulletList":
+		writeHTMLElement(buf, "ul", "", node, images)
+	case "orderedList":
+		writeHTMLElement(buf, "ol", "", node, images)
+	case "taskList":
+		writeHTMLElement(buf, "ul", ` class="tasks"`, node, images)
+	case "decisionList":
+		writeHTMLElement(buf, "ul", ` class="decisions"`, node, images)
+	case "listItem":
+		writeHTMLElement(buf, "li", "", node, images)
+	case "taskItem":
+		buf.WriteString("<li>")
+		if node.Attrs["state"] == "DONE" {
+			buf.WriteString("&#9745; ")
+		} else {
+			buf.WriteString("&#9744; ")
+		}
+		writeHTMLChildren(buf, node, images)
+		buf.WriteString("</li>\n")
+	case "decisionItem":
+		buf.WriteString("<li>&#9997; ")
+		writeHTMLChildren(buf, node, images)
+		buf.WriteString("</li>\n")
+	case "blockquote":
+		writeHTMLElement(buf, "blockquote", "", node, images)
+	case "rule":
+		buf.WriteString("<hr>\n")
+	case "hardBreak":
+		buf.WriteString("<br>")
+	case "codeBlock":
+		buf.WriteString("<pre><code>")
+		buf.WriteString(html.EscapeString(node.TextContent()))
+		buf.WriteString("</code></pre>\n")
+	case "panel":
+		typ, _ := node.Attrs["panelType"].(string)
+		writeHTMLElement(buf, "div", fmt.Sprintf(` class="panel panel-%s"`, html.EscapeString(typ)), node, images)
+	case "table":
+		writeHTMLElement(buf, "table", "", node, images)
+	case "tableRow":
+		writeHTMLElement(buf, "tr", "", node, images)
+	case "tableHeader":
+		writeHTMLElement(buf, "th", cellHTMLAttributes(node), node, images)
+	case "tableCell":
+		writeHTMLElement(buf, "td", cellHTMLAttributes(node), node, images)
+	case "status":
+		if txt, ok := node.Attrs["text"].(string); ok {
+			fmt.Fprintf(buf, `<span class="status">%s</span>`, html.EscapeString(txt))
+		}
+	case "date":
+		if ts, ok := node.Attrs["timestamp"].(string); ok {
+			if ms, err := strconv.ParseInt(ts, 10, 64); err == nil {
+				txt := time.Unix(ms/1000, 0).Format("2006-01-02")
+				fmt.Fprintf(buf, "<time>%s</time>", txt)
+			}
+		}
+	case "media":
+		src, _ := node.Attrs["url"].(string)
+		for _, img := range images {
+			if img.DocID == src && img.dataURI != "" {
+				fmt.Fprintf(buf, `<p class="center"><img src="%s" alt="%s"></p>`+"\n",
+					img.dataURI, html.EscapeString(img.Name))
+			}
+		}
+	default:
+		// mediaSingle, and the unknown nodes: only their content is rendered
+		writeHTMLChildren(buf, node, images)
+	}
+}
+
+func writeHTMLElement(buf *bytes.Buffer, tag, attrs string, node *model.Node, images []*Image) {
+	fmt.Fprintf(buf, "<%s%s>", tag, attrs)
+	writeHTMLChildren(buf, node, images)
+	fmt.Fprintf(buf, "</%s>\n", tag)
+}
+
+func cellHTMLAttributes(node *model.Node) string {
+	var attrs string
+	if color, ok := node.Attrs["background"].(string); ok && cssColorRegexp.MatchString(color) {
+		attrs += fmt.Sprintf(` style="background: %s"`, color)
+	}
+	if span, ok := node.Attrs["rowspan"].(float64); ok && span > 1 {
+		attrs += fmt.Sprintf(` rowspan="%d"`, int(span))
+	}
+	if span, ok := node.Attrs["colspan"].(float64); ok && span > 1 {
+		attrs += fmt.Sprintf(` colspan="%d"`, int(span))
+	}
+	return attrs
+}
+
+func writeHTMLText(buf *bytes.Buffer, node *model.Node) {
+	if node.Text == nil {
+		return
+	}
+	var closing []string
+	for _, mark := range node.Marks {
+		open, close := htmlMark(mark)
+		buf.WriteString(open)
+		closing = append(closing, close)
+	}
+	buf.WriteString(html.EscapeString(*node.Text))
+	for i := len(closing) - 1; i >= 0; i-- {
+		buf.WriteString(closing[i])
+	}
+}
+
+func htmlMark(mark *model.Mark) (string, string) {
+	switch mark.Type.Name {
+	case "strong":
+		return "<strong>", "</strong>"
+	case "em":
+		return "<em>", "</em>"
+	case "code":
+		return "<code>", "</code>"
+	case "strike":
+		return "<s>", "</s>"
+	case "underline":
+		return "<u>", "</u>"
+	case "link":
+		href, _ := mark.Attrs["href"].(string)
+		if !isSafeHref(href) {
+			return "", ""
+		}
+		return fmt.Sprintf(`<a href="%s">`, html.EscapeString(href)), "</a>"
+	case "subsup":
+		if mark.Attrs["type"] == "sup" {
+			return "<sup>", "</sup>"
+		}
+		return "<sub>", "</sub>"
+	case "textColor":
+		color, _ := mark.Attrs["color"].(string)
+		if !cssColorRegexp.MatchString(color) {
+			return "", ""
+		}
+		return fmt.Sprintf(`<span style="color: %s">`, color), "</span>"
+	}
+	return "", ""
+}
+
+// isSafeHref returns true if the link can be kept in the exported note: only
+// the http, https and mailto links are allowed, as the PDF converter could
+// follow the others (file://, javascript:, etc.).
+func isSafeHref(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return true
+	}
+	return false
+}
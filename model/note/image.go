@@ -39,6 +39,8 @@ type Image struct {
 
 	seen         bool
 	originalName string
+	// dataURI is the content of the image, used for exporting the note
+	dataURI string
 }
 
 // ID returns the image qualified identifier
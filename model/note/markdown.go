@@ -137,6 +137,9 @@ func markdownSerializer(images []*Image) *markdown.Serializer {
 				if img.DocID == src {
 					alt = img.Name
 					img.seen = true
+					if img.dataURI != "" {
+						src = img.dataURI
+					}
 				}
 			}
 			state.Write(fmt.Sprintf("![%s](%s)\n", state.Esc(alt), state.Esc(src)))
@@ -313,7 +313,7 @@ func ensureNotesDir(inst *instance.Instance) (*vfs.DirDoc, error) {
 		if !strings.HasPrefix(dir.Fullpath, vfs.TrashDirName) {
 			return dir, nil
 		}
-		return vfs.RestoreDir(fs, dir)
+		return vfs.RestoreDir(fs, dir, nil)
 	}
 
 	dirname := inst.Translate("Tree Notes")
@@ -3,7 +3,10 @@ package note
 import (
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/prosemirror-go/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -79,3 +82,154 @@ and another decision
 	md := textSerializer().Serialize(node)
 	assert.Equal(t, expected, md)
 }
+
+func TestHTML(t *testing.T) {
+	initial := `# My title
+
+foobar **bold** <script>
+
+:info: this is a panel
+
+- [ ] a todo task
+
+- [X] a done task`
+
+	schemaSpecs := DefaultSchemaSpecs()
+	specs := model.SchemaSpecFromJSON(schemaSpecs)
+	schema, err := model.NewSchema(&specs)
+	require.NoError(t, err)
+
+	node, err := parseFile(strings.NewReader(initial), schema)
+	require.NoError(t, err)
+
+	html := string(renderHTML("A & B", node, nil))
+	assert.Contains(t, html, "<title>A &amp; B</title>")
+	assert.Contains(t, html, "<h1>My title</h1>")
+	assert.Contains(t, html, "<strong>bold</strong>")
+	assert.Contains(t, html, "&lt;script&gt;")
+	assert.Contains(t, html, `<div class="panel panel-info">`)
+	assert.Contains(t, html, "&#9744; ")
+	assert.Contains(t, html, "&#9745; ")
+}
+
+func TestTemplate(t *testing.T) {
+	t.Run("SubstituteVariables", func(t *testing.T) {
+		vars := map[string]string{"date": "2026-10-16", "contact.fullname": "Alice"}
+		assert.Equal(t, "Meeting with Alice - 2026-10-16",
+			substituteVariables("Meeting with {{ contact.fullname }} - {{date}}", vars))
+		assert.Equal(t, "Agenda: {{agenda}}", substituteVariables("Agenda: {{agenda}}", vars))
+	})
+
+	t.Run("SubstituteNode", func(t *testing.T) {
+		content := map[string]interface{}{
+			"type": "doc",
+			"content": []interface{}{
+				map[string]interface{}{
+					"type": "paragraph",
+					"content": []interface{}{
+						map[string]interface{}{"type": "text", "text": "Members: "},
+						map[string]interface{}{"type": "text", "text": "{{sharing.members}}"},
+						map[string]interface{}{"type": "text", "text": "{{empty}}"},
+					},
+				},
+			},
+		}
+		vars := map[string]string{"sharing.members": "Alice, Bob", "empty": ""}
+		node := substituteNode(content, vars)
+
+		schemaSpecs := DefaultSchemaSpecs()
+		specs := model.SchemaSpecFromJSON(schemaSpecs)
+		schema, err := model.NewSchema(&specs)
+		require.NoError(t, err)
+		doc, err := model.NodeFromJSON(schema, node)
+		require.NoError(t, err)
+		assert.Equal(t, "Members: Alice, Bob", textSerializer().Serialize(doc))
+
+		// The template is not modified
+		paragraph := content["content"].([]interface{})[0].(map[string]interface{})
+		assert.Len(t, paragraph["content"], 3)
+	})
+
+	t.Run("TemplateVariables", func(t *testing.T) {
+		now := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+		c := contact.New()
+		c.M["fullname"] = "Alice"
+		c.M["email"] = []interface{}{map[string]interface{}{"address": "alice@example.net"}}
+		s := &sharing.Sharing{
+			Description: "Project X",
+			Members: []sharing.Member{
+				{Status: sharing.MemberStatusOwner, PublicName: "Bob"},
+				{Status: sharing.MemberStatusReady, Name: "Alice"},
+				{Status: sharing.MemberStatusRevoked, Email: "eve@example.net"},
+			},
+		}
+		vars := templateVariables(&TemplateOptions{
+			Contact:   c,
+			Sharing:   s,
+			Variables: map[string]string{"time": "10:00", "place": "Paris"},
+		}, now)
+		assert.Equal(t, "2026-10-16", vars["date"])
+		assert.Equal(t, "10:00", vars["time"])
+		assert.Equal(t, "Paris", vars["place"])
+		assert.Equal(t, "Alice", vars["contact.fullname"])
+		assert.Equal(t, "alice@example.net", vars["contact.email"])
+		assert.Equal(t, "Project X", vars["sharing.description"])
+		assert.Equal(t, "Bob", vars["sharing.owner"])
+		assert.Equal(t, "Bob, Alice", vars["sharing.members"])
+	})
+}
+
+func TestHTMLUnsafeAttributes(t *testing.T) {
+	schemaSpecs := DefaultSchemaSpecs()
+	specs := model.SchemaSpecFromJSON(schemaSpecs)
+	schema, err := model.NewSchema(&specs)
+	require.NoError(t, err)
+
+	t.Run("TextColor", func(t *testing.T) {
+		open, _ := htmlMark(schema.Mark("textColor", map[string]interface{}{"color": "#ff5630"}))
+		assert.Equal(t, `<span style="color: #ff5630">`, open)
+		open, _ = htmlMark(schema.Mark("textColor", map[string]interface{}{"color": "rgb(255, 86, 48)"}))
+		assert.Equal(t, `<span style="color: rgb(255, 86, 48)">`, open)
+		open, _ = htmlMark(schema.Mark("textColor", map[string]interface{}{"color": "red; background: url(file:///etc/passwd)"}))
+		assert.Empty(t, open)
+	})
+
+	t.Run("Link", func(t *testing.T) {
+		open, _ := htmlMark(schema.Mark("link", map[string]interface{}{"href": "https://cozy.io/"}))
+		assert.Equal(t, `<a href="https://cozy.io/">`, open)
+		open, _ = htmlMark(schema.Mark("link", map[string]interface{}{"href": "mailto:alice@cozy.example"}))
+		assert.Equal(t, `<a href="mailto:alice@cozy.example">`, open)
+		for _, href := range []string{"file:///etc/passwd", "javascript:alert(1)", "//cozy.io/"} {
+			open, _ = htmlMark(schema.Mark("link", map[string]interface{}{"href": href}))
+			assert.Empty(t, open, href)
+		}
+	})
+
+	t.Run("CellBackground", func(t *testing.T) {
+		typ, err := schema.NodeType("tableCell")
+		require.NoError(t, err)
+		cell, err := typ.Create(map[string]interface{}{"background": "#e3fcef"}, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, ` style="background: #e3fcef"`, cellHTMLAttributes(cell))
+		cell, err = typ.Create(map[string]interface{}{"background": "#fff\" onload=\"x"}, nil, nil)
+		require.NoError(t, err)
+		assert.Empty(t, cellHTMLAttributes(cell))
+	})
+
+	t.Run("LimitedBuffer", func(t *testing.T) {
+		canceled := false
+		buf := &limitedBuffer{max: 4, cancel: func() { canceled = true }}
+		_, err := buf.Write([]byte("abc"))
+		assert.NoError(t, err)
+		_, err = buf.Write([]byte("de"))
+		assert.ErrorIs(t, err, ErrExportTooLarge)
+		assert.True(t, canceled)
+		assert.True(t, buf.exceeded)
+
+		stderr := &limitedBuffer{max: 4}
+		n, err := stderr.Write([]byte("abcdef"))
+		assert.NoError(t, err)
+		assert.Equal(t, 6, n)
+		assert.Equal(t, "abcd", stderr.String())
+	})
+}
@@ -0,0 +1,195 @@
+package note
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+// Template is a document from which the notes can be created. Its title and
+// the text nodes of its content can have placeholders, like {{date}} or
+// {{contact.fullname}}, that are replaced when a note is created from it.
+type Template struct {
+	DocID      string                 `json:"_id,omitempty"`
+	DocRev     string                 `json:"_rev,omitempty"`
+	Title      string                 `json:"title"`
+	SchemaSpec map[string]interface{} `json:"schema,omitempty"`
+	RawContent map[string]interface{} `json:"content,omitempty"`
+}
+
+// ID returns the document qualified identifier
+func (t *Template) ID() string { return t.DocID }
+
+// Rev returns the document revision
+func (t *Template) Rev() string { return t.DocRev }
+
+// DocType returns the document type
+func (t *Template) DocType() string { return consts.NotesTemplates }
+
+// Clone implements couchdb.Doc
+func (t *Template) Clone() couchdb.Doc {
+	cloned := *t
+	// XXX The schema and the content are not modified when a note is created
+	// from the template, and are not cloned.
+	return &cloned
+}
+
+// SetID changes the document qualified identifier
+func (t *Template) SetID(id string) { t.DocID = id }
+
+// SetRev changes the document revision
+func (t *Template) SetRev(rev string) { t.DocRev = rev }
+
+// TemplateOptions are the parameters for creating a note from a template.
+type TemplateOptions struct {
+	// DirID is the directory where the note is created (optional, the Notes
+	// directory is used by default).
+	DirID string
+	// Title can be used to replace the title of the template.
+	Title string
+	// Schema is used when the template has no schema.
+	Schema map[string]interface{}
+	// Contact and Sharing are optional, and are used to fill the contact.*
+	// and sharing.* variables.
+	Contact *contact.Contact
+	Sharing *sharing.Sharing
+	// Variables are custom variables, that take precedence over the
+	// variables computed by the stack.
+	Variables map[string]string
+	CreatedBy string
+}
+
+// FindTemplate returns the template with the given identifier.
+func FindTemplate(inst *instance.Instance, id string) (*Template, error) {
+	var tpl Template
+	if err := couchdb.GetDoc(inst, consts.NotesTemplates, id, &tpl); err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+// CreateFromTemplate creates a note from a template, where the variables in
+// the title and the content are replaced by their values.
+func CreateFromTemplate(inst *instance.Instance, tpl *Template, opts *TemplateOptions) (*vfs.FileDoc, error) {
+	vars := templateVariables(opts, time.Now())
+	title := tpl.Title
+	if opts.Title != "" {
+		title = opts.Title
+	}
+	doc := &Document{
+		CreatedBy:  opts.CreatedBy,
+		DirID:      opts.DirID,
+		Title:      substituteVariables(title, vars),
+		SchemaSpec: tpl.SchemaSpec,
+	}
+	if len(doc.SchemaSpec) == 0 {
+		doc.SchemaSpec = opts.Schema
+	}
+	if len(doc.SchemaSpec) == 0 {
+		doc.SchemaSpec = DefaultSchemaSpecs()
+	}
+	if len(tpl.RawContent) > 0 {
+		doc.RawContent = substituteNode(tpl.RawContent, vars)
+	}
+	return Create(inst, doc)
+}
+
+// templateVariables returns the values of the variables that can be used in
+// a template.
+func templateVariables(opts *TemplateOptions, now time.Time) map[string]string {
+	vars := map[string]string{
+		"date":     now.Format("2006-01-02"),
+		"time":     now.Format("15:04"),
+		"datetime": now.Format("2006-01-02 15:04"),
+	}
+
+	if c := opts.Contact; c != nil {
+		vars["contact.fullname"] = c.PrimaryName()
+		vars["contact.phone"] = c.PrimaryPhoneNumber()
+		vars["contact.cozy"] = c.PrimaryCozyURL()
+		if addr, err := c.ToMailAddress(); err == nil {
+			vars["contact.email"] = addr.Email
+		}
+		if company, ok := c.Get("company").(string); ok {
+			vars["contact.company"] = company
+		}
+	}
+
+	if s := opts.Sharing; s != nil {
+		vars["sharing.description"] = s.Description
+		var names []string
+		for i, m := range s.Members {
+			if m.Status == sharing.MemberStatusRevoked {
+				continue
+			}
+			if i == 0 {
+				vars["sharing.owner"] = m.PrimaryName()
+			}
+			names = append(names, m.PrimaryName())
+		}
+		vars["sharing.members"] = strings.Join(names, ", ")
+	}
+
+	for k, v := range opts.Variables {
+		vars[k] = v
+	}
+	return vars
+}
+
+var variableRegexp = regexp.MustCompile(`\{\{\s*([\w.]+)\s*\}\}`)
+
+// substituteVariables replaces the placeholders in the given text by the
+// value of their variable. The placeholders for unknown variables are kept
+// as is, to help the user to notice them.
+func substituteVariables(text string, vars map[string]string) string {
+	return variableRegexp.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := variableRegexp.FindStringSubmatch(placeholder)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// substituteNode returns a copy of the prosemirror node, in its JSON form,
+// where the variables in the text nodes have been replaced.
+func substituteNode(node map[string]interface{}, vars map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(node))
+	for k, v := range node {
+		out[k] = v
+	}
+	if text, ok := node["text"].(string); ok {
+		out["text"] = substituteVariables(text, vars)
+	}
+	children, ok := node["content"].([]interface{})
+	if !ok {
+		return out
+	}
+	content := make([]interface{}, 0, len(children))
+	for _, child := range children {
+		c, ok := child.(map[string]interface{})
+		if !ok {
+			content = append(content, child)
+			continue
+		}
+		c = substituteNode(c, vars)
+		// Prosemirror doesn't allow empty text nodes, and a variable with
+		// an empty value can lead to one.
+		if text, ok := c["text"].(string); ok && text == "" {
+			continue
+		}
+		content = append(content, c)
+	}
+	out["content"] = content
+	return out
+}
@@ -12,4 +12,6 @@ var (
 	// ErrCategoryNotFound is used when sending a notification from an unknown
 	// category.
 	ErrCategoryNotFound = errors.New("Notification category does not exist")
+	// ErrNotificationNotFound is used when the notification does not exist.
+	ErrNotificationNotFound = errors.New("Notification not found")
 )
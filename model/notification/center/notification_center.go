@@ -13,6 +13,8 @@ import (
 	"github.com/cozy/cozy-stack/model/notification"
 	"github.com/cozy/cozy-stack/model/oauth"
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/usage"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -28,6 +30,18 @@ const (
 	// NotificationOAuthClients category for sending alert when exceeding the
 	// connected OAuth clients limit.
 	NotificationOAuthClients = "oauth-clients"
+	// NotificationMailsLimit category for sending alert when the daily cap of
+	// mails has been reached.
+	NotificationMailsLimit = "mails-limit"
+	// NotificationDocumentsQuota category for sending alert when the maximal
+	// number of documents of a doctype has been reached.
+	NotificationDocumentsQuota = "documents-quota"
+	// NotificationSharingsQuota category for sending alert when the maximal
+	// number of sharings, or of members for a sharing, has been reached.
+	NotificationSharingsQuota = "sharings-quota"
+	// NotificationSharingExpiration category for warning the owner of a
+	// sharing that it will expire soon.
+	NotificationSharingExpiration = "sharing-expiration"
 )
 
 var (
@@ -45,6 +59,28 @@ var (
 			Stateful:     false,
 			MailTemplate: "notifications_oauthclients",
 		},
+		NotificationMailsLimit: {
+			Description: "Warn about the daily cap of mails being reached",
+			Collapsible: true,
+			Stateful:    false,
+		},
+		NotificationDocumentsQuota: {
+			Description: "Warn about the maximal number of documents of a doctype being reached",
+			Collapsible: true,
+			Stateful:    true,
+			MinInterval: 24 * time.Hour,
+		},
+		NotificationSharingsQuota: {
+			Description: "Warn about the maximal number of sharings or members being reached",
+			Collapsible: true,
+			Stateful:    true,
+			MinInterval: 24 * time.Hour,
+		},
+		NotificationSharingExpiration: {
+			Description: "Warn about a sharing that will expire soon",
+			Collapsible: false,
+			Stateful:    false,
+		},
 	}
 )
 
@@ -55,59 +91,74 @@ func init() {
 			return
 		}
 
-		title := i.Translate("Notifications Disk Quota Close Title")
-		message := i.Translate("Notifications Disk Quota Close Message")
-		offersLink, err := i.ManagerURL(instance.ManagerPremiumURL)
+		data, err := diskQuotaData(i)
 		if err != nil {
 			return
 		}
-		cozyDriveLink := i.SubDomain(consts.DriveSlug)
-		redirectLink := consts.SettingsSlug + "/#/storage"
-
 		n := &notification.Notification{
-			Title:   title,
-			Message: message,
-			Slug:    consts.SettingsSlug,
-			State:   capsizeExceeded,
-			Data: map[string]interface{}{
-				// For email notification
-				"OffersLink":    offersLink,
-				"CozyDriveLink": cozyDriveLink.String(),
-
-				// For mobile push notification
-				"appName":      "",
-				"redirectLink": redirectLink,
-			},
+			Title:             i.Translate("Notifications Disk Quota Close Title"),
+			Message:           i.Translate("Notifications Disk Quota Close Message"),
+			Slug:              consts.SettingsSlug,
+			State:             capsizeExceeded,
+			Data:              data,
 			PreferredChannels: []string{"mobile"},
 		}
 		_ = PushStack(domain, NotificationDiskQuota, n)
 	})
 
 	oauth.RegisterClientsLimitAlertCallback(func(i *instance.Instance, clientName string, clientsLimit int) {
-		devicesLink := i.SubDomain(consts.SettingsSlug)
-		devicesLink.Fragment = "/connectedDevices"
+		n := &notification.Notification{
+			Title:             i.Translate("Notifications OAuth Clients Subject"),
+			Slug:              consts.SettingsSlug,
+			Data:              oauthClientsData(i, clientName, clientsLimit),
+			PreferredChannels: []string{"mail"},
+		}
+		PushStack(i.DomainName(), NotificationOAuthClients, n)
+	})
 
-		var offersLink string
-		if i.HasPremiumLinksEnabled() {
-			var err error
-			offersLink, err = i.ManagerURL(instance.ManagerPremiumURL)
-			if err != nil {
-				i.Logger().Errorf("Could not get instance Premium Manager URL: %s", err.Error())
-			}
+	usage.RegisterDocumentsQuotaCallback(func(i *instance.Instance, doctype string, quota int) {
+		n := &notification.Notification{
+			Title:             i.Translate("Notifications Documents Quota Title"),
+			Message:           i.Translate("Notifications Documents Quota Message"),
+			Slug:              consts.SettingsSlug,
+			State:             doctype,
+			Data:              map[string]interface{}{"doctype": doctype, "quota": quota},
+			PreferredChannels: []string{"mobile"},
 		}
+		if err := PushStack(i.DomainName(), NotificationDocumentsQuota, n); err != nil {
+			i.Logger().WithNamespace("usage").
+				Warnf("Cannot notify that the documents quota has been reached: %s", err)
+		}
+	})
 
+	sharing.RegisterQuotaCallback(func(i *instance.Instance, kind string, quota int) {
 		n := &notification.Notification{
-			Title: i.Translate("Notifications OAuth Clients Subject"),
-			Slug:  consts.SettingsSlug,
-			Data: map[string]interface{}{
-				"ClientName":   clientName,
-				"ClientsLimit": clientsLimit,
-				"OffersLink":   offersLink,
-				"DevicesLink":  devicesLink.String(),
-			},
-			PreferredChannels: []string{"mail"},
+			Title:             i.Translate("Notifications Sharings Quota Title"),
+			Message:           i.Translate("Notifications Sharings Quota Message " + kind),
+			Slug:              consts.SettingsSlug,
+			State:             kind,
+			Data:              sharingsQuotaData(i, kind, quota),
+			PreferredChannels: []string{"mobile"},
+		}
+		if err := PushStack(i.DomainName(), NotificationSharingsQuota, n); err != nil {
+			i.Logger().WithNamespace("sharing").
+				Warnf("Cannot notify that the sharings quota has been reached: %s", err)
+		}
+	})
+
+	sharing.RegisterExpirationReminderCallback(func(i *instance.Instance, s *sharing.Sharing) {
+		date := s.ExpiresAt.Format("2006-01-02")
+		n := &notification.Notification{
+			Title:             i.Translate("Notifications Sharing Expiration Title"),
+			Message:           i.Translate("Notifications Sharing Expiration Message", s.Description, date),
+			Slug:              consts.DriveSlug,
+			Data:              map[string]interface{}{"sharing_id": s.SID, "expires_at": s.ExpiresAt},
+			PreferredChannels: []string{"mobile"},
+		}
+		if err := PushStack(i.DomainName(), NotificationSharingExpiration, n); err != nil {
+			i.Logger().WithNamespace("sharing").
+				Warnf("Cannot notify that the sharing will expire: %s", err)
 		}
-		PushStack(i.DomainName(), NotificationOAuthClients, n)
 	})
 }
 
@@ -248,6 +299,13 @@ func makePush(inst *instance.Instance, p *notification.Properties, n *notificati
 	n.LastSent = lastSent
 	n.PreferredChannels = nil
 	n.At = ""
+	n.ReadAt = nil
+	n.ArchivedAt = nil
+	// The notifications that are not sent are not shown as unread to the user
+	if skipNotification {
+		readAt := n.CreatedAt
+		n.ReadAt = &readAt
+	}
 
 	if err := couchdb.CreateDoc(inst, n); err != nil {
 		return err
@@ -255,6 +313,7 @@ func makePush(inst *instance.Instance, p *notification.Properties, n *notificati
 	if skipNotification {
 		return nil
 	}
+	publishBadge(inst, n.BadgeKey())
 
 	var errm error
 	log := inst.Logger().WithNamespace("notifications")
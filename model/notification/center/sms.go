@@ -1,6 +1,30 @@
 package center
 
-import "github.com/cozy/cozy-stack/pkg/mail"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/notification"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/mail"
+)
+
+const (
+	// SMSStatusSent is the status of a SMS accepted by the provider.
+	SMSStatusSent = "sent"
+	// SMSStatusDelivered is the status of a SMS delivered to the phone.
+	SMSStatusDelivered = "delivered"
+	// SMSStatusFailed is the status of a SMS that cannot be delivered.
+	SMSStatusFailed = "failed"
+	// SMSStatusPending is the status of a SMS still in the queue of the
+	// provider.
+	SMSStatusPending = "pending"
+)
 
 // SMS contains a notification request for sending a SMS.
 type SMS struct {
@@ -8,3 +32,92 @@ type SMS struct {
 	Message        string        `json:"message,omitempty"`
 	MailFallback   *mail.Options `json:"mail_fallback,omitempty"`
 }
+
+// SMSStatusFromDLR converts a delivery report code, as sent by OVHcloud on
+// the callback URL, to a delivery status.
+func SMSStatusFromDLR(dlr string) string {
+	switch dlr {
+	case "1":
+		return SMSStatusDelivered
+	case "2", "16":
+		return SMSStatusFailed
+	case "4", "8":
+		return SMSStatusPending
+	}
+	return ""
+}
+
+// SMSStatusURL returns the URL that the SMS provider can call to give the
+// delivery status of the SMS sent for the given notification.
+func SMSStatusURL(inst *instance.Instance, notificationID string) string {
+	queries := url.Values{"token": {smsStatusToken(inst, notificationID)}}
+	return inst.PageURL("/notifications/"+notificationID+"/sms-status", queries)
+}
+
+// CheckSMSStatusToken returns true if the token is valid for the delivery
+// status callback of the given notification.
+func CheckSMSStatusToken(inst *instance.Instance, notificationID, token string) bool {
+	expected := smsStatusToken(inst, notificationID)
+	return hmac.Equal([]byte(expected), []byte(token))
+}
+
+func smsStatusToken(inst *instance.Instance, notificationID string) string {
+	mac := hmac.New(sha256.New, inst.SessionSecret())
+	mac.Write([]byte("sms-status:" + notificationID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// smsStatusRank gives the order of the delivery statuses: a SMS is sent, then
+// pending in the queue of the provider, and finally delivered or failed.
+func smsStatusRank(status string) int {
+	switch status {
+	case SMSStatusSent:
+		return 1
+	case SMSStatusPending:
+		return 2
+	case SMSStatusDelivered, SMSStatusFailed:
+		return 3
+	}
+	return 0
+}
+
+// IsValidSMSStatus returns true if the status is one of the known delivery
+// statuses.
+func IsValidSMSStatus(status string) bool {
+	return smsStatusRank(status) > 0
+}
+
+// isForwardSMSStatus returns true if the delivery status can go from the
+// previous status to the next one. The reports can arrive out of order, and a
+// late one must not overwrite a final status.
+func isForwardSMSStatus(previous, next string) bool {
+	if previous == SMSStatusDelivered || previous == SMSStatusFailed {
+		return false
+	}
+	return smsStatusRank(next) >= smsStatusRank(previous)
+}
+
+// RecordSMSDelivery saves the delivery status of the SMS on the notification.
+// The provider and message ID are kept from the previous status when they are
+// not given. A status that would go backward (for example, sent after
+// delivered) is ignored.
+func RecordSMSDelivery(inst *instance.Instance, notificationID string, delivery *notification.SMSDelivery) error {
+	var n notification.Notification
+	if err := couchdb.GetDoc(inst, consts.Notifications, notificationID, &n); err != nil {
+		return err
+	}
+	if n.SMS != nil {
+		if !isForwardSMSStatus(n.SMS.Status, delivery.Status) {
+			return nil
+		}
+		if delivery.Provider == "" {
+			delivery.Provider = n.SMS.Provider
+		}
+		if delivery.MessageID == "" {
+			delivery.MessageID = n.SMS.MessageID
+		}
+	}
+	delivery.UpdatedAt = time.Now().UTC()
+	n.SMS = delivery
+	return couchdb.UpdateDoc(inst, &n)
+}
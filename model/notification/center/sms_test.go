@@ -0,0 +1,31 @@
+package center
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsForwardSMSStatus(t *testing.T) {
+	assert.True(t, isForwardSMSStatus("", SMSStatusSent))
+	assert.True(t, isForwardSMSStatus(SMSStatusSent, SMSStatusPending))
+	assert.True(t, isForwardSMSStatus(SMSStatusSent, SMSStatusDelivered))
+	assert.True(t, isForwardSMSStatus(SMSStatusPending, SMSStatusPending))
+	assert.True(t, isForwardSMSStatus(SMSStatusPending, SMSStatusFailed))
+
+	assert.False(t, isForwardSMSStatus(SMSStatusDelivered, SMSStatusSent))
+	assert.False(t, isForwardSMSStatus(SMSStatusPending, SMSStatusSent))
+	assert.False(t, isForwardSMSStatus(SMSStatusDelivered, SMSStatusFailed))
+	assert.False(t, isForwardSMSStatus(SMSStatusFailed, SMSStatusDelivered))
+}
+
+func TestIsValidSMSStatus(t *testing.T) {
+	assert.True(t, IsValidSMSStatus(SMSStatusSent))
+	assert.True(t, IsValidSMSStatus(SMSStatusPending))
+	assert.True(t, IsValidSMSStatus(SMSStatusDelivered))
+	assert.True(t, IsValidSMSStatus(SMSStatusFailed))
+
+	assert.False(t, IsValidSMSStatus(""))
+	assert.False(t, IsValidSMSStatus("unknown"))
+	assert.False(t, IsValidSMSStatus("DELIVERED"))
+}
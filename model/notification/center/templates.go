@@ -0,0 +1,112 @@
+package center
+
+import (
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/mail"
+)
+
+// mailBranding returns the mail_branding settings of the context of the
+// instance, that can be used by the partners to brand the mails of the stack
+// notifications.
+func mailBranding(i *instance.Instance) map[string]interface{} {
+	settings, ok := i.SettingsContext()
+	if !ok {
+		return nil
+	}
+	branding, _ := settings["mail_branding"].(map[string]interface{})
+	return branding
+}
+
+// offersLink returns the URL of the page where the user can change their
+// offer. The context can override it with the offers_url of its mail
+// branding, else the premium URL of the manager is used.
+func offersLink(i *instance.Instance) (string, error) {
+	if u, ok := mailBranding(i)["offers_url"].(string); ok && u != "" {
+		return u, nil
+	}
+	return i.ManagerURL(instance.ManagerPremiumURL)
+}
+
+func diskQuotaData(i *instance.Instance) (map[string]interface{}, error) {
+	offers, err := offersLink(i)
+	if err != nil {
+		return nil, err
+	}
+	cozyDriveLink := i.SubDomain(consts.DriveSlug)
+	redirectLink := consts.SettingsSlug + "/#/storage"
+	return map[string]interface{}{
+		// For email notification
+		"OffersLink":    offers,
+		"CozyDriveLink": cozyDriveLink.String(),
+
+		// For mobile push notification
+		"appName":      "",
+		"redirectLink": redirectLink,
+	}, nil
+}
+
+func oauthClientsData(i *instance.Instance, clientName string, clientsLimit int) map[string]interface{} {
+	devicesLink := i.SubDomain(consts.SettingsSlug)
+	devicesLink.Fragment = "/connectedDevices"
+
+	var offers string
+	if i.HasPremiumLinksEnabled() {
+		var err error
+		offers, err = offersLink(i)
+		if err != nil {
+			i.Logger().Errorf("Could not get instance Premium Manager URL: %s", err.Error())
+		}
+	}
+
+	return map[string]interface{}{
+		"ClientName":   clientName,
+		"ClientsLimit": clientsLimit,
+		"OffersLink":   offers,
+		"DevicesLink":  devicesLink.String(),
+	}
+}
+
+// sharingsQuotaData returns the data of the notification for a quota of the
+// sharings, with a link to the offers when the premium links are enabled.
+func sharingsQuotaData(i *instance.Instance, kind string, quota int) map[string]interface{} {
+	data := map[string]interface{}{
+		"kind":  kind,
+		"quota": quota,
+	}
+	if i.HasPremiumLinksEnabled() {
+		if offers, err := offersLink(i); err == nil {
+			data["OffersLink"] = offers
+		} else {
+			i.Logger().Errorf("Could not get instance Premium Manager URL: %s", err.Error())
+		}
+	}
+	return data
+}
+
+// PreviewStackMail returns the options for the mail of a stack notification,
+// filled with some sample data. It can be used to check how the mail looks
+// like with the branding of the context of the instance.
+func PreviewStackMail(i *instance.Instance, category string) (*mail.Options, error) {
+	p := stackNotifications[category]
+	if p == nil || p.MailTemplate == "" {
+		return nil, ErrCategoryNotFound
+	}
+	var data map[string]interface{}
+	switch category {
+	case NotificationDiskQuota:
+		var err error
+		data, err = diskQuotaData(i)
+		if err != nil {
+			return nil, err
+		}
+	case NotificationOAuthClients:
+		data = oauthClientsData(i, "My Laptop", 3)
+	}
+	return &mail.Options{
+		Mode:           mail.ModeFromStack,
+		TemplateName:   p.MailTemplate,
+		TemplateValues: data,
+		Locale:         i.Locale,
+	}, nil
+}
@@ -0,0 +1,55 @@
+package center
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStackTemplates(t *testing.T) {
+	config.UseTestFile(t)
+	conf := config.GetConfig()
+	conf.Contexts = map[string]interface{}{
+		"partner": map[string]interface{}{
+			"manager_url": "https://manager.partner.example",
+			"mail_branding": map[string]interface{}{
+				"offers_url": "https://partner.example/offers",
+			},
+		},
+		"other": map[string]interface{}{
+			"manager_url": "https://manager.other.example",
+		},
+	}
+
+	t.Run("OffersLink", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "alice.partner.example", ContextName: "partner", UUID: "uuid"}
+		link, err := offersLink(inst)
+		require.NoError(t, err)
+		assert.Equal(t, "https://partner.example/offers", link)
+
+		inst = &instance.Instance{Domain: "bob.other.example", ContextName: "other", UUID: "uuid"}
+		link, err = offersLink(inst)
+		require.NoError(t, err)
+		assert.Equal(t, "https://manager.other.example/cozy/instances/uuid/premium", link)
+	})
+
+	t.Run("PreviewStackMail", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "alice.partner.example", ContextName: "partner", Locale: "fr"}
+		opts, err := PreviewStackMail(inst, NotificationDiskQuota)
+		require.NoError(t, err)
+		assert.Equal(t, "notifications_diskquota", opts.TemplateName)
+		assert.Equal(t, "fr", opts.Locale)
+		assert.Equal(t, "https://partner.example/offers", opts.TemplateValues["OffersLink"])
+
+		opts, err = PreviewStackMail(inst, NotificationOAuthClients)
+		require.NoError(t, err)
+		assert.Equal(t, "notifications_oauthclients", opts.TemplateName)
+		assert.Equal(t, 3, opts.TemplateValues["ClientsLimit"])
+
+		_, err = PreviewStackMail(inst, "unknown")
+		assert.Equal(t, ErrCategoryNotFound, err)
+	})
+}
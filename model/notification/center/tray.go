@@ -0,0 +1,204 @@
+package center
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/notification"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+)
+
+// markAllBatchSize is the number of notifications updated at once when all
+// the notifications are marked as read.
+const markAllBatchSize = 500
+
+// Badge is the number of unread notifications for an app. It is sent in the
+// realtime hub each time this number changes.
+type Badge struct {
+	Slug  string `json:"slug"`
+	Count int    `json:"count"`
+}
+
+// ID is used to implement the realtime.Doc interface
+func (b *Badge) ID() string { return b.Slug }
+
+// DocType is used to implement the realtime.Doc interface
+func (b *Badge) DocType() string { return consts.NotificationsBadges }
+
+// Find returns the notification with the given identifier.
+func Find(inst *instance.Instance, id string) (*notification.Notification, error) {
+	var n notification.Notification
+	err := couchdb.GetDoc(inst, consts.Notifications, id, &n)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// MarkAsRead marks the notification as read by the user.
+func MarkAsRead(inst *instance.Instance, n *notification.Notification) error {
+	if n.ReadAt != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	n.ReadAt = &now
+	return updateNotification(inst, n)
+}
+
+// MarkAsUnread marks the notification as not read by the user. An archived
+// notification stays archived, and is still not counted as unread.
+func MarkAsUnread(inst *instance.Instance, n *notification.Notification) error {
+	if n.ReadAt == nil {
+		return nil
+	}
+	n.ReadAt = nil
+	return updateNotification(inst, n)
+}
+
+// Archive hides the notification from the tray of the user. It is also marked
+// as read.
+func Archive(inst *instance.Instance, n *notification.Notification) error {
+	if n.ArchivedAt != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	n.ArchivedAt = &now
+	if n.ReadAt == nil {
+		n.ReadAt = &now
+	}
+	return updateNotification(inst, n)
+}
+
+func updateNotification(inst *instance.Instance, n *notification.Notification) error {
+	if err := couchdb.UpdateDoc(inst, n); err != nil {
+		return err
+	}
+	publishBadge(inst, n.BadgeKey())
+	return nil
+}
+
+// MarkAllAsRead marks all the unread notifications of an app as read, or all
+// the unread notifications if slug is empty. It returns the number of
+// notifications that have been updated.
+func MarkAllAsRead(inst *instance.Instance, slug string) (int, error) {
+	count := 0
+	keys := make(map[string]struct{})
+	seen := make(map[string]struct{})
+	now := time.Now().UTC()
+	for {
+		req := &couchdb.ViewRequest{
+			IncludeDocs: true,
+			Limit:       markAllBatchSize,
+		}
+		if slug != "" {
+			req.Key = slug
+		}
+		var res couchdb.ViewResponse
+		err := couchdb.ExecView(inst, couchdb.UnreadNotificationsView, req, &res)
+		if couchdb.IsNoDatabaseError(err) {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		docs := make([]interface{}, 0, len(res.Rows))
+		olds := make([]interface{}, 0, len(res.Rows))
+		for _, row := range res.Rows {
+			// A notification that is still there after an update is in
+			// conflict, and it is skipped to avoid looping on it.
+			if _, ok := seen[row.ID]; ok {
+				continue
+			}
+			seen[row.ID] = struct{}{}
+			var n notification.Notification
+			if err := json.Unmarshal(row.Doc, &n); err != nil {
+				return count, err
+			}
+			olds = append(olds, n.Clone())
+			readAt := now
+			n.ReadAt = &readAt
+			docs = append(docs, &n)
+			keys[n.BadgeKey()] = struct{}{}
+		}
+		if len(docs) == 0 {
+			break
+		}
+		if err := couchdb.BulkUpdateDocs(inst, consts.Notifications, docs, olds); err != nil {
+			return count, err
+		}
+		count += len(docs)
+		// The updated notifications are no longer in the view, so the next
+		// batch starts from the beginning.
+		if len(res.Rows) < markAllBatchSize {
+			break
+		}
+	}
+
+	for key := range keys {
+		publishBadge(inst, key)
+	}
+	return count, nil
+}
+
+// BadgeCounts returns the number of unread notifications, by slug of the
+// apps. The notifications sent by the stack are counted with the stack key.
+func BadgeCounts(inst *instance.Instance) (map[string]int, error) {
+	var res couchdb.ViewResponse
+	err := couchdb.ExecView(inst, couchdb.UnreadNotificationsView, &couchdb.ViewRequest{
+		Reduce: true,
+		Group:  true,
+	}, &res)
+	counts := make(map[string]int)
+	if couchdb.IsNoDatabaseError(err) {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range res.Rows {
+		key, _ := row.Key.(string)
+		value, _ := row.Value.(float64)
+		if key != "" && value > 0 {
+			counts[key] = int(value)
+		}
+	}
+	return counts, nil
+}
+
+func countUnread(inst *instance.Instance, key string) (int, error) {
+	var res couchdb.ViewResponse
+	err := couchdb.ExecView(inst, couchdb.UnreadNotificationsView, &couchdb.ViewRequest{
+		Key:    key,
+		Reduce: true,
+	}, &res)
+	if err != nil {
+		return 0, err
+	}
+	if len(res.Rows) == 0 {
+		return 0, nil
+	}
+	value, _ := res.Rows[0].Value.(float64)
+	return int(value), nil
+}
+
+// publishBadge sends the number of unread notifications for the given key in
+// the realtime hub, so that the apps can update their badges.
+func publishBadge(inst *instance.Instance, key string) {
+	if key == "" {
+		return
+	}
+	count, err := countUnread(inst, key)
+	if err != nil {
+		inst.Logger().WithNamespace("notifications").
+			Warnf("Cannot count the unread notifications for %s: %s", key, err)
+		return
+	}
+	realtime.GetHub().Publish(inst, realtime.EventUpdate, &Badge{Slug: key, Count: count}, nil)
+}
@@ -34,6 +34,14 @@ func (p *Properties) Clone() *Properties {
 	return &cloned
 }
 
+// SMSDelivery is the delivery status of a notification sent by SMS.
+type SMSDelivery struct {
+	Provider  string    `json:"provider"`
+	MessageID string    `json:"message_id,omitempty"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // Notification data containing associated to an application a list of actions
 type Notification struct {
 	NID  string `json:"_id,omitempty"`
@@ -55,8 +63,12 @@ type Notification struct {
 	State    interface{}            `json:"state,omitempty"`
 	Data     map[string]interface{} `json:"data,omitempty"`
 
-	PreferredChannels []string `json:"preferred_channels,omitempty"`
-	At                string   `json:"at,omitempty"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+
+	PreferredChannels []string     `json:"preferred_channels,omitempty"`
+	At                string       `json:"at,omitempty"`
+	SMS               *SMSDelivery `json:"sms,omitempty"`
 
 	// XXX retro-compatible fields for sending rich mail
 	Content     string `json:"content,omitempty"`
@@ -81,6 +93,18 @@ func (n *Notification) Clone() couchdb.Doc {
 	}
 	cloned.PreferredChannels = make([]string, len(n.PreferredChannels))
 	copy(cloned.PreferredChannels, n.PreferredChannels)
+	if n.SMS != nil {
+		sms := *n.SMS
+		cloned.SMS = &sms
+	}
+	if n.ReadAt != nil {
+		readAt := *n.ReadAt
+		cloned.ReadAt = &readAt
+	}
+	if n.ArchivedAt != nil {
+		archivedAt := *n.ArchivedAt
+		cloned.ArchivedAt = &archivedAt
+	}
 	return &cloned
 }
 
@@ -103,5 +127,14 @@ func (n *Notification) Source() string {
 		n.CategoryID)
 }
 
+// BadgeKey returns the key used for counting the unread notifications: the
+// slug of the app, or the originator for the notifications without a slug.
+func (n *Notification) BadgeKey() string {
+	if n.Slug != "" {
+		return n.Slug
+	}
+	return n.Originator
+}
+
 var _ couchdb.Doc = &Notification{}
 var _ permission.Fetcher = &Notification{}
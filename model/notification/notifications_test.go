@@ -0,0 +1,28 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotification(t *testing.T) {
+	t.Run("BadgeKey", func(t *testing.T) {
+		n := &Notification{Originator: "app", Slug: "bank"}
+		assert.Equal(t, "bank", n.BadgeKey())
+		n = &Notification{Originator: "stack"}
+		assert.Equal(t, "stack", n.BadgeKey())
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		readAt := time.Now()
+		n := &Notification{Title: "foo", ReadAt: &readAt}
+		cloned := n.Clone().(*Notification)
+		require.NotNil(t, cloned.ReadAt)
+		assert.Equal(t, readAt, *cloned.ReadAt)
+		assert.NotSame(t, n.ReadAt, cloned.ReadAt)
+		assert.Nil(t, cloned.ArchivedAt)
+	})
+}
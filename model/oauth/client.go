@@ -17,6 +17,7 @@ import (
 	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/model/notification"
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
@@ -106,6 +107,11 @@ type Client struct {
 	OnboardingPermissions string `json:"onboarding_permissions,omitempty"`
 	OnboardingState       string `json:"onboarding_state,omitempty"`
 
+	// SyncScope is the list of the top-level directories that the client can
+	// synchronize, chosen by the user. It is empty for a client that can
+	// access the whole VFS.
+	SyncScope []string `json:"sync_scope,omitempty"`
+
 	Metadata *metadata.CozyMetadata `json:"cozyMetadata,omitempty"`
 }
 
@@ -604,6 +610,7 @@ func (c *Client) Update(i *instance.Instance, old *Client) *ClientRegistrationEr
 
 	c.Flagship = old.Flagship
 	c.CertifiedFromStore = old.CertifiedFromStore
+	c.SyncScope = old.SyncScope
 
 	// Updating metadata
 	md := metadata.New()
@@ -645,6 +652,10 @@ func (c *Client) Delete(i *instance.Instance) *ClientRegistrationError {
 			Error: "internal_server_error",
 		}
 	}
+	if err := vfs.DeleteCheckpoint(i, c.ID()); err != nil {
+		i.Logger().WithNamespace("oauth").
+			Warnf("Cannot delete the checkpoint of client %s: %s", c.ID(), err)
+	}
 	return nil
 }
 
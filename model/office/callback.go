@@ -119,15 +119,6 @@ func forceSaveFile(inst *instance.Instance, key, downloadURL string) error {
 
 // saveFile saves the file with content from the given URL and returns the new revision.
 func saveFile(inst *instance.Instance, detector conflictDetector, downloadURL string) (*conflictDetector, error) {
-	fs := inst.VFS()
-	file, err := fs.FileByID(detector.ID)
-	if err != nil {
-		return nil, err
-	}
-	if !isOfficeDocument(file) {
-		return nil, ErrInvalidFile
-	}
-
 	res, err := docserverClient.Get(downloadURL)
 	if err != nil {
 		return nil, err
@@ -138,10 +129,25 @@ func saveFile(inst *instance.Instance, detector conflictDetector, downloadURL st
 		_, _ = io.Copy(io.Discard, res.Body)
 		_ = res.Body.Close()
 	}()
+	return writeFile(inst, detector, res.Body, res.ContentLength)
+}
+
+// writeFile writes a new version of the file with the given content, or
+// creates a conflict file if the file has been modified since the document
+// server has loaded it.
+func writeFile(inst *instance.Instance, detector conflictDetector, content io.Reader, size int64) (*conflictDetector, error) {
+	fs := inst.VFS()
+	file, err := fs.FileByID(detector.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isOfficeDocument(file) {
+		return nil, ErrInvalidFile
+	}
 
 	newfile := file.Clone().(*vfs.FileDoc)
 	newfile.MD5Sum = nil // Let the VFS compute the new md5sum
-	newfile.ByteSize = res.ContentLength
+	newfile.ByteSize = size
 	if newfile.CozyMetadata == nil {
 		newfile.CozyMetadata = vfs.NewCozyMetadata(inst.PageURL("/", nil))
 	}
@@ -166,7 +172,7 @@ func saveFile(inst *instance.Instance, detector conflictDetector, downloadURL st
 	if err != nil {
 		return nil, err
 	}
-	_, err = io.Copy(f, res.Body)
+	_, err = io.Copy(f, content)
 	if cerr := f.Close(); cerr != nil && err == nil {
 		err = cerr
 	}
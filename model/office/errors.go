@@ -8,6 +8,9 @@ var (
 	ErrNoServer = errors.New("No OnlyOnffice server is configured")
 	// ErrInvalidFile is used when a file is not an office document
 	ErrInvalidFile = errors.New("Invalid file, not an office document")
+	// ErrReadOnly is used when a document server tries to save a file that
+	// has been opened in read-only mode
+	ErrReadOnly = errors.New("The file has been opened in read-only mode")
 	// ErrInternalServerError is used when something goes wrong (like no
 	// connection to redis)
 	ErrInternalServerError = errors.New("Internal server error")
@@ -24,6 +24,7 @@ type apiOfficeURL struct {
 	Sharecode  string      `json:"sharecode,omitempty"`
 	PublicName string      `json:"public_name,omitempty"`
 	OO         *onlyOffice `json:"onlyoffice,omitempty"`
+	WOPI       *wopiParams `json:"wopi,omitempty"`
 }
 
 type onlyOffice struct {
@@ -140,10 +141,16 @@ func (o *Opener) GetResult(memberIndex int, readOnly bool) (jsonapi.Object, erro
 
 func (o *Opener) openLocalDocument(memberIndex int, readOnly bool) (*apiOfficeURL, error) {
 	cfg := getConfig(o.Inst.ContextName)
-	if cfg == nil || cfg.OnlyOfficeURL == "" {
+	if cfg == nil || (cfg.OnlyOfficeURL == "" && cfg.WOPIURL == "") {
 		return nil, ErrNoServer
 	}
 
+	// A recipient of a sharing with the read-only flag must not be able to
+	// save the document
+	if o.Sharing != nil && !o.Sharing.Owner && o.Sharing.ReadOnly() {
+		readOnly = true
+	}
+
 	// Create a local result
 	code, err := o.GetSharecode(memberIndex, readOnly)
 	if err != nil {
@@ -178,6 +185,15 @@ func (o *Opener) openLocalDocument(memberIndex int, readOnly bool) (*apiOfficeUR
 	}
 	publicName, _ := settings.PublicName(o.Inst)
 	doc.PublicName = publicName
+
+	if cfg.OnlyOfficeURL == "" {
+		doc.WOPI, err = o.wopiParams(cfg, key, mode == "view")
+		if err != nil {
+			return nil, err
+		}
+		return &doc, nil
+	}
+
 	doc.OO = &onlyOffice{
 		URL:  cfg.OnlyOfficeURL,
 		Type: documentType(o.File),
@@ -239,6 +255,7 @@ func (o *Opener) openSharedDocument() (*apiOfficeURL, error) {
 	publicName, _ := settings.PublicName(o.Inst)
 	doc.PublicName = publicName
 	doc.OO = nil
+	doc.WOPI = nil
 	return &doc, nil
 }
 
@@ -0,0 +1,259 @@
+package office
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/previewfs"
+)
+
+var (
+	// ErrPreviewDisabled is used when the previews of the office documents
+	// are not configured for the context of the instance.
+	ErrPreviewDisabled = errors.New("The previews of the office documents are not enabled")
+	// ErrPreviewBusy is used when all the LibreOffice processes of the context
+	// are busy, and no one has been available before the timeout.
+	ErrPreviewBusy = errors.New("Too many previews are being generated, retry later")
+	// ErrPreviewPageNotFound is used when the page asked for a preview does
+	// not exist in the document.
+	ErrPreviewPageNotFound = errors.New("The page does not exist in the document")
+	// ErrPreviewFailed is used when LibreOffice or ImageMagick has failed to
+	// convert the document.
+	ErrPreviewFailed = errors.New("The preview of the document cannot be generated")
+)
+
+// previewFormatPDF is the format in the cache for the preview of the whole
+// document, as PDF.
+const previewFormatPDF = "pdf"
+
+// pdfPageRegexp matches the page objects in the PDF produced by LibreOffice,
+// and not the /Pages objects of the page tree.
+var pdfPageRegexp = regexp.MustCompile(`/Type\s*/Page\b[^s]`)
+
+// previewPools limits the number of LibreOffice processes running at the same
+// time, per context.
+var (
+	previewPoolsMu sync.Mutex
+	previewPools   = make(map[string]chan struct{})
+)
+
+func previewPool(contextName string, size int) chan struct{} {
+	previewPoolsMu.Lock()
+	defer previewPoolsMu.Unlock()
+	pool, ok := previewPools[contextName]
+	if !ok || cap(pool) != size {
+		pool = make(chan struct{}, size)
+		previewPools[contextName] = pool
+	}
+	return pool
+}
+
+func getPreviewConfig(inst *instance.Instance) (*config.OfficePreview, string, error) {
+	contextName := inst.ContextName
+	configuration := config.GetConfig().Office
+	c, ok := configuration[contextName]
+	if !ok {
+		contextName = config.DefaultInstanceContext
+		c, ok = configuration[contextName]
+	}
+	if !ok || c.Preview.Cmd == "" {
+		return nil, "", ErrPreviewDisabled
+	}
+	return &c.Preview, contextName, nil
+}
+
+// PreviewPDF returns the preview of an office document, converted to PDF. The
+// previews are cached by the checksum of the content of the file.
+func PreviewPDF(inst *instance.Instance, doc *vfs.FileDoc) (*bytes.Buffer, error) {
+	if !isOfficeDocument(doc) {
+		return nil, ErrInvalidFile
+	}
+	// The cache is shared and checked before opening the file
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
+	cache := previewfs.SystemCache()
+	if buf, err := cache.GetOfficePreview(doc.MD5Sum, previewFormatPDF); err == nil {
+		return buf, nil
+	}
+
+	cfg, contextName, err := getPreviewConfig(inst)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := convertToPDF(inst, cfg, contextName, doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.SetOfficePreview(doc.MD5Sum, previewFormatPDF, buf); err != nil {
+		inst.Logger().WithNamespace("office").
+			Warnf("Cannot cache the preview of %s: %s", doc.ID(), err)
+	}
+	return buf, nil
+}
+
+// PreviewPage returns the preview of a page of an office document, as a PNG
+// image, and the number of pages of the document. The first page is 1.
+func PreviewPage(inst *instance.Instance, doc *vfs.FileDoc, page int) (*bytes.Buffer, int, error) {
+	pdf, err := PreviewPDF(inst, doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	pages := CountPDFPages(pdf.Bytes())
+	if page < 1 || page > pages {
+		return nil, pages, ErrPreviewPageNotFound
+	}
+
+	cache := previewfs.SystemCache()
+	format := "page-" + strconv.Itoa(page)
+	if buf, err := cache.GetOfficePreview(doc.MD5Sum, format); err == nil {
+		return buf, pages, nil
+	}
+	buf, err := renderPDFPage(doc, pdf, page)
+	if err != nil {
+		return nil, pages, err
+	}
+	if err := cache.SetOfficePreview(doc.MD5Sum, format, buf); err != nil {
+		inst.Logger().WithNamespace("office").
+			Warnf("Cannot cache the preview of %s: %s", doc.ID(), err)
+	}
+	return buf, pages, nil
+}
+
+// CountPDFPages returns the number of pages of a PDF generated by LibreOffice.
+func CountPDFPages(pdf []byte) int {
+	return len(pdfPageRegexp.FindAllIndex(pdf, -1))
+}
+
+func convertToPDF(inst *instance.Instance, cfg *config.OfficePreview, contextName string, doc *vfs.FileDoc) (*bytes.Buffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	// Wait for a LibreOffice process of the pool
+	pool := previewPool(contextName, cfg.PoolSize)
+	select {
+	case pool <- struct{}{}:
+		defer func() { <-pool }()
+	case <-ctx.Done():
+		return nil, ErrPreviewBusy
+	}
+
+	tempDir, err := os.MkdirTemp("", "office-preview")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	// LibreOffice guesses the format of the document from its extension
+	input := filepath.Join(tempDir, "document"+path.Ext(doc.DocName))
+	if err := copyFileContent(inst.VFS(), doc, input); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"--headless",
+		"--norestore",
+		// Each process needs its own profile to run in parallel
+		"-env:UserInstallation=file://" + filepath.Join(tempDir, "profile"),
+		"--convert-to", "pdf",
+		"--outdir", tempDir,
+		input,
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, cfg.Cmd, args...)
+	cmd.Env = []string{"HOME=" + tempDir}
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logPreviewError("libreoffice", doc, &stderr, err)
+		return nil, ErrPreviewFailed
+	}
+
+	output := filepath.Join(tempDir, "document.pdf")
+	content, err := os.ReadFile(output)
+	if err != nil {
+		logPreviewError("libreoffice", doc, &stderr, err)
+		return nil, ErrPreviewFailed
+	}
+	return bytes.NewBuffer(content), nil
+}
+
+func copyFileContent(fs vfs.VFS, doc *vfs.FileDoc, dst string) error {
+	f, err := fs.OpenFile(doc)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, f); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func renderPDFPage(doc *vfs.FileDoc, pdf *bytes.Buffer, page int) (*bytes.Buffer, error) {
+	tempDir, err := os.MkdirTemp("", "magick")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	envTempDir := fmt.Sprintf("MAGICK_TEMPORARY_PATH=%s", tempDir)
+	env := []string{envTempDir}
+
+	convertCmd := config.GetConfig().Jobs.ImageMagickConvertCmd
+	if convertCmd == "" {
+		convertCmd = "convert"
+	}
+	args := []string{
+		"-limit", "Memory", "2GB",
+		"-limit", "Map", "3GB",
+		"-density", "150", // A good resolution for reading a page on a screen
+		// Takes the page from the PDF on stdin (the index starts at 0)
+		fmt.Sprintf("pdf:-[%d]", page-1),
+		"-background", "white", // Use white for the background
+		"-alpha", "remove", // Remove the transparency
+		"-colorspace", "sRGB", // Use the colorspace recommended for web, sRGB
+		"png:-", // Send the output on stdout, in PNG format
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(convertCmd, args...)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(pdf.Bytes())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logPreviewError("imagemagick", doc, &stderr, err)
+		return nil, ErrPreviewFailed
+	}
+	return &stdout, nil
+}
+
+func logPreviewError(tool string, doc *vfs.FileDoc, stderr *bytes.Buffer, err error) {
+	// Truncate very long messages
+	msg := stderr.String()
+	if len(msg) > 4000 {
+		msg = msg[:4000]
+	}
+	logger.WithNamespace("office_preview").
+		WithField("stderr", msg).
+		WithField("file_id", doc.ID()).
+		Errorf("%s failed: %s", tool, err)
+}
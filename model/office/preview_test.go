@@ -0,0 +1,57 @@
+package office
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("CountPDFPages", func(t *testing.T) {
+		pdf := []byte(`%PDF-1.4
+1 0 obj << /Type /Pages /Kids [2 0 R 3 0 R] /Count 2 >> endobj
+2 0 obj << /Type /Page /Parent 1 0 R >> endobj
+3 0 obj <</Type/Page/Parent 1 0 R>> endobj
+%%EOF`)
+		assert.Equal(t, 2, CountPDFPages(pdf))
+		assert.Equal(t, 0, CountPDFPages([]byte("not a PDF")))
+	})
+
+	t.Run("GetPreviewConfig", func(t *testing.T) {
+		cfg := config.GetConfig()
+		previous := cfg.Office
+		defer func() { cfg.Office = previous }()
+
+		inst := &instance.Instance{ContextName: "foo"}
+		cfg.Office = map[string]config.Office{
+			"default": {OnlyOfficeURL: "https://onlyoffice.example.net/"},
+		}
+		_, _, err := getPreviewConfig(inst)
+		assert.Equal(t, ErrPreviewDisabled, err)
+
+		cfg.Office = map[string]config.Office{
+			"default": {
+				Preview: config.OfficePreview{Cmd: "soffice", PoolSize: 2, Timeout: time.Minute},
+			},
+			"bar": {
+				Preview: config.OfficePreview{Cmd: "/usr/bin/soffice", PoolSize: 4, Timeout: time.Minute},
+			},
+		}
+		preview, contextName, err := getPreviewConfig(inst)
+		require.NoError(t, err)
+		assert.Equal(t, "default", contextName)
+		assert.Equal(t, "soffice", preview.Cmd)
+
+		inst.ContextName = "bar"
+		preview, contextName, err = getPreviewConfig(inst)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", contextName)
+		assert.Equal(t, 4, preview.PoolSize)
+	})
+}
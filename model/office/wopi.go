@@ -0,0 +1,202 @@
+package office
+
+import (
+	"encoding/base64"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// WOPI is the protocol used by some document servers, like Collabora Online,
+// to load and save the files from the stack.
+// Cf https://learn.microsoft.com/en-us/microsoft-365/cloud-storage-partner-program/rest/
+
+type wopiParams struct {
+	URL         string `json:"url"`
+	Token       string `json:"access_token"`
+	TokenTTL    int64  `json:"access_token_ttl"`
+	WOPISrc     string `json:"wopi_src"`
+	Mode        string `json:"mode"`
+	DocumentKey string `json:"document_key"`
+}
+
+// WOPIClaims are the claims of the access tokens given to the document server
+// for loading and saving a file.
+type WOPIClaims struct {
+	crypto.StandardClaims
+	Key      string `json:"key"`
+	ReadOnly bool   `json:"ro,omitempty"`
+	UserName string `json:"name,omitempty"`
+}
+
+// WOPIFileInfo is the response for the CheckFileInfo operation.
+// Cf https://learn.microsoft.com/en-us/microsoft-365/cloud-storage-partner-program/rest/files/checkfileinfo
+type WOPIFileInfo struct {
+	BaseFileName            string `json:"BaseFileName"`
+	OwnerID                 string `json:"OwnerId"`
+	UserID                  string `json:"UserId"`
+	UserFriendlyName        string `json:"UserFriendlyName,omitempty"`
+	Size                    int64  `json:"Size"`
+	Version                 string `json:"Version"`
+	LastModifiedTime        string `json:"LastModifiedTime"`
+	ReadOnly                bool   `json:"ReadOnly"`
+	UserCanWrite            bool   `json:"UserCanWrite"`
+	UserCanNotWriteRelative bool   `json:"UserCanNotWriteRelative"`
+	SupportsUpdate          bool   `json:"SupportsUpdate"`
+	SupportsLocks           bool   `json:"SupportsLocks"`
+}
+
+// wopiParams returns the parameters for opening the document with a WOPI
+// document server.
+func (o *Opener) wopiParams(cfg *config.Office, key string, readOnly bool) (*wopiParams, error) {
+	publicName, _ := settings.PublicName(o.Inst)
+	token, err := makeWOPIToken(o.Inst, o.File.ID(), key, publicName, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	mode := "edit"
+	if readOnly {
+		mode = "view"
+	}
+	ttl := time.Now().Add(consts.WOPITokenValidityDuration)
+	return &wopiParams{
+		URL:         cfg.WOPIURL,
+		Token:       token,
+		TokenTTL:    ttl.UnixNano() / int64(time.Millisecond),
+		WOPISrc:     o.Inst.PageURL("/office/wopi/files/"+o.File.ID(), nil),
+		Mode:        mode,
+		DocumentKey: key,
+	}, nil
+}
+
+func makeWOPIToken(inst *instance.Instance, fileID, key, name string, readOnly bool) (string, error) {
+	now := time.Now()
+	return crypto.NewJWT(inst.SessionSecret(), WOPIClaims{
+		StandardClaims: crypto.StandardClaims{
+			Audience:  consts.WOPIAudience,
+			Issuer:    inst.Domain,
+			Subject:   fileID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(consts.WOPITokenValidityDuration).Unix(),
+		},
+		Key:      key,
+		ReadOnly: readOnly,
+		UserName: name,
+	})
+}
+
+// CheckWOPIToken checks that the access token sent by the document server is
+// valid for the given file, and returns its claims.
+func CheckWOPIToken(inst *instance.Instance, fileID, token string) (*WOPIClaims, error) {
+	var claims WOPIClaims
+	err := crypto.ParseJWT(token, func(token *jwt.Token) (interface{}, error) {
+		return inst.SessionSecret(), nil
+	}, &claims)
+	if err != nil {
+		return nil, permission.ErrInvalidToken
+	}
+	if claims.Audience != consts.WOPIAudience ||
+		claims.Issuer != inst.Domain ||
+		claims.Subject != fileID {
+		return nil, permission.ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// WOPICheckFileInfo returns the information about the file for a document
+// server.
+func WOPICheckFileInfo(inst *instance.Instance, claims *WOPIClaims) (*WOPIFileInfo, error) {
+	file, err := inst.VFS().FileByID(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if !isOfficeDocument(file) {
+		return nil, ErrInvalidFile
+	}
+	readOnly := claims.ReadOnly || file.Trashed
+	return &WOPIFileInfo{
+		BaseFileName:            file.DocName,
+		OwnerID:                 inst.Domain,
+		UserID:                  claims.Key,
+		UserFriendlyName:        claims.UserName,
+		Size:                    file.ByteSize,
+		Version:                 base64.StdEncoding.EncodeToString(file.MD5Sum),
+		LastModifiedTime:        file.UpdatedAt.UTC().Format(time.RFC3339),
+		ReadOnly:                readOnly,
+		UserCanWrite:            !readOnly,
+		UserCanNotWriteRelative: true,
+		SupportsUpdate:          !readOnly,
+		SupportsLocks:           false,
+	}, nil
+}
+
+// WOPIGetFile returns the file that the document server can load.
+func WOPIGetFile(inst *instance.Instance, claims *WOPIClaims) (*vfs.FileDoc, error) {
+	file, err := inst.VFS().FileByID(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if !isOfficeDocument(file) {
+		return nil, ErrInvalidFile
+	}
+	return file, nil
+}
+
+// WOPIPutFile saves a new version of the file with the content sent by the
+// document server. The VFS keeps the previous content as an old version of
+// the file, and a conflict file is created if the file has been modified on
+// the stack while it was edited.
+func WOPIPutFile(inst *instance.Instance, claims *WOPIClaims, content io.Reader, size int64) (*vfs.FileDoc, error) {
+	if claims.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	detector, err := GetStore().GetDoc(inst, claims.Key)
+	if err != nil || detector == nil || detector.ID == "" || detector.Rev == "" {
+		return nil, permission.ErrInvalidToken
+	}
+	if detector.ID != claims.Subject {
+		return nil, permission.ErrInvalidToken
+	}
+	if err := checkNotTrashed(inst, detector.ID); err != nil {
+		return nil, err
+	}
+	updated, err := writeFile(inst, *detector, content, size)
+	if err != nil {
+		return nil, err
+	}
+	// Only follow the original file, not a conflict file
+	if updated.ID == detector.ID {
+		_ = GetStore().UpdateDoc(inst, claims.Key, *updated)
+	}
+	return inst.VFS().FileByID(updated.ID)
+}
+
+// checkNotTrashed returns an error if the file has been moved to the trash
+// since the document was opened: the document server must not write in it.
+func checkNotTrashed(inst *instance.Instance, fileID string) error {
+	fs := inst.VFS()
+	file, err := fs.FileByID(fileID)
+	if err != nil {
+		return err
+	}
+	if file.Trashed {
+		return vfs.ErrFileInTrash
+	}
+	fullpath, err := file.Path(fs)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(fullpath, vfs.TrashDirName+"/") {
+		return vfs.ErrFileInTrash
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package office
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWOPIToken(t *testing.T) {
+	inst := &instance.Instance{
+		Domain:     "alice.cozy.example",
+		SessSecret: crypto.GenerateRandomBytes(64),
+	}
+
+	token, err := makeWOPIToken(inst, "file-id", "key", "Alice", true)
+	require.NoError(t, err)
+
+	claims, err := CheckWOPIToken(inst, "file-id", token)
+	require.NoError(t, err)
+	assert.Equal(t, "key", claims.Key)
+	assert.Equal(t, "Alice", claims.UserName)
+	assert.True(t, claims.ReadOnly)
+
+	_, err = CheckWOPIToken(inst, "another-file", token)
+	assert.Error(t, err)
+
+	other := &instance.Instance{
+		Domain:     "bob.cozy.example",
+		SessSecret: crypto.GenerateRandomBytes(64),
+	}
+	_, err = CheckWOPIToken(other, "file-id", token)
+	assert.Error(t, err)
+
+	appToken := inst.BuildAppToken("drive", "")
+	_, err = CheckWOPIToken(inst, "file-id", appToken)
+	assert.Error(t, err)
+}
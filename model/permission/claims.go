@@ -44,8 +44,15 @@ func (claims *Claims) Expired() bool {
 	case consts.AccessTokenAudience:
 		validityDuration = consts.AccessTokenValidityDuration
 
-	// Share, RefreshToken and RegistrationToken never expire
-	case consts.ShareAudience, consts.RegistrationTokenAudience, consts.RefreshTokenAudience:
+	// The real expiration date of a delegated token is checked on its
+	// permission document
+	case consts.DelegatedAudience:
+		validityDuration = consts.MaxDelegatedTokenValidityDuration
+
+	// Share, RefreshToken and RegistrationToken never expire. The upload
+	// tokens are long-lived, and their expiration is checked on their
+	// permission document.
+	case consts.ShareAudience, consts.RegistrationTokenAudience, consts.RefreshTokenAudience, consts.UploadAudience:
 		return false
 
 	default:
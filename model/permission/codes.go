@@ -0,0 +1,159 @@
+package permission
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// CodeUseDuration is the duration during which the requests made with a code
+// are accepted after it has been used for the last time, when the code has a
+// maximal number of uses. It allows the viewer to load the shared documents
+// after opening the link.
+const CodeUseDuration = time.Hour
+
+// maxConsumeRetries is the number of times the consumption of a code is
+// retried when there is a conflict with a concurrent access.
+const maxConsumeRetries = 3
+
+// CodeLimits are the optional limits of a sharecode, enforced by the stack in
+// addition to the expiration date of the permission: a validity window and a
+// maximal number of uses. A use is counted when the link is opened.
+type CodeLimits struct {
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	MaxUses   int        `json:"max_uses,omitempty"`
+
+	Uses          int        `json:"uses,omitempty"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	Regenerations int        `json:"regenerations,omitempty"`
+	RegeneratedAt *time.Time `json:"regenerated_at,omitempty"`
+}
+
+// Clone returns a copy of the limits.
+func (l *CodeLimits) Clone() *CodeLimits {
+	cloned := *l
+	return &cloned
+}
+
+// UsedUp returns true if the code has been used its maximal number of times.
+func (l *CodeLimits) UsedUp() bool {
+	return l.MaxUses > 0 && l.Uses >= l.MaxUses
+}
+
+// inUseWindow returns true if the code has been used less than
+// CodeUseDuration ago.
+func (l *CodeLimits) inUseWindow(now time.Time) bool {
+	return l.LastUsedAt != nil && !now.After(l.LastUsedAt.Add(CodeUseDuration))
+}
+
+// needsUse returns true if a request made with the code at the given date
+// must be counted as a new use: the code has a maximal number of uses, and it
+// has not been used recently.
+func (l *CodeLimits) needsUse(now time.Time) bool {
+	return l.MaxUses > 0 && !l.inUseWindow(now)
+}
+
+// check returns an error if the code cannot be used at the given date.
+func (l *CodeLimits) check(now time.Time) error {
+	if l.NotBefore != nil && now.Before(*l.NotBefore) {
+		return ErrCodeNotYetValid
+	}
+	if l.NotAfter != nil && now.After(*l.NotAfter) {
+		return ErrExpiredToken
+	}
+	if l.UsedUp() && !l.inUseWindow(now) {
+		return ErrCodeUsedUp
+	}
+	return nil
+}
+
+// CodeName returns the name of the given code, or an empty string if the code
+// is not one of the codes of the permission.
+func (p *Permission) CodeName(code string) string {
+	for name, c := range p.Codes {
+		if c == code {
+			return name
+		}
+	}
+	return ""
+}
+
+// checkCodeLimits returns an error if the code can no longer be used.
+func (p *Permission) checkCodeLimits(code string, now time.Time) error {
+	limits := p.CodesLimits[p.CodeName(code)]
+	if limits == nil {
+		return nil
+	}
+	return limits.check(now)
+}
+
+// RegenerateCode replaces a code and its shortcode by new ones. The uses of
+// the code are reset, and the regeneration is tracked in its limits.
+func (p *Permission) RegenerateCode(name, code, shortcode string) {
+	if p.Codes == nil {
+		p.Codes = make(map[string]string)
+	}
+	p.Codes[name] = code
+	if p.ShortCodes == nil {
+		p.ShortCodes = make(map[string]string)
+	}
+	p.ShortCodes[name] = shortcode
+
+	if p.CodesLimits == nil {
+		p.CodesLimits = make(map[string]*CodeLimits)
+	}
+	limits := p.CodesLimits[name]
+	if limits == nil {
+		limits = &CodeLimits{}
+		p.CodesLimits[name] = limits
+	}
+	now := time.Now()
+	limits.Uses = 0
+	limits.LastUsedAt = nil
+	limits.Regenerations++
+	limits.RegeneratedAt = &now
+}
+
+// ConsumeShareCode counts a use of a sharecode, when the link is opened. It
+// returns an error if the code can no longer be used.
+func ConsumeShareCode(db prefixer.Prefixer, code string) error {
+	perm, err := findForShareCode(db, code)
+	if err != nil {
+		return err
+	}
+	return consumeCode(db, perm, code, false)
+}
+
+// consumeCode counts a use of the code, and saves the permission. The
+// permission is reloaded and the use is counted again when there is a
+// conflict. With onlyIfNeeded, the use is not counted if the code has been
+// used recently, like by a concurrent request.
+func consumeCode(db prefixer.Prefixer, perm *Permission, code string, onlyIfNeeded bool) error {
+	for i := 0; ; i++ {
+		limits := perm.CodesLimits[perm.CodeName(code)]
+		if limits == nil {
+			return nil
+		}
+		now := time.Now()
+		if onlyIfNeeded && !limits.needsUse(now) {
+			return nil
+		}
+		if limits.UsedUp() {
+			return ErrCodeUsedUp
+		}
+		limits.Uses++
+		limits.LastUsedAt = &now
+		err := couchdb.UpdateDoc(db, perm)
+		if !couchdb.IsConflictError(err) || i >= maxConsumeRetries {
+			return err
+		}
+		id := perm.ID()
+		perm = &Permission{}
+		if err := couchdb.GetDoc(db, consts.Permissions, id, perm); err != nil {
+			return err
+		}
+	}
+}
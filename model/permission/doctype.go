@@ -15,14 +15,19 @@ var none = false
 
 var blockList = map[string]bool{
 	// Global databases
-	consts.Instances:             none,
-	consts.AccountTypes:          none,
-	consts.KonnectorsMaintenance: none,
-	consts.RemoteSecrets:         none,
+	consts.Instances:              none,
+	consts.AccountTypes:           none,
+	consts.KonnectorsMaintenance:  none,
+	consts.KonnectorsAvailability: none,
+	consts.RemoteSecrets:          none,
+	consts.CSPPolicies:            none,
+	consts.UploadPolicies:         none,
 
 	// Only stack can manipulate them
 	consts.Sessions:            none,
 	consts.Permissions:         none,
+	consts.PermissionsUsage:    none,
+	consts.AppsProvisioning:    none,
 	consts.Intents:             none,
 	consts.OAuthClients:        none,
 	consts.OAuthAccessCodes:    none,
@@ -30,6 +35,41 @@ var blockList = map[string]bool{
 	consts.Sharings:            none,
 	consts.Shared:              none,
 	consts.SoftDeletedAccounts: none,
+	consts.Audit:               none,
+	consts.AccessLogs:          none,
+	consts.UnoptimalQueries:    none,
+	consts.KonnectorsLogs:      none,
+	consts.TriggersHistory:     none,
+	consts.ContactsDuplicates:  none,
+	consts.ContactsMerges:      none,
+	consts.SupportAccesses:     none,
+	consts.FilesJournal:        none,
+
+	// Only stack can manipulate them, and they are available to the owner via
+	// the /sharings/:id/analytics API
+	consts.SharingsAnalytics: none,
+
+	// Only stack can manipulate them, and they are available via the
+	// /sharings/suggestions API
+	consts.SharingsSuggestions: none,
+	consts.SharingsWebhooks:    none,
+
+	// Only stack can manipulate them, and they are available via the
+	// /data/:doctype/_migration API
+	consts.DoctypesMigrations: none,
+
+	// Only stack can write them, and the apps can read them to browse the
+	// sharings in metadata-only mode
+	consts.SharingsRemoteFiles: readable,
+
+	// Only stack can manipulate them, and they are available via the
+	// /jobs/webhooks/subscriptions API
+	consts.WebhookSubscriptions: none,
+	consts.WebhookDeliveries:    none,
+
+	// Only stack can manipulate them, and they are available via the
+	// /bitwarden/api/reports API
+	consts.BitwardenReports: none,
 
 	// Synthetic doctypes (API only)
 	consts.CertifiedCarbonCopy:     none,
@@ -38,6 +78,7 @@ var blockList = map[string]bool{
 	consts.TriggersState:           none,
 	consts.SharingsAnswer:          none,
 	consts.SharingsMoved:           none,
+	consts.SharingsIdentity:        none,
 	consts.Support:                 none,
 	consts.BitwardenProfiles:       none,
 	consts.OfficeURL:               none,
@@ -49,23 +90,34 @@ var blockList = map[string]bool{
 	consts.JobEvents:           none,
 	consts.SharingsInitialSync: none,
 	consts.NotesEvents:         none,
+	consts.Comments:            readable,
+	consts.CommentsEvents:      none,
 	consts.NotesTelepointers:   none,
+	consts.NotesPresences:      none,
 	consts.Thumbnails:          none,
 	consts.AppLogs:             none,
+	consts.FilesFsckReports:    none,
 
 	// Only stack can write them
-	consts.Jobs:              readable,
-	consts.Triggers:          readable,
-	consts.Apps:              readable,
-	consts.Konnectors:        readable,
-	consts.Files:             readable,
-	consts.FilesVersions:     readable,
-	consts.Notifications:     readable,
-	consts.RemoteRequests:    readable,
-	consts.SessionsLogins:    readable,
-	consts.NotesSteps:        readable,
-	consts.NotesImages:       readable,
-	consts.BitwardenContacts: readable,
+	consts.Jobs:                  readable,
+	consts.Triggers:              readable,
+	consts.Apps:                  readable,
+	consts.Konnectors:            readable,
+	consts.KonnectorsInputs:      readable,
+	consts.KonnectorsSummaries:   readable,
+	consts.Files:                 readable,
+	consts.FilesVersions:         readable,
+	consts.FilesSnapshots:        readable,
+	consts.FilesSnapshotEntries:  readable,
+	consts.FilesCheckpoints:      readable,
+	consts.FilesImports:          readable,
+	consts.FilesPreparedArchives: readable,
+	consts.Notifications:         readable,
+	consts.RemoteRequests:        readable,
+	consts.SessionsLogins:        readable,
+	consts.NotesSteps:            readable,
+	consts.NotesImages:           readable,
+	consts.BitwardenContacts:     readable,
 }
 
 // CheckReadable will abort the context and returns false if the doctype
@@ -35,6 +35,36 @@ var (
 	ErrOnlyAppCanCreateSubSet = echo.NewHTTPError(http.StatusForbidden,
 		"Only apps can create sharing permissions")
 
+	// ErrOnlyAppCanDelegate is returned if a non-webapp attempts to mint a
+	// token for a third party.
+	ErrOnlyAppCanDelegate = echo.NewHTTPError(http.StatusForbidden,
+		"Only webapps can delegate their permissions")
+
+	// ErrDelegatedWholeType is returned when an app tries to delegate its
+	// permissions on a whole doctype.
+	ErrDelegatedWholeType = echo.NewHTTPError(http.StatusBadRequest,
+		"Delegated permissions must be restricted to some documents")
+
+	// ErrOnlyAppCanMintUpload is returned if a non-webapp attempts to mint an
+	// upload token.
+	ErrOnlyAppCanMintUpload = echo.NewHTTPError(http.StatusForbidden,
+		"Only webapps can create upload tokens")
+
+	// ErrUploadWithoutDir is returned when an upload token is asked without a
+	// directory.
+	ErrUploadWithoutDir = echo.NewHTTPError(http.StatusBadRequest,
+		"An upload token must be restricted to a directory")
+
+	// ErrCodeNotYetValid is used when a sharecode is used before the start of
+	// its validity window.
+	ErrCodeNotYetValid = echo.NewHTTPError(http.StatusForbidden,
+		"The code is not yet valid")
+
+	// ErrCodeUsedUp is used when a sharecode has been used its maximal number
+	// of times.
+	ErrCodeUsedUp = echo.NewHTTPError(http.StatusForbidden,
+		"The code has already been used")
+
 	// ErrNotParent is used when the permissions should have a specific parent.
 	ErrNotParent = echo.NewHTTPError(http.StatusForbidden,
 		"Permissions can be updated only by its parent")
@@ -31,6 +31,11 @@ type Permission struct {
 	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
 	Codes       map[string]string `json:"codes,omitempty"`
 	ShortCodes  map[string]string `json:"shortcodes,omitempty"`
+	// CodesLimits are the optional limits of the codes, by code name
+	CodesLimits map[string]*CodeLimits `json:"codes_limits,omitempty"`
+	// RevokedDoctypes are the doctypes revoked by the user for an app or a
+	// konnector: they are not given back when the app is updated
+	RevokedDoctypes []string `json:"revoked_doctypes,omitempty"`
 
 	Client   interface{}            `json:"-"` // Contains the *oauth.Client client pointer for Oauth permission type
 	Metadata *metadata.CozyMetadata `json:"cozyMetadata,omitempty"`
@@ -63,6 +68,15 @@ const (
 	// TypeShareInteract is the value of Permission.Type for reading and
 	// writing a note in a shared folder.
 	TypeShareInteract = "share-interact"
+
+	// TypeDelegated is the value of Permission.Type for the short-lived
+	// permissions minted by an app for a third party.
+	TypeDelegated = "delegated"
+
+	// TypeUpload is the value of Permission.Type for the long-lived
+	// permissions of a device, like a scanner, that can only upload files in
+	// a directory.
+	TypeUpload = "upload"
 )
 
 // ID implements jsonapi.Doc
@@ -88,6 +102,16 @@ func (p *Permission) Clone() couchdb.Doc {
 	for k, v := range p.ShortCodes {
 		cloned.ShortCodes[k] = v
 	}
+	if p.CodesLimits != nil {
+		cloned.CodesLimits = make(map[string]*CodeLimits, len(p.CodesLimits))
+		for k, v := range p.CodesLimits {
+			cloned.CodesLimits[k] = v.Clone()
+		}
+	}
+	if p.RevokedDoctypes != nil {
+		cloned.RevokedDoctypes = make([]string, len(p.RevokedDoctypes))
+		copy(cloned.RevokedDoctypes, p.RevokedDoctypes)
+	}
 	cloned.Permissions = make([]Rule, len(p.Permissions))
 	for i, r := range p.Permissions {
 		vals := r.Values
@@ -146,6 +170,13 @@ func (p *Permission) PatchCodes(codes map[string]string) {
 		}
 		p.ShortCodes = updatedShortcodes
 	}
+
+	// Removing associated limits
+	for codeName := range p.CodesLimits {
+		if _, ok := codes[codeName]; !ok {
+			delete(p.CodesLimits, codeName)
+		}
+	}
 }
 
 // Revoke destroy a Permission
@@ -165,6 +196,24 @@ func (p *Permission) CanUpdateShareByLink(child *Permission) bool {
 	return child.SourceID == p.SourceID || child.Permissions.IsSubSetOf(p.Permissions)
 }
 
+// CanRevokeDelegated checks if the delegated permissions can be revoked by p
+// (p must be the app that has minted them).
+func (p *Permission) CanRevokeDelegated(child *Permission) bool {
+	if child.Type != TypeDelegated || p.Type != TypeWebapp {
+		return false
+	}
+	return child.SourceID == p.SourceID
+}
+
+// CanRevokeUpload checks if the upload-only permissions can be revoked by p
+// (p must be the app that has created them).
+func (p *Permission) CanRevokeUpload(child *Permission) bool {
+	if child.Type != TypeUpload || p.Type != TypeWebapp {
+		return false
+	}
+	return child.SourceID == p.SourceID
+}
+
 // GetByID fetch a permission by its ID
 func GetByID(db prefixer.Prefixer, id string) (*Permission, error) {
 	perm := &Permission{}
@@ -262,8 +311,27 @@ func getFromSource(db prefixer.Prefixer, permType, docType, slug string) (*Permi
 	return perm, nil
 }
 
-// GetForShareCode retrieves the Permission doc for a given sharing code
+// GetForShareCode retrieves the Permission doc for a given sharing code. For
+// a code with a maximal number of uses, a request made long after the last
+// use counts as a new use, and the permission is not returned if this use
+// cannot be saved.
 func GetForShareCode(db prefixer.Prefixer, tokenCode string) (*Permission, error) {
+	perm, err := findForShareCode(db, tokenCode)
+	if err != nil {
+		return nil, err
+	}
+	limits := perm.CodesLimits[perm.CodeName(tokenCode)]
+	if limits != nil && limits.needsUse(time.Now()) {
+		if err := consumeCode(db, perm, tokenCode, true); err != nil {
+			return nil, err
+		}
+	}
+	return perm, nil
+}
+
+// findForShareCode retrieves the Permission doc for a given sharing code,
+// and checks that the code can still be used, without counting a use.
+func findForShareCode(db prefixer.Prefixer, tokenCode string) (*Permission, error) {
 	var res couchdb.ViewResponse
 	err := couchdb.ExecView(db, couchdb.PermissionsShareByCView, &couchdb.ViewRequest{
 		Key:         tokenCode,
@@ -292,26 +360,88 @@ func GetForShareCode(db prefixer.Prefixer, tokenCode string) (*Permission, error
 	if perm.Expired() {
 		return nil, ErrExpiredToken
 	}
+	if err := perm.checkCodeLimits(tokenCode, time.Now()); err != nil {
+		return nil, err
+	}
+	if !sourceExists(db, perm) {
+		return nil, ErrExpiredToken
+	}
+	return perm, nil
+}
+
+// GetForDelegatedToken retrieves the Permission doc for the subject of a
+// token minted by an app for a third party.
+func GetForDelegatedToken(db prefixer.Prefixer, permID string) (*Permission, error) {
+	perm, err := GetByID(db, permID)
+	if err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if perm.Type != TypeDelegated {
+		return nil, ErrInvalidToken
+	}
+	if perm.ExpiresAt == nil || perm.Expired() {
+		return nil, ErrExpiredToken
+	}
+	if !sourceExists(db, perm) {
+		return nil, ErrExpiredToken
+	}
+	return perm, nil
+}
 
-	// Check for sharing made by a webapp/konnector that the app is still
-	// present (but not for OAuth). It is not checked in development release,
-	// since the --appdir does not create the expected document.
-	if !build.IsDevRelease() {
-		parts := strings.SplitN(perm.SourceID, "/", 2)
-		if len(parts) == 2 {
-			var doc couchdb.JSONDoc
-			docID := parts[0] + "/" + parts[1]
-			if parts[0] == consts.Sharings {
-				docID = parts[1]
-			}
-			if err := couchdb.GetDoc(db, parts[0], docID, &doc); err != nil {
-				return nil, ErrExpiredToken
-			}
+// GetForUploadToken retrieves the Permission doc for the subject of an upload
+// token.
+func GetForUploadToken(db prefixer.Prefixer, permID string) (*Permission, error) {
+	perm, err := GetByID(db, permID)
+	if err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil, ErrInvalidToken
 		}
+		return nil, err
+	}
+	if err := perm.checkUploadToken(); err != nil {
+		return nil, err
+	}
+	if !sourceExists(db, perm) {
+		return nil, ErrExpiredToken
 	}
 	return perm, nil
 }
 
+// checkUploadToken returns an error if the permission can't be used for an
+// upload token. As the upload tokens have no expiration date, the expiration
+// of the permission is the only limit of their validity.
+func (p *Permission) checkUploadToken() error {
+	if p.Type != TypeUpload {
+		return ErrInvalidToken
+	}
+	if p.Expired() {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// sourceExists checks for permissions made by a webapp/konnector that the app
+// is still present (but not for OAuth). It is not checked in development
+// release, since the --appdir does not create the expected document.
+func sourceExists(db prefixer.Prefixer, perm *Permission) bool {
+	if build.IsDevRelease() {
+		return true
+	}
+	parts := strings.SplitN(perm.SourceID, "/", 2)
+	if len(parts) != 2 {
+		return true
+	}
+	var doc couchdb.JSONDoc
+	docID := parts[0] + "/" + parts[1]
+	if parts[0] == consts.Sharings {
+		docID = parts[1]
+	}
+	return couchdb.GetDoc(db, parts[0], docID, &doc) == nil
+}
+
 // GetTokenFromShortcode retrieves the token doc for a given sharing shortcode
 func GetTokenFromShortcode(db prefixer.Prefixer, shortcode string) (string, error) {
 	token, _, err := GetTokenAndPermissionsFromShortcode(db, shortcode)
@@ -458,7 +588,7 @@ func UpdateKonnectorSet(db prefixer.Prefixer, slug string, set Set) (*Permission
 }
 
 func updateAppSet(db prefixer.Prefixer, doc *Permission, typ, docType, slug string, set Set) (*Permission, error) {
-	doc.Permissions = set
+	doc.Permissions = withoutDoctypes(set, doc.RevokedDoctypes)
 	if doc.Metadata == nil {
 		doc.Metadata, _ = metadata.NewWithApp(slug, "", DocTypeVersion)
 	} else {
@@ -503,6 +633,7 @@ func CreateShareSet(db prefixer.Prefixer, parent *Permission, sourceID string, c
 		Permissions: set,
 		Codes:       codes,
 		ShortCodes:  shortcodes,
+		CodesLimits: subdoc.CodesLimits,
 		ExpiresAt:   expiresAt,
 		Metadata:    subdoc.Metadata,
 	}
@@ -515,6 +646,120 @@ func CreateShareSet(db prefixer.Prefixer, parent *Permission, sourceID string, c
 	return doc, nil
 }
 
+// CreateDelegatedSet creates a Permission doc for a third party, with a subset
+// of the permissions of an app. Each rule must be restricted to some
+// documents, and the permissions expire at the given date.
+func CreateDelegatedSet(db prefixer.Prefixer, parent *Permission, set Set, expiresAt time.Time, md *metadata.CozyMetadata) (*Permission, error) {
+	if parent.Type != TypeWebapp {
+		return nil, ErrOnlyAppCanDelegate
+	}
+	if len(set) == 0 {
+		return nil, ErrBadScope
+	}
+	for _, rule := range set {
+		if len(rule.Values) == 0 {
+			return nil, ErrDelegatedWholeType
+		}
+	}
+	if err := checkSetPermissions(set, parent); err != nil {
+		return nil, err
+	}
+	if err := DestroyExpiredDelegatedSets(db, parent.SourceID); err != nil {
+		return nil, err
+	}
+	doc := &Permission{
+		Type:        TypeDelegated,
+		SourceID:    parent.SourceID,
+		Permissions: set,
+		ExpiresAt:   &expiresAt,
+		Metadata:    md,
+	}
+	if err := couchdb.CreateDoc(db, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DestroyExpiredDelegatedSets deletes the delegated permissions of an app
+// that have expired. The delegated tokens are short-lived, so the expired
+// docs are purged when the app asks for a new one.
+func DestroyExpiredDelegatedSets(db prefixer.Prefixer, sourceID string) error {
+	var res []*Permission
+	err := couchdb.FindDocs(db, consts.Permissions, &couchdb.FindRequest{
+		UseIndex: "by-source-and-type",
+		Selector: mango.And(
+			mango.Equal("source_id", sourceID),
+			mango.Equal("type", TypeDelegated),
+			mango.Lt("expires_at", time.Now()),
+		),
+		Limit: 1000,
+	}, &res)
+	if err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil
+		}
+		return err
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	docs := make([]couchdb.Doc, len(res))
+	for i, p := range res {
+		docs[i] = p
+	}
+	return couchdb.BulkDeleteDocs(db, consts.Permissions, docs)
+}
+
+// CreateUploadSet creates a Permission doc for a device that can only create
+// files in the given directory (and its sub-directories), without being able
+// to read or list anything. The label helps the user to recognize the device.
+func CreateUploadSet(db prefixer.Prefixer, parent *Permission, dirID, label string, expiresAt *time.Time, md *metadata.CozyMetadata) (*Permission, error) {
+	if parent.Type != TypeWebapp {
+		return nil, ErrOnlyAppCanMintUpload
+	}
+	if dirID == "" {
+		return nil, ErrUploadWithoutDir
+	}
+	set := Set{Rule{
+		Title:       "upload",
+		Description: label,
+		Type:        consts.Files,
+		Verbs:       Verbs(POST),
+		Values:      []string{dirID},
+	}}
+	if err := checkSetPermissions(set, parent); err != nil {
+		return nil, err
+	}
+	doc := &Permission{
+		Type:        TypeUpload,
+		SourceID:    parent.SourceID,
+		Permissions: set,
+		ExpiresAt:   expiresAt,
+		Metadata:    md,
+	}
+	if err := couchdb.CreateDoc(db, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GetUploadSets returns the upload-only permissions created by an app.
+func GetUploadSets(db prefixer.Prefixer, sourceID string) ([]*Permission, error) {
+	var res []*Permission
+	err := couchdb.FindDocs(db, consts.Permissions, &couchdb.FindRequest{
+		UseIndex: "by-source-and-type",
+		Selector: mango.And(
+			mango.Equal("source_id", sourceID),
+			mango.Equal("type", TypeUpload),
+		),
+		Limit: 1000,
+	}, &res)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*Permission{}, nil
+	}
+	return res, err
+}
+
 // CreateSharePreviewSet creates a Permission doc for previewing a sharing
 func CreateSharePreviewSet(db prefixer.Prefixer, sharingID string, codes, shortcodes map[string]string, subdoc Permission) (*Permission, error) {
 	doc := &Permission{
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -409,6 +411,95 @@ func TestCreateShareSetBlocklist(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDelegated(t *testing.T) {
+	parent := &Permission{
+		Type:     TypeWebapp,
+		SourceID: "io.cozy.apps/drive",
+		Permissions: Set{
+			Rule{Type: "io.cozy.files", Verbs: ALL},
+		},
+	}
+	expiresAt := time.Now().Add(time.Hour)
+
+	t.Run("OnlyWebapps", func(t *testing.T) {
+		konn := &Permission{Type: TypeKonnector, Permissions: parent.Permissions}
+		set := Set{Rule{Type: "io.cozy.files", Values: []string{"foo"}}}
+		_, err := CreateDelegatedSet(nil, konn, set, expiresAt, nil)
+		assert.Equal(t, ErrOnlyAppCanDelegate, err)
+	})
+
+	t.Run("WholeType", func(t *testing.T) {
+		set := Set{Rule{Type: "io.cozy.files", Verbs: Verbs(GET)}}
+		_, err := CreateDelegatedSet(nil, parent, set, expiresAt, nil)
+		assert.Equal(t, ErrDelegatedWholeType, err)
+	})
+
+	t.Run("NotSubset", func(t *testing.T) {
+		set := Set{Rule{Type: "io.cozy.contacts", Values: []string{"foo"}}}
+		_, err := CreateDelegatedSet(nil, parent, set, expiresAt, nil)
+		assert.Equal(t, ErrNotSubset, err)
+	})
+
+	t.Run("CanRevokeDelegated", func(t *testing.T) {
+		child := &Permission{Type: TypeDelegated, SourceID: parent.SourceID}
+		assert.True(t, parent.CanRevokeDelegated(child))
+		other := &Permission{Type: TypeWebapp, SourceID: "io.cozy.apps/photos"}
+		assert.False(t, other.CanRevokeDelegated(child))
+		share := &Permission{Type: TypeShareByLink, SourceID: parent.SourceID}
+		assert.False(t, parent.CanRevokeDelegated(share))
+	})
+}
+
+func TestUpload(t *testing.T) {
+	parent := &Permission{
+		Type:     TypeWebapp,
+		SourceID: "io.cozy.apps/drive",
+		Permissions: Set{
+			Rule{Type: "io.cozy.files", Verbs: Verbs(GET, POST), Values: []string{"dir-scans"}},
+		},
+	}
+
+	t.Run("OnlyWebapps", func(t *testing.T) {
+		konn := &Permission{Type: TypeKonnector, Permissions: parent.Permissions}
+		_, err := CreateUploadSet(nil, konn, "dir-scans", "Scanner", nil, nil)
+		assert.Equal(t, ErrOnlyAppCanMintUpload, err)
+	})
+
+	t.Run("WithoutDir", func(t *testing.T) {
+		_, err := CreateUploadSet(nil, parent, "", "Scanner", nil, nil)
+		assert.Equal(t, ErrUploadWithoutDir, err)
+	})
+
+	t.Run("NotSubset", func(t *testing.T) {
+		_, err := CreateUploadSet(nil, parent, "dir-other", "Scanner", nil, nil)
+		assert.Equal(t, ErrNotSubset, err)
+	})
+
+	t.Run("CanRevokeUpload", func(t *testing.T) {
+		child := &Permission{Type: TypeUpload, SourceID: parent.SourceID}
+		assert.True(t, parent.CanRevokeUpload(child))
+		assert.False(t, parent.CanRevokeDelegated(child))
+		other := &Permission{Type: TypeWebapp, SourceID: "io.cozy.apps/photos"}
+		assert.False(t, other.CanRevokeUpload(child))
+	})
+
+	t.Run("ExpiredPermission", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		future := time.Now().Add(time.Hour)
+		assert.NoError(t, (&Permission{Type: TypeUpload}).checkUploadToken())
+		assert.NoError(t, (&Permission{Type: TypeUpload, ExpiresAt: &future}).checkUploadToken())
+		assert.Equal(t, ErrExpiredToken, (&Permission{Type: TypeUpload, ExpiresAt: &past}).checkUploadToken())
+		assert.Equal(t, ErrInvalidToken, (&Permission{Type: TypeWebapp}).checkUploadToken())
+	})
+
+	t.Run("NoExpirationForTheToken", func(t *testing.T) {
+		claims := &Claims{}
+		claims.Audience = consts.UploadAudience
+		claims.IssuedAt = time.Now().Add(-365 * 24 * time.Hour).Unix()
+		assert.False(t, claims.Expired())
+	})
+}
+
 func assertEqualJSON(t *testing.T, value []byte, expected string) {
 	expectedBytes := new(bytes.Buffer)
 	err := json.Compact(expectedBytes, []byte(expected))
@@ -446,3 +537,107 @@ func (t *validableFile) Fetch(field string) []string {
 	}
 	return prefixes
 }
+
+func TestVerbsByDoctype(t *testing.T) {
+	s := Set{
+		Rule{Type: "io.cozy.contacts", Verbs: Verbs(GET)},
+		Rule{Type: "io.cozy.contacts", Verbs: Verbs(POST)},
+		Rule{Type: "io.cozy.files", Verbs: ALL},
+		Rule{Type: "io.cozy.files", Verbs: Verbs(GET)},
+	}
+	assert.Equal(t, map[string]string{
+		"io.cozy.contacts": "GET,POST",
+		"io.cozy.files":    "ALL",
+	}, s.VerbsByDoctype())
+}
+
+func TestRemoveDoctypes(t *testing.T) {
+	p := &Permission{Permissions: Set{
+		Rule{Type: "io.cozy.contacts", Verbs: Verbs(GET)},
+		Rule{Type: "io.cozy.files", Verbs: ALL},
+		Rule{Type: "io.cozy.contacts", Verbs: Verbs(POST)},
+	}}
+	assert.False(t, p.RemoveDoctypes("io.cozy.bank.operations"))
+	assert.Len(t, p.Permissions, 3)
+	assert.True(t, p.RemoveDoctypes("io.cozy.contacts"))
+	assert.Equal(t, Set{Rule{Type: "io.cozy.files", Verbs: ALL}}, p.Permissions)
+	assert.Equal(t, []string{"io.cozy.contacts"}, p.RevokedDoctypes)
+
+	// The revoked doctypes are not given back by an update of the app
+	set := Set{
+		Rule{Type: "io.cozy.contacts", Verbs: ALL},
+		Rule{Type: "io.cozy.files", Verbs: ALL},
+	}
+	assert.Equal(t, Set{Rule{Type: "io.cozy.files", Verbs: ALL}}, withoutDoctypes(set, p.RevokedDoctypes))
+}
+
+func TestCodeLimits(t *testing.T) {
+	now := time.Now()
+	later := now.Add(48 * time.Hour)
+	perm := &Permission{
+		Type:  TypeShareByLink,
+		Codes: map[string]string{"bob": "code-bob", "email": "code-email"},
+		ShortCodes: map[string]string{
+			"bob":   "short-bob",
+			"email": "short-email",
+		},
+		CodesLimits: map[string]*CodeLimits{
+			"bob": {NotBefore: &now, NotAfter: &later, MaxUses: 1},
+		},
+	}
+
+	t.Run("CodeName", func(t *testing.T) {
+		assert.Equal(t, "bob", perm.CodeName("code-bob"))
+		assert.Equal(t, "", perm.CodeName("unknown"))
+	})
+
+	t.Run("ValidityWindow", func(t *testing.T) {
+		assert.NoError(t, perm.checkCodeLimits("code-bob", now.Add(time.Hour)))
+		assert.Equal(t, ErrCodeNotYetValid, perm.checkCodeLimits("code-bob", now.Add(-time.Hour)))
+		assert.Equal(t, ErrExpiredToken, perm.checkCodeLimits("code-bob", later.Add(time.Hour)))
+		assert.NoError(t, perm.checkCodeLimits("code-email", later.Add(time.Hour)))
+	})
+
+	t.Run("MaxUses", func(t *testing.T) {
+		limits := perm.CodesLimits["bob"]
+		assert.False(t, limits.UsedUp())
+		usedAt := now.Add(time.Hour)
+		limits.Uses = 1
+		limits.LastUsedAt = &usedAt
+		assert.True(t, limits.UsedUp())
+		// The viewer can still load the documents just after opening the link
+		assert.NoError(t, perm.checkCodeLimits("code-bob", usedAt.Add(time.Minute)))
+		assert.Equal(t, ErrCodeUsedUp, perm.checkCodeLimits("code-bob", usedAt.Add(2*CodeUseDuration)))
+
+		// A request made with the code outside of the window of the last use
+		// counts as a new use
+		assert.False(t, limits.needsUse(usedAt.Add(time.Minute)))
+		assert.True(t, limits.needsUse(usedAt.Add(2*CodeUseDuration)))
+		assert.True(t, (&CodeLimits{MaxUses: 3}).needsUse(now))
+		assert.False(t, (&CodeLimits{}).needsUse(now))
+	})
+
+	t.Run("RegenerateCode", func(t *testing.T) {
+		cloned := perm.Clone().(*Permission)
+		cloned.RegenerateCode("bob", "new-code-bob", "new-short-bob")
+		assert.Equal(t, "new-code-bob", cloned.Codes["bob"])
+		assert.Equal(t, "new-short-bob", cloned.ShortCodes["bob"])
+		limits := cloned.CodesLimits["bob"]
+		assert.Equal(t, 0, limits.Uses)
+		assert.Nil(t, limits.LastUsedAt)
+		assert.Equal(t, 1, limits.Regenerations)
+		assert.NotNil(t, limits.RegeneratedAt)
+		assert.Equal(t, 1, limits.MaxUses)
+		// The original permission is not modified
+		assert.Equal(t, 1, perm.CodesLimits["bob"].Uses)
+
+		cloned.RegenerateCode("email", "new-code-email", "new-short-email")
+		assert.Equal(t, 1, cloned.CodesLimits["email"].Regenerations)
+	})
+
+	t.Run("PatchCodes", func(t *testing.T) {
+		cloned := perm.Clone().(*Permission)
+		cloned.PatchCodes(map[string]string{"email": "code-email"})
+		assert.NotContains(t, cloned.CodesLimits, "bob")
+	})
+}
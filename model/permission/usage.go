@@ -0,0 +1,190 @@
+package permission
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// usageUpdatePeriod is the minimal duration between two updates of the date
+// of the last use of the permissions for an app or client, to avoid writing
+// in CouchDB on every request.
+const usageUpdatePeriod = 1 * time.Hour
+
+// Usage is a document with the date of the last use of the permissions of an
+// app, konnector, or OAuth client. Its identifier is the source ID of the
+// permissions (like io.cozy.apps/drive, or the ID of the OAuth client).
+type Usage struct {
+	DocID  string `json:"_id,omitempty"`
+	DocRev string `json:"_rev,omitempty"`
+	Type   string `json:"type"`
+	// Permissions is the scope of the last token used by an OAuth client (the
+	// permissions of the apps and konnectors are in their permission docs)
+	Permissions Set       `json:"permissions,omitempty"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+}
+
+// ID implements the couchdb.Doc interface
+func (u *Usage) ID() string { return u.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (u *Usage) Rev() string { return u.DocRev }
+
+// DocType implements the couchdb.Doc interface
+func (u *Usage) DocType() string { return consts.PermissionsUsage }
+
+// SetID implements the couchdb.Doc interface
+func (u *Usage) SetID(id string) { u.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (u *Usage) SetRev(rev string) { u.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (u *Usage) Clone() couchdb.Doc {
+	cloned := *u
+	cloned.Permissions = make(Set, len(u.Permissions))
+	copy(cloned.Permissions, u.Permissions)
+	return &cloned
+}
+
+// TrackUsage records that the permissions of an app, konnector or OAuth
+// client have been used. The date is updated at most once per hour for each
+// of them.
+func TrackUsage(db prefixer.Prefixer, p *Permission) error {
+	if p.Type != TypeWebapp && p.Type != TypeKonnector && p.Type != TypeOauth {
+		return nil
+	}
+	if p.SourceID == "" {
+		return nil
+	}
+	cache := config.GetConfig().CacheStorage
+	key := "permissions-usage:" + db.DBPrefix() + ":" + p.SourceID
+	if _, ok := cache.Get(key); ok {
+		return nil
+	}
+	cache.Set(key, []byte("1"), usageUpdatePeriod)
+
+	usage := &Usage{}
+	err := couchdb.GetDoc(db, consts.PermissionsUsage, p.SourceID, usage)
+	if err != nil && !couchdb.IsNotFoundError(err) && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+	exists := err == nil
+	usage.DocID = p.SourceID
+	usage.Type = p.Type
+	usage.LastUsedAt = time.Now().UTC()
+	if p.Type == TypeOauth {
+		usage.Permissions = p.Permissions
+	}
+	if exists {
+		return couchdb.UpdateDoc(db, usage)
+	}
+	return couchdb.CreateNamedDocWithDB(db, usage)
+}
+
+// GetUsages returns the usages of the permissions, indexed by their source
+// ID.
+func GetUsages(db prefixer.Prefixer) (map[string]*Usage, error) {
+	var usages []*Usage
+	req := &couchdb.AllDocsRequest{Limit: 10000}
+	err := couchdb.GetAllDocs(db, consts.PermissionsUsage, req, &usages)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	byID := make(map[string]*Usage, len(usages))
+	for _, usage := range usages {
+		byID[usage.DocID] = usage
+	}
+	return byID, nil
+}
+
+// DeleteUsage removes the usage of the permissions with the given source ID,
+// for example when an OAuth client is revoked.
+func DeleteUsage(db prefixer.Prefixer, sourceID string) error {
+	usage := &Usage{}
+	err := couchdb.GetDoc(db, consts.PermissionsUsage, sourceID, usage)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return couchdb.DeleteDoc(db, usage)
+}
+
+// VerbsByDoctype returns the verbs allowed by the set for each doctype, like
+// "GET,POST" or "ALL".
+func (s Set) VerbsByDoctype() map[string]string {
+	verbs := make(map[string]VerbSet)
+	for _, rule := range s {
+		if existing, ok := verbs[rule.Type]; ok {
+			if len(existing) == 0 {
+				continue
+			}
+			if len(rule.Verbs) == 0 {
+				verbs[rule.Type] = ALL
+				continue
+			}
+			merged := make(VerbSet, len(existing))
+			merged.Merge(&existing)
+			merged.Merge(&rule.Verbs)
+			verbs[rule.Type] = merged
+		} else {
+			verbs[rule.Type] = rule.Verbs
+		}
+	}
+	out := make(map[string]string, len(verbs))
+	for doctype, vs := range verbs {
+		out[doctype] = vs.String()
+	}
+	return out
+}
+
+// RemoveDoctypes removes the rules for the given doctypes from the permission
+// doc, and keeps them as revoked, so that they are not given back when the
+// app is updated. It returns true if some rules have been removed.
+func (p *Permission) RemoveDoctypes(doctypes ...string) bool {
+	newperms := withoutDoctypes(p.Permissions, doctypes)
+	if len(newperms) == len(p.Permissions) {
+		return false
+	}
+	p.Permissions = newperms
+	for _, doctype := range doctypes {
+		found := false
+		for _, revoked := range p.RevokedDoctypes {
+			if revoked == doctype {
+				found = true
+			}
+		}
+		if !found {
+			p.RevokedDoctypes = append(p.RevokedDoctypes, doctype)
+		}
+	}
+	return true
+}
+
+// withoutDoctypes returns the rules of the set that are not for the given
+// doctypes.
+func withoutDoctypes(set Set, doctypes []string) Set {
+	if len(doctypes) == 0 {
+		return set
+	}
+	newperms := make(Set, 0, len(set))
+	for _, r := range set {
+		found := false
+		for _, doctype := range doctypes {
+			if r.Type == doctype {
+				found = true
+			}
+		}
+		if !found {
+			newperms = append(newperms, r)
+		}
+	}
+	return newperms
+}
+
+var _ couchdb.Doc = &Usage{}
@@ -0,0 +1,225 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/limits"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrMissingCredentials is used when a remote doctype needs some credentials,
+// but they are not configured for the context of the instance.
+var ErrMissingCredentials = errors.New("the credentials for the remote doctype are not configured")
+
+const (
+	// AuthOAuth2 is used for a remote doctype that obtains an access token
+	// with the OAuth2 client credentials grant.
+	AuthOAuth2 = "oauth2"
+	// AuthAPIKey is used for a remote doctype that sends an API key in a
+	// header or in the query-string.
+	AuthAPIKey = "api_key"
+)
+
+// authDirective is how the remote website authenticates the requests, as
+// declared by the @auth directive. The credentials are not in the request
+// definition, but in the configuration of the context.
+type authDirective struct {
+	kind string
+	// in and param are used for an API key: in is header or query, and param
+	// is the name of the header or of the query parameter
+	in    string
+	param string
+}
+
+func parseAuthDirective(args []string) (*authDirective, error) {
+	if len(args) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	switch args[0] {
+	case AuthOAuth2:
+		if len(args) != 1 {
+			return nil, ErrInvalidRequest
+		}
+		return &authDirective{kind: AuthOAuth2}, nil
+	case AuthAPIKey:
+		if len(args) != 3 || (args[1] != "header" && args[1] != "query") {
+			return nil, ErrInvalidRequest
+		}
+		return &authDirective{kind: AuthAPIKey, in: args[1], param: args[2]}, nil
+	}
+	return nil, ErrInvalidRequest
+}
+
+// contextSettings returns the parameters of the context of the instance for
+// the remote doctype, in the remote_doctypes section.
+func contextSettings(inst *instance.Instance, doctype string) map[string]interface{} {
+	ctxSettings, ok := inst.SettingsContext()
+	if !ok {
+		return nil
+	}
+	doctypes, ok := ctxSettings["remote_doctypes"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	settings, _ := doctypes[doctype].(map[string]interface{})
+	return settings
+}
+
+func settingString(settings map[string]interface{}, key string) string {
+	val, _ := settings[key].(string)
+	return val
+}
+
+// rateLimit returns the maximal number of requests per minute for the remote
+// doctype, from the @rate_limit directive, or from the context if it is
+// overridden. 0 means that there is no limit.
+func (remote *Remote) rateLimit(settings map[string]interface{}) int64 {
+	switch limit := settings["rate_limit"].(type) {
+	case int:
+		return int64(limit)
+	case float64:
+		return int64(limit)
+	case string:
+		if n, err := strconv.ParseInt(limit, 10, 64); err == nil {
+			return n
+		}
+	}
+	return remote.rateLimitPerMinute
+}
+
+// checkRateLimit returns an error if the requests to the remote website have
+// exceeded the limit. The counter is shared by the instances of a context, as
+// they share the credentials.
+func (remote *Remote) checkRateLimit(inst *instance.Instance, settings map[string]interface{}) error {
+	limit := remote.rateLimit(settings)
+	if limit <= 0 {
+		return nil
+	}
+	key := remote.Doctype + ":" + inst.ContextName
+	_, err := config.GetRateLimiter().CheckRateLimitKeyWithLimit(key, limits.RemoteDoctypeType, limit)
+	if err != nil {
+		log.Infof("Rate limit exceeded for remote doctype %s: %s", remote.Doctype, err)
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// authenticate adds the credentials to the request.
+func (remote *Remote) authenticate(inst *instance.Instance, settings map[string]interface{}, req *http.Request) error {
+	if remote.auth == nil {
+		return nil
+	}
+	switch remote.auth.kind {
+	case AuthAPIKey:
+		key := settingString(settings, "api_key")
+		if key == "" {
+			return ErrMissingCredentials
+		}
+		if remote.auth.in == "header" {
+			req.Header.Set(remote.auth.param, key)
+		} else {
+			query := req.URL.Query()
+			query.Set(remote.auth.param, key)
+			req.URL.RawQuery = query.Encode()
+		}
+	case AuthOAuth2:
+		token, err := tokens.get(inst.ContextName, remote.Doctype, settings)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	return nil
+}
+
+// tokenCache keeps the access tokens obtained with the client credentials
+// grant, per context and remote doctype, until they expire.
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+var tokens = &tokenCache{tokens: make(map[string]cachedToken)}
+
+// tokenExpirationMargin is used to renew a token a bit before its expiration,
+// to take into account the duration of the request.
+const tokenExpirationMargin = 30 * time.Second
+
+func (c *tokenCache) get(contextName, doctype string, settings map[string]interface{}) (string, error) {
+	tokenURL := settingString(settings, "token_url")
+	clientID := settingString(settings, "client_id")
+	clientSecret := settingString(settings, "client_secret")
+	if tokenURL == "" || clientID == "" || clientSecret == "" {
+		return "", ErrMissingCredentials
+	}
+
+	key := contextName + "/" + doctype
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.tokens[key]; ok && time.Now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	token, expiresIn, err := fetchClientCredentialsToken(tokenURL, clientID, clientSecret, settingString(settings, "scope"))
+	if err != nil {
+		log.Infof("Cannot get an access token for remote doctype %s: %s", doctype, err)
+		return "", ErrRequestFailed
+	}
+	if expiresIn > tokenExpirationMargin {
+		c.tokens[key] = cachedToken{
+			value:     token,
+			expiresAt: time.Now().Add(expiresIn - tokenExpirationMargin),
+		}
+	}
+	return token, nil
+}
+
+// fetchClientCredentialsToken asks an access token to the authorization server
+// with the client credentials grant (RFC 6749, section 4.4).
+func fetchClientCredentialsToken(tokenURL, clientID, clientSecret, scope string) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	res, err := remoteClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", 0, err
+	}
+	if body.AccessToken == "" {
+		return "", 0, errors.New("no access token in the response")
+	}
+	return body.AccessToken, time.Duration(body.ExpiresIn) * time.Second, nil
+}
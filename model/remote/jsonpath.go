@@ -0,0 +1,178 @@
+package remote
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidJSONPath is used when a JSONPath expression of a remote doctype
+// cannot be parsed.
+var ErrInvalidJSONPath = errors.New("the JSONPath expression is not valid")
+
+// jsonPathStep is a step of a JSONPath expression: a member of an object, an
+// element of an array, or all the members/elements with the wildcard.
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// jsonPath is a compiled JSONPath expression. Only a subset of JSONPath is
+// supported: $, .name, ['name'], [n], [*] and .* (no filters, slices, or
+// recursive descent).
+type jsonPath struct {
+	raw   string
+	steps []jsonPathStep
+}
+
+// fieldMapping maps the result of a JSONPath expression to a field of the
+// transformed documents.
+type fieldMapping struct {
+	name string
+	path *jsonPath
+}
+
+func compileJSONPath(raw string) (*jsonPath, error) {
+	if !strings.HasPrefix(raw, "$") {
+		return nil, ErrInvalidJSONPath
+	}
+	p := &jsonPath{raw: raw}
+	rest := raw[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			if name == "" {
+				return nil, ErrInvalidJSONPath
+			}
+			if name == "*" {
+				p.steps = append(p.steps, jsonPathStep{wildcard: true})
+			} else {
+				p.steps = append(p.steps, jsonPathStep{name: name})
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, ErrInvalidJSONPath
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				p.steps = append(p.steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p.steps = append(p.steps, jsonPathStep{name: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, ErrInvalidJSONPath
+				}
+				p.steps = append(p.steps, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, ErrInvalidJSONPath
+		}
+	}
+	return p, nil
+}
+
+// multiple returns true if the expression can select several values.
+func (p *jsonPath) multiple() bool {
+	for _, step := range p.steps {
+		if step.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// eval returns the values selected by the expression in the document.
+func (p *jsonPath) eval(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, val := range current {
+			switch v := val.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					keys := make([]string, 0, len(v))
+					for key := range v {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, v[key])
+					}
+				} else if member, ok := v[step.name]; ok && !step.isIndex {
+					next = append(next, member)
+				}
+			case []interface{}:
+				if step.wildcard {
+					next = append(next, v...)
+				} else if step.isIndex {
+					index := step.index
+					if index < 0 {
+						index += len(v)
+					}
+					if index >= 0 && index < len(v) {
+						next = append(next, v[index])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// evalOne returns the value selected by the expression, a list of values if
+// the expression has a wildcard, or nil if there is no match.
+func (p *jsonPath) evalOne(doc interface{}) interface{} {
+	values := p.eval(doc)
+	if p.multiple() {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// transformResponse applies the @select and @field directives of the remote
+// doctype to the JSON response of the remote website.
+func (remote *Remote) transformResponse(doc interface{}) interface{} {
+	if remote.selectPath != nil {
+		doc = remote.selectPath.evalOne(doc)
+	}
+	if len(remote.fields) == 0 {
+		return doc
+	}
+	if items, ok := doc.([]interface{}); ok && remote.selectPath != nil && remote.selectPath.multiple() {
+		mapped := make([]interface{}, len(items))
+		for i, item := range items {
+			mapped[i] = remote.mapFields(item)
+		}
+		return mapped
+	}
+	return remote.mapFields(doc)
+}
+
+func (remote *Remote) mapFields(item interface{}) map[string]interface{} {
+	mapped := make(map[string]interface{}, len(remote.fields))
+	for _, field := range remote.fields {
+		mapped[field.name] = field.path.evalOne(item)
+	}
+	return mapped
+}
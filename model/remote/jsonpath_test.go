@@ -0,0 +1,71 @@
+package remote
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const forecast = `{
+  "city": {"name": "Paris"},
+  "list": [
+    {"dt": 1, "main": {"temp": 12.5}, "weather": [{"description": "rain"}]},
+    {"dt": 2, "main": {"temp": 14}, "weather": [{"description": "clouds"}]}
+  ]
+}`
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(forecast), &doc))
+
+	t.Run("Compile", func(t *testing.T) {
+		for _, raw := range []string{"list", "$.", "$..list", "$[0", "$[abc]", "$list"} {
+			_, err := compileJSONPath(raw)
+			assert.Equal(t, ErrInvalidJSONPath, err, raw)
+		}
+	})
+
+	t.Run("Eval", func(t *testing.T) {
+		cases := map[string]interface{}{
+			"$":                                doc,
+			"$.city.name":                      "Paris",
+			"$['city']['name']":                "Paris",
+			"$.list[1].dt":                     2.0,
+			"$.list[-1].dt":                    2.0,
+			"$.list[2].dt":                     nil,
+			"$.missing":                        nil,
+			"$.list[*].dt":                     []interface{}{1.0, 2.0},
+			"$.list[*].weather[0].description": []interface{}{"rain", "clouds"},
+			"$.city.*":                         []interface{}{"Paris"},
+			"$.nothing[*]":                     []interface{}{},
+		}
+		for raw, expected := range cases {
+			p, err := compileJSONPath(raw)
+			require.NoError(t, err, raw)
+			assert.Equal(t, expected, p.evalOne(doc), raw)
+		}
+	})
+
+	t.Run("Transform", func(t *testing.T) {
+		r := &Remote{}
+		r.selectPath, _ = compileJSONPath("$.list[*]")
+		temp, _ := compileJSONPath("$.main.temp")
+		weather, _ := compileJSONPath("$.weather[0].description")
+		r.fields = []fieldMapping{{name: "temperature", path: temp}, {name: "weather", path: weather}}
+		expected := []interface{}{
+			map[string]interface{}{"temperature": 12.5, "weather": "rain"},
+			map[string]interface{}{"temperature": 14.0, "weather": "clouds"},
+		}
+		assert.Equal(t, expected, r.transformResponse(doc))
+
+		r.selectPath, _ = compileJSONPath("$.list[0]")
+		expectedOne := map[string]interface{}{"temperature": 12.5, "weather": "rain"}
+		assert.Equal(t, expectedOne, r.transformResponse(doc))
+
+		r.selectPath, _ = compileJSONPath("$.city")
+		r.fields = nil
+		assert.Equal(t, map[string]interface{}{"name": "Paris"}, r.transformResponse(doc))
+	})
+}
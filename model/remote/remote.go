@@ -13,6 +13,7 @@ import (
 	"path"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -48,6 +49,9 @@ var (
 	// ErrRemoteAssetNotFound is used when the wanted remote asset is not part of
 	// our defined list.
 	ErrRemoteAssetNotFound = errors.New("wanted remote asset is not part of our asset list")
+	// ErrRateLimited is used when too many requests have been made to the
+	// remote website
+	ErrRateLimited = errors.New("too many requests for the remote doctype")
 )
 
 const rawURL = "https://raw.githubusercontent.com/cozy/cozy-doctypes/master/%s/request"
@@ -137,13 +141,20 @@ type Remote struct {
 	URL     *url.URL
 	Headers map[string]string
 	Body    string
+
+	// The fields below are set by the directives, in the lines starting with
+	// @ after the first line
+	auth               *authDirective
+	rateLimitPerMinute int64
+	selectPath         *jsonPath
+	fields             []fieldMapping
 }
 
 var log = logger.WithNamespace("remote")
 
 // ParseRawRequest takes a string and parse it as a remote struct.
 // First line is verb and URL.
-// Then, we have the headers.
+// Then, we have the headers and the directives (lines starting with @).
 // And for a POST, we have a blank line, and then the body.
 func ParseRawRequest(doctype, raw string) (*Remote, error) {
 	lines := strings.Split(raw, "\n")
@@ -177,6 +188,13 @@ func ParseRawRequest(doctype, raw string) (*Remote, error) {
 			remote.Body = strings.Join(lines[i+2:], "\n")
 			break
 		}
+		if strings.HasPrefix(line, "@") {
+			if err := remote.parseDirective(line); err != nil {
+				log.Infof("Invalid directive for remote doctype %s: %s", doctype, line)
+				return nil, err
+			}
+			continue
+		}
 		parts = strings.SplitN(line, ":", 2)
 		if len(parts) != 2 {
 			log.Infof("Invalid header for remote doctype %s: %s", doctype, line)
@@ -187,6 +205,52 @@ func ParseRawRequest(doctype, raw string) (*Remote, error) {
 	return &remote, nil
 }
 
+// parseDirective parses a line with a directive:
+//   - @auth oauth2 | @auth api_key header|query <name>
+//   - @rate_limit <requests per minute>
+//   - @select <JSONPath>
+//   - @field <name> <JSONPath>
+func (remote *Remote) parseDirective(line string) error {
+	args := strings.Fields(line)
+	var err error
+	switch args[0] {
+	case "@auth":
+		remote.auth, err = parseAuthDirective(args[1:])
+	case "@rate_limit":
+		if len(args) != 2 {
+			return ErrInvalidRequest
+		}
+		remote.rateLimitPerMinute, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || remote.rateLimitPerMinute < 0 {
+			return ErrInvalidRequest
+		}
+	case "@select":
+		if len(args) != 2 {
+			return ErrInvalidRequest
+		}
+		remote.selectPath, err = compileJSONPath(args[1])
+	case "@field":
+		if len(args) != 3 {
+			return ErrInvalidRequest
+		}
+		var path *jsonPath
+		path, err = compileJSONPath(args[2])
+		remote.fields = append(remote.fields, fieldMapping{name: args[1], path: path})
+	default:
+		return ErrInvalidRequest
+	}
+	if err != nil {
+		return ErrInvalidRequest
+	}
+	return nil
+}
+
+// hasTransformation returns true if the JSON response must be transformed
+// before being sent to the client.
+func (remote *Remote) hasTransformation() bool {
+	return remote.selectPath != nil || len(remote.fields) > 0
+}
+
 func lockDoctype(inst *instance.Instance, docID string) func() {
 	mu := config.Lock().ReadWrite(inst, docID)
 	_ = mu.Lock()
@@ -389,6 +453,11 @@ func (remote *Remote) ProxyTo(
 	remote.URL.User = nil
 	remote.URL.Fragment = ""
 
+	settings := contextSettings(ins, remote.Doctype)
+	if err = remote.checkRateLimit(ins, settings); err != nil {
+		return err
+	}
+
 	var body io.Reader
 	if remote.Verb != "GET" && remote.Verb != "DELETE" {
 		body = strings.NewReader(remote.Body)
@@ -402,6 +471,10 @@ func (remote *Remote) ProxyTo(
 	for k, v := range remote.Headers {
 		req.Header.Set(k, v)
 	}
+	// The credentials are added after the URL has been kept for the logs
+	if err = remote.authenticate(ins, settings, req); err != nil {
+		return err
+	}
 
 	res, err := remoteClient.Do(req)
 	if err != nil {
@@ -445,6 +518,11 @@ func (remote *Remote) ProxyTo(
 	}
 	log.Debugf("Remote request: %#v\n", logged)
 
+	if remote.hasTransformation() && res.StatusCode/100 == 2 &&
+		(ctype == "application/json" || ctype == "application/vnd.api+json") {
+		return remote.writeTransformed(rw, res)
+	}
+
 	copyHeader(rw.Header(), res.Header)
 	rw.WriteHeader(res.StatusCode)
 	_, err = io.Copy(rw, res.Body)
@@ -454,6 +532,24 @@ func (remote *Remote) ProxyTo(
 	return nil
 }
 
+// writeTransformed sends to the client the JSON response of the remote
+// website, transformed with the @select and @field directives.
+func (remote *Remote) writeTransformed(rw http.ResponseWriter, res *http.Response) error {
+	var doc interface{}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		log.Infof("Invalid JSON in the response from %s: %s", remote.URL.String(), err)
+		return ErrRequestFailed
+	}
+	transformed, err := json.Marshal(remote.transformResponse(doc))
+	if err != nil {
+		return err
+	}
+	rw.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rw.WriteHeader(res.StatusCode)
+	_, err = rw.Write(transformed)
+	return err
+}
+
 // ProxyRemoteAsset proxy the given http request to fetch an asset from our
 // list of available asset list.
 func ProxyRemoteAsset(name string, w http.ResponseWriter) error {
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
@@ -176,3 +177,93 @@ Authorization: Bearer {{secret_token}}
 	assert.NoError(t, err)
 	assert.Equal(t, "Bearer 123456789", r.Headers["Authorization"])
 }
+
+func TestParseDirectives(t *testing.T) {
+	config.UseTestFile(t)
+
+	raw := `GET https://api.example.org/forecast?city={{city}}
+Accept: application/json
+@auth api_key query appid
+@rate_limit 60
+@select $.list[*]
+@field temperature $.main.temp
+@field weather $.weather[0].description`
+	r, err := ParseRawRequest(doctype, raw)
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", r.Headers["Accept"])
+	assert.Len(t, r.Headers, 1)
+	require.NotNil(t, r.auth)
+	assert.Equal(t, AuthAPIKey, r.auth.kind)
+	assert.Equal(t, "query", r.auth.in)
+	assert.Equal(t, "appid", r.auth.param)
+	assert.EqualValues(t, 60, r.rateLimitPerMinute)
+	require.NotNil(t, r.selectPath)
+	assert.Len(t, r.fields, 2)
+
+	raw = `GET https://api.example.org/
+@auth oauth2`
+	r, err = ParseRawRequest(doctype, raw)
+	require.NoError(t, err)
+	assert.Equal(t, AuthOAuth2, r.auth.kind)
+
+	for _, directive := range []string{
+		"@auth",
+		"@auth basic",
+		"@auth api_key cookie key",
+		"@rate_limit many",
+		"@select list",
+		"@field name",
+		"@unknown",
+	} {
+		_, err = ParseRawRequest(doctype, "GET https://api.example.org/\n"+directive)
+		assert.Equal(t, ErrInvalidRequest, err, directive)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	config.UseTestFile(t)
+
+	r := &Remote{
+		Doctype: doctype,
+		auth:    &authDirective{kind: AuthAPIKey, in: "query", param: "appid"},
+	}
+	req, err := http.NewRequest("GET", "https://api.example.org/?city=Paris", nil)
+	require.NoError(t, err)
+	settings := map[string]interface{}{"api_key": "s3cr3t"}
+	require.NoError(t, r.authenticate(nil, settings, req))
+	assert.Equal(t, "s3cr3t", req.URL.Query().Get("appid"))
+	assert.Equal(t, "Paris", req.URL.Query().Get("city"))
+
+	r.auth = &authDirective{kind: AuthAPIKey, in: "header", param: "X-Api-Key"}
+	require.NoError(t, r.authenticate(nil, settings, req))
+	assert.Equal(t, "s3cr3t", req.Header.Get("X-Api-Key"))
+
+	err = r.authenticate(nil, nil, req)
+	assert.Equal(t, ErrMissingCredentials, err)
+
+	assert.EqualValues(t, 0, r.rateLimit(nil))
+	r.rateLimitPerMinute = 10
+	assert.EqualValues(t, 10, r.rateLimit(nil))
+	assert.EqualValues(t, 5, r.rateLimit(map[string]interface{}{"rate_limit": 5}))
+}
+
+func TestFetchClientCredentialsToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "cozy" || secret != "s3cr3t" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"abc","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	token, expiresIn, err := fetchClientCredentialsToken(ts.URL, "cozy", "s3cr3t", "read")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", token)
+	assert.Equal(t, 3600*time.Second, expiresIn)
+
+	_, _, err = fetchClientCredentialsToken(ts.URL, "cozy", "wrong", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,340 @@
+// Package schema is a registry of the schema versions of the doctypes, with
+// the functions that migrate a document from a version to the next one. The
+// data API uses it to upgrade the old documents in memory when they are read,
+// so that the apps only see the last shape of the documents, and a job of the
+// migrations worker persists the upgrades.
+//
+// The version of a document is stored in its cozyMetadata.doctypeVersion
+// field. A document without this field is considered to be in version 1.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// MigrateFunc is a function that migrates a document to the next version of
+// its doctype. It modifies the document in place.
+type MigrateFunc func(doc map[string]interface{}) error
+
+type migration struct {
+	version int
+	fn      MigrateFunc
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string][]migration)
+)
+
+// scheduleDelay is the minimal delay between two jobs pushed for the upgrade
+// of the documents of a doctype on an instance.
+const scheduleDelay = 1 * time.Hour
+
+// Register declares that the documents of the doctype can be migrated to the
+// given version with the given function. The version must be at least 2, as
+// the documents without a version are in version 1.
+func Register(doctype string, version int, fn MigrateFunc) {
+	if version < 2 {
+		panic(fmt.Sprintf("schema: invalid version %d for %s", version, doctype))
+	}
+	if hasVersion(doctype, version) {
+		panic(fmt.Sprintf("schema: version %d already registered for %s", version, doctype))
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	migrations := append(registry[doctype], migration{version: version, fn: fn})
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	registry[doctype] = migrations
+}
+
+// RegisterFromConfig registers the migrations declared in the config file.
+// They are checked before any of them is registered.
+func RegisterFromConfig(migrations []config.SchemaMigration) error {
+	fns := make([]MigrateFunc, len(migrations))
+	seen := make(map[string]bool)
+	for i, m := range migrations {
+		if m.Doctype == "" || m.Version < 2 {
+			return fmt.Errorf("schema: invalid version %d for %q", m.Version, m.Doctype)
+		}
+		key := m.Doctype + "/" + strconv.Itoa(m.Version)
+		if seen[key] || hasVersion(m.Doctype, m.Version) {
+			return fmt.Errorf("schema: version %d already registered for %s", m.Version, m.Doctype)
+		}
+		seen[key] = true
+		fn, err := declarativeMigration(m)
+		if err != nil {
+			return err
+		}
+		fns[i] = fn
+	}
+	for i, m := range migrations {
+		Register(m.Doctype, m.Version, fns[i])
+	}
+	return nil
+}
+
+func hasVersion(doctype string, version int) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, m := range registry[doctype] {
+		if m.version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// declarativeMigration returns the function for a migration declared in the
+// config file: the fields are renamed (unless the new field already exists),
+// and then removed.
+func declarativeMigration(m config.SchemaMigration) (MigrateFunc, error) {
+	renames := make([][2]string, 0, len(m.Rename))
+	for _, rename := range m.Rename {
+		parts := strings.SplitN(rename, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("schema: invalid rename %q for %s", rename, m.Doctype)
+		}
+		renames = append(renames, [2]string{parts[0], parts[1]})
+	}
+	remove := m.Remove
+	return func(doc map[string]interface{}) error {
+		for _, r := range renames {
+			if v, ok := doc[r[0]]; ok {
+				if _, exists := doc[r[1]]; !exists {
+					doc[r[1]] = v
+				}
+				delete(doc, r[0])
+			}
+		}
+		for _, field := range remove {
+			delete(doc, field)
+		}
+		return nil
+	}, nil
+}
+
+// LatestVersion returns the last version of the doctype, or 0 if no migration
+// has been registered for it.
+func LatestVersion(doctype string) int {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	migrations := registry[doctype]
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// Version returns the schema version of the document.
+func Version(doc map[string]interface{}) int {
+	md, _ := doc["cozyMetadata"].(map[string]interface{})
+	switch v := md["doctypeVersion"].(type) {
+	case string:
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	case float64:
+		if v > 0 {
+			return int(v)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil && n > 0 {
+			return int(n)
+		}
+	case int:
+		if v > 0 {
+			return v
+		}
+	}
+	return 1
+}
+
+func setVersion(doc map[string]interface{}, version int) {
+	md, ok := doc["cozyMetadata"].(map[string]interface{})
+	if !ok {
+		md = make(map[string]interface{})
+		doc["cozyMetadata"] = md
+	}
+	md["doctypeVersion"] = strconv.Itoa(version)
+}
+
+// Migrate applies the migrations to the document, in memory, to bring it to
+// the last version of its doctype. It returns true if the document has been
+// modified. On error, the document is left unchanged.
+func Migrate(doctype string, doc map[string]interface{}) (bool, error) {
+	registryMu.RLock()
+	migrations := registry[doctype]
+	registryMu.RUnlock()
+
+	current := Version(doc)
+	if len(migrations) == 0 || migrations[len(migrations)-1].version <= current {
+		return false, nil
+	}
+
+	upgraded := (&couchdb.JSONDoc{M: doc}).Clone().(*couchdb.JSONDoc).M
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := m.fn(upgraded); err != nil {
+			return false, fmt.Errorf("cannot migrate to version %d: %w", m.version, err)
+		}
+		current = m.version
+		setVersion(upgraded, current)
+	}
+	for k := range doc {
+		delete(doc, k)
+	}
+	for k, v := range upgraded {
+		doc[k] = v
+	}
+	return true, nil
+}
+
+// ScheduleUpgrade pushes a job to the migrations worker for persisting the
+// upgrade of the documents of the doctype. It is called when an old document
+// has been read, and the job is pushed at most once per scheduleDelay.
+func ScheduleUpgrade(inst *instance.Instance, doctype string) {
+	key := "schema-upgrade:" + inst.Domain + ":" + doctype
+	if !config.GetConfig().CacheStorage.SetNX(key, []byte("1"), scheduleDelay) {
+		return
+	}
+	msg, err := job.NewMessage(map[string]interface{}{
+		"type":    "doctype-schema",
+		"doctype": doctype,
+	})
+	if err == nil {
+		_, err = job.System().PushJob(inst, &job.JobRequest{
+			WorkerType: "migrations",
+			Message:    msg,
+		})
+	}
+	if err != nil {
+		inst.Logger().WithNamespace("schema").
+			Warnf("Cannot push a job for the upgrade of %s: %s", doctype, err)
+	}
+}
+
+// UpgradeAll migrates all the documents of the doctype to its last version,
+// persists them, and records the progress of the migration. A document that
+// cannot be migrated, or that has been modified in the meantime, is skipped,
+// and it will be upgraded by a next job. It returns the number of documents
+// that have been upgraded.
+func UpgradeAll(inst *instance.Instance, doctype string) (int, error) {
+	latest := LatestVersion(doctype)
+	if latest == 0 {
+		return 0, nil
+	}
+	log := inst.Logger().WithNamespace("schema")
+
+	upgraded, upToDate := 0, 0
+	err := couchdb.ForeachDocs(inst, doctype, func(id string, raw json.RawMessage) error {
+		doc := &couchdb.JSONDoc{Type: doctype}
+		if err := json.Unmarshal(raw, &doc.M); err != nil {
+			return err
+		}
+		if Version(doc.M) >= latest {
+			upToDate++
+			return nil
+		}
+		old := doc.Clone().(*couchdb.JSONDoc)
+		if _, err := Migrate(doctype, doc.M); err != nil {
+			log.Warnf("Cannot migrate %s %s: %s", doctype, id, err)
+			return nil
+		}
+		if err := couchdb.UpdateDocWithOld(inst, doc, old); err != nil {
+			if couchdb.IsConflictError(err) {
+				return nil
+			}
+			return err
+		}
+		upgraded++
+		upToDate++
+		return nil
+	})
+	if couchdb.IsNoDatabaseError(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return upgraded, err
+	}
+	return upgraded, saveProgress(inst, doctype, latest, upToDate)
+}
+
+// Progress is a document with the progress of the migration of the documents
+// of a doctype to a version, on an instance.
+type Progress struct {
+	DocID          string    `json:"_id,omitempty"`
+	DocRev         string    `json:"_rev,omitempty"`
+	Version        int       `json:"version"`
+	Upgraded       int       `json:"upgraded"`
+	LastUpgradedAt time.Time `json:"last_upgraded_at,omitempty"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (p *Progress) ID() string { return p.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (p *Progress) Rev() string { return p.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (p *Progress) DocType() string { return consts.DoctypesMigrations }
+
+// Clone implements couchdb.Doc
+func (p *Progress) Clone() couchdb.Doc {
+	cloned := *p
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (p *Progress) SetID(id string) { p.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (p *Progress) SetRev(rev string) { p.DocRev = rev }
+
+// GetProgress returns the progress of the migration of the documents of the
+// given doctype. The identifier of the progress document is the doctype.
+func GetProgress(db prefixer.Prefixer, doctype string) (*Progress, error) {
+	var progress Progress
+	err := couchdb.GetDoc(db, consts.DoctypesMigrations, doctype, &progress)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return &Progress{DocID: doctype}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// saveProgress records the number of documents of the doctype that are in
+// the given version.
+func saveProgress(inst *instance.Instance, doctype string, version, count int) error {
+	progress, err := GetProgress(inst, doctype)
+	if err != nil {
+		return err
+	}
+	progress.Version = version
+	progress.Upgraded = count
+	progress.LastUpgradedAt = time.Now().UTC()
+	if progress.DocRev == "" {
+		return couchdb.CreateNamedDocWithDB(inst, progress)
+	}
+	return couchdb.UpdateDoc(inst, progress)
+}
+
+var _ couchdb.Doc = &Progress{}
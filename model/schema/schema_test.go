@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	const doctype = "io.cozy.tests.schema"
+
+	t.Run("Version", func(t *testing.T) {
+		assert.Equal(t, 1, Version(map[string]interface{}{}))
+		assert.Equal(t, 3, Version(map[string]interface{}{
+			"cozyMetadata": map[string]interface{}{"doctypeVersion": "3"},
+		}))
+		assert.Equal(t, 2, Version(map[string]interface{}{
+			"cozyMetadata": map[string]interface{}{"doctypeVersion": float64(2)},
+		}))
+		assert.Equal(t, 1, Version(map[string]interface{}{
+			"cozyMetadata": map[string]interface{}{"doctypeVersion": "foo"},
+		}))
+		assert.Equal(t, 4, Version(map[string]interface{}{
+			"cozyMetadata": map[string]interface{}{"doctypeVersion": json.Number("4")},
+		}))
+	})
+
+	t.Run("Register", func(t *testing.T) {
+		assert.Equal(t, 0, LatestVersion(doctype))
+		Register(doctype, 3, func(doc map[string]interface{}) error {
+			doc["done"] = doc["finished"] == true
+			delete(doc, "finished")
+			return nil
+		})
+		Register(doctype, 2, func(doc map[string]interface{}) error {
+			doc["title"] = doc["label"]
+			delete(doc, "label")
+			return nil
+		})
+		assert.Equal(t, 3, LatestVersion(doctype))
+
+		assert.Panics(t, func() { Register(doctype, 1, nil) })
+		assert.Panics(t, func() { Register(doctype, 2, nil) })
+	})
+
+	t.Run("Migrate", func(t *testing.T) {
+		doc := map[string]interface{}{"label": "foo", "finished": true}
+		migrated, err := Migrate(doctype, doc)
+		require.NoError(t, err)
+		assert.True(t, migrated)
+		assert.Equal(t, "foo", doc["title"])
+		assert.Equal(t, true, doc["done"])
+		assert.NotContains(t, doc, "label")
+		assert.Equal(t, 3, Version(doc))
+
+		doc = map[string]interface{}{
+			"title":        "bar",
+			"finished":     true,
+			"cozyMetadata": map[string]interface{}{"doctypeVersion": "2"},
+		}
+		migrated, err = Migrate(doctype, doc)
+		require.NoError(t, err)
+		assert.True(t, migrated)
+		assert.Equal(t, "bar", doc["title"])
+		assert.Equal(t, true, doc["done"])
+
+		migrated, err = Migrate(doctype, doc)
+		require.NoError(t, err)
+		assert.False(t, migrated)
+
+		migrated, err = Migrate("io.cozy.tests.unknown", map[string]interface{}{})
+		require.NoError(t, err)
+		assert.False(t, migrated)
+	})
+
+	t.Run("MigrateWithError", func(t *testing.T) {
+		const other = "io.cozy.tests.schema.errors"
+		Register(other, 2, func(doc map[string]interface{}) error {
+			return errors.New("invalid document")
+		})
+		doc := map[string]interface{}{"foo": "bar"}
+		migrated, err := Migrate(other, doc)
+		assert.Error(t, err)
+		assert.False(t, migrated)
+		assert.Equal(t, 1, Version(doc))
+		assert.Equal(t, map[string]interface{}{"foo": "bar"}, doc)
+	})
+
+	t.Run("RegisterFromConfig", func(t *testing.T) {
+		const other = "io.cozy.tests.schema.config"
+		err := RegisterFromConfig([]config.SchemaMigration{
+			{Doctype: other, Version: 2, Rename: []string{"label:title", "name:title"}, Remove: []string{"legacy"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, LatestVersion(other))
+
+		doc := map[string]interface{}{"label": "foo", "name": "bar", "legacy": true, "done": false}
+		migrated, err := Migrate(other, doc)
+		require.NoError(t, err)
+		assert.True(t, migrated)
+		assert.Equal(t, "foo", doc["title"])
+		assert.Equal(t, false, doc["done"])
+		assert.NotContains(t, doc, "label")
+		assert.NotContains(t, doc, "name")
+		assert.NotContains(t, doc, "legacy")
+
+		err = RegisterFromConfig([]config.SchemaMigration{
+			{Doctype: other, Version: 3, Rename: []string{"foo"}},
+		})
+		assert.Error(t, err)
+		err = RegisterFromConfig([]config.SchemaMigration{
+			{Doctype: other, Version: 2},
+		})
+		assert.Error(t, err)
+		err = RegisterFromConfig([]config.SchemaMigration{
+			{Doctype: other, Version: 1},
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 2, LatestVersion(other))
+	})
+}
@@ -41,6 +41,12 @@ type Session struct {
 	LastSeen  time.Time `json:"last_seen"`
 	LongRun   bool      `json:"long_run"`
 	ShortRun  bool      `json:"short_run"`
+
+	// SupportAccessID and SupportOperator are set for a session opened by an
+	// operator of the support, via the admin API.
+	SupportAccessID string `json:"support_access_id,omitempty"`
+	SupportOperator string `json:"support_operator,omitempty"`
+	support         *SupportAccess
 }
 
 // DocType implements couchdb.Doc
@@ -149,6 +155,20 @@ func Get(i *instance.Instance, sessionID string) (*Session, error) {
 		return nil, ErrExpired
 	}
 
+	// A support session is closed when the access granted by the user has
+	// expired or has been revoked.
+	if s.SupportAccessID != "" {
+		access, err := getSupportAccess(i, s.SupportAccessID)
+		if errors.Is(err, ErrNoSupportAccess) {
+			s.Delete(i)
+			return nil, ErrExpired
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.support = access
+	}
+
 	// In order to avoid too many updates of the session document, we have an
 	// update period of one day for the `last_seen` date, which is a good enough
 	// granularity.
@@ -0,0 +1,231 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+)
+
+// supportCodeMaxAge is the duration during which a code minted from the admin
+// API can be used to open a support session.
+const supportCodeMaxAge = 10 * time.Minute
+
+// supportOperatorMaxLen is the maximal length of the name of the operator.
+const supportOperatorMaxLen = 64
+
+var (
+	// ErrNoSupportAccess is used when the user has not granted an access to
+	// the support, or when this access has expired or been revoked.
+	ErrNoSupportAccess = errors.New("No access has been granted to the support")
+	// ErrInvalidSupportCode is used when the code for opening a support
+	// session is invalid or has expired.
+	ErrInvalidSupportCode = errors.New("Invalid code for the support access")
+	// ErrInvalidSupportOperator is used when the name of the operator is
+	// missing or invalid.
+	ErrInvalidSupportOperator = errors.New("Invalid operator for the support access")
+)
+
+// SupportAccess is a time-limited access granted by the user to the support
+// team. While it is valid, an operator can open a session on the instance via
+// the admin API. This session is read-only, unless the user has explicitly
+// granted a read-write access.
+type SupportAccess struct {
+	DocID     string    `json:"_id,omitempty"`
+	DocRev    string    `json:"_rev,omitempty"`
+	ReadWrite bool      `json:"read_write"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DocType implements couchdb.Doc
+func (a *SupportAccess) DocType() string { return consts.SupportAccesses }
+
+// ID implements couchdb.Doc
+func (a *SupportAccess) ID() string { return a.DocID }
+
+// SetID implements couchdb.Doc
+func (a *SupportAccess) SetID(v string) { a.DocID = v }
+
+// Rev implements couchdb.Doc
+func (a *SupportAccess) Rev() string { return a.DocRev }
+
+// SetRev implements couchdb.Doc
+func (a *SupportAccess) SetRev(v string) { a.DocRev = v }
+
+// Clone implements couchdb.Doc
+func (a *SupportAccess) Clone() couchdb.Doc {
+	cloned := *a
+	return &cloned
+}
+
+// Expired returns true if the access can no longer be used.
+func (a *SupportAccess) Expired() bool {
+	return time.Now().After(a.ExpiresAt)
+}
+
+// GrantSupportAccess creates an access for the support, valid for the given
+// duration. A previous access is revoked, as only one access can be granted
+// at a time.
+func GrantSupportAccess(inst *instance.Instance, ttl time.Duration, readWrite bool) (*SupportAccess, error) {
+	if ttl > consts.MaxSupportAccessValidityDuration {
+		ttl = consts.MaxSupportAccessValidityDuration
+	}
+	if _, err := RevokeSupportAccess(inst); err != nil && !errors.Is(err, ErrNoSupportAccess) {
+		return nil, err
+	}
+	now := time.Now()
+	access := &SupportAccess{
+		ReadWrite: readWrite,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := couchdb.CreateDoc(inst, access); err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+// GetSupportAccess returns the access granted to the support, if any. The
+// expired accesses are deleted.
+func GetSupportAccess(inst *instance.Instance) (*SupportAccess, error) {
+	var accesses []*SupportAccess
+	err := couchdb.GetAllDocs(inst, consts.SupportAccesses, nil, &accesses)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	var found *SupportAccess
+	for _, access := range accesses {
+		if access.Expired() {
+			revokeSupportAccess(inst, access)
+		} else {
+			found = access
+		}
+	}
+	if found == nil {
+		return nil, ErrNoSupportAccess
+	}
+	return found, nil
+}
+
+func getSupportAccess(inst *instance.Instance, accessID string) (*SupportAccess, error) {
+	access := &SupportAccess{}
+	err := couchdb.GetDoc(inst, consts.SupportAccesses, accessID, access)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, ErrNoSupportAccess
+	}
+	if err != nil {
+		return nil, err
+	}
+	if access.Expired() {
+		revokeSupportAccess(inst, access)
+		return nil, ErrNoSupportAccess
+	}
+	return access, nil
+}
+
+// RevokeSupportAccess removes the access granted to the support, and closes
+// the sessions opened with it. The revoked access is returned.
+func RevokeSupportAccess(inst *instance.Instance) (*SupportAccess, error) {
+	access, err := GetSupportAccess(inst)
+	if err != nil {
+		return nil, err
+	}
+	revokeSupportAccess(inst, access)
+	return access, nil
+}
+
+func revokeSupportAccess(inst *instance.Instance, access *SupportAccess) {
+	if err := couchdb.DeleteDoc(inst, access); err != nil {
+		inst.Logger().WithNamespace("support").
+			Warnf("Cannot delete support access %s: %s", access.DocID, err)
+	}
+	sessions, err := GetAll(inst)
+	if err != nil {
+		inst.Logger().WithNamespace("support").
+			Warnf("Cannot list the sessions for support access %s: %s", access.DocID, err)
+		return
+	}
+	for _, s := range sessions {
+		if s.SupportAccessID == access.DocID {
+			s.Delete(inst)
+		}
+	}
+}
+
+// CreateSupportCode returns a short-lived code that can be used by the given
+// operator to open a session with the support access.
+func CreateSupportCode(inst *instance.Instance, operator string) (string, error) {
+	operator = strings.TrimSpace(operator)
+	if operator == "" || len(operator) > supportOperatorMaxLen || strings.Contains(operator, "|") {
+		return "", ErrInvalidSupportOperator
+	}
+	access, err := GetSupportAccess(inst)
+	if err != nil {
+		return "", err
+	}
+	code, err := crypto.EncodeAuthMessage(supportCodeMACConfig(), inst.SessionSecret(),
+		[]byte(access.DocID+"|"+operator), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(code), nil
+}
+
+// NewSupportSession checks the code minted from the admin API, and creates a
+// session for the operator with the support access.
+func NewSupportSession(inst *instance.Instance, code string) (*Session, error) {
+	value, err := crypto.DecodeAuthMessage(supportCodeMACConfig(), inst.SessionSecret(),
+		[]byte(code), nil)
+	if err != nil {
+		return nil, ErrInvalidSupportCode
+	}
+	parts := strings.SplitN(string(value), "|", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidSupportCode
+	}
+	access, err := getSupportAccess(inst, parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s := &Session{
+		instance:        inst,
+		LastSeen:        now,
+		CreatedAt:       now,
+		SupportAccessID: access.DocID,
+		SupportOperator: parts[1],
+		support:         access,
+	}
+	if err := couchdb.CreateDoc(inst, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SupportAccess returns the access granted to the support if the session has
+// been opened by an operator, or nil for a normal session.
+func (s *Session) SupportAccess() *SupportAccess {
+	return s.support
+}
+
+// ReadOnly returns true if the session has been opened by an operator of the
+// support, and the user has not granted a read-write access.
+func (s *Session) ReadOnly() bool {
+	return s.support != nil && !s.support.ReadWrite
+}
+
+func supportCodeMACConfig() crypto.MACConfig {
+	return crypto.MACConfig{
+		Name:   "support-access",
+		MaxAge: supportCodeMaxAge,
+		MaxLen: 256,
+	}
+}
+
+var _ couchdb.Doc = &SupportAccess{}
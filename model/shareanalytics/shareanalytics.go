@@ -0,0 +1,297 @@
+// Package shareanalytics is used to record anonymized statistics about the
+// accesses to the share by links and to the previews of the sharings, so that
+// the owner can know if and how their shares are used. The IP addresses and
+// the user-agents are never stored: only the country and the class of the
+// user-agent are kept, aggregated by day.
+package shareanalytics
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/mssola/user_agent"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const (
+	// ShareTypeLink is the type of the analytics for a share by link.
+	ShareTypeLink = "link"
+	// ShareTypePreview is the type of the analytics for the preview of a
+	// sharing.
+	ShareTypePreview = "preview"
+)
+
+const (
+	// ClassDesktop is the class of the user-agents for the desktop browsers.
+	ClassDesktop = "desktop"
+	// ClassMobile is the class of the user-agents for the mobile browsers.
+	ClassMobile = "mobile"
+	// ClassBot is the class of the user-agents for the bots, like the ones
+	// that generate the previews of the links in the messaging apps.
+	ClassBot = "bot"
+	// ClassUnknown is used when the user-agent is missing.
+	ClassUnknown = "unknown"
+)
+
+// unknownCountry is used when the country cannot be found from the IP address.
+const unknownCountry = "unknown"
+
+// maxRetries is the number of times the recording of an access is retried
+// when there is a conflict with a concurrent access.
+const maxRetries = 3
+
+// maxDays is the maximal number of days loaded for the analytics of a share.
+const maxDays = 1000
+
+// DayStats is a document with the statistics of the accesses to a share for
+// a day.
+type DayStats struct {
+	DocID         string         `json:"_id,omitempty"`
+	DocRev        string         `json:"_rev,omitempty"`
+	ShareID       string         `json:"share_id"`
+	ShareType     string         `json:"share_type"`
+	Day           string         `json:"day"`
+	Count         int            `json:"count"`
+	FirstAccessAt time.Time      `json:"first_access_at"`
+	LastAccessAt  time.Time      `json:"last_access_at"`
+	Countries     map[string]int `json:"countries"`
+	UserAgents    map[string]int `json:"user_agents"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (d *DayStats) ID() string { return d.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (d *DayStats) Rev() string { return d.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (d *DayStats) DocType() string { return consts.SharingsAnalytics }
+
+// Clone implements couchdb.Doc
+func (d *DayStats) Clone() couchdb.Doc {
+	cloned := *d
+	cloned.Countries = make(map[string]int, len(d.Countries))
+	for k, v := range d.Countries {
+		cloned.Countries[k] = v
+	}
+	cloned.UserAgents = make(map[string]int, len(d.UserAgents))
+	for k, v := range d.UserAgents {
+		cloned.UserAgents[k] = v
+	}
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (d *DayStats) SetID(id string) { d.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (d *DayStats) SetRev(rev string) { d.DocRev = rev }
+
+// add counts an access made at the given time.
+func (d *DayStats) add(at time.Time, country, class string) {
+	d.Count++
+	if d.FirstAccessAt.IsZero() || at.Before(d.FirstAccessAt) {
+		d.FirstAccessAt = at
+	}
+	if at.After(d.LastAccessAt) {
+		d.LastAccessAt = at
+	}
+	if d.Countries == nil {
+		d.Countries = make(map[string]int)
+	}
+	d.Countries[country]++
+	if d.UserAgents == nil {
+		d.UserAgents = make(map[string]int)
+	}
+	d.UserAgents[class]++
+}
+
+// Enabled returns false if the share analytics have been disabled for the
+// context of the instance.
+func Enabled(inst *instance.Instance) bool {
+	ctx, ok := inst.SettingsContext()
+	if !ok {
+		return true
+	}
+	enabled, ok := ctx["share_analytics"].(bool)
+	return !ok || enabled
+}
+
+// ShareFor returns the identifier and the type of the share for the given
+// permission, or empty strings if the permission is not used for a share.
+func ShareFor(pdoc *permission.Permission) (string, string) {
+	switch pdoc.Type {
+	case permission.TypeShareByLink:
+		return pdoc.ID(), ShareTypeLink
+	case permission.TypeSharePreview, permission.TypeShareInteract:
+		parts := strings.SplitN(pdoc.SourceID, "/", 2)
+		if len(parts) == 2 && parts[0] == consts.Sharings {
+			return parts[1], ShareTypePreview
+		}
+	}
+	return "", ""
+}
+
+// Record counts an access to the share for the given permission. An error is
+// only logged, as it should not prevent the access to the share.
+func Record(inst *instance.Instance, pdoc *permission.Permission, ip, rawUserAgent string) {
+	if !Enabled(inst) {
+		return
+	}
+	shareID, shareType := ShareFor(pdoc)
+	if shareID == "" {
+		return
+	}
+	now := time.Now().UTC()
+	country := lookupCountry(ip)
+	class := userAgentClass(rawUserAgent)
+
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		if err = record(inst, shareID, shareType, now, country, class); !couchdb.IsConflictError(err) {
+			break
+		}
+	}
+	if err != nil {
+		inst.Logger().WithNamespace("shareanalytics").
+			Warnf("Cannot record the access to the share %s: %s", shareID, err)
+	}
+}
+
+func record(inst *instance.Instance, shareID, shareType string, now time.Time, country, class string) error {
+	day := now.Format("2006-01-02")
+	docID := shareID + "_" + day
+	var stats DayStats
+	err := couchdb.GetDoc(inst, consts.SharingsAnalytics, docID, &stats)
+	if err != nil && !couchdb.IsNotFoundError(err) && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+	stats.ShareID = shareID
+	stats.ShareType = shareType
+	stats.Day = day
+	stats.add(now, country, class)
+	if stats.DocRev != "" {
+		return couchdb.UpdateDoc(inst, &stats)
+	}
+	stats.DocID = docID
+	return couchdb.CreateNamedDocWithDB(inst, &stats)
+}
+
+// Analytics is the summary of the accesses to a share.
+type Analytics struct {
+	ShareID       string         `json:"share_id"`
+	ShareType     string         `json:"share_type,omitempty"`
+	Count         int            `json:"count"`
+	FirstAccessAt *time.Time     `json:"first_access_at,omitempty"`
+	LastAccessAt  *time.Time     `json:"last_access_at,omitempty"`
+	Countries     map[string]int `json:"countries"`
+	UserAgents    map[string]int `json:"user_agents"`
+	Days          []DayCount     `json:"days"`
+}
+
+// DayCount is the number of accesses to a share for a day.
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// Get returns the analytics of the share with the given identifier.
+func Get(db prefixer.Prefixer, shareID string) (*Analytics, error) {
+	var days []*DayStats
+	req := &couchdb.FindRequest{
+		UseIndex: "by-share-id-and-day",
+		Selector: mango.Equal("share_id", shareID),
+		Sort: mango.SortBy{
+			{Field: "share_id", Direction: mango.Asc},
+			{Field: "day", Direction: mango.Asc},
+		},
+		Limit: maxDays,
+	}
+	err := couchdb.FindDocs(db, consts.SharingsAnalytics, req, &days)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	return summarize(shareID, days), nil
+}
+
+func summarize(shareID string, days []*DayStats) *Analytics {
+	analytics := &Analytics{
+		ShareID:    shareID,
+		Countries:  make(map[string]int),
+		UserAgents: make(map[string]int),
+		Days:       []DayCount{},
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		return days[i].Day < days[j].Day
+	})
+	for _, d := range days {
+		analytics.ShareType = d.ShareType
+		analytics.Count += d.Count
+		if analytics.FirstAccessAt == nil || d.FirstAccessAt.Before(*analytics.FirstAccessAt) {
+			first := d.FirstAccessAt
+			analytics.FirstAccessAt = &first
+		}
+		if analytics.LastAccessAt == nil || d.LastAccessAt.After(*analytics.LastAccessAt) {
+			last := d.LastAccessAt
+			analytics.LastAccessAt = &last
+		}
+		for k, v := range d.Countries {
+			analytics.Countries[k] += v
+		}
+		for k, v := range d.UserAgents {
+			analytics.UserAgents[k] += v
+		}
+		analytics.Days = append(analytics.Days, DayCount{Day: d.Day, Count: d.Count})
+	}
+	return analytics
+}
+
+func userAgentClass(rawUserAgent string) string {
+	if rawUserAgent == "" {
+		return ClassUnknown
+	}
+	ua := user_agent.New(rawUserAgent)
+	if ua.Bot() {
+		return ClassBot
+	}
+	if ua.Mobile() {
+		return ClassMobile
+	}
+	return ClassDesktop
+}
+
+// lookupCountry returns the ISO code of the country for the given IP address.
+func lookupCountry(ip string) string {
+	geodb := config.GetConfig().GeoDB
+	if geodb == "" || ip == "" {
+		return unknownCountry
+	}
+	db, err := maxminddb.Open(geodb)
+	if err != nil {
+		logger.WithNamespace("shareanalytics").Errorf("cannot open the geodb: %s", err)
+		return unknownCountry
+	}
+	defer db.Close()
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := db.Lookup(net.ParseIP(ip), &record); err != nil || record.Country.ISOCode == "" {
+		return unknownCountry
+	}
+	return record.Country.ISOCode
+}
+
+var _ couchdb.Doc = &DayStats{}
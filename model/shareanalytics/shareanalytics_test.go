@@ -0,0 +1,61 @@
+package shareanalytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareAnalytics(t *testing.T) {
+	t.Run("ShareFor", func(t *testing.T) {
+		link := &permission.Permission{PID: "perm-id", Type: permission.TypeShareByLink}
+		id, typ := ShareFor(link)
+		assert.Equal(t, "perm-id", id)
+		assert.Equal(t, ShareTypeLink, typ)
+
+		preview := &permission.Permission{
+			PID:      "other-id",
+			Type:     permission.TypeSharePreview,
+			SourceID: "io.cozy.sharings/sharing-id",
+		}
+		id, typ = ShareFor(preview)
+		assert.Equal(t, "sharing-id", id)
+		assert.Equal(t, ShareTypePreview, typ)
+
+		app := &permission.Permission{PID: "app-id", Type: permission.TypeWebapp}
+		id, _ = ShareFor(app)
+		assert.Empty(t, id)
+	})
+
+	t.Run("UserAgentClass", func(t *testing.T) {
+		assert.Equal(t, ClassUnknown, userAgentClass(""))
+		assert.Equal(t, ClassDesktop, userAgentClass("Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0"))
+		assert.Equal(t, ClassMobile, userAgentClass("Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"))
+		assert.Equal(t, ClassBot, userAgentClass("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"))
+	})
+
+	t.Run("Summarize", func(t *testing.T) {
+		now := time.Now().UTC()
+		yesterday := &DayStats{ShareID: "share-id", ShareType: ShareTypeLink, Day: "2023-01-01"}
+		yesterday.add(now.Add(-24*time.Hour), "FR", ClassDesktop)
+		today := &DayStats{ShareID: "share-id", ShareType: ShareTypeLink, Day: "2023-01-02"}
+		today.add(now, "FR", ClassMobile)
+		today.add(now.Add(-time.Hour), "DE", ClassMobile)
+
+		analytics := summarize("share-id", []*DayStats{today, yesterday})
+		assert.Equal(t, ShareTypeLink, analytics.ShareType)
+		assert.Equal(t, 3, analytics.Count)
+		assert.Equal(t, now.Add(-24*time.Hour), *analytics.FirstAccessAt)
+		assert.Equal(t, now, *analytics.LastAccessAt)
+		assert.Equal(t, map[string]int{"FR": 2, "DE": 1}, analytics.Countries)
+		assert.Equal(t, map[string]int{ClassDesktop: 1, ClassMobile: 2}, analytics.UserAgents)
+		assert.Equal(t, []DayCount{{Day: "2023-01-01", Count: 1}, {Day: "2023-01-02", Count: 2}}, analytics.Days)
+
+		empty := summarize("share-id", nil)
+		assert.Equal(t, 0, empty.Count)
+		assert.Nil(t, empty.FirstAccessAt)
+		assert.Empty(t, empty.Days)
+	})
+}
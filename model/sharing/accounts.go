@@ -0,0 +1,67 @@
+package sharing
+
+import (
+	"github.com/cozy/cozy-stack/model/account"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+// transformAccountToSent removes the secrets of an account before sending it
+// to another member: only the configuration of the konnector is shared, and
+// each member fills their own credentials.
+func (s *Sharing) transformAccountToSent(doc map[string]interface{}, xorKey []byte) {
+	id := doc["_id"].(string)
+	doc["_id"] = XorID(id, xorKey)
+	if _, ok := doc["_deleted"]; !ok {
+		account.StripSecrets(doc)
+	}
+}
+
+// prepareAccountsToApply ensures that the accounts received from another
+// member have no secrets, and keeps the secrets and the state of the local
+// version of the accounts that already exist on this instance.
+func prepareAccountsToApply(inst *instance.Instance, docs DocsList) error {
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if _, ok := doc["_deleted"]; ok {
+			continue
+		}
+		needed, _ := doc["credentials_needed"].(bool)
+		account.StripSecrets(doc)
+		if needed {
+			doc["credentials_needed"] = true
+		}
+		if id, ok := doc["_id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var locals []map[string]interface{}
+	req := couchdb.AllDocsRequest{Keys: ids}
+	err := couchdb.GetAllDocs(inst, consts.Accounts, &req, &locals)
+	if couchdb.IsNoDatabaseError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]map[string]interface{}, len(locals))
+	for _, local := range locals {
+		if id, ok := local["_id"].(string); ok {
+			byID[id] = local
+		}
+	}
+	for _, doc := range docs {
+		id, _ := doc["_id"].(string)
+		if local, ok := byID[id]; ok {
+			if _, ok := doc["_deleted"]; !ok {
+				account.KeepMemberFields(doc, local)
+			}
+		}
+	}
+	return nil
+}
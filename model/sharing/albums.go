@@ -0,0 +1,303 @@
+package sharing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+)
+
+// isAlbumRule returns true if the rule is for the photos of an album.
+func (r Rule) isAlbumRule() bool {
+	if r.DocType != consts.Files || r.Selector != couchdb.SelectorReferencedBy {
+		return false
+	}
+	for _, val := range r.Values {
+		if strings.HasPrefix(val, consts.PhotosAlbums+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// albumIDs returns the identifiers of the albums shared by this sharing.
+func (s *Sharing) albumIDs() []string {
+	var ids []string
+	for _, rule := range s.Rules {
+		if !rule.isAlbumRule() {
+			continue
+		}
+		for _, val := range rule.Values {
+			if id := strings.TrimPrefix(val, consts.PhotosAlbums+"/"); id != val {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// findLocalCopy returns a file of the instance with the same content (same
+// checksum and same size) as the target, or nil if there is none. It is used
+// for the photos of an album, as the members of a family often have the same
+// photos in their libraries.
+func findLocalCopy(inst *instance.Instance, target *FileDocWithRevisions) (*vfs.FileDoc, error) {
+	var files []*vfs.FileDoc
+	req := &couchdb.FindRequest{
+		UseIndex: "by-md5sum",
+		Selector: mango.And(
+			mango.Equal("md5sum", base64.StdEncoding.EncodeToString(target.MD5Sum)),
+			mango.Equal("size", strconv.FormatInt(target.ByteSize, 10)),
+			mango.Equal("type", consts.FileType),
+			mango.NotEqual("trashed", true),
+		),
+		Limit: 1,
+	}
+	if err := couchdb.FindDocs(inst, consts.Files, req, &files); err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if file.DocID != target.DocID {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+// linkLocalCopy adds the references to the shared albums of the target to a
+// local file with the same content, instead of creating a copy of this file.
+// The io.cozy.shared document of the target keeps the identifier of the local
+// file, so that the next changes of the target are applied to it. It returns
+// false if there is no local copy of this file, or if the recipient has not
+// allowed the local copies to be used for this sharing, as matching on the
+// checksum would let the other members probe the files of the recipient.
+func (s *Sharing) linkLocalCopy(inst *instance.Instance, target *FileDocWithRevisions, ruleIndex int) (bool, error) {
+	if s.Owner || !s.LinkLocalCopies {
+		return false, nil
+	}
+	local, err := findLocalCopy(inst, target)
+	if err != nil || local == nil {
+		return false, err
+	}
+
+	inst.Logger().WithNamespace("upload").
+		Debugf("Link %s to the local copy %s", target.DocID, local.DocID)
+	ref := SharedRef{
+		SID:     consts.Files + "/" + target.DocID,
+		Infos:   map[string]SharedInfo{s.SID: {Rule: ruleIndex, Binary: true}},
+		LocalID: local.DocID,
+	}
+	if err := UpdateFileShared(inst, &ref, target.Revisions); err != nil {
+		return false, err
+	}
+	// The link must be saved before the local file is updated, as the update
+	// of the file will trigger a share-track job for it.
+	if err := s.setLink(inst, local, target.DocID); err != nil {
+		return false, err
+	}
+	if err := s.updateLocalCopy(inst, target, local, &s.Rules[ruleIndex]); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetLinkLocalCopies is used by a recipient to allow, or not, the photos of
+// the shared albums to be matched with the files of its own library.
+func (s *Sharing) SetLinkLocalCopies(inst *instance.Instance, enabled bool) error {
+	if s.Owner {
+		return ErrInvalidSharing
+	}
+	if s.LinkLocalCopies == enabled {
+		return nil
+	}
+	s.LinkLocalCopies = enabled
+	return couchdb.UpdateDoc(inst, s)
+}
+
+// findLinkedRef returns the io.cozy.shared document of a file of the sharing
+// that has been linked to a local copy, or nil if the file has not been
+// linked.
+func (s *Sharing) findLinkedRef(inst *instance.Instance, fileID string) (*SharedRef, error) {
+	if len(s.albumIDs()) == 0 {
+		return nil, nil
+	}
+	var ref SharedRef
+	if err := couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+fileID, &ref); err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if _, ok := ref.Infos[s.SID]; !ok || ref.LocalID == "" {
+		return nil, nil
+	}
+	return &ref, nil
+}
+
+// syncLocalCopy applies the changes of a shared file to the local copy that
+// is used in place of it. If the local copy has no longer the same content,
+// the link is removed and a key is returned to upload the shared file.
+func (s *Sharing) syncLocalCopy(inst *instance.Instance, target *FileDocWithRevisions, ref *SharedRef) (*KeyToUpload, error) {
+	if sub, _ := ref.Revisions.Find(target.DocRev); sub != nil {
+		// It's just the echo, there is nothing to do
+		return nil, nil
+	}
+	local, err := inst.VFS().FileByID(ref.LocalID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if local == nil || local.Trashed || !bytes.Equal(local.MD5Sum, target.MD5Sum) {
+		if err := s.unlinkLocalCopy(inst, ref); err != nil {
+			return nil, err
+		}
+		return s.createUploadKey(inst, target)
+	}
+	rule := &s.Rules[ref.Infos[s.SID].Rule]
+	if err := s.updateLocalCopy(inst, target, local, rule); err != nil {
+		return nil, err
+	}
+	return nil, UpdateFileShared(inst, ref, target.Revisions)
+}
+
+// unlinkLocalCopy removes the references to the shared albums from the local
+// copy of a shared file, and the io.cozy.shared document of this file. It is
+// used when the shared file has been removed from the sharing.
+func (s *Sharing) unlinkLocalCopy(inst *instance.Instance, ref *SharedRef) error {
+	inst.Logger().WithNamespace("upload").
+		Debugf("Unlink %s from the local copy %s", ref.SID, ref.LocalID)
+	local, err := inst.VFS().FileByID(ref.LocalID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if local != nil {
+		olddoc := local.Clone().(*vfs.FileDoc)
+		removeReferencesFromRule(local, &s.Rules[ref.Infos[s.SID].Rule])
+		if len(local.ReferencedBy) != len(olddoc.ReferencedBy) {
+			if err := saveLocalCopy(inst, olddoc, local); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.removeLink(inst, ref.LocalID); err != nil {
+		return err
+	}
+	return couchdb.DeleteDoc(inst, ref)
+}
+
+// updateLocalCopy sets the references to the shared albums of the target on
+// the local copy.
+func (s *Sharing) updateLocalCopy(inst *instance.Instance, target *FileDocWithRevisions, local *vfs.FileDoc, rule *Rule) error {
+	olddoc := local.Clone().(*vfs.FileDoc)
+	local.ReferencedBy = buildReferencedBy(target.FileDoc, local, rule)
+	if vfs.SameReferences(olddoc.ReferencedBy, local.ReferencedBy) {
+		return nil
+	}
+	return saveLocalCopy(inst, olddoc, local)
+}
+
+func saveLocalCopy(inst *instance.Instance, olddoc, local *vfs.FileDoc) error {
+	fs := inst.VFS()
+	if local.CozyMetadata != nil {
+		local.CozyMetadata.UpdatedAt = time.Now()
+	}
+	if _, err := local.Path(fs); err != nil {
+		return err
+	}
+	return fs.UpdateFileDoc(olddoc, local)
+}
+
+// setLink records on the io.cozy.shared document of the local file that it is
+// used in place of the given shared file.
+func (s *Sharing) setLink(inst *instance.Instance, local *vfs.FileDoc, sharedID string) error {
+	sid := consts.Files + "/" + local.DocID
+	mu := config.Lock().ReadWrite(inst, "shared/"+sid)
+	if err := mu.Lock(); err != nil {
+		return err
+	}
+	defer mu.Unlock()
+
+	var ref SharedRef
+	if err := couchdb.GetDoc(inst, consts.Shared, sid, &ref); err != nil {
+		if !couchdb.IsNotFoundError(err) {
+			return err
+		}
+		ref.SID = sid
+		ref.Infos = make(map[string]SharedInfo)
+		ref.Revisions = &RevsTree{Rev: local.DocRev}
+	}
+	if ref.Links == nil {
+		ref.Links = make(map[string]string)
+	}
+	ref.Links[s.SID] = sharedID
+	if ref.Rev() == "" {
+		return couchdb.CreateNamedDoc(inst, &ref)
+	}
+	return couchdb.UpdateDoc(inst, &ref)
+}
+
+// removeLink removes the link for this sharing from the io.cozy.shared
+// document of the local file.
+func (s *Sharing) removeLink(inst *instance.Instance, localID string) error {
+	sid := consts.Files + "/" + localID
+	mu := config.Lock().ReadWrite(inst, "shared/"+sid)
+	if err := mu.Lock(); err != nil {
+		return err
+	}
+	defer mu.Unlock()
+
+	var ref SharedRef
+	if err := couchdb.GetDoc(inst, consts.Shared, sid, &ref); err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+	if _, ok := ref.Links[s.SID]; !ok {
+		return nil
+	}
+	delete(ref.Links, s.SID)
+	if len(ref.Links) == 0 && len(ref.Infos) == 0 {
+		return couchdb.DeleteDoc(inst, &ref)
+	}
+	return couchdb.UpdateDoc(inst, &ref)
+}
+
+// countAlbumFiles returns the number of files received for each album of the
+// sharing.
+func (s *Sharing) countAlbumFiles(inst *instance.Instance) map[string]int {
+	ids := s.albumIDs()
+	if len(ids) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(ids))
+	for _, id := range ids {
+		req := &couchdb.ViewRequest{
+			Key:    []string{consts.PhotosAlbums, id},
+			Reduce: true,
+		}
+		var res couchdb.ViewResponse
+		if err := couchdb.ExecView(inst, couchdb.FilesReferencedByView, req, &res); err != nil {
+			continue
+		}
+		count := 0
+		if len(res.Rows) > 0 {
+			if n, ok := res.Rows[0].Value.(float64); ok {
+				count = int(n)
+			}
+		}
+		counts[id] = count
+	}
+	return counts
+}
@@ -9,20 +9,22 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-// InfoByDocTypeData returns the sharings info as data array in the JSON-API format
-func InfoByDocTypeData(c echo.Context, statusCode int, sharings []*APISharing) error {
+// InfoByDocTypeData returns a page of the sharings info as data array in the
+// JSON-API format
+func InfoByDocTypeData(c echo.Context, statusCode int, sharings []*APISharing, total int, next *jsonapi.PageCursor) error {
 	data := make([]jsonapi.Object, len(sharings))
 	for i, s := range sharings {
 		data[i] = s
 	}
-	return jsonapi.DataList(c, http.StatusOK, data, nil)
+	return jsonapi.DataListPage(c, http.StatusOK, data, &total, next)
 }
 
 // APISharing is used to serialize a Sharing to JSON-API
 type APISharing struct {
 	*Sharing
-	// XXX Hide the credentials
+	// XXX Hide the credentials and the webhook (with its secret)
 	Credentials *interface{}           `json:"credentials,omitempty"`
+	Webhook     *interface{}           `json:"webhook,omitempty"`
 	SharedDocs  []couchdb.DocReference `json:"-"`
 }
 
@@ -138,3 +140,44 @@ func (m *APIMoved) Relationships() jsonapi.RelationshipMap { return nil }
 func (m *APIMoved) Links() *jsonapi.LinksList { return nil }
 
 var _ jsonapi.Object = (*APIMoved)(nil)
+
+// APIIdentity is used when the email or the public name of a Cozy has changed
+// to inform the other members of the sharing of its new identity.
+type APIIdentity struct {
+	SharingID    string `json:"id"`
+	Email        string `json:"email"`
+	PublicName   string `json:"public_name,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// ID returns the sharing qualified identifier
+func (m *APIIdentity) ID() string { return m.SharingID }
+
+// Rev returns the sharing revision
+func (m *APIIdentity) Rev() string { return "" }
+
+// DocType returns the sharing document type
+func (m *APIIdentity) DocType() string { return consts.SharingsIdentity }
+
+// SetID changes the sharing qualified identifier
+func (m *APIIdentity) SetID(id string) { m.SharingID = id }
+
+// SetRev changes the sharing revision
+func (m *APIIdentity) SetRev(rev string) {}
+
+// Clone is part of jsonapi.Object interface
+func (m *APIIdentity) Clone() couchdb.Doc {
+	panic("APIIdentity must not be cloned")
+}
+
+// Included is part of jsonapi.Object interface
+func (m *APIIdentity) Included() []jsonapi.Object { return nil }
+
+// Relationships is part of jsonapi.Object interface
+func (m *APIIdentity) Relationships() jsonapi.RelationshipMap { return nil }
+
+// Links is part of jsonapi.Object interface
+func (m *APIIdentity) Links() *jsonapi.LinksList { return nil }
+
+var _ jsonapi.Object = (*APIIdentity)(nil)
@@ -0,0 +1,192 @@
+package sharing
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/revision"
+)
+
+// resetCheckpointsTimeout is the timeout of the job that resets the
+// checkpoints of a replication.
+const resetCheckpointsTimeout = time.Hour
+
+// isStaleSeq returns true if the sequence number saved as a checkpoint can't
+// come from the database with the given update_seq: it happens when the
+// database has been recreated or restored, and the numbers start again from 0.
+// When the numbers are the same, the opaque parts must be the same too.
+func isStaleSeq(lastSeq, updateSeq string) bool {
+	if lastSeq == "" || updateSeq == "" {
+		return false
+	}
+	lastGen := revision.Generation(lastSeq)
+	updateGen := revision.Generation(updateSeq)
+	if lastGen != updateGen {
+		return lastGen > updateGen
+	}
+	return lastSeq != updateSeq
+}
+
+// isStaleCheckpoint checks if the last sequence number of a replication is
+// still valid for the io.cozy.shared database.
+func isStaleCheckpoint(inst *instance.Instance, lastSeq string) (bool, error) {
+	if lastSeq == "" {
+		return false, nil
+	}
+	status, err := couchdb.DBStatus(inst, consts.Shared)
+	if err != nil {
+		return false, err
+	}
+	return isStaleSeq(lastSeq, status.UpdateSeq), nil
+}
+
+// setLastSeqNumber saves the sequence number for this replication, even if
+// it is inferior to the previous one.
+func (s *Sharing) setLastSeqNumber(inst *instance.Instance, m *Member, worker, seq string) error {
+	id, err := s.replicationID(m)
+	if err != nil {
+		return err
+	}
+	result, err := couchdb.GetLocal(inst, consts.Shared, id+"/"+worker)
+	if err != nil {
+		if !couchdb.IsNotFoundError(err) {
+			return err
+		}
+		result = make(map[string]interface{})
+	}
+	result["last_seq"] = seq
+	return couchdb.PutLocal(inst, consts.Shared, id+"/"+worker, result)
+}
+
+// resetReplication is used when the checkpoint of the replication to a member
+// can't be used. Instead of replaying the whole changes feed, the documents of
+// the sharing are found with the shared docs view and compared with the
+// documents of the member with _revs_diff. Then, the checkpoint is moved to
+// the current sequence number of the database.
+func (s *Sharing) resetReplication(inst *instance.Instance, m *Member, creds *Credentials, lastSeq string) error {
+	log := inst.Logger().WithNamespace("replicator")
+	log.Warnf("Reset the replication checkpoint for sharing %s (last_seq = %s)", s.SID, lastSeq)
+
+	// The sequence number is taken before the diff, so that the changes made
+	// during the diff will be replicated by the next replication.
+	status, err := couchdb.DBStatus(inst, consts.Shared)
+	if err != nil {
+		return err
+	}
+	if err := s.rediff(inst, m, creds); err != nil {
+		return err
+	}
+	return s.setLastSeqNumber(inst, m, "replicator", status.UpdateSeq)
+}
+
+// rediff sends to the member the documents of the sharing that are missing
+// on its side.
+func (s *Sharing) rediff(inst *instance.Instance, m *Member, creds *Credentials) error {
+	req := &couchdb.ViewRequest{
+		StartKey:    s.SID,
+		EndKey:      s.SID,
+		IncludeDocs: true,
+		Limit:       BatchSize,
+	}
+	for {
+		var res couchdb.ViewResponse
+		if err := couchdb.ExecView(inst, couchdb.SharedDocsBySharingID, req, &res); err != nil {
+			return err
+		}
+		if len(res.Rows) == 0 {
+			return nil
+		}
+		req.StartKeyDocID = res.Rows[len(res.Rows)-1].ID
+		req.Skip = 1 // Do not fetch again the last document from this page
+
+		feed := changesResponse{
+			Changes: Changes{
+				Changed: make(Changed),
+				Removed: make(Removed),
+			},
+			RuleIndexes: make(map[string]int),
+		}
+		for _, row := range res.Rows {
+			var doc couchdb.JSONDoc
+			if err := json.Unmarshal(row.Doc, &doc); err != nil {
+				return err
+			}
+			if err := s.addSharedDoc(&feed, row.ID, doc, false); err != nil {
+				return err
+			}
+		}
+		changes := &feed.Changes
+		if len(changes.Changed) > 0 {
+			missings, err := s.callRevsDiff(inst, m, creds, changes)
+			if err != nil {
+				return err
+			}
+			docs, err := s.getMissingDocs(inst, missings, changes)
+			if err != nil {
+				return err
+			}
+			if err := s.sendBulkDocs(inst, m, creds, docs, feed.RuleIndexes); err != nil {
+				return err
+			}
+		}
+		if len(res.Rows) < BatchSize {
+			return nil
+		}
+	}
+}
+
+// PushResetCheckpointsJob adds a job to reset the checkpoints of the
+// replications to the member at the given index, as it can take a long time
+// for the sharings with a lot of documents.
+func PushResetCheckpointsJob(inst *instance.Instance, s *Sharing, index int) error {
+	msg, err := job.NewMessage(&ReplicateMsg{
+		SharingID:   s.SID,
+		ResetMember: &index,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "share-replicate",
+		Message:    msg,
+		Options:    &job.JobOptions{Timeout: resetCheckpointsTimeout},
+	})
+	return err
+}
+
+// ResetCheckpoints forces a reset of the checkpoints of the replications to
+// the given member: the documents of the sharing are compared with those of
+// the member, and the files are checked again for the upload.
+func (s *Sharing) ResetCheckpoints(inst *instance.Instance, m *Member) error {
+	if m.Instance == "" {
+		return ErrInvalidURL
+	}
+	creds := s.FindCredentials(m)
+	if creds == nil {
+		return ErrInvalidSharing
+	}
+
+	mu := config.Lock().ReadWrite(inst, "sharings/"+s.SID)
+	if err := mu.Lock(); err != nil {
+		return err
+	}
+	defer mu.Unlock()
+
+	lastSeq, err := s.getLastSeqNumber(inst, m, "replicator")
+	if err != nil {
+		return err
+	}
+	if err := s.resetReplication(inst, m, creds, lastSeq); err != nil {
+		return err
+	}
+	if err := s.clearLastSequenceNumber(inst, m, "upload"); err != nil {
+		return err
+	}
+	PushUploadJob(s, inst)
+	return nil
+}
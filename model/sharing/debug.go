@@ -0,0 +1,397 @@
+package sharing
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// maxDebugChangesBatches is the maximal number of batches of the changes feed
+// read to count the pending shared docs of a checkpoint.
+const maxDebugChangesBatches = 20
+
+// DebugReport is everything that can be known about a sharing on the
+// instances of this stack. It is used by the support to investigate a
+// sharing that doesn't work as expected.
+type DebugReport struct {
+	SharingID   string                   `json:"sharing_id"`
+	Description string                   `json:"description,omitempty"`
+	Rules       []Rule                   `json:"rules"`
+	Members     []DebugMember            `json:"members"`
+	Instances   []*DebugInstance         `json:"instances"`
+	Checks      []map[string]interface{} `json:"checks"`
+}
+
+// DebugMember is a member of the sharing, as seen by the owner.
+type DebugMember struct {
+	Index    int    `json:"index"`
+	Status   string `json:"status"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+	// Local is true if the instance of the member is on this stack
+	Local bool `json:"local"`
+}
+
+// DebugInstance is the state of the sharing on a local instance.
+type DebugInstance struct {
+	Domain      string             `json:"domain"`
+	Error       string             `json:"error,omitempty"`
+	Owner       bool               `json:"owner"`
+	Active      bool               `json:"active"`
+	Initial     bool               `json:"initial,omitempty"`
+	ReadOnly    bool               `json:"read_only,omitempty"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	Triggers    []DebugTrigger     `json:"triggers"`
+	Credentials []DebugCredentials `json:"credentials"`
+	Checkpoints []DebugCheckpoint  `json:"checkpoints"`
+}
+
+// DebugTrigger tells if a trigger of the sharing still exists.
+type DebugTrigger struct {
+	Worker string `json:"worker"`
+	ID     string `json:"id"`
+	Exists bool   `json:"exists"`
+}
+
+// DebugCredentials describes the credentials for a member. The tokens can be
+// introspected only when they have been issued by an instance of this stack.
+type DebugCredentials struct {
+	Member        int         `json:"member"`
+	OAuthClient   bool        `json:"oauth_client"`
+	InboundClient *bool       `json:"inbound_client,omitempty"`
+	AccessToken   *DebugToken `json:"access_token,omitempty"`
+	RefreshToken  *DebugToken `json:"refresh_token,omitempty"`
+}
+
+// DebugToken is the result of the introspection of a token.
+type DebugToken struct {
+	Valid    bool       `json:"valid"`
+	Expired  bool       `json:"expired,omitempty"`
+	IssuedAt *time.Time `json:"issued_at,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// DebugCheckpoint is the last sequence number of the io.cozy.shared changes
+// feed for a worker and a member, with the number of shared docs that have
+// changed since.
+type DebugCheckpoint struct {
+	Member  int    `json:"member"`
+	Worker  string `json:"worker"`
+	LastSeq string `json:"last_seq,omitempty"`
+	Stale   bool   `json:"stale,omitempty"`
+	Pending int    `json:"pending"`
+	// PendingMore is true when there are more pending docs than counted
+	PendingMore bool `json:"pending_more,omitempty"`
+}
+
+// Debug inspects a sharing on all the instances of this stack that are
+// members of it: the credentials, the triggers, the checkpoints of the
+// replications, and the consistency of the trees of files between the owner
+// and the recipients. It is a focused version of CheckSharings.
+func Debug(inst *instance.Instance, sharingID string, skipFSConsistency bool) (*DebugReport, error) {
+	s, err := FindSharing(inst, sharingID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look at the sharing from the point of view of the owner if possible
+	ownerInst := inst
+	if !s.Owner && len(s.Members) > 0 {
+		if o := localInstance(s.Members[0].Instance); o != nil {
+			if owned, err := FindSharing(o, sharingID); err == nil {
+				ownerInst, s = o, owned
+			}
+		}
+	}
+
+	report := &DebugReport{
+		SharingID:   s.SID,
+		Description: s.Description,
+		Rules:       s.Rules,
+		Checks:      []map[string]interface{}{},
+	}
+
+	// The local instances of the members, by index
+	locals := make(map[int]*instance.Instance)
+	for i, m := range s.Members {
+		var local *instance.Instance
+		switch {
+		case i == 0 && s.Owner:
+			local = ownerInst
+		case !s.Owner && localDomain(m.Instance) == inst.Domain:
+			local = inst
+		default:
+			local = localInstance(m.Instance)
+		}
+		if local != nil {
+			locals[i] = local
+		}
+		report.Members = append(report.Members, DebugMember{
+			Index:    i,
+			Status:   m.Status,
+			Name:     m.PrimaryName(),
+			Email:    m.Email,
+			Instance: m.Instance,
+			ReadOnly: m.ReadOnly,
+			Local:    local != nil,
+		})
+	}
+
+	membersChecks, _ := s.checkSharingMembers()
+	report.Checks = append(report.Checks, withInstance(membersChecks, ownerInst.Domain)...)
+
+	copies := make(map[int]*Sharing)
+	for i := 0; i < len(s.Members); i++ {
+		local, ok := locals[i]
+		if !ok {
+			continue
+		}
+		di := &DebugInstance{Domain: local.Domain}
+		report.Instances = append(report.Instances, di)
+		ms := s
+		if local != ownerInst || !s.Owner {
+			if ms, err = FindSharing(local, sharingID); err != nil {
+				di.Error = err.Error()
+				continue
+			}
+		}
+		copies[i] = ms
+		ms.debugInstance(local, di, locals)
+
+		accepted := false
+		for _, m := range ms.Members {
+			if m.Status == MemberStatusReady {
+				accepted = true
+			}
+		}
+		report.Checks = append(report.Checks, withInstance(ms.checkSharingTriggers(local, accepted), local.Domain)...)
+		report.Checks = append(report.Checks, withInstance(ms.checkSharingCredentials(), local.Domain)...)
+	}
+
+	if skipFSConsistency || !s.Owner || !s.Active || s.Initial {
+		return report, nil
+	}
+	rule := s.FirstFilesRule()
+	if rule == nil {
+		return report, nil
+	}
+	ownerDocs, err := FindMatchingDocs(ownerInst, *rule)
+	if err != nil {
+		report.Checks = append(report.Checks, map[string]interface{}{
+			"id":       s.SID,
+			"type":     "missing_matching_docs_for_owner",
+			"instance": ownerInst.Domain,
+			"error":    err.Error(),
+		})
+		return report, nil
+	}
+	for i := 1; i < len(s.Members); i++ {
+		ms, ok := copies[i]
+		if !ok || !ms.Active || s.Members[i].Status != MemberStatusReady {
+			continue
+		}
+		report.Checks = append(report.Checks, s.checkSharingTreesConsistency(ownerInst, ownerDocs, locals[i], ms)...)
+	}
+	return report, nil
+}
+
+// debugInstance fills the state of the sharing on the given instance.
+func (s *Sharing) debugInstance(inst *instance.Instance, di *DebugInstance, locals map[int]*instance.Instance) {
+	di.Owner = s.Owner
+	di.Active = s.Active
+	di.Initial = s.Initial
+	di.ReadOnly = s.ReadOnly()
+	di.UpdatedAt = s.UpdatedAt
+	di.Triggers = s.debugTriggers(inst)
+	di.Credentials = []DebugCredentials{}
+	di.Checkpoints = []DebugCheckpoint{}
+
+	for i := range s.Members {
+		var creds *Credentials
+		switch {
+		case s.Owner && i > 0 && i-1 < len(s.Credentials):
+			creds = &s.Credentials[i-1]
+		case !s.Owner && i == 0 && len(s.Credentials) > 0:
+			creds = &s.Credentials[0]
+		default:
+			continue
+		}
+
+		dc := DebugCredentials{Member: i, OAuthClient: creds.Client != nil}
+		if creds.InboundClientID != "" {
+			_, err := oauth.FindClient(inst, creds.InboundClientID)
+			exists := err == nil
+			dc.InboundClient = &exists
+		}
+		if creds.AccessToken != nil {
+			if issuer, ok := locals[i]; ok {
+				dc.AccessToken = introspectToken(issuer, consts.AccessTokenAudience, creds.AccessToken.AccessToken)
+				dc.RefreshToken = introspectToken(issuer, consts.RefreshTokenAudience, creds.AccessToken.RefreshToken)
+			}
+		}
+		di.Credentials = append(di.Credentials, dc)
+
+		m := &s.Members[i]
+		if m.Status != MemberStatusReady && m.Status != MemberStatusOwner {
+			continue
+		}
+		workers := []string{"replicator"}
+		if s.FirstFilesRule() != nil {
+			workers = append(workers, "upload")
+		}
+		for _, worker := range workers {
+			di.Checkpoints = append(di.Checkpoints, s.debugCheckpoint(inst, m, i, worker))
+		}
+	}
+}
+
+func (s *Sharing) debugTriggers(inst *instance.Instance) []DebugTrigger {
+	triggers := []DebugTrigger{}
+	add := func(worker, id string) {
+		if id == "" {
+			return
+		}
+		err := couchdb.GetDoc(inst, consts.Triggers, id, nil)
+		triggers = append(triggers, DebugTrigger{
+			Worker: worker,
+			ID:     id,
+			Exists: !couchdb.IsNotFoundError(err),
+		})
+	}
+	add("share-track", s.Triggers.TrackID)
+	for _, id := range s.Triggers.TrackIDs {
+		add("share-track", id)
+	}
+	add("share-replicate", s.Triggers.ReplicateID)
+	add("share-upload", s.Triggers.UploadID)
+	add("share-expire", s.Triggers.ExpireID)
+	add("share-expire", s.Triggers.ReminderID)
+	return triggers
+}
+
+func (s *Sharing) debugCheckpoint(inst *instance.Instance, m *Member, index int, worker string) DebugCheckpoint {
+	cp := DebugCheckpoint{Member: index, Worker: worker}
+	seq, err := s.getLastSeqNumber(inst, m, worker)
+	if err != nil {
+		return cp
+	}
+	cp.LastSeq = seq
+	cp.Stale, _ = isStaleCheckpoint(inst, seq)
+	if cp.Stale {
+		return cp
+	}
+	cp.Pending, cp.PendingMore = s.countPendingDocs(inst, seq, worker == "upload")
+	return cp
+}
+
+// countPendingDocs returns the number of shared docs of this sharing that
+// have changed since the given sequence number. The boolean is true if the
+// changes feed has not been read until its end.
+func (s *Sharing) countPendingDocs(inst *instance.Instance, since string, filesOnly bool) (int, bool) {
+	count := 0
+	for i := 0; i < maxDebugChangesBatches; i++ {
+		response, err := couchdb.GetChanges(inst, &couchdb.ChangesRequest{
+			DocType:     consts.Shared,
+			IncludeDocs: true,
+			Since:       since,
+			Limit:       BatchSize,
+		})
+		if err != nil {
+			return count, false
+		}
+		res := changesResponse{
+			Changes:     Changes{Changed: make(Changed), Removed: make(Removed)},
+			RuleIndexes: make(map[string]int),
+		}
+		for _, r := range response.Results {
+			_ = s.addSharedDoc(&res, r.DocID, r.Doc, false)
+		}
+		for docID := range res.Changes.Changed {
+			if !filesOnly || strings.HasPrefix(docID, consts.Files+"/") {
+				count++
+			}
+		}
+		if response.Pending == 0 {
+			return count, false
+		}
+		since = response.LastSeq
+	}
+	return count, true
+}
+
+// introspectToken checks a token issued by an instance of this stack: its
+// signature, its issuer, its expiration, and the OAuth client for which it
+// has been issued.
+func introspectToken(issuer *instance.Instance, audience, token string) *DebugToken {
+	if token == "" {
+		return nil
+	}
+	dt := &DebugToken{}
+	var claims permission.Claims
+	err := crypto.ParseJWT(token, func(t *jwt.Token) (interface{}, error) {
+		return issuer.PickKey(audience)
+	}, &claims)
+	if err != nil {
+		dt.Error = err.Error()
+		return dt
+	}
+	issuedAt := claims.IssuedAtUTC()
+	dt.IssuedAt = &issuedAt
+	if claims.Audience != audience || claims.Issuer != issuer.Domain {
+		dt.Error = "unexpected audience or issuer"
+		return dt
+	}
+	if _, err := oauth.FindClient(issuer, claims.Subject); err != nil {
+		dt.Error = "the OAuth client is missing: " + err.Error()
+		return dt
+	}
+	dt.Expired = claims.Expired()
+	dt.Valid = !dt.Expired
+	return dt
+}
+
+// localDomain returns the domain of the URL of a Cozy instance.
+func localDomain(cozyURL string) string {
+	u, err := url.ParseRequestURI(cozyURL)
+	if err != nil {
+		return ""
+	}
+	domain := strings.ToLower(u.Hostname())
+	if u.Port() != "" {
+		domain += ":" + u.Port()
+	}
+	return domain
+}
+
+// localInstance returns the instance for the given URL if it is on this
+// stack, or nil.
+func localInstance(cozyURL string) *instance.Instance {
+	domain := localDomain(cozyURL)
+	if domain == "" {
+		return nil
+	}
+	inst, err := instance.Get(domain)
+	if err != nil {
+		return nil
+	}
+	return inst
+}
+
+func withInstance(checks []map[string]interface{}, domain string) []map[string]interface{} {
+	for _, check := range checks {
+		if _, ok := check["instance"]; !ok {
+			check["instance"] = domain
+		}
+	}
+	return checks
+}
@@ -0,0 +1,25 @@
+package sharing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebug(t *testing.T) {
+	t.Run("LocalDomain", func(t *testing.T) {
+		assert.Equal(t, "bob.cozy.example", localDomain("https://Bob.cozy.example/"))
+		assert.Equal(t, "bob.cozy.localhost:8080", localDomain("http://bob.cozy.localhost:8080"))
+		assert.Equal(t, "", localDomain("bob.cozy.example"))
+		assert.Equal(t, "", localDomain(""))
+	})
+
+	t.Run("WithInstance", func(t *testing.T) {
+		checks := withInstance([]map[string]interface{}{
+			{"type": "missing_trigger_on_active_sharing"},
+			{"type": "sharing_in_sharing", "instance": "bob.cozy.example"},
+		}, "alice.cozy.example")
+		assert.Equal(t, "alice.cozy.example", checks[0]["instance"])
+		assert.Equal(t, "bob.cozy.example", checks[1]["instance"])
+	})
+}
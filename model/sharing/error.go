@@ -9,6 +9,9 @@ var (
 	ErrNoRecipients = errors.New("A sharing must have recipients")
 	// ErrTooManyMembers is used when a sharing has too many members
 	ErrTooManyMembers = errors.New("There are too many members for this sharing")
+	// ErrTooManySharings is used when the maximal number of active sharings
+	// for the instance has been reached
+	ErrTooManySharings = errors.New("The maximal number of sharings has been reached")
 	// ErrInvalidURL is used for invalid URL of a Cozy instance
 	ErrInvalidURL = errors.New("The Cozy URL is invalid")
 	// ErrInvalidRule is used when a rule is invalid when the sharing is
@@ -44,6 +47,9 @@ var (
 	// ErrFolderNotFound is used when informations about a folder is asked,
 	// but this folder was not found
 	ErrFolderNotFound = errors.New("This folder was not found")
+	// ErrFileNotFound is used when the content of a file of a sharing in
+	// metadata-only mode is asked, but the file cannot be found
+	ErrFileNotFound = errors.New("This file was not found")
 	// ErrSafety is used when an operation is aborted due to the safety principal
 	ErrSafety = errors.New("Operation aborted")
 	// ErrAlreadyAccepted is used when someone tries to accept twice a sharing
@@ -51,4 +57,25 @@ var (
 	ErrAlreadyAccepted = errors.New("Sharing already accepted by this recipient")
 	// ErrCannotOpenFile is used when opening a file fails
 	ErrCannotOpenFile = errors.New("The file cannot be opened")
+	// ErrMemberNotVerified is used when a new member of an open sharing must
+	// prove their identity before accepting the sharing
+	ErrMemberNotVerified = errors.New("The identity of the member must be verified")
+	// ErrInvalidVerificationCode is used when the code sent by email to verify
+	// the identity of a member is wrong or has expired
+	ErrInvalidVerificationCode = errors.New("The verification code is invalid")
+	// ErrVerificationLocked is used when too many verification codes have
+	// been sent to a member of an open sharing
+	ErrVerificationLocked = errors.New("Too many verification codes have been sent")
+	// ErrNotTracked is used when a document should be in a sharing, but it is
+	// not tracked in io.cozy.shared for this sharing
+	ErrNotTracked = errors.New("The document is not tracked by this sharing")
+	// ErrInvalidSignature is used when a request from another member of the
+	// sharing has no valid signature
+	ErrInvalidSignature = errors.New("The signature of the request is invalid")
+	// ErrInvalidWebhookEvent is used when the webhook of a sharing is
+	// registered for an unknown event
+	ErrInvalidWebhookEvent = errors.New("Invalid event for the webhook")
+	// ErrInvalidExpiration is used when the expiration date of a sharing is
+	// not in the future
+	ErrInvalidExpiration = errors.New("The expiration date must be in the future")
 )
@@ -0,0 +1,199 @@
+package sharing
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/mail"
+)
+
+// reminderBeforeExpiration is how long before the expiration of a sharing the
+// owner and the members are reminded of it.
+const reminderBeforeExpiration = 3 * 24 * time.Hour
+
+// ExpireMessage is the message of the share-expire jobs. The expiration date
+// is used to ignore the jobs of a previous expiration date.
+type ExpireMessage struct {
+	SharingID string    `json:"sharing_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Reminder  bool      `json:"reminder,omitempty"`
+}
+
+// ExpirationReminderCallback is a function called on the owner's instance
+// before a sharing expires.
+type ExpirationReminderCallback func(inst *instance.Instance, s *Sharing)
+
+var expirationReminderCallback ExpirationReminderCallback
+
+// RegisterExpirationReminderCallback allows to register a callback function
+// called when the owner of a sharing must be reminded that it will expire.
+func RegisterExpirationReminderCallback(cb ExpirationReminderCallback) {
+	expirationReminderCallback = cb
+}
+
+// SetExpiration changes the date when the sharing is automatically revoked.
+// The expiration is removed if the date is nil.
+func (s *Sharing) SetExpiration(inst *instance.Instance, at *time.Time) error {
+	if !s.Owner || !s.Active {
+		return ErrInvalidSharing
+	}
+	if at != nil && !at.After(time.Now()) {
+		return ErrInvalidExpiration
+	}
+	if err := s.removeExpirationTriggers(inst); err != nil {
+		return err
+	}
+	if at == nil {
+		s.ExpiresAt = nil
+	} else {
+		expiresAt := at.UTC()
+		s.ExpiresAt = &expiresAt
+		if err := s.scheduleExpiration(inst); err != nil {
+			return err
+		}
+	}
+	return couchdb.UpdateDoc(inst, s)
+}
+
+// scheduleExpiration adds the triggers for revoking the sharing at its
+// expiration date, and for reminding it to the owner and the members before.
+// The sharing document must be saved after that.
+func (s *Sharing) scheduleExpiration(inst *instance.Instance) error {
+	expiresAt := *s.ExpiresAt
+	id, err := addExpirationTrigger(inst, expiresAt, &ExpireMessage{
+		SharingID: s.SID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	s.Triggers.ExpireID = id
+
+	remindAt := expiresAt.Add(-reminderBeforeExpiration)
+	if remindAt.After(time.Now()) {
+		id, err = addExpirationTrigger(inst, remindAt, &ExpireMessage{
+			SharingID: s.SID,
+			ExpiresAt: expiresAt,
+			Reminder:  true,
+		})
+		if err != nil {
+			return err
+		}
+		s.Triggers.ReminderID = id
+	}
+	return nil
+}
+
+func addExpirationTrigger(inst *instance.Instance, at time.Time, msg *ExpireMessage) (string, error) {
+	m, err := job.NewMessage(msg)
+	if err != nil {
+		return "", err
+	}
+	t, err := job.NewTrigger(inst, job.TriggerInfos{
+		Type:       "@at",
+		WorkerType: "share-expire",
+		Arguments:  at.Format(time.RFC3339),
+	}, m)
+	if err != nil {
+		return "", err
+	}
+	if err = job.System().AddTrigger(t); err != nil {
+		return "", err
+	}
+	return t.ID(), nil
+}
+
+func (s *Sharing) removeExpirationTriggers(inst *instance.Instance) error {
+	if err := removeSharingTrigger(inst, s.Triggers.ExpireID); err != nil {
+		return err
+	}
+	if err := removeSharingTrigger(inst, s.Triggers.ReminderID); err != nil {
+		return err
+	}
+	s.Triggers.ExpireID = ""
+	s.Triggers.ReminderID = ""
+	return nil
+}
+
+// Expire is called by the share-expire worker, to revoke the sharing at its
+// expiration date, or to send the reminders before that.
+func Expire(inst *instance.Instance, msg *ExpireMessage) error {
+	s, err := FindSharing(inst, msg.SharingID)
+	if couchdb.IsNotFoundError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The expiration may have been removed or changed since the trigger was
+	// added
+	if !s.Owner || !s.Active || s.ExpiresAt == nil || !s.ExpiresAt.Equal(msg.ExpiresAt) {
+		return nil
+	}
+
+	if msg.Reminder {
+		s.Triggers.ReminderID = ""
+		if err := couchdb.UpdateDoc(inst, s); err != nil {
+			return err
+		}
+		s.sendExpirationReminders(inst)
+		return nil
+	}
+
+	inst.Logger().WithNamespace("sharing").
+		Infof("Sharing %s has expired and is revoked", s.SID)
+	s.Triggers.ExpireID = ""
+	return s.Revoke(inst)
+}
+
+// sendExpirationReminders notifies the owner, and sends a mail to the members,
+// that the sharing will expire soon.
+func (s *Sharing) sendExpirationReminders(inst *instance.Instance) {
+	if expirationReminderCallback != nil {
+		expirationReminderCallback(inst, s)
+	}
+	sharer, err := csettings.PublicName(inst)
+	if err != nil {
+		sharer = inst.Domain
+	}
+	for i, m := range s.Members {
+		if i == 0 || m.Email == "" || m.Status != MemberStatusReady {
+			continue
+		}
+		if err := m.sendExpirationMail(inst, s, sharer); err != nil {
+			inst.Logger().WithNamespace("sharing").
+				Warnf("Cannot send the expiration mail: %s", err)
+		}
+	}
+}
+
+func (m *Member) sendExpirationMail(inst *instance.Instance, s *Sharing, sharer string) error {
+	addr := &mail.Address{
+		Email: m.Email,
+		Name:  m.PrimaryName(),
+	}
+	mailValues := map[string]interface{}{
+		"SharerPublicName": sharer,
+		"Description":      s.Description,
+		"Date":             s.ExpiresAt.Format("2006-01-02"),
+	}
+	msg, err := job.NewMessage(mail.Options{
+		Mode:           "from",
+		To:             []*mail.Address{addr},
+		TemplateName:   "sharing_expiration",
+		TemplateValues: mailValues,
+		RecipientName:  addr.Name,
+		Layout:         mail.CozyCloudLayout,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "sendmail",
+		Message:    msg,
+	})
+	return err
+}
@@ -0,0 +1,33 @@
+package sharing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiration(t *testing.T) {
+	t.Run("SetExpirationChecks", func(t *testing.T) {
+		future := time.Now().Add(time.Hour)
+		past := time.Now().Add(-time.Hour)
+
+		s := &Sharing{Owner: false, Active: true}
+		assert.Equal(t, ErrInvalidSharing, s.SetExpiration(nil, &future))
+
+		s = &Sharing{Owner: true, Active: false}
+		assert.Equal(t, ErrInvalidSharing, s.SetExpiration(nil, &future))
+
+		s = &Sharing{Owner: true, Active: true}
+		assert.Equal(t, ErrInvalidExpiration, s.SetExpiration(nil, &past))
+		assert.Nil(t, s.ExpiresAt)
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		s := &Sharing{ExpiresAt: &at}
+		cloned := s.Clone().(*Sharing)
+		*cloned.ExpiresAt = at.Add(time.Hour)
+		assert.Equal(t, at, *s.ExpiresAt)
+	})
+}
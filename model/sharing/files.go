@@ -111,6 +111,7 @@ func (s *Sharing) SortFilesToSent(files []map[string]interface{}) {
 // - its dir_id is XORed or removed
 // - the referenced_by are XORed or removed
 // - the path is removed (directory only)
+// - the favorite flag and the labels are removed (unless SyncAnnotations)
 //
 // ruleIndexes is a map of "doctype-docid" -> rule index
 func (s *Sharing) TransformFileToSent(doc map[string]interface{}, xorKey []byte, ruleIndex int) {
@@ -118,6 +119,12 @@ func (s *Sharing) TransformFileToSent(doc map[string]interface{}, xorKey []byte,
 		delete(doc, "path")
 		delete(doc, "not_synchronized_on")
 	}
+	if !s.SyncAnnotations {
+		if meta, ok := doc["cozyMetadata"].(map[string]interface{}); ok {
+			delete(meta, "favorite")
+			delete(meta, "labels")
+		}
+	}
 	id := doc["_id"].(string)
 	doc["_id"] = XorID(id, xorKey)
 	dir, ok := doc["dir_id"].(string)
@@ -208,7 +215,7 @@ func EnsureSharedWithMeDir(inst *instance.Instance) (*vfs.DirDoc, error) {
 		} else {
 			dir.CozyMetadata.UpdatedAt = now
 		}
-		_, err = vfs.RestoreDir(fs, dir)
+		_, err = vfs.RestoreDir(fs, dir, nil)
 		if err != nil {
 			inst.Logger().WithNamespace("sharing").
 				Warnf("EnsureSharedWithMeDir failed to restore the dir: %s", err)
@@ -469,7 +476,7 @@ func (s *Sharing) GetNoLongerSharedDir(inst *instance.Instance) (*vfs.DirDoc, er
 			dir.CozyMetadata.UpdatedAt = now
 		}
 		dir.CozyMetadata.UpdatedAt = now
-		_, err = vfs.RestoreDir(fs, dir)
+		_, err = vfs.RestoreDir(fs, dir, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -547,6 +554,15 @@ func (s *Sharing) ApplyBulkFiles(inst *instance.Instance, docs DocsList) error {
 			errm = multierror.Append(errm, ErrMissingID)
 			continue
 		}
+		if _, ok := target["_deleted"]; ok && s.MetadataOnly {
+			removed, err := s.removeRemoteFile(inst, id)
+			if err != nil {
+				errm = multierror.Append(errm, err)
+			}
+			if removed || err != nil {
+				continue
+			}
+		}
 		ref := &SharedRef{}
 		err := couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+id, ref)
 		if err != nil {
@@ -580,9 +596,11 @@ func (s *Sharing) ApplyBulkFiles(inst *instance.Instance, docs DocsList) error {
 				continue
 			}
 			if dir == nil && file == nil {
-				continue
-			}
-			if dir != nil {
+				if ref.LocalID == "" {
+					continue
+				}
+				err = s.unlinkLocalCopy(inst, ref)
+			} else if dir != nil {
 				err = s.TrashDir(inst, dir)
 			} else {
 				err = s.TrashFile(inst, file, &s.Rules[infos.Rule])
@@ -673,7 +691,8 @@ func buildReferencedBy(target, file *vfs.FileDoc, rule *Rule) []couchdb.DocRefer
 	return refs
 }
 
-func copySafeFieldsToFile(target, file *vfs.FileDoc) {
+func (s *Sharing) copySafeFieldsToFile(target, file *vfs.FileDoc) {
+	local := file.CozyMetadata
 	file.Tags = target.Tags
 	file.Metadata = target.Metadata.RemoveCertifiedMetadata()
 	file.CreatedAt = target.CreatedAt
@@ -682,9 +701,20 @@ func copySafeFieldsToFile(target, file *vfs.FileDoc) {
 	file.Class = target.Class
 	file.Executable = target.Executable
 	file.CozyMetadata = target.CozyMetadata
+	file.CustomMetadata = target.CustomMetadata
+	if !s.SyncAnnotations {
+		file.CozyMetadata = keepLocalAnnotations(file.CozyMetadata, local)
+	}
 }
 
-func copySafeFieldsToDir(target map[string]interface{}, dir *vfs.DirDoc) {
+func (s *Sharing) copySafeFieldsToDir(target map[string]interface{}, dir *vfs.DirDoc) {
+	local := dir.CozyMetadata
+	defer func() {
+		if !s.SyncAnnotations {
+			dir.CozyMetadata = keepLocalAnnotations(dir.CozyMetadata, local)
+		}
+	}()
+
 	if tags, ok := target["tags"].([]interface{}); ok {
 		dir.Tags = make([]string, 0, len(tags))
 		for _, tag := range tags {
@@ -708,6 +738,15 @@ func copySafeFieldsToDir(target map[string]interface{}, dir *vfs.DirDoc) {
 		dir.Metadata = vfs.Metadata(meta).RemoveCertifiedMetadata()
 	}
 
+	if custom, ok := target["custom_metadata"].(map[string]interface{}); ok {
+		dir.CustomMetadata = make(vfs.CustomMetadata, len(custom))
+		for slug, values := range custom {
+			if vals, ok := values.(map[string]interface{}); ok {
+				dir.CustomMetadata[slug] = vals
+			}
+		}
+	}
+
 	if meta, ok := target["cozyMetadata"].(map[string]interface{}); ok {
 		dir.CozyMetadata = &vfs.FilesCozyMetadata{}
 		if version, ok := meta["doctypeVersion"].(string); ok {
@@ -763,9 +802,36 @@ func copySafeFieldsToDir(target map[string]interface{}, dir *vfs.DirDoc) {
 		if id, ok := meta["sourceAccountIdentifier"].(string); ok {
 			dir.CozyMetadata.SourceIdentifier = id
 		}
+		if favorite, ok := meta["favorite"].(bool); ok {
+			dir.CozyMetadata.Favorite = favorite
+		}
+		if labels, ok := meta["labels"].([]interface{}); ok {
+			for _, label := range labels {
+				if l, ok := label.(string); ok {
+					dir.CozyMetadata.Labels = append(dir.CozyMetadata.Labels, l)
+				}
+			}
+		}
 	}
 }
 
+// keepLocalAnnotations returns the cozyMetadata received from another member
+// of the sharing, with the favorite flag and the labels of the local
+// document, as they are private to each member.
+func keepLocalAnnotations(fcm, local *vfs.FilesCozyMetadata) *vfs.FilesCozyMetadata {
+	if fcm == nil || fcm == local {
+		return fcm
+	}
+	fcm = fcm.Clone()
+	fcm.Favorite = false
+	fcm.Labels = nil
+	if local != nil {
+		fcm.Favorite = local.Favorite
+		fcm.Labels = local.Labels
+	}
+	return fcm
+}
+
 // resolveConflictSamePath is used when two files/folders are in conflict
 // because they have the same path. To resolve the conflict, we take the
 // file/folder from the owner instance as the winner and rename the other.
@@ -831,7 +897,9 @@ func (s *Sharing) getDirDocFromInstance(inst *instance.Instance, m *Member, cred
 			"Authorization": "Bearer " + creds.AccessToken.AccessToken,
 		},
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	creds.signRequest(opts, nil)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, m, creds, opts, nil)
@@ -980,7 +1048,7 @@ func (s *Sharing) CreateDir(inst *instance.Instance, target map[string]interface
 	}
 	dir.SetID(target["_id"].(string))
 	ref.SID = consts.Files + "/" + dir.DocID
-	copySafeFieldsToDir(target, dir)
+	s.copySafeFieldsToDir(target, dir)
 	rule, ruleIndex := s.findRuleForNewDirectory(dir)
 	if rule == nil {
 		return ErrSafety
@@ -1074,7 +1142,7 @@ func (s *Sharing) UpdateDir(
 	if err = s.prepareDirWithAncestors(inst, dir, dirID); err != nil {
 		return err
 	}
-	copySafeFieldsToDir(target, dir)
+	s.copySafeFieldsToDir(target, dir)
 
 	err = fs.UpdateDirDoc(oldDoc, dir)
 	if errors.Is(err, os.ErrExist) && resolution == resolveResolution {
@@ -1296,6 +1364,9 @@ func dirToJSONDoc(dir *vfs.DirDoc, instanceURL string) couchdb.JSONDoc {
 	if len(dir.Metadata) > 0 {
 		doc.M["metadata"] = dir.Metadata.RemoveCertifiedMetadata()
 	}
+	if len(dir.CustomMetadata) > 0 {
+		doc.M["custom_metadata"] = dir.CustomMetadata
+	}
 	fcm := dir.CozyMetadata
 	if fcm == nil {
 		fcm = vfs.NewCozyMetadata(instanceURL)
@@ -1335,6 +1406,9 @@ func fileToJSONDoc(file *vfs.FileDoc, instanceURL string) couchdb.JSONDoc {
 	if len(file.Metadata) > 0 {
 		doc.M["metadata"] = file.Metadata.RemoveCertifiedMetadata()
 	}
+	if len(file.CustomMetadata) > 0 {
+		doc.M["custom_metadata"] = file.CustomMetadata
+	}
 	fcm := file.CozyMetadata
 	if fcm == nil {
 		fcm = vfs.NewCozyMetadata(instanceURL)
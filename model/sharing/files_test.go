@@ -286,6 +286,155 @@ func TestFiles(t *testing.T) {
 		}
 		assert.Equal(t, 8, s.countFiles(inst))
 	})
+
+	t.Run("LinkLocalCopy", func(t *testing.T) {
+		fs := inst.VFS()
+		content := []byte("a photo of the family")
+		doc, err := vfs.NewFileDoc("family.jpg", consts.RootDirID, int64(len(content)), nil, "image/jpeg", "image", time.Now(), false, false, false, nil)
+		require.NoError(t, err)
+		f, err := fs.CreateFile(doc, nil)
+		require.NoError(t, err)
+		_, err = f.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		local, err := fs.FileByPath("/family.jpg")
+		require.NoError(t, err)
+
+		album := couchdb.DocReference{Type: consts.PhotosAlbums, ID: "album-link"}
+		other := couchdb.DocReference{Type: consts.PhotosAlbums, ID: "album-link-2"}
+		s := &Sharing{SID: "sharing-link", Rules: []Rule{{
+			Title:    "photos",
+			DocType:  consts.Files,
+			Selector: couchdb.SelectorReferencedBy,
+			Values: []string{
+				consts.PhotosAlbums + "/album-link",
+				consts.PhotosAlbums + "/album-link-2",
+			},
+		}}}
+		require.NoError(t, couchdb.CreateNamedDoc(inst, s))
+		target := &FileDocWithRevisions{
+			FileDoc: &vfs.FileDoc{
+				DocID:        "target-of-the-family-photo",
+				DocRev:       "1-aaa",
+				DocName:      "family.jpg",
+				ByteSize:     local.ByteSize,
+				MD5Sum:       local.MD5Sum,
+				ReferencedBy: []couchdb.DocReference{album},
+			},
+			Revisions: RevsStruct{Start: 1, IDs: []string{"aaa"}},
+		}
+
+		// The recipient has not allowed the local copies
+		linked, err := s.linkLocalCopy(inst, target, 0)
+		require.NoError(t, err)
+		assert.False(t, linked)
+		require.NoError(t, s.SetLinkLocalCopies(inst, true))
+
+		key, err := s.SyncFile(inst, target)
+		require.NoError(t, err)
+		assert.Nil(t, key)
+		local, err = fs.FileByID(local.DocID)
+		require.NoError(t, err)
+		assert.Equal(t, []couchdb.DocReference{album}, local.ReferencedBy)
+		_, err = fs.FileByID(target.DocID)
+		assert.Error(t, err)
+
+		var ref SharedRef
+		require.NoError(t, couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+target.DocID, &ref))
+		assert.Equal(t, local.DocID, ref.LocalID)
+		assert.Contains(t, ref.Infos, s.SID)
+
+		// The local file is not sent back to the owner
+		msg := TrackMessage{SharingID: s.SID, RuleIndex: 0, DocType: consts.Files}
+		evt := TrackEvent{Verb: "UPDATED", Doc: couchdb.JSONDoc{
+			Type: consts.Files,
+			M: map[string]interface{}{
+				"_id":                        local.DocID,
+				"_rev":                       local.DocRev,
+				"type":                       consts.FileType,
+				couchdb.SelectorReferencedBy: []interface{}{map[string]interface{}{"type": album.Type, "id": album.ID}},
+			},
+		}}
+		require.NoError(t, UpdateShared(inst, msg, evt))
+		var localRef SharedRef
+		require.NoError(t, couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+local.DocID, &localRef))
+		assert.Equal(t, target.DocID, localRef.Links[s.SID])
+		assert.NotContains(t, localRef.Infos, s.SID)
+
+		// The owner adds the photo to another album
+		target.DocRev = "2-bbb"
+		target.Revisions = RevsStruct{Start: 2, IDs: []string{"bbb", "aaa"}}
+		target.ReferencedBy = []couchdb.DocReference{album, other}
+		key, err = s.SyncFile(inst, target)
+		require.NoError(t, err)
+		assert.Nil(t, key)
+		local, err = fs.FileByID(local.DocID)
+		require.NoError(t, err)
+		assert.True(t, vfs.SameReferences([]couchdb.DocReference{album, other}, local.ReferencedBy))
+		require.NoError(t, couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+target.DocID, &ref))
+		sub, _ := ref.Revisions.Find("2-bbb")
+		assert.NotNil(t, sub)
+
+		// The owner deletes the photo
+		docs := DocsList{{"_id": target.DocID, "_rev": "3-ccc", "_deleted": true}}
+		require.NoError(t, s.ApplyBulkFiles(inst, docs))
+		local, err = fs.FileByID(local.DocID)
+		require.NoError(t, err)
+		assert.Empty(t, local.ReferencedBy)
+		assert.False(t, local.Trashed)
+		err = couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+target.DocID, &ref)
+		assert.True(t, couchdb.IsNotFoundError(err))
+		err = couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+local.DocID, &localRef)
+		assert.True(t, couchdb.IsNotFoundError(err))
+
+		// The size must also match
+		target.ByteSize++
+		linked, err = s.linkLocalCopy(inst, target, 0)
+		require.NoError(t, err)
+		assert.False(t, linked)
+	})
+
+	t.Run("Annotations", func(t *testing.T) {
+		target := &vfs.FileDoc{CozyMetadata: vfs.NewCozyMetadata("https://alice.cozy.localhost/")}
+		target.CozyMetadata.Favorite = true
+		target.CozyMetadata.Labels = []string{"red"}
+
+		local := &vfs.FileDoc{CozyMetadata: vfs.NewCozyMetadata("https://bob.cozy.localhost/")}
+		local.CozyMetadata.Labels = []string{"blue"}
+		s := &Sharing{}
+		s.copySafeFieldsToFile(target, local)
+		assert.False(t, local.CozyMetadata.Favorite)
+		assert.Equal(t, []string{"blue"}, local.CozyMetadata.Labels)
+		assert.Equal(t, "https://alice.cozy.localhost/", local.CozyMetadata.CreatedOn)
+		assert.True(t, target.CozyMetadata.Favorite)
+
+		created := &vfs.FileDoc{}
+		s.copySafeFieldsToFile(target, created)
+		assert.False(t, created.CozyMetadata.Favorite)
+		assert.Nil(t, created.CozyMetadata.Labels)
+
+		synced := &vfs.FileDoc{}
+		s.SyncAnnotations = true
+		s.copySafeFieldsToFile(target, synced)
+		assert.True(t, synced.CozyMetadata.Favorite)
+		assert.Equal(t, []string{"red"}, synced.CozyMetadata.Labels)
+
+		s = &Sharing{Rules: []Rule{{DocType: consts.Files, Values: []string{"foo"}}}}
+		doc := map[string]interface{}{
+			"_id":  "bar",
+			"type": consts.FileType,
+			"cozyMetadata": map[string]interface{}{
+				"createdOn": "https://alice.cozy.localhost/",
+				"favorite":  true,
+				"labels":    []interface{}{"red"},
+			},
+		}
+		s.TransformFileToSent(doc, []byte{0}, 0)
+		meta := doc["cozyMetadata"].(map[string]interface{})
+		assert.NotContains(t, meta, "favorite")
+		assert.NotContains(t, meta, "labels")
+		assert.Equal(t, "https://alice.cozy.localhost/", meta["createdOn"])
+	})
 }
 
 type H map[string]H
@@ -0,0 +1,269 @@
+package sharing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/permission"
+	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/labstack/echo/v4"
+)
+
+// IdentityMsg is used for jobs on the share-identity worker.
+type IdentityMsg struct {
+	OldEmail string `json:"old_email"`
+}
+
+// PushIdentityJob pushes a job to propagate the new identity of the instance
+// to its sharings, after its email has been changed.
+func PushIdentityJob(inst *instance.Instance, oldEmail string) error {
+	msg, err := job.NewMessage(&IdentityMsg{OldEmail: oldEmail})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "share-identity",
+		Message:    msg,
+	})
+	return err
+}
+
+// ChangeIdentity is called when the email of the instance has changed. For
+// each active sharing, it updates the member for this instance, re-issues the
+// sharecodes that were keyed by the old email, and informs the other members
+// of the new identity, with new tokens.
+func ChangeIdentity(inst *instance.Instance, oldEmail string) error {
+	email, err := inst.SettingsEMail()
+	if err != nil {
+		return err
+	}
+	publicName, _ := csettings.PublicName(inst)
+
+	var sharings []*Sharing
+	req := couchdb.AllDocsRequest{Limit: 1000}
+	if err := couchdb.GetAllDocs(inst, consts.Sharings, &req, &sharings); err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil
+		}
+		return err
+	}
+
+	var errm error
+	for _, s := range sharings {
+		if strings.HasPrefix(s.ID(), "_design") || !s.Active {
+			continue
+		}
+		if err := s.changeIdentity(inst, oldEmail, email, publicName); err != nil {
+			errm = multierror.Append(errm, err)
+		}
+	}
+	return errm
+}
+
+func (s *Sharing) changeIdentity(inst *instance.Instance, oldEmail, email, publicName string) error {
+	index := s.selfMemberIndex(inst, oldEmail)
+	if index < 0 {
+		return nil
+	}
+	s.Members[index].Email = email
+	s.Members[index].PublicName = publicName
+	if err := couchdb.UpdateDoc(inst, s); err != nil {
+		return err
+	}
+
+	// The sharecodes are on the owner's instance, and they are re-issued when
+	// it receives the new identity of the recipient
+	if !s.Owner {
+		return s.notifyIdentity(inst, 0, email, publicName)
+	}
+	var errm error
+	for i, m := range s.Members {
+		if i == 0 || m.Status != MemberStatusReady {
+			continue
+		}
+		if err := s.notifyIdentity(inst, i, email, publicName); err != nil {
+			errm = multierror.Append(errm, err)
+		}
+	}
+	return errm
+}
+
+// selfMemberIndex returns the index of the member for the given instance, or
+// -1 if it is not found.
+func (s *Sharing) selfMemberIndex(inst *instance.Instance, oldEmail string) int {
+	if s.Owner {
+		return 0
+	}
+	self := inst.PageURL("", nil)
+	for i, m := range s.Members {
+		if i == 0 {
+			continue
+		}
+		if m.Instance != "" && m.Instance == self {
+			return i
+		}
+	}
+	for i, m := range s.Members {
+		if i == 0 {
+			continue
+		}
+		if oldEmail != "" && m.Email == oldEmail {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Sharing) notifyIdentity(inst *instance.Instance, index int, email, publicName string) error {
+	u, err := url.Parse(s.Members[index].Instance)
+	if s.Members[index].Instance == "" || err != nil {
+		return err
+	}
+
+	credIndex := 0
+	if s.Owner {
+		credIndex = index - 1
+	}
+	if len(s.Credentials) <= credIndex || s.Credentials[credIndex].AccessToken == nil {
+		return errors.New("sharing in invalid state")
+	}
+
+	// The tokens given to the other member are rotated, as they were
+	// issued for the old identity
+	cli := &oauth.Client{ClientID: s.Credentials[credIndex].InboundClientID}
+	newToken, err := CreateAccessToken(inst, cli, s.ID(), permission.ALL)
+	if err != nil {
+		return err
+	}
+	identity := APIIdentity{
+		SharingID:    s.ID(),
+		Email:        email,
+		PublicName:   publicName,
+		AccessToken:  newToken.AccessToken,
+		RefreshToken: newToken.RefreshToken,
+	}
+	data, err := jsonapi.MarshalObject(&identity)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(jsonapi.Document{Data: &data})
+	if err != nil {
+		return err
+	}
+
+	token := s.Credentials[credIndex].AccessToken.AccessToken
+	opts := &request.Options{
+		Method: http.MethodPost,
+		Scheme: u.Scheme,
+		Domain: u.Host,
+		Path:   "/sharings/" + s.SID + "/recipients/self/identity",
+		Headers: request.Headers{
+			echo.HeaderAccept:        jsonapi.ContentType,
+			echo.HeaderContentType:   jsonapi.ContentType,
+			echo.HeaderAuthorization: "Bearer " + token,
+		},
+		Body:       bytes.NewReader(body),
+		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
+	}
+	s.Credentials[credIndex].signRequest(opts, body)
+	res, err := request.Req(opts)
+	if res != nil && res.StatusCode/100 == 4 {
+		res, err = RefreshToken(inst, err, s, &s.Members[index], &s.Credentials[credIndex], opts, body)
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// ChangeOwnerIdentity is used when the owner of the sharing has changed their
+// email or public name, and a recipient is informed of it.
+func (s *Sharing) ChangeOwnerIdentity(inst *instance.Instance, params APIIdentity) error {
+	if len(s.Credentials) == 0 {
+		return ErrInvalidSharing
+	}
+	s.Members[0].Email = params.Email
+	s.Members[0].PublicName = params.PublicName
+	rotateTokens(&s.Credentials[0], params)
+	return couchdb.UpdateDoc(inst, s)
+}
+
+// ChangeMemberIdentity is used when a recipient of the sharing has changed
+// their email or public name, and the owner is informed of it. The sharecodes
+// keyed by the old email are re-issued, and the other recipients are notified
+// of the new list of members.
+func (s *Sharing) ChangeMemberIdentity(inst *instance.Instance, m *Member, params APIIdentity) error {
+	if creds := s.FindCredentials(m); creds != nil {
+		rotateTokens(creds, params)
+	}
+	oldEmail := m.Email
+	m.Email = params.Email
+	m.PublicName = params.PublicName
+	if err := couchdb.UpdateDoc(inst, s); err != nil {
+		return err
+	}
+	if oldEmail != "" && oldEmail != params.Email {
+		if err := s.reissueCodes(inst, oldEmail); err != nil {
+			return err
+		}
+	}
+	go s.NotifyRecipients(inst, m)
+	return nil
+}
+
+func rotateTokens(creds *Credentials, params APIIdentity) {
+	if creds.AccessToken == nil || params.AccessToken == "" {
+		return
+	}
+	creds.AccessToken.AccessToken = params.AccessToken
+	creds.AccessToken.RefreshToken = params.RefreshToken
+}
+
+// reissueCodes replaces the sharecodes keyed by the old email of a member. The
+// preview codes are created again for the current members, and the interact
+// code is removed, to be created again on the next access.
+func (s *Sharing) reissueCodes(inst *instance.Instance, oldEmail string) error {
+	if _, err := permission.GetForSharePreview(inst, s.SID); err == nil {
+		if _, err := s.CreatePreviewPermissions(inst); err != nil {
+			return err
+		}
+	} else if !couchdb.IsNotFoundError(err) {
+		return err
+	}
+
+	interact, err := permission.GetForShareInteract(inst, s.SID)
+	if err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+	if removeCodes(interact, oldEmail) {
+		return couchdb.UpdateDoc(inst, interact)
+	}
+	return nil
+}
+
+// removeCodes removes the codes for the given key from the permission, and
+// returns true if the permission has been modified.
+func removeCodes(perms *permission.Permission, key string) bool {
+	_, okCode := perms.Codes[key]
+	_, okShort := perms.ShortCodes[key]
+	delete(perms.Codes, key)
+	delete(perms.ShortCodes, key)
+	return okCode || okShort
+}
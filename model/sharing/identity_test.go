@@ -0,0 +1,45 @@
+package sharing
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentity(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("SelfMemberIndex", func(t *testing.T) {
+		inst := &instance.Instance{Domain: "bob.cozy.example"}
+		owner := &Sharing{Owner: true, Members: []Member{
+			{Email: "alice@example.net"},
+			{Email: "bob@example.net"},
+		}}
+		assert.Equal(t, 0, owner.selfMemberIndex(inst, "bob@example.net"))
+
+		s := &Sharing{Members: []Member{
+			{Email: "alice@example.net", Instance: "https://alice.cozy.example/"},
+			{Email: "bob@example.net"},
+			{Email: "charlie@example.net", Instance: inst.PageURL("", nil)},
+		}}
+		assert.Equal(t, 2, s.selfMemberIndex(inst, "bob@example.net"))
+		s.Members[2].Instance = ""
+		assert.Equal(t, 1, s.selfMemberIndex(inst, "bob@example.net"))
+		assert.Equal(t, -1, s.selfMemberIndex(inst, "dave@example.net"))
+		assert.Equal(t, -1, s.selfMemberIndex(inst, "alice@example.net"))
+	})
+
+	t.Run("RemoveCodes", func(t *testing.T) {
+		perms := &permission.Permission{
+			Codes:      map[string]string{"bob@example.net": "code-bob", "charlie@example.net": "code-charlie"},
+			ShortCodes: map[string]string{"bob@example.net": "short-bob"},
+		}
+		assert.True(t, removeCodes(perms, "bob@example.net"))
+		assert.Equal(t, map[string]string{"charlie@example.net": "code-charlie"}, perms.Codes)
+		assert.Empty(t, perms.ShortCodes)
+		assert.False(t, removeCodes(perms, "bob@example.net"))
+	})
+}
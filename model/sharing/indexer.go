@@ -139,6 +139,10 @@ func (s *sharingIndexer) VersionsUsage() (int64, error) {
 	return s.indexer.VersionsUsage()
 }
 
+func (s *sharingIndexer) ColdUsage() (int64, error) {
+	return s.indexer.ColdUsage()
+}
+
 func (s *sharingIndexer) TrashUsage() (int64, error) {
 	return s.indexer.TrashUsage()
 }
@@ -264,13 +268,20 @@ func (s *sharingIndexer) bulkForceUpdateDoc(olddoc, doc *vfs.FileDoc) error {
 	if doc.CozyMetadata != nil {
 		docs[0]["cozyMetadata"] = doc.CozyMetadata
 	}
+	if len(doc.CustomMetadata) > 0 {
+		docs[0]["custom_metadata"] = doc.CustomMetadata
+	}
 	if doc.InternalID != "" {
 		docs[0]["internal_vfs_id"] = doc.InternalID
 	}
 	doc.SetRev(s.bulkRevs.Rev)
 	s.setDirOrFileRevisions(nil, olddoc, docs[0])
 
-	return couchdb.BulkForceUpdateDocs(s.db, consts.Files, docs)
+	if err := couchdb.BulkForceUpdateDocs(s.db, consts.Files, docs); err != nil {
+		return err
+	}
+	vfs.UpdateDiskUsage(s.db, vfs.DiskUsageDelta(olddoc, doc))
+	return nil
 }
 
 // DeleteFileDoc is used when uploading a new file fails (invalid md5sum for example)
@@ -318,6 +329,9 @@ func (s *sharingIndexer) UpdateDirDoc(olddoc, doc *vfs.DirDoc) error {
 	if doc.CozyMetadata != nil {
 		docs[0]["cozyMetadata"] = doc.CozyMetadata
 	}
+	if len(doc.CustomMetadata) > 0 {
+		docs[0]["custom_metadata"] = doc.CustomMetadata
+	}
 	doc.SetRev(s.bulkRevs.Rev)
 	s.setDirOrFileRevisions(olddoc, nil, docs[0])
 
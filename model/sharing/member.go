@@ -47,17 +47,6 @@ const (
 	MemberStatusRevoked = "revoked"
 )
 
-const maximalNumberOfMembers = 90
-
-func maxNumberOfMembers(inst *instance.Instance) int {
-	if settings, ok := inst.SettingsContext(); ok {
-		if max, ok := settings["max_members_per_sharing"].(float64); ok {
-			return int(max)
-		}
-	}
-	return maximalNumberOfMembers
-}
-
 // Member contains the information about a recipient (or the sharer) for a sharing
 type Member struct {
 	Status     string `json:"status"`
@@ -66,6 +55,11 @@ type Member struct {
 	Email      string `json:"email,omitempty"`
 	Instance   string `json:"instance,omitempty"`
 	ReadOnly   bool   `json:"read_only,omitempty"`
+
+	// VerifiedBy and VerifiedAt record how and when a new member of an open
+	// sharing has proved their identity (see VerifyMembers).
+	VerifiedBy string     `json:"verified_by,omitempty"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
 }
 
 // PrimaryName returns the main name of this member
@@ -92,9 +86,22 @@ type Credentials struct {
 	// XorKey is used to transform file identifiers
 	XorKey []byte `json:"xor_key,omitempty"`
 
+	// SigningKey is the key shared with the member to sign the requests
+	// between the two instances
+	SigningKey []byte `json:"signing_key,omitempty"`
+
 	// InboundClientID is the OAuth ClientID used for authentifying incoming
 	// requests from the member
 	InboundClientID string `json:"inbound_client_id,omitempty"`
+
+	// Verification is the code sent by email to the member, when they must
+	// prove their identity before accepting the sharing
+	Verification *VerificationCode `json:"verification,omitempty"`
+
+	// InitialSyncPending is true when the initial_sync.done event for this
+	// member must be sent by the replicator, at the end of the first
+	// replication
+	InitialSyncPending bool `json:"initial_sync_pending,omitempty"`
 }
 
 // AddContacts adds a list of contacts on the sharer cozy
@@ -175,7 +182,8 @@ func (s *Sharing) addMember(inst *instance.Instance, m Member) (string, error) {
 		break
 	}
 	if idx < 1 {
-		if len(s.Members) >= maxNumberOfMembers(inst) {
+		if max := maxNumberOfMembers(inst); len(s.Members) >= max {
+			quotaReached(inst, QuotaMembers, max)
 			return "", ErrTooManyMembers
 		}
 		s.Members = append(s.Members, m)
@@ -297,7 +305,9 @@ func (s *Sharing) DelegateAddContacts(inst *instance.Instance, contactIDs map[st
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	c.signRequest(opts, body)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, &s.Members[0], c, opts, body)
@@ -384,7 +394,7 @@ func (s *Sharing) AddDelegatedContact(inst *instance.Instance, email, instanceUR
 // DelegateDiscovery delegates the POST discovery when a recipient has invited
 // another person to a sharing, and this person accepts the sharing on the
 // recipient cozy. The calls is delegated to the owner cozy.
-func (s *Sharing) DelegateDiscovery(inst *instance.Instance, state, cozyURL string) (string, error) {
+func (s *Sharing) DelegateDiscovery(inst *instance.Instance, state, cozyURL, code string) (string, error) {
 	u, err := url.Parse(s.Members[0].Instance)
 	if err != nil {
 		return "", err
@@ -392,6 +402,9 @@ func (s *Sharing) DelegateDiscovery(inst *instance.Instance, state, cozyURL stri
 	v := url.Values{}
 	v.Add("state", state)
 	v.Add("url", cozyURL)
+	if code != "" {
+		v.Add("code", code)
+	}
 	body := []byte(v.Encode())
 	c := &s.Credentials[0]
 	opts := &request.Options{
@@ -406,14 +419,24 @@ func (s *Sharing) DelegateDiscovery(inst *instance.Instance, state, cozyURL stri
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	c.signRequest(opts, body)
 	res, err := request.Req(opts)
-	if res != nil && res.StatusCode/100 == 4 {
+	// A wrong verification code must not be sent twice
+	if res != nil && res.StatusCode/100 == 4 && res.StatusCode != http.StatusUnprocessableEntity {
 		res, err = RefreshToken(inst, err, s, &s.Members[0], c, opts, body)
 	}
 	if err != nil {
-		if res != nil && res.StatusCode == http.StatusBadRequest {
-			return "", ErrInvalidURL
+		if res != nil {
+			switch res.StatusCode {
+			case http.StatusBadRequest:
+				return "", ErrInvalidURL
+			case http.StatusForbidden:
+				return "", ErrMemberNotVerified
+			case http.StatusUnprocessableEntity:
+				return "", ErrInvalidVerificationCode
+			}
 		}
 		return "", err
 	}
@@ -603,7 +626,7 @@ func (c *Credentials) Refresh(inst *instance.Instance, s *Sharing, m *Member) er
 // an access token with a short validity to let it synchronize its last
 // changes.
 func (s *Sharing) AddReadOnlyFlag(inst *instance.Instance, index int) error {
-	if index <= 1 {
+	if index < 1 {
 		return ErrMemberNotFound
 	}
 	if s.ReadOnlyFlag() {
@@ -665,7 +688,9 @@ func (s *Sharing) AddReadOnlyFlag(inst *instance.Instance, index int) error {
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	s.Credentials[index-1].signRequest(opts, body)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, &s.Members[index], &s.Credentials[index-1], opts, body)
@@ -698,7 +723,9 @@ func (s *Sharing) DelegateAddReadOnlyFlag(inst *instance.Instance, index int) er
 			echo.HeaderAuthorization: "Bearer " + c.AccessToken.AccessToken,
 		},
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	c.signRequest(opts, nil)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, &s.Members[0], c, opts, nil)
@@ -753,7 +780,7 @@ func (s *Sharing) DowngradeToReadOnly(inst *instance.Instance, creds *APICredent
 // RemoveReadOnlyFlag removes the read-only flag of a recipient, and send
 // credentials to their cozy so that it can push its changes.
 func (s *Sharing) RemoveReadOnlyFlag(inst *instance.Instance, index int) error {
-	if index <= 1 {
+	if index < 1 {
 		return ErrMemberNotFound
 	}
 	if s.ReadOnlyFlag() {
@@ -767,7 +794,8 @@ func (s *Sharing) RemoveReadOnlyFlag(inst *instance.Instance, index int) error {
 	ac := APICredentials{
 		CID: s.SID,
 		Credentials: &Credentials{
-			XorKey: s.Credentials[index-1].XorKey,
+			XorKey:     s.Credentials[index-1].XorKey,
+			SigningKey: s.Credentials[index-1].SigningKey,
 		},
 	}
 	// Create the credentials for the recipient
@@ -807,7 +835,9 @@ func (s *Sharing) RemoveReadOnlyFlag(inst *instance.Instance, index int) error {
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	s.Credentials[index-1].signRequest(opts, body)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, &s.Members[index], &s.Credentials[index-1], opts, body)
@@ -838,6 +868,9 @@ func (s *Sharing) UpgradeToReadWrite(inst *instance.Instance, creds *APICredenti
 	}
 
 	s.Credentials[0].XorKey = creds.XorKey
+	if len(creds.SigningKey) > 0 {
+		s.Credentials[0].SigningKey = creds.SigningKey
+	}
 	s.Credentials[0].AccessToken = creds.AccessToken
 	s.Credentials[0].Client = creds.Client
 	return couchdb.UpdateDoc(inst, s)
@@ -860,7 +893,9 @@ func (s *Sharing) DelegateRemoveReadOnlyFlag(inst *instance.Instance, index int)
 			echo.HeaderAuthorization: "Bearer " + c.AccessToken.AccessToken,
 		},
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	c.signRequest(opts, nil)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, &s.Members[0], c, opts, nil)
@@ -879,6 +914,7 @@ func (s *Sharing) DelegateRemoveReadOnlyFlag(inst *instance.Instance, index int)
 func (s *Sharing) RevokeMember(inst *instance.Instance, index int) error {
 	m := &s.Members[index]
 	c := &s.Credentials[index-1]
+	alreadyRevoked := m.Status == MemberStatusRevoked
 
 	// No need to contact the revoked member if the sharing is not ready
 	if m.Status == MemberStatusReady {
@@ -904,6 +940,9 @@ func (s *Sharing) RevokeMember(inst *instance.Instance, index int) error {
 
 		err := couchdb.UpdateDoc(inst, s)
 		if !couchdb.IsConflictError(err) || leftRetries == 0 {
+			if err == nil && !alreadyRevoked {
+				s.notifyWebhook(inst, WebhookMemberRevoked, index, "")
+			}
 			return err
 		}
 
@@ -965,7 +1004,9 @@ func (s *Sharing) NotifyMemberRevocation(inst *instance.Instance, m *Member, c *
 			echo.HeaderAuthorization: "Bearer " + c.AccessToken.AccessToken,
 		},
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	c.signRequest(opts, nil)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, m, c, opts, nil)
@@ -1076,7 +1117,9 @@ func (s *Sharing) NotifyRecipients(inst *instance.Instance, except *Member) {
 			},
 			Body:       bytes.NewReader(body),
 			ParseError: ParseRequestError,
+			Client:     request.InstancesClient(),
 		}
+		c.signRequest(opts, body)
 		res, err := request.Req(opts)
 		if res != nil && res.StatusCode/100 == 4 {
 			res, err = RefreshToken(inst, err, s, &s.Members[i], c, opts, body)
@@ -1158,15 +1201,23 @@ func (s *Sharing) SaveBitwarden(inst *instance.Instance, m *Member, bw *APIBitwa
 	if orgKey != "" {
 		status = bitwarden.OrgMemberConfirmed
 	}
-	org.Members[domain] = bitwarden.OrgMember{
-		UserID:   bw.UserID,
-		Email:    m.Email,
-		Name:     m.PrimaryName(),
-		OrgKey:   orgKey,
-		Status:   status,
-		Owner:    false,
-		ReadOnly: m.ReadOnly || s.ReadOnlyRules(),
-	}
+	// The role is kept, but the read-only flag of the sharing member wins
+	role := org.Members[domain].Role
+	if m.ReadOnly || s.ReadOnlyRules() {
+		role = bitwarden.OrgRoleReadOnly
+	} else if role == "" || role == bitwarden.OrgRoleReadOnly {
+		role = bitwarden.OrgRoleUser
+	}
+	member := bitwarden.OrgMember{
+		UserID: bw.UserID,
+		Email:  m.Email,
+		Name:   m.PrimaryName(),
+		OrgKey: orgKey,
+		Status: status,
+		Owner:  false,
+	}
+	member.SetRole(role)
+	org.Members[domain] = member
 	if err := couchdb.UpdateDoc(inst, org); err != nil {
 		return err
 	}
@@ -1176,6 +1227,66 @@ func (s *Sharing) SaveBitwarden(inst *instance.Instance, m *Member, bw *APIBitwa
 	return nil
 }
 
+// SetBitwardenMemberReadOnly is called when the role of a member of a shared
+// bitwarden organization has changed, to add or remove the read-only flag of
+// the member of the sharing. A read-only member has no credentials to push
+// their changes, so their edits are not propagated.
+func SetBitwardenMemberReadOnly(inst *instance.Instance, orgID string, orgMember *bitwarden.OrgMember, domain string) error {
+	readOnly := orgMember.ReadOnly
+	sharings, err := GetSharingsByDocType(inst, consts.BitwardenOrganizations)
+	if err != nil {
+		return err
+	}
+	for _, s := range sharings {
+		if !s.Owner || !s.Active {
+			continue
+		}
+		rule := s.FirstBitwardenOrganizationRule()
+		if rule == nil || len(rule.Values) == 0 || rule.Values[0] != orgID {
+			continue
+		}
+		for i, m := range s.Members {
+			if i == 0 || !m.isBitwardenMember(orgMember, domain) {
+				continue
+			}
+			if m.ReadOnly == readOnly {
+				return nil
+			}
+			if !readOnly && s.ReadOnlyRules() {
+				return ErrInvalidSharing
+			}
+			if m.Status != MemberStatusReady {
+				// The credentials will be sent with the read-only flag when
+				// the member accepts the sharing
+				s.Members[i].ReadOnly = readOnly
+				return couchdb.UpdateDoc(inst, s)
+			}
+			if readOnly {
+				err = s.AddReadOnlyFlag(inst, i)
+			} else {
+				err = s.RemoveReadOnlyFlag(inst, i)
+			}
+			if err != nil {
+				return err
+			}
+			go s.NotifyRecipients(inst, nil)
+			return nil
+		}
+	}
+	return nil
+}
+
+// isBitwardenMember returns true if the sharing member is the given member of
+// the organization. The members that have not yet accepted the sharing can
+// have no instance, and they are found by their email.
+func (m *Member) isBitwardenMember(orgMember *bitwarden.OrgMember, domain string) bool {
+	if m.Instance == "" {
+		return m.Email != "" && m.Email == orgMember.Email
+	}
+	u, err := url.Parse(m.Instance)
+	return err == nil && u.Host == domain
+}
+
 func (s *Sharing) sendContactConfirmationMail(inst *instance.Instance, m *Member) error {
 	publicName, _ := csettings.PublicName(inst)
 	link := inst.SubDomain(s.AppSlug)
@@ -22,7 +22,6 @@ import (
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
-	"github.com/cozy/cozy-stack/pkg/safehttp"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 )
@@ -91,7 +90,9 @@ func (m *Member) CreateSharingRequest(inst *instance.Instance, s *Sharing, c *Cr
 		},
 		nil,
 		nil,
+		nil,
 	}
+	sh.MetadataOnly = s.MetadataOnly
 	data, err := jsonapi.MarshalObject(&sh)
 	if err != nil {
 		return err
@@ -111,6 +112,7 @@ func (m *Member) CreateSharingRequest(inst *instance.Instance, s *Sharing, c *Cr
 		},
 		Queries: u.Query(),
 		Body:    bytes.NewReader(body),
+		Client:  request.InstancesClient(),
 	}
 	res, err := request.Req(&opts)
 	if res != nil && res.StatusCode == http.StatusConflict {
@@ -229,6 +231,9 @@ func (s *Sharing) RegisterCozyURL(inst *instance.Instance, m *Member, cozyURL st
 	u.RawPath = ""
 	u.RawQuery = ""
 	u.Fragment = ""
+	if err := s.checkVerification(m, u.String()); err != nil {
+		return err
+	}
 	m.Instance = u.String()
 
 	creds := s.FindCredentials(m)
@@ -382,6 +387,7 @@ func (s *Sharing) SendAnswer(inst *instance.Instance, state string) error {
 			State:       state,
 			Client:      ConvertOAuthClient(cli),
 			AccessToken: token,
+			SigningKey:  MakeSigningKey(),
 		},
 		PublicName: name,
 		CID:        s.SID,
@@ -413,7 +419,8 @@ func (s *Sharing) SendAnswer(inst *instance.Instance, state string) error {
 			echo.HeaderAccept:      jsonapi.ContentType,
 			echo.HeaderContentType: jsonapi.ContentType,
 		},
-		Body: bytes.NewReader(body),
+		Body:   bytes.NewReader(body),
+		Client: request.InstancesClient(),
 	})
 	if err != nil {
 		return err
@@ -439,6 +446,9 @@ func (s *Sharing) SendAnswer(inst *instance.Instance, state string) error {
 		return ErrRequestFailed
 	}
 	s.Credentials[0].XorKey = creds.XorKey
+	// The signing key is kept only if the owner has echoed it, as an older
+	// stack would not sign its requests
+	s.Credentials[0].SigningKey = creds.SigningKey
 	s.Credentials[0].InboundClientID = cli.ClientID
 	s.Credentials[0].AccessToken = creds.AccessToken
 	s.Credentials[0].Client = creds.Client
@@ -454,14 +464,19 @@ func (s *Sharing) ProcessAnswer(inst *instance.Instance, creds *APICredentials)
 	}
 	for i, c := range s.Credentials {
 		if c.State == creds.State {
+			if err := s.verifyAnswer(&s.Members[i+1]); err != nil {
+				return nil, err
+			}
 			s.Members[i+1].Status = MemberStatusReady
 			s.Members[i+1].PublicName = creds.PublicName
 			s.Credentials[i].Client = creds.Client
 			s.Credentials[i].AccessToken = creds.AccessToken
+			s.Credentials[i].SigningKey = creds.SigningKey
 			ac := APICredentials{
 				CID: s.SID,
 				Credentials: &Credentials{
-					XorKey: c.XorKey,
+					XorKey:     c.XorKey,
+					SigningKey: creds.SigningKey,
 				},
 			}
 			// Create the credentials for the recipient
@@ -518,6 +533,7 @@ func (s *Sharing) ProcessAnswer(inst *instance.Instance, creds *APICredentials)
 					return nil, err
 				}
 			}
+			s.notifyWebhook(inst, WebhookMemberAccepted, i+1, "")
 			go s.Setup(inst, &s.Members[i+1])
 			return &ac, nil
 		}
@@ -582,7 +598,16 @@ func RefreshToken(
 	}
 
 	if err := creds.Refresh(inst, s, m); err != nil {
-		return nil, err
+		// When the OAuth client has been revoked by the other member, the
+		// credentials can be renegotiated with the signing key
+		if !isRejectedByOAuth(err) {
+			return nil, err
+		}
+		if errp := s.RepairCredentials(inst, m, creds); errp != nil {
+			inst.Logger().WithNamespace("sharing").
+				Infof("Cannot repair the credentials for %s: %s", s.SID, errp)
+			return nil, err
+		}
 	}
 	opts.Headers["Authorization"] = "Bearer " + creds.AccessToken.AccessToken
 	if body != nil {
@@ -687,7 +712,7 @@ func TryTokenForMovedSharing(i *instance.Instance, c *oauth.Client, token string
 	}
 	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationForm)
 	req.Header.Add(echo.HeaderAccept, echo.MIMEApplicationJSON)
-	res, err := safehttp.ClientWithKeepAlive.Do(req)
+	res, err := request.InstancesClient().Do(req)
 	if err != nil || res.StatusCode != http.StatusOK {
 		return "", claims, false
 	}
@@ -318,6 +318,7 @@ func (o *FileOpener) PrepareRequestForSharedFile() (*PreparedRequest, error) {
 			echo.HeaderAuthorization: "Bearer " + prepared.Creds.AccessToken.AccessToken,
 		},
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
 	return &prepared, nil
 }
@@ -0,0 +1,70 @@
+package sharing
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/mail"
+)
+
+// NotifyOwnerDeletion sends a mail to the members of the active sharings
+// where the instance is the owner, to warn them that the instance has been
+// scheduled for deletion, and that the sharings will stop at the given date.
+func NotifyOwnerDeletion(inst *instance.Instance, at time.Time) error {
+	sharer, err := csettings.PublicName(inst)
+	if err != nil {
+		return err
+	}
+	return couchdb.ForeachDocs(inst, consts.Sharings, func(_ string, data json.RawMessage) error {
+		s := &Sharing{}
+		if err := json.Unmarshal(data, s); err != nil {
+			return err
+		}
+		if !s.Owner || !s.Active {
+			return nil
+		}
+		for i, m := range s.Members {
+			if i == 0 || m.Email == "" || m.Status != MemberStatusReady {
+				continue
+			}
+			if err := m.sendOwnerDeletionMail(inst, s, sharer, at); err != nil {
+				inst.Logger().WithNamespace("sharing").
+					Warnf("Cannot send the owner deletion mail: %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Member) sendOwnerDeletionMail(inst *instance.Instance, s *Sharing, sharer string, at time.Time) error {
+	addr := &mail.Address{
+		Email: m.Email,
+		Name:  m.PrimaryName(),
+	}
+	mailValues := map[string]interface{}{
+		"SharerPublicName": sharer,
+		"Description":      s.Description,
+		"Date":             at.Format("2006-01-02"),
+	}
+	msg, err := job.NewMessage(mail.Options{
+		Mode:           "from",
+		To:             []*mail.Address{addr},
+		TemplateName:   "sharing_owner_deletion",
+		TemplateValues: mailValues,
+		RecipientName:  addr.Name,
+		Layout:         mail.CozyCloudLayout,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "sendmail",
+		Message:    msg,
+	})
+	return err
+}
@@ -0,0 +1,185 @@
+package sharing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cozy/cozy-stack/client/auth"
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+// The OAuth clients and tokens exchanged by two members of a sharing can
+// become invalid, for example when a member has reset their password and
+// revoked their connected devices. The sharing is still accepted, and the
+// members still share the signing key exchanged on the answer: it is used to
+// authenticate a re-pairing handshake, where the two members create new OAuth
+// clients and tokens for each other, without asking the recipient to accept
+// the sharing again.
+
+// RepairCredentials starts a re-pairing handshake with the given member: a new
+// OAuth client and access token are created for the member, and they are sent
+// in a request signed with the signing key of the sharing. The member responds
+// with its own new client and token.
+func (s *Sharing) RepairCredentials(inst *instance.Instance, m *Member, creds *Credentials) error {
+	if !s.Active || len(creds.SigningKey) == 0 {
+		return ErrInvalidSharing
+	}
+	u, err := url.Parse(m.Instance)
+	if m.Instance == "" || err != nil {
+		return ErrInvalidURL
+	}
+
+	cli, err := CreateOAuthClient(inst, m)
+	if err != nil {
+		return err
+	}
+	token, err := CreateAccessToken(inst, cli, s.SID, s.inboundVerbs(m))
+	if err != nil {
+		_ = cli.Delete(inst)
+		return err
+	}
+	ac := APICredentials{
+		CID: s.SID,
+		Credentials: &Credentials{
+			Client:      ConvertOAuthClient(cli),
+			AccessToken: token,
+		},
+	}
+	data, err := jsonapi.MarshalObject(&ac)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(jsonapi.Document{Data: &data})
+	if err != nil {
+		return err
+	}
+	opts := &request.Options{
+		Method: http.MethodPost,
+		Scheme: u.Scheme,
+		Domain: u.Host,
+		Path:   "/sharings/" + s.SID + "/repairing",
+		Headers: request.Headers{
+			echo.HeaderAccept:      jsonapi.ContentType,
+			echo.HeaderContentType: jsonapi.ContentType,
+		},
+		Body:       bytes.NewReader(body),
+		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
+	}
+	creds.signRequest(opts, body)
+	res, err := request.Req(opts)
+	if err != nil {
+		_ = cli.Delete(inst)
+		return err
+	}
+	defer res.Body.Close()
+
+	var other Credentials
+	if _, err = jsonapi.Bind(res.Body, &other); err != nil {
+		_ = cli.Delete(inst)
+		return ErrRequestFailed
+	}
+	if other.Client == nil || other.AccessToken == nil {
+		_ = cli.Delete(inst)
+		return ErrRequestFailed
+	}
+
+	if err := DeleteOAuthClient(inst, m, creds); err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Infof("Cannot delete the old OAuth client for %s: %s", s.SID, err)
+	}
+	creds.InboundClientID = cli.ClientID
+	creds.Client = other.Client
+	creds.AccessToken = other.AccessToken
+	return couchdb.UpdateDoc(inst, s)
+}
+
+// ProcessRepairing is called on the member that receives a re-pairing
+// handshake, after the signature of the request has been checked. The client
+// and token of the other member are saved, and a new client and token are
+// created for it.
+func (s *Sharing) ProcessRepairing(inst *instance.Instance, m *Member, creds *Credentials, ac *APICredentials) (*APICredentials, error) {
+	if !s.Active || m.Status == MemberStatusRevoked {
+		return nil, ErrInvalidSharing
+	}
+	if ac.Credentials == nil || ac.Client == nil || ac.AccessToken == nil {
+		return nil, ErrInvalidSharing
+	}
+
+	cli, err := CreateOAuthClient(inst, m)
+	if err != nil {
+		return nil, err
+	}
+	token, err := CreateAccessToken(inst, cli, s.SID, s.inboundVerbs(m))
+	if err != nil {
+		_ = cli.Delete(inst)
+		return nil, err
+	}
+	if err := DeleteOAuthClient(inst, m, creds); err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Infof("Cannot delete the old OAuth client for %s: %s", s.SID, err)
+	}
+	creds.InboundClientID = cli.ClientID
+	creds.Client = ac.Client
+	creds.AccessToken = ac.AccessToken
+	if err := couchdb.UpdateDoc(inst, s); err != nil {
+		return nil, err
+	}
+
+	return &APICredentials{
+		CID: s.SID,
+		Credentials: &Credentials{
+			Client:      ConvertOAuthClient(cli),
+			AccessToken: token,
+		},
+	}, nil
+}
+
+// FindMemberBySignature returns the member, and its credentials, that has
+// signed the request. It is used for the requests that can't be authenticated
+// by an OAuth token.
+func (s *Sharing) FindMemberBySignature(req *http.Request) (*Member, *Credentials, error) {
+	now := time.Now()
+	for i := range s.Credentials {
+		creds := &s.Credentials[i]
+		if len(creds.SigningKey) == 0 {
+			continue
+		}
+		if err := creds.VerifySignature(req, false, now); err != nil {
+			continue
+		}
+		if !s.Owner {
+			return &s.Members[0], creds, nil
+		}
+		if i+1 < len(s.Members) {
+			return &s.Members[i+1], creds, nil
+		}
+	}
+	return nil, nil, ErrInvalidSignature
+}
+
+// inboundVerbs returns the verbs allowed for the tokens given to a member.
+func (s *Sharing) inboundVerbs(m *Member) permission.VerbSet {
+	// In case of read-only, the recipient only needs read access on the
+	// sharing, e.g. to notify the sharer of a revocation
+	if s.Owner && (s.ReadOnlyRules() || m.ReadOnly) {
+		return permission.Verbs(permission.GET)
+	}
+	return permission.ALL
+}
+
+// isRejectedByOAuth returns true if the error is a rejection of the client or
+// of the refresh token by the OAuth server of the other member.
+func isRejectedByOAuth(err error) bool {
+	var authErr *auth.Error
+	return errors.As(err, &authErr)
+}
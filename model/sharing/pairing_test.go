@@ -0,0 +1,88 @@
+package sharing
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cozy/cozy-stack/client/auth"
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairing(t *testing.T) {
+	config.UseTestFile(t)
+	signed := func(creds *Credentials) *http.Request {
+		body := []byte(`{"data":{"type":"io.cozy.sharings.answer"}}`)
+		opts := &request.Options{
+			Method: http.MethodPost,
+			Path:   "/sharings/123/repairing",
+			Body:   bytes.NewReader(body),
+		}
+		creds.signRequest(opts, body)
+		req := httptest.NewRequest(opts.Method, "https://alice.cozy.example"+opts.Path, bytes.NewReader(body))
+		for k, v := range opts.Headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	t.Run("FindMemberBySignature", func(t *testing.T) {
+		s := &Sharing{
+			SID:   "123",
+			Owner: true,
+			Members: []Member{
+				{Status: MemberStatusOwner, Instance: "https://alice.cozy.example"},
+				{Status: MemberStatusReady, Instance: "https://bob.cozy.example"},
+				{Status: MemberStatusReady, Instance: "https://dave.cozy.example"},
+			},
+			Credentials: []Credentials{
+				{SigningKey: MakeSigningKey()},
+				{SigningKey: MakeSigningKey()},
+			},
+		}
+
+		m, creds, err := s.FindMemberBySignature(signed(&Credentials{SigningKey: s.Credentials[1].SigningKey}))
+		require.NoError(t, err)
+		assert.Equal(t, "https://dave.cozy.example", m.Instance)
+		assert.Equal(t, &s.Credentials[1], creds)
+
+		_, _, err = s.FindMemberBySignature(signed(&Credentials{SigningKey: MakeSigningKey()}))
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+
+		// The members without a signing key can't use the re-pairing
+		s.Credentials[0].SigningKey = nil
+		req := signed(&Credentials{})
+		_, _, err = s.FindMemberBySignature(req)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+
+		recipient := &Sharing{
+			SID: "123",
+			Members: []Member{
+				{Status: MemberStatusOwner, Instance: "https://alice.cozy.example"},
+				{Status: MemberStatusReady, Instance: "https://bob.cozy.example"},
+			},
+			Credentials: []Credentials{{SigningKey: MakeSigningKey()}},
+		}
+		m, _, err = recipient.FindMemberBySignature(signed(&recipient.Credentials[0]))
+		require.NoError(t, err)
+		assert.Equal(t, "https://alice.cozy.example", m.Instance)
+	})
+
+	t.Run("InboundVerbs", func(t *testing.T) {
+		s := &Sharing{Owner: true, Rules: []Rule{{Title: "foo", DocType: "io.cozy.files", Add: "sync", Update: "sync", Remove: "sync"}}}
+		assert.Equal(t, permission.ALL, s.inboundVerbs(&Member{}))
+		assert.Equal(t, permission.Verbs(permission.GET), s.inboundVerbs(&Member{ReadOnly: true}))
+		s.Owner = false
+		assert.Equal(t, permission.ALL, s.inboundVerbs(&Member{ReadOnly: true}))
+	})
+
+	t.Run("IsRejectedByOAuth", func(t *testing.T) {
+		assert.True(t, isRejectedByOAuth(&auth.Error{Value: "invalid refresh token"}))
+		assert.False(t, isRejectedByOAuth(&request.Error{Status: "Bad Gateway"}))
+	})
+}
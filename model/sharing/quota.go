@@ -0,0 +1,132 @@
+package sharing
+
+import (
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+// The kinds of quota for the sharings.
+const (
+	// QuotaSharings is the quota on the number of active sharings where the
+	// instance is the owner.
+	QuotaSharings = "sharings"
+	// QuotaMembers is the quota on the number of members of a sharing.
+	QuotaMembers = "members"
+)
+
+const maximalNumberOfMembers = 90
+
+// QuotaCallback is a function called when a quota of the sharings has been
+// reached on an instance.
+type QuotaCallback func(inst *instance.Instance, kind string, quota int)
+
+var quotaCallback QuotaCallback
+
+// RegisterQuotaCallback allows to register a callback function called when
+// the maximal number of sharings, or of members for a sharing, has been
+// reached.
+func RegisterQuotaCallback(cb QuotaCallback) {
+	quotaCallback = cb
+}
+
+// contextLimit returns the value of a limit in the settings of the context of
+// the instance, or the default value if it is not set.
+func contextLimit(inst *instance.Instance, key string, defaultValue int) int {
+	settings, ok := inst.SettingsContext()
+	if !ok {
+		return defaultValue
+	}
+	switch v := settings[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return defaultValue
+}
+
+func maxNumberOfMembers(inst *instance.Instance) int {
+	return contextLimit(inst, "max_members_per_sharing", maximalNumberOfMembers)
+}
+
+// maxNumberOfSharings returns the maximal number of active sharings that the
+// instance can own, or 0 if there is no limit.
+func maxNumberOfSharings(inst *instance.Instance) int {
+	return contextLimit(inst, "max_sharings", 0)
+}
+
+// CountActiveSharings returns the number of active sharings where the
+// instance is the owner.
+func CountActiveSharings(inst *instance.Instance) (int, error) {
+	var res couchdb.ViewResponse
+	err := couchdb.ExecView(inst, couchdb.ActiveSharingsView, &couchdb.ViewRequest{
+		Reduce: true,
+	}, &res)
+	if couchdb.IsNoDatabaseError(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(res.Rows) == 0 {
+		return 0, nil
+	}
+	count, _ := res.Rows[0].Value.(float64)
+	return int(count), nil
+}
+
+// checkSharingsQuota returns ErrTooManySharings if the instance cannot own a
+// new sharing. It is a soft quota: the existing sharings are kept active when
+// the limit is lowered.
+func checkSharingsQuota(inst *instance.Instance) error {
+	max := maxNumberOfSharings(inst)
+	if max <= 0 {
+		return nil
+	}
+	count, err := CountActiveSharings(inst)
+	if err != nil {
+		return err
+	}
+	if count < max {
+		return nil
+	}
+	quotaReached(inst, QuotaSharings, max)
+	return ErrTooManySharings
+}
+
+func quotaReached(inst *instance.Instance, kind string, quota int) {
+	inst.Logger().WithNamespace("sharing").
+		Infof("Quota of %d %s reached", quota, kind)
+	if quotaCallback != nil {
+		quotaCallback(inst, kind, quota)
+	}
+}
+
+// SharingsUsage is the number of active sharings owned by an instance, with
+// the quotas of its context.
+type SharingsUsage struct {
+	Count        int `json:"count"`
+	Quota        int `json:"quota,omitempty"`
+	MembersQuota int `json:"members_quota"`
+}
+
+// QuotaReached returns true if the instance cannot own a new sharing.
+func (u *SharingsUsage) QuotaReached() bool {
+	return u.Quota > 0 && u.Count >= u.Quota
+}
+
+// GetSharingsUsage returns the number of active sharings owned by the
+// instance, and the quotas for them.
+func GetSharingsUsage(inst *instance.Instance) (*SharingsUsage, error) {
+	count, err := CountActiveSharings(inst)
+	if err != nil {
+		return nil, err
+	}
+	return &SharingsUsage{
+		Count:        count,
+		Quota:        maxNumberOfSharings(inst),
+		MembersQuota: maxNumberOfMembers(inst),
+	}, nil
+}
@@ -0,0 +1,38 @@
+package sharing
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("ContextLimits", func(t *testing.T) {
+		cfg := config.GetConfig()
+		cfg.Contexts = map[string]interface{}{
+			"beta": map[string]interface{}{
+				"max_sharings":            500,
+				"max_members_per_sharing": float64(20),
+			},
+		}
+		defer func() { cfg.Contexts = nil }()
+
+		inst := &instance.Instance{Domain: "alice.cozy.example"}
+		assert.Equal(t, 0, maxNumberOfSharings(inst))
+		assert.Equal(t, maximalNumberOfMembers, maxNumberOfMembers(inst))
+
+		inst.ContextName = "beta"
+		assert.Equal(t, 500, maxNumberOfSharings(inst))
+		assert.Equal(t, 20, maxNumberOfMembers(inst))
+	})
+
+	t.Run("QuotaReached", func(t *testing.T) {
+		assert.False(t, (&SharingsUsage{Count: 1000}).QuotaReached())
+		assert.False(t, (&SharingsUsage{Count: 499, Quota: 500}).QuotaReached())
+		assert.True(t, (&SharingsUsage{Count: 500, Quota: 500}).QuotaReached())
+	})
+}
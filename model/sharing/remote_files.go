@@ -0,0 +1,346 @@
+package sharing
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/contentcache"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+)
+
+// RemoteFile is the metadata of a file of a sharing in metadata-only mode, on
+// the instance of a recipient. The content of the file is kept on the
+// instance of the owner, and it is fetched on demand.
+type RemoteFile struct {
+	DocID     string    `json:"_id,omitempty"`
+	DocRev    string    `json:"_rev,omitempty"`
+	SharingID string    `json:"sharing_id"`
+	FileRev   string    `json:"file_rev"`
+	Name      string    `json:"name"`
+	DirID     string    `json:"dir_id,omitempty"`
+	Size      int64     `json:"size,string"`
+	MD5Sum    []byte    `json:"md5sum"`
+	Mime      string    `json:"mime,omitempty"`
+	Class     string    `json:"class,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (f *RemoteFile) ID() string { return f.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (f *RemoteFile) Rev() string { return f.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (f *RemoteFile) DocType() string { return consts.SharingsRemoteFiles }
+
+// Clone implements couchdb.Doc
+func (f *RemoteFile) Clone() couchdb.Doc {
+	cloned := *f
+	cloned.MD5Sum = make([]byte, len(f.MD5Sum))
+	copy(cloned.MD5Sum, f.MD5Sum)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (f *RemoteFile) SetID(id string) { f.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (f *RemoteFile) SetRev(rev string) { f.DocRev = rev }
+
+// Fetch implements permission.Fetcher
+func (f *RemoteFile) Fetch(field string) []string {
+	switch field {
+	case "sharing_id":
+		return []string{f.SharingID}
+	case "dir_id":
+		return []string{f.DirID}
+	case "mime":
+		return []string{f.Mime}
+	case "class":
+		return []string{f.Class}
+	}
+	return nil
+}
+
+// cacheKey returns the key for the content of the file in the cache. The
+// instance is part of the key, as the metadata are given by the owner.
+func (f *RemoteFile) cacheKey(inst *instance.Instance) string {
+	return inst.DBPrefix() + "/" + f.SharingID + "/" + f.DocID + "-" + f.FileRev
+}
+
+// syncRemoteFile is used on the instance of a recipient of a sharing in
+// metadata-only mode, to save the metadata of a file sent by the owner.
+func (s *Sharing) syncRemoteFile(inst *instance.Instance, target *FileDocWithRevisions) error {
+	old := &RemoteFile{}
+	err := couchdb.GetDoc(inst, consts.SharingsRemoteFiles, target.DocID, old)
+	if err != nil && !couchdb.IsNotFoundError(err) && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+	var file *RemoteFile
+	if err == nil {
+		if old.SharingID != s.SID {
+			return ErrSafety
+		}
+		if old.FileRev == target.DocRev {
+			// It's just the echo, there is nothing to do
+			return nil
+		}
+		file = old.Clone().(*RemoteFile)
+	} else {
+		if rule, _ := s.findRuleForNewFile(target.FileDoc); rule == nil {
+			return ErrSafety
+		}
+		file = &RemoteFile{DocID: target.DocID, SharingID: s.SID}
+	}
+
+	file.FileRev = target.DocRev
+	file.Name = target.DocName
+	file.DirID = target.DirID
+	if file.DirID == "" {
+		if dir, err := s.GetSharingDir(inst); err == nil {
+			file.DirID = dir.DocID
+		}
+	}
+	file.Size = target.ByteSize
+	file.MD5Sum = target.MD5Sum
+	file.Mime = target.Mime
+	file.Class = target.Class
+	file.CreatedAt = target.CreatedAt
+	file.UpdatedAt = target.UpdatedAt
+
+	if file.DocRev == "" {
+		return couchdb.CreateNamedDocWithDB(inst, file)
+	}
+	return couchdb.UpdateDoc(inst, file)
+}
+
+// removeRemoteFile deletes the metadata of a file of a sharing in
+// metadata-only mode. It returns false if there is no such file.
+func (s *Sharing) removeRemoteFile(inst *instance.Instance, id string) (bool, error) {
+	file, err := s.GetRemoteFile(inst, id)
+	if errors.Is(err, ErrFileNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, couchdb.DeleteDoc(inst, file)
+}
+
+// RemoveRemoteFiles deletes the metadata of all the files of the sharing, when
+// it is revoked on the instance of a recipient.
+func (s *Sharing) RemoveRemoteFiles(inst *instance.Instance) error {
+	if !s.MetadataOnly {
+		return nil
+	}
+	for {
+		var files []*RemoteFile
+		req := &couchdb.FindRequest{
+			UseIndex: "by-sharing-id",
+			Selector: mango.Equal("sharing_id", s.SID),
+			Limit:    1000,
+		}
+		err := couchdb.FindDocs(inst, consts.SharingsRemoteFiles, req, &files)
+		if couchdb.IsNoDatabaseError(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		docs := make([]couchdb.Doc, len(files))
+		for i, f := range files {
+			docs[i] = f
+		}
+		if err := couchdb.BulkDeleteDocs(inst, consts.SharingsRemoteFiles, docs); err != nil {
+			return err
+		}
+	}
+}
+
+// GetRemoteFile returns the metadata of a file of the sharing, on the instance
+// of a recipient.
+func (s *Sharing) GetRemoteFile(inst *instance.Instance, id string) (*RemoteFile, error) {
+	file := &RemoteFile{}
+	err := couchdb.GetDoc(inst, consts.SharingsRemoteFiles, id, file)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.SharingID != s.SID {
+		return nil, ErrFileNotFound
+	}
+	return file, nil
+}
+
+// FileForMember returns the file on the instance of the owner for the given
+// XORed identifier, if it can be read by the member of the sharing in
+// metadata-only mode.
+func (s *Sharing) FileForMember(inst *instance.Instance, m *Member, xoredID string) (*vfs.FileDoc, error) {
+	if !s.Owner || !s.MetadataOnly {
+		return nil, ErrInvalidSharing
+	}
+	creds := s.FindCredentials(m)
+	if creds == nil {
+		return nil, ErrInvalidSharing
+	}
+	fileID := XorID(xoredID, creds.XorKey)
+	ref := &SharedRef{}
+	if err := couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+fileID, ref); err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	info, ok := ref.Infos[s.SID]
+	if !ok || info.Removed || !info.Binary {
+		return nil, ErrFileNotFound
+	}
+	file, err := inst.VFS().FileByID(fileID)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.Trashed {
+		return nil, ErrFileNotFound
+	}
+	return file, nil
+}
+
+// OpenRemoteFile returns the content of a file of a sharing in metadata-only
+// mode, on the instance of a recipient. The content is taken from the cache
+// if possible, and else it is streamed from the instance of the owner and put
+// in the cache.
+func (s *Sharing) OpenRemoteFile(inst *instance.Instance, file *RemoteFile) (io.ReadCloser, error) {
+	if s.Owner || !s.MetadataOnly || len(s.Credentials) == 0 {
+		return nil, ErrInvalidSharing
+	}
+	cache := contentcache.SystemCache()
+	key := file.cacheKey(inst)
+	if content, err := cache.Open(key); err == nil {
+		return content, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		inst.Logger().WithNamespace("sharing").
+			Warnf("Cannot read %s from the cache: %s", key, err)
+	}
+
+	res, err := s.fetchRemoteContent(inst, file)
+	if err != nil {
+		return nil, err
+	}
+	w, err := cache.Create(key, file.Mime)
+	if err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Warnf("Cannot put %s in the cache: %s", key, err)
+		return res.Body, nil
+	}
+	return newCachingReader(res.Body, w, file.MD5Sum), nil
+}
+
+func (s *Sharing) fetchRemoteContent(inst *instance.Instance, file *RemoteFile) (*http.Response, error) {
+	owner := &s.Members[0]
+	creds := &s.Credentials[0]
+	if creds.AccessToken == nil {
+		return nil, ErrInvalidSharing
+	}
+	u, err := url.Parse(owner.Instance)
+	if owner.Instance == "" || err != nil {
+		return nil, ErrInvalidURL
+	}
+	opts := &request.Options{
+		Method: http.MethodGet,
+		Scheme: u.Scheme,
+		Domain: u.Host,
+		Path:   "/sharings/" + s.SID + "/io.cozy.files/" + file.DocID + "/content",
+		Headers: request.Headers{
+			"Authorization": "Bearer " + creds.AccessToken.AccessToken,
+		},
+		ParseError: ParseRequestError,
+		Client:     request.InstancesStreamingClient(),
+	}
+	creds.signRequest(opts, nil)
+	res, err := request.Req(opts)
+	if res != nil && res.StatusCode/100 == 4 {
+		res, err = RefreshToken(inst, err, s, owner, creds, opts, nil)
+	}
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			return nil, ErrFileNotFound
+		}
+		if res != nil && res.StatusCode/100 == 5 {
+			return nil, ErrInternalServerError
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// cachingReader copies the content read from the body to the cache. The
+// content is kept in the cache only if it has been read until the end and its
+// checksum is the expected one.
+type cachingReader struct {
+	body     io.ReadCloser
+	w        contentcache.Writer
+	h        hash.Hash
+	expected []byte
+	eof      bool
+}
+
+func newCachingReader(body io.ReadCloser, w contentcache.Writer, md5sum []byte) *cachingReader {
+	return &cachingReader{body: body, w: w, h: md5.New(), expected: md5sum}
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.h.Write(p[:n])
+		if r.w != nil {
+			if _, errw := r.w.Write(p[:n]); errw != nil {
+				r.w.Abort()
+				r.w = nil
+			}
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		r.eof = true
+	}
+	return n, err
+}
+
+func (r *cachingReader) Close() error {
+	err := r.body.Close()
+	if r.w == nil {
+		return err
+	}
+	if r.eof && bytes.Equal(r.h.Sum(nil), r.expected) {
+		if errc := r.w.Commit(); errc != nil && err == nil {
+			err = errc
+		}
+	} else {
+		r.w.Abort()
+	}
+	r.w = nil
+	return err
+}
+
+var _ couchdb.Doc = &RemoteFile{}
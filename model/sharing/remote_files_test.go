@@ -0,0 +1,58 @@
+package sharing
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCacheWriter struct {
+	bytes.Buffer
+	committed bool
+	aborted   bool
+}
+
+func (w *fakeCacheWriter) Commit() error { w.committed = true; return nil }
+func (w *fakeCacheWriter) Abort()        { w.aborted = true }
+
+func TestCachingReader(t *testing.T) {
+	content := []byte("the content of the remote file")
+	sum := md5.Sum(content)
+
+	t.Run("Complete", func(t *testing.T) {
+		w := &fakeCacheWriter{}
+		r := newCachingReader(io.NopCloser(bytes.NewReader(content)), w, sum[:])
+		read, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, content, read)
+		assert.Equal(t, content, w.Bytes())
+		assert.True(t, w.committed)
+		assert.False(t, w.aborted)
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		w := &fakeCacheWriter{}
+		r := newCachingReader(io.NopCloser(bytes.NewReader(content)), w, sum[:])
+		buf := make([]byte, 5)
+		_, err := r.Read(buf)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.False(t, w.committed)
+		assert.True(t, w.aborted)
+	})
+
+	t.Run("InvalidChecksum", func(t *testing.T) {
+		w := &fakeCacheWriter{}
+		r := newCachingReader(io.NopCloser(bytes.NewReader([]byte("altered"))), w, sum[:])
+		_, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.False(t, w.committed)
+		assert.True(t, w.aborted)
+	})
+}
@@ -0,0 +1,148 @@
+package sharing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+// The actions that can be used to repair a sharing after a check
+const (
+	repairRecreateTrigger = "recreate_trigger"
+	repairRepushDoc       = "repush_doc"
+	repairReconcileDoc    = "reconcile_doc"
+)
+
+// repairChecks tries to fix the problems found by the checks of a sharing. It
+// is limited to the problems that can be fixed safely: the missing triggers,
+// the documents of the owner that are missing for a member, and the documents
+// that have the same revision but not the same name or parent. Each repair is
+// recorded in the check.
+func (s *Sharing) repairChecks(inst *instance.Instance, checks []map[string]interface{}) {
+	done := make(map[string]error)
+	for _, check := range checks {
+		if check["id"] != s.SID {
+			continue
+		}
+		var action, key string
+		switch check["type"] {
+		case "missing_trigger_on_active_sharing":
+			action = repairRecreateTrigger
+			kind, _ := check["trigger"].(string)
+			key = action + "/" + kind
+			if _, ok := done[key]; !ok {
+				done[key] = s.recreateTrigger(inst, kind)
+			}
+		case "missing_matching_doc_for_member":
+			if !s.Owner {
+				continue
+			}
+			action = repairRepushDoc
+			id, _ := check["ownerDocID"].(string)
+			key = action + "/" + id
+			if _, ok := done[key]; !ok {
+				done[key] = s.repushDoc(inst, id)
+			}
+		case "invalid_doc_name", "invalid_doc_parent":
+			if !s.Owner {
+				continue
+			}
+			action = repairReconcileDoc
+			doc, _ := check["ownerDoc"].(couchdb.JSONDoc)
+			key = action + "/" + doc.ID()
+			if _, ok := done[key]; !ok {
+				done[key] = s.reconcileDoc(inst, doc.ID())
+			}
+		default:
+			continue
+		}
+		check["repair"] = action
+		if err := done[key]; err != nil {
+			check["repair_error"] = err.Error()
+		} else {
+			check["repaired"] = true
+		}
+	}
+}
+
+// recreateTrigger creates again a trigger of the sharing that is missing.
+func (s *Sharing) recreateTrigger(inst *instance.Instance, kind string) error {
+	switch kind {
+	case "track":
+		// The track triggers are created all together, so the remaining
+		// ones are deleted before.
+		sched := job.System()
+		ids := s.Triggers.TrackIDs
+		if s.Triggers.TrackID != "" {
+			ids = append(ids, s.Triggers.TrackID)
+		}
+		for _, id := range ids {
+			err := sched.DeleteTrigger(inst, id)
+			if err != nil && err != job.ErrNotFoundTrigger && !couchdb.IsNotFoundError(err) {
+				return err
+			}
+		}
+		s.Triggers.TrackID = ""
+		s.Triggers.TrackIDs = nil
+		return s.AddTrackTriggers(inst)
+	case "replicate":
+		s.Triggers.ReplicateID = ""
+		return s.AddReplicateTrigger(inst)
+	case "upload":
+		s.Triggers.UploadID = ""
+		return s.AddUploadTrigger(inst)
+	}
+	return fmt.Errorf("Unknown trigger %q", kind)
+}
+
+// repushDoc updates the io.cozy.shared reference of a document, so that the
+// replicator and the upload worker send it again to the members.
+func (s *Sharing) repushDoc(inst *instance.Instance, docID string) error {
+	ref := &SharedRef{}
+	if err := couchdb.GetDoc(inst, consts.Shared, consts.Files+"/"+docID, ref); err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return ErrNotTracked
+		}
+		return err
+	}
+	if info, ok := ref.Infos[s.SID]; !ok || info.Removed {
+		return ErrNotTracked
+	}
+	if err := couchdb.UpdateDoc(inst, ref); err != nil {
+		return err
+	}
+	s.pushJob(inst, "share-replicate")
+	PushUploadJob(s, inst)
+	return nil
+}
+
+// reconcileDoc is used when a document has the same revision for the owner
+// and a member, but not the same name or parent. A new revision is made for
+// the document of the owner, so that its version wins on the member side.
+func (s *Sharing) reconcileDoc(inst *instance.Instance, docID string) error {
+	fs := inst.VFS()
+	dir, file, err := fs.DirOrFileByID(docID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if dir != nil {
+		newdir := dir.Clone().(*vfs.DirDoc)
+		newdir.UpdatedAt = now
+		if newdir.CozyMetadata != nil {
+			newdir.CozyMetadata.UpdatedAt = now
+		}
+		return fs.UpdateDirDoc(dir, newdir)
+	}
+	newfile := file.Clone().(*vfs.FileDoc)
+	newfile.UpdatedAt = now
+	if newfile.CozyMetadata != nil {
+		newfile.CozyMetadata.UpdatedAt = now
+	}
+	return fs.UpdateFileDoc(file, newfile)
+}
@@ -0,0 +1,35 @@
+package sharing
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepairChecks(t *testing.T) {
+	inst := &instance.Instance{Domain: "alice.cozy.example"}
+	s := &Sharing{SID: "sharing-1", Owner: false}
+
+	checks := []map[string]interface{}{
+		{"id": "sharing-1", "type": "invalid_member_status"},
+		{"id": "sharing-2", "type": "missing_trigger_on_active_sharing", "trigger": "foo"},
+		{"id": "sharing-1", "type": "missing_trigger_on_active_sharing", "trigger": "foo"},
+		{"id": "sharing-1", "type": "missing_matching_doc_for_member", "ownerDocID": "file-1"},
+		{"id": "sharing-1", "type": "invalid_doc_name", "ownerDoc": couchdb.JSONDoc{}},
+	}
+	s.repairChecks(inst, checks)
+
+	// Only the problems that can be fixed safely are repaired
+	assert.NotContains(t, checks[0], "repair")
+	// The checks for other sharings are ignored
+	assert.NotContains(t, checks[1], "repair")
+	// An unknown trigger cannot be recreated
+	assert.Equal(t, repairRecreateTrigger, checks[2]["repair"])
+	assert.NotContains(t, checks[2], "repaired")
+	assert.Contains(t, checks[2]["repair_error"], "Unknown trigger")
+	// The documents are only repaired from the owner instance
+	assert.NotContains(t, checks[3], "repair")
+	assert.NotContains(t, checks[4], "repair")
+}
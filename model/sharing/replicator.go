@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cozy/cozy-stack/client/request"
@@ -20,7 +21,6 @@ import (
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/couchdb/revision"
 	"github.com/cozy/cozy-stack/pkg/realtime"
-	"github.com/cozy/cozy-stack/pkg/safehttp"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/sync/errgroup"
 )
@@ -40,6 +40,9 @@ const BatchSize = 100
 type ReplicateMsg struct {
 	SharingID string `json:"sharing_id"`
 	Errors    int    `json:"errors"`
+	// ResetMember is the index of the member whose replication checkpoints
+	// must be reset, instead of running the replicator.
+	ResetMember *int `json:"reset_member,omitempty"`
 }
 
 // Replicate starts a replicator on this sharing.
@@ -55,11 +58,14 @@ func (s *Sharing) Replicate(inst *instance.Instance, errors int) error {
 	if !s.Owner {
 		pending, err = s.ReplicateTo(inst, &s.Members[0], false)
 	} else {
+		var upToDate []int
+		var upToDateMu sync.Mutex
 		g, _ := errgroup.WithContext(context.Background())
 		for i := range s.Members {
 			if i == 0 {
 				continue
 			}
+			index := i
 			m := &s.Members[i]
 			g.Go(func() error {
 				if m.Status == MemberStatusReady {
@@ -69,12 +75,17 @@ func (s *Sharing) Replicate(inst *instance.Instance, errors int) error {
 					}
 					if p {
 						pending = true
+					} else {
+						upToDateMu.Lock()
+						upToDate = append(upToDate, index)
+						upToDateMu.Unlock()
 					}
 				}
 				return nil
 			})
 		}
 		err = g.Wait()
+		s.endInitialSyncs(inst, upToDate)
 	}
 	if err != nil {
 		s.retryWorker(inst, "share-replicate", errors)
@@ -116,6 +127,7 @@ func (s *Sharing) retryWorker(inst *instance.Instance, worker string, errors int
 	errors++
 	if errors == MaxRetries {
 		inst.Logger().WithNamespace("replicator").Warnf("Max retries reached")
+		s.notifyWebhook(inst, WebhookSyncError, 0, "Max retries reached for "+worker)
 		return
 	}
 	msg, err := job.NewMessage(&ReplicateMsg{
@@ -161,8 +173,18 @@ func (s *Sharing) ReplicateTo(inst *instance.Instance, m *Member, initial bool)
 	}
 	inst.Logger().WithNamespace("replicator").Debugf("lastSeq = %s", lastSeq)
 
+	if stale, err := isStaleCheckpoint(inst, lastSeq); err != nil {
+		return false, err
+	} else if stale {
+		return false, s.resetReplication(inst, m, creds, lastSeq)
+	}
+
 	feed, err := s.callChangesFeed(inst, lastSeq)
 	if err != nil {
+		if lastSeq != "" && couchdb.IsBadRequestError(err) {
+			// CouchDB rejects a sequence number from another database
+			return false, s.resetReplication(inst, m, creds, lastSeq)
+		}
 		if errors.Is(err, errRevokeSharing) {
 			if s.Owner {
 				return false, s.Revoke(inst)
@@ -372,35 +394,46 @@ func (s *Sharing) callChangesFeed(inst *instance.Instance, since string) (*chang
 		Pending:     response.Pending > 0,
 	}
 	for _, r := range response.Results {
-		infos, ok := r.Doc.Get("infos").(map[string]interface{})
-		if !ok {
-			continue
-		}
-		info, ok := infos[s.SID].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		idx, ok := info["rule"].(float64)
-		if !ok {
-			continue
+		if err := s.addSharedDoc(&res, r.DocID, r.Doc, true); err != nil {
+			return nil, err
 		}
-		res.RuleIndexes[r.DocID] = int(idx)
-		if _, ok = info["removed"]; ok {
-			rule := s.Rules[int(idx)]
-			if rule.Remove == ActionRuleRevoke {
-				return nil, errRevokeSharing
-			}
-			res.Changes.Removed[r.DocID] = struct{}{}
+	}
+	return &res, nil
+}
+
+// addSharedDoc adds a document of io.cozy.shared to the changes, if it is
+// for this sharing. If revoke is true and the document has been removed with
+// a rule whose remove action is to revoke the sharing, errRevokeSharing is
+// returned.
+func (s *Sharing) addSharedDoc(res *changesResponse, docID string, doc couchdb.JSONDoc, revoke bool) error {
+	infos, ok := doc.Get("infos").(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	info, ok := infos[s.SID].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	idx, ok := info["rule"].(float64)
+	if !ok || int(idx) >= len(s.Rules) {
+		return nil
+	}
+	res.RuleIndexes[docID] = int(idx)
+	if _, ok = info["removed"]; ok {
+		rule := s.Rules[int(idx)]
+		if revoke && rule.Remove == ActionRuleRevoke {
+			return errRevokeSharing
 		}
-		if strings.HasPrefix(r.DocID, consts.Files+"/") {
-			if rev := extractLastRevision(r.Doc); rev != "" {
-				res.Changes.Changed[r.DocID] = []string{rev}
-			}
-		} else {
-			res.Changes.Changed[r.DocID] = extractRevisionsSlice(r.Doc)
+		res.Changes.Removed[docID] = struct{}{}
+	}
+	if strings.HasPrefix(docID, consts.Files+"/") {
+		if rev := extractLastRevision(doc); rev != "" {
+			res.Changes.Changed[docID] = []string{rev}
 		}
+	} else {
+		res.Changes.Changed[docID] = extractRevisionsSlice(doc)
 	}
-	return &res, nil
+	return nil
 }
 
 // Missings is a struct for the response of _revs_diff
@@ -463,7 +496,9 @@ func (s *Sharing) callRevsDiff(inst *instance.Instance, m *Member, creds *Creden
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	creds.signRequest(opts, body)
 	var res *http.Response
 	res, err = request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
@@ -600,6 +635,11 @@ func (s *Sharing) sendBulkDocs(inst *instance.Instance, m *Member, creds *Creden
 				s.transformCipherToSent(doc, creds.XorKey)
 				docs[i] = doc
 			}
+		case consts.Accounts:
+			for i, doc := range docs {
+				s.transformAccountToSent(doc, creds.XorKey)
+				docs[i] = doc
+			}
 		default:
 			for i, doc := range docs {
 				id := doc["_id"].(string)
@@ -625,8 +665,9 @@ func (s *Sharing) sendBulkDocs(inst *instance.Instance, m *Member, creds *Creden
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
-		Client:     safehttp.ClientWithKeepAlive,
+		Client:     request.InstancesClient(),
 	}
+	creds.signRequest(opts, body)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, m, creds, opts, body)
@@ -661,6 +702,11 @@ func (s *Sharing) ApplyBulkDocs(inst *instance.Instance, payload DocsByDoctype)
 			}
 			continue
 		}
+		if doctype == consts.Accounts {
+			if err := prepareAccountsToApply(inst, docs); err != nil {
+				return err
+			}
+		}
 		var okDocs, docsToUpdate DocsList
 		var newRefs, existingRefs []*SharedRef
 		newDocs, existingDocs, err := partitionDocsPayload(inst, doctype, docs)
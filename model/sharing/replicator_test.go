@@ -21,6 +21,14 @@ const foos = "io.cozy.sharing.test.foos"
 const bars = "io.cozy.sharing.test.bars"
 const bazs = "io.cozy.sharing.test.bazs"
 
+func TestStaleSequenceNumber(t *testing.T) {
+	assert.False(t, isStaleSeq("", "12-abc"))
+	assert.False(t, isStaleSeq("5-abc", "12-def"))
+	assert.False(t, isStaleSeq("12-abc", "12-abc"))
+	assert.True(t, isStaleSeq("42-abc", "12-def"))
+	assert.True(t, isStaleSeq("12-abc", "12-def"))
+}
+
 func TestReplicator(t *testing.T) {
 	if testing.Short() {
 		t.Skip("an instance is required for this test: test skipped due to the use of --short flag")
@@ -75,6 +83,19 @@ func TestReplicator(t *testing.T) {
 		seq3, err := s.getLastSeqNumber(inst, m, "replicator")
 		assert.NoError(t, err)
 		assert.Equal(t, feed.Seq, seq3)
+
+		stale, err := isStaleCheckpoint(inst, seq3)
+		assert.NoError(t, err)
+		assert.False(t, stale)
+		stale, err = isStaleCheckpoint(inst, "42-abc")
+		assert.NoError(t, err)
+		assert.True(t, stale)
+
+		err = s.setLastSeqNumber(inst, m, "replicator", "2-abc")
+		assert.NoError(t, err)
+		seq4, err := s.getLastSeqNumber(inst, m, "replicator")
+		assert.NoError(t, err)
+		assert.Equal(t, "2-abc", seq4)
 	})
 
 	t.Run("InitialCopy", func(t *testing.T) {
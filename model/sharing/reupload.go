@@ -78,7 +78,9 @@ func askReuploadTo(inst *instance.Instance, s *Sharing, m *Member, c *Credential
 			"Authorization": "Bearer " + c.AccessToken.AccessToken,
 		},
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	c.signRequest(opts, nil)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, m, c, opts, nil)
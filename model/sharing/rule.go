@@ -7,6 +7,7 @@ import (
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
 )
 
 const (
@@ -22,6 +23,10 @@ const (
 	ActionRuleRevoke = "revoke"
 )
 
+// RuleWildcard can be used at the end of a value of a rule with a selector to
+// match all the documents where the selected field starts with this prefix.
+const RuleWildcard = "*"
+
 // Rule describes how the sharing behave when a document matching the rule is
 // added, updated or deleted.
 type Rule struct {
@@ -85,6 +90,9 @@ func (s *Sharing) ValidateRules() error {
 		} else if permission.CheckWritable(rule.DocType) != nil {
 			return ErrInvalidRule
 		}
+		if !rule.validSelector() {
+			return ErrInvalidRule
+		}
 		if rule.Add == "" {
 			s.Rules[i].Add = ActionRuleNone
 			rule.Add = s.Rules[i].Add
@@ -120,6 +128,66 @@ func (s *Sharing) ValidateRules() error {
 	return nil
 }
 
+// validSelector returns false if the selector is a dotted path with an empty
+// segment, or if the values have a wildcard that is not allowed.
+func (r Rule) validSelector() bool {
+	if r.Selector != "" {
+		for _, key := range strings.Split(r.Selector, ".") {
+			if key == "" {
+				return false
+			}
+		}
+	}
+	for _, val := range r.Values {
+		idx := strings.Index(val, RuleWildcard)
+		if idx < 0 {
+			continue
+		}
+		// The wildcard can only be used at the end of a value, with a
+		// non-empty prefix, and for a selector on a field of the documents.
+		if idx == 0 || idx != len(val)-len(RuleWildcard) {
+			return false
+		}
+		if r.Selector == "" || r.Selector == "id" || r.Selector == "_id" ||
+			r.Selector == couchdb.SelectorReferencedBy {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValue returns true if the given value is one of the values of the
+// rule, or starts with the prefix of a value with a wildcard.
+func (r Rule) matchValue(val string) bool {
+	for _, v := range r.Values {
+		if v == val {
+			return true
+		}
+		if prefix := strings.TrimSuffix(v, RuleWildcard); prefix != v &&
+			strings.HasPrefix(val, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFor returns the mango filter for finding the documents that match a
+// value of the rule: the value with a wildcard is used as a prefix. The filter
+// is validated, as the values come from the request that has created the
+// sharing.
+func (r Rule) filterFor(val string) (mango.Filter, error) {
+	var filter mango.Filter
+	if prefix := strings.TrimSuffix(val, RuleWildcard); prefix != val {
+		filter = mango.StartWith(r.Selector, prefix)
+	} else {
+		filter = mango.Equal(r.Selector, val)
+	}
+	if err := mango.Validate(filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
 // Accept returns true if the document matches the rule criteria
 func (r Rule) Accept(doctype string, doc map[string]interface{}) bool {
 	if r.Local || doctype != r.DocType {
@@ -147,19 +215,19 @@ func (r Rule) Accept(doctype string, doc map[string]interface{}) bool {
 			}
 		}
 	}
-	if val, ok := obj.(string); ok {
-		for _, v := range r.Values {
-			if v == val {
+	switch val := obj.(type) {
+	case string:
+		return r.matchValue(val)
+	case []string:
+		for _, vv := range val {
+			if r.matchValue(vv) {
 				return true
 			}
 		}
-	}
-	if val, ok := obj.([]string); ok {
+	case []interface{}:
 		for _, vv := range val {
-			for _, v := range r.Values {
-				if v == vv {
-					return true
-				}
+			if str, ok := vv.(string); ok && r.matchValue(str) {
+				return true
 			}
 		}
 	}
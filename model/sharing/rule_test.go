@@ -5,6 +5,7 @@ import (
 
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -91,6 +92,50 @@ func TestValidatesRules(t *testing.T) {
 		},
 	}
 	assert.NoError(t, s.ValidateRules())
+	s.Rules = []Rule{
+		{
+			Title:    "wildcard and nested selector are OK",
+			DocType:  "io.cozy.bills",
+			Selector: "metadata.provider",
+			Values:   []string{"EDF*", "Orange"},
+		},
+	}
+	assert.NoError(t, s.ValidateRules())
+	s.Rules = []Rule{
+		{
+			Title:   "wildcard needs a selector",
+			DocType: "io.cozy.bills",
+			Values:  []string{"EDF*"},
+		},
+	}
+	assert.Equal(t, ErrInvalidRule, s.ValidateRules())
+	s.Rules = []Rule{
+		{
+			Title:    "wildcard needs a prefix",
+			DocType:  "io.cozy.bills",
+			Selector: "vendor",
+			Values:   []string{"*"},
+		},
+	}
+	assert.Equal(t, ErrInvalidRule, s.ValidateRules())
+	s.Rules = []Rule{
+		{
+			Title:    "wildcard is only at the end",
+			DocType:  "io.cozy.bills",
+			Selector: "vendor",
+			Values:   []string{"E*F"},
+		},
+	}
+	assert.Equal(t, ErrInvalidRule, s.ValidateRules())
+	s.Rules = []Rule{
+		{
+			Title:    "nested selector with an empty segment",
+			DocType:  "io.cozy.bills",
+			Selector: "metadata..provider",
+			Values:   []string{"EDF"},
+		},
+	}
+	assert.Equal(t, ErrInvalidRule, s.ValidateRules())
 	s.Rules = []Rule{
 		{
 			Title:   "root cannot be shared",
@@ -147,6 +192,24 @@ func TestRuleAccept(t *testing.T) {
 	r.Values = []string{"group4"}
 	assert.False(t, r.Accept(doctype, doc))
 
+	// Wildcards
+	r.Selector = "one.two.three"
+	r.Values = []string{"12*"}
+	assert.True(t, r.Accept(doctype, doc))
+	r.Values = []string{"13*"}
+	assert.False(t, r.Accept(doctype, doc))
+	r.Selector = "groups"
+	r.Values = []string{"group*"}
+	assert.True(t, r.Accept(doctype, doc))
+	decoded := map[string]interface{}{
+		"_id":    "bar",
+		"groups": []interface{}{"team1", "team2"},
+	}
+	r.Values = []string{"team*"}
+	assert.True(t, r.Accept(doctype, decoded))
+	r.Values = []string{"group*"}
+	assert.False(t, r.Accept(doctype, decoded))
+
 	// Referenced_by
 	file := map[string]interface{}{
 		"_id": "84fa49e2-3409-11e8-86de-7fff926238b1",
@@ -166,6 +229,21 @@ func TestRuleAccept(t *testing.T) {
 	assert.False(t, r.Accept(consts.Files, file))
 }
 
+func TestRuleFilterFor(t *testing.T) {
+	r := Rule{
+		Title:    "test",
+		DocType:  "io.cozy.test.foos",
+		Selector: "one.two",
+		Values:   []string{"foo", "ba*"},
+	}
+	filter, err := r.filterFor("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, mango.Equal("one.two", "foo"), filter)
+	filter, err = r.filterFor("ba*")
+	assert.NoError(t, err)
+	assert.Equal(t, mango.StartWith("one.two", "ba"), filter)
+}
+
 func TestTriggersArgs(t *testing.T) {
 	r := Rule{
 		Title:    "test triggers args",
@@ -189,6 +267,48 @@ func TestTriggersArgs(t *testing.T) {
 	expected = "io.cozy.test.foos:CREATED,UPDATED,DELETED:foo"
 	assert.Equal(t, expected, r.TriggerArgs())
 
+	r = Rule{
+		Title:    "test wildcard",
+		DocType:  "io.cozy.bills",
+		Selector: "vendor",
+		Values:   []string{"EDF*"},
+	}
+	expected = "io.cozy.bills:CREATED:EDF*:vendor"
+	assert.Equal(t, expected, r.TriggerArgs())
+
+	r.Values = []string{"EDF"}
+	r.Selector = "metadata.provider"
+	expected = "io.cozy.bills:CREATED:EDF:metadata.provider"
+	assert.Equal(t, expected, r.TriggerArgs())
+
 	r.Local = true
 	assert.Equal(t, "", r.TriggerArgs())
 }
+
+func TestAlbumRules(t *testing.T) {
+	s := Sharing{
+		Rules: []Rule{
+			{
+				Title:   "album",
+				DocType: consts.PhotosAlbums,
+				Values:  []string{"album1"},
+			},
+			{
+				Title:    "photos",
+				DocType:  consts.Files,
+				Selector: couchdb.SelectorReferencedBy,
+				Values:   []string{consts.PhotosAlbums + "/album1"},
+			},
+			{
+				Title:    "playlist",
+				DocType:  consts.Files,
+				Selector: couchdb.SelectorReferencedBy,
+				Values:   []string{"io.cozy.music.playlists/foo"},
+			},
+		},
+	}
+	assert.False(t, s.Rules[0].isAlbumRule())
+	assert.True(t, s.Rules[1].isAlbumRule())
+	assert.False(t, s.Rules[2].isAlbumRule())
+	assert.Equal(t, []string{"album1"}, s.albumIDs())
+}
@@ -122,14 +122,23 @@ func (s *Sharing) Setup(inst *instance.Instance, m *Member) {
 	if pending, err := s.ReplicateTo(inst, m, true); err != nil {
 		inst.Logger().WithNamespace("sharing").
 			Warnf("Error on initial replication (%s): %s", s.SID, err)
+		if s.FirstFilesRule() == nil {
+			s.waitInitialSync(inst, m)
+		}
 		s.retryWorker(inst, "share-replicate", 0)
 	} else {
-		if pending {
-			s.pushJob(inst, "share-replicate")
-		}
 		if s.FirstFilesRule() == nil {
+			if pending {
+				s.waitInitialSync(inst, m)
+				s.pushJob(inst, "share-replicate")
+			} else {
+				s.notifyInitialSyncDone(inst, m)
+			}
 			return
 		}
+		if pending {
+			s.pushJob(inst, "share-replicate")
+		}
 		if err := s.AddUploadTrigger(inst); err != nil {
 			inst.Logger().WithNamespace("sharing").
 				Warnf("Error on setup upload trigger (%s): %s", s.SID, err)
@@ -138,6 +147,8 @@ func (s *Sharing) Setup(inst *instance.Instance, m *Member) {
 			inst.Logger().WithNamespace("sharing").
 				Warnf("Error on initial upload (%s): %s", s.SID, err)
 			s.retryWorker(inst, "share-upload", 0)
+		} else {
+			s.notifyInitialSyncDone(inst, m)
 		}
 	}
 
@@ -299,9 +310,13 @@ func FindMatchingDocs(inst *instance.Instance, rule Rule) ([]couchdb.JSONDoc, er
 			// Request the index for all values
 			for _, val := range rule.Values {
 				var results []couchdb.JSONDoc
+				selector, err := rule.filterFor(val)
+				if err != nil {
+					return nil, err
+				}
 				req := &couchdb.FindRequest{
 					UseIndex: name,
-					Selector: mango.Equal(rule.Selector, val),
+					Selector: selector,
 					Limit:    10000,
 				}
 				if err := couchdb.FindDocs(inst, rule.DocType, req, &results); err != nil {
@@ -61,6 +61,14 @@ type SharedRef struct {
 
 	// Infos is a map of sharing ids -> informations
 	Infos map[string]SharedInfo `json:"infos"`
+
+	// LocalID is the identifier of a local file with the same content that
+	// is used in place of the shared file (for the photos of an album)
+	LocalID string `json:"local_id,omitempty"`
+
+	// Links is a map of sharing ids -> identifiers of the shared files, for a
+	// local file that is used in place of a shared file
+	Links map[string]string `json:"links,omitempty"`
 }
 
 // ID returns the sharing qualified identifier
@@ -87,6 +95,12 @@ func (s *SharedRef) Clone() couchdb.Doc {
 	for k, v := range s.Infos {
 		cloned.Infos[k] = v
 	}
+	if s.Links != nil {
+		cloned.Links = make(map[string]string, len(s.Links))
+		for k, v := range s.Links {
+			cloned.Links[k] = v
+		}
+	}
 	return &cloned
 }
 
@@ -333,6 +347,12 @@ func UpdateShared(inst *instance.Instance, msg TrackMessage, evt TrackEvent) err
 		ref.Infos = make(map[string]SharedInfo)
 	}
 
+	// A local file used in place of a shared file is not sent to the other
+	// members, they already have the shared file.
+	if _, ok := ref.Links[msg.SharingID]; ok {
+		return nil
+	}
+
 	rev := evt.Doc.Rev()
 	_, wasTracked := ref.Infos[msg.SharingID]
 
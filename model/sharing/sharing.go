@@ -44,6 +44,8 @@ type Triggers struct {
 	TrackIDs    []string `json:"track_ids,omitempty"`
 	ReplicateID string   `json:"replicate_id,omitempty"`
 	UploadID    string   `json:"upload_id,omitempty"`
+	ExpireID    string   `json:"expire_id,omitempty"`
+	ReminderID  string   `json:"reminder_id,omitempty"`
 }
 
 // Sharing contains all the information about a sharing.
@@ -65,6 +67,26 @@ type Sharing struct {
 	ShortcutID  string    `json:"shortcut_id,omitempty"`
 	MovedFrom   string    `json:"moved_from,omitempty"`
 
+	// VerifyMembers can be used with an open sharing to ask the new members
+	// to prove their identity before the credentials are exchanged.
+	VerifyMembers bool `json:"verify_members,omitempty"`
+
+	// SyncAnnotations can be used to share the favorite flag and the color
+	// labels of the files between the members. By default, they are private
+	// to each member.
+	SyncAnnotations bool `json:"sync_annotations,omitempty"`
+
+	// MetadataOnly can be used with a sharing of files to replicate only the
+	// metadata of the files to the recipients. The content of a file is
+	// fetched from the owner's instance when a recipient opens it.
+	MetadataOnly bool `json:"metadata_only,omitempty"`
+
+	// LinkLocalCopies is set by a recipient to allow the photos of the
+	// shared albums to be matched with the files of its own library that
+	// have the same content. It is only used on a recipient, as those files
+	// are then added to the albums and visible to the other members.
+	LinkLocalCopies bool `json:"link_local_copies,omitempty"`
+
 	Rules []Rule `json:"rules"`
 
 	// Members[0] is the owner, Members[1...] are the recipients
@@ -73,6 +95,14 @@ type Sharing struct {
 	// On the owner, credentials[i] is associated to members[i+1]
 	// On a recipient, there is only credentials[0] (for the owner)
 	Credentials []Credentials `json:"credentials,omitempty"`
+
+	// Webhook is the URL where the events of the sharing are sent (only on
+	// the owner)
+	Webhook *Webhook `json:"webhook,omitempty"`
+
+	// ExpiresAt is the date when the sharing is automatically revoked by the
+	// owner.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // ID returns the sharing qualified identifier
@@ -110,8 +140,26 @@ func (s *Sharing) Clone() couchdb.Doc {
 		if s.Credentials[i].AccessToken != nil {
 			cloned.Credentials[i].AccessToken = s.Credentials[i].AccessToken.Clone()
 		}
+		if s.Credentials[i].Verification != nil {
+			verification := *s.Credentials[i].Verification
+			cloned.Credentials[i].Verification = &verification
+		}
 		cloned.Credentials[i].XorKey = make([]byte, len(s.Credentials[i].XorKey))
 		copy(cloned.Credentials[i].XorKey, s.Credentials[i].XorKey)
+		if s.Credentials[i].SigningKey != nil {
+			cloned.Credentials[i].SigningKey = make([]byte, len(s.Credentials[i].SigningKey))
+			copy(cloned.Credentials[i].SigningKey, s.Credentials[i].SigningKey)
+		}
+	}
+	if s.Webhook != nil {
+		hook := *s.Webhook
+		hook.Events = make([]string, len(s.Webhook.Events))
+		copy(hook.Events, s.Webhook.Events)
+		cloned.Webhook = &hook
+	}
+	if s.ExpiresAt != nil {
+		expiresAt := *s.ExpiresAt
+		cloned.ExpiresAt = &expiresAt
 	}
 	return &cloned
 }
@@ -135,6 +183,11 @@ func (s *Sharing) ReadOnlyFlag() bool {
 // ReadOnlyRules returns true if the rules forbid that a change on the
 // recipient's cozy instance can be propagated to the sharer's cozy.
 func (s *Sharing) ReadOnlyRules() bool {
+	if s.MetadataOnly {
+		// The recipients don't have the content of the files, so they
+		// can't make changes
+		return true
+	}
 	for _, rule := range s.Rules {
 		if rule.HasSync() {
 			return false
@@ -369,13 +422,32 @@ func (s *Sharing) Create(inst *instance.Instance) (*permission.Permission, error
 	if err := s.ValidateRules(); err != nil {
 		return nil, err
 	}
+	if s.MetadataOnly && s.FirstFilesRule() == nil {
+		return nil, ErrInvalidRule
+	}
 	if len(s.Members) < 2 {
 		return nil, ErrNoRecipients
 	}
+	if s.Owner {
+		if err := checkSharingsQuota(inst); err != nil {
+			return nil, err
+		}
+	}
+	if s.Owner && s.ExpiresAt != nil && !s.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiration
+	}
 
 	if err := couchdb.CreateDoc(inst, s); err != nil {
 		return nil, err
 	}
+	if s.Owner && s.ExpiresAt != nil {
+		if err := s.scheduleExpiration(inst); err != nil {
+			return nil, err
+		}
+		if err := couchdb.UpdateDoc(inst, s); err != nil {
+			return nil, err
+		}
+	}
 	if rule := s.FirstFilesRule(); rule != nil && rule.Selector != couchdb.SelectorReferencedBy {
 		if err := s.AddReferenceForSharingDir(inst, rule); err != nil {
 			inst.Logger().WithNamespace("sharing").
@@ -439,6 +511,9 @@ func (s *Sharing) Revoke(inst *instance.Instance) error {
 	if !s.Owner {
 		return ErrInvalidSharing
 	}
+	if inst.UnderLegalHold() {
+		return instance.ErrLegalHold
+	}
 	for i := range s.Credentials {
 		if err := s.RevokeMember(inst, i+1); err != nil {
 			errm = multierror.Append(errm, err)
@@ -489,6 +564,9 @@ func (s *Sharing) RevokeRecipient(inst *instance.Instance, index int) error {
 	if !s.Owner {
 		return ErrInvalidSharing
 	}
+	if inst.UnderLegalHold() {
+		return instance.ErrLegalHold
+	}
 	if err := s.RevokeMember(inst, index); err != nil {
 		return err
 	}
@@ -509,6 +587,9 @@ func (s *Sharing) RevokeRecipientBySelf(inst *instance.Instance, sharingDirTrash
 	if s.Owner || len(s.Members) == 0 {
 		return ErrInvalidSharing
 	}
+	if inst.UnderLegalHold() {
+		return instance.ErrLegalHold
+	}
 	if err := s.RevokeOwner(inst); err != nil {
 		return err
 	}
@@ -522,6 +603,10 @@ func (s *Sharing) RevokeRecipientBySelf(inst *instance.Instance, sharingDirTrash
 		inst.Logger().WithNamespace("sharing").
 			Warnf("RevokeRecipientBySelf failed to remove shared refs (%s)': %s", s.ID(), err)
 	}
+	if err := s.RemoveRemoteFiles(inst); err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Warnf("RevokeRecipientBySelf failed to remove remote files (%s)': %s", s.ID(), err)
+	}
 	if !sharingDirTrashed {
 		if rule := s.FirstFilesRule(); rule != nil && rule.Mime == "" {
 			if err := s.RemoveSharingDir(inst); err != nil {
@@ -563,6 +648,9 @@ func (s *Sharing) RemoveTriggers(inst *instance.Instance) error {
 	if err := removeSharingTrigger(inst, s.Triggers.UploadID); err != nil {
 		return err
 	}
+	if err := s.removeExpirationTriggers(inst); err != nil {
+		return err
+	}
 	s.Triggers = Triggers{}
 	return nil
 }
@@ -609,6 +697,9 @@ func (s *Sharing) RevokeByNotification(inst *instance.Instance) error {
 	if err := RemoveSharedRefs(inst, s.SID); err != nil {
 		return err
 	}
+	if err := s.RemoveRemoteFiles(inst); err != nil {
+		return err
+	}
 	if rule := s.FirstFilesRule(); rule != nil && rule.Mime == "" {
 		if err := s.RemoveSharingDir(inst); err != nil {
 			return err
@@ -667,7 +758,15 @@ func (s *Sharing) RevokeRecipientByNotification(inst *instance.Instance, m *Memb
 	m.Status = MemberStatusRevoked
 	*c = Credentials{}
 
-	return s.NoMoreRecipient(inst)
+	if err := s.NoMoreRecipient(inst); err != nil {
+		return err
+	}
+	for i := range s.Members {
+		if &s.Members[i] == m {
+			s.notifyWebhook(inst, WebhookMemberRevoked, i, "")
+		}
+	}
+	return nil
 }
 
 // NoMoreRecipient cleans up the sharing if there is no more active recipient
@@ -920,7 +1019,8 @@ func (s *Sharing) GetPreviewURL(inst *instance.Instance, state string) (string,
 			echo.HeaderAccept:      echo.MIMEApplicationJSON,
 			echo.HeaderContentType: echo.MIMEApplicationJSON,
 		},
-		Body: bytes.NewReader(body),
+		Body:   bytes.NewReader(body),
+		Client: request.InstancesClient(),
 	})
 	if err != nil {
 		return "", err
@@ -1023,7 +1123,9 @@ func (s *Sharing) sendPublicKeyToOwner(inst *instance.Instance, publicKey string
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	s.Credentials[0].signRequest(opts, body)
 	res, err := request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
 		res, err = RefreshToken(inst, err, s, &s.Members[0], &s.Credentials[0], opts, body)
@@ -1037,14 +1139,19 @@ func (s *Sharing) sendPublicKeyToOwner(inst *instance.Instance, publicKey string
 }
 
 // CheckSharings will scan all the io.cozy.sharings documents and check their
-// triggers and members/credentials.
-func CheckSharings(inst *instance.Instance, skipFSConsistency bool) ([]map[string]interface{}, error) {
+// triggers and members/credentials. With repair, it also tries to fix the
+// problems that can be fixed safely, and records the repairs in the checks.
+func CheckSharings(inst *instance.Instance, skipFSConsistency, repair bool) ([]map[string]interface{}, error) {
 	checks := []map[string]interface{}{}
 	err := couchdb.ForeachDocs(inst, consts.Sharings, func(_ string, data json.RawMessage) error {
 		s := &Sharing{}
 		if err := json.Unmarshal(data, s); err != nil {
 			return err
 		}
+		if repair {
+			from := len(checks)
+			defer func() { s.repairChecks(inst, checks[from:]) }()
+		}
 
 		if err := s.ValidateRules(); err != nil {
 			checks = append(checks, map[string]interface{}{
@@ -0,0 +1,152 @@
+package sharing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+)
+
+const (
+	// SignatureHeader is the HTTP header with the signature of a request
+	// between two members of a sharing.
+	SignatureHeader = "X-Cozy-Sharing-Signature"
+	// SignatureTimestampHeader is the HTTP header with the time (unix
+	// seconds) when a request has been signed.
+	SignatureTimestampHeader = "X-Cozy-Sharing-Timestamp"
+	// SignatureContentHeader is the HTTP header with the SHA-256 of the body
+	// of a signed request, or UNSIGNED-PAYLOAD for a file content.
+	SignatureContentHeader = "X-Cozy-Sharing-Content-Sha256"
+	// SignatureNonceHeader is the HTTP header with a random value, unique for
+	// each signed request, so that a request can't be replayed.
+	SignatureNonceHeader = "X-Cozy-Sharing-Nonce"
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// signatureMaxSkew is the maximal delay between the signature of a
+	// request and its verification. The nonces are kept in the cache for
+	// twice this delay, to reject the replays of a request.
+	signatureMaxSkew = 5 * time.Minute
+
+	// signatureNonceLen is the length of the nonces, in hexadecimal.
+	signatureNonceLen = 32
+)
+
+// MakeSigningKey generates a key for signing the requests between two members
+// of a sharing.
+func MakeSigningKey() []byte {
+	return crypto.GenerateRandomBytes(32)
+}
+
+// signRequest adds the signature headers to the request options, if a signing
+// key has been exchanged with the member. The body must be given for the JSON
+// payloads, and it can be nil for a file content that is streamed.
+func (c *Credentials) signRequest(opts *request.Options, body []byte) {
+	if c == nil || len(c.SigningKey) == 0 {
+		return
+	}
+	contentHash := unsignedPayload
+	if body != nil || opts.Body == nil {
+		contentHash = hashContent(body)
+	}
+	path := opts.Path
+	if query := opts.Queries.Encode(); query != "" {
+		path += "?" + query
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := hex.EncodeToString(crypto.GenerateRandomBytes(signatureNonceLen / 2))
+	if opts.Headers == nil {
+		opts.Headers = request.Headers{}
+	}
+	opts.Headers[SignatureTimestampHeader] = timestamp
+	opts.Headers[SignatureNonceHeader] = nonce
+	opts.Headers[SignatureContentHeader] = contentHash
+	opts.Headers[SignatureHeader] = computeSignature(c.SigningKey, opts.Method, path, timestamp, nonce, contentHash)
+}
+
+// VerifySignature checks the signature of a request sent by the member with
+// those credentials. The members that have not exchanged a signing key, like
+// the instances with an older version of the stack, are only authenticated by
+// their access token. For the requests with a file content, the body is not
+// read, and it is checked later with the md5sum of the file. A valid
+// signature can be used only once: its nonce is kept in the cache.
+func (c *Credentials) VerifySignature(req *http.Request, streamed bool, now time.Time) error {
+	if len(c.SigningKey) == 0 {
+		return nil
+	}
+	signature := req.Header.Get(SignatureHeader)
+	timestamp := req.Header.Get(SignatureTimestampHeader)
+	nonce := req.Header.Get(SignatureNonceHeader)
+	contentHash := req.Header.Get(SignatureContentHeader)
+	if signature == "" || timestamp == "" || contentHash == "" {
+		return ErrInvalidSignature
+	}
+	if len(nonce) != signatureNonceLen {
+		return ErrInvalidSignature
+	}
+	if _, err := hex.DecodeString(nonce); err != nil {
+		return ErrInvalidSignature
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > signatureMaxSkew || skew < -signatureMaxSkew {
+		return ErrInvalidSignature
+	}
+
+	if !streamed {
+		if contentHash == unsignedPayload {
+			return ErrInvalidSignature
+		}
+		var body []byte
+		if req.Body != nil {
+			body, err = io.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			req.Body.Close()
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if !hmac.Equal([]byte(hashContent(body)), []byte(contentHash)) {
+			return ErrInvalidSignature
+		}
+	}
+
+	path := req.URL.Path
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+	expected := computeSignature(c.SigningKey, req.Method, path, timestamp, nonce, contentHash)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	// The nonce is checked after the signature, so that only the requests
+	// signed by a member can fill the cache.
+	cache := config.GetConfig().CacheStorage
+	if !cache.SetNX("sharing-signature-nonce:"+nonce, []byte{1}, 2*signatureMaxSkew) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func hashContent(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func computeSignature(key []byte, method, path, timestamp, nonce, contentHash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + contentHash))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
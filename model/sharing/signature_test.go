@@ -0,0 +1,116 @@
+package sharing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/client/request"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	config.UseTestFile(t)
+	creds := &Credentials{SigningKey: MakeSigningKey()}
+
+	// toRequest builds the request received by the other instance for the
+	// given options
+	toRequest := func(opts *request.Options, body []byte) *http.Request {
+		u := url.URL{Scheme: "https", Host: "bob.cozy.example", Path: opts.Path}
+		u.RawQuery = opts.Queries.Encode()
+		req := httptest.NewRequest(opts.Method, u.String(), bytes.NewReader(body))
+		for k, v := range opts.Headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		body := []byte(`{"io.cozy.files":[]}`)
+		opts := &request.Options{
+			Method:  http.MethodPost,
+			Path:    "/sharings/123/_bulk_docs",
+			Queries: url.Values{"from": {"alice.cozy.example"}},
+			Headers: request.Headers{"Content-Type": "application/json"},
+			Body:    bytes.NewReader(body),
+		}
+		creds.signRequest(opts, body)
+		req := toRequest(opts, body)
+		require.NoError(t, creds.VerifySignature(req, false, time.Now()))
+
+		// The body can still be read by the handler
+		read, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		assert.Equal(t, body, read)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		body := []byte(`{"io.cozy.files":[]}`)
+		opts := &request.Options{
+			Method: http.MethodPost,
+			Path:   "/sharings/123/_bulk_docs",
+			Body:   bytes.NewReader(body),
+		}
+		creds.signRequest(opts, body)
+
+		req := toRequest(opts, []byte(`{"io.cozy.files":[{"_id":"456"}]}`))
+		assert.ErrorIs(t, creds.VerifySignature(req, false, time.Now()), ErrInvalidSignature)
+
+		req = toRequest(opts, body)
+		req.URL.Path = "/sharings/789/_bulk_docs"
+		assert.ErrorIs(t, creds.VerifySignature(req, false, time.Now()), ErrInvalidSignature)
+
+		req = toRequest(opts, body)
+		other := &Credentials{SigningKey: MakeSigningKey()}
+		assert.ErrorIs(t, other.VerifySignature(req, false, time.Now()), ErrInvalidSignature)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		opts := &request.Options{Method: http.MethodDelete, Path: "/sharings/123/initial"}
+		creds.signRequest(opts, nil)
+		req := toRequest(opts, nil)
+		later := time.Now().Add(10 * time.Minute)
+		assert.ErrorIs(t, creds.VerifySignature(req, false, later), ErrInvalidSignature)
+
+		// The same request can't be sent twice
+		require.NoError(t, creds.VerifySignature(toRequest(opts, nil), false, time.Now()))
+		assert.ErrorIs(t, creds.VerifySignature(toRequest(opts, nil), false, time.Now()), ErrInvalidSignature)
+
+		// Nor without its nonce
+		creds.signRequest(opts, nil)
+		req = toRequest(opts, nil)
+		req.Header.Del(SignatureNonceHeader)
+		assert.ErrorIs(t, creds.VerifySignature(req, false, time.Now()), ErrInvalidSignature)
+	})
+
+	t.Run("Streamed", func(t *testing.T) {
+		opts := &request.Options{
+			Method: http.MethodPut,
+			Path:   "/sharings/123/io.cozy.files/456",
+			Body:   bytes.NewReader([]byte("content")),
+		}
+		creds.signRequest(opts, nil)
+		assert.Equal(t, unsignedPayload, opts.Headers[SignatureContentHeader])
+		req := toRequest(opts, []byte("content"))
+		assert.NoError(t, creds.VerifySignature(req, true, time.Now()))
+		req = toRequest(opts, []byte("content"))
+		assert.ErrorIs(t, creds.VerifySignature(req, false, time.Now()), ErrInvalidSignature)
+	})
+
+	t.Run("NoSigningKey", func(t *testing.T) {
+		old := &Credentials{}
+		opts := &request.Options{Method: http.MethodGet, Path: "/sharings/123/io.cozy.files/456"}
+		old.signRequest(opts, nil)
+		assert.Empty(t, opts.Headers[SignatureHeader])
+		assert.NoError(t, old.VerifySignature(toRequest(opts, nil), false, time.Now()))
+
+		// A member with a signing key must sign its requests
+		assert.ErrorIs(t, creds.VerifySignature(toRequest(opts, nil), false, time.Now()), ErrInvalidSignature)
+	})
+}
@@ -0,0 +1,408 @@
+package sharing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+)
+
+const (
+	// suggestionsDocID is the identifier of the single document where the
+	// suggestions are stored.
+	suggestionsDocID = "suggestions"
+	// suggestionsHalfLife is the age of a sharing for which it counts for
+	// half in the frequency of a candidate.
+	suggestionsHalfLife = 90 * 24 * time.Hour
+	// maxSuggestionDocIDs is the maximal number of identifiers of shared
+	// documents kept for a candidate.
+	maxSuggestionDocIDs = 50
+	// doctypeBonus is the bonus in the score of a candidate with whom only
+	// documents of the same doctype have been shared.
+	doctypeBonus = 1.0
+	// sameDocBonus is the bonus in the score of a candidate with whom the
+	// document, or its parent directory, has already been shared.
+	sameDocBonus = 2.0
+)
+
+// SuggestionCandidate is a person with whom the user has already shared some
+// documents, and who can be suggested as a recipient for a new sharing.
+type SuggestionCandidate struct {
+	Key          string         `json:"key"`
+	ContactID    string         `json:"contact_id,omitempty"`
+	Name         string         `json:"name,omitempty"`
+	Email        string         `json:"email,omitempty"`
+	Instance     string         `json:"instance,omitempty"`
+	Sharings     int            `json:"sharings"`
+	LastSharedAt time.Time      `json:"last_shared_at"`
+	Frequency    float64        `json:"frequency"`
+	Doctypes     map[string]int `json:"doctypes,omitempty"`
+	DocIDs       []string       `json:"doc_ids,omitempty"`
+}
+
+// Suggestions is the document where the candidates for the sharing
+// suggestions are stored. It is computed periodically by the
+// sharing-suggestions worker, from the sharings and the contacts of the
+// instance, and nothing is sent outside of the instance.
+type Suggestions struct {
+	DocID      string                 `json:"_id,omitempty"`
+	DocRev     string                 `json:"_rev,omitempty"`
+	ComputedAt time.Time              `json:"computed_at"`
+	Candidates []*SuggestionCandidate `json:"candidates"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (s *Suggestions) ID() string { return s.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (s *Suggestions) Rev() string { return s.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (s *Suggestions) DocType() string { return consts.SharingsSuggestions }
+
+// Clone implements couchdb.Doc
+func (s *Suggestions) Clone() couchdb.Doc {
+	cloned := *s
+	cloned.Candidates = make([]*SuggestionCandidate, len(s.Candidates))
+	for i, c := range s.Candidates {
+		candidate := *c
+		candidate.Doctypes = make(map[string]int, len(c.Doctypes))
+		for k, v := range c.Doctypes {
+			candidate.Doctypes[k] = v
+		}
+		candidate.DocIDs = append([]string{}, c.DocIDs...)
+		cloned.Candidates[i] = &candidate
+	}
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (s *Suggestions) SetID(id string) { s.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (s *Suggestions) SetRev(rev string) { s.DocRev = rev }
+
+var _ couchdb.Doc = &Suggestions{}
+
+// APISuggestion is used to serialize a suggested recipient to JSON-API.
+type APISuggestion struct {
+	key          string
+	ContactID    string    `json:"contact_id,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	Email        string    `json:"email,omitempty"`
+	Instance     string    `json:"instance,omitempty"`
+	Sharings     int       `json:"sharings"`
+	LastSharedAt time.Time `json:"last_shared_at"`
+	Score        float64   `json:"score"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (a *APISuggestion) ID() string { return a.key }
+
+// Rev is used to implement the couchdb.Doc interface
+func (a *APISuggestion) Rev() string { return "" }
+
+// DocType is used to implement the couchdb.Doc interface
+func (a *APISuggestion) DocType() string { return consts.SharingsSuggestions }
+
+// Clone implements couchdb.Doc
+func (a *APISuggestion) Clone() couchdb.Doc {
+	cloned := *a
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (a *APISuggestion) SetID(id string) {}
+
+// SetRev is used to implement the couchdb.Doc interface
+func (a *APISuggestion) SetRev(rev string) {}
+
+// Included is part of jsonapi.Object interface
+func (a *APISuggestion) Included() []jsonapi.Object { return nil }
+
+// Relationships is part of jsonapi.Object interface
+func (a *APISuggestion) Relationships() jsonapi.RelationshipMap { return nil }
+
+// Links is part of jsonapi.Object interface
+func (a *APISuggestion) Links() *jsonapi.LinksList { return nil }
+
+var _ jsonapi.Object = (*APISuggestion)(nil)
+
+// Rank returns the candidates sorted by their score for a new sharing of a
+// document of the given doctype. The ids are the identifier of the document
+// and of its parent directory, if known: the candidates with whom they have
+// already been shared are ranked first.
+func (s *Suggestions) Rank(doctype string, ids []string, limit int) []*APISuggestion {
+	ranked := make([]*APISuggestion, 0, len(s.Candidates))
+	for _, c := range s.Candidates {
+		score := c.Frequency
+		if c.Sharings > 0 && doctype != "" {
+			score += doctypeBonus * float64(c.Doctypes[doctype]) / float64(c.Sharings)
+		}
+		if hasAnyDocID(c, ids) {
+			score += sameDocBonus
+		}
+		ranked = append(ranked, &APISuggestion{
+			key:          c.Key,
+			ContactID:    c.ContactID,
+			Name:         c.Name,
+			Email:        c.Email,
+			Instance:     c.Instance,
+			Sharings:     c.Sharings,
+			LastSharedAt: c.LastSharedAt,
+			Score:        math.Round(score*1000) / 1000,
+		})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].LastSharedAt.After(ranked[j].LastSharedAt)
+	})
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+func hasAnyDocID(c *SuggestionCandidate, ids []string) bool {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		for _, docID := range c.DocIDs {
+			if docID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetSuggestions returns the suggestions of the instance. If they have not
+// been computed yet, they are computed now.
+func GetSuggestions(inst *instance.Instance) (*Suggestions, error) {
+	var doc Suggestions
+	err := couchdb.GetDoc(inst, consts.SharingsSuggestions, suggestionsDocID, &doc)
+	if err == nil {
+		return &doc, nil
+	}
+	if !couchdb.IsNotFoundError(err) {
+		return nil, err
+	}
+	return ComputeSuggestions(inst)
+}
+
+// ComputeSuggestions looks at the sharings and the contacts of the instance
+// to compute the candidates for the sharing suggestions, and saves them.
+func ComputeSuggestions(inst *instance.Instance) (*Suggestions, error) {
+	var sharings []*Sharing
+	err := couchdb.ForeachDocs(inst, consts.Sharings, func(_ string, raw json.RawMessage) error {
+		var s Sharing
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		sharings = append(sharings, &s)
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+
+	var contacts []*contact.Contact
+	err = couchdb.ForeachDocs(inst, consts.Contacts, func(_ string, raw json.RawMessage) error {
+		c := contact.New()
+		if err := json.Unmarshal(raw, c); err != nil {
+			return err
+		}
+		if !c.IsTrashed() {
+			contacts = append(contacts, c)
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	doc := &Suggestions{
+		DocID:      suggestionsDocID,
+		ComputedAt: now,
+		Candidates: computeCandidates(sharings, contacts, inst.Domain, now),
+	}
+	var old Suggestions
+	err = couchdb.GetDoc(inst, consts.SharingsSuggestions, suggestionsDocID, &old)
+	switch {
+	case err == nil:
+		doc.DocRev = old.DocRev
+		err = couchdb.UpdateDoc(inst, doc)
+	case couchdb.IsNotFoundError(err):
+		err = couchdb.CreateNamedDocWithDB(inst, doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// computeCandidates aggregates the members of the sharings by person. A
+// member is identified by the contact with the same email address or Cozy
+// URL, or else by its email address or Cozy URL. The member for the instance
+// itself, identified by its domain, is ignored.
+func computeCandidates(sharings []*Sharing, contacts []*contact.Contact, domain string, now time.Time) []*SuggestionCandidate {
+	byEmail := make(map[string]*contact.Contact)
+	byHost := make(map[string]*contact.Contact)
+	for _, c := range contacts {
+		for _, email := range c.Emails() {
+			byEmail[contact.NormalizeEmail(email)] = c
+		}
+		if host := cozyHost(c.PrimaryCozyURL()); host != "" {
+			byHost[host] = c
+		}
+	}
+
+	// Sort the sharings from the most recent, so that the most recently
+	// shared documents are kept for each candidate.
+	sort.SliceStable(sharings, func(i, j int) bool {
+		return sharings[i].CreatedAt.After(sharings[j].CreatedAt)
+	})
+
+	candidates := make(map[string]*SuggestionCandidate)
+	var order []string
+	for _, s := range sharings {
+		weight := math.Pow(0.5, float64(now.Sub(s.CreatedAt))/float64(suggestionsHalfLife))
+		if weight > 1 {
+			weight = 1
+		}
+		seen := make(map[string]bool)
+		for i, m := range s.Members {
+			if s.Owner && i == 0 {
+				continue
+			}
+			email := contact.NormalizeEmail(m.Email)
+			host := cozyHost(m.Instance)
+			if email == "" && host == "" {
+				continue
+			}
+			if host != "" && host == domain {
+				continue
+			}
+
+			var key string
+			var c *contact.Contact
+			if email != "" {
+				c = byEmail[email]
+			}
+			if c == nil && host != "" {
+				c = byHost[host]
+			}
+			switch {
+			case c != nil:
+				key = c.ID()
+			case email != "":
+				key = "email:" + email
+			default:
+				key = "cozy:" + host
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			candidate, ok := candidates[key]
+			if !ok {
+				candidate = &SuggestionCandidate{
+					Key:      key,
+					Doctypes: make(map[string]int),
+				}
+				if c != nil {
+					candidate.ContactID = c.ID()
+					candidate.Name = c.PrimaryName()
+				}
+				candidates[key] = candidate
+				order = append(order, key)
+			}
+			if candidate.Name == "" {
+				candidate.Name = m.PrimaryName()
+			}
+			if candidate.Email == "" {
+				candidate.Email = m.Email
+			}
+			if candidate.Instance == "" {
+				candidate.Instance = m.Instance
+			}
+			candidate.Sharings++
+			candidate.Frequency += weight
+			if s.CreatedAt.After(candidate.LastSharedAt) {
+				candidate.LastSharedAt = s.CreatedAt
+			}
+			for _, r := range s.Rules {
+				if r.Local {
+					continue
+				}
+				candidate.Doctypes[r.DocType]++
+				for _, id := range r.Values {
+					if len(candidate.DocIDs) >= maxSuggestionDocIDs {
+						break
+					}
+					candidate.DocIDs = append(candidate.DocIDs, id)
+				}
+			}
+		}
+	}
+
+	list := make([]*SuggestionCandidate, 0, len(order))
+	for _, key := range order {
+		c := candidates[key]
+		c.Frequency = math.Round(c.Frequency*1000) / 1000
+		list = append(list, c)
+	}
+	return list
+}
+
+func cozyHost(cozyURL string) string {
+	if cozyURL == "" {
+		return ""
+	}
+	if !strings.Contains(cozyURL, "://") {
+		cozyURL = "https://" + cozyURL
+	}
+	u, err := url.Parse(cozyURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// EnsureSuggestionsTrigger creates the trigger for computing the sharing
+// suggestions every day, if it does not exist yet.
+func EnsureSuggestionsTrigger(inst *instance.Instance) {
+	sched := job.System()
+	infos := job.TriggerInfos{
+		Type:       "@cron",
+		WorkerType: "sharing-suggestions",
+	}
+	if sched.HasTrigger(inst, infos) {
+		return
+	}
+	now := time.Now()
+	infos.Arguments = fmt.Sprintf("0 %d %d * * *", now.Minute(), (now.Hour()+6)%24)
+	t, err := job.NewTrigger(inst, infos, nil)
+	if err == nil {
+		err = sched.AddTrigger(t)
+	}
+	if err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Errorf("Cannot create sharing-suggestions trigger: %s", err)
+	}
+}
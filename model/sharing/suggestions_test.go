@@ -0,0 +1,106 @@
+package sharing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestions(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	bob := contact.New()
+	bob.SetID("contact-bob")
+	bob.M["fullname"] = "Bob"
+	bob.M["email"] = []interface{}{
+		map[string]interface{}{"address": "bob@example.net"},
+	}
+	dave := contact.New()
+	dave.SetID("contact-dave")
+	dave.M["fullname"] = "Dave"
+	dave.M["cozy"] = []interface{}{
+		map[string]interface{}{"url": "https://dave.cozy.example", "primary": true},
+	}
+	contacts := []*contact.Contact{bob, dave}
+
+	sharings := []*Sharing{
+		{
+			Owner:     true,
+			CreatedAt: now.Add(-24 * time.Hour),
+			Rules:     []Rule{{DocType: consts.Files, Values: []string{"dir-photos"}}},
+			Members: []Member{
+				{Status: MemberStatusOwner, Email: "alice@example.net", Instance: "https://alice.cozy.example"},
+				{Status: MemberStatusReady, Email: "Bob@example.net ", Instance: "https://bob.cozy.example"},
+				{Status: MemberStatusPendingInvitation, Name: "Carol", Email: "carol@example.net"},
+			},
+		},
+		{
+			Owner:     true,
+			CreatedAt: now.Add(-180 * 24 * time.Hour),
+			Rules:     []Rule{{DocType: "io.cozy.notes", Values: []string{"note-1"}}},
+			Members: []Member{
+				{Status: MemberStatusOwner, Email: "alice@example.net", Instance: "https://alice.cozy.example"},
+				{Status: MemberStatusReady, Email: "carol@example.net"},
+			},
+		},
+		{
+			Owner:     false,
+			CreatedAt: now.Add(-10 * 24 * time.Hour),
+			Rules:     []Rule{{DocType: consts.Files, Values: []string{"dir-work"}}},
+			Members: []Member{
+				{Status: MemberStatusOwner, PublicName: "Dave", Instance: "https://dave.cozy.example"},
+				{Status: MemberStatusReady, Email: "alice@example.net", Instance: "https://alice.cozy.example"},
+			},
+		},
+	}
+
+	candidates := computeCandidates(sharings, contacts, "alice.cozy.example", now)
+	require.Len(t, candidates, 3)
+	byKey := make(map[string]*SuggestionCandidate)
+	for _, c := range candidates {
+		byKey[c.Key] = c
+	}
+
+	t.Run("ComputeCandidates", func(t *testing.T) {
+		b := byKey["contact-bob"]
+		require.NotNil(t, b)
+		assert.Equal(t, "Bob", b.Name)
+		assert.Equal(t, 1, b.Sharings)
+		assert.Equal(t, []string{"dir-photos"}, b.DocIDs)
+
+		c := byKey["email:carol@example.net"]
+		require.NotNil(t, c)
+		assert.Empty(t, c.ContactID)
+		assert.Equal(t, "Carol", c.Name)
+		assert.Equal(t, 2, c.Sharings)
+		assert.Equal(t, 1, c.Doctypes["io.cozy.notes"])
+		assert.Less(t, c.Frequency, 1.5)
+
+		d := byKey["contact-dave"]
+		require.NotNil(t, d)
+		assert.Equal(t, "Dave", d.Name)
+		assert.Equal(t, 1, d.Sharings)
+	})
+
+	t.Run("Rank", func(t *testing.T) {
+		doc := &Suggestions{Candidates: candidates}
+		ranked := doc.Rank(consts.Files, []string{"photo-1", "dir-photos"}, 10)
+		require.Len(t, ranked, 3)
+		assert.Equal(t, "contact-bob", ranked[0].ID())
+
+		ranked = doc.Rank("io.cozy.notes", nil, 1)
+		require.Len(t, ranked, 1)
+		assert.Equal(t, "email:carol@example.net", ranked[0].ID())
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		doc := &Suggestions{Candidates: candidates}
+		cloned := doc.Clone().(*Suggestions)
+		cloned.Candidates[0].Doctypes["io.cozy.tests"] = 1
+		assert.NotContains(t, doc.Candidates[0].Doctypes, "io.cozy.tests")
+	})
+}
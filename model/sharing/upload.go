@@ -117,7 +117,9 @@ func (s *Sharing) sendInitialEndNotif(inst *instance.Instance, m *Member) error
 		Headers: request.Headers{
 			echo.HeaderAuthorization: "Bearer " + c.AccessToken.AccessToken,
 		},
+		Client: request.InstancesClient(),
 	}
+	c.signRequest(opts, nil)
 	res, err := request.Req(opts)
 	if err != nil {
 		return err
@@ -143,6 +145,19 @@ func (s *Sharing) UploadTo(inst *instance.Instance, m *Member, lastTry bool) (bo
 	}
 	inst.Logger().WithNamespace("upload").Debugf("lastSeq = %s", lastSeq)
 
+	// The upload is idempotent, so a stale checkpoint can be safely reset to
+	// check again all the files from the beginning of the changes feed.
+	if stale, err := isStaleCheckpoint(inst, lastSeq); err != nil {
+		return false, err
+	} else if stale {
+		inst.Logger().WithNamespace("upload").
+			Warnf("Reset the upload checkpoint for sharing %s (last_seq = %s)", s.SID, lastSeq)
+		if err := s.clearLastSequenceNumber(inst, m, "upload"); err != nil {
+			return false, err
+		}
+		lastSeq = ""
+	}
+
 	file, ruleIndex, seq, err := s.findNextFileToUpload(inst, lastSeq)
 	if errors.Is(err, ErrInternalServerError) {
 		// Retrying is useless in this case, let's skip this file
@@ -273,7 +288,9 @@ func (s *Sharing) uploadFile(inst *instance.Instance, m *Member, file map[string
 		},
 		Body:       bytes.NewReader(body),
 		ParseError: ParseRequestError,
+		Client:     request.InstancesClient(),
 	}
+	creds.signRequest(opts, body)
 	var res *http.Response
 	res, err = request.Req(opts)
 	if res != nil && res.StatusCode/100 == 4 {
@@ -302,7 +319,15 @@ func (s *Sharing) uploadFile(inst *instance.Instance, m *Member, file map[string
 	if err != nil {
 		return err
 	}
-	content, err := fs.OpenFile(fileDoc)
+	// The content of a quarantined file is not sent to the other members
+	if fileDoc.Quarantined() {
+		inst.Logger().WithNamespace("upload").
+			Infof("Quarantined file %s not uploaded", origFileID)
+		return nil
+	}
+	// The content is streamed from the storage with its expected length, to
+	// avoid buffering it.
+	content, err := fs.OpenFileAt(fileDoc, 0, fileDoc.ByteSize)
 	if err != nil {
 		return err
 	}
@@ -318,9 +343,11 @@ func (s *Sharing) uploadFile(inst *instance.Instance, m *Member, file map[string
 			echo.HeaderContentType:   fileDoc.Mime,
 			echo.HeaderAuthorization: "Bearer " + creds.AccessToken.AccessToken,
 		},
-		Body:   content,
-		Client: http.DefaultClient,
+		Body:          content,
+		ContentLength: fileDoc.ByteSize,
+		Client:        request.InstancesStreamingClient(),
 	}
+	creds.signRequest(opts2, nil)
 	res2, err := request.Req(opts2)
 	if err != nil {
 		if res2 != nil && res2.StatusCode/100 == 5 {
@@ -367,6 +394,9 @@ func (s *Sharing) SyncFile(inst *instance.Instance, target *FileDocWithRevisions
 	if len(target.MD5Sum) == 0 {
 		return nil, vfs.ErrInvalidHash
 	}
+	if s.MetadataOnly {
+		return nil, s.syncRemoteFile(inst, target)
+	}
 	sid := consts.Files + "/" + target.DocID
 	mu := config.Lock().ReadWrite(inst, "shared/"+sid)
 	if err := mu.Lock(); err != nil {
@@ -376,9 +406,26 @@ func (s *Sharing) SyncFile(inst *instance.Instance, target *FileDocWithRevisions
 	current, err := inst.VFS().FileByID(target.DocID)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			if rule, _ := s.findRuleForNewFile(target.FileDoc); rule == nil {
+			linkedRef, err := s.findLinkedRef(inst, target.DocID)
+			if err != nil {
+				return nil, err
+			}
+			if linkedRef != nil {
+				return s.syncLocalCopy(inst, target, linkedRef)
+			}
+			rule, ruleIndex := s.findRuleForNewFile(target.FileDoc)
+			if rule == nil {
 				return nil, ErrSafety
 			}
+			if rule.isAlbumRule() {
+				linked, err := s.linkLocalCopy(inst, target, ruleIndex)
+				if err != nil {
+					return nil, err
+				}
+				if linked {
+					return nil, nil
+				}
+			}
 			return s.createUploadKey(inst, target)
 		}
 		return nil, err
@@ -460,7 +507,7 @@ func (s *Sharing) updateFileMetadata(inst *instance.Instance, target *FileDocWit
 		return err
 	}
 	newdoc.ResetFullpath()
-	copySafeFieldsToFile(target.FileDoc, newdoc)
+	s.copySafeFieldsToFile(target.FileDoc, newdoc)
 	infos := ref.Infos[s.SID]
 	rule := &s.Rules[infos.Rule]
 	newdoc.ReferencedBy = buildReferencedBy(target.FileDoc, newdoc, rule)
@@ -589,7 +636,7 @@ func (s *Sharing) UploadNewFile(inst *instance.Instance, target *FileDocWithRevi
 	}
 	newdoc.SetID(target.DocID)
 	ref.SID = consts.Files + "/" + newdoc.DocID
-	copySafeFieldsToFile(target.FileDoc, newdoc)
+	s.copySafeFieldsToFile(target.FileDoc, newdoc)
 
 	ref.Infos[s.SID] = SharedInfo{Rule: ruleIndex, Binary: true}
 	newdoc.ReferencedBy = buildReferencedBy(target.FileDoc, nil, rule)
@@ -666,6 +713,9 @@ func (s *Sharing) countReceivedFiles(inst *instance.Instance) {
 			"count": count,
 		},
 	}
+	if albums := s.countAlbumFiles(inst); albums != nil {
+		doc.M["albums"] = albums
+	}
 	realtime.GetHub().Publish(inst, realtime.EventUpdate, &doc, nil)
 }
 
@@ -702,7 +752,7 @@ func (s *Sharing) UploadExistingFile(inst *instance.Instance, target *FileDocWit
 	}
 	rule := &s.Rules[infos.Rule]
 	newdoc.ReferencedBy = buildReferencedBy(target.FileDoc, olddoc, rule)
-	copySafeFieldsToFile(target.FileDoc, newdoc)
+	s.copySafeFieldsToFile(target.FileDoc, newdoc)
 	newdoc.DocName = target.DocName
 	if err := s.prepareFileWithAncestors(inst, newdoc, target.DirID); err != nil {
 		return err
@@ -0,0 +1,182 @@
+package sharing
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/cozy/cozy-stack/pkg/limits"
+	"github.com/cozy/cozy-stack/pkg/mail"
+)
+
+const (
+	// VerifiedByEmail is used when a member has proved their identity with
+	// the code sent to their email address.
+	VerifiedByEmail = "email"
+	// VerifiedByInstance is used when a member has proved their identity by
+	// accepting the sharing on the Cozy instance they were invited on.
+	VerifiedByInstance = "instance"
+)
+
+// verificationCodeTTL is the validity duration of a verification code
+const verificationCodeTTL = 1 * time.Hour
+
+// verificationMaxAttempts is the number of wrong codes that can be tried
+// before a new code must be sent
+const verificationMaxAttempts = 5
+
+// VerificationCode is a code sent by email to a new member of an open sharing
+// to prove their identity.
+type VerificationCode struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Attempts  int       `json:"attempts,omitempty"`
+}
+
+// expired returns true if the code can no longer be used
+func (v *VerificationCode) expired() bool {
+	return v == nil || time.Now().After(v.ExpiresAt) || v.Attempts >= verificationMaxAttempts
+}
+
+// newVerificationCode generates a code of 6 digits
+func newVerificationCode() *VerificationCode {
+	n := binary.BigEndian.Uint32(crypto.GenerateRandomBytes(4))
+	return &VerificationCode{
+		Code:      fmt.Sprintf("%06d", n%1000000),
+		ExpiresAt: time.Now().Add(verificationCodeTTL),
+	}
+}
+
+// verificationRequired returns true if the new members of this sharing must
+// prove their identity before accepting it.
+func (s *Sharing) verificationRequired() bool {
+	return s.Owner && s.Open && s.VerifyMembers
+}
+
+// checkVerification is called before registering the Cozy URL of a member.
+// When the verification is required, the URL is accepted only if:
+//   - the member has proved their identity by email (and they have not yet
+//     registered another URL)
+//   - or it is the URL of the instance the member was invited on, and the
+//     sharing will be accepted on this instance.
+func (s *Sharing) checkVerification(m *Member, cozyURL string) error {
+	if !s.verificationRequired() {
+		return nil
+	}
+	if m.VerifiedBy == VerifiedByEmail && m.VerifiedAt != nil &&
+		(m.Instance == "" || m.Instance == cozyURL) {
+		return nil
+	}
+	if m.Instance != "" && m.Instance == cozyURL && m.VerifiedBy != VerifiedByEmail {
+		// The proof will be given when the answer comes from this instance
+		m.VerifiedBy = VerifiedByInstance
+		return nil
+	}
+	return ErrMemberNotVerified
+}
+
+// verifyAnswer is called when a member accepts the sharing, before the
+// credentials are exchanged.
+func (s *Sharing) verifyAnswer(m *Member) error {
+	if !s.verificationRequired() || m.VerifiedAt != nil {
+		return nil
+	}
+	if m.VerifiedBy != VerifiedByInstance {
+		return ErrMemberNotVerified
+	}
+	now := time.Now().UTC()
+	m.VerifiedAt = &now
+	return nil
+}
+
+// SendVerificationCode sends by email a code to the member, that they can use
+// to prove their identity. If a code has already been sent and is still
+// valid, no new mail is sent.
+func (s *Sharing) SendVerificationCode(inst *instance.Instance, m *Member) error {
+	if !s.verificationRequired() {
+		return ErrInvalidSharing
+	}
+	if m.Email == "" {
+		return ErrMemberNotVerified
+	}
+	creds := s.FindCredentials(m)
+	if creds == nil {
+		return ErrInvalidSharing
+	}
+	if !creds.Verification.expired() {
+		return nil
+	}
+	// A member can only ask a few codes, else the 6 digits could be
+	// bruteforced by asking a new code after each series of attempts.
+	key := inst.DomainName() + ":" + s.SID + ":" + m.Email
+	if err := config.GetRateLimiter().CheckRateLimitKey(key, limits.SharingVerificationCodeType); limits.IsLimitReachedOrExceeded(err) {
+		return ErrVerificationLocked
+	}
+	creds.Verification = newVerificationCode()
+	if err := couchdb.UpdateDoc(inst, s); err != nil {
+		return err
+	}
+
+	sharer, _ := csettings.PublicName(inst)
+	addr := &mail.Address{
+		Email: m.Email,
+		Name:  m.PrimaryName(),
+	}
+	msg, err := job.NewMessage(mail.Options{
+		Mode:         "from",
+		To:           []*mail.Address{addr},
+		TemplateName: "sharing_verification",
+		TemplateValues: map[string]interface{}{
+			"SharerPublicName": sharer,
+			"Description":      s.Description,
+			"Code":             creds.Verification.Code,
+		},
+		RecipientName: addr.Name,
+		Layout:        mail.CozyCloudLayout,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "sendmail",
+		Message:    msg,
+	})
+	return err
+}
+
+// VerifyMemberByCode checks the code sent by email to the member. If it is
+// valid, the member is marked as verified and can register the URL of their
+// Cozy instance.
+func (s *Sharing) VerifyMemberByCode(inst *instance.Instance, m *Member, code string) error {
+	if !s.verificationRequired() {
+		return nil
+	}
+	creds := s.FindCredentials(m)
+	if creds == nil {
+		return ErrInvalidSharing
+	}
+	if creds.Verification.expired() {
+		return ErrInvalidVerificationCode
+	}
+	if subtle.ConstantTimeCompare([]byte(creds.Verification.Code), []byte(code)) != 1 {
+		creds.Verification.Attempts++
+		if err := couchdb.UpdateDoc(inst, s); err != nil {
+			return err
+		}
+		return ErrInvalidVerificationCode
+	}
+	now := time.Now().UTC()
+	creds.Verification = nil
+	m.VerifiedBy = VerifiedByEmail
+	m.VerifiedAt = &now
+	// The member can choose the instance where they accept the sharing
+	m.Instance = ""
+	return couchdb.UpdateDoc(inst, s)
+}
@@ -0,0 +1,57 @@
+package sharing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberVerification(t *testing.T) {
+	s := &Sharing{Owner: true, Open: true, VerifyMembers: true}
+
+	t.Run("NotRequired", func(t *testing.T) {
+		closed := &Sharing{Owner: true, VerifyMembers: true}
+		m := &Member{}
+		assert.NoError(t, closed.checkVerification(m, "https://bob.cozy.example/"))
+		assert.NoError(t, closed.verifyAnswer(m))
+	})
+
+	t.Run("ByInstance", func(t *testing.T) {
+		m := &Member{Email: "bob@example.net", Instance: "https://bob.cozy.example"}
+		err := s.checkVerification(m, "https://mallory.cozy.example")
+		assert.ErrorIs(t, err, ErrMemberNotVerified)
+		assert.NoError(t, s.checkVerification(m, "https://bob.cozy.example"))
+		assert.Equal(t, VerifiedByInstance, m.VerifiedBy)
+		assert.NoError(t, s.verifyAnswer(m))
+		assert.NotNil(t, m.VerifiedAt)
+	})
+
+	t.Run("ByEmail", func(t *testing.T) {
+		m := &Member{Email: "bob@example.net"}
+		err := s.checkVerification(m, "https://bob.cozy.example")
+		assert.ErrorIs(t, err, ErrMemberNotVerified)
+		assert.ErrorIs(t, s.verifyAnswer(m), ErrMemberNotVerified)
+
+		now := time.Now()
+		m.VerifiedBy = VerifiedByEmail
+		m.VerifiedAt = &now
+		assert.NoError(t, s.checkVerification(m, "https://bob.cozy.example"))
+		m.Instance = "https://bob.cozy.example"
+		err = s.checkVerification(m, "https://mallory.cozy.example")
+		assert.ErrorIs(t, err, ErrMemberNotVerified)
+		assert.NoError(t, s.verifyAnswer(m))
+	})
+
+	t.Run("Code", func(t *testing.T) {
+		v := newVerificationCode()
+		assert.Len(t, v.Code, 6)
+		assert.False(t, v.expired())
+		v.Attempts = verificationMaxAttempts
+		assert.True(t, v.expired())
+		v = &VerificationCode{Code: "123456", ExpiresAt: time.Now().Add(-time.Minute)}
+		assert.True(t, v.expired())
+		v = nil
+		assert.True(t, v.expired())
+	})
+}
@@ -0,0 +1,269 @@
+package sharing
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/webhook"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+)
+
+// The events of a sharing that can be sent to the webhook of the owner.
+const (
+	// WebhookMemberAccepted is sent when a recipient has accepted the sharing.
+	WebhookMemberAccepted = "member.accepted"
+	// WebhookMemberRevoked is sent when a recipient has been revoked, or has
+	// left the sharing.
+	WebhookMemberRevoked = "member.revoked"
+	// WebhookSyncError is sent when the replication or the upload of the files
+	// has failed, and the maximal number of retries has been reached.
+	WebhookSyncError = "sync.error"
+	// WebhookInitialSyncDone is sent when the initial replication to a new
+	// recipient has been done.
+	WebhookInitialSyncDone = "initial_sync.done"
+)
+
+// WebhookEvents is the list of the events that can be sent to the webhook of
+// a sharing.
+var WebhookEvents = []string{
+	WebhookMemberAccepted,
+	WebhookMemberRevoked,
+	WebhookSyncError,
+	WebhookInitialSyncDone,
+}
+
+// webhookSecretLength is the length of the secret used to sign the payloads.
+const webhookSecretLength = 32
+
+// Webhook is an URL where the owner of a sharing receives the events of the
+// lifecycle of this sharing. The payloads are signed with the secret, like
+// for the webhook subscriptions.
+type Webhook struct {
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants returns true if the given event must be sent to the webhook.
+func (w *Webhook) Wants(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookMsg is the message of the share-webhook jobs.
+type WebhookMsg struct {
+	SharingID   string `json:"sharing_id"`
+	Event       string `json:"event"`
+	MemberIndex int    `json:"member_index,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// WebhookPayload is the JSON body sent to the URL of the webhook.
+type WebhookPayload struct {
+	DeliveryID  string         `json:"delivery_id"`
+	SharingID   string         `json:"sharing_id"`
+	Domain      string         `json:"domain"`
+	Event       string         `json:"event"`
+	Description string         `json:"description,omitempty"`
+	Member      *WebhookMember `json:"member,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Timestamp   int64          `json:"timestamp"`
+}
+
+// WebhookMember describes the member concerned by an event.
+type WebhookMember struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// SetWebhook registers the URL where the events of the sharing are sent. If
+// no events are given, all the events are sent. The secret for checking the
+// signatures is only returned by this function.
+func (s *Sharing) SetWebhook(inst *instance.Instance, rawURL string, events []string) (*Webhook, error) {
+	if !s.Owner {
+		return nil, ErrInvalidSharing
+	}
+	if err := webhook.CheckURL(rawURL); err != nil {
+		return nil, err
+	}
+	checked, err := checkWebhookEvents(events)
+	if err != nil {
+		return nil, err
+	}
+	s.Webhook = &Webhook{
+		URL:       rawURL,
+		Events:    checked,
+		Secret:    crypto.GenerateRandomString(webhookSecretLength),
+		CreatedAt: time.Now(),
+	}
+	if err := couchdb.UpdateDoc(inst, s); err != nil {
+		return nil, err
+	}
+	return s.Webhook, nil
+}
+
+// RemoveWebhook unregisters the webhook of the sharing.
+func (s *Sharing) RemoveWebhook(inst *instance.Instance) error {
+	if s.Webhook == nil {
+		return nil
+	}
+	s.Webhook = nil
+	return couchdb.UpdateDoc(inst, s)
+}
+
+func checkWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return append([]string{}, WebhookEvents...), nil
+	}
+	checked := make([]string, 0, len(events))
+	for _, event := range events {
+		event = strings.ToLower(event)
+		valid := false
+		for _, e := range WebhookEvents {
+			if event == e {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, ErrInvalidWebhookEvent
+		}
+		checked = append(checked, event)
+	}
+	return checked, nil
+}
+
+// notifyWebhook pushes a job to send the event to the webhook of the sharing,
+// if the owner has registered one for this event. The index of the member is
+// 0 when the event is not about a recipient.
+func (s *Sharing) notifyWebhook(inst *instance.Instance, event string, index int, errMsg string) {
+	if !s.Owner || s.Webhook == nil || !s.Webhook.Wants(event) {
+		return
+	}
+	msg, err := job.NewMessage(&WebhookMsg{
+		SharingID:   s.SID,
+		Event:       event,
+		MemberIndex: index,
+		Error:       errMsg,
+	})
+	if err == nil {
+		_, err = job.System().PushJob(inst, &job.JobRequest{
+			WorkerType: "share-webhook",
+			Message:    msg,
+		})
+	}
+	if err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Warnf("Cannot push the webhook job for %s (%s): %s", event, s.SID, err)
+	}
+}
+
+// notifyInitialSyncDone sends the initial_sync.done event for the given member
+// to the webhook.
+func (s *Sharing) notifyInitialSyncDone(inst *instance.Instance, m *Member) {
+	for i := range s.Members {
+		if i > 0 && &s.Members[i] == m {
+			s.notifyWebhook(inst, WebhookInitialSyncDone, i, "")
+		}
+	}
+}
+
+// waitInitialSync is used when the initial replication to the given member
+// has not been completed in the setup: the initial_sync.done event will be
+// sent by the replicator when the documents have been replicated.
+func (s *Sharing) waitInitialSync(inst *instance.Instance, m *Member) {
+	if s.Webhook == nil || !s.Webhook.Wants(WebhookInitialSyncDone) {
+		return
+	}
+	for i := range s.Members {
+		if i > 0 && &s.Members[i] == m && len(s.Credentials) >= i {
+			s.Credentials[i-1].InitialSyncPending = true
+		}
+	}
+	if err := couchdb.UpdateDoc(inst, s); err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Warnf("Cannot save the pending initial sync (%s): %s", s.SID, err)
+	}
+}
+
+// endInitialSyncs sends the initial_sync.done events for the members that
+// were waiting for the end of their initial replication, when the replicator
+// has nothing more to send to them.
+func (s *Sharing) endInitialSyncs(inst *instance.Instance, indexes []int) {
+	var done []int
+	for _, i := range indexes {
+		if i > 0 && len(s.Credentials) >= i && s.Credentials[i-1].InitialSyncPending {
+			s.Credentials[i-1].InitialSyncPending = false
+			done = append(done, i)
+		}
+	}
+	if len(done) == 0 {
+		return
+	}
+	if err := couchdb.UpdateDoc(inst, s); err != nil {
+		inst.Logger().WithNamespace("sharing").
+			Warnf("Cannot save the end of the initial sync (%s): %s", s.SID, err)
+		return
+	}
+	for _, i := range done {
+		s.notifyWebhook(inst, WebhookInitialSyncDone, i, "")
+	}
+}
+
+// DeliverWebhook sends the event of a share-webhook job to the URL of the
+// webhook. An error is returned if the delivery has failed, so that the job
+// can be retried.
+func DeliverWebhook(ctx *job.WorkerContext, msg *WebhookMsg) error {
+	inst := ctx.Instance
+	s, err := FindSharing(inst, msg.SharingID)
+	if couchdb.IsNotFoundError(err) {
+		ctx.SetNoRetry()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The webhook may have been removed or changed since the job was pushed
+	if s.Webhook == nil || !s.Webhook.Wants(msg.Event) {
+		return nil
+	}
+
+	now := time.Now()
+	payload := WebhookPayload{
+		DeliveryID:  ctx.JobID(),
+		SharingID:   s.SID,
+		Domain:      inst.Domain,
+		Event:       msg.Event,
+		Description: s.Description,
+		Error:       msg.Error,
+		Timestamp:   now.Unix(),
+	}
+	if msg.MemberIndex > 0 && msg.MemberIndex < len(s.Members) {
+		m := s.Members[msg.MemberIndex]
+		payload.Member = &WebhookMember{
+			Index:    msg.MemberIndex,
+			Name:     m.PrimaryName(),
+			Email:    m.Email,
+			Instance: m.Instance,
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	event := consts.Sharings + ":" + msg.Event
+	_, err = webhook.Post(ctx, s.Webhook.URL, s.Webhook.Secret, event, payload.Timestamp, body)
+	return err
+}
@@ -0,0 +1,39 @@
+package sharing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Run("CheckEvents", func(t *testing.T) {
+		events, err := checkWebhookEvents(nil)
+		require.NoError(t, err)
+		assert.Equal(t, WebhookEvents, events)
+
+		events, err = checkWebhookEvents([]string{"MEMBER.ACCEPTED", "sync.error"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{WebhookMemberAccepted, WebhookSyncError}, events)
+
+		_, err = checkWebhookEvents([]string{"member.deleted"})
+		assert.Equal(t, ErrInvalidWebhookEvent, err)
+	})
+
+	t.Run("Wants", func(t *testing.T) {
+		w := &Webhook{Events: []string{WebhookMemberRevoked}}
+		assert.True(t, w.Wants(WebhookMemberRevoked))
+		assert.False(t, w.Wants(WebhookMemberAccepted))
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		s := &Sharing{Webhook: &Webhook{
+			URL:    "https://hooks.example.net/sharing",
+			Events: []string{WebhookMemberAccepted},
+		}}
+		cloned := s.Clone().(*Sharing)
+		cloned.Webhook.Events[0] = WebhookSyncError
+		assert.Equal(t, WebhookMemberAccepted, s.Webhook.Events[0])
+	})
+}
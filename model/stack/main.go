@@ -3,11 +3,16 @@ package stack
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
 
+	"github.com/cozy/cozy-stack/client/request"
 	"github.com/cozy/cozy-stack/model/cloudery"
+	"github.com/cozy/cozy-stack/model/indexadvisor"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/konnectortelemetry"
+	"github.com/cozy/cozy-stack/model/schema"
 	"github.com/cozy/cozy-stack/model/session"
 	"github.com/cozy/cozy-stack/model/settings"
 	"github.com/cozy/cozy-stack/model/token"
@@ -16,6 +21,7 @@ import (
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/emailer"
+	"github.com/cozy/cozy-stack/pkg/safehttp"
 	"github.com/cozy/cozy-stack/pkg/utils"
 
 	"github.com/google/gops/agent"
@@ -84,6 +90,14 @@ security features. Please do not use this binary as your production server.
 		return nil, nil, fmt.Errorf("failed to init the swift connection: %w", err)
 	}
 
+	if err := schema.RegisterFromConfig(config.GetConfig().SchemaMigrations); err != nil {
+		return nil, nil, fmt.Errorf("failed to register the schema migrations: %w", err)
+	}
+
+	if err := initRequestsClient(config.GetConfig().Requests); err != nil {
+		return nil, nil, fmt.Errorf("failed to init the requests client: %w", err)
+	}
+
 	workersList, err := job.GetWorkersList()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get the workers list: %w", err)
@@ -125,8 +139,37 @@ security features. Please do not use this binary as your production server.
 	sessionSweeper := session.SweepLoginRegistrations()
 	shutdowners = append(shutdowners, sessionSweeper)
 
+	shutdowners = append(shutdowners, indexadvisor.Start())
+
+	if konnectortelemetry.Enabled() {
+		shutdowners = append(shutdowners, konnectortelemetry.Start())
+	}
+
 	// Global shutdowner that composes all the running processes of the stack
 	processes := utils.NewGroupShutdown(shutdowners...)
 
 	return processes, &services, nil
 }
+
+// initRequestsClient configures the http client and the health tracking of the
+// hosts used for the requests between instances.
+func initRequestsClient(cfg config.Requests) error {
+	opts := safehttp.ClientOptions{
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		Timeout:             cfg.Timeout,
+		HTTP2:               cfg.HTTP2,
+	}
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy %q: %w", cfg.Proxy, err)
+		}
+		opts.Proxy = proxy
+	}
+	request.ConfigureInstancesClients(opts)
+	request.ConfigureHealth(cfg.UnhealthyThreshold, cfg.BlacklistDuration)
+	return nil
+}
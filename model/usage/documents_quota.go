@@ -0,0 +1,144 @@
+package usage
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/cozy/cozy-stack/model/feature"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+// DefaultQuotaClass is the quota class of the instances without the
+// quota_class feature flag.
+const DefaultQuotaClass = "default"
+
+// ErrDocumentsQuotaExceeded is used when a document cannot be created because
+// the maximal number of documents for its doctype has been reached.
+var ErrDocumentsQuotaExceeded = errors.New("The maximal number of documents for this doctype has been reached")
+
+// DocumentsQuotaCallback is a function called when the maximal number of
+// documents of a doctype has been reached on an instance.
+type DocumentsQuotaCallback func(inst *instance.Instance, doctype string, quota int)
+
+var documentsQuotaCallback DocumentsQuotaCallback
+
+// RegisterDocumentsQuotaCallback allows to register a callback function
+// called when the maximal number of documents of a doctype has been reached.
+func RegisterDocumentsQuotaCallback(cb DocumentsQuotaCallback) {
+	documentsQuotaCallback = cb
+}
+
+// QuotaClass returns the quota class of the instance. It can be set with the
+// quota_class feature flag, for example by the offers of the manager.
+func QuotaClass(inst *instance.Instance) string {
+	flags, err := feature.GetFlags(inst)
+	if err != nil {
+		return DefaultQuotaClass
+	}
+	if class, ok := flags.GetString("quota_class"); ok && class != "" {
+		return class
+	}
+	return DefaultQuotaClass
+}
+
+// DocumentsQuotas returns the maximal numbers of documents per doctype for the
+// instance, from the documents_quotas of its context and its quota class.
+func DocumentsQuotas(inst *instance.Instance) map[string]int {
+	ctx, ok := inst.SettingsContext()
+	if !ok {
+		return nil
+	}
+	classes, ok := ctx["documents_quotas"].(map[string]interface{})
+	if !ok || len(classes) == 0 {
+		return nil
+	}
+	class, ok := classes[QuotaClass(inst)].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return parseDocumentsQuotas(class)
+}
+
+func parseDocumentsQuotas(class map[string]interface{}) map[string]int {
+	quotas := make(map[string]int)
+	for doctype, value := range class {
+		var quota int
+		switch v := value.(type) {
+		case int:
+			quota = v
+		case int64:
+			quota = int(v)
+		case float64:
+			quota = int(v)
+		}
+		if quota > 0 {
+			quotas[doctype] = quota
+		}
+	}
+	return quotas
+}
+
+// CheckDocumentsQuota returns ErrDocumentsQuotaExceeded if creating count
+// documents of the given doctype would exceed the quota of the instance. The
+// callback is called in that case, so that the user can be notified.
+func CheckDocumentsQuota(inst *instance.Instance, doctype string, count int) error {
+	quota, ok := DocumentsQuotas(inst)[doctype]
+	if !ok {
+		return nil
+	}
+	current, err := couchdb.CountNormalDocs(inst, doctype)
+	if err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			current = 0
+		} else {
+			return err
+		}
+	}
+	if current+count <= quota {
+		return nil
+	}
+	inst.Logger().WithNamespace("usage").
+		Infof("Documents quota of %d exceeded for %s", quota, doctype)
+	if documentsQuotaCallback != nil {
+		documentsQuotaCallback(inst, doctype, quota)
+	}
+	return ErrDocumentsQuotaExceeded
+}
+
+// DocumentsUsage is the number of documents of a doctype, with its quota.
+type DocumentsUsage struct {
+	Doctype string `json:"doctype"`
+	Count   int    `json:"count"`
+	Quota   int    `json:"quota"`
+}
+
+// ListDocumentsUsage returns the number of documents for the doctypes with a
+// quota on the instance, sorted by doctype.
+func ListDocumentsUsage(inst *instance.Instance) ([]*DocumentsUsage, error) {
+	quotas := DocumentsQuotas(inst)
+	list := make([]*DocumentsUsage, 0, len(quotas))
+	for doctype, quota := range quotas {
+		count, err := couchdb.CountNormalDocs(inst, doctype)
+		if err != nil && !couchdb.IsNoDatabaseError(err) {
+			return nil, err
+		}
+		list = append(list, &DocumentsUsage{Doctype: doctype, Count: count, Quota: quota})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Doctype < list[j].Doctype
+	})
+	return list, nil
+}
+
+// exceededQuotas returns the doctypes with more documents than their quota.
+func exceededQuotas(doctypes map[string]int, quotas map[string]int) []string {
+	var exceeded []string
+	for doctype, quota := range quotas {
+		if doctypes[doctype] >= quota {
+			exceeded = append(exceeded, doctype)
+		}
+	}
+	sort.Strings(exceeded)
+	return exceeded
+}
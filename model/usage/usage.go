@@ -0,0 +1,386 @@
+// Package usage is used to compute some metrics about the usage of an
+// instance (files, documents, konnectors, sharings, last activity), and to
+// aggregate them per context for the administrators.
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/session"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+)
+
+// ActiveDelay is the delay since the last activity for an instance to be
+// considered as active in the aggregated metrics.
+const ActiveDelay = 30 * 24 * time.Hour
+
+// konnectorRunsPeriod is the period on which the executions of the konnectors
+// are counted.
+const konnectorRunsPeriod = 7 * 24 * time.Hour
+
+// Usage is the document with the usage metrics of an instance. It is saved
+// in the io.cozy.settings database, and it is updated by the usage worker.
+type Usage struct {
+	DocID      string    `json:"_id,omitempty"`
+	DocRev     string    `json:"_rev,omitempty"`
+	ComputedAt time.Time `json:"computed_at"`
+
+	// FilesCount is the number of files and directories
+	FilesCount int `json:"files_count"`
+	// FilesBytes is the number of bytes used by the files (without the old
+	// versions and the contents in the cold storage)
+	FilesBytes    int64 `json:"files_bytes"`
+	VersionsBytes int64 `json:"versions_bytes"`
+	ColdBytes     int64 `json:"cold_bytes,omitempty"`
+	// Doctypes is the number of documents for each doctype
+	Doctypes map[string]int `json:"doctypes"`
+	// DocumentsQuotasReached is the list of the doctypes for which the
+	// maximal number of documents has been reached
+	DocumentsQuotasReached []string `json:"documents_quotas_reached,omitempty"`
+	// KonnectorRuns is the number of konnector jobs in the last 7 days
+	KonnectorRuns  int `json:"konnector_runs_per_week"`
+	ActiveSharings int `json:"active_sharings"`
+	// SharingsQuotaReached is true when the instance owns the maximal number
+	// of active sharings allowed by its context
+	SharingsQuotaReached bool      `json:"sharings_quota_reached,omitempty"`
+	LastActivity         time.Time `json:"last_activity"`
+}
+
+// ID implements the couchdb.Doc interface
+func (u *Usage) ID() string { return u.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (u *Usage) Rev() string { return u.DocRev }
+
+// DocType implements the couchdb.Doc interface
+func (u *Usage) DocType() string { return consts.Settings }
+
+// SetID implements the couchdb.Doc interface
+func (u *Usage) SetID(id string) { u.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (u *Usage) SetRev(rev string) { u.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (u *Usage) Clone() couchdb.Doc {
+	cloned := *u
+	cloned.Doctypes = make(map[string]int, len(u.Doctypes))
+	for k, v := range u.Doctypes {
+		cloned.Doctypes[k] = v
+	}
+	return &cloned
+}
+
+// Get returns the usage document of the instance, as computed by the last
+// execution of the usage worker.
+func Get(inst *instance.Instance) (*Usage, error) {
+	var doc Usage
+	if err := couchdb.GetDoc(inst, consts.Settings, consts.UsageSettingsID, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Compute computes the usage metrics of the instance and saves them in the
+// io.cozy.settings.usage document.
+func Compute(inst *instance.Instance) (*Usage, error) {
+	doc := &Usage{
+		DocID:      consts.UsageSettingsID,
+		ComputedAt: time.Now(),
+		Doctypes:   make(map[string]int),
+	}
+
+	fs := inst.VFS()
+	var err error
+	if doc.FilesBytes, err = fs.FilesUsage(); err != nil {
+		return nil, err
+	}
+	if doc.VersionsBytes, err = fs.VersionsUsage(); err != nil {
+		return nil, err
+	}
+	vfs.ReconcileDiskUsage(inst, doc.FilesBytes+doc.VersionsBytes)
+	if cold, err := fs.ColdUsage(); err == nil {
+		doc.ColdBytes = cold
+	}
+
+	doctypes, err := couchdb.AllDoctypes(inst)
+	if err != nil {
+		return nil, err
+	}
+	for _, doctype := range doctypes {
+		count, err := couchdb.CountNormalDocs(inst, doctype)
+		if err != nil {
+			if couchdb.IsNoDatabaseError(err) {
+				continue
+			}
+			return nil, err
+		}
+		doc.Doctypes[doctype] = count
+	}
+	doc.FilesCount = doc.Doctypes[consts.Files]
+	doc.DocumentsQuotasReached = exceededQuotas(doc.Doctypes, DocumentsQuotas(inst))
+
+	if doc.KonnectorRuns, err = countKonnectorRuns(inst, doc.ComputedAt.Add(-konnectorRunsPeriod)); err != nil {
+		return nil, err
+	}
+	if doc.ActiveSharings, err = countActiveSharings(inst); err != nil {
+		return nil, err
+	}
+	if sharings, err := sharing.GetSharingsUsage(inst); err == nil {
+		doc.SharingsQuotaReached = sharings.QuotaReached()
+	}
+	if doc.LastActivity, err = LastActivity(inst); err != nil {
+		return nil, err
+	}
+
+	if old, err := Get(inst); err == nil {
+		doc.SetRev(old.Rev())
+		err = couchdb.UpdateDoc(inst, doc)
+		return doc, err
+	} else if !couchdb.IsNotFoundError(err) && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	return doc, couchdb.CreateNamedDocWithDB(inst, doc)
+}
+
+func countKonnectorRuns(inst *instance.Instance, since time.Time) (int, error) {
+	count := 0
+	bookmark := ""
+	for {
+		var jobs []struct {
+			ID string `json:"_id"`
+		}
+		req := &couchdb.FindRequest{
+			UseIndex: "by-queued-at",
+			Selector: mango.And(
+				mango.Gt("queued_at", since.Format(time.RFC3339Nano)),
+				mango.Equal("worker", "konnector"),
+			),
+			Fields:   []string{"_id"},
+			Bookmark: bookmark,
+			Limit:    1000,
+		}
+		res, err := couchdb.FindDocsRaw(inst, consts.Jobs, req, &jobs)
+		if couchdb.IsNoDatabaseError(err) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		count += len(jobs)
+		if len(jobs) < 1000 || res.Bookmark == "" {
+			return count, nil
+		}
+		bookmark = res.Bookmark
+	}
+}
+
+func countActiveSharings(inst *instance.Instance) (int, error) {
+	count := 0
+	err := couchdb.ForeachDocs(inst, consts.Sharings, func(_ string, data json.RawMessage) error {
+		var s struct {
+			Active bool `json:"active"`
+		}
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s.Active {
+			count++
+		}
+		return nil
+	})
+	if couchdb.IsNoDatabaseError(err) {
+		return 0, nil
+	}
+	return count, err
+}
+
+// LastActivity returns the date of the last activity of the user on the
+// instance, from the login history, the sessions, and the OAuth clients
+// (excepted the clients used for sharings).
+func LastActivity(inst *instance.Instance) (time.Time, error) {
+	last := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	err := couchdb.ForeachDocs(inst, consts.SessionsLogins, func(_ string, data json.RawMessage) error {
+		var entry session.LoginEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if last.Before(entry.CreatedAt) {
+			last = entry.CreatedAt
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return last, err
+	}
+
+	err = couchdb.ForeachDocs(inst, consts.Sessions, func(_ string, data json.RawMessage) error {
+		var sess session.Session
+		if err := json.Unmarshal(data, &sess); err != nil {
+			return err
+		}
+		if last.Before(sess.LastSeen) {
+			last = sess.LastSeen
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return last, err
+	}
+
+	err = couchdb.ForeachDocs(inst, consts.OAuthClients, func(_ string, data json.RawMessage) error {
+		var client oauth.Client
+		if err := json.Unmarshal(data, &client); err != nil {
+			return err
+		}
+		// Ignore the OAuth clients used for sharings
+		if client.ClientKind == "sharing" {
+			return nil
+		}
+		for _, at := range []interface{}{client.LastRefreshedAt, client.SynchronizedAt} {
+			if at, ok := at.(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, at); err == nil {
+					if last.Before(t) {
+						last = t
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return last, err
+	}
+	return last, nil
+}
+
+// ContextUsage is the aggregation of the usage metrics of the instances of a
+// context.
+type ContextUsage struct {
+	Context   string `json:"context"`
+	Instances int    `json:"instances"`
+	// Computed is the number of instances with usage metrics
+	Computed int `json:"computed"`
+	// Active is the number of instances with some activity in the last 30 days
+	Active         int            `json:"active"`
+	FilesCount     int            `json:"files_count"`
+	FilesBytes     int64          `json:"files_bytes"`
+	VersionsBytes  int64          `json:"versions_bytes"`
+	ColdBytes      int64          `json:"cold_bytes"`
+	Doctypes       map[string]int `json:"doctypes"`
+	KonnectorRuns  int            `json:"konnector_runs_per_week"`
+	ActiveSharings int            `json:"active_sharings"`
+	// DocumentsQuotasReached is the number of instances where the maximal
+	// number of documents has been reached for at least one doctype
+	DocumentsQuotasReached int `json:"documents_quotas_reached"`
+	// SharingsQuotasReached is the number of instances where the maximal
+	// number of active sharings has been reached
+	SharingsQuotasReached int `json:"sharings_quotas_reached"`
+}
+
+func newContextUsage(contextName string) *ContextUsage {
+	return &ContextUsage{
+		Context:  contextName,
+		Doctypes: make(map[string]int),
+	}
+}
+
+// add adds the usage metrics of an instance to the aggregation. The usage can
+// be nil if it has not been computed yet for this instance.
+func (c *ContextUsage) add(u *Usage, now time.Time) {
+	c.Instances++
+	if u == nil {
+		return
+	}
+	c.Computed++
+	if now.Sub(u.LastActivity) < ActiveDelay {
+		c.Active++
+	}
+	c.FilesCount += u.FilesCount
+	c.FilesBytes += u.FilesBytes
+	c.VersionsBytes += u.VersionsBytes
+	c.ColdBytes += u.ColdBytes
+	for doctype, count := range u.Doctypes {
+		c.Doctypes[doctype] += count
+	}
+	c.KonnectorRuns += u.KonnectorRuns
+	c.ActiveSharings += u.ActiveSharings
+	if len(u.DocumentsQuotasReached) > 0 {
+		c.DocumentsQuotasReached++
+	}
+	if u.SharingsQuotaReached {
+		c.SharingsQuotasReached++
+	}
+}
+
+// Aggregate returns the usage metrics of the instances aggregated per
+// context. If contextName is not empty, only the instances of this context
+// are looked at. The metrics are the ones saved by the last execution of the
+// usage worker for each instance.
+func Aggregate(contextName string) ([]*ContextUsage, error) {
+	now := time.Now()
+	byContext := make(map[string]*ContextUsage)
+	var list []*ContextUsage
+	err := instance.ForeachInstances(func(inst *instance.Instance) error {
+		name := inst.ContextName
+		if name == "" {
+			name = config.DefaultInstanceContext
+		}
+		if contextName != "" && name != contextName {
+			return nil
+		}
+		agg, ok := byContext[name]
+		if !ok {
+			agg = newContextUsage(name)
+			byContext[name] = agg
+			list = append(list, agg)
+		}
+		u, err := Get(inst)
+		if err != nil {
+			u = nil
+		}
+		agg.add(u, now)
+		return nil
+	})
+	return list, err
+}
+
+// EnsureTrigger creates the daily trigger for computing the usage metrics of
+// the instance if it does not exist yet.
+func EnsureTrigger(inst *instance.Instance) {
+	// 1. Check if the trigger already exists
+	sched := job.System()
+	infos := job.TriggerInfos{
+		Type:       "@cron",
+		WorkerType: "usage",
+	}
+	if sched.HasTrigger(inst, infos) {
+		return
+	}
+
+	// 2. Create the trigger
+	now := time.Now()
+	hours := (now.Hour() + 12) % 24
+	infos.Arguments = fmt.Sprintf("0 %d %d * * *", now.Minute(), hours)
+	trigger, err := job.NewTrigger(inst, infos, nil)
+	if err != nil {
+		inst.Logger().Errorf("Cannot create usage trigger: %s", err)
+		return
+	}
+	if err = sched.AddTrigger(trigger); err != nil {
+		inst.Logger().Errorf("Cannot create usage trigger: %s", err)
+	}
+}
+
+var _ couchdb.Doc = &Usage{}
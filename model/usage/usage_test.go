@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsage(t *testing.T) {
+	t.Run("ContextUsageAdd", func(t *testing.T) {
+		now := time.Now()
+		agg := newContextUsage("beta")
+
+		agg.add(&Usage{
+			FilesCount:     10,
+			FilesBytes:     1000,
+			VersionsBytes:  100,
+			Doctypes:       map[string]int{consts.Files: 10, consts.Contacts: 3},
+			KonnectorRuns:  7,
+			ActiveSharings: 1,
+			LastActivity:   now.Add(-24 * time.Hour),
+
+			DocumentsQuotasReached: []string{consts.Contacts},
+		}, now)
+		agg.add(&Usage{
+			FilesCount:   5,
+			FilesBytes:   500,
+			ColdBytes:    50,
+			Doctypes:     map[string]int{consts.Files: 5},
+			LastActivity: now.Add(-60 * 24 * time.Hour),
+
+			SharingsQuotaReached: true,
+		}, now)
+		agg.add(nil, now)
+
+		assert.Equal(t, "beta", agg.Context)
+		assert.Equal(t, 3, agg.Instances)
+		assert.Equal(t, 2, agg.Computed)
+		assert.Equal(t, 1, agg.Active)
+		assert.Equal(t, 15, agg.FilesCount)
+		assert.EqualValues(t, 1500, agg.FilesBytes)
+		assert.EqualValues(t, 100, agg.VersionsBytes)
+		assert.EqualValues(t, 50, agg.ColdBytes)
+		assert.Equal(t, map[string]int{consts.Files: 15, consts.Contacts: 3}, agg.Doctypes)
+		assert.Equal(t, 7, agg.KonnectorRuns)
+		assert.Equal(t, 1, agg.ActiveSharings)
+		assert.Equal(t, 1, agg.DocumentsQuotasReached)
+		assert.Equal(t, 1, agg.SharingsQuotasReached)
+	})
+
+	t.Run("DocumentsQuotas", func(t *testing.T) {
+		quotas := parseDocumentsQuotas(map[string]interface{}{
+			"io.cozy.bank.operations": 100000,
+			consts.Contacts:           float64(5000),
+			"io.cozy.todos":           "invalid",
+			"io.cozy.notes":           0,
+		})
+		assert.Equal(t, map[string]int{
+			"io.cozy.bank.operations": 100000,
+			consts.Contacts:           5000,
+		}, quotas)
+
+		doctypes := map[string]int{
+			"io.cozy.bank.operations": 100000,
+			consts.Contacts:           12,
+		}
+		assert.Equal(t, []string{"io.cozy.bank.operations"}, exceededQuotas(doctypes, quotas))
+		assert.Empty(t, exceededQuotas(doctypes, nil))
+	})
+}
@@ -23,6 +23,9 @@ type Archive struct {
 	Secret string   `json:"-"`
 	IDs    []string `json:"ids"`
 	Files  []string `json:"files"`
+	// Async is true when the archive must be built in background, before
+	// being downloaded
+	Async bool `json:"async,omitempty"`
 
 	// archiveEntries cache
 	entries []ArchiveEntry
@@ -112,7 +115,12 @@ func (a *Archive) Serve(fs VFS, w http.ResponseWriter) error {
 	header.Set(echo.HeaderContentType, ZipMime)
 	header.Set(echo.HeaderContentDisposition,
 		ContentDisposition("attachment", a.Name+".zip"))
+	return a.WriteZip(fs, w, nil)
+}
 
+// WriteZip writes the zip archive to the given writer. The optional onFile
+// callback is called after each file has been added to the archive.
+func (a *Archive) WriteZip(fs VFS, w io.Writer, onFile func(file *FileDoc) error) error {
 	zw := zip.NewWriter(w)
 	defer zw.Close()
 
@@ -135,6 +143,13 @@ func (a *Archive) Serve(fs VFS, w http.ResponseWriter) error {
 				_, err = zw.Create(a.Name + "/" + name + "/")
 				return err
 			}
+			// The quarantined files are left out of the archive
+			if file.Quarantined() {
+				if onFile != nil {
+					return onFile(file)
+				}
+				return nil
+			}
 			header := &zip.FileHeader{
 				Name:     a.Name + "/" + name,
 				Method:   zip.Deflate,
@@ -149,15 +164,44 @@ func (a *Archive) Serve(fs VFS, w http.ResponseWriter) error {
 				return fmt.Errorf("Can't open file <%s>: %s", name, err)
 			}
 			defer f.Close()
-			_, err = io.Copy(ze, f)
-			return err
+			if _, err = io.Copy(ze, f); err != nil {
+				return err
+			}
+			if onFile != nil {
+				return onFile(file)
+			}
+			return nil
 		}, 0)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return zw.Close()
+}
+
+// Stats returns the number of files and their total size for the archive.
+func (a *Archive) Stats(fs VFS) (count int, size int64, err error) {
+	entries, err := a.GetEntries(fs)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		err = walk(fs, entry.root, entry.Dir, entry.File, func(name string, dir *DirDoc, file *FileDoc, err error) error {
+			if err != nil {
+				return err
+			}
+			if file != nil {
+				count++
+				size += file.ByteSize
+			}
+			return nil
+		}, 0)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return count, size, nil
 }
 
 // ID makes Archive a jsonapi.Object
@@ -0,0 +1,241 @@
+package vfs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// Checkpoint is a document that keeps the position of an OAuth client (like
+// the desktop or the mobile apps) in the changes feed of io.cozy.files. Its
+// identifier is the identifier of the OAuth client.
+type Checkpoint struct {
+	DocID  string `json:"_id,omitempty"`
+	DocRev string `json:"_rev,omitempty"`
+	// LastSeq is the last sequence delivered to the client.
+	LastSeq string `json:"last_seq"`
+	// AckedSeq is the last sequence that the client has confirmed to have
+	// processed, by sending it as the since parameter of a request.
+	AckedSeq    string    `json:"acked_seq,omitempty"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (c *Checkpoint) ID() string { return c.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (c *Checkpoint) Rev() string { return c.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (c *Checkpoint) DocType() string { return consts.FilesCheckpoints }
+
+// Clone implements couchdb.Doc
+func (c *Checkpoint) Clone() couchdb.Doc {
+	cloned := *c
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (c *Checkpoint) SetID(id string) { c.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (c *Checkpoint) SetRev(rev string) { c.DocRev = rev }
+
+// SafeSeq returns the sequence from which the changes can be sent again to
+// the client without losing any of them.
+func (c *Checkpoint) SafeSeq() string {
+	if c.AckedSeq != "" {
+		return c.AckedSeq
+	}
+	return c.LastSeq
+}
+
+const (
+	// CheckpointRetention is the delay after which the checkpoint of a client
+	// that has not used the delta feed is garbage-collected. The client will
+	// have to do a full synchronization if it comes back.
+	CheckpointRetention = 90 * 24 * time.Hour
+
+	// changesHorizonID is the identifier of the document that keeps the
+	// horizon of the changes feed, with the checkpoints.
+	changesHorizonID = "horizon"
+)
+
+// ErrSeqNotDelivered is used when a client acknowledges a sequence that has
+// not been delivered to it.
+var ErrSeqNotDelivered = errors.New("The sequence has not been delivered to this client")
+
+// GetCheckpoint returns the checkpoint of the given OAuth client, or nil if
+// the client has never used the delta feed.
+func GetCheckpoint(db prefixer.Prefixer, clientID string) (*Checkpoint, error) {
+	var doc Checkpoint
+	err := couchdb.GetDoc(db, consts.FilesCheckpoints, clientID, &doc)
+	if couchdb.IsNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// SaveCheckpoint persists the sequences delivered to and acknowledged by an
+// OAuth client.
+func SaveCheckpoint(db prefixer.Prefixer, clientID, ackedSeq, lastSeq string) (*Checkpoint, error) {
+	doc, err := GetCheckpoint(db, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = &Checkpoint{DocID: clientID}
+	}
+	if ackedSeq != "" {
+		doc.AckedSeq = ackedSeq
+	}
+	doc.LastSeq = lastSeq
+	doc.DeliveredAt = time.Now().UTC()
+	if err := couchdb.Upsert(db, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// AckCheckpoint persists the sequence that an OAuth client has confirmed to
+// have processed. The next request without the since parameter will start
+// from this sequence.
+func AckCheckpoint(db prefixer.Prefixer, clientID, seq string) (*Checkpoint, error) {
+	doc, err := GetCheckpoint(db, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil || SeqNumber(seq) > SeqNumber(doc.LastSeq) {
+		return nil, ErrSeqNotDelivered
+	}
+	doc.AckedSeq = seq
+	if err := couchdb.UpdateDoc(db, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DeleteCheckpoint removes the checkpoint of an OAuth client, for example
+// when the client is revoked.
+func DeleteCheckpoint(db prefixer.Prefixer, clientID string) error {
+	doc, err := GetCheckpoint(db, clientID)
+	if err != nil || doc == nil {
+		return err
+	}
+	return couchdb.DeleteDoc(db, doc)
+}
+
+// ListCheckpoints returns the checkpoints of all the OAuth clients.
+func ListCheckpoints(db prefixer.Prefixer) ([]*Checkpoint, error) {
+	var docs []*Checkpoint
+	req := &couchdb.AllDocsRequest{Limit: 1000}
+	err := couchdb.GetAllDocs(db, consts.FilesCheckpoints, req, &docs)
+	if couchdb.IsNoDatabaseError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := docs[:0]
+	for _, doc := range docs {
+		if doc.DocID != changesHorizonID {
+			checkpoints = append(checkpoints, doc)
+		}
+	}
+	return checkpoints, nil
+}
+
+// OldestCheckpoint returns the checkpoint of the client that is the most
+// late in the changes feed. It returns nil if there are no checkpoints.
+func OldestCheckpoint(db prefixer.Prefixer) (*Checkpoint, error) {
+	docs, err := ListCheckpoints(db)
+	if err != nil {
+		return nil, err
+	}
+	var oldest *Checkpoint
+	for _, doc := range docs {
+		if oldest == nil || SeqNumber(doc.SafeSeq()) < SeqNumber(oldest.SafeSeq()) {
+			oldest = doc
+		}
+	}
+	return oldest, nil
+}
+
+// ChangesHorizon returns the oldest sequence of the changes feed of
+// io.cozy.files from which a client can continue: the changes before it can
+// be garbage-collected. It returns an empty string if there is no horizon.
+func ChangesHorizon(db prefixer.Prefixer) (string, error) {
+	doc, err := GetCheckpoint(db, changesHorizonID)
+	if err != nil || doc == nil {
+		return "", err
+	}
+	return doc.LastSeq, nil
+}
+
+// IsBeforeHorizon returns true if the changes feed can't be continued from
+// the given sequence, as it is older than the horizon.
+func IsBeforeHorizon(db prefixer.Prefixer, seq string) (bool, error) {
+	horizon, err := ChangesHorizon(db)
+	if err != nil || horizon == "" {
+		return false, err
+	}
+	return SeqNumber(seq) < SeqNumber(horizon), nil
+}
+
+// CollectCheckpoints deletes the checkpoints of the clients that have not
+// used the delta feed since the retention delay, and moves the horizon of the
+// changes feed to the oldest sequence still needed by the other clients.
+func CollectCheckpoints(db prefixer.Prefixer, retention time.Duration) error {
+	docs, err := ListCheckpoints(db)
+	if err != nil {
+		return err
+	}
+	limit := time.Now().Add(-retention)
+	var oldest *Checkpoint
+	for _, doc := range docs {
+		if doc.DeliveredAt.Before(limit) {
+			if err := couchdb.DeleteDoc(db, doc); err != nil && !couchdb.IsNotFoundError(err) {
+				return err
+			}
+			continue
+		}
+		if oldest == nil || SeqNumber(doc.SafeSeq()) < SeqNumber(oldest.SafeSeq()) {
+			oldest = doc
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+	horizon, err := GetCheckpoint(db, changesHorizonID)
+	if err != nil {
+		return err
+	}
+	if horizon == nil {
+		horizon = &Checkpoint{DocID: changesHorizonID}
+	} else if SeqNumber(oldest.SafeSeq()) <= SeqNumber(horizon.LastSeq) {
+		return nil
+	}
+	horizon.LastSeq = oldest.SafeSeq()
+	horizon.DeliveredAt = time.Now().UTC()
+	return couchdb.Upsert(db, horizon)
+}
+
+// SeqNumber returns the numeric prefix of a CouchDB sequence. The sequences
+// are opaque strings, but this prefix can be used to compare them
+// approximately.
+func SeqNumber(seq string) int64 {
+	prefix, _, _ := strings.Cut(seq, "-")
+	n, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,23 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	t.Run("SeqNumber", func(t *testing.T) {
+		assert.Equal(t, int64(0), SeqNumber(""))
+		assert.Equal(t, int64(0), SeqNumber("now"))
+		assert.Equal(t, int64(42), SeqNumber("42"))
+		assert.Equal(t, int64(123), SeqNumber("123-g1AAAAFTeJzLYWBgYMlgTmFQSUpMzi9KdUhJMtRLStbVTU"))
+	})
+
+	t.Run("SafeSeq", func(t *testing.T) {
+		cp := &Checkpoint{LastSeq: "12-abc"}
+		assert.Equal(t, "12-abc", cp.SafeSeq())
+		cp.AckedSeq = "10-def"
+		assert.Equal(t, "10-def", cp.SafeSeq())
+	})
+}
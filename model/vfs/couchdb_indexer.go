@@ -57,8 +57,13 @@ func (c *couchdbIndexer) InitIndex() error {
 	return nil
 }
 
-// DiskUsage returns the total size of the files (current + old versions).
+// DiskUsage returns the total size of the files (current + old versions). It
+// is served from the counter in the cache when it is available.
 func (c *couchdbIndexer) DiskUsage() (int64, error) {
+	if used, ok := cachedDiskUsage(c.db); ok {
+		return used, nil
+	}
+
 	used, err := c.FilesUsage()
 	if err != nil {
 		return 0, err
@@ -66,6 +71,7 @@ func (c *couchdbIndexer) DiskUsage() (int64, error) {
 
 	if versions, err := c.VersionsUsage(); err == nil {
 		used += versions
+		initDiskUsage(c.db, used)
 	}
 
 	return used, nil
@@ -114,6 +120,31 @@ func (c *couchdbIndexer) VersionsUsage() (int64, error) {
 	return int64(used), nil
 }
 
+// ColdUsage returns the total size of the files and old versions that have
+// been moved to the cold storage.
+func (c *couchdbIndexer) ColdUsage() (int64, error) {
+	var used int64
+	for _, view := range []*couchdb.View{couchdb.ColdDiskUsageView, couchdb.ColdVersionsDiskUsageView} {
+		var doc couchdb.ViewResponse
+		err := couchdb.ExecView(c.db, view, &couchdb.ViewRequest{
+			Reduce: true,
+		}, &doc)
+		if err != nil {
+			return 0, err
+		}
+		if len(doc.Rows) == 0 {
+			continue
+		}
+		// Reduce of _sum should give us a number value
+		size, ok := doc.Rows[0].Value.(float64)
+		if !ok {
+			return 0, ErrWrongCouchdbState
+		}
+		used += int64(size)
+	}
+	return used, nil
+}
+
 // TrashUsage returns the space taken by the files in the trash.
 func (c *couchdbIndexer) TrashUsage() (int64, error) {
 	var size int64
@@ -208,14 +239,22 @@ func (c *couchdbIndexer) CreateFileDoc(doc *FileDoc) error {
 	if err := c.prepareFileDoc(doc); err != nil {
 		return err
 	}
-	return couchdb.CreateDoc(c.db, doc)
+	if err := couchdb.CreateDoc(c.db, doc); err != nil {
+		return err
+	}
+	UpdateDiskUsage(c.db, DiskUsageDelta(nil, doc))
+	return nil
 }
 
 func (c *couchdbIndexer) CreateNamedFileDoc(doc *FileDoc) error {
 	if err := c.prepareFileDoc(doc); err != nil {
 		return err
 	}
-	return couchdb.CreateNamedDoc(c.db, doc)
+	if err := couchdb.CreateNamedDoc(c.db, doc); err != nil {
+		return err
+	}
+	UpdateDiskUsage(c.db, DiskUsageDelta(nil, doc))
+	return nil
 }
 
 func (c *couchdbIndexer) UpdateFileDoc(olddoc, newdoc *FileDoc) error {
@@ -233,7 +272,11 @@ func (c *couchdbIndexer) UpdateFileDoc(olddoc, newdoc *FileDoc) error {
 
 	newdoc.SetID(olddoc.ID())
 	newdoc.SetRev(olddoc.Rev())
-	return couchdb.UpdateDocWithOld(c.db, newdoc, olddoc)
+	if err := couchdb.UpdateDocWithOld(c.db, newdoc, olddoc); err != nil {
+		return err
+	}
+	UpdateDiskUsage(c.db, DiskUsageDelta(olddoc, newdoc))
+	return nil
 }
 
 var DeleteNote = func(db prefixer.Prefixer, noteID string) {}
@@ -246,7 +289,11 @@ func (c *couchdbIndexer) DeleteFileDoc(doc *FileDoc) error {
 	if doc.Mime == consts.NoteMimeType {
 		DeleteNote(c.db, doc.DocID)
 	}
-	return couchdb.DeleteDoc(c.db, doc)
+	if err := couchdb.DeleteDoc(c.db, doc); err != nil {
+		return err
+	}
+	UpdateDiskUsage(c.db, DiskUsageDelta(doc, nil))
+	return nil
 }
 
 func (c *couchdbIndexer) CreateDirDoc(doc *DirDoc) error {
@@ -344,6 +391,13 @@ func (c *couchdbIndexer) BatchDelete(docs []couchdb.Doc) error {
 				return err
 			}
 		}
+		var delta int64
+		for _, doc := range toDelete {
+			if file, ok := doc.(*FileDoc); ok {
+				delta += DiskUsageDelta(file, nil)
+			}
+		}
+		UpdateDiskUsage(c.db, delta)
 	}
 	return nil
 }
@@ -692,11 +746,19 @@ func (c *couchdbIndexer) BatchUpdate(docs, oldDocs []interface{}) error {
 }
 
 func (c *couchdbIndexer) CreateVersion(v *Version) error {
-	return couchdb.CreateNamedDocWithDB(c.db, v)
+	if err := couchdb.CreateNamedDocWithDB(c.db, v); err != nil {
+		return err
+	}
+	UpdateDiskUsage(c.db, versionUsedBytes(v))
+	return nil
 }
 
 func (c *couchdbIndexer) DeleteVersion(v *Version) error {
-	return couchdb.DeleteDoc(c.db, v)
+	if err := couchdb.DeleteDoc(c.db, v); err != nil {
+		return err
+	}
+	UpdateDiskUsage(c.db, -versionUsedBytes(v))
+	return nil
 }
 
 func (c *couchdbIndexer) AllVersions() ([]*Version, error) {
@@ -730,6 +792,11 @@ func (c *couchdbIndexer) BatchDeleteVersions(versions []*Version) error {
 				return err
 			}
 		}
+		var delta int64
+		for _, doc := range toDelete {
+			delta -= versionUsedBytes(doc.(*Version))
+		}
+		UpdateDiskUsage(c.db, delta)
 	}
 	return nil
 }
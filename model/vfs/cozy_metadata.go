@@ -33,6 +33,10 @@ type FilesCozyMetadata struct {
 	SourceAccount string `json:"sourceAccount,omitempty"`
 	// Identifier unique to the account targeted by the connector (login most of the time)
 	SourceIdentifier string `json:"sourceAccountIdentifier,omitempty"`
+	// True when the user has starred the file or directory
+	Favorite bool `json:"favorite,omitempty"`
+	// Color labels given by the user to the file or directory
+	Labels []string `json:"labels,omitempty"`
 }
 
 // NewCozyMetadata initializes a new FilesCozyMetadata struct
@@ -69,9 +73,37 @@ func (fcm *FilesCozyMetadata) Clone() *FilesCozyMetadata {
 		at := *fcm.UploadedAt
 		cloned.UploadedAt = &at
 	}
+	if fcm.Labels != nil {
+		cloned.Labels = make([]string, len(fcm.Labels))
+		copy(cloned.Labels, fcm.Labels)
+	}
 	return &cloned
 }
 
+// applyAnnotations returns the cozyMetadata with the favorite flag and the
+// labels of the patch. The given cozyMetadata is not modified.
+func applyAnnotations(fcm *FilesCozyMetadata, patch *DocPatch, cdate time.Time) *FilesCozyMetadata {
+	if patch.Favorite == nil && patch.Labels == nil {
+		return fcm
+	}
+	if fcm == nil {
+		fcm = NewCozyMetadata("")
+		fcm.CreatedAt = cdate
+	} else {
+		fcm = fcm.Clone()
+	}
+	if patch.Favorite != nil {
+		fcm.Favorite = *patch.Favorite
+	}
+	if patch.Labels != nil {
+		fcm.Labels = *patch.Labels
+		if len(fcm.Labels) == 0 {
+			fcm.Labels = nil
+		}
+	}
+	return fcm
+}
+
 // UpdatedByApp updates the list of UpdatedByApps entries with the new entry.
 // It ensures that each entry has a unique slug+instance, and the new entry
 // will be in the last position.
@@ -159,5 +191,11 @@ func (fcm *FilesCozyMetadata) ToJSONDoc() map[string]interface{} {
 	if fcm.SourceIdentifier != "" {
 		doc["sourceAccountIdentifier"] = fcm.SourceIdentifier
 	}
+	if fcm.Favorite {
+		doc["favorite"] = true
+	}
+	if len(fcm.Labels) > 0 {
+		doc["labels"] = fcm.Labels
+	}
 	return doc
 }
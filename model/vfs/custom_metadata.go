@@ -0,0 +1,297 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// Types of the fields of the custom metadata
+const (
+	CustomFieldString  = "string"
+	CustomFieldNumber  = "number"
+	CustomFieldInteger = "integer"
+	CustomFieldBoolean = "boolean"
+	CustomFieldDate    = "date"
+	CustomFieldArray   = "array"
+)
+
+const (
+	// customFieldMaxLength is the default maximal length of a string value.
+	customFieldMaxLength = 4096
+	// customFieldMaxItems is the maximal number of items of an array value.
+	customFieldMaxItems = 256
+	// customSchemaMaxFields is the maximal number of fields that an app can
+	// declare.
+	customSchemaMaxFields = 64
+)
+
+var customFieldNameReg = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+// ErrCustomMetadataNoSchema is used when an app tries to write custom
+// metadata without having declared them in its manifest.
+var ErrCustomMetadataNoSchema = errors.New("The app has not declared custom metadata in its manifest")
+
+// CustomMetadataError is returned when the custom metadata do not match the
+// schema declared by the app.
+type CustomMetadataError struct {
+	Field  string
+	Reason string
+}
+
+func (e *CustomMetadataError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("Invalid custom metadata: %s", e.Reason)
+	}
+	return fmt.Sprintf("Invalid custom metadata for %s: %s", e.Field, e.Reason)
+}
+
+// CustomMetadata are the metadata that the apps can attach to the files and
+// directories. There is a namespace per app, and the key is the slug of the
+// app. The values of a namespace are validated by the schema declared in the
+// manifest of the app.
+type CustomMetadata map[string]map[string]interface{}
+
+// Clone returns a deep copy of the custom metadata (the arrays are shared).
+func (cm CustomMetadata) Clone() CustomMetadata {
+	if cm == nil {
+		return nil
+	}
+	cloned := make(CustomMetadata, len(cm))
+	for slug, values := range cm {
+		vals := make(map[string]interface{}, len(values))
+		for k, v := range values {
+			vals[k] = v
+		}
+		cloned[slug] = vals
+	}
+	return cloned
+}
+
+// CustomMetadataField is the declaration of a field of the custom metadata.
+type CustomMetadataField struct {
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	// Items is the type of the items for an array
+	Items string `json:"items,omitempty"`
+	// Enum is the list of the allowed values
+	Enum      []interface{} `json:"enum,omitempty"`
+	Min       *float64      `json:"min,omitempty"`
+	Max       *float64      `json:"max,omitempty"`
+	MaxLength int           `json:"max_length,omitempty"`
+	// Searchable is used to ask the stack to create a mango index for the
+	// field.
+	Searchable bool `json:"searchable,omitempty"`
+}
+
+// CustomMetadataSchema is the list of the fields that an app has declared
+// for its custom metadata in its manifest, by name.
+type CustomMetadataSchema map[string]*CustomMetadataField
+
+// Check returns an error if the schema is not valid.
+func (s CustomMetadataSchema) Check() error {
+	if len(s) > customSchemaMaxFields {
+		return &CustomMetadataError{Reason: "too many fields"}
+	}
+	for name, field := range s {
+		if !customFieldNameReg.MatchString(name) {
+			return &CustomMetadataError{Field: name, Reason: "invalid field name"}
+		}
+		if field == nil {
+			return &CustomMetadataError{Field: name, Reason: "missing declaration"}
+		}
+		switch field.Type {
+		case CustomFieldString, CustomFieldNumber, CustomFieldInteger,
+			CustomFieldBoolean, CustomFieldDate:
+			if field.Items != "" {
+				return &CustomMetadataError{Field: name, Reason: "items is only for arrays"}
+			}
+		case CustomFieldArray:
+			switch field.Items {
+			case CustomFieldString, CustomFieldNumber, CustomFieldInteger,
+				CustomFieldBoolean, CustomFieldDate:
+			default:
+				return &CustomMetadataError{Field: name, Reason: "invalid items type"}
+			}
+		default:
+			return &CustomMetadataError{Field: name, Reason: "invalid type"}
+		}
+		if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			return &CustomMetadataError{Field: name, Reason: "min is greater than max"}
+		}
+		if field.MaxLength < 0 {
+			return &CustomMetadataError{Field: name, Reason: "invalid max_length"}
+		}
+	}
+	return nil
+}
+
+// Validate checks that the values match the schema. The values are the
+// content of the namespace of the app, and are replaced as a whole.
+func (s CustomMetadataSchema) Validate(values map[string]interface{}) error {
+	if len(s) == 0 {
+		return ErrCustomMetadataNoSchema
+	}
+	for name, value := range values {
+		field, ok := s[name]
+		if !ok {
+			return &CustomMetadataError{Field: name, Reason: "unknown field"}
+		}
+		if value == nil {
+			if field.Required {
+				return &CustomMetadataError{Field: name, Reason: "the field is required"}
+			}
+			continue
+		}
+		if err := field.validate(value); err != nil {
+			return &CustomMetadataError{Field: name, Reason: err.Error()}
+		}
+	}
+	for name, field := range s {
+		if _, ok := values[name]; field.Required && !ok {
+			return &CustomMetadataError{Field: name, Reason: "the field is required"}
+		}
+	}
+	return nil
+}
+
+func (f *CustomMetadataField) validate(value interface{}) error {
+	if f.Type != CustomFieldArray {
+		return f.validateScalar(f.Type, value)
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return errors.New("an array is expected")
+	}
+	if len(items) > customFieldMaxItems {
+		return errors.New("too many items")
+	}
+	for _, item := range items {
+		if err := f.validateScalar(f.Items, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *CustomMetadataField) validateScalar(typ string, value interface{}) error {
+	switch typ {
+	case CustomFieldString:
+		str, ok := value.(string)
+		if !ok {
+			return errors.New("a string is expected")
+		}
+		maxLength := f.MaxLength
+		if maxLength == 0 {
+			maxLength = customFieldMaxLength
+		}
+		if len(str) > maxLength {
+			return errors.New("the string is too long")
+		}
+	case CustomFieldNumber, CustomFieldInteger:
+		num, ok := value.(float64)
+		if !ok {
+			return errors.New("a number is expected")
+		}
+		if typ == CustomFieldInteger && num != math.Trunc(num) {
+			return errors.New("an integer is expected")
+		}
+		if f.Min != nil && num < *f.Min {
+			return errors.New("the number is too small")
+		}
+		if f.Max != nil && num > *f.Max {
+			return errors.New("the number is too big")
+		}
+	case CustomFieldBoolean:
+		if _, ok := value.(bool); !ok {
+			return errors.New("a boolean is expected")
+		}
+	case CustomFieldDate:
+		str, ok := value.(string)
+		if !ok {
+			return errors.New("a date is expected")
+		}
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return errors.New("the date must be in the RFC 3339 format")
+		}
+	}
+	if len(f.Enum) > 0 && !inEnum(f.Enum, value) {
+		return errors.New("the value is not allowed")
+	}
+	return nil
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomMetadataIndexes returns the mango indexes for the searchable fields
+// of the custom metadata of an app.
+func CustomMetadataIndexes(slug string, schema CustomMetadataSchema) []*mango.Index {
+	var indexes []*mango.Index
+	for name, field := range schema {
+		if field == nil || !field.Searchable {
+			continue
+		}
+		ddoc := customMetadataIndexPrefix(slug) + name
+		path := "custom_metadata." + slug + "." + name
+		indexes = append(indexes, mango.MakeIndex(consts.Files, ddoc, mango.IndexDef{Fields: []string{path}}))
+	}
+	return indexes
+}
+
+// DeleteObsoleteCustomMetadataIndexes removes the mango indexes for the
+// custom metadata of an app that are no longer searchable in its schema. With
+// a nil schema, like when the app is uninstalled, all the indexes of the app
+// are removed.
+func DeleteObsoleteCustomMetadataIndexes(db prefixer.Prefixer, slug string, schema CustomMetadataSchema) error {
+	prefix := "_design/" + customMetadataIndexPrefix(slug)
+	var ddocs []*couchdb.DesignDoc
+	req := &couchdb.AllDocsRequest{
+		StartKey: prefix,
+		EndKey:   prefix + "\uffff",
+		Limit:    customSchemaMaxFields * 2,
+	}
+	if err := couchdb.GetDesignDocs(db, consts.Files, req, &ddocs); err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil
+		}
+		return err
+	}
+	for _, ddoc := range ddocs {
+		if ddoc == nil {
+			continue
+		}
+		name := strings.TrimPrefix(ddoc.ID, prefix)
+		// The field names can't have a dash, so it is the index of an app
+		// whose slug starts with the slug of this app
+		if strings.Contains(name, "-") {
+			continue
+		}
+		if field, ok := schema[name]; ok && field != nil && field.Searchable {
+			continue
+		}
+		err := couchdb.DeleteDesignDoc(db, consts.Files, strings.TrimPrefix(ddoc.ID, "_design/"), ddoc.Rev)
+		if err != nil && !couchdb.IsNotFoundError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func customMetadataIndexPrefix(slug string) string {
+	return "by-custom-metadata-" + slug + "-"
+}
@@ -0,0 +1,86 @@
+package vfs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomMetadata(t *testing.T) {
+	var schema CustomMetadataSchema
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "rating": {"type": "integer", "min": 0, "max": 5, "searchable": true},
+  "status": {"type": "string", "enum": ["draft", "final"], "required": true},
+  "reviewed": {"type": "boolean"},
+  "due": {"type": "date"},
+  "labels": {"type": "array", "items": "string", "max_length": 8}
+}`), &schema))
+
+	t.Run("CheckSchema", func(t *testing.T) {
+		assert.NoError(t, schema.Check())
+
+		invalid := CustomMetadataSchema{"foo.bar": {Type: CustomFieldString}}
+		assert.Error(t, invalid.Check())
+		invalid = CustomMetadataSchema{"foo": {Type: "object"}}
+		assert.Error(t, invalid.Check())
+		invalid = CustomMetadataSchema{"foo": {Type: CustomFieldArray}}
+		assert.Error(t, invalid.Check())
+		lo, hi := 3.0, 1.0
+		invalid = CustomMetadataSchema{"foo": {Type: CustomFieldNumber, Min: &lo, Max: &hi}}
+		assert.Error(t, invalid.Check())
+	})
+
+	t.Run("ValidValues", func(t *testing.T) {
+		var values map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(`{
+  "rating": 4,
+  "status": "draft",
+  "reviewed": true,
+  "due": "2023-06-01T12:00:00Z",
+  "labels": ["work", "urgent"]
+}`), &values))
+		assert.NoError(t, schema.Validate(values))
+	})
+
+	t.Run("InvalidValues", func(t *testing.T) {
+		cases := []map[string]interface{}{
+			{"status": "draft", "unknown": "field"},
+			{"rating": 3.0},
+			{"status": "published"},
+			{"status": "draft", "rating": 4.5},
+			{"status": "draft", "rating": 6.0},
+			{"status": "draft", "reviewed": "yes"},
+			{"status": "draft", "due": "tomorrow"},
+			{"status": "draft", "labels": "work"},
+			{"status": "draft", "labels": []interface{}{"too long label"}},
+			{"status": nil},
+		}
+		for _, values := range cases {
+			err := schema.Validate(values)
+			var customErr *CustomMetadataError
+			assert.ErrorAs(t, err, &customErr, "values: %v", values)
+		}
+	})
+
+	t.Run("NoSchema", func(t *testing.T) {
+		var empty CustomMetadataSchema
+		err := empty.Validate(map[string]interface{}{})
+		assert.ErrorIs(t, err, ErrCustomMetadataNoSchema)
+	})
+
+	t.Run("Indexes", func(t *testing.T) {
+		indexes := CustomMetadataIndexes("drive", schema)
+		require.Len(t, indexes, 1)
+		assert.Equal(t, "by-custom-metadata-drive-rating", indexes[0].Request.DDoc)
+		assert.Equal(t, []string{"custom_metadata.drive.rating"}, indexes[0].Request.Index.Fields)
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		cm := CustomMetadata{"drive": {"rating": 4.0}}
+		cloned := cm.Clone()
+		cloned["drive"]["rating"] = 5.0
+		assert.Equal(t, 4.0, cm["drive"]["rating"])
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/realtime"
 )
 
 // DirDoc is a struct containing all the informations about a
@@ -41,8 +42,9 @@ type DirDoc struct {
 	ReferencedBy      []couchdb.DocReference `json:"referenced_by,omitempty"`
 	NotSynchronizedOn []couchdb.DocReference `json:"not_synchronized_on,omitempty"`
 
-	Metadata     Metadata           `json:"metadata,omitempty"`
-	CozyMetadata *FilesCozyMetadata `json:"cozyMetadata,omitempty"`
+	Metadata       Metadata           `json:"metadata,omitempty"`
+	CozyMetadata   *FilesCozyMetadata `json:"cozyMetadata,omitempty"`
+	CustomMetadata CustomMetadata     `json:"custom_metadata,omitempty"`
 }
 
 // ID returns the directory qualified identifier
@@ -70,6 +72,7 @@ func (d *DirDoc) Clone() couchdb.Doc {
 	if d.CozyMetadata != nil {
 		cloned.CozyMetadata = d.CozyMetadata.Clone()
 	}
+	cloned.CustomMetadata = d.CustomMetadata.Clone()
 	return &cloned
 }
 
@@ -259,7 +262,8 @@ func ModifyDirMetadata(fs VFS, olddoc *DirDoc, patch *DocPatch) (*DirDoc, error)
 	newdoc.ReferencedBy = olddoc.ReferencedBy
 	newdoc.NotSynchronizedOn = olddoc.NotSynchronizedOn
 	newdoc.Metadata = olddoc.Metadata
-	newdoc.CozyMetadata = olddoc.CozyMetadata
+	newdoc.CozyMetadata = applyAnnotations(olddoc.CozyMetadata, patch, cdate)
+	newdoc.CustomMetadata = olddoc.CustomMetadata
 
 	if err = fs.UpdateDirDoc(olddoc, newdoc); err != nil {
 		return nil, err
@@ -297,22 +301,38 @@ func TrashDir(fs VFS, olddoc *DirDoc) (*DirDoc, error) {
 	return newdoc, nil
 }
 
-// RestoreDir is used to restore a trashed directory given its document
-func RestoreDir(fs VFS, olddoc *DirDoc) (*DirDoc, error) {
+// RestoreDir is used to restore a trashed directory given its document. The
+// options can be nil to use the default strategy.
+func RestoreDir(fs VFS, olddoc *DirDoc, opts *RestoreOptions) (*DirDoc, error) {
 	oldpath, err := olddoc.Path(fs)
 	if err != nil {
 		return nil, err
 	}
 
-	restoreDir, err := getRestoreDir(fs, oldpath, olddoc.RestorePath)
+	target, err := getRestoreTarget(fs, oldpath, olddoc.RestorePath, olddoc.DocName, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	restoreDir, err := target.dir(fs)
 	if err != nil {
 		return nil, err
 	}
 
-	name := stripConflictSuffix(olddoc.DocName)
+	if target.strategy == RestoreMerge {
+		existing, err := fs.DirByPath(path.Join(restoreDir.Fullpath, target.name))
+		if err == nil {
+			if err = mergeDir(fs, olddoc, existing); err != nil {
+				return nil, err
+			}
+			return fs.DirByID(existing.DocID)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
 
 	var newdoc *DirDoc
-	err = tryOrUseSuffix(name, conflictFormat, func(name string) error {
+	err = target.try(func(name string) error {
 		newdoc = olddoc.Clone().(*DirDoc)
 		newdoc.DirID = restoreDir.DocID
 		newdoc.RestorePath = ""
@@ -329,17 +349,19 @@ func RestoreDir(fs VFS, olddoc *DirDoc) (*DirDoc, error) {
 }
 
 // FilterNotSynchronizedDocs filters a changes feed to replace documents in
-// not_synchronized_on directories with deleted: true entries.
-func FilterNotSynchronizedDocs(fs VFS, clientID string, changes *couchdb.ChangesResponse) error {
+// not_synchronized_on directories with deleted: true entries. If the OAuth
+// client has a sync scope (a list of top-level directories), the documents
+// outside of those directories are also replaced.
+func FilterNotSynchronizedDocs(fs VFS, clientID string, syncScope []string, changes *couchdb.ChangesResponse) error {
 	if len(changes.Results) == 0 {
 		return nil
 	}
 
-	notSynchronizedDirs, err := fetchNotSynchronizedOn(fs, clientID)
+	notSynchronizedDirs, err := fetchNotSynchronizedOn(fs, clientID, syncScope)
 	if err != nil {
 		return err
 	}
-	if len(notSynchronizedDirs.byID) == 0 {
+	if len(notSynchronizedDirs.byID) == 0 && notSynchronizedDirs.allowed == nil {
 		return nil
 	}
 
@@ -367,13 +389,61 @@ func FilterNotSynchronizedDocs(fs VFS, clientID string, changes *couchdb.Changes
 	return nil
 }
 
+// FilterNotSynchronizedBulk filters the changes of a bulk realtime event on
+// files, like FilterNotSynchronizedDocs does for a changes feed: the files and
+// directories that are not synchronized by the OAuth client are replaced by
+// deletions.
+func FilterNotSynchronizedBulk(fs VFS, clientID string, syncScope []string, bulk *realtime.BulkDoc) error {
+	changes := &couchdb.ChangesResponse{Results: make([]couchdb.Change, len(bulk.Changes))}
+	for i, change := range bulk.Changes {
+		doc := map[string]interface{}{
+			"_id":    change.ID,
+			"type":   change.Type,
+			"dir_id": change.DirID,
+			"path":   change.Path,
+		}
+		if change.Verb == realtime.EventDelete {
+			doc["_deleted"] = true
+		}
+		changes.Results[i] = couchdb.Change{
+			DocID:   change.ID,
+			Doc:     couchdb.JSONDoc{M: doc, Type: consts.Files},
+			Deleted: change.Verb == realtime.EventDelete,
+		}
+	}
+	if err := FilterNotSynchronizedDocs(fs, clientID, syncScope, changes); err != nil {
+		return err
+	}
+	for i, change := range changes.Results {
+		if change.Deleted && bulk.Changes[i].Verb != realtime.EventDelete {
+			bulk.Changes[i] = realtime.BulkChange{
+				Verb: realtime.EventDelete,
+				ID:   bulk.Changes[i].ID,
+				Rev:  bulk.Changes[i].Rev,
+			}
+		}
+	}
+	return nil
+}
+
 type notSynchronizedMap struct {
 	byID   map[string]struct{}
 	byPath map[string]struct{}
+	// allowed is the list of paths of the directories in the sync scope, or
+	// nil if the client has no sync scope
+	allowed []string
 }
 
-func fetchNotSynchronizedOn(fs VFS, clientID string) (notSynchronizedMap, error) {
+func fetchNotSynchronizedOn(fs VFS, clientID string, syncScope []string) (notSynchronizedMap, error) {
 	m := notSynchronizedMap{}
+	if len(syncScope) > 0 {
+		allowed, err := syncScopePaths(fs, syncScope)
+		if err != nil {
+			return m, err
+		}
+		m.allowed = allowed
+	}
+
 	docs, err := fs.ListNotSynchronizedOn(clientID)
 	if err != nil || len(docs) == 0 {
 		return m, err
@@ -400,6 +470,13 @@ func isNotSynchronized(fp FilePather, notSynchronizedDirs notSynchronizedMap, do
 		fpath, _ = fp.FilePath(&FileDoc{DocID: docID, DirID: dirID})
 	}
 
+	if notSynchronizedDirs.allowed != nil {
+		if deleted, _ := doc.M["_deleted"].(bool); !deleted &&
+			docID != consts.RootDirID && !inSyncScope(notSynchronizedDirs.allowed, fpath) {
+			return true
+		}
+	}
+
 	for {
 		if _, ok := notSynchronizedDirs.byPath[fpath]; ok {
 			return true
@@ -411,6 +488,66 @@ func isNotSynchronized(fp FilePather, notSynchronizedDirs notSynchronizedMap, do
 	}
 }
 
+// syncScopePaths returns the paths of the directories in the sync scope of an
+// OAuth client. The directories that no longer exist are ignored.
+func syncScopePaths(fs VFS, syncScope []string) ([]string, error) {
+	paths := make([]string, 0, len(syncScope))
+	for _, id := range syncScope {
+		dir, err := fs.DirByID(id)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, dir.Fullpath)
+	}
+	return paths, nil
+}
+
+func inSyncScope(allowed []string, fpath string) bool {
+	for _, p := range allowed {
+		if fpath == p || strings.HasPrefix(fpath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedBySyncScope returns true if the file or directory is inside one of
+// the directories of the sync scope of an OAuth client, or if the sync scope
+// is empty. The root directory is also allowed, so that the client can list
+// the top-level directories.
+func AllowedBySyncScope(fs VFS, syncScope []string, fd Fetcher) (bool, error) {
+	if len(syncScope) == 0 || fd.ID() == consts.RootDirID {
+		return true, nil
+	}
+	allowed, err := syncScopePaths(fs, syncScope)
+	if err != nil {
+		return false, err
+	}
+	fpath, err := fd.Path(fs)
+	if err != nil {
+		return false, err
+	}
+	return inSyncScope(allowed, fpath), nil
+}
+
+// CheckSyncScope checks that the given directory IDs can be used as the sync
+// scope of an OAuth client: they must be top-level directories.
+func CheckSyncScope(fs VFS, syncScope []string) error {
+	for _, id := range syncScope {
+		dir, err := fs.DirByID(id)
+		if err != nil {
+			return err
+		}
+		if dir.DirID != consts.RootDirID || dir.DocID == consts.TrashDirID {
+			return ErrNotTopLevelDir
+		}
+	}
+	return nil
+}
+
 var (
 	_ couchdb.Doc = &DirDoc{}
 	_ os.FileInfo = &DirDoc{}
@@ -0,0 +1,114 @@
+package vfs
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/cache"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// The disk usage of an instance is kept in a counter in the cache. It is
+// updated by the indexer when a file or a version is created, modified or
+// deleted, so that the quota can be checked on each upload without querying
+// the CouchDB views. Some paths, like the bulk updates of the sharings, can
+// make it drift, and it is reconciled with the views by the usage worker.
+
+// diskUsageCounterTTL is how long the counter is kept in the cache without
+// being reconciled. After that, it is computed again from the views.
+const diskUsageCounterTTL = 7 * 24 * time.Hour
+
+func diskUsageKey(db prefixer.Prefixer) string {
+	return "disk-usage:" + db.DBPrefix()
+}
+
+func diskUsageCache() cache.Cache {
+	return config.GetConfig().CacheStorage
+}
+
+// usedBytes returns the number of bytes of a file that are counted in the
+// disk usage. The files in the cold storage are not counted.
+func usedBytes(doc *FileDoc) int64 {
+	if doc == nil || doc.Cold {
+		return 0
+	}
+	return doc.ByteSize
+}
+
+// versionUsedBytes returns the number of bytes of an old version that are
+// counted in the disk usage.
+func versionUsedBytes(v *Version) int64 {
+	if v == nil || v.Cold {
+		return 0
+	}
+	return v.ByteSize
+}
+
+// DiskUsageDelta returns the change of the disk usage when a file document is
+// replaced by a new one. The old document is nil for a creation, and the new
+// one is nil for a deletion.
+func DiskUsageDelta(olddoc, newdoc *FileDoc) int64 {
+	return usedBytes(newdoc) - usedBytes(olddoc)
+}
+
+// UpdateDiskUsage adds the delta to the disk usage counter of the instance. It
+// does nothing if the counter is not in the cache, as it will be computed from
+// the views on the next call to DiskUsage.
+func UpdateDiskUsage(db prefixer.Prefixer, delta int64) {
+	c := diskUsageCache()
+	if delta == 0 || c == nil {
+		return
+	}
+	c.IncrBy(diskUsageKey(db), delta)
+}
+
+// cachedDiskUsage returns the disk usage counter of the instance, if it is in
+// the cache.
+func cachedDiskUsage(db prefixer.Prefixer) (int64, bool) {
+	c := diskUsageCache()
+	if c == nil {
+		return 0, false
+	}
+	buf, ok := c.Get(diskUsageKey(db))
+	if !ok {
+		return 0, false
+	}
+	used, err := strconv.ParseInt(string(buf), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return used, true
+}
+
+// initDiskUsage puts the disk usage computed from the views in the cache,
+// unless another process has already done it.
+func initDiskUsage(db prefixer.Prefixer, used int64) {
+	if c := diskUsageCache(); c != nil {
+		c.SetNX(diskUsageKey(db), []byte(strconv.FormatInt(used, 10)), diskUsageCounterTTL)
+	}
+}
+
+// ReconcileDiskUsage replaces the disk usage counter of the instance by the
+// value computed from the views, and logs the drift if there was one.
+func ReconcileDiskUsage(db prefixer.Prefixer, used int64) {
+	c := diskUsageCache()
+	if c == nil {
+		return
+	}
+	if counted, ok := cachedDiskUsage(db); ok && counted != used {
+		logger.WithDomain(db.DomainName()).WithNamespace("vfs").
+			Infof("The disk usage counter has drifted by %d bytes", counted-used)
+	}
+	c.Set(diskUsageKey(db), []byte(strconv.FormatInt(used, 10)), diskUsageCounterTTL)
+}
+
+// ClearDiskUsage removes the disk usage counter of the instance from the
+// cache. It is used when the instance is destroyed, as a new instance with the
+// same domain will have the same prefix.
+func ClearDiskUsage(db prefixer.Prefixer) {
+	if c := diskUsageCache(); c != nil {
+		c.Clear(diskUsageKey(db))
+	}
+}
@@ -0,0 +1,50 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskUsageCounter(t *testing.T) {
+	config.UseTestFile(t)
+	db := prefixer.NewPrefixer(0, "disk-usage.cozy.localhost", "disk-usage")
+	t.Cleanup(func() { ClearDiskUsage(db) })
+
+	t.Run("Delta", func(t *testing.T) {
+		hot := &FileDoc{ByteSize: 100}
+		bigger := &FileDoc{ByteSize: 150}
+		cold := &FileDoc{ByteSize: 100, Cold: true}
+		assert.EqualValues(t, 100, DiskUsageDelta(nil, hot))
+		assert.EqualValues(t, -100, DiskUsageDelta(hot, nil))
+		assert.EqualValues(t, 50, DiskUsageDelta(hot, bigger))
+		assert.EqualValues(t, -100, DiskUsageDelta(hot, cold))
+		assert.EqualValues(t, 0, DiskUsageDelta(cold, nil))
+	})
+
+	t.Run("NoCounter", func(t *testing.T) {
+		UpdateDiskUsage(db, 42)
+		_, ok := cachedDiskUsage(db)
+		assert.False(t, ok)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		initDiskUsage(db, 1000)
+		initDiskUsage(db, 2000)
+		UpdateDiskUsage(db, 500)
+		UpdateDiskUsage(db, -200)
+		used, ok := cachedDiskUsage(db)
+		require.True(t, ok)
+		assert.EqualValues(t, 1300, used)
+	})
+
+	t.Run("Reconcile", func(t *testing.T) {
+		ReconcileDiskUsage(db, 1234)
+		used, ok := cachedDiskUsage(db)
+		require.True(t, ok)
+		assert.EqualValues(t, 1234, used)
+	})
+}
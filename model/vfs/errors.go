@@ -31,6 +31,12 @@ var (
 	ErrFileInTrash = errors.New("File or directory is already in the trash")
 	// ErrFileNotInTrash is used when the file is not in the trash
 	ErrFileNotInTrash = errors.New("File or directory is not in the trash")
+	// ErrInvalidRestoreStrategy is used when the strategy for restoring a
+	// file or directory from the trash is unknown or misses a parameter
+	ErrInvalidRestoreStrategy = errors.New("Invalid strategy for restoring from the trash")
+	// ErrNotTopLevelDir is used when a directory given for the sync scope of
+	// an OAuth client is not at the root of the VFS
+	ErrNotTopLevelDir = errors.New("The directory is not a top-level directory")
 	// ErrParentInTrash is used when trying to upload a file to a directory
 	// that is trashed
 	ErrParentInTrash = errors.New("Parent directory is in the trash")
@@ -48,6 +54,12 @@ var (
 	ErrMaxFileSize = errors.New("The file is too big and exceeds the filesystem maximum file size")
 	// ErrFsckFailFast is used when the FSCK is stopped by the fail-fast option
 	ErrFsckFailFast = errors.New("FSCK has been stopped on first failure")
+	// ErrFsckNotOrphan is used when trying to reclaim or restore something
+	// that is not an orphan object
+	ErrFsckNotOrphan = errors.New("FSCK log is not about an orphan object")
+	// ErrFsckNotSupported is used when the orphan objects cannot be reclaimed
+	// or restored for the layout of the VFS
+	ErrFsckNotSupported = errors.New("Orphan objects are not supported for this VFS layout")
 	// ErrWrongToken is used when a key is not found on the store
 	ErrWrongToken = errors.New("Wrong download token")
 	// ErrInvalidMetadataID is used when the metadata cannot be found from a MetadatID parameter
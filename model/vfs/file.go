@@ -3,10 +3,12 @@ package vfs
 import (
 	"encoding/base64"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -46,13 +48,22 @@ type FileDoc struct {
 	Metadata     Metadata               `json:"metadata,omitempty"`
 	ReferencedBy []couchdb.DocReference `json:"referenced_by,omitempty"`
 
-	CozyMetadata *FilesCozyMetadata `json:"cozyMetadata,omitempty"`
+	CozyMetadata   *FilesCozyMetadata `json:"cozyMetadata,omitempty"`
+	CustomMetadata CustomMetadata     `json:"custom_metadata,omitempty"`
 
 	// InternalID is an identifier that can be used by the VFS, but must no be
 	// used by clients. For example, it can be used to know the location in
 	// Swift of a file.
 	InternalID string `json:"internal_vfs_id,omitempty"`
 
+	// Cold is true when the content of the file has been moved to the cold
+	// storage. It can still be read, but it is slower.
+	Cold bool `json:"cold,omitempty"`
+
+	// Scan is the status given to the file by a scanning or policy
+	// subsystem, like an antivirus.
+	Scan *ScanStatus `json:"scan,omitempty"`
+
 	// Cache of the fullpath of the file. Should not have to be invalidated
 	// since we use FileDoc as immutable data-structures.
 	fullpath string
@@ -86,6 +97,11 @@ func (f *FileDoc) Clone() couchdb.Doc {
 	if f.CozyMetadata != nil {
 		cloned.CozyMetadata = f.CozyMetadata.Clone()
 	}
+	cloned.CustomMetadata = f.CustomMetadata.Clone()
+	if f.Scan != nil {
+		scan := *f.Scan
+		cloned.Scan = &scan
+	}
 	return &cloned
 }
 
@@ -222,6 +238,23 @@ func NewFileDoc(name, dirID string, size int64, md5Sum []byte, mimeType, class s
 //
 // The content disposition is inlined.
 func ServeFileContent(fs VFS, doc *FileDoc, version *Version, filename, disposition string, req *http.Request, w http.ResponseWriter) error {
+	if doc.Quarantined() {
+		return ErrFileQuarantined
+	}
+	return serveFileContent(fs, doc, version, filename, disposition, req, w)
+}
+
+// ServeQuarantinedFileContent replies to a http request with the content of a
+// file, even if it has been quarantined. It must only be used by the
+// administrators.
+func ServeQuarantinedFileContent(fs VFS, doc *FileDoc, req *http.Request, w http.ResponseWriter) error {
+	// The VFS refuses to open the content of a quarantined file
+	unchecked := doc.Clone().(*FileDoc)
+	unchecked.Scan = nil
+	return serveFileContent(fs, unchecked, nil, "", "attachment", req, w)
+}
+
+func serveFileContent(fs VFS, doc *FileDoc, version *Version, filename, disposition string, req *http.Request, w http.ResponseWriter) error {
 	if filename == "" {
 		filename = doc.DocName
 	}
@@ -236,6 +269,17 @@ func ServeFileContent(fs VFS, doc *FileDoc, version *Version, filename, disposit
 		header.Set("Etag", fmt.Sprintf(`"%s"`, eTag))
 	}
 
+	// A request for a single range of bytes is served by fetching only this
+	// part of the content from the storage. The other cases (multiple ranges,
+	// conditional requests, etc.) are left to http.ServeContent, as the
+	// preconditions must be evaluated before the range.
+	rng := req.Header.Get("Range")
+	if version == nil && req.Method == http.MethodGet && rng != "" && !isConditionalRequest(req) {
+		if start, length, ok := parseSingleRange(rng, doc.ByteSize); ok {
+			return serveFileRange(fs, doc, start, length, w)
+		}
+	}
+
 	var content File
 	var err error
 	if version == nil {
@@ -252,6 +296,80 @@ func ServeFileContent(fs VFS, doc *FileDoc, version *Version, filename, disposit
 	return nil
 }
 
+// isConditionalRequest returns true if the request has a header for a
+// precondition, like If-None-Match or If-Modified-Since.
+func isConditionalRequest(req *http.Request) bool {
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"} {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func serveFileRange(fs VFS, doc *FileDoc, start, length int64, w http.ResponseWriter) error {
+	content, err := fs.OpenFileAt(doc, start, length)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Last-Modified", doc.UpdatedAt.UTC().Format(http.TimeFormat))
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, doc.ByteSize))
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	_, err = io.CopyN(w, content, length)
+	return err
+}
+
+// parseSingleRange parses a Range header with a single range of bytes, and
+// returns the offset and length of this range for a content of the given
+// size. It returns false if the header has several ranges or if the range
+// cannot be satisfied.
+func parseSingleRange(header string, size int64) (int64, int64, bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) || size <= 0 {
+		return 0, 0, false
+	}
+	spec := strings.TrimSpace(header[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	first, last := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if first == "" {
+		// Suffix range: the last N bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true
+}
+
 // ModifyFileMetadata modify the metadata associated to a file. It can
 // be used to rename or move the file in the VFS.
 func ModifyFileMetadata(fs VFS, olddoc *FileDoc, patch *DocPatch) (*FileDoc, error) {
@@ -313,7 +431,8 @@ func ModifyFileMetadata(fs VFS, olddoc *FileDoc, patch *DocPatch) (*FileDoc, err
 	newdoc.UpdatedAt = *patch.UpdatedAt
 	newdoc.Metadata = olddoc.Metadata
 	newdoc.ReferencedBy = olddoc.ReferencedBy
-	newdoc.CozyMetadata = olddoc.CozyMetadata
+	newdoc.CozyMetadata = applyAnnotations(olddoc.CozyMetadata, patch, cdate)
+	newdoc.CustomMetadata = olddoc.CustomMetadata
 	newdoc.InternalID = olddoc.InternalID
 
 	if err = fs.UpdateFileDoc(olddoc, newdoc); err != nil {
@@ -352,22 +471,25 @@ func TrashFile(fs VFS, olddoc *FileDoc) (*FileDoc, error) {
 	return newdoc, err
 }
 
-// RestoreFile is used to restore a trashed file given its document
-func RestoreFile(fs VFS, olddoc *FileDoc) (*FileDoc, error) {
+// RestoreFile is used to restore a trashed file given its document. The
+// options can be nil to use the default strategy.
+func RestoreFile(fs VFS, olddoc *FileDoc, opts *RestoreOptions) (*FileDoc, error) {
 	oldpath, err := olddoc.Path(fs)
 	if err != nil {
 		return nil, err
 	}
 
-	restoreDir, err := getRestoreDir(fs, oldpath, olddoc.RestorePath)
+	target, err := getRestoreTarget(fs, oldpath, olddoc.RestorePath, olddoc.DocName, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	restoreDir, err := target.dir(fs)
 	if err != nil {
 		return nil, err
 	}
-
-	name := stripConflictSuffix(olddoc.DocName)
 
 	var newdoc *FileDoc
-	err = tryOrUseSuffix(name, conflictFormat, func(name string) error {
+	err = target.try(func(name string) error {
 		newdoc = olddoc.Clone().(*FileDoc)
 		newdoc.DirID = restoreDir.DocID
 		newdoc.RestorePath = ""
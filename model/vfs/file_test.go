@@ -0,0 +1,74 @@
+package vfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSingleRange(t *testing.T) {
+	tests := []struct {
+		header string
+		start  int64
+		length int64
+		ok     bool
+	}{
+		{"bytes=0-99", 0, 100, true},
+		{"bytes=100-", 100, 900, true},
+		{"bytes=-100", 900, 100, true},
+		{"bytes=-2000", 0, 1000, true},
+		{"bytes=990-2000", 990, 10, true},
+		{"bytes=1000-", 0, 0, false},
+		{"bytes=50-10", 0, 0, false},
+		{"bytes=0-9,20-29", 0, 0, false},
+		{"bytes=-0", 0, 0, false},
+		{"items=0-9", 0, 0, false},
+		{"bytes=abc", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, length, ok := parseSingleRange(tt.header, 1000)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.start, start)
+				assert.Equal(t, tt.length, length)
+			}
+		})
+	}
+}
+
+func TestQuarantinedFile(t *testing.T) {
+	doc := &FileDoc{DocName: "invoice.pdf"}
+	assert.False(t, doc.Quarantined())
+
+	doc.Scan = &ScanStatus{Status: ScanStatusPending}
+	assert.False(t, doc.Quarantined())
+
+	doc.Scan = &ScanStatus{Status: ScanStatusQuarantined, Reason: "Eicar-Test-Signature"}
+	assert.True(t, doc.Quarantined())
+	cloned := doc.Clone().(*FileDoc)
+	cloned.Scan.Status = ScanStatusClean
+	assert.True(t, doc.Quarantined())
+
+	req := httptest.NewRequest(http.MethodGet, "/files/download", nil)
+	rec := httptest.NewRecorder()
+	err := ServeFileContent(nil, doc, nil, "", "attachment", req, rec)
+	assert.Equal(t, ErrFileQuarantined, err)
+	assert.Empty(t, rec.Body.String())
+
+	_, err = SetScanStatus(nil, doc, "infected", "", "")
+	assert.Equal(t, ErrInvalidScanStatus, err)
+}
+
+func TestCheckNotQuarantined(t *testing.T) {
+	doc := &FileDoc{}
+	assert.NoError(t, CheckNotQuarantined(doc))
+	doc.Scan = &ScanStatus{Status: ScanStatusClean}
+	assert.NoError(t, CheckNotQuarantined(doc))
+	doc.Scan = &ScanStatus{Status: ScanStatusQuarantined}
+	assert.Equal(t, ErrFileQuarantined, CheckNotQuarantined(doc))
+	_, err := preview(nil, doc)
+	assert.Equal(t, ErrFileQuarantined, err)
+}
@@ -112,6 +112,26 @@ func (f *FsckLog) String() string {
 	panic(fmt.Sprintf("bad FsckLog type: %#v", f))
 }
 
+// Trim removes the children and the metadata of the documents of the log, as
+// they can take a lot of space when serialized to JSON.
+func (f *FsckLog) Trim() {
+	if f.FileDoc != nil {
+		f.FileDoc.DirsChildren = nil // It can be filled on type mismatch
+		f.FileDoc.FilesChildren = nil
+		f.FileDoc.FilesChildrenSize = 0
+		f.FileDoc.Metadata = nil
+	}
+	if f.DirDoc != nil {
+		f.DirDoc.DirsChildren = nil
+		f.DirDoc.FilesChildren = nil
+		f.DirDoc.FilesChildrenSize = 0
+		f.DirDoc.Metadata = nil
+	}
+	if f.VersionDoc != nil {
+		f.VersionDoc.Metadata = nil
+	}
+}
+
 // FsckContentMismatch is a struct used by the FSCK where CouchDB and Swift
 // haven't the same information about a file content (md5sum and size).
 type FsckContentMismatch struct {
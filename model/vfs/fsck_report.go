@@ -0,0 +1,208 @@
+package vfs
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// FsckMode tells what the fsck job must do with the orphan objects.
+type FsckMode string
+
+const (
+	// FsckModeReport is used to only report the orphans and ghosts.
+	FsckModeReport FsckMode = "report"
+	// FsckModeReclaim is used to remove the orphan objects from the storage
+	// to free their space.
+	FsckModeReclaim FsckMode = "reclaim"
+	// FsckModeRestore is used to create the missing documents in the index
+	// for the orphan objects.
+	FsckModeRestore FsckMode = "restore"
+)
+
+// OrphanGracePeriod is the minimal age of an orphan object before it can be
+// reclaimed or restored. An upload in progress can have its content written
+// to the storage before its document is added to the index.
+const OrphanGracePeriod = 1 * time.Hour
+
+// MaxFsckReportEntries is the maximal number of entries kept in a report, to
+// avoid hitting the size limit of a CouchDB document.
+const MaxFsckReportEntries = 1000
+
+// Valid returns true if the mode is known.
+func (m FsckMode) Valid() bool {
+	return m == FsckModeReport || m == FsckModeReclaim || m == FsckModeRestore
+}
+
+// FsckReportEntry is an orphan or a ghost found by the fsck job, with the
+// action that has been made for it.
+type FsckReportEntry struct {
+	*FsckLog
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// FsckReport is the document persisted by the fsck job. It lists the orphans
+// (objects in the storage without a document in the index) and the ghosts
+// (documents in the index without an object in the storage).
+type FsckReport struct {
+	DocID         string             `json:"_id,omitempty"`
+	DocRev        string             `json:"_rev,omitempty"`
+	Mode          FsckMode           `json:"mode"`
+	Orphans       int                `json:"orphans"`
+	OrphansSize   int64              `json:"orphans_size"`
+	Ghosts        int                `json:"ghosts"`
+	GhostsSize    int64              `json:"ghosts_size"`
+	Others        int                `json:"others"`
+	Reclaimed     int                `json:"reclaimed"`
+	ReclaimedSize int64              `json:"reclaimed_size"`
+	Restored      int                `json:"restored"`
+	Skipped       int                `json:"skipped"`
+	Failures      int                `json:"failures"`
+	Entries       []*FsckReportEntry `json:"entries"`
+	Truncated     bool               `json:"truncated,omitempty"`
+	StartedAt     time.Time          `json:"started_at"`
+	FinishedAt    time.Time          `json:"finished_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (r *FsckReport) ID() string { return r.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (r *FsckReport) Rev() string { return r.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (r *FsckReport) DocType() string { return consts.FilesFsckReports }
+
+// Clone implements couchdb.Doc
+func (r *FsckReport) Clone() couchdb.Doc {
+	cloned := *r
+	cloned.Entries = make([]*FsckReportEntry, len(r.Entries))
+	copy(cloned.Entries, r.Entries)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (r *FsckReport) SetID(id string) { r.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (r *FsckReport) SetRev(rev string) { r.DocRev = rev }
+
+// NewFsckReport returns an empty report for the given mode.
+func NewFsckReport(id string, mode FsckMode) *FsckReport {
+	return &FsckReport{
+		DocID:     id,
+		Mode:      mode,
+		Entries:   []*FsckReportEntry{},
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// Run checks the consistency between the storage and the index, and fills
+// the report with the orphans and the ghosts. Depending on the mode, the
+// orphans are reclaimed or restored.
+func (r *FsckReport) Run(fs VFS) error {
+	var logs []*FsckLog
+	err := fs.CheckFilesConsistency(func(log *FsckLog) {
+		logs = append(logs, log)
+	}, false)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		r.add(fs, log)
+	}
+	r.FinishedAt = time.Now().UTC()
+	return nil
+}
+
+func (r *FsckReport) add(fs VFS, log *FsckLog) {
+	entry := &FsckReportEntry{FsckLog: log}
+	switch {
+	case log.IsOrphanObject():
+		r.Orphans++
+		r.OrphansSize += log.size()
+		r.handleOrphan(fs, entry)
+	case log.Type == FSMissing:
+		r.Ghosts++
+		r.GhostsSize += log.size()
+	default:
+		r.Others++
+		return
+	}
+	if len(r.Entries) >= MaxFsckReportEntries {
+		r.Truncated = true
+		return
+	}
+	log.Trim()
+	r.Entries = append(r.Entries, entry)
+}
+
+func (r *FsckReport) handleOrphan(fs VFS, entry *FsckReportEntry) {
+	var err error
+	switch r.Mode {
+	case FsckModeReclaim:
+		if entry.tooRecent() {
+			entry.Action = "skipped"
+			r.Skipped++
+			return
+		}
+		if err = fs.ReclaimOrphan(entry.FsckLog); err == nil {
+			entry.Action = "reclaimed"
+			r.Reclaimed++
+			r.ReclaimedSize += entry.size()
+		}
+	case FsckModeRestore:
+		if entry.tooRecent() || entry.Type != IndexMissing {
+			entry.Action = "skipped"
+			r.Skipped++
+			return
+		}
+		if err = fs.RestoreOrphan(entry.FsckLog); err == nil {
+			entry.Action = "restored"
+			r.Restored++
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		r.Failures++
+	}
+}
+
+// IsOrphanObject returns true if the log is about an object in the storage
+// that has no document in the index.
+func (f *FsckLog) IsOrphanObject() bool {
+	return f.Type == IndexMissing || f.Type == ThumbnailWithNoFile
+}
+
+func (f *FsckLog) size() int64 {
+	switch {
+	case f.IsVersion && f.VersionDoc != nil:
+		return f.VersionDoc.ByteSize
+	case f.FileDoc != nil:
+		return f.FileDoc.ByteSize
+	}
+	return 0
+}
+
+func (f *FsckLog) tooRecent() bool {
+	var modified time.Time
+	switch {
+	case f.IsVersion && f.VersionDoc != nil:
+		modified = f.VersionDoc.UpdatedAt
+	case f.FileDoc != nil:
+		modified = f.FileDoc.UpdatedAt
+	}
+	return time.Since(modified) < OrphanGracePeriod
+}
+
+// GetFsckReport returns the report of the fsck job with the given ID.
+func GetFsckReport(db prefixer.Prefixer, id string) (*FsckReport, error) {
+	var doc FsckReport
+	if err := couchdb.GetDoc(db, consts.FilesFsckReports, id, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
@@ -0,0 +1,80 @@
+package vfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsckReport(t *testing.T) {
+	orphan := func(size int64, updatedAt time.Time) *FsckLog {
+		return &FsckLog{
+			Type:   IndexMissing,
+			IsFile: true,
+			FileDoc: &TreeFile{
+				DirOrFileDoc: DirOrFileDoc{
+					DirDoc:   &DirDoc{DocID: "orphan", UpdatedAt: updatedAt},
+					ByteSize: size,
+				},
+			},
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		assert.True(t, FsckModeReport.Valid())
+		assert.True(t, FsckModeReclaim.Valid())
+		assert.True(t, FsckModeRestore.Valid())
+		assert.False(t, FsckMode("").Valid())
+		assert.False(t, FsckMode("delete").Valid())
+	})
+
+	t.Run("IsOrphanObject", func(t *testing.T) {
+		assert.True(t, (&FsckLog{Type: IndexMissing}).IsOrphanObject())
+		assert.True(t, (&FsckLog{Type: ThumbnailWithNoFile}).IsOrphanObject())
+		assert.False(t, (&FsckLog{Type: FSMissing}).IsOrphanObject())
+		assert.False(t, (&FsckLog{Type: ContentMismatch}).IsOrphanObject())
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		r := NewFsckReport("job-id", FsckModeReport)
+		r.add(nil, orphan(100, time.Now().Add(-2*time.Hour)))
+		r.add(nil, &FsckLog{
+			Type:       FSMissing,
+			IsVersion:  true,
+			VersionDoc: &Version{ByteSize: 42},
+		})
+		r.add(nil, &FsckLog{Type: ContentMismatch})
+		assert.Equal(t, 1, r.Orphans)
+		assert.Equal(t, int64(100), r.OrphansSize)
+		assert.Equal(t, 1, r.Ghosts)
+		assert.Equal(t, int64(42), r.GhostsSize)
+		assert.Equal(t, 1, r.Others)
+		assert.Len(t, r.Entries, 2)
+		assert.Empty(t, r.Entries[0].Action)
+	})
+
+	t.Run("SkipRecentOrphans", func(t *testing.T) {
+		r := NewFsckReport("job-id", FsckModeReclaim)
+		r.add(nil, orphan(100, time.Now().Add(-10*time.Minute)))
+		assert.Equal(t, 1, r.Orphans)
+		assert.Equal(t, 1, r.Skipped)
+		assert.Equal(t, 0, r.Reclaimed)
+		assert.Equal(t, "skipped", r.Entries[0].Action)
+
+		r = NewFsckReport("job-id", FsckModeRestore)
+		r.add(nil, &FsckLog{Type: ThumbnailWithNoFile})
+		assert.Equal(t, 1, r.Skipped)
+		assert.Equal(t, 0, r.Restored)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		r := NewFsckReport("job-id", FsckModeReport)
+		for i := 0; i <= MaxFsckReportEntries; i++ {
+			r.add(nil, orphan(1, time.Now()))
+		}
+		assert.Equal(t, MaxFsckReportEntries+1, r.Orphans)
+		assert.Len(t, r.Entries, MaxFsckReportEntries)
+		assert.True(t, r.Truncated)
+	})
+}
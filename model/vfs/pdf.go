@@ -28,6 +28,10 @@ func ServePDFIcon(w http.ResponseWriter, req *http.Request, fs VFS, doc *FileDoc
 }
 
 func icon(fs VFS, doc *FileDoc) (*bytes.Buffer, error) {
+	// The cache is shared and checked before opening the file
+	if err := CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
 	cache := previewfs.SystemCache()
 	if buf, err := cache.GetIcon(doc.MD5Sum); err == nil {
 		return buf, nil
@@ -110,6 +114,9 @@ func ServePDFPreview(w http.ResponseWriter, req *http.Request, fs VFS, doc *File
 }
 
 func preview(fs VFS, doc *FileDoc) (*bytes.Buffer, error) {
+	if err := CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
 	cache := previewfs.SystemCache()
 	if buf, err := cache.GetPreview(doc.MD5Sum); err == nil {
 		return buf, nil
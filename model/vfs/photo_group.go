@@ -0,0 +1,206 @@
+package vfs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+)
+
+const (
+	// LivePhotoGroup is the type of group for a live photo: an image and a
+	// short video with the same name (like IMG_1234.HEIC and IMG_1234.MOV).
+	LivePhotoGroup = "live_photo"
+	// BurstGroup is the type of group for a sequence of images taken in
+	// burst mode (like IMG_20230101_120000_BURST001.jpg).
+	BurstGroup = "burst"
+)
+
+// photoGroupWindow is the delay around the last update of a file where the
+// other files of its group are looked for. The files of a group are taken at
+// the same moment, and are uploaded together.
+const photoGroupWindow = time.Hour
+
+// maxPhotoGroupCandidates is the maximal number of files looked at for finding
+// the other files of a group.
+const maxPhotoGroupCandidates = 1000
+
+var burstRegexp = regexp.MustCompile(`(?i)^(.+)_BURST\d+(_COVER)?\.(jpe?g|heic|heif)$`)
+
+// PhotoGroup is the group of a live photo or a burst. It is stored in the
+// photo_group field of the metadata of the files of the group, and the
+// clients can display the primary file of the group as a single item.
+type PhotoGroup struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// photoGroupKey returns the type and the key of the group that the file can be
+// part of, or empty strings if the file cannot be grouped.
+func photoGroupKey(name, mime string) (string, string) {
+	if m := burstRegexp.FindStringSubmatch(name); m != nil {
+		return BurstGroup, strings.ToLower(m[1])
+	}
+	switch mime {
+	case "image/jpeg", "image/heic", "image/heif", "video/quicktime":
+		base := strings.TrimSuffix(name, path.Ext(name))
+		return LivePhotoGroup, strings.ToLower(base)
+	}
+	return "", ""
+}
+
+// photoGroupID returns a stable identifier for the group with the given key in
+// the given directory.
+func photoGroupID(dirID, typ, key string) string {
+	sum := md5.Sum([]byte(dirID + "/" + typ + "/" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// selectPhotoGroup returns the members of the group, with the primary file
+// first, or nil if the files do not make a group. A live photo is an image and
+// a video, and a burst has at least two images.
+func selectPhotoGroup(typ string, members []*FileDoc) []*FileDoc {
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].DocName < members[j].DocName
+	})
+	switch typ {
+	case LivePhotoGroup:
+		var image, video *FileDoc
+		for _, f := range members {
+			if f.Class == "image" && image == nil {
+				image = f
+			} else if f.Class == "video" && video == nil {
+				video = f
+			} else {
+				// The group is ambiguous, so we let the files alone
+				return nil
+			}
+		}
+		if image == nil || video == nil {
+			return nil
+		}
+		return []*FileDoc{image, video}
+	case BurstGroup:
+		if len(members) < 2 {
+			return nil
+		}
+		for i, f := range members {
+			if strings.Contains(strings.ToUpper(f.DocName), "_COVER.") {
+				members[0], members[i] = members[i], members[0]
+				break
+			}
+		}
+		return members
+	}
+	return nil
+}
+
+// GroupPhotos looks for the other files of the live photo or burst that the
+// given file can be part of, and sets the photo_group metadata on the files of
+// the group. It does nothing if the files are already grouped.
+func GroupPhotos(fs VFS, doc *FileDoc) error {
+	if doc.Trashed {
+		return nil
+	}
+	typ, key := photoGroupKey(doc.DocName, doc.Mime)
+	if typ == "" {
+		return nil
+	}
+
+	var candidates []*FileDoc
+	req := &couchdb.FindRequest{
+		UseIndex: "by-dir-id-updated-at",
+		Selector: mango.And(
+			mango.Equal("dir_id", doc.DirID),
+			mango.Gte("updated_at", doc.UpdatedAt.Add(-photoGroupWindow)),
+			mango.Lte("updated_at", doc.UpdatedAt.Add(photoGroupWindow)),
+		),
+		Limit: maxPhotoGroupCandidates,
+	}
+	if err := couchdb.FindDocs(fs, consts.Files, req, &candidates); err != nil {
+		return err
+	}
+
+	members := []*FileDoc{doc}
+	for _, f := range candidates {
+		if f.DocID == doc.DocID || f.Type != consts.FileType || f.Trashed {
+			continue
+		}
+		if t, k := photoGroupKey(f.DocName, f.Mime); t == typ && k == key {
+			members = append(members, f)
+		}
+	}
+	members = selectPhotoGroup(typ, members)
+	if members == nil {
+		return nil
+	}
+
+	id := photoGroupID(doc.DirID, typ, key)
+	for i, f := range members {
+		group := PhotoGroup{ID: id, Type: typ, Primary: i == 0}
+		if hasPhotoGroup(f, group) {
+			continue
+		}
+		newdoc := f.Clone().(*FileDoc)
+		if newdoc.Metadata == nil {
+			newdoc.Metadata = Metadata{}
+		}
+		newdoc.Metadata["photo_group"] = group
+		if err := fs.UpdateFileDoc(f, newdoc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasPhotoGroup returns true if the file already has the given group in its
+// metadata.
+func hasPhotoGroup(f *FileDoc, group PhotoGroup) bool {
+	switch current := f.Metadata["photo_group"].(type) {
+	case PhotoGroup:
+		return current == group
+	case map[string]interface{}:
+		primary, _ := current["primary"].(bool)
+		return current["id"] == group.ID &&
+			current["type"] == group.Type &&
+			primary == group.Primary
+	}
+	return false
+}
+
+// FindPhotoGroup returns the files of the group with the given identifier,
+// with the primary file first.
+func FindPhotoGroup(fs VFS, groupID string) ([]*FileDoc, error) {
+	var files []*FileDoc
+	req := &couchdb.FindRequest{
+		UseIndex: "by-photo-group",
+		Selector: mango.Equal("metadata.photo_group.id", groupID),
+		Limit:    maxPhotoGroupCandidates,
+	}
+	if err := couchdb.FindDocs(fs, consts.Files, req, &files); err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		pi, _ := files[i].Metadata["photo_group"].(map[string]interface{})
+		pj, _ := files[j].Metadata["photo_group"].(map[string]interface{})
+		if pi["primary"] == true && pj["primary"] != true {
+			return true
+		}
+		if pi["primary"] != true && pj["primary"] == true {
+			return false
+		}
+		return files[i].DocName < files[j].DocName
+	})
+	return files, nil
+}
@@ -0,0 +1,64 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhotoGroup(t *testing.T) {
+	t.Run("Key", func(t *testing.T) {
+		typ, key := photoGroupKey("IMG_1234.HEIC", "image/heic")
+		assert.Equal(t, LivePhotoGroup, typ)
+		assert.Equal(t, "img_1234", key)
+		typ, key = photoGroupKey("IMG_1234.MOV", "video/quicktime")
+		assert.Equal(t, LivePhotoGroup, typ)
+		assert.Equal(t, "img_1234", key)
+
+		typ, key = photoGroupKey("IMG_20230101_120000_BURST002_COVER.jpg", "image/jpeg")
+		assert.Equal(t, BurstGroup, typ)
+		assert.Equal(t, "img_20230101_120000", key)
+
+		typ, _ = photoGroupKey("notes.txt", "text/plain")
+		assert.Empty(t, typ)
+		typ, _ = photoGroupKey("movie.mp4", "video/mp4")
+		assert.Empty(t, typ)
+	})
+
+	t.Run("SelectLivePhoto", func(t *testing.T) {
+		image := &FileDoc{DocName: "IMG_1234.HEIC", Class: "image"}
+		video := &FileDoc{DocName: "IMG_1234.MOV", Class: "video"}
+		members := selectPhotoGroup(LivePhotoGroup, []*FileDoc{video, image})
+		require.Len(t, members, 2)
+		assert.Equal(t, image, members[0])
+		assert.Equal(t, video, members[1])
+
+		assert.Nil(t, selectPhotoGroup(LivePhotoGroup, []*FileDoc{image}))
+		other := &FileDoc{DocName: "img_1234.jpg", Class: "image"}
+		assert.Nil(t, selectPhotoGroup(LivePhotoGroup, []*FileDoc{image, video, other}))
+	})
+
+	t.Run("SelectBurst", func(t *testing.T) {
+		first := &FileDoc{DocName: "IMG_BURST001.jpg", Class: "image"}
+		cover := &FileDoc{DocName: "IMG_BURST002_COVER.jpg", Class: "image"}
+		last := &FileDoc{DocName: "IMG_BURST003.jpg", Class: "image"}
+		members := selectPhotoGroup(BurstGroup, []*FileDoc{last, first, cover})
+		require.Len(t, members, 3)
+		assert.Equal(t, cover, members[0])
+
+		assert.Nil(t, selectPhotoGroup(BurstGroup, []*FileDoc{first}))
+	})
+
+	t.Run("HasPhotoGroup", func(t *testing.T) {
+		group := PhotoGroup{ID: photoGroupID("dir", BurstGroup, "img"), Type: BurstGroup}
+		f := &FileDoc{Metadata: Metadata{"photo_group": map[string]interface{}{
+			"id":   group.ID,
+			"type": BurstGroup,
+		}}}
+		assert.True(t, hasPhotoGroup(f, group))
+		group.Primary = true
+		assert.False(t, hasPhotoGroup(f, group))
+		assert.False(t, hasPhotoGroup(&FileDoc{}, group))
+	})
+}
@@ -0,0 +1,428 @@
+package vfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/hashicorp/go-multierror"
+	"github.com/ncw/swift/v2"
+	"github.com/spf13/afero"
+)
+
+const (
+	// PreparedArchiveQueued is the state of an archive waiting for its job.
+	PreparedArchiveQueued = "queued"
+	// PreparedArchiveRunning is the state of an archive being built.
+	PreparedArchiveRunning = "running"
+	// PreparedArchiveReady is the state of an archive that can be downloaded.
+	PreparedArchiveReady = "ready"
+	// PreparedArchiveErrored is the state of an archive that could not be
+	// built.
+	PreparedArchiveErrored = "errored"
+	// PreparedArchiveDownloaded is the state of an archive whose download link
+	// has been used.
+	PreparedArchiveDownloaded = "downloaded"
+)
+
+// PreparedArchiveTTL is the duration after which a prepared archive is
+// removed, even if it has not been downloaded.
+const PreparedArchiveTTL = 24 * time.Hour
+
+// preparedArchiveSaveInterval is the minimal delay between two saves of the
+// progress of an archive.
+const preparedArchiveSaveInterval = 2 * time.Second
+
+var (
+	// ErrArchiveTooBig is used when the files of an archive exceed the
+	// maximal size.
+	ErrArchiveTooBig = errors.New("The files are too big for an archive")
+	// ErrArchiveNotReady is used when trying to download an archive that is
+	// still being built.
+	ErrArchiveNotReady = errors.New("The archive is not ready")
+)
+
+// PreparedArchive is a zip archive built in background by a job, and stored
+// in a temporary storage until it is downloaded. The identifier of the
+// document is a hash of the secret used in the download link, so that the
+// link can be used only by the client that has asked for the archive, and
+// only once.
+type PreparedArchive struct {
+	DocID       string    `json:"_id,omitempty"`
+	DocRev      string    `json:"_rev,omitempty"`
+	Name        string    `json:"name"`
+	IDs         []string  `json:"ids"`
+	State       string    `json:"state"`
+	Error       string    `json:"error,omitempty"`
+	Count       int       `json:"count"`
+	Total       int       `json:"total"`
+	Size        int64     `json:"size"`
+	TotalSize   int64     `json:"total_size"`
+	ArchiveSize int64     `json:"archive_size,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (p *PreparedArchive) ID() string { return p.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (p *PreparedArchive) Rev() string { return p.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (p *PreparedArchive) DocType() string { return consts.FilesPreparedArchives }
+
+// Clone is used to implement the couchdb.Doc interface
+func (p *PreparedArchive) Clone() couchdb.Doc {
+	cloned := *p
+	cloned.IDs = make([]string, len(p.IDs))
+	copy(cloned.IDs, p.IDs)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (p *PreparedArchive) SetID(id string) { p.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (p *PreparedArchive) SetRev(rev string) { p.DocRev = rev }
+
+// Included is part of the jsonapi.Object interface
+func (p *PreparedArchive) Included() []jsonapi.Object { return nil }
+
+// Relationships is part of the jsonapi.Object interface
+func (p *PreparedArchive) Relationships() jsonapi.RelationshipMap { return nil }
+
+// Links is part of the jsonapi.Object interface
+func (p *PreparedArchive) Links() *jsonapi.LinksList { return nil }
+
+func preparedArchiveID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePreparedArchive saves the document for an archive to be built in
+// background, and returns it with the secret for the download link.
+func CreatePreparedArchive(db prefixer.Prefixer, archive *Archive) (*PreparedArchive, string, error) {
+	secret := hex.EncodeToString(crypto.GenerateRandomBytes(24))
+	now := time.Now()
+	doc := &PreparedArchive{
+		DocID:     preparedArchiveID(secret),
+		Name:      archive.Name,
+		IDs:       archive.IDs,
+		State:     PreparedArchiveQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(PreparedArchiveTTL),
+	}
+	if err := couchdb.CreateNamedDocWithDB(db, doc); err != nil {
+		return nil, "", err
+	}
+	return doc, secret, nil
+}
+
+// GetPreparedArchive returns the archive for the given secret.
+func GetPreparedArchive(db prefixer.Prefixer, secret string) (*PreparedArchive, error) {
+	doc := &PreparedArchive{}
+	if err := couchdb.GetDoc(db, consts.FilesPreparedArchives, preparedArchiveID(secret), doc); err != nil {
+		return nil, err
+	}
+	if time.Now().After(doc.ExpiresAt) {
+		return nil, os.ErrNotExist
+	}
+	return doc, nil
+}
+
+// BuildPreparedArchive builds the zip archive with the files and directories
+// of the document, and writes it in the temporary storage. The progress is
+// saved regularly in the document, which sends realtime events.
+func BuildPreparedArchive(ctx context.Context, fs VFS, db prefixer.Prefixer, id string) error {
+	doc := &PreparedArchive{}
+	if err := couchdb.GetDoc(db, consts.FilesPreparedArchives, id, doc); err != nil {
+		return err
+	}
+	if doc.State != PreparedArchiveQueued {
+		return nil
+	}
+	err := doc.build(ctx, fs, db)
+	if err != nil {
+		_ = preparedArchiveStorage().remove(db, doc)
+		doc.State = PreparedArchiveErrored
+		doc.Error = err.Error()
+	} else {
+		doc.State = PreparedArchiveReady
+	}
+	doc.UpdatedAt = time.Now()
+	if uerr := couchdb.UpdateDoc(db, doc); uerr != nil && err == nil {
+		err = uerr
+	}
+	return err
+}
+
+func (p *PreparedArchive) build(ctx context.Context, fs VFS, db prefixer.Prefixer) error {
+	archive := &Archive{Name: p.Name, IDs: p.IDs}
+	count, size, err := archive.Stats(fs)
+	if err != nil {
+		return err
+	}
+	maxSize := config.GetConfig().Fs.ArchiveMaxSize
+	if maxSize > 0 && size > maxSize {
+		return ErrArchiveTooBig
+	}
+	p.State = PreparedArchiveRunning
+	p.Total = count
+	p.TotalSize = size
+	p.UpdatedAt = time.Now()
+	if err := couchdb.UpdateDoc(db, p); err != nil {
+		return err
+	}
+
+	w, err := preparedArchiveStorage().create(db, p)
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: w}
+	lastSave := time.Now()
+	err = archive.WriteZip(fs, cw, func(file *FileDoc) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.Count++
+		p.Size += file.ByteSize
+		if maxSize > 0 && cw.n > maxSize {
+			return ErrArchiveTooBig
+		}
+		if time.Since(lastSave) < preparedArchiveSaveInterval {
+			return nil
+		}
+		lastSave = time.Now()
+		p.UpdatedAt = lastSave
+		return couchdb.UpdateDoc(db, p)
+	})
+	if cerr := w.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	p.ArchiveSize = cw.n
+	return err
+}
+
+// OpenPreparedArchive opens an archive that is ready for download. The
+// archive is marked as downloaded, and the caller must remove it with
+// RemovePreparedArchive after the download.
+func OpenPreparedArchive(db prefixer.Prefixer, doc *PreparedArchive) (io.ReadCloser, error) {
+	if doc.State != PreparedArchiveReady {
+		if doc.State == PreparedArchiveDownloaded {
+			return nil, os.ErrNotExist
+		}
+		return nil, ErrArchiveNotReady
+	}
+	doc.State = PreparedArchiveDownloaded
+	doc.UpdatedAt = time.Now()
+	if err := couchdb.UpdateDoc(db, doc); err != nil {
+		// A conflict means that the link has already been used
+		if couchdb.IsConflictError(err) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return preparedArchiveStorage().open(db, doc)
+}
+
+// RemovePreparedArchive removes the archive from the temporary storage.
+func RemovePreparedArchive(db prefixer.Prefixer, doc *PreparedArchive) error {
+	return preparedArchiveStorage().remove(db, doc)
+}
+
+// CleanExpiredPreparedArchives removes the archives that have expired, and
+// their documents. The files left in the temporary storage without a document
+// (a build or a removal that has been interrupted) are also removed once they
+// are older than the TTL. It returns the number of archives removed.
+func CleanExpiredPreparedArchives(db prefixer.Prefixer) (int, error) {
+	now := time.Now()
+	storage := preparedArchiveStorage()
+	var errm error
+	if err := storage.removeOlderThan(db, now.Add(-PreparedArchiveTTL)); err != nil {
+		errm = multierror.Append(errm, err)
+	}
+
+	count := 0
+	req := &couchdb.AllDocsRequest{Limit: 1000}
+	for {
+		var docs []*PreparedArchive
+		if err := couchdb.GetAllDocs(db, consts.FilesPreparedArchives, req, &docs); err != nil {
+			if couchdb.IsNoDatabaseError(err) {
+				return count, errm
+			}
+			return count, multierror.Append(errm, err)
+		}
+		for _, doc := range docs {
+			if doc.ExpiresAt.After(now) {
+				continue
+			}
+			if err := storage.remove(db, doc); err != nil {
+				errm = multierror.Append(errm, err)
+				continue
+			}
+			if err := couchdb.DeleteDoc(db, doc); err != nil {
+				errm = multierror.Append(errm, err)
+				continue
+			}
+			count++
+		}
+		if len(docs) < req.Limit {
+			return count, errm
+		}
+		req.StartKeyDocID = docs[len(docs)-1].ID()
+		req.Skip = 1
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// archiveStorage is the temporary storage for the prepared archives. It uses
+// the same backend as the files.
+type archiveStorage interface {
+	create(db prefixer.Prefixer, doc *PreparedArchive) (io.WriteCloser, error)
+	open(db prefixer.Prefixer, doc *PreparedArchive) (io.ReadCloser, error)
+	remove(db prefixer.Prefixer, doc *PreparedArchive) error
+	// removeOlderThan removes the archives of the instance created before the
+	// given date, even if they have no document.
+	removeOlderThan(db prefixer.Prefixer, before time.Time) error
+}
+
+func preparedArchiveStorage() archiveStorage {
+	fsURL := config.FsURL()
+	switch fsURL.Scheme {
+	case config.SchemeFile, config.SchemeMem:
+		fs := afero.NewBasePathFs(afero.NewOsFs(), path.Join(fsURL.Path, "archives"))
+		return &aferoArchiveStorage{fs}
+	case config.SchemeSwift, config.SchemeSwiftSecure:
+		return &swiftArchiveStorage{c: config.GetSwiftConnection(), container: "archives"}
+	default:
+		panic(fmt.Errorf("archives: unknown storage provider %s", fsURL.Scheme))
+	}
+}
+
+type aferoArchiveStorage struct {
+	fs afero.Fs
+}
+
+func (a *aferoArchiveStorage) fileName(db prefixer.Prefixer, doc *PreparedArchive) string {
+	return path.Join(db.DBPrefix(), doc.ID()+".zip")
+}
+
+func (a *aferoArchiveStorage) create(db prefixer.Prefixer, doc *PreparedArchive) (io.WriteCloser, error) {
+	if err := a.fs.MkdirAll(path.Join("/", db.DBPrefix()), 0700); err != nil {
+		return nil, err
+	}
+	return a.fs.OpenFile(a.fileName(db, doc), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+}
+
+func (a *aferoArchiveStorage) open(db prefixer.Prefixer, doc *PreparedArchive) (io.ReadCloser, error) {
+	return a.fs.Open(a.fileName(db, doc))
+}
+
+func (a *aferoArchiveStorage) remove(db prefixer.Prefixer, doc *PreparedArchive) error {
+	err := a.fs.Remove(a.fileName(db, doc))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (a *aferoArchiveStorage) removeOlderThan(db prefixer.Prefixer, before time.Time) error {
+	dir := db.DBPrefix()
+	infos, err := afero.ReadDir(a.fs, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var errm error
+	for _, info := range infos {
+		if info.IsDir() || info.ModTime().After(before) {
+			continue
+		}
+		err := a.fs.Remove(path.Join(dir, info.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			errm = multierror.Append(errm, err)
+		}
+	}
+	return errm
+}
+
+type swiftArchiveStorage struct {
+	c         *swift.Connection
+	container string
+}
+
+func (s *swiftArchiveStorage) init(ctx context.Context) error {
+	if _, _, err := s.c.Container(ctx, s.container); errors.Is(err, swift.ContainerNotFound) {
+		if err = s.c.ContainerCreate(ctx, s.container, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *swiftArchiveStorage) objectName(db prefixer.Prefixer, doc *PreparedArchive) string {
+	return db.DBPrefix() + "/" + doc.ID()
+}
+
+func (s *swiftArchiveStorage) create(db prefixer.Prefixer, doc *PreparedArchive) (io.WriteCloser, error) {
+	ctx := context.Background()
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+	headers := swift.Headers{
+		"X-Delete-At": strconv.FormatInt(doc.ExpiresAt.Unix(), 10),
+	}
+	return s.c.ObjectCreate(ctx, s.container, s.objectName(db, doc), true, "", ZipMime, headers)
+}
+
+func (s *swiftArchiveStorage) open(db prefixer.Prefixer, doc *PreparedArchive) (io.ReadCloser, error) {
+	f, _, err := s.c.ObjectOpen(context.Background(), s.container, s.objectName(db, doc), false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *swiftArchiveStorage) remove(db prefixer.Prefixer, doc *PreparedArchive) error {
+	err := s.c.ObjectDelete(context.Background(), s.container, s.objectName(db, doc))
+	if errors.Is(err, swift.ObjectNotFound) || errors.Is(err, swift.ContainerNotFound) {
+		return nil
+	}
+	return err
+}
+
+// removeOlderThan has nothing to do for Swift, as the objects are created with
+// an X-Delete-At header.
+func (s *swiftArchiveStorage) removeOlderThan(db prefixer.Prefixer, before time.Time) error {
+	return nil
+}
+
+var _ jsonapi.Object = (*PreparedArchive)(nil)
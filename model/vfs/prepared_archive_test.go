@@ -0,0 +1,79 @@
+package vfs
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreparedArchive(t *testing.T) {
+	t.Run("ID", func(t *testing.T) {
+		id := preparedArchiveID("secret")
+		assert.Len(t, id, 64)
+		assert.NotContains(t, id, "secret")
+		assert.Equal(t, id, preparedArchiveID("secret"))
+		assert.NotEqual(t, id, preparedArchiveID("other"))
+	})
+
+	t.Run("CountingWriter", func(t *testing.T) {
+		cw := &countingWriter{w: io.Discard}
+		_, err := cw.Write([]byte("hello"))
+		require.NoError(t, err)
+		_, err = cw.Write([]byte(" world"))
+		require.NoError(t, err)
+		assert.EqualValues(t, 11, cw.n)
+	})
+
+	t.Run("AferoStorage", func(t *testing.T) {
+		storage := &aferoArchiveStorage{fs: afero.NewMemMapFs()}
+		db := prefixer.NewPrefixer(0, "alice.cozy.localhost", "alice")
+		doc := &PreparedArchive{DocID: preparedArchiveID("secret")}
+
+		w, err := storage.create(db, doc)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("zip content"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		r, err := storage.open(db, doc)
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, "zip content", string(content))
+
+		require.NoError(t, storage.remove(db, doc))
+		_, err = storage.open(db, doc)
+		assert.Error(t, err)
+		// Removing twice is not an error
+		assert.NoError(t, storage.remove(db, doc))
+	})
+
+	t.Run("AferoStorageRemoveOlderThan", func(t *testing.T) {
+		storage := &aferoArchiveStorage{fs: afero.NewMemMapFs()}
+		db := prefixer.NewPrefixer(0, "alice.cozy.localhost", "alice")
+		assert.NoError(t, storage.removeOlderThan(db, time.Now()))
+
+		old := &PreparedArchive{DocID: preparedArchiveID("old")}
+		recent := &PreparedArchive{DocID: preparedArchiveID("recent")}
+		for _, doc := range []*PreparedArchive{old, recent} {
+			w, err := storage.create(db, doc)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+		}
+		past := time.Now().Add(-2 * PreparedArchiveTTL)
+		require.NoError(t, storage.fs.Chtimes(storage.fileName(db, old), past, past))
+
+		require.NoError(t, storage.removeOlderThan(db, time.Now().Add(-PreparedArchiveTTL)))
+		_, err := storage.open(db, old)
+		assert.Error(t, err)
+		r, err := storage.open(db, recent)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+	})
+}
@@ -0,0 +1,168 @@
+package vfs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// CheckedReferenceTypes are the doctypes of the references that are checked
+// when looking for the dangling references. The other references are kept:
+// the ones to io.cozy.apps and io.cozy.konnectors are used as markers for the
+// folders of the apps, even when the app is not installed, and they are
+// needed to find those folders again on a reinstall.
+var CheckedReferenceTypes = []string{
+	consts.PhotosAlbums,
+	consts.Sharings,
+}
+
+// referencesBatchSize is the number of documents fetched in one request to
+// CouchDB.
+const referencesBatchSize = 1000
+
+// ReferencesReport is the result of the search of the dangling references:
+// the references on files to documents that no longer exist.
+type ReferencesReport struct {
+	DryRun       bool `json:"dry_run"`
+	FilesScanned int  `json:"files_scanned"`
+	FilesUpdated int  `json:"files_updated"`
+	// Checked is the number of distinct referenced documents, by doctype
+	Checked map[string]int `json:"checked"`
+	// Dangling is the number of dangling references, by doctype
+	Dangling map[string]int `json:"dangling"`
+}
+
+// CleanDanglingReferences looks for the references on the files and
+// directories to the documents that have been deleted, like the albums or
+// the sharings, and removes them. The documents are updated via the VFS, so
+// that the realtime events are sent and the hooks are called. With dryRun,
+// the references are only counted.
+func CleanDanglingReferences(fs VFS, dryRun bool) (*ReferencesReport, error) {
+	report := &ReferencesReport{
+		DryRun:   dryRun,
+		Checked:  make(map[string]int),
+		Dangling: make(map[string]int),
+	}
+	checked := make(map[string]bool, len(CheckedReferenceTypes))
+	for _, doctype := range CheckedReferenceTypes {
+		checked[doctype] = true
+	}
+
+	// 1. List the references of the files
+	refsByFile := make(map[string][]couchdb.DocReference)
+	idsByType := make(map[string]map[string]bool)
+	err := couchdb.ForeachDocs(fs, consts.Files, func(id string, raw json.RawMessage) error {
+		report.FilesScanned++
+		var doc struct {
+			ReferencedBy []couchdb.DocReference `json:"referenced_by"`
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil
+		}
+		for _, ref := range doc.ReferencedBy {
+			if !checked[ref.Type] {
+				continue
+			}
+			refsByFile[id] = append(refsByFile[id], ref)
+			if idsByType[ref.Type] == nil {
+				idsByType[ref.Type] = make(map[string]bool)
+			}
+			idsByType[ref.Type][ref.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return report, nil
+		}
+		return nil, err
+	}
+
+	// 2. Check which referenced documents still exist
+	missing := make(map[string]map[string]bool, len(idsByType))
+	for doctype, ids := range idsByType {
+		report.Checked[doctype] = len(ids)
+		missingIDs, err := missingDocs(fs, doctype, ids)
+		if err != nil {
+			return nil, err
+		}
+		missing[doctype] = missingIDs
+	}
+
+	// 3. Count and remove the dangling references
+	for id, refs := range refsByFile {
+		var dangling []couchdb.DocReference
+		for _, ref := range refs {
+			if missing[ref.Type][ref.ID] {
+				report.Dangling[ref.Type]++
+				dangling = append(dangling, ref)
+			}
+		}
+		if dryRun || len(dangling) == 0 {
+			continue
+		}
+		updated, err := removeReferences(fs, id, dangling)
+		if err != nil {
+			return nil, err
+		}
+		if updated {
+			report.FilesUpdated++
+		}
+	}
+	return report, nil
+}
+
+// removeReferences removes the given references from the file or directory.
+// It returns false if the document no longer exists.
+func removeReferences(fs VFS, id string, refs []couchdb.DocReference) (bool, error) {
+	dir, file, err := fs.DirOrFileByID(id)
+	if err != nil {
+		if couchdb.IsNotFoundError(err) || errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if dir != nil {
+		newdir := dir.Clone().(*DirDoc)
+		newdir.RemoveReferencedBy(refs...)
+		return true, fs.UpdateDirDoc(dir, newdir)
+	}
+	newfile := file.Clone().(*FileDoc)
+	newfile.RemoveReferencedBy(refs...)
+	return true, fs.UpdateFileDoc(file, newfile)
+}
+
+// missingDocs returns the identifiers of the documents that don't exist in
+// the database of the given doctype.
+func missingDocs(db prefixer.Prefixer, doctype string, ids map[string]bool) (map[string]bool, error) {
+	missing := make(map[string]bool)
+	keys := make([]string, 0, len(ids))
+	for id := range ids {
+		keys = append(keys, id)
+		missing[id] = true
+	}
+	for start := 0; start < len(keys); start += referencesBatchSize {
+		end := start + referencesBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var docs []map[string]interface{}
+		req := &couchdb.AllDocsRequest{Keys: keys[start:end]}
+		if err := couchdb.GetAllDocs(db, doctype, req, &docs); err != nil {
+			if couchdb.IsNoDatabaseError(err) {
+				return missing, nil
+			}
+			return nil, err
+		}
+		for _, doc := range docs {
+			if id, ok := doc["_id"].(string); ok {
+				delete(missing, id)
+			}
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,304 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// RestoreAuto is the default strategy for restoring a file or directory
+	// from the trash: it is put back in its original directory (which is
+	// recreated if needed), and a suffix is added to its name on conflict.
+	RestoreAuto = "auto"
+	// RestoreTo is the strategy for restoring a file or directory in another
+	// directory than its original one.
+	RestoreTo = "restore-to"
+	// RestoreRenameTo is the strategy for restoring a file or directory with
+	// a new name.
+	RestoreRenameTo = "rename-to"
+	// RestoreMerge is the strategy for restoring a directory by merging its
+	// content inside the directory that has taken its place.
+	RestoreMerge = "merge"
+)
+
+// RestoreOptions can be used to choose how a file or directory is restored
+// from the trash. The directory and name are mandatory for respectively the
+// restore-to and rename-to strategies, and can be used with the other
+// strategies to override the original directory and name.
+type RestoreOptions struct {
+	Strategy string
+	DirID    string
+	Name     string
+}
+
+// RestoreConflict is the file or directory that already exists where a file
+// or directory from the trash should be restored.
+type RestoreConflict struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// RestorePreview describes what will happen when a file or directory is
+// restored from the trash. The resolution of the conflict can be none (no
+// conflict), suffix (the name of the restored file will have a suffix), merge
+// (the content of the directories will be merged) or error (the restoration
+// will fail).
+type RestorePreview struct {
+	Strategy       string           `json:"strategy"`
+	OriginalPath   string           `json:"original_path"`
+	TargetPath     string           `json:"target_path"`
+	MissingParents []string         `json:"missing_parents,omitempty"`
+	Conflict       *RestoreConflict `json:"conflict,omitempty"`
+	Resolution     string           `json:"resolution"`
+}
+
+// restoreTarget is the place where a file or directory will be restored.
+type restoreTarget struct {
+	strategy     string
+	originalPath string
+	parentPath   string
+	parent       *DirDoc // nil if the parent directory must be created
+	name         string
+}
+
+func getRestoreTarget(fs VFS, oldpath, restorePath, docName string, isDir bool, opts *RestoreOptions) (*restoreTarget, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = RestoreAuto
+	}
+	switch strategy {
+	case RestoreAuto:
+	case RestoreTo:
+		if opts.DirID == "" {
+			return nil, ErrInvalidRestoreStrategy
+		}
+	case RestoreRenameTo:
+		if opts.Name == "" {
+			return nil, ErrInvalidRestoreStrategy
+		}
+	case RestoreMerge:
+		if !isDir {
+			return nil, ErrInvalidRestoreStrategy
+		}
+	default:
+		return nil, ErrInvalidRestoreStrategy
+	}
+
+	originalDir, err := getRestorePath(fs, oldpath, restorePath)
+	if err != nil {
+		return nil, err
+	}
+	target := &restoreTarget{
+		strategy:     strategy,
+		originalPath: path.Join(originalDir, stripConflictSuffix(docName)),
+		parentPath:   originalDir,
+		name:         stripConflictSuffix(docName),
+	}
+
+	if opts.Name != "" {
+		if err := checkFileName(opts.Name); err != nil {
+			return nil, err
+		}
+		target.name = opts.Name
+	}
+
+	if opts.DirID != "" {
+		parent, err := fs.DirByID(opts.DirID)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(parent.Fullpath, TrashDirName) {
+			return nil, ErrParentInTrash
+		}
+		target.parent = parent
+		target.parentPath = parent.Fullpath
+		return target, nil
+	}
+
+	parent, err := fs.DirByPath(target.parentPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	target.parent = parent
+	return target, nil
+}
+
+// dir returns the directory where the file or directory will be restored,
+// and creates it if it does not exist anymore.
+func (t *restoreTarget) dir(fs VFS) (*DirDoc, error) {
+	if t.parent != nil {
+		return t.parent, nil
+	}
+	return MkdirAll(fs, t.parentPath)
+}
+
+// try calls the given function with the name of the restored file or
+// directory. With the auto strategy, a suffix is added to the name on
+// conflict, and for the other strategies, the os.ErrExist error is returned.
+func (t *restoreTarget) try(do func(name string) error) error {
+	if t.strategy == RestoreAuto {
+		return tryOrUseSuffix(t.name, conflictFormat, do)
+	}
+	return do(t.name)
+}
+
+func (t *restoreTarget) preview(fs VFS) (*RestorePreview, error) {
+	preview := &RestorePreview{
+		Strategy:     t.strategy,
+		OriginalPath: t.originalPath,
+		TargetPath:   path.Join(t.parentPath, t.name),
+		Resolution:   "none",
+	}
+
+	if t.parent == nil {
+		missing, err := missingParents(fs, t.parentPath)
+		if err != nil {
+			return nil, err
+		}
+		preview.MissingParents = missing
+		return preview, nil
+	}
+
+	d, f, err := fs.DirOrFileByPath(preview.TargetPath)
+	if os.IsNotExist(err) {
+		return preview, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d != nil {
+		preview.Conflict = &RestoreConflict{ID: d.ID(), Type: d.Type}
+	} else {
+		preview.Conflict = &RestoreConflict{ID: f.ID(), Type: f.Type}
+	}
+	switch {
+	case t.strategy == RestoreAuto:
+		preview.Resolution = "suffix"
+	case t.strategy == RestoreMerge && d != nil:
+		preview.Resolution = "merge"
+	default:
+		preview.Resolution = "error"
+	}
+	return preview, nil
+}
+
+// missingParents returns the directories that will be created to restore a
+// file or directory inside the given directory, from the top to the bottom.
+func missingParents(fs VFS, dirpath string) ([]string, error) {
+	var missing []string
+	for dirpath != "/" && dirpath != "." {
+		_, err := fs.DirByPath(dirpath)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		missing = append([]string{dirpath}, missing...)
+		dirpath = path.Dir(dirpath)
+	}
+	return missing, nil
+}
+
+// PreviewRestoreDir returns what will happen when the trashed directory is
+// restored with the given options, without making any change.
+func PreviewRestoreDir(fs VFS, doc *DirDoc, opts *RestoreOptions) (*RestorePreview, error) {
+	oldpath, err := doc.Path(fs)
+	if err != nil {
+		return nil, err
+	}
+	target, err := getRestoreTarget(fs, oldpath, doc.RestorePath, doc.DocName, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	return target.preview(fs)
+}
+
+// PreviewRestoreFile returns what will happen when the trashed file is
+// restored with the given options, without making any change.
+func PreviewRestoreFile(fs VFS, doc *FileDoc, opts *RestoreOptions) (*RestorePreview, error) {
+	oldpath, err := doc.Path(fs)
+	if err != nil {
+		return nil, err
+	}
+	target, err := getRestoreTarget(fs, oldpath, doc.RestorePath, doc.DocName, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	return target.preview(fs)
+}
+
+// mergeDir moves the content of the src directory inside the dst directory,
+// and then removes the src directory. The sub-directories with the same name
+// are merged too, and a suffix is added to the name of the files on conflict.
+func mergeDir(fs VFS, src, dst *DirDoc) error {
+	var dirs []*DirDoc
+	var files []*FileDoc
+	iter := fs.DirIterator(src, nil)
+	for {
+		d, f, err := iter.Next()
+		if errors.Is(err, ErrIteratorDone) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if d != nil {
+			dirs = append(dirs, d)
+		} else {
+			files = append(files, f)
+		}
+	}
+
+	for _, olddoc := range dirs {
+		existing, err := fs.DirByPath(path.Join(dst.Fullpath, olddoc.DocName))
+		if err == nil {
+			if err = mergeDir(fs, olddoc, existing); err != nil {
+				return err
+			}
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		err = tryOrUseSuffix(olddoc.DocName, conflictFormat, func(name string) error {
+			newdoc := olddoc.Clone().(*DirDoc)
+			newdoc.DirID = dst.DocID
+			newdoc.RestorePath = ""
+			newdoc.DocName = name
+			newdoc.Fullpath = path.Join(dst.Fullpath, name)
+			newdoc.CozyMetadata = olddoc.CozyMetadata
+			return fs.UpdateDirDoc(olddoc, newdoc)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, olddoc := range files {
+		err := tryOrUseSuffix(olddoc.DocName, conflictFormat, func(name string) error {
+			newdoc := olddoc.Clone().(*FileDoc)
+			newdoc.DirID = dst.DocID
+			newdoc.RestorePath = ""
+			newdoc.DocName = name
+			newdoc.Trashed = false
+			newdoc.fullpath = path.Join(dst.Fullpath, name)
+			newdoc.CozyMetadata = olddoc.CozyMetadata
+			return fs.UpdateFileDoc(olddoc, newdoc)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The directory is now empty, so there are no files to push to the trash
+	// worker.
+	return fs.DestroyDirAndContent(src, func(TrashJournal) error {
+		return ErrDirNotEmpty
+	})
+}
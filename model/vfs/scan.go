@@ -0,0 +1,83 @@
+package vfs
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// ScanStatusPending is the status of a file that is being analyzed.
+	ScanStatusPending = "pending"
+	// ScanStatusClean is the status of a file where nothing has been found.
+	ScanStatusClean = "clean"
+	// ScanStatusQuarantined is the status of a file that has been flagged:
+	// its content can no longer be downloaded, except by an administrator.
+	ScanStatusQuarantined = "quarantined"
+)
+
+var (
+	// ErrFileQuarantined is used when the content of a quarantined file is
+	// requested.
+	ErrFileQuarantined = errors.New("The file has been quarantined")
+	// ErrInvalidScanStatus is used when the status of a scan is not one of
+	// pending, clean and quarantined.
+	ErrInvalidScanStatus = errors.New("Invalid scan status")
+)
+
+// ScanStatus is the status given to a file by a scanning or policy
+// subsystem, like an antivirus. The files that have never been analyzed have
+// no status. As the status is for the content, it is not kept when a new
+// content is uploaded for the file.
+type ScanStatus struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Scanner   string    `json:"scanner,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Quarantined returns true if the file has been flagged by a scanning or
+// policy subsystem.
+func (f *FileDoc) Quarantined() bool {
+	return f.Scan != nil && f.Scan.Status == ScanStatusQuarantined
+}
+
+// CheckNotQuarantined returns ErrFileQuarantined if the file has been
+// quarantined. It is called by the VFS implementations before opening the
+// content of a file, so that it can't be read by any feature (previews,
+// sharings, thumbnails, exports, etc.).
+func CheckNotQuarantined(doc *FileDoc) error {
+	if doc.Quarantined() {
+		return ErrFileQuarantined
+	}
+	return nil
+}
+
+// OpenQuarantinedFile opens the content of a file, even if it has been
+// quarantined. It must only be used for the copies kept by the operators,
+// like the escrow exports.
+func OpenQuarantinedFile(fs VFS, doc *FileDoc) (File, error) {
+	unchecked := doc.Clone().(*FileDoc)
+	unchecked.Scan = nil
+	return fs.OpenFile(unchecked)
+}
+
+// SetScanStatus saves the status given to a file by a scanning or policy
+// subsystem.
+func SetScanStatus(fs VFS, doc *FileDoc, status, reason, scanner string) (*FileDoc, error) {
+	switch status {
+	case ScanStatusPending, ScanStatusClean, ScanStatusQuarantined:
+	default:
+		return nil, ErrInvalidScanStatus
+	}
+	newdoc := doc.Clone().(*FileDoc)
+	newdoc.Scan = &ScanStatus{
+		Status:    status,
+		Reason:    reason,
+		Scanner:   scanner,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := fs.UpdateFileDoc(doc, newdoc); err != nil {
+		return nil, err
+	}
+	return newdoc, nil
+}
@@ -0,0 +1,631 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// SnapshotQueued is the state of a snapshot waiting for its job.
+	SnapshotQueued = "queued"
+	// SnapshotReady is the state of a snapshot whose entries have all been
+	// saved, and that can be restored.
+	SnapshotReady = "ready"
+	// SnapshotErrored is the state of a snapshot that could not be taken.
+	SnapshotErrored = "errored"
+	// SnapshotRestoreDone is the state of a restoration that has finished.
+	SnapshotRestoreDone = "done"
+)
+
+// snapshotBatchSize is the maximal number of entries saved in a single bulk
+// request to CouchDB.
+const snapshotBatchSize = 500
+
+var (
+	// ErrSnapshotNameMissing is used when trying to create a snapshot without
+	// a name.
+	ErrSnapshotNameMissing = errors.New("The name of the snapshot is missing")
+	// ErrSnapshotNotReady is used when trying to restore a snapshot that is
+	// still being taken, or that has failed.
+	ErrSnapshotNotReady = errors.New("The snapshot is not ready")
+)
+
+// Snapshot is a restore point for a file tree. It only keeps the metadata of
+// the files and directories (in SnapshotEntry documents), and a reference to
+// the version of the content of each file. The content itself is not copied:
+// the objects are immutable and the versions referenced by a snapshot are not
+// cleaned.
+type Snapshot struct {
+	DocID     string    `json:"_id,omitempty"`
+	DocRev    string    `json:"_rev,omitempty"`
+	Name      string    `json:"name"`
+	DirID     string    `json:"dir_id"`
+	Path      string    `json:"path"`
+	State     string    `json:"state,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Count     int       `json:"count"`
+	ByteSize  int64     `json:"size,string"`
+
+	// LastRestore is the state of the last restoration from this snapshot,
+	// that is made in background by a job.
+	LastRestore *SnapshotRestoreResult `json:"last_restore,omitempty"`
+}
+
+// IsReady returns true if the entries of the snapshot have all been saved.
+// The snapshots taken before the job was introduced have no state and are
+// ready.
+func (s *Snapshot) IsReady() bool {
+	return s.State == "" || s.State == SnapshotReady
+}
+
+// ID returns the snapshot identifier
+func (s *Snapshot) ID() string { return s.DocID }
+
+// Rev returns the snapshot revision
+func (s *Snapshot) Rev() string { return s.DocRev }
+
+// DocType returns the snapshot document type
+func (s *Snapshot) DocType() string { return consts.FilesSnapshots }
+
+// Clone implements couchdb.Doc
+func (s *Snapshot) Clone() couchdb.Doc {
+	cloned := *s
+	if s.LastRestore != nil {
+		restore := *s.LastRestore
+		restore.Failed = make([]string, len(s.LastRestore.Failed))
+		copy(restore.Failed, s.LastRestore.Failed)
+		cloned.LastRestore = &restore
+	}
+	return &cloned
+}
+
+// SetID changes the snapshot identifier
+func (s *Snapshot) SetID(id string) { s.DocID = id }
+
+// SetRev changes the snapshot revision
+func (s *Snapshot) SetRev(rev string) { s.DocRev = rev }
+
+// Included is part of jsonapi.Object interface
+func (s *Snapshot) Included() []jsonapi.Object { return nil }
+
+// Relationships is part of jsonapi.Object interface
+func (s *Snapshot) Relationships() jsonapi.RelationshipMap { return nil }
+
+// Links is part of jsonapi.Object interface
+func (s *Snapshot) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/files/snapshots/" + s.DocID}
+}
+
+// SnapshotEntry is the state of a file or directory when a snapshot has been
+// taken. Its identifier is the snapshot identifier and the file identifier,
+// separated by a slash, so that the entries of a snapshot can be listed
+// without an index.
+type SnapshotEntry struct {
+	DocID      string    `json:"_id,omitempty"`
+	DocRev     string    `json:"_rev,omitempty"`
+	SnapshotID string    `json:"snapshot_id"`
+	Type       string    `json:"type"`
+	FileID     string    `json:"file_id"`
+	DirID      string    `json:"dir_id"`
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Tags       []string  `json:"tags,omitempty"`
+	VersionID  string    `json:"version_id,omitempty"`
+	ByteSize   int64     `json:"size,string,omitempty"`
+	MD5Sum     []byte    `json:"md5sum,omitempty"`
+	Mime       string    `json:"mime,omitempty"`
+	Class      string    `json:"class,omitempty"`
+	Executable bool      `json:"executable,omitempty"`
+}
+
+// ID returns the entry identifier
+func (e *SnapshotEntry) ID() string { return e.DocID }
+
+// Rev returns the entry revision
+func (e *SnapshotEntry) Rev() string { return e.DocRev }
+
+// DocType returns the entry document type
+func (e *SnapshotEntry) DocType() string { return consts.FilesSnapshotEntries }
+
+// Clone implements couchdb.Doc
+func (e *SnapshotEntry) Clone() couchdb.Doc {
+	cloned := *e
+	cloned.Tags = make([]string, len(e.Tags))
+	copy(cloned.Tags, e.Tags)
+	cloned.MD5Sum = make([]byte, len(e.MD5Sum))
+	copy(cloned.MD5Sum, e.MD5Sum)
+	return &cloned
+}
+
+// SetID changes the entry identifier
+func (e *SnapshotEntry) SetID(id string) { e.DocID = id }
+
+// SetRev changes the entry revision
+func (e *SnapshotEntry) SetRev(rev string) { e.DocRev = rev }
+
+// SnapshotRestoreResult gives the number of files and directories that have
+// been restored from a snapshot, and the paths of those that could not be.
+type SnapshotRestoreResult struct {
+	State      string     `json:"state,omitempty"`
+	Path       string     `json:"path,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Restored   int        `json:"restored"`
+	Failed     []string   `json:"failed,omitempty"`
+}
+
+// CreateSnapshot saves the document for a snapshot of the given directory.
+// The entries are saved later by a job, with BuildSnapshot.
+func CreateSnapshot(db prefixer.Prefixer, name string, dir *DirDoc) (*Snapshot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrSnapshotNameMissing
+	}
+	snap := &Snapshot{
+		Name:      name,
+		DirID:     dir.DocID,
+		Path:      dir.Fullpath,
+		State:     SnapshotQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := couchdb.CreateDoc(db, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// BuildSnapshot walks the directory of a queued snapshot and everything
+// inside it (except the trash), and saves the entries in batches. If it
+// fails, the entries already saved are removed and the snapshot is marked as
+// errored.
+func BuildSnapshot(ctx context.Context, fs VFS, id string) error {
+	snap, err := GetSnapshot(fs, id)
+	if err != nil {
+		return err
+	}
+	if snap.State != SnapshotQueued {
+		return nil
+	}
+	err = snap.build(ctx, fs)
+	if err != nil {
+		_ = deleteSnapshotEntries(fs, snap)
+		snap.State = SnapshotErrored
+		snap.Error = err.Error()
+		snap.Count = 0
+		snap.ByteSize = 0
+	} else {
+		snap.State = SnapshotReady
+	}
+	if uerr := couchdb.UpdateDoc(fs, snap); uerr != nil && err == nil {
+		err = uerr
+	}
+	return err
+}
+
+func (s *Snapshot) build(ctx context.Context, fs VFS) error {
+	dir, err := fs.DirByID(s.DirID)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]interface{}, 0, snapshotBatchSize)
+	flush := func() error {
+		if len(entries) == 0 {
+			return nil
+		}
+		olds := make([]interface{}, len(entries))
+		if err := couchdb.BulkUpdateDocs(fs, consts.FilesSnapshotEntries, entries, olds); err != nil {
+			return err
+		}
+		s.Count += len(entries)
+		entries = entries[:0]
+		return nil
+	}
+
+	err = Walk(fs, dir.Fullpath, func(fullpath string, d *DirDoc, f *FileDoc, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d != nil {
+			if d.DocID == consts.TrashDirID {
+				return ErrSkipDir
+			}
+			entries = append(entries, &SnapshotEntry{
+				DocID:      s.DocID + "/" + d.DocID,
+				SnapshotID: s.DocID,
+				Type:       consts.DirType,
+				FileID:     d.DocID,
+				DirID:      d.DirID,
+				Name:       d.DocName,
+				Path:       fullpath,
+				UpdatedAt:  d.UpdatedAt,
+				Tags:       d.Tags,
+			})
+		} else {
+			entries = append(entries, &SnapshotEntry{
+				DocID:      s.DocID + "/" + f.DocID,
+				SnapshotID: s.DocID,
+				Type:       consts.FileType,
+				FileID:     f.DocID,
+				DirID:      f.DirID,
+				Name:       f.DocName,
+				Path:       fullpath,
+				UpdatedAt:  f.UpdatedAt,
+				Tags:       f.Tags,
+				VersionID:  NewVersion(f).DocID,
+				ByteSize:   f.ByteSize,
+				MD5Sum:     f.MD5Sum,
+				Mime:       f.Mime,
+				Class:      f.Class,
+				Executable: f.Executable,
+			})
+			s.ByteSize += f.ByteSize
+		}
+		if len(entries) >= snapshotBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// ListSnapshots returns the list of the snapshots, sorted by creation date.
+func ListSnapshots(db prefixer.Prefixer) ([]*Snapshot, error) {
+	var snaps []*Snapshot
+	err := couchdb.GetAllDocs(db, consts.FilesSnapshots, nil, &snaps)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].CreatedAt.Before(snaps[j].CreatedAt)
+	})
+	return snaps, nil
+}
+
+// GetSnapshot returns the snapshot with the given identifier.
+func GetSnapshot(db prefixer.Prefixer, id string) (*Snapshot, error) {
+	snap := &Snapshot{}
+	if err := couchdb.GetDoc(db, consts.FilesSnapshots, id, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// SnapshotEntries returns the entries of a snapshot.
+func SnapshotEntries(db prefixer.Prefixer, snap *Snapshot) ([]*SnapshotEntry, error) {
+	var entries []*SnapshotEntry
+	req := &couchdb.AllDocsRequest{
+		StartKey: snap.DocID + "/",
+		EndKey:   snap.DocID + "0", // 0 is the next character after / in ascii
+	}
+	err := couchdb.GetAllDocs(db, consts.FilesSnapshotEntries, req, &entries)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteSnapshot deletes a snapshot and its entries. The old versions that
+// were only kept for this snapshot can then be cleaned.
+func DeleteSnapshot(db prefixer.Prefixer, snap *Snapshot) error {
+	if err := deleteSnapshotEntries(db, snap); err != nil {
+		return err
+	}
+	return couchdb.DeleteDoc(db, snap)
+}
+
+func deleteSnapshotEntries(db prefixer.Prefixer, snap *Snapshot) error {
+	entries, err := SnapshotEntries(db, snap)
+	if err != nil {
+		return err
+	}
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > snapshotBatchSize {
+			n = snapshotBatchSize
+		}
+		docs := make([]couchdb.Doc, n)
+		for i, entry := range entries[:n] {
+			docs[i] = entry
+		}
+		if err := couchdb.BulkDeleteDocs(db, consts.FilesSnapshotEntries, docs); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+// snapshotVersionsFor returns the identifiers of the versions of the given
+// file that are referenced by a snapshot.
+func snapshotVersionsFor(db prefixer.Prefixer, fileID string) (map[string]bool, error) {
+	snaps, err := ListSnapshots(db)
+	if err != nil || len(snaps) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(snaps))
+	for i, snap := range snaps {
+		keys[i] = snap.DocID + "/" + fileID
+	}
+	var entries []*SnapshotEntry
+	req := &couchdb.AllDocsRequest{Keys: keys}
+	err = couchdb.GetAllDocs(db, consts.FilesSnapshotEntries, req, &entries)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, entry := range entries {
+		if entry != nil && entry.VersionID != "" {
+			referenced[entry.VersionID] = true
+		}
+	}
+	return referenced, nil
+}
+
+// allSnapshotVersions returns the identifiers of all the versions referenced
+// by a snapshot.
+func allSnapshotVersions(db prefixer.Prefixer) (map[string]bool, error) {
+	var entries []*SnapshotEntry
+	err := couchdb.GetAllDocs(db, consts.FilesSnapshotEntries, nil, &entries)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.VersionID != "" {
+			referenced[entry.VersionID] = true
+		}
+	}
+	return referenced, nil
+}
+
+// keepSnapshotVersions ensures that the versions referenced by a snapshot are
+// not cleaned.
+func keepSnapshotVersions(action ActionForCandidateVersion, candidate *Version, toClean []*Version, referenced map[string]bool) (ActionForCandidateVersion, []*Version) {
+	if len(referenced) == 0 {
+		return action, toClean
+	}
+	if action == CleanCandidateVersion && candidate != nil && referenced[candidate.DocID] {
+		action = KeepCandidateVersion
+	}
+	kept := toClean[:0]
+	for _, v := range toClean {
+		if !referenced[v.DocID] {
+			kept = append(kept, v)
+		}
+	}
+	return action, kept
+}
+
+// QueueSnapshotRestore marks the snapshot as being restored, before a job is
+// pushed for the restoration. fullpath is the optional path of the file or
+// directory to restore.
+func QueueSnapshotRestore(db prefixer.Prefixer, snap *Snapshot, fullpath string) error {
+	if !snap.IsReady() {
+		return ErrSnapshotNotReady
+	}
+	snap.LastRestore = &SnapshotRestoreResult{
+		State:    SnapshotQueued,
+		Path:     fullpath,
+		QueuedAt: time.Now().UTC(),
+	}
+	return couchdb.UpdateDoc(db, snap)
+}
+
+// RunSnapshotRestore restores the files and directories of a snapshot, and
+// saves the result of the restoration in the snapshot document.
+func RunSnapshotRestore(fs VFS, id, fullpath string) error {
+	snap, err := GetSnapshot(fs, id)
+	if err != nil {
+		return err
+	}
+	res, err := RestoreSnapshot(fs, snap, fullpath)
+	if err != nil {
+		res = &SnapshotRestoreResult{State: SnapshotErrored, Error: err.Error()}
+	} else {
+		res.State = SnapshotRestoreDone
+	}
+	res.Path = fullpath
+	if snap.LastRestore != nil {
+		res.QueuedAt = snap.LastRestore.QueuedAt
+	}
+	finishedAt := time.Now().UTC()
+	res.FinishedAt = &finishedAt
+	snap.LastRestore = res
+	if uerr := couchdb.UpdateDoc(fs, snap); uerr != nil && err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// RestoreSnapshot restores the files and directories of a snapshot. If
+// fullpath is not empty, only the file or directory with this path (as it was
+// when the snapshot was taken) and its content are restored.
+func RestoreSnapshot(fs VFS, snap *Snapshot, fullpath string) (*SnapshotRestoreResult, error) {
+	if !snap.IsReady() {
+		return nil, ErrSnapshotNotReady
+	}
+	entries, err := SnapshotEntries(fs, snap)
+	if err != nil {
+		return nil, err
+	}
+	if fullpath != "" {
+		fullpath = path.Clean(fullpath)
+		selected := entries[:0]
+		for _, entry := range entries {
+			if entry.Path == fullpath || strings.HasPrefix(entry.Path, fullpath+"/") {
+				selected = append(selected, entry)
+			}
+		}
+		entries = selected
+		if len(entries) == 0 {
+			return nil, os.ErrNotExist
+		}
+	}
+
+	// The directories are restored before the files, and the parents before
+	// their children.
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type == consts.DirType
+		}
+		return strings.Count(entries[i].Path, "/") < strings.Count(entries[j].Path, "/")
+	})
+
+	r := &snapshotRestorer{fs: fs, dirIDs: make(map[string]string)}
+	res := &SnapshotRestoreResult{}
+	for _, entry := range entries {
+		if entry.Type == consts.DirType {
+			err = r.restoreDir(entry)
+		} else {
+			err = r.restoreFile(entry)
+		}
+		if err != nil {
+			res.Failed = append(res.Failed, entry.Path)
+		} else {
+			res.Restored++
+		}
+	}
+	return res, nil
+}
+
+type snapshotRestorer struct {
+	fs VFS
+	// dirIDs maps the identifiers of the directories in the snapshot to the
+	// identifiers of the directories that were recreated for them.
+	dirIDs map[string]string
+}
+
+func (r *snapshotRestorer) parentID(entry *SnapshotEntry) string {
+	if id, ok := r.dirIDs[entry.DirID]; ok {
+		return id
+	}
+	return entry.DirID
+}
+
+func (r *snapshotRestorer) restoreDir(entry *SnapshotEntry) error {
+	if entry.FileID == consts.RootDirID {
+		return nil
+	}
+	dir, err := r.fs.DirByID(entry.FileID)
+	if err != nil && !couchdb.IsNotFoundError(err) && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	parent, err := r.fs.DirByID(r.parentID(entry))
+	if err != nil {
+		return err
+	}
+
+	if dir == nil {
+		if existing, err := r.fs.DirByPath(path.Join(parent.Fullpath, entry.Name)); err == nil {
+			r.dirIDs[entry.FileID] = existing.DocID
+			return nil
+		}
+		dir, err = NewDirDocWithParent(entry.Name, parent, entry.Tags)
+		if err != nil {
+			return err
+		}
+		if err = r.fs.CreateDir(dir); err != nil {
+			return err
+		}
+		r.dirIDs[entry.FileID] = dir.DocID
+		return nil
+	}
+
+	if strings.HasPrefix(dir.Fullpath, TrashDirName+"/") {
+		if dir, err = RestoreDir(r.fs, dir, nil); err != nil {
+			return err
+		}
+	}
+	if dir.DirID == parent.DocID && dir.DocName == entry.Name {
+		return nil
+	}
+	name := entry.Name
+	if exists, _ := r.fs.GetIndexer().DirChildExists(parent.DocID, name); exists {
+		name = ConflictName(r.fs, parent.DocID, name, false)
+	}
+	_, err = ModifyDirMetadata(r.fs, dir, &DocPatch{Name: &name, DirID: &parent.DocID})
+	return err
+}
+
+func (r *snapshotRestorer) restoreFile(entry *SnapshotEntry) error {
+	file, err := r.fs.FileByID(entry.FileID)
+	if err != nil {
+		return err
+	}
+	if file.Trashed {
+		if file, err = RestoreFile(r.fs, file, nil); err != nil {
+			return err
+		}
+	}
+
+	if !bytes.Equal(file.MD5Sum, entry.MD5Sum) {
+		version, err := r.findVersion(entry)
+		if err != nil {
+			return err
+		}
+		if err = r.fs.RevertFileVersion(file, version); err != nil {
+			return err
+		}
+		if file, err = r.fs.FileByID(entry.FileID); err != nil {
+			return err
+		}
+	}
+
+	parentID := r.parentID(entry)
+	if file.DirID == parentID && file.DocName == entry.Name {
+		return nil
+	}
+	name := entry.Name
+	if exists, _ := r.fs.GetIndexer().DirChildExists(parentID, name); exists {
+		name = ConflictName(r.fs, parentID, name, true)
+	}
+	_, err = ModifyFileMetadata(r.fs, file, &DocPatch{Name: &name, DirID: &parentID})
+	return err
+}
+
+// findVersion returns the version with the content of the file when the
+// snapshot was taken. If the version referenced by the entry is not found (it
+// can happen when the file was overwritten with the same content), another
+// version with the same checksum is used.
+func (r *snapshotRestorer) findVersion(entry *SnapshotEntry) (*Version, error) {
+	version, err := FindVersion(r.fs, entry.VersionID)
+	if err == nil {
+		return version, nil
+	}
+	if !couchdb.IsNotFoundError(err) {
+		return nil, err
+	}
+	versions, err := VersionsFor(r.fs, entry.FileID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if bytes.Equal(v.MD5Sum, entry.MD5Sum) {
+			return v, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+var _ jsonapi.Object = &Snapshot{}
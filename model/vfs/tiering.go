@@ -0,0 +1,206 @@
+package vfs
+
+import (
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/hashicorp/go-multierror"
+	"github.com/justincampbell/bigduration"
+)
+
+// maxTrashedToMove is the maximal number of items of the trash that are
+// looked at by an execution of the tiering.
+const maxTrashedToMove = 1000
+
+// Tierer is implemented by the VFS that can move the contents of the files to
+// a cheaper storage. The contents in the cold storage can still be read, but
+// the retrieval can be slower.
+type Tierer interface {
+	// MoveFileToCold moves the content of a file to the cold storage.
+	MoveFileToCold(doc *FileDoc) error
+	// MoveVersionToCold moves the content of an old version to the cold
+	// storage.
+	MoveVersionToCold(version *Version) error
+	// MoveFileToHot moves back the content of a file from the cold storage.
+	MoveFileToHot(doc *FileDoc) error
+}
+
+// TieringPolicy is the set of rules used to know which contents are moved to
+// the cold storage.
+type TieringPolicy struct {
+	// VersionsAfter is the age after which an old version is moved to the
+	// cold storage (0 means never).
+	VersionsAfter time.Duration
+	// TrashAfter is the duration after which a file in the trash is moved to
+	// the cold storage (0 means never).
+	TrashAfter time.Duration
+}
+
+// Enabled returns true if some contents can be moved to the cold storage.
+func (p TieringPolicy) Enabled() bool {
+	return p.VersionsAfter > 0 || p.TrashAfter > 0
+}
+
+// ContextTieringPolicy returns the tiering policy for the given context, from
+// the config file.
+func ContextTieringPolicy(contextName string) TieringPolicy {
+	cfg := config.GetConfig().Fs
+	versionsAfter := cfg.Tiering.VersionsAfter
+	trashAfter := cfg.Tiering.TrashAfter
+
+	context, _ := cfg.Contexts[contextName].(map[string]interface{})
+	if after, ok := context["tiering_versions_after"].(string); ok {
+		versionsAfter = after
+	}
+	if after, ok := context["tiering_trash_after"].(string); ok {
+		trashAfter = after
+	}
+
+	return TieringPolicy{
+		VersionsAfter: parseTieringDelay("versions_after", versionsAfter),
+		TrashAfter:    parseTieringDelay("trash_after", trashAfter),
+	}
+}
+
+func parseTieringDelay(name, after string) time.Duration {
+	if after == "" {
+		return 0
+	}
+	delay, err := bigduration.ParseDuration(after)
+	if err != nil {
+		logger.WithNamespace("vfs").
+			Errorf("Invalid config for tiering %s: %s", name, err)
+		return 0
+	}
+	return delay
+}
+
+// ApplyTieringPolicy moves to the cold storage the old versions and the files
+// in the trash that are older than the thresholds of the given policy. It
+// returns the number of bytes that have been moved.
+func ApplyTieringPolicy(fs VFS, policy TieringPolicy) (int64, error) {
+	tierer, ok := fs.(Tierer)
+	if !ok {
+		return 0, nil
+	}
+	now := time.Now()
+
+	var moved int64
+	var errm error
+	if policy.VersionsAfter > 0 {
+		versions, err := fs.AllVersions()
+		if err != nil {
+			return 0, err
+		}
+		for _, v := range selectVersionsToMove(versions, now.Add(-policy.VersionsAfter)) {
+			if err := tierer.MoveVersionToCold(v); err != nil {
+				errm = multierror.Append(errm, err)
+				continue
+			}
+			moved += v.ByteSize
+		}
+	}
+
+	if policy.TrashAfter > 0 {
+		files, err := findTrashedFilesToMove(fs, now.Add(-policy.TrashAfter))
+		if err != nil {
+			return moved, multierror.Append(errm, err)
+		}
+		for _, f := range files {
+			if err := tierer.MoveFileToCold(f); err != nil {
+				errm = multierror.Append(errm, err)
+				continue
+			}
+			moved += f.ByteSize
+		}
+	}
+	return moved, errm
+}
+
+// selectVersionsToMove returns the versions that are not yet in the cold
+// storage, and that have been created before the given time.
+func selectVersionsToMove(versions []*Version, before time.Time) []*Version {
+	var selected []*Version
+	for _, v := range versions {
+		if !v.Cold && v.CozyMetadata.CreatedAt.Before(before) {
+			selected = append(selected, v)
+		}
+	}
+	return selected
+}
+
+// findTrashedFilesToMove returns the files in the trash that are not yet in
+// the cold storage, and that have been put in the trash before the given time.
+// The files inside the trashed directories are included.
+func findTrashedFilesToMove(fs VFS, before time.Time) ([]*FileDoc, error) {
+	var list []*DirOrFileDoc
+	req := &couchdb.FindRequest{
+		UseIndex: "by-dir-id-updated-at",
+		Selector: mango.And(
+			mango.Equal("dir_id", consts.TrashDirID),
+			mango.Lt("updated_at", before),
+		),
+		Limit: maxTrashedToMove,
+	}
+	if _, err := couchdb.FindDocsRaw(fs, consts.Files, req, &list); err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var files []*FileDoc
+	for _, item := range list {
+		d, f := item.Refine()
+		if f != nil {
+			if !f.Cold {
+				files = append(files, f)
+			}
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		err := walk(fs, d.Fullpath, d, nil, func(_ string, _ *DirDoc, file *FileDoc, err error) error {
+			if file != nil && !file.Cold {
+				files = append(files, file)
+			}
+			return err
+		}, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// RetrieveFromColdStorage moves back the content of a file, or of the files
+// inside a directory, from the cold storage. It is used when a file has been
+// restored from the trash, or when a version in the cold storage has been
+// restored. The files still in the trash are ignored.
+func RetrieveFromColdStorage(fs VFS, fileID string) error {
+	tierer, ok := fs.(Tierer)
+	if !ok {
+		return nil
+	}
+	var errm error
+	err := WalkByID(fs, fileID, func(_ string, _ *DirDoc, file *FileDoc, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != nil && file.Cold && !file.Trashed {
+			if errh := tierer.MoveFileToHot(file); errh != nil {
+				errm = multierror.Append(errm, errh)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return multierror.Append(errm, err)
+	}
+	return errm
+}
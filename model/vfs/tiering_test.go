@@ -0,0 +1,63 @@
+package vfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTiering(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("ContextTieringPolicy", func(t *testing.T) {
+		cfg := config.GetConfig()
+		cfg.Fs.Tiering = config.FsTiering{VersionsAfter: "6M", TrashAfter: "30D"}
+		cfg.Fs.Contexts = map[string]interface{}{
+			"beta": map[string]interface{}{
+				"tiering_trash_after": "7D",
+			},
+			"alpha": map[string]interface{}{
+				"tiering_versions_after": "",
+			},
+		}
+
+		policy := ContextTieringPolicy("default")
+		assert.True(t, policy.Enabled())
+		assert.Equal(t, 30*24*time.Hour, policy.TrashAfter)
+		assert.Greater(t, policy.VersionsAfter, 150*24*time.Hour)
+
+		policy = ContextTieringPolicy("beta")
+		assert.Equal(t, 7*24*time.Hour, policy.TrashAfter)
+		assert.Greater(t, policy.VersionsAfter, 150*24*time.Hour)
+
+		policy = ContextTieringPolicy("alpha")
+		assert.Equal(t, time.Duration(0), policy.VersionsAfter)
+		assert.True(t, policy.Enabled())
+
+		cfg.Fs.Tiering = config.FsTiering{TrashAfter: "invalid"}
+		policy = ContextTieringPolicy("default")
+		assert.False(t, policy.Enabled())
+	})
+
+	t.Run("SelectVersionsToMove", func(t *testing.T) {
+		now := time.Now()
+		genVersion := func(timeAgo time.Duration, cold bool) *Version {
+			v := &Version{DocID: uuidv4() + "/" + utils.RandomString(16), Cold: cold}
+			v.CozyMetadata.CreatedAt = now.Add(-1 * timeAgo)
+			return v
+		}
+		v0 := genVersion(96*time.Hour, false)
+		v1 := genVersion(72*time.Hour, true)
+		v2 := genVersion(48*time.Hour, false)
+		v3 := genVersion(1*time.Hour, false)
+
+		selected := selectVersionsToMove([]*Version{v0, v1, v2, v3}, now.Add(-24*time.Hour))
+		assert.Equal(t, []*Version{v0, v2}, selected)
+
+		selected = selectVersionsToMove([]*Version{v1, v3}, now.Add(-24*time.Hour))
+		assert.Empty(t, selected)
+	})
+}
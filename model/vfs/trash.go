@@ -6,4 +6,7 @@ package vfs
 type TrashJournal struct {
 	FileIDs     []string `json:"ids"`
 	ObjectNames []string `json:"objects"`
+	// ColdObjectNames are the objects of the files that were in the cold
+	// storage.
+	ColdObjectNames []string `json:"cold_objects,omitempty"`
 }
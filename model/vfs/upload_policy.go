@@ -0,0 +1,263 @@
+package vfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// UploadRuleExtension is the rule violated by a file with a blocked
+	// extension.
+	UploadRuleExtension = "blocked_extension"
+	// UploadRuleMime is the rule violated by a file with a blocked mime type.
+	UploadRuleMime = "blocked_mime"
+	// UploadRuleSize is the rule violated by a file larger than the maximal
+	// size.
+	UploadRuleSize = "max_file_size"
+)
+
+// uploadPolicyCacheTTL is the duration for which an upload policy is kept in
+// cache, as it is checked for each upload.
+const uploadPolicyCacheTTL = 5 * time.Minute
+
+var (
+	// ErrInvalidUploadPolicy is used when an upload policy has an invalid rule
+	ErrInvalidUploadPolicy = errors.New("Invalid upload policy")
+	// ErrUploadPolicyNotFound is used when there is no upload policy for a
+	// context
+	ErrUploadPolicyNotFound = errors.New("Upload policy not found")
+)
+
+// UploadPolicyError is returned when a file cannot be created as it violates
+// a rule of the upload policy of the context.
+type UploadPolicyError struct {
+	Context string
+	Rule    string
+	Value   string
+}
+
+func (e *UploadPolicyError) Error() string {
+	return fmt.Sprintf("The upload is blocked by the policy of the context %s (%s: %s)",
+		e.Context, e.Rule, e.Value)
+}
+
+// UploadPolicy is a document, stored in the global database, with the rules
+// that block some uploads for the instances of a context. Its identifier is
+// the name of the context.
+type UploadPolicy struct {
+	DocID             string    `json:"_id,omitempty"`
+	DocRev            string    `json:"_rev,omitempty"`
+	BlockedExtensions []string  `json:"blocked_extensions,omitempty"`
+	BlockedMimes      []string  `json:"blocked_mimes,omitempty"`
+	MaxFileSize       int64     `json:"max_file_size,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (p *UploadPolicy) ID() string { return p.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (p *UploadPolicy) Rev() string { return p.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (p *UploadPolicy) DocType() string { return consts.UploadPolicies }
+
+// Clone implements couchdb.Doc
+func (p *UploadPolicy) Clone() couchdb.Doc {
+	cloned := *p
+	cloned.BlockedExtensions = append([]string{}, p.BlockedExtensions...)
+	cloned.BlockedMimes = append([]string{}, p.BlockedMimes...)
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (p *UploadPolicy) SetID(id string) { p.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (p *UploadPolicy) SetRev(rev string) { p.DocRev = rev }
+
+// Validate checks the rules of the policy, and normalizes the extensions and
+// the mime types.
+func (p *UploadPolicy) Validate() error {
+	if p.DocID == "" || p.MaxFileSize < 0 {
+		return ErrInvalidUploadPolicy
+	}
+	for i, ext := range p.BlockedExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if ext == "." || strings.ContainsAny(ext, "/ ") {
+			return ErrInvalidUploadPolicy
+		}
+		p.BlockedExtensions[i] = ext
+	}
+	for i, mime := range p.BlockedMimes {
+		mime = strings.ToLower(strings.TrimSpace(mime))
+		parts := strings.Split(mime, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == "*" {
+			return ErrInvalidUploadPolicy
+		}
+		p.BlockedMimes[i] = mime
+	}
+	return nil
+}
+
+// Check returns an UploadPolicyError if the file violates a rule of the
+// policy. A size of -1 means that the size is not known in advance.
+func (p *UploadPolicy) Check(name, mime string, size int64) error {
+	name = strings.ToLower(name)
+	for _, ext := range p.BlockedExtensions {
+		if strings.HasSuffix(name, ext) {
+			return &UploadPolicyError{Context: p.DocID, Rule: UploadRuleExtension, Value: ext}
+		}
+	}
+	mime = strings.ToLower(mime)
+	for _, blocked := range p.BlockedMimes {
+		if mime == blocked || (strings.HasSuffix(blocked, "/*") &&
+			strings.HasPrefix(mime, strings.TrimSuffix(blocked, "*"))) {
+			return &UploadPolicyError{Context: p.DocID, Rule: UploadRuleMime, Value: blocked}
+		}
+	}
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return &UploadPolicyError{Context: p.DocID, Rule: UploadRuleSize, Value: fmt.Sprintf("%d", p.MaxFileSize)}
+	}
+	return nil
+}
+
+// GetUploadPolicy returns the upload policy of the given context, or nil if
+// there is none.
+func GetUploadPolicy(contextName string) (*UploadPolicy, error) {
+	var doc UploadPolicy
+	err := couchdb.GetDoc(prefixer.GlobalPrefixer, consts.UploadPolicies, contextName, &doc)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// SaveUploadPolicy validates and persists an upload policy.
+func SaveUploadPolicy(policy *UploadPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	policy.UpdatedAt = time.Now().UTC()
+	if err := couchdb.Upsert(prefixer.GlobalPrefixer, policy); err != nil {
+		return err
+	}
+	config.GetConfig().CacheStorage.Clear(uploadPolicyCacheKey(policy.DocID))
+	return nil
+}
+
+// DeleteUploadPolicy removes the upload policy of the given context.
+func DeleteUploadPolicy(contextName string) error {
+	policy, err := GetUploadPolicy(contextName)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return ErrUploadPolicyNotFound
+	}
+	if err := couchdb.DeleteDoc(prefixer.GlobalPrefixer, policy); err != nil {
+		return err
+	}
+	config.GetConfig().CacheStorage.Clear(uploadPolicyCacheKey(contextName))
+	return nil
+}
+
+// ListUploadPolicies returns the upload policies of all the contexts.
+func ListUploadPolicies() ([]*UploadPolicy, error) {
+	var docs []*UploadPolicy
+	req := &couchdb.AllDocsRequest{Limit: 1000}
+	err := couchdb.GetAllDocs(prefixer.GlobalPrefixer, consts.UploadPolicies, req, &docs)
+	if couchdb.IsNoDatabaseError(err) {
+		return []*UploadPolicy{}, nil
+	}
+	return docs, err
+}
+
+// CheckUploadPolicy returns an UploadPolicyError if the file cannot be
+// created in the given context. The policy is returned, so that the maximal
+// size can also be checked on the bytes written, as the size of the file is
+// not always known in advance.
+func CheckUploadPolicy(contextName string, doc *FileDoc) (*UploadPolicy, error) {
+	policy, err := getCachedUploadPolicy(contextName)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+	if err := policy.Check(doc.DocName, doc.Mime, doc.ByteSize); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// CheckUploadPolicyOnUpdate returns an UploadPolicyError if a file is renamed
+// or given a new mime type that is blocked by the policy of the context. A
+// file that was already blocked (ie created before the policy) can still be
+// renamed, or moved to the trash.
+func CheckUploadPolicyOnUpdate(contextName string, olddoc, newdoc *FileDoc) error {
+	if olddoc.DocName == newdoc.DocName && olddoc.Mime == newdoc.Mime {
+		return nil
+	}
+	policy, err := getCachedUploadPolicy(contextName)
+	if err != nil || policy == nil {
+		return err
+	}
+	// The size is not checked, as the content is not changed
+	err = policy.Check(newdoc.DocName, newdoc.Mime, 0)
+	if err != nil && policy.Check(olddoc.DocName, olddoc.Mime, 0) != nil {
+		return nil
+	}
+	return err
+}
+
+// CheckWritten returns an UploadPolicyError if the number of bytes written
+// for a file is over the maximal size of the policy. It can be called on a
+// nil policy.
+func (p *UploadPolicy) CheckWritten(written int64) error {
+	if p == nil || p.MaxFileSize <= 0 || written <= p.MaxFileSize {
+		return nil
+	}
+	return &UploadPolicyError{Context: p.DocID, Rule: UploadRuleSize, Value: fmt.Sprintf("%d", p.MaxFileSize)}
+}
+
+// getCachedUploadPolicy returns the upload policy of the context, or nil if
+// there is none. The policy is cached, as it is checked on each upload.
+func getCachedUploadPolicy(contextName string) (*UploadPolicy, error) {
+	if contextName == "" {
+		contextName = config.DefaultInstanceContext
+	}
+	cache := config.GetConfig().CacheStorage
+	key := uploadPolicyCacheKey(contextName)
+	var policy *UploadPolicy
+	if buf, ok := cache.Get(key); ok {
+		if err := json.Unmarshal(buf, &policy); err != nil {
+			policy = nil
+			cache.Clear(key)
+		}
+		return policy, nil
+	}
+	policy, err := GetUploadPolicy(contextName)
+	if err != nil {
+		return nil, err
+	}
+	if buf, err := json.Marshal(policy); err == nil {
+		cache.Set(key, buf, uploadPolicyCacheTTL)
+	}
+	return policy, nil
+}
+
+func uploadPolicyCacheKey(contextName string) string {
+	return "upload_policy:" + contextName
+}
@@ -0,0 +1,104 @@
+package vfs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadPolicy(t *testing.T) {
+	t.Run("Validate", func(t *testing.T) {
+		policy := &UploadPolicy{
+			DocID:             "school",
+			BlockedExtensions: []string{"EXE", ".bat", " .tar.gz "},
+			BlockedMimes:      []string{"Application/x-msdownload", "video/*"},
+		}
+		require.NoError(t, policy.Validate())
+		assert.Equal(t, []string{".exe", ".bat", ".tar.gz"}, policy.BlockedExtensions)
+		assert.Equal(t, []string{"application/x-msdownload", "video/*"}, policy.BlockedMimes)
+
+		assert.Error(t, (&UploadPolicy{}).Validate())
+		assert.Error(t, (&UploadPolicy{DocID: "school", MaxFileSize: -1}).Validate())
+		assert.Error(t, (&UploadPolicy{DocID: "school", BlockedExtensions: []string{"."}}).Validate())
+		assert.Error(t, (&UploadPolicy{DocID: "school", BlockedMimes: []string{"video"}}).Validate())
+		assert.Error(t, (&UploadPolicy{DocID: "school", BlockedMimes: []string{"*/*"}}).Validate())
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		policy := &UploadPolicy{
+			DocID:             "school",
+			BlockedExtensions: []string{".exe"},
+			BlockedMimes:      []string{"video/*", "application/x-msdownload"},
+			MaxFileSize:       1000,
+		}
+		assert.NoError(t, policy.Check("report.pdf", "application/pdf", 100))
+		assert.NoError(t, policy.Check("unknown.bin", "application/octet-stream", -1))
+
+		err := policy.Check("Setup.EXE", "application/octet-stream", 100)
+		var policyErr *UploadPolicyError
+		require.ErrorAs(t, err, &policyErr)
+		assert.Equal(t, UploadRuleExtension, policyErr.Rule)
+		assert.Equal(t, ".exe", policyErr.Value)
+		assert.Equal(t, "school", policyErr.Context)
+
+		err = policy.Check("movie.mkv", "video/x-matroska", 100)
+		require.ErrorAs(t, err, &policyErr)
+		assert.Equal(t, UploadRuleMime, policyErr.Rule)
+		assert.Equal(t, "video/*", policyErr.Value)
+
+		err = policy.Check("setup", "application/x-msdownload", 100)
+		require.ErrorAs(t, err, &policyErr)
+		assert.Equal(t, UploadRuleMime, policyErr.Rule)
+
+		err = policy.Check("big.pdf", "application/pdf", 1001)
+		require.ErrorAs(t, err, &policyErr)
+		assert.Equal(t, UploadRuleSize, policyErr.Rule)
+		assert.Equal(t, "1000", policyErr.Value)
+	})
+
+	t.Run("CheckWritten", func(t *testing.T) {
+		var nilPolicy *UploadPolicy
+		assert.NoError(t, nilPolicy.CheckWritten(1<<40))
+		policy := &UploadPolicy{DocID: "school", MaxFileSize: 1000}
+		assert.NoError(t, policy.CheckWritten(1000))
+		var policyErr *UploadPolicyError
+		require.ErrorAs(t, policy.CheckWritten(1001), &policyErr)
+		assert.Equal(t, UploadRuleSize, policyErr.Rule)
+	})
+
+	t.Run("CheckUploadPolicyOnUpdate", func(t *testing.T) {
+		config.UseTestFile(t)
+		policy := &UploadPolicy{DocID: "school", BlockedExtensions: []string{".exe"}}
+		buf, err := json.Marshal(policy)
+		require.NoError(t, err)
+		cache := config.GetConfig().CacheStorage
+		cache.Set(uploadPolicyCacheKey("school"), buf, time.Minute)
+		defer cache.Clear(uploadPolicyCacheKey("school"))
+
+		olddoc := &FileDoc{DocName: "setup.txt", Mime: "text/plain"}
+		newdoc := &FileDoc{DocName: "setup.exe", Mime: "application/octet-stream"}
+		var policyErr *UploadPolicyError
+		require.ErrorAs(t, CheckUploadPolicyOnUpdate("school", olddoc, newdoc), &policyErr)
+		assert.Equal(t, UploadRuleExtension, policyErr.Rule)
+		assert.NoError(t, CheckUploadPolicyOnUpdate("school", olddoc, olddoc))
+
+		// A file created before the policy can still be renamed
+		renamed := &FileDoc{DocName: "setup (2).exe", Mime: "application/octet-stream"}
+		assert.NoError(t, CheckUploadPolicyOnUpdate("school", newdoc, renamed))
+
+		// The size is checked on the bytes written
+		doc := &FileDoc{DocName: "report.pdf", Mime: "application/pdf", ByteSize: -1}
+		policy.MaxFileSize = 10
+		buf, err = json.Marshal(policy)
+		require.NoError(t, err)
+		cache.Set(uploadPolicyCacheKey("school"), buf, time.Minute)
+		got, err := CheckUploadPolicy("school", doc)
+		require.NoError(t, err)
+		assert.Error(t, got.CheckWritten(11))
+	})
+}
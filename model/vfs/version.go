@@ -1,14 +1,18 @@
 package vfs
 
 import (
+	"encoding/json"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/metrics"
 	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/hashicorp/go-multierror"
 )
 
 // Version is used for storing the metadata about previous versions of file
@@ -23,6 +27,7 @@ type Version struct {
 	Tags         []string          `json:"tags"`
 	Metadata     Metadata          `json:"metadata,omitempty"`
 	CozyMetadata FilesCozyMetadata `json:"cozyMetadata,omitempty"`
+	Cold         bool              `json:"cold,omitempty"`
 	Rels         struct {
 		File struct {
 			Data struct {
@@ -95,6 +100,7 @@ func NewVersion(file *FileDoc) *Version {
 		Tags:         file.Tags,
 		Metadata:     file.Metadata,
 		CozyMetadata: *fcm,
+		Cold:         file.Cold,
 	}
 	v.Rels.File.Data.ID = file.ID()
 	v.Rels.File.Data.Type = consts.Files
@@ -162,38 +168,277 @@ const (
 	CleanCandidateVersion
 )
 
+// VersioningPolicy is the set of rules used to know which old versions of the
+// files are kept.
+type VersioningPolicy struct {
+	// MaxNumber is the maximal number of old versions kept for a file (0
+	// disables the versioning).
+	MaxNumber int
+	// MinDelay is the minimal delay between two versions of a file.
+	MinDelay time.Duration
+	// MaxAge is the duration after which an old version is cleaned (0 means
+	// no limit).
+	MaxAge time.Duration
+	// MaxTotalSize is the maximal number of bytes used by the old versions of
+	// all the files of an instance (0 means no limit).
+	MaxTotalSize int64
+}
+
+// VersioningOverride can be used to override some rules of the versioning
+// policy of the context for an instance.
+type VersioningOverride struct {
+	MaxNumber    *int   `json:"max_number_of_versions_to_keep,omitempty"`
+	MinDelay     string `json:"min_delay_between_two_versions,omitempty"`
+	MaxAge       string `json:"max_age_of_versions,omitempty"`
+	MaxTotalSize *int64 `json:"max_size_of_versions,omitempty"`
+}
+
+// Validate checks that the durations of the override can be parsed.
+func (o *VersioningOverride) Validate() error {
+	for _, d := range []string{o.MinDelay, o.MaxAge} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply returns the policy with the rules of the override.
+func (o *VersioningOverride) Apply(policy VersioningPolicy) VersioningPolicy {
+	if o == nil {
+		return policy
+	}
+	if o.MaxNumber != nil {
+		policy.MaxNumber = *o.MaxNumber
+	}
+	if delay, err := time.ParseDuration(o.MinDelay); err == nil {
+		policy.MinDelay = delay
+	}
+	if age, err := time.ParseDuration(o.MaxAge); err == nil {
+		policy.MaxAge = age
+	}
+	if o.MaxTotalSize != nil {
+		policy.MaxTotalSize = *o.MaxTotalSize
+	}
+	return policy
+}
+
+// ContextVersioningPolicy returns the versioning policy for the given
+// context, from the config file.
+func ContextVersioningPolicy(contextName string) VersioningPolicy {
+	cfg := config.GetConfig()
+	policy := VersioningPolicy{
+		MaxNumber:    cfg.Fs.Versioning.MaxNumberToKeep,
+		MinDelay:     cfg.Fs.Versioning.MinDelayBetweenTwoVersions,
+		MaxAge:       cfg.Fs.Versioning.MaxAge,
+		MaxTotalSize: cfg.Fs.Versioning.MaxTotalSize,
+	}
+
+	context, _ := cfg.Fs.Contexts[contextName].(map[string]interface{})
+	if number, ok := context["max_number_of_versions_to_keep"].(int); ok {
+		policy.MaxNumber = number
+	}
+	if delay, ok := context["min_delay_between_two_versions"].(string); ok {
+		if min, err := time.ParseDuration(delay); err == nil {
+			policy.MinDelay = min
+		}
+	}
+	if age, ok := context["max_age_of_versions"].(string); ok {
+		if max, err := time.ParseDuration(age); err == nil {
+			policy.MaxAge = max
+		}
+	}
+	if size, ok := context["max_size_of_versions"].(int); ok {
+		policy.MaxTotalSize = int64(size)
+	}
+
+	return policy
+}
+
 // FindVersionsToClean returns a bool to say if the candidate version must be
 // cleaned, a list of old versions to clean, and an error. The rules to know
 // the versions to clean or keep are:
 // - the tagged versions are kept
 // - two versions must not be too close in time
-// - there is a maximal number of versions.
-func FindVersionsToClean(db Prefixer, fileID string, candidate *Version) (ActionForCandidateVersion, []*Version, error) {
-	olds, err := VersionsFor(db, fileID)
+// - there is a maximal number of versions
+// - the versions older than the maximal age are cleaned
+// - the candidate is not kept if the old versions of the instance already
+// use the maximal size
+// - the versions referenced by a snapshot are kept.
+func FindVersionsToClean(fs VFS, fileID string, candidate *Version) (ActionForCandidateVersion, []*Version, error) {
+	olds, err := VersionsFor(fs, fileID)
 	if err != nil {
 		return DoNothingForCandidateVersion, nil, err
 	}
-	maxNumber, minDelay := getVersioningConfig(db.GetContextName())
-	action, toClean := detectVersionsToClean(candidate, olds, maxNumber, minDelay)
+	policy := fs.VersioningPolicy()
+	action, toClean := detectVersionsToClean(candidate, olds, policy.MaxNumber, policy.MinDelay)
+	if policy.MaxAge > 0 {
+		toClean = appendExpiredVersions(toClean, olds, time.Now().Add(-policy.MaxAge))
+	}
+	if action == KeepCandidateVersion && candidate != nil && policy.MaxTotalSize > 0 && len(candidate.Tags) == 0 {
+		usage, err := fs.VersionsUsage()
+		if err != nil {
+			return DoNothingForCandidateVersion, nil, err
+		}
+		for _, v := range toClean {
+			usage -= v.ByteSize
+		}
+		if usage+candidate.ByteSize > policy.MaxTotalSize {
+			action = CleanCandidateVersion
+		}
+	}
+	referenced, err := snapshotVersionsFor(fs, fileID)
+	if err != nil {
+		return DoNothingForCandidateVersion, nil, err
+	}
+	action, toClean = keepSnapshotVersions(action, candidate, toClean, referenced)
+
 	return action, toClean, nil
 }
 
-func getVersioningConfig(contextName string) (int, time.Duration) {
-	cfg := config.GetConfig()
-	maxNumber := cfg.Fs.Versioning.MaxNumberToKeep
-	minDelay := cfg.Fs.Versioning.MinDelayBetweenTwoVersions
+// appendExpiredVersions adds to the list of versions to clean the versions
+// without tags that have been created before the given time.
+func appendExpiredVersions(toClean, olds []*Version, before time.Time) []*Version {
+	selected := make(map[string]bool, len(toClean))
+	for _, v := range toClean {
+		selected[v.DocID] = true
+	}
+	for _, v := range olds {
+		if len(v.Tags) > 0 || selected[v.DocID] {
+			continue
+		}
+		if v.CozyMetadata.CreatedAt.Before(before) {
+			toClean = append(toClean, v)
+		}
+	}
+	return toClean
+}
 
-	context, _ := cfg.Fs.Contexts[contextName].(map[string]interface{})
-	if number, ok := context["max_number_of_versions_to_keep"].(int); ok {
-		maxNumber = number
+// versionsBatchSize is the number of versions loaded at once when the
+// versions are cleaned by the policy.
+const versionsBatchSize = 1000
+
+// CleanVersionsByPolicy deletes the old versions that are too old, or the
+// oldest versions when they use more space than allowed by the versioning
+// policy. The tagged versions and the versions referenced by a snapshot are
+// kept. The versions are loaded page by page, the oldest first. It returns
+// the number of bytes that have been reclaimed.
+func CleanVersionsByPolicy(fs VFS) (int64, error) {
+	policy := fs.VersioningPolicy()
+	if policy.MaxAge <= 0 && policy.MaxTotalSize <= 0 {
+		return 0, nil
 	}
-	if delay, ok := context["min_delay_between_two_versions"].(string); ok {
-		if min, err := time.ParseDuration(delay); err == nil {
-			minDelay = min
+	referenced, err := allSnapshotVersions(fs)
+	if err != nil {
+		return 0, err
+	}
+	selector := &versionsSelector{policy: policy, referenced: referenced, now: time.Now()}
+	if policy.MaxTotalSize > 0 {
+		if selector.total, err = fs.VersionsUsage(); err != nil {
+			return 0, err
+		}
+	}
+
+	var reclaimed int64
+	var errm error
+	req := &couchdb.ViewRequest{
+		IncludeDocs: true,
+		Limit:       versionsBatchSize + 1, // Also get the following version for the next key
+	}
+	for {
+		var res couchdb.ViewResponse
+		err := couchdb.ExecView(fs, couchdb.OldVersionsByCreatedAtView, req, &res)
+		if couchdb.IsNoDatabaseError(err) {
+			break
+		}
+		if err != nil {
+			return reclaimed, err
 		}
+		var next *couchdb.ViewResponseRow
+		if len(res.Rows) > versionsBatchSize {
+			next = res.Rows[versionsBatchSize]
+			res.Rows = res.Rows[:versionsBatchSize]
+		}
+		versions := make([]*Version, 0, len(res.Rows))
+		for _, row := range res.Rows {
+			var v Version
+			if err := json.Unmarshal(row.Doc, &v); err != nil {
+				return reclaimed, err
+			}
+			versions = append(versions, &v)
+		}
+
+		toClean, done := selector.selectPage(versions)
+		for _, v := range toClean {
+			fileID := v.Rels.File.Data.ID
+			if fileID == "" {
+				fileID = strings.SplitN(v.DocID, "/", 2)[0]
+			}
+			if err := fs.CleanOldVersion(fileID, v); err != nil {
+				errm = multierror.Append(errm, err)
+				continue
+			}
+			reclaimed += v.ByteSize
+			metrics.VersionsReclaimedBytes.WithLabelValues("job").Add(float64(v.ByteSize))
+		}
+		if done || next == nil {
+			break
+		}
+		req.StartKey = next.Key
+		req.StartKeyDocID = next.ID
 	}
+	return reclaimed, errm
+}
+
+// versionsSelector selects the versions that must be cleaned to respect the
+// maximal age and the maximal total size of the versioning policy. The
+// versions are given to it the oldest first.
+type versionsSelector struct {
+	policy     VersioningPolicy
+	referenced map[string]bool
+	now        time.Time
+	total      int64
+}
 
-	return maxNumber, minDelay
+// selectPage returns the versions of the page to clean, and true when the
+// next versions don't need to be looked at (they are more recent, and the
+// total size is already under the limit).
+func (s *versionsSelector) selectPage(versions []*Version) ([]*Version, bool) {
+	var toClean []*Version
+	for _, v := range versions {
+		if len(v.Tags) > 0 || s.referenced[v.DocID] {
+			continue
+		}
+		expired := s.policy.MaxAge > 0 && v.CozyMetadata.CreatedAt.Before(s.now.Add(-s.policy.MaxAge))
+		tooBig := s.policy.MaxTotalSize > 0 && s.total > s.policy.MaxTotalSize
+		if !expired && !tooBig {
+			return toClean, true
+		}
+		toClean = append(toClean, v)
+		if !v.Cold {
+			s.total -= v.ByteSize
+		}
+	}
+	return toClean, false
+}
+
+// selectVersionsToClean returns the versions that must be cleaned to respect
+// the maximal age and the maximal total size of the versioning policy.
+func selectVersionsToClean(versions []*Version, referenced map[string]bool, policy VersioningPolicy, now time.Time) []*Version {
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].CozyMetadata.CreatedAt.Before(versions[j].CozyMetadata.CreatedAt)
+	})
+	selector := &versionsSelector{policy: policy, referenced: referenced, now: now}
+	for _, v := range versions {
+		if !v.Cold {
+			selector.total += v.ByteSize
+		}
+	}
+	toClean, _ := selector.selectPage(versions)
+	return toClean
 }
 
 func detectVersionsToClean(candidate *Version, olds []*Version, maxNumber int, minDelay time.Duration) (ActionForCandidateVersion, []*Version) {
@@ -91,6 +91,80 @@ func TestVersion(t *testing.T) {
 		assert.Equal(t, &v4, toClean[2])
 		assert.Equal(t, &v5, toClean[3])
 	})
+
+	t.Run("KeepSnapshotVersions", func(t *testing.T) {
+		fileID := uuidv4()
+		v0 := &Version{DocID: fileID + "/v0"}
+		v1 := &Version{DocID: fileID + "/v1"}
+		v2 := &Version{DocID: fileID + "/v2"}
+		candidate := &Version{DocID: fileID + "/v3"}
+
+		action, toClean := keepSnapshotVersions(CleanCandidateVersion, candidate, []*Version{v0, v1, v2}, nil)
+		assert.Equal(t, CleanCandidateVersion, action)
+		assert.Equal(t, []*Version{v0, v1, v2}, toClean)
+
+		referenced := map[string]bool{v1.DocID: true}
+		action, toClean = keepSnapshotVersions(CleanCandidateVersion, candidate, []*Version{v0, v1, v2}, referenced)
+		assert.Equal(t, CleanCandidateVersion, action)
+		assert.Equal(t, []*Version{v0, v2}, toClean)
+
+		referenced[candidate.DocID] = true
+		action, toClean = keepSnapshotVersions(CleanCandidateVersion, candidate, []*Version{v0, v1}, referenced)
+		assert.Equal(t, KeepCandidateVersion, action)
+		assert.Equal(t, []*Version{v0}, toClean)
+
+		action, _ = keepSnapshotVersions(DoNothingForCandidateVersion, candidate, nil, referenced)
+		assert.Equal(t, DoNothingForCandidateVersion, action)
+	})
+
+	t.Run("AppendExpiredVersions", func(t *testing.T) {
+		now := time.Now()
+		genVersion := func(timeAgo time.Duration, tags ...string) *Version {
+			v := &Version{DocID: uuidv4() + "/" + utils.RandomString(16), Tags: tags}
+			v.CozyMetadata.CreatedAt = now.Add(-1 * timeAgo)
+			return v
+		}
+		v0 := genVersion(72 * time.Hour)
+		v1 := genVersion(48*time.Hour, "important")
+		v2 := genVersion(36 * time.Hour)
+		v3 := genVersion(1 * time.Hour)
+
+		toClean := appendExpiredVersions(nil, []*Version{v0, v1, v2, v3}, now.Add(-24*time.Hour))
+		assert.Equal(t, []*Version{v0, v2}, toClean)
+
+		toClean = appendExpiredVersions([]*Version{v0}, []*Version{v0, v1, v2, v3}, now.Add(-24*time.Hour))
+		assert.Equal(t, []*Version{v0, v2}, toClean)
+	})
+
+	t.Run("SelectVersionsToClean", func(t *testing.T) {
+		now := time.Now()
+		genVersion := func(timeAgo time.Duration, size int64, tags ...string) *Version {
+			v := &Version{DocID: uuidv4() + "/" + utils.RandomString(16), ByteSize: size, Tags: tags}
+			v.CozyMetadata.CreatedAt = now.Add(-1 * timeAgo)
+			return v
+		}
+		v0 := genVersion(96*time.Hour, 100)
+		v1 := genVersion(72*time.Hour, 100, "important")
+		v2 := genVersion(48*time.Hour, 100)
+		v3 := genVersion(24*time.Hour, 100)
+		v4 := genVersion(1*time.Hour, 100)
+		all := func() []*Version { return []*Version{v4, v2, v0, v3, v1} }
+
+		policy := VersioningPolicy{MaxAge: 36 * time.Hour}
+		toClean := selectVersionsToClean(all(), nil, policy, now)
+		assert.Equal(t, []*Version{v0, v2}, toClean)
+
+		policy = VersioningPolicy{MaxTotalSize: 250}
+		toClean = selectVersionsToClean(all(), nil, policy, now)
+		assert.Equal(t, []*Version{v0, v2, v3}, toClean)
+
+		referenced := map[string]bool{v0.DocID: true}
+		toClean = selectVersionsToClean(all(), referenced, policy, now)
+		assert.Equal(t, []*Version{v2, v3, v4}, toClean)
+
+		toClean = selectVersionsToClean(all(), nil, VersioningPolicy{}, now)
+		assert.Empty(t, toClean)
+	})
 }
 
 func uuidv4() string {
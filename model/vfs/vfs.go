@@ -80,6 +80,11 @@ type Fs interface {
 	// OpenFile return a file handler for reading associated with the given file
 	// document. The file handler implements io.ReadCloser and io.Seeker.
 	OpenFile(doc *FileDoc) (File, error)
+	// OpenFileAt returns a reader for a part of the content of the given
+	// file: it starts at offset, and has at most length bytes (or goes until
+	// the end of the file if length is negative). Only the requested part is
+	// fetched from the storage.
+	OpenFileAt(doc *FileDoc, offset, length int64) (io.ReadCloser, error)
 	// OpenFileVersion returns a file handler for reading the content of an old
 	// version of the given file.
 	OpenFileVersion(doc *FileDoc, version *Version) (File, error)
@@ -129,6 +134,12 @@ type Fs interface {
 	// Fsck return the list of inconsistencies in the VFS
 	Fsck(func(log *FsckLog), bool) (err error)
 	CheckFilesConsistency(func(*FsckLog), bool) error
+	// ReclaimOrphan removes from the storage an orphan object, ie an object
+	// without a document in the index, to free its space.
+	ReclaimOrphan(log *FsckLog) error
+	// RestoreOrphan creates the missing document in the index for an orphan
+	// object.
+	RestoreOrphan(log *FsckLog) error
 }
 
 // File is a reader, writer, seeker, closer iterface representing an opened
@@ -141,6 +152,15 @@ type File interface {
 	io.Closer
 }
 
+// CancelWithError can be called on a file opened for writing, before closing
+// it, to abort its creation: the Close will return the given error, and the
+// content is not committed.
+func CancelWithError(file File, err error) {
+	if c, ok := file.(interface{ CancelWithError(err error) }); ok {
+		c.CancelWithError(err)
+	}
+}
+
 // FilePather is an interface for computing the fullpath of a filedoc
 type FilePather interface {
 	FilePath(doc *FileDoc) (string, error)
@@ -165,6 +185,10 @@ type Indexer interface {
 	// VersionsUsage computes the total size of the old file versions contained
 	// in the VFS, not including latest version.
 	VersionsUsage() (int64, error)
+	// ColdUsage computes the total size of the files and old versions that
+	// have been moved to the cold storage. They are not counted in the other
+	// usages.
+	ColdUsage() (int64, error)
 	// TrashUsage computes the total size of the files contained in the trash.
 	TrashUsage() (int64, error)
 	// DirSize returns the size of a directory, including files in
@@ -255,6 +279,9 @@ type DiskThresholder interface {
 	// DiskQuota returns the total number of bytes allowed to be stored in the
 	// VFS. If minus or equal to zero, it is considered without limit.
 	DiskQuota() int64
+	// VersioningPolicy returns the rules used to know which old versions of
+	// the files are kept.
+	VersioningPolicy() VersioningPolicy
 }
 
 // Thumbser defines an interface to define a thumbnail filesystem.
@@ -332,6 +359,9 @@ type DocPatch struct {
 	Executable  *bool      `json:"executable,omitempty"`
 	Encrypted   *bool      `json:"encrypted,omitempty"`
 	Class       *string    `json:"class,omitempty"`
+	// The annotations of the user, saved in the cozyMetadata
+	Favorite *bool     `json:"favorite,omitempty"`
+	Labels   *[]string `json:"labels,omitempty"`
 }
 
 // DirOrFileDoc is a union struct of FileDoc and DirDoc. It is useful to
@@ -348,6 +378,9 @@ type DirOrFileDoc struct {
 	Trashed    bool   `json:"trashed,omitempty"`
 	Encrypted  bool   `json:"encrypted,omitempty"`
 	InternalID string `json:"internal_vfs_id,omitempty"`
+	Cold       bool   `json:"cold,omitempty"`
+
+	Scan *ScanStatus `json:"scan,omitempty"`
 }
 
 // Clone is part of the couchdb.Doc interface
@@ -363,26 +396,29 @@ func (fd *DirOrFileDoc) Refine() (*DirDoc, *FileDoc) {
 		return fd.DirDoc, nil
 	case consts.FileType:
 		return nil, &FileDoc{
-			Type:         fd.Type,
-			DocID:        fd.DocID,
-			DocRev:       fd.DocRev,
-			DocName:      fd.DocName,
-			DirID:        fd.DirID,
-			RestorePath:  fd.RestorePath,
-			CreatedAt:    fd.CreatedAt,
-			UpdatedAt:    fd.UpdatedAt,
-			ByteSize:     fd.ByteSize,
-			MD5Sum:       fd.MD5Sum,
-			Mime:         fd.Mime,
-			Class:        fd.Class,
-			Executable:   fd.Executable,
-			Trashed:      fd.Trashed,
-			Encrypted:    fd.Encrypted,
-			Tags:         fd.Tags,
-			Metadata:     fd.Metadata,
-			ReferencedBy: fd.ReferencedBy,
-			CozyMetadata: fd.CozyMetadata,
-			InternalID:   fd.InternalID,
+			Type:           fd.Type,
+			DocID:          fd.DocID,
+			DocRev:         fd.DocRev,
+			DocName:        fd.DocName,
+			DirID:          fd.DirID,
+			RestorePath:    fd.RestorePath,
+			CreatedAt:      fd.CreatedAt,
+			UpdatedAt:      fd.UpdatedAt,
+			ByteSize:       fd.ByteSize,
+			MD5Sum:         fd.MD5Sum,
+			Mime:           fd.Mime,
+			Class:          fd.Class,
+			Executable:     fd.Executable,
+			Trashed:        fd.Trashed,
+			Encrypted:      fd.Encrypted,
+			Tags:           fd.Tags,
+			Metadata:       fd.Metadata,
+			ReferencedBy:   fd.ReferencedBy,
+			CozyMetadata:   fd.CozyMetadata,
+			InternalID:     fd.InternalID,
+			CustomMetadata: fd.CustomMetadata,
+			Cold:           fd.Cold,
+			Scan:           fd.Scan,
 		}
 	}
 	return nil, nil
@@ -755,12 +791,12 @@ func DiskQuotaAfterDestroy(fs VFS, diskUsageBeforeWrite, destroyed int64) {
 	}
 }
 
-// getRestoreDir returns the restoration directory document from a file a
-// directory path. The specified file path should be part of the trash
-// directory.
-func getRestoreDir(fs VFS, name, restorePath string) (*DirDoc, error) {
+// getRestorePath returns the path of the directory where a file or directory
+// from the trash will be restored, without creating it. The specified file
+// path should be part of the trash directory.
+func getRestorePath(fs VFS, name, restorePath string) (string, error) {
 	if !strings.HasPrefix(name, TrashDirName) {
-		return nil, ErrFileNotInTrash
+		return "", ErrFileNotInTrash
 	}
 
 	// If the restore path is not set, it means that the file is part of a
@@ -779,7 +815,7 @@ func getRestoreDir(fs VFS, name, restorePath string) (*DirDoc, error) {
 			rest := path.Dir(name[split+1:])
 			doc, err := fs.DirByPath(TrashDirName + "/" + root)
 			if err != nil {
-				return nil, err
+				return "", err
 			}
 			if doc.RestorePath != "" {
 				restorePath = path.Join(doc.RestorePath, doc.DocName, rest)
@@ -792,14 +828,7 @@ func getRestoreDir(fs VFS, name, restorePath string) (*DirDoc, error) {
 	if restorePath == "" {
 		restorePath = "/"
 	}
-
-	// If the restore directory does not exist anymore, we re-create the
-	// directory hierarchy to restore the file in.
-	restoreDir, err := fs.DirByPath(restorePath)
-	if os.IsNotExist(err) {
-		return MkdirAll(fs, restorePath)
-	}
-	return restoreDir, err
+	return restorePath, nil
 }
 
 func normalizeDocPatch(data, patch *DocPatch, cdate time.Time) (*DocPatch, error) {
@@ -96,6 +96,42 @@ func TestVfs(t *testing.T) {
 				assert.Error(t, err)
 			})
 
+			t.Run("OpenFileAt", func(t *testing.T) {
+				doc, err := fs.FileByPath("/toto")
+				require.NoError(t, err)
+
+				content, err := fs.OpenFileAt(doc, 2, 3)
+				require.NoError(t, err)
+				buf, err := io.ReadAll(content)
+				assert.NoError(t, err)
+				assert.NoError(t, content.Close())
+				assert.Equal(t, "llo", string(buf))
+
+				content, err = fs.OpenFileAt(doc, 4, -1)
+				require.NoError(t, err)
+				buf, err = io.ReadAll(content)
+				assert.NoError(t, err)
+				assert.NoError(t, content.Close())
+				assert.Equal(t, "o !", string(buf))
+
+				file, err := fs.OpenFile(doc)
+				require.NoError(t, err)
+				p := make([]byte, 4)
+				n, err := file.ReadAt(p, 1)
+				assert.NoError(t, err)
+				assert.Equal(t, 4, n)
+				assert.Equal(t, "ello", string(p))
+				n, err = file.ReadAt(p, 5)
+				assert.Equal(t, io.EOF, err)
+				assert.Equal(t, 2, n)
+				assert.Equal(t, " !", string(p[:n]))
+				n, err = file.ReadAt(p, 0)
+				assert.NoError(t, err)
+				assert.Equal(t, 4, n)
+				assert.Equal(t, "hell", string(p))
+				assert.NoError(t, file.Close())
+			})
+
 			t.Run("Remove", func(t *testing.T) {
 				err := vfs.Remove(fs, "foo/bar", fs.EnsureErased)
 				assert.Error(t, err)
@@ -658,6 +694,103 @@ func TestVfs(t *testing.T) {
 				assert.Equal(t, "existing (copy) (2)", newname)
 			})
 
+			t.Run("RestoreWithStrategy", func(t *testing.T) {
+				origtree := H{
+					"restore1/": H{
+						"foo": nil,
+						"sub/": H{
+							"bar": nil,
+						},
+					},
+				}
+				olddoc := createTree(t, fs, origtree, consts.RootDirID)
+				trashed, err := vfs.TrashDir(fs, olddoc)
+				require.NoError(t, err)
+
+				newtree := H{
+					"restore1/": H{
+						"baz":  nil,
+						"sub/": H{},
+					},
+				}
+				existing := createTree(t, fs, newtree, consts.RootDirID)
+
+				preview, err := vfs.PreviewRestoreDir(fs, trashed, nil)
+				require.NoError(t, err)
+				assert.Equal(t, vfs.RestoreAuto, preview.Strategy)
+				assert.Equal(t, "/restore1", preview.TargetPath)
+				assert.Equal(t, "suffix", preview.Resolution)
+				require.NotNil(t, preview.Conflict)
+				assert.Equal(t, existing.ID(), preview.Conflict.ID)
+
+				preview, err = vfs.PreviewRestoreDir(fs, trashed, &vfs.RestoreOptions{
+					Strategy: vfs.RestoreRenameTo,
+					Name:     "restore2",
+				})
+				require.NoError(t, err)
+				assert.Equal(t, "/restore2", preview.TargetPath)
+				assert.Equal(t, "none", preview.Resolution)
+				assert.Nil(t, preview.Conflict)
+
+				_, err = vfs.RestoreDir(fs, trashed, &vfs.RestoreOptions{Strategy: vfs.RestoreTo})
+				assert.Equal(t, vfs.ErrInvalidRestoreStrategy, err)
+
+				preview, err = vfs.PreviewRestoreDir(fs, trashed, &vfs.RestoreOptions{Strategy: vfs.RestoreMerge})
+				require.NoError(t, err)
+				assert.Equal(t, "merge", preview.Resolution)
+
+				restored, err := vfs.RestoreDir(fs, trashed, &vfs.RestoreOptions{Strategy: vfs.RestoreMerge})
+				require.NoError(t, err)
+				assert.Equal(t, existing.ID(), restored.ID())
+
+				tree, err := fetchTree(fs, "/restore1")
+				require.NoError(t, err)
+				assert.EqualValues(t, H{
+					"restore1/": H{
+						"baz": nil,
+						"foo": nil,
+						"sub/": H{
+							"bar": nil,
+						},
+					},
+				}, tree)
+
+				_, err = fs.DirByID(trashed.ID())
+				assert.True(t, os.IsNotExist(err))
+			})
+
+			t.Run("Quarantined", func(t *testing.T) {
+				doc, err := vfs.NewFileDoc("quarantined.txt", consts.RootDirID, -1, nil, "text/plain", "text", time.Now(), false, false, false, nil)
+				require.NoError(t, err)
+				file, err := fs.CreateFile(doc, nil)
+				require.NoError(t, err)
+				_, err = file.Write([]byte("malware"))
+				require.NoError(t, err)
+				require.NoError(t, file.Close())
+
+				doc, err = fs.FileByPath("/quarantined.txt")
+				require.NoError(t, err)
+				doc, err = vfs.SetScanStatus(fs, doc, vfs.ScanStatusQuarantined, "virus", "antivirus")
+				require.NoError(t, err)
+
+				_, err = fs.OpenFile(doc)
+				assert.Equal(t, vfs.ErrFileQuarantined, err)
+				_, err = fs.OpenFileAt(doc, 0, 3)
+				assert.Equal(t, vfs.ErrFileQuarantined, err)
+
+				req := httptest.NewRequest("GET", "/", nil)
+				w := httptest.NewRecorder()
+				err = vfs.ServeFileContent(fs, doc, nil, "", "attachment", req, w)
+				assert.Equal(t, vfs.ErrFileQuarantined, err)
+
+				w = httptest.NewRecorder()
+				require.NoError(t, vfs.ServeQuarantinedFileContent(fs, doc, req, w))
+				assert.Equal(t, "malware", w.Body.String())
+				assert.True(t, doc.Quarantined())
+
+				require.NoError(t, fs.DestroyFile(doc))
+			})
+
 			t.Run("CheckAvailableSpace", func(t *testing.T) {
 				diskQuota = 0
 
@@ -696,6 +829,10 @@ func (d *diskImpl) DiskQuota() int64 {
 	return diskQuota
 }
 
+func (d *diskImpl) VersioningPolicy() vfs.VersioningPolicy {
+	return vfs.ContextVersioningPolicy("")
+}
+
 func (h H) String() string {
 	return printH(h, "", 0)
 }
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -255,3 +256,68 @@ func fileInfosToVersionDoc(fullpath string, fileinfo os.FileInfo) *vfs.Version {
 	v.Rels.File.Data.Type = consts.Files
 	return v
 }
+
+func (afs *aferoVFS) ReclaimOrphan(log *vfs.FsckLog) error {
+	if log.Type != vfs.IndexMissing {
+		return vfs.ErrFsckNotOrphan
+	}
+	var err error
+	switch {
+	case log.IsVersion && log.VersionDoc != nil:
+		err = afs.fs.Remove(pathForVersion(log.VersionDoc))
+	case log.FileDoc != nil:
+		err = afs.fs.RemoveAll(log.FileDoc.Fullpath)
+	default:
+		return vfs.ErrFsckNotOrphan
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (afs *aferoVFS) RestoreOrphan(log *vfs.FsckLog) error {
+	if log.Type != vfs.IndexMissing {
+		return vfs.ErrFsckNotOrphan
+	}
+	if log.IsVersion && log.VersionDoc != nil {
+		v := log.VersionDoc
+		if _, err := afs.Indexer.FileByID(v.Rels.File.Data.ID); err != nil {
+			return err
+		}
+		v.Tags = []string{}
+		return afs.Indexer.CreateVersion(v)
+	}
+	if log.FileDoc == nil {
+		return vfs.ErrFsckNotOrphan
+	}
+
+	// The content is already at the right place on the local filesystem, the
+	// parent directory must be restored before its children.
+	orphan := log.FileDoc
+	parent, err := afs.Indexer.DirByPath(path.Dir(orphan.Fullpath))
+	if err != nil {
+		return err
+	}
+	infos, err := afs.fs.Stat(orphan.Fullpath)
+	if err != nil {
+		return err
+	}
+	if infos.IsDir() {
+		dir, err := vfs.NewDirDocWithParent(infos.Name(), parent, nil)
+		if err != nil {
+			return err
+		}
+		dir.CreatedAt = infos.ModTime()
+		dir.UpdatedAt = infos.ModTime()
+		dir.CozyMetadata = vfs.NewCozyMetadata("")
+		return afs.Indexer.CreateDirDoc(dir)
+	}
+	doc, err := vfs.NewFileDoc(infos.Name(), parent.DocID, orphan.ByteSize, orphan.MD5Sum,
+		orphan.Mime, orphan.Class, infos.ModTime(), orphan.Executable, orphan.Trashed, false, nil)
+	if err != nil {
+		return err
+	}
+	doc.CozyMetadata = vfs.NewCozyMetadata("")
+	return afs.Indexer.CreateFileDoc(doc)
+}
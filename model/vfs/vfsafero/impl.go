@@ -15,9 +15,11 @@ import (
 	"sync"
 
 	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/filetype"
 	"github.com/cozy/cozy-stack/pkg/lock"
+	"github.com/cozy/cozy-stack/pkg/metrics"
 
 	"github.com/spf13/afero"
 )
@@ -123,6 +125,7 @@ func (afs *aferoVFS) UseSharingIndexer(index vfs.Indexer) vfs.VFS {
 		DiskThresholder: afs.DiskThresholder,
 		domain:          afs.domain,
 		prefix:          afs.prefix,
+		context:         afs.context,
 		fs:              afs.fs,
 		mu:              afs.mu,
 		pth:             afs.pth,
@@ -194,6 +197,10 @@ func (afs *aferoVFS) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.CreateO
 	if err != nil {
 		return nil, err
 	}
+	policy, err := vfs.CheckUploadPolicy(afs.context, newdoc)
+	if err != nil {
+		return nil, err
+	}
 
 	if olddoc != nil {
 		newdoc.SetID(olddoc.ID())
@@ -240,6 +247,7 @@ func (afs *aferoVFS) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.CreateO
 		size:    newsize,
 		maxsize: maxsize,
 		capsize: capsize,
+		policy:  policy,
 		hash:    hash,
 		meta:    extractor,
 	}, nil
@@ -379,6 +387,9 @@ func (afs *aferoVFS) DissociateDir(src, dst *vfs.DirDoc) error {
 }
 
 func (afs *aferoVFS) DestroyDirContent(doc *vfs.DirDoc, push func(vfs.TrashJournal) error) error {
+	if err := couchdb.CheckDeletion(afs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := afs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -415,6 +426,9 @@ func (afs *aferoVFS) DestroyDirContent(doc *vfs.DirDoc, push func(vfs.TrashJourn
 }
 
 func (afs *aferoVFS) DestroyDirAndContent(doc *vfs.DirDoc, push func(vfs.TrashJournal) error) error {
+	if err := couchdb.CheckDeletion(afs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := afs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -439,6 +453,9 @@ func (afs *aferoVFS) DestroyDirAndContent(doc *vfs.DirDoc, push func(vfs.TrashJo
 }
 
 func (afs *aferoVFS) DestroyFile(doc *vfs.FileDoc) error {
+	if err := couchdb.CheckDeletion(afs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := afs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -477,6 +494,9 @@ func (afs *aferoVFS) openFile(doc *vfs.FileDoc) (vfs.File, error) {
 }
 
 func (afs *aferoVFS) OpenFile(doc *vfs.FileDoc) (vfs.File, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
 	if lockerr := afs.mu.RLock(); lockerr != nil {
 		return nil, lockerr
 	}
@@ -484,6 +504,31 @@ func (afs *aferoVFS) OpenFile(doc *vfs.FileDoc) (vfs.File, error) {
 	return afs.openFile(doc)
 }
 
+func (afs *aferoVFS) OpenFileAt(doc *vfs.FileDoc, offset, length int64) (io.ReadCloser, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
+	if lockerr := afs.mu.RLock(); lockerr != nil {
+		return nil, lockerr
+	}
+	defer afs.mu.RUnlock()
+	f, err := afs.openFile(doc)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
 func (afs *aferoVFS) EnsureErased(journal vfs.TrashJournal) error {
 	return errors.New("EnsureErased is only for Swift")
 }
@@ -583,6 +628,9 @@ func (afs *aferoVFS) UpdateFileDoc(olddoc, newdoc *vfs.FileDoc) error {
 		return lockerr
 	}
 	defer afs.mu.Unlock()
+	if err := vfs.CheckUploadPolicyOnUpdate(afs.context, olddoc, newdoc); err != nil {
+		return err
+	}
 	if newdoc.DirID != olddoc.DirID || newdoc.DocName != olddoc.DocName {
 		oldpath, err := afs.Indexer.FilePath(olddoc)
 		if err != nil {
@@ -723,6 +771,7 @@ type aferoFileCreation struct {
 	size    int64              // total file size, -1 if unknown
 	maxsize int64              // maximum size allowed for the file
 	capsize int64              // size cap from which we send a notification to the user
+	policy  *vfs.UploadPolicy  // upload policy of the context, for the size
 	hash    hash.Hash          // hash we build up along the file
 	meta    *vfs.MetaExtractor // extracts metadata from the content
 	err     error              // write error
@@ -759,6 +808,10 @@ func (f *aferoFileCreation) Write(p []byte) (int, error) {
 		f.err = vfs.ErrFileTooBig
 		return n, f.err
 	}
+	if err := f.policy.CheckWritten(f.w); err != nil {
+		f.err = err
+		return n, f.err
+	}
 
 	if f.size >= 0 && f.w > f.size {
 		f.err = vfs.ErrContentLengthMismatch
@@ -769,6 +822,14 @@ func (f *aferoFileCreation) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// CancelWithError makes the Close fail with the given error, so that the
+// content is not committed.
+func (f *aferoFileCreation) CancelWithError(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
 func (f *aferoFileCreation) Close() (err error) {
 	defer func() {
 		if err != nil {
@@ -895,9 +956,13 @@ func (f *aferoFileCreation) Close() (err error) {
 			vPath := pathForVersion(v)
 			_ = f.afs.fs.Remove(vPath)
 		}
+		var reclaimed int64
 		for _, old := range toClean {
-			_ = cleanOldVersion(f.afs, old)
+			if cleanOldVersion(f.afs, old) == nil {
+				reclaimed += old.ByteSize
+			}
 		}
+		metrics.VersionsReclaimedBytes.WithLabelValues("write").Add(float64(reclaimed))
 	}
 
 	if f.capsize > 0 && f.size >= f.capsize {
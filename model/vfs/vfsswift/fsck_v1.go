@@ -202,3 +202,11 @@ func objectToFileDocV1(container string, object swift.Object) *vfs.TreeFile {
 		},
 	}
 }
+
+func (sfs *swiftVFS) ReclaimOrphan(log *vfs.FsckLog) error {
+	return vfs.ErrFsckNotSupported
+}
+
+func (sfs *swiftVFS) RestoreOrphan(log *vfs.FsckLog) error {
+	return vfs.ErrFsckNotSupported
+}
@@ -140,3 +140,11 @@ func objectToFileDocV2(container string, object swift.Object) *vfs.TreeFile {
 		},
 	}
 }
+
+func (sfs *swiftVFSV2) ReclaimOrphan(log *vfs.FsckLog) error {
+	return vfs.ErrFsckNotSupported
+}
+
+func (sfs *swiftVFSV2) RestoreOrphan(log *vfs.FsckLog) error {
+	return vfs.ErrFsckNotSupported
+}
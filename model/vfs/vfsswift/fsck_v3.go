@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"os"
 	"path"
 	"strings"
 
@@ -58,7 +59,10 @@ func (sfs *swiftVFSV3) checkFiles(
 		if erru := json.Unmarshal(data, v); erru != nil {
 			return erru
 		}
-		versions[v.DocID] = v
+		// The contents in the cold storage are not checked
+		if !v.Cold {
+			versions[v.DocID] = v
+		}
 		return nil
 	})
 	if err != nil {
@@ -80,8 +84,12 @@ func (sfs *swiftVFSV3) checkFiles(
 	}
 
 	fileIDs := make(map[string]struct{}, len(entries))
-	for _, f := range entries {
+	for key, f := range entries {
 		fileIDs[f.DocID] = struct{}{}
+		// The contents in the cold storage are not checked
+		if f.Cold {
+			delete(entries, key)
+		}
 	}
 
 	opts := &swift.ObjectsOpts{Limit: 10_000}
@@ -239,3 +247,61 @@ func objectToFileDocV3(container string, object swift.Object) *vfs.TreeFile {
 		},
 	}
 }
+
+func (sfs *swiftVFSV3) ReclaimOrphan(log *vfs.FsckLog) error {
+	if log.FileDoc == nil {
+		return vfs.ErrFsckNotOrphan
+	}
+	var objName string
+	switch log.Type {
+	case vfs.IndexMissing:
+		objName = MakeObjectNameV3(log.FileDoc.DocID, log.FileDoc.InternalID)
+	case vfs.ThumbnailWithNoFile:
+		objName = log.FileDoc.DocName
+	default:
+		return vfs.ErrFsckNotOrphan
+	}
+	err := sfs.c.ObjectDelete(sfs.ctx, sfs.container, objName)
+	if errors.Is(err, swift.ObjectNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (sfs *swiftVFSV3) RestoreOrphan(log *vfs.FsckLog) error {
+	if log.Type != vfs.IndexMissing || log.FileDoc == nil {
+		return vfs.ErrFsckNotOrphan
+	}
+	orphan := log.FileDoc
+	_, err := sfs.Indexer.FileByID(orphan.DocID)
+	if err == nil {
+		// The object is an old content of a file that is still in the index
+		v := &vfs.Version{
+			DocID:     orphan.DocID + "/" + orphan.InternalID,
+			UpdatedAt: orphan.UpdatedAt,
+			ByteSize:  orphan.ByteSize,
+			MD5Sum:    orphan.MD5Sum,
+			Tags:      []string{},
+		}
+		v.Rels.File.Data.ID = orphan.DocID
+		v.Rels.File.Data.Type = consts.Files
+		return sfs.Indexer.CreateVersion(v)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, err := vfs.MkdirAll(sfs, vfs.OrphansDirName)
+	if err != nil {
+		return err
+	}
+	doc, err := vfs.NewFileDoc(orphan.DocID, dir.DocID, orphan.ByteSize, orphan.MD5Sum,
+		orphan.Mime, orphan.Class, orphan.CreatedAt, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	doc.SetID(orphan.DocID)
+	doc.InternalID = orphan.InternalID
+	doc.CozyMetadata = vfs.NewCozyMetadata("")
+	return sfs.Indexer.CreateNamedFileDoc(doc)
+}
@@ -1,7 +1,6 @@
 package vfsswift
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
@@ -12,10 +11,10 @@ import (
 
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/lock"
 	"github.com/cozy/cozy-stack/pkg/logger"
-	"github.com/cozy/cozy-stack/pkg/prefixer"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/ncw/swift/v2"
 )
@@ -36,6 +35,7 @@ type swiftVFS struct {
 	cluster       int
 	domain        string
 	prefix        string
+	context       string
 	container     string
 	version       string
 	dataContainer string
@@ -46,7 +46,7 @@ type swiftVFS struct {
 
 // New returns a vfs.VFS instance associated with the specified indexer and the
 // swift storage url.
-func New(db prefixer.Prefixer, index vfs.Indexer, disk vfs.DiskThresholder, mu lock.ErrorRWLocker) (vfs.VFS, error) {
+func New(db vfs.Prefixer, index vfs.Indexer, disk vfs.DiskThresholder, mu lock.ErrorRWLocker) (vfs.VFS, error) {
 	return &swiftVFS{
 		Indexer:         index,
 		DiskThresholder: disk,
@@ -55,6 +55,7 @@ func New(db prefixer.Prefixer, index vfs.Indexer, disk vfs.DiskThresholder, mu l
 		cluster:       db.DBCluster(),
 		domain:        db.DomainName(),
 		prefix:        db.DBPrefix(),
+		context:       db.GetContextName(),
 		container:     swiftV1ContainerPrefix + db.DBPrefix(),
 		version:       swiftV1ContainerPrefix + db.DBPrefix() + versionSuffix,
 		dataContainer: swiftV1DataContainerPrefix + db.DomainName(),
@@ -91,6 +92,7 @@ func (sfs *swiftVFS) UseSharingIndexer(index vfs.Indexer) vfs.VFS {
 		c:               sfs.c,
 		domain:          sfs.domain,
 		prefix:          sfs.prefix,
+		context:         sfs.context,
 		container:       sfs.container,
 		version:         sfs.version,
 		mu:              sfs.mu,
@@ -233,6 +235,10 @@ func (sfs *swiftVFS) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.CreateO
 	if maxsize <= 0 || (newsize >= 0 && (newsize-oldsize) > maxsize) {
 		return nil, vfs.ErrFileTooBig
 	}
+	policy, err := vfs.CheckUploadPolicy(sfs.context, newdoc)
+	if err != nil {
+		return nil, err
+	}
 
 	if olddoc != nil {
 		newdoc.SetID(olddoc.ID())
@@ -305,10 +311,14 @@ func (sfs *swiftVFS) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.CreateO
 		olddoc:  olddoc,
 		maxsize: maxsize,
 		capsize: capsize,
+		policy:  policy,
 	}, nil
 }
 
 func (sfs *swiftVFS) DestroyDirContent(doc *vfs.DirDoc, push func(vfs.TrashJournal) error) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -322,6 +332,9 @@ func (sfs *swiftVFS) DestroyDirContent(doc *vfs.DirDoc, push func(vfs.TrashJourn
 }
 
 func (sfs *swiftVFS) DestroyDirAndContent(doc *vfs.DirDoc, push func(vfs.TrashJournal) error) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -335,6 +348,9 @@ func (sfs *swiftVFS) DestroyDirAndContent(doc *vfs.DirDoc, push func(vfs.TrashJo
 }
 
 func (sfs *swiftVFS) DestroyFile(doc *vfs.FileDoc) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -423,18 +439,35 @@ func (sfs *swiftVFS) EnsureErased(journal vfs.TrashJournal) error {
 }
 
 func (sfs *swiftVFS) OpenFile(doc *vfs.FileDoc) (vfs.File, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
 	if lockerr := sfs.mu.RLock(); lockerr != nil {
 		return nil, lockerr
 	}
 	defer sfs.mu.RUnlock()
-	f, _, err := sfs.c.ObjectOpen(sfs.ctx, sfs.container, doc.DirID+"/"+doc.DocName, false, nil)
+	objName := doc.DirID + "/" + doc.DocName
+	f, h, err := sfs.c.ObjectOpen(sfs.ctx, sfs.container, objName, false, nil)
 	if errors.Is(err, swift.ObjectNotFound) {
 		return nil, os.ErrNotExist
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &swiftFileOpen{f, nil}, nil
+	r := newObjectReaderAt(sfs.ctx, sfs.c, sfs.container, objName, h)
+	return &swiftFileOpen{f, r}, nil
+}
+
+func (sfs *swiftVFS) OpenFileAt(doc *vfs.FileDoc, offset, length int64) (io.ReadCloser, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
+	if lockerr := sfs.mu.RLock(); lockerr != nil {
+		return nil, lockerr
+	}
+	defer sfs.mu.RUnlock()
+	objName := doc.DirID + "/" + doc.DocName
+	return openObjectAt(sfs.ctx, sfs.c, sfs.container, objName, offset, length, "")
 }
 
 func (sfs *swiftVFS) CopyFile(olddoc, newdoc *vfs.FileDoc) error {
@@ -510,6 +543,9 @@ func (sfs *swiftVFS) UpdateFileDoc(olddoc, newdoc *vfs.FileDoc) error {
 		return lockerr
 	}
 	defer sfs.mu.Unlock()
+	if err := vfs.CheckUploadPolicyOnUpdate(sfs.context, olddoc, newdoc); err != nil {
+		return err
+	}
 	if newdoc.DirID != olddoc.DirID || newdoc.DocName != olddoc.DocName {
 		exists, err := sfs.Indexer.DirChildExists(newdoc.DirID, newdoc.DocName)
 		if err != nil {
@@ -629,6 +665,7 @@ type swiftFileCreation struct {
 	olddoc  *vfs.FileDoc
 	maxsize int64
 	capsize int64
+	policy  *vfs.UploadPolicy
 }
 
 func (f *swiftFileCreation) Read(p []byte) (int, error) {
@@ -662,6 +699,10 @@ func (f *swiftFileCreation) Write(p []byte) (int, error) {
 		f.err = vfs.ErrFileTooBig
 		return n, f.err
 	}
+	if err := f.policy.CheckWritten(f.w); err != nil {
+		f.err = err
+		return n, f.err
+	}
 
 	if f.size >= 0 && f.w > f.size {
 		f.err = vfs.ErrContentLengthMismatch
@@ -671,6 +712,14 @@ func (f *swiftFileCreation) Write(p []byte) (int, error) {
 	return n, nil
 }
 
+// CancelWithError makes the Close fail with the given error, so that the
+// content is not committed.
+func (f *swiftFileCreation) CancelWithError(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
 func (f *swiftFileCreation) Close() (err error) {
 	defer func() {
 		if err == nil {
@@ -778,8 +827,8 @@ func (f *swiftFileCreation) Close() (err error) {
 }
 
 type swiftFileOpen struct {
-	f  *swift.ObjectOpenFile
-	br *bytes.Reader
+	f *swift.ObjectOpenFile
+	r *objectReaderAt
 }
 
 func (f *swiftFileOpen) Read(p []byte) (int, error) {
@@ -787,14 +836,7 @@ func (f *swiftFileOpen) Read(p []byte) (int, error) {
 }
 
 func (f *swiftFileOpen) ReadAt(p []byte, off int64) (int, error) {
-	if f.br == nil {
-		buf, err := io.ReadAll(f.f)
-		if err != nil {
-			return 0, err
-		}
-		f.br = bytes.NewReader(buf)
-	}
-	return f.br.ReadAt(p, off)
+	return f.r.ReadAt(p, off)
 }
 
 func (f *swiftFileOpen) Seek(offset int64, whence int) (int64, error) {
@@ -811,6 +853,7 @@ func (f *swiftFileOpen) Write(p []byte) (int, error) {
 }
 
 func (f *swiftFileOpen) Close() error {
+	_ = f.r.Close()
 	return f.f.Close()
 }
 
@@ -1,7 +1,6 @@
 package vfsswift
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
@@ -13,10 +12,10 @@ import (
 
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/lock"
 	"github.com/cozy/cozy-stack/pkg/logger"
-	"github.com/cozy/cozy-stack/pkg/prefixer"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/ncw/swift/v2"
 )
@@ -28,6 +27,7 @@ type swiftVFSV2 struct {
 	cluster       int
 	domain        string
 	prefix        string
+	context       string
 	container     string
 	version       string
 	dataContainer string
@@ -47,7 +47,7 @@ const (
 // This version implements a simpler layout where swift does not contain any
 // hierarchy: meaning no index informations. This help with index incoherency
 // and as many performance improvements regarding moving / renaming folders.
-func NewV2(db prefixer.Prefixer, index vfs.Indexer, disk vfs.DiskThresholder, mu lock.ErrorRWLocker) (vfs.VFS, error) {
+func NewV2(db vfs.Prefixer, index vfs.Indexer, disk vfs.DiskThresholder, mu lock.ErrorRWLocker) (vfs.VFS, error) {
 	return &swiftVFSV2{
 		Indexer:         index,
 		DiskThresholder: disk,
@@ -56,6 +56,7 @@ func NewV2(db prefixer.Prefixer, index vfs.Indexer, disk vfs.DiskThresholder, mu
 		cluster:       db.DBCluster(),
 		domain:        db.DomainName(),
 		prefix:        db.DBPrefix(),
+		context:       db.GetContextName(),
 		container:     swiftV2ContainerPrefixCozy + db.DBPrefix(),
 		version:       swiftV2ContainerPrefixCozy + db.DBPrefix() + versionSuffix,
 		dataContainer: swiftV2ContainerPrefixData + db.DBPrefix(),
@@ -109,6 +110,7 @@ func (sfs *swiftVFSV2) UseSharingIndexer(index vfs.Indexer) vfs.VFS {
 		c:               sfs.c,
 		domain:          sfs.domain,
 		prefix:          sfs.prefix,
+		context:         sfs.context,
 		container:       sfs.container,
 		version:         sfs.version,
 		dataContainer:   sfs.dataContainer,
@@ -241,6 +243,10 @@ func (sfs *swiftVFSV2) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.Creat
 	if maxsize <= 0 || (newsize >= 0 && (newsize-oldsize) > maxsize) {
 		return nil, vfs.ErrFileTooBig
 	}
+	policy, err := vfs.CheckUploadPolicy(sfs.context, newdoc)
+	if err != nil {
+		return nil, err
+	}
 
 	if olddoc != nil {
 		newdoc.SetID(olddoc.ID())
@@ -318,10 +324,14 @@ func (sfs *swiftVFSV2) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.Creat
 		olddoc:  olddoc,
 		maxsize: maxsize,
 		capsize: capsize,
+		policy:  policy,
 	}, nil
 }
 
 func (sfs *swiftVFSV2) DestroyDirContent(doc *vfs.DirDoc, push func(vfs.TrashJournal) error) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -344,6 +354,9 @@ func (sfs *swiftVFSV2) DestroyDirContent(doc *vfs.DirDoc, push func(vfs.TrashJou
 }
 
 func (sfs *swiftVFSV2) DestroyDirAndContent(doc *vfs.DirDoc, push func(vfs.TrashJournal) error) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -366,6 +379,9 @@ func (sfs *swiftVFSV2) DestroyDirAndContent(doc *vfs.DirDoc, push func(vfs.Trash
 }
 
 func (sfs *swiftVFSV2) DestroyFile(doc *vfs.FileDoc) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -422,19 +438,35 @@ func (sfs *swiftVFSV2) EnsureErased(journal vfs.TrashJournal) error {
 }
 
 func (sfs *swiftVFSV2) OpenFile(doc *vfs.FileDoc) (vfs.File, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
 	if lockerr := sfs.mu.RLock(); lockerr != nil {
 		return nil, lockerr
 	}
 	defer sfs.mu.RUnlock()
 	objName := MakeObjectName(doc.DocID)
-	f, _, err := sfs.c.ObjectOpen(sfs.ctx, sfs.container, objName, false, nil)
+	f, h, err := sfs.c.ObjectOpen(sfs.ctx, sfs.container, objName, false, nil)
 	if errors.Is(err, swift.ObjectNotFound) {
 		return nil, os.ErrNotExist
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &swiftFileOpenV2{f, nil}, nil
+	r := newObjectReaderAt(sfs.ctx, sfs.c, sfs.container, objName, h)
+	return &swiftFileOpenV2{f, r}, nil
+}
+
+func (sfs *swiftVFSV2) OpenFileAt(doc *vfs.FileDoc, offset, length int64) (io.ReadCloser, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
+	if lockerr := sfs.mu.RLock(); lockerr != nil {
+		return nil, lockerr
+	}
+	defer sfs.mu.RUnlock()
+	objName := MakeObjectName(doc.DocID)
+	return openObjectAt(sfs.ctx, sfs.c, sfs.container, objName, offset, length, "")
 }
 
 func (sfs *swiftVFSV2) CopyFile(olddoc, newdoc *vfs.FileDoc) error {
@@ -512,6 +544,9 @@ func (sfs *swiftVFSV2) UpdateFileDoc(olddoc, newdoc *vfs.FileDoc) error {
 		return lockerr
 	}
 	defer sfs.mu.Unlock()
+	if err := vfs.CheckUploadPolicyOnUpdate(sfs.context, olddoc, newdoc); err != nil {
+		return err
+	}
 	if newdoc.DirID != olddoc.DirID || newdoc.DocName != olddoc.DocName {
 		exists, err := sfs.Indexer.DirChildExists(newdoc.DirID, newdoc.DocName)
 		if err != nil {
@@ -615,6 +650,7 @@ type swiftFileCreationV2 struct {
 	olddoc  *vfs.FileDoc
 	maxsize int64
 	capsize int64
+	policy  *vfs.UploadPolicy
 }
 
 func (f *swiftFileCreationV2) Read(p []byte) (int, error) {
@@ -648,6 +684,10 @@ func (f *swiftFileCreationV2) Write(p []byte) (int, error) {
 		f.err = vfs.ErrFileTooBig
 		return n, f.err
 	}
+	if err := f.policy.CheckWritten(f.w); err != nil {
+		f.err = err
+		return n, f.err
+	}
 
 	if f.size >= 0 && f.w > f.size {
 		f.err = vfs.ErrContentLengthMismatch
@@ -657,6 +697,14 @@ func (f *swiftFileCreationV2) Write(p []byte) (int, error) {
 	return n, nil
 }
 
+// CancelWithError makes the Close fail with the given error, so that the
+// content is not committed.
+func (f *swiftFileCreationV2) CancelWithError(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
 func (f *swiftFileCreationV2) Close() (err error) {
 	defer func() {
 		if err == nil {
@@ -764,8 +812,8 @@ func (f *swiftFileCreationV2) Close() (err error) {
 }
 
 type swiftFileOpenV2 struct {
-	f  *swift.ObjectOpenFile
-	br *bytes.Reader
+	f *swift.ObjectOpenFile
+	r *objectReaderAt
 }
 
 func (f *swiftFileOpenV2) Read(p []byte) (int, error) {
@@ -773,14 +821,7 @@ func (f *swiftFileOpenV2) Read(p []byte) (int, error) {
 }
 
 func (f *swiftFileOpenV2) ReadAt(p []byte, off int64) (int, error) {
-	if f.br == nil {
-		buf, err := io.ReadAll(f.f)
-		if err != nil {
-			return 0, err
-		}
-		f.br = bytes.NewReader(buf)
-	}
-	return f.br.ReadAt(p, off)
+	return f.r.ReadAt(p, off)
 }
 
 func (f *swiftFileOpenV2) Seek(offset int64, whence int) (int64, error) {
@@ -796,6 +837,7 @@ func (f *swiftFileOpenV2) Write(p []byte) (int, error) {
 }
 
 func (f *swiftFileOpenV2) Close() error {
+	_ = f.r.Close()
 	return f.f.Close()
 }
 
@@ -12,9 +12,11 @@ import (
 
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/lock"
 	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/cozy/cozy-stack/pkg/metrics"
 	"github.com/cozy/cozy-stack/pkg/utils"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/ncw/swift/v2"
@@ -122,6 +124,7 @@ func (sfs *swiftVFSV3) UseSharingIndexer(index vfs.Indexer) vfs.VFS {
 		c:               sfs.c,
 		domain:          sfs.domain,
 		prefix:          sfs.prefix,
+		context:         sfs.context,
 		container:       sfs.container,
 		mu:              sfs.mu,
 		ctx:             context.Background(),
@@ -158,6 +161,18 @@ func (sfs *swiftVFSV3) Delete() error {
 		sfs.log.Errorf("Could not mark container %q as to-be-deleted: %s",
 			sfs.container, err)
 	}
+	cold := sfs.containerFor(true)
+	if replica := config.GetSwiftReplicaConnection(); replica != nil {
+		for _, container := range []string{sfs.container, cold} {
+			if err := DeleteContainer(sfs.ctx, replica, container); err != nil {
+				sfs.log.Errorf("Could not delete the replica of container %q: %s",
+					container, err)
+			}
+		}
+	}
+	if err := DeleteContainer(sfs.ctx, sfs.c, cold); err != nil {
+		sfs.log.Errorf("Could not delete container %q: %s", cold, err)
+	}
 	return DeleteContainer(sfs.ctx, sfs.c, sfs.container)
 }
 
@@ -189,6 +204,10 @@ func (sfs *swiftVFSV3) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.Creat
 	if err != nil {
 		return nil, err
 	}
+	policy, err := vfs.CheckUploadPolicy(sfs.context, newdoc)
+	if err != nil {
+		return nil, err
+	}
 	if newsize > maxsize {
 		return nil, vfs.ErrFileTooBig
 	}
@@ -227,6 +246,7 @@ func (sfs *swiftVFSV3) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.Creat
 	}
 
 	newdoc.InternalID = NewInternalID()
+	newdoc.Cold = false
 	objName := MakeObjectNameV3(newdoc.DocID, newdoc.InternalID)
 	hash := hex.EncodeToString(newdoc.MD5Sum)
 	f, err := sfs.c.ObjectCreate(sfs.ctx, sfs.container, objName, true, hash, newdoc.Mime, nil)
@@ -245,6 +265,7 @@ func (sfs *swiftVFSV3) CreateFile(newdoc, olddoc *vfs.FileDoc, opts ...vfs.Creat
 		size:    newsize,
 		maxsize: maxsize,
 		capsize: capsize,
+		policy:  policy,
 		meta:    extractor,
 	}, nil
 }
@@ -264,6 +285,7 @@ func (sfs *swiftVFSV3) CopyFile(olddoc, newdoc *vfs.FileDoc) error {
 		return err
 	}
 	newdoc.InternalID = NewInternalID()
+	newdoc.Cold = false
 
 	// Copy the file
 	srcName := MakeObjectNameV3(olddoc.DocID, olddoc.InternalID)
@@ -273,13 +295,15 @@ func (sfs *swiftVFSV3) CopyFile(olddoc, newdoc *vfs.FileDoc) error {
 		"created-at":    newdoc.CreatedAt.Format(time.RFC3339),
 		"copied-from":   olddoc.ID(),
 	}.ObjectHeaders()
-	if _, err := sfs.c.ObjectCopy(sfs.ctx, sfs.container, srcName, sfs.container, dstName, headers); err != nil {
+	srcContainer := sfs.containerFor(olddoc.Cold)
+	if _, err := sfs.c.ObjectCopy(sfs.ctx, srcContainer, srcName, sfs.container, dstName, headers); err != nil {
 		return err
 	}
 	if err := sfs.Indexer.CreateNamedFileDoc(newdoc); err != nil {
 		_ = sfs.c.ObjectDelete(sfs.ctx, sfs.container, dstName)
 		return err
 	}
+	sfs.journal(dstName)
 
 	if capsize > 0 && newsize >= capsize {
 		vfs.PushDiskQuotaAlert(sfs, true)
@@ -309,6 +333,7 @@ func (sfs *swiftVFSV3) DissociateFile(src, dst *vfs.FileDoc) error {
 		return err
 	}
 	dst.DocID = uuid
+	dst.Cold = false
 
 	// Copy the file
 	srcName := MakeObjectNameV3(src.DocID, src.InternalID)
@@ -318,13 +343,15 @@ func (sfs *swiftVFSV3) DissociateFile(src, dst *vfs.FileDoc) error {
 		"created-at":     src.CreatedAt.Format(time.RFC3339),
 		"dissociated-of": src.ID(),
 	}.ObjectHeaders()
-	if _, err := sfs.c.ObjectCopy(sfs.ctx, sfs.container, srcName, sfs.container, dstName, headers); err != nil {
+	srcContainer := sfs.containerFor(src.Cold)
+	if _, err := sfs.c.ObjectCopy(sfs.ctx, srcContainer, srcName, sfs.container, dstName, headers); err != nil {
 		return err
 	}
 	if err := sfs.Indexer.CreateNamedFileDoc(dst); err != nil {
 		_ = sfs.c.ObjectDelete(sfs.ctx, sfs.container, dstName)
 		return err
 	}
+	sfs.journal(dstName)
 
 	// Remove the source
 	thumbsFS := &thumbsV2{
@@ -361,6 +388,9 @@ func (sfs *swiftVFSV3) DissociateDir(src, dst *vfs.DirDoc) error {
 }
 
 func (sfs *swiftVFSV3) destroyDir(doc *vfs.DirDoc, push func(vfs.TrashJournal) error, onlyContent bool) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -375,14 +405,20 @@ func (sfs *swiftVFSV3) destroyDir(doc *vfs.DirDoc, push func(vfs.TrashJournal) e
 	}
 	vfs.DiskQuotaAfterDestroy(sfs, diskUsage, destroyed)
 	ids := make([]string, len(files))
-	objNames := make([]string, len(files))
+	var objNames, coldNames []string
 	for i, file := range files {
 		ids[i] = file.DocID
-		objNames[i] = MakeObjectNameV3(file.DocID, file.InternalID)
+		objName := MakeObjectNameV3(file.DocID, file.InternalID)
+		if file.Cold {
+			coldNames = append(coldNames, objName)
+		} else {
+			objNames = append(objNames, objName)
+		}
 	}
 	err = push(vfs.TrashJournal{
-		FileIDs:     ids,
-		ObjectNames: objNames,
+		FileIDs:         ids,
+		ObjectNames:     objNames,
+		ColdObjectNames: coldNames,
 	})
 	return err
 }
@@ -396,6 +432,9 @@ func (sfs *swiftVFSV3) DestroyDirAndContent(doc *vfs.DirDoc, push func(vfs.Trash
 }
 
 func (sfs *swiftVFSV3) DestroyFile(doc *vfs.FileDoc) error {
+	if err := couchdb.CheckDeletion(sfs, consts.Files); err != nil {
+		return err
+	}
 	if lockerr := sfs.mu.Lock(); lockerr != nil {
 		return lockerr
 	}
@@ -405,20 +444,31 @@ func (sfs *swiftVFSV3) DestroyFile(doc *vfs.FileDoc) error {
 
 func (sfs *swiftVFSV3) destroyFileLocked(doc *vfs.FileDoc) error {
 	diskUsage, _ := sfs.Indexer.DiskUsage()
-	objNames := []string{
-		MakeObjectNameV3(doc.DocID, doc.InternalID),
+	var objNames, coldNames []string
+	if doc.Cold {
+		coldNames = append(coldNames, MakeObjectNameV3(doc.DocID, doc.InternalID))
+	} else {
+		objNames = append(objNames, MakeObjectNameV3(doc.DocID, doc.InternalID))
 	}
 	if err := sfs.Indexer.DeleteFileDoc(doc); err != nil {
 		return err
 	}
-	destroyed := doc.ByteSize
+	var destroyed int64
+	if !doc.Cold {
+		destroyed = doc.ByteSize
+	}
 	if versions, errv := vfs.VersionsFor(sfs, doc.DocID); errv == nil {
 		for _, v := range versions {
 			internalID := v.DocID
 			if parts := strings.SplitN(v.DocID, "/", 2); len(parts) > 1 {
 				internalID = parts[1]
 			}
-			objNames = append(objNames, MakeObjectNameV3(doc.DocID, internalID))
+			objName := MakeObjectNameV3(doc.DocID, internalID)
+			if v.Cold {
+				coldNames = append(coldNames, objName)
+				continue
+			}
+			objNames = append(objNames, objName)
 			destroyed += v.ByteSize
 		}
 		err := sfs.Indexer.BatchDeleteVersions(versions)
@@ -437,6 +487,14 @@ func (sfs *swiftVFSV3) destroyFileLocked(doc *vfs.FileDoc) error {
 	if errb != nil {
 		sfs.log.Warnf("DestroyFile failed on BulkDelete: %s", errb)
 	}
+	sfs.journal(objNames...)
+	if len(coldNames) > 0 {
+		cold := sfs.containerFor(true)
+		if err := deleteContainerFiles(sfs.ctx, sfs.c, cold, coldNames); err != nil {
+			sfs.log.Warnf("DestroyFile failed on deleteContainerFiles for the cold storage: %s", err)
+		}
+		sfs.journalIn(cold, coldNames...)
+	}
 	vfs.DiskQuotaAfterDestroy(sfs, diskUsage, destroyed)
 	return nil
 }
@@ -445,6 +503,7 @@ func (sfs *swiftVFSV3) EnsureErased(journal vfs.TrashJournal) error {
 	// No lock needed
 	diskUsage, _ := sfs.Indexer.DiskUsage()
 	objNames := journal.ObjectNames
+	coldNames := journal.ColdObjectNames
 	var errm error
 	var destroyed int64
 	var allVersions []*vfs.Version
@@ -462,7 +521,12 @@ func (sfs *swiftVFSV3) EnsureErased(journal vfs.TrashJournal) error {
 			if parts := strings.SplitN(v.DocID, "/", 2); len(parts) > 1 {
 				internalID = parts[1]
 			}
-			objNames = append(objNames, MakeObjectNameV3(fileID, internalID))
+			objName := MakeObjectNameV3(fileID, internalID)
+			if v.Cold {
+				coldNames = append(coldNames, objName)
+				continue
+			}
+			objNames = append(objNames, objName)
 			destroyed += v.ByteSize
 		}
 		allVersions = append(allVersions, versions...)
@@ -475,24 +539,54 @@ func (sfs *swiftVFSV3) EnsureErased(journal vfs.TrashJournal) error {
 		sfs.log.Warnf("EnsureErased failed on deleteContainerFiles: %s", err)
 		errm = multierror.Append(errm, err)
 	}
+	sfs.journal(objNames...)
+	if len(coldNames) > 0 {
+		cold := sfs.containerFor(true)
+		if err := deleteContainerFiles(sfs.ctx, sfs.c, cold, coldNames); err != nil {
+			sfs.log.Warnf("EnsureErased failed on deleteContainerFiles for the cold storage: %s", err)
+			errm = multierror.Append(errm, err)
+		}
+		sfs.journalIn(cold, coldNames...)
+	}
 	vfs.DiskQuotaAfterDestroy(sfs, diskUsage, destroyed)
 	return errm
 }
 
 func (sfs *swiftVFSV3) OpenFile(doc *vfs.FileDoc) (vfs.File, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
 	if lockerr := sfs.mu.RLock(); lockerr != nil {
 		return nil, lockerr
 	}
 	defer sfs.mu.RUnlock()
 	objName := MakeObjectNameV3(doc.DocID, doc.InternalID)
-	f, _, err := sfs.c.ObjectOpen(sfs.ctx, sfs.container, objName, false, nil)
+	c := sfs.readConn()
+	f, h, container, err := sfs.openObject(c, doc.Cold, objName)
 	if errors.Is(err, swift.ObjectNotFound) {
 		return nil, os.ErrNotExist
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &swiftFileOpenV3{f, nil}, nil
+	r := newObjectReaderAt(sfs.ctx, c, container, objName, h)
+	return &swiftFileOpenV3{f, r}, nil
+}
+
+func (sfs *swiftVFSV3) OpenFileAt(doc *vfs.FileDoc, offset, length int64) (io.ReadCloser, error) {
+	if err := vfs.CheckNotQuarantined(doc); err != nil {
+		return nil, err
+	}
+	if lockerr := sfs.mu.RLock(); lockerr != nil {
+		return nil, lockerr
+	}
+	defer sfs.mu.RUnlock()
+	objName := MakeObjectNameV3(doc.DocID, doc.InternalID)
+	f, err := openObjectAt(sfs.ctx, sfs.readConn(), sfs.containerFor(doc.Cold), objName, offset, length, "")
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = openObjectAt(sfs.ctx, sfs.readConn(), sfs.containerFor(!doc.Cold), objName, offset, length, "")
+	}
+	return f, err
 }
 
 func (sfs *swiftVFSV3) OpenFileVersion(doc *vfs.FileDoc, version *vfs.Version) (vfs.File, error) {
@@ -505,14 +599,16 @@ func (sfs *swiftVFSV3) OpenFileVersion(doc *vfs.FileDoc, version *vfs.Version) (
 		internalID = parts[1]
 	}
 	objName := MakeObjectNameV3(doc.DocID, internalID)
-	f, _, err := sfs.c.ObjectOpen(sfs.ctx, sfs.container, objName, false, nil)
+	c := sfs.readConn()
+	f, h, container, err := sfs.openObject(c, version.Cold, objName)
 	if errors.Is(err, swift.ObjectNotFound) {
 		return nil, os.ErrNotExist
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &swiftFileOpenV3{f, nil}, nil
+	r := newObjectReaderAt(sfs.ctx, c, container, objName, h)
+	return &swiftFileOpenV3{f, r}, nil
 }
 
 func (sfs *swiftVFSV3) ImportFileVersion(version *vfs.Version, content io.ReadCloser) error {
@@ -537,6 +633,7 @@ func (sfs *swiftVFSV3) ImportFileVersion(version *vfs.Version, content io.ReadCl
 		return vfs.ErrIllegalFilename
 	}
 	objName := MakeObjectNameV3(parts[0], parts[1])
+	version.Cold = false
 
 	hash := hex.EncodeToString(version.MD5Sum)
 	f, err := sfs.c.ObjectCreate(sfs.ctx, sfs.container, objName, true, hash, "application/octet-stream", nil)
@@ -557,6 +654,7 @@ func (sfs *swiftVFSV3) ImportFileVersion(version *vfs.Version, content io.ReadCl
 		}
 		return err
 	}
+	sfs.journal(objName)
 
 	return sfs.Indexer.CreateVersion(version)
 }
@@ -577,6 +675,7 @@ func (sfs *swiftVFSV3) RevertFileVersion(doc *vfs.FileDoc, version *vfs.Version)
 		newdoc.InternalID = parts[1]
 	}
 	vfs.SetMetaFromVersion(newdoc, version)
+	newdoc.Cold = version.Cold
 	if err := sfs.Indexer.UpdateFileDoc(doc, newdoc); err != nil {
 		_ = sfs.Indexer.DeleteVersion(save)
 		return err
@@ -596,6 +695,9 @@ func (sfs *swiftVFSV3) UpdateFileDoc(olddoc, newdoc *vfs.FileDoc) error {
 		return lockerr
 	}
 	defer sfs.mu.Unlock()
+	if err := vfs.CheckUploadPolicyOnUpdate(sfs.context, olddoc, newdoc); err != nil {
+		return err
+	}
 	if newdoc.DirID != olddoc.DirID || newdoc.DocName != olddoc.DocName {
 		exists, err := sfs.Indexer.DirChildExists(newdoc.DirID, newdoc.DocName)
 		if err != nil {
@@ -705,6 +807,7 @@ type swiftFileCreationV3 struct {
 	size    int64
 	maxsize int64
 	capsize int64
+	policy  *vfs.UploadPolicy
 	meta    *vfs.MetaExtractor
 	err     error
 }
@@ -740,6 +843,10 @@ func (f *swiftFileCreationV3) Write(p []byte) (int, error) {
 		f.err = vfs.ErrFileTooBig
 		return n, f.err
 	}
+	if err := f.policy.CheckWritten(f.w); err != nil {
+		f.err = err
+		return n, f.err
+	}
 
 	if f.size >= 0 && f.w > f.size {
 		f.err = vfs.ErrContentLengthMismatch
@@ -749,6 +856,14 @@ func (f *swiftFileCreationV3) Write(p []byte) (int, error) {
 	return n, nil
 }
 
+// CancelWithError makes the Close fail with the given error, so that the
+// content is not committed.
+func (f *swiftFileCreationV3) CancelWithError(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
 func (f *swiftFileCreationV3) Close() (err error) {
 	defer func() {
 		if err != nil {
@@ -876,13 +991,21 @@ func (f *swiftFileCreationV3) Close() (err error) {
 				internalID = parts[1]
 			}
 			objName := MakeObjectNameV3(newdoc.DocID, internalID)
-			_ = f.fs.c.ObjectDelete(f.fs.ctx, f.fs.container, objName)
+			container := f.fs.containerFor(v.Cold)
+			_ = f.fs.c.ObjectDelete(f.fs.ctx, container, objName)
+			f.fs.journalIn(container, objName)
 		}
+		var reclaimed int64
 		for _, old := range toClean {
-			_ = cleanOldVersion(f.fs, newdoc.DocID, old)
+			if cleanOldVersion(f.fs, newdoc.DocID, old) == nil {
+				reclaimed += old.ByteSize
+			}
 		}
+		metrics.VersionsReclaimedBytes.WithLabelValues("write").Add(float64(reclaimed))
 	}
 
+	f.fs.journal(f.name)
+
 	if f.capsize > 0 && f.size >= f.capsize {
 		vfs.PushDiskQuotaAlert(f.fs, true)
 	}
@@ -907,7 +1030,10 @@ func cleanOldVersion(sfs *swiftVFSV3, fileID string, v *vfs.Version) error {
 		internalID = parts[1]
 	}
 	objName := MakeObjectNameV3(fileID, internalID)
-	return sfs.c.ObjectDelete(sfs.ctx, sfs.container, objName)
+	container := sfs.containerFor(v.Cold)
+	err := sfs.c.ObjectDelete(sfs.ctx, container, objName)
+	sfs.journalIn(container, objName)
+	return err
 }
 
 func (sfs *swiftVFSV3) ClearOldVersions() error {
@@ -920,9 +1046,15 @@ func (sfs *swiftVFSV3) ClearOldVersions() error {
 	if err != nil {
 		return err
 	}
-	var objNames []string
+	var objNames, coldNames []string
 	var destroyed int64
 	for _, v := range versions {
+		if v.Cold {
+			if parts := strings.SplitN(v.DocID, "/", 2); len(parts) > 1 {
+				coldNames = append(coldNames, MakeObjectNameV3(parts[0], parts[1]))
+			}
+			continue
+		}
 		if parts := strings.SplitN(v.DocID, "/", 2); len(parts) > 1 {
 			objNames = append(objNames, MakeObjectNameV3(parts[0], parts[1]))
 		}
@@ -932,12 +1064,21 @@ func (sfs *swiftVFSV3) ClearOldVersions() error {
 		return err
 	}
 	vfs.DiskQuotaAfterDestroy(sfs, diskUsage, destroyed)
-	return deleteContainerFiles(sfs.ctx, sfs.c, sfs.container, objNames)
+	err = deleteContainerFiles(sfs.ctx, sfs.c, sfs.container, objNames)
+	sfs.journal(objNames...)
+	if len(coldNames) > 0 {
+		cold := sfs.containerFor(true)
+		if errc := deleteContainerFiles(sfs.ctx, sfs.c, cold, coldNames); err == nil {
+			err = errc
+		}
+		sfs.journalIn(cold, coldNames...)
+	}
+	return err
 }
 
 type swiftFileOpenV3 struct {
-	f  *swift.ObjectOpenFile
-	br *bytes.Reader
+	f *swift.ObjectOpenFile
+	r *objectReaderAt
 }
 
 func (f *swiftFileOpenV3) Read(p []byte) (int, error) {
@@ -945,14 +1086,7 @@ func (f *swiftFileOpenV3) Read(p []byte) (int, error) {
 }
 
 func (f *swiftFileOpenV3) ReadAt(p []byte, off int64) (int, error) {
-	if f.br == nil {
-		buf, err := io.ReadAll(f.f)
-		if err != nil {
-			return 0, err
-		}
-		f.br = bytes.NewReader(buf)
-	}
-	return f.br.ReadAt(p, off)
+	return f.r.ReadAt(p, off)
 }
 
 func (f *swiftFileOpenV3) Seek(offset int64, whence int) (int64, error) {
@@ -968,6 +1102,7 @@ func (f *swiftFileOpenV3) Write(p []byte) (int, error) {
 }
 
 func (f *swiftFileOpenV3) Close() error {
+	_ = f.r.Close()
 	return f.f.Close()
 }
 
@@ -0,0 +1,440 @@
+package vfsswift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/ncw/swift/v2"
+)
+
+// journalBatchSize is the number of journal entries processed at once by the
+// replication.
+const journalBatchSize = 100
+
+// journalMaxAttempts is the number of times the replication of an entry is
+// tried before it is put aside as a dead letter.
+const journalMaxAttempts = 5
+
+// reconcileBatchSize is the number of objects listed at once by the
+// reconciliation.
+const reconcileBatchSize = 1000
+
+// largeObjectThreshold is the size above which an object can't be put in a
+// single request, and is copied as a static large object.
+const largeObjectThreshold = 5 * 1024 * 1024 * 1024
+
+// largeObjectSegmentSize is the size of the segments for the large objects
+// copied to the secondary endpoint.
+const largeObjectSegmentSize = 1024 * 1024 * 1024
+
+// ScheduleReplication is called before an entry is added to the journal, to
+// ensure that the replication will be executed for the instance. It is set by
+// the replication worker.
+var ScheduleReplication func(db vfs.Prefixer) error
+
+// JournalEntry is a document of the journal of the objects written or deleted
+// in the Swift container of an instance. The journal is used to replicate
+// these objects asynchronously to the secondary endpoint. The operation is
+// not recorded, as the replication looks at the state of the object on the
+// primary endpoint, and the entries can then be processed in any order.
+//
+// An entry that has failed too many times is kept as a dead letter: it is
+// skipped by the replication, and removed by the reconciliation.
+type JournalEntry struct {
+	DocID      string    `json:"_id,omitempty"`
+	DocRev     string    `json:"_rev,omitempty"`
+	Container  string    `json:"container"`
+	Objects    []string  `json:"objects"`
+	CreatedAt  time.Time `json:"created_at"`
+	Attempts   int       `json:"attempts,omitempty"`
+	DeadLetter bool      `json:"dead_letter,omitempty"`
+}
+
+// ID implements the couchdb.Doc interface
+func (e *JournalEntry) ID() string { return e.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (e *JournalEntry) Rev() string { return e.DocRev }
+
+// DocType implements the couchdb.Doc interface
+func (e *JournalEntry) DocType() string { return consts.FilesJournal }
+
+// SetID implements the couchdb.Doc interface
+func (e *JournalEntry) SetID(id string) { e.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (e *JournalEntry) SetRev(rev string) { e.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (e *JournalEntry) Clone() couchdb.Doc {
+	cloned := *e
+	cloned.Objects = make([]string, len(e.Objects))
+	copy(cloned.Objects, e.Objects)
+	return &cloned
+}
+
+// journal adds an entry to the journal for the given objects, if the
+// replication is enabled. An error is only logged, as the reconciliation job
+// can fix the objects that have been missed.
+func (sfs *swiftVFSV3) journal(objNames ...string) {
+	sfs.journalIn(sfs.container, objNames...)
+}
+
+// journalIn is like journal, but for the objects of another container of the
+// instance, like the container of the cold storage.
+func (sfs *swiftVFSV3) journalIn(container string, objNames ...string) {
+	if len(objNames) == 0 || config.GetSwiftReplicaConnection() == nil {
+		return
+	}
+	if ScheduleReplication != nil {
+		if err := ScheduleReplication(sfs); err != nil {
+			sfs.log.Warnf("Cannot schedule the replication: %s", err)
+		}
+	}
+	entry := &JournalEntry{
+		Container: container,
+		Objects:   objNames,
+		CreatedAt: time.Now(),
+	}
+	if err := couchdb.CreateDoc(sfs, entry); err != nil {
+		sfs.log.Warnf("Cannot add %v to the replication journal: %s", objNames, err)
+	}
+}
+
+// readConn returns the connection used for reading the files: the secondary
+// endpoint is used in failover mode.
+func (sfs *swiftVFSV3) readConn() *swift.Connection {
+	if config.GetConfig().Fs.Replication.Failover {
+		if replica := config.GetSwiftReplicaConnection(); replica != nil {
+			return replica
+		}
+	}
+	return sfs.c
+}
+
+// ReplicationReport is the result of the replication of an instance.
+type ReplicationReport struct {
+	Copied      int `json:"copied"`
+	Deleted     int `json:"deleted"`
+	Errors      int `json:"errors"`
+	DeadLetters int `json:"dead_letters,omitempty"`
+}
+
+// Replicate processes the journal of an instance: each object of the journal
+// is copied to the secondary endpoint if it exists on the primary endpoint,
+// or deleted from the secondary endpoint if it does not. The entries are
+// removed from the journal when all their objects have been replicated, and
+// the entries with errors are kept for the next execution.
+func Replicate(ctx context.Context, db vfs.Prefixer) (*ReplicationReport, error) {
+	primary := config.GetSwiftConnection()
+	replica := config.GetSwiftReplicaConnection()
+	if replica == nil {
+		return nil, errors.New("the replication is not configured")
+	}
+	report := &ReplicationReport{}
+	containers := make(map[string]bool)
+	startKey := ""
+	for {
+		var entries []*JournalEntry
+		req := &couchdb.AllDocsRequest{
+			Limit:    journalBatchSize + 1, // Also get the following entry for the next key
+			StartKey: startKey,
+		}
+		err := couchdb.GetAllDocs(db, consts.FilesJournal, req, &entries)
+		if couchdb.IsNoDatabaseError(err) {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		startKey = ""
+		if len(entries) > journalBatchSize {
+			startKey = entries[journalBatchSize].DocID
+			entries = entries[:journalBatchSize]
+		}
+
+		var done []couchdb.Doc
+		var failed, olds []interface{}
+		for _, entry := range entries {
+			if entry.DeadLetter {
+				continue
+			}
+			if !containers[entry.Container] {
+				if err := ensureContainer(ctx, replica, entry.Container, nil); err != nil {
+					return report, err
+				}
+				containers[entry.Container] = true
+			}
+			ok := true
+			for _, objName := range entry.Objects {
+				if err := replicateObject(ctx, primary, replica, entry.Container, objName, report); err != nil {
+					report.Errors++
+					ok = false
+				}
+			}
+			if ok {
+				done = append(done, entry)
+				continue
+			}
+			olds = append(olds, entry.Clone())
+			entry.Attempts++
+			if entry.Attempts >= journalMaxAttempts {
+				entry.DeadLetter = true
+				report.DeadLetters++
+			}
+			failed = append(failed, entry)
+		}
+		if err := couchdb.BulkDeleteDocs(db, consts.FilesJournal, done); err != nil {
+			return report, err
+		}
+		if err := couchdb.BulkUpdateDocs(db, consts.FilesJournal, failed, olds); err != nil {
+			return report, err
+		}
+		if startKey == "" {
+			return report, nil
+		}
+	}
+}
+
+// Reconcile compares the objects of the containers of an instance on the
+// primary and secondary endpoints, and fixes the differences: the missing or
+// modified objects are copied, and the objects that no longer exist on the
+// primary endpoint are deleted from the secondary endpoint. It can be used
+// for the objects written before the replication was enabled, or when some
+// entries of the journal have been lost.
+func Reconcile(ctx context.Context, db vfs.Prefixer) (*ReplicationReport, error) {
+	primary := config.GetSwiftConnection()
+	replica := config.GetSwiftReplicaConnection()
+	if replica == nil {
+		return nil, errors.New("the replication is not configured")
+	}
+	report := &ReplicationReport{}
+	container := swiftV3ContainerPrefix + db.DBPrefix()
+	if err := reconcileContainer(ctx, primary, replica, container, report); err != nil {
+		return report, err
+	}
+	// The container for the cold storage exists only if the tiering has
+	// already moved some contents for this instance.
+	cold := container + swiftColdContainerSuffix
+	err := reconcileContainer(ctx, primary, replica, cold, report)
+	if err != nil && !errors.Is(err, swift.ContainerNotFound) {
+		return report, err
+	}
+	// The dead letters of the journal have been fixed by the reconciliation
+	if err := purgeDeadLetters(db); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// reconcileContainer walks the objects of the container on the two endpoints
+// at the same time, page by page: as Swift lists them sorted by name, the
+// differences can be found without loading the whole listings in memory.
+func reconcileContainer(ctx context.Context, primary, replica *swift.Connection, container string, report *ReplicationReport) error {
+	if _, _, err := primary.Container(ctx, container); err != nil {
+		return err
+	}
+	if err := ensureContainer(ctx, replica, container, nil); err != nil {
+		return err
+	}
+	sources := &objectsPager{c: primary, container: container}
+	targets := &objectsPager{c: replica, container: container}
+	src, err := sources.next(ctx)
+	if err != nil {
+		return err
+	}
+	dst, err := targets.next(ctx)
+	if err != nil {
+		return err
+	}
+
+	for src != nil || dst != nil {
+		switch {
+		case dst == nil || (src != nil && src.Name < dst.Name):
+			if err := copyObject(ctx, primary, replica, container, src.Name); err != nil {
+				report.Errors++
+			} else {
+				report.Copied++
+			}
+			src, err = sources.next(ctx)
+		case src == nil || dst.Name < src.Name:
+			err = replica.LargeObjectDelete(ctx, container, dst.Name)
+			if err != nil && !errors.Is(err, swift.ObjectNotFound) {
+				report.Errors++
+			} else {
+				report.Deleted++
+			}
+			dst, err = targets.next(ctx)
+		default:
+			if !sameObject(src, dst) {
+				if err := copyObject(ctx, primary, replica, container, src.Name); err != nil {
+					report.Errors++
+				} else {
+					report.Copied++
+				}
+			}
+			if src, err = sources.next(ctx); err == nil {
+				dst, err = targets.next(ctx)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameObject returns true if the object on the secondary endpoint is a copy
+// of the object on the primary endpoint. The large objects are segmented
+// differently on the two endpoints, so only their sizes can be compared.
+func sameObject(src, dst *swift.Object) bool {
+	if src.Bytes != dst.Bytes {
+		return false
+	}
+	if src.Bytes > largeObjectThreshold {
+		return true
+	}
+	return src.Hash == dst.Hash
+}
+
+// objectsPager lists the objects of a container, page by page.
+type objectsPager struct {
+	c         *swift.Connection
+	container string
+	marker    string
+	objects   []swift.Object
+	done      bool
+}
+
+// next returns the next object of the container, or nil at the end.
+func (p *objectsPager) next(ctx context.Context) (*swift.Object, error) {
+	if len(p.objects) == 0 && !p.done {
+		objects, err := p.c.Objects(ctx, p.container, &swift.ObjectsOpts{
+			Marker: p.marker,
+			Limit:  reconcileBatchSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.objects = objects
+		p.done = len(objects) < reconcileBatchSize
+		if len(objects) > 0 {
+			p.marker = objects[len(objects)-1].Name
+		}
+	}
+	if len(p.objects) == 0 {
+		return nil, nil
+	}
+	obj := &p.objects[0]
+	p.objects = p.objects[1:]
+	return obj, nil
+}
+
+// purgeDeadLetters removes the entries of the journal that have been put
+// aside by the replication.
+func purgeDeadLetters(db vfs.Prefixer) error {
+	var entries []*JournalEntry
+	err := couchdb.ForeachDocs(db, consts.FilesJournal, func(_ string, data json.RawMessage) error {
+		var entry JournalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if entry.DeadLetter {
+			entries = append(entries, &entry)
+		}
+		return nil
+	})
+	if err != nil {
+		if couchdb.IsNoDatabaseError(err) {
+			return nil
+		}
+		return err
+	}
+	docs := make([]couchdb.Doc, len(entries))
+	for i, entry := range entries {
+		docs[i] = entry
+	}
+	return couchdb.BulkDeleteDocs(db, consts.FilesJournal, docs)
+}
+
+func ensureContainer(ctx context.Context, c *swift.Connection, container string, headers swift.Headers) error {
+	if _, _, err := c.Container(ctx, container); !errors.Is(err, swift.ContainerNotFound) {
+		return err
+	}
+	return c.ContainerCreate(ctx, container, headers)
+}
+
+// replicateObject copies the object to the secondary endpoint, or deletes it
+// there (with its segments for a large object) if it no longer exists on the
+// primary endpoint.
+func replicateObject(ctx context.Context, primary, replica *swift.Connection, container, objName string, report *ReplicationReport) error {
+	err := copyObject(ctx, primary, replica, container, objName)
+	if !errors.Is(err, swift.ObjectNotFound) {
+		if err == nil {
+			report.Copied++
+		}
+		return err
+	}
+	err = replica.LargeObjectDelete(ctx, container, objName)
+	if err != nil && !errors.Is(err, swift.ObjectNotFound) {
+		return err
+	}
+	report.Deleted++
+	return nil
+}
+
+func copyObject(ctx context.Context, primary, replica *swift.Connection, container, objName string) error {
+	f, headers, err := primary.ObjectOpen(ctx, container, objName, false, nil)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	length, err := f.Length(ctx)
+	if err != nil {
+		return err
+	}
+	isLarge := headers["X-Static-Large-Object"] != "" || headers["X-Object-Manifest"] != ""
+	if length > largeObjectThreshold {
+		return copyLargeObject(ctx, replica, container, objName, f, headers)
+	}
+	// The etag of a large object is not the MD5 of its content, and it can't
+	// be used to check the copy.
+	hash := strings.Trim(headers["Etag"], `"`)
+	if isLarge {
+		hash = ""
+	}
+	_, err = replica.ObjectPut(ctx, container, objName, f, !isLarge, hash,
+		headers["Content-Type"], headers.ObjectMetadata().ObjectHeaders())
+	return err
+}
+
+// copyLargeObject copies an object that is too big for a single request: it
+// is written segment by segment on the secondary endpoint, as a static large
+// object.
+func copyLargeObject(ctx context.Context, replica *swift.Connection, container, objName string, f io.Reader, headers swift.Headers) error {
+	w, err := replica.StaticLargeObjectCreate(ctx, &swift.LargeObjectOpts{
+		Container:   container,
+		ObjectName:  objName,
+		ContentType: headers["Content-Type"],
+		Headers:     headers.ObjectMetadata().ObjectHeaders(),
+		ChunkSize:   largeObjectSegmentSize,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+var _ couchdb.Doc = &JournalEntry{}
@@ -3,6 +3,13 @@ package vfsswift
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cozy/cozy-stack/pkg/utils"
@@ -93,3 +100,105 @@ func deleteContainerFiles(ctx context.Context, c *swift.Connection, container st
 	}
 	return errm
 }
+
+// openObjectAt opens an object for reading a part of its content, starting at
+// offset, with at most length bytes (or until the end if length is negative).
+// A Range header is used to let Swift send only the requested bytes. If etag
+// is not empty, it is sent in the If-Match header, and the request fails if
+// the object has been replaced.
+func openObjectAt(ctx context.Context, c *swift.Connection, container, objName string, offset, length int64, etag string) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	headers := swift.Headers{}
+	if offset > 0 || length > 0 {
+		rng := fmt.Sprintf("bytes=%d-", offset)
+		if length > 0 {
+			rng += strconv.FormatInt(offset+length-1, 10)
+		}
+		headers["Range"] = rng
+	}
+	if etag != "" {
+		headers["If-Match"] = etag
+	}
+	f, _, err := c.ObjectOpen(ctx, container, objName, false, headers)
+	if errors.Is(err, swift.ObjectNotFound) {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// objectReaderAt implements the io.ReaderAt interface for a Swift object. A
+// ranged stream is kept open between two calls, so that the sequential reads
+// don't make a request each, and a new one is opened only when the offset
+// jumps. The ETag of the object when it was opened is sent in the If-Match
+// header, to not mix the content of two versions of the object.
+type objectReaderAt struct {
+	ctx       context.Context
+	c         *swift.Connection
+	container string
+	objName   string
+	etag      string
+
+	mu   sync.Mutex
+	body io.ReadCloser
+	pos  int64
+}
+
+func newObjectReaderAt(ctx context.Context, c *swift.Connection, container, objName string, headers swift.Headers) *objectReaderAt {
+	return &objectReaderAt{
+		ctx:       ctx,
+		c:         c,
+		container: container,
+		objName:   objName,
+		etag:      headers["Etag"],
+	}
+}
+
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.body == nil || r.pos != off {
+		r.closeBody()
+		body, err := openObjectAt(r.ctx, r.c, r.container, r.objName, off, -1, r.etag)
+		if err != nil {
+			var swiftErr *swift.Error
+			if errors.As(err, &swiftErr) && swiftErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		r.body = body
+		r.pos = off
+	}
+	n, err := io.ReadFull(r.body, p)
+	r.pos += int64(n)
+	if err != nil {
+		r.closeBody()
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+	}
+	return n, err
+}
+
+// Close closes the ranged stream, if any.
+func (r *objectReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeBody()
+	return nil
+}
+
+func (r *objectReaderAt) closeBody() {
+	if r.body != nil {
+		_ = r.body.Close()
+		r.body = nil
+	}
+}
@@ -0,0 +1,148 @@
+package vfsswift
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/ncw/swift/v2"
+)
+
+// swiftColdContainerSuffix is the suffix of the container used for the cold
+// storage of an instance. This container is created with the storage policy
+// configured in fs.tiering.storage_policy.
+const swiftColdContainerSuffix = "-cold"
+
+// containerFor returns the container where a content is stored.
+func (sfs *swiftVFSV3) containerFor(cold bool) string {
+	if cold {
+		return sfs.container + swiftColdContainerSuffix
+	}
+	return sfs.container
+}
+
+// openObject opens an object for reading. If the object is not found, the
+// other container is tried, as the content may have been moved between the
+// hot and cold storages since the document has been fetched.
+func (sfs *swiftVFSV3) openObject(c *swift.Connection, cold bool, objName string) (*swift.ObjectOpenFile, swift.Headers, string, error) {
+	container := sfs.containerFor(cold)
+	f, h, err := c.ObjectOpen(sfs.ctx, container, objName, false, nil)
+	if errors.Is(err, swift.ObjectNotFound) {
+		container = sfs.containerFor(!cold)
+		f, h, err = c.ObjectOpen(sfs.ctx, container, objName, false, nil)
+	}
+	return f, h, container, err
+}
+
+func (sfs *swiftVFSV3) ensureColdContainer() error {
+	var headers swift.Headers
+	if policy := config.GetConfig().Fs.Tiering.StoragePolicy; policy != "" {
+		headers = swift.Headers{"X-Storage-Policy": policy}
+	}
+	return ensureContainer(sfs.ctx, sfs.c, sfs.containerFor(true), headers)
+}
+
+// moveObject copies an object to another container, calls the update
+// function to save the new location in CouchDB, and then deletes the object
+// from its old container.
+func (sfs *swiftVFSV3) moveObject(objName string, toCold bool, update func() error) error {
+	from, to := sfs.containerFor(!toCold), sfs.containerFor(toCold)
+	if _, err := sfs.c.ObjectCopy(sfs.ctx, from, objName, to, objName, nil); err != nil {
+		return err
+	}
+	if err := update(); err != nil {
+		_ = sfs.c.ObjectDelete(sfs.ctx, to, objName)
+		return err
+	}
+	err := sfs.c.ObjectDelete(sfs.ctx, from, objName)
+	if err != nil && !errors.Is(err, swift.ObjectNotFound) {
+		sfs.log.Warnf("Cannot delete %s from %s after the move: %s", objName, from, err)
+	}
+	sfs.journalIn(to, objName)
+	sfs.journalIn(from, objName)
+	return nil
+}
+
+// MoveFileToCold moves the content of a file, and of its old versions, to
+// the cold storage.
+func (sfs *swiftVFSV3) MoveFileToCold(doc *vfs.FileDoc) error {
+	if lockerr := sfs.mu.Lock(); lockerr != nil {
+		return lockerr
+	}
+	defer sfs.mu.Unlock()
+	if err := sfs.ensureColdContainer(); err != nil {
+		return err
+	}
+
+	if versions, err := vfs.VersionsFor(sfs, doc.DocID); err == nil {
+		for _, v := range versions {
+			if err := sfs.moveVersionToColdLocked(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if doc.Cold {
+		return nil
+	}
+	objName := MakeObjectNameV3(doc.DocID, doc.InternalID)
+	return sfs.moveObject(objName, true, func() error {
+		newdoc := doc.Clone().(*vfs.FileDoc)
+		newdoc.Cold = true
+		return sfs.Indexer.UpdateFileDoc(doc, newdoc)
+	})
+}
+
+// MoveVersionToCold moves the content of an old version to the cold storage.
+func (sfs *swiftVFSV3) MoveVersionToCold(v *vfs.Version) error {
+	if lockerr := sfs.mu.Lock(); lockerr != nil {
+		return lockerr
+	}
+	defer sfs.mu.Unlock()
+	if err := sfs.ensureColdContainer(); err != nil {
+		return err
+	}
+	return sfs.moveVersionToColdLocked(v)
+}
+
+func (sfs *swiftVFSV3) moveVersionToColdLocked(v *vfs.Version) error {
+	if v.Cold {
+		return nil
+	}
+	parts := strings.SplitN(v.DocID, "/", 2)
+	if len(parts) != 2 {
+		return vfs.ErrIllegalFilename
+	}
+	objName := MakeObjectNameV3(parts[0], parts[1])
+	return sfs.moveObject(objName, true, func() error {
+		v.Cold = true
+		if err := couchdb.UpdateDoc(sfs, v); err != nil {
+			v.Cold = false
+			return err
+		}
+		vfs.UpdateDiskUsage(sfs, -v.ByteSize)
+		return nil
+	})
+}
+
+// MoveFileToHot moves back the content of a file from the cold storage. The
+// old versions are kept in the cold storage.
+func (sfs *swiftVFSV3) MoveFileToHot(doc *vfs.FileDoc) error {
+	if lockerr := sfs.mu.Lock(); lockerr != nil {
+		return lockerr
+	}
+	defer sfs.mu.Unlock()
+	if !doc.Cold {
+		return nil
+	}
+	objName := MakeObjectNameV3(doc.DocID, doc.InternalID)
+	return sfs.moveObject(objName, false, func() error {
+		newdoc := doc.Clone().(*vfs.FileDoc)
+		newdoc.Cold = false
+		return sfs.Indexer.UpdateFileDoc(doc, newdoc)
+	})
+}
+
+var _ vfs.Tierer = &swiftVFSV3{}
@@ -0,0 +1,287 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+	"github.com/cozy/cozy-stack/pkg/safehttp"
+	"github.com/labstack/echo/v4"
+)
+
+// deliveryLogMaxEntries is the number of deliveries kept in the log of a
+// subscription: the oldest entries are removed when this number is reached.
+const deliveryLogMaxEntries = 100
+
+const (
+	// SignatureHeader is the HTTP header with the signature of the payload.
+	SignatureHeader = "X-Cozy-Signature"
+	// DeliveryHeader is the HTTP header with the identifier of the delivery,
+	// that is the same for the retries.
+	DeliveryHeader = "X-Cozy-Delivery"
+	// EventHeader is the HTTP header with the doctype and verb of the event.
+	EventHeader = "X-Cozy-Event"
+)
+
+// DeliveryEntry is an attempt to deliver a payload, kept in the log.
+type DeliveryEntry struct {
+	DeliveryID string    `json:"delivery_id"`
+	Attempt    int       `json:"attempt"`
+	Verb       string    `json:"verb"`
+	DocID      string    `json:"doc_id"`
+	SentAt     time.Time `json:"sent_at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Duration   float64   `json:"duration"` // in seconds
+	Error      string    `json:"error,omitempty"`
+}
+
+// DeliveryLog is a rolling store of the last deliveries of a subscription.
+// The document has the same ID as the subscription.
+type DeliveryLog struct {
+	DocID   string           `json:"_id,omitempty"`
+	DocRev  string           `json:"_rev,omitempty"`
+	Entries []*DeliveryEntry `json:"entries"`
+}
+
+// ID implements the couchdb.Doc interface
+func (l *DeliveryLog) ID() string { return l.DocID }
+
+// Rev implements the couchdb.Doc interface
+func (l *DeliveryLog) Rev() string { return l.DocRev }
+
+// DocType implements the couchdb.Doc interface
+func (l *DeliveryLog) DocType() string { return consts.WebhookDeliveries }
+
+// SetID implements the couchdb.Doc interface
+func (l *DeliveryLog) SetID(id string) { l.DocID = id }
+
+// SetRev implements the couchdb.Doc interface
+func (l *DeliveryLog) SetRev(rev string) { l.DocRev = rev }
+
+// Clone implements the couchdb.Doc interface
+func (l *DeliveryLog) Clone() couchdb.Doc {
+	cloned := *l
+	cloned.Entries = make([]*DeliveryEntry, len(l.Entries))
+	for i, entry := range l.Entries {
+		e := *entry
+		cloned.Entries[i] = &e
+	}
+	return &cloned
+}
+
+// Add appends an entry to the log, and removes the oldest entries if the log
+// is full. The attempt number of the entry is computed from the previous
+// entries for the same delivery.
+func (l *DeliveryLog) Add(entry *DeliveryEntry) {
+	entry.Attempt = 1
+	for _, e := range l.Entries {
+		if e.DeliveryID == entry.DeliveryID {
+			entry.Attempt++
+		}
+	}
+	l.Entries = append(l.Entries, entry)
+	if extra := len(l.Entries) - deliveryLogMaxEntries; extra > 0 {
+		l.Entries = l.Entries[extra:]
+	}
+}
+
+// GetDeliveryLog returns the log of the deliveries of a subscription. An
+// empty log is returned if nothing has been delivered yet.
+func GetDeliveryLog(db prefixer.Prefixer, subscriptionID string) (*DeliveryLog, error) {
+	var log DeliveryLog
+	err := couchdb.GetDoc(db, consts.WebhookDeliveries, subscriptionID, &log)
+	if couchdb.IsNotFoundError(err) {
+		return &DeliveryLog{DocID: subscriptionID, Entries: []*DeliveryEntry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+func recordDelivery(db prefixer.Prefixer, subscriptionID string, entry *DeliveryEntry) error {
+	// The jobs of a subscription can be executed concurrently, so we retry on
+	// conflicts.
+	var err error
+	for i := 0; i < 3; i++ {
+		var log *DeliveryLog
+		log, err = GetDeliveryLog(db, subscriptionID)
+		if err != nil {
+			return err
+		}
+		log.Add(entry)
+		if log.Rev() == "" {
+			err = couchdb.CreateNamedDocWithDB(db, log)
+		} else {
+			err = couchdb.UpdateDoc(db, log)
+		}
+		if !couchdb.IsConflictError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func deleteDeliveryLog(db prefixer.Prefixer, subscriptionID string) {
+	var log DeliveryLog
+	if err := couchdb.GetDoc(db, consts.WebhookDeliveries, subscriptionID, &log); err == nil {
+		_ = couchdb.DeleteDoc(db, &log)
+	}
+}
+
+// Event is the realtime event that has triggered the webhook job.
+type Event struct {
+	Verb   string           `json:"verb"`
+	Doc    couchdb.JSONDoc  `json:"doc"`
+	OldDoc *couchdb.JSONDoc `json:"old,omitempty"`
+}
+
+// Payload is the JSON body sent to the URL of the subscription.
+type Payload struct {
+	DeliveryID     string                 `json:"delivery_id"`
+	SubscriptionID string                 `json:"subscription_id"`
+	Domain         string                 `json:"domain"`
+	Doctype        string                 `json:"doctype"`
+	Verb           string                 `json:"verb"`
+	Doc            map[string]interface{} `json:"doc"`
+	Timestamp      int64                  `json:"timestamp"`
+}
+
+// Matches returns true if the event matches the selector of the subscription.
+// For a deletion, the selector is also checked on the old version of the
+// document, as the deleted document can have lost its fields.
+func (s *Subscription) Matches(evt *Event) bool {
+	if len(s.Selector) == 0 {
+		return true
+	}
+	if mango.Match(s.Selector, evt.Doc.M) {
+		return true
+	}
+	if evt.Verb == realtime.EventDelete && evt.OldDoc != nil {
+		return mango.Match(s.Selector, evt.OldDoc.M)
+	}
+	return false
+}
+
+// Sign returns the value of the signature header for a payload: the HMAC-SHA256
+// of the timestamp and the body, with the secret of the subscription.
+func (s *Subscription) Sign(timestamp int64, body []byte) string {
+	return Sign(s.Secret, timestamp, body)
+}
+
+// Sign returns the value of the signature header for a payload: the
+// HMAC-SHA256 of the timestamp and the body, with the given secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver sends the event to the URL of the subscription, and records the
+// attempt in the delivery log. An error is returned if the delivery has
+// failed, so that the job can be retried with a backoff.
+func Deliver(ctx *job.WorkerContext, subscriptionID string, evt *Event) error {
+	inst := ctx.Instance
+	sub, err := Get(inst, subscriptionID)
+	if couchdb.IsNotFoundError(err) {
+		ctx.SetNoRetry()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !sourceIsAllowed(inst, sub) {
+		ctx.Logger().Infof("Remove the webhook subscription %s as %s is no longer allowed",
+			sub.DocID, sub.SourceID)
+		ctx.SetNoRetry()
+		return Delete(inst, sub)
+	}
+	if !sub.Matches(evt) {
+		return nil
+	}
+
+	now := time.Now()
+	payload := Payload{
+		DeliveryID:     ctx.JobID(),
+		SubscriptionID: sub.DocID,
+		Domain:         inst.Domain,
+		Doctype:        sub.Doctype,
+		Verb:           evt.Verb,
+		Doc:            evt.Doc.M,
+		Timestamp:      now.Unix(),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	entry := &DeliveryEntry{
+		DeliveryID: ctx.JobID(),
+		Verb:       evt.Verb,
+		DocID:      evt.Doc.ID(),
+		SentAt:     now,
+	}
+	errDelivery := send(ctx, sub, payload.Timestamp, body, entry)
+	entry.Duration = time.Since(now).Seconds()
+	if errDelivery != nil {
+		entry.Error = errDelivery.Error()
+	}
+	if err := recordDelivery(inst, sub.DocID, entry); err != nil {
+		ctx.Logger().Warnf("Cannot record the delivery of webhook %s: %s", sub.DocID, err)
+	}
+	return errDelivery
+}
+
+func send(ctx *job.WorkerContext, sub *Subscription, timestamp int64, body []byte, entry *DeliveryEntry) error {
+	event := sub.Doctype + ":" + entry.Verb
+	status, err := Post(ctx, sub.URL, sub.Secret, event, timestamp, body)
+	entry.StatusCode = status
+	return err
+}
+
+// Post sends a signed payload to an URL, with the headers for the signature,
+// the delivery and the event. It returns the HTTP status of the response. The
+// client errors are not retried, except for a timeout or a rate limit.
+func Post(ctx *job.WorkerContext, url, secret, event string, timestamp int64, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		ctx.SetNoRetry()
+		return 0, err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	req.Header.Set(DeliveryHeader, ctx.JobID())
+	req.Header.Set(EventHeader, event)
+
+	res, err := safehttp.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res.StatusCode, nil
+	}
+	if res.StatusCode >= 400 && res.StatusCode < 500 &&
+		res.StatusCode != http.StatusRequestTimeout &&
+		res.StatusCode != http.StatusTooManyRequests {
+		ctx.SetNoRetry()
+	}
+	return res.StatusCode, fmt.Errorf("Unexpected response from the webhook URL: %d", res.StatusCode)
+}
+
+var _ couchdb.Doc = &DeliveryLog{}
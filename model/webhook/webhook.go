@@ -0,0 +1,272 @@
+// Package webhook is used for the outbound webhooks: an application can
+// subscribe to the changes on a doctype, with a mango selector, and the stack
+// sends a signed JSON payload to an external URL for each matching change.
+// It avoids to poll the changes feed for the third-party integrations.
+package webhook
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/permission"
+	build "github.com/cozy/cozy-stack/pkg/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+)
+
+// WorkerType is the type of the jobs used for delivering the webhooks.
+const WorkerType = "webhook"
+
+// maxSubscriptions is the maximal number of subscriptions for an instance.
+const maxSubscriptions = 50
+
+// secretLength is the length of the secret used to sign the payloads.
+const secretLength = 32
+
+// Verbs are the events that can be watched by a subscription.
+var Verbs = []string{realtime.EventCreate, realtime.EventUpdate, realtime.EventDelete}
+
+var (
+	// ErrInvalidURL is used when the URL of a subscription is not a valid
+	// http(s) URL.
+	ErrInvalidURL = errors.New("Invalid URL for the webhook")
+	// ErrInvalidVerb is used when a verb is not CREATED, UPDATED or DELETED.
+	ErrInvalidVerb = errors.New("Invalid verb for the webhook")
+	// ErrTooManySubscriptions is used when the instance has already reached
+	// the maximal number of subscriptions.
+	ErrTooManySubscriptions = errors.New("Too many webhook subscriptions")
+)
+
+// Subscription is a document for an outbound webhook. A @event trigger is
+// created with it for the webhook worker, and the secret is used to sign the
+// payloads.
+type Subscription struct {
+	DocID      string    `json:"_id,omitempty"`
+	DocRev     string    `json:"_rev,omitempty"`
+	URL        string    `json:"url"`
+	Doctype    string    `json:"doctype"`
+	Verbs      []string  `json:"verbs"`
+	Selector   mango.Map `json:"selector,omitempty"`
+	Secret     string    `json:"secret,omitempty"`
+	SourceType string    `json:"source_type"`
+	SourceID   string    `json:"source_id"`
+	Scope      string    `json:"scope,omitempty"`
+	TriggerID  string    `json:"trigger_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (s *Subscription) ID() string { return s.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (s *Subscription) Rev() string { return s.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (s *Subscription) DocType() string { return consts.WebhookSubscriptions }
+
+// Clone is used to implement the couchdb.Doc interface
+func (s *Subscription) Clone() couchdb.Doc {
+	cloned := *s
+	cloned.Verbs = make([]string, len(s.Verbs))
+	copy(cloned.Verbs, s.Verbs)
+	if s.Selector != nil {
+		cloned.Selector = make(mango.Map, len(s.Selector))
+		for k, v := range s.Selector {
+			cloned.Selector[k] = v
+		}
+	}
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (s *Subscription) SetID(id string) { s.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (s *Subscription) SetRev(rev string) { s.DocRev = rev }
+
+// Options are the parameters given by an application for a subscription.
+type Options struct {
+	URL      string    `json:"url"`
+	Doctype  string    `json:"doctype"`
+	Verbs    []string  `json:"verbs"`
+	Selector mango.Map `json:"selector"`
+}
+
+// Message is the message of the webhook jobs.
+type Message struct {
+	SubscriptionID string `json:"subscription_id"`
+}
+
+// Create checks the options, and creates a subscription with its trigger. The
+// source is the permission document of the application that has made the
+// request, and the secret is only returned by this function.
+func Create(inst *instance.Instance, opts Options, source *permission.Permission) (*Subscription, error) {
+	if err := CheckURL(opts.URL); err != nil {
+		return nil, err
+	}
+	if err := permission.CheckReadable(opts.Doctype); err != nil {
+		return nil, err
+	}
+	verbs, err := checkVerbs(opts.Verbs)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Selector) > 0 {
+		if err := mango.Validate(opts.Selector); err != nil {
+			return nil, err
+		}
+	}
+	subs, err := List(inst)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) >= maxSubscriptions {
+		return nil, ErrTooManySubscriptions
+	}
+
+	sub := &Subscription{
+		URL:        opts.URL,
+		Doctype:    opts.Doctype,
+		Verbs:      verbs,
+		Selector:   opts.Selector,
+		Secret:     crypto.GenerateRandomString(secretLength),
+		SourceType: source.Type,
+		SourceID:   source.SourceID,
+		CreatedAt:  time.Now(),
+	}
+	if source.Type == permission.TypeOauth {
+		// The scope of an OAuth client is only known from its token, so it
+		// is kept to check later that the client can still read the doctype.
+		if sub.Scope, err = source.Permissions.MarshalScopeString(); err != nil {
+			return nil, err
+		}
+	}
+	if err := couchdb.CreateDoc(inst, sub); err != nil {
+		return nil, err
+	}
+
+	t, err := job.NewTrigger(inst, job.TriggerInfos{
+		Type:       "@event",
+		WorkerType: WorkerType,
+		Arguments:  sub.Doctype + ":" + strings.Join(sub.Verbs, ","),
+	}, Message{SubscriptionID: sub.DocID})
+	if err == nil {
+		err = job.System().AddTrigger(t)
+	}
+	if err != nil {
+		_ = couchdb.DeleteDoc(inst, sub)
+		return nil, err
+	}
+	sub.TriggerID = t.ID()
+	if err := couchdb.UpdateDoc(inst, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// CheckURL returns an error if the URL can't be used for a webhook: only the
+// https URLs are accepted, except for the development releases.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || !build.IsDevRelease()) {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+func checkVerbs(verbs []string) ([]string, error) {
+	if len(verbs) == 0 {
+		return append([]string{}, Verbs...), nil
+	}
+	checked := make([]string, 0, len(verbs))
+	for _, verb := range verbs {
+		verb = strings.ToUpper(verb)
+		valid := false
+		for _, v := range Verbs {
+			if verb == v {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, ErrInvalidVerb
+		}
+		checked = append(checked, verb)
+	}
+	return checked, nil
+}
+
+// Get returns the subscription with the given identifier.
+func Get(db prefixer.Prefixer, id string) (*Subscription, error) {
+	sub := &Subscription{}
+	if err := couchdb.GetDoc(db, consts.WebhookSubscriptions, id, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// List returns all the subscriptions of the instance.
+func List(db prefixer.Prefixer) ([]*Subscription, error) {
+	var subs []*Subscription
+	err := couchdb.GetAllDocs(db, consts.WebhookSubscriptions, nil, &subs)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// Delete removes the subscription, with its trigger and its delivery log.
+func Delete(db prefixer.Prefixer, sub *Subscription) error {
+	if sub.TriggerID != "" {
+		err := job.System().DeleteTrigger(db, sub.TriggerID)
+		if err != nil && !errors.Is(err, job.ErrNotFoundTrigger) {
+			return err
+		}
+	}
+	deleteDeliveryLog(db, sub.DocID)
+	return couchdb.DeleteDoc(db, sub)
+}
+
+// sourceIsAllowed checks that the application that has created the
+// subscription is still installed, and can still read the doctype.
+func sourceIsAllowed(inst *instance.Instance, sub *Subscription) bool {
+	var perm *permission.Permission
+	var err error
+	switch sub.SourceType {
+	case permission.TypeWebapp:
+		perm, err = permission.GetForWebapp(inst, strings.TrimPrefix(sub.SourceID, consts.Apps+"/"))
+	case permission.TypeKonnector:
+		perm, err = permission.GetForKonnector(inst, strings.TrimPrefix(sub.SourceID, consts.Konnectors+"/"))
+	case permission.TypeOauth:
+		client, err := oauth.FindClient(inst, sub.SourceID)
+		if err != nil {
+			return false
+		}
+		if sub.Doctype == consts.Files && len(client.SyncScope) > 0 {
+			return false
+		}
+		if slug := oauth.GetLinkedAppSlug(client.SoftwareID); slug != "" {
+			perm, err = permission.GetForWebapp(inst, slug)
+		} else {
+			perm = &permission.Permission{}
+			perm.Permissions, err = permission.UnmarshalScopeString(sub.Scope)
+		}
+	default:
+		return true
+	}
+	return err == nil && perm.Permissions.AllowWholeType(permission.GET, sub.Doctype)
+}
+
+var _ couchdb.Doc = &Subscription{}
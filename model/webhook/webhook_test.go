@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	t.Run("CheckURL", func(t *testing.T) {
+		assert.NoError(t, CheckURL("https://service.example.com/hooks"))
+		assert.ErrorIs(t, CheckURL("ftp://service.example.com/hooks"), ErrInvalidURL)
+		assert.ErrorIs(t, CheckURL("https:///hooks"), ErrInvalidURL)
+		assert.ErrorIs(t, CheckURL("not an url"), ErrInvalidURL)
+	})
+
+	t.Run("CheckVerbs", func(t *testing.T) {
+		verbs, err := checkVerbs(nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"CREATED", "UPDATED", "DELETED"}, verbs)
+
+		verbs, err = checkVerbs([]string{"created", "DELETED"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"CREATED", "DELETED"}, verbs)
+
+		_, err = checkVerbs([]string{"CREATED", "NOTIFIED"})
+		assert.ErrorIs(t, err, ErrInvalidVerb)
+	})
+
+	t.Run("Matches", func(t *testing.T) {
+		sub := &Subscription{Doctype: "io.cozy.files"}
+		evt := &Event{
+			Verb: realtime.EventCreate,
+			Doc:  couchdb.JSONDoc{M: map[string]interface{}{"_id": "123", "class": "image"}},
+		}
+		assert.True(t, sub.Matches(evt))
+
+		sub.Selector = mango.Map{"class": "image"}
+		assert.True(t, sub.Matches(evt))
+		sub.Selector = mango.Map{"class": "pdf"}
+		assert.False(t, sub.Matches(evt))
+
+		evt.Verb = realtime.EventDelete
+		evt.Doc = couchdb.JSONDoc{M: map[string]interface{}{"_id": "123", "_deleted": true}}
+		evt.OldDoc = &couchdb.JSONDoc{M: map[string]interface{}{"_id": "123", "class": "pdf"}}
+		assert.True(t, sub.Matches(evt))
+	})
+
+	t.Run("Sign", func(t *testing.T) {
+		sub := &Subscription{Secret: "my-secret"}
+		body := []byte(`{"verb":"CREATED"}`)
+		signature := sub.Sign(1686582245, body)
+		require.True(t, strings.HasPrefix(signature, "t=1686582245,v1="))
+
+		mac := hmac.New(sha256.New, []byte("my-secret"))
+		mac.Write([]byte(`1686582245.{"verb":"CREATED"}`))
+		expected := hex.EncodeToString(mac.Sum(nil))
+		assert.Equal(t, "t=1686582245,v1="+expected, signature)
+
+		other := &Subscription{Secret: "other-secret"}
+		assert.NotEqual(t, signature, other.Sign(1686582245, body))
+	})
+
+	t.Run("DeliveryLog", func(t *testing.T) {
+		log := &DeliveryLog{DocID: "sub"}
+		log.Add(&DeliveryEntry{DeliveryID: "job1"})
+		log.Add(&DeliveryEntry{DeliveryID: "job2"})
+		log.Add(&DeliveryEntry{DeliveryID: "job1"})
+		require.Len(t, log.Entries, 3)
+		assert.Equal(t, 1, log.Entries[0].Attempt)
+		assert.Equal(t, 1, log.Entries[1].Attempt)
+		assert.Equal(t, 2, log.Entries[2].Attempt)
+
+		for i := 0; i < deliveryLogMaxEntries; i++ {
+			log.Add(&DeliveryEntry{DeliveryID: "job3"})
+		}
+		assert.Len(t, log.Entries, deliveryLogMaxEntries)
+		assert.Equal(t, deliveryLogMaxEntries, log.Entries[len(log.Entries)-1].Attempt)
+	})
+}
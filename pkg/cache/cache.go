@@ -18,10 +18,11 @@ type Cache interface {
 	Keys(prefix string) []string
 	Clear(key string)
 	Set(key string, data []byte, expiration time.Duration)
-	SetNX(key string, data []byte, expiration time.Duration)
+	SetNX(key string, data []byte, expiration time.Duration) bool
 	GetCompressed(key string) (io.Reader, bool)
 	SetCompressed(key string, data []byte, expiration time.Duration)
 	RefreshTTL(key string, expiration time.Duration)
+	IncrBy(key string, delta int64) (int64, bool)
 }
 
 type cacheEntry struct {
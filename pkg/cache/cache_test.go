@@ -90,6 +90,31 @@ func TestRedisCache(t *testing.T) {
 				assert.Nil(t, bufs[2])
 			})
 
+			t.Run("SetNX", func(t *testing.T) {
+				assert.True(t, c.SetNX("nx", []byte("1"), 10*time.Millisecond))
+				assert.False(t, c.SetNX("nx", []byte("2"), 10*time.Millisecond))
+				actual, _ := c.Get("nx")
+				assert.Equal(t, []byte("1"), actual)
+
+				time.Sleep(11 * time.Millisecond)
+				assert.True(t, c.SetNX("nx", []byte("3"), 10*time.Millisecond))
+			})
+
+			t.Run("IncrBy", func(t *testing.T) {
+				_, ok := c.IncrBy("counter", 5)
+				assert.False(t, ok)
+
+				c.Set("counter", []byte("10"), 10*time.Millisecond)
+				n, ok := c.IncrBy("counter", 5)
+				assert.True(t, ok)
+				assert.EqualValues(t, 15, n)
+				n, ok = c.IncrBy("counter", -20)
+				assert.True(t, ok)
+				assert.EqualValues(t, -5, n)
+				actual, _ := c.Get("counter")
+				assert.Equal(t, []byte("-5"), actual)
+			})
+
 			t.Run("Keys", func(t *testing.T) {
 				// Set three values
 				c.Set("foo:one", []byte("1"), 10*time.Millisecond)
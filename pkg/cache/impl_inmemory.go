@@ -5,6 +5,7 @@ import (
 	"compress/gzip"
 	"context"
 	"io"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -12,7 +13,8 @@ import (
 
 // InMemory implementation of the Cache client.
 type InMemory struct {
-	m *sync.Map
+	m  *sync.Map
+	mu sync.Mutex
 }
 
 // NewRedis instantiate a new in-memory Cache Client.
@@ -83,12 +85,16 @@ func (c *InMemory) Set(key string, data []byte, expiration time.Duration) {
 	})
 }
 
-// SetNX stores the data in the cache only if the key doesn't exist yet.
-func (c *InMemory) SetNX(key string, data []byte, expiration time.Duration) {
-	c.m.LoadOrStore(key, cacheEntry{
-		payload:   data,
-		expiredAt: time.Now().Add(expiration),
-	})
+// SetNX stores the data in the cache only if the key doesn't exist yet. It
+// returns true if the data has been stored.
+func (c *InMemory) SetNX(key string, data []byte, expiration time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.Get(key); ok {
+		return false
+	}
+	c.Set(key, data, expiration)
+	return true
 }
 
 // GetCompressed works like Get but expect a compressed asset that is
@@ -124,3 +130,27 @@ func (c *InMemory) RefreshTTL(key string, expiration time.Duration) {
 	entry.expiredAt = time.Now().Add(expiration)
 	c.m.Store(key, entry)
 }
+
+// IncrBy increments the integer stored at the given key by delta, only if the
+// key exists. It returns the new value, and false if the key was not found.
+func (c *InMemory) IncrBy(key string, delta int64) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.m.Load(key)
+	if !ok {
+		return 0, false
+	}
+	entry := value.(cacheEntry)
+	if time.Now().After(entry.expiredAt) {
+		c.Clear(key)
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(entry.payload), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	n += delta
+	entry.payload = []byte(strconv.FormatInt(n, 10))
+	c.m.Store(key, entry)
+	return n, true
+}
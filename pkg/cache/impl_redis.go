@@ -75,9 +75,11 @@ func (c *Redis) Set(key string, data []byte, expiration time.Duration) {
 	c.client.Set(context.TODO(), key, data, expiration)
 }
 
-// SetNX stores the data in the cache only if the key doesn't exist yet.
-func (c *Redis) SetNX(key string, data []byte, expiration time.Duration) {
-	c.client.SetNX(context.TODO(), key, data, expiration)
+// SetNX stores the data in the cache only if the key doesn't exist yet. It
+// returns true if the data has been stored.
+func (c *Redis) SetNX(key string, data []byte, expiration time.Duration) bool {
+	ok, err := c.client.SetNX(context.TODO(), key, data, expiration).Result()
+	return err == nil && ok
 }
 
 // GetCompressed works like Get but expect a compressed asset that is
@@ -114,3 +116,20 @@ func (c *Redis) SetCompressed(key string, data []byte, expiration time.Duration)
 func (c *Redis) RefreshTTL(key string, expiration time.Duration) {
 	c.client.Expire(context.TODO(), key, expiration)
 }
+
+var incrByScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+  return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return false
+`)
+
+// IncrBy increments the integer stored at the given key by delta, only if the
+// key exists. It returns the new value, and false if the key was not found.
+func (c *Redis) IncrBy(key string, delta int64) (int64, bool) {
+	value, err := incrByScript.Run(context.TODO(), c.client, []string{key}, delta).Int64()
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
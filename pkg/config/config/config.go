@@ -15,6 +15,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"text/template"
 	"time"
@@ -83,9 +84,9 @@ const (
 // administration hashed passphrase.
 const defaultAdminSecretFileName = "cozy-admin-passphrase"
 
-var (
-	config *Config
-)
+// config is the current configuration, as a *Config. The secrets can be
+// reloaded while the stack is running, and the configuration is then swapped.
+var config atomic.Value
 
 var log = logger.WithNamespace("config")
 
@@ -108,9 +109,17 @@ type Config struct {
 	Hooks                 string
 	GeoDB                 string
 	PasswordResetInterval time.Duration
+	DestroyGracePeriod    time.Duration
+	AuditRetention        time.Duration
+	AccessLogsRetention   time.Duration
+	IdempotencyTTL        time.Duration
+	TrustedProxies        []*net.IPNet
 
 	RemoteAssets   map[string]string
 	DeprecatedApps DeprecatedAppsCfg
+	// SchemaMigrations are the migrations of the doctypes declared in the
+	// config file.
+	SchemaMigrations []SchemaMigration
 
 	Avatars        *avatar.Service
 	Fs             Fs
@@ -120,7 +129,11 @@ type Config struct {
 	Konnectors     Konnectors
 	Mail           *gomail.DialerOptions
 	MailPerContext map[string]interface{}
+	MailDKIM       *DKIM
+	MailLimits     MailLimits
 	Move           Move
+	Escrow         Escrow
+	Requests       Requests
 	Notifications  Notifications
 	Flagship       Flagship
 
@@ -144,6 +157,7 @@ type Config struct {
 	CSPDisabled   bool
 	CSPAllowList  map[string]string
 	CSPPerContext map[string]map[string]string
+	CSPPerApp     map[string]map[string]string
 
 	AssetsPollingDisabled bool
 	AssetsPollingInterval time.Duration
@@ -168,13 +182,43 @@ type Fs struct {
 	CanQueryInfo          bool
 	AutoCleanTrashedAfter map[string]string
 	Versioning            FsVersioning
+	ArchiveMaxSize        int64
 	Contexts              map[string]interface{}
+
+	Replication FsReplication
+	Tiering     FsTiering
+}
+
+// FsReplication contains the configuration for the replication of the Swift
+// objects to a secondary endpoint, in another region.
+type FsReplication struct {
+	// URL is the secondary Swift endpoint, with the same format as fs.url.
+	URL *url.URL
+	// Failover can be set to true to read the files from the secondary
+	// endpoint when the primary region is lost.
+	Failover bool
+}
+
+// FsTiering contains the configuration for moving the old versions and the
+// trashed files to a cheaper storage. The durations use the bigduration
+// format (like 6M or 30D), and can be overridden per context.
+type FsTiering struct {
+	// StoragePolicy is the Swift storage policy of the cold containers.
+	StoragePolicy string
+	// VersionsAfter is the age after which the old versions are moved to the
+	// cold storage (empty to disable).
+	VersionsAfter string
+	// TrashAfter is the duration after which the files in the trash are moved
+	// to the cold storage (empty to disable).
+	TrashAfter string
 }
 
 // FsVersioning contains the configuration for the versioning of files
 type FsVersioning struct {
 	MaxNumberToKeep            int
 	MinDelayBetweenTwoVersions time.Duration
+	MaxAge                     time.Duration
+	MaxTotalSize               int64
 }
 
 // CouchDBCluster contains the configuration values for a cluster of CouchDB.
@@ -182,6 +226,15 @@ type CouchDBCluster struct {
 	Auth     *url.Userinfo
 	URL      *url.URL
 	Creation bool
+	// Client is the HTTP client for this cluster, with its own pool of
+	// connections
+	Client *http.Client
+	// MaxConcurrentRequests is the maximal number of requests sent at the
+	// same time by a stack process to this cluster (0 means no limit)
+	MaxConcurrentRequests int
+	// QueueTimeout is how long a request can wait for a free slot when the
+	// limit of concurrent requests has been reached
+	QueueTimeout time.Duration
 }
 
 // CouchDB contains the configuration for the CouchDB clusters.
@@ -189,6 +242,16 @@ type CouchDB struct {
 	Client   *http.Client
 	Global   CouchDBCluster
 	Clusters []CouchDBCluster
+	// AutoIndexes is the list of doctypes, by context, for which the indexes
+	// suggested by the index advisor are created automatically
+	AutoIndexes map[string][]string
+	// MaxConcurrentMigrations is the maximal number of instances for which
+	// the indexes and views are migrated at the same time
+	MaxConcurrentMigrations int
+	// MaxConcurrentWarmUps is the maximal number of queries sent at the same
+	// time by a stack process to a CouchDB cluster, to build the indexes and
+	// views in background
+	MaxConcurrentWarmUps int
 }
 
 // Jobs contains the configuration values for the jobs and triggers
@@ -199,14 +262,71 @@ type Jobs struct {
 	AllowList             bool
 	Workers               []Worker
 	ImageMagickConvertCmd string
+	// HTMLToPDFCmd is the command used to convert an HTML document to PDF. It
+	// reads the HTML on stdin and writes the PDF on stdout.
+	HTMLToPDFCmd string
 	// XXX for retro-compatibility
 	NbWorkers             int
 	DefaultDurationToKeep string
+	// CoalescingWindow is the duration during which the jobs with the same
+	// dedup key (like a konnector for an account) are coalesced
+	CoalescingWindow time.Duration
 }
 
 // Konnectors contains the configuration values for the konnectors
 type Konnectors struct {
 	Cmd string
+	// LogsRetention is the duration during which the logs of the executions
+	// of the konnectors are kept
+	LogsRetention time.Duration
+	// Remote is used for running the konnectors on remote executor agents,
+	// instead of the local command
+	Remote RemoteKonnectors
+	// MaxConcurrentPerInstance is the maximal number of konnectors that can
+	// run at the same time for an instance (0 means no limit). It can be
+	// overridden in the context with konnectors_max_concurrent.
+	MaxConcurrentPerInstance int
+	// InputTimeout is the maximal duration that a konnector can wait for an
+	// input of the user, like a 2FA code
+	InputTimeout time.Duration
+	// Telemetry is the opt-in reporting of the success and failure rates of
+	// the konnectors to the apps registry
+	Telemetry KonnectorsTelemetry
+}
+
+// KonnectorsTelemetry contains the configuration for reporting anonymized
+// statistics about the executions of the konnectors to the apps registry.
+type KonnectorsTelemetry struct {
+	// Enabled must be set to true to send the reports (opt-in)
+	Enabled bool
+	// URL is where the reports are sent (by default, the telemetry endpoint
+	// of the first registry of the default context)
+	URL string
+	// Interval is the delay between two reports
+	Interval time.Duration
+	// Epsilon is the privacy budget for the differential privacy noise added
+	// to the counters (0 for no noise). It can be overridden in the context
+	// with konnectors_telemetry_epsilon.
+	Epsilon float64
+}
+
+// RemoteKonnectors contains the configuration for dispatching the executions
+// of the konnectors to a pool of remote agents
+type RemoteKonnectors struct {
+	Agents              []string
+	Secret              string
+	HealthCheckInterval time.Duration
+}
+
+// MailLimits contains the caps on the number of mails that can be sent per
+// day. They can be overridden per context, in the mail.contexts section.
+type MailLimits struct {
+	// PerInstance is the maximal number of mails sent by an instance per day
+	// (0 means no limit)
+	PerInstance int64
+	// PerContext is the maximal number of mails sent by all the instances of
+	// a context per day (0 means no limit)
+	PerContext int64
 }
 
 // Move contains the configuration for the move wizard
@@ -214,12 +334,63 @@ type Move struct {
 	URL string
 }
 
+// Escrow contains the configuration for the escrow exports, made by an
+// operator before destroying an instance, to answer the legal requests.
+type Escrow struct {
+	// Passphrase is used to encrypt the archives (the escrow exports are
+	// disabled if it is empty)
+	Passphrase string
+	// Retention is how long the archives are kept
+	Retention time.Duration
+	// Container is the name of the Swift container, or of the directory,
+	// where the archives are stored, apart from the exports of the users
+	Container string
+}
+
+// Requests contains the configuration for the HTTP client used for the
+// requests between instances, like the replications of the sharings.
+type Requests struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	Timeout             time.Duration
+	HTTP2               bool
+	// Proxy is the URL of the proxy (if empty, the proxy is taken from the
+	// environment variables)
+	Proxy string
+	// UnhealthyThreshold is the number of consecutive failures after which a
+	// host is blacklisted (0 means that the hosts are never blacklisted)
+	UnhealthyThreshold int
+	// BlacklistDuration is how long a host is blacklisted
+	BlacklistDuration time.Duration
+}
+
 // Office contains the configuration for collaborative edition of office
 // documents
 type Office struct {
 	OnlyOfficeURL string
 	InboxSecret   string
 	OutboxSecret  string
+	// WOPIURL is the URL of a document server speaking the WOPI protocol,
+	// like Collabora Online.
+	WOPIURL string
+	// Preview is the configuration for the previews of the office documents
+	// rendered by the server.
+	Preview OfficePreview
+}
+
+// OfficePreview contains the configuration for converting the office
+// documents to PDF/PNG previews with LibreOffice in headless mode.
+type OfficePreview struct {
+	// Cmd is the path to the LibreOffice binary (soffice). The previews are
+	// disabled when it is empty.
+	Cmd string
+	// PoolSize is the maximal number of conversions that can run at the same
+	// time for the context.
+	PoolSize int
+	// Timeout is the maximal duration of a conversion.
+	Timeout time.Duration
 }
 
 // Notifications contains the configuration for the mobile push-notification
@@ -254,6 +425,25 @@ type SMS struct {
 	Provider string
 	URL      string
 	Token    string
+
+	// For the OVH provider
+	ApplicationKey    string
+	ApplicationSecret string
+	ConsumerKey       string
+	ServiceName       string
+	Sender            string
+
+	// For the generic HTTP provider
+	BodyTemplate string
+	ContentType  string
+	Headers      map[string]string
+}
+
+// DKIM contains the parameters for signing the mails with DKIM.
+type DKIM struct {
+	Domain     string
+	Selector   string
+	PrivateKey []byte
 }
 
 // DeprecatedCfg describes the config used to setup [github.com/cozy/cozy-stack/web/auth.DeprecatedAppList].
@@ -274,12 +464,72 @@ type DeprecatedApp struct {
 	StoreURLs map[string]string `mapstructure:"store_urls"`
 }
 
+// SchemaMigration is a migration of the documents of a doctype to a schema
+// version, declared in the config file (see the model/schema package). The
+// rename entries are in the "old:new" format, for the fields at the top level
+// of the documents.
+type SchemaMigration struct {
+	Doctype string   `mapstructure:"doctype"`
+	Version int      `mapstructure:"version"`
+	Rename  []string `mapstructure:"rename"`
+	Remove  []string `mapstructure:"remove"`
+}
+
 // Worker contains the configuration fields for a specific worker type.
 type Worker struct {
 	WorkerType   string
 	Concurrency  *int
 	MaxExecCount *int
 	Timeout      *time.Duration
+	// Retries are the retry policies of the failed jobs, by error class
+	Retries map[string]RetryPolicy
+}
+
+// RetryPolicy describes how the jobs that have failed with a class of errors
+// are retried later, with a new job.
+type RetryPolicy struct {
+	// MaxRetries is the maximal number of retries (0 for no retry)
+	MaxRetries int
+	// Delay is the delay before the first retry, doubled for each retry
+	Delay time.Duration
+	// MaxDelay is the maximal delay between two retries (no limit if 0)
+	MaxDelay time.Duration
+}
+
+func parseRetryPolicies(workerType string, retries map[string]interface{}) (map[string]RetryPolicy, error) {
+	policies := make(map[string]RetryPolicy, len(retries))
+	for class, raw := range retries {
+		key := "jobs.workers." + workerType + ".retries." + class
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config: expecting a map in the key %q", key)
+		}
+		var policy RetryPolicy
+		for k, v := range m {
+			switch k {
+			case "max_retries":
+				if n, ok := v.(int); ok {
+					policy.MaxRetries = n
+				}
+			case "delay", "max_delay":
+				str, _ := v.(string)
+				d, err := time.ParseDuration(str)
+				if err != nil {
+					return nil, fmt.Errorf("config: could not parse %s duration for %q: %s",
+						k, key, err)
+				}
+				if k == "delay" {
+					policy.Delay = d
+				} else {
+					policy.MaxDelay = d
+				}
+			default:
+				return nil, fmt.Errorf("config: unknown key %q", key+"."+k)
+			}
+		}
+		policies[class] = policy
+	}
+	return policies, nil
 }
 
 // GetRedis returns a [redis.UniversalClient] for the given db.
@@ -325,56 +575,57 @@ func GetRedis(v *viper.Viper, mainOpt *redis.UniversalOptions, key, ptr string)
 
 // FsURL returns a copy of the filesystem URL
 func FsURL() *url.URL {
-	return config.Fs.URL
+	return GetConfig().Fs.URL
 }
 
 // ServerAddr returns the address on which the stack is run
 func ServerAddr() string {
-	return net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	return net.JoinHostPort(GetConfig().Host, strconv.Itoa(GetConfig().Port))
 }
 
 // AdminServerAddr returns the address on which the administration is listening
 func AdminServerAddr() string {
-	return net.JoinHostPort(config.AdminHost, strconv.Itoa(config.AdminPort))
+	return net.JoinHostPort(GetConfig().AdminHost, strconv.Itoa(GetConfig().AdminPort))
 }
 
 // CouchCluster returns the CouchDB configuration for the given cluster.
 func CouchCluster(n int) CouchDBCluster {
-	if 0 <= n && n < len(config.CouchDB.Clusters) {
-		return config.CouchDB.Clusters[n]
+	if 0 <= n && n < len(GetConfig().CouchDB.Clusters) {
+		return GetConfig().CouchDB.Clusters[n]
 	}
-	return config.CouchDB.Global
+	return GetConfig().CouchDB.Global
 }
 
 // CouchClient returns the http client to use when making requests to a CouchDB
 // cluster.
 func CouchClient() *http.Client {
-	return config.CouchDB.Client
+	return GetConfig().CouchDB.Client
 }
 
 // Lock return the lock getter.
 func Lock() lock.Getter {
-	return config.Lock
+	return GetConfig().Lock
 }
 
 // GetConfig returns the configured instance of Config
 func GetConfig() *Config {
-	return config
+	cfg, _ := config.Load().(*Config)
+	return cfg
 }
 
 // Avatars return the configured initials service.
 func Avatars() *avatar.Service {
-	return config.Avatars
+	return GetConfig().Avatars
 }
 
 // GetKeyring returns the configured instance of [keyring.Keyring]
 func GetKeyring() keyring.Keyring {
-	return config.Keyring
+	return GetConfig().Keyring
 }
 
 // GetRateLimiter return the setup rate limiter.
 func GetRateLimiter() *limits.RateLimiter {
-	return config.Limiter
+	return GetConfig().Limiter
 }
 
 // GetOIDC returns the OIDC config for the given context (with a boolean to say
@@ -383,7 +634,7 @@ func GetOIDC(contextName string) (map[string]interface{}, bool) {
 	if contextName == "" {
 		return nil, false
 	}
-	auth, ok := config.Authentication[contextName].(map[string]interface{})
+	auth, ok := GetConfig().Authentication[contextName].(map[string]interface{})
 	if !ok {
 		return nil, false
 	}
@@ -397,7 +648,7 @@ func GetFranceConnect(contextName string) (map[string]interface{}, bool) {
 	if contextName == "" {
 		return nil, false
 	}
-	auth, ok := config.Authentication[contextName].(map[string]interface{})
+	auth, ok := GetConfig().Authentication[contextName].(map[string]interface{})
 	if !ok {
 		return nil, false
 	}
@@ -405,11 +656,32 @@ func GetFranceConnect(contextName string) (map[string]interface{}, bool) {
 	return config, ok
 }
 
+// GetMailDKIM returns the parameters for signing the mails sent for the given
+// context with DKIM, or nil if they must not be signed.
+func GetMailDKIM(contextName string) (*DKIM, error) {
+	if ctxConfig, ok := GetConfig().MailPerContext[contextName].(map[string]interface{}); ok {
+		if raw, ok := ctxConfig["dkim"].(map[string]interface{}); ok {
+			return makeDKIM(raw)
+		}
+	}
+	return GetConfig().MailDKIM, nil
+}
+
+func makeCSPRules(rule map[string]interface{}) map[string]string {
+	rules := map[string]string{}
+	for src, list := range rule {
+		if l, ok := list.(string); ok {
+			rules[src] = l
+		}
+	}
+	return rules
+}
+
 var defaultPasswordResetInterval = 15 * time.Minute
 
 // PasswordResetInterval returns the minimal delay between two password reset
 func PasswordResetInterval() time.Duration {
-	return config.PasswordResetInterval
+	return GetConfig().PasswordResetInterval
 }
 
 // Setup Viper to read the environment and the optional config file
@@ -434,12 +706,22 @@ func Setup(cfgFile string) (err error) {
 	}
 
 	log.Debugf("Using config files: %s", cfgFiles)
+	if err := mergeConfigFiles(viper.GetViper(), cfgFiles); err != nil {
+		return err
+	}
+	configFiles = cfgFiles
+
+	return UseViper(viper.GetViper())
+}
 
-	for _, cfgFile = range cfgFiles {
+// mergeConfigFiles executes the templates of the configuration files and
+// merges them in viper.
+func mergeConfigFiles(v *viper.Viper, cfgFiles []string) error {
+	for _, cfgFile := range cfgFiles {
 		tmplName := filepath.Base(cfgFile)
 		tmpl := template.New(tmplName)
 		tmpl = tmpl.Option("missingkey=zero")
-		tmpl, err = tmpl.Funcs(numericFuncsMap).ParseFiles(cfgFile)
+		tmpl, err := tmpl.Funcs(numericFuncsMap).Funcs(secretsFuncsMap()).ParseFiles(cfgFile)
 		if err != nil {
 			return fmt.Errorf("Unable to open and parse configuration file "+
 				"template %s: %s", cfgFile, err)
@@ -460,9 +742,9 @@ func Setup(cfgFile string) (err error) {
 
 		cfgFile = regexp.MustCompile(`\.local$`).ReplaceAllString(cfgFile, "")
 		if ext := filepath.Ext(cfgFile); len(ext) > 0 {
-			viper.SetConfigType(ext[1:])
+			v.SetConfigType(ext[1:])
 		}
-		if err := viper.MergeConfig(dest); err != nil {
+		if err := v.MergeConfig(dest); err != nil {
 			if _, isParseErr := err.(viper.ConfigParseError); isParseErr {
 				log.Errorf("Failed to read cozy-stack configurations from %s", cfgFile)
 				log.Errorf(dest.String())
@@ -470,18 +752,41 @@ func Setup(cfgFile string) (err error) {
 			}
 		}
 	}
-
-	return UseViper(viper.GetViper())
+	return nil
 }
 
 func applyDefaults(v *viper.Viper) {
 	v.SetDefault("password_reset_interval", defaultPasswordResetInterval)
 	v.SetDefault("jobs.imagemagick_convert_cmd", "convert")
 	v.SetDefault("jobs.defaultDurationToKeep", "2W")
+	v.SetDefault("jobs.coalescing_window", time.Minute)
 	v.SetDefault("assets_polling_disabled", false)
 	v.SetDefault("assets_polling_interval", 2*time.Minute)
 	v.SetDefault("fs.versioning.max_number_of_versions_to_keep", 20)
 	v.SetDefault("fs.versioning.min_delay_between_two_versions", 15*time.Minute)
+	v.SetDefault("fs.archive_max_size", int64(10<<30))
+	v.SetDefault("audit.retention", 365*24*time.Hour)
+	v.SetDefault("escrow.retention", 365*24*time.Hour)
+	v.SetDefault("escrow.container", "escrow")
+	v.SetDefault("access_logs.retention", 90*24*time.Hour)
+	v.SetDefault("idempotency.ttl", 24*time.Hour)
+	v.SetDefault("trusted_proxies", []string{"127.0.0.1/8", "::1/128"})
+	v.SetDefault("konnectors.logs_retention", 30*24*time.Hour)
+	v.SetDefault("konnectors.remote.health_check_interval", 30*time.Second)
+	v.SetDefault("konnectors.max_concurrent_per_instance", 3)
+	v.SetDefault("konnectors.input_timeout", 5*time.Minute)
+	v.SetDefault("konnectors.telemetry.interval", 24*time.Hour)
+	v.SetDefault("couchdb.max_concurrent_migrations", 10)
+	v.SetDefault("couchdb.max_concurrent_warmups", 4)
+	v.SetDefault("couchdb.queue_timeout", 10*time.Second)
+	v.SetDefault("mail.daily_limit", 500)
+	v.SetDefault("requests.max_idle_conns", 100)
+	v.SetDefault("requests.max_idle_conns_per_host", 10)
+	v.SetDefault("requests.idle_conn_timeout", 90*time.Second)
+	v.SetDefault("requests.timeout", 10*time.Second)
+	v.SetDefault("requests.http2", true)
+	v.SetDefault("requests.unhealthy_threshold", 5)
+	v.SetDefault("requests.blacklist_duration", 30*time.Second)
 }
 
 func envMap() map[string]string {
@@ -537,6 +842,17 @@ func UseViper(v *viper.Viper) error {
 		return err
 	}
 
+	var replicaURL *url.URL
+	if u := v.GetString("fs.replication.url"); u != "" {
+		replicaURL, err = url.Parse(u)
+		if err != nil {
+			return err
+		}
+		if replicaURL.Scheme != SchemeSwift && replicaURL.Scheme != SchemeSwiftSecure {
+			return fmt.Errorf("The replication is only available for Swift, was: %q", replicaURL.Scheme)
+		}
+	}
+
 	regs, err := makeRegistries(v)
 	if err != nil {
 		return err
@@ -547,6 +863,11 @@ func UseViper(v *viper.Viper) error {
 		return err
 	}
 
+	dkim, err := makeDKIM(v.GetStringMap("mail.dkim"))
+	if err != nil {
+		return err
+	}
+
 	var subdomains SubdomainType
 	if subs := v.GetString("subdomains"); subs != "" {
 		switch subs {
@@ -642,7 +963,9 @@ func UseViper(v *viper.Viper) error {
 	jobs := Jobs{
 		Client:                jobsRedis,
 		ImageMagickConvertCmd: v.GetString("jobs.imagemagick_convert_cmd"),
+		HTMLToPDFCmd:          v.GetString("jobs.html_to_pdf_cmd"),
 		DefaultDurationToKeep: v.GetString("jobs.defaultDurationToKeep"),
+		CoalescingWindow:      v.GetDuration("jobs.coalescing_window"),
 	}
 	{
 		if allow := v.GetBool("jobs.allowlist"); allow {
@@ -686,6 +1009,16 @@ func UseViper(v *viper.Viper) error {
 								}
 								w.Timeout = &d
 							}
+						case "retries":
+							retries, ok := v.(map[string]interface{})
+							if !ok {
+								return fmt.Errorf("config: expecting a map in the key %q",
+									"jobs.workers."+workerType+".retries")
+							}
+							w.Retries, err = parseRetryPolicies(workerType, retries)
+							if err != nil {
+								return err
+							}
 						default:
 							return fmt.Errorf("config: unknown key %q",
 								"jobs.workers."+workerType+"."+k)
@@ -713,6 +1046,7 @@ func UseViper(v *viper.Viper) error {
 
 	cspAllowList := map[string]string{}
 	cspPerContext := map[string]map[string]string{}
+	cspPerApp := map[string]map[string]string{}
 	cspList := v.GetStringMap("csp_allowlist")
 	for key, value := range cspList {
 		if val, ok := value.(string); ok {
@@ -720,18 +1054,23 @@ func UseViper(v *viper.Viper) error {
 		} else if val, ok := value.(map[string]interface{}); ok && key == "contexts" {
 			for ctx, rules := range val {
 				if rule, ok := rules.(map[string]interface{}); ok {
-					forContext := map[string]string{}
-					for src, list := range rule {
-						if l, ok := list.(string); ok {
-							forContext[src] = l
-						}
-					}
-					cspPerContext[ctx] = forContext
+					cspPerContext[ctx] = makeCSPRules(rule)
+				}
+			}
+		} else if val, ok := value.(map[string]interface{}); ok && key == "apps" {
+			for slug, rules := range val {
+				if rule, ok := rules.(map[string]interface{}); ok {
+					cspPerApp[slug] = makeCSPRules(rule)
 				}
 			}
 		}
 	}
 
+	trustedProxies, err := parseTrustedProxies(v.GetStringSlice("trusted_proxies"))
+	if err != nil {
+		return err
+	}
+
 	cacheStorage := cache.New(cacheRedis)
 	avatars := avatar.NewService(cacheStorage, v.GetString("jobs.imagemagick_convert_cmd"))
 
@@ -746,7 +1085,7 @@ func UseViper(v *viper.Viper) error {
 		return fmt.Errorf("failed to setup the keyring: %w", err)
 	}
 
-	config = &Config{
+	cfg := &Config{
 		Host: v.GetString("host"),
 		Port: v.GetInt("port"),
 
@@ -764,6 +1103,11 @@ func UseViper(v *viper.Viper) error {
 		Hooks:                 v.GetString("hooks"),
 		GeoDB:                 v.GetString("geodb"),
 		PasswordResetInterval: v.GetDuration("password_reset_interval"),
+		DestroyGracePeriod:    v.GetDuration("destroy_grace_period"),
+		AuditRetention:        v.GetDuration("audit.retention"),
+		AccessLogsRetention:   v.GetDuration("access_logs.retention"),
+		IdempotencyTTL:        v.GetDuration("idempotency.ttl"),
+		TrustedProxies:        trustedProxies,
 
 		RemoteAssets: v.GetStringMapString("remote_assets"),
 
@@ -778,33 +1122,60 @@ func UseViper(v *viper.Viper) error {
 			Versioning: FsVersioning{
 				MaxNumberToKeep:            v.GetInt("fs.versioning.max_number_of_versions_to_keep"),
 				MinDelayBetweenTwoVersions: v.GetDuration("fs.versioning.min_delay_between_two_versions"),
+				MaxAge:                     v.GetDuration("fs.versioning.max_age_of_versions"),
+				MaxTotalSize:               v.GetInt64("fs.versioning.max_size_of_versions"),
+			},
+			ArchiveMaxSize: v.GetInt64("fs.archive_max_size"),
+			Contexts:       v.GetStringMap("fs.contexts"),
+			Replication: FsReplication{
+				URL:      replicaURL,
+				Failover: v.GetBool("fs.replication.failover"),
+			},
+			Tiering: FsTiering{
+				StoragePolicy: v.GetString("fs.tiering.storage_policy"),
+				VersionsAfter: v.GetString("fs.tiering.versions_after"),
+				TrashAfter:    v.GetString("fs.tiering.trash_after"),
 			},
-			Contexts: v.GetStringMap("fs.contexts"),
 		},
 		CouchDB: couch,
 		Jobs:    jobs,
 		Konnectors: Konnectors{
-			Cmd: v.GetString("konnectors.cmd"),
+			Cmd:           v.GetString("konnectors.cmd"),
+			LogsRetention: v.GetDuration("konnectors.logs_retention"),
+			Remote: RemoteKonnectors{
+				Agents:              v.GetStringSlice("konnectors.remote.agents"),
+				Secret:              v.GetString("konnectors.remote.secret"),
+				HealthCheckInterval: v.GetDuration("konnectors.remote.health_check_interval"),
+			},
+			MaxConcurrentPerInstance: v.GetInt("konnectors.max_concurrent_per_instance"),
+			InputTimeout:             v.GetDuration("konnectors.input_timeout"),
+			Telemetry: KonnectorsTelemetry{
+				Enabled:  v.GetBool("konnectors.telemetry.enabled"),
+				URL:      v.GetString("konnectors.telemetry.url"),
+				Interval: v.GetDuration("konnectors.telemetry.interval"),
+				Epsilon:  v.GetFloat64("konnectors.telemetry.epsilon"),
+			},
 		},
 		Move: Move{
 			URL: v.GetString("move.url"),
 		},
-		Notifications: Notifications{
-			Development: v.GetBool("notifications.development"),
-
-			FCMServer:     v.GetString("notifications.fcm_server"),
-			AndroidAPIKey: v.GetString("notifications.android_api_key"),
-
-			IOSCertificateKeyPath:  v.GetString("notifications.ios_certificate_key_path"),
-			IOSCertificatePassword: v.GetString("notifications.ios_certificate_password"),
-			IOSKeyID:               v.GetString("notifications.ios_key_id"),
-			IOSTeamID:              v.GetString("notifications.ios_team_id"),
-
-			HuaweiGetTokenURL:     v.GetString("notifications.huawei_get_token"),
-			HuaweiSendMessagesURL: v.GetString("notifications.huawei_send_message"),
-
-			Contexts: makeSMS(v.GetStringMap("notifications.contexts")),
+		Escrow: Escrow{
+			Passphrase: v.GetString("escrow.passphrase"),
+			Retention:  v.GetDuration("escrow.retention"),
+			Container:  v.GetString("escrow.container"),
+		},
+		Requests: Requests{
+			MaxIdleConns:        v.GetInt("requests.max_idle_conns"),
+			MaxIdleConnsPerHost: v.GetInt("requests.max_idle_conns_per_host"),
+			MaxConnsPerHost:     v.GetInt("requests.max_conns_per_host"),
+			IdleConnTimeout:     v.GetDuration("requests.idle_conn_timeout"),
+			Timeout:             v.GetDuration("requests.timeout"),
+			HTTP2:               v.GetBool("requests.http2"),
+			Proxy:               v.GetString("requests.proxy"),
+			UnhealthyThreshold:  v.GetInt("requests.unhealthy_threshold"),
+			BlacklistDuration:   v.GetDuration("requests.blacklist_duration"),
 		},
+		Notifications: makeNotifications(v),
 		Flagship: Flagship{
 			Contexts:              v.GetStringMap("flagship.contexts"),
 			APKPackageNames:       v.GetStringSlice("flagship.apk_package_names"),
@@ -818,15 +1189,13 @@ func UseViper(v *viper.Viper) error {
 		OauthStateStorage: oauthStateRedis,
 		Realtime:          realtimeRedis,
 		CacheStorage:      cacheStorage,
-		Mail: &gomail.DialerOptions{
-			Host:                      v.GetString("mail.host"),
-			Port:                      v.GetInt("mail.port"),
-			Username:                  v.GetString("mail.username"),
-			Password:                  v.GetString("mail.password"),
-			DisableTLS:                v.GetBool("mail.disable_tls"),
-			SkipCertificateValidation: v.GetBool("mail.skip_certificate_validation"),
+		Mail:              makeMail(v),
+		MailPerContext:    v.GetStringMap("mail.contexts"),
+		MailDKIM:          dkim,
+		MailLimits: MailLimits{
+			PerInstance: v.GetInt64("mail.daily_limit"),
+			PerContext:  v.GetInt64("mail.context_daily_limit"),
 		},
-		MailPerContext: v.GetStringMap("mail.contexts"),
 		Contexts:       v.GetStringMap("contexts"),
 		Authentication: v.GetStringMap("authentication"),
 		Office:         office,
@@ -834,33 +1203,40 @@ func UseViper(v *viper.Viper) error {
 
 		CSPAllowList:  cspAllowList,
 		CSPPerContext: cspPerContext,
+		CSPPerApp:     cspPerApp,
 
 		AssetsPollingDisabled: v.GetBool("assets_polling_disabled"),
 		AssetsPollingInterval: v.GetDuration("assets_polling_interval"),
 	}
 
-	err = v.UnmarshalKey("deprecated_apps", &config.DeprecatedApps)
+	err = v.UnmarshalKey("deprecated_apps", &cfg.DeprecatedApps)
 	if err != nil {
 		return fmt.Errorf(`failed to parse the config for "deprecated_apps": %w`, err)
 	}
 
-	err = v.UnmarshalKey("clouderies", &config.Clouderies)
+	err = v.UnmarshalKey("clouderies", &cfg.Clouderies)
 	if err != nil {
 		return fmt.Errorf(`failed to parse the config for "clouderies": %w`, err)
 	}
 
+	err = v.UnmarshalKey("schema_migrations", &cfg.SchemaMigrations)
+	if err != nil {
+		return fmt.Errorf(`failed to parse the config for "schema_migrations": %w`, err)
+	}
+
 	// For compatibility
-	if len(config.CSPAllowList) == 0 {
-		config.CSPAllowList = v.GetStringMapString("csp_whitelist")
+	if len(cfg.CSPAllowList) == 0 {
+		cfg.CSPAllowList = v.GetStringMapString("csp_whitelist")
 	}
 
 	if build.IsDevRelease() && v.GetBool("disable_csp") {
-		config.CSPDisabled = true
+		cfg.CSPDisabled = true
 	}
 
 	if v.GetBool("remote_allow_custom_port") {
-		config.RemoteAllowCustomPort = true
+		cfg.RemoteAllowCustomPort = true
 	}
+	config.Store(cfg)
 
 	loggerOpts := logger.Options{
 		Level: v.GetString("log.level"),
@@ -885,23 +1261,49 @@ func UseViper(v *viper.Viper) error {
 	return nil
 }
 
+// makeMail returns the options for the SMTP server
+func makeMail(v *viper.Viper) *gomail.DialerOptions {
+	return &gomail.DialerOptions{
+		Host:                      v.GetString("mail.host"),
+		Port:                      v.GetInt("mail.port"),
+		Username:                  v.GetString("mail.username"),
+		Password:                  v.GetString("mail.password"),
+		DisableTLS:                v.GetBool("mail.disable_tls"),
+		SkipCertificateValidation: v.GetBool("mail.skip_certificate_validation"),
+	}
+}
+
+// makeNotifications returns the configuration for the push notifications
+func makeNotifications(v *viper.Viper) Notifications {
+	return Notifications{
+		Development: v.GetBool("notifications.development"),
+
+		FCMServer:     v.GetString("notifications.fcm_server"),
+		AndroidAPIKey: v.GetString("notifications.android_api_key"),
+
+		IOSCertificateKeyPath:  v.GetString("notifications.ios_certificate_key_path"),
+		IOSCertificatePassword: v.GetString("notifications.ios_certificate_password"),
+		IOSKeyID:               v.GetString("notifications.ios_key_id"),
+		IOSTeamID:              v.GetString("notifications.ios_team_id"),
+
+		HuaweiGetTokenURL:     v.GetString("notifications.huawei_get_token"),
+		HuaweiSendMessagesURL: v.GetString("notifications.huawei_send_message"),
+
+		Contexts: makeSMS(v.GetStringMap("notifications.contexts")),
+	}
+}
+
 func makeCouch(v *viper.Viper) (CouchDB, error) {
 	var couch CouchDB
-	couchClient, _, err := tlsclient.NewHTTPClient(tlsclient.HTTPEndpoint{
-		Timeout:             10 * time.Second,
-		MaxIdleConnsPerHost: 20,
-		RootCAFile:          v.GetString("couchdb.root_ca"),
-		ClientCertificateFiles: tlsclient.ClientCertificateFilePair{
-			CertificateFile: v.GetString("couchdb.client_cert"),
-			KeyFile:         v.GetString("couchdb.client_key"),
-		},
-		PinnedKey:              v.GetString("couchdb.pinned_key"),
-		InsecureSkipValidation: v.GetBool("couchdb.insecure_skip_validation"),
-	})
+	couchClient, err := makeCouchClient(v)
 	if err != nil {
 		return couch, err
 	}
 	couch.Client = couchClient
+	couch.MaxConcurrentMigrations = v.GetInt("couchdb.max_concurrent_migrations")
+	couch.MaxConcurrentWarmUps = v.GetInt("couchdb.max_concurrent_warmups")
+	maxRequests := v.GetInt("couchdb.max_concurrent_requests")
+	queueTimeout := v.GetDuration("couchdb.queue_timeout")
 
 	couchURL, couchAuth, err := parseURL(v.GetString("couchdb.url"))
 	if err != nil {
@@ -911,9 +1313,12 @@ func makeCouch(v *viper.Viper) (CouchDB, error) {
 		couchURL.Path = "/"
 	}
 	couch.Global = CouchDBCluster{
-		Auth:     couchAuth,
-		URL:      couchURL,
-		Creation: true,
+		Auth:                  couchAuth,
+		URL:                   couchURL,
+		Creation:              true,
+		Client:                couchClient,
+		MaxConcurrentRequests: maxRequests,
+		QueueTimeout:          queueTimeout,
 	}
 
 	if clusters, ok := v.Get("couchdb.clusters").([]interface{}); ok {
@@ -931,20 +1336,69 @@ func makeCouch(v *viper.Viper) (CouchDB, error) {
 			if c, ok := cluster["instance_creation"].(bool); ok {
 				creation = c
 			}
+			// Each cluster has its own pool of connections, so that a slow
+			// cluster can't take all the connections.
+			client, err := makeCouchClient(v)
+			if err != nil {
+				return couch, err
+			}
+			max := maxRequests
+			switch m := cluster["max_concurrent_requests"].(type) {
+			case int:
+				max = m
+			case float64:
+				max = int(m)
+			}
+			timeout := queueTimeout
+			if t, ok := cluster["queue_timeout"].(string); ok {
+				if timeout, err = time.ParseDuration(t); err != nil {
+					return couch, fmt.Errorf("Invalid queue_timeout for the CouchDB cluster %s: %w", u, err)
+				}
+			}
 			couch.Clusters = append(couch.Clusters, CouchDBCluster{
-				Auth:     couchAuth,
-				URL:      couchURL,
-				Creation: creation,
+				Auth:                  couchAuth,
+				URL:                   couchURL,
+				Creation:              creation,
+				Client:                client,
+				MaxConcurrentRequests: max,
+				QueueTimeout:          timeout,
 			})
 		}
 	}
 
+	if autoIndexes, ok := v.Get("couchdb.auto_indexes").(map[string]interface{}); ok {
+		couch.AutoIndexes = make(map[string][]string, len(autoIndexes))
+		for context, doctypes := range autoIndexes {
+			list, _ := doctypes.([]interface{})
+			for _, doctype := range list {
+				if d, ok := doctype.(string); ok {
+					couch.AutoIndexes[context] = append(couch.AutoIndexes[context], d)
+				}
+			}
+		}
+	}
+
 	if len(couch.Clusters) == 0 {
 		couch.Clusters = []CouchDBCluster{couch.Global}
 	}
 	return couch, nil
 }
 
+func makeCouchClient(v *viper.Viper) (*http.Client, error) {
+	client, _, err := tlsclient.NewHTTPClient(tlsclient.HTTPEndpoint{
+		Timeout:             10 * time.Second,
+		MaxIdleConnsPerHost: 20,
+		RootCAFile:          v.GetString("couchdb.root_ca"),
+		ClientCertificateFiles: tlsclient.ClientCertificateFilePair{
+			CertificateFile: v.GetString("couchdb.client_cert"),
+			KeyFile:         v.GetString("couchdb.client_key"),
+		},
+		PinnedKey:              v.GetString("couchdb.pinned_key"),
+		InsecureSkipValidation: v.GetBool("couchdb.insecure_skip_validation"),
+	})
+	return client, err
+}
+
 func makeRegistries(v *viper.Viper) (map[string][]*url.URL, error) {
 	regs := make(map[string][]*url.URL)
 
@@ -1001,8 +1455,13 @@ func makeOffice(v *viper.Viper) (map[string]Office, error) {
 		if !ok {
 			return nil, errors.New("Bad format in the office section of the configuration file")
 		}
-		url, ok := ctx["onlyoffice_url"].(string)
-		if !ok {
+		url, _ := ctx["onlyoffice_url"].(string)
+		wopi, _ := ctx["wopi_url"].(string)
+		preview, err := makeOfficePreview(ctx["preview"])
+		if err != nil {
+			return nil, err
+		}
+		if url == "" && wopi == "" && preview.Cmd == "" {
 			return nil, errors.New("Bad format in the office section of the configuration file")
 		}
 		inbox, _ := ctx["onlyoffice_inbox_secret"].(string)
@@ -1011,20 +1470,62 @@ func makeOffice(v *viper.Viper) (map[string]Office, error) {
 			OnlyOfficeURL: url,
 			InboxSecret:   inbox,
 			OutboxSecret:  outbox,
+			WOPIURL:       wopi,
+			Preview:       preview,
 		}
 	}
 
 	if url := v.GetString("office.default.onlyoffice_url"); url != "" {
+		preview, err := makeOfficePreview(v.Get("office.default.preview"))
+		if err != nil {
+			return nil, err
+		}
 		office[DefaultInstanceContext] = Office{
 			OnlyOfficeURL: url,
 			InboxSecret:   v.GetString("office.default.onlyoffice_inbox_secret"),
 			OutboxSecret:  v.GetString("office.default.onlyoffice_outbox_secret"),
+			WOPIURL:       v.GetString("office.default.wopi_url"),
+			Preview:       preview,
 		}
 	}
 
 	return office, nil
 }
 
+func makeOfficePreview(raw interface{}) (OfficePreview, error) {
+	var preview OfficePreview
+	if raw == nil {
+		return preview, nil
+	}
+	ctx, ok := raw.(map[string]interface{})
+	if !ok {
+		return preview, errors.New("Bad format in the office.preview section of the configuration file")
+	}
+	preview.Cmd, _ = ctx["cmd"].(string)
+	if preview.Cmd == "" {
+		return preview, nil
+	}
+	preview.PoolSize = 2
+	preview.Timeout = 60 * time.Second
+	switch size := ctx["pool_size"].(type) {
+	case int:
+		preview.PoolSize = size
+	case float64:
+		preview.PoolSize = int(size)
+	}
+	if preview.PoolSize <= 0 {
+		return preview, errors.New("Bad pool_size in the office.preview section of the configuration file")
+	}
+	if timeout, ok := ctx["timeout"].(string); ok && timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return preview, errors.New("Bad timeout in the office.preview section of the configuration file")
+		}
+		preview.Timeout = d
+	}
+	return preview, nil
+}
+
 func makeSMS(raw map[string]interface{}) map[string]SMS {
 	sms := make(map[string]SMS)
 	for name, val := range raw {
@@ -1038,11 +1539,46 @@ func makeSMS(raw map[string]interface{}) map[string]SMS {
 		}
 		url, _ := entry["url"].(string)
 		token, _ := entry["token"].(string)
-		sms[name] = SMS{Provider: provider, URL: url, Token: token}
+		cfg := SMS{Provider: provider, URL: url, Token: token}
+		cfg.ApplicationKey, _ = entry["application_key"].(string)
+		cfg.ApplicationSecret, _ = entry["application_secret"].(string)
+		cfg.ConsumerKey, _ = entry["consumer_key"].(string)
+		cfg.ServiceName, _ = entry["service_name"].(string)
+		cfg.Sender, _ = entry["sender"].(string)
+		cfg.BodyTemplate, _ = entry["body_template"].(string)
+		cfg.ContentType, _ = entry["content_type"].(string)
+		if headers, ok := entry["headers"].(map[string]interface{}); ok {
+			cfg.Headers = make(map[string]string, len(headers))
+			for k, v := range headers {
+				cfg.Headers[k], _ = v.(string)
+			}
+		}
+		sms[name] = cfg
 	}
 	return sms
 }
 
+func makeDKIM(raw map[string]interface{}) (*DKIM, error) {
+	selector, _ := raw["selector"].(string)
+	if selector == "" {
+		return nil, nil
+	}
+	domain, _ := raw["domain"].(string)
+	key, _ := raw["private_key"].(string)
+	if key != "" {
+		return &DKIM{Domain: domain, Selector: selector, PrivateKey: []byte(key)}, nil
+	}
+	keyPath, _ := raw["private_key_path"].(string)
+	if keyPath == "" {
+		return nil, errors.New("DKIM: missing private_key or private_key_path")
+	}
+	content, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("DKIM: cannot read the private key: %w", err)
+	}
+	return &DKIM{Domain: domain, Selector: selector, PrivateKey: content}, nil
+}
+
 func createTestViper() *viper.Viper {
 	v := viper.New()
 	v.SetConfigName("cozy.test")
@@ -1138,3 +1674,37 @@ func parseURL(u string) (*url.URL, *url.Userinfo, error) {
 	parsedURL.User = nil
 	return parsedURL, user, nil
 }
+
+// parseTrustedProxies parses the list of the IP addresses and networks of the
+// reverse proxies in front of the stack.
+func parseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	proxies := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// IsTrustedProxy returns true if the given IP address is the one of a
+// reverse proxy in front of the stack, that can be trusted for the
+// X-Forwarded-For header.
+func (c *Config) IsTrustedProxy(ip net.IP) bool {
+	for _, network := range c.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
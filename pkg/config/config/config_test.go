@@ -1,6 +1,10 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -10,6 +14,7 @@ import (
 	"github.com/cozy/cozy-stack/pkg/prefixer"
 	"github.com/cozy/gomail"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,6 +35,7 @@ func TestConfigUnmarshal(t *testing.T) {
 	assert.Equal(t, cfg.ReplyTo, "support@cozycloud.cc")
 	assert.Equal(t, cfg.GeoDB, "/geo/db/path")
 	assert.Equal(t, cfg.PasswordResetInterval, time.Hour)
+	assert.Equal(t, 90*24*time.Hour, cfg.AuditRetention)
 
 	// Assets
 	assert.Equal(t, true, cfg.AssetsPollingDisabled)
@@ -46,7 +52,12 @@ func TestConfigUnmarshal(t *testing.T) {
 	assert.Equal(t, FsVersioning{
 		MaxNumberToKeep:            4,
 		MinDelayBetweenTwoVersions: time.Minute,
+		MaxAge:                     720 * time.Hour,
+		MaxTotalSize:               1073741824,
 	}, cfg.Fs.Versioning)
+	require.NotNil(t, cfg.Fs.Replication.URL)
+	assert.Equal(t, "swift://openstack-region2/?Region=region2", cfg.Fs.Replication.URL.String())
+	assert.True(t, cfg.Fs.Replication.Failover)
 
 	// Jobs
 	one := 1
@@ -60,6 +71,9 @@ func TestConfigUnmarshal(t *testing.T) {
 			Concurrency:  &one,
 			MaxExecCount: &one,
 			Timeout:      &oneHour,
+			Retries: map[string]RetryPolicy{
+				"network": {MaxRetries: 3, Delay: 5 * time.Minute, MaxDelay: time.Hour},
+			},
 		},
 	}, cfg.Jobs.Workers)
 
@@ -83,6 +97,14 @@ func TestConfigUnmarshal(t *testing.T) {
 				URL:      "https://some-notif-url",
 				Token:    "some-token",
 			},
+			"ovh-context": {
+				Provider:          "ovh",
+				ApplicationKey:    "some-app-key",
+				ApplicationSecret: "some-app-secret",
+				ConsumerKey:       "some-consumer-key",
+				ServiceName:       "sms-ab12345-1",
+				Sender:            "Cozy",
+			},
 		},
 	}, cfg.Notifications)
 
@@ -98,6 +120,11 @@ func TestConfigUnmarshal(t *testing.T) {
 	assert.EqualValues(t, map[string]interface{}{
 		"my-context": map[string]interface{}{"host": "-"},
 	}, cfg.MailPerContext)
+	assert.EqualValues(t, &DKIM{
+		Domain:     "bar.baz",
+		Selector:   "cozy",
+		PrivateKey: []byte("some-private-key"),
+	}, cfg.MailDKIM)
 
 	// Contexts
 	assert.EqualValues(t, map[string]interface{}{
@@ -145,6 +172,7 @@ func TestConfigUnmarshal(t *testing.T) {
 			OnlyOfficeURL: "https://onlyoffice-url",
 			InboxSecret:   "inbox_secret",
 			OutboxSecret:  "outbox_secret",
+			WOPIURL:       "https://wopi-url",
 		},
 	}, cfg.Office)
 
@@ -181,6 +209,9 @@ func TestConfigUnmarshal(t *testing.T) {
 			"connect": "https://connect-url",
 		},
 	}, cfg.CSPPerContext)
+	assert.EqualValues(t, map[string]map[string]string{
+		"drive": {"connect": "https://analytics-url"},
+	}, cfg.CSPPerApp)
 }
 
 func TestUseViper(t *testing.T) {
@@ -188,6 +219,9 @@ func TestUseViper(t *testing.T) {
 	cfg.Set("couchdb.url", "http://db:1234")
 	assert.NoError(t, UseViper(cfg))
 	assert.Equal(t, "http://db:1234/", CouchCluster(prefixer.GlobalCouchCluster).URL.String())
+
+	cfg.Set("fs.replication.url", "file:///var/lib/cozy-replica")
+	assert.Error(t, UseViper(cfg))
 }
 
 func TestSetup(t *testing.T) {
@@ -257,6 +291,148 @@ registries:
 	assert.EqualValues(t, []string{"https://default"}, regsToStrings(GetConfig().Registries[DefaultInstanceContext]))
 }
 
+func TestReloadSecrets(t *testing.T) {
+	viper.Reset()
+	password := "first"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"data":{"data":{"password":%q,"couch":"admin:%s"},"metadata":{}}}`, password, password)
+	}))
+	defer ts.Close()
+	t.Setenv("VAULT_ADDR", ts.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	tmpdir := t.TempDir()
+	cfgFile := filepath.Join(tmpdir, "cozy.yaml")
+	require.NoError(t, os.WriteFile(cfgFile, []byte(`
+fs:
+  url: file://`+tmpdir+`/storage
+couchdb:
+  url: http://{{ vault "secret/data/cozy" "couch" }}@db:5984/
+mail:
+  host: smtp.example.net
+  password: {{ vault "secret/data/cozy" "password" }}
+authentication:
+  foo:
+    oidc:
+      client_secret: {{ vault "secret/data/cozy/foo" "password" }}
+`), 0600))
+
+	require.NoError(t, Setup(cfgFile))
+	assert.Equal(t, "first", GetConfig().Mail.Password)
+	pass, _ := CouchCluster(prefixer.GlobalCouchCluster).Auth.Password()
+	assert.Equal(t, "first", pass)
+
+	reloaded := false
+	OnSecretsReload(func() error {
+		reloaded = true
+		return nil
+	})
+	before := GetConfig()
+	password = "second"
+	require.NoError(t, ReloadSecrets())
+	assert.True(t, reloaded)
+	assert.Equal(t, "first", before.Mail.Password)
+	assert.Equal(t, "second", GetConfig().Mail.Password)
+	assert.Equal(t, "smtp.example.net", GetConfig().Mail.Host)
+	pass, _ = CouchCluster(prefixer.GlobalCouchCluster).Auth.Password()
+	assert.Equal(t, "second", pass)
+	oidc, ok := GetOIDC("foo")
+	require.True(t, ok)
+	assert.Equal(t, "second", oidc["client_secret"])
+
+	// The limits of the pool of connections to CouchDB are also reloaded,
+	// but the HTTP client is kept
+	client := CouchCluster(prefixer.GlobalCouchCluster).Client
+	require.NoError(t, os.WriteFile(cfgFile, []byte(`
+fs:
+  url: file://`+tmpdir+`/storage
+couchdb:
+  url: http://{{ vault "secret/data/cozy" "couch" }}@db:5984/
+  max_concurrent_requests: 20
+  queue_timeout: 3s
+mail:
+  host: smtp.example.net
+  password: {{ vault "secret/data/cozy" "password" }}
+authentication:
+  foo:
+    oidc:
+      client_secret: {{ vault "secret/data/cozy/foo" "password" }}
+`), 0600))
+	require.NoError(t, ReloadSecrets())
+	assert.Equal(t, 20, CouchCluster(prefixer.GlobalCouchCluster).MaxConcurrentRequests)
+	assert.Equal(t, 3*time.Second, CouchCluster(prefixer.GlobalCouchCluster).QueueTimeout)
+	assert.Equal(t, client, CouchCluster(prefixer.GlobalCouchCluster).Client)
+
+	// The keys removed from the file are removed from the configuration,
+	// and all the hooks are called even if one of them fails
+	require.NoError(t, os.WriteFile(cfgFile, []byte(`
+fs:
+  url: file://`+tmpdir+`/storage
+couchdb:
+  url: http://{{ vault "secret/data/cozy" "couch" }}@db:5984/
+`), 0600))
+	OnSecretsReload(func() error {
+		return errors.New("failed")
+	})
+	called := false
+	OnSecretsReload(func() error {
+		called = true
+		return nil
+	})
+	assert.Error(t, ReloadSecrets())
+	assert.True(t, called)
+	_, ok = GetOIDC("foo")
+	assert.False(t, ok)
+	assert.Empty(t, GetConfig().Mail.Password)
+
+	require.NoError(t, os.WriteFile(cfgFile, []byte(`
+fs:
+  url: file://`+tmpdir+`/other
+`), 0600))
+	assert.Error(t, ReloadSecrets())
+}
+
+func TestReloadSecretsKeepsFlags(t *testing.T) {
+	viper.Reset()
+	reloadHooks = nil
+	tmpdir := t.TempDir()
+	cfgFile := filepath.Join(tmpdir, "cozy.yaml")
+	require.NoError(t, os.WriteFile(cfgFile, []byte(`
+fs:
+  url: file://`+tmpdir+`/storage
+mail:
+  host: smtp.example.net
+  password: secret
+`), 0600))
+
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	flags.String("mail-host", "localhost", "mail smtp host")
+	flags.String("fs-url", "", "filesystem url")
+	require.NoError(t, flags.Parse([]string{
+		"--mail-host", "smtp.flag.net",
+		"--fs-url", "file://" + tmpdir + "/storage",
+	}))
+	require.NoError(t, BindPFlag("mail.host", flags.Lookup("mail-host")))
+	require.NoError(t, BindPFlag("fs.url", flags.Lookup("fs-url")))
+	t.Cleanup(func() {
+		delete(boundFlags, "mail.host")
+		delete(boundFlags, "fs.url")
+	})
+
+	require.NoError(t, Setup(cfgFile))
+	assert.Equal(t, "smtp.flag.net", GetConfig().Mail.Host)
+
+	require.NoError(t, os.WriteFile(cfgFile, []byte(`
+mail:
+  host: smtp.example.net
+  password: other
+`), 0600))
+	require.NoError(t, ReloadSecrets())
+	assert.Equal(t, "smtp.flag.net", GetConfig().Mail.Host)
+	assert.Equal(t, "other", GetConfig().Mail.Password)
+	assert.Equal(t, "file://"+tmpdir+"/storage", GetConfig().Fs.URL.String())
+}
+
 func regsToStrings(regs []*url.URL) []string {
 	ss := make([]string, len(regs))
 	for i, r := range regs {
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/cozy/cozy-stack/pkg/secrets"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	secretsResolver = secrets.NewResolver()
+
+	// configFiles are the configuration files used by Setup, and read again
+	// when the secrets are reloaded.
+	configFiles []string
+
+	// boundFlags are the command-line flags bound to the configuration keys,
+	// bound again on the viper used to reload the secrets.
+	boundFlags = make(map[string]*pflag.Flag)
+
+	reloadMu    sync.Mutex
+	reloadHooks []func() error
+)
+
+// BindPFlag binds a command-line flag to a key of the configuration, like
+// viper.BindPFlag, and keeps this binding for the reloads of the secrets.
+func BindPFlag(key string, flag *pflag.Flag) error {
+	if err := viper.BindPFlag(key, flag); err != nil {
+		return err
+	}
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	boundFlags[key] = flag
+	return nil
+}
+
+// secretsFuncsMap returns the functions for the templates of the
+// configuration files that fetch the secrets:
+//
+//	password: {{ vault "secret/data/cozy/smtp" "password" }}
+//	password: {{ sops "/etc/cozy/secrets.enc.yaml" "mail.password" }}
+func secretsFuncsMap() template.FuncMap {
+	return template.FuncMap{
+		"vault": secretsResolver.Vault,
+		"sops":  secretsResolver.Sops,
+	}
+}
+
+// OnSecretsReload registers a function that is called after the secrets have
+// been reloaded, for the services that keep a client initialized with them.
+func OnSecretsReload(fn func() error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// ReloadSecrets reads the configuration files again, with fresh values from
+// Vault and the SOPS files, and replaces the secrets in the current
+// configuration: the credentials for CouchDB, Swift and the SMTP servers, the
+// limits of the pools of connections to CouchDB, the keys for the push
+// notifications, and the contexts (OAuth and OIDC providers for example). The
+// other parameters need a restart of the stack to be changed. The values given
+// by the command-line flags are kept.
+//
+// The new configuration is swapped with the current one only when all the
+// secrets have been read. The hooks are then all called, even if one of them
+// fails.
+func ReloadSecrets() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	secretsResolver.Flush()
+	// A new viper is used, so that the keys removed from the configuration
+	// files are not kept from the previous values.
+	v := viper.New()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.SetEnvPrefix("cozy")
+	v.AutomaticEnv()
+	applyDefaults(v)
+	for key, flag := range boundFlags {
+		if err := v.BindPFlag(key, flag); err != nil {
+			return err
+		}
+	}
+	if err := mergeConfigFiles(v, configFiles); err != nil {
+		return err
+	}
+	next, err := applySecrets(GetConfig(), v)
+	if err != nil {
+		return err
+	}
+	config.Store(next)
+
+	var errm error
+	for _, fn := range reloadHooks {
+		if err := fn(); err != nil {
+			errm = multierror.Append(errm, err)
+		}
+	}
+	if errm != nil {
+		return errm
+	}
+	log.Infof("The secrets have been reloaded")
+	return nil
+}
+
+// applySecrets returns a copy of the current configuration with the secrets
+// from viper. The current configuration is not modified, as it can be read
+// concurrently.
+func applySecrets(current *Config, v *viper.Viper) (*Config, error) {
+	couch, err := makeCouch(v)
+	if err != nil {
+		return nil, err
+	}
+	dkim, err := makeDKIM(v.GetStringMap("mail.dkim"))
+	if err != nil {
+		return nil, err
+	}
+	fsURL, err := rotatedURL(current.Fs.URL, v.GetString("fs.url"), "fs.url")
+	if err != nil {
+		return nil, err
+	}
+	var replicaURL *url.URL
+	if current.Fs.Replication.URL != nil {
+		replicaURL, err = rotatedURL(current.Fs.Replication.URL, v.GetString("fs.replication.url"), "fs.replication.url")
+		if err != nil {
+			return nil, err
+		}
+	}
+	var clouderies map[string]ClouderyConfig
+	if err := v.UnmarshalKey("clouderies", &clouderies); err != nil {
+		return nil, fmt.Errorf(`failed to parse the config for "clouderies": %w`, err)
+	}
+
+	next := *current
+	next.Fs.URL = fsURL
+	if replicaURL != nil {
+		next.Fs.Replication.URL = replicaURL
+	}
+	if fsURL.String() != current.Fs.URL.String() ||
+		(replicaURL != nil && replicaURL.String() != current.Fs.Replication.URL.String()) {
+		if err := InitSwiftConnection(next.Fs); err != nil {
+			return nil, err
+		}
+	}
+
+	// The HTTP clients are kept, but the credentials and the limits of the
+	// pools of connections can be changed.
+	reloadCluster(&next.CouchDB.Global, couch.Global)
+	next.CouchDB.Clusters = make([]CouchDBCluster, len(current.CouchDB.Clusters))
+	copy(next.CouchDB.Clusters, current.CouchDB.Clusters)
+	for i := range next.CouchDB.Clusters {
+		if i < len(couch.Clusters) && couch.Clusters[i].URL.String() == next.CouchDB.Clusters[i].URL.String() {
+			reloadCluster(&next.CouchDB.Clusters[i], couch.Clusters[i])
+		}
+	}
+
+	next.Mail = makeMail(v)
+	next.MailPerContext = v.GetStringMap("mail.contexts")
+	next.MailDKIM = dkim
+	next.Notifications = makeNotifications(v)
+	next.Contexts = v.GetStringMap("contexts")
+	next.Authentication = v.GetStringMap("authentication")
+	next.Clouderies = clouderies
+	return &next, nil
+}
+
+func reloadCluster(cluster *CouchDBCluster, reloaded CouchDBCluster) {
+	cluster.Auth = reloaded.Auth
+	cluster.MaxConcurrentRequests = reloaded.MaxConcurrentRequests
+	cluster.QueueTimeout = reloaded.QueueTimeout
+}
+
+// rotatedURL parses the new URL of a storage, and checks that only its
+// credentials have changed.
+func rotatedURL(current *url.URL, raw, key string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != current.Scheme || u.Host != current.Host || u.Path != current.Path {
+		return nil, fmt.Errorf("%s can't be changed without a restart", key)
+	}
+	return u, nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -10,10 +11,11 @@ import (
 )
 
 var swiftConn *swift.Connection
+var swiftReplicaConn *swift.Connection
 
 // InitDefaultSwiftConnection initializes the default swift handler.
 func InitDefaultSwiftConnection() error {
-	return InitSwiftConnection(config.Fs)
+	return InitSwiftConnection(GetConfig().Fs)
 }
 
 // InitSwiftConnection initialize the global swift handler connection. This is
@@ -24,6 +26,30 @@ func InitSwiftConnection(fs Fs) error {
 		return nil
 	}
 
+	// In failover mode, the primary region can be lost: the stack can still
+	// start, and the connection will try to authenticate again later.
+	failover := fs.Replication.URL != nil && fs.Replication.Failover
+	conn, err := newSwiftConnection(fsURL, fs.Transport)
+	if err != nil && !failover {
+		return err
+	}
+	swiftConn = conn
+
+	swiftReplicaConn = nil
+	if fs.Replication.URL != nil {
+		conn, err = newSwiftConnection(fs.Replication.URL, fs.Transport)
+		if err != nil {
+			return err
+		}
+		swiftReplicaConn = conn
+	}
+	return nil
+}
+
+// newSwiftConnection creates a connection for the given URL, and tries to
+// authenticate. The connection is returned even if the authentication has
+// failed.
+func newSwiftConnection(fsURL *url.URL, transport http.RoundTripper) (*swift.Connection, error) {
 	q := fsURL.Query()
 	isSecure := fsURL.Scheme == SchemeSwiftSecure
 
@@ -68,7 +94,7 @@ func InitSwiftConnection(fs Fs) error {
 		}
 	}
 
-	swiftConn = &swift.Connection{
+	conn := &swift.Connection{
 		UserName:       username,
 		ApiKey:         password,
 		AuthUrl:        authURL.String(),
@@ -80,18 +106,18 @@ func InitSwiftConnection(fs Fs) error {
 		Region:         q.Get("Region"),
 		EndpointType:   endpointType,
 		// Copying a file needs a long timeout on large files
-		Transport:      fs.Transport,
+		Transport:      transport,
 		ConnectTimeout: timeout,
 		Timeout:        timeout,
 	}
 
-	if err = swiftConn.Authenticate(context.Background()); err != nil {
+	if err = conn.Authenticate(context.Background()); err != nil {
 		log.Errorf("Authentication failed with the OpenStack Swift server on %s",
-			swiftConn.AuthUrl)
-		return err
+			conn.AuthUrl)
+		return conn, err
 	}
-	log.Infof("Successfully authenticated with server %s", swiftConn.AuthUrl)
-	return nil
+	log.Infof("Successfully authenticated with server %s", conn.AuthUrl)
+	return conn, nil
 }
 
 // GetSwiftConnection returns a swift.Connection pointer created from the
@@ -102,3 +128,10 @@ func GetSwiftConnection() *swift.Connection {
 	}
 	return swiftConn
 }
+
+// GetSwiftReplicaConnection returns the swift.Connection for the secondary
+// endpoint used for the replication, or nil if the replication is not
+// configured.
+func GetSwiftReplicaConnection() *swift.Connection {
+	return swiftReplicaConn
+}
@@ -27,6 +27,15 @@ const (
 	ClientsUsageID = "io.cozy.settings.clients-usage"
 	// DiskUsageID is the id of the settings JSON-API response for disk-usage
 	DiskUsageID = "io.cozy.settings.disk-usage"
+	// AccessLogsSettingsID is the id of the settings JSON-API response for
+	// the doctypes with access logs
+	AccessLogsSettingsID = "io.cozy.settings.access-logs"
+	// UsageSettingsID is the id of the settings document with the usage
+	// metrics of the instance, computed periodically by the usage worker
+	UsageSettingsID = "io.cozy.settings.usage"
+	// AnonymousIDSettingsID is the id of the settings document with the
+	// nonce used to compute the anonymous identifier of the instance
+	AnonymousIDSettingsID = "io.cozy.settings.anonymous-id"
 	// InstanceSettingsID is the id of settings document for the instance
 	InstanceSettingsID = "io.cozy.settings.instance"
 	// CapabilitiesSettingsID is the id of the settings document with the
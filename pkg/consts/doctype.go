@@ -14,28 +14,71 @@ const (
 	// AppsOpenParameters doc type for the parameters used by the flagship to
 	// open a webapp
 	AppsOpenParameters = "io.cozy.apps.open"
+	// AppsProvisioning doc type for the report of the provisioning of the
+	// apps and konnectors defined by the context of the instance
+	AppsProvisioning = "io.cozy.apps.provisioning"
 	// AppLogs doc type for logs sent by apps and konnectors
 	AppLogs = "io.cozy.apps.logs"
 	// Konnectors doc type for konnector application manifests
 	Konnectors = "io.cozy.konnectors"
 	// KonnectorsMaintenance doc type for maintenance of konnectors.
 	KonnectorsMaintenance = "io.cozy.konnectors.maintenance"
+	// KonnectorsAvailability doc type for the unavailability windows of the
+	// konnectors configured by the administrators.
+	KonnectorsAvailability = "io.cozy.konnectors.availability"
+	// KonnectorsLogs doc type for the logs of the executions of konnectors
+	KonnectorsLogs = "io.cozy.konnectors.logs"
+	// KonnectorsSummaries doc type for the summaries of the executions of
+	// konnectors, displayed in the timeline of the Home app
+	KonnectorsSummaries = "io.cozy.konnectors.summaries"
+	// KonnectorsInputs doc type for the inputs asked to the user by a running
+	// konnector (a 2FA code, the answer to a captcha, etc.)
+	KonnectorsInputs = "io.cozy.konnectors.inputs"
+	// CSPPolicies doc type for the sources added to the CSP of a webapp
+	CSPPolicies = "io.cozy.csp.policies"
+	// UploadPolicies doc type for the rules that block some uploads in a
+	// context
+	UploadPolicies = "io.cozy.files.upload_policies"
 	// Archives doc type for zip archives with files and directories
 	Archives = "io.cozy.files.archives"
 	// Exports doc type for global exports archives
 	Exports = "io.cozy.exports"
+	// Escrows doc type for the escrow exports of the instances, made before
+	// their destruction for the legal requests
+	Escrows = "io.cozy.escrows"
 	// ExportsRequests doc type for a request to move to another Cozy
 	ExportsRequests = "io.cozy.exports.requests"
 	// Imports doc type for global exports archives
 	Imports = "io.cozy.imports"
 	// Doctypes doc type for doctype list
 	Doctypes = "io.cozy.doctypes"
+	// DoctypesMigrations doc type for the progress of the migrations of the
+	// documents of a doctype to its last schema version
+	DoctypesMigrations = "io.cozy.doctypes.migrations"
 	// Files doc type for type for files and directories
 	Files = "io.cozy.files"
 	// FilesMetadata doc type for metadata of files
 	FilesMetadata = "io.cozy.files.metadata"
 	// FilesVersions doc type for versioning file contents
 	FilesVersions = "io.cozy.files.versions"
+	// FilesJournal doc type for the journal of the objects written in Swift,
+	// used for the replication to a secondary region
+	FilesJournal = "io.cozy.files.journal"
+	// FilesSnapshots doc type for the restore points of a file tree
+	FilesSnapshots = "io.cozy.files.snapshots"
+	// FilesSnapshotEntries doc type for the files and directories saved in a
+	// snapshot
+	FilesSnapshotEntries = "io.cozy.files.snapshots.entries"
+	// FilesCheckpoints doc type for the last sequence of the changes feed
+	// delivered to an OAuth client
+	FilesCheckpoints = "io.cozy.files.checkpoints"
+	// FilesImports doc type for the imports of files from Google Drive or
+	// OneDrive
+	FilesImports = "io.cozy.files.imports"
+	// FilesPreparedArchives doc type for the zip archives built in background
+	FilesPreparedArchives = "io.cozy.files.prepared_archives"
+	// FilesFsckReports doc type for the reports of the fsck jobs
+	FilesFsckReports = "io.cozy.files.fsck_reports"
 	// FilesShortcuts doc type for high-level information about .url files
 	FilesShortcuts = "io.cozy.files.shortcuts"
 	// Thumbnails is a synthetic doctype for thumbnails, used for realtime
@@ -58,18 +101,55 @@ const (
 	Jobs = "io.cozy.jobs"
 	// JobEvents doc type for real time events sent by jobs
 	JobEvents = "io.cozy.jobs.events"
+	// MailsBounces doc type for the email addresses where mails have bounced
+	MailsBounces = "io.cozy.mails.bounces"
 	// Support doc type for sending mail to the support
 	Support = "io.cozy.support"
+	// SupportAccesses doc type for the accesses granted by the user to the
+	// support team
+	SupportAccesses = "io.cozy.support.accesses"
 	// Notifications doc type for notifications
 	Notifications = "io.cozy.notifications"
+	// NotificationsBadges doc type for the real time events with the number of
+	// unread notifications of an app
+	NotificationsBadges = "io.cozy.notifications.badges"
 	// OAuthAccessCodes doc type for OAuth2 access codes
 	OAuthAccessCodes = "io.cozy.oauth.access_codes"
 	// OAuthClients doc type for OAuth2 clients
 	OAuthClients = "io.cozy.oauth.clients"
 	// Permissions doc type for permissions identifying a connection
 	Permissions = "io.cozy.permissions"
+	// PermissionsUsage doc type for the date of the last use of the
+	// permissions of the apps, konnectors and OAuth clients
+	PermissionsUsage = "io.cozy.permissions.usage"
+	// UnoptimalQueries doc type for the shapes of the _find queries that
+	// cannot use an index
+	UnoptimalQueries = "io.cozy.couchdb.unoptimal_queries"
+	// Audit doc type for the audit trail of the changes on permissions and
+	// sharings
+	Audit = "io.cozy.audit"
+	// AccessLogs doc type for the logs of the reads made on the doctypes for
+	// which the user has enabled the access logs
+	AccessLogs = "io.cozy.access.logs"
+	// SharingsAnalytics doc type for the anonymized statistics of the
+	// accesses to the share by links and the sharing previews
+	SharingsAnalytics = "io.cozy.sharings.analytics"
+	// SharingsSuggestions doc type for the recipients suggested for the new
+	// sharings, computed from the previous ones
+	SharingsSuggestions = "io.cozy.sharings.suggestions"
+	// SharingsWebhooks doc type for the webhook where the owner of a sharing
+	// receives its events.
+	SharingsWebhooks = "io.cozy.sharings.webhooks"
 	// Contacts doc type for sharing
 	Contacts = "io.cozy.contacts"
+	// ContactsDuplicates doc type for the pairs of contacts that may be
+	// duplicates
+	ContactsDuplicates = "io.cozy.contacts.duplicates"
+	// ContactsMerges doc type for the merges of contacts that can be undone
+	ContactsMerges = "io.cozy.contacts.merges"
+	// ContactsImports doc type for the imports of contacts from vCard or CSV
+	// files
+	ContactsImports = "io.cozy.contacts.imports"
 	// RemoteRequests doc type for logging requests to remote websites
 	RemoteRequests = "io.cozy.remote.requests"
 	// RemoteSecrets doc type for secrets used by remote doctypes
@@ -90,6 +170,12 @@ const (
 	SharingsAnswer = "io.cozy.sharings.answer"
 	// SharingsMoved doc type for when a Cozy is moved to a new address
 	SharingsMoved = "io.cozy.sharings.moved"
+	// SharingsIdentity doc type for when the email or the public name of a
+	// member of a sharing has changed
+	SharingsIdentity = "io.cozy.sharings.identity"
+	// SharingsRemoteFiles doc type for the metadata of the files of a sharing
+	// in metadata-only mode, on the instances of the recipients
+	SharingsRemoteFiles = "io.cozy.sharings.remote_files"
 	// SharingsInitialSync doc type for real-time events for initial sync of a
 	// sharing
 	SharingsInitialSync = "io.cozy.sharings.initial_sync"
@@ -97,6 +183,14 @@ const (
 	Triggers = "io.cozy.triggers"
 	// TriggersState doc type for triggers current state, jobs launchers
 	TriggersState = "io.cozy.triggers.state"
+	// TriggersHistory doc type for the history of the executions of a trigger
+	TriggersHistory = "io.cozy.triggers.history"
+	// WebhookSubscriptions doc type for the subscriptions of the outbound
+	// webhooks
+	WebhookSubscriptions = "io.cozy.webhooks.subscriptions"
+	// WebhookDeliveries doc type for the log of the deliveries of a webhook
+	// subscription
+	WebhookDeliveries = "io.cozy.webhooks.deliveries"
 	// Accounts doc type for accounts
 	Accounts = "io.cozy.accounts"
 	// SoftDeletedAccounts doc type for old revisions of deleted accounts
@@ -114,6 +208,9 @@ const (
 	// BitwardenContacts doc type for Bitwarden users that can be added to
 	// an organization
 	BitwardenContacts = "com.bitwarden.contacts"
+	// BitwardenReports doc type for the reports computed on the Bitwarden
+	// vault, like the password health report
+	BitwardenReports = "com.bitwarden.reports"
 	// NotesDocuments doc type is used for manipulating the documents that
 	// represents a note before they are persisted to a file.
 	NotesDocuments = "io.cozy.notes.documents"
@@ -125,10 +222,22 @@ const (
 	// NotesEvents doc type is used for realtime events related to a note, like
 	// a change of title.
 	NotesEvents = "io.cozy.notes.events"
+	// NotesPresences doc type is used for realtime events about the users
+	// that have a note opened.
+	NotesPresences = "io.cozy.notes.presences"
+	// Comments doc type is used for the comments posted on a file, including
+	// by the members that preview a sharing.
+	Comments = "io.cozy.comments"
+	// CommentsEvents doc type is used for realtime events about the comments
+	// of a file.
+	CommentsEvents = "io.cozy.comments.events"
 	// NotesURL doc type is used to return the URL where a note can be edited.
 	NotesURL = "io.cozy.notes.url"
 	// NotesImages doc type used for images used by a note
 	NotesImages = "io.cozy.notes.images"
+	// NotesTemplates doc type is used for the templates from which the notes
+	// can be created.
+	NotesTemplates = "io.cozy.notes.templates"
 	// OfficeURL doc type is used to return the URL where an office document can be edited.
 	OfficeURL = "io.cozy.office.url"
 	// AuthConfirmations doc type used for realtime events when confirming
@@ -11,6 +11,9 @@ const (
 	RegistrationTokenAudience = "registration" // OAuth registration tokens
 	AccessTokenAudience       = "access"       // OAuth access tokens
 	RefreshTokenAudience      = "refresh"      // OAuth refresh tokens
+	WOPIAudience              = "wopi"         // used by WOPI document servers
+	DelegatedAudience         = "delegated"    // used by third parties with a token minted by an app
+	UploadAudience            = "upload"       // used by devices that can only upload files in a directory
 )
 
 // TokenValidityDuration is the duration where a token is valid in seconds (1 week)
@@ -20,6 +23,19 @@ var (
 	AppTokenValidityDuration       = 24 * time.Hour
 	KonnectorTokenValidityDuration = 30 * time.Minute
 	CLITokenValidityDuration       = 30 * time.Minute
+	WOPITokenValidityDuration      = 10 * time.Hour
+
+	// DelegatedTokenValidityDuration is the default duration of a token
+	// minted by an app for a third party, and MaxDelegatedTokenValidityDuration
+	// is the maximal duration that an app can ask.
+	DelegatedTokenValidityDuration    = 1 * time.Hour
+	MaxDelegatedTokenValidityDuration = 24 * time.Hour
+
+	// SupportAccessValidityDuration is the default duration of an access
+	// granted by the user to the support, and MaxSupportAccessValidityDuration
+	// is the maximal duration that can be granted.
+	SupportAccessValidityDuration    = 24 * time.Hour
+	MaxSupportAccessValidityDuration = 7 * 24 * time.Hour
 
 	AccessTokenValidityDuration = 7 * 24 * time.Hour
 )
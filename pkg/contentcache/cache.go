@@ -0,0 +1,166 @@
+// Package contentcache is a cache for the content of files that are not
+// stored on the instance, like the files of a sharing in metadata-only mode
+// that are fetched on demand from the instance of the owner.
+package contentcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/crypto"
+	"github.com/ncw/swift/v2"
+	"github.com/spf13/afero"
+)
+
+const (
+	containerName = "contents"
+	ttl           = 7 * 24 * time.Hour
+)
+
+// Cache is an interface for keeping the content of remote files for a while.
+type Cache interface {
+	// Open returns the cached content for the key, or an error that matches
+	// os.ErrNotExist if it is not in the cache.
+	Open(key string) (io.ReadCloser, error)
+	// Create returns a writer for putting a content in the cache. The content
+	// is available to Open only after Commit has been called.
+	Create(key, mime string) (Writer, error)
+}
+
+// Writer is used to write a content in the cache.
+type Writer interface {
+	io.Writer
+	// Commit makes the content available in the cache.
+	Commit() error
+	// Abort discards the content.
+	Abort()
+}
+
+// SystemCache returns the global cache, using the configuration file.
+func SystemCache() Cache {
+	fsURL := config.FsURL()
+	switch fsURL.Scheme {
+	case config.SchemeFile, config.SchemeMem:
+		fs := afero.NewBasePathFs(afero.NewOsFs(), path.Join(fsURL.Path, containerName))
+		return aferoCache{fs}
+	case config.SchemeSwift, config.SchemeSwiftSecure:
+		conn := config.GetSwiftConnection()
+		ctx := context.Background()
+		return swiftCache{conn, ctx}
+	default:
+		panic(fmt.Errorf("contentcache: unknown storage provider %s", fsURL.Scheme))
+	}
+}
+
+type aferoCache struct {
+	fs afero.Fs
+}
+
+func (a aferoCache) Open(key string) (io.ReadCloser, error) {
+	infos, err := a.fs.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	// There is no expiration with afero, so it is checked on reading
+	if time.Since(infos.ModTime()) > ttl {
+		_ = a.fs.Remove(key)
+		return nil, os.ErrNotExist
+	}
+	return a.fs.Open(key)
+}
+
+func (a aferoCache) Create(key, mime string) (Writer, error) {
+	if err := a.fs.MkdirAll(path.Dir(key), 0700); err != nil {
+		return nil, err
+	}
+	tmp := key + ".tmp-" + crypto.GenerateRandomString(8)
+	f, err := a.fs.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &aferoWriter{fs: a.fs, f: f, tmp: tmp, key: key}, nil
+}
+
+type aferoWriter struct {
+	fs  afero.Fs
+	f   afero.File
+	tmp string
+	key string
+}
+
+func (w *aferoWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *aferoWriter) Commit() error {
+	if err := w.f.Close(); err != nil {
+		_ = w.fs.Remove(w.tmp)
+		return err
+	}
+	return w.fs.Rename(w.tmp, w.key)
+}
+
+func (w *aferoWriter) Abort() {
+	_ = w.f.Close()
+	_ = w.fs.Remove(w.tmp)
+}
+
+type swiftCache struct {
+	c   *swift.Connection
+	ctx context.Context
+}
+
+func (s swiftCache) Open(key string) (io.ReadCloser, error) {
+	f, _, err := s.c.ObjectOpen(s.ctx, containerName, key, false, nil)
+	if errors.Is(err, swift.ObjectNotFound) || errors.Is(err, swift.ContainerNotFound) {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s swiftCache) Create(key, mime string) (Writer, error) {
+	if _, _, err := s.c.Container(s.ctx, containerName); errors.Is(err, swift.ContainerNotFound) {
+		if err = s.c.ContainerCreate(s.ctx, containerName, nil); err != nil {
+			return nil, err
+		}
+	}
+	objectMeta := swift.Metadata{"created-at": time.Now().Format(time.RFC3339)}
+	headers := objectMeta.ObjectHeaders()
+	headers["X-Delete-After"] = strconv.FormatInt(int64(ttl.Seconds()), 10)
+	f, err := s.c.ObjectCreate(s.ctx, containerName, key, false, "", mime, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &swiftWriter{s: s, f: f, key: key}, nil
+}
+
+type swiftWriter struct {
+	s   swiftCache
+	f   *swift.ObjectCreateFile
+	key string
+}
+
+func (w *swiftWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *swiftWriter) Commit() error {
+	return w.f.Close()
+}
+
+func (w *swiftWriter) Abort() {
+	// The object is created when the writer is closed, so it must be deleted
+	// after that
+	_ = w.f.Close()
+	_ = w.s.c.ObjectDelete(w.s.ctx, containerName, w.key)
+}
@@ -0,0 +1,61 @@
+package contentcache
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAferoCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	cache := aferoCache{fs}
+
+	t.Run("Commit", func(t *testing.T) {
+		_, err := cache.Open("prefix/foo")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		w, err := cache.Create("prefix/foo", "text/plain")
+		require.NoError(t, err)
+		_, err = w.Write([]byte("hello"))
+		require.NoError(t, err)
+		_, err = cache.Open("prefix/foo")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		require.NoError(t, w.Commit())
+
+		f, err := cache.Open("prefix/foo")
+		require.NoError(t, err)
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(content))
+		require.NoError(t, f.Close())
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		w, err := cache.Create("prefix/bar", "text/plain")
+		require.NoError(t, err)
+		_, err = w.Write([]byte("hello"))
+		require.NoError(t, err)
+		w.Abort()
+
+		_, err = cache.Open("prefix/bar")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		files, err := afero.ReadDir(fs, "prefix")
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		old := time.Now().Add(-2 * ttl)
+		require.NoError(t, fs.Chtimes("prefix/foo", old, old))
+		_, err := cache.Open("prefix/foo")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		exists, err := afero.Exists(fs, "prefix/foo")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
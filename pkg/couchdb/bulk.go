@@ -10,7 +10,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/couchdb/revision"
 	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/prefixer"
@@ -172,7 +171,7 @@ func MakeAllDocsRequest(db prefixer.Prefixer, doctype string, params *AllDocsReq
 	}
 
 	start := time.Now()
-	resp, err := config.CouchClient().Do(req)
+	resp, err := clientFor(db.DBCluster()).Do(req)
 	elapsed := time.Since(start)
 	// Possible err = mostly connection failure
 	if err != nil {
@@ -345,6 +344,9 @@ func BulkDeleteDocs(db prefixer.Prefixer, doctype string, docs []Doc) error {
 	if len(docs) == 0 {
 		return nil
 	}
+	if err := CheckDeletion(db, doctype); err != nil {
+		return err
+	}
 	body := struct {
 		Docs []json.RawMessage `json:"docs"`
 	}{
@@ -0,0 +1,116 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+)
+
+// MaxBulkChanges is the maximal number of changes in a bulk realtime event.
+// When a bulk operation changes more documents, several bulk events are
+// published.
+const MaxBulkChanges = 1000
+
+// bulkEvents coalesces the realtime events of a bulk operation. The hooks are
+// still run for each change, and the events for each change are still
+// published for the subscribers that have not enabled the bulk events, like
+// the triggers.
+type bulkEvents struct {
+	refs    int
+	changes map[string][]realtime.BulkChange // by doctype
+	order   []string
+}
+
+var (
+	bulkMu   sync.Mutex
+	bulkByDB = make(map[prefixer.Prefixer]*bulkEvents)
+)
+
+// CoalesceEvents starts to coalesce the realtime events for the given
+// prefixer: a single bulk event per doctype is published when the returned
+// function is called, for the websocket clients that have asked for them. It
+// is used by the bulk operations, like moving or deleting thousands of files,
+// to avoid overwhelming these clients.
+//
+// Only the changes made with this prefixer are coalesced: for a request, it
+// is the instance loaded for this request, and the changes made by the other
+// requests on the same instance are not coalesced.
+func CoalesceEvents(db prefixer.Prefixer) func() {
+	key := db
+	bulkMu.Lock()
+	b, ok := bulkByDB[key]
+	if !ok {
+		b = &bulkEvents{changes: make(map[string][]realtime.BulkChange)}
+		bulkByDB[key] = b
+	}
+	b.refs++
+	bulkMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			bulkMu.Lock()
+			b.refs--
+			if b.refs > 0 {
+				bulkMu.Unlock()
+				return
+			}
+			delete(bulkByDB, key)
+			bulkMu.Unlock()
+			b.publish(db)
+		})
+	}
+}
+
+// coalesceEvent adds the change to the bulk events of the prefixer, and
+// returns false if the events of this prefixer are not coalesced.
+func coalesceEvent(db prefixer.Prefixer, verb string, doc Doc) bool {
+	bulkMu.Lock()
+	defer bulkMu.Unlock()
+	b, ok := bulkByDB[db]
+	if !ok {
+		return false
+	}
+	doctype := doc.DocType()
+	if _, ok := b.changes[doctype]; !ok {
+		b.order = append(b.order, doctype)
+	}
+	b.changes[doctype] = append(b.changes[doctype], newBulkChange(verb, doc))
+	return true
+}
+
+func newBulkChange(verb string, doc Doc) realtime.BulkChange {
+	change := realtime.BulkChange{Verb: verb, ID: doc.ID(), Rev: doc.Rev()}
+	if doc.DocType() != consts.Files {
+		return change
+	}
+	var fields map[string]interface{}
+	if j, ok := doc.(*JSONDoc); ok {
+		fields = j.M
+	} else if buf, err := json.Marshal(doc); err == nil {
+		_ = json.Unmarshal(buf, &fields)
+	}
+	change.Type, _ = fields["type"].(string)
+	change.DirID, _ = fields["dir_id"].(string)
+	change.Path, _ = fields["path"].(string)
+	return change
+}
+
+func (b *bulkEvents) publish(db prefixer.Prefixer) {
+	hub := realtime.GetHub()
+	for _, doctype := range b.order {
+		changes := b.changes[doctype]
+		for len(changes) > 0 {
+			n := len(changes)
+			if n > MaxBulkChanges {
+				n = MaxBulkChanges
+			}
+			doc := &realtime.BulkDoc{Type: doctype, Changes: changes[:n]}
+			hub.Publish(db, realtime.EventBulk, doc, nil)
+			changes = changes[n:]
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package couchdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceEvents(t *testing.T) {
+	config.UseTestFile(t)
+	db := prefixer.NewPrefixer(0, "bulk", "bulk-events-tests")
+	sub := realtime.GetHub().Subscriber(db)
+	defer sub.Close()
+	sub.EnableBulkEvents()
+	sub.Subscribe(TestDoctype)
+	sub.Watch(consts.Files, "file-2")
+
+	// A subscriber that has not enabled the bulk events, like the triggers
+	legacy := realtime.GetHub().Subscriber(db)
+	defer legacy.Close()
+	legacy.Subscribe(TestDoctype)
+	time.Sleep(10 * time.Millisecond)
+
+	nextOf := func(t *testing.T, sub *realtime.Subscriber) *realtime.Event {
+		select {
+		case e := <-sub.Channel:
+			require.NotNil(t, e)
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("the event has not been published")
+		}
+		return nil
+	}
+	next := func(t *testing.T) *realtime.Event { return nextOf(t, sub) }
+	noneOf := func(t *testing.T, sub *realtime.Subscriber) {
+		select {
+		case e := <-sub.Channel:
+			t.Fatalf("unexpected event %v", e)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	none := func(t *testing.T) { noneOf(t, sub) }
+
+	t.Run("Bulk", func(t *testing.T) {
+		flush := CoalesceEvents(db)
+		RTEvent(db, realtime.EventCreate, &testDoc{TestID: "one", TestRev: "1-abc"}, nil)
+		RTEvent(db, realtime.EventDelete, &testDoc{TestID: "two", TestRev: "2-abc"}, nil)
+		RTEvent(db, realtime.EventUpdate, &JSONDoc{
+			Type: consts.Files,
+			M: map[string]interface{}{
+				"_id":    "file-2",
+				"_rev":   "3-abc",
+				"type":   consts.FileType,
+				"dir_id": "dir-1",
+			},
+		}, nil)
+		none(t)
+		ids := []string{nextOf(t, legacy).Doc.ID(), nextOf(t, legacy).Doc.ID()}
+		assert.ElementsMatch(t, []string{"one", "two"}, ids)
+
+		flush()
+		// The events for two doctypes are not published in the same topic,
+		// and can be received in any order.
+		bulks := make(map[string]*realtime.BulkDoc)
+		for i := 0; i < 2; i++ {
+			e := next(t)
+			assert.Equal(t, realtime.EventBulk, e.Verb)
+			bulk, ok := realtime.AsBulkDoc(e.Doc)
+			require.True(t, ok)
+			bulks[bulk.DocType()] = bulk
+		}
+		require.Contains(t, bulks, TestDoctype)
+		assert.Equal(t, []realtime.BulkChange{
+			{Verb: realtime.EventCreate, ID: "one", Rev: "1-abc"},
+			{Verb: realtime.EventDelete, ID: "two", Rev: "2-abc"},
+		}, bulks[TestDoctype].Changes)
+		require.Contains(t, bulks, consts.Files)
+		assert.Equal(t, []realtime.BulkChange{
+			{Verb: realtime.EventUpdate, ID: "file-2", Rev: "3-abc", Type: consts.FileType, DirID: "dir-1"},
+		}, bulks[consts.Files].Changes)
+
+		// Calling flush again does nothing
+		flush()
+		none(t)
+		noneOf(t, legacy)
+	})
+
+	t.Run("OtherRequest", func(t *testing.T) {
+		flush := CoalesceEvents(db)
+		defer flush()
+		// Same database, but another prefixer, like the instance loaded by
+		// another request
+		other := prefixer.NewPrefixer(0, "bulk", "bulk-events-tests")
+		RTEvent(other, realtime.EventCreate, &testDoc{TestID: "five", TestRev: "1-abc"}, nil)
+		e := next(t)
+		assert.Equal(t, realtime.EventCreate, e.Verb)
+		assert.Equal(t, "five", e.Doc.ID())
+		assert.Equal(t, "five", nextOf(t, legacy).Doc.ID())
+	})
+
+	t.Run("Nested", func(t *testing.T) {
+		outer := CoalesceEvents(db)
+		inner := CoalesceEvents(db)
+		RTEvent(db, realtime.EventCreate, &testDoc{TestID: "three", TestRev: "1-abc"}, nil)
+		inner()
+		none(t)
+		outer()
+		e := next(t)
+		assert.Equal(t, realtime.EventBulk, e.Verb)
+		assert.Equal(t, "three", nextOf(t, legacy).Doc.ID())
+	})
+
+	t.Run("NotCoalesced", func(t *testing.T) {
+		RTEvent(db, realtime.EventCreate, &testDoc{TestID: "four", TestRev: "1-abc"}, nil)
+		e := next(t)
+		assert.Equal(t, realtime.EventCreate, e.Verb)
+		assert.Equal(t, "four", e.Doc.ID())
+		assert.Equal(t, "four", nextOf(t, legacy).Doc.ID())
+	})
+}
@@ -20,6 +20,9 @@ type ChangesFeedStyle string
 const (
 	// ChangesModeNormal is the only mode supported by cozy-stack
 	ChangesModeNormal ChangesFeedMode = "normal"
+	// ChangesModeLongPoll waits for a change before sending the response. It
+	// is only used internally by the stack.
+	ChangesModeLongPoll ChangesFeedMode = "longpoll"
 	// ChangesStyleAllDocs pass all revisions including conflicts
 	ChangesStyleAllDocs ChangesFeedStyle = "all_docs"
 	// ChangesStyleMainOnly only pass the winning revision
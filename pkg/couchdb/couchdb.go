@@ -44,11 +44,22 @@ type Doc interface {
 
 // RTEvent published a realtime event for a couchDB change
 func RTEvent(db prefixer.Prefixer, verb string, doc, oldDoc Doc) {
+	if unguarded, ok := db.(unguardedDB); ok {
+		db = unguarded.Prefixer
+	}
+	if buffer, ok := db.(*EventsBuffer); ok {
+		buffer.push(verb, doc, oldDoc)
+		return
+	}
 	if err := runHooks(db, verb, doc, oldDoc); err != nil {
 		logger.WithDomain(db.DomainName()).WithNamespace("couchdb").
 			Errorf("error in hooks on %s %s %v\n", verb, doc.DocType(), err)
 	}
 	docClone := doc.Clone()
+	if coalesceEvent(db, verb, doc) {
+		go realtime.PublishCoalesced(db, verb, docClone, oldDoc)
+		return
+	}
 	go realtime.GetHub().Publish(db, verb, docClone, oldDoc)
 }
 
@@ -303,7 +314,7 @@ func makeRequest(db prefixer.Prefixer, doctype, method, path string, reqbody int
 	}
 
 	start := time.Now()
-	resp, err := config.CouchClient().Do(req)
+	resp, err := clientFor(db.DBCluster()).Do(req)
 	elapsed := time.Since(start)
 	// Possible err = mostly connection failure
 	if err != nil {
@@ -524,6 +535,9 @@ func DeleteDoc(db prefixer.Prefixer, doc Doc) error {
 	if id == "" {
 		return fmt.Errorf("Missing ID for DeleteDoc")
 	}
+	if err := CheckDeletion(db, doc.DocType()); err != nil {
+		return err
+	}
 	old := doc.Clone()
 
 	// XXX Specific log for the deletion of an account, to help monitor this
@@ -744,7 +758,7 @@ func Copy(db prefixer.Prefixer, doctype, path, destination string) (map[string]i
 	if err != nil {
 		return nil, err
 	}
-	resp, err := config.CouchClient().Do(req)
+	resp, err := clientFor(db.DBCluster()).Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -789,9 +803,12 @@ func findDocsRaw(db prefixer.Prefixer, doctype string, req interface{}, results
 		}
 		return nil, err
 	}
-	if !ignoreUnoptimized && strings.Contains(response.Warning, "matching index found") {
-		// Developers should not rely on fullscan with no index.
-		return nil, unoptimalError()
+	if strings.Contains(response.Warning, "matching index found") {
+		runUnoptimalQueryHooks(db, doctype, req)
+		if !ignoreUnoptimized {
+			// Developers should not rely on fullscan with no index.
+			return nil, unoptimalError()
+		}
 	}
 	if response.Bookmark == "nil" {
 		// CouchDB surprisingly returns "nil" when there is no doc
@@ -805,6 +822,23 @@ func FindDocsRaw(db prefixer.Prefixer, doctype string, req interface{}, results
 	return findDocsRaw(db, doctype, req, results, false)
 }
 
+// FindDocsRawUnoptimized is like FindDocsRaw, but it allows the queries that
+// cannot use an index.
+// /!\ Use with care
+func FindDocsRawUnoptimized(db prefixer.Prefixer, doctype string, req interface{}, results interface{}) (*FindResponse, error) {
+	return findDocsRaw(db, doctype, req, results, true)
+}
+
+// ExplainFind asks CouchDB which index would be used for a _find query,
+// without executing it.
+func ExplainFind(db prefixer.Prefixer, doctype string, req interface{}) (*ExplainResponse, error) {
+	var response ExplainResponse
+	if err := makeRequest(db, doctype, http.MethodPost, "_explain", &req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
 // NormalDocs returns all the documents from a database, with pagination, but
 // it excludes the design docs.
 func NormalDocs(db prefixer.Prefixer, doctype string, skip, limit int, bookmark string, executionStats bool) (*NormalDocsResponse, error) {
@@ -874,6 +908,21 @@ type FindResponse struct {
 	ExecutionStats *ExecutionStats `json:"execution_stats,omitempty"`
 }
 
+// ExplainResponse is returned by CouchDB on _explain queries
+type ExplainResponse struct {
+	Index struct {
+		DDoc string `json:"ddoc"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"index"`
+}
+
+// IsFullScan returns true when no index can be used for the query, and all
+// the documents of the database would be scanned.
+func (e *ExplainResponse) IsFullScan() bool {
+	return e.Index.Type == "special"
+}
+
 // ExecutionStats is returned by CouchDB on _find queries
 type ExecutionStats struct {
 	TotalKeysExamined       int     `json:"total_keys_examined,omitempty"`
@@ -173,6 +173,18 @@ func IsConflictError(err error) bool {
 	return couchErr.StatusCode == http.StatusConflict
 }
 
+// IsBadRequestError checks if an error from the error tree
+// contains a CouchDB 400 (Bad Request) status code.
+func IsBadRequestError(err error) bool {
+	var couchErr *Error
+
+	if ok := errors.As(err, &couchErr); !ok {
+		return false
+	}
+
+	return couchErr.StatusCode == http.StatusBadRequest
+}
+
 // IsNoUsableIndexError checks if an error from the error tree
 // contains a "no_usable_index" error.
 func IsNoUsableIndexError(err error) bool {
@@ -0,0 +1,61 @@
+package couchdb
+
+import (
+	"sync"
+
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// EventsBuffer is a prefixer that can be used in place of the instance for
+// the changes made to CouchDB: the hooks and the realtime events for these
+// changes are held until Flush is called, or dropped by Discard. It is useful
+// for the operations that must be seen as a whole by the other parts of the
+// stack, like the batch of the data API.
+type EventsBuffer struct {
+	prefixer.Prefixer
+	mu     sync.Mutex
+	events []bufferedEvent
+}
+
+type bufferedEvent struct {
+	verb   string
+	doc    Doc
+	oldDoc Doc
+}
+
+// BufferEvents returns an EventsBuffer for the given database.
+func BufferEvents(db prefixer.Prefixer) *EventsBuffer {
+	return &EventsBuffer{Prefixer: db}
+}
+
+func (b *EventsBuffer) push(verb string, doc, oldDoc Doc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, bufferedEvent{verb: verb, doc: doc.Clone(), oldDoc: oldDoc})
+}
+
+// Len returns the number of events held by the buffer.
+func (b *EventsBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.events)
+}
+
+// Flush runs the hooks and publishes the realtime events that have been held,
+// in the order of the changes.
+func (b *EventsBuffer) Flush() {
+	b.mu.Lock()
+	events := b.events
+	b.events = nil
+	b.mu.Unlock()
+	for _, e := range events {
+		RTEvent(b.Prefixer, e.verb, e.doc, e.oldDoc)
+	}
+}
+
+// Discard drops the events that have been held.
+func (b *EventsBuffer) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = nil
+}
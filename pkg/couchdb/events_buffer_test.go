@@ -0,0 +1,59 @@
+package couchdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/realtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsBuffer(t *testing.T) {
+	config.UseTestFile(t)
+	db := prefixer.NewPrefixer(0, "buffer", "events-buffer-tests")
+	sub := realtime.GetHub().Subscriber(db)
+	defer sub.Close()
+	sub.Subscribe(TestDoctype)
+
+	t.Run("Flush", func(t *testing.T) {
+		buffer := BufferEvents(db)
+		doc := &testDoc{TestID: "flushed", TestRev: "1-abc", Test: "foo"}
+		RTEvent(buffer, realtime.EventCreate, doc, nil)
+		assert.Equal(t, 1, buffer.Len())
+
+		select {
+		case e := <-sub.Channel:
+			t.Fatalf("unexpected event %v", e)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		buffer.Flush()
+		assert.Equal(t, 0, buffer.Len())
+		select {
+		case e := <-sub.Channel:
+			require.NotNil(t, e)
+			assert.Equal(t, realtime.EventCreate, e.Verb)
+			assert.Equal(t, "flushed", e.Doc.ID())
+		case <-time.After(time.Second):
+			t.Fatal("the event has not been published")
+		}
+	})
+
+	t.Run("Discard", func(t *testing.T) {
+		buffer := BufferEvents(db)
+		doc := &testDoc{TestID: "discarded", TestRev: "1-abc", Test: "foo"}
+		RTEvent(buffer, realtime.EventCreate, doc, nil)
+		buffer.Discard()
+		assert.Equal(t, 0, buffer.Len())
+		buffer.Flush()
+
+		select {
+		case e := <-sub.Channel:
+			t.Fatalf("unexpected event %v", e)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
@@ -49,3 +49,62 @@ func AddHook(doctype, event string, hook listener) {
 	}
 	hooks[k] = append(hs, hook)
 }
+
+// unoptimalListener is a function called when CouchDB has warned that no
+// index can be used for a _find query.
+type unoptimalListener func(db prefixer.Prefixer, doctype string, req interface{})
+
+var unoptimalHooks []unoptimalListener
+
+func runUnoptimalQueryHooks(db prefixer.Prefixer, doctype string, req interface{}) {
+	for _, h := range unoptimalHooks {
+		h(db, doctype, req)
+	}
+}
+
+// AddUnoptimalQueryHook adds a hook called for the _find queries that cannot
+// use an index. The hook must not make a _find query itself.
+func AddUnoptimalQueryHook(hook unoptimalListener) {
+	unoptimalHooks = append(unoptimalHooks, hook)
+}
+
+// deletionGuard is a function called before documents of the given doctype
+// are deleted. It can forbid the deletion by returning an error.
+type deletionGuard func(db prefixer.Prefixer, doctype string) error
+
+var deletionGuards []deletionGuard
+
+// AddDeletionGuard adds a guard that is checked before the deletion of
+// documents, with DeleteDoc and BulkDeleteDocs.
+func AddDeletionGuard(guard deletionGuard) {
+	deletionGuards = append(deletionGuards, guard)
+}
+
+// unguardedDB is a database where the deletion guards are not checked.
+type unguardedDB struct {
+	prefixer.Prefixer
+}
+
+// WithoutDeletionGuards returns the database where the deletion guards are not
+// checked. It must only be used for deleting documents that have been created
+// by the same operation, like the compensation of a failed batch: no data that
+// existed before the operation is deleted.
+func WithoutDeletionGuards(db prefixer.Prefixer) prefixer.Prefixer {
+	return unguardedDB{db}
+}
+
+// CheckDeletion returns an error if the documents of the given doctype can't
+// be deleted for this database. It is called by DeleteDoc and BulkDeleteDocs,
+// and can be called before an operation that deletes data outside of CouchDB,
+// like the destruction of a file in the VFS.
+func CheckDeletion(db prefixer.Prefixer, doctype string) error {
+	if _, ok := db.(unguardedDB); ok {
+		return nil
+	}
+	for _, guard := range deletionGuards {
+		if err := guard(db, doctype); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -13,14 +13,41 @@ import (
 )
 
 // IndexViewsVersion is the version of current definition of views & indexes.
-// This number should be incremented when this file changes.
-const IndexViewsVersion int = 36
+// This number should be incremented when this file changes, and the Version
+// of the indexes and views that are added or modified must be set to the new
+// value, so that only them are migrated on the existing instances.
+const IndexViewsVersion int = 49
 
 // Indexes is the index list required by an instance to run properly.
 var Indexes = []*mango.Index{
 	// Permissions
 	mango.MakeIndex(consts.Permissions, "by-source-and-type", mango.IndexDef{Fields: []string{"source_id", "type"}}),
 
+	// Used to list the audit trail, and to delete the old entries
+	mango.MakeIndex(consts.Audit, "by-created-at", mango.IndexDef{Fields: []string{"created_at"}}),
+
+	// Used to list the executions of a konnector, and to delete the old logs
+	withVersion(40, mango.MakeIndex(consts.KonnectorsLogs, "by-slug-and-started-at", mango.IndexDef{Fields: []string{"slug", "started_at"}})),
+	withVersion(40, mango.MakeIndex(consts.KonnectorsLogs, "by-started-at", mango.IndexDef{Fields: []string{"started_at"}})),
+
+	// Used to list the summaries of the executions of the konnectors, and to
+	// delete the old ones
+	withVersion(46, mango.MakeIndex(consts.KonnectorsSummaries, "by-finished-at", mango.IndexDef{Fields: []string{"finished_at"}})),
+	withVersion(46, mango.MakeIndex(consts.KonnectorsSummaries, "by-account-and-finished-at", mango.IndexDef{Fields: []string{"account", "finished_at"}})),
+
+	// Used to list the access logs of a doctype, and to delete the old entries
+	withVersion(42, mango.MakeIndex(consts.AccessLogs, "by-doctype-and-created-at", mango.IndexDef{Fields: []string{"doctype", "created_at"}})),
+	withVersion(42, mango.MakeIndex(consts.AccessLogs, "by-created-at", mango.IndexDef{Fields: []string{"created_at"}})),
+
+	// Used to list the analytics of a share by link or a sharing preview
+	withVersion(44, mango.MakeIndex(consts.SharingsAnalytics, "by-share-id-and-day", mango.IndexDef{Fields: []string{"share_id", "day"}})),
+
+	// Used to list the remote files of a sharing in metadata-only mode
+	withVersion(45, mango.MakeIndex(consts.SharingsRemoteFiles, "by-sharing-id", mango.IndexDef{Fields: []string{"sharing_id"}})),
+
+	// Used to list the comments of a file
+	mango.MakeIndex(consts.Comments, "by-file-id", mango.IndexDef{Fields: []string{"file_id", "created_at"}}),
+
 	// Used to lookup over the children of a directory
 	mango.MakeIndex(consts.Files, "dir-children", mango.IndexDef{Fields: []string{"dir_id", "_id"}}),
 	// Used to lookup a directory given its path
@@ -33,6 +60,12 @@ var Indexes = []*mango.Index{
 	mango.MakeIndex(consts.Files, "by-sharing-status", mango.IndexDef{Fields: []string{"metadata.sharing.status"}}),
 	// Used to find old files and directories in the trashed that should be deleted
 	mango.MakeIndex(consts.Files, "by-dir-id-updated-at", mango.IndexDef{Fields: []string{"dir_id", "updated_at"}}),
+	// Used to find the local copy of a photo received via an album sharing
+	withVersion(39, mango.MakeIndex(consts.Files, "by-md5sum", mango.IndexDef{Fields: []string{"md5sum"}})),
+	// Used to list the files of a live photo or a burst
+	withVersion(43, mango.MakeIndex(consts.Files, "by-photo-group", mango.IndexDef{Fields: []string{"metadata.photo_group.id"}})),
+	// Used to count the files created by a konnector for an account
+	withVersion(46, mango.MakeIndex(consts.Files, "by-source-account-created-at", mango.IndexDef{Fields: []string{"cozyMetadata.sourceAccount", "cozyMetadata.createdAt"}})),
 
 	// Used to lookup a queued and running jobs
 	mango.MakeIndex(consts.Jobs, "by-worker-and-state", mango.IndexDef{Fields: []string{"worker", "state"}}),
@@ -68,31 +101,84 @@ var Indexes = []*mango.Index{
 	mango.MakeIndex(consts.BitwardenCiphers, "by-organization-id", mango.IndexDef{Fields: []string{"organization_id"}}),
 }
 
-// DiskUsageView is the view used for computing the disk usage for files
+// DiskUsageView is the view used for computing the disk usage for files. The
+// files in the cold storage are not counted.
 var DiskUsageView = &View{
 	Name:    "disk-usage",
 	Doctype: consts.Files,
 	Map: `
 function(doc) {
-  if (doc.type === 'file') {
+  if (doc.type === 'file' && !doc.cold) {
     emit(doc.dir_id, +doc.size);
   }
 }
 `,
-	Reduce: "_sum",
+	Reduce:  "_sum",
+	Version: 41,
 }
 
 // OldVersionsDiskUsageView is the view used for computing the disk usage for
-// the old versions of file contents.
+// the old versions of file contents. The versions in the cold storage are not
+// counted.
 var OldVersionsDiskUsageView = &View{
 	Name:    "old-versions-disk-usage",
 	Doctype: consts.FilesVersions,
 	Map: `
 function(doc) {
-  emit(doc._id, +doc.size);
+  if (!doc.cold) {
+    emit(doc._id, +doc.size);
+  }
+}
+`,
+	Reduce:  "_sum",
+	Version: 41,
+}
+
+// OldVersionsByCreatedAtView is the view used for listing the old versions of
+// file contents, the oldest first.
+var OldVersionsByCreatedAtView = &View{
+	Name:    "old-versions-by-created-at",
+	Doctype: consts.FilesVersions,
+	Map: `
+function(doc) {
+  if (doc.cozyMetadata && doc.cozyMetadata.createdAt) {
+    emit(doc.cozyMetadata.createdAt);
+  }
+}
+`,
+	Version: 49,
+}
+
+// ColdDiskUsageView is the view used for computing the disk usage for the
+// files in the cold storage.
+var ColdDiskUsageView = &View{
+	Name:    "cold-disk-usage",
+	Doctype: consts.Files,
+	Map: `
+function(doc) {
+  if (doc.type === 'file' && doc.cold) {
+    emit(doc._id, +doc.size);
+  }
 }
 `,
-	Reduce: "_sum",
+	Reduce:  "_sum",
+	Version: 41,
+}
+
+// ColdVersionsDiskUsageView is the view used for computing the disk usage for
+// the old versions of file contents in the cold storage.
+var ColdVersionsDiskUsageView = &View{
+	Name:    "cold-versions-disk-usage",
+	Doctype: consts.FilesVersions,
+	Map: `
+function(doc) {
+  if (doc.cold) {
+    emit(doc._id, +doc.size);
+  }
+}
+`,
+	Reduce:  "_sum",
+	Version: 41,
 }
 
 // DirNotSynchronizedOnView is the view used for fetching directories that are
@@ -253,6 +339,37 @@ function(doc) {
 }`,
 }
 
+// ActiveSharingsView is used to count the active sharings where the instance
+// is the owner
+var ActiveSharingsView = &View{
+	Name:    "active-sharings",
+	Doctype: consts.Sharings,
+	Map: `
+function(doc) {
+  if (doc.active && doc.owner) {
+    emit(doc._id);
+  }
+}`,
+	Reduce:  "_count",
+	Version: 47,
+}
+
+// UnreadNotificationsView is used to count the notifications that have not
+// been read or archived, by slug of the app (or by originator for the
+// notifications sent by the stack).
+var UnreadNotificationsView = &View{
+	Name:    "unread-notifications",
+	Doctype: consts.Notifications,
+	Map: `
+function(doc) {
+  if (!doc.read_at && !doc.archived_at) {
+    emit(doc.slug || doc.originator);
+  }
+}`,
+	Reduce:  "_count",
+	Version: 48,
+}
+
 // ContactByEmail is used to find a contact by its email address
 var ContactByEmail = &View{
 	Name:    "contacts-by-email",
@@ -272,6 +389,9 @@ function(doc) {
 var Views = []*View{
 	DiskUsageView,
 	OldVersionsDiskUsageView,
+	OldVersionsByCreatedAtView,
+	ColdDiskUsageView,
+	ColdVersionsDiskUsageView,
 	DirNotSynchronizedOnView,
 	FilesReferencedByView,
 	ReferencedBySortedByDatetimeView,
@@ -282,6 +402,8 @@ var Views = []*View{
 	PermissionsShareByShortcodeView,
 	SharedDocsBySharingID,
 	SharingsByDocTypeView,
+	ActiveSharingsView,
+	UnreadNotificationsView,
 	ContactByEmail,
 }
 
@@ -311,6 +433,8 @@ func IndexesByDoctype(doctype string) []*mango.Index {
 // properly.
 var globalIndexes = []*mango.Index{
 	mango.MakeIndex(consts.Exports, "by-domain", mango.IndexDef{Fields: []string{"domain", "created_at"}}),
+	mango.MakeIndex(consts.Escrows, "by-domain", mango.IndexDef{Fields: []string{"domain", "created_at"}}),
+	mango.MakeIndex(consts.Audit, "by-created-at", mango.IndexDef{Fields: []string{"created_at"}}),
 }
 
 // secretIndexes is the index list required on the secret databases to run
@@ -18,6 +18,9 @@ type IndexRequest struct {
 type Index struct {
 	Doctype string
 	Request *IndexRequest
+	// Version is the IndexViewsVersion where the index has been added or
+	// modified for the last time
+	Version int
 }
 
 // MakeIndex constructs a new Index
@@ -0,0 +1,340 @@
+package mango
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Match returns true if the document matches the selector. It follows the
+// semantics of the CouchDB selectors, with one simplification: the strings
+// are compared byte per byte, not with the UCA algorithm used by CouchDB. It
+// is useful for checking a document received in a realtime event against a
+// filter, without querying CouchDB.
+func Match(selector map[string]interface{}, doc map[string]interface{}) bool {
+	return matchSelector(selector, doc, true)
+}
+
+func matchSelector(selector map[string]interface{}, value interface{}, found bool) bool {
+	for key, cond := range selector {
+		var ok bool
+		switch key {
+		case string(and):
+			ok = true
+			for _, sub := range asList(cond) {
+				if s, isMap := asMap(sub); !isMap || !matchSelector(s, value, found) {
+					ok = false
+					break
+				}
+			}
+		case string(or):
+			for _, sub := range asList(cond) {
+				if s, isMap := asMap(sub); isMap && matchSelector(s, value, found) {
+					ok = true
+					break
+				}
+			}
+		case string(nor):
+			ok = true
+			for _, sub := range asList(cond) {
+				if s, isMap := asMap(sub); isMap && matchSelector(s, value, found) {
+					ok = false
+					break
+				}
+			}
+		case string(not):
+			s, isMap := asMap(cond)
+			ok = isMap && !matchSelector(s, value, found)
+		default:
+			if strings.HasPrefix(key, "$") {
+				ok = matchOperator(key, cond, value, found)
+			} else {
+				sub, subFound := getField(value, key)
+				if s, isMap := asMap(cond); isMap {
+					ok = matchSelector(s, sub, subFound)
+				} else {
+					ok = subFound && compare(sub, cond) == 0
+				}
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func matchOperator(op string, cond, value interface{}, found bool) bool {
+	if op == string(exists) {
+		b, ok := cond.(bool)
+		return ok && b == found
+	}
+	if !found {
+		return false
+	}
+
+	switch op {
+	case "$eq":
+		return compare(value, cond) == 0
+	case string(ne):
+		return compare(value, cond) != 0
+	case string(gt):
+		return compare(value, cond) > 0
+	case string(gte):
+		return compare(value, cond) >= 0
+	case string(lt):
+		return compare(value, cond) < 0
+	case string(lte):
+		return compare(value, cond) <= 0
+	case string(in):
+		return inList(value, asList(cond))
+	case "$nin":
+		return !inList(value, asList(cond))
+	case string(all):
+		values, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, expected := range asList(cond) {
+			if !inList(expected, values) {
+				return false
+			}
+		}
+		return true
+	case string(size):
+		values, ok := value.([]interface{})
+		n, isNumber := toFloat(cond)
+		return ok && isNumber && float64(len(values)) == n
+	case string(regex):
+		str, ok := value.(string)
+		pattern, isString := cond.(string)
+		if !ok || !isString {
+			return false
+		}
+		re, err := regexp.Compile(pattern)
+		return err == nil && re.MatchString(str)
+	case "$beginsWith":
+		str, ok := value.(string)
+		prefix, isString := cond.(string)
+		return ok && isString && strings.HasPrefix(str, prefix)
+	case "$mod":
+		args := asList(cond)
+		n, ok := toFloat(value)
+		if !ok || len(args) != 2 {
+			return false
+		}
+		divisor, ok1 := toFloat(args[0])
+		remainder, ok2 := toFloat(args[1])
+		if !ok1 || !ok2 || divisor == 0 || n != float64(int64(n)) {
+			return false
+		}
+		return int64(n)%int64(divisor) == int64(remainder)
+	case "$type":
+		name, ok := cond.(string)
+		return ok && typeName(value) == name
+	case string(elemMatch), string(allMatch):
+		values, ok := value.([]interface{})
+		s, isMap := asMap(cond)
+		if !ok || !isMap || len(values) == 0 {
+			return false
+		}
+		for _, v := range values {
+			matched := matchSelector(s, v, true)
+			if op == string(elemMatch) && matched {
+				return true
+			}
+			if op == string(allMatch) && !matched {
+				return false
+			}
+		}
+		return op == string(allMatch)
+	}
+	return false
+}
+
+// getField returns the value of a field, with the dot notation for the
+// nested fields.
+func getField(value interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := asMap(value)
+		if !ok {
+			return nil, false
+		}
+		value, ok = obj[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// inList returns true if the value, or one of its elements for an array, is
+// equal to one of the values of the list.
+func inList(value interface{}, list []interface{}) bool {
+	for _, v := range list {
+		if compare(value, v) == 0 {
+			return true
+		}
+	}
+	if values, ok := value.([]interface{}); ok {
+		for _, elem := range values {
+			for _, v := range list {
+				if compare(elem, v) == 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func asList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list
+	case []int:
+		list := make([]interface{}, len(v))
+		for i, n := range v {
+			list[i] = n
+		}
+		return list
+	case []Map:
+		list := make([]interface{}, len(v))
+		for i, m := range v {
+			list[i] = m
+		}
+		return list
+	case []Filter:
+		list := make([]interface{}, len(v))
+		for i, f := range v {
+			list[i] = f.ToMango()
+		}
+		return list
+	}
+	return nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}, []string, []int:
+		return "array"
+	case map[string]interface{}, Map:
+		return "object"
+	}
+	if _, ok := toFloat(value); ok {
+		return "number"
+	}
+	return ""
+}
+
+// typeRank gives the order of the types in the CouchDB collation.
+func typeRank(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	}
+	switch typeName(value) {
+	case "number":
+		return 3
+	case "string":
+		return 4
+	case "array":
+		return 5
+	case "object":
+		return 6
+	}
+	return 7
+}
+
+// compare returns -1, 0 or 1 if a is lower, equal or greater than b, with the
+// CouchDB collation order: null < false < true < numbers < strings < arrays <
+// objects.
+func compare(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch ra {
+	case 3:
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	case 4:
+		return strings.Compare(a.(string), b.(string))
+	case 5:
+		la, lb := asList(a), asList(b)
+		for i := 0; i < len(la) && i < len(lb); i++ {
+			if c := compare(la[i], lb[i]); c != 0 {
+				return c
+			}
+		}
+		return compare(len(la), len(lb))
+	case 6:
+		ma, _ := asMap(a)
+		mb, _ := asMap(b)
+		ka, kb := sortedKeys(ma), sortedKeys(mb)
+		for i := 0; i < len(ka) && i < len(kb); i++ {
+			if c := strings.Compare(ka[i], kb[i]); c != 0 {
+				return c
+			}
+			if c := compare(ma[ka[i]], mb[kb[i]]); c != 0 {
+				return c
+			}
+		}
+		return compare(len(ka), len(kb))
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,77 @@
+package mango
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	var doc map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"_id": "123",
+		"type": "file",
+		"name": "photo.jpg",
+		"size": 2048,
+		"trashed": false,
+		"tags": ["holidays", "beach"],
+		"metadata": {"width": 800, "height": 600},
+		"referenced_by": [
+			{"type": "io.cozy.photos.albums", "id": "album1"},
+			{"type": "io.cozy.photos.albums", "id": "album2"}
+		]
+	}`), &doc)
+	require.NoError(t, err)
+
+	matching := []Filter{
+		Equal("type", "file"),
+		Gt("size", 1000),
+		Lte("size", 2048),
+		And(Equal("trashed", false), Regex("name", `\.jpg$`)),
+		Or(Equal("type", "directory"), Equal("name", "photo.jpg")),
+		Not(Equal("type", "directory")),
+		Exists("metadata"),
+		NotExists("deleted"),
+		NotEqual("name", "other.jpg"),
+		In("name", []interface{}{"photo.jpg", "photo.png"}),
+		In("tags", []interface{}{"beach", "mountain"}),
+		All("tags", []interface{}{"beach", "holidays"}),
+		Size("tags", 2),
+		Contains("tags", "beach"),
+		ElemMatch("referenced_by", Equal("id", "album2")),
+		AllMatch("referenced_by", Equal("type", "io.cozy.photos.albums")),
+		StartWith("name", "photo"),
+		Equal("metadata.width", 800),
+		Map{"metadata": map[string]interface{}{"height": map[string]interface{}{"$lt": 1000}}},
+		Map{"tags": []interface{}{"holidays", "beach"}},
+		Map{"size": map[string]interface{}{"$type": "number", "$mod": []interface{}{1000, 48}}},
+	}
+	for _, f := range matching {
+		assert.True(t, Match(f.ToMango(), doc), "%v should match", f.ToMango())
+	}
+
+	notMatching := []Filter{
+		Equal("type", "directory"),
+		Gt("size", 4096),
+		And(Equal("trashed", false), Regex("name", `\.png$`)),
+		Or(Equal("type", "directory"), Equal("name", "other.jpg")),
+		Nor(Equal("type", "file")),
+		Exists("deleted"),
+		NotEqual("deleted", true),
+		In("name", []interface{}{"other.jpg"}),
+		All("tags", []interface{}{"beach", "mountain"}),
+		Size("tags", 3),
+		ElemMatch("referenced_by", Equal("id", "album3")),
+		AllMatch("referenced_by", Equal("id", "album1")),
+		Equal("metadata.depth", 3),
+		Lt("name", 1000),
+		Map{"$unknown": true},
+	}
+	for _, f := range notMatching {
+		assert.False(t, Match(f.ToMango(), doc), "%v should not match", f.ToMango())
+	}
+
+	assert.True(t, Match(map[string]interface{}{}, doc))
+}
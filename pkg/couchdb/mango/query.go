@@ -35,6 +35,23 @@ const exists ValueOperator = "$exists"
 // in ($in) checks that the field value equals one of the values
 const in ValueOperator = "$in"
 
+// all ($all) checks that the array field contains all the values
+const all ValueOperator = "$all"
+
+// regex ($regex) checks that the string field matches a regular expression
+const regex ValueOperator = "$regex"
+
+// size ($size) checks the length of the array field
+const size ValueOperator = "$size"
+
+// elemMatch ($elemMatch) checks that at least one element of the array field
+// matches a filter
+const elemMatch ValueOperator = "$elemMatch"
+
+// allMatch ($allMatch) checks that all the elements of the array field match
+// a filter
+const allMatch ValueOperator = "$allMatch"
+
 // LogicOperator is an operator between two filters
 type LogicOperator string
 
@@ -165,6 +182,47 @@ func Lt(field string, value interface{}) Filter { return &valueFilter{field, lt,
 // Lte returns a filter that check if a field <= value
 func Lte(field string, value interface{}) Filter { return &valueFilter{field, lte, value} }
 
+// All returns a filter that checks if the array field contains all the values
+func All(field string, values []interface{}) Filter { return &valueFilter{field, all, values} }
+
+// Regex returns a filter that checks if the string field matches the regular
+// expression. Such a filter cannot use an index.
+func Regex(field string, pattern string) Filter { return &valueFilter{field, regex, pattern} }
+
+// Size returns a filter that checks if the array field has n elements
+func Size(field string, n int) Filter { return &valueFilter{field, size, n} }
+
+// ElemMatch returns a filter that checks if at least one element of the array
+// field matches the filter. The filter is on the fields of the elements, or
+// on the elements themselves with ElemEqual, ElemIn, etc.
+func ElemMatch(field string, filter Filter) Filter {
+	return &valueFilter{field, elemMatch, filter.ToMango()}
+}
+
+// AllMatch returns a filter that checks if all the elements of the array
+// field match the filter.
+func AllMatch(field string, filter Filter) Filter {
+	return &valueFilter{field, allMatch, filter.ToMango()}
+}
+
+// Contains returns a filter that checks if the array field has an element
+// equal to the value.
+func Contains(field string, value interface{}) Filter {
+	return ElemMatch(field, ElemEqual(value))
+}
+
+// ElemEqual returns a filter, to be used with ElemMatch or AllMatch, that
+// checks if an element of an array is equal to the value.
+func ElemEqual(value interface{}) Filter { return makeMap("$eq", value) }
+
+// ElemIn returns a filter, to be used with ElemMatch or AllMatch, that checks
+// if an element of an array is equal to one of the values.
+func ElemIn(values []interface{}) Filter { return makeMap(string(in), values) }
+
+// ElemRegex returns a filter, to be used with ElemMatch or AllMatch, that
+// checks if an element of an array matches the regular expression.
+func ElemRegex(pattern string) Filter { return makeMap(string(regex), pattern) }
+
 // Between returns a filter that check if v1 <= field < v2
 func Between(field string, v1 interface{}, v2 interface{}) Filter {
 	return &logicFilter{op: and, filters: []Filter{
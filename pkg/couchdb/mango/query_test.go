@@ -2,6 +2,7 @@ package mango
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,3 +46,55 @@ func TestSortMarshaling(t *testing.T) {
 		assert.Equal(t, j1, []byte(`[{"dir_id":"asc"},{"foo_bar":"desc"}]`))
 	}
 }
+
+func TestArrayOperatorsMarshaling(t *testing.T) {
+	q1 := ElemMatch("members", And(Equal("status", "ready"), Gt("age", 18)))
+	DeepEqual(t, q1.ToMango(), M{"members": M{"$elemMatch": M{"$and": S{
+		M{"status": "ready"},
+		M{"age": M{"$gt": 18}},
+	}}}})
+	q2 := AllMatch("tags", ElemRegex("^cozy"))
+	DeepEqual(t, q2.ToMango(), M{"tags": M{"$allMatch": M{"$regex": "^cozy"}}})
+	q3 := Contains("tags", "foo")
+	DeepEqual(t, q3.ToMango(), M{"tags": M{"$elemMatch": M{"$eq": "foo"}}})
+	q4 := All("tags", []interface{}{"foo", "bar"})
+	DeepEqual(t, q4.ToMango(), M{"tags": M{"$all": S{"foo", "bar"}}})
+	q5 := Not(Regex("_id", "^_design/"))
+	DeepEqual(t, q5.ToMango(), M{"$not": M{"_id": M{"$regex": "^_design/"}}})
+	q6 := Size("tags", 2)
+	DeepEqual(t, q6.ToMango(), M{"tags": M{"$size": 2}})
+}
+
+func TestValidate(t *testing.T) {
+	valid := []Filter{
+		Equal("dir_id", "foo"),
+		And(Or(Equal("a", 1), Gt("b", 2)), Not(Regex("name", "^foo"))),
+		ElemMatch("members", Or(Equal("status", "ready"), Exists("email"))),
+		AllMatch("tags", ElemIn([]interface{}{"foo", "bar"})),
+		Map{"metadata": map[string]interface{}{"datetime": map[string]interface{}{"$gt": "2023"}}},
+		Map{"tags": map[string]interface{}{"$size": float64(3)}},
+		Regex("name", "^foo(?=bar)"),
+		Regex("name", "(a)\\1"),
+	}
+	for _, f := range valid {
+		assert.NoError(t, Validate(f))
+	}
+
+	invalid := []Filter{
+		nil,
+		And(),
+		Or(Equal("a", 1), Or()),
+		Regex("name", strings.Repeat("a", MaxRegexLength+1)),
+		ElemMatch("tags", ElemRegex(strings.Repeat("a", MaxRegexLength+1))),
+		Map{"name": map[string]interface{}{"$regex": 42}},
+		Map{"tags": map[string]interface{}{"$in": "foo"}},
+		Map{"tags": map[string]interface{}{"$size": 1.5}},
+		Map{"name": map[string]interface{}{"$exists": "yes"}},
+		Map{"$or": []interface{}{"foo"}},
+		Map{"tags": map[string]interface{}{"$elemMatch": "foo"}},
+	}
+	for _, f := range invalid {
+		err := Validate(f)
+		assert.ErrorIs(t, err, ErrInvalidSelector)
+	}
+}
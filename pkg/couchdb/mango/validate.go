@@ -0,0 +1,128 @@
+package mango
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSelector is used when a selector cannot be used by CouchDB
+var ErrInvalidSelector = errors.New("Invalid selector")
+
+// MaxRegexLength is the maximal length of the pattern of a $regex operator.
+// The pattern itself is not compiled here: CouchDB uses the PCRE syntax, that
+// accepts more than the regexp package of Go (lookaheads, backreferences).
+const MaxRegexLength = 1024
+
+// Validate checks that the filter can be used as a selector by CouchDB: the
+// $and, $or and $nor operators must have at least one filter, the regular
+// expressions can't be too long, the $in and $all operators must have a list of
+// values, etc. It is useful for the filters composed from the inputs of a
+// request.
+func Validate(filter Filter) error {
+	if filter == nil {
+		return fmt.Errorf("%w: empty filter", ErrInvalidSelector)
+	}
+	return validateSelector(filter.ToMango())
+}
+
+func validateSelector(selector map[string]interface{}) error {
+	for key, value := range selector {
+		var err error
+		switch key {
+		case string(and), string(or), string(nor):
+			err = validateFilters(key, value)
+		case string(not):
+			err = validateSub(key, value)
+		default:
+			if strings.HasPrefix(key, "$") {
+				err = validateOperator(key, value)
+			} else if sub, ok := asMap(value); ok {
+				err = validateSelector(sub)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateFilters(op string, value interface{}) error {
+	var filters []interface{}
+	switch v := value.(type) {
+	case []Map:
+		for _, m := range v {
+			filters = append(filters, m)
+		}
+	case []interface{}:
+		filters = v
+	}
+	if len(filters) == 0 {
+		return fmt.Errorf("%w: %s needs at least one filter", ErrInvalidSelector, op)
+	}
+	for _, f := range filters {
+		if err := validateSub(op, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSub(op string, value interface{}) error {
+	sub, ok := asMap(value)
+	if !ok {
+		return fmt.Errorf("%w: %s needs a filter", ErrInvalidSelector, op)
+	}
+	return validateSelector(sub)
+}
+
+func validateOperator(op string, value interface{}) error {
+	switch op {
+	case string(regex):
+		pattern, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: %s needs a string", ErrInvalidSelector, op)
+		}
+		if len(pattern) > MaxRegexLength {
+			return fmt.Errorf("%w: %s pattern is too long", ErrInvalidSelector, op)
+		}
+	case string(in), "$nin", string(all):
+		if !isList(value) {
+			return fmt.Errorf("%w: %s needs a list of values", ErrInvalidSelector, op)
+		}
+	case string(size):
+		if _, ok := value.(int); !ok {
+			if f, ok := value.(float64); !ok || f != float64(int(f)) {
+				return fmt.Errorf("%w: %s needs an integer", ErrInvalidSelector, op)
+			}
+		}
+	case string(exists):
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: %s needs a boolean", ErrInvalidSelector, op)
+		}
+	case string(elemMatch), string(allMatch):
+		return validateSub(op, value)
+	}
+	return nil
+}
+
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case Map:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	case Filter:
+		return v.ToMango(), true
+	}
+	return nil, false
+}
+
+func isList(value interface{}) bool {
+	switch value.(type) {
+	case []interface{}, []string, []int, []Map:
+		return true
+	}
+	return false
+}
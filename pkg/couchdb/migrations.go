@@ -0,0 +1,171 @@
+package couchdb
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"golang.org/x/sync/singleflight"
+)
+
+// FirstVersionedIndexViews is the first IndexViewsVersion where the indexes
+// and views have a version. For an instance with an older version, all the
+// indexes and views are checked.
+const FirstVersionedIndexViews = 38
+
+var (
+	migrationsGroup singleflight.Group
+	migrationsOnce  sync.Once
+	migrationsSem   chan struct{}
+)
+
+// withVersion sets the version where an index has been added or modified.
+func withVersion(version int, index *mango.Index) *mango.Index {
+	index.Version = version
+	return index
+}
+
+// IndexesSince returns the indexes that have been added or modified after the
+// given version.
+func IndexesSince(version int) []*mango.Index {
+	if version < FirstVersionedIndexViews {
+		return Indexes
+	}
+	var indexes []*mango.Index
+	for _, index := range Indexes {
+		if index.Version > version {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// ViewsSince returns the views that have been added or modified after the
+// given version.
+func ViewsSince(version int) []*View {
+	if version < FirstVersionedIndexViews {
+		return Views
+	}
+	var views []*View
+	for _, view := range Views {
+		if view.Version > version {
+			views = append(views, view)
+		}
+	}
+	return views
+}
+
+// MigrateIndexesAndViews creates or updates the indexes and views that have
+// changed since the given version. The number of databases migrated at the
+// same time is limited, to avoid CouchDB being overloaded by the reindexing
+// after an upgrade of the stack, and the concurrent calls for the same prefix
+// share the same migration.
+func MigrateIndexesAndViews(db prefixer.Prefixer, version int) error {
+	indexes := IndexesSince(version)
+	views := ViewsSince(version)
+	if len(indexes) == 0 && len(views) == 0 {
+		return nil
+	}
+	_, err, _ := migrationsGroup.Do(db.DBPrefix(), func() (interface{}, error) {
+		sem := migrationsSemaphore()
+		if sem != nil {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+		}
+		return nil, UpdateIndexesAndViews(db, indexes, views)
+	})
+	return err
+}
+
+func migrationsSemaphore() chan struct{} {
+	migrationsOnce.Do(func() {
+		if max := config.GetConfig().CouchDB.MaxConcurrentMigrations; max > 0 {
+			migrationsSem = make(chan struct{}, max)
+		}
+	})
+	return migrationsSem
+}
+
+// IndexBuildTask is an indexer task of CouchDB, for a design doc of a
+// database. CouchDB builds the indexes in background, shard by shard.
+type IndexBuildTask struct {
+	Doctype      string `json:"doctype"`
+	DesignDoc    string `json:"design_document"`
+	Progress     int    `json:"progress"`
+	ChangesDone  int    `json:"changes_done"`
+	TotalChanges int    `json:"total_changes"`
+	StartedOn    int64  `json:"started_on"`
+}
+
+// IndexBuildTasks returns the indexes and views that are being built by
+// CouchDB for the databases with the given prefix.
+func IndexBuildTasks(db prefixer.Prefixer) ([]*IndexBuildTask, error) {
+	var tasks []struct {
+		Type         string `json:"type"`
+		Database     string `json:"database"`
+		DesignDoc    string `json:"design_document"`
+		Progress     int    `json:"progress"`
+		ChangesDone  int    `json:"changes_done"`
+		TotalChanges int    `json:"total_changes"`
+		StartedOn    int64  `json:"started_on"`
+	}
+	if err := makeRequest(db, "", http.MethodGet, "_active_tasks", nil, &tasks); err != nil {
+		return nil, err
+	}
+	// The names of the databases are escaped, so the doctypes of the indexes
+	// and views are used to find the original doctypes
+	doctypes := make(map[string]string)
+	for _, index := range Indexes {
+		doctypes[EscapeCouchdbName(index.Doctype)] = index.Doctype
+	}
+	for _, view := range Views {
+		doctypes[EscapeCouchdbName(view.Doctype)] = view.Doctype
+	}
+	builds := []*IndexBuildTask{}
+	for _, task := range tasks {
+		if task.Type != "indexer" {
+			continue
+		}
+		ok, name := dbNameHasPrefix(shardDBName(task.Database), db.DBPrefix())
+		if !ok {
+			continue
+		}
+		doctype, ok := doctypes[name]
+		if !ok {
+			doctype = name
+		}
+		builds = append(builds, &IndexBuildTask{
+			Doctype:      doctype,
+			DesignDoc:    task.DesignDoc,
+			Progress:     task.Progress,
+			ChangesDone:  task.ChangesDone,
+			TotalChanges: task.TotalChanges,
+			StartedOn:    task.StartedOn,
+		})
+	}
+	return builds, nil
+}
+
+// shardDBName returns the name of the database for a shard, like
+// shards/00000000-7fffffff/cozy1/io-cozy-files.1684829042 for the
+// cozy1/io-cozy-files database.
+func shardDBName(shard string) string {
+	name := shard
+	if strings.HasPrefix(name, "shards/") {
+		parts := strings.SplitN(name, "/", 3)
+		if len(parts) == 3 {
+			name = parts[2]
+		}
+		if i := strings.LastIndex(name, "."); i > 0 {
+			name = name[:i]
+		}
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
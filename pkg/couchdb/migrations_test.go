@@ -0,0 +1,66 @@
+package couchdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Run("IndexesAndViewsSince", func(t *testing.T) {
+		assert.Equal(t, Indexes, IndexesSince(0))
+		assert.Equal(t, Views, ViewsSince(FirstVersionedIndexViews-1))
+		assert.Empty(t, IndexesSince(IndexViewsVersion))
+		assert.Empty(t, ViewsSince(IndexViewsVersion))
+
+		var names []string
+		for _, index := range IndexesSince(38) {
+			names = append(names, index.Request.DDoc)
+		}
+		assert.Contains(t, names, "by-md5sum")
+		assert.NotContains(t, names, "dir-children")
+		assert.Contains(t, names, "by-slug-and-started-at")
+
+		names = names[:0]
+		for _, index := range IndexesSince(39) {
+			names = append(names, index.Request.DDoc)
+		}
+		assert.NotContains(t, names, "by-md5sum")
+		assert.Contains(t, names, "by-started-at")
+
+		names = names[:0]
+		for _, view := range ViewsSince(40) {
+			names = append(names, view.Name)
+		}
+		assert.Contains(t, names, "disk-usage")
+		assert.Contains(t, names, "cold-disk-usage")
+		assert.NotContains(t, names, "contacts-by-email")
+
+		names = names[:0]
+		for _, index := range IndexesSince(41) {
+			names = append(names, index.Request.DDoc)
+		}
+		assert.Equal(t, []string{
+			"by-finished-at",
+			"by-account-and-finished-at",
+			"by-doctype-and-created-at",
+			"by-created-at",
+			"by-share-id-and-day",
+			"by-sharing-id",
+			"by-photo-group",
+			"by-source-account-created-at",
+		}, names)
+	})
+
+	t.Run("ShardDBName", func(t *testing.T) {
+		assert.Equal(t, "cozy1/io-cozy-files",
+			shardDBName("shards/00000000-7fffffff/cozy1/io-cozy-files.1684829042"))
+		assert.Equal(t, "cozy1/io-cozy-files",
+			shardDBName("shards/00000000-7fffffff/cozy1%2Fio-cozy-files.1684829042"))
+		assert.Equal(t, "cozy1/io-cozy-files", shardDBName("cozy1/io-cozy-files"))
+
+		ok, name := dbNameHasPrefix(shardDBName("shards/00000000-7fffffff/cozy1/io-cozy-files.1684829042"), "cozy1")
+		assert.True(t, ok)
+		assert.Equal(t, "io-cozy-files", name)
+	})
+}
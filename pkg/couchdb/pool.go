@@ -0,0 +1,307 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrPoolTimeout is used when a request to CouchDB has waited too long for a
+// free slot in the pool of its cluster.
+var ErrPoolTimeout = errors.New("couchdb: timeout while waiting for a free slot in the pool")
+
+var (
+	poolInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "couchdb",
+			Subsystem: "pool",
+			Name:      "in_flight",
+
+			Help: "Number of requests in flight to CouchDB, labelled by cluster.",
+		},
+		[]string{"cluster"},
+	)
+	poolQueued = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "couchdb",
+			Subsystem: "pool",
+			Name:      "queued",
+
+			Help: "Number of requests waiting for a free slot, labelled by cluster.",
+		},
+		[]string{"cluster"},
+	)
+	poolWaitDurations = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "couchdb",
+			Subsystem: "pool",
+			Name:      "wait_seconds",
+
+			Help: `Time spent by the requests waiting for a free slot, labelled by
+cluster. The requests that have not waited are not observed.`,
+
+			Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"cluster"},
+	)
+	poolTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "couchdb",
+			Subsystem: "pool",
+			Name:      "timeouts",
+
+			Help: `Number of requests that have been rejected after waiting too long
+for a free slot, labelled by cluster.`,
+		},
+		[]string{"cluster"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		poolInFlight,
+		poolQueued,
+		poolWaitDurations,
+		poolTimeouts,
+	)
+	config.OnSecretsReload(reconfigurePools)
+}
+
+// pool is an http.RoundTripper that limits the number of concurrent requests
+// sent to a CouchDB cluster. When the limit is reached, the requests wait in a
+// queue until a slot is released, or the timeout is reached.
+type pool struct {
+	label string
+	base  http.RoundTripper
+
+	mu      sync.RWMutex
+	sem     chan struct{}
+	max     int
+	timeout time.Duration
+}
+
+func newPool(label string, max int, timeout time.Duration, base http.RoundTripper) *pool {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	p := &pool{label: label, base: base}
+	p.configure(max, timeout)
+	return p
+}
+
+// configure sets the limits of the pool. It is called again when the config
+// is reloaded, and the requests in flight keep their slot in the previous
+// semaphore.
+func (p *pool) configure(max int, timeout time.Duration) {
+	p.mu.RLock()
+	same := p.max == max && p.timeout == timeout && (p.sem != nil || max <= 0)
+	p.mu.RUnlock()
+	if same {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.max != max || (p.sem == nil && max > 0) {
+		p.sem = nil
+		if max > 0 {
+			p.sem = make(chan struct{}, max)
+		}
+	}
+	p.max = max
+	p.timeout = timeout
+}
+
+// RoundTrip implements the http.RoundTripper interface. The slot is kept
+// until the body of the response has been read or closed, as the connection
+// is still used by CouchDB while the body is read.
+func (p *pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	return p.roundTrip(req, 0)
+}
+
+// roundTrip sends the request when a slot is free. The timeout, if not 0,
+// starts when the slot has been acquired, as the time spent in the queue is
+// already bounded by the queue timeout.
+func (p *pool) roundTrip(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	sem, err := p.acquire(req)
+	if err != nil {
+		return nil, err
+	}
+	cancel := func() {}
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+		req = req.WithContext(ctx)
+	}
+	res, err := p.base.RoundTrip(req)
+	if err != nil {
+		cancel()
+		p.release(sem)
+		return nil, err
+	}
+	res.Body = &poolBody{ReadCloser: res.Body, release: func() {
+		cancel()
+		p.release(sem)
+	}}
+	return res, nil
+}
+
+func (p *pool) acquire(req *http.Request) (chan struct{}, error) {
+	p.mu.RLock()
+	sem, queueTimeout := p.sem, p.timeout
+	p.mu.RUnlock()
+
+	if sem == nil {
+		poolInFlight.WithLabelValues(p.label).Inc()
+		return nil, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		poolInFlight.WithLabelValues(p.label).Inc()
+		return sem, nil
+	default:
+	}
+
+	queued := poolQueued.WithLabelValues(p.label)
+	queued.Inc()
+	defer queued.Dec()
+	start := time.Now()
+	var timeout <-chan time.Time
+	if queueTimeout > 0 {
+		timer := time.NewTimer(queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case sem <- struct{}{}:
+		poolWaitDurations.WithLabelValues(p.label).Observe(time.Since(start).Seconds())
+		poolInFlight.WithLabelValues(p.label).Inc()
+		return sem, nil
+	case <-timeout:
+		poolWaitDurations.WithLabelValues(p.label).Observe(time.Since(start).Seconds())
+		poolTimeouts.WithLabelValues(p.label).Inc()
+		return nil, ErrPoolTimeout
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+func (p *pool) release(sem chan struct{}) {
+	poolInFlight.WithLabelValues(p.label).Dec()
+	if sem != nil {
+		<-sem
+	}
+}
+
+// poolBody releases the slot when the body has been read until the end (or
+// an error), or when it is closed, whichever comes first.
+type poolBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *poolBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *poolBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// timedPool is a pool where the requests have a timeout, like the timeout of
+// an http.Client, but without the time spent in the queue.
+type timedPool struct {
+	*pool
+	timeout time.Duration
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *timedPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.pool.roundTrip(req, t.timeout)
+}
+
+// pooledClient is the HTTP client with the pool of a CouchDB cluster.
+type pooledClient struct {
+	cluster int
+	client  *http.Client
+}
+
+var (
+	poolsMu sync.RWMutex
+	pools   = make(map[*http.Client]pooledClient)
+)
+
+// proxyTransport returns the transport to use for proxying the requests to
+// the given CouchDB cluster. It shares the pool of the cluster, but without a
+// timeout, as the responses can be streamed for a long time.
+func proxyTransport(cluster int) http.RoundTripper {
+	return clientFor(cluster).Transport.(*timedPool).pool
+}
+
+// clientFor returns the HTTP client to use for the requests to the given
+// CouchDB cluster. Each cluster has its own pool, so that a slow cluster, or a
+// migration on many instances, can't take all the connections of the process.
+// The timeout of the underlying client is applied by the pool once a slot has
+// been acquired, and not to the time spent in the queue.
+func clientFor(cluster int) *http.Client {
+	couch := config.CouchCluster(cluster)
+	base := couch.Client
+	if base == nil {
+		base = config.CouchClient()
+	}
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	// The pools are indexed by the underlying client, as the global cluster
+	// is also the first cluster when no clusters are configured.
+	poolsMu.RLock()
+	pc, ok := pools[base]
+	poolsMu.RUnlock()
+	if ok {
+		return pc.client
+	}
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if pc, ok := pools[base]; ok {
+		return pc.client
+	}
+	label := strconv.Itoa(cluster)
+	if cluster == prefixer.GlobalCouchCluster || base == config.CouchClient() {
+		label = "global"
+	}
+	p := newPool(label, couch.MaxConcurrentRequests, couch.QueueTimeout, base.Transport)
+	client := &http.Client{
+		Transport:     &timedPool{pool: p, timeout: base.Timeout},
+		CheckRedirect: base.CheckRedirect,
+	}
+	pools[base] = pooledClient{cluster: cluster, client: client}
+	return client
+}
+
+// reconfigurePools applies the limits of the pools after a reload of the
+// config.
+func reconfigurePools() error {
+	poolsMu.RLock()
+	defer poolsMu.RUnlock()
+	for _, pc := range pools {
+		couch := config.CouchCluster(pc.cluster)
+		pc.client.Transport.(*timedPool).configure(couch.MaxConcurrentRequests, couch.QueueTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	t.Run("QueueTimeout", func(t *testing.T) {
+		client := &http.Client{Transport: newPool("test", 1, 50*time.Millisecond, nil)}
+		first, err := client.Get(ts.URL)
+		require.NoError(t, err)
+
+		_, err = client.Get(ts.URL)
+		assert.True(t, errors.Is(err, ErrPoolTimeout))
+
+		_, _ = io.ReadAll(first.Body)
+		require.NoError(t, first.Body.Close())
+		second, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		require.NoError(t, second.Body.Close())
+	})
+
+	t.Run("WaitForSlot", func(t *testing.T) {
+		client := &http.Client{Transport: newPool("test", 1, time.Second, nil)}
+		first, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			_ = first.Body.Close()
+		}()
+		second, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		require.NoError(t, second.Body.Close())
+		// Closing twice must not release the slot twice
+		require.NoError(t, second.Body.Close())
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		client := &http.Client{Transport: newPool("test", 1, time.Second, nil)}
+		first, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		defer first.Body.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		client := &http.Client{Transport: newPool("test", 0, time.Millisecond, nil)}
+		for i := 0; i < 5; i++ {
+			res, err := client.Get(ts.URL)
+			require.NoError(t, err)
+			defer res.Body.Close()
+		}
+	})
+
+	t.Run("ReleaseOnEOF", func(t *testing.T) {
+		client := &http.Client{Transport: newPool("test", 1, 50*time.Millisecond, nil)}
+		first, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		defer first.Body.Close()
+		_, err = io.ReadAll(first.Body)
+		require.NoError(t, err)
+
+		// The body has not been closed, but it has been read until the end
+		second, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		require.NoError(t, second.Body.Close())
+	})
+
+	t.Run("RequestTimeoutAfterQueue", func(t *testing.T) {
+		p := newPool("test", 1, time.Second, nil)
+		client := &http.Client{Transport: &timedPool{pool: p, timeout: 100 * time.Millisecond}}
+		first, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		go func() {
+			time.Sleep(150 * time.Millisecond)
+			_ = first.Body.Close()
+		}()
+
+		// The time spent in the queue is not counted in the request timeout
+		second, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		_, err = io.ReadAll(second.Body)
+		require.NoError(t, err)
+		require.NoError(t, second.Body.Close())
+	})
+
+	t.Run("Configure", func(t *testing.T) {
+		p := newPool("test", 1, 50*time.Millisecond, nil)
+		client := &http.Client{Transport: p}
+		first, err := client.Get(ts.URL)
+		require.NoError(t, err)
+
+		p.configure(2, 50*time.Millisecond)
+		second, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		third, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		_, err = client.Get(ts.URL)
+		assert.True(t, errors.Is(err, ErrPoolTimeout))
+
+		// The slot of the first request is released in the old semaphore
+		require.NoError(t, first.Body.Close())
+		_, err = client.Get(ts.URL)
+		assert.True(t, errors.Is(err, ErrPoolTimeout))
+		require.NoError(t, second.Body.Close())
+		require.NoError(t, third.Body.Close())
+
+		p.configure(0, 0)
+		for i := 0; i < 3; i++ {
+			res, err := client.Get(ts.URL)
+			require.NoError(t, err)
+			defer res.Body.Close()
+		}
+	})
+
+	t.Run("ClientFor", func(t *testing.T) {
+		config.UseTestFile(t)
+		client := clientFor(prefixer.GlobalCouchCluster)
+		require.NotNil(t, client)
+		assert.Equal(t, client, clientFor(prefixer.GlobalCouchCluster))
+		p, ok := client.Transport.(*timedPool)
+		require.True(t, ok)
+		assert.Zero(t, client.Timeout)
+		assert.Equal(t, config.CouchCluster(prefixer.GlobalCouchCluster).Client.Timeout, p.timeout)
+		assert.Equal(t, p.pool, proxyTransport(prefixer.GlobalCouchCluster))
+	})
+
+	t.Run("ReconfigurePools", func(t *testing.T) {
+		config.UseTestFile(t)
+		p := clientFor(prefixer.GlobalCouchCluster).Transport.(*timedPool)
+		global := &config.GetConfig().CouchDB.Global
+		max, timeout := global.MaxConcurrentRequests, global.QueueTimeout
+		defer func() {
+			global.MaxConcurrentRequests, global.QueueTimeout = max, timeout
+			require.NoError(t, reconfigurePools())
+		}()
+
+		global.MaxConcurrentRequests, global.QueueTimeout = max+3, time.Second
+		require.NoError(t, reconfigurePools())
+		assert.Equal(t, max+3, p.pool.max)
+		assert.Equal(t, time.Second, p.pool.timeout)
+		assert.Equal(t, max+3, cap(p.pool.sem))
+	})
+}
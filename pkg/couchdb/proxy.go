@@ -19,7 +19,7 @@ import (
 // correct route.
 func Proxy(db prefixer.Prefixer, doctype, path string) *httputil.ReverseProxy {
 	couch := config.CouchCluster(db.DBCluster())
-	transport := config.CouchClient().Transport
+	transport := proxyTransport(db.DBCluster())
 
 	director := func(req *http.Request) {
 		req.URL.Scheme = couch.URL.Scheme
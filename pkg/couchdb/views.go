@@ -21,6 +21,9 @@ type View struct {
 	Map     interface{} `json:"map"`
 	Reduce  interface{} `json:"reduce,omitempty"`
 	Options interface{} `json:"options,omitempty"`
+	// Version is the IndexViewsVersion where the view has been added or
+	// modified for the last time
+	Version int `json:"-"`
 }
 
 // DesignDoc is the structure if a _design doc containing views
@@ -258,6 +261,13 @@ func DefineIndexes(g *errgroup.Group, db prefixer.Prefixer, indexes []*mango.Ind
 	}
 }
 
+// DeleteDesignDoc deletes the design doc of a view or an index, with its
+// name (without the _design/ prefix).
+func DeleteDesignDoc(db prefixer.Prefixer, doctype, name, rev string) error {
+	u := "_design/" + url.PathEscape(name) + "?rev=" + url.QueryEscape(rev)
+	return makeRequest(db, doctype, http.MethodDelete, u, nil, nil)
+}
+
 // DefineIndex define the index on the doctype database
 // see query package on how to define an index
 func DefineIndex(db prefixer.Prefixer, index *mango.Index) error {
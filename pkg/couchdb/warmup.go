@@ -0,0 +1,90 @@
+package couchdb
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// WarmUpMessage is the message of the warmup jobs, that ask CouchDB to build
+// the indexes and views in background, instead of doing it lazily on the
+// first query.
+type WarmUpMessage struct {
+	// All is true to warm up all the indexes and views of the stack.
+	All bool `json:"all,omitempty"`
+	// Indexes are some mango indexes to warm up.
+	Indexes []*mango.Index `json:"indexes,omitempty"`
+}
+
+var (
+	warmUpMu  sync.Mutex
+	warmUpSem = make(map[int]chan struct{})
+)
+
+// warmUpSemaphore returns the semaphore that limits the number of warm-up
+// queries sent at the same time to a CouchDB cluster by this process.
+func warmUpSemaphore(cluster int) chan struct{} {
+	max := config.GetConfig().CouchDB.MaxConcurrentWarmUps
+	if max <= 0 {
+		return nil
+	}
+	warmUpMu.Lock()
+	defer warmUpMu.Unlock()
+	sem, ok := warmUpSem[cluster]
+	if !ok {
+		sem = make(chan struct{}, max)
+		warmUpSem[cluster] = sem
+	}
+	return sem
+}
+
+// WarmUp forces CouchDB to build the indexes and views given in the message.
+// It continues on errors, and returns the last one.
+func WarmUp(db prefixer.Prefixer, msg *WarmUpMessage) error {
+	var errw error
+	indexes := msg.Indexes
+	if msg.All {
+		indexes = append(indexes, Indexes...)
+		for _, v := range Views {
+			if err := WarmUpView(db, v.Doctype, v.Name, v.Name); err != nil {
+				errw = err
+			}
+		}
+	}
+	for _, index := range indexes {
+		if err := WarmUpIndex(db, index); err != nil {
+			errw = err
+		}
+	}
+	return errw
+}
+
+// WarmUpIndex forces CouchDB to build a mango index. The index is defined if
+// it doesn't exist yet.
+func WarmUpIndex(db prefixer.Prefixer, index *mango.Index) error {
+	res, err := DefineIndexRaw(db, index.Doctype, index.Request)
+	if err != nil {
+		return err
+	}
+	ddoc := strings.TrimPrefix(res.ID, "_design/")
+	return WarmUpView(db, index.Doctype, ddoc, res.Name)
+}
+
+// WarmUpView forces CouchDB to build a view by querying it with limit=0.
+func WarmUpView(db prefixer.Prefixer, doctype, ddoc, name string) error {
+	if sem := warmUpSemaphore(db.DBCluster()); sem != nil {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+	}
+	u := "_design/" + url.PathEscape(ddoc) + "/_view/" + url.PathEscape(name) + "?limit=0"
+	err := makeRequest(db, doctype, http.MethodGet, u, nil, nil)
+	if IsNoDatabaseError(err) || IsNotFoundError(err) {
+		return nil
+	}
+	return err
+}
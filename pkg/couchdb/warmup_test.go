@@ -0,0 +1,37 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmUp(t *testing.T) {
+	config.UseTestFile(t)
+
+	t.Run("Semaphore", func(t *testing.T) {
+		sem := warmUpSemaphore(0)
+		require.NotNil(t, sem)
+		assert.Equal(t, config.GetConfig().CouchDB.MaxConcurrentWarmUps, cap(sem))
+		assert.Equal(t, sem, warmUpSemaphore(0))
+		assert.NotEqual(t, sem, warmUpSemaphore(1))
+	})
+
+	t.Run("Message", func(t *testing.T) {
+		index := mango.MakeIndex(consts.Files, "by-custom-field", mango.IndexDef{Fields: []string{"foo"}})
+		buf, err := json.Marshal(&WarmUpMessage{Indexes: []*mango.Index{index}})
+		require.NoError(t, err)
+		var msg WarmUpMessage
+		require.NoError(t, json.Unmarshal(buf, &msg))
+		assert.False(t, msg.All)
+		require.Len(t, msg.Indexes, 1)
+		assert.Equal(t, consts.Files, msg.Indexes[0].Doctype)
+		assert.Equal(t, "by-custom-field", msg.Indexes[0].Request.DDoc)
+		assert.Equal(t, []string{"foo"}, msg.Indexes[0].Request.Index.Fields)
+	})
+}
@@ -0,0 +1,119 @@
+// Package errcode is the registry of the machine-readable codes for the errors
+// returned by the stack. A code is a stable string, like
+// "sharing.invalid_signature", that the client apps can use instead of
+// matching the error messages, which can change.
+package errcode
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+// Code is an error code, with the HTTP status used for it.
+type Code struct {
+	ID          string `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]*Code)
+)
+
+// Register adds a code to the registry. It is intended to be called when
+// initializing the packages, and it panics if the code is already registered,
+// as the codes must be unique.
+func Register(id string, status int, description string) *Code {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[id]; ok {
+		panic(fmt.Sprintf("errcode: the code %q is already registered", id))
+	}
+	code := &Code{ID: id, Status: status, Description: description}
+	registry[id] = code
+	return code
+}
+
+// Lookup returns the registered code with the given identifier.
+func Lookup(id string) (*Code, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	code, ok := registry[id]
+	return code, ok
+}
+
+// All returns the registered codes, sorted by their identifiers.
+func All() []*Code {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	codes := make([]*Code, 0, len(registry))
+	for _, code := range registry {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].ID < codes[j].ID
+	})
+	return codes
+}
+
+// New returns a JSON-API error with this code, and the error message as
+// detail.
+func (c *Code) New(err error) *jsonapi.Error {
+	return &jsonapi.Error{
+		Status: c.Status,
+		Title:  http.StatusText(c.Status),
+		Code:   c.ID,
+		Detail: err.Error(),
+	}
+}
+
+// Errorf is like New, with a detail built with Sprintf.
+func (c *Code) Errorf(format string, args ...interface{}) *jsonapi.Error {
+	return c.New(fmt.Errorf(format, args...))
+}
+
+// Parameter returns a JSON-API error with this code, for an invalid HTTP or
+// query-string parameter.
+func (c *Code) Parameter(parameter string, err error) *jsonapi.Error {
+	jerr := c.New(err)
+	jerr.Source.Parameter = parameter
+	return jerr
+}
+
+// Attribute returns a JSON-API error with this code, for an invalid attribute
+// of the document sent in the request.
+func (c *Code) Attribute(attribute string, err error) *jsonapi.Error {
+	jerr := c.New(err)
+	jerr.Source.Pointer = "/data/attributes/" + attribute
+	return jerr
+}
+
+// WithDetails returns a JSON-API error with this code, and some details in its
+// meta.
+func (c *Code) WithDetails(err error, details map[string]interface{}) *jsonapi.Error {
+	jerr := c.New(err)
+	jerr.Meta = details
+	return jerr
+}
+
+// JSON responds to the request with this error, for the endpoints that don't
+// use JSON-API: the body is a JSON object with the message in the error field,
+// and the code in the code field.
+func (c *Code) JSON(ctx echo.Context, message string) error {
+	return ctx.JSON(c.Status, echo.Map{
+		"error": message,
+		"code":  c.ID,
+	})
+}
+
+// Is returns true if the given error is a JSON-API error with this code.
+func (c *Code) Is(err error) bool {
+	jerr, ok := err.(*jsonapi.Error)
+	return ok && jerr.Code == c.ID
+}
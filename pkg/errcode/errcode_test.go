@@ -0,0 +1,60 @@
+package errcode
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrCode(t *testing.T) {
+	foo := Register("test.foo", http.StatusConflict, "Foo")
+	bar := Register("test.bar", http.StatusUnprocessableEntity, "Bar")
+
+	t.Run("Register", func(t *testing.T) {
+		assert.Panics(t, func() {
+			Register("test.foo", http.StatusBadRequest, "Foo again")
+		})
+		code, ok := Lookup("test.foo")
+		require.True(t, ok)
+		assert.Equal(t, http.StatusConflict, code.Status)
+		_, ok = Lookup("test.unknown")
+		assert.False(t, ok)
+	})
+
+	t.Run("All", func(t *testing.T) {
+		all := All()
+		require.Len(t, all, 2)
+		assert.Equal(t, bar, all[0])
+		assert.Equal(t, foo, all[1])
+	})
+
+	t.Run("JSONAPI", func(t *testing.T) {
+		err := foo.New(errors.New("The foo is in conflict"))
+		assert.Equal(t, http.StatusConflict, err.Status)
+		assert.Equal(t, "Conflict", err.Title)
+		assert.Equal(t, "test.foo", err.Code)
+		assert.Equal(t, "The foo is in conflict", err.Detail)
+		assert.True(t, foo.Is(err))
+		assert.False(t, bar.Is(err))
+
+		err = bar.Parameter("name", errors.New("Invalid name"))
+		assert.Equal(t, "name", err.Source.Parameter)
+		err = bar.Attribute("name", errors.New("Invalid name"))
+		assert.Equal(t, "/data/attributes/name", err.Source.Pointer)
+		err = bar.WithDetails(errors.New("Invalid name"), map[string]interface{}{"max": 255})
+		assert.Equal(t, 255, err.Meta["max"])
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		require.NoError(t, foo.JSON(c, "conflict"))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.JSONEq(t, `{"error":"conflict","code":"test.foo"}`, rec.Body.String())
+	})
+}
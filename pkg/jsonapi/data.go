@@ -21,6 +21,9 @@ type Meta struct {
 	Warning        string                  `json:"warning,omitempty"`
 	Count          *int                    `json:"count,omitempty"`
 	ExecutionStats *couchdb.ExecutionStats `json:"execution_stats,omitempty"`
+	InFlight       *int                    `json:"in_flight,omitempty"`
+	Total          *int                    `json:"total,omitempty"`
+	HasMore        *bool                   `json:"has_more,omitempty"`
 }
 
 // LinksList is the common links used in JSON-API for the top-level or a
@@ -22,6 +22,9 @@ type Error struct {
 	Detail string      `json:"detail,omitempty"`
 	Source SourceError `json:"source,omitempty"`
 	Links  *LinksList  `json:"links,omitempty"`
+	// Meta can be used to give some details about the error, that are
+	// readable by a machine.
+	Meta map[string]interface{} `json:"meta,omitempty"`
 }
 
 // ErrorList is just an array of error objects
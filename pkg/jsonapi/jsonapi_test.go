@@ -39,6 +39,21 @@ func TestJsonapi(t *testing.T) {
 		return fmt.Errorf("Wrong cursor type")
 	})
 
+	router.GET("/paged", func(c echo.Context) error {
+		page, err := ExtractPage(c, 0, 3)
+		if err != nil {
+			return err
+		}
+		foos := []string{"a", "b", "c", "d", "e"}
+		start, end, next := page.Bounds(len(foos))
+		objs := make([]Object, 0, end-start)
+		for _, id := range foos[start:end] {
+			objs = append(objs, &Foo{FID: id, FRev: "1-abc", Bar: id})
+		}
+		total := len(foos)
+		return DataListPage(c, 200, objs, &total, next)
+	})
+
 	ts := httptest.NewServer(router)
 	t.Cleanup(ts.Close)
 
@@ -145,6 +160,56 @@ func TestJsonapi(t *testing.T) {
 		assert.NoError(t, json.NewDecoder(res.Body).Decode(&c))
 		assert.Equal(t, "key 13 [a b] c", c)
 	})
+
+	t.Run("PageCursor", func(t *testing.T) {
+		cursor := PageCursor{Bookmark: "g1AAAA", Offset: 42}
+		decoded, err := DecodeCursor(EncodeCursor(cursor))
+		assert.NoError(t, err)
+		assert.Equal(t, cursor, decoded)
+
+		_, err = DecodeCursor("not a cursor")
+		assert.Error(t, err)
+	})
+
+	t.Run("PageWithoutLimit", func(t *testing.T) {
+		res, err := http.Get(ts.URL + "/paged")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Len(t, body["data"], 5)
+		assert.NotContains(t, body, "links")
+		meta, _ := body["meta"].(map[string]interface{})
+		assert.EqualValues(t, 5, meta["count"])
+		assert.EqualValues(t, 5, meta["total"])
+		assert.Equal(t, false, meta["has_more"])
+	})
+
+	t.Run("PageWithLimit", func(t *testing.T) {
+		res, err := http.Get(ts.URL + "/paged?page[limit]=10&foo=bar")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		assert.Len(t, body["data"], 3)
+		meta, _ := body["meta"].(map[string]interface{})
+		assert.EqualValues(t, 3, meta["count"])
+		assert.EqualValues(t, 5, meta["total"])
+		assert.Equal(t, true, meta["has_more"])
+		links, _ := body["links"].(map[string]interface{})
+		next, _ := links["next"].(string)
+		assert.Contains(t, next, "foo=bar")
+
+		res2, err := http.Get(ts.URL + next)
+		assert.NoError(t, err)
+		defer res2.Body.Close()
+		var body2 map[string]interface{}
+		assert.NoError(t, json.NewDecoder(res2.Body).Decode(&body2))
+		assert.Len(t, body2["data"], 2)
+		assert.NotContains(t, body2, "links")
+		meta2, _ := body2["meta"].(map[string]interface{})
+		assert.Equal(t, false, meta2["has_more"])
+	})
 }
 
 type Foo struct {
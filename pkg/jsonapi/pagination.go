@@ -0,0 +1,105 @@
+package jsonapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PageCursor is the position of a page in a list. It is sent to the clients
+// as an opaque string in the page[cursor] parameter of the next link, and
+// can be built from a mango bookmark, a sequence number of a changes feed, or
+// an offset for the lists sorted in memory.
+type PageCursor struct {
+	Bookmark string `json:"b,omitempty"`
+	Seq      string `json:"s,omitempty"`
+	Offset   int    `json:"o,omitempty"`
+}
+
+// EncodeCursor returns the opaque string for the given cursor.
+func EncodeCursor(cursor PageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses an opaque string made by EncodeCursor.
+func DecodeCursor(str string) (PageCursor, error) {
+	var cursor PageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return cursor, Errorf(http.StatusBadRequest, "bad cursor %s", str)
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.Offset < 0 {
+		return cursor, Errorf(http.StatusBadRequest, "bad cursor %s", str)
+	}
+	return cursor, nil
+}
+
+// Page is the page of a list requested by a client, with the page[limit] and
+// page[cursor] parameters. A limit of 0 means that all the items are wanted.
+type Page struct {
+	Limit  int
+	Cursor PageCursor
+}
+
+// ExtractPage reads the page[limit] and page[cursor] parameters of the
+// request. The default limit is used when the client has not given a limit,
+// and can be 0 for the routes that have historically returned the whole list.
+func ExtractPage(c echo.Context, defaultLimit, maxLimit int) (*Page, error) {
+	page := &Page{Limit: defaultLimit}
+	if limitString := c.QueryParam("page[limit]"); limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit <= 0 {
+			return nil, NewError(http.StatusBadRequest, "page limit is not a positive number")
+		}
+		page.Limit = limit
+		if maxLimit > 0 && page.Limit > maxLimit {
+			page.Limit = maxLimit
+		}
+	}
+	if str := c.QueryParam("page[cursor]"); str != "" {
+		cursor, err := DecodeCursor(str)
+		if err != nil {
+			return nil, err
+		}
+		page.Cursor = cursor
+	}
+	return page, nil
+}
+
+// Bounds returns the indexes of the first and last (excluded) items of the
+// page for a list of n items sorted in memory, and the cursor for the next
+// page, or nil if it is the last page.
+func (p *Page) Bounds(n int) (int, int, *PageCursor) {
+	start := p.Cursor.Offset
+	if start > n {
+		start = n
+	}
+	if p.Limit == 0 || start+p.Limit >= n {
+		return start, n, nil
+	}
+	end := start + p.Limit
+	return start, end, &PageCursor{Offset: end}
+}
+
+// DataListPage sends a page of a list of objects. The meta contains the
+// number of objects in the page, the total number of items if it is known,
+// and if there are more items. The next link is added when the cursor for the
+// next page is not nil, and keeps the other parameters of the request.
+func DataListPage(c echo.Context, statusCode int, objs []Object, total *int, next *PageCursor) error {
+	count := len(objs)
+	hasMore := next != nil
+	meta := Meta{Count: &count, Total: total, HasMore: &hasMore}
+
+	var links *LinksList
+	if next != nil {
+		req := c.Request()
+		params := req.URL.Query()
+		params.Set("page[cursor]", EncodeCursor(*next))
+		links = &LinksList{Next: req.URL.Path + "?" + params.Encode()}
+	}
+	return DataListWithMeta(c, statusCode, meta, objs, links)
+}
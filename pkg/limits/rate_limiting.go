@@ -75,6 +75,20 @@ const (
 	// MagicLinkType is used when sending emails with a magic link that can
 	// authenticate the user into a Cozy
 	MagicLinkType
+	// JobSMSType is used for counting the number of SMS sent for notifications
+	JobSMSType
+	// MailDailyType is used for counting the number of mails sent by an
+	// instance during a day
+	MailDailyType
+	// MailContextDailyType is used for counting the number of mails sent by
+	// all the instances of a context during a day
+	MailContextDailyType
+	// RemoteDoctypeType is used for counting the number of requests made to
+	// the remote website of a remote doctype, for the instances of a context
+	RemoteDoctypeType
+	// SharingVerificationCodeType is used for counting the number of
+	// verification codes sent to a member of an open sharing
+	SharingVerificationCodeType
 )
 
 type counterConfig struct {
@@ -222,6 +236,36 @@ var configs = []counterConfig{
 		Limit:  30,
 		Period: 1 * time.Hour,
 	},
+	// JobSMSType
+	{
+		Prefix: "job-sms",
+		Limit:  20,
+		Period: 1 * time.Hour,
+	},
+	// MailDailyType (the limit comes from the configuration)
+	{
+		Prefix: "mail-daily",
+		Limit:  0,
+		Period: 24 * time.Hour,
+	},
+	// MailContextDailyType (the limit comes from the configuration)
+	{
+		Prefix: "mail-context-daily",
+		Limit:  0,
+		Period: 24 * time.Hour,
+	},
+	// RemoteDoctypeType (the limit comes from the remote doctype)
+	{
+		Prefix: "remote-doctype",
+		Limit:  0,
+		Period: 1 * time.Minute,
+	},
+	// SharingVerificationCodeType
+	{
+		Prefix: "sharing-verification-code",
+		Limit:  5,
+		Period: 24 * time.Hour,
+	},
 }
 
 // Counter is an interface for counting number of attempts that can be used to
@@ -258,25 +302,34 @@ func (r *RateLimiter) CheckRateLimit(p prefixer.Prefixer, ct CounterType) error
 
 // CheckRateLimitKey allows to check the rate-limit for a key
 func (r *RateLimiter) CheckRateLimitKey(customKey string, ct CounterType) error {
+	_, err := r.CheckRateLimitKeyWithLimit(customKey, ct, configs[ct].Limit)
+	return err
+}
+
+// CheckRateLimitKeyWithLimit allows to check the rate-limit for a key, with a
+// limit that can be different of the default one for the counter type (for
+// example, when it can be configured per context). It also returns the value
+// of the counter.
+func (r *RateLimiter) CheckRateLimitKeyWithLimit(customKey string, ct CounterType, limit int64) (int64, error) {
 	cfg := configs[ct]
 	key := cfg.Prefix + ":" + customKey
 
 	val, err := r.counter.Increment(key, cfg.Period)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// The first time we reach the limit, we provide a specific error message.
 	// This allows to log a warning only once if needed.
-	if val == cfg.Limit+1 {
-		return ErrRateLimitReached
+	if val == limit+1 {
+		return val, ErrRateLimitReached
 	}
 
-	if val > cfg.Limit {
-		return ErrRateLimitExceeded
+	if val > limit {
+		return val, ErrRateLimitExceeded
 	}
 
-	return nil
+	return val, nil
 }
 
 // ResetCounter sets again to zero the counter for the given type and instance.
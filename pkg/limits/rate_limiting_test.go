@@ -81,6 +81,20 @@ func TestRate(t *testing.T) {
 				err := limiter.CheckRateLimit(testInstance, TwoFactorType)
 				require.Error(t, err)
 			})
+
+			t.Run("CustomLimit", func(t *testing.T) {
+				key := testInstance.DomainName() + ":custom"
+				for i := int64(1); i <= 3; i++ {
+					val, err := limiter.CheckRateLimitKeyWithLimit(key, MailDailyType, 3)
+					require.NoError(t, err)
+					require.Equal(t, i, val)
+				}
+				val, err := limiter.CheckRateLimitKeyWithLimit(key, MailDailyType, 3)
+				require.ErrorIs(t, err, ErrRateLimitReached)
+				require.Equal(t, int64(4), val)
+				_, err = limiter.CheckRateLimitKeyWithLimit(key, MailDailyType, 3)
+				require.ErrorIs(t, err, ErrRateLimitExceeded)
+			})
 		})
 	}
 }
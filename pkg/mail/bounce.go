@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+const (
+	// BounceHard is used for permanent failures, like an unknown address.
+	BounceHard = "hard"
+	// BounceSoft is used for temporary failures, like a full mailbox.
+	BounceSoft = "soft"
+
+	// maxSoftBounces is the number of soft bounces after which an address is
+	// considered as bouncing.
+	maxSoftBounces = 3
+)
+
+// ErrInvalidBounce is used when a bounce notification is not valid.
+var ErrInvalidBounce = errors.New("Invalid bounce: the email address is missing")
+
+// Bounce is a document, stored in the global database, that records that the
+// mails sent to an address have bounced.
+type Bounce struct {
+	DocID        string    `json:"_id,omitempty"`
+	DocRev       string    `json:"_rev,omitempty"`
+	Email        string    `json:"email"`
+	Domain       string    `json:"domain,omitempty"`
+	Type         string    `json:"type"`
+	Reason       string    `json:"reason,omitempty"`
+	Count        int       `json:"count"`
+	LastBounceAt time.Time `json:"last_bounce_at"`
+}
+
+// ID is used to implement the couchdb.Doc interface
+func (b *Bounce) ID() string { return b.DocID }
+
+// Rev is used to implement the couchdb.Doc interface
+func (b *Bounce) Rev() string { return b.DocRev }
+
+// DocType is used to implement the couchdb.Doc interface
+func (b *Bounce) DocType() string { return consts.MailsBounces }
+
+// Clone implements couchdb.Doc
+func (b *Bounce) Clone() couchdb.Doc {
+	cloned := *b
+	return &cloned
+}
+
+// SetID is used to implement the couchdb.Doc interface
+func (b *Bounce) SetID(id string) { b.DocID = id }
+
+// SetRev is used to implement the couchdb.Doc interface
+func (b *Bounce) SetRev(rev string) { b.DocRev = rev }
+
+// IsBouncing returns true if the mails sent to this address should not be
+// sent anymore.
+func (b *Bounce) IsBouncing() bool {
+	return b.Type == BounceHard || b.Count >= maxSoftBounces
+}
+
+func bounceID(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// GetBounce returns the bounce document for the given email address, or nil
+// if no mail has bounced for it.
+func GetBounce(email string) (*Bounce, error) {
+	var doc Bounce
+	err := couchdb.GetDoc(prefixer.GlobalPrefixer, consts.MailsBounces, bounceID(email), &doc)
+	if couchdb.IsNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// RecordBounce saves that a mail sent to the address has bounced. A hard
+// bounce marks the address as bouncing immediately, whereas several soft
+// bounces are needed for that.
+func RecordBounce(bounce *Bounce) (*Bounce, error) {
+	id := bounceID(bounce.Email)
+	if id == "" {
+		return nil, ErrInvalidBounce
+	}
+	if bounce.Type != BounceSoft {
+		bounce.Type = BounceHard
+	}
+	doc, err := GetBounce(id)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = &Bounce{DocID: id, Email: id}
+	}
+	if doc.Type != BounceHard {
+		doc.Type = bounce.Type
+	}
+	if bounce.Domain != "" {
+		doc.Domain = bounce.Domain
+	}
+	doc.Reason = bounce.Reason
+	doc.Count++
+	doc.LastBounceAt = time.Now().UTC()
+	if err := couchdb.Upsert(prefixer.GlobalPrefixer, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ClearBounce removes the bouncing mark on an email address, for example
+// when the user has fixed their mailbox.
+func ClearBounce(email string) error {
+	doc, err := GetBounce(email)
+	if err != nil || doc == nil {
+		return err
+	}
+	return couchdb.DeleteDoc(prefixer.GlobalPrefixer, doc)
+}
+
+// IsBouncing returns true if the mails sent to the given address have
+// bounced, and no new mail should be sent to it.
+func IsBouncing(email string) bool {
+	doc, err := GetBounce(email)
+	if err != nil || doc == nil {
+		return false
+	}
+	return doc.IsBouncing()
+}
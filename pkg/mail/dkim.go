@@ -0,0 +1,218 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dkimSignedHeaders is the list of the headers that are signed with DKIM, if
+// they are present in the message.
+var dkimSignedHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc",
+	"Message-Id", "Mime-Version", "Content-Type", "X-Cozy",
+}
+
+// ErrInvalidDKIMKey is used when the DKIM private key cannot be parsed.
+var ErrInvalidDKIMKey = errors.New("Invalid DKIM private key")
+
+// ParseDKIMPrivateKey parses a PEM encoded private key that can be used for
+// signing the mails with DKIM. RSA and ed25519 keys are supported.
+func ParseDKIMPrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidDKIMKey
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidDKIMKey
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, ErrInvalidDKIMKey
+}
+
+// SignDKIM adds a DKIM-Signature header to the given message, using the
+// relaxed canonicalization for both the headers and the body.
+// Cf https://www.rfc-editor.org/rfc/rfc6376
+func SignDKIM(msg []byte, domain, selector string, key crypto.Signer, now time.Time) ([]byte, error) {
+	var algo string
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		algo = "rsa-sha256"
+	case ed25519.PrivateKey:
+		algo = "ed25519-sha256"
+	default:
+		return nil, ErrInvalidDKIMKey
+	}
+
+	header, body := splitMessage(msg)
+	fields := parseHeaderFields(header)
+	bodyHash := sha256.Sum256(canonicalizeBodyRelaxed(body))
+
+	var names []string
+	hash := sha256.New()
+	for _, name := range dkimSignedHeaders {
+		field, ok := fields[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		names = append(names, strings.ToLower(name))
+		hash.Write([]byte(canonicalizeHeaderRelaxed(field)))
+		hash.Write([]byte("\r\n"))
+	}
+
+	sig := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		algo, domain, selector, now.Unix(), strings.Join(names, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+	sig = foldDKIMTags(sig)
+	hash.Write([]byte(canonicalizeHeaderRelaxed("DKIM-Signature: " + sig)))
+	digest := hash.Sum(nil)
+
+	var signed []byte
+	var err error
+	if k, ok := key.(ed25519.PrivateKey); ok {
+		signed = ed25519.Sign(k, digest)
+	} else {
+		signed, err = key.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("DKIM-Signature: ")
+	buf.WriteString(sig)
+	// The value of the b= tag, including the folding whitespaces, is ignored
+	// when computing the hash of the headers, so it can be folded anywhere.
+	b := base64.StdEncoding.EncodeToString(signed)
+	for len(b) > 0 {
+		n := 72
+		if n > len(b) {
+			n = len(b)
+		}
+		buf.WriteString("\r\n\t")
+		buf.WriteString(b[:n])
+		b = b[n:]
+	}
+	buf.WriteString("\r\n")
+	buf.Write(msg)
+	return buf.Bytes(), nil
+}
+
+// splitMessage returns the header and the body of a message.
+func splitMessage(msg []byte) (string, []byte) {
+	idx := bytes.Index(msg, []byte("\r\n\r\n"))
+	if idx < 0 {
+		return string(msg), nil
+	}
+	return string(msg[:idx+2]), msg[idx+4:]
+}
+
+// parseHeaderFields returns the header fields of a message, indexed by their
+// lowercased name. The fields are kept with their original format, and when
+// a field appears several times, only the last one is kept as it is the one
+// that is signed first (RFC 6376, section 5.4.2).
+func parseHeaderFields(header string) map[string]string {
+	fields := make(map[string]string)
+	lines := strings.Split(header, "\r\n")
+	var current string
+	flush := func() {
+		if current == "" {
+			return
+		}
+		if idx := strings.Index(current, ":"); idx > 0 {
+			name := strings.ToLower(strings.TrimSpace(current[:idx]))
+			fields[name] = current
+		}
+	}
+	for _, line := range lines {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			current += "\r\n" + line
+			continue
+		}
+		flush()
+		current = line
+	}
+	flush()
+	return fields
+}
+
+// canonicalizeHeaderRelaxed applies the relaxed canonicalization algorithm to
+// a header field (RFC 6376, section 3.4.2). The trailing CRLF is not added.
+func canonicalizeHeaderRelaxed(field string) string {
+	idx := strings.Index(field, ":")
+	if idx < 0 {
+		return field
+	}
+	name := strings.ToLower(strings.TrimRight(field[:idx], " \t"))
+	value := strings.ReplaceAll(field[idx+1:], "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return name + ":" + value
+}
+
+// canonicalizeBodyRelaxed applies the relaxed canonicalization algorithm to
+// the body of a message (RFC 6376, section 3.4.4).
+func canonicalizeBodyRelaxed(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		lines[i] = strings.Join(strings.FieldsFunc(line, isWSP), " ")
+		if len(line) > 0 && isWSP(rune(line[0])) {
+			lines[i] = " " + lines[i]
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// foldDKIMTags folds the value of the DKIM-Signature header between its
+// tags, to keep the lines short. The relaxed canonicalization of the header
+// replaces the folding whitespaces by a single space, so the folded header
+// can be used for computing the signature.
+func foldDKIMTags(value string) string {
+	const width = 72
+	var buf strings.Builder
+	lineLen := len("DKIM-Signature: ")
+	for i, tag := range strings.Split(value, "; ") {
+		if i > 0 {
+			buf.WriteString(";")
+			if lineLen+len(tag)+2 > width {
+				buf.WriteString("\r\n\t")
+				lineLen = 1
+			} else {
+				buf.WriteString(" ")
+				lineLen += 2
+			}
+		}
+		buf.WriteString(tag)
+		lineLen += len(tag)
+	}
+	return buf.String()
+}
@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dkimTestMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.net\r\n" +
+	"Subject: Hello\r\n" +
+	" world\r\n" +
+	"Date: Mon, 19 Jun 2023 10:00:00 +0000\r\n" +
+	"X-Cozy: alice.example.com\r\n" +
+	"\r\n" +
+	"Hi Bob,  \r\n" +
+	"\r\n" +
+	"How are you?\r\n" +
+	"\r\n" +
+	"\r\n"
+
+func TestDKIM(t *testing.T) {
+	t.Run("CanonicalizeRelaxed", func(t *testing.T) {
+		// Examples from RFC 6376, section 3.4.5
+		assert.Equal(t, "a:X", canonicalizeHeaderRelaxed("A: X"))
+		assert.Equal(t, "b:Y Z", canonicalizeHeaderRelaxed("B : Y\t\r\n\tZ  "))
+		body := canonicalizeBodyRelaxed([]byte(" C \r\nD \t E\r\n\r\n\r\n"))
+		assert.Equal(t, " C\r\nD E\r\n", string(body))
+		assert.Empty(t, canonicalizeBodyRelaxed([]byte("\r\n\r\n")))
+	})
+
+	t.Run("ParseDKIMPrivateKey", func(t *testing.T) {
+		_, err := ParseDKIMPrivateKey([]byte("not a key"))
+		assert.ErrorIs(t, err, ErrInvalidDKIMKey)
+
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		data := pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+		})
+		key, err := ParseDKIMPrivateKey(data)
+		require.NoError(t, err)
+		assert.IsType(t, &rsa.PrivateKey{}, key)
+
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(edKey)
+		require.NoError(t, err)
+		data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		key, err = ParseDKIMPrivateKey(data)
+		require.NoError(t, err)
+		assert.IsType(t, ed25519.PrivateKey{}, key)
+	})
+
+	t.Run("SignWithRSA", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		signed, err := SignDKIM([]byte(dkimTestMessage), "example.com", "cozy", key, time.Now())
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(string(signed), dkimTestMessage))
+
+		tags, digest := verifyDKIMHeader(t, signed)
+		assert.Equal(t, "rsa-sha256", tags["a"])
+		assert.Equal(t, "example.com", tags["d"])
+		assert.Equal(t, "cozy", tags["s"])
+		assert.Equal(t, "from:subject:date:to:x-cozy", tags["h"])
+		sig, err := base64.StdEncoding.DecodeString(tags["b"])
+		require.NoError(t, err)
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest, sig))
+	})
+
+	t.Run("SignWithEd25519", func(t *testing.T) {
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		signed, err := SignDKIM([]byte(dkimTestMessage), "example.com", "cozy", key, time.Now())
+		require.NoError(t, err)
+
+		tags, digest := verifyDKIMHeader(t, signed)
+		assert.Equal(t, "ed25519-sha256", tags["a"])
+		sig, err := base64.StdEncoding.DecodeString(tags["b"])
+		require.NoError(t, err)
+		assert.True(t, ed25519.Verify(pub, digest, sig))
+	})
+}
+
+// verifyDKIMHeader checks the body hash of a signed message, and returns the
+// tags of its DKIM-Signature header and the hash of the signed headers.
+func verifyDKIMHeader(t *testing.T, signed []byte) (map[string]string, []byte) {
+	header, body := splitMessage(signed)
+	fields := parseHeaderFields(header)
+	sigField, ok := fields["dkim-signature"]
+	require.True(t, ok)
+
+	tags := map[string]string{}
+	value := sigField[strings.Index(sigField, ":")+1:]
+	value = regexp.MustCompile(`\s+`).ReplaceAllString(value, "")
+	for _, tag := range strings.Split(value, ";") {
+		parts := strings.SplitN(tag, "=", 2)
+		require.Len(t, parts, 2)
+		tags[parts[0]] = parts[1]
+	}
+
+	bodyHash := sha256.Sum256(canonicalizeBodyRelaxed(body))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(bodyHash[:]), tags["bh"])
+
+	hash := sha256.New()
+	for _, name := range strings.Split(tags["h"], ":") {
+		hash.Write([]byte(canonicalizeHeaderRelaxed(fields[name]) + "\r\n"))
+	}
+	stripped := regexp.MustCompile(`b=[^;]*$`).ReplaceAllString(sigField, "b=")
+	hash.Write([]byte(canonicalizeHeaderRelaxed(stripped)))
+	return tags, hash.Sum(nil)
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MailCapAccepted is the outcome label for a mail that can be sent.
+	MailCapAccepted = "accepted"
+	// MailCapDeferred is the outcome label for a mail put in the overflow
+	// queue.
+	MailCapDeferred = "deferred"
+	// MailCapDropped is the outcome label for a mail dropped because the
+	// overflow queue is full.
+	MailCapDropped = "dropped"
+)
+
+// MailsCapsCounter is a counter of the mails checked against the daily caps,
+// labelled by the outcome and by the cap ("instance", "context" or "none").
+var MailsCapsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "mails",
+		Subsystem: "caps",
+		Name:      "count",
+
+		Help: `Number of mails checked against the daily caps, labelled by the outcome
+(accepted, deferred or dropped) and by the cap that was hit.`,
+	},
+	[]string{"outcome", "cap"},
+)
+
+func init() {
+	prometheus.MustRegister(MailsCapsCounter)
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// VersionsReclaimedBytes is a counter of the number of bytes reclaimed by
+// cleaning the old versions of the files, labelled by the source of the
+// cleaning: "write" when a file is modified, and "job" for the periodic job.
+var VersionsReclaimedBytes = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "vfs",
+		Subsystem: "versions",
+		Name:      "reclaimed_bytes",
+
+		Help: `Number of bytes reclaimed by cleaning the old versions of the files,
+labelled by the source of the cleaning.`,
+	},
+	[]string{"source"},
+)
+
+func init() {
+	prometheus.MustRegister(VersionsReclaimedBytes)
+}
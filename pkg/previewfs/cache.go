@@ -22,12 +22,17 @@ const (
 	ttl           = 30 * 24 * time.Hour
 )
 
-// Cache is a interface for persisting icons & previews of PDF for later reuse.
+// Cache is a interface for persisting icons & previews of PDF, and previews
+// of office documents, for later reuse.
 type Cache interface {
 	GetIcon(md5sum []byte) (*bytes.Buffer, error)
 	SetIcon(md5sum []byte, buffer *bytes.Buffer) error
 	GetPreview(md5sum []byte) (*bytes.Buffer, error)
 	SetPreview(md5sum []byte, buffer *bytes.Buffer) error
+	// The format of an office preview is pdf, or page-N for the PNG image of
+	// a page.
+	GetOfficePreview(md5sum []byte, format string) (*bytes.Buffer, error)
+	SetOfficePreview(md5sum []byte, format string, buffer *bytes.Buffer) error
 }
 
 // SystemCache returns the global cache, using the configuration file.
@@ -90,6 +95,26 @@ func (a aferoCache) SetPreview(md5sum []byte, buffer *bytes.Buffer) error {
 	return writeClose(f, buffer)
 }
 
+func (a aferoCache) GetOfficePreview(md5sum []byte, format string) (*bytes.Buffer, error) {
+	f, err := a.fs.Open(officeFilename(md5sum, format))
+	if err != nil {
+		return nil, err
+	}
+	return readClose(f)
+}
+
+func (a aferoCache) SetOfficePreview(md5sum []byte, format string, buffer *bytes.Buffer) error {
+	exists, err := afero.DirExists(a.fs, "/")
+	if err != nil || !exists {
+		_ = a.fs.MkdirAll("/", 0700)
+	}
+	f, err := a.fs.OpenFile(officeFilename(md5sum, format), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	return writeClose(f, buffer)
+}
+
 type swiftCache struct {
 	c   *swift.Connection
 	ctx context.Context
@@ -151,6 +176,38 @@ func (s swiftCache) SetPreview(md5sum []byte, buffer *bytes.Buffer) error {
 	return err
 }
 
+func (s swiftCache) GetOfficePreview(md5sum []byte, format string) (*bytes.Buffer, error) {
+	f, _, err := s.c.ObjectOpen(s.ctx, containerName, officeFilename(md5sum, format), false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return readClose(f)
+}
+
+func (s swiftCache) SetOfficePreview(md5sum []byte, format string, buffer *bytes.Buffer) error {
+	objectName := officeFilename(md5sum, format)
+	contentType := "image/png"
+	if format == "pdf" {
+		contentType = "application/pdf"
+	}
+	objectMeta := swift.Metadata{"created-at": time.Now().Format(time.RFC3339)}
+	headers := objectMeta.ObjectHeaders()
+	headers["X-Delete-After"] = strconv.FormatInt(int64(ttl.Seconds()), 10)
+	f, err := s.c.ObjectCreate(s.ctx, containerName, objectName, true, "", contentType, headers)
+	if err != nil {
+		return err
+	}
+	err = writeClose(f, buffer)
+	if errors.Is(err, swift.ContainerNotFound) || errors.Is(err, swift.ObjectNotFound) {
+		_ = s.c.ContainerCreate(s.ctx, containerName, nil)
+		f, err = s.c.ObjectCreate(s.ctx, containerName, objectName, true, "", contentType, headers)
+		if err == nil {
+			err = writeClose(f, buffer)
+		}
+	}
+	return err
+}
+
 func iconFilename(md5sum []byte) string {
 	return "icon-" + hex.EncodeToString(md5sum) + ".jpg"
 }
@@ -159,6 +216,10 @@ func previewFilename(md5sum []byte) string {
 	return hex.EncodeToString(md5sum) + ".jpg"
 }
 
+func officeFilename(md5sum []byte, format string) string {
+	return "office-" + hex.EncodeToString(md5sum) + "-" + format
+}
+
 func readClose(f io.ReadCloser) (*bytes.Buffer, error) {
 	buffer := &bytes.Buffer{}
 	_, err := buffer.ReadFrom(f)
@@ -0,0 +1,118 @@
+package realtime
+
+import (
+	"encoding/json"
+
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+)
+
+// EventBulk is the verb of the events that coalesce the changes made on a
+// doctype by a bulk operation, like moving or deleting thousands of files.
+const EventBulk = "BULK"
+
+// BulkChange is the compact description of a document changed by a bulk
+// operation. For the files and directories, the type, dir_id and path are
+// also given, so that the changes can be filtered for the clients that don't
+// synchronize some directories.
+type BulkChange struct {
+	Verb  string `json:"verb"`
+	ID    string `json:"_id"`
+	Rev   string `json:"_rev,omitempty"`
+	Type  string `json:"type,omitempty"`
+	DirID string `json:"dir_id,omitempty"`
+	Path  string `json:"path,omitempty"`
+}
+
+// BulkDoc is the document of a bulk event.
+type BulkDoc struct {
+	Type    string       `json:"-"`
+	Changes []BulkChange `json:"changes"`
+}
+
+// ID returns an empty string, as a bulk event is not about a single document.
+func (b *BulkDoc) ID() string { return "" }
+
+// DocType returns the doctype of the changed documents.
+func (b *BulkDoc) DocType() string { return b.Type }
+
+// MarshalJSON is used for marshalling the document to JSON, with the doctype
+// as _type, like for JSONDoc.
+func (b *BulkDoc) MarshalJSON() ([]byte, error) {
+	changes := b.Changes
+	if changes == nil {
+		changes = []BulkChange{}
+	}
+	return json.Marshal(map[string]interface{}{
+		"_type":   b.Type,
+		"changes": changes,
+	})
+}
+
+// AsBulkDoc returns the bulk document of an event, when the event has been
+// published in this process or received from redis.
+func AsBulkDoc(doc Doc) (*BulkDoc, bool) {
+	switch d := doc.(type) {
+	case *BulkDoc:
+		return d, true
+	case *JSONDoc:
+		raw, ok := d.M["changes"]
+		if !ok {
+			return nil, false
+		}
+		buf, err := json.Marshal(raw)
+		if err != nil {
+			return nil, false
+		}
+		bulk := &BulkDoc{Type: d.Type}
+		if err := json.Unmarshal(buf, &bulk.Changes); err != nil {
+			return nil, false
+		}
+		return bulk, true
+	}
+	return nil, false
+}
+
+// PublishCoalesced publishes the event for a change that is also part of a
+// bulk event. It is sent to the subscribers that have not enabled the bulk
+// events, like the triggers, but not to the others, as they will receive the
+// bulk event.
+func PublishCoalesced(db prefixer.Prefixer, verb string, doc Doc, oldDoc Doc) {
+	e := newEvent(db, verb, doc, oldDoc)
+	e.Coalesced = true
+	GetHub().publish(e)
+}
+
+// matchIDs returns true if the document of the event is one of the watched
+// documents.
+func matchIDs(e *Event, ids []string) bool {
+	for _, id := range ids {
+		if e.Doc.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBulkEvent returns a copy of the bulk event with only the changes of
+// the watched documents, or nil if none of them has been changed.
+func filterBulkEvent(e *Event, ids []string) *Event {
+	bulk, ok := AsBulkDoc(e.Doc)
+	if !ok {
+		return nil
+	}
+	filtered := &BulkDoc{Type: bulk.Type}
+	for _, change := range bulk.Changes {
+		for _, id := range ids {
+			if change.ID == id {
+				filtered.Changes = append(filtered.Changes, change)
+				break
+			}
+		}
+	}
+	if len(filtered.Changes) == 0 {
+		return nil
+	}
+	clone := *e
+	clone.Doc = filtered
+	return &clone
+}
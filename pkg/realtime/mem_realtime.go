@@ -23,11 +23,14 @@ func newMemHub() *memHub {
 }
 
 func (h *memHub) Publish(db prefixer.Prefixer, verb string, doc, oldDoc Doc) {
+	h.publish(newEvent(db, verb, doc, oldDoc))
+}
+
+func (h *memHub) publish(e *Event) {
 	h.RLock()
 	defer h.RUnlock()
 
-	e := newEvent(db, verb, doc, oldDoc)
-	key := topicKey(db, doc.DocType())
+	key := topicKey(e, e.Doc.DocType())
 	it := h.topics[key]
 	if it != nil {
 		select {
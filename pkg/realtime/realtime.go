@@ -29,6 +29,8 @@ type Event struct {
 	Verb    string `json:"verb"`
 	Doc     Doc    `json:"doc"`
 	OldDoc  Doc    `json:"old,omitempty"`
+	// Coalesced is true when the change is also part of a bulk event
+	Coalesced bool `json:"coalesced,omitempty"`
 }
 
 func newEvent(db prefixer.Prefixer, verb string, doc Doc, oldDoc Doc) *Event {
@@ -75,6 +77,7 @@ type Hub interface {
 	// cozy-stack process.
 	SubscribeFirehose() *Subscriber
 
+	publish(e *Event)
 	subscribe(sub *Subscriber, key string)
 	unsubscribe(sub *Subscriber, key string)
 	watch(sub *Subscriber, key, id string)
@@ -1,6 +1,7 @@
 package realtime
 
 import (
+	"encoding/json"
 	"sync"
 	"testing"
 	"time"
@@ -300,3 +301,111 @@ func TestRedisRealtime(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestRedisHubDispatch(t *testing.T) {
+	h := &redisHub{
+		mem:    newMemHub(),
+		queues: make(map[string]chan *jsonEvent),
+	}
+	c := h.Subscriber(testingDB)
+	defer c.Close()
+	c.Subscribe("io.cozy.testobject")
+
+	payload := `io.cozy.testobject,{"domain":"testing","prefix":"testing","verb":"CREATED","doc":{"_id":"foo"}}`
+	je, err := parsePayload(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, "io.cozy.testobject", je.Doc.DocType())
+	h.dispatch(je)
+
+	payload = `io.cozy.testobject,{"domain":"other","prefix":"other","verb":"CREATED","doc":{"_id":"bar"}}`
+	je, err = parsePayload(payload)
+	assert.NoError(t, err)
+	h.dispatch(je)
+
+	payload = `io.cozy.testobject,{"domain":"testing","prefix":"testing","verb":"UPDATED","doc":{"_id":"foo"}}`
+	je, err = parsePayload(payload)
+	assert.NoError(t, err)
+	h.dispatch(je)
+
+	e := <-c.Channel
+	assert.Equal(t, EventCreate, e.Verb)
+	assert.Equal(t, "foo", e.Doc.ID())
+	e = <-c.Channel
+	assert.Equal(t, EventUpdate, e.Verb)
+	assert.Equal(t, "foo", e.Doc.ID())
+
+	h.queuesMu.Lock()
+	assert.Len(t, h.queues, 2)
+	h.queuesMu.Unlock()
+
+	_, err = parsePayload("invalid")
+	assert.Error(t, err)
+}
+
+func TestBulkEvent(t *testing.T) {
+	bulk := &BulkDoc{
+		Type: "io.cozy.testobject",
+		Changes: []BulkChange{
+			{Verb: EventUpdate, ID: "foo", Rev: "2-abc"},
+			{Verb: EventDelete, ID: "bar", Rev: "3-abc"},
+		},
+	}
+
+	t.Run("FromRedis", func(t *testing.T) {
+		buf, err := json.Marshal(newEvent(testingDB, EventBulk, bulk, nil))
+		assert.NoError(t, err)
+		var je jsonEvent
+		assert.NoError(t, json.Unmarshal(buf, &je))
+		decoded, ok := AsBulkDoc(je.Doc)
+		assert.True(t, ok)
+		assert.Equal(t, bulk, decoded)
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		h := newMemHub()
+		c := h.Subscriber(testingDB)
+		defer c.Close()
+		c.EnableBulkEvents()
+		c.Watch("io.cozy.testobject", "bar")
+		time.Sleep(10 * time.Millisecond)
+
+		h.Publish(testingDB, EventBulk, &BulkDoc{Type: "io.cozy.testobject"}, nil)
+		h.Publish(testingDB, EventBulk, bulk, nil)
+		select {
+		case e := <-c.Channel:
+			assert.Equal(t, EventBulk, e.Verb)
+			assert.Equal(t, &BulkDoc{
+				Type:    "io.cozy.testobject",
+				Changes: []BulkChange{{Verb: EventDelete, ID: "bar", Rev: "3-abc"}},
+			}, e.Doc)
+			// The original event is not modified for the other subscribers
+			assert.Len(t, bulk.Changes, 2)
+		case <-time.After(time.Second):
+			t.Fatal("the bulk event has not been received")
+		}
+	})
+
+	t.Run("OptIn", func(t *testing.T) {
+		h := newMemHub()
+		c := h.Subscriber(testingDB)
+		defer c.Close()
+		c.Subscribe("io.cozy.testobject")
+		firehose := h.SubscribeFirehose()
+		defer firehose.Close()
+		time.Sleep(10 * time.Millisecond)
+
+		h.Publish(testingDB, EventBulk, bulk, nil)
+		e := newEvent(testingDB, EventUpdate, &testDoc{id: "foo", doctype: "io.cozy.testobject"}, nil)
+		e.Coalesced = true
+		h.publish(e)
+		for _, sub := range []*Subscriber{c, firehose} {
+			select {
+			case e := <-sub.Channel:
+				assert.Equal(t, EventUpdate, e.Verb)
+				assert.Equal(t, "foo", e.Doc.ID())
+			case <-time.After(time.Second):
+				t.Fatal("the event has not been received")
+			}
+		}
+	})
+}
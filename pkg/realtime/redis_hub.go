@@ -3,27 +3,77 @@ package realtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/pkg/utils"
 	redis "github.com/redis/go-redis/v9"
 )
 
-const eventsRedisKey = "realtime:events"
+const (
+	// eventsStreamKey is the key of the redis stream where the events are
+	// published. Each stack reads it with its own consumer group, so that every
+	// stack receives all the events.
+	eventsStreamKey = "realtime:stream"
+	// eventsStreamMaxLen is the approximative number of events kept in the
+	// stream. It allows a stack to replay the events that it has missed during
+	// a brief disconnection from redis.
+	eventsStreamMaxLen = 100000
+
+	readCount   = 100
+	readBlock   = 5 * time.Second
+	maxBackoff  = 10 * time.Second
+	cleanPeriod = 10 * time.Minute
+	// groupMaxIdle is the duration after which the consumer group of a stack
+	// that no longer reads the stream is destroyed.
+	groupMaxIdle = time.Hour
+
+	// instanceQueueSize is the maximal number of events waiting to be
+	// dispatched for an instance. When an instance has too many events (or
+	// too slow subscribers), the next events for it are dropped, and the
+	// other instances are not impacted.
+	instanceQueueSize = 1000
+	instanceQueueIdle = time.Minute
+)
 
 type redisHub struct {
 	c        redis.UniversalClient
 	ctx      context.Context
 	mem      *memHub
 	firehose *topic
+	group    string
+	consumer string
+
+	queuesMu sync.Mutex
+	queues   map[string]chan *jsonEvent // by DB prefix
 }
 
 func newRedisHub(c redis.UniversalClient) *redisHub {
 	ctx := context.Background()
 	firehose := newTopic()
 	mem := newMemHub()
-	hub := &redisHub{c, ctx, mem, firehose}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "stack"
+	}
+	hub := &redisHub{
+		c:        c,
+		ctx:      ctx,
+		mem:      mem,
+		firehose: firehose,
+		group:    hostname + "-" + utils.RandomString(8),
+		consumer: hostname,
+		queues:   make(map[string]chan *jsonEvent),
+	}
+	if err := hub.createGroup(); err != nil {
+		logger.WithNamespace("realtime-redis").
+			Warnf("Cannot create the consumer group: %s", err)
+	}
 	go hub.start()
 	return hub
 }
@@ -68,12 +118,13 @@ func toJSONDoc(d map[string]interface{}) *JSONDoc {
 }
 
 type jsonEvent struct {
-	Cluster int
-	Domain  string
-	Prefix  string
-	Verb    string
-	Doc     *JSONDoc
-	Old     *JSONDoc
+	Cluster   int
+	Domain    string
+	Prefix    string
+	Verb      string
+	Doc       *JSONDoc
+	Old       *JSONDoc
+	Coalesced bool
 }
 
 func (j *jsonEvent) UnmarshalJSON(buf []byte) error {
@@ -87,6 +138,7 @@ func (j *jsonEvent) UnmarshalJSON(buf []byte) error {
 	j.Domain, _ = m["domain"].(string)
 	j.Prefix, _ = m["prefix"].(string)
 	j.Verb, _ = m["verb"].(string)
+	j.Coalesced, _ = m["coalesced"].(bool)
 	if doc, ok := m["doc"].(map[string]interface{}); ok {
 		j.Doc = toJSONDoc(doc)
 	}
@@ -96,38 +148,181 @@ func (j *jsonEvent) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
+// createGroup creates the consumer group of this stack. It starts with the
+// events published after its creation.
+func (h *redisHub) createGroup() error {
+	err := h.c.XGroupCreateMkStream(h.ctx, eventsStreamKey, h.group, "$").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
 func (h *redisHub) start() {
-	sub := h.c.Subscribe(h.ctx, eventsRedisKey)
 	log := logger.WithNamespace("realtime-redis")
-	for msg := range sub.Channel() {
-		parts := strings.SplitN(msg.Payload, ",", 2)
-		if len(parts) < 2 {
-			log.Warnf("Invalid payload: %s", msg.Payload)
+	backoff := 100 * time.Millisecond
+	lastClean := time.Time{}
+	for {
+		if time.Since(lastClean) > cleanPeriod {
+			h.cleanGroups()
+			lastClean = time.Now()
+		}
+
+		// The consumer group keeps the position of the last event read by this
+		// stack. After a disconnection, the next read will start just after
+		// it, and the missed events will be replayed.
+		streams, err := h.c.XReadGroup(h.ctx, &redis.XReadGroupArgs{
+			Group:    h.group,
+			Consumer: h.consumer,
+			Streams:  []string{eventsStreamKey, ">"},
+			Count:    readCount,
+			Block:    readBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			log.Warnf("Error on read: %s", err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// The stream or the group has been lost, for example when
+				// redis is restarted without persistence.
+				if err := h.createGroup(); err != nil {
+					log.Warnf("Cannot create the consumer group: %s", err)
+				}
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+
+		for _, stream := range streams {
+			ids := make([]string, 0, len(stream.Messages))
+			for _, msg := range stream.Messages {
+				ids = append(ids, msg.ID)
+				payload, _ := msg.Values["event"].(string)
+				je, err := parsePayload(payload)
+				if err != nil {
+					log.Warnf("Invalid payload %q: %s", payload, err)
+					continue
+				}
+				h.dispatch(je)
+			}
+			if len(ids) > 0 {
+				if err := h.c.XAck(h.ctx, eventsStreamKey, h.group, ids...).Err(); err != nil {
+					log.Warnf("Error on ack: %s", err)
+				}
+			}
+		}
+	}
+}
+
+func parsePayload(payload string) (*jsonEvent, error) {
+	parts := strings.SplitN(payload, ",", 2)
+	if len(parts) < 2 {
+		return nil, errors.New("no doctype")
+	}
+	// We clone the doctype to allow the GC to collect the payload even if
+	// the jsonEvent is still in use.
+	doctype := strings.Clone(parts[0])
+	r := strings.NewReader(parts[1])
+	je := jsonEvent{}
+	if err := json.NewDecoder(r).Decode(&je); err != nil {
+		return nil, err
+	}
+	if je.Doc != nil {
+		je.Doc.Type = doctype
+	}
+	if je.Old != nil {
+		je.Old.Type = doctype
+	}
+	return &je, nil
+}
+
+// dispatch sends the event to the queue of its instance, that forwards it to
+// the mem hub. The queue is bounded: if it is full, the event is dropped.
+func (h *redisHub) dispatch(je *jsonEvent) {
+	db := prefixer.NewPrefixer(je.Cluster, je.Domain, je.Prefix)
+	key := db.DBPrefix()
+
+	h.queuesMu.Lock()
+	defer h.queuesMu.Unlock()
+	queue, ok := h.queues[key]
+	if !ok {
+		queue = make(chan *jsonEvent, instanceQueueSize)
+		h.queues[key] = queue
+		go h.forward(key, queue)
+	}
+	select {
+	case queue <- je:
+	default:
+		logger.WithDomain(je.Domain).WithNamespace("realtime-redis").
+			Warnf("Too many events, dropping a %s event", je.Verb)
+	}
+}
+
+func (h *redisHub) forward(key string, queue chan *jsonEvent) {
+	timer := time.NewTimer(instanceQueueIdle)
+	defer timer.Stop()
+	for {
+		select {
+		case je := <-queue:
+			db := prefixer.NewPrefixer(je.Cluster, je.Domain, je.Prefix)
+			e := newEvent(db, je.Verb, je.Doc, je.Old)
+			e.Coalesced = je.Coalesced
+			h.mem.publish(e)
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(instanceQueueIdle)
+		case <-timer.C:
+			h.queuesMu.Lock()
+			if len(queue) == 0 {
+				delete(h.queues, key)
+				h.queuesMu.Unlock()
+				return
+			}
+			h.queuesMu.Unlock()
+			timer.Reset(instanceQueueIdle)
+		}
+	}
+}
+
+// cleanGroups destroys the consumer groups of the stacks that have stopped,
+// so that redis doesn't keep track of them forever.
+func (h *redisHub) cleanGroups() {
+	groups, err := h.c.XInfoGroups(h.ctx, eventsStreamKey).Result()
+	if err != nil {
+		return
+	}
+	for _, group := range groups {
+		if group.Name == h.group || group.Consumers == 0 {
 			continue
 		}
-		// We clone the doctype to allow the GC to collect the payload even if
-		// the jsonEvent is still in use.
-		doctype := strings.Clone(parts[0])
-		r := strings.NewReader(parts[1])
-		je := jsonEvent{}
-		if err := json.NewDecoder(r).Decode(&je); err != nil {
-			log.Warnf("Error on start: %s", err)
+		consumers, err := h.c.XInfoConsumers(h.ctx, eventsStreamKey, group.Name).Result()
+		if err != nil {
 			continue
 		}
-		if je.Doc != nil {
-			je.Doc.Type = doctype
+		idle := true
+		for _, consumer := range consumers {
+			if consumer.Idle < groupMaxIdle {
+				idle = false
+			}
 		}
-		if je.Old != nil {
-			je.Old.Type = doctype
+		if idle {
+			h.c.XGroupDestroy(h.ctx, eventsStreamKey, group.Name)
 		}
-		db := prefixer.NewPrefixer(je.Cluster, je.Domain, je.Prefix)
-		h.mem.Publish(db, je.Verb, je.Doc, je.Old)
 	}
-	logger.WithNamespace("realtime-redis").Infof("End of subscribe channel")
 }
 
 func (h *redisHub) Publish(db prefixer.Prefixer, verb string, doc, oldDoc Doc) {
-	e := newEvent(db, verb, doc, oldDoc)
+	h.publish(newEvent(db, verb, doc, oldDoc))
+}
+
+func (h *redisHub) publish(e *Event) {
 	h.firehose.broadcast <- e
 	buf, err := json.Marshal(e)
 	if err != nil {
@@ -135,7 +330,16 @@ func (h *redisHub) Publish(db prefixer.Prefixer, verb string, doc, oldDoc Doc) {
 		log.Warnf("Error on publish: %s", err)
 		return
 	}
-	h.c.Publish(h.ctx, eventsRedisKey, e.Doc.DocType()+","+string(buf))
+	err = h.c.XAdd(h.ctx, &redis.XAddArgs{
+		Stream: eventsStreamKey,
+		MaxLen: eventsStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": e.Doc.DocType() + "," + string(buf)},
+	}).Err()
+	if err != nil {
+		log := logger.WithNamespace("realtime-redis")
+		log.Warnf("Error on publish: %s", err)
+	}
 }
 
 func (h *redisHub) Subscriber(db prefixer.Prefixer) *Subscriber {
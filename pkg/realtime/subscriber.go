@@ -10,6 +10,7 @@ type Subscriber struct {
 	Channel EventsChan
 	hub     Hub
 	running chan struct{}
+	bulk    bool
 }
 
 // EventsChan is a chan of events
@@ -24,6 +25,13 @@ func newSubscriber(hub Hub, db prefixer.Prefixer) *Subscriber {
 	}
 }
 
+// EnableBulkEvents tells that the subscriber wants to receive the bulk events
+// instead of the events for each document changed by a bulk operation. It must
+// be called before subscribing to the doctypes.
+func (sub *Subscriber) EnableBulkEvents() {
+	sub.bulk = true
+}
+
 // Subscribe adds a listener for events on a whole doctype
 func (sub *Subscriber) Subscribe(doctype string) {
 	if sub.hub == nil {
@@ -50,22 +50,27 @@ func (t *topic) loop() {
 
 func (t *topic) publish(e *Event) {
 	for s, f := range t.subs {
-		ok := false
-		if f.whole {
-			ok = true
-		} else {
-			for _, id := range f.ids {
-				if e.Doc.ID() == id {
-					ok = true
-					break
+		ev := e
+		if e.Verb == EventBulk {
+			if !s.bulk {
+				continue
+			}
+			if !f.whole {
+				if ev = filterBulkEvent(e, f.ids); ev == nil {
+					continue
 				}
 			}
-		}
-		if ok {
-			select {
-			case s.Channel <- e:
-			case <-s.running: // the subscriber has been closed
+		} else {
+			if e.Coalesced && s.bulk {
+				continue
 			}
+			if !f.whole && !matchIDs(e, f.ids) {
+				continue
+			}
+		}
+		select {
+		case s.Channel <- ev:
+		case <-s.running: // the subscriber has been closed
 		}
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"syscall"
 	"time"
 
@@ -62,6 +63,45 @@ var ClientWithKeepAlive = &http.Client{
 	Transport: transportWithKeepAlive,
 }
 
+// ClientOptions can be used to tune the connection pool of a client made with
+// NewClient.
+type ClientOptions struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	Timeout             time.Duration
+	HTTP2               bool
+	// Proxy is the URL of the proxy. If it is nil, the proxy is taken from the
+	// environment variables.
+	Proxy *url.URL
+}
+
+// NewClient returns an http client that can be used to avoid SSRF, with
+// keep-alive, and a connection pool configured with the given options. The
+// typical use case is the requests between instances.
+func NewClient(opts ClientOptions) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != nil {
+		proxy = http.ProxyURL(opts.Proxy)
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           safeDialer.DialContext,
+		ForceAttemptHTTP2:     opts.HTTP2,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+	}
+}
+
 func safeControl(network string, address string, conn syscall.RawConn) error {
 	if !(network == "tcp4" || network == "tcp6") {
 		return fmt.Errorf("%s is not a safe network type", network)
@@ -0,0 +1,114 @@
+// Package secrets is used to fetch the secrets of the configuration, like the
+// SMTP and CouchDB credentials or the API keys, from HashiCorp Vault or from
+// files encrypted with SOPS, so that they are not kept in plain text in the
+// configuration files.
+package secrets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultSopsCmd is the command used to decrypt the SOPS files.
+const DefaultSopsCmd = "sops"
+
+// Resolver fetches the secrets and keeps them in memory, so that a Vault
+// path or a SOPS file is read only once, even if several secrets are taken
+// from it. Flush can be called to fetch fresh values, when the secrets have
+// been rotated.
+type Resolver struct {
+	// SopsCmd is the command used to decrypt the SOPS files.
+	SopsCmd string
+
+	mu    sync.Mutex
+	vault *VaultClient
+	paths map[string]map[string]interface{}
+	files map[string]map[string]interface{}
+}
+
+// NewResolver returns a resolver with an empty cache.
+func NewResolver() *Resolver {
+	return &Resolver{
+		SopsCmd: DefaultSopsCmd,
+		paths:   make(map[string]map[string]interface{}),
+		files:   make(map[string]map[string]interface{}),
+	}
+}
+
+// Flush empties the cache of the resolver.
+func (r *Resolver) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths = make(map[string]map[string]interface{})
+	r.files = make(map[string]map[string]interface{})
+}
+
+// Vault returns the value for the given key of the secret at the given path
+// in HashiCorp Vault. The address and the token of Vault are taken from the
+// usual VAULT_ADDR and VAULT_TOKEN environment variables.
+func (r *Resolver) Vault(path, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.paths[path]
+	if !ok {
+		if r.vault == nil {
+			client, err := NewVaultClientFromEnv()
+			if err != nil {
+				return "", err
+			}
+			r.vault = client
+		}
+		var err error
+		data, err = r.vault.Read(path)
+		if err != nil {
+			return "", err
+		}
+		r.paths[path] = data
+	}
+	return lookup(data, key, "vault:"+path)
+}
+
+// Sops returns the value for the given key of a file encrypted with SOPS. The
+// key can be a dotted path for the nested values, like "mail.password".
+func (r *Resolver) Sops(file, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.files[file]
+	if !ok {
+		var err error
+		data, err = decryptSopsFile(r.SopsCmd, file)
+		if err != nil {
+			return "", err
+		}
+		r.files[file] = data
+	}
+	return lookup(data, key, "sops:"+file)
+}
+
+// lookup returns the value for a dotted key in the data of a secret.
+func lookup(data map[string]interface{}, key, source string) (string, error) {
+	var value interface{} = data
+	for _, part := range strings.Split(key, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("secrets: %s has no key %q", source, key)
+		}
+		value, ok = obj[part]
+		if !ok {
+			return "", fmt.Errorf("secrets: %s has no key %q", source, key)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("secrets: the value of %q in %s is not a scalar", key, source)
+}
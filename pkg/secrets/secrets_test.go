@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecrets(t *testing.T) {
+	t.Run("Vault", func(t *testing.T) {
+		calls := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if r.Header.Get("X-Vault-Token") != "s.token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			switch r.URL.Path {
+			case "/v1/secret/data/cozy/smtp":
+				_, _ = w.Write([]byte(`{"data":{"data":{"password":"p4ss","port":587},"metadata":{"version":3}}}`))
+			case "/v1/kv/cozy/fcm":
+				_, _ = w.Write([]byte(`{"data":{"api_key":"AIza"}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer ts.Close()
+		t.Setenv("VAULT_ADDR", ts.URL+"/")
+		t.Setenv("VAULT_TOKEN", "s.token")
+
+		r := NewResolver()
+		value, err := r.Vault("secret/data/cozy/smtp", "password")
+		require.NoError(t, err)
+		assert.Equal(t, "p4ss", value)
+		value, err = r.Vault("secret/data/cozy/smtp", "port")
+		require.NoError(t, err)
+		assert.Equal(t, "587", value)
+		assert.Equal(t, 1, calls)
+
+		value, err = r.Vault("/kv/cozy/fcm", "api_key")
+		require.NoError(t, err)
+		assert.Equal(t, "AIza", value)
+
+		_, err = r.Vault("secret/data/cozy/smtp", "username")
+		assert.Error(t, err)
+		_, err = r.Vault("secret/data/cozy/unknown", "password")
+		assert.Error(t, err)
+
+		r.Flush()
+		_, err = r.Vault("secret/data/cozy/smtp", "password")
+		require.NoError(t, err)
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("VaultNotConfigured", func(t *testing.T) {
+		t.Setenv("VAULT_ADDR", "")
+		_, err := NewResolver().Vault("secret/data/cozy/smtp", "password")
+		assert.Equal(t, ErrVaultNotConfigured, err)
+	})
+
+	t.Run("Sops", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("The fake sops command is a shell script")
+		}
+		dir := t.TempDir()
+		file := filepath.Join(dir, "secrets.json")
+		require.NoError(t, os.WriteFile(file, []byte(`{"mail":{"password":"s3cr3t"},"debug":true}`), 0600))
+		cmd := filepath.Join(dir, "sops")
+		require.NoError(t, os.WriteFile(cmd, []byte("#!/bin/sh\ncat \"$4\"\n"), 0700))
+
+		r := NewResolver()
+		r.SopsCmd = cmd
+		value, err := r.Sops(file, "mail.password")
+		require.NoError(t, err)
+		assert.Equal(t, "s3cr3t", value)
+		value, err = r.Sops(file, "debug")
+		require.NoError(t, err)
+		assert.Equal(t, "true", value)
+		_, err = r.Sops(file, "mail")
+		assert.Error(t, err)
+		_, err = r.Sops(filepath.Join(dir, "missing.json"), "mail.password")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,28 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// decryptSopsFile runs sops to decrypt the given file, and returns its
+// content. The keys for the decryption are found by sops as usual (age or
+// PGP keys, cloud KMS, etc.).
+func decryptSopsFile(cmd, file string) (map[string]interface{}, error) {
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(cmd, "--decrypt", "--output-type", "json", file)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("secrets: cannot decrypt %s with sops: %w (%s)",
+			file, err, strings.TrimSpace(stderr.String()))
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &data); err != nil {
+		return nil, fmt.Errorf("secrets: invalid output of sops for %s: %w", file, err)
+	}
+	return data, nil
+}
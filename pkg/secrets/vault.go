@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrVaultNotConfigured is returned when a secret is read from Vault, but the
+// address of Vault has not been given.
+var ErrVaultNotConfigured = errors.New("secrets: VAULT_ADDR is not set")
+
+// VaultClient is a minimal client for reading the secrets of the KV secrets
+// engines (version 1 and 2) of HashiCorp Vault.
+type VaultClient struct {
+	Address   string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// NewVaultClientFromEnv returns a client configured with the same
+// environment variables as the vault CLI: VAULT_ADDR, VAULT_TOKEN and
+// VAULT_NAMESPACE. When VAULT_TOKEN is not set, the token is read from the
+// ~/.vault-token file, like the vault CLI and the vault agent do.
+func NewVaultClientFromEnv() (*VaultClient, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, ErrVaultNotConfigured
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if buf, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(buf))
+			}
+		}
+	}
+	return &VaultClient{
+		Address:   strings.TrimSuffix(addr, "/"),
+		Token:     token,
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Read returns the data of the secret at the given path. For the version 2
+// of the KV secrets engine, the path must include the data/ segment, like
+// secret/data/cozy/smtp.
+func (c *VaultClient) Read(path string) (map[string]interface{}, error) {
+	path = strings.Trim(path, "/")
+	req, err := http.NewRequest(http.MethodGet, c.Address+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Vault-Token", c.Token)
+	}
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: cannot read %s from vault: %w", path, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secrets: cannot read %s from vault: status %d", path, res.StatusCode)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("secrets: invalid response from vault for %s: %w", path, err)
+	}
+
+	// With the version 2 of the KV secrets engine, the secret is wrapped in
+	// a data field, next to its metadata.
+	if data, ok := body.Data["data"].(map[string]interface{}); ok {
+		if _, ok := body.Data["metadata"].(map[string]interface{}); ok {
+			return data, nil
+		}
+	}
+	return body.Data, nil
+}
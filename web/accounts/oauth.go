@@ -244,6 +244,35 @@ func refresh(c echo.Context) error {
 	return jsonapi.Data(c, http.StatusOK, &apiAccount{&acc}, nil)
 }
 
+// aggregator is an internal route used by konnectors to get the secrets of
+// the aggregator account shared with other konnectors, in the scope declared
+// in their manifest. It requires permissions GET:io.cozy.accounts:accountid.
+func aggregator(c echo.Context) error {
+	instance := middlewares.GetInstance(c)
+	accountid := c.Param("accountid")
+
+	var acc account.Account
+	if err := couchdb.GetDoc(instance, consts.Accounts, accountid, &acc); err != nil {
+		return err
+	}
+
+	if err := middlewares.Allow(c, permission.GET, &acc); err != nil {
+		return err
+	}
+
+	view, err := account.GetAggregatorView(instance, &acc)
+	switch {
+	case errors.Is(err, account.ErrNoAggregator):
+		return jsonapi.NotFound(err)
+	case errors.Is(err, account.ErrAggregatorMismatch):
+		return jsonapi.Forbidden(err)
+	case err != nil:
+		return err
+	}
+
+	return jsonapi.Data(c, http.StatusOK, &apiAccount{view}, nil)
+}
+
 // manage redirects the user to the BI webview allowing them to manage their
 // bank connections
 func manage(c echo.Context) error {
@@ -405,5 +434,6 @@ func Routes(router *echo.Group) {
 	router.GET("/:accountType/redirect", redirect)
 	router.GET("/:accountType/:accountid/manage", manage, middlewares.NeedInstance, middlewares.LoadSession, checkLogin)
 	router.POST("/:accountType/:accountid/refresh", refresh, middlewares.NeedInstance)
+	router.GET("/:accountType/:accountid/aggregator", aggregator, middlewares.NeedInstance)
 	router.GET("/:accountType/:accountid/reconnect", reconnect, middlewares.NeedInstance, middlewares.LoadSession, checkLogin)
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/cozy/cozy-stack/model/oauth"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/session"
+	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/appfs"
 	build "github.com/cozy/cozy-stack/pkg/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
@@ -823,6 +824,7 @@ func WebappsRoutes(router *echo.Group) {
 // KonnectorRoutes sets the routing for the konnectors service
 func KonnectorRoutes(router *echo.Group) {
 	router.GET("/", listKonnectorsHandler)
+	router.GET("/_summaries", getKonnectorSummaries)
 	router.GET("/:slug", getHandler(consts.KonnectorType))
 	router.POST("/:slug", installHandler(consts.KonnectorType))
 	router.PUT("/:slug", updateHandler(consts.KonnectorType))
@@ -832,6 +834,7 @@ func KonnectorRoutes(router *echo.Group) {
 	router.POST("/:slug/trigger", createTrigger)
 	router.GET("/:slug/download", downloadHandler(consts.KonnectorType))
 	router.GET("/:slug/download/:version", downloadHandler(consts.KonnectorType))
+	router.GET("/:slug/logs", getKonnectorLogs)
 	router.POST("/:slug/logs", logsHandler(consts.KonnectorType))
 }
 
@@ -855,6 +858,8 @@ func wrapAppsError(err error) error {
 		return jsonapi.BadRequest(err)
 	case app.ErrLinkedAppExists:
 		return jsonapi.BadRequest(err)
+	case app.ErrInvalidCSPPolicy:
+		return jsonapi.InvalidAttribute("sources", err)
 	case limits.ErrRateLimitReached,
 		limits.ErrRateLimitExceeded:
 		return jsonapi.BadRequest(err)
@@ -862,5 +867,8 @@ func wrapAppsError(err error) error {
 	if _, ok := err.(*url.Error); ok {
 		return jsonapi.InvalidParameter("Source", err)
 	}
+	if _, ok := err.(*vfs.CustomMetadataError); ok {
+		return jsonapi.InvalidAttribute("custom_metadata", err)
+	}
 	return err
 }
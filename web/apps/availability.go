@@ -0,0 +1,68 @@
+package apps
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/app"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+type apiAvailability struct {
+	Slug           string             `json:"slug"`
+	Unavailability app.Unavailability `json:"unavailability"`
+}
+
+func (a *apiAvailability) ID() string                             { return a.Slug }
+func (a *apiAvailability) Rev() string                            { return "" }
+func (a *apiAvailability) DocType() string                        { return consts.KonnectorsAvailability }
+func (a *apiAvailability) Clone() couchdb.Doc                     { cloned := *a; return &cloned }
+func (a *apiAvailability) SetID(_ string)                         {}
+func (a *apiAvailability) SetRev(_ string)                        {}
+func (a *apiAvailability) Relationships() jsonapi.RelationshipMap { return nil }
+func (a *apiAvailability) Included() []jsonapi.Object             { return nil }
+func (a *apiAvailability) Links() *jsonapi.LinksList              { return nil }
+
+// apiAvailability is a jsonapi.Object
+var _ jsonapi.Object = (*apiAvailability)(nil)
+
+func listAvailability(c echo.Context) error {
+	list, err := app.ListAvailabilityOverrides()
+	if err != nil {
+		return err
+	}
+	objs := make([]jsonapi.Object, 0, len(list))
+	for slug, windows := range list {
+		objs = append(objs, &apiAvailability{Slug: slug, Unavailability: windows})
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+}
+
+func setAvailability(c echo.Context) error {
+	slug := c.Param("slug")
+	var attrs apiAvailability
+	if _, err := jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return err
+	}
+	if err := attrs.Unavailability.Validate(); err != nil {
+		return jsonapi.InvalidAttribute("unavailability", err)
+	}
+	if err := app.SetAvailabilityOverride(slug, attrs.Unavailability); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func deleteAvailability(c echo.Context) error {
+	slug := c.Param("slug")
+	if err := app.DeleteAvailabilityOverride(slug); err != nil {
+		if errors.Is(err, app.ErrNotFound) {
+			return jsonapi.NotFound(err)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package apps
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/app"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+func listCSPPolicies(c echo.Context) error {
+	policies, err := app.ListCSPPolicies()
+	if err != nil {
+		return wrapAppsError(err)
+	}
+	return c.JSON(http.StatusOK, policies)
+}
+
+func getCSPPolicy(c echo.Context) error {
+	policy, err := app.GetCSPPolicy(c.QueryParam("Context"), c.Param("slug"))
+	if err != nil {
+		return wrapAppsError(err)
+	}
+	if policy == nil {
+		return jsonapi.NotFound(app.ErrNotFound)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+func putCSPPolicy(c echo.Context) error {
+	var sources map[string][]string
+	if err := json.NewDecoder(c.Request().Body).Decode(&sources); err != nil {
+		return jsonapi.BadJSON()
+	}
+	policy := &app.CSPPolicy{
+		Slug:    c.Param("slug"),
+		Context: c.QueryParam("Context"),
+		Sources: sources,
+	}
+	if err := app.SaveCSPPolicy(policy); err != nil {
+		return wrapAppsError(err)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+func deleteCSPPolicy(c echo.Context) error {
+	if err := app.DeleteCSPPolicy(c.QueryParam("Context"), c.Param("slug")); err != nil {
+		return wrapAppsError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CSPAdminRoutes sets the routing for the admin interface to configure the
+// sources added to the Content-Security-Policy of the webapps.
+func CSPAdminRoutes(router *echo.Group) {
+	router.GET("", listCSPPolicies)
+	router.GET("/:slug", getCSPPolicy)
+	router.PUT("/:slug", putCSPPolicy)
+	router.DELETE("/:slug", deleteCSPPolicy)
+}
@@ -0,0 +1,124 @@
+package apps
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/model/konnectorlog"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultRunsLimit  = 20
+	maxRunsLimit      = 100
+	defaultLinesLimit = 100
+	maxLinesLimit     = konnectorlog.MaxLines
+)
+
+type apiRun struct {
+	*konnectorlog.Run
+}
+
+// Links is part of the jsonapi.Object interface
+func (r *apiRun) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{
+		Self: "/konnectors/" + r.Slug + "/logs?job_id=" + url.QueryEscape(r.DocID),
+	}
+}
+
+// Relationships is part of the jsonapi.Object interface
+func (r *apiRun) Relationships() jsonapi.RelationshipMap { return nil }
+
+// Included is part of the jsonapi.Object interface
+func (r *apiRun) Included() []jsonapi.Object { return nil }
+
+var _ jsonapi.Object = (*apiRun)(nil)
+
+// getKonnectorLogs handles the GET /konnectors/:slug/logs requests. Without
+// the job_id parameter, it returns the executions of the konnector, from the
+// most recent to the oldest. With it, it returns the lines of log of this
+// execution.
+func getKonnectorLogs(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.KonnectorsLogs); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	slug := c.Param("slug")
+
+	jobID := c.QueryParam("job_id")
+	if jobID == "" {
+		limit, err := pageLimit(c, defaultRunsLimit, maxRunsLimit)
+		if err != nil {
+			return err
+		}
+		runs, bookmark, err := konnectorlog.List(inst, slug, c.QueryParam("page[cursor]"), limit)
+		if err != nil {
+			return err
+		}
+		var links jsonapi.LinksList
+		if bookmark != "" {
+			links.Next = "/konnectors/" + slug + "/logs?page[cursor]=" + url.QueryEscape(bookmark) +
+				"&page[limit]=" + strconv.Itoa(limit)
+		}
+		objs := make([]jsonapi.Object, len(runs))
+		for i, run := range runs {
+			objs[i] = &apiRun{run}
+		}
+		return jsonapi.DataList(c, http.StatusOK, objs, &links)
+	}
+
+	limit, err := pageLimit(c, defaultLinesLimit, maxLinesLimit)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	if cursor := c.QueryParam("page[cursor]"); cursor != "" {
+		offset, err = strconv.Atoi(cursor)
+		if err != nil || offset < 0 {
+			return jsonapi.InvalidParameter("page[cursor]", errors.New("invalid cursor"))
+		}
+	}
+	run, err := konnectorlog.Get(inst, slug, jobID)
+	if couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err) {
+		return jsonapi.NotFound(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	links := jsonapi.LinksList{}
+	if offset > len(run.Lines) {
+		offset = len(run.Lines)
+	}
+	end := offset + limit
+	if end < len(run.Lines) {
+		links.Next = "/konnectors/" + slug + "/logs?job_id=" + url.QueryEscape(jobID) +
+			"&page[cursor]=" + strconv.Itoa(end) + "&page[limit]=" + strconv.Itoa(limit)
+	} else {
+		end = len(run.Lines)
+	}
+	run.Lines = run.Lines[offset:end]
+	return jsonapi.Data(c, http.StatusOK, &apiRun{run}, &links)
+}
+
+func pageLimit(c echo.Context, defaultLimit, maxLimit int) (int, error) {
+	param := c.QueryParam("page[limit]")
+	if param == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(param)
+	if err != nil || limit <= 0 {
+		return 0, jsonapi.InvalidParameter("page[limit]", errors.New("invalid limit"))
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, nil
+}
@@ -85,9 +85,15 @@ func deactivateMaintenance(c echo.Context) error {
 }
 
 // AdminRoutes sets the routing for the admin interface to configure
-// maintenance for the konnectors.
+// maintenance and the availability of the providers for the konnectors.
 func AdminRoutes(router *echo.Group) {
 	router.GET("/maintenance", listMaintenance)
 	router.PUT("/maintenance/:slug", activateMaintenance)
 	router.DELETE("/maintenance/:slug", deactivateMaintenance)
+
+	router.GET("/availability", listAvailability)
+	router.PUT("/availability/:slug", setAvailability)
+	router.DELETE("/availability/:slug", deleteAvailability)
+
+	router.GET("/telemetry", getTelemetry)
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/session"
 	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/model/shareanalytics"
 	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/cozy-stack/pkg/appfs"
 	"github.com/cozy/cozy-stack/pkg/assets"
@@ -142,6 +143,24 @@ func handleIntent(c echo.Context, i *instance.Instance, slug, intentID string) {
 	middlewares.AppendCSPRule(c, "frame-ancestors", from)
 }
 
+// handleCSPPolicy adds to the CSP headers the sources allowed for this webapp
+// by the config file or by the CSP policies of the stack.
+func handleCSPPolicy(c echo.Context, i *instance.Instance, slug string) {
+	if config.GetConfig().CSPDisabled {
+		return
+	}
+	rules, err := app.CSPRulesFor(i.ContextName, slug)
+	if err != nil {
+		i.Logger().WithNamespace("apps").Warnf("Cannot load the CSP policy of %s: %s", slug, err)
+		return
+	}
+	for ruleType, sources := range rules {
+		if len(sources) > 0 {
+			middlewares.ExtendCSPRule(c, ruleType, sources...)
+		}
+	}
+}
+
 // ServeAppFile will serve the requested file using the specified application
 // manifest and appfs.FileServer context.
 //
@@ -251,6 +270,7 @@ func ServeAppFile(c echo.Context, i *instance.Instance, fs appfs.FileServer, web
 	if intentID := c.QueryParam("intent"); intentID != "" {
 		handleIntent(c, i, slug, intentID)
 	}
+	handleCSPPolicy(c, i, slug)
 
 	// For index file, we inject the locale, the stack domain, and a token if the
 	// user is connected
@@ -380,6 +400,21 @@ func getServeToken(
 	// same link to work (and be upgraded) after the user has accepted the
 	// sharing.
 	token, pdoc, err := permission.GetTokenAndPermissionsFromShortcode(inst, sharecode)
+	if !isLoggedIn {
+		// Opening the link counts as a use of the code, for the codes with
+		// a maximal number of uses. If the use can't be counted, the code is
+		// not given to the app.
+		code := sharecode
+		if err == nil {
+			code = token
+		}
+		if errc := permission.ConsumeShareCode(inst, code); errc != nil {
+			return ""
+		}
+	}
+	if err == nil && !isLoggedIn {
+		shareanalytics.Record(inst, pdoc, middlewares.ClientIP(c), c.Request().UserAgent())
+	}
 	if err != nil || pdoc.Type != permission.TypeSharePreview {
 		return sharecode
 	}
@@ -0,0 +1,72 @@
+package apps
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/model/konnectorsummary"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSummariesLimit = 20
+	maxSummariesLimit     = 100
+)
+
+type apiSummary struct {
+	*konnectorsummary.Summary
+}
+
+// Links is part of the jsonapi.Object interface
+func (s *apiSummary) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{
+		Related: "/konnectors/" + s.Slug + "/logs?job_id=" + url.QueryEscape(s.DocID),
+	}
+}
+
+// Relationships is part of the jsonapi.Object interface
+func (s *apiSummary) Relationships() jsonapi.RelationshipMap { return nil }
+
+// Included is part of the jsonapi.Object interface
+func (s *apiSummary) Included() []jsonapi.Object { return nil }
+
+var _ jsonapi.Object = (*apiSummary)(nil)
+
+// getKonnectorSummaries handles the GET /konnectors/_summaries requests. It
+// returns the summaries of the executions of the konnectors, from the most
+// recent to the oldest, for the timeline of the Home app.
+func getKonnectorSummaries(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.KonnectorsSummaries); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	limit, err := pageLimit(c, defaultSummariesLimit, maxSummariesLimit)
+	if err != nil {
+		return err
+	}
+	accountID := c.QueryParam("filter[account]")
+
+	summaries, bookmark, err := konnectorsummary.List(inst, accountID, c.QueryParam("page[cursor]"), limit)
+	if err != nil {
+		return err
+	}
+	var links jsonapi.LinksList
+	if bookmark != "" {
+		next := "/konnectors/_summaries?page[cursor]=" + url.QueryEscape(bookmark) +
+			"&page[limit]=" + strconv.Itoa(limit)
+		if accountID != "" {
+			next += "&filter[account]=" + url.QueryEscape(accountID)
+		}
+		links.Next = next
+	}
+	objs := make([]jsonapi.Object, len(summaries))
+	for i, summary := range summaries {
+		objs[i] = &apiSummary{summary}
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, &links)
+}
@@ -0,0 +1,18 @@
+package apps
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/konnectortelemetry"
+	"github.com/labstack/echo/v4"
+)
+
+// getTelemetry is used by the administrators to inspect the report about the
+// executions of the konnectors that would be sent to the apps registry.
+func getTelemetry(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{
+		"enabled": konnectortelemetry.Enabled(),
+		"url":     konnectortelemetry.ReportURL(),
+		"report":  konnectortelemetry.Preview(),
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/cozy/cozy-stack/model/instance/lifecycle"
 	"github.com/cozy/cozy-stack/model/session"
 	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/model/usage"
 	build "github.com/cozy/cozy-stack/pkg/config"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/crypto"
@@ -273,6 +274,7 @@ func newSession(c echo.Context, inst *instance.Instance, redirect *url.URL, dura
 	if err = session.StoreNewLoginEntry(inst, sessionID, clientID, c.Request(), logMessage, true); err != nil {
 		inst.Logger().Errorf("Could not store session history %q: %s", sessionID, err)
 	}
+	usage.EnsureTrigger(inst)
 
 	return nil
 }
@@ -616,6 +618,9 @@ func Routes(router *echo.Group) {
 	router.POST("/access_token", accessToken)
 	router.POST("/secret_exchange", secretExchange)
 
+	// Support access
+	router.GET("/support", loginWithSupportCode, noCSRF)
+
 	// Flagship app
 	router.POST("/session_code", CreateSessionCode)
 	router.POST("/tokens/konnectors/:slug", buildKonnectorToken)
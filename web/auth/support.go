@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/session"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// loginWithSupportCode opens a session for an operator of the support, with
+// the code minted from the admin API. The user must have granted an access to
+// the support from the settings.
+func loginWithSupportCode(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	sess, err := session.NewSupportSession(inst, c.QueryParam("code"))
+	if err != nil {
+		return renderError(c, http.StatusBadRequest, "Error Invalid magic link")
+	}
+	cookie, err := sess.ToCookie()
+	if err != nil {
+		return err
+	}
+	c.SetCookie(cookie)
+
+	req := c.Request()
+	if err = session.StoreNewLoginEntry(inst, sess.ID(), "", req, "support", false); err != nil {
+		inst.Logger().Errorf("Could not store session history %q: %s", sess.ID(), err)
+	}
+	actor := audit.Actor{Kind: audit.ActorSupport, ID: sess.SupportOperator, IP: middlewares.ClientIP(c)}
+	audit.Record(inst, audit.ActionAccess, consts.SupportAccesses, sess.SupportAccessID,
+		actor, nil, map[string]interface{}{
+			"session_id": sess.ID(),
+			"read_only":  sess.ReadOnly(),
+		})
+	return c.Redirect(http.StatusSeeOther, inst.DefaultRedirection().String())
+}
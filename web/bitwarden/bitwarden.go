@@ -72,9 +72,7 @@ func SendHint(c echo.Context) error {
 func GetProfile(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenProfiles); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -92,18 +90,14 @@ func GetProfile(c echo.Context) error {
 func UpdateProfile(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenProfiles); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var data struct {
 		Hint string `json:"masterPasswordHint"`
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&data); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid JSON payload",
-		})
+		return codeInvalidPayload.JSON(c, "invalid JSON payload")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -125,9 +119,7 @@ func SetKeyPair(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	log := inst.Logger().WithNamespace("bitwarden")
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenProfiles); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var data struct {
@@ -135,9 +127,7 @@ func SetKeyPair(c echo.Context) error {
 		Public  string `json:"publicKey"`
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&data); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid JSON payload",
-		})
+		return codeInvalidPayload.JSON(c, "invalid JSON payload")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -162,15 +152,11 @@ func ChangeSecurityStamp(c echo.Context) error {
 		Hashed string `json:"masterPasswordHash"`
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&data); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid JSON payload",
-		})
+		return codeInvalidPayload.JSON(c, "invalid JSON payload")
 	}
 
 	if err := instance.CheckPassphrase(inst, []byte(data.Hashed)); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid masterPasswordHash",
-		})
+		return codeInvalidPassword.JSON(c, "invalid masterPasswordHash")
 	}
 
 	setting, err := settings.Get(inst)
@@ -189,9 +175,7 @@ func ChangeSecurityStamp(c echo.Context) error {
 func GetRevisionDate(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenProfiles); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -215,13 +199,9 @@ func GetToken(c echo.Context) error {
 	case "refresh_token":
 		return refreshToken(c)
 	case "":
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "the grant_type parameter is mandatory",
-		})
+		return codeInvalidGrantType.JSON(c, "the grant_type parameter is mandatory")
 	default:
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid grant type",
-		})
+		return codeInvalidGrantType.JSON(c, "invalid grant type")
 	}
 }
 
@@ -247,9 +227,7 @@ func getInitialCredentials(c echo.Context) error {
 
 	// Authentication
 	if err := instance.CheckPassphrase(inst, pass); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid password",
-		})
+		return codeInvalidPassword.JSON(c, "invalid password")
 	}
 
 	if inst.HasAuthMode(instance.TwoFactorMail) {
@@ -276,24 +254,18 @@ func getInitialCredentials(c echo.Context) error {
 	client.CouchID = client.ClientID
 	if _, ok := middlewares.GetSession(c); !ok {
 		if err := session.SendNewRegistrationNotification(inst, client.ClientID); err != nil {
-			return c.JSON(http.StatusInternalServerError, echo.Map{
-				"error": err.Error(),
-			})
+			return codeInternal.JSON(c, err.Error())
 		}
 	}
 
 	// Create the credentials
 	access, err := bitwarden.CreateAccessJWT(inst, client)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Can't generate access token",
-		})
+		return codeInternal.JSON(c, "Can't generate access token")
 	}
 	refresh, err := bitwarden.CreateRefreshJWT(inst, client)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Can't generate refresh token",
-		})
+		return codeInternal.JSON(c, "Can't generate refresh token")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -364,6 +336,7 @@ func checkTwoFactor(c echo.Context, inst *instance.Instance) bool {
 				_ = c.JSON(http.StatusBadRequest, echo.Map{
 					"error":             "invalid_grant",
 					"error_description": "invalid_username_or_password",
+					"code":              codeInvalidTwoFactorToken.ID,
 					"ErrorModel": map[string]string{
 						"Message": "Two-step token is invalid. Try again.",
 						"Object":  "error",
@@ -383,9 +356,7 @@ func checkTwoFactor(c echo.Context, inst *instance.Instance) bool {
 
 	email, err := inst.SettingsEMail()
 	if err != nil {
-		_ = c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		_ = codeInternal.JSON(c, err.Error())
 		return false
 	}
 	var obscured string
@@ -396,9 +367,7 @@ func checkTwoFactor(c echo.Context, inst *instance.Instance) bool {
 
 	token, err := lifecycle.SendTwoFactorPasscode(inst)
 	if err != nil {
-		_ = c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		_ = codeInternal.JSON(c, err.Error())
 		return false
 	}
 	cache.Set(key, token, 5*time.Minute)
@@ -406,6 +375,7 @@ func checkTwoFactor(c echo.Context, inst *instance.Instance) bool {
 	_ = c.JSON(http.StatusBadRequest, echo.Map{
 		"error":             "invalid_grant",
 		"error_description": "Two factor required.",
+		"code":              codeTwoFactorRequired.ID,
 		// 1 means email
 		// https://github.com/bitwarden/jslib/blob/master/common/src/enums/twoFactorProviderType.ts
 		"TwoFactorProviders": []int{1},
@@ -423,9 +393,7 @@ func refreshToken(c echo.Context) error {
 	// Check the refresh token
 	claims, ok := oauth.ValidTokenWithSStamp(inst, consts.RefreshTokenAudience, refresh)
 	if !ok || !bitwarden.IsBitwardenScope(claims.Scope) {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid refresh token",
-		})
+		return codeInvalidRefreshToken.JSON(c, "invalid refresh token")
 	}
 
 	// Find the OAuth client
@@ -434,17 +402,13 @@ func refreshToken(c echo.Context) error {
 		if couchErr, isCouchErr := couchdb.IsCouchError(err); isCouchErr && couchErr.StatusCode >= 500 {
 			return err
 		}
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "the client must be registered",
-		})
+		return codeClientNotRegistered.JSON(c, "the client must be registered")
 	}
 
 	// Create the credentials
 	access, err := bitwarden.CreateAccessJWT(inst, client)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Can't generate access token",
-		})
+		return codeInternal.JSON(c, "Can't generate access token")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -473,22 +437,16 @@ func refreshToken(c echo.Context) error {
 func GetCozy(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	orgKey, err := setting.OrganizationKey()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	res := map[string]interface{}{
@@ -545,6 +503,11 @@ func Routes(router *echo.Group) {
 	ciphers.POST("/:id/share", ShareCipher)
 	ciphers.PUT("/:id/share", ShareCipher)
 
+	reports := api.Group("/reports")
+	reports.GET("/password-health", GetPasswordHealthReport)
+	reports.POST("/password-health", CreatePasswordHealthReport)
+	reports.GET("/password-range/:prefix", GetPasswordRange)
+
 	folders := api.Group("/folders")
 	folders.GET("", ListFolders)
 	folders.POST("", CreateFolder)
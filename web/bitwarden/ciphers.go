@@ -8,6 +8,7 @@ import (
 
 	"github.com/cozy/cozy-stack/model/bitwarden"
 	"github.com/cozy/cozy-stack/model/bitwarden/settings"
+	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -240,24 +241,18 @@ type ciphersList struct {
 func ListCiphers(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var ciphers []*bitwarden.Cipher
 	req := &couchdb.AllDocsRequest{}
 	if err := couchdb.GetAllDocs(inst, consts.BitwardenCiphers, req, &ciphers); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	res := &ciphersList{Object: "list"}
@@ -271,45 +266,33 @@ func ListCiphers(c echo.Context) error {
 func CreateCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req cipherRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 
 	cipher, err := req.toCipher()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInvalidCipher.JSON(c, err.Error())
 	}
 
 	if cipher.FolderID != "" {
 		folder := &bitwarden.Folder{}
 		if err := couchdb.GetDoc(inst, consts.BitwardenFolders, cipher.FolderID, folder); err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{
-				"error": "folder not found",
-			})
+			return codeFolderNotFound.JSON(c, "folder not found")
 		}
 	}
 
 	if err := couchdb.CreateDoc(inst, cipher); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, setting)
@@ -321,9 +304,7 @@ func CreateCipher(c echo.Context) error {
 func CreateSharedCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req struct {
@@ -331,37 +312,27 @@ func CreateSharedCipher(c echo.Context) error {
 		CollectionIDs []string      `json:"collectionIds"`
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 
 	cipher, err := req.Cipher.toCipher()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInvalidCipher.JSON(c, err.Error())
 	}
 
 	if cipher.FolderID != "" {
 		folder := &bitwarden.Folder{}
 		if err := couchdb.GetDoc(inst, consts.BitwardenFolders, cipher.FolderID, folder); err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{
-				"error": "folder not found",
-			})
+			return codeFolderNotFound.JSON(c, "folder not found")
 		}
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	if len(req.CollectionIDs) != 1 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "only one collection per organization is supported",
-		})
+		return codeUnsupportedCollections.JSON(c, "only one collection per organization is supported")
 	}
 	for _, id := range req.CollectionIDs {
 		if id == setting.CollectionID {
@@ -371,11 +342,12 @@ func CreateSharedCipher(c echo.Context) error {
 			cipher.CollectionID = id
 		}
 	}
+	if err := bitwarden.CheckWritable(inst, cipher.OrganizationID); err != nil {
+		return readOnlyError(c, err)
+	}
 
 	if err := couchdb.CreateDoc(inst, cipher); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, setting)
@@ -387,35 +359,25 @@ func CreateSharedCipher(c echo.Context) error {
 func GetCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	cipher := &bitwarden.Cipher{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenCiphers, id, cipher); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	res := newCipherResponse(cipher, setting)
@@ -426,49 +388,39 @@ func GetCipher(c echo.Context) error {
 func UpdateCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	old := &bitwarden.Cipher{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenCiphers, id, old); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+
+	if err := bitwarden.CheckWritable(inst, old.OrganizationID); err != nil {
+		return readOnlyError(c, err)
 	}
 
 	var req cipherRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	cipher, err := req.toCipher()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInvalidCipher.JSON(c, err.Error())
 	}
 
 	if cipher.FolderID != "" && cipher.FolderID != old.FolderID {
 		folder := &bitwarden.Folder{}
 		if err := couchdb.GetDoc(inst, consts.BitwardenFolders, cipher.FolderID, folder); err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{
-				"error": "folder not found",
-			})
+			return codeFolderNotFound.JSON(c, "folder not found")
 		}
 	}
 
@@ -490,16 +442,12 @@ func UpdateCipher(c echo.Context) error {
 	cipher.SetID(old.ID())
 	cipher.SetRev(old.Rev())
 	if err := couchdb.UpdateDocWithOld(inst, cipher, old); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, setting)
@@ -511,34 +459,28 @@ func UpdateCipher(c echo.Context) error {
 func DeleteCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	cipher := &bitwarden.Cipher{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenCiphers, id, cipher); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+
+	if err := bitwarden.CheckWritable(inst, cipher.OrganizationID); err != nil {
+		return readOnlyError(c, err)
 	}
 
 	if err := couchdb.DeleteDoc(inst, cipher); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -550,43 +492,35 @@ func DeleteCipher(c echo.Context) error {
 func SoftDeleteCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	cipher := &bitwarden.Cipher{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenCiphers, id, cipher); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+
+	if err := bitwarden.CheckWritable(inst, cipher.OrganizationID); err != nil {
+		return readOnlyError(c, err)
 	}
 
 	cipher.Metadata.ChangeUpdatedAt()
 	cipher.DeletedDate = &cipher.Metadata.UpdatedAt
 	if err := couchdb.UpdateDoc(inst, cipher); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	_ = settings.UpdateRevisionDate(inst, setting)
 
@@ -598,43 +532,35 @@ func SoftDeleteCipher(c echo.Context) error {
 func RestoreCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	cipher := &bitwarden.Cipher{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenCiphers, id, cipher); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+
+	if err := bitwarden.CheckWritable(inst, cipher.OrganizationID); err != nil {
+		return readOnlyError(c, err)
 	}
 
 	cipher.DeletedDate = nil
 	cipher.Metadata.ChangeUpdatedAt()
 	if err := couchdb.UpdateDoc(inst, cipher); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	_ = settings.UpdateRevisionDate(inst, setting)
 	return c.NoContent(http.StatusOK)
@@ -644,38 +570,31 @@ func RestoreCipher(c echo.Context) error {
 func BulkDeleteCiphers(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req idsRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	if len(req.IDs) == 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Request missing ids field",
-		})
+		return codeMissingIDs.JSON(c, "Request missing ids field")
 	}
 
 	var ciphers []bitwarden.Cipher
 	keys := couchdb.AllDocsRequest{Keys: req.IDs}
 	if err := couchdb.GetAllDocs(inst, consts.BitwardenCiphers, &keys, &ciphers); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+	if err := checkWritableCiphers(inst, ciphers); err != nil {
+		return readOnlyError(c, err)
 	}
 	docs := make([]couchdb.Doc, len(ciphers))
 	for i := range ciphers {
 		docs[i] = ciphers[i].Clone()
 	}
 	if err := couchdb.BulkDeleteDocs(inst, consts.BitwardenCiphers, docs); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -686,29 +605,24 @@ func BulkDeleteCiphers(c echo.Context) error {
 func BulkSoftDeleteCiphers(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req idsRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	if len(req.IDs) == 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Request missing ids field",
-		})
+		return codeMissingIDs.JSON(c, "Request missing ids field")
 	}
 
 	var ciphers []bitwarden.Cipher
 	keys := couchdb.AllDocsRequest{Keys: req.IDs}
 	if err := couchdb.GetAllDocs(inst, consts.BitwardenCiphers, &keys, &ciphers); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+	if err := checkWritableCiphers(inst, ciphers); err != nil {
+		return readOnlyError(c, err)
 	}
 	olds := make([]interface{}, len(ciphers))
 	docs := make([]interface{}, len(ciphers))
@@ -720,9 +634,7 @@ func BulkSoftDeleteCiphers(c echo.Context) error {
 		docs[i] = cipher
 	}
 	if err := couchdb.BulkUpdateDocs(inst, consts.BitwardenCiphers, docs, olds); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -733,29 +645,24 @@ func BulkSoftDeleteCiphers(c echo.Context) error {
 func BulkRestoreCiphers(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req idsRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	if len(req.IDs) == 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Request missing ids field",
-		})
+		return codeMissingIDs.JSON(c, "Request missing ids field")
 	}
 
 	var ciphers []bitwarden.Cipher
 	keys := couchdb.AllDocsRequest{Keys: req.IDs}
 	if err := couchdb.GetAllDocs(inst, consts.BitwardenCiphers, &keys, &ciphers); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+	if err := checkWritableCiphers(inst, ciphers); err != nil {
+		return readOnlyError(c, err)
 	}
 	olds := make([]interface{}, len(ciphers))
 	docs := make([]interface{}, len(ciphers))
@@ -767,16 +674,12 @@ func BulkRestoreCiphers(c echo.Context) error {
 		docs[i] = cipher
 	}
 	if err := couchdb.BulkUpdateDocs(inst, consts.BitwardenCiphers, docs, olds); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	_ = settings.UpdateRevisionDate(inst, setting)
 
@@ -794,69 +697,77 @@ type shareCipherRequest struct {
 	CollectionIDs []string      `json:"collectionIds"`
 }
 
+// checkWritableCiphers returns an error if one of the ciphers is in an
+// organization where the instance is a read-only member.
+func checkWritableCiphers(inst *instance.Instance, ciphers []bitwarden.Cipher) error {
+	checked := make(map[string]bool)
+	for _, cipher := range ciphers {
+		if checked[cipher.OrganizationID] {
+			continue
+		}
+		if err := bitwarden.CheckWritable(inst, cipher.OrganizationID); err != nil {
+			return err
+		}
+		checked[cipher.OrganizationID] = true
+	}
+	return nil
+}
+
+func readOnlyError(c echo.Context, err error) error {
+	if errors.Is(err, bitwarden.ErrReadOnlyMember) {
+		return codeReadOnlyMember.JSON(c, err.Error())
+	}
+	return codeInternal.JSON(c, err.Error())
+}
+
 // ShareCipher is used to share a cipher with an organization.
 func ShareCipher(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	old := &bitwarden.Cipher{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenCiphers, id, old); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	var req shareCipherRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
 		inst.Logger().WithNamespace("bitwarden").
 			Infof("Bad JSON: %v", err)
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	cipher, err := req.Cipher.toCipher()
 	if err != nil {
 		inst.Logger().WithNamespace("bitwarden").
 			Infof("Bad cipher: %v", err)
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInvalidCipher.JSON(c, err.Error())
 	}
 	if req.Cipher.OrganizationID == "" {
 		inst.Logger().WithNamespace("bitwarden").
 			Infof("Bad organization: %v", req)
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "organizationId not provided",
-		})
+		return codeMissingOrganization.JSON(c, "organizationId not provided")
+	}
+	if err := bitwarden.CheckWritable(inst, req.Cipher.OrganizationID); err != nil {
+		return readOnlyError(c, err)
 	}
 
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	if len(req.CollectionIDs) != 1 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "only one collection per organization is supported",
-		})
+		return codeUnsupportedCollections.JSON(c, "only one collection per organization is supported")
 	}
 	for _, id := range req.CollectionIDs {
 		if id == setting.CollectionID {
@@ -876,9 +787,7 @@ func ShareCipher(c echo.Context) error {
 	cipher.SetID(old.ID())
 	cipher.SetRev(old.Rev())
 	if err := couchdb.UpdateDocWithOld(inst, cipher, old); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, setting)
@@ -890,16 +799,12 @@ func ShareCipher(c echo.Context) error {
 func ImportCiphers(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req importCipherRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 
 	// Import the folders
@@ -909,9 +814,7 @@ func ImportCiphers(c echo.Context) error {
 		folders[i] = folder.toFolder()
 	}
 	if err := couchdb.BulkUpdateDocs(inst, consts.BitwardenFolders, folders, olds); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	// Import the ciphers
@@ -920,9 +823,7 @@ func ImportCiphers(c echo.Context) error {
 	for i, cipherReq := range req.Ciphers {
 		cipher, err := cipherReq.toCipher()
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{
-				"error": err.Error(),
-			})
+			return codeInvalidCipher.JSON(c, err.Error())
 		}
 		for _, kv := range req.FolderRelationships {
 			if kv.Cipher == i && kv.Folder < len(folders) {
@@ -932,17 +833,13 @@ func ImportCiphers(c echo.Context) error {
 		ciphers[i] = cipher
 	}
 	if err := couchdb.BulkUpdateDocs(inst, consts.BitwardenCiphers, ciphers, olds); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	// Update the revision date
 	setting, err := settings.Get(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	_ = settings.UpdateRevisionDate(inst, setting)
 
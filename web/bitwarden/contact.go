@@ -19,35 +19,25 @@ import (
 func RefuseContact(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.BitwardenContacts); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	var contact bitwarden.Contact
 	if err := couchdb.GetDoc(inst, consts.BitwardenContacts, id, &contact); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	email := contact.Email
 	if err := couchdb.DeleteDoc(inst, &contact); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	sharings, err := sharing.GetSharingsByDocType(inst, consts.BitwardenOrganizations)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	var errm error
 	for _, s := range sharings {
@@ -63,9 +53,7 @@ func RefuseContact(c echo.Context) error {
 		}
 	}
 	if errm != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	return c.NoContent(http.StatusNoContent)
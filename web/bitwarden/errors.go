@@ -0,0 +1,39 @@
+package bitwarden
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/pkg/errcode"
+)
+
+// Codes of the errors returned by the bitwarden routes. The responses keep the
+// format expected by the bitwarden clients, with the message in the error
+// field, and the code is added in a code field.
+var (
+	codeInvalidToken           = errcode.Register("bitwarden.invalid_token", http.StatusUnauthorized, "The token is invalid or doesn't give the permission for this action")
+	codeInvalidJSON            = errcode.Register("bitwarden.invalid_json", http.StatusBadRequest, "The JSON of the request is invalid")
+	codeInvalidPayload         = errcode.Register("bitwarden.invalid_payload", http.StatusUnauthorized, "The JSON payload for the profile or the keys is invalid")
+	codeNotFound               = errcode.Register("bitwarden.not_found", http.StatusNotFound, "The item has not been found")
+	codeMissingID              = errcode.Register("bitwarden.missing_id", http.StatusNotFound, "The identifier of the item is missing")
+	codeMissingIDs             = errcode.Register("bitwarden.missing_ids", http.StatusBadRequest, "The ids field is missing")
+	codeMissingName            = errcode.Register("bitwarden.missing_name", http.StatusBadRequest, "The name is missing")
+	codeFolderNotFound         = errcode.Register("bitwarden.folder_not_found", http.StatusBadRequest, "The folder of the cipher has not been found")
+	codeInvalidCipher          = errcode.Register("bitwarden.invalid_cipher", http.StatusBadRequest, "The cipher is invalid")
+	codeUnsupportedCollections = errcode.Register("bitwarden.unsupported_collections", http.StatusBadRequest, "Only one collection per organization is supported")
+	codeMissingOrganization    = errcode.Register("bitwarden.missing_organization", http.StatusBadRequest, "The organizationId is missing")
+	codeReadOnlyMember         = errcode.Register("bitwarden.read_only_member", http.StatusForbidden, "The member has only a read-only access to the organization")
+	codeNotAllowed             = errcode.Register("bitwarden.not_allowed", http.StatusUnauthorized, "The action is reserved to the owner or the admins of the organization")
+	codeInvalidRole            = errcode.Register("bitwarden.invalid_role", http.StatusBadRequest, "The role of the member is invalid")
+	codeInvalidMemberState     = errcode.Register("bitwarden.invalid_member_state", http.StatusBadRequest, "The member of the organization is not in a valid state for this action")
+	codeInvalidPassword        = errcode.Register("bitwarden.invalid_password", http.StatusUnauthorized, "The master password is invalid")
+	codeInvalidHashPrefix      = errcode.Register("bitwarden.invalid_hash_prefix", http.StatusBadRequest, "The prefix of the password hash is invalid")
+	codeBreachCheckDisabled    = errcode.Register("bitwarden.breach_check_disabled", http.StatusForbidden, "The check against the data breaches is disabled")
+	codeBreachCheckUnavailable = errcode.Register("bitwarden.breach_check_unavailable", http.StatusBadGateway, "The range API for the data breaches cannot be reached")
+	codeNoHealthReport         = errcode.Register("bitwarden.no_password_health_report", http.StatusNotFound, "The password health report has not been computed yet")
+	codeInvalidGrantType       = errcode.Register("bitwarden.invalid_grant_type", http.StatusBadRequest, "The grant_type is missing or not supported")
+	codeClientNotRegistered    = errcode.Register("bitwarden.client_not_registered", http.StatusBadRequest, "The client must be registered")
+	codeInvalidRefreshToken    = errcode.Register("bitwarden.invalid_refresh_token", http.StatusBadRequest, "The refresh token is invalid")
+	codeInvalidTwoFactorToken  = errcode.Register("bitwarden.invalid_two_factor_token", http.StatusBadRequest, "The two-factor token is invalid")
+	codeTwoFactorRequired      = errcode.Register("bitwarden.two_factor_required", http.StatusBadRequest, "A two-factor token is required")
+	codeInternal               = errcode.Register("bitwarden.internal_error", http.StatusInternalServerError, "An internal error has happened")
+)
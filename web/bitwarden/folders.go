@@ -60,17 +60,13 @@ type foldersList struct {
 func ListFolders(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenFolders); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var folders []*bitwarden.Folder
 	req := &couchdb.AllDocsRequest{}
 	if err := couchdb.GetAllDocs(inst, consts.BitwardenFolders, req, &folders); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	res := &foldersList{Object: "list"}
@@ -84,28 +80,20 @@ func ListFolders(c echo.Context) error {
 func CreateFolder(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenFolders); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req folderRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	if req.Name == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "missing name",
-		})
+		return codeMissingName.JSON(c, "missing name")
 	}
 
 	folder := req.toFolder()
 	if err := couchdb.CreateDoc(inst, folder); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -117,28 +105,20 @@ func CreateFolder(c echo.Context) error {
 func GetFolder(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenFolders); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	folder := &bitwarden.Folder{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenFolders, id, folder); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	res := newFolderResponse(folder)
@@ -149,40 +129,28 @@ func GetFolder(c echo.Context) error {
 func RenameFolder(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenFolders); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	folder := &bitwarden.Folder{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenFolders, id, folder); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	var req folderRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	if req.Name == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "missing name",
-		})
+		return codeMissingName.JSON(c, "missing name")
 	}
 
 	folder.Name = req.Name
@@ -193,9 +161,7 @@ func RenameFolder(c echo.Context) error {
 	}
 	folder.Metadata.ChangeUpdatedAt()
 	if err := couchdb.UpdateDoc(inst, folder); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -207,36 +173,26 @@ func RenameFolder(c echo.Context) error {
 func DeleteFolder(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.BitwardenFolders); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	folder := &bitwarden.Folder{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenFolders, id, folder); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	// Move the ciphers that are in this folder to outside of it
 	ciphers, err := bitwarden.FindCiphersInFolder(inst, id)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	docs := make([]interface{}, len(ciphers))
 	olds := make([]interface{}, len(ciphers))
@@ -246,9 +202,7 @@ func DeleteFolder(c echo.Context) error {
 		docs[i] = ciphers[i]
 	}
 	if err := couchdb.BulkUpdateDocs(inst, consts.BitwardenCiphers, docs, olds); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	if folder.Metadata == nil {
@@ -258,9 +212,7 @@ func DeleteFolder(c echo.Context) error {
 	}
 	folder.Metadata.ChangeUpdatedAt()
 	if err := couchdb.DeleteDoc(inst, folder); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -30,9 +30,7 @@ type transport struct {
 // only websocket is supported.
 func NegotiateHub(c echo.Context) error {
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	transports := []transport{
@@ -54,16 +52,12 @@ func WebsocketHub(c echo.Context) error {
 	token := c.QueryParam("access_token")
 	pdoc, err := middlewares.ParseJWT(c, inst, token)
 	if err != nil || !pdoc.Permissions.AllowWholeType(permission.GET, consts.BitwardenCiphers) {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	notifier, err := upgradeWebsocket(c, inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	go readPump(notifier)
 	return writePump(notifier)
@@ -11,6 +11,7 @@ import (
 	"github.com/cozy/cozy-stack/model/contact"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/metadata"
@@ -84,12 +85,20 @@ type organizationResponse struct {
 	Object         string  `json:"Object"`
 }
 
-func newOrganizationResponse(inst *instance.Instance, org *bitwarden.Organization) *organizationResponse {
-	m := org.Members[inst.Domain]
-	typ := 2 // User
+// https://github.com/bitwarden/server/blob/master/src/Core/Enums/OrganizationUserType.cs
+func organizationUserType(m *bitwarden.OrgMember) int {
 	if m.Owner {
-		typ = 0 // Owner
+		return 0 // Owner
+	}
+	if m.EffectiveRole() == bitwarden.OrgRoleAdmin {
+		return 1 // Admin
 	}
+	return 2 // User
+}
+
+func newOrganizationResponse(inst *instance.Instance, org *bitwarden.Organization) *organizationResponse {
+	m := org.Members[inst.Domain]
+	typ := organizationUserType(&m)
 	email := inst.PassphraseSalt()
 	return &organizationResponse{
 		ID:             org.ID(),
@@ -153,35 +162,25 @@ func newCollectionResponse(inst *instance.Instance, org *bitwarden.Organization,
 func CreateOrganization(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req organizationRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	if req.Name == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "missing name",
-		})
+		return codeMissingName.JSON(c, "missing name")
 	}
 
 	org := req.toOrganization(inst)
 	collID, err := couchdb.UUID(inst)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 	org.Collection.DocID = collID
 	if err := couchdb.CreateDoc(inst, org); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -194,28 +193,20 @@ func GetOrganization(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	org := &bitwarden.Organization{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenOrganizations, id, org); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	res := newOrganizationResponse(inst, org)
@@ -233,28 +224,20 @@ func GetCollections(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	org := &bitwarden.Organization{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenOrganizations, id, org); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	coll := newCollectionResponse(inst, org, &org.Collection)
@@ -272,52 +255,36 @@ type passwordVerificationRequest struct {
 func DeleteOrganization(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var verification passwordVerificationRequest
 	if err := json.NewDecoder(c.Request().Body).Decode(&verification); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 	if err := instance.CheckPassphrase(inst, []byte(verification.Hash)); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid password",
-		})
+		return codeInvalidPassword.JSON(c, "invalid password")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	org := &bitwarden.Organization{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenOrganizations, id, org); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	if m := org.Members[inst.Domain]; !m.Owner {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "only the Owner can call this endpoint",
-		})
+		return codeNotAllowed.JSON(c, "only the Owner can call this endpoint")
 	}
 
 	if err := org.Delete(inst); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	_ = settings.UpdateRevisionDate(inst, nil)
@@ -325,6 +292,8 @@ func DeleteOrganization(c echo.Context) error {
 }
 
 // https://github.com/bitwarden/jslib/blob/master/common/src/models/response/organizationUserResponse.ts
+// We deviate from the Bitwarden's protocol by adding the Role and ReadOnly
+// fields, as Bitwarden has no type for the read-only members.
 type userDetailsResponse struct {
 	ID        string                    `json:"Id"`
 	UserID    string                    `json:"UserId"`
@@ -333,22 +302,26 @@ type userDetailsResponse struct {
 	AccessAll bool                      `json:"AccessAll"`
 	Name      string                    `json:"Name"`
 	Email     string                    `json:"Email"`
+	Role      string                    `json:"Role"`
+	ReadOnly  bool                      `json:"ReadOnly"`
 	Object    string                    `json:"Object"`
 }
 
 func newUserDetailsResponse(m *bitwarden.OrgMember) *userDetailsResponse {
-	typ := 2 // User
+	role := string(m.EffectiveRole())
 	if m.Owner {
-		typ = 0 // Owner
+		role = "owner"
 	}
 	return &userDetailsResponse{
 		ID:        m.UserID,
 		UserID:    m.UserID,
-		Type:      typ,
+		Type:      organizationUserType(m),
 		Status:    m.Status,
 		AccessAll: true,
 		Name:      m.Name,
 		Email:     m.Email,
+		Role:      role,
+		ReadOnly:  !m.CanWrite(),
 		Object:    "organizationUserUserDetails",
 	}
 }
@@ -362,28 +335,20 @@ type userDetailsList struct {
 func ListOrganizationUser(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 
 	org := &bitwarden.Organization{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenOrganizations, id, org); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	list := &userDetailsList{Object: "list"}
@@ -394,65 +359,65 @@ func ListOrganizationUser(c echo.Context) error {
 }
 
 // https://github.com/bitwarden/jslib/blob/master/common/src/models/request/organizationUserConfirmRequest.ts
+// We deviate from the Bitwarden's protocol by accepting an optional role.
 type userConfirmRequest struct {
-	Key string `json:"key"`
+	Key  string `json:"key"`
+	Role string `json:"role,omitempty"`
 }
 
 // ConfirmUser is the route to confirm a user in an organization. It takes the
-// organization key encrypted with the public key of this user as input.
+// organization key encrypted with the public key of this user as input, and
+// optionally the role of this user (admin, user, or read_only).
 func ConfirmUser(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 	org := &bitwarden.Organization{}
 	if err := couchdb.GetDoc(inst, consts.BitwardenOrganizations, id, org); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
-	if m := org.Members[inst.Domain]; !m.Owner {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "only the Owner can call this endpoint",
-		})
+	self := org.Members[inst.Domain]
+	if !self.CanManageMembers() {
+		return codeNotAllowed.JSON(c, "only the Owner or an Admin can call this endpoint")
 	}
 
 	var confirm userConfirmRequest
 	err := json.NewDecoder(c.Request().Body).Decode(&confirm)
 	if err != nil || confirm.Key == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
+	}
+	var role bitwarden.OrgMemberRole
+	if confirm.Role != "" {
+		if role, err = bitwarden.ParseOrgMemberRole(confirm.Role); err != nil {
+			return codeInvalidRole.JSON(c, err.Error())
+		}
+		// The roles are aligned with the sharing, that only the owner can
+		// change
+		if !self.Owner {
+			return codeNotAllowed.JSON(c, "only the Owner can change the role of a user")
+		}
 	}
 
 	userID := c.Param("user-id")
 	var bwContact bitwarden.Contact
 	if err := couchdb.GetDoc(inst, consts.BitwardenContacts, userID, &bwContact); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	found := false
+	var memberDomain string
 	for domain, member := range org.Members {
 		if member.UserID != userID {
 			continue
@@ -460,31 +425,29 @@ func ConfirmUser(c echo.Context) error {
 		if member.Status == bitwarden.OrgMemberAccepted {
 			member.Status = bitwarden.OrgMemberConfirmed
 		} else if member.Status != bitwarden.OrgMemberInvited {
-			return c.JSON(http.StatusBadRequest, echo.Map{
-				"error": "User in invalid state",
-			})
+			return codeInvalidMemberState.JSON(c, "User in invalid state")
 		}
 		found = true
 		member.OrgKey = confirm.Key
+		if role != "" {
+			member.SetRole(role)
+		}
 		org.Members[domain] = member
+		memberDomain = domain
 	}
 	if !found {
 		card, err := contact.FindByEmail(inst, bwContact.Email)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, echo.Map{
-				"error": err.Error(),
-			})
+			return codeInternal.JSON(c, err.Error())
 		}
 		domain := card.PrimaryCozyURL()
 		if domain == "" {
-			return c.JSON(http.StatusInternalServerError, echo.Map{
-				"error": "Unknown Cozy URL for this user",
-			})
+			return codeInternal.JSON(c, "Unknown Cozy URL for this user")
 		}
 		if u, err := url.Parse(domain); err == nil {
 			domain = u.Host
 		}
-		org.Members[domain] = bitwarden.OrgMember{
+		member := bitwarden.OrgMember{
 			UserID:   bwContact.UserID,
 			Email:    bwContact.Email,
 			Name:     card.PrimaryName(),
@@ -493,22 +456,34 @@ func ConfirmUser(c echo.Context) error {
 			Owner:    false,
 			ReadOnly: true, // it will be overwritten when the user accepts the sharing
 		}
+		if role != "" {
+			member.SetRole(role)
+		}
+		org.Members[domain] = member
+		memberDomain = domain
 	}
 
 	if !bwContact.Confirmed {
 		bwContact.Confirmed = true
 		bwContact.Metadata.UpdatedAt = time.Now()
 		if err := couchdb.UpdateDoc(inst, &bwContact); err != nil {
-			return c.JSON(http.StatusInternalServerError, echo.Map{
-				"error": err.Error(),
-			})
+			return codeInternal.JSON(c, err.Error())
 		}
 	}
 
 	if err := couchdb.UpdateDoc(inst, org); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
+	}
+
+	// The read-only flag of the sharing member is aligned with the role, so
+	// that the changes of a read-only member are not propagated
+	if role != "" {
+		member := org.Members[memberDomain]
+		if err := sharing.SetBitwardenMemberReadOnly(inst, org.ID(), &member, memberDomain); err != nil {
+			inst.Logger().WithNamespace("bitwarden").
+				Warnf("Cannot update the read-only flag of %s: %s", memberDomain, err)
+			return codeInternal.JSON(c, err.Error())
+		}
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -518,27 +493,19 @@ func ConfirmUser(c echo.Context) error {
 func GetPublicKey(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenOrganizations); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	id := c.Param("id")
 	if id == "" {
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "missing id",
-		})
+		return codeMissingID.JSON(c, "missing id")
 	}
 	var contact bitwarden.Contact
 	if err := couchdb.GetDoc(inst, consts.BitwardenContacts, id, &contact); err != nil {
 		if couchdb.IsNotFoundError(err) {
-			return c.JSON(http.StatusNotFound, echo.Map{
-				"error": "not found",
-			})
+			return codeNotFound.JSON(c, "not found")
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
@@ -0,0 +1,142 @@
+package bitwarden
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/bitwarden"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+type exposedCipherRequest struct {
+	CipherID string `json:"cipherId"`
+	Count    int    `json:"count"`
+}
+
+type passwordHealthRequest struct {
+	Reused      []string               `json:"reused"`
+	Exposed     []exposedCipherRequest `json:"exposed"`
+	BreachCheck bool                   `json:"breachCheck"`
+}
+
+type exposedCipherResponse struct {
+	CipherID string `json:"CipherId"`
+	Count    int    `json:"Count"`
+}
+
+type passwordHealthResponse struct {
+	Total           int                     `json:"Total"`
+	ReusedCount     int                     `json:"ReusedCount"`
+	ReusedCipherIDs []string                `json:"ReusedCipherIds"`
+	OldCount        int                     `json:"OldCount"`
+	OldCipherIDs    []string                `json:"OldCipherIds"`
+	ExposedCount    int                     `json:"ExposedCount"`
+	ExposedCiphers  []exposedCipherResponse `json:"ExposedCiphers"`
+	BreachCheck     bool                    `json:"BreachCheck"`
+	Date            time.Time               `json:"RevisionDate"`
+	Object          string                  `json:"Object"`
+}
+
+func newPasswordHealthResponse(r *bitwarden.PasswordHealthReport) *passwordHealthResponse {
+	exposed := make([]exposedCipherResponse, len(r.Exposed))
+	for i, e := range r.Exposed {
+		exposed[i] = exposedCipherResponse{CipherID: e.CipherID, Count: e.Count}
+	}
+	return &passwordHealthResponse{
+		Total:           r.Total,
+		ReusedCount:     len(r.Reused),
+		ReusedCipherIDs: r.Reused,
+		OldCount:        len(r.Old),
+		OldCipherIDs:    r.Old,
+		ExposedCount:    len(r.Exposed),
+		ExposedCiphers:  exposed,
+		BreachCheck:     r.BreachCheck,
+		Date:            r.CreatedAt.UTC(),
+		Object:          "passwordHealthReport",
+	}
+}
+
+// CreatePasswordHealthReport is the route for computing a new report on the
+// passwords of the vault. The stack cannot decrypt the ciphers, so the client
+// checks the passwords itself and sends only the identifiers of the ciphers
+// with a reused or exposed password.
+func CreatePasswordHealthReport(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.BitwardenCiphers); err != nil {
+		return codeInvalidToken.JSON(c, "invalid token")
+	}
+
+	var req passwordHealthRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return codeInvalidJSON.JSON(c, "invalid JSON")
+	}
+	checks := &bitwarden.PasswordHealthChecks{
+		Reused:      req.Reused,
+		Exposed:     make([]bitwarden.ExposedCipher, 0, len(req.Exposed)),
+		BreachCheck: req.BreachCheck,
+	}
+	for _, e := range req.Exposed {
+		checks.Exposed = append(checks.Exposed, bitwarden.ExposedCipher{CipherID: e.CipherID, Count: e.Count})
+	}
+
+	report, err := bitwarden.ComputePasswordHealth(inst, checks)
+	if err != nil {
+		return codeInternal.JSON(c, err.Error())
+	}
+	return c.JSON(http.StatusOK, newPasswordHealthResponse(report))
+}
+
+// GetPasswordHealthReport is the route for getting the last report on the
+// passwords of the vault.
+func GetPasswordHealthReport(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenCiphers); err != nil {
+		return codeInvalidToken.JSON(c, "invalid token")
+	}
+
+	report, err := bitwarden.GetPasswordHealth(inst)
+	if errors.Is(err, bitwarden.ErrNoPasswordHealthReport) {
+		return codeNoHealthReport.JSON(c, err.Error())
+	}
+	if err != nil {
+		return codeInternal.JSON(c, err.Error())
+	}
+	return c.JSON(http.StatusOK, newPasswordHealthResponse(report))
+}
+
+// GetPasswordRange is the route used by the clients to check the passwords
+// against the data breaches. The client sends the 5 first characters of the
+// SHA-1 of a password, and the response is the list of the suffixes of the
+// breached passwords with this prefix, in the format of the range API of Have
+// I Been Pwned.
+func GetPasswordRange(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenCiphers); err != nil {
+		return codeInvalidToken.JSON(c, "invalid token")
+	}
+
+	suffixes, err := bitwarden.PasswordRange(inst, c.Param("prefix"))
+	switch {
+	case errors.Is(err, bitwarden.ErrInvalidHashPrefix):
+		return codeInvalidHashPrefix.JSON(c, err.Error())
+	case errors.Is(err, bitwarden.ErrBreachCheckDisabled):
+		return codeBreachCheckDisabled.JSON(c, err.Error())
+	case err != nil:
+		return codeBreachCheckUnavailable.JSON(c, err.Error())
+	}
+
+	lines := make([]string, 0, len(suffixes))
+	for suffix, count := range suffixes {
+		lines = append(lines, fmt.Sprintf("%s:%d\r\n", suffix, count))
+	}
+	sort.Strings(lines)
+	return c.String(http.StatusOK, strings.Join(lines, ""))
+}
@@ -53,9 +53,7 @@ func newDomainsResponse(setting *settings.Settings) *domainsResponse {
 func GetDomains(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenProfiles); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -70,9 +68,7 @@ func GetDomains(c echo.Context) error {
 func UpdateDomains(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.PUT, consts.BitwardenProfiles); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 
 	var req struct {
@@ -80,9 +76,7 @@ func UpdateDomains(c echo.Context) error {
 		Global     []int      `json:"globalEquivalentDomains"`
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "invalid JSON",
-		})
+		return codeInvalidJSON.JSON(c, "invalid JSON")
 	}
 
 	setting, err := settings.Get(inst)
@@ -93,9 +87,7 @@ func UpdateDomains(c echo.Context) error {
 	setting.EquivalentDomains = req.Equivalent
 	setting.GlobalEquivalentDomains = req.Global
 	if err := setting.Save(inst); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	domains := newDomainsResponse(setting)
@@ -115,9 +115,7 @@ func newSyncResponse(
 func Sync(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
 	if err := middlewares.AllowWholeType(c, permission.GET, consts.BitwardenCiphers); err != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "invalid token",
-		})
+		return codeInvalidToken.JSON(c, "invalid token")
 	}
 	setting, err := settings.Get(inst)
 	if err != nil {
@@ -126,17 +124,13 @@ func Sync(c echo.Context) error {
 
 	profile, err := newProfileResponse(inst, setting)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	var ciphers []*bitwarden.Cipher
 	req := &couchdb.AllDocsRequest{}
 	if err := couchdb.GetAllDocs(inst, consts.BitwardenCiphers, req, &ciphers); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	var folders []*bitwarden.Folder
@@ -145,17 +139,13 @@ func Sync(c echo.Context) error {
 		if couchdb.IsNoDatabaseError(err) {
 			_ = couchdb.CreateDB(inst, consts.BitwardenFolders)
 		} else {
-			return c.JSON(http.StatusInternalServerError, echo.Map{
-				"error": err.Error(),
-			})
+			return codeInternal.JSON(c, err.Error())
 		}
 	}
 
 	organizations, err := bitwarden.FindAllOrganizations(inst, setting)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
+		return codeInternal.JSON(c, err.Error())
 	}
 
 	var domains *domainsResponse
@@ -0,0 +1,199 @@
+// Package comments is for the routes used to post comments on a file, and to
+// moderate them.
+package comments
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cozy/cozy-stack/model/comment"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+type apiComment struct {
+	*comment.Comment
+}
+
+func (c *apiComment) Relationships() jsonapi.RelationshipMap { return nil }
+func (c *apiComment) Included() []jsonapi.Object             { return nil }
+func (c *apiComment) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/comments/" + c.FileID + "/" + c.ID()}
+}
+
+// canModerate returns true if the request has been made by the owner of the
+// instance, with a permission on the whole io.cozy.comments doctype.
+func canModerate(c echo.Context) bool {
+	return middlewares.AllowWholeType(c, permission.PATCH, consts.Comments) == nil
+}
+
+// viewerSharingID returns the identifier of the sharing of the sharecode used
+// for the request. The boolean is false when the request has been made with a
+// token of the owner (app, OAuth client, etc.).
+func viewerSharingID(c echo.Context) (string, bool) {
+	pdoc, err := middlewares.GetPermission(c)
+	if err != nil {
+		return "", true
+	}
+	switch pdoc.Type {
+	case permission.TypeSharePreview, permission.TypeShareInteract:
+		return strings.TrimPrefix(pdoc.SourceID, consts.Sharings+"/"), true
+	case permission.TypeShareByLink:
+		return "", true
+	}
+	return "", false
+}
+
+// ListComments is the API handler for GET /comments/:file-id. It returns the
+// comments of the file, and the hidden comments only for the owner. With a
+// sharecode, the email and the Cozy instance of an author are only given for
+// the comments posted by the members of the same sharing.
+func ListComments(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	file, err := inst.VFS().FileByID(c.Param("file-id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := middlewares.AllowVFS(c, permission.GET, file); err != nil {
+		return err
+	}
+
+	list, err := comment.List(inst, file.ID(), canModerate(c))
+	if err != nil {
+		return wrapError(err)
+	}
+	sharingID, withSharecode := viewerSharingID(c)
+	objs := make([]jsonapi.Object, len(list))
+	for i, com := range list {
+		if withSharecode && com.SharingID != sharingID {
+			com.HideAuthorContact()
+		}
+		objs[i] = &apiComment{com}
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+}
+
+// PostComment is the API handler for POST /comments/:file-id. A member of a
+// sharing can use its sharecode to comment a shared file, even if the sharing
+// is read-only for them.
+func PostComment(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	file, err := inst.VFS().FileByID(c.Param("file-id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := middlewares.AllowVFS(c, permission.GET, file); err != nil {
+		return err
+	}
+
+	pdoc, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+	com := &comment.Comment{FileID: file.ID()}
+	switch pdoc.Type {
+	case permission.TypeSharePreview, permission.TypeShareInteract:
+		sharingID := strings.TrimPrefix(pdoc.SourceID, consts.Sharings+"/")
+		s, err := sharing.FindSharing(inst, sharingID)
+		if err != nil {
+			return wrapError(err)
+		}
+		member, err := s.FindMemberByCode(pdoc, middlewares.GetRequestToken(c))
+		if err != nil {
+			return wrapError(err)
+		}
+		com.SharingID = sharingID
+		com.Author = comment.Author{
+			Name:     member.PrimaryName(),
+			Email:    member.Email,
+			Instance: member.Instance,
+		}
+	default:
+		if err := middlewares.AllowWholeType(c, permission.POST, consts.Comments); err != nil {
+			return err
+		}
+		name, _ := inst.SettingsPublicName()
+		com.Author = comment.Author{Name: name, Owner: true}
+	}
+
+	var attrs struct {
+		Body string `json:"body"`
+	}
+	if _, err := jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return jsonapi.BadJSON()
+	}
+	com.Body = attrs.Body
+	if err := comment.Create(inst, com); err != nil {
+		return wrapError(err)
+	}
+	return jsonapi.Data(c, http.StatusCreated, &apiComment{com}, nil)
+}
+
+// ModerateComment is the API handler for PATCH /comments/:file-id/:id. It is
+// used by the owner to hide a comment, or to publish it again.
+func ModerateComment(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.PATCH, consts.Comments); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	com, err := comment.Get(inst, c.Param("file-id"), c.Param("id"))
+	if err != nil {
+		return wrapError(err)
+	}
+
+	var attrs struct {
+		Status string `json:"status"`
+	}
+	if _, err := jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if err := comment.Moderate(inst, com, attrs.Status); err != nil {
+		return wrapError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, &apiComment{com}, nil)
+}
+
+// DeleteComment is the API handler for DELETE /comments/:file-id/:id.
+func DeleteComment(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.Comments); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	com, err := comment.Get(inst, c.Param("file-id"), c.Param("id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := comment.Delete(inst, com); err != nil {
+		return wrapError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Routes sets the routing for the comments.
+func Routes(router *echo.Group) {
+	router.GET("/:file-id", ListComments)
+	router.POST("/:file-id", PostComment)
+	router.PATCH("/:file-id/:id", ModerateComment)
+	router.DELETE("/:file-id/:id", DeleteComment)
+}
+
+func wrapError(err error) *jsonapi.Error {
+	switch err {
+	case comment.ErrInvalidBody:
+		return jsonapi.InvalidAttribute("body", err)
+	case comment.ErrInvalidStatus:
+		return jsonapi.InvalidAttribute("status", err)
+	case comment.ErrNotFound, os.ErrNotExist, sharing.ErrMemberNotFound:
+		return jsonapi.NotFound(err)
+	}
+	if couchdb.IsNotFoundError(err) {
+		return jsonapi.NotFound(err)
+	}
+	return jsonapi.InternalServerError(err)
+}
@@ -1,4 +1,5 @@
-// Package contacts exposes a route for the myself document.
+// Package contacts exposes a route for the myself document, the routes to
+// find and merge the duplicate contacts, and the routes to import contacts.
 package contacts
 
 import (
@@ -49,4 +50,14 @@ func MyselfHandler(c echo.Context) error {
 // Routes sets the routing for the contacts.
 func Routes(router *echo.Group) {
 	router.POST("/myself", MyselfHandler)
+
+	router.GET("/duplicates", ListDuplicates)
+	router.POST("/duplicates", ScanDuplicates)
+	router.GET("/duplicates/:id/preview", PreviewMerge)
+	router.POST("/duplicates/:id/merge", MergeDuplicate)
+	router.DELETE("/duplicates/:id", DismissDuplicate)
+	router.POST("/merges/:id/undo", UndoMerge)
+
+	router.POST("/import", ImportContacts)
+	router.GET("/import/:id", GetImport)
 }
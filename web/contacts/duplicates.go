@@ -0,0 +1,170 @@
+package contacts
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+type apiDuplicate struct{ *contact.Duplicate }
+
+func (d *apiDuplicate) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/contacts/duplicates/" + d.DocID}
+}
+func (d *apiDuplicate) Relationships() jsonapi.RelationshipMap { return jsonapi.RelationshipMap{} }
+func (d *apiDuplicate) Included() []jsonapi.Object             { return []jsonapi.Object{} }
+
+// contactData returns the JSON-API representation of a contact, with some
+// meta-data about the merge.
+func contactData(doc *contact.Contact, meta echo.Map) echo.Map {
+	attrs := make(map[string]interface{}, len(doc.M))
+	for k, v := range doc.M {
+		if k != "_id" && k != "_rev" {
+			attrs[k] = v
+		}
+	}
+	data := echo.Map{
+		"type":       consts.Contacts,
+		"id":         doc.ID(),
+		"attributes": attrs,
+	}
+	if rev := doc.Rev(); rev != "" {
+		data["meta"] = echo.Map{"rev": rev}
+	}
+	return echo.Map{"data": data, "meta": meta}
+}
+
+// ListDuplicates is the handler for GET /contacts/duplicates. It returns the
+// pairs of contacts that may be duplicates, the most probable first.
+func ListDuplicates(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Contacts); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	contact.EnsureDedupTrigger(inst)
+	dups, err := contact.ListDuplicates(inst, false)
+	if err != nil {
+		return wrapError(err)
+	}
+	objs := make([]jsonapi.Object, len(dups))
+	for i, dup := range dups {
+		objs[i] = &apiDuplicate{dup}
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+}
+
+// ScanDuplicates is the handler for POST /contacts/duplicates. It pushes a
+// job to look for the duplicates.
+func ScanDuplicates(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.Contacts); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	contact.EnsureDedupTrigger(inst)
+	if err := contact.PushDedupJob(inst); err != nil {
+		return wrapError(err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// PreviewMerge is the handler for GET /contacts/duplicates/:id/preview. It
+// returns the contact that would result of the merge, without saving it.
+func PreviewMerge(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Contacts); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	dup, err := contact.GetDuplicate(inst, c.Param("id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	merged, removed, err := dup.Preview(inst)
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, contactData(merged, echo.Map{
+		"removed": removed.ID(),
+	}))
+}
+
+// MergeDuplicate is the handler for POST /contacts/duplicates/:id/merge. It
+// merges the two contacts, and returns the merged contact.
+func MergeDuplicate(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.PUT, consts.Contacts); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	dup, err := contact.GetDuplicate(inst, c.Param("id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	merged, record, err := contact.MergeDuplicate(inst, dup)
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, contactData(merged, echo.Map{
+		"removed":    record.Removed,
+		"merge_id":   record.ID(),
+		"undo_until": record.ExpiresAt,
+	}))
+}
+
+// DismissDuplicate is the handler for DELETE /contacts/duplicates/:id. It
+// marks the two contacts as not being duplicates.
+func DismissDuplicate(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.PUT, consts.Contacts); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	dup, err := contact.GetDuplicate(inst, c.Param("id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := dup.Dismiss(inst); err != nil {
+		return wrapError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UndoMerge is the handler for POST /contacts/merges/:id/undo. It restores
+// the two contacts as they were before the merge.
+func UndoMerge(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.PUT, consts.Contacts); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	record, err := contact.GetMerge(inst, c.Param("id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := record.Undo(inst); err != nil {
+		return wrapError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func wrapError(err error) error {
+	switch {
+	case errors.Is(err, contact.ErrDuplicateNotFound),
+		errors.Is(err, contact.ErrMergeNotFound),
+		errors.Is(err, contact.ErrImportNotFound),
+		errors.Is(err, contact.ErrNotFound):
+		return jsonapi.NotFound(err)
+	case errors.Is(err, contact.ErrInvalidFormat),
+		errors.Is(err, contact.ErrInvalidStrategy),
+		errors.Is(err, contact.ErrInvalidMapping):
+		return jsonapi.BadRequest(err)
+	case errors.Is(err, contact.ErrCannotMerge):
+		return jsonapi.Conflict(err)
+	case couchdb.IsNotFoundError(err):
+		return jsonapi.NotFound(err)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+type apiImport struct{ *contact.Import }
+
+func (i *apiImport) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/contacts/import/" + i.DocID}
+}
+func (i *apiImport) Relationships() jsonapi.RelationshipMap { return jsonapi.RelationshipMap{} }
+func (i *apiImport) Included() []jsonapi.Object             { return []jsonapi.Object{} }
+
+// importFormat returns the format of the file to import, from the format
+// parameter, or else from the Content-Type.
+func importFormat(c echo.Context) string {
+	if format := c.QueryParam("format"); format != "" {
+		return strings.ToLower(format)
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case "text/vcard", "text/x-vcard", "text/directory":
+		return contact.FormatVCard
+	case "text/csv":
+		return contact.FormatCSV
+	}
+	return ""
+}
+
+// ImportContacts is the handler for POST /contacts/import. It receives a
+// file of contacts (vCard or CSV), and pushes a job to import them. The
+// response is the import document, that can be used to follow the progress.
+func ImportContacts(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.Contacts); err != nil {
+		return err
+	}
+	imp := &contact.Import{
+		Format:   importFormat(c),
+		Strategy: c.QueryParam("strategy"),
+	}
+	if imp.Strategy == "" {
+		imp.Strategy = contact.StrategySkip
+	}
+	if param := c.QueryParam("mapping"); param != "" {
+		if err := json.Unmarshal([]byte(param), &imp.Mapping); err != nil {
+			return jsonapi.InvalidParameter("mapping", err)
+		}
+	}
+	if err := contact.CheckImportOptions(imp.Format, imp.Strategy, imp.Mapping); err != nil {
+		return wrapError(err)
+	}
+	if pdoc, err := middlewares.GetPermission(c); err == nil && pdoc.Type == permission.TypeWebapp {
+		imp.CreatedByApp = strings.TrimPrefix(pdoc.SourceID, consts.Apps+"/")
+	}
+
+	content, err := io.ReadAll(io.LimitReader(c.Request().Body, contact.MaxImportSize+1))
+	if err != nil {
+		return jsonapi.BadRequest(err)
+	}
+	if len(content) > contact.MaxImportSize {
+		return jsonapi.NewError(http.StatusRequestEntityTooLarge, "The file of contacts is too large")
+	}
+	if len(content) == 0 {
+		return jsonapi.BadRequest(errors.New("The file of contacts is empty"))
+	}
+
+	inst := middlewares.GetInstance(c)
+	if err := contact.StartImport(inst, imp, content); err != nil {
+		if errors.Is(err, vfs.ErrFileTooBig) {
+			return jsonapi.NewError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return wrapError(err)
+	}
+	return jsonapi.Data(c, http.StatusAccepted, &apiImport{imp}, nil)
+}
+
+// GetImport is the handler for GET /contacts/import/:id. It returns the
+// progress of an import.
+func GetImport(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Contacts); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	imp, err := contact.GetImport(inst, c.Param("id"))
+	if err != nil {
+		return wrapError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, &apiImport{imp}, nil)
+}
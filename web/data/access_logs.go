@@ -0,0 +1,35 @@
+package data
+
+import (
+	"strings"
+
+	"github.com/cozy/cozy-stack/model/accesslog"
+	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// recordAccess adds an entry to the access logs for a read on the given
+// doctype, if the user has enabled the access logs for this doctype.
+func recordAccess(c echo.Context, doctype, query string) {
+	inst := middlewares.GetInstance(c)
+	if !inst.HasAccessLogs(doctype) {
+		return
+	}
+	entry := &accesslog.Entry{Doctype: doctype, Query: query}
+	if perm, err := middlewares.GetPermission(c); err == nil {
+		entry.Kind = perm.Type
+		entry.Subject = perm.SourceID
+		if perm.Type == permission.TypeOauth {
+			if client, ok := perm.Client.(*oauth.Client); ok {
+				entry.Slug = client.SoftwareID
+			}
+		} else if strings.HasPrefix(perm.SourceID, consts.Apps+"/") ||
+			strings.HasPrefix(perm.SourceID, consts.Konnectors+"/") {
+			entry.Slug = perm.SourceID[strings.Index(perm.SourceID, "/")+1:]
+		}
+	}
+	accesslog.Record(inst, entry)
+}
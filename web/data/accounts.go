@@ -118,6 +118,7 @@ func updateAccount(c echo.Context) error {
 		}
 	}
 
+	account.ClearCredentialsNeeded(doc.M)
 	account.Encrypt(doc)
 
 	if doc.M["cozyMetadata"] == nil {
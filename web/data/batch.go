@@ -0,0 +1,279 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchOperations is the maximal number of operations in a batch.
+const maxBatchOperations = 100
+
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+)
+
+type batchOperation struct {
+	Op      string                 `json:"op"`
+	Doctype string                 `json:"doctype"`
+	ID      string                 `json:"id,omitempty"`
+	Rev     string                 `json:"rev,omitempty"`
+	Doc     map[string]interface{} `json:"doc,omitempty"`
+}
+
+type batchResult struct {
+	OK             bool                   `json:"ok"`
+	ID             string                 `json:"id,omitempty"`
+	Rev            string                 `json:"rev,omitempty"`
+	Type           string                 `json:"type,omitempty"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+	Deleted        bool                   `json:"deleted,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	Skipped        bool                   `json:"skipped,omitempty"`
+	RolledBack     bool                   `json:"rolled_back,omitempty"`
+	RollbackFailed bool                   `json:"rollback_failed,omitempty"`
+}
+
+// preparedOperation is an operation of a batch that has been validated. The
+// old document is kept to compensate the operation if a later one fails.
+type preparedOperation struct {
+	op  string
+	doc *couchdb.JSONDoc
+	old *couchdb.JSONDoc
+}
+
+// batch applies several operations on documents, possibly of different
+// doctypes, as a whole: if an operation fails, the operations already applied
+// are compensated in the reverse order, and the realtime events are only
+// published when all the operations have succeeded.
+func batch(c echo.Context) error {
+	var body struct {
+		Operations []batchOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.Errorf(http.StatusBadRequest, "%s", err)
+	}
+	if len(body.Operations) == 0 {
+		return jsonapi.Errorf(http.StatusBadRequest, "No operations")
+	}
+	if len(body.Operations) > maxBatchOperations {
+		return jsonapi.Errorf(http.StatusRequestEntityTooLarge,
+			"Too many operations (max %d)", maxBatchOperations)
+	}
+
+	// All the operations are checked before the first one is applied
+	prepared := make([]*preparedOperation, len(body.Operations))
+	for i, op := range body.Operations {
+		p, err := prepareBatchOperation(c, op)
+		if err != nil {
+			return echo.NewHTTPError(errorStatus(err), fmt.Sprintf("operation %d: %s", i, err))
+		}
+		prepared[i] = p
+	}
+	if err := checkBatchDocumentsQuotas(c, prepared); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	buffer := couchdb.BufferEvents(inst)
+	results := make([]batchResult, len(prepared))
+	for i, p := range prepared {
+		if err := applyBatchOperation(buffer, p); err != nil {
+			results[i] = batchResult{Type: p.doc.DocType(), ID: p.doc.ID(), Error: err.Error()}
+			for j := i + 1; j < len(prepared); j++ {
+				results[j] = batchResult{Type: prepared[j].doc.DocType(), Skipped: true}
+			}
+			for j := i - 1; j >= 0; j-- {
+				results[j].OK = false
+				results[j].Data = nil
+				if errb := rollbackBatchOperation(buffer, prepared[j]); errb != nil {
+					inst.Logger().WithNamespace("data").
+						Errorf("Cannot roll back the operation %d of a batch on %s %s: %s",
+							j, prepared[j].doc.DocType(), prepared[j].doc.ID(), errb)
+					results[j].RollbackFailed = true
+				} else {
+					results[j].RolledBack = true
+				}
+			}
+			buffer.Discard()
+			return c.JSON(errorStatus(err), echo.Map{
+				"ok":      false,
+				"results": results,
+			})
+		}
+		results[i] = batchResult{
+			OK:      true,
+			ID:      p.doc.ID(),
+			Rev:     p.doc.Rev(),
+			Type:    p.doc.DocType(),
+			Deleted: p.op == batchDelete,
+		}
+		if p.op != batchDelete {
+			results[i].Data = p.doc.ToMapWithType()
+		}
+	}
+	buffer.Flush()
+	return c.JSON(http.StatusOK, echo.Map{
+		"ok":      true,
+		"results": results,
+	})
+}
+
+func prepareBatchOperation(c echo.Context, op batchOperation) (*preparedOperation, error) {
+	if op.Doctype == "" {
+		return nil, jsonapi.Errorf(http.StatusBadRequest, "Missing doctype")
+	}
+	// Accounts are handled specifically to encrypt the auth fields, and they
+	// cannot be modified in a batch
+	if op.Doctype == consts.Accounts {
+		return nil, jsonapi.Errorf(http.StatusBadRequest, "Accounts cannot be modified in a batch")
+	}
+	if err := permission.CheckWritable(op.Doctype); err != nil {
+		return nil, err
+	}
+	inst := middlewares.GetInstance(c)
+
+	switch op.Op {
+	case batchCreate:
+		doc := &couchdb.JSONDoc{Type: op.Doctype, M: op.Doc}
+		if doc.M == nil {
+			doc.M = make(map[string]interface{})
+		}
+		if doc.Rev() != "" {
+			return nil, jsonapi.Errorf(http.StatusBadRequest, "No _rev should be given for a creation")
+		}
+		if err := middlewares.Allow(c, permission.POST, doc); err != nil {
+			return nil, err
+		}
+		return &preparedOperation{op: batchCreate, doc: doc}, nil
+
+	case batchUpdate:
+		doc := &couchdb.JSONDoc{Type: op.Doctype, M: op.Doc}
+		if doc.M == nil || doc.ID() == "" || doc.Rev() == "" {
+			return nil, jsonapi.Errorf(http.StatusBadRequest, "An _id and a _rev are required for an update")
+		}
+		old := &couchdb.JSONDoc{}
+		if err := couchdb.GetDoc(inst, op.Doctype, doc.ID(), old); err != nil {
+			return nil, fixErrorNoDatabaseIsWrongDoctype(err)
+		}
+		old.Type = op.Doctype
+		if err := middlewares.AllowWholeType(c, permission.PUT, op.Doctype); err != nil {
+			if err := middlewares.Allow(c, permission.PUT, old); err != nil {
+				return nil, err
+			}
+			if err := middlewares.Allow(c, permission.PUT, doc); err != nil {
+				return nil, err
+			}
+		}
+		return &preparedOperation{op: batchUpdate, doc: doc, old: old}, nil
+
+	case batchDelete:
+		if op.ID == "" || op.Rev == "" {
+			return nil, jsonapi.Errorf(http.StatusBadRequest, "An id and a rev are required for a deletion")
+		}
+		old := &couchdb.JSONDoc{}
+		if err := couchdb.GetDoc(inst, op.Doctype, op.ID, old); err != nil {
+			return nil, fixErrorNoDatabaseIsWrongDoctype(err)
+		}
+		old.Type = op.Doctype
+		doc := old.Clone().(*couchdb.JSONDoc)
+		doc.SetRev(op.Rev)
+		if err := middlewares.Allow(c, permission.DELETE, doc); err != nil {
+			return nil, err
+		}
+		// Reject the batch before applying anything if the deletion is
+		// forbidden, like for an instance under legal hold
+		if err := couchdb.CheckDeletion(inst, op.Doctype); err != nil {
+			return nil, err
+		}
+		return &preparedOperation{op: batchDelete, doc: doc, old: old}, nil
+	}
+
+	return nil, jsonapi.Errorf(http.StatusBadRequest, "Invalid op '%s'", op.Op)
+}
+
+// checkBatchDocumentsQuotas checks that the creations of the batch do not
+// exceed the maximal numbers of documents for their doctypes.
+func checkBatchDocumentsQuotas(c echo.Context, prepared []*preparedOperation) error {
+	creations := make(map[string]int)
+	var doctypes []string
+	for _, p := range prepared {
+		if p.op == batchCreate {
+			if creations[p.doc.DocType()] == 0 {
+				doctypes = append(doctypes, p.doc.DocType())
+			}
+			creations[p.doc.DocType()]++
+		}
+	}
+	for _, doctype := range doctypes {
+		if err := checkDocumentsQuota(c, doctype, creations[doctype]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyBatchOperation(buffer *couchdb.EventsBuffer, p *preparedOperation) error {
+	switch p.op {
+	case batchCreate:
+		if p.doc.ID() != "" {
+			return couchdb.CreateNamedDocWithDB(buffer, p.doc)
+		}
+		return couchdb.CreateDoc(buffer, p.doc)
+	case batchUpdate:
+		return couchdb.UpdateDocWithOld(buffer, p.doc, p.old)
+	case batchDelete:
+		return couchdb.DeleteDoc(buffer, p.doc)
+	}
+	return nil
+}
+
+// rollbackBatchOperation compensates an operation that has been applied. As
+// CouchDB has no transactions, it writes a new revision with the previous
+// content of the document.
+func rollbackBatchOperation(buffer *couchdb.EventsBuffer, p *preparedOperation) error {
+	switch p.op {
+	case batchCreate:
+		// The document has been created by this batch, so it can be deleted
+		// even if the instance is under legal hold.
+		return couchdb.DeleteDoc(couchdb.WithoutDeletionGuards(buffer), p.doc.Clone())
+	case batchUpdate:
+		restored := p.old.Clone().(*couchdb.JSONDoc)
+		restored.SetRev(p.doc.Rev())
+		return couchdb.UpdateDocWithOld(buffer, restored, p.doc)
+	case batchDelete:
+		// CouchDB accepts to create a document without a revision when the
+		// previous one has been deleted
+		restored := p.old.Clone().(*couchdb.JSONDoc)
+		restored.SetRev("")
+		return couchdb.CreateNamedDoc(buffer, restored)
+	}
+	return nil
+}
+
+// errorStatus returns the HTTP status for the error, in the same way as
+// couchdbStyleErrorHandler.
+func errorStatus(err error) int {
+	if err == instance.ErrLegalHold {
+		return http.StatusLocked
+	}
+	switch e := err.(type) {
+	case *couchdb.Error:
+		return e.StatusCode
+	case *echo.HTTPError:
+		return e.Code
+	case *jsonapi.Error:
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
@@ -3,12 +3,14 @@ package data
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/usage"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/couchdb/stream"
@@ -37,10 +39,27 @@ func ValidDoctype(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 		c.Set("docid", docid)
 
+		// The changes feed is the only way to read the files via the data
+		// API for an OAuth client with a sync scope, as it is filtered.
+		if doctype == consts.Files && middlewares.HasSyncScope(c) &&
+			!strings.HasSuffix(c.Path(), "/_changes") {
+			return middlewares.ErrForbidden
+		}
+
 		return next(c)
 	}
 }
 
+// checkDocumentsQuota returns an error if the maximal number of documents for
+// the doctype would be exceeded by the creation of count documents.
+func checkDocumentsQuota(c echo.Context, doctype string, count int) error {
+	err := usage.CheckDocumentsQuota(middlewares.GetInstance(c), doctype, count)
+	if errors.Is(err, usage.ErrDocumentsQuotaExceeded) {
+		return jsonapi.Errorf(http.StatusRequestEntityTooLarge, "%s", err)
+	}
+	return err
+}
+
 func fixErrorNoDatabaseIsWrongDoctype(err error) error {
 	if couchdb.IsNoDatabaseError(err) {
 		err.(*couchdb.Error).Reason = "wrong_doctype"
@@ -114,6 +133,8 @@ func getDoc(c echo.Context) error {
 		}
 	}
 
+	upgradeDoc(c, &out)
+	recordAccess(c, doctype, docid)
 	return c.JSON(http.StatusOK, out.ToMapWithType())
 }
 
@@ -140,6 +161,10 @@ func createDoc(c echo.Context) error {
 		return err
 	}
 
+	if err := checkDocumentsQuota(c, doctype, 1); err != nil {
+		return err
+	}
+
 	if err := couchdb.CreateDoc(instance, &doc); err != nil {
 		return err
 	}
@@ -161,6 +186,10 @@ func createNamedDoc(c echo.Context, doc couchdb.JSONDoc) error {
 		return err
 	}
 
+	if err := checkDocumentsQuota(c, doc.DocType(), 1); err != nil {
+		return err
+	}
+
 	err = couchdb.CreateNamedDocWithDB(instance, &doc)
 	if err != nil {
 		return fixErrorNoDatabaseIsWrongDoctype(err)
@@ -372,6 +401,14 @@ func findDocuments(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	// The documents can only be upgraded when all their fields are known
+	if _, hasFields := findRequest["fields"]; !hasFields {
+		upgradeDocs(c, doctype, results)
+	}
+	if selector, err := json.Marshal(findRequest["selector"]); err == nil {
+		recordAccess(c, doctype, string(selector))
+	}
+
 	// There might be more docs next when the returned docs reached the limit
 	next := len(results) >= int(limit)
 	out := echo.Map{
@@ -397,10 +434,11 @@ func allDocs(c echo.Context) error {
 	if err := middlewares.AllowWholeType(c, permission.GET, doctype); err != nil {
 		return err
 	}
+	recordAccess(c, doctype, "_all_docs")
 
 	if c.QueryParam("Fields") == "" && c.QueryParam("DesignDocs") == "" {
 		// Fast path, just proxy the request/response
-		return proxy(c, "_all_docs")
+		return proxyWithUpgrade(c, "_all_docs", allDocsOf)
 	}
 
 	inst := middlewares.GetInstance(c)
@@ -459,6 +497,7 @@ func normalDocs(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	recordAccess(c, doctype, "_normal_docs")
 	return c.JSON(http.StatusOK, res)
 }
 
@@ -572,6 +611,7 @@ func Routes(router *echo.Group) {
 	// API Routes that don't depend on a doctype
 	router.GET("/", dataAPIWelcome)
 	router.GET("/_all_doctypes", allDoctypes)
+	router.POST("/_batch", batch, middlewares.BulkEvents)
 
 	// API Routes under /:doctype
 	group := router.Group("/:doctype", ValidDoctype)
@@ -587,6 +627,7 @@ func Routes(router *echo.Group) {
 	group.GET("/_all_docs", allDocs)
 	group.POST("/_all_docs", allDocs)
 	group.GET("/_normal_docs", normalDocs)
+	group.GET("/_migration", getMigration)
 	group.POST("/_index", defineIndex)
 	group.POST("/_find", findDocuments)
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/tests/testutils"
@@ -987,6 +988,44 @@ func TestData(t *testing.T) {
 			ValueEqual("rev", rev)
 	})
 
+	t.Run("BatchRollbackUnderLegalHold", func(t *testing.T) {
+		e := testutils.CreateTestClient(t, ts.URL)
+
+		doc := getDocForTest(Type, testInstance)
+		require.NoError(t, lifecycle.StartLegalHold(testInstance, "Investigation", "Legal"))
+		defer func() { _ = lifecycle.EndLegalHold(testInstance) }()
+
+		// The creation is rolled back, as the update has a bad revision
+		obj := e.POST("/data/_batch").
+			WithHeader("Authorization", "Bearer "+token).
+			WithHeader("Content-Type", "application/json").
+			WithBytes([]byte(`{"operations": [
+				{"op": "create", "doctype": "` + Type + `", "doc": {"_id": "batch-under-hold", "test": "value"}},
+				{"op": "update", "doctype": "` + Type + `", "doc": {"_id": "` + doc.ID() + `", "_rev": "1-bad", "test": "other"}}
+			]}`)).
+			Expect().Status(409).
+			JSON().Object()
+		obj.ValueEqual("ok", false)
+		obj.Value("results").Array().Element(0).Object().ValueEqual("rolled_back", true)
+
+		var created couchdb.JSONDoc
+		err := couchdb.GetDoc(testInstance, Type, "batch-under-hold", &created)
+		assert.True(t, couchdb.IsNotFoundError(err))
+
+		// A batch with a deletion is rejected before any operation is applied
+		e.POST("/data/_batch").
+			WithHeader("Authorization", "Bearer "+token).
+			WithHeader("Content-Type", "application/json").
+			WithBytes([]byte(`{"operations": [
+				{"op": "create", "doctype": "` + Type + `", "doc": {"_id": "batch-with-delete", "test": "value"}},
+				{"op": "delete", "doctype": "` + Type + `", "id": "` + doc.ID() + `", "rev": "` + doc.Rev() + `"}
+			]}`)).
+			Expect().Status(423)
+
+		err = couchdb.GetDoc(testInstance, Type, "batch-with-delete", &created)
+		assert.True(t, couchdb.IsNotFoundError(err))
+	})
+
 	t.Run("DeleteDatabase", func(t *testing.T) {
 		e := testutils.CreateTestClient(t, ts.URL)
 
@@ -1019,3 +1058,18 @@ func getDocForTest(t string, instance *instance.Instance) *couchdb.JSONDoc {
 	_ = couchdb.CreateDoc(instance, &doc)
 	return &doc
 }
+
+func TestCountNewDocs(t *testing.T) {
+	assert.Equal(t, 2, countNewDocs([]byte(`{"docs":[
+		{"foo":"bar"},
+		{"_id":"named","foo":"baz"},
+		{"_id":"old","_rev":"2-abc","foo":"qux"},
+		{"_id":"gone","_deleted":true}
+	]}`)))
+	assert.Equal(t, 1, countNewDocs([]byte(`{"new_edits":false,"docs":[
+		{"_id":"new","_rev":"1-abc"},
+		{"_id":"old","_rev":"3-abc"},
+		{"_id":"gone","_rev":"1-def","_deleted":true}
+	]}`)))
+	assert.Equal(t, 0, countNewDocs([]byte(`not json`)))
+}
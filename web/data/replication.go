@@ -1,11 +1,16 @@
 package data
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/usage"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
@@ -67,7 +72,7 @@ func bulkGet(c echo.Context) error {
 		return err
 	}
 
-	return proxy(c, "_bulk_get")
+	return proxyWithUpgrade(c, "_bulk_get", bulkGetDocsOf)
 }
 
 func bulkDocs(c echo.Context) error {
@@ -82,6 +87,16 @@ func bulkDocs(c echo.Context) error {
 	}
 
 	instance := middlewares.GetInstance(c)
+	if _, ok := usage.DocumentsQuotas(instance)[doctype]; ok {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		c.Request().Body = io.NopCloser(bytes.NewReader(body))
+		if err := checkDocumentsQuota(c, doctype, countNewDocs(body)); err != nil {
+			return err
+		}
+	}
 	if err := couchdb.EnsureDBExist(instance, doctype); err != nil {
 		return err
 	}
@@ -102,6 +117,34 @@ func bulkDocs(c echo.Context) error {
 	return nil
 }
 
+// countNewDocs returns the number of documents that can be created by a
+// request to _bulk_docs: the documents without a revision, or with a first
+// revision when new_edits is false (replication), and that are not deleted.
+// An invalid body is rejected later by ProxyBulkDocs.
+func countNewDocs(body []byte) int {
+	var bulk struct {
+		Docs []struct {
+			Rev     string `json:"_rev"`
+			Deleted bool   `json:"_deleted"`
+		} `json:"docs"`
+		NewEdits *bool `json:"new_edits"`
+	}
+	if err := json.Unmarshal(body, &bulk); err != nil {
+		return 0
+	}
+	replication := bulk.NewEdits != nil && !*bulk.NewEdits
+	count := 0
+	for _, doc := range bulk.Docs {
+		if doc.Deleted {
+			continue
+		}
+		if doc.Rev == "" || (replication && strings.HasPrefix(doc.Rev, "1-")) {
+			count++
+		}
+	}
+	return count
+}
+
 func createDB(c echo.Context) error {
 	doctype := c.Param("doctype")
 
@@ -209,9 +252,15 @@ func changesFeed(c echo.Context) error {
 		return err
 	}
 
-	if err = middlewares.AllowWholeType(c, permission.GET, doctype); err != nil {
+	// The files outside of the sync scope of an OAuth client are filtered below
+	if err = middlewares.AllowFilteredFeed(c, permission.GET, doctype); err != nil {
 		return err
 	}
+	// Without the documents, the changes feed gives only the identifiers and
+	// revisions, and the documents are read later via the other routes.
+	if includeDocs {
+		recordAccess(c, doctype, "_changes")
+	}
 
 	// Use the VFS lock for the files to avoid sending the changed feed while
 	// the VFS is moving a directory.
@@ -247,12 +296,15 @@ func changesFeed(c echo.Context) error {
 
 	if doctype == consts.Files {
 		if client, ok := middlewares.GetOAuthClient(c); ok {
-			err = vfs.FilterNotSynchronizedDocs(instance.VFS(), client.ID(), results)
+			err = vfs.FilterNotSynchronizedDocs(instance.VFS(), client.ID(), client.SyncScope, results)
 			if err != nil {
 				return err
 			}
 		}
 	}
+	if includeDocs {
+		upgradeChanges(c, doctype, results)
+	}
 
 	return c.JSON(http.StatusOK, results)
 }
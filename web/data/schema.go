@@ -0,0 +1,192 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/schema"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// upgradeDoc migrates the document, in memory, to the last schema version of
+// its doctype, if it is an old document. The upgrade is persisted later by a
+// job. A failure is only logged, and the document is then returned as it is
+// in CouchDB.
+func upgradeDoc(c echo.Context, doc *couchdb.JSONDoc) {
+	if schema.LatestVersion(doc.DocType()) == 0 {
+		return
+	}
+	if upgradeMap(c, doc.DocType(), doc.M) {
+		schema.ScheduleUpgrade(middlewares.GetInstance(c), doc.DocType())
+	}
+}
+
+// upgradeDocs is like upgradeDoc, for the results of a query.
+func upgradeDocs(c echo.Context, doctype string, docs []couchdb.JSONDoc) {
+	if schema.LatestVersion(doctype) == 0 {
+		return
+	}
+	migrated := false
+	for i := range docs {
+		if upgradeMap(c, doctype, docs[i].M) {
+			migrated = true
+		}
+	}
+	if migrated {
+		schema.ScheduleUpgrade(middlewares.GetInstance(c), doctype)
+	}
+}
+
+func upgradeMap(c echo.Context, doctype string, doc map[string]interface{}) bool {
+	if doc == nil {
+		return false
+	}
+	migrated, err := schema.Migrate(doctype, doc)
+	if err != nil {
+		middlewares.GetInstance(c).Logger().WithNamespace("data").
+			Warnf("Cannot upgrade %s %v: %s", doctype, doc["_id"], err)
+	}
+	return migrated
+}
+
+// upgradeChanges is like upgradeDocs, for the documents of a changes feed.
+func upgradeChanges(c echo.Context, doctype string, changes *couchdb.ChangesResponse) {
+	if schema.LatestVersion(doctype) == 0 {
+		return
+	}
+	migrated := false
+	for i := range changes.Results {
+		if upgradeMap(c, doctype, changes.Results[i].Doc.M) {
+			migrated = true
+		}
+	}
+	if migrated {
+		schema.ScheduleUpgrade(middlewares.GetInstance(c), doctype)
+	}
+}
+
+// proxyWithUpgrade is like proxy, but the documents in the response from
+// CouchDB are migrated to the last schema version of their doctype. The
+// documents are found with the given function, that is specific to the
+// format of the response of the CouchDB endpoint.
+func proxyWithUpgrade(c echo.Context, path string, docsOf func(map[string]interface{}) []map[string]interface{}) error {
+	doctype := c.Param("doctype")
+	if schema.LatestVersion(doctype) == 0 {
+		return proxy(c, path)
+	}
+
+	instance := middlewares.GetInstance(c)
+	p := couchdb.Proxy(instance, doctype, path)
+	logger := instance.Logger().WithNamespace("data-proxy").Writer()
+	defer logger.Close()
+	p.ErrorLog = log.New(logger, "", 0)
+	p.ModifyResponse = func(res *http.Response) error {
+		ct := res.Header.Get(echo.HeaderContentType)
+		if res.StatusCode != http.StatusOK || !strings.HasPrefix(ct, echo.MIMEApplicationJSON) {
+			return nil
+		}
+		var body map[string]interface{}
+		decoder := json.NewDecoder(res.Body)
+		decoder.UseNumber()
+		err := decoder.Decode(&body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		migrated := false
+		for _, doc := range docsOf(body) {
+			if upgradeMap(c, doctype, doc) {
+				migrated = true
+			}
+		}
+		if migrated {
+			schema.ScheduleUpgrade(instance, doctype)
+		}
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		res.Body = io.NopCloser(bytes.NewReader(buf))
+		res.ContentLength = int64(len(buf))
+		res.Header.Set(echo.HeaderContentLength, strconv.Itoa(len(buf)))
+		res.Header.Del("Etag")
+		return nil
+	}
+	p.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// allDocsOf returns the documents of a response of _all_docs.
+func allDocsOf(body map[string]interface{}) []map[string]interface{} {
+	var docs []map[string]interface{}
+	rows, _ := body["rows"].([]interface{})
+	for _, row := range rows {
+		r, _ := row.(map[string]interface{})
+		if doc, ok := r["doc"].(map[string]interface{}); ok {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// bulkGetDocsOf returns the documents of a response of _bulk_get.
+func bulkGetDocsOf(body map[string]interface{}) []map[string]interface{} {
+	var docs []map[string]interface{}
+	results, _ := body["results"].([]interface{})
+	for _, result := range results {
+		r, _ := result.(map[string]interface{})
+		items, _ := r["docs"].([]interface{})
+		for _, item := range items {
+			i, _ := item.(map[string]interface{})
+			if doc, ok := i["ok"].(map[string]interface{}); ok {
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return docs
+}
+
+// getMigration returns the last schema version of the doctype, and the
+// progress of the migration of its documents on this instance.
+func getMigration(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	doctype := c.Param("doctype")
+	if err := permission.CheckReadable(doctype); err != nil {
+		return err
+	}
+	if err := middlewares.AllowWholeType(c, permission.GET, doctype); err != nil {
+		return err
+	}
+
+	progress, err := schema.GetProgress(inst, doctype)
+	if err != nil {
+		return err
+	}
+	total, err := couchdb.CountNormalDocs(inst, doctype)
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+	latest := schema.LatestVersion(doctype)
+	upgraded := 0
+	if latest > 0 && progress.Version == latest {
+		upgraded = progress.Upgraded
+	}
+	out := echo.Map{
+		"doctype":        doctype,
+		"latest_version": latest,
+		"upgraded":       upgraded,
+		"total":          total,
+	}
+	if upgraded > 0 {
+		out["last_upgraded_at"] = progress.LastUpgradedAt
+	}
+	return c.JSON(http.StatusOK, out)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/errcode"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/web/middlewares"
@@ -19,6 +20,10 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// codeLegalHold is the code of the error returned when a destructive
+// operation is tried on an instance under legal hold.
+var codeLegalHold = errcode.Register("instance.legal_hold", http.StatusLocked, "The instance is under legal hold and its data can't be deleted")
+
 // ErrorHandler is the default error handler of our APIs.
 func ErrorHandler(err error, c echo.Context) {
 	var je *jsonapi.Error
@@ -30,6 +35,8 @@ func ErrorHandler(err error, c echo.Context) {
 	var ok bool
 	if _, ok = err.(*echo.HTTPError); ok {
 		// nothing to do
+	} else if err == instance.ErrLegalHold {
+		je = codeLegalHold.New(err)
 	} else if os.IsExist(err) {
 		je = jsonapi.Conflict(err)
 	} else if os.IsNotExist(err) {
@@ -183,3 +190,14 @@ func HTMLErrorHandler(err error, c echo.Context) {
 		logger.WithNamespace("http").Errorf("%s %s %s", req.Method, req.URL.Path, err)
 	}
 }
+
+// ListCodes returns the codes that can be used in the errors returned by the
+// stack, with their HTTP status and a description.
+func ListCodes(c echo.Context) error {
+	return c.JSON(http.StatusOK, errcode.All())
+}
+
+// Routes sets the routing for the errors
+func Routes(router *echo.Group) {
+	router.GET("/codes", ListCodes)
+}
@@ -0,0 +1,131 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/app"
+	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// errCustomMetadataNamespace is used when an app tries to write in the
+// namespace of another app.
+var errCustomMetadataNamespace = errors.New("An app can only change its own custom metadata")
+
+// SetCustomMetadataHandler is the echo.handler for replacing the custom
+// metadata of an app on a file or directory.
+// PUT /files/:file-id/custom_metadata/:slug
+func SetCustomMetadataHandler(c echo.Context) error {
+	values := make(map[string]interface{})
+	if _, err := jsonapi.Bind(c.Request().Body, &values); err != nil {
+		return jsonapi.BadJSON()
+	}
+	return changeCustomMetadata(c, values)
+}
+
+// DeleteCustomMetadataHandler is the echo.handler for removing the custom
+// metadata of an app on a file or directory.
+// DELETE /files/:file-id/custom_metadata/:slug
+func DeleteCustomMetadataHandler(c echo.Context) error {
+	return changeCustomMetadata(c, nil)
+}
+
+// changeCustomMetadata replaces the namespace of the app with the given
+// values, or removes it if values is nil.
+func changeCustomMetadata(c echo.Context, values map[string]interface{}) error {
+	inst := middlewares.GetInstance(c)
+	slug := c.Param("slug")
+	requester, appType := customMetadataRequester(c)
+	if requester == "" || requester != slug {
+		return codeCustomMetadataOwner.New(errCustomMetadataNamespace)
+	}
+
+	fs := inst.VFS()
+	dir, file, err := fs.DirOrFileByID(c.Param("file-id"))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	if err := checkPerm(c, permission.PATCH, dir, file); err != nil {
+		return err
+	}
+	var rev string
+	if dir != nil {
+		rev = dir.Rev()
+	} else {
+		rev = file.Rev()
+	}
+	if err := CheckIfMatch(c, rev); err != nil {
+		return err
+	}
+
+	if values != nil {
+		man, err := app.GetBySlug(inst, slug, appType)
+		if err != nil {
+			return codeAppNotFound.New(err)
+		}
+		if err := man.CustomMetadata().Validate(values); err != nil {
+			return WrapVfsError(err)
+		}
+	}
+
+	if dir != nil {
+		newdir := dir.Clone().(*vfs.DirDoc)
+		newdir.CustomMetadata = withCustomMetadata(newdir.CustomMetadata, slug, values)
+		updateDirCozyMetadata(c, newdir)
+		if err := fs.UpdateDirDoc(dir, newdir); err != nil {
+			return WrapVfsError(err)
+		}
+		return dirData(c, http.StatusOK, newdir)
+	}
+
+	newfile := file.Clone().(*vfs.FileDoc)
+	newfile.CustomMetadata = withCustomMetadata(newfile.CustomMetadata, slug, values)
+	updateFileCozyMetadata(c, newfile, false)
+	if err := fs.UpdateFileDoc(file, newfile); err != nil {
+		return WrapVfsError(err)
+	}
+	return FileData(c, http.StatusOK, newfile, false, nil)
+}
+
+func withCustomMetadata(cm vfs.CustomMetadata, slug string, values map[string]interface{}) vfs.CustomMetadata {
+	if values == nil {
+		delete(cm, slug)
+		if len(cm) == 0 {
+			return nil
+		}
+		return cm
+	}
+	if cm == nil {
+		cm = make(vfs.CustomMetadata)
+	}
+	cm[slug] = values
+	return cm
+}
+
+// customMetadataRequester returns the slug and the type of the app that makes
+// the request, or an empty slug if the request does not come from an app.
+func customMetadataRequester(c echo.Context) (string, consts.AppType) {
+	claims, ok := c.Get("claims").(permission.Claims)
+	if !ok {
+		return "", consts.WebappType
+	}
+	switch claims.Audience {
+	case consts.AppAudience:
+		return claims.Subject, consts.WebappType
+	case consts.KonnectorAudience:
+		return claims.Subject, consts.KonnectorType
+	case consts.AccessTokenAudience:
+		if perms, err := middlewares.GetPermission(c); err == nil {
+			if cli, ok := perms.Client.(*oauth.Client); ok {
+				return oauth.GetLinkedAppSlug(cli.SoftwareID), consts.WebappType
+			}
+		}
+	}
+	return "", consts.WebappType
+}
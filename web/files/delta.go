@@ -0,0 +1,229 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultDeltaLimit   = 1000
+	maxDeltaLimit       = 10000
+	defaultDeltaTimeout = 30000
+	maxDeltaTimeout     = 60000
+)
+
+var allowedDeltaParams = map[string]bool{
+	"since":             true,
+	"limit":             true,
+	"feed":              true,
+	"timeout":           true,
+	"fields":            false,
+	"include_file_path": false,
+}
+
+// DeltaFeed is the handler for GET /files/_changes/delta. It is a changes
+// feed for the OAuth clients, like the desktop and mobile apps, where the
+// stack remembers the last sequence delivered to each client. A client can
+// omit the since parameter to continue from where it was, and can use
+// feed=longpoll to wait for the next changes.
+func DeltaFeed(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	// The files outside of the sync scope of an OAuth client are filtered
+	if err := middlewares.AllowFilteredFeed(c, permission.GET, consts.Files); err != nil {
+		return err
+	}
+	client, ok := middlewares.GetOAuthClient(c)
+	if !ok {
+		return codeDeltaNeedsOAuth.Errorf("The delta feed is only available for OAuth clients")
+	}
+
+	filter := &changesFilter{}
+	for key := range c.QueryParams() {
+		if byStack, ok := allowedDeltaParams[key]; !ok {
+			return codeInvalidParameter.Errorf("Unsupported query parameter '%s'", key)
+		} else if !byStack {
+			filter.Add(key, c.QueryParam(key))
+		}
+	}
+
+	limit, err := intQueryParam(c, "limit", defaultDeltaLimit, maxDeltaLimit)
+	if err != nil {
+		return err
+	}
+	timeout, err := intQueryParam(c, "timeout", defaultDeltaTimeout, maxDeltaTimeout)
+	if err != nil {
+		return err
+	}
+	longpoll := false
+	switch c.QueryParam("feed") {
+	case "", string(couchdb.ChangesModeNormal):
+	case string(couchdb.ChangesModeLongPoll):
+		longpoll = true
+	default:
+		return codeInvalidParameter.Errorf("Unsupported feed value '%s'", c.QueryParam("feed"))
+	}
+
+	collectCheckpoints(inst)
+
+	// When the client gives the since parameter, it means that it has
+	// processed the changes until this sequence. Without it, the feed resumes
+	// from the last acknowledged sequence (with the since parameter or the
+	// ack route), as the client may not have processed the last batch that
+	// was delivered to it.
+	acked := c.QueryParam("since")
+	since := acked
+	if since == "" {
+		checkpoint, err := vfs.GetCheckpoint(inst, client.ID())
+		if err != nil {
+			return err
+		}
+		if checkpoint != nil {
+			since = checkpoint.AckedSeq
+		}
+	}
+	if since != "" {
+		before, err := vfs.IsBeforeHorizon(inst, since)
+		if err != nil {
+			return err
+		}
+		if before {
+			return codeDeltaReset.Errorf("The sequence %s is older than the horizon of the changes feed", since)
+		}
+	}
+
+	results, err := fetchFilesChanges(inst, since, limit, filter)
+	if err != nil {
+		return err
+	}
+	if longpoll && len(results.Results) == 0 {
+		// The VFS lock is not kept while waiting for the next change.
+		waitReq := &couchdb.ChangesRequest{
+			DocType: consts.Files,
+			Feed:    couchdb.ChangesModeLongPoll,
+			Timeout: timeout,
+			Since:   results.LastSeq,
+			Limit:   1,
+			Filter:  "_selector",
+		}
+		waited, err := couchdb.PostChanges(inst, waitReq, &changesFilter{})
+		if err != nil {
+			return err
+		}
+		if len(waited.Results) > 0 {
+			results, err = fetchFilesChanges(inst, results.LastSeq, limit, filter)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := vfs.FilterNotSynchronizedDocs(inst.VFS(), client.ID(), client.SyncScope, results); err != nil {
+		return err
+	}
+	filter.AddPathIfAsked(inst, results)
+
+	if _, err := vfs.SaveCheckpoint(inst, client.ID(), acked, results.LastSeq); err != nil {
+		inst.Logger().WithNamespace("files").
+			Warnf("Cannot save the checkpoint for client %s: %s", client.ID(), err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// DeltaAck is the handler for POST /files/_changes/delta/ack. A client can
+// use it to acknowledge the changes that it has processed, until the given
+// sequence, without making a new request on the delta feed.
+func DeltaAck(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	if err := middlewares.AllowFilteredFeed(c, permission.GET, consts.Files); err != nil {
+		return err
+	}
+	client, ok := middlewares.GetOAuthClient(c)
+	if !ok {
+		return codeDeltaNeedsOAuth.Errorf("The delta feed is only available for OAuth clients")
+	}
+
+	var body struct {
+		Seq string `json:"seq"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil || body.Seq == "" {
+		return jsonapi.BadJSON()
+	}
+	if _, err := vfs.AckCheckpoint(inst, client.ID(), body.Seq); err != nil {
+		if errors.Is(err, vfs.ErrSeqNotDelivered) {
+			return codeDeltaNotDelivered.Errorf("%s", err)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkpointsCollectedTTL is how long the stack waits before garbage-
+// collecting again the checkpoints of an instance.
+const checkpointsCollectedTTL = 24 * time.Hour
+
+// collectCheckpoints removes the checkpoints of the clients that have not been
+// seen for a long time, and moves the horizon of the changes feed, at most
+// once a day per instance.
+func collectCheckpoints(inst *instance.Instance) {
+	cache := config.GetConfig().CacheStorage
+	cacheKey := "files-checkpoints-collected:" + inst.Domain
+	if _, ok := cache.Get(cacheKey); ok {
+		return
+	}
+	if err := vfs.CollectCheckpoints(inst, vfs.CheckpointRetention); err != nil {
+		inst.Logger().WithNamespace("files").
+			Warnf("Cannot collect the checkpoints: %s", err)
+		return
+	}
+	cache.Set(cacheKey, []byte("1"), checkpointsCollectedTTL)
+}
+
+// fetchFilesChanges returns a batch of the changes feed for io.cozy.files,
+// with the documents. The VFS lock is used to avoid sending the changes feed
+// while the VFS is moving a directory.
+func fetchFilesChanges(inst *instance.Instance, since string, limit int, filter *changesFilter) (*couchdb.ChangesResponse, error) {
+	mu := config.Lock().ReadWrite(inst, "vfs")
+	if err := mu.Lock(); err != nil {
+		return nil, err
+	}
+	defer mu.Unlock()
+
+	filter.reader = nil
+	couchReq := &couchdb.ChangesRequest{
+		DocType:     consts.Files,
+		Since:       since,
+		Limit:       limit,
+		IncludeDocs: true,
+		Filter:      "_selector",
+	}
+	return couchdb.PostChanges(inst, couchReq, filter)
+}
+
+func intQueryParam(c echo.Context, name string, defaultValue, maxValue int) (int, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil || value < 0 {
+		return 0, codeInvalidParameter.Errorf("Invalid %s value '%s'", name, param)
+	}
+	if value > maxValue {
+		value = maxValue
+	}
+	return value, nil
+}
@@ -0,0 +1,169 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/errcode"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/ncw/swift/v2"
+)
+
+// Codes of the errors returned by the files routes.
+var (
+	codeInvalidDocType         = errcode.Register("files.invalid_doctype", http.StatusUnprocessableEntity, "The type of the document is not a file or a directory")
+	codeAlreadyExists          = errcode.Register("files.already_exists", http.StatusConflict, "A file or directory with the same name already exists")
+	codeNotFound               = errcode.Register("files.not_found", http.StatusNotFound, "The file or directory has not been found")
+	codeParentNotFound         = errcode.Register("files.parent_not_found", http.StatusNotFound, "The parent directory has not been found")
+	codeParentInTrash          = errcode.Register("files.parent_in_trash", http.StatusNotFound, "The parent directory is in the trash")
+	codeInvalidRestoreStrategy = errcode.Register("files.invalid_restore_strategy", http.StatusUnprocessableEntity, "The strategy to restore a file is invalid")
+	codeForbiddenMove          = errcode.Register("files.forbidden_move", http.StatusPreconditionFailed, "A directory can't be moved inside itself")
+	codeIllegalName            = errcode.Register("files.illegal_name", http.StatusUnprocessableEntity, "The name of the file is invalid")
+	codeIllegalPath            = errcode.Register("files.illegal_path", http.StatusUnprocessableEntity, "The path is invalid")
+	codeIllegalMime            = errcode.Register("files.illegal_mime", http.StatusUnprocessableEntity, "The mime type is invalid")
+	codeIllegalTime            = errcode.Register("files.illegal_time", http.StatusUnprocessableEntity, "The date of the file is invalid")
+	codeInvalidHash            = errcode.Register("files.invalid_hash", http.StatusPreconditionFailed, "The checksum of the content doesn't match its Content-MD5")
+	codeContentLengthMismatch  = errcode.Register("files.content_length_mismatch", http.StatusPreconditionFailed, "The size of the content doesn't match its Content-Length")
+	codeConflict               = errcode.Register("files.conflict", http.StatusConflict, "The file has been modified in the meantime")
+	codeFileInTrash            = errcode.Register("files.file_in_trash", http.StatusBadRequest, "The file is in the trash")
+	codeNonAbsolutePath        = errcode.Register("files.non_absolute_path", http.StatusBadRequest, "The path is not absolute")
+	codeDirNotEmpty            = errcode.Register("files.dir_not_empty", http.StatusBadRequest, "The directory is not empty")
+	codeFileTooBig             = errcode.Register("files.file_too_big", http.StatusRequestEntityTooLarge, "The file is too big for the disk quota or the maximal file size")
+	codeWrongToken             = errcode.Register("files.wrong_token", http.StatusBadRequest, "The download token is invalid or has expired")
+	codeInvalidMetadataID      = errcode.Register("files.invalid_metadata_id", http.StatusUnprocessableEntity, "The identifier of the metadata is invalid")
+	codeSnapshotNameMissing    = errcode.Register("files.snapshot_name_missing", http.StatusUnprocessableEntity, "The name of the snapshot is missing")
+	codeSnapshotNotReady       = errcode.Register("files.snapshot_not_ready", http.StatusConflict, "The snapshot is not ready yet")
+	codeArchiveTooBig          = errcode.Register("files.archive_too_big", http.StatusRequestEntityTooLarge, "The archive has too many files or is too big")
+	codeArchiveNotReady        = errcode.Register("files.archive_not_ready", http.StatusConflict, "The prepared archive is not ready yet")
+	codeCustomMetadataInvalid  = errcode.Register("files.invalid_custom_metadata", http.StatusUnprocessableEntity, "The custom metadata don't match the schema of the app")
+	codeCustomMetadataNoSchema = errcode.Register("files.custom_metadata_no_schema", http.StatusForbidden, "The app has not declared a schema for its custom metadata")
+	codeCustomMetadataOwner    = errcode.Register("files.custom_metadata_owner", http.StatusForbidden, "An app can only change its own custom metadata")
+	codeAppNotFound            = errcode.Register("files.app_not_found", http.StatusNotFound, "The app has not been found")
+	codeRevisionMismatch       = errcode.Register("files.revision_mismatch", http.StatusPreconditionFailed, "The revision doesn't match the If-Match header")
+	codeInvalidParameter       = errcode.Register("files.invalid_parameter", http.StatusBadRequest, "A query-string parameter is invalid or not supported")
+	codeDeltaNeedsOAuth        = errcode.Register("files.delta_needs_oauth", http.StatusForbidden, "The delta feed is only available for OAuth clients")
+	codeDeltaReset             = errcode.Register("files.delta_reset", http.StatusGone, "The sequence is older than the horizon of the changes feed, a full synchronization is needed")
+	codeDeltaNotDelivered      = errcode.Register("files.delta_not_delivered", http.StatusUnprocessableEntity, "The sequence has not been delivered to this client")
+	codeNotADirectory          = errcode.Register("files.not_a_directory", http.StatusBadRequest, "The operation is only possible on a directory")
+	codeNotInPhotoGroup        = errcode.Register("files.not_in_photo_group", http.StatusNotFound, "The file is not part of a live photo or burst")
+	codeImportInvalid          = errcode.Register("files.invalid_import", http.StatusBadRequest, "The import from a cloud provider can't be started")
+	codeImportConflict         = errcode.Register("files.import_conflict", http.StatusConflict, "The import from a cloud provider is finished or can't be resumed")
+	codeImportNotFound         = errcode.Register("files.import_not_found", http.StatusNotFound, "The import from a cloud provider has not been found")
+	codeMissingAccount         = errcode.Register("files.missing_account", http.StatusUnprocessableEntity, "The account for the import is missing")
+	codePreviewNotFound        = errcode.Register("files.preview_not_found", http.StatusNotFound, "The preview is not available")
+	codePreviewBusy            = errcode.Register("files.preview_busy", http.StatusServiceUnavailable, "Too many previews are being generated, retry later")
+	codePreviewFailed          = errcode.Register("files.preview_failed", http.StatusInternalServerError, "The preview can't be generated")
+	codeQuarantined            = errcode.Register("files.quarantined", http.StatusForbidden, "The file has been quarantined and its content can't be downloaded")
+	codeInvalidScanStatus      = errcode.Register("files.invalid_scan_status", http.StatusUnprocessableEntity, "The scan status must be pending, clean or quarantined")
+	codeLegalHold              = errcode.Register("files.legal_hold", http.StatusLocked, "The instance is under legal hold and its files can't be destroyed")
+	codeInternal               = errcode.Register("files.internal_error", http.StatusInternalServerError, "An internal error has happened")
+
+	// The codes for the upload policies are the name of the violated rules,
+	// as they were used before the codes were introduced.
+	codeUploadRules = map[string]*errcode.Code{
+		vfs.UploadRuleExtension: errcode.Register(vfs.UploadRuleExtension, http.StatusUnprocessableEntity, "The upload policy blocks this file extension"),
+		vfs.UploadRuleMime:      errcode.Register(vfs.UploadRuleMime, http.StatusUnprocessableEntity, "The upload policy blocks this mime type"),
+		vfs.UploadRuleSize:      errcode.Register(vfs.UploadRuleSize, http.StatusUnprocessableEntity, "The upload policy blocks the files of this size"),
+	}
+)
+
+// WrapVfsError returns a formatted error from a golang error emitted by the vfs
+func WrapVfsError(err error) error {
+	if errj := wrapVfsError(err); errj != nil {
+		return errj
+	}
+	return err
+}
+
+func wrapVfsErrorJSONAPI(err error) *jsonapi.Error {
+	if errj := wrapVfsError(err); errj != nil {
+		return errj
+	}
+	return codeInternal.New(err)
+}
+
+func wrapVfsError(err error) *jsonapi.Error {
+	var policyErr *vfs.UploadPolicyError
+	if errors.As(err, &policyErr) {
+		code, ok := codeUploadRules[policyErr.Rule]
+		if !ok {
+			code = codeUploadRules[vfs.UploadRuleExtension]
+		}
+		jerr := code.WithDetails(err, map[string]interface{}{
+			"rule":  policyErr.Rule,
+			"value": policyErr.Value,
+		})
+		jerr.Title = "Upload blocked"
+		return jerr
+	}
+	var customErr *vfs.CustomMetadataError
+	if errors.As(err, &customErr) {
+		return codeCustomMetadataInvalid.Attribute("custom_metadata", err)
+	}
+	switch err {
+	case ErrDocTypeInvalid:
+		return codeInvalidDocType.Attribute("type", err)
+	case os.ErrExist:
+		return codeAlreadyExists.New(err)
+	case os.ErrNotExist, swift.ObjectNotFound:
+		return codeNotFound.New(err)
+	case vfs.ErrParentDoesNotExist:
+		return codeParentNotFound.New(err)
+	case vfs.ErrParentInTrash:
+		return codeParentInTrash.New(err)
+	case vfs.ErrInvalidRestoreStrategy:
+		return codeInvalidRestoreStrategy.Parameter("strategy", err)
+	case vfs.ErrForbiddenDocMove:
+		return codeForbiddenMove.Parameter("dir-id", err)
+	case vfs.ErrIllegalFilename:
+		return codeIllegalName.Parameter("name", err)
+	case vfs.ErrIllegalPath:
+		return codeIllegalPath.Parameter("path", err)
+	case vfs.ErrIllegalMime:
+		return codeIllegalMime.Parameter("mime", err)
+	case vfs.ErrIllegalTime:
+		return codeIllegalTime.Parameter("UpdatedAt", err)
+	case vfs.ErrInvalidHash:
+		return codeInvalidHash.Parameter("Content-MD5", err)
+	case vfs.ErrContentLengthMismatch:
+		return codeContentLengthMismatch.Parameter("Content-Length", err)
+	case vfs.ErrConflict:
+		return codeConflict.New(err)
+	case vfs.ErrFileInTrash:
+		return codeFileInTrash.New(err)
+	case vfs.ErrNonAbsolutePath:
+		return codeNonAbsolutePath.New(err)
+	case vfs.ErrDirNotEmpty:
+		return codeDirNotEmpty.New(err)
+	case vfs.ErrFileTooBig, vfs.ErrMaxFileSize:
+		return codeFileTooBig.New(err)
+	case vfs.ErrWrongToken:
+		return codeWrongToken.New(err)
+	case vfs.ErrInvalidMetadataID:
+		return codeInvalidMetadataID.Parameter("MetadataID", err)
+	case vfs.ErrSnapshotNameMissing:
+		return codeSnapshotNameMissing.Attribute("name", err)
+	case vfs.ErrSnapshotNotReady:
+		return codeSnapshotNotReady.New(err)
+	case vfs.ErrArchiveTooBig:
+		return codeArchiveTooBig.New(err)
+	case vfs.ErrArchiveNotReady:
+		return codeArchiveNotReady.New(err)
+	case vfs.ErrCustomMetadataNoSchema:
+		return codeCustomMetadataNoSchema.New(err)
+	case vfs.ErrFileQuarantined:
+		return codeQuarantined.New(err)
+	case vfs.ErrInvalidScanStatus:
+		return codeInvalidScanStatus.Attribute("status", err)
+	case instance.ErrLegalHold:
+		return codeLegalHold.New(err)
+	}
+	if _, ok := err.(*jsonapi.Error); !ok {
+		logger.WithNamespace("files").Warnf("Not wrapped error: %s", err)
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/model/note"
 	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/office"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/cozy-stack/model/vfs"
@@ -31,15 +32,14 @@ import (
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/cozy/cozy-stack/pkg/limits"
-	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/metadata"
 	"github.com/cozy/cozy-stack/pkg/utils"
 	"github.com/cozy/cozy-stack/web/middlewares"
 	"github.com/cozy/cozy-stack/worker/thumbnail"
 	"github.com/labstack/echo/v4"
-	"github.com/ncw/swift/v2"
 )
 
 type docPatch struct {
@@ -244,6 +244,7 @@ func OverwriteFileContentHandler(c echo.Context) error {
 	}
 
 	newdoc.ReferencedBy = olddoc.ReferencedBy
+	newdoc.CustomMetadata = olddoc.CustomMetadata
 
 	if err := CheckIfMatch(c, olddoc.Rev()); err != nil {
 		return WrapVfsError(err)
@@ -275,6 +276,9 @@ func OverwriteFileContentHandler(c echo.Context) error {
 		return FileData(c, http.StatusOK, newdoc, true, nil)
 	}
 
+	ensureCleanOldVersionsTrigger(instance)
+	ensureTieringTrigger(instance)
+
 	file, err := instance.VFS().CreateFile(newdoc, olddoc)
 	if err != nil {
 		return WrapVfsError(err)
@@ -799,7 +803,7 @@ func GetChildrenHandler(c echo.Context) error {
 	}
 
 	if file != nil {
-		return jsonapi.Errorf(http.StatusBadRequest, "cant read children of file %v", fileID)
+		return codeNotADirectory.Errorf("cant read children of file %v", fileID)
 	}
 
 	return dirDataList(c, http.StatusOK, dir)
@@ -946,6 +950,9 @@ func RevertFileVersion(c echo.Context) error {
 	if err = inst.VFS().RevertFileVersion(doc, version); err != nil {
 		return WrapVfsError(err)
 	}
+	if version.Cold {
+		pushRetrieveJob(inst, doc.DocID)
+	}
 
 	return FileData(c, http.StatusOK, doc, true, nil)
 }
@@ -982,7 +989,7 @@ func IconHandler(c echo.Context) error {
 		return WrapVfsError(err)
 	}
 	if c.Param("file-id") != fileID {
-		return jsonapi.NewError(http.StatusBadRequest, "Wrong download token")
+		return codeWrongToken.New(vfs.ErrWrongToken)
 	}
 
 	doc, err := instance.VFS().FileByID(fileID)
@@ -1003,7 +1010,7 @@ func PreviewHandler(c echo.Context) error {
 		return WrapVfsError(err)
 	}
 	if c.Param("file-id") != fileID {
-		return jsonapi.NewError(http.StatusBadRequest, "Wrong download token")
+		return codeWrongToken.New(vfs.ErrWrongToken)
 	}
 
 	doc, err := instance.VFS().FileByID(fileID)
@@ -1024,13 +1031,16 @@ func ThumbnailHandler(c echo.Context) error {
 		return WrapVfsError(err)
 	}
 	if c.Param("file-id") != fileID {
-		return jsonapi.NewError(http.StatusBadRequest, "Wrong download token")
+		return codeWrongToken.New(vfs.ErrWrongToken)
 	}
 
 	doc, err := instance.VFS().FileByID(fileID)
 	if err != nil {
 		return WrapVfsError(err)
 	}
+	if doc.Quarantined() {
+		return WrapVfsError(vfs.ErrFileQuarantined)
+	}
 
 	fs := instance.ThumbsFS()
 	format := c.Param("format")
@@ -1051,6 +1061,81 @@ func ThumbnailHandler(c echo.Context) error {
 	return nil
 }
 
+// OfficePreviewHandler serves the preview of an office document, converted
+// to PDF, or a page of this preview as a PNG image when the page parameter is
+// given. It can be used with a sharecode.
+func OfficePreviewHandler(c echo.Context) error {
+	instance := middlewares.GetInstance(c)
+	perm, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+
+	fileID := c.Param("file-id")
+	doc, err := instance.VFS().FileByID(fileID)
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	if err := checkPerm(c, permission.GET, nil, doc); err != nil {
+		return err
+	}
+
+	// Limiting the number of public share link consultations
+	if perm.Type == permission.TypeShareByLink {
+		err = config.GetRateLimiter().CheckRateLimitKey(fileID, limits.SharingPublicLinkType)
+		if limits.IsLimitReachedOrExceeded(err) {
+			return err
+		}
+	}
+
+	modtime := doc.UpdatedAt
+	if doc.CozyMetadata != nil && doc.CozyMetadata.UploadedAt != nil {
+		modtime = *doc.CozyMetadata.UploadedAt
+	}
+
+	if p := c.QueryParam("page"); p != "" {
+		page, err := strconv.Atoi(p)
+		if err != nil {
+			return jsonapi.InvalidParameter("page", err)
+		}
+		buf, pages, err := office.PreviewPage(instance, doc, page)
+		if pages > 0 {
+			c.Response().Header().Set(officePreviewPagesHeader, strconv.Itoa(pages))
+		}
+		if err != nil {
+			return wrapOfficePreviewError(err)
+		}
+		name := fmt.Sprintf("%s-page-%d.png", doc.ID(), page)
+		http.ServeContent(c.Response(), c.Request(), name, modtime, bytes.NewReader(buf.Bytes()))
+		return nil
+	}
+
+	buf, err := office.PreviewPDF(instance, doc)
+	if err != nil {
+		return wrapOfficePreviewError(err)
+	}
+	c.Response().Header().Set(officePreviewPagesHeader, strconv.Itoa(office.CountPDFPages(buf.Bytes())))
+	name := fmt.Sprintf("%s-preview.pdf", doc.ID())
+	http.ServeContent(c.Response(), c.Request(), name, modtime, bytes.NewReader(buf.Bytes()))
+	return nil
+}
+
+// officePreviewPagesHeader is the HTTP header with the number of pages of the
+// preview of an office document.
+const officePreviewPagesHeader = "X-Cozy-Pages"
+
+func wrapOfficePreviewError(err error) error {
+	switch err {
+	case office.ErrInvalidFile, office.ErrPreviewDisabled, office.ErrPreviewPageNotFound:
+		return codePreviewNotFound.New(err)
+	case office.ErrPreviewBusy:
+		return codePreviewBusy.New(err)
+	case office.ErrPreviewFailed:
+		return codePreviewFailed.New(err)
+	}
+	return WrapVfsError(err)
+}
+
 func serveThumbnailPlaceholder(res http.ResponseWriter, req *http.Request, doc *vfs.FileDoc, format string) error {
 	if !utils.IsInArray(format, vfs.ThumbnailFormatNames) {
 		return echo.NewHTTPError(http.StatusNotFound, "Format does not exist")
@@ -1150,6 +1235,10 @@ func ArchiveDownloadCreateHandler(c echo.Context) error {
 		return archive.Serve(instance.VFS(), c.Response())
 	}
 
+	if archive.Async {
+		return prepareArchive(c, archive, entries)
+	}
+
 	secret, err := vfs.GetStore().AddArchive(instance, archive)
 	if err != nil {
 		return WrapVfsError(err)
@@ -1310,6 +1399,7 @@ func TrashHandler(c echo.Context) error {
 	}
 
 	ensureCleanOldTrashedTrigger(instance)
+	ensureTieringTrigger(instance)
 
 	if dir != nil {
 		updateDirCozyMetadata(c, dir)
@@ -1363,23 +1453,88 @@ func RestoreTrashFileHandler(c echo.Context) error {
 		return err
 	}
 
+	opts, err := restoreOptions(c)
+	if err != nil {
+		return err
+	}
+
 	if dir != nil {
 		updateDirCozyMetadata(c, dir)
-		doc, errt := vfs.RestoreDir(instance.VFS(), dir)
+		doc, errt := vfs.RestoreDir(instance.VFS(), dir, opts)
 		if errt != nil {
 			return WrapVfsError(errt)
 		}
+		if vfs.ContextTieringPolicy(instance.ContextName).TrashAfter > 0 {
+			pushRetrieveJob(instance, doc.DocID)
+		}
 		return dirData(c, http.StatusOK, doc)
 	}
 
 	updateFileCozyMetadata(c, file, false)
-	doc, errt := vfs.RestoreFile(instance.VFS(), file)
+	doc, errt := vfs.RestoreFile(instance.VFS(), file, opts)
 	if errt != nil {
 		return WrapVfsError(errt)
 	}
+	if doc.Cold {
+		pushRetrieveJob(instance, doc.DocID)
+	}
 	return FileData(c, http.StatusOK, doc, false, nil)
 }
 
+// RestorePreviewHandler handles GET requests on /files/trash/:file-id/preview
+// and can be used to know what will happen when a file or directory is
+// restored from the trash with the given strategy.
+func RestorePreviewHandler(c echo.Context) error {
+	instance := middlewares.GetInstance(c)
+
+	dir, file, err := instance.VFS().DirOrFileByID(c.Param("file-id"))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+
+	err = checkPerm(c, permission.GET, dir, file)
+	if err != nil {
+		return err
+	}
+
+	opts, err := restoreOptions(c)
+	if err != nil {
+		return err
+	}
+
+	var preview *vfs.RestorePreview
+	if dir != nil {
+		preview, err = vfs.PreviewRestoreDir(instance.VFS(), dir, opts)
+	} else {
+		preview, err = vfs.PreviewRestoreFile(instance.VFS(), file, opts)
+	}
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	return c.JSON(http.StatusOK, preview)
+}
+
+// restoreOptions reads the strategy for restoring a file or directory from
+// the trash in the query-string, and checks that the destination directory
+// can be written.
+func restoreOptions(c echo.Context) (*vfs.RestoreOptions, error) {
+	opts := &vfs.RestoreOptions{
+		Strategy: c.QueryParam("strategy"),
+		DirID:    c.QueryParam("dir_id"),
+		Name:     c.QueryParam("name"),
+	}
+	if opts.DirID != "" {
+		dest, err := middlewares.GetInstance(c).VFS().DirByID(opts.DirID)
+		if err != nil {
+			return nil, WrapVfsError(err)
+		}
+		if err := checkPerm(c, permission.PATCH, dest, nil); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
 // ClearTrashHandler handles DELETE request to clear the trash
 func ClearTrashHandler(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
@@ -1622,7 +1777,8 @@ var allowedChangesParams = map[string]bool{
 // changes feed of CouchDB with some additional options, like skip_trashed.
 func ChangesFeed(c echo.Context) error {
 	inst := middlewares.GetInstance(c)
-	if err := middlewares.AllowWholeType(c, permission.GET, consts.Files); err != nil {
+	// The files outside of the sync scope of an OAuth client are filtered
+	if err := middlewares.AllowFilteredFeed(c, permission.GET, consts.Files); err != nil {
 		return err
 	}
 
@@ -1630,7 +1786,7 @@ func ChangesFeed(c echo.Context) error {
 	filter := &changesFilter{}
 	for key := range c.QueryParams() {
 		if byCouch, ok := allowedChangesParams[key]; !ok {
-			return jsonapi.Errorf(http.StatusBadRequest, "Unsupported query parameter '%s'", key)
+			return codeInvalidParameter.Errorf("Unsupported query parameter '%s'", key)
 		} else if !byCouch {
 			filter.Add(key, c.QueryParam(key))
 		}
@@ -1641,7 +1797,7 @@ func ChangesFeed(c echo.Context) error {
 	if limitString != "" {
 		var err error
 		if limit, err = strconv.Atoi(limitString); err != nil {
-			return jsonapi.Errorf(http.StatusBadRequest, "Invalid limit value '%s': %s", limitString, err.Error())
+			return codeInvalidParameter.Errorf("Invalid limit value '%s': %s", limitString, err.Error())
 		}
 		if limit > 10000 {
 			limit = 10000
@@ -1650,7 +1806,7 @@ func ChangesFeed(c echo.Context) error {
 
 	includeDocs := c.QueryParam("include_docs") == "true"
 	if !includeDocs && (filter.IncludePath || filter.SkipTrashed) {
-		return jsonapi.Errorf(http.StatusBadRequest, "Invalid options: include_docs should be set to true")
+		return codeInvalidParameter.Errorf("Invalid options: include_docs should be set to true")
 	}
 
 	// Use the VFS lock for the files to avoid sending the changed feed while
@@ -1674,7 +1830,7 @@ func ChangesFeed(c echo.Context) error {
 	}
 
 	if client, ok := middlewares.GetOAuthClient(c); ok {
-		err = vfs.FilterNotSynchronizedDocs(inst.VFS(), client.ID(), results)
+		err = vfs.FilterNotSynchronizedDocs(inst.VFS(), client.ID(), client.SyncScope, results)
 		if err != nil {
 			return err
 		}
@@ -1755,15 +1911,8 @@ func (filter *changesFilter) AddPathIfAsked(inst *instance.Instance, results *co
 }
 
 func (filter *changesFilter) Body() []byte {
-	selector := map[string]interface{}{
-		"_id": map[string]interface{}{
-			"$not": map[string]interface{}{
-				"$regex": "^_design/",
-			},
-		},
-	}
 	payload := map[string]interface{}{
-		"selector": selector,
+		"selector": mango.Not(mango.Regex("_id", "^_design/")),
 	}
 
 	// Cf https://github.com/apache/couchdb/discussions/3774#discussioncomment-1416510
@@ -1854,8 +2003,22 @@ func Routes(router *echo.Group) {
 	router.POST("/:file-id/versions", CopyVersionHandler)
 	router.DELETE("/versions", ClearOldVersions)
 
+	router.POST("/snapshots", CreateSnapshotHandler)
+	router.GET("/snapshots", ListSnapshotsHandler)
+	router.GET("/snapshots/:id", GetSnapshotHandler)
+	router.DELETE("/snapshots/:id", DeleteSnapshotHandler)
+	router.POST("/snapshots/:id/restore", RestoreSnapshotHandler)
+
+	router.POST("/imports", CreateImportHandler)
+	router.GET("/imports", ListImportsHandler)
+	router.GET("/imports/:id", GetImportHandler)
+	router.POST("/imports/:id/resume", ResumeImportHandler)
+	router.DELETE("/imports/:id", CancelImportHandler)
+
 	router.POST("/_find", FindFilesMango)
 	router.GET("/_changes", ChangesFeed)
+	router.GET("/_changes/delta", DeltaFeed)
+	router.POST("/_changes/delta/ack", DeltaAck)
 
 	router.HEAD("/:file-id", HeadDirOrFile)
 
@@ -1863,23 +2026,27 @@ func Routes(router *echo.Group) {
 	router.GET("/:file-id", ReadMetadataFromIDHandler)
 	router.GET("/:file-id/relationships/contents", GetChildrenHandler)
 	router.GET("/:file-id/size", GetDirSize)
+	router.GET("/:file-id/photo_group", PhotoGroupHandler)
 
 	router.PATCH("/metadata", ModifyMetadataByPathHandler)
 	router.PATCH("/:file-id", ModifyMetadataByIDHandler)
-	router.PATCH("/", ModifyMetadataByIDInBatchHandler)
+	router.PATCH("/", ModifyMetadataByIDInBatchHandler, middlewares.BulkEvents)
 
-	router.POST("/", CreationHandler)
-	router.POST("/:file-id", CreationHandler)
+	router.POST("/", CreationHandler, middlewares.Idempotent)
+	router.POST("/:file-id", CreationHandler, middlewares.Idempotent)
 	router.PUT("/:file-id", OverwriteFileContentHandler)
 	router.POST("/upload/metadata", UploadMetadataHandler)
 	router.POST("/:file-id/copy", FileCopyHandler)
 
 	router.GET("/:file-id/icon/:secret", IconHandler)
+	router.GET("/:file-id/preview", OfficePreviewHandler)
 	router.GET("/:file-id/preview/:secret", PreviewHandler)
 	router.GET("/:file-id/thumbnails/:secret/:format", ThumbnailHandler)
 
 	router.POST("/archive", ArchiveDownloadCreateHandler)
 	router.GET("/archive/:secret/:fake-name", ArchiveDownloadHandler)
+	router.GET("/archive/prepared/:secret", PreparedArchiveHandler)
+	router.GET("/archive/prepared/:secret/:fake-name", PreparedArchiveDownloadHandler)
 
 	router.POST("/downloads", FileDownloadCreateHandler)
 	router.GET("/downloads/:secret/:fake-name", FileDownloadHandler)
@@ -1890,75 +2057,20 @@ func Routes(router *echo.Group) {
 	router.POST("/:file-id/relationships/not_synchronized_on", AddNotSynchronizedOn)
 	router.DELETE("/:file-id/relationships/not_synchronized_on", RemoveNotSynchronizedOn)
 
+	router.PUT("/:file-id/custom_metadata/:slug", SetCustomMetadataHandler)
+	router.DELETE("/:file-id/custom_metadata/:slug", DeleteCustomMetadataHandler)
+
 	router.GET("/trash", ReadTrashFilesHandler)
-	router.DELETE("/trash", ClearTrashHandler)
+	router.DELETE("/trash", ClearTrashHandler, middlewares.BulkEvents)
 
 	router.POST("/trash/:file-id", RestoreTrashFileHandler)
+	router.GET("/trash/:file-id/preview", RestorePreviewHandler)
 	router.DELETE("/trash/:file-id", DestroyFileHandler)
 
 	router.DELETE("/:file-id", TrashHandler)
 	router.GET("/fsck", fsckHandler)
 }
 
-// WrapVfsError returns a formatted error from a golang error emitted by the vfs
-func WrapVfsError(err error) error {
-	if errj := wrapVfsError(err); errj != nil {
-		return errj
-	}
-	return err
-}
-
-func wrapVfsErrorJSONAPI(err error) *jsonapi.Error {
-	if errj := wrapVfsError(err); errj != nil {
-		return errj
-	}
-	return jsonapi.InternalServerError(err)
-}
-
-func wrapVfsError(err error) *jsonapi.Error {
-	switch err {
-	case ErrDocTypeInvalid:
-		return jsonapi.InvalidAttribute("type", err)
-	case os.ErrExist:
-		return jsonapi.Conflict(err)
-	case os.ErrNotExist, swift.ObjectNotFound:
-		return jsonapi.NotFound(err)
-	case vfs.ErrParentDoesNotExist:
-		return jsonapi.NotFound(err)
-	case vfs.ErrParentInTrash:
-		return jsonapi.NotFound(err)
-	case vfs.ErrForbiddenDocMove:
-		return jsonapi.PreconditionFailed("dir-id", err)
-	case vfs.ErrIllegalFilename:
-		return jsonapi.InvalidParameter("name", err)
-	case vfs.ErrIllegalPath:
-		return jsonapi.InvalidParameter("path", err)
-	case vfs.ErrIllegalMime:
-		return jsonapi.InvalidParameter("mime", err)
-	case vfs.ErrIllegalTime:
-		return jsonapi.InvalidParameter("UpdatedAt", err)
-	case vfs.ErrInvalidHash:
-		return jsonapi.PreconditionFailed("Content-MD5", err)
-	case vfs.ErrContentLengthMismatch:
-		return jsonapi.PreconditionFailed("Content-Length", err)
-	case vfs.ErrConflict:
-		return jsonapi.Conflict(err)
-	case vfs.ErrFileInTrash, vfs.ErrNonAbsolutePath,
-		vfs.ErrDirNotEmpty:
-		return jsonapi.BadRequest(err)
-	case vfs.ErrFileTooBig, vfs.ErrMaxFileSize:
-		return jsonapi.Errorf(http.StatusRequestEntityTooLarge, "%s", err)
-	case vfs.ErrWrongToken:
-		return jsonapi.BadRequest(err)
-	case vfs.ErrInvalidMetadataID:
-		return jsonapi.InvalidParameter("MetadataID", err)
-	}
-	if _, ok := err.(*jsonapi.Error); !ok {
-		logger.WithNamespace("files").Warnf("Not wrapped error: %s", err)
-	}
-	return nil
-}
-
 // FileDocFromReq creates a FileDoc from an incoming request.
 func FileDocFromReq(c echo.Context, name, dirID string) (*vfs.FileDoc, error) {
 	header := c.Request().Header
@@ -1977,7 +2089,7 @@ func FileDocFromReq(c echo.Context, name, dirID string) (*vfs.FileDoc, error) {
 		md5Sum, err = parseMD5Hash(md5Str)
 	}
 	if err != nil {
-		err = jsonapi.InvalidParameter("Content-MD5", err)
+		err = codeInvalidHash.Parameter("Content-MD5", err)
 		return nil, err
 	}
 
@@ -2085,7 +2197,7 @@ func CheckIfMatch(c echo.Context, rev string) error {
 
 func checkIfMatch(rev, wantedRev string) error {
 	if wantedRev != "" && rev != wantedRev {
-		return jsonapi.PreconditionFailed("If-Match", fmt.Errorf("Revision does not match"))
+		return codeRevisionMismatch.Parameter("If-Match", fmt.Errorf("Revision does not match"))
 	}
 	return nil
 }
@@ -2162,6 +2274,58 @@ func ensureCleanOldTrashedTrigger(inst *instance.Instance) {
 	}
 }
 
+func ensureCleanOldVersionsTrigger(inst *instance.Instance) {
+	policy := inst.VersioningPolicy()
+	if policy.MaxAge > 0 || policy.MaxTotalSize > 0 {
+		job.EnsureDailyTrigger(inst, "clean-old-versions", nil)
+	}
+}
+
+func ensureTieringTrigger(inst *instance.Instance) {
+	// 1. Check if we need a trigger for tiering worker
+	if !vfs.ContextTieringPolicy(inst.ContextName).Enabled() {
+		return
+	}
+
+	// 2. Check if the trigger already exists
+	sched := job.System()
+	infos := job.TriggerInfos{
+		Type:       "@cron",
+		WorkerType: "tiering",
+	}
+	if sched.HasTrigger(inst, infos) {
+		return
+	}
+
+	// 3. Create the trigger
+	now := time.Now()
+	hours := (now.Hour() + 12) % 24
+	infos.Arguments = fmt.Sprintf("0 %d %d * * *", now.Minute(), hours)
+	trigger, err := job.NewTrigger(inst, infos, nil)
+	if err != nil {
+		inst.Logger().Errorf("Cannot create tiering trigger: %s", err)
+		return
+	}
+	if err = sched.AddTrigger(trigger); err != nil {
+		inst.Logger().Errorf("Cannot create tiering trigger: %s", err)
+	}
+}
+
+// pushRetrieveJob pushes a job to move back the content of a file, or of the
+// files inside a directory, from the cold storage.
+func pushRetrieveJob(inst *instance.Instance, id string) {
+	msg, err := job.NewMessage(map[string]string{"retrieve_id": id})
+	if err == nil {
+		_, err = job.System().PushJob(inst, &job.JobRequest{
+			WorkerType: "tiering",
+			Message:    msg,
+		})
+	}
+	if err != nil {
+		inst.Logger().Errorf("Cannot push a job to retrieve %s from the cold storage: %s", id, err)
+	}
+}
+
 func instanceURL(c echo.Context) string {
 	return middlewares.GetInstance(c).PageURL("/", nil)
 }
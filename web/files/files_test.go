@@ -1807,6 +1807,15 @@ func TestFiles(t *testing.T) {
 			WithHeader("Authorization", "Bearer "+token).
 			Expect().Status(206).
 			Body().Equal("bar")
+
+		// The preconditions are evaluated before the range
+		e.GET("/files/download").
+			WithQuery("Path", "/downloadmebyrange").
+			WithQuery("", "/downloadmebyrange").
+			WithHeader("Range", "bytes=0-2").
+			WithHeader("If-None-Match", `"UmfjCVWct/albVkURcJJfg=="`).
+			WithHeader("Authorization", "Bearer "+token).
+			Expect().Status(304)
 	})
 
 	t.Run("GetFileMetadataFromPath", func(t *testing.T) {
@@ -3609,6 +3618,32 @@ func TestFiles(t *testing.T) {
 		data.Value("attributes").Object().ValueEqual("size", "90")
 	})
 
+	t.Run("SyncScopeForbidsWholeTypeRoutes", func(t *testing.T) {
+		e := testutils.CreateTestClient(t, ts.URL)
+
+		dir, err := vfs.Mkdir(testInstance.VFS(), "/ScopedSync", nil)
+		require.NoError(t, err)
+		client, scopedToken := setup.GetTestClient(consts.Files)
+		client.SyncScope = []string{dir.ID()}
+		require.NoError(t, couchdb.UpdateDoc(testInstance, client))
+
+		e.GET("/files/fsck").
+			WithHeader("Authorization", "Bearer "+scopedToken).
+			Expect().Status(403)
+		e.DELETE("/files/versions").
+			WithHeader("Authorization", "Bearer "+scopedToken).
+			Expect().Status(403)
+		e.POST("/files/_find").
+			WithHeader("Authorization", "Bearer "+scopedToken).
+			WithBytes([]byte(`{"selector": {"type": "file"}}`)).
+			Expect().Status(403)
+
+		// The changes feed is filtered, and can still be used
+		e.GET("/files/_changes").
+			WithHeader("Authorization", "Bearer "+scopedToken).
+			Expect().Status(200)
+	})
+
 	t.Run("DeprecatePreviewAndIcon", func(t *testing.T) {
 		testutils.TODO(t, "2023-12-01", "Remove the deprecated preview and icon for PDF files")
 	})
@@ -0,0 +1,136 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/account"
+	"github.com/cozy/cozy-stack/model/cloudimport"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// CreateImportHandler is the echo.handler for starting an import of the
+// files from Google Drive or OneDrive.
+// POST /files/imports
+func CreateImportHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.Files); err != nil {
+		return err
+	}
+
+	var opts cloudimport.Options
+	if _, err := jsonapi.Bind(c.Request().Body, &opts); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if opts.AccountID == "" {
+		return codeMissingAccount.Parameter("account_id", errors.New("missing account"))
+	}
+
+	// The stack uses the OAuth tokens of the account, so the app must have
+	// the permission to read it.
+	inst := middlewares.GetInstance(c)
+	var acc account.Account
+	if err := couchdb.GetDoc(inst, consts.Accounts, opts.AccountID, &acc); err != nil {
+		return wrapImportError(err)
+	}
+	if err := middlewares.Allow(c, permission.GET, &acc); err != nil {
+		return err
+	}
+
+	doc, err := cloudimport.Start(inst, opts)
+	if err != nil {
+		return wrapImportError(err)
+	}
+	return jsonapi.Data(c, http.StatusAccepted, doc, nil)
+}
+
+// ListImportsHandler is the echo.handler for listing the imports, the most
+// recent first.
+// GET /files/imports
+func ListImportsHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Files); err != nil {
+		return err
+	}
+
+	docs, err := cloudimport.List(middlewares.GetInstance(c))
+	if err != nil {
+		return wrapImportError(err)
+	}
+	objs := make([]jsonapi.Object, len(docs))
+	for i, doc := range docs {
+		objs[i] = doc
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+}
+
+// GetImportHandler is the echo.handler for reading the state and progress of
+// an import.
+// GET /files/imports/:id
+func GetImportHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Files); err != nil {
+		return err
+	}
+
+	doc, err := cloudimport.Get(middlewares.GetInstance(c), c.Param("id"))
+	if err != nil {
+		return wrapImportError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, doc, nil)
+}
+
+// ResumeImportHandler is the echo.handler for resuming an import that has
+// been stopped by an error.
+// POST /files/imports/:id/resume
+func ResumeImportHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.Files); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	doc, err := cloudimport.Get(inst, c.Param("id"))
+	if err != nil {
+		return wrapImportError(err)
+	}
+	if err := cloudimport.Resume(inst, doc); err != nil {
+		return wrapImportError(err)
+	}
+	return jsonapi.Data(c, http.StatusAccepted, doc, nil)
+}
+
+// CancelImportHandler is the echo.handler for canceling an import. The files
+// already imported are kept.
+// DELETE /files/imports/:id
+func CancelImportHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.Files); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	doc, err := cloudimport.Get(inst, c.Param("id"))
+	if err != nil {
+		return wrapImportError(err)
+	}
+	if err := cloudimport.Cancel(inst, doc); err != nil {
+		return wrapImportError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func wrapImportError(err error) error {
+	switch {
+	case errors.Is(err, cloudimport.ErrUnknownProvider),
+		errors.Is(err, cloudimport.ErrInvalidConflictPolicy),
+		errors.Is(err, cloudimport.ErrNoOAuthCredentials):
+		return codeImportInvalid.New(err)
+	case errors.Is(err, cloudimport.ErrImportNotResumable),
+		errors.Is(err, cloudimport.ErrImportFinished):
+		return codeImportConflict.New(err)
+	case couchdb.IsNotFoundError(err), couchdb.IsNoDatabaseError(err):
+		return codeImportNotFound.New(err)
+	}
+	return WrapVfsError(err)
+}
@@ -0,0 +1,60 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// PhotoGroupHandler returns the files of the live photo or burst of the given
+// file, with the primary file first.
+// GET /files/:file-id/photo_group
+func PhotoGroupHandler(c echo.Context) error {
+	instance := middlewares.GetInstance(c)
+	fs := instance.VFS()
+
+	doc, err := fs.FileByID(c.Param("file-id"))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	if err = middlewares.AllowVFS(c, permission.GET, doc); err != nil {
+		return err
+	}
+	group, ok := doc.Metadata["photo_group"].(map[string]interface{})
+	groupID, _ := group["id"].(string)
+	if !ok || groupID == "" {
+		return codeNotInPhotoGroup.New(errors.New("the file is not part of a live photo or burst"))
+	}
+
+	files, err := vfs.FindPhotoGroup(fs, groupID)
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	var thumbIDs []string
+	allowed := make([]*vfs.FileDoc, 0, len(files))
+	for _, f := range files {
+		if f.ID() != doc.ID() && middlewares.AllowVFS(c, permission.GET, f) != nil {
+			continue
+		}
+		allowed = append(allowed, f)
+		if f.Class == "image" {
+			thumbIDs = append(thumbIDs, f.ID())
+		}
+	}
+	secrets, _ := vfs.GetStore().AddThumbs(instance, thumbIDs)
+
+	objs := make([]jsonapi.Object, len(allowed))
+	for i, f := range allowed {
+		file := NewFile(f, instance)
+		if secret, ok := secrets[f.ID()]; ok {
+			file.SetThumbSecret(secret)
+		}
+		objs[i] = file
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+}
@@ -0,0 +1,100 @@
+package files
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// prepareArchive creates a document for the archive and pushes a job to
+// build it in background. The response has a link to follow the progress,
+// and the link for downloading the archive when it will be ready.
+func prepareArchive(c echo.Context, archive *vfs.Archive, entries []vfs.ArchiveEntry) error {
+	inst := middlewares.GetInstance(c)
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		if e.Dir != nil {
+			ids[i] = e.Dir.ID()
+		} else {
+			ids[i] = e.File.ID()
+		}
+	}
+
+	job.EnsureDailyTrigger(inst, "clean-prepared-archives", nil)
+	doc, secret, err := vfs.CreatePreparedArchive(inst, &vfs.Archive{Name: archive.Name, IDs: ids})
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	msg, err := job.NewMessage(map[string]string{"id": doc.ID()})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "prepare-archive",
+		Message:    msg,
+	})
+	if err != nil {
+		return err
+	}
+	return jsonapi.Data(c, http.StatusAccepted, doc, preparedArchiveLinks(doc, secret))
+}
+
+func preparedArchiveLinks(doc *vfs.PreparedArchive, secret string) *jsonapi.LinksList {
+	return &jsonapi.LinksList{
+		Self:    "/files/archive/prepared/" + secret,
+		Related: "/files/archive/prepared/" + secret + "/" + url.PathEscape(doc.Name) + ".zip",
+	}
+}
+
+// PreparedArchiveHandler returns the state and progress of an archive built
+// in background. The secret from the links of the creation is used as the
+// authentication.
+// GET /files/archive/prepared/:secret
+func PreparedArchiveHandler(c echo.Context) error {
+	secret := c.Param("secret")
+	doc, err := vfs.GetPreparedArchive(middlewares.GetInstance(c), secret)
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, doc, preparedArchiveLinks(doc, secret))
+}
+
+// PreparedArchiveDownloadHandler sends an archive built in background. The
+// link can be used only once, and the archive is removed after the download.
+// GET /files/archive/prepared/:secret/:fake-name
+func PreparedArchiveDownloadHandler(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	doc, err := vfs.GetPreparedArchive(inst, c.Param("secret"))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	content, err := vfs.OpenPreparedArchive(inst, doc)
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	defer func() {
+		_ = content.Close()
+		if err := vfs.RemovePreparedArchive(inst, doc); err != nil {
+			inst.Logger().WithNamespace("files").
+				Warnf("Cannot remove prepared archive %s: %s", doc.ID(), err)
+		}
+	}()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, vfs.ZipMime)
+	header.Set(echo.HeaderContentDisposition,
+		vfs.ContentDisposition("attachment", doc.Name+".zip"))
+	if doc.ArchiveSize > 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(doc.ArchiveSize, 10))
+	}
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = io.Copy(c.Response(), content)
+	return err
+}
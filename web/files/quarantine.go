@@ -0,0 +1,87 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// errQuarantineJustification is used when an administrator downloads a
+// quarantined file without giving their name and a reason.
+var errQuarantineJustification = errors.New("The operator and the reason are mandatory")
+
+func adminFile(c echo.Context) (*instance.Instance, *vfs.FileDoc, error) {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		if err == instance.ErrNotFound {
+			return nil, nil, jsonapi.NotFound(err)
+		}
+		return nil, nil, err
+	}
+	doc, err := inst.VFS().FileByID(c.Param("file-id"))
+	if err != nil {
+		return nil, nil, WrapVfsError(err)
+	}
+	return inst, doc, nil
+}
+
+// setScanStatus is used by a scanning or policy subsystem to give a status to
+// a file: pending, clean or quarantined.
+func setScanStatus(c echo.Context) error {
+	inst, doc, err := adminFile(c)
+	if err != nil {
+		return err
+	}
+	var body struct {
+		Status  string `json:"status"`
+		Reason  string `json:"reason"`
+		Scanner string `json:"scanner"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.BadJSON()
+	}
+	newdoc, err := vfs.SetScanStatus(inst.VFS(), doc, body.Status, body.Reason, body.Scanner)
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	return c.JSON(http.StatusOK, newdoc.Scan)
+}
+
+// downloadQuarantined allows an administrator to download the content of a
+// quarantined file. The operator and the reason are recorded in the audit
+// trail of the instance.
+func downloadQuarantined(c echo.Context) error {
+	operator := c.QueryParam("operator")
+	reason := c.QueryParam("reason")
+	if operator == "" || reason == "" {
+		return jsonapi.BadRequest(errQuarantineJustification)
+	}
+	inst, doc, err := adminFile(c)
+	if err != nil {
+		return err
+	}
+	actor := audit.Actor{Kind: audit.ActorOperator, ID: operator, IP: middlewares.ClientIP(c)}
+	audit.Record(inst, audit.ActionAccess, consts.Files, doc.ID(), actor, nil,
+		map[string]interface{}{"reason": reason, "scan": doc.Scan})
+	if err := vfs.ServeQuarantinedFileContent(inst.VFS(), doc, c.Request(), c.Response()); err != nil {
+		return WrapVfsError(err)
+	}
+	return nil
+}
+
+// QuarantineAdminRoutes sets the routing for the admin interface used by the
+// scanning or policy subsystems to flag the files, and by the administrators
+// to download the quarantined files.
+func QuarantineAdminRoutes(router *echo.Group) {
+	router.PUT("/:domain/:file-id/scan", setScanStatus)
+	router.GET("/:domain/:file-id/quarantined", downloadQuarantined)
+}
@@ -93,7 +93,7 @@ func ListReferencesHandler(c echo.Context) error {
 	case "datetime", "-datetime":
 		view = couchdb.ReferencedBySortedByDatetimeView
 	default:
-		return jsonapi.BadRequest(errors.New("Invalid sort parameter"))
+		return codeInvalidParameter.New(errors.New("Invalid sort parameter"))
 	}
 
 	req := &couchdb.ViewRequest{
@@ -0,0 +1,143 @@
+package files
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// CreateSnapshotHandler is the echo.handler for taking a snapshot of a
+// directory (the root directory by default). The entries of the snapshot are
+// saved in background by a job.
+// POST /files/snapshots
+func CreateSnapshotHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.Files); err != nil {
+		return err
+	}
+
+	var attrs struct {
+		Name  string `json:"name"`
+		DirID string `json:"dir_id"`
+	}
+	if _, err := jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if attrs.DirID == "" {
+		attrs.DirID = consts.RootDirID
+	}
+
+	inst := middlewares.GetInstance(c)
+	dir, err := inst.VFS().DirByID(attrs.DirID)
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	snap, err := vfs.CreateSnapshot(inst, attrs.Name, dir)
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	msg, err := job.NewMessage(map[string]string{"id": snap.ID()})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "snapshot",
+		Message:    msg,
+	})
+	if err != nil {
+		_ = couchdb.DeleteDoc(inst, snap)
+		return err
+	}
+	return jsonapi.Data(c, http.StatusAccepted, snap, nil)
+}
+
+// ListSnapshotsHandler is the echo.handler for listing the snapshots.
+// GET /files/snapshots
+func ListSnapshotsHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Files); err != nil {
+		return err
+	}
+
+	snaps, err := vfs.ListSnapshots(middlewares.GetInstance(c))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	objs := make([]jsonapi.Object, len(snaps))
+	for i, snap := range snaps {
+		objs[i] = snap
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+}
+
+// GetSnapshotHandler is the echo.handler for reading a snapshot.
+// GET /files/snapshots/:id
+func GetSnapshotHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Files); err != nil {
+		return err
+	}
+
+	snap, err := vfs.GetSnapshot(middlewares.GetInstance(c), c.Param("id"))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, snap, nil)
+}
+
+// DeleteSnapshotHandler is the echo.handler for deleting a snapshot. The
+// files are not modified, but the old versions of their content that were
+// kept for this snapshot may be cleaned later.
+// DELETE /files/snapshots/:id
+func DeleteSnapshotHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.Files); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	snap, err := vfs.GetSnapshot(inst, c.Param("id"))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	if err := vfs.DeleteSnapshot(inst, snap); err != nil {
+		return WrapVfsError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RestoreSnapshotHandler is the echo.handler for restoring the files and
+// directories from a snapshot. The Path query parameter can be used to
+// restore only a file or a directory. The restoration is made in background
+// by a job, and its result is saved in the snapshot document.
+// POST /files/snapshots/:id/restore
+func RestoreSnapshotHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.PATCH, consts.Files); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	snap, err := vfs.GetSnapshot(inst, c.Param("id"))
+	if err != nil {
+		return WrapVfsError(err)
+	}
+	fullpath := c.QueryParam("Path")
+	if err := vfs.QueueSnapshotRestore(inst, snap, fullpath); err != nil {
+		return WrapVfsError(err)
+	}
+	msg, err := job.NewMessage(map[string]string{"id": snap.ID(), "path": fullpath})
+	if err != nil {
+		return err
+	}
+	_, err = job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "snapshot-restore",
+		Message:    msg,
+	})
+	if err != nil {
+		return err
+	}
+	return jsonapi.Data(c, http.StatusAccepted, snap, nil)
+}
@@ -0,0 +1,64 @@
+package files
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+func listUploadPolicies(c echo.Context) error {
+	policies, err := vfs.ListUploadPolicies()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, policies)
+}
+
+func getUploadPolicy(c echo.Context) error {
+	policy, err := vfs.GetUploadPolicy(c.Param("context"))
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return jsonapi.NotFound(vfs.ErrUploadPolicyNotFound)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+func putUploadPolicy(c echo.Context) error {
+	var policy vfs.UploadPolicy
+	if err := json.NewDecoder(c.Request().Body).Decode(&policy); err != nil {
+		return jsonapi.BadJSON()
+	}
+	policy.DocID = c.Param("context")
+	policy.DocRev = ""
+	if err := vfs.SaveUploadPolicy(&policy); err != nil {
+		if err == vfs.ErrInvalidUploadPolicy {
+			return jsonapi.BadRequest(err)
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+func deleteUploadPolicy(c echo.Context) error {
+	if err := vfs.DeleteUploadPolicy(c.Param("context")); err != nil {
+		if err == vfs.ErrUploadPolicyNotFound {
+			return jsonapi.NotFound(err)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UploadPolicyAdminRoutes sets the routing for the admin interface to
+// configure the rules that block some uploads in a context.
+func UploadPolicyAdminRoutes(router *echo.Group) {
+	router.GET("", listUploadPolicies)
+	router.GET("/:context", getUploadPolicy)
+	router.PUT("/:context", putUploadPolicy)
+	router.DELETE("/:context", deleteUploadPolicy)
+}
@@ -0,0 +1,53 @@
+package instances
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+// exportAudit returns the entries of the audit trail of an instance, from the
+// oldest to the newest. The since parameter can be used to paginate, with the
+// created_at of the last entry.
+func exportAudit(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+
+	var since time.Time
+	if param := c.QueryParam("since"); param != "" {
+		since, err = time.Parse(time.RFC3339Nano, param)
+		if err != nil {
+			return jsonapi.InvalidParameter("since", err)
+		}
+	}
+	limit := 1000
+	if param := c.QueryParam("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil {
+			return jsonapi.InvalidParameter("limit", err)
+		}
+		if limit <= 0 {
+			return jsonapi.InvalidParameter("limit", errors.New("limit must be positive"))
+		}
+		if limit > 10000 {
+			limit = 10000
+		}
+	}
+
+	entries, err := audit.List(inst, since, limit)
+	if err != nil {
+		return wrapError(err)
+	}
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+	return c.JSON(http.StatusOK, entries)
+}
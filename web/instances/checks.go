@@ -3,14 +3,17 @@ package instances
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/labstack/echo/v4"
 )
 
@@ -44,21 +47,7 @@ func fsckHandler(c echo.Context) (err error) {
 	for log := range logCh {
 		// XXX do not serialize to JSON the children and the cozyMetadata, as
 		// it can take more than 64ko and scanner will ignore such lines.
-		if log.FileDoc != nil {
-			log.FileDoc.DirsChildren = nil  // It can be filled on type mismatch
-			log.FileDoc.FilesChildren = nil // Idem
-			log.FileDoc.FilesChildrenSize = 0
-			log.FileDoc.Metadata = nil
-		}
-		if log.DirDoc != nil {
-			log.DirDoc.DirsChildren = nil
-			log.DirDoc.FilesChildren = nil
-			log.DirDoc.FilesChildrenSize = 0
-			log.DirDoc.Metadata = nil
-		}
-		if log.VersionDoc != nil {
-			log.VersionDoc.Metadata = nil
-		}
+		log.Trim()
 		if errenc := encoder.Encode(log); errenc != nil {
 			i.Logger().WithNamespace("fsck").
 				Warnf("Cannot encode to JSON: %s (%v)", errenc, log)
@@ -83,6 +72,51 @@ func fsckHandler(c echo.Context) (err error) {
 	return nil
 }
 
+func fsckJobHandler(c echo.Context) error {
+	domain := c.Param("domain")
+	i, err := lifecycle.GetInstance(domain)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	mode := vfs.FsckMode(c.QueryParam("Mode"))
+	if mode == "" {
+		mode = vfs.FsckModeReport
+	}
+	if !mode.Valid() {
+		return jsonapi.InvalidParameter("Mode", fmt.Errorf("unknown mode %q", mode))
+	}
+	msg, err := job.NewMessage(map[string]interface{}{"mode": mode})
+	if err != nil {
+		return wrapError(err)
+	}
+	j, err := job.System().PushJob(i, &job.JobRequest{
+		WorkerType: "fsck",
+		Message:    msg,
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusAccepted, j)
+}
+
+func fsckReportHandler(c echo.Context) error {
+	domain := c.Param("domain")
+	i, err := lifecycle.GetInstance(domain)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	report, err := vfs.GetFsckReport(i, c.Param("job-id"))
+	if err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return jsonapi.NotFound(err)
+		}
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
 func checkTriggers(c echo.Context) error {
 	domain := c.Param("domain")
 	inst, err := lifecycle.GetInstance(domain)
@@ -233,8 +267,9 @@ func checkSharings(c echo.Context) error {
 	}
 
 	skipFSConsistency, _ := strconv.ParseBool(c.QueryParam("SkipFSConsistency"))
+	repair, _ := strconv.ParseBool(c.QueryParam("Repair"))
 
-	results, err := sharing.CheckSharings(i, skipFSConsistency)
+	results, err := sharing.CheckSharings(i, skipFSConsistency, repair)
 	if err != nil {
 		if couchdb.IsNotFoundError(err) {
 			return c.JSON(http.StatusOK, []map[string]interface{}{
@@ -245,3 +280,20 @@ func checkSharings(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, results)
 }
+
+func debugSharing(c echo.Context) error {
+	i, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+
+	skipFSConsistency, _ := strconv.ParseBool(c.QueryParam("SkipFSConsistency"))
+	report, err := sharing.Debug(i, c.Param("sharing-id"), skipFSConsistency)
+	if err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return jsonapi.NotFound(err)
+		}
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
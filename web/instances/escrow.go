@@ -0,0 +1,118 @@
+package instances
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/move"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/prefixer"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// escrowActor returns the actor for the audit trail of a request on the
+// escrow exports. The operator and the reason are mandatory, as these
+// requests are only made to answer a legal request.
+func escrowActor(c echo.Context) (audit.Actor, string, error) {
+	operator := c.QueryParam("operator")
+	reason := c.QueryParam("reason")
+	if operator == "" || reason == "" {
+		return audit.Actor{}, "", move.ErrEscrowJustification
+	}
+	actor := audit.Actor{Kind: audit.ActorOperator, ID: operator, IP: middlewares.ClientIP(c)}
+	return actor, reason, nil
+}
+
+// createEscrow makes an escrow export of an instance, before destroying it.
+func createEscrow(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	actor, reason, err := escrowActor(c)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	doc, err := move.CreateEscrow(inst, actor.ID, reason, move.SystemEscrowArchiver())
+	if err != nil {
+		return wrapError(err)
+	}
+	after := map[string]interface{}{"domain": doc.Domain, "reason": reason}
+	if err := audit.RecordGlobal(audit.ActionCreate, consts.Escrows, doc.ID(), actor, nil, after); err != nil {
+		inst.Logger().WithNamespace("escrow").
+			Errorf("Cannot record the creation of the escrow export %s: %s", doc.ID(), err)
+	}
+	return c.JSON(http.StatusCreated, doc)
+}
+
+// listEscrows returns the metadata of the escrow exports, optionally filtered
+// by domain.
+func listEscrows(c echo.Context) error {
+	docs, err := move.ListEscrows(c.QueryParam("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if docs == nil {
+		docs = []*move.EscrowDoc{}
+	}
+	return c.JSON(http.StatusOK, docs)
+}
+
+// escrowData is the break-glass access to the encrypted archive of an escrow
+// export. The access is recorded in the audit trail of the stack before the
+// archive is sent, and it is refused if it cannot be recorded.
+func escrowData(c echo.Context) error {
+	actor, reason, err := escrowActor(c)
+	if err != nil {
+		return wrapError(err)
+	}
+	doc, err := move.GetEscrow(c.Param("escrow-id"))
+	if err != nil {
+		return wrapError(err)
+	}
+
+	after := map[string]interface{}{"domain": doc.Domain, "reason": reason}
+	if err := audit.RecordGlobal(audit.ActionAccess, consts.Escrows, doc.ID(), actor, nil, after); err != nil {
+		return wrapError(err)
+	}
+	content, err := move.OpenEscrowArchive(doc, move.SystemEscrowArchiver())
+	if err != nil {
+		return wrapError(err)
+	}
+	defer content.Close()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "application/octet-stream")
+	w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, doc.Filename()))
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, content)
+	return err
+}
+
+// escrowAudit returns the entries of the audit trail of the stack, like the
+// accesses to the escrow exports, from the oldest to the newest.
+func escrowAudit(c echo.Context) error {
+	var since time.Time
+	if param := c.QueryParam("since"); param != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, param)
+		if err != nil {
+			return jsonapi.InvalidParameter("since", err)
+		}
+	}
+	entries, err := audit.List(prefixer.GlobalPrefixer, since, 1000)
+	if err != nil {
+		return wrapError(err)
+	}
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+	return c.JSON(http.StatusOK, entries)
+}
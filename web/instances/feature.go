@@ -46,6 +46,7 @@ func patchFeatureFlags(c echo.Context) error {
 	if err := instance.Update(inst); err != nil {
 		return wrapError(err)
 	}
+	go feature.PublishChanges(inst)
 	return c.JSON(http.StatusOK, inst.FeatureFlags)
 }
 
@@ -132,6 +133,11 @@ func getFeatureContext(c echo.Context) error {
 type contextParameters struct {
 	Ratio float64     `json:"ratio"`
 	Value interface{} `json:"value"`
+
+	// Optional targeting rules on the instance attributes
+	FeatureSets   []string `json:"feature_sets,omitempty"`
+	CreatedAfter  string   `json:"created_after,omitempty"`
+	CreatedBefore string   `json:"created_before,omitempty"`
 }
 
 func patchFeatureContext(c echo.Context) error {
@@ -162,6 +168,8 @@ func patchFeatureContext(c echo.Context) error {
 		return wrapError(err)
 	}
 
+	feature.PublishContextChanges(c.Param("context"))
+
 	delete(flags.M, "_id")
 	delete(flags.M, "_rev")
 	return c.JSON(http.StatusOK, flags.M)
@@ -203,6 +211,8 @@ func patchFeatureDefaults(c echo.Context) error {
 		return wrapError(err)
 	}
 
+	feature.PublishContextChanges("")
+
 	delete(defaults.M, "_id")
 	delete(defaults.M, "_rev")
 	return c.JSON(http.StatusOK, defaults.M)
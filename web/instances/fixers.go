@@ -15,10 +15,12 @@ import (
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/instance/lifecycle"
 	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/cozy-stack/model/stack"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/labstack/echo/v4"
 )
 
@@ -505,3 +507,61 @@ func indexesFixer(c echo.Context) error {
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+// referencesFixer pushes a job to remove the references on the files to the
+// albums and sharings that have been deleted.
+func referencesFixer(c echo.Context) error {
+	domain := c.Param("domain")
+	inst, err := lifecycle.GetInstance(domain)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		DryRun bool `json:"dry_run"`
+	}
+	// Try to get the dry_run param from the body. If there is no body, ignore
+	// it
+	_ = json.NewDecoder(c.Request().Body).Decode(&body)
+
+	msg, err := job.NewMessage(body)
+	if err != nil {
+		return err
+	}
+	j, err := job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "clean-references",
+		Message:    msg,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusAccepted, j)
+}
+
+func sharingCheckpointsFixer(c echo.Context) error {
+	domain := c.Param("domain")
+	inst, err := lifecycle.GetInstance(domain)
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		SharingID   string `json:"sharing_id"`
+		MemberIndex int    `json:"member_index"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.BadJSON()
+	}
+	s, err := sharing.FindSharing(inst, body.SharingID)
+	if err != nil {
+		return jsonapi.NotFound(err)
+	}
+	idx := body.MemberIndex
+	if idx < 0 || idx >= len(s.Members) || (s.Owner && idx == 0) || (!s.Owner && idx != 0) {
+		return jsonapi.BadRequest(sharing.ErrMemberNotFound)
+	}
+	if err := sharing.PushResetCheckpointsJob(inst, s, idx); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusAccepted)
+}
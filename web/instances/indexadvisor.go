@@ -0,0 +1,23 @@
+package instances
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/indexadvisor"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/labstack/echo/v4"
+)
+
+// indexAdvisorReport returns the indexes suggested for the queries of an
+// instance that cannot use an index, grouped by doctype.
+func indexAdvisorReport(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	advices, err := indexadvisor.Report(inst)
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, advices)
+}
@@ -0,0 +1,54 @@
+package instances
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+type pendingDesignDoc struct {
+	Doctype   string `json:"doctype"`
+	DesignDoc string `json:"design_document"`
+}
+
+// indexesState returns the version of the indexes and views of an instance,
+// the ones that are still to be migrated, and the ones that are being built
+// by CouchDB. The instance is not loaded via lifecycle.GetInstance, as it
+// would migrate the indexes and views.
+func indexesState(c echo.Context) error {
+	inst, err := instance.GetFromCouch(c.Param("domain"))
+	if err != nil {
+		return jsonapi.NotFound(err)
+	}
+
+	pending := []pendingDesignDoc{}
+	if inst.IndexViewsVersion != couchdb.IndexViewsVersion {
+		for _, index := range couchdb.IndexesSince(inst.IndexViewsVersion) {
+			pending = append(pending, pendingDesignDoc{
+				Doctype:   index.Doctype,
+				DesignDoc: "_design/" + index.Request.DDoc,
+			})
+		}
+		for _, view := range couchdb.ViewsSince(inst.IndexViewsVersion) {
+			pending = append(pending, pendingDesignDoc{
+				Doctype:   view.Doctype,
+				DesignDoc: "_design/" + view.Name,
+			})
+		}
+	}
+
+	builds, err := couchdb.IndexBuildTasks(inst)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"indexes_version": inst.IndexViewsVersion,
+		"wanted_version":  couchdb.IndexViewsVersion,
+		"pending":         pending,
+		"builds":          builds,
+	})
+}
@@ -13,9 +13,8 @@ import (
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/instance/lifecycle"
 	"github.com/cozy/cozy-stack/model/job"
-	"github.com/cozy/cozy-stack/model/oauth"
-	"github.com/cozy/cozy-stack/model/session"
 	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/usage"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/crypto"
@@ -275,11 +274,38 @@ func countHandler(c echo.Context) error {
 
 func deleteHandler(c echo.Context) error {
 	domain := c.Param("domain")
-	err := lifecycle.Destroy(domain)
+	if now, _ := strconv.ParseBool(c.QueryParam("Now")); now {
+		if err := lifecycle.Destroy(domain); err != nil {
+			return wrapError(err)
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	inst, err := lifecycle.ScheduleDestroy(domain)
 	if err != nil {
 		return wrapError(err)
 	}
-	return c.NoContent(http.StatusNoContent)
+	if inst == nil {
+		// No grace period, the instance has been destroyed
+		return c.NoContent(http.StatusNoContent)
+	}
+	if err := sharing.NotifyOwnerDeletion(inst, *inst.DeletionScheduledAt); err != nil {
+		inst.Logger().WithNamespace("instances").
+			Warnf("Cannot notify the sharings of the deletion: %s", err)
+	}
+	return c.JSON(http.StatusAccepted, echo.Map{
+		"domain":                inst.Domain,
+		"deletion_scheduled_at": inst.DeletionScheduledAt,
+	})
+}
+
+func restoreHandler(c echo.Context) error {
+	domain := c.Param("domain")
+	inst, err := lifecycle.RestoreScheduledDestroy(domain)
+	if err != nil {
+		return wrapError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, &apiInstance{inst}, nil)
 }
 
 func updatesHandler(c echo.Context) error {
@@ -431,68 +457,24 @@ func lastActivity(c echo.Context) error {
 	if err != nil {
 		return jsonapi.NotFound(err)
 	}
-	last := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
-
-	err = couchdb.ForeachDocs(inst, consts.SessionsLogins, func(_ string, data json.RawMessage) error {
-		var entry session.LoginEntry
-		if err := json.Unmarshal(data, &entry); err != nil {
-			return err
-		}
-		if last.Before(entry.CreatedAt) {
-			last = entry.CreatedAt
-		}
-		return nil
-	})
+	last, err := usage.LastActivity(inst)
 	if err != nil {
 		return err
 	}
-
-	err = couchdb.ForeachDocs(inst, consts.Sessions, func(_ string, data json.RawMessage) error {
-		var sess session.Session
-		if err := json.Unmarshal(data, &sess); err != nil {
-			return err
-		}
-		if last.Before(sess.LastSeen) {
-			last = sess.LastSeen
-		}
-		return nil
+	return c.JSON(http.StatusOK, echo.Map{
+		"last-activity": last.Format("2006-01-02"),
 	})
-	if err != nil {
-		return err
-	}
+}
 
-	err = couchdb.ForeachDocs(inst, consts.OAuthClients, func(_ string, data json.RawMessage) error {
-		var client oauth.Client
-		if err := json.Unmarshal(data, &client); err != nil {
-			return err
-		}
-		// Ignore the OAuth clients used for sharings
-		if client.ClientKind == "sharing" {
-			return nil
-		}
-		if at, ok := client.LastRefreshedAt.(string); ok {
-			if t, err := time.Parse(time.RFC3339Nano, at); err == nil {
-				if last.Before(t) {
-					last = t
-				}
-			}
-		}
-		if at, ok := client.SynchronizedAt.(string); ok {
-			if t, err := time.Parse(time.RFC3339Nano, at); err == nil {
-				if last.Before(t) {
-					last = t
-				}
-			}
-		}
-		return nil
-	})
+func usageHandler(c echo.Context) error {
+	list, err := usage.Aggregate(c.QueryParam("context"))
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
-
-	return c.JSON(http.StatusOK, echo.Map{
-		"last-activity": last.Format("2006-01-02"),
-	})
+	if list == nil {
+		list = []*usage.ContextUsage{}
+	}
+	return c.JSON(http.StatusOK, list)
 }
 
 func unxorID(c echo.Context) error {
@@ -525,6 +507,7 @@ type diskUsageResult struct {
 	Versions      int64 `json:"versions,string,omitempty"`
 	VersionsCount int   `json:"versions_count,string,omitempty"`
 	Trashed       int64 `json:"trashed,string,omitempty"`
+	Cold          int64 `json:"cold,string,omitempty"`
 }
 
 func diskUsage(c echo.Context) error {
@@ -558,6 +541,10 @@ func diskUsage(c echo.Context) error {
 		result.Trashed = trashed
 	}
 
+	if cold, err := fs.ColdUsage(); err == nil {
+		result.Cold = cold
+	}
+
 	result.Quota = fs.DiskQuota()
 	if stats, err := couchdb.DBStatus(instance, consts.Files); err == nil {
 		result.Count = stats.DocCount
@@ -644,6 +631,14 @@ func wrapError(err error) error {
 		return jsonapi.BadRequest(err)
 	case instance.ErrBadTOSVersion:
 		return jsonapi.BadRequest(err)
+	case instance.ErrDeletionAlreadyRequested, instance.ErrDeletionNotScheduled:
+		return jsonapi.Conflict(err)
+	case instance.ErrInvalidAllowedIPs:
+		return jsonapi.InvalidParameter("allowed_ips", err)
+	case instance.ErrMissingLegalHoldReason:
+		return jsonapi.BadRequest(err)
+	case instance.ErrLegalHold:
+		return jsonapi.NewError(http.StatusLocked, err.Error())
 	}
 	return err
 }
@@ -654,9 +649,11 @@ func Routes(router *echo.Group) {
 	router.GET("", listHandler)
 	router.POST("", createHandler)
 	router.GET("/count", countHandler)
+	router.GET("/usage", usageHandler)
 	router.GET("/:domain", showHandler)
 	router.PATCH("/:domain", modifyHandler)
 	router.DELETE("/:domain", deleteHandler)
+	router.POST("/:domain/restore", restoreHandler)
 
 	// Debug mode
 	router.GET("/:domain/debug", getDebug)
@@ -681,6 +678,7 @@ func Routes(router *echo.Group) {
 	router.POST("/:domain/auth-mode", setAuthMode)
 	router.POST("/:domain/magic_link", createMagicLink)
 	router.POST("/:domain/session_code", createSessionCode)
+	router.POST("/:domain/support_code", createSupportCode)
 	router.DELETE("/:domain/sessions", cleanSessions)
 
 	// Advanced features for instances
@@ -690,6 +688,25 @@ func Routes(router *echo.Group) {
 	router.GET("/:domain/exports/:export-id/data", dataExporter)
 	router.POST("/:domain/import", importer)
 	router.GET("/:domain/disk-usage", diskUsage)
+	router.GET("/:domain/versioning", getVersioning)
+	router.GET("/:domain/provisioning", getProvisioning)
+	router.POST("/:domain/provisioning", provisionInstance)
+	router.PUT("/:domain/versioning", putVersioning)
+	router.GET("/:domain/maintenance", getMaintenance)
+	router.PUT("/:domain/maintenance", putMaintenance)
+	router.DELETE("/:domain/maintenance", deleteMaintenance)
+	router.GET("/:domain/legal_hold", getLegalHold)
+	router.PUT("/:domain/legal_hold", putLegalHold)
+	router.DELETE("/:domain/legal_hold", deleteLegalHold)
+	router.GET("/:domain/audit", exportAudit)
+	router.POST("/:domain/escrow", createEscrow)
+	router.GET("/escrows", listEscrows)
+	router.GET("/escrows/audit", escrowAudit)
+	router.GET("/escrows/:escrow-id/data", escrowData)
+	router.POST("/:domain/doctypes/:doctype/query", queryDoctype)
+	router.GET("/:domain/index-advisor", indexAdvisorReport)
+	router.GET("/:domain/indexes", indexesState)
+	router.GET("/:domain/notifications/:category/preview", previewNotificationMail)
 	router.GET("/:domain/prefix", showPrefix)
 	router.GET("/:domain/swift-prefix", getSwiftBucketName)
 	router.GET("/:domain/sharings/:sharing-id/unxor/:doc-id", unxorID)
@@ -705,9 +722,12 @@ func Routes(router *echo.Group) {
 
 	// Checks
 	router.GET("/:domain/fsck", fsckHandler)
+	router.POST("/:domain/fsck/jobs", fsckJobHandler)
+	router.GET("/:domain/fsck/reports/:job-id", fsckReportHandler)
 	router.POST("/:domain/checks/triggers", checkTriggers)
 	router.POST("/:domain/checks/shared", checkShared)
 	router.POST("/:domain/checks/sharings", checkSharings)
+	router.GET("/:domain/sharings/:sharing-id/debug", debugSharing)
 
 	// Fixers
 	router.POST("/:domain/fixers/content-mismatch", contentMismatchFixer)
@@ -715,4 +735,6 @@ func Routes(router *echo.Group) {
 	router.POST("/:domain/fixers/orphan-account", orphanAccountFixer)
 	router.POST("/:domain/fixers/service-triggers", serviceTriggersFixer)
 	router.POST("/:domain/fixers/indexes", indexesFixer)
+	router.POST("/:domain/fixers/references", referencesFixer)
+	router.POST("/:domain/fixers/sharing-checkpoints", sharingCheckpointsFixer)
 }
@@ -0,0 +1,54 @@
+package instances
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+// getLegalHold returns the legal hold of an instance, or 404 if the instance
+// is not under legal hold.
+func getLegalHold(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if !inst.UnderLegalHold() {
+		return jsonapi.NotFound(errors.New("The instance is not under legal hold"))
+	}
+	return c.JSON(http.StatusOK, inst.LegalHold)
+}
+
+// putLegalHold puts an instance under legal hold, or updates the reason and
+// the actor of a legal hold in progress.
+func putLegalHold(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	var body instance.LegalHold
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if err := lifecycle.StartLegalHold(inst, body.Reason, body.Actor); err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, inst.LegalHold)
+}
+
+// deleteLegalHold lifts the legal hold of an instance.
+func deleteLegalHold(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := lifecycle.EndLegalHold(inst); err != nil {
+		return wrapError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package instances
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+// getMaintenance returns the maintenance of an instance, or 404 if the
+// instance is not in maintenance.
+func getMaintenance(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if !inst.InMaintenance() {
+		return jsonapi.NotFound(errors.New("The instance is not in maintenance"))
+	}
+	return c.JSON(http.StatusOK, inst.Maintenance)
+}
+
+// putMaintenance puts an instance in maintenance, or updates the message and
+// the allowlist of a maintenance in progress.
+func putMaintenance(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	var body instance.Maintenance
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if err := lifecycle.StartMaintenance(inst, body.Message, body.AllowedIPs); err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, inst.Maintenance)
+}
+
+// deleteMaintenance ends the maintenance of an instance, and resumes the
+// paused jobs.
+func deleteMaintenance(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := lifecycle.EndMaintenance(inst); err != nil {
+		return wrapError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -72,11 +72,8 @@ func dataExporter(c echo.Context) error {
 	}
 
 	w := c.Response()
-	w.Header().Set(echo.HeaderContentType, "application/zip")
-	filename := domain + ".zip"
-	if len(exportDoc.PartsCursors) > 0 {
-		filename = fmt.Sprintf("%s - part%03d.zip", domain, cursor.Number)
-	}
+	w.Header().Set(echo.HeaderContentType, move.ExportContentType(&exportDoc))
+	filename := move.ExportFilename(&exportDoc, domain, cursor)
 	w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
 	w.WriteHeader(http.StatusOK)
 
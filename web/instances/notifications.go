@@ -0,0 +1,58 @@
+package instances
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/notification/center"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/mail"
+	"github.com/cozy/cozy-stack/worker/mails"
+	"github.com/labstack/echo/v4"
+)
+
+// previewNotificationMail renders the mail of a stack notification with some
+// sample data, and with the branding of the context of the instance. The
+// ContentType parameter can be used to choose between the HTML and the text
+// version of the mail.
+func previewNotificationMail(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	opts, err := center.PreviewStackMail(inst, c.Param("category"))
+	if err == center.ErrCategoryNotFound {
+		return jsonapi.NotFound(err)
+	}
+	if err != nil {
+		return wrapError(err)
+	}
+
+	locale := c.QueryParam("locale")
+	if locale == "" {
+		locale = opts.Locale
+	}
+	j := &job.Job{JobID: "preview", Domain: inst.Domain}
+	ctx := job.NewWorkerContext("0", j, inst)
+	_, parts, err := mails.RenderMail(ctx, opts.TemplateName, mail.DefaultLayout, locale, inst.Domain, opts.TemplateValues)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	contentType := c.QueryParam("ContentType")
+	if contentType == "" {
+		contentType = "text/html"
+	}
+	for _, part := range parts {
+		if part.Type != contentType {
+			continue
+		}
+		if part.Type == "text/html" {
+			return c.HTML(http.StatusOK, part.Body)
+		}
+		return c.String(http.StatusOK, part.Body)
+	}
+	return jsonapi.NotFound(fmt.Errorf("Cannot render the mail with content-type %q", contentType))
+}
@@ -0,0 +1,57 @@
+package instances
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/app"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+// getProvisioning returns the provisioning profile of the context of the
+// instance, and the report of its last provisioning.
+func getProvisioning(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	profile, ok := app.GetProvisioningProfile(inst)
+	if !ok {
+		return jsonapi.NotFound(errors.New("no provisioning profile for this context"))
+	}
+	report, err := app.GetProvisioningReport(inst)
+	if err != nil && !errors.Is(err, app.ErrNotFound) {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"profile": profile,
+		"report":  report,
+	})
+}
+
+// provisionInstance pushes a job to converge the instance toward the
+// provisioning profile of its context.
+func provisionInstance(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if _, ok := app.GetProvisioningProfile(inst); !ok {
+		return jsonapi.NotFound(errors.New("no provisioning profile for this context"))
+	}
+	msg, err := job.NewMessage(map[string]interface{}{})
+	if err != nil {
+		return wrapError(err)
+	}
+	j, err := job.System().PushJob(inst, &job.JobRequest{
+		WorkerType: "provisioning",
+		Message:    msg,
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusAccepted, j)
+}
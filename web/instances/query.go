@@ -0,0 +1,126 @@
+package instances
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 10000
+	queryBatchSize    = 1000
+)
+
+// mangoQuery is the subset of a Mango query that can be sent by an admin.
+// The limit is given by the Limit parameter, and the pagination is made by
+// the stack.
+type mangoQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Fields   []string               `json:"fields,omitempty"`
+	Sort     json.RawMessage        `json:"sort,omitempty"`
+	UseIndex json.RawMessage        `json:"use_index,omitempty"`
+	Skip     int                    `json:"skip,omitempty"`
+	Limit    int                    `json:"limit"`
+	Bookmark string                 `json:"bookmark,omitempty"`
+}
+
+// queryDoctype executes a read-only Mango query on the database of an
+// instance, and streams the documents as NDJSON. The queries that cannot use
+// an index are rejected, except if the Unoptimized parameter is true.
+func queryDoctype(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	doctype := c.Param("doctype")
+	if err := permission.CheckDoctypeName(doctype, false); err != nil {
+		return jsonapi.InvalidParameter("doctype", err)
+	}
+
+	limit := defaultQueryLimit
+	if param := c.QueryParam("Limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil {
+			return jsonapi.InvalidParameter("Limit", err)
+		}
+		if limit <= 0 {
+			return jsonapi.InvalidParameter("Limit", errors.New("Limit must be positive"))
+		}
+		if limit > maxQueryLimit {
+			limit = maxQueryLimit
+		}
+	}
+	unoptimized, _ := strconv.ParseBool(c.QueryParam("Unoptimized"))
+
+	var query mangoQuery
+	if err := json.NewDecoder(c.Request().Body).Decode(&query); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if query.Selector == nil {
+		return jsonapi.InvalidAttribute("selector", errors.New("The selector is missing"))
+	}
+	if err := mango.Validate(mango.Map(query.Selector)); err != nil {
+		return jsonapi.InvalidAttribute("selector", err)
+	}
+	query.Bookmark = ""
+	query.Limit = queryBatchSize
+	if limit < queryBatchSize {
+		query.Limit = limit
+	}
+
+	explain, err := couchdb.ExplainFind(inst, doctype, &query)
+	if couchdb.IsNoDatabaseError(err) {
+		return c.NoContent(http.StatusOK)
+	}
+	if couchdb.IsBadRequestError(err) && !couchdb.IsNoUsableIndexError(err) {
+		// For example, a $regex that CouchDB can't compile
+		return jsonapi.InvalidAttribute("selector", err)
+	}
+	if err != nil {
+		return err
+	}
+	if explain.IsFullScan() && !unoptimized {
+		return jsonapi.BadRequest(errors.New("No index can be used for this query: use Unoptimized to allow a full scan"))
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for sent := 0; sent < limit; {
+		var docs []json.RawMessage
+		var res *couchdb.FindResponse
+		if unoptimized {
+			res, err = couchdb.FindDocsRawUnoptimized(inst, doctype, &query, &docs)
+		} else {
+			res, err = couchdb.FindDocsRaw(inst, doctype, &query, &docs)
+		}
+		if err != nil {
+			_ = encoder.Encode(map[string]string{"error": err.Error()})
+			break
+		}
+		for _, doc := range docs {
+			if sent >= limit {
+				break
+			}
+			_ = encoder.Encode(doc)
+			sent++
+		}
+		w.Flush()
+		if len(docs) < query.Limit || res.Bookmark == "" {
+			break
+		}
+		query.Bookmark = res.Bookmark
+		query.Skip = 0
+	}
+	return nil
+}
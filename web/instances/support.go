@@ -0,0 +1,41 @@
+package instances
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/session"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// createSupportCode returns a short-lived URL that an operator of the support
+// can open in a browser to access the instance, if the user has granted an
+// access to the support from the settings.
+func createSupportCode(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+
+	operator := c.QueryParam("operator")
+	code, err := session.CreateSupportCode(inst, operator)
+	switch {
+	case errors.Is(err, session.ErrInvalidSupportOperator):
+		return jsonapi.InvalidParameter("operator", err)
+	case errors.Is(err, session.ErrNoSupportAccess):
+		return jsonapi.Forbidden(err)
+	case err != nil:
+		return err
+	}
+
+	inst.Logger().WithNamespace("loginaudit").
+		Infof("New support code created for %s from %s", operator, middlewares.ClientIP(c))
+	return c.JSON(http.StatusCreated, echo.Map{
+		"code": code,
+		"url":  inst.PageURL("/auth/support", url.Values{"code": {code}}),
+	})
+}
@@ -0,0 +1,60 @@
+package instances
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+type apiVersioning struct {
+	Policy   map[string]interface{}  `json:"policy"`
+	Override *vfs.VersioningOverride `json:"override,omitempty"`
+}
+
+func newAPIVersioning(inst *instance.Instance) *apiVersioning {
+	policy := inst.VersioningPolicy()
+	return &apiVersioning{
+		Policy: map[string]interface{}{
+			"max_number_of_versions_to_keep": policy.MaxNumber,
+			"min_delay_between_two_versions": policy.MinDelay.String(),
+			"max_age_of_versions":            policy.MaxAge.String(),
+			"max_size_of_versions":           policy.MaxTotalSize,
+		},
+		Override: inst.Versioning,
+	}
+}
+
+func getVersioning(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, newAPIVersioning(inst))
+}
+
+func putVersioning(c echo.Context) error {
+	inst, err := lifecycle.GetInstance(c.Param("domain"))
+	if err != nil {
+		return wrapError(err)
+	}
+	var override vfs.VersioningOverride
+	if err := json.NewDecoder(c.Request().Body).Decode(&override); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if err := override.Validate(); err != nil {
+		return jsonapi.BadRequest(err)
+	}
+	inst.Versioning = &override
+	if override == (vfs.VersioningOverride{}) {
+		inst.Versioning = nil
+	}
+	if err := instance.Update(inst); err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, newAPIVersioning(inst))
+}
@@ -120,6 +120,10 @@ func getIntent(c echo.Context) error {
 	if !allowed {
 		return echo.NewHTTPError(http.StatusForbidden)
 	}
+	// Only the handler chosen by the client can read the relayed payload
+	if intent.Handler != "" && pdoc.SourceID != consts.Apps+"/"+intent.Handler {
+		intent.Payload = nil
+	}
 	api := &apiIntent{intent, instance}
 	return jsonapi.Data(c, http.StatusOK, api, nil)
 }
@@ -128,6 +132,12 @@ func wrapIntentsError(err error) error {
 	if couchdb.IsNotFoundError(err) {
 		return jsonapi.NotFound(err)
 	}
+	switch err {
+	case intent.ErrServiceNotFound:
+		return jsonapi.InvalidParameter("service", err)
+	case intent.ErrAlreadyRelayed, intent.ErrNotPending:
+		return jsonapi.Conflict(err)
+	}
 	return jsonapi.InternalServerError(err)
 }
 
@@ -135,4 +145,6 @@ func wrapIntentsError(err error) error {
 func Routes(router *echo.Group) {
 	router.POST("", createIntent)
 	router.GET("/:id", getIntent)
+	router.POST("/:id/relay", relayIntent)
+	router.POST("/:id/response", respondIntent)
 }
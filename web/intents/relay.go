@@ -0,0 +1,131 @@
+package intents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/intent"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRelaySize is the maximal size of a payload or a response relayed by the
+// stack.
+const maxRelaySize = 1 << 20 // 1MB
+
+// relayTimeout is the maximal duration the stack waits for the next response
+// of the handler.
+const relayTimeout = 5 * time.Minute
+
+func readRelayBody(c echo.Context) (json.RawMessage, error) {
+	buf, err := io.ReadAll(io.LimitReader(c.Request().Body, maxRelaySize+1))
+	if err != nil {
+		return nil, jsonapi.BadRequest(err)
+	}
+	if len(buf) > maxRelaySize {
+		return nil, jsonapi.Errorf(http.StatusRequestEntityTooLarge, "The body is too large")
+	}
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if !json.Valid(buf) {
+		return nil, jsonapi.BadJSON()
+	}
+	return buf, nil
+}
+
+// relayIntent is used by the client of an intent to send a payload to the
+// handler, and to receive the responses of the handler, as a stream of JSON
+// objects separated by newlines.
+func relayIntent(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	pdoc, err := middlewares.GetPermission(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	in := &intent.Intent{}
+	if err = couchdb.GetDoc(inst, consts.Intents, c.Param("id"), in); err != nil {
+		return wrapIntentsError(err)
+	}
+	if pdoc.SourceID != in.Client {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	payload, err := readRelayBody(c)
+	if err != nil {
+		return err
+	}
+
+	listener := intent.Listen(inst, in.ID())
+	defer listener.Close()
+	if err = in.Relay(inst, c.QueryParam("service"), payload); err != nil {
+		return wrapIntentsError(err)
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+	encoder := json.NewEncoder(w)
+	for {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), relayTimeout)
+		res, err := listener.Next(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				res = &intent.Response{IntentID: in.ID(), Error: "timeout", Done: true}
+				_ = encoder.Encode(res)
+			}
+			if errAbort := intent.Abort(inst, in.ID()); errAbort != nil {
+				inst.Logger().WithNamespace("intents").
+					Warnf("Cannot abort intent %s: %s", in.ID(), errAbort)
+			}
+			return nil
+		}
+		if errenc := encoder.Encode(res); errenc != nil {
+			inst.Logger().WithNamespace("intents").
+				Warnf("Cannot encode to JSON: %s", errenc)
+		}
+		w.Flush()
+		if res.Done {
+			return nil
+		}
+	}
+}
+
+// respondIntent is used by the handler of an intent to send a response to
+// the client.
+func respondIntent(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	pdoc, err := middlewares.GetPermission(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	in := &intent.Intent{}
+	if err = couchdb.GetDoc(inst, consts.Intents, c.Param("id"), in); err != nil {
+		return wrapIntentsError(err)
+	}
+	if in.Handler == "" || pdoc.SourceID != consts.Apps+"/"+in.Handler {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	body, err := readRelayBody(c)
+	if err != nil {
+		return err
+	}
+	res := &intent.Response{}
+	if body != nil {
+		if err = json.Unmarshal(body, res); err != nil {
+			return jsonapi.BadJSON()
+		}
+	}
+	if err = in.Respond(inst, res); err != nil {
+		return wrapIntentsError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
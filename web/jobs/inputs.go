@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/konnectorinput"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// answerInput relays the value given by the user to the konnector that has
+// asked for it. The apps that can read the input request, and launch the job
+// of the konnector or its trigger, can answer it.
+func answerInput(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	req, err := konnectorinput.Get(inst, c.Param("input-id"))
+	if err != nil {
+		return wrapInputError(err)
+	}
+	if err := middlewares.Allow(c, permission.GET, req); err != nil {
+		return err
+	}
+	if err := allowInputAnswer(c, req); err != nil {
+		return err
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if err := konnectorinput.Answer(inst, req, body.Value); err != nil {
+		return wrapInputError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func allowInputAnswer(c echo.Context, req *konnectorinput.Request) error {
+	inst := middlewares.GetInstance(c)
+	j, err := job.Get(inst, req.JobID)
+	if err != nil {
+		return middlewares.ErrForbidden
+	}
+	if middlewares.Allow(c, permission.POST, j) == nil {
+		return nil
+	}
+	if j.TriggerID == "" {
+		return middlewares.ErrForbidden
+	}
+	t, err := job.System().GetTrigger(inst, j.TriggerID)
+	if err != nil {
+		return middlewares.ErrForbidden
+	}
+	return middlewares.Allow(c, permission.POST, t)
+}
+
+func wrapInputError(err error) error {
+	switch err {
+	case konnectorinput.ErrExpired:
+		return jsonapi.NewError(http.StatusGone, err.Error())
+	case konnectorinput.ErrInvalidValue:
+		return jsonapi.InvalidAttribute("value", err)
+	}
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -29,19 +30,30 @@ import (
 
 	// import workers
 	_ "github.com/cozy/cozy-stack/worker/archive"
+	_ "github.com/cozy/cozy-stack/worker/audit"
+	_ "github.com/cozy/cozy-stack/worker/cloudimport"
+	_ "github.com/cozy/cozy-stack/worker/contacts"
 	"github.com/cozy/cozy-stack/worker/exec"
+	_ "github.com/cozy/cozy-stack/worker/fsck"
+	_ "github.com/cozy/cozy-stack/worker/instances"
 	_ "github.com/cozy/cozy-stack/worker/log"
 	_ "github.com/cozy/cozy-stack/worker/mails"
 	_ "github.com/cozy/cozy-stack/worker/migrations"
 	_ "github.com/cozy/cozy-stack/worker/moves"
 	_ "github.com/cozy/cozy-stack/worker/notes"
 	_ "github.com/cozy/cozy-stack/worker/oauth"
+	_ "github.com/cozy/cozy-stack/worker/provisioning"
 	_ "github.com/cozy/cozy-stack/worker/push"
+	_ "github.com/cozy/cozy-stack/worker/replication"
 	_ "github.com/cozy/cozy-stack/worker/share"
 	_ "github.com/cozy/cozy-stack/worker/sms"
+	_ "github.com/cozy/cozy-stack/worker/snapshot"
 	_ "github.com/cozy/cozy-stack/worker/thumbnail"
 	_ "github.com/cozy/cozy-stack/worker/trash"
 	_ "github.com/cozy/cozy-stack/worker/updates"
+	_ "github.com/cozy/cozy-stack/worker/usage"
+	_ "github.com/cozy/cozy-stack/worker/warmup"
+	_ "github.com/cozy/cozy-stack/worker/webhooks"
 )
 
 type (
@@ -73,6 +85,9 @@ type (
 		t *job.TriggerInfos
 		s *job.TriggerState
 	}
+	apiTriggerHistory struct {
+		h *job.TriggerHistory
+	}
 	apiTriggerRequest struct {
 		Type            string          `json:"type"`
 		Arguments       string          `json:"arguments"`
@@ -80,6 +95,7 @@ type (
 		Message         json.RawMessage `json:"message"`
 		WorkerArguments json.RawMessage `json:"worker_arguments"`
 		Debounce        string          `json:"debounce"`
+		Timezone        string          `json:"timezone"`
 		Options         *job.JobOptions `json:"options"`
 	}
 )
@@ -152,8 +168,36 @@ func (t apiTriggerState) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t.s)
 }
 
+func (t apiTriggerHistory) ID() string                             { return t.h.DocID }
+func (t apiTriggerHistory) Rev() string                            { return "" }
+func (t apiTriggerHistory) DocType() string                        { return consts.TriggersHistory }
+func (t apiTriggerHistory) Clone() couchdb.Doc                     { return t }
+func (t apiTriggerHistory) SetID(_ string)                         {}
+func (t apiTriggerHistory) SetRev(_ string)                        {}
+func (t apiTriggerHistory) Relationships() jsonapi.RelationshipMap { return nil }
+func (t apiTriggerHistory) Included() []jsonapi.Object             { return nil }
+func (t apiTriggerHistory) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/jobs/triggers/" + t.ID() + "/history"}
+}
+
+func (t apiTriggerHistory) MarshalJSON() ([]byte, error) {
+	// The most recent executions are listed first
+	entries := make([]*job.HistoryEntry, len(t.h.Entries))
+	for i, entry := range t.h.Entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return json.Marshal(struct {
+		Entries []*job.HistoryEntry `json:"entries"`
+		Stats   *job.TriggerStats   `json:"stats"`
+	}{entries, t.h.Stats()})
+}
+
 const bearerAuthScheme = "Bearer "
 
+// maxTriggersPerPage is the maximal number of triggers in a page of the list
+// of triggers.
+const maxTriggersPerPage = 1000
+
 func getQueue(c echo.Context) error {
 	instance := middlewares.GetInstance(c)
 	workerType := c.Param("worker-type")
@@ -168,12 +212,19 @@ func getQueue(c echo.Context) error {
 		return wrapJobsError(err)
 	}
 
+	inFlight, err := job.System().WorkerInFlight(instance, workerType)
+	if err != nil {
+		return wrapJobsError(err)
+	}
+
 	objs := make([]jsonapi.Object, len(js))
 	for i, j := range js {
 		objs[i] = apiJob{j}
 	}
 
-	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+	count := len(objs)
+	meta := jsonapi.Meta{Count: &count, InFlight: &inFlight}
+	return jsonapi.DataListWithMeta(c, http.StatusOK, meta, objs, nil)
 }
 
 func pushJob(c echo.Context) error {
@@ -294,6 +345,7 @@ func newTrigger(c echo.Context) error {
 		Domain:     instance.Domain,
 		Arguments:  req.Arguments,
 		Debounce:   req.Debounce,
+		Timezone:   req.Timezone,
 		Options:    req.Options,
 		Metadata:   md,
 	}, msg)
@@ -360,6 +412,27 @@ func getTriggerState(c echo.Context) error {
 	return jsonapi.Data(c, http.StatusOK, apiTriggerState{t: infos, s: state}, nil)
 }
 
+func getTriggerHistory(c echo.Context) error {
+	instance := middlewares.GetInstance(c)
+	sched := job.System()
+	t, err := sched.GetTrigger(instance, c.Param("trigger-id"))
+	if err != nil {
+		return wrapJobsError(err)
+	}
+	infos := t.Infos()
+	if err = middlewares.Allow(c, permission.GET, t); err != nil {
+		if !allowKonnectorForItsOwnTrigger(c, infos) {
+			return err
+		}
+	}
+
+	history, err := job.GetTriggerHistory(t, t.ID())
+	if err != nil {
+		return wrapJobsError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, apiTriggerHistory{history}, nil)
+}
+
 func getTriggerJobs(c echo.Context) error {
 	instance := middlewares.GetInstance(c)
 
@@ -559,25 +632,41 @@ func getAllTriggers(c echo.Context) error {
 		}
 	}
 
+	page, err := jsonapi.ExtractPage(c, 0, maxTriggersPerPage)
+	if err != nil {
+		return err
+	}
+
 	sched := job.System()
 	ts, err := sched.GetAllTriggers(instance)
 	if err != nil {
 		return wrapJobsError(err)
 	}
 
-	objs := make([]jsonapi.Object, 0, len(ts))
+	matching := make([]job.Trigger, 0, len(ts))
 	for _, t := range ts {
 		tInfos := t.Infos()
 		if hasWorker(tInfos, workerTypes) && hasType(tInfos, triggerTypes) {
-			tInfos.CurrentState, err = job.GetTriggerState(t, t.ID())
-			if err != nil {
-				return wrapJobsError(err)
-			}
-			objs = append(objs, apiTrigger{tInfos, instance})
+			matching = append(matching, t)
 		}
 	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].ID() < matching[j].ID()
+	})
 
-	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+	start, end, next := page.Bounds(len(matching))
+	objs := make([]jsonapi.Object, 0, end-start)
+	for _, t := range matching[start:end] {
+		tInfos := t.Infos()
+		tInfos.CurrentState, err = job.GetTriggerState(t, t.ID())
+		if err != nil {
+			return wrapJobsError(err)
+		}
+		objs = append(objs, apiTrigger{tInfos, instance})
+	}
+
+	total := len(matching)
+	return jsonapi.DataListPage(c, http.StatusOK, objs, &total, next)
 }
 
 func hasWorker(infos *job.TriggerInfos, workers []string) bool {
@@ -802,21 +891,30 @@ func purgeJobs(c echo.Context) error {
 // Routes sets the routing for the jobs service
 func Routes(router *echo.Group) {
 	router.GET("/queue/:worker-type", getQueue)
-	router.POST("/queue/:worker-type", pushJob)
+	router.POST("/queue/:worker-type", pushJob, middlewares.Idempotent)
 	router.POST("/support", contactSupport)
 
 	router.POST("/triggers", newTrigger)
 	router.GET("/triggers", getAllTriggers)
 	router.GET("/triggers/:trigger-id", getTrigger)
 	router.GET("/triggers/:trigger-id/state", getTriggerState)
+	router.GET("/triggers/:trigger-id/history", getTriggerHistory)
 	router.GET("/triggers/:trigger-id/jobs", getTriggerJobs)
 	router.PATCH("/triggers/:trigger-id", patchTrigger)
 	router.POST("/triggers/:trigger-id/launch", launchTrigger)
 	router.DELETE("/triggers/:trigger-id", deleteTrigger)
 
+	router.POST("/webhooks/subscriptions", createSubscription)
+	router.GET("/webhooks/subscriptions", listSubscriptions)
+	router.GET("/webhooks/subscriptions/:subscription-id", getSubscription)
+	router.GET("/webhooks/subscriptions/:subscription-id/deliveries", getSubscriptionDeliveries)
+	router.DELETE("/webhooks/subscriptions/:subscription-id", deleteSubscription)
+
 	router.POST("/webhooks/bi", fireBIWebhook)
 	router.POST("/webhooks/:trigger-id", fireWebhook)
 
+	router.POST("/inputs/:input-id", answerInput)
+
 	router.POST("/clean", cleanJobs)
 	router.DELETE("/purge", purgeJobs)
 	router.GET("/:job-id", getJob)
@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/webhook"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/couchdb/mango"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// apiSubscription is the jsonapi representation of a webhook
+	// subscription. The secret is only sent on creation.
+	apiSubscription struct {
+		s          *webhook.Subscription
+		withSecret bool
+	}
+	apiDeliveryLog struct {
+		l *webhook.DeliveryLog
+	}
+)
+
+func (s apiSubscription) ID() string                             { return s.s.DocID }
+func (s apiSubscription) Rev() string                            { return s.s.DocRev }
+func (s apiSubscription) DocType() string                        { return consts.WebhookSubscriptions }
+func (s apiSubscription) Clone() couchdb.Doc                     { return s }
+func (s apiSubscription) SetID(_ string)                         {}
+func (s apiSubscription) SetRev(_ string)                        {}
+func (s apiSubscription) Relationships() jsonapi.RelationshipMap { return nil }
+func (s apiSubscription) Included() []jsonapi.Object             { return nil }
+func (s apiSubscription) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/jobs/webhooks/subscriptions/" + s.ID()}
+}
+
+func (s apiSubscription) MarshalJSON() ([]byte, error) {
+	sub := *s.s
+	if !s.withSecret {
+		sub.Secret = ""
+	}
+	return json.Marshal(sub)
+}
+
+func (l apiDeliveryLog) ID() string                             { return l.l.DocID }
+func (l apiDeliveryLog) Rev() string                            { return "" }
+func (l apiDeliveryLog) DocType() string                        { return consts.WebhookDeliveries }
+func (l apiDeliveryLog) Clone() couchdb.Doc                     { return l }
+func (l apiDeliveryLog) SetID(_ string)                         {}
+func (l apiDeliveryLog) SetRev(_ string)                        {}
+func (l apiDeliveryLog) Relationships() jsonapi.RelationshipMap { return nil }
+func (l apiDeliveryLog) Included() []jsonapi.Object             { return nil }
+func (l apiDeliveryLog) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/jobs/webhooks/subscriptions/" + l.ID() + "/deliveries"}
+}
+
+func (l apiDeliveryLog) MarshalJSON() ([]byte, error) {
+	// The most recent deliveries are listed first
+	entries := make([]*webhook.DeliveryEntry, len(l.l.Entries))
+	for i, entry := range l.l.Entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return json.Marshal(struct {
+		Entries []*webhook.DeliveryEntry `json:"entries"`
+	}{entries})
+}
+
+func createSubscription(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.WebhookSubscriptions); err != nil {
+		return err
+	}
+
+	var opts webhook.Options
+	if _, err := jsonapi.Bind(c.Request().Body, &opts); err != nil {
+		return jsonapi.BadJSON()
+	}
+
+	// The payloads contain the whole documents, so the application must be
+	// able to read all the documents of the doctype.
+	if err := middlewares.AllowWholeType(c, permission.GET, opts.Doctype); err != nil {
+		return err
+	}
+	pdoc, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+	switch pdoc.Type {
+	case permission.TypeWebapp, permission.TypeKonnector, permission.TypeOauth, permission.TypeCLI:
+		// OK
+	default:
+		return jsonapi.Forbidden(errors.New("Only the applications can subscribe to webhooks"))
+	}
+
+	sub, err := webhook.Create(middlewares.GetInstance(c), opts, pdoc)
+	if err != nil {
+		return wrapWebhookError(err)
+	}
+	return jsonapi.Data(c, http.StatusCreated, apiSubscription{sub, true}, nil)
+}
+
+func listSubscriptions(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.WebhookSubscriptions); err != nil {
+		return err
+	}
+
+	pdoc, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+	page, err := jsonapi.ExtractPage(c, 0, maxTriggersPerPage)
+	if err != nil {
+		return err
+	}
+
+	all, err := webhook.List(middlewares.GetInstance(c))
+	if err != nil {
+		return wrapWebhookError(err)
+	}
+	subs := make([]*webhook.Subscription, 0, len(all))
+	for _, sub := range all {
+		if canManageSubscription(pdoc, sub) {
+			subs = append(subs, sub)
+		}
+	}
+	start, end, next := page.Bounds(len(subs))
+	objs := make([]jsonapi.Object, 0, end-start)
+	for _, sub := range subs[start:end] {
+		objs = append(objs, apiSubscription{sub, false})
+	}
+	total := len(subs)
+	return jsonapi.DataListPage(c, http.StatusOK, objs, &total, next)
+}
+
+func getSubscription(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.WebhookSubscriptions); err != nil {
+		return err
+	}
+
+	sub, err := getOwnSubscription(c, middlewares.GetInstance(c))
+	if err != nil {
+		return err
+	}
+	return jsonapi.Data(c, http.StatusOK, apiSubscription{sub, false}, nil)
+}
+
+func getSubscriptionDeliveries(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.WebhookSubscriptions); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	sub, err := getOwnSubscription(c, inst)
+	if err != nil {
+		return err
+	}
+	log, err := webhook.GetDeliveryLog(inst, sub.DocID)
+	if err != nil {
+		return wrapWebhookError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, apiDeliveryLog{log}, nil)
+}
+
+func deleteSubscription(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.WebhookSubscriptions); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	sub, err := getOwnSubscription(c, inst)
+	if err != nil {
+		return err
+	}
+	if err := webhook.Delete(inst, sub); err != nil {
+		return wrapWebhookError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getOwnSubscription loads the subscription from the URL parameter, and checks
+// that it has been created by the application that makes the request.
+func getOwnSubscription(c echo.Context, inst *instance.Instance) (*webhook.Subscription, error) {
+	pdoc, err := middlewares.GetPermission(c)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := webhook.Get(inst, c.Param("subscription-id"))
+	if err != nil {
+		return nil, wrapWebhookError(err)
+	}
+	if !canManageSubscription(pdoc, sub) {
+		return nil, jsonapi.Forbidden(errors.New("The subscription belongs to another application"))
+	}
+	return sub, nil
+}
+
+// canManageSubscription returns true if the subscription has been created by
+// the application of the permission. The CLI can manage all of them.
+func canManageSubscription(pdoc *permission.Permission, sub *webhook.Subscription) bool {
+	if pdoc.Type == permission.TypeCLI {
+		return true
+	}
+	return pdoc.Type == sub.SourceType && pdoc.SourceID == sub.SourceID
+}
+
+func wrapWebhookError(err error) error {
+	switch {
+	case errors.Is(err, webhook.ErrInvalidURL):
+		return jsonapi.InvalidAttribute("url", err)
+	case errors.Is(err, webhook.ErrInvalidVerb):
+		return jsonapi.InvalidAttribute("verbs", err)
+	case errors.Is(err, mango.ErrInvalidSelector):
+		return jsonapi.InvalidAttribute("selector", err)
+	case errors.Is(err, webhook.ErrTooManySubscriptions):
+		return jsonapi.BadRequest(err)
+	case couchdb.IsNotFoundError(err), couchdb.IsNoDatabaseError(err):
+		return jsonapi.NotFound(err)
+	}
+	return wrapJobsError(err)
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/labstack/echo/v4"
+)
+
+// workersStats returns the metrics of the workers of this stack process, for
+// the autoscalers.
+func workersStats(c echo.Context) error {
+	stats, err := job.System().WorkersStats()
+	if err != nil {
+		return wrapJobsError(err)
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// drainWorkers puts the workers of this stack process in drain mode: they
+// finish their running jobs, but don't take new ones. The worker query
+// parameter can be used to drain only some workers.
+func drainWorkers(c echo.Context) error {
+	types := c.QueryParams()["worker"]
+	if err := job.System().DrainWorkers(types...); err != nil {
+		return wrapJobsError(err)
+	}
+	return workersStats(c)
+}
+
+// resumeWorkers ends the drain mode.
+func resumeWorkers(c echo.Context) error {
+	types := c.QueryParams()["worker"]
+	if err := job.System().ResumeWorkers(types...); err != nil {
+		return wrapJobsError(err)
+	}
+	return workersStats(c)
+}
+
+// AdminRoutes sets the routing for the administration of the workers
+func AdminRoutes(router *echo.Group) {
+	router.GET("/workers", workersStats)
+	router.POST("/workers/drain", drainWorkers)
+	router.POST("/workers/resume", resumeWorkers)
+}
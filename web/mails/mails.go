@@ -0,0 +1,58 @@
+package mails
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/mail"
+	"github.com/labstack/echo/v4"
+)
+
+// recordBounce is the webhook that can be called by the SMTP server when a
+// mail has bounced.
+func recordBounce(c echo.Context) error {
+	var bounce mail.Bounce
+	if err := json.NewDecoder(c.Request().Body).Decode(&bounce); err != nil {
+		return jsonapi.BadJSON()
+	}
+	doc, err := mail.RecordBounce(&bounce)
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, doc)
+}
+
+func getBounce(c echo.Context) error {
+	doc, err := mail.GetBounce(c.Param("email"))
+	if err != nil {
+		return wrapError(err)
+	}
+	if doc == nil {
+		return jsonapi.NotFound(errors.New("No bounce for this address"))
+	}
+	return c.JSON(http.StatusOK, doc)
+}
+
+func clearBounce(c echo.Context) error {
+	if err := mail.ClearBounce(c.Param("email")); err != nil {
+		return wrapError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func wrapError(err error) error {
+	if err == mail.ErrInvalidBounce {
+		return jsonapi.BadRequest(err)
+	}
+	return err
+}
+
+// AdminRoutes sets the routing for the admin interface to manage the
+// addresses where mails have bounced.
+func AdminRoutes(router *echo.Group) {
+	router.POST("/bounces", recordBounce)
+	router.GET("/bounces/:email", getBounce)
+	router.DELETE("/bounces/:email", clearBounce)
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"strconv"
+
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/labstack/echo/v4"
+)
+
+// BulkEventsParam is the query-string parameter used by the clients of the
+// bulk endpoints to ask for bulk realtime events.
+const BulkEventsParam = "bulk_events"
+
+// BulkEvents is a middleware for the endpoints that can change a lot of
+// documents at once. When the client sends bulk_events=true in the
+// query-string, the realtime events for the changes are coalesced in bulk
+// events, published at the end of the request. It must be used after
+// NeedInstance.
+func BulkEvents(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if enabled, _ := strconv.ParseBool(c.QueryParam(BulkEventsParam)); !enabled {
+			return next(c)
+		}
+		flush := couchdb.CoalesceEvents(GetInstance(c))
+		defer flush()
+		return next(c)
+	}
+}
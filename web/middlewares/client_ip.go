@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/labstack/echo/v4"
+)
+
+// ClientIP returns the IP address of the client that has made the request.
+// Contrary to c.RealIP(), the X-Forwarded-For and X-Real-IP headers are used
+// only when the request comes from a trusted proxy (see the trusted_proxies
+// parameter of the config file), as anyone can send them.
+func ClientIP(c echo.Context) string {
+	return RemoteIP(c.Request())
+}
+
+// RemoteIP is the same as ClientIP, but for an HTTP request.
+func RemoteIP(req *http.Request) string {
+	cfg := config.GetConfig()
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	ip := net.ParseIP(remote)
+	if ip == nil || !cfg.IsTrustedProxy(ip) {
+		return remote
+	}
+
+	// The X-Forwarded-For header is read from the right, as each proxy
+	// appends the address of its client, and the first address that is not
+	// a trusted proxy is the client.
+	var forwarded []string
+	for _, header := range req.Header.Values(echo.HeaderXForwardedFor) {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		remote = hop.String()
+		if !cfg.IsTrustedProxy(hop) {
+			return remote
+		}
+	}
+	if len(forwarded) > 0 {
+		return remote
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(req.Header.Get(echo.HeaderXRealIP))); realIP != nil {
+		return realIP.String()
+	}
+	return remote
+}
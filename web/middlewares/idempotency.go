@@ -0,0 +1,201 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// IdempotencyKeyHeader is the header used by the clients to make a
+	// mutating request idempotent.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is added to the responses replayed for a retry.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize is the maximal size of a response body that is
+	// stored. The larger responses are not replayed.
+	maxIdempotentBodySize = 1 << 20
+)
+
+// idempotentHeaders are the headers of a response that are replayed.
+var idempotentHeaders = []string{
+	echo.HeaderContentType,
+	echo.HeaderLocation,
+	"Etag",
+}
+
+type idempotentResponse struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	// BodyHash is the SHA-256 of the request body, as a retry must send the
+	// same body.
+	BodyHash string            `json:"body_hash"`
+	Status   int               `json:"status"`
+	Header   map[string]string `json:"header,omitempty"`
+	Body     []byte            `json:"body,omitempty"`
+}
+
+// idempotentRecorder keeps a copy of the response sent to the client.
+type idempotentRecorder struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *idempotentRecorder) Write(p []byte) (int, error) {
+	if !r.overflow {
+		if r.body.Len()+len(p) > maxIdempotentBodySize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// hashingBody computes the hash of the request body while it is read by the
+// handler.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	eof  bool
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// sum reads the end of the body that has not been read by the handler, and
+// returns the hash of the whole body.
+func (b *hashingBody) sum() (string, error) {
+	if !b.eof {
+		if _, err := io.Copy(io.Discard, b); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(b.hash.Sum(nil)), nil
+}
+
+func (r *idempotentRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Idempotent is a middleware for the mutating endpoints that supports the
+// Idempotency-Key header. The response is stored for the (token, key) pair,
+// and it is replayed when the client retries the request with the same key,
+// instead of doing the action twice. It must be used after NeedInstance.
+func Idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return next(c)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return jsonapi.InvalidParameter(IdempotencyKeyHeader,
+				errors.New("The key is too long"))
+		}
+		token := GetRequestToken(c)
+		if token == "" {
+			return next(c)
+		}
+
+		inst := GetInstance(c)
+		sum := sha256.Sum256([]byte(token + "\x00" + key))
+		hash := hex.EncodeToString(sum[:])
+		cacheKey := "idempotency:" + inst.Domain + ":" + hash
+		req := c.Request()
+
+		// Two requests with the same key are not executed in parallel: the
+		// second one waits for the first one, and replays its response. The
+		// lock is refreshed while the first one is running, as it can be a
+		// long upload.
+		mu := config.Lock().LongOperation(inst, "idempotency/"+hash)
+		if err := mu.Lock(); err != nil {
+			return jsonapi.Conflict(errors.New("A request with the same Idempotency-Key is in progress"))
+		}
+		defer mu.Unlock()
+
+		body := &hashingBody{ReadCloser: req.Body, hash: sha256.New()}
+		req.Body = body
+
+		cache := config.GetConfig().CacheStorage
+		if buf, ok := cache.Get(cacheKey); ok {
+			var stored idempotentResponse
+			if err := json.Unmarshal(buf, &stored); err == nil {
+				bodyHash, err := body.sum()
+				if err != nil {
+					return err
+				}
+				if stored.Method != req.Method || stored.Path != req.URL.Path ||
+					stored.Query != req.URL.RawQuery || stored.BodyHash != bodyHash {
+					return jsonapi.NewError(http.StatusUnprocessableEntity,
+						"The Idempotency-Key has already been used for another request")
+				}
+				res := c.Response()
+				for k, v := range stored.Header {
+					res.Header().Set(k, v)
+				}
+				res.Header().Set(IdempotentReplayedHeader, "true")
+				res.WriteHeader(stored.Status)
+				_, err = res.Write(stored.Body)
+				return err
+			}
+		}
+
+		res := c.Response()
+		recorder := &idempotentRecorder{ResponseWriter: res.Writer}
+		res.Writer = recorder
+		err := next(c)
+		res.Writer = recorder.ResponseWriter
+		if err != nil || !res.Committed || recorder.overflow {
+			return err
+		}
+		// The server errors are not stored, so that the client can retry
+		if res.Status >= http.StatusInternalServerError {
+			return nil
+		}
+		bodyHash, err := body.sum()
+		if err != nil {
+			return nil
+		}
+
+		stored := idempotentResponse{
+			Method:   req.Method,
+			Path:     req.URL.Path,
+			Query:    req.URL.RawQuery,
+			BodyHash: bodyHash,
+			Status:   res.Status,
+			Header:   make(map[string]string),
+			Body:     recorder.body.Bytes(),
+		}
+		for _, h := range idempotentHeaders {
+			if v := res.Header().Get(h); v != "" {
+				stored.Header[h] = v
+			}
+		}
+		if buf, err := json.Marshal(stored); err == nil {
+			cache.Set(cacheKey, buf, config.GetConfig().IdempotencyTTL)
+		}
+		return nil
+	}
+}
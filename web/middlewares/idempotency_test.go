@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotent(t *testing.T) {
+	config.UseTestFile(t)
+	inst := &instance.Instance{Domain: "alice.cozy.local"}
+
+	calls := 0
+	e := echo.New()
+	handler := Idempotent(func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusCreated, echo.Map{"calls": calls})
+	})
+	do := func(method, path, token, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("instance", inst)
+		assert.NoError(t, handler(c))
+		return rec
+	}
+
+	t.Run("WithoutKey", func(t *testing.T) {
+		calls = 0
+		do(http.MethodPost, "/jobs/queue/thumbnail", "token1", "")
+		do(http.MethodPost, "/jobs/queue/thumbnail", "token1", "")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		calls = 0
+		first := do(http.MethodPost, "/jobs/queue/thumbnail", "token1", "key-replay")
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+		second := do(http.MethodPost, "/jobs/queue/thumbnail", "token1", "key-replay")
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Contains(t, second.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("KeyIsScopedByToken", func(t *testing.T) {
+		calls = 0
+		do(http.MethodPost, "/jobs/queue/thumbnail", "token1", "key-scoped")
+		do(http.MethodPost, "/jobs/queue/thumbnail", "token2", "key-scoped")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("KeyReusedForAnotherRequest", func(t *testing.T) {
+		calls = 0
+		do(http.MethodPost, "/jobs/queue/thumbnail", "token1", "key-reused")
+		req := httptest.NewRequest(http.MethodPost, "/sharings/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer token1")
+		req.Header.Set(IdempotencyKeyHeader, "key-reused")
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("instance", inst)
+		err := handler(c)
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("KeyReusedWithAnotherQuery", func(t *testing.T) {
+		calls = 0
+		do(http.MethodPost, "/files/?Type=file&Name=foo", "token1", "key-query")
+		do(http.MethodPost, "/files/?Type=file&Name=foo", "token1", "key-query")
+		assert.Equal(t, 1, calls)
+		req := httptest.NewRequest(http.MethodPost, "/files/?Type=file&Name=bar", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer token1")
+		req.Header.Set(IdempotencyKeyHeader, "key-query")
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("instance", inst)
+		assert.Error(t, handler(c))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("KeyReusedWithAnotherBody", func(t *testing.T) {
+		calls = 0
+		send := func(body string) error {
+			req := httptest.NewRequest(http.MethodPost, "/files/", strings.NewReader(body))
+			req.Header.Set(echo.HeaderAuthorization, "Bearer token1")
+			req.Header.Set(IdempotencyKeyHeader, "key-body")
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.Set("instance", inst)
+			return handler(c)
+		}
+		assert.NoError(t, send("foo"))
+		assert.NoError(t, send("foo"))
+		assert.Equal(t, 1, calls)
+		assert.Error(t, send("bar"))
+		assert.Equal(t, 1, calls)
+	})
+}
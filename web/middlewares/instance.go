@@ -54,7 +54,7 @@ func NeedInstance(next echo.HandlerFunc) echo.HandlerFunc {
 func CheckInstanceDeleting(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		i := GetInstance(c)
-		if i.Deleting {
+		if i.Deleting || i.IsDeletionScheduled() {
 			err := instance.ErrNotFound
 			errHTTP := echo.NewHTTPError(http.StatusNotFound, err)
 			errHTTP.Internal = err
@@ -73,6 +73,12 @@ func CheckInstanceBlocked(next echo.HandlerFunc) echo.HandlerFunc {
 		if _, ok := GetCLIPermission(c); ok {
 			return next(c)
 		}
+		if i.IsDeletionScheduled() {
+			err := instance.ErrNotFound
+			errHTTP := echo.NewHTTPError(http.StatusNotFound, err)
+			errHTTP.Internal = err
+			return errHTTP
+		}
 		if i.CheckInstanceBlocked() {
 			return handleBlockedInstance(c, i, next)
 		}
@@ -80,6 +86,48 @@ func CheckInstanceBlocked(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// CheckInstanceMaintenance is a middleware that closes the routes of an
+// instance in maintenance, except for the CLI and the IP addresses in the
+// allowlist of the maintenance.
+func CheckInstanceMaintenance(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		i := GetInstance(c)
+		if !i.InMaintenance() {
+			return next(c)
+		}
+		if _, ok := GetCLIPermission(c); ok {
+			return next(c)
+		}
+		if i.Maintenance.AllowIP(ClientIP(c)) {
+			return next(c)
+		}
+
+		message := i.Maintenance.Message
+		if message == "" {
+			message = i.Translate("Instance maintenance Default message")
+		}
+		switch AcceptedContentType(c) {
+		case jsonapi.ContentType, echo.MIMEApplicationJSON:
+			return jsonapi.DataError(c, &jsonapi.Error{
+				Status: http.StatusServiceUnavailable,
+				Title:  "Maintenance",
+				Code:   "maintenance",
+				Detail: message,
+			})
+		default:
+			return c.Render(http.StatusServiceUnavailable, "instance_maintenance.html", echo.Map{
+				"Domain":       i.ContextualDomain(),
+				"ContextName":  i.ContextName,
+				"Locale":       i.Locale,
+				"Title":        i.TemplateTitle(),
+				"Favicon":      Favicon(i),
+				"Message":      message,
+				"SupportEmail": i.SupportEmailAddress(),
+			})
+		}
+	}
+}
+
 func handleBlockedInstance(c echo.Context, i *instance.Instance, next echo.HandlerFunc) error {
 	returnCode := http.StatusServiceUnavailable
 	contentType := AcceptedContentType(c)
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckInstanceMaintenance(t *testing.T) {
+	config.UseTestFile(t)
+	inst := &instance.Instance{
+		Domain: "alice.cozy.local",
+		Maintenance: &instance.Maintenance{
+			Message:    "Back soon",
+			AllowedIPs: []string{"203.0.113.7"},
+		},
+	}
+
+	e := echo.New()
+	handler := CheckInstanceMaintenance(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	do := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("instance", inst)
+		c.Set(acceptContentTypeKey, echo.MIMEApplicationJSON)
+		assert.NoError(t, handler(c))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, do("203.0.113.7:1234", ""))
+	assert.Equal(t, http.StatusServiceUnavailable, do("198.51.100.1:1234", ""))
+	// The X-Forwarded-For header is used only from a trusted proxy
+	assert.Equal(t, http.StatusServiceUnavailable, do("198.51.100.1:1234", "203.0.113.7"))
+	assert.Equal(t, http.StatusNoContent, do("127.0.0.1:1234", "203.0.113.7"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("instance", inst)
+	c.Set(acceptContentTypeKey, echo.MIMEApplicationJSON)
+	assert.NoError(t, handler(c))
+	var body struct {
+		Errors []struct {
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	if assert.Len(t, body.Errors, 1) {
+		assert.Equal(t, "maintenance", body.Errors[0].Code)
+		assert.Equal(t, "Back soon", body.Errors[0].Detail)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/cozy/cozy-stack/model/app"
+	"github.com/cozy/cozy-stack/model/audit"
 	"github.com/cozy/cozy-stack/model/bitwarden/settings"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/oauth"
@@ -307,6 +308,24 @@ func ParseJWT(c echo.Context, instance *instance.Instance, token string) (*permi
 
 		return pdoc, nil
 
+	case consts.DelegatedAudience:
+		pdoc, err := permission.GetForDelegatedToken(instance, claims.Subject)
+		if err != nil {
+			logger.WithNamespace("permissions").
+				Debugf("invalid token: no delegated permission - %s", err)
+			return nil, err
+		}
+		return pdoc, nil
+
+	case consts.UploadAudience:
+		pdoc, err := permission.GetForUploadToken(instance, claims.Subject)
+		if err != nil {
+			logger.WithNamespace("permissions").
+				Debugf("invalid token: no upload permission - %s", err)
+			return nil, err
+		}
+		return pdoc, nil
+
 	default:
 		return nil, echo.NewHTTPError(http.StatusBadRequest, "Unrecognized token audience "+claims.Audience)
 	}
@@ -367,14 +386,46 @@ func GetPermission(c echo.Context) (*permission.Permission, error) {
 	if err != nil {
 		return nil, err
 	}
+	if pdoc.Type == permission.TypeUpload && !isFileUpload(c) {
+		return nil, ErrForbidden
+	}
+	if err := permission.TrackUsage(inst, pdoc); err != nil {
+		inst.Logger().WithNamespace("permissions").
+			Warnf("Cannot track the usage of %s: %s", pdoc.SourceID, err)
+	}
 
 	c.Set(contextPermissionDoc, pdoc)
 	return pdoc, nil
 }
 
+// isFileUpload returns true if the request is the upload of a file in a
+// directory. It is the only request allowed for an upload token: the POST verb
+// on a directory also gives access to some other routes, like the creation of
+// sub-directories.
+func isFileUpload(c echo.Context) bool {
+	return c.Request().Method == http.MethodPost &&
+		c.Path() == "/files/:file-id" &&
+		c.QueryParam("Type") == consts.FileType
+}
+
 // AllowWholeType validates that the context permission set can use a verb on
-// the whold doctype
+// the whold doctype. An OAuth client with a sync scope can't use the whole
+// io.cozy.files doctype, as it must not see the files outside of its scope.
 func AllowWholeType(c echo.Context, v permission.Verb, doctype string) error {
+	if doctype == consts.Files && HasSyncScope(c) {
+		return ErrForbidden
+	}
+	return allowWholeType(c, v, doctype)
+}
+
+// AllowFilteredFeed is like AllowWholeType, but it accepts an OAuth client
+// with a sync scope for io.cozy.files. It must only be used for the changes
+// feeds that filter the files outside of the sync scope.
+func AllowFilteredFeed(c echo.Context, v permission.Verb, doctype string) error {
+	return allowWholeType(c, v, doctype)
+}
+
+func allowWholeType(c echo.Context, v permission.Verb, doctype string) error {
 	pdoc, err := GetPermission(c)
 	if err != nil {
 		return err
@@ -429,6 +480,9 @@ func AllowVFS(c echo.Context, v permission.Verb, o vfs.Fetcher) error {
 	if err != nil {
 		return err
 	}
+	if err := checkSyncScope(c, v, o); err != nil {
+		return err
+	}
 	if pdoc.Permissions.IsMaximal() {
 		return nil
 	}
@@ -439,6 +493,31 @@ func AllowVFS(c echo.Context, v permission.Verb, o vfs.Fetcher) error {
 	return nil
 }
 
+// checkSyncScope forbids an OAuth client with a sync scope to access the
+// files and directories outside of it. The root directory can still be read.
+func checkSyncScope(c echo.Context, v permission.Verb, o vfs.Fetcher) error {
+	client, ok := GetOAuthClient(c)
+	if !ok || len(client.SyncScope) == 0 {
+		return nil
+	}
+	if o.ID() == consts.RootDirID && v != permission.GET {
+		return ErrForbidden
+	}
+	allowed, err := vfs.AllowedBySyncScope(GetInstance(c).VFS(), client.SyncScope, o)
+	if err != nil || !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// HasSyncScope returns true if the request is made by an OAuth client that
+// can only synchronize some directories. Such a client cannot use the routes
+// that list the files without checking their paths.
+func HasSyncScope(c echo.Context) bool {
+	client, ok := GetOAuthClient(c)
+	return ok && len(client.SyncScope) > 0
+}
+
 // CanWriteToAnyDirectory checks that the context permission allows to write to
 // a directory on the VFS.
 func CanWriteToAnyDirectory(c echo.Context) error {
@@ -582,3 +661,17 @@ func GetOAuthClient(c echo.Context) (*oauth.Client, bool) {
 	}
 	return perm.Client.(*oauth.Client), true
 }
+
+// GetAuditActor returns who is making the request, to record it in the audit
+// trail.
+func GetAuditActor(c echo.Context) audit.Actor {
+	actor := audit.Actor{IP: ClientIP(c)}
+	if perm, err := GetPermission(c); err == nil {
+		actor.Kind = perm.Type
+		actor.ID = perm.SourceID
+	}
+	if sess, ok := GetSession(c); ok && sess.SupportAccess() != nil {
+		actor.Support = sess.SupportOperator
+	}
+	return actor
+}
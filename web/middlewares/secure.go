@@ -325,3 +325,26 @@ func appendCSPRule(currentRules, ruleType string, appendedValues ...string) (new
 	}
 	return
 }
+
+// ExtendCSPRule is like AppendCSPRule, but when the directive is missing from
+// the CSP headers, it starts with the sources of default-src, as the browser
+// would have used them for this directive.
+func ExtendCSPRule(c echo.Context, ruleType string, appendedValues ...string) {
+	currentRules := c.Response().Header().Get(echo.HeaderContentSecurityPolicy)
+	if _, ok := cspRuleValues(currentRules, ruleType); !ok && ruleType != "form-action" {
+		if defaults, ok := cspRuleValues(currentRules, "default-src"); ok {
+			appendedValues = append(defaults, appendedValues...)
+		}
+	}
+	AppendCSPRule(c, ruleType, appendedValues...)
+}
+
+func cspRuleValues(rules, ruleType string) ([]string, bool) {
+	for _, rule := range strings.Split(rules, ";") {
+		fields := strings.Fields(rule)
+		if len(fields) > 0 && fields[0] == ruleType {
+			return fields[1:], true
+		}
+	}
+	return nil, false
+}
@@ -122,4 +122,22 @@ func TestSecure(t *testing.T) {
 		r = appendCSPRule("script '*'; toto;", "frame-ancestors", "new-rule")
 		assert.Equal(t, "script '*'; toto;frame-ancestors new-rule;", r)
 	})
+
+	t.Run("ExtendCSPRule", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(echo.GET, "http://app.cozy.local/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		h := c.Response().Header()
+
+		h.Set(echo.HeaderContentSecurityPolicy, "default-src 'self';connect-src 'self';")
+		ExtendCSPRule(c, "connect-src", "https://analytics.example.net/")
+		assert.Equal(t, "default-src 'self';connect-src 'self' https://analytics.example.net/;", h.Get(echo.HeaderContentSecurityPolicy))
+
+		ExtendCSPRule(c, "worker-src", "https://workers.example.net/")
+		assert.Equal(t, "default-src 'self';connect-src 'self' https://analytics.example.net/;worker-src 'self' https://workers.example.net/;", h.Get(echo.HeaderContentSecurityPolicy))
+
+		ExtendCSPRule(c, "form-action", "https://form.example.net/")
+		assert.Contains(t, h.Get(echo.HeaderContentSecurityPolicy), "form-action https://form.example.net/;")
+	})
 }
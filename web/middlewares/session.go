@@ -1,14 +1,28 @@
 package middlewares
 
 import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/cozy/cozy-stack/model/audit"
 	"github.com/cozy/cozy-stack/model/session"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/labstack/echo/v4"
 )
 
 const sessionKey = "session"
 
+// SupportAccessHeader is the HTTP header added to the responses for the
+// requests made with a session opened by the support.
+const SupportAccessHeader = "X-Cozy-Support-Access"
+
 // LoadSession is a middlewares that loads the session and stores it the
-// request context.
+// request context. The requests made with a session opened by the support are
+// checked here, so that the restrictions of the support access apply to all
+// the routes that accept a session.
 func LoadSession(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		i, ok := GetInstanceSafe(c)
@@ -16,12 +30,95 @@ func LoadSession(next echo.HandlerFunc) echo.HandlerFunc {
 			sess, err := session.FromCookie(c, i)
 			if err == nil {
 				c.Set(sessionKey, sess)
+				if sess.SupportAccess() != nil {
+					if err := checkSupportAccess(c, sess); err != nil {
+						return err
+					}
+				}
 			}
 		}
 		return next(c)
 	}
 }
 
+// supportForbiddenRoutes are the prefixes of the routes that cannot be used
+// with a session opened by the support, even with a read-write access, as
+// they would allow the operator to take over the account.
+var supportForbiddenRoutes = []string{
+	"/auth",
+	"/settings/passphrase",
+	"/settings/hint",
+	"/settings/email",
+	"/settings/instance/auth_mode",
+	"/settings/instance/deletion",
+	"/settings/support-access",
+}
+
+// supportAllowedRoutes are the exceptions to supportForbiddenRoutes.
+var supportAllowedRoutes = map[string]bool{
+	"/auth/logout":  true,
+	"/auth/support": true,
+}
+
+// checkSupportAccess is called for the requests made with a session opened
+// by an operator of the support: they are tagged, logged and recorded in the
+// audit trail, and only the safe methods are allowed if the access granted by
+// the user is read-only.
+func checkSupportAccess(c echo.Context, sess *session.Session) error {
+	inst := GetInstance(c)
+	req := c.Request()
+	c.Response().Header().Set(SupportAccessHeader, sess.SupportAccessID)
+	inst.Logger().WithNamespace("support").
+		Infof("%s %s by %s", req.Method, req.URL.Path, sess.SupportOperator)
+
+	if isSupportForbiddenRoute(req.URL.Path) {
+		return jsonapi.Forbidden(errors.New("This route cannot be used by the support"))
+	}
+	if !isReadOnlyRequest(req) && sess.ReadOnly() {
+		return jsonapi.Forbidden(errors.New("The support access is read-only"))
+	}
+	actor := audit.Actor{Kind: audit.ActorSupport, ID: sess.SupportOperator, IP: ClientIP(c)}
+	audit.Record(inst, audit.ActionAccess, consts.SupportAccesses, sess.SupportAccessID,
+		actor, nil, map[string]interface{}{
+			"method": req.Method,
+			"path":   req.URL.Path,
+		})
+	return nil
+}
+
+func isSupportForbiddenRoute(p string) bool {
+	p = path.Clean("/" + p)
+	if supportAllowedRoutes[p] {
+		return false
+	}
+	for _, prefix := range supportForbiddenRoutes {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyQueries are the routes that use the POST method to query the
+// documents, without modifying them.
+var readOnlyQueries = map[string]bool{
+	"_find":     true,
+	"_all_docs": true,
+	"_index":    true,
+	"_changes":  true,
+	"_bulk_get": true,
+}
+
+func isReadOnlyRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return readOnlyQueries[path.Base(req.URL.Path)]
+	}
+	return false
+}
+
 // IsLoggedIn returns true if the context has a valid session cookie.
 func IsLoggedIn(c echo.Context) bool {
 	_, ok := GetSession(c)
@@ -0,0 +1,115 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportAccess(t *testing.T) {
+	t.Run("IsReadOnlyRequest", func(t *testing.T) {
+		readOnly := []struct{ method, path string }{
+			{http.MethodGet, "/files/io.cozy.files.root-dir"},
+			{http.MethodHead, "/files/download/123"},
+			{http.MethodOptions, "/data/io.cozy.contacts/"},
+			{http.MethodPost, "/data/io.cozy.contacts/_find"},
+			{http.MethodPost, "/data/io.cozy.contacts/_all_docs"},
+			{http.MethodPost, "/data/io.cozy.contacts/_index"},
+			{http.MethodPost, "/files/_find"},
+		}
+		for _, r := range readOnly {
+			req, _ := http.NewRequest(r.method, "http://alice.cozy.local"+r.path, nil)
+			assert.True(t, isReadOnlyRequest(req), "%s %s", r.method, r.path)
+		}
+
+		writes := []struct{ method, path string }{
+			{http.MethodPost, "/data/io.cozy.contacts/"},
+			{http.MethodPost, "/data/io.cozy.contacts/_bulk_docs"},
+			{http.MethodPut, "/data/io.cozy.contacts/123"},
+			{http.MethodPatch, "/files/123"},
+			{http.MethodDelete, "/files/123"},
+			{http.MethodPost, "/settings/support-access"},
+		}
+		for _, r := range writes {
+			req, _ := http.NewRequest(r.method, "http://alice.cozy.local"+r.path, nil)
+			assert.False(t, isReadOnlyRequest(req), "%s %s", r.method, r.path)
+		}
+	})
+	t.Run("IsSupportForbiddenRoute", func(t *testing.T) {
+		forbidden := []string{
+			"/auth/authorize",
+			"/auth/register",
+			"/auth/session_code",
+			"/auth/../auth/authorize",
+			"/settings/passphrase",
+			"/settings/passphrase/check",
+			"/settings/instance/auth_mode",
+			"/settings/email",
+			"/settings/support-access",
+		}
+		for _, p := range forbidden {
+			assert.True(t, isSupportForbiddenRoute(p), p)
+		}
+
+		allowed := []string{
+			"/auth/logout",
+			"/authors",
+			"/settings/instance",
+			"/settings/passphrases-are-not-a-route",
+			"/files/io.cozy.files.root-dir",
+		}
+		for _, p := range allowed {
+			assert.False(t, isSupportForbiddenRoute(p), p)
+		}
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	config.UseTestFile(t)
+	cfg := config.GetConfig()
+	proxies := cfg.TrustedProxies
+	defer func() { cfg.TrustedProxies = proxies }()
+	_, network, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	cfg.TrustedProxies = []*net.IPNet{network}
+
+	newRequest := func(remote string, forwarded ...string) *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "http://alice.cozy.local/", nil)
+		req.RemoteAddr = remote
+		for _, f := range forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		return req
+	}
+
+	t.Run("UntrustedRemote", func(t *testing.T) {
+		req := newRequest("203.0.113.7:4242", "198.51.100.1")
+		assert.Equal(t, "203.0.113.7", RemoteIP(req))
+	})
+
+	t.Run("TrustedProxy", func(t *testing.T) {
+		req := newRequest("10.0.0.1:4242", "198.51.100.1")
+		assert.Equal(t, "198.51.100.1", RemoteIP(req))
+	})
+
+	t.Run("SpoofedHeader", func(t *testing.T) {
+		// The client has sent a fake X-Forwarded-For, and the proxy has
+		// appended the real address of the client
+		req := newRequest("10.0.0.1:4242", "192.0.2.66, 198.51.100.1")
+		assert.Equal(t, "198.51.100.1", RemoteIP(req))
+	})
+
+	t.Run("ChainOfProxies", func(t *testing.T) {
+		req := newRequest("10.0.0.1:4242", "198.51.100.1, 10.0.0.2", "10.0.0.3")
+		assert.Equal(t, "198.51.100.1", RemoteIP(req))
+	})
+
+	t.Run("NoHeader", func(t *testing.T) {
+		req := newRequest("10.0.0.1:4242")
+		assert.Equal(t, "10.0.0.1", RemoteIP(req))
+	})
+}
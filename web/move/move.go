@@ -49,6 +49,9 @@ func createExport(c echo.Context) error {
 	exportOptions.ContextualDomain = inst.ContextualDomain()
 	exportOptions.MoveTo = nil
 	exportOptions.TokenSource = ""
+	if err := exportOptions.EncryptWithPassphrase(inst); err != nil {
+		return err
+	}
 
 	msg, err := job.NewMessage(exportOptions)
 	if err != nil {
@@ -75,7 +78,7 @@ func exportHandler(c echo.Context) error {
 		return err
 	}
 
-	return jsonapi.Data(c, http.StatusOK, exportDoc, nil)
+	return jsonapi.Data(c, http.StatusOK, exportDoc.Manifest(), nil)
 }
 
 func exportDataHandler(c echo.Context) error {
@@ -98,11 +101,8 @@ func exportDataHandler(c echo.Context) error {
 	middlewares.AppendCSPRule(c, "frame-ancestors", from)
 
 	w := c.Response()
-	w.Header().Set(echo.HeaderContentType, "application/zip")
-	filename := "My Cozy.zip"
-	if len(exportDoc.PartsCursors) > 0 {
-		filename = fmt.Sprintf("My Cozy - part%03d.zip", cursor.Number)
-	}
+	w.Header().Set(echo.HeaderContentType, move.ExportContentType(exportDoc))
+	filename := move.ExportFilename(exportDoc, "My Cozy", cursor)
 	w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%s", filename))
 	w.WriteHeader(http.StatusOK)
 
@@ -121,7 +121,7 @@ func precheckImport(c echo.Context) error {
 	}
 
 	inst := middlewares.GetInstance(c)
-	if err := move.CheckImport(inst, options.SettingsURL); err != nil {
+	if err := move.CheckImport(inst, options.SettingsURL, options.Passphrase); err != nil {
 		return wrapError(err)
 	}
 
@@ -543,6 +543,8 @@ func wrapError(err error) error {
 		return jsonapi.PreconditionFailed("url", err)
 	case move.ErrNotEnoughSpace:
 		return jsonapi.Errorf(http.StatusRequestEntityTooLarge, "%s", err)
+	case move.ErrPassphraseRequired, move.ErrInvalidPassphrase:
+		return jsonapi.InvalidParameter("passphrase", err)
 	}
 	return err
 }
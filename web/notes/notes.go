@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cozy/cozy-stack/model/contact"
 	"github.com/cozy/cozy-stack/model/note"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/sharing"
@@ -21,6 +22,7 @@ import (
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/cozy/cozy-stack/web/files"
 	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/cozy/cozy-stack/web/sharings"
 	"github.com/labstack/echo/v4"
 )
 
@@ -39,32 +41,82 @@ func CreateNote(c echo.Context) error {
 	// complicated and costly, but is needed for creating a note in a shared by
 	// link folder for example.
 	if err := middlewares.AllowWholeType(c, permission.POST, consts.Files); err != nil {
-		dirID, errd := doc.GetDirID(inst)
-		if errd != nil {
-			return err
+		if errc := allowCreationInDir(c, doc, err); errc != nil {
+			return errc
 		}
-		fileDoc, errf := vfs.NewFileDoc(
-			"tmp.cozy-note", // We don't care, but it can't be empty
-			dirID,
-			0,   // We don't care
-			nil, // Let the VFS compute the md5sum
-			consts.NoteMimeType,
-			"text",
-			time.Now(),
-			false, // Not executable
-			false, // Not trashed
-			false, // Not encrypted
-			nil,   // No tags
-		)
-		if errf != nil {
+	}
+
+	file, err := note.Create(inst, doc)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return files.FileData(c, http.StatusCreated, file, false, nil)
+}
+
+// CreateNoteFromTemplate is the API handler for POST /notes/from-template. It
+// creates a note from a template, with the variables in its title and content
+// replaced by their values.
+func CreateNoteFromTemplate(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	var attrs struct {
+		TemplateID string                 `json:"template_id"`
+		DirID      string                 `json:"dir_id"`
+		Title      string                 `json:"title"`
+		Schema     map[string]interface{} `json:"schema"`
+		ContactID  string                 `json:"contact_id"`
+		SharingID  string                 `json:"sharing_id"`
+		Variables  map[string]string      `json:"variables"`
+	}
+	if _, err := jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if attrs.TemplateID == "" {
+		return jsonapi.InvalidAttribute("template_id", errors.New("The template_id is mandatory"))
+	}
+
+	if err := middlewares.AllowTypeAndID(c, permission.GET, consts.NotesTemplates, attrs.TemplateID); err != nil {
+		return err
+	}
+	tpl, err := note.FindTemplate(inst, attrs.TemplateID)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	opts := &note.TemplateOptions{
+		DirID:     attrs.DirID,
+		Title:     attrs.Title,
+		Schema:    attrs.Schema,
+		Variables: attrs.Variables,
+		CreatedBy: getCreatedBy(c),
+	}
+	if attrs.ContactID != "" {
+		if err := middlewares.AllowTypeAndID(c, permission.GET, consts.Contacts, attrs.ContactID); err != nil {
 			return err
 		}
-		if err := middlewares.AllowVFS(c, permission.POST, fileDoc); err != nil {
+		opts.Contact, err = contact.Find(inst, attrs.ContactID)
+		if err != nil {
+			return jsonapi.NotFound(err)
+		}
+	}
+	if attrs.SharingID != "" {
+		opts.Sharing, err = sharing.FindSharing(inst, attrs.SharingID)
+		if err != nil {
+			return jsonapi.NotFound(err)
+		}
+		if err := sharings.CheckGetPermissions(c, opts.Sharing); err != nil {
 			return err
 		}
 	}
 
-	file, err := note.Create(inst, doc)
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.Files); err != nil {
+		doc := &note.Document{DirID: attrs.DirID}
+		if errc := allowCreationInDir(c, doc, err); errc != nil {
+			return errc
+		}
+	}
+
+	file, err := note.CreateFromTemplate(inst, tpl, opts)
 	if err != nil {
 		return wrapError(err)
 	}
@@ -72,6 +124,34 @@ func CreateNote(c echo.Context) error {
 	return files.FileData(c, http.StatusCreated, file, false, nil)
 }
 
+// allowCreationInDir checks the finer permissions for creating a note in the
+// directory of the document, like a shared by link folder. The forbidden error
+// is returned when the directory can't be checked.
+func allowCreationInDir(c echo.Context, doc *note.Document, forbidden error) error {
+	inst := middlewares.GetInstance(c)
+	dirID, err := doc.GetDirID(inst)
+	if err != nil {
+		return forbidden
+	}
+	fileDoc, err := vfs.NewFileDoc(
+		"tmp.cozy-note", // We don't care, but it can't be empty
+		dirID,
+		0,   // We don't care
+		nil, // Let the VFS compute the md5sum
+		consts.NoteMimeType,
+		"text",
+		time.Now(),
+		false, // Not executable
+		false, // Not trashed
+		false, // Not encrypted
+		nil,   // No tags
+	)
+	if err != nil {
+		return forbidden
+	}
+	return middlewares.AllowVFS(c, permission.POST, fileDoc)
+}
+
 // ListNotes is the API handler for GET /notes. It returns the list of the
 // notes.
 func ListNotes(c echo.Context) error {
@@ -143,6 +223,34 @@ func GetNoteText(c echo.Context) error {
 	return c.String(http.StatusOK, content)
 }
 
+// ExportNote is the API handler for GET /notes/:id/export?format=xxx. It
+// returns the note converted to markdown or PDF, with its images. It can be
+// used with a token for a share by link or a preview.
+func ExportNote(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	fileID := c.Param("id")
+	file, err := inst.VFS().FileByID(fileID)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	if err := middlewares.AllowVFS(c, permission.GET, file); err != nil {
+		return err
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = note.ExportMarkdown
+	}
+	export, err := note.ExportFile(inst, file, format)
+	if err != nil {
+		return wrapError(err)
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		vfs.ContentDisposition("attachment", export.Filename))
+	return c.Blob(http.StatusOK, export.Mime, export.Content)
+}
+
 // GetSteps is the API handler for GET /notes/:id/steps?Version=xxx. It returns
 // the steps since the given version. If the version is too old, and the steps
 // are no longer available, it returns a 412 response with the whole document
@@ -274,6 +382,36 @@ func PutTelepointer(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// PutPresence is the API handler for PUT /notes/:id/presence. It tells the
+// other editors of the note that a user has opened, is still editing, or has
+// closed the note.
+func PutPresence(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	fileID := c.Param("id")
+	file, err := inst.VFS().FileByID(fileID)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	// A share-preview token is not enough, the presence is only for the
+	// members that can edit the note (share-interact).
+	if err := middlewares.AllowVFS(c, permission.PUT, file); err != nil {
+		return err
+	}
+
+	presence := note.Event{}
+	if _, err := jsonapi.Bind(c.Request().Body, &presence); err != nil {
+		return err
+	}
+	presence.SetID(file.ID())
+
+	if err := note.PutPresence(inst, presence); err != nil {
+		return wrapError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
 // ForceNoteSync is the API handler for POST /notes/:id/sync. It forces writing
 // the note to the VFS
 func ForceNoteSync(c echo.Context) error {
@@ -446,13 +584,16 @@ func GetImage(c echo.Context) error {
 // Routes sets the routing for the collaborative edition of notes.
 func Routes(router *echo.Group) {
 	router.POST("", CreateNote)
+	router.POST("/from-template", CreateNoteFromTemplate)
 	router.GET("", ListNotes)
 	router.GET("/:id", GetNote)
 	router.GET("/:id/text", GetNoteText)
+	router.GET("/:id/export", ExportNote)
 	router.GET("/:id/steps", GetSteps)
 	router.PATCH("/:id", PatchNote)
 	router.PUT("/:id/title", ChangeTitle)
 	router.PUT("/:id/telepointer", PutTelepointer)
+	router.PUT("/:id/presence", PutPresence)
 	router.POST("/:id/sync", ForceNoteSync)
 	router.GET("/:id/open", OpenNoteURL)
 	router.PUT("/:id/schema", UpdateNoteSchema)
@@ -464,10 +605,18 @@ func wrapError(err error) *jsonapi.Error {
 	switch err {
 	case note.ErrInvalidSchema:
 		return jsonapi.InvalidAttribute("schema", err)
-	case note.ErrInvalidFile, sharing.ErrCannotOpenFile:
+	case note.ErrInvalidFile, note.ErrTemplateNotFound, sharing.ErrCannotOpenFile:
 		return jsonapi.NotFound(err)
 	case note.ErrNoSteps, note.ErrInvalidSteps:
 		return jsonapi.BadRequest(err)
+	case note.ErrMissingSessionID, note.ErrInvalidPresence:
+		return jsonapi.BadRequest(err)
+	case note.ErrInvalidExportFormat:
+		return jsonapi.InvalidParameter("format", err)
+	case note.ErrPDFExportDisabled:
+		return jsonapi.Errorf(http.StatusNotImplemented, "%s", err)
+	case note.ErrExportTooLarge:
+		return jsonapi.Errorf(http.StatusRequestEntityTooLarge, "%s", err)
 	case note.ErrCannotApply:
 		return jsonapi.Conflict(err)
 	case os.ErrNotExist, vfs.ErrParentDoesNotExist, vfs.ErrParentInTrash:
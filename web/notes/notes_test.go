@@ -13,6 +13,7 @@ import (
 	"github.com/cozy/cozy-stack/model/note"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/realtime"
 	"github.com/cozy/cozy-stack/tests/testutils"
 	"github.com/cozy/cozy-stack/web/errors"
@@ -36,7 +37,7 @@ func TestNotes(t *testing.T) {
 	testutils.NeedCouchdb(t)
 	setup := testutils.NewSetup(t, t.Name())
 	inst := setup.GetTestInstance()
-	_, token := setup.GetTestClient(consts.Files)
+	_, token := setup.GetTestClient(consts.Files + " " + consts.NotesTemplates)
 
 	ts := setup.GetTestServerMultipleRoutes(map[string]func(*echo.Group){
 		"/files":    files.Routes,
@@ -113,6 +114,59 @@ func TestNotes(t *testing.T) {
 		noteID = obj.Path("$.data.id").String().NotEmpty().Raw()
 	})
 
+	t.Run("CreateNoteFromTemplate", func(t *testing.T) {
+		e := testutils.CreateTestClient(t, ts.URL)
+
+		tpl := &note.Template{
+			Title: "Meeting {{date}}",
+			RawContent: map[string]interface{}{
+				"type": "doc",
+				"content": []interface{}{
+					map[string]interface{}{
+						"type": "paragraph",
+						"content": []interface{}{
+							map[string]interface{}{"type": "text", "text": "Place: {{place}}"},
+						},
+					},
+				},
+			},
+		}
+		require.NoError(t, couchdb.CreateDoc(inst, tpl))
+
+		obj := e.POST("/notes/from-template").
+			WithHeader("Authorization", "Bearer "+token).
+			WithHeader("Content-Type", "application/json").
+			WithBytes([]byte(`{
+        "data": {
+          "type": "io.cozy.notes.documents",
+          "attributes": {
+            "template_id": "` + tpl.ID() + `",
+            "variables": { "date": "2026-10-16", "place": "Paris" }
+          }
+        }
+      }`)).
+			Expect().Status(201).
+			JSON(httpexpect.ContentOpts{MediaType: "application/vnd.api+json"}).
+			Object()
+
+		attrs := obj.Path("$.data.attributes").Object()
+		attrs.ValueEqual("name", "Meeting 2026-10-16.cozy-note")
+		meta := attrs.Value("metadata").Object()
+		meta.ValueEqual("title", "Meeting 2026-10-16")
+		meta.Path("$.content.content[0].content[0].text").String().Equal("Place: Paris")
+
+		e.POST("/notes/from-template").
+			WithHeader("Authorization", "Bearer "+token).
+			WithHeader("Content-Type", "application/json").
+			WithBytes([]byte(`{
+        "data": {
+          "type": "io.cozy.notes.documents",
+          "attributes": { "template_id": "` + tpl.ID() + `-unknown" }
+        }
+      }`)).
+			Expect().Status(404)
+	})
+
 	t.Run("GetNote", func(t *testing.T) {
 		e := testutils.CreateTestClient(t, ts.URL)
 
@@ -551,6 +605,64 @@ func TestNotes(t *testing.T) {
 		wg.Wait()
 	})
 
+	t.Run("PutPresence", func(t *testing.T) {
+		e := testutils.CreateTestClient(t, ts.URL)
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			sub := realtime.GetHub().Subscriber(inst)
+			sub.Subscribe(consts.NotesEvents)
+			wg.Done()
+
+			e := <-sub.Channel
+			assert.Equal(t, "UPDATED", e.Verb)
+			assert.Equal(t, noteID, e.Doc.ID())
+			doc, ok := e.Doc.(note.Event)
+			assert.True(t, ok)
+			assert.Equal(t, consts.NotesPresences, doc["doctype"])
+			assert.Equal(t, "543781490137", doc["sessionID"])
+			assert.Equal(t, "joined", doc["status"])
+			assert.Equal(t, "Alice", doc["name"])
+			wg.Done()
+		}()
+
+		wg.Wait()
+
+		e.PUT("/notes/"+noteID+"/presence").
+			WithHeader("Authorization", "Bearer "+token).
+			WithHeader("Content-Type", "application/json").
+			WithBytes([]byte(`{
+        "data": {
+          "type": "io.cozy.notes.presences",
+          "attributes": {
+            "sessionID": "543781490137",
+            "status": "unknown"
+          }
+        }
+      }`)).
+			Expect().Status(400)
+
+		wg.Add(1)
+		e.PUT("/notes/"+noteID+"/presence").
+			WithHeader("Authorization", "Bearer "+token).
+			WithHeader("Content-Type", "application/json").
+			WithBytes([]byte(`{
+        "data": {
+          "type": "io.cozy.notes.presences",
+          "attributes": {
+            "sessionID": "543781490137",
+            "status": "joined",
+            "name": "Alice",
+            "color": "#ff0000"
+          }
+        }
+      }`)).
+			Expect().Status(204)
+
+		wg.Wait()
+	})
+
 	t.Run("NoteMarkdown", func(t *testing.T) {
 		// Force the changes to the VFS
 		err := note.Update(inst, noteID)
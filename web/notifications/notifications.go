@@ -2,11 +2,13 @@ package notifications
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/cozy/cozy-stack/model/app"
 	"github.com/cozy/cozy-stack/model/notification"
 	"github.com/cozy/cozy-stack/model/notification/center"
+	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
@@ -50,6 +52,137 @@ func createHandler(c echo.Context) error {
 	return jsonapi.Data(c, http.StatusCreated, &apiNotif{n}, nil)
 }
 
+type apiBadges struct {
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+func (b *apiBadges) ID() string                             { return consts.NotificationsBadges }
+func (b *apiBadges) Rev() string                            { return "" }
+func (b *apiBadges) DocType() string                        { return consts.NotificationsBadges }
+func (b *apiBadges) Clone() couchdb.Doc                     { return b }
+func (b *apiBadges) SetID(_ string)                         {}
+func (b *apiBadges) SetRev(_ string)                        {}
+func (b *apiBadges) Relationships() jsonapi.RelationshipMap { return nil }
+func (b *apiBadges) Included() []jsonapi.Object             { return nil }
+func (b *apiBadges) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/notifications/badges"}
+}
+
+// getNotification returns the notification of the request, if the permission
+// allows to update it.
+func getNotification(c echo.Context) (*notification.Notification, error) {
+	inst := middlewares.GetInstance(c)
+	n, err := center.Find(inst, c.Param("id"))
+	if err != nil {
+		return nil, wrapErrors(err)
+	}
+	if err := middlewares.Allow(c, permission.PATCH, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func markAsReadHandler(c echo.Context) error {
+	n, err := getNotification(c)
+	if err != nil {
+		return err
+	}
+	if err := center.MarkAsRead(middlewares.GetInstance(c), n); err != nil {
+		return wrapErrors(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, &apiNotif{n}, nil)
+}
+
+func markAsUnreadHandler(c echo.Context) error {
+	n, err := getNotification(c)
+	if err != nil {
+		return err
+	}
+	if err := center.MarkAsUnread(middlewares.GetInstance(c), n); err != nil {
+		return wrapErrors(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, &apiNotif{n}, nil)
+}
+
+func archiveHandler(c echo.Context) error {
+	n, err := getNotification(c)
+	if err != nil {
+		return err
+	}
+	if err := center.Archive(middlewares.GetInstance(c), n); err != nil {
+		return wrapErrors(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, &apiNotif{n}, nil)
+}
+
+func markAllAsReadHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.PATCH, consts.Notifications); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	count, err := center.MarkAllAsRead(inst, c.QueryParam("slug"))
+	if err != nil {
+		return wrapErrors(err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"count": count})
+}
+
+func badgesHandler(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Notifications); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	counts, err := center.BadgeCounts(inst)
+	if err != nil {
+		return wrapErrors(err)
+	}
+	badges := &apiBadges{Counts: counts}
+	for _, count := range counts {
+		badges.Total += count
+	}
+	return jsonapi.Data(c, http.StatusOK, badges, nil)
+}
+
+// smsStatusHandler is the callback called by the SMS provider to give the
+// delivery status of a SMS sent for a notification.
+func smsStatusHandler(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	id := c.Param("id")
+	if !center.CheckSMSStatusToken(inst, id, c.QueryParam("token")) {
+		return jsonapi.Forbidden(center.ErrUnauthorized)
+	}
+	status := c.FormValue("status")
+	if status == "" {
+		status = center.SMSStatusFromDLR(c.FormValue("dlr"))
+	}
+	if status == "" {
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(c.Request().Body).Decode(&body); err == nil {
+			status = body.Status
+		}
+	}
+	if status == "" {
+		return jsonapi.BadRequest(errors.New("The delivery status is missing"))
+	}
+	if !center.IsValidSMSStatus(status) {
+		return jsonapi.BadRequest(errors.New("The delivery status is unknown"))
+	}
+	err := center.RecordSMSDelivery(inst, id, &notification.SMSDelivery{
+		MessageID: c.FormValue("id"),
+		Status:    status,
+	})
+	if err != nil {
+		if couchdb.IsNotFoundError(err) {
+			return jsonapi.NotFound(err)
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
 func wrapErrors(err error) error {
 	if err == nil {
 		return nil
@@ -63,6 +196,8 @@ func wrapErrors(err error) error {
 		return jsonapi.Forbidden(err)
 	case center.ErrCategoryNotFound:
 		return jsonapi.Forbidden(err)
+	case center.ErrNotificationNotFound:
+		return jsonapi.NotFound(err)
 	case app.ErrNotFound:
 		return jsonapi.NotFound(err)
 	}
@@ -72,4 +207,11 @@ func wrapErrors(err error) error {
 // Routes sets the routing for the notification service.
 func Routes(router *echo.Group) {
 	router.POST("", createHandler)
+	router.GET("/badges", badgesHandler)
+	router.POST("/read-all", markAllAsReadHandler)
+	router.POST("/:id/read", markAsReadHandler)
+	router.DELETE("/:id/read", markAsUnreadHandler)
+	router.POST("/:id/archive", archiveHandler)
+	router.GET("/:id/sms-status", smsStatusHandler)
+	router.POST("/:id/sms-status", smsStatusHandler)
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cozy/cozy-stack/model/office"
 	"github.com/cozy/cozy-stack/model/permission"
@@ -85,16 +86,93 @@ func Callback(c echo.Context) error {
 	return c.JSON(http.StatusOK, echo.Map{"error": 0})
 }
 
+// wopiClaims checks the access token sent by a WOPI document server.
+func wopiClaims(c echo.Context) (*office.WOPIClaims, error) {
+	inst := middlewares.GetInstance(c)
+	token := c.QueryParam("access_token")
+	if token == "" {
+		header := c.Request().Header.Get(echo.HeaderAuthorization)
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	claims, err := office.CheckWOPIToken(inst, c.Param("id"), token)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	return claims, nil
+}
+
+// WOPICheckFileInfo is the handler for the CheckFileInfo operation of WOPI.
+func WOPICheckFileInfo(c echo.Context) error {
+	claims, err := wopiClaims(c)
+	if err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	info, err := office.WOPICheckFileInfo(inst, claims)
+	if err != nil {
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+// WOPIGetFile is the handler for the GetFile operation of WOPI.
+func WOPIGetFile(c echo.Context) error {
+	claims, err := wopiClaims(c)
+	if err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	file, err := office.WOPIGetFile(inst, claims)
+	if err != nil {
+		return wrapError(err)
+	}
+	err = vfs.ServeFileContent(inst.VFS(), file, nil, "", "attachment", c.Request(), c.Response())
+	if err == vfs.ErrFileQuarantined {
+		return wrapError(err)
+	}
+	return err
+}
+
+// WOPIPutFile is the handler for the PutFile operation of WOPI. The document
+// server sends the new content of the file, and the stack saves it as a new
+// version.
+func WOPIPutFile(c echo.Context) error {
+	claims, err := wopiClaims(c)
+	if err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	req := c.Request()
+	file, err := office.WOPIPutFile(inst, claims, req.Body, req.ContentLength)
+	if err != nil {
+		inst.Logger().WithNamespace("office").
+			Infof("Cannot save file from WOPI server: %s", err)
+		return wrapError(err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"LastModifiedTime": file.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
 // Routes sets the routing for the collaborative edition of office documents.
 func Routes(router *echo.Group) {
 	router.GET("/:id/open", Open)
 	router.POST("/callback", Callback)
+
+	// Routes for the document servers speaking WOPI
+	router.GET("/wopi/files/:id", WOPICheckFileInfo)
+	router.GET("/wopi/files/:id/contents", WOPIGetFile)
+	router.POST("/wopi/files/:id/contents", WOPIPutFile)
 }
 
 func wrapError(err error) *jsonapi.Error {
 	switch err {
 	case office.ErrNoServer, office.ErrInvalidFile, sharing.ErrCannotOpenFile:
 		return jsonapi.NotFound(err)
+	case office.ErrReadOnly, vfs.ErrFileQuarantined:
+		return jsonapi.Forbidden(err)
+	case vfs.ErrFileInTrash:
+		return jsonapi.Conflict(err)
 	case office.ErrInternalServerError:
 		return jsonapi.InternalServerError(err)
 	case os.ErrNotExist, vfs.ErrParentDoesNotExist, vfs.ErrParentInTrash:
@@ -2,12 +2,14 @@ package permissions
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cozy/cozy-stack/model/audit"
 	"github.com/cozy/cozy-stack/model/oauth"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/sharing"
@@ -142,6 +144,12 @@ func createPermission(c echo.Context) error {
 		}
 	}
 
+	limits, err := codeLimitsFromQuery(c)
+	if err != nil {
+		return err
+	}
+	subdoc.CodesLimits = nil
+
 	var codes map[string]string
 	var shortcodes map[string]string
 
@@ -157,6 +165,12 @@ func createPermission(c echo.Context) error {
 			if err != nil {
 				return err
 			}
+			if limits != nil {
+				if subdoc.CodesLimits == nil {
+					subdoc.CodesLimits = make(map[string]*permission.CodeLimits, len(names))
+				}
+				subdoc.CodesLimits[name] = limits.Clone()
+			}
 		}
 	}
 
@@ -188,10 +202,223 @@ func createPermission(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	audit.Record(instance, audit.ActionCreate, consts.Permissions, pdoc.ID(),
+		middlewares.GetAuditActor(c), nil, audit.PermissionState(pdoc))
 
 	return jsonapi.Data(c, http.StatusOK, &APIPermission{pdoc, nil}, nil)
 }
 
+// delegatePermission is used by a webapp to mint a short-lived token for a
+// third party, with a subset of its permissions restricted to some documents.
+func delegatePermission(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	parent, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+
+	var subdoc permission.Permission
+	if _, err = jsonapi.Bind(c.Request().Body, &subdoc); err != nil {
+		return err
+	}
+
+	ttl := consts.DelegatedTokenValidityDuration
+	if param := c.QueryParam("ttl"); param != "" {
+		d, err := bigduration.ParseDuration(param)
+		if err != nil || d <= 0 {
+			return jsonapi.InvalidParameter("ttl", errors.New("invalid duration"))
+		}
+		ttl = d
+	}
+	if ttl > consts.MaxDelegatedTokenValidityDuration {
+		ttl = consts.MaxDelegatedTokenValidityDuration
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	if parent.Type != permission.TypeWebapp {
+		return permission.ErrOnlyAppCanDelegate
+	}
+	claims, ok := c.Get("claims").(permission.Claims)
+	if !ok {
+		return permission.ErrOnlyAppCanDelegate
+	}
+	md, err := metadata.NewWithApp(claims.Subject, "", permission.DocTypeVersion)
+	if err != nil {
+		return err
+	}
+	if subdoc.Metadata != nil {
+		subdoc.Metadata.EnsureCreatedFields(md)
+		md = subdoc.Metadata
+	}
+
+	pdoc, err := permission.CreateDelegatedSet(inst, parent, subdoc.Permissions, expiresAt, md)
+	if err != nil {
+		return err
+	}
+	audit.Record(inst, audit.ActionCreate, consts.Permissions, pdoc.ID(),
+		middlewares.GetAuditActor(c), nil, audit.PermissionState(pdoc))
+	token, err := inst.CreateDelegatedToken(pdoc.ID())
+	if err != nil {
+		return err
+	}
+
+	// The token is not persisted, it is only sent in the response
+	pdoc.Codes = map[string]string{"delegated": token}
+	return jsonapi.Data(c, http.StatusCreated, &APIPermission{pdoc, nil}, nil)
+}
+
+// createUploadPermission is used by a webapp, like Drive, to create a
+// long-lived token for a device that can only upload files in a directory.
+func createUploadPermission(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	parent, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+
+	var attrs struct {
+		DirID string `json:"dir_id"`
+		Label string `json:"label"`
+	}
+	if _, err = jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return err
+	}
+
+	var expiresAt *time.Time
+	if param := c.QueryParam("ttl"); param != "" {
+		d, err := bigduration.ParseDuration(param)
+		if err != nil || d <= 0 {
+			return jsonapi.InvalidParameter("ttl", errors.New("invalid duration"))
+		}
+		at := time.Now().Add(d)
+		expiresAt = &at
+	}
+
+	if parent.Type != permission.TypeWebapp {
+		return permission.ErrOnlyAppCanMintUpload
+	}
+	claims, ok := c.Get("claims").(permission.Claims)
+	if !ok {
+		return permission.ErrOnlyAppCanMintUpload
+	}
+	md, err := metadata.NewWithApp(claims.Subject, "", permission.DocTypeVersion)
+	if err != nil {
+		return err
+	}
+
+	pdoc, err := permission.CreateUploadSet(inst, parent, attrs.DirID, attrs.Label, expiresAt, md)
+	if err != nil {
+		return err
+	}
+	audit.Record(inst, audit.ActionCreate, consts.Permissions, pdoc.ID(),
+		middlewares.GetAuditActor(c), nil, audit.PermissionState(pdoc))
+	token, err := inst.CreateUploadToken(pdoc.ID())
+	if err != nil {
+		return err
+	}
+
+	// The token is not persisted, it is only sent in the response
+	pdoc.Codes = map[string]string{"upload": token}
+	return jsonapi.Data(c, http.StatusCreated, &APIPermission{pdoc, nil}, nil)
+}
+
+// listUploadPermissions returns the upload tokens created by the webapp, so
+// that the user can see and revoke them.
+func listUploadPermissions(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	current, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+	if current.Type != permission.TypeWebapp {
+		return permission.ErrOnlyAppCanMintUpload
+	}
+	perms, err := permission.GetUploadSets(inst, current.SourceID)
+	if err != nil {
+		return err
+	}
+	out := make([]jsonapi.Object, len(perms))
+	for i, perm := range perms {
+		out[i] = &APIPermission{perm, nil}
+	}
+	return jsonapi.DataList(c, http.StatusOK, out, nil)
+}
+
+// codeLimitsFromQuery returns the limits of the codes from the valid_from,
+// valid_for and max_uses parameters, or nil if they are not used.
+func codeLimitsFromQuery(c echo.Context) (*permission.CodeLimits, error) {
+	validFrom := c.QueryParam("valid_from")
+	validFor := c.QueryParam("valid_for")
+	maxUses := c.QueryParam("max_uses")
+	if validFrom == "" && validFor == "" && maxUses == "" {
+		return nil, nil
+	}
+
+	limits := &permission.CodeLimits{}
+	start := time.Now()
+	if validFrom != "" {
+		t, err := time.Parse(time.RFC3339, validFrom)
+		if err != nil {
+			return nil, jsonapi.InvalidParameter("valid_from", err)
+		}
+		start = t
+		limits.NotBefore = &t
+	}
+	if validFor != "" {
+		d, err := bigduration.ParseDuration(validFor)
+		if err != nil || d <= 0 {
+			return nil, jsonapi.InvalidParameter("valid_for", errors.New("invalid duration"))
+		}
+		end := start.Add(d)
+		limits.NotAfter = &end
+	}
+	if maxUses != "" {
+		n, err := strconv.Atoi(maxUses)
+		if err != nil || n <= 0 {
+			return nil, jsonapi.InvalidParameter("max_uses", errors.New("invalid number"))
+		}
+		limits.MaxUses = n
+	}
+	return limits, nil
+}
+
+// regenerateCode replaces a code of a share by link permission by a new one.
+// The uses of the code are reset.
+func regenerateCode(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	current, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+
+	toPatch, err := permission.GetByID(inst, c.Param("permdocid"))
+	if err != nil {
+		return err
+	}
+	if !current.CanUpdateShareByLink(toPatch) {
+		return permission.ErrNotParent
+	}
+	name := c.Param("name")
+	if _, ok := toPatch.Codes[name]; !ok {
+		return jsonapi.NotFound(errors.New("no code with this name"))
+	}
+	before := audit.PermissionState(toPatch.Clone().(*permission.Permission))
+
+	code, err := inst.CreateShareCode(name)
+	if err != nil {
+		return err
+	}
+	tiny, _ := strconv.ParseBool(c.QueryParam("tiny"))
+	toPatch.RegenerateCode(name, code, createShortCode(tiny))
+	if err = couchdb.UpdateDoc(inst, toPatch); err != nil {
+		return err
+	}
+	audit.Record(inst, audit.ActionUpdate, consts.Permissions, toPatch.ID(),
+		middlewares.GetAuditActor(c), before, audit.PermissionState(toPatch))
+
+	return jsonapi.Data(c, http.StatusOK, &APIPermission{toPatch, nil}, nil)
+}
+
 func createShortCode(tiny bool) string {
 	if tiny {
 		return crypto.GenerateRandomSixDigits()
@@ -348,6 +575,7 @@ func patchPermission(getPerms getPermsFunc, paramName string) echo.HandlerFunc {
 		if err != nil {
 			return err
 		}
+		before := audit.PermissionState(toPatch.Clone().(*permission.Permission))
 
 		if patchCodes {
 			if !current.CanUpdateShareByLink(toPatch) {
@@ -388,6 +616,8 @@ func patchPermission(getPerms getPermsFunc, paramName string) echo.HandlerFunc {
 		if err = couchdb.UpdateDoc(instance, toPatch); err != nil {
 			return err
 		}
+		audit.Record(instance, audit.ActionUpdate, consts.Permissions, toPatch.ID(),
+			middlewares.GetAuditActor(c), before, audit.PermissionState(toPatch))
 
 		return jsonapi.Data(c, http.StatusOK, &APIPermission{toPatch, nil}, nil)
 	}
@@ -406,7 +636,8 @@ func revokePermission(c echo.Context) error {
 		return err
 	}
 
-	if !current.CanUpdateShareByLink(toRevoke) {
+	if !current.CanUpdateShareByLink(toRevoke) && !current.CanRevokeDelegated(toRevoke) &&
+		!current.CanRevokeUpload(toRevoke) {
 		return permission.ErrNotParent
 	}
 
@@ -414,6 +645,8 @@ func revokePermission(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	audit.Record(instance, audit.ActionRevoke, consts.Permissions, toRevoke.ID(),
+		middlewares.GetAuditActor(c), audit.PermissionState(toRevoke), nil)
 
 	return c.NoContent(http.StatusNoContent)
 }
@@ -422,11 +655,15 @@ func revokePermission(c echo.Context) error {
 func Routes(router *echo.Group) {
 	// API Routes
 	router.POST("", createPermission)
+	router.POST("/delegate", delegatePermission)
+	router.POST("/upload", createUploadPermission)
+	router.GET("/upload", listUploadPermissions)
 	router.GET("/self", displayPermissions)
 	router.POST("/exists", listPermissions)
 	router.GET("/:permdocid", showPermissions)
 	router.PATCH("/:permdocid", patchPermission(permission.GetByID, "permdocid"))
 	router.DELETE("/:permdocid", revokePermission)
+	router.POST("/:permdocid/codes/:name/regenerate", regenerateCode)
 
 	router.PATCH("/apps/:slug", patchPermission(permission.GetForWebapp, "slug"))
 	router.PATCH("/konnectors/:slug", patchPermission(permission.GetForKonnector, "slug"))
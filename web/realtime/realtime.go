@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/oauth"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
@@ -149,7 +152,7 @@ func authorized(i *instance.Instance, perms permission.Set, permType, id string)
 }
 
 func readPump(ctx context.Context, c echo.Context, i *instance.Instance, ws *websocket.Conn,
-	ds *realtime.Subscriber, errc chan *wsError, withAuthentication bool) {
+	ds *realtime.Subscriber, errc chan *wsError, client *wsClient, withAuthentication bool) {
 	defer close(errc)
 
 	var err error
@@ -174,6 +177,9 @@ func readPump(ctx context.Context, c echo.Context, i *instance.Instance, ws *web
 			sendErr(ctx, errc, unauthorized(auth))
 			return
 		}
+		if cli, ok := pdoc.Client.(*oauth.Client); ok && pdoc.Type == permission.TypeOauth {
+			client.set(cli)
+		}
 	}
 
 	for {
@@ -200,8 +206,10 @@ func readPump(ctx context.Context, c echo.Context, i *instance.Instance, ws *web
 		permType := cmd.Payload.Type
 		permID := cmd.Payload.ID
 		// XXX: thumbnails is a synthetic doctype, listening to its events
-		// requires a permissions on io.cozy.files. Same for note events.
-		if permType == consts.Thumbnails || permType == consts.NotesEvents {
+		// requires a permissions on io.cozy.files. Same for note events and
+		// comment events.
+		if permType == consts.Thumbnails || permType == consts.NotesEvents ||
+			permType == consts.CommentsEvents {
 			permType = consts.Files
 		}
 		// XXX: the passphrase settings document is synthetic, and a
@@ -236,6 +244,49 @@ func readPump(ctx context.Context, c echo.Context, i *instance.Instance, ws *web
 	}
 }
 
+// wsClient is the OAuth client authenticated on a websocket, if any. It is
+// set by the goroutine that reads the commands, and read by the one that
+// sends the events.
+type wsClient struct {
+	mu     sync.Mutex
+	client *oauth.Client
+}
+
+func (w *wsClient) set(client *oauth.Client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.client = client
+}
+
+func (w *wsClient) get() *oauth.Client {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.client
+}
+
+// filterBulkFiles removes from a bulk event on files the directories that are
+// not synchronized by the OAuth client, like it is done for the changes feed.
+func filterBulkFiles(inst *instance.Instance, client *oauth.Client, doc realtime.Doc) realtime.Doc {
+	if inst == nil || client == nil {
+		return doc
+	}
+	bulk, ok := realtime.AsBulkDoc(doc)
+	if !ok {
+		return doc
+	}
+	// The bulk document is shared with the other subscribers
+	filtered := &realtime.BulkDoc{
+		Type:    bulk.Type,
+		Changes: append([]realtime.BulkChange{}, bulk.Changes...),
+	}
+	if err := vfs.FilterNotSynchronizedBulk(inst.VFS(), client.ID(), client.SyncScope, filtered); err != nil {
+		inst.Logger().WithNamespace("realtime").
+			Warnf("Cannot filter the bulk event: %s", err)
+		return doc
+	}
+	return filtered
+}
+
 // Ws is the API handler for realtime via a websocket connection.
 func Ws(c echo.Context) error {
 	var db prefixer.Prefixer
@@ -266,10 +317,16 @@ func Ws(c echo.Context) error {
 
 	ds := realtime.GetHub().Subscriber(db)
 	defer ds.Close()
+	// The clients must opt in for the bulk events, as the older ones don't
+	// know how to handle them.
+	if enabled, _ := strconv.ParseBool(c.QueryParam(middlewares.BulkEventsParam)); enabled {
+		ds.EnableBulkEvents()
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	errc := make(chan *wsError)
-	go readPump(ctx, c, inst, ws, ds, errc, withAuthentication)
+	client := &wsClient{}
+	go readPump(ctx, c, inst, ws, ds, errc, client, withAuthentication)
 
 	ticker := time.NewTicker(pingPeriod)
 	defer ticker.Stop()
@@ -290,12 +347,16 @@ func Ws(c echo.Context) error {
 			if err := ws.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
 				return err
 			}
+			doc := e.Doc
+			if e.Verb == realtime.EventBulk && doc.DocType() == consts.Files {
+				doc = filterBulkFiles(inst, client.get(), doc)
+			}
 			res := wsResponse{
 				Event: e.Verb,
 				Payload: wsResponsePayload{
-					Type: e.Doc.DocType(),
-					ID:   e.Doc.ID(),
-					Doc:  e.Doc,
+					Type: doc.DocType(),
+					ID:   doc.ID(),
+					Doc:  doc,
 				},
 			}
 			if err := ws.WriteJSON(res); err != nil {
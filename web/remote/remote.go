@@ -100,6 +100,10 @@ func wrapRemoteErr(err error) error {
 		return jsonapi.BadGateway(err)
 	case remote.ErrRemoteAssetNotFound:
 		return jsonapi.NotFound(err)
+	case remote.ErrRateLimited:
+		return jsonapi.NewError(http.StatusTooManyRequests, err.Error())
+	case remote.ErrMissingCredentials:
+		return jsonapi.BadGateway(err)
 	}
 	return err
 }
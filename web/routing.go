@@ -17,6 +17,7 @@ import (
 	"github.com/cozy/cozy-stack/web/apps"
 	"github.com/cozy/cozy-stack/web/auth"
 	"github.com/cozy/cozy-stack/web/bitwarden"
+	"github.com/cozy/cozy-stack/web/comments"
 	"github.com/cozy/cozy-stack/web/compat"
 	"github.com/cozy/cozy-stack/web/conncheck"
 	"github.com/cozy/cozy-stack/web/contacts"
@@ -26,6 +27,7 @@ import (
 	"github.com/cozy/cozy-stack/web/instances"
 	"github.com/cozy/cozy-stack/web/intents"
 	"github.com/cozy/cozy-stack/web/jobs"
+	"github.com/cozy/cozy-stack/web/mails"
 	"github.com/cozy/cozy-stack/web/middlewares"
 	"github.com/cozy/cozy-stack/web/move"
 	"github.com/cozy/cozy-stack/web/notes"
@@ -79,6 +81,7 @@ func SetupAppsHandler(appsHandler echo.HandlerFunc) echo.HandlerFunc {
 		middlewares.Accept(middlewares.AcceptOptions{
 			DefaultContentTypeOffer: echo.MIMETextHTML,
 		}),
+		middlewares.CheckInstanceMaintenance,
 		middlewares.CheckInstanceBlocked,
 		middlewares.CheckInstanceDeleting,
 		middlewares.CheckTOSDeadlineExpired,
@@ -196,6 +199,7 @@ func SetupRoutes(router *echo.Echo, services *stack.Services) error {
 				DefaultContentTypeOffer: echo.MIMETextHTML,
 			}),
 			middlewares.CheckUserAgent,
+			middlewares.CheckInstanceMaintenance,
 			middlewares.CheckInstanceBlocked,
 			middlewares.CheckInstanceDeleting,
 		}
@@ -214,6 +218,7 @@ func SetupRoutes(router *echo.Echo, services *stack.Services) error {
 			middlewares.Accept(middlewares.AcceptOptions{
 				DefaultContentTypeOffer: jsonapi.ContentType,
 			}),
+			middlewares.CheckInstanceMaintenance,
 		}
 		mws := append(mwsNotBlocked,
 			middlewares.CheckInstanceBlocked,
@@ -222,6 +227,7 @@ func SetupRoutes(router *echo.Echo, services *stack.Services) error {
 		registry.Routes(router.Group("/registry", mws...))
 		data.Routes(router.Group("/data", mws...))
 		files.Routes(router.Group("/files", mws...))
+		comments.Routes(router.Group("/comments", mws...))
 		contacts.Routes(router.Group("/contacts", mws...))
 		intents.Routes(router.Group("/intents", mws...))
 		jobs.Routes(router.Group("/jobs", mws...))
@@ -257,6 +263,7 @@ func SetupRoutes(router *echo.Echo, services *stack.Services) error {
 		conncheck.Routes(router.Group("/connection_check"))
 		status.Routes(router.Group("/status"))
 		version.Routes(router.Group("/version"))
+		errors.Routes(router.Group("/errors"))
 	}
 
 	// dev routes
@@ -295,8 +302,13 @@ func SetupAdminRoutes(router *echo.Echo) error {
 	}
 
 	instances.Routes(router.Group("/instances", mws...))
+	jobs.AdminRoutes(router.Group("/jobs", mws...))
 	apps.AdminRoutes(router.Group("/konnectors", mws...))
+	apps.CSPAdminRoutes(router.Group("/csp", mws...))
+	files.UploadPolicyAdminRoutes(router.Group("/upload_policies", mws...))
+	files.QuarantineAdminRoutes(router.Group("/files", mws...))
 	version.Routes(router.Group("/version", mws...))
+	mails.AdminRoutes(router.Group("/mails", mws...))
 	metrics.Routes(router.Group("/metrics", mws...))
 	oauth.Routes(router.Group("/oauth", mws...))
 	oidc.AdminRoutes(router.Group("/oidc", mws...))
@@ -0,0 +1,186 @@
+package settings
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/accesslog"
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultAccessLogsLimit = 50
+	maxAccessLogsLimit     = 1000
+)
+
+type apiAccessLogsSettings struct {
+	Doctypes []string `json:"doctypes"`
+}
+
+func (s *apiAccessLogsSettings) ID() string                             { return consts.AccessLogsSettingsID }
+func (s *apiAccessLogsSettings) Rev() string                            { return "" }
+func (s *apiAccessLogsSettings) DocType() string                        { return consts.Settings }
+func (s *apiAccessLogsSettings) Clone() couchdb.Doc                     { return s }
+func (s *apiAccessLogsSettings) SetID(_ string)                         {}
+func (s *apiAccessLogsSettings) SetRev(_ string)                        {}
+func (s *apiAccessLogsSettings) Relationships() jsonapi.RelationshipMap { return nil }
+func (s *apiAccessLogsSettings) Included() []jsonapi.Object             { return nil }
+func (s *apiAccessLogsSettings) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/settings/access-logs"}
+}
+
+// Settings objects permissions are only on ID
+func (s *apiAccessLogsSettings) Fetch(field string) []string { return nil }
+
+type apiAccessLog struct {
+	*accesslog.Entry
+}
+
+func (e *apiAccessLog) Relationships() jsonapi.RelationshipMap { return nil }
+func (e *apiAccessLog) Included() []jsonapi.Object             { return nil }
+func (e *apiAccessLog) Links() *jsonapi.LinksList              { return nil }
+
+func accessLogsState(doctypes []string) interface{} {
+	return map[string]interface{}{"doctypes": doctypes}
+}
+
+func (h *HTTPHandler) getAccessLogsSettings(c echo.Context) error {
+	result := &apiAccessLogsSettings{}
+	if err := middlewares.Allow(c, permission.GET, result); err != nil {
+		return err
+	}
+	result.Doctypes = middlewares.GetInstance(c).AccessLogs
+	if result.Doctypes == nil {
+		result.Doctypes = []string{}
+	}
+	return jsonapi.Data(c, http.StatusOK, result, nil)
+}
+
+func (h *HTTPHandler) updateAccessLogsSettings(c echo.Context) error {
+	result := &apiAccessLogsSettings{}
+	if _, err := jsonapi.Bind(c.Request().Body, result); err != nil {
+		return err
+	}
+	if err := middlewares.Allow(c, permission.PUT, result); err != nil {
+		return err
+	}
+	// An operator of the support cannot disable the access logs
+	if sess, ok := middlewares.GetSession(c); ok && sess.SupportAccess() != nil {
+		return jsonapi.Forbidden(errors.New("The support cannot change the access logs"))
+	}
+	for _, doctype := range result.Doctypes {
+		if err := permission.CheckReadable(doctype); err != nil {
+			return jsonapi.InvalidParameter("doctypes", err)
+		}
+	}
+
+	inst := middlewares.GetInstance(c)
+	before := accessLogsState(inst.AccessLogs)
+	if len(result.Doctypes) == 0 {
+		inst.AccessLogs = nil
+	} else {
+		inst.AccessLogs = result.Doctypes
+	}
+	if err := instance.Update(inst); err != nil {
+		return err
+	}
+	audit.Record(inst, audit.ActionUpdate, consts.Settings, consts.AccessLogsSettingsID,
+		middlewares.GetAuditActor(c), before, accessLogsState(inst.AccessLogs))
+	if result.Doctypes == nil {
+		result.Doctypes = []string{}
+	}
+	return jsonapi.Data(c, http.StatusOK, result, nil)
+}
+
+// listAccessLogs handles the GET /settings/access-logs/:doctype requests. It
+// returns the reads made on this doctype, from the most recent to the oldest.
+func (h *HTTPHandler) listAccessLogs(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.AccessLogs); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	doctype := c.Param("doctype")
+	since, err := accessLogsSince(c)
+	if err != nil {
+		return err
+	}
+	limit := defaultAccessLogsLimit
+	if param := c.QueryParam("page[limit]"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 {
+			return jsonapi.InvalidParameter("page[limit]", errors.New("invalid limit"))
+		}
+		if limit > maxAccessLogsLimit {
+			limit = maxAccessLogsLimit
+		}
+	}
+
+	entries, bookmark, err := accesslog.List(inst, doctype, since, c.QueryParam("page[cursor]"), limit)
+	if err != nil {
+		return err
+	}
+	var links jsonapi.LinksList
+	if bookmark != "" {
+		links.Next = "/settings/access-logs/" + url.PathEscape(doctype) +
+			"?since=" + url.QueryEscape(since.Format(time.RFC3339)) +
+			"&page[cursor]=" + url.QueryEscape(bookmark) +
+			"&page[limit]=" + strconv.Itoa(limit)
+	}
+	objs := make([]jsonapi.Object, len(entries))
+	for i, entry := range entries {
+		objs[i] = &apiAccessLog{entry}
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, &links)
+}
+
+// accessLogsSummary handles the GET /settings/access-logs/:doctype/summary
+// requests. It returns the apps and clients that have read documents of this
+// doctype, with the number of reads.
+func (h *HTTPHandler) accessLogsSummary(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.AccessLogs); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	doctype := c.Param("doctype")
+	since, err := accessLogsSince(c)
+	if err != nil {
+		return err
+	}
+	apps, err := accesslog.Summary(inst, doctype, since)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"doctype": doctype,
+		"since":   since,
+		"apps":    apps,
+	})
+}
+
+// accessLogsSince returns the date from the since parameter. By default, it
+// is the beginning of the current month.
+func accessLogsSince(c echo.Context) (time.Time, error) {
+	param := c.QueryParam("since")
+	if param == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	if since, err := time.Parse(time.RFC3339, param); err == nil {
+		return since, nil
+	}
+	since, err := time.Parse("2006-01-02", param)
+	if err != nil {
+		return since, jsonapi.InvalidParameter("since", errors.New("invalid date"))
+	}
+	return since, nil
+}
@@ -0,0 +1,71 @@
+package settings
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/anonymous"
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+type apiAnonymousID struct {
+	AnonymousID string    `json:"anonymous_id"`
+	RotatedAt   time.Time `json:"rotated_at"`
+}
+
+func (a *apiAnonymousID) ID() string                             { return consts.AnonymousIDSettingsID }
+func (a *apiAnonymousID) Rev() string                            { return "" }
+func (a *apiAnonymousID) DocType() string                        { return consts.Settings }
+func (a *apiAnonymousID) Clone() couchdb.Doc                     { cloned := *a; return &cloned }
+func (a *apiAnonymousID) SetID(_ string)                         {}
+func (a *apiAnonymousID) SetRev(_ string)                        {}
+func (a *apiAnonymousID) Relationships() jsonapi.RelationshipMap { return nil }
+func (a *apiAnonymousID) Included() []jsonapi.Object             { return nil }
+func (a *apiAnonymousID) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/settings/anonymous-id"}
+}
+
+// Settings objects permissions are only on ID
+func (a *apiAnonymousID) Fetch(field string) []string { return nil }
+
+// getAnonymousID handles the GET /settings/anonymous-id requests. It returns
+// a stable identifier for the instance that doesn't reveal its domain.
+func (h *HTTPHandler) getAnonymousID(c echo.Context) error {
+	result := &apiAnonymousID{}
+	if err := middlewares.Allow(c, permission.GET, result); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	doc, err := anonymous.Get(inst)
+	if err != nil {
+		return jsonapi.InternalServerError(err)
+	}
+	result.AnonymousID = doc.Value(inst.ContextName)
+	result.RotatedAt = doc.RotatedAt
+	return jsonapi.Data(c, http.StatusOK, result, nil)
+}
+
+// rotateAnonymousID handles the POST /settings/anonymous-id/rotate requests.
+// The new identifier can't be linked to the previous one.
+func (h *HTTPHandler) rotateAnonymousID(c echo.Context) error {
+	result := &apiAnonymousID{}
+	if err := middlewares.Allow(c, permission.PUT, result); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+	doc, err := anonymous.Rotate(inst)
+	if err != nil {
+		return jsonapi.InternalServerError(err)
+	}
+	audit.Record(inst, audit.ActionUpdate, consts.Settings, consts.AnonymousIDSettingsID,
+		middlewares.GetAuditActor(c), nil, map[string]interface{}{"rotated_at": doc.RotatedAt})
+	result.AnonymousID = doc.Value(inst.ContextName)
+	result.RotatedAt = doc.RotatedAt
+	return jsonapi.Data(c, http.StatusOK, result, nil)
+}
@@ -9,10 +9,12 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/cozy/cozy-stack/model/audit"
 	"github.com/cozy/cozy-stack/model/feature"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/oauth"
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
@@ -99,6 +101,50 @@ func (h *HTTPHandler) revokeClient(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// updateSyncScope handles the PUT /settings/clients/:id/sync_scope requests.
+// It restricts an OAuth client to some top-level directories, or removes the
+// restriction if the list of directories is empty.
+func (h *HTTPHandler) updateSyncScope(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+
+	if err := middlewares.AllowWholeType(c, permission.PUT, consts.OAuthClients); err != nil {
+		return err
+	}
+
+	clientID := c.Param("id")
+	if current, ok := middlewares.GetOAuthClient(c); ok && current.ID() == clientID {
+		return jsonapi.Forbidden(errors.New("a client cannot change its own sync scope"))
+	}
+
+	var body struct {
+		DirIDs []string `json:"dir_ids"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if err := vfs.CheckSyncScope(inst.VFS(), body.DirIDs); err != nil {
+		return jsonapi.InvalidParameter("dir_ids", err)
+	}
+
+	defer auth.LockOAuthClient(inst, clientID)()
+
+	client, err := oauth.FindClient(inst, clientID)
+	if err != nil {
+		return err
+	}
+	before := client.SyncScope
+	client.SyncScope = body.DirIDs
+	if len(client.SyncScope) == 0 {
+		client.SyncScope = nil
+	}
+	if err := couchdb.UpdateDoc(inst, client); err != nil {
+		return err
+	}
+	audit.Record(inst, audit.ActionUpdate, consts.OAuthClients, client.ID(),
+		middlewares.GetAuditActor(c), before, client.SyncScope)
+	return jsonapi.Data(c, http.StatusOK, &apiOauthClient{client}, nil)
+}
+
 func (h *HTTPHandler) synchronized(c echo.Context) error {
 	instance := middlewares.GetInstance(c)
 
@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/usage"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
@@ -19,6 +21,11 @@ type apiDiskUsage struct {
 	Files    int64  `json:"files,string"`
 	Trash    *int64 `json:"trash,string,omitempty"`
 	Versions int64  `json:"versions,string"`
+	Cold     int64  `json:"cold,string,omitempty"`
+	// Documents is the number of documents for the doctypes with a quota
+	Documents []*usage.DocumentsUsage `json:"documents,omitempty"`
+	// Sharings is the number of active sharings, when they have a quota
+	Sharings *sharing.SharingsUsage `json:"sharings,omitempty"`
 }
 
 func (j *apiDiskUsage) ID() string                             { return consts.DiskUsageID }
@@ -79,6 +86,16 @@ func (h *HTTPHandler) diskUsage(c echo.Context) error {
 
 	used := files + versions
 	quota := fs.DiskQuota()
+	if cold, err := fs.ColdUsage(); err == nil {
+		result.Cold = cold
+	}
+
+	if docs, err := usage.ListDocumentsUsage(instance); err == nil && len(docs) > 0 {
+		result.Documents = docs
+	}
+	if sharings, err := sharing.GetSharingsUsage(instance); err == nil && sharings.Quota > 0 {
+		result.Sharings = sharings
+	}
 
 	result.Used = used
 	result.Quota = quota
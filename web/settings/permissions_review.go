@@ -0,0 +1,226 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/oauth"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/auth"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRevocations is the maximal number of items in a batch of revocations.
+const maxRevocations = 100
+
+// permissionsHolder is an app, a konnector, or an OAuth client, with the
+// doctypes it can access.
+type permissionsHolder struct {
+	SourceID   string            `json:"source_id"`
+	Type       string            `json:"type"`
+	Slug       string            `json:"slug,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Doctypes   map[string]string `json:"doctypes"`
+	LastUsedAt *time.Time        `json:"last_used_at,omitempty"`
+}
+
+type permissionsRevocation struct {
+	SourceID string   `json:"source_id"`
+	Doctypes []string `json:"doctypes,omitempty"`
+}
+
+type permissionsRevocationResult struct {
+	SourceID string `json:"source_id"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// listPermissionsHolders handles the GET /settings/permissions requests. It
+// returns the apps, konnectors and OAuth clients with the doctypes they can
+// access, and the date of the last use of their permissions.
+func (h *HTTPHandler) listPermissionsHolders(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Permissions); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+
+	usages, err := permission.GetUsages(inst)
+	if err != nil {
+		return err
+	}
+
+	holders := []*permissionsHolder{}
+	err = couchdb.ForeachDocs(inst, consts.Permissions, func(_ string, raw json.RawMessage) error {
+		var doc permission.Permission
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		if doc.Type != permission.TypeWebapp && doc.Type != permission.TypeKonnector {
+			return nil
+		}
+		parts := strings.SplitN(doc.SourceID, "/", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		holders = append(holders, &permissionsHolder{
+			SourceID: doc.SourceID,
+			Type:     doc.Type,
+			Slug:     parts[1],
+			Name:     parts[1],
+			Doctypes: doc.Permissions.VerbsByDoctype(),
+		})
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+
+	err = couchdb.ForeachDocs(inst, consts.OAuthClients, func(_ string, raw json.RawMessage) error {
+		var client oauth.Client
+		if err := json.Unmarshal(raw, &client); err != nil {
+			return err
+		}
+		if client.ClientKind == "sharing" {
+			return nil
+		}
+		holder := &permissionsHolder{
+			SourceID: client.ID(),
+			Type:     permission.TypeOauth,
+			Slug:     client.SoftwareID,
+			Name:     client.ClientName,
+			Doctypes: map[string]string{},
+		}
+		// The scope of an OAuth client is only known from its tokens
+		if usage, ok := usages[client.ID()]; ok {
+			holder.Doctypes = usage.Permissions.VerbsByDoctype()
+		}
+		holders = append(holders, holder)
+		return nil
+	})
+	if err != nil && !couchdb.IsNoDatabaseError(err) {
+		return err
+	}
+
+	for _, holder := range holders {
+		if usage, ok := usages[holder.SourceID]; ok {
+			lastUsedAt := usage.LastUsedAt
+			holder.LastUsedAt = &lastUsedAt
+		}
+	}
+	sort.SliceStable(holders, func(i, j int) bool {
+		if holders[i].Type != holders[j].Type {
+			return holders[i].Type < holders[j].Type
+		}
+		return holders[i].Name < holders[j].Name
+	})
+	return c.JSON(http.StatusOK, echo.Map{"holders": holders})
+}
+
+// revokePermissions handles the POST /settings/permissions/revoke requests. It
+// removes the permissions on some doctypes for the apps and konnectors, and
+// revokes the OAuth clients. The result of each revocation is given in the
+// response, as the other revocations are still made if one of them fails.
+func (h *HTTPHandler) revokePermissions(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.Permissions); err != nil {
+		return err
+	}
+	inst := middlewares.GetInstance(c)
+
+	var body struct {
+		Revocations []permissionsRevocation `json:"revocations"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if len(body.Revocations) == 0 {
+		return jsonapi.InvalidParameter("revocations", errors.New("no revocations"))
+	}
+	if len(body.Revocations) > maxRevocations {
+		return jsonapi.InvalidParameter("revocations", errors.New("too many revocations"))
+	}
+
+	actor := middlewares.GetAuditActor(c)
+	results := make([]permissionsRevocationResult, len(body.Revocations))
+	for i, revocation := range body.Revocations {
+		results[i].SourceID = revocation.SourceID
+		var err error
+		if strings.HasPrefix(revocation.SourceID, consts.Apps+"/") ||
+			strings.HasPrefix(revocation.SourceID, consts.Konnectors+"/") {
+			err = revokeAppDoctypes(inst, actor, revocation)
+		} else {
+			err = middlewares.AllowWholeType(c, permission.DELETE, consts.OAuthClients)
+			if err == nil {
+				err = revokeOAuthClient(inst, actor, revocation)
+			}
+		}
+		if err != nil {
+			results[i].Status = "error"
+			results[i].Error = err.Error()
+		} else {
+			results[i].Status = "revoked"
+		}
+	}
+	return c.JSON(http.StatusOK, echo.Map{"results": results})
+}
+
+func revokeAppDoctypes(inst *instance.Instance, actor audit.Actor, revocation permissionsRevocation) error {
+	if len(revocation.Doctypes) == 0 {
+		return errors.New("the doctypes are mandatory for an app or a konnector")
+	}
+	var pdoc *permission.Permission
+	var err error
+	slug := revocation.SourceID[strings.Index(revocation.SourceID, "/")+1:]
+	if strings.HasPrefix(revocation.SourceID, consts.Apps+"/") {
+		pdoc, err = permission.GetForWebapp(inst, slug)
+	} else {
+		pdoc, err = permission.GetForKonnector(inst, slug)
+	}
+	if err != nil {
+		return err
+	}
+	before := pdoc.Permissions.VerbsByDoctype()
+	if !pdoc.RemoveDoctypes(revocation.Doctypes...) {
+		return nil
+	}
+	if err := couchdb.UpdateDoc(inst, pdoc); err != nil {
+		return err
+	}
+	audit.Record(inst, audit.ActionRevoke, consts.Permissions, pdoc.ID(), actor,
+		before, pdoc.Permissions.VerbsByDoctype())
+	return nil
+}
+
+func revokeOAuthClient(inst *instance.Instance, actor audit.Actor, revocation permissionsRevocation) error {
+	if len(revocation.Doctypes) > 0 {
+		return errors.New("the permissions of an OAuth client can only be revoked as a whole")
+	}
+	defer auth.LockOAuthClient(inst, revocation.SourceID)()
+
+	client, err := oauth.FindClient(inst, revocation.SourceID)
+	if err != nil {
+		return err
+	}
+	if client.ClientKind == "sharing" {
+		return errors.New("the OAuth clients of the sharings cannot be revoked here")
+	}
+	if err := client.Delete(inst); err != nil {
+		return errors.New(err.Error)
+	}
+	if err := permission.DeleteUsage(inst, client.ID()); err != nil {
+		inst.Logger().WithNamespace("settings").
+			Warnf("Cannot delete the usage of the permissions for %s: %s", client.ID(), err)
+	}
+	audit.Record(inst, audit.ActionRevoke, consts.OAuthClients, client.ID(), actor,
+		map[string]interface{}{"client_name": client.ClientName, "software_id": client.SoftwareID}, nil)
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/session"
 	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/cozy-stack/model/token"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -168,9 +169,16 @@ func (h *HTTPHandler) getEmailConfirmation(c echo.Context) error {
 
 	settingsURL := inst.SubDomain("settings").String()
 
+	oldEmail, _ := inst.SettingsEMail()
 	err := h.svc.ConfirmEmailUpdate(inst, tok)
 	switch {
 	case err == nil:
+		// The sharecodes keyed by the old email must be re-issued, and the
+		// members of the sharings informed of the new email
+		if err := sharing.PushIdentityJob(inst, oldEmail); err != nil {
+			inst.Logger().WithNamespace("settings").
+				Errorf("Cannot push a job for the identity change: %s", err)
+		}
 		// Redirect to the setting page
 		return c.Redirect(http.StatusTemporaryRedirect, settingsURL)
 	case errors.Is(err, csettings.ErrNoPendingEmail), errors.Is(err, token.ErrInvalidToken):
@@ -225,10 +233,26 @@ func (h *HTTPHandler) Register(router *echo.Group) {
 
 	router.GET("/flags", h.getFlags)
 
+	router.GET("/anonymous-id", h.getAnonymousID)
+	router.POST("/anonymous-id/rotate", h.rotateAnonymousID)
+
 	router.GET("/sessions", h.getSessions)
 
+	router.GET("/support-access", h.getSupportAccess)
+	router.POST("/support-access", h.grantSupportAccess)
+	router.DELETE("/support-access", h.revokeSupportAccess)
+
+	router.GET("/access-logs", h.getAccessLogsSettings)
+	router.PUT("/access-logs", h.updateAccessLogsSettings)
+	router.GET("/access-logs/:doctype", h.listAccessLogs)
+	router.GET("/access-logs/:doctype/summary", h.accessLogsSummary)
+
+	router.GET("/permissions", h.listPermissionsHolders)
+	router.POST("/permissions/revoke", h.revokePermissions)
+
 	router.GET("/clients", h.listClients)
 	router.DELETE("/clients/:id", h.revokeClient)
+	router.PUT("/clients/:id/sync_scope", h.updateSyncScope)
 	router.GET("/clients/limit-exceeded", h.limitExceeded)
 	router.POST("/synchronized", h.synchronized)
 
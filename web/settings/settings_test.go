@@ -15,6 +15,7 @@ import (
 	"github.com/cozy/cozy-stack/model/oauth"
 	"github.com/cozy/cozy-stack/model/session"
 	csettings "github.com/cozy/cozy-stack/model/settings"
+	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
@@ -633,6 +634,40 @@ func TestSettings(t *testing.T) {
 		redirectURIs.First().String().Equal(client.RedirectURIs[0])
 	})
 
+	t.Run("UpdateSyncScope", func(t *testing.T) {
+		e := testutils.CreateTestClient(t, tsURL)
+
+		fs := testInstance.VFS()
+		dir, err := vfs.Mkdir(fs, "/SyncScope", nil)
+		require.NoError(t, err)
+		subdir, err := vfs.Mkdir(fs, "/SyncScope/Sub", nil)
+		require.NoError(t, err)
+
+		e.PUT("/settings/clients/"+oauthClientID+"/sync_scope").
+			WithHeader("Authorization", "Bearer "+token).
+			WithBytes([]byte(`{"dir_ids": ["` + subdir.ID() + `"]}`)).
+			Expect().Status(422)
+
+		obj := e.PUT("/settings/clients/"+oauthClientID+"/sync_scope").
+			WithHeader("Authorization", "Bearer "+token).
+			WithBytes([]byte(`{"dir_ids": ["` + dir.ID() + `"]}`)).
+			Expect().Status(200).
+			JSON(httpexpect.ContentOpts{MediaType: "application/vnd.api+json"}).
+			Object()
+
+		attrs := obj.Path("$.data.attributes").Object()
+		attrs.Value("sync_scope").Array().Equal([]string{dir.ID()})
+
+		obj = e.PUT("/settings/clients/"+oauthClientID+"/sync_scope").
+			WithHeader("Authorization", "Bearer "+token).
+			WithBytes([]byte(`{"dir_ids": []}`)).
+			Expect().Status(200).
+			JSON(httpexpect.ContentOpts{MediaType: "application/vnd.api+json"}).
+			Object()
+
+		obj.Path("$.data.attributes").Object().NotContainsKey("sync_scope")
+	})
+
 	t.Run("RevokeClient", func(t *testing.T) {
 		e := testutils.CreateTestClient(t, tsURL)
 
@@ -0,0 +1,105 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/session"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/justincampbell/bigduration"
+	"github.com/labstack/echo/v4"
+)
+
+type apiSupportAccess struct {
+	a *session.SupportAccess
+}
+
+func (a *apiSupportAccess) ID() string                             { return a.a.ID() }
+func (a *apiSupportAccess) Rev() string                            { return a.a.Rev() }
+func (a *apiSupportAccess) DocType() string                        { return consts.SupportAccesses }
+func (a *apiSupportAccess) Clone() couchdb.Doc                     { return a }
+func (a *apiSupportAccess) SetID(_ string)                         {}
+func (a *apiSupportAccess) SetRev(_ string)                        {}
+func (a *apiSupportAccess) Relationships() jsonapi.RelationshipMap { return nil }
+func (a *apiSupportAccess) Included() []jsonapi.Object             { return nil }
+func (a *apiSupportAccess) MarshalJSON() ([]byte, error)           { return json.Marshal(a.a) }
+func (a *apiSupportAccess) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/settings/support-access"}
+}
+
+func supportAccessState(a *session.SupportAccess) interface{} {
+	return map[string]interface{}{
+		"read_write": a.ReadWrite,
+		"expires_at": a.ExpiresAt,
+	}
+}
+
+func (h *HTTPHandler) getSupportAccess(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.SupportAccesses); err != nil {
+		return err
+	}
+
+	access, err := session.GetSupportAccess(middlewares.GetInstance(c))
+	if err != nil {
+		return wrapSupportAccessError(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, &apiSupportAccess{access}, nil)
+}
+
+func (h *HTTPHandler) grantSupportAccess(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.POST, consts.SupportAccesses); err != nil {
+		return err
+	}
+	// An operator of the support cannot extend their own access
+	if sess, ok := middlewares.GetSession(c); ok && sess.SupportAccess() != nil {
+		return jsonapi.Forbidden(errors.New("The support cannot grant an access"))
+	}
+
+	ttl := consts.SupportAccessValidityDuration
+	if param := c.QueryParam("ttl"); param != "" {
+		d, err := bigduration.ParseDuration(param)
+		if err != nil || d <= 0 {
+			return jsonapi.InvalidParameter("ttl", errors.New("invalid duration"))
+		}
+		ttl = d
+	}
+	readWrite := c.QueryParam("read_write") == "true"
+
+	inst := middlewares.GetInstance(c)
+	access, err := session.GrantSupportAccess(inst, ttl, readWrite)
+	if err != nil {
+		return wrapSupportAccessError(err)
+	}
+	audit.Record(inst, audit.ActionCreate, consts.SupportAccesses, access.ID(),
+		middlewares.GetAuditActor(c), nil, supportAccessState(access))
+	return jsonapi.Data(c, http.StatusCreated, &apiSupportAccess{access}, nil)
+}
+
+func (h *HTTPHandler) revokeSupportAccess(c echo.Context) error {
+	if err := middlewares.AllowWholeType(c, permission.DELETE, consts.SupportAccesses); err != nil {
+		return err
+	}
+
+	inst := middlewares.GetInstance(c)
+	actor := middlewares.GetAuditActor(c)
+	access, err := session.RevokeSupportAccess(inst)
+	if err != nil {
+		return wrapSupportAccessError(err)
+	}
+	audit.Record(inst, audit.ActionRevoke, consts.SupportAccesses, access.ID(),
+		actor, supportAccessState(access), nil)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func wrapSupportAccessError(err error) error {
+	if errors.Is(err, session.ErrNoSupportAccess) {
+		return jsonapi.NotFound(err)
+	}
+	return err
+}
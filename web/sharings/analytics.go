@@ -0,0 +1,62 @@
+package sharings
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/shareanalytics"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// GetAnalytics returns the anonymized statistics of the accesses to a sharing
+// preview or to a share by link. The identifier can be the one of a sharing,
+// or the one of the permission document of a share by link. Only the owner
+// can see them.
+func GetAnalytics(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	requestPerm, err := middlewares.GetPermission(c)
+	if err != nil {
+		return err
+	}
+	if requestPerm.Type != permission.TypeWebapp &&
+		requestPerm.Type != permission.TypeOauth &&
+		requestPerm.Type != permission.TypeCLI {
+		return middlewares.ErrForbidden
+	}
+
+	shareID := c.Param("sharing-id")
+	s, err := sharing.FindSharing(inst, shareID)
+	switch {
+	case err == nil:
+		if !s.Owner {
+			return middlewares.ErrForbidden
+		}
+		if err := CheckGetPermissions(c, s); err != nil {
+			return wrapErrors(err)
+		}
+	case couchdb.IsNotFoundError(err) || couchdb.IsNoDatabaseError(err):
+		pdoc, err := permission.GetByID(inst, shareID)
+		if err != nil {
+			return err
+		}
+		if pdoc.Type != permission.TypeShareByLink {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		if pdoc.SourceID != requestPerm.SourceID {
+			if err := middlewares.AllowMaximal(c); err != nil {
+				return middlewares.ErrForbidden
+			}
+		}
+	default:
+		return wrapErrors(err)
+	}
+
+	analytics, err := shareanalytics.Get(inst, shareID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, analytics)
+}
@@ -0,0 +1,141 @@
+package sharings
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/model/webhook"
+	"github.com/cozy/cozy-stack/pkg/errcode"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Codes of the errors returned by the sharing routes.
+var (
+	codeNoMailAddress           = errcode.Register("sharing.no_mail_address", http.StatusUnprocessableEntity, "A recipient has no email address")
+	codeNoRecipients            = errcode.Register("sharing.no_recipients", http.StatusBadRequest, "The sharing has no recipient")
+	codeNoRules                 = errcode.Register("sharing.no_rules", http.StatusBadRequest, "The sharing has no rule")
+	codeTooManyMembers          = errcode.Register("sharing.too_many_members", http.StatusBadRequest, "The sharing has too many members")
+	codeTooManySharings         = errcode.Register("sharing.too_many_sharings", http.StatusForbidden, "The maximal number of sharings has been reached")
+	codeInvalidURL              = errcode.Register("sharing.invalid_url", http.StatusUnprocessableEntity, "The URL of the Cozy instance is invalid")
+	codeCozyURLRejected         = errcode.Register("sharing.cozy_url_rejected", http.StatusBadRequest, "The Cozy instance can't be used to accept the sharing")
+	codeInvalidSharing          = errcode.Register("sharing.invalid_sharing", http.StatusBadRequest, "The sharing is invalid or not active")
+	codeInvalidRule             = errcode.Register("sharing.invalid_rule", http.StatusBadRequest, "A rule of the sharing is invalid")
+	codeMemberNotFound          = errcode.Register("sharing.member_not_found", http.StatusNotFound, "The member is not in the sharing")
+	codeInvitationNotSent       = errcode.Register("sharing.invitation_not_sent", http.StatusBadRequest, "The invitation has not been sent")
+	codeRequestFailed           = errcode.Register("sharing.request_failed", http.StatusBadGateway, "The request to the Cozy of another member has failed")
+	codeNoOAuthClient           = errcode.Register("sharing.no_oauth_client", http.StatusBadRequest, "No OAuth client has been exchanged with the member")
+	codeMissingID               = errcode.Register("sharing.missing_id", http.StatusBadRequest, "A document has no identifier")
+	codeMissingRev              = errcode.Register("sharing.missing_rev", http.StatusBadRequest, "A document has no revision")
+	codeInternal                = errcode.Register("sharing.internal_error", http.StatusInternalServerError, "An internal error has happened")
+	codeMissingFileMetadata     = errcode.Register("sharing.missing_file_metadata", http.StatusNotFound, "The metadata of the file are missing")
+	codeFolderNotFound          = errcode.Register("sharing.folder_not_found", http.StatusNotFound, "The shared folder has not been found")
+	codeFileNotFound            = errcode.Register("sharing.file_not_found", http.StatusNotFound, "The shared file has not been found")
+	codeSafety                  = errcode.Register("sharing.safety", http.StatusBadRequest, "The operation has been refused for the safety of the sharing")
+	codeAlreadyAccepted         = errcode.Register("sharing.already_accepted", http.StatusConflict, "The sharing has already been accepted")
+	codeMemberNotVerified       = errcode.Register("sharing.member_not_verified", http.StatusForbidden, "The identity of the member must be verified with a code")
+	codeInvalidSignature        = errcode.Register("sharing.invalid_signature", http.StatusForbidden, "The signature of the request is invalid")
+	codeInvalidVerificationCode = errcode.Register("sharing.invalid_verification_code", http.StatusUnprocessableEntity, "The verification code is invalid")
+	codeVerificationLocked      = errcode.Register("sharing.verification_locked", http.StatusTooManyRequests, "Too many verification codes have been sent")
+	codeInvalidMD5Sum           = errcode.Register("sharing.invalid_md5sum", http.StatusUnprocessableEntity, "The checksum of the content is invalid")
+	codeContentLengthMismatch   = errcode.Register("sharing.content_length_mismatch", http.StatusPreconditionFailed, "The size of the content doesn't match its Content-Length")
+	codeFileConflict            = errcode.Register("sharing.file_conflict", http.StatusConflict, "The file has been modified in the meantime")
+	codeFileQuarantined         = errcode.Register("sharing.file_quarantined", http.StatusForbidden, "The file has been quarantined")
+	codeFileTooBig              = errcode.Register("sharing.file_too_big", http.StatusRequestEntityTooLarge, "The file is too big for the disk quota")
+	codeExpiredToken            = errcode.Register("sharing.expired_token", http.StatusBadRequest, "The token has expired")
+	codeInvalidIndex            = errcode.Register("sharing.invalid_index", http.StatusUnprocessableEntity, "The index of the member is invalid")
+	codeMissingEmail            = errcode.Register("sharing.missing_email", http.StatusBadRequest, "The email address is missing")
+	codeInvalidSourceID         = errcode.Register("sharing.invalid_source_id", http.StatusBadRequest, "The source_id of the token is invalid")
+	codeIDMismatch              = errcode.Register("sharing.id_mismatch", http.StatusUnprocessableEntity, "The identifiers in the URL and in the document are not the same")
+	codeInvalidLimit            = errcode.Register("sharing.invalid_limit", http.StatusBadRequest, "The limit is not a positive integer")
+	codeMissingDoctype          = errcode.Register("sharing.missing_doctype", http.StatusBadRequest, "The doctype is missing")
+	codeInvalidWebhookURL       = errcode.Register("sharing.invalid_webhook_url", http.StatusUnprocessableEntity, "The URL of the webhook is invalid")
+	codeInvalidWebhookEvent     = errcode.Register("sharing.invalid_webhook_event", http.StatusUnprocessableEntity, "An event of the webhook is unknown")
+	codeInvalidExpiration       = errcode.Register("sharing.invalid_expiration", http.StatusUnprocessableEntity, "The expiration date is invalid")
+	codeUploadBlocked           = errcode.Register("sharing.upload_blocked", http.StatusUnprocessableEntity, "The file is blocked by the upload policy")
+)
+
+// wrapErrors returns a formatted error
+func wrapErrors(err error) error {
+	if merr, ok := err.(*multierror.Error); ok {
+		err = merr.WrappedErrors()[0]
+	}
+	var policyErr *vfs.UploadPolicyError
+	if errors.As(err, &policyErr) {
+		return codeUploadBlocked.New(err)
+	}
+	switch err {
+	case contact.ErrNoMailAddress:
+		return codeNoMailAddress.Attribute("recipients", err)
+	case sharing.ErrNoRecipients:
+		return codeNoRecipients.New(err)
+	case sharing.ErrNoRules:
+		return codeNoRules.New(err)
+	case sharing.ErrTooManyMembers:
+		return codeTooManyMembers.New(err)
+	case sharing.ErrTooManySharings:
+		return codeTooManySharings.New(err)
+	case sharing.ErrInvalidURL:
+		return codeInvalidURL.Parameter("url", err)
+	case sharing.ErrInvalidSharing:
+		return codeInvalidSharing.New(err)
+	case sharing.ErrInvalidRule:
+		return codeInvalidRule.New(err)
+	case sharing.ErrMemberNotFound:
+		return codeMemberNotFound.New(err)
+	case sharing.ErrInvitationNotSent:
+		return codeInvitationNotSent.New(err)
+	case sharing.ErrRequestFailed:
+		return codeRequestFailed.New(err)
+	case sharing.ErrNoOAuthClient:
+		return codeNoOAuthClient.New(err)
+	case sharing.ErrMissingID:
+		return codeMissingID.New(err)
+	case sharing.ErrMissingRev:
+		return codeMissingRev.New(err)
+	case sharing.ErrInternalServerError:
+		return codeInternal.New(err)
+	case sharing.ErrMissingFileMetadata:
+		return codeMissingFileMetadata.New(err)
+	case sharing.ErrFolderNotFound:
+		return codeFolderNotFound.New(err)
+	case sharing.ErrFileNotFound:
+		return codeFileNotFound.New(err)
+	case sharing.ErrSafety:
+		return codeSafety.New(err)
+	case sharing.ErrAlreadyAccepted:
+		return codeAlreadyAccepted.New(err)
+	case sharing.ErrMemberNotVerified:
+		return codeMemberNotVerified.New(err)
+	case sharing.ErrInvalidSignature:
+		return codeInvalidSignature.New(err)
+	case sharing.ErrInvalidVerificationCode:
+		return codeInvalidVerificationCode.Parameter("code", err)
+	case sharing.ErrVerificationLocked:
+		return codeVerificationLocked.New(err)
+	case vfs.ErrInvalidHash:
+		return codeInvalidMD5Sum.Parameter("md5sum", err)
+	case vfs.ErrContentLengthMismatch:
+		return codeContentLengthMismatch.Parameter("Content-Length", err)
+	case vfs.ErrConflict:
+		return codeFileConflict.New(err)
+	case vfs.ErrFileTooBig, vfs.ErrMaxFileSize:
+		return codeFileTooBig.New(err)
+	case vfs.ErrFileQuarantined:
+		return codeFileQuarantined.New(err)
+	case permission.ErrExpiredToken:
+		return codeExpiredToken.New(err)
+	case webhook.ErrInvalidURL:
+		return codeInvalidWebhookURL.Attribute("url", err)
+	case sharing.ErrInvalidWebhookEvent:
+		return codeInvalidWebhookEvent.Attribute("events", err)
+	case sharing.ErrInvalidExpiration:
+		return codeInvalidExpiration.Attribute("expires_at", err)
+	}
+	logger.WithNamespace("sharing").Warnf("Not wrapped error: %s", err)
+	return err
+}
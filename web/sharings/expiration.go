@@ -0,0 +1,44 @@
+package sharings
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// PutExpiration sets the date when the sharing will be automatically revoked.
+func PutExpiration(c echo.Context) error {
+	s, err := ownedSharing(c)
+	if err != nil {
+		return err
+	}
+	var attrs struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if _, err := jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if attrs.ExpiresAt == nil {
+		return codeInvalidExpiration.Attribute("expires_at", errors.New("The expiration date is missing"))
+	}
+	if err := s.SetExpiration(middlewares.GetInstance(c), attrs.ExpiresAt); err != nil {
+		return wrapErrors(err)
+	}
+	return jsonapiSharingWithDocs(c, s)
+}
+
+// DeleteExpiration removes the expiration date of a sharing.
+func DeleteExpiration(c echo.Context) error {
+	s, err := ownedSharing(c)
+	if err != nil {
+		return err
+	}
+	if err := s.SetExpiration(middlewares.GetInstance(c), nil); err != nil {
+		return wrapErrors(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package sharings
+
+import (
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// AllowLocalCopies is used by a recipient to allow the photos of the shared
+// albums to be matched with the files of its own library.
+func AllowLocalCopies(c echo.Context) error {
+	return setLinkLocalCopies(c, true)
+}
+
+// DisallowLocalCopies is used by a recipient to stop matching the photos of
+// the shared albums with the files of its own library.
+func DisallowLocalCopies(c echo.Context) error {
+	return setLinkLocalCopies(c, false)
+}
+
+func setLinkLocalCopies(c echo.Context, enabled bool) error {
+	inst := middlewares.GetInstance(c)
+	s, err := sharing.FindSharing(inst, c.Param("sharing-id"))
+	if err != nil {
+		return wrapErrors(err)
+	}
+	if _, err = checkCreatePermissions(c, s); err != nil {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	if err = s.SetLinkLocalCopies(inst, enabled); err != nil {
+		return wrapErrors(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
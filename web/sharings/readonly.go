@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/cozy/cozy-stack/model/audit"
 	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/cozy/cozy-stack/web/middlewares"
 	"github.com/labstack/echo/v4"
@@ -28,15 +30,18 @@ func AddReadOnly(c echo.Context) error {
 	}
 	index, err := strconv.Atoi(c.Param("index"))
 	if err != nil {
-		return jsonapi.InvalidParameter("index", err)
+		return codeInvalidIndex.Parameter("index", err)
 	}
 	if index == 0 || index >= len(s.Members) {
-		return jsonapi.InvalidParameter("index", errors.New("Invalid index"))
+		return codeInvalidIndex.Parameter("index", errors.New("Invalid index"))
 	}
 	if s.Owner {
+		before := audit.SharingState(s)
 		if err = s.AddReadOnlyFlag(inst, index); err != nil {
 			return wrapErrors(err)
 		}
+		audit.Record(inst, audit.ActionUpdate, consts.Sharings, s.SID,
+			middlewares.GetAuditActor(c), before, audit.SharingState(s))
 		go s.NotifyRecipients(inst, nil)
 	} else {
 		if err = s.DelegateAddReadOnlyFlag(inst, index); err != nil {
@@ -82,15 +87,18 @@ func RemoveReadOnly(c echo.Context) error {
 	}
 	index, err := strconv.Atoi(c.Param("index"))
 	if err != nil {
-		return jsonapi.InvalidParameter("index", err)
+		return codeInvalidIndex.Parameter("index", err)
 	}
 	if index == 0 || index >= len(s.Members) {
-		return jsonapi.InvalidParameter("index", errors.New("Invalid index"))
+		return codeInvalidIndex.Parameter("index", errors.New("Invalid index"))
 	}
 	if s.Owner {
+		before := audit.SharingState(s)
 		if err = s.RemoveReadOnlyFlag(inst, index); err != nil {
 			return wrapErrors(err)
 		}
+		audit.Record(inst, audit.ActionUpdate, consts.Sharings, s.SID,
+			middlewares.GetAuditActor(c), before, audit.SharingState(s))
 		go s.NotifyRecipients(inst, nil)
 	} else {
 		if err = s.DelegateRemoveReadOnlyFlag(inst, index); err != nil {
@@ -0,0 +1,78 @@
+package sharings
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// GetFileContent is used on the owner's instance to send the content of a
+// file of a sharing in metadata-only mode to a recipient.
+func GetFileContent(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	sharingID := c.Param("sharing-id")
+	s, err := sharing.FindSharing(inst, sharingID)
+	if err != nil {
+		inst.Logger().WithNamespace("replicator").Infof("Sharing was not found: %s", err)
+		return wrapErrors(err)
+	}
+	member, err := requestMember(c, s)
+	if err != nil {
+		inst.Logger().WithNamespace("replicator").Infof("Member was not found: %s", err)
+		return wrapErrors(err)
+	}
+	file, err := s.FileForMember(inst, member, c.Param("id"))
+	if err != nil {
+		return wrapErrors(err)
+	}
+	err = vfs.ServeFileContent(inst.VFS(), file, nil, "", "", c.Request(), c.Response())
+	if err != nil {
+		return wrapErrors(err)
+	}
+	return nil
+}
+
+// DownloadRemoteFile is used on the instance of a recipient to download a
+// file of a sharing in metadata-only mode. The content is fetched from the
+// instance of the owner, or from the cache.
+func DownloadRemoteFile(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	sharingID := c.Param("sharing-id")
+	s, err := sharing.FindSharing(inst, sharingID)
+	if err != nil {
+		return wrapErrors(err)
+	}
+	if s.Owner || !s.MetadataOnly {
+		return wrapErrors(sharing.ErrInvalidSharing)
+	}
+	file, err := s.GetRemoteFile(inst, c.Param("file-id"))
+	if err != nil {
+		return wrapErrors(err)
+	}
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Files); err != nil {
+		if err := middlewares.Allow(c, permission.GET, file); err != nil {
+			return err
+		}
+	}
+
+	content, err := s.OpenRemoteFile(inst, file)
+	if err != nil {
+		return wrapErrors(err)
+	}
+	defer content.Close()
+
+	disposition := "inline"
+	if c.QueryParam("Dl") == "1" {
+		disposition = "attachment"
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, vfs.ContentDisposition(disposition, file.Name))
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(file.Size, 10))
+	return c.Stream(http.StatusOK, file.Mime, content)
+}
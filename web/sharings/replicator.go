@@ -4,10 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/cozy/cozy-stack/model/sharing"
 	"github.com/cozy/cozy-stack/pkg/consts"
-	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/cozy/cozy-stack/web/middlewares"
 	"github.com/labstack/echo/v4"
 )
@@ -105,7 +106,7 @@ func SyncFile(c echo.Context) error {
 	}
 	if c.Param("id") != fileDoc.DocID {
 		err = errors.New("The identifiers in the URL and in the doc are not the same")
-		return jsonapi.InvalidAttribute("id", err)
+		return codeIDMismatch.Attribute("id", err)
 	}
 	key, err := s.SyncFile(inst, &fileDoc)
 	if err != nil {
@@ -168,6 +169,7 @@ func replicatorRoutes(router *echo.Group) {
 	group.GET("/:sharing-id/io.cozy.files/:id", GetFolder, checkSharingReadPermissions)
 	group.PUT("/:sharing-id/io.cozy.files/:id/metadata", SyncFile, checkSharingWritePermissions)
 	group.PUT("/:sharing-id/io.cozy.files/:id", FileHandler, checkSharingWritePermissions)
+	group.GET("/:sharing-id/io.cozy.files/:id/content", GetFileContent, checkSharingReadPermissions)
 	group.POST("/:sharing-id/reupload", ReuploadHandler, checkSharingReadPermissions)
 	group.DELETE("/:sharing-id/initial", EndInitial, checkSharingWritePermissions)
 }
@@ -186,6 +188,9 @@ func checkSharingReadPermissions(next echo.HandlerFunc) echo.HandlerFunc {
 				Infof("Not allowed (%s)", sharingID)
 			return echo.NewHTTPError(http.StatusForbidden)
 		}
+		if err := checkSharingSignature(c); err != nil {
+			return err
+		}
 		return next(c)
 	}
 }
@@ -212,9 +217,65 @@ func hasSharingWritePermissions(c echo.Context) error {
 			Infof("Not allowed (%s)", sharingID)
 		return echo.NewHTTPError(http.StatusForbidden)
 	}
+	return checkSharingSignature(c)
+}
+
+// checkSharingSignature verifies the signature of a request sent by another
+// member of the sharing. As the signing key is in the sharing document, it
+// also checks without a round-trip that the member has not been revoked.
+func checkSharingSignature(c echo.Context) error {
+	if c.Get("sharing_signature_checked") == true {
+		return nil
+	}
+	inst := middlewares.GetInstance(c)
+	s, err := sharing.FindSharing(inst, c.Param("sharing-id"))
+	if err != nil {
+		return wrapErrors(err)
+	}
+	member, err := findRequestMember(c, s)
+	if err != nil {
+		// The request is not made by another instance of the sharing, but by
+		// an application with a permission on the sharing
+		c.Set("sharing_signature_checked", true)
+		return nil
+	}
+	if !s.Active || member.Status == sharing.MemberStatusRevoked {
+		inst.Logger().WithNamespace("replicator").
+			Infof("Request from a revoked member (%s)", s.SID)
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	return verifyMemberSignature(c, s, member)
+}
+
+// verifyMemberSignature checks the signature of a request made by the given
+// member of the sharing.
+func verifyMemberSignature(c echo.Context, s *sharing.Sharing, member *sharing.Member) error {
+	if c.Get("sharing_signature_checked") == true {
+		return nil
+	}
+	inst := middlewares.GetInstance(c)
+	creds := s.FindCredentials(member)
+	if creds == nil {
+		inst.Logger().WithNamespace("replicator").
+			Infof("No credentials for the member (%s)", s.SID)
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	if err := creds.VerifySignature(c.Request(), isStreamedRoute(c), time.Now()); err != nil {
+		inst.Logger().WithNamespace("replicator").
+			Infof("Invalid signature (%s): %s", s.SID, err)
+		return wrapErrors(err)
+	}
+	c.Set("sharing_signature_checked", true)
 	return nil
 }
 
+// isStreamedRoute returns true for the route where the content of a file is
+// uploaded, as its body is not hashed for the signature.
+func isStreamedRoute(c echo.Context) bool {
+	return c.Request().Method == http.MethodPut &&
+		strings.HasSuffix(c.Path(), "/io.cozy.files/:id")
+}
+
 func checkSharingPermissions(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		sharingID := c.Param("sharing-id")
@@ -229,11 +290,27 @@ func checkSharingPermissions(next echo.HandlerFunc) echo.HandlerFunc {
 				Infof("Not allowed (%s)", sharingID)
 			return echo.NewHTTPError(http.StatusForbidden)
 		}
+		if err := checkSharingSignature(c); err != nil {
+			return err
+		}
 		return next(c)
 	}
 }
 
+// requestMember returns the member of the sharing that has made the request,
+// after having checked the signature of the request.
 func requestMember(c echo.Context, s *sharing.Sharing) (*sharing.Member, error) {
+	member, err := findRequestMember(c, s)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyMemberSignature(c, s, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func findRequestMember(c echo.Context, s *sharing.Sharing) (*sharing.Member, error) {
 	requestPerm, err := middlewares.GetPermission(c)
 	if err != nil {
 		return nil, err
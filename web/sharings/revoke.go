@@ -5,8 +5,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/cozy/cozy-stack/model/audit"
 	"github.com/cozy/cozy-stack/model/sharing"
-	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/web/middlewares"
 	"github.com/labstack/echo/v4"
 )
@@ -23,9 +24,12 @@ func RevokeSharing(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusForbidden)
 	}
+	before := audit.SharingState(s)
 	if err = s.Revoke(inst); err != nil {
 		return wrapErrors(err)
 	}
+	audit.Record(inst, audit.ActionRevoke, consts.Sharings, s.SID,
+		middlewares.GetAuditActor(c), before, audit.SharingState(s))
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -43,14 +47,17 @@ func RevokeRecipient(c echo.Context) error {
 	}
 	index, err := strconv.Atoi(c.Param("index"))
 	if err != nil {
-		return jsonapi.InvalidParameter("index", err)
+		return codeInvalidIndex.Parameter("index", err)
 	}
 	if index == 0 || index >= len(s.Members) {
-		return jsonapi.InvalidParameter("index", errors.New("Invalid index"))
+		return codeInvalidIndex.Parameter("index", errors.New("Invalid index"))
 	}
+	before := audit.SharingState(s)
 	if err = s.RevokeRecipient(inst, index); err != nil {
 		return wrapErrors(err)
 	}
+	audit.Record(inst, audit.ActionUpdate, consts.Sharings, s.SID,
+		middlewares.GetAuditActor(c), before, audit.SharingState(s))
 	go s.NotifyRecipients(inst, nil)
 	return c.NoContent(http.StatusNoContent)
 }
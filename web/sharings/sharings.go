@@ -5,25 +5,23 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/audit"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/oauth"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/settings"
 	"github.com/cozy/cozy-stack/model/sharing"
-	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/avatar"
 	"github.com/cozy/cozy-stack/pkg/config/config"
 	"github.com/cozy/cozy-stack/pkg/consts"
 	"github.com/cozy/cozy-stack/pkg/couchdb"
 	"github.com/cozy/cozy-stack/pkg/jsonapi"
-	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/safehttp"
 	"github.com/cozy/cozy-stack/web/middlewares"
-	"github.com/hashicorp/go-multierror"
 	"github.com/labstack/echo/v4"
 )
 
@@ -74,6 +72,8 @@ func CreateSharing(c echo.Context) error {
 	if err != nil {
 		return wrapErrors(err)
 	}
+	audit.Record(inst, audit.ActionCreate, consts.Sharings, s.SID,
+		middlewares.GetAuditActor(c), nil, audit.SharingState(&s))
 	if err = s.SendInvitations(inst, perms); err != nil {
 		return wrapErrors(err)
 	}
@@ -144,7 +144,7 @@ func GetSharing(c echo.Context) error {
 	if err != nil {
 		return wrapErrors(err)
 	}
-	if err = checkGetPermissions(c, s); err != nil {
+	if err = CheckGetPermissions(c, s); err != nil {
 		return wrapErrors(err)
 	}
 	return jsonapiSharingWithDocs(c, s)
@@ -184,29 +184,38 @@ func GetSharingsInfoByDocType(c echo.Context) error {
 	if err := middlewares.AllowWholeType(c, permission.GET, docType); err != nil {
 		return wrapErrors(err)
 	}
-	if len(sharings) == 0 {
-		return jsonapi.DataList(c, http.StatusOK, nil, nil)
+	page, err := jsonapi.ExtractPage(c, 0, consts.MaxItemsPerPageForMango)
+	if err != nil {
+		return err
+	}
+	total := len(sharings)
+	if total == 0 {
+		return jsonapi.DataListPage(c, http.StatusOK, nil, &total, nil)
 	}
 	sharingIDs := make([]string, 0, len(sharings))
 	for sID := range sharings {
 		sharingIDs = append(sharingIDs, sID)
 	}
+	sort.Strings(sharingIDs)
+	start, end, next := page.Bounds(len(sharingIDs))
+	sharingIDs = sharingIDs[start:end]
+
 	sDocs, err := sharing.GetSharedDocsBySharingIDs(inst, sharingIDs)
 	if err != nil {
 		inst.Logger().WithNamespace("sharing").Errorf("GetSharedDocsBySharingIDs error: %s", err)
 		return wrapErrors(err)
 	}
 
-	res := make([]*sharing.APISharing, 0, len(sharings))
-	for sID, s := range sharings {
+	res := make([]*sharing.APISharing, 0, len(sharingIDs))
+	for _, sID := range sharingIDs {
 		as := &sharing.APISharing{
-			Sharing:     s,
+			Sharing:     sharings[sID],
 			SharedDocs:  sDocs[sID],
 			Credentials: nil,
 		}
 		res = append(res, as)
 	}
-	return sharing.InfoByDocTypeData(c, http.StatusOK, res)
+	return sharing.InfoByDocTypeData(c, http.StatusOK, res, total, next)
 }
 
 // AnswerSharing is used to exchange credentials between 2 cozys, after the
@@ -229,6 +238,31 @@ func AnswerSharing(c echo.Context) error {
 	return jsonapi.Data(c, http.StatusOK, ac, nil)
 }
 
+// RepairCredentials is used by another member of the sharing to renegotiate
+// the OAuth clients and tokens, when they have been revoked. The request is
+// authenticated by its signature, as the tokens are no longer valid.
+func RepairCredentials(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	sharingID := c.Param("sharing-id")
+	s, err := sharing.FindSharing(inst, sharingID)
+	if err != nil {
+		return wrapErrors(err)
+	}
+	member, creds, err := s.FindMemberBySignature(c.Request())
+	if err != nil {
+		return wrapErrors(err)
+	}
+	var params sharing.APICredentials
+	if _, err = jsonapi.Bind(c.Request().Body, &params); err != nil {
+		return jsonapi.BadJSON()
+	}
+	ac, err := s.ProcessRepairing(inst, member, creds, &params)
+	if err != nil {
+		return wrapErrors(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, ac, nil)
+}
+
 // ReceivePublicKey is used to receive the public key of a sharing member. It can
 // be used when the member has delegated authentication, and didn't have a
 // password when they accepted the sharing: this route is called when the user
@@ -262,20 +296,53 @@ func ChangeCozyAddress(c echo.Context) error {
 	if err != nil {
 		return wrapErrors(err)
 	}
+	member, err := requestMember(c, s)
+	if err != nil {
+		return wrapErrors(err)
+	}
+
 	var moved sharing.APIMoved
 	if _, err = jsonapi.Bind(c.Request().Body, &moved); err != nil {
 		return jsonapi.BadJSON()
 	}
 
+	if s.Owner {
+		err = s.ChangeMemberAddress(inst, member, moved)
+	} else {
+		err = s.ChangeOwnerAddress(inst, moved)
+	}
+	if err != nil {
+		return wrapErrors(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ChangeIdentity is called when a member of the sharing has changed their
+// email or public name.
+func ChangeIdentity(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	sharingID := c.Param("sharing-id")
+	s, err := sharing.FindSharing(inst, sharingID)
+	if err != nil {
+		return wrapErrors(err)
+	}
 	member, err := requestMember(c, s)
 	if err != nil {
 		return wrapErrors(err)
 	}
 
+	var identity sharing.APIIdentity
+	if _, err = jsonapi.Bind(c.Request().Body, &identity); err != nil {
+		return jsonapi.BadJSON()
+	}
+	if identity.Email == "" {
+		return codeMissingEmail.New(errors.New("Missing email"))
+	}
+
 	if s.Owner {
-		err = s.ChangeMemberAddress(inst, member, moved)
+		err = s.ChangeMemberIdentity(inst, member, identity)
 	} else {
-		err = s.ChangeOwnerAddress(inst, moved)
+		err = s.ChangeOwnerIdentity(inst, identity)
 	}
 	if err != nil {
 		return wrapErrors(err)
@@ -317,6 +384,7 @@ func AddRecipients(c echo.Context) error {
 	if err != nil {
 		return jsonapi.BadJSON()
 	}
+	before := audit.SharingState(s)
 	if rel, ok := obj.GetRelationship("recipients"); ok {
 		if err = addRecipientsToSharing(inst, s, rel, false); err != nil {
 			return wrapErrors(err)
@@ -327,6 +395,8 @@ func AddRecipients(c echo.Context) error {
 			return wrapErrors(err)
 		}
 	}
+	audit.Record(inst, audit.ActionUpdate, consts.Sharings, s.SID,
+		middlewares.GetAuditActor(c), before, audit.SharingState(s))
 	return jsonapiSharingWithDocs(c, s)
 }
 
@@ -469,9 +539,34 @@ func renderDiscoveryForm(c echo.Context, inst *instance.Instance, code int, shar
 		"ShareCode":       sharecode,
 		"URLError":        code == http.StatusBadRequest,
 		"NotEmailError":   code == http.StatusPreconditionFailed,
+		"CodeNeeded":      code == http.StatusForbidden || code == http.StatusUnprocessableEntity,
+		"CodeError":       code == http.StatusUnprocessableEntity,
 	})
 }
 
+// askVerificationCode is used when a new member of an open sharing must prove
+// their identity: a code is sent to their email address, and the discovery
+// form is displayed again with a field for this code.
+//
+// If the member has no email address, they can only accept the sharing on the
+// Cozy instance they were invited on, and the URL is rejected.
+func askVerificationCode(c echo.Context, inst *instance.Instance, s *sharing.Sharing, m *sharing.Member, state, sharecode, cozyURL string, verifErr error) error {
+	code := codeMemberNotVerified
+	if m.Email == "" {
+		code = codeCozyURLRejected
+	} else if errors.Is(verifErr, sharing.ErrInvalidVerificationCode) {
+		code = codeInvalidVerificationCode
+	} else if err := s.SendVerificationCode(inst, m); err != nil {
+		return wrapErrors(err)
+	}
+	if c.Request().Header.Get(echo.HeaderAccept) == echo.MIMEApplicationJSON {
+		return code.JSON(c, verifErr.Error())
+	}
+	displayed := *m
+	displayed.Instance = cozyURL
+	return renderDiscoveryForm(c, inst, code.Status, s.SID, state, sharecode, &displayed)
+}
+
 // GetDiscovery displays a form where a recipient can give the address of their
 // cozy instance
 func GetDiscovery(c echo.Context) error {
@@ -583,10 +678,21 @@ func PostDiscovery(c echo.Context) error {
 		if strings.Contains(cozyURL, "@") {
 			return renderDiscoveryForm(c, inst, http.StatusPreconditionFailed, sharingID, state, sharecode, member)
 		}
+		if code := c.FormValue("code"); code != "" {
+			if err = s.VerifyMemberByCode(inst, member, code); err != nil {
+				if !errors.Is(err, sharing.ErrInvalidVerificationCode) {
+					return wrapErrors(err)
+				}
+				return askVerificationCode(c, inst, s, member, state, sharecode, cozyURL, err)
+			}
+		}
 		email = member.Email
 		if err = s.RegisterCozyURL(inst, member, cozyURL); err != nil {
+			if errors.Is(err, sharing.ErrMemberNotVerified) {
+				return askVerificationCode(c, inst, s, member, state, sharecode, cozyURL, err)
+			}
 			if c.Request().Header.Get(echo.HeaderAccept) == echo.MIMEApplicationJSON {
-				return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+				return codeCozyURLRejected.JSON(c, err.Error())
 			}
 			if errors.Is(err, sharing.ErrAlreadyAccepted) {
 				return renderAlreadyAccepted(c, inst, cozyURL)
@@ -599,11 +705,21 @@ func PostDiscovery(c echo.Context) error {
 		}
 		sharing.PersistInstanceURL(inst, member.Email, member.Instance)
 	} else {
-		redirectURL, err = s.DelegateDiscovery(inst, state, cozyURL)
+		redirectURL, err = s.DelegateDiscovery(inst, state, cozyURL, c.FormValue("code"))
 		if err != nil {
+			if errors.Is(err, sharing.ErrMemberNotVerified) || errors.Is(err, sharing.ErrInvalidVerificationCode) {
+				code := codeMemberNotVerified
+				if errors.Is(err, sharing.ErrInvalidVerificationCode) {
+					code = codeInvalidVerificationCode
+				}
+				if c.Request().Header.Get(echo.HeaderAccept) == echo.MIMEApplicationJSON {
+					return code.JSON(c, err.Error())
+				}
+				return renderDiscoveryForm(c, inst, code.Status, sharingID, state, sharecode, &sharing.Member{Instance: cozyURL})
+			}
 			if errors.Is(err, sharing.ErrInvalidURL) {
 				if c.Request().Header.Get(echo.HeaderAccept) == echo.MIMEApplicationJSON {
-					return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+					return codeCozyURLRejected.JSON(c, err.Error())
 				}
 				return renderDiscoveryForm(c, inst, http.StatusBadRequest, sharingID, state, sharecode, &sharing.Member{})
 			}
@@ -672,10 +788,10 @@ func GetAvatar(c echo.Context) error {
 
 	index, err := strconv.Atoi(c.Param("index"))
 	if err != nil {
-		return jsonapi.InvalidParameter("index", err)
+		return codeInvalidIndex.Parameter("index", err)
 	}
 	if index > len(s.Members) {
-		return jsonapi.NotFound(errors.New("member not found"))
+		return codeMemberNotFound.New(errors.New("member not found"))
 	}
 	m := s.Members[index]
 
@@ -717,10 +833,11 @@ func localAvatar(c echo.Context, m sharing.Member) error {
 // Routes sets the routing for the sharing service
 func Routes(router *echo.Group) {
 	// Create a sharing
-	router.POST("/", CreateSharing)        // On the sharer
-	router.PUT("/:sharing-id", PutSharing) // On a recipient
+	router.POST("/", CreateSharing, middlewares.Idempotent) // On the sharer
+	router.PUT("/:sharing-id", PutSharing)                  // On a recipient
 	router.GET("/:sharing-id", GetSharing)
 	router.POST("/:sharing-id/answer", AnswerSharing)
+	router.POST("/:sharing-id/repairing", RepairCredentials)
 
 	// Managing recipients
 	router.POST("/:sharing-id/recipients", AddRecipients)
@@ -728,12 +845,15 @@ func Routes(router *echo.Group) {
 	router.DELETE("/:sharing-id/recipients", RevokeSharing)          // On the sharer
 	router.DELETE("/:sharing-id/recipients/:index", RevokeRecipient) // On the sharer
 	router.POST("/:sharing-id/recipients/self/moved", ChangeCozyAddress)
+	router.POST("/:sharing-id/recipients/self/identity", ChangeIdentity)
 	router.POST("/:sharing-id/recipients/:index/readonly", AddReadOnly)                                      // On the sharer
 	router.POST("/:sharing-id/recipients/self/readonly", DowngradeToReadOnly, checkSharingWritePermissions)  // On the recipient
 	router.DELETE("/:sharing-id/recipients/:index/readonly", RemoveReadOnly)                                 // On the sharer
 	router.DELETE("/:sharing-id/recipients/self/readonly", UpgradeToReadWrite, checkSharingWritePermissions) // On the recipient
 	router.DELETE("/:sharing-id", RevocationRecipientNotif, checkSharingWritePermissions)                    // On the recipient
 	router.DELETE("/:sharing-id/recipients/self", RevokeRecipientBySelf)                                     // On the recipient
+	router.PUT("/:sharing-id/recipients/self/local-copies", AllowLocalCopies)                                // On the recipient
+	router.DELETE("/:sharing-id/recipients/self/local-copies", DisallowLocalCopies)                          // On the recipient
 	router.DELETE("/:sharing-id/answer", RevocationOwnerNotif, checkSharingWritePermissions)                 // On the sharer
 	router.POST("/:sharing-id/public-key", ReceivePublicKey)
 
@@ -742,6 +862,7 @@ func Routes(router *echo.Group) {
 
 	// Misc
 	router.GET("/news", CountNewShortcuts)
+	router.GET("/suggestions", GetSuggestions)
 	router.GET("/doctype/:doctype", GetSharingsInfoByDocType)
 	router.GET("/:sharing-id/recipients/:index/avatar", GetAvatar)
 
@@ -749,6 +870,13 @@ func Routes(router *echo.Group) {
 	router.GET("/:sharing-id/discovery", GetDiscovery)
 	router.POST("/:sharing-id/discovery", PostDiscovery)
 	router.POST("/:sharing-id/preview-url", GetPreviewURL)
+	router.GET("/:sharing-id/analytics", GetAnalytics)
+	router.GET("/:sharing-id/webhook", GetWebhook)                                // On the sharer
+	router.PUT("/:sharing-id/webhook", PutWebhook)                                // On the sharer
+	router.DELETE("/:sharing-id/webhook", DeleteWebhook)                          // On the sharer
+	router.PUT("/:sharing-id/expiration", PutExpiration)                          // On the sharer
+	router.DELETE("/:sharing-id/expiration", DeleteExpiration)                    // On the sharer
+	router.GET("/:sharing-id/remote-files/:file-id/download", DownloadRemoteFile) // On a recipient
 
 	// Replicator routes
 	replicatorRoutes(router)
@@ -757,7 +885,7 @@ func Routes(router *echo.Group) {
 func extractSlugFromSourceID(sourceID string) (string, error) {
 	parts := strings.SplitN(sourceID, "/", 2)
 	if len(parts) < 2 {
-		return "", jsonapi.BadRequest(errors.New("Invalid request"))
+		return "", codeInvalidSourceID.New(errors.New("Invalid request"))
 	}
 	slug := parts[1]
 	return slug, nil
@@ -802,9 +930,9 @@ func checkCreatePermissions(c echo.Context, s *sharing.Sharing) (string, error)
 	return extractSlugFromSourceID(requestPerm.SourceID)
 }
 
-// checkGetPermissions checks the requester's token has at least one doctype
+// CheckGetPermissions checks the requester's token has at least one doctype
 // permission declared in the rules of the sharing document
-func checkGetPermissions(c echo.Context, s *sharing.Sharing) error {
+func CheckGetPermissions(c echo.Context, s *sharing.Sharing) error {
 	requestPerm, err := middlewares.GetPermission(c)
 	if err != nil {
 		return err
@@ -861,54 +989,3 @@ func ClearAppInURL(cozyURL string) string {
 	u.Host = parts[0] + "." + domain
 	return u.String()
 }
-
-// wrapErrors returns a formatted error
-func wrapErrors(err error) error {
-	if merr, ok := err.(*multierror.Error); ok {
-		err = merr.WrappedErrors()[0]
-	}
-	switch err {
-	case contact.ErrNoMailAddress:
-		return jsonapi.InvalidAttribute("recipients", err)
-	case sharing.ErrNoRecipients, sharing.ErrNoRules:
-		return jsonapi.BadRequest(err)
-	case sharing.ErrTooManyMembers:
-		return jsonapi.BadRequest(err)
-	case sharing.ErrInvalidURL:
-		return jsonapi.InvalidParameter("url", err)
-	case sharing.ErrInvalidSharing, sharing.ErrInvalidRule:
-		return jsonapi.BadRequest(err)
-	case sharing.ErrMemberNotFound:
-		return jsonapi.NotFound(err)
-	case sharing.ErrInvitationNotSent:
-		return jsonapi.BadRequest(err)
-	case sharing.ErrRequestFailed:
-		return jsonapi.BadGateway(err)
-	case sharing.ErrNoOAuthClient:
-		return jsonapi.BadRequest(err)
-	case sharing.ErrMissingID, sharing.ErrMissingRev:
-		return jsonapi.BadRequest(err)
-	case sharing.ErrInternalServerError:
-		return jsonapi.InternalServerError(err)
-	case sharing.ErrMissingFileMetadata:
-		return jsonapi.NotFound(err)
-	case sharing.ErrFolderNotFound:
-		return jsonapi.NotFound(err)
-	case sharing.ErrSafety:
-		return jsonapi.BadRequest(err)
-	case sharing.ErrAlreadyAccepted:
-		return jsonapi.Conflict(err)
-	case vfs.ErrInvalidHash:
-		return jsonapi.InvalidParameter("md5sum", err)
-	case vfs.ErrContentLengthMismatch:
-		return jsonapi.PreconditionFailed("Content-Length", err)
-	case vfs.ErrConflict:
-		return jsonapi.Conflict(err)
-	case vfs.ErrFileTooBig, vfs.ErrMaxFileSize:
-		return jsonapi.Errorf(http.StatusRequestEntityTooLarge, "%s", err)
-	case permission.ErrExpiredToken:
-		return jsonapi.BadRequest(err)
-	}
-	logger.WithNamespace("sharing").Warnf("Not wrapped error: %s", err)
-	return err
-}
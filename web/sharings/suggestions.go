@@ -0,0 +1,85 @@
+package sharings
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cozy/cozy-stack/model/permission"
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSuggestionsLimit = 10
+	maxSuggestionsLimit     = 50
+)
+
+// GetSuggestions returns the recipients suggested for sharing a document,
+// ranked by the previous sharings with them. The suggestions are computed on
+// the instance from its sharings and contacts.
+func GetSuggestions(c echo.Context) error {
+	inst := middlewares.GetInstance(c)
+	if err := middlewares.AllowWholeType(c, permission.GET, consts.Contacts); err != nil {
+		return err
+	}
+
+	limit := defaultSuggestionsLimit
+	if l := c.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			return codeInvalidLimit.Parameter("limit", errors.New("Invalid limit"))
+		}
+		if n > maxSuggestionsLimit {
+			n = maxSuggestionsLimit
+		}
+		limit = n
+	}
+
+	doctype := c.QueryParam("doctype")
+	var ids []string
+	if id := c.QueryParam("id"); id != "" {
+		if doctype == "" {
+			return codeMissingDoctype.Parameter("doctype", errors.New("The doctype is missing"))
+		}
+		if doctype == consts.Files {
+			dir, file, err := inst.VFS().DirOrFileByID(id)
+			if err != nil {
+				return codeFileNotFound.New(err)
+			}
+			var fetcher vfs.Fetcher = dir
+			parentID := ""
+			if dir != nil {
+				parentID = dir.DirID
+			} else {
+				fetcher = file
+				parentID = file.DirID
+			}
+			if err := middlewares.AllowVFS(c, permission.GET, fetcher); err != nil {
+				return err
+			}
+			ids = []string{id, parentID}
+		} else {
+			if err := middlewares.AllowTypeAndID(c, permission.GET, doctype, id); err != nil {
+				return err
+			}
+			ids = []string{id}
+		}
+	}
+
+	sharing.EnsureSuggestionsTrigger(inst)
+	doc, err := sharing.GetSuggestions(inst)
+	if err != nil {
+		return wrapErrors(err)
+	}
+	ranked := doc.Rank(doctype, ids, limit)
+	objs := make([]jsonapi.Object, len(ranked))
+	for i, suggestion := range ranked {
+		objs[i] = suggestion
+	}
+	return jsonapi.DataList(c, http.StatusOK, objs, nil)
+}
@@ -0,0 +1,107 @@
+package sharings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cozy/cozy-stack/model/sharing"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
+	"github.com/cozy/cozy-stack/web/middlewares"
+	"github.com/labstack/echo/v4"
+)
+
+// apiWebhook is the jsonapi representation of the webhook of a sharing. The
+// secret is only sent when the webhook is registered.
+type apiWebhook struct {
+	sharingID  string
+	w          *sharing.Webhook
+	withSecret bool
+}
+
+func (w apiWebhook) ID() string                             { return w.sharingID }
+func (w apiWebhook) Rev() string                            { return "" }
+func (w apiWebhook) DocType() string                        { return consts.SharingsWebhooks }
+func (w apiWebhook) Clone() couchdb.Doc                     { return w }
+func (w apiWebhook) SetID(_ string)                         {}
+func (w apiWebhook) SetRev(_ string)                        {}
+func (w apiWebhook) Relationships() jsonapi.RelationshipMap { return nil }
+func (w apiWebhook) Included() []jsonapi.Object             { return nil }
+func (w apiWebhook) Links() *jsonapi.LinksList {
+	return &jsonapi.LinksList{Self: "/sharings/" + w.sharingID + "/webhook"}
+}
+
+func (w apiWebhook) MarshalJSON() ([]byte, error) {
+	hook := *w.w
+	if !w.withSecret {
+		hook.Secret = ""
+	}
+	return json.Marshal(hook)
+}
+
+var errNoWebhook = errors.New("The sharing has no webhook")
+
+// ownedSharing returns the sharing from the URL, if the instance is its owner
+// and the application has the permissions on it.
+func ownedSharing(c echo.Context) (*sharing.Sharing, error) {
+	inst := middlewares.GetInstance(c)
+	s, err := sharing.FindSharing(inst, c.Param("sharing-id"))
+	if err != nil {
+		return nil, wrapErrors(err)
+	}
+	if !s.Owner {
+		return nil, wrapErrors(sharing.ErrInvalidSharing)
+	}
+	if _, err = checkCreatePermissions(c, s); err != nil {
+		return nil, wrapErrors(err)
+	}
+	return s, nil
+}
+
+// GetWebhook returns the webhook of a sharing, without its secret.
+func GetWebhook(c echo.Context) error {
+	s, err := ownedSharing(c)
+	if err != nil {
+		return err
+	}
+	if s.Webhook == nil {
+		return jsonapi.NotFound(errNoWebhook)
+	}
+	return jsonapi.Data(c, http.StatusOK, apiWebhook{s.SID, s.Webhook, false}, nil)
+}
+
+// PutWebhook registers the URL where the owner of a sharing receives the
+// events of this sharing, like a member who has accepted it. The secret for
+// checking the signatures is only in the response of this route.
+func PutWebhook(c echo.Context) error {
+	s, err := ownedSharing(c)
+	if err != nil {
+		return err
+	}
+	var attrs struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if _, err := jsonapi.Bind(c.Request().Body, &attrs); err != nil {
+		return jsonapi.BadJSON()
+	}
+	hook, err := s.SetWebhook(middlewares.GetInstance(c), attrs.URL, attrs.Events)
+	if err != nil {
+		return wrapErrors(err)
+	}
+	return jsonapi.Data(c, http.StatusOK, apiWebhook{s.SID, hook, true}, nil)
+}
+
+// DeleteWebhook unregisters the webhook of a sharing.
+func DeleteWebhook(c echo.Context) error {
+	s, err := ownedSharing(c)
+	if err != nil {
+		return err
+	}
+	if err := s.RemoveWebhook(middlewares.GetInstance(c)); err != nil {
+		return wrapErrors(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -36,6 +36,7 @@ var (
 		"error.html",
 		"import.html",
 		"instance_blocked.html",
+		"instance_maintenance.html",
 		"login.html",
 		"magic_link_twofactor.html",
 		"move_confirm.html",
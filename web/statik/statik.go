@@ -36819,154 +36819,165 @@ boYcHfom
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /locales/en.po
-Size: 35072
+Size: 38034
 
-G/+IAKwHeMM5quNQHcuas9xU2sccsYQQWuwSPnbUK1mpqVV7qmwnoTWTMn9Rfu1L
-8Uj6ARaYvQUBKUDAIQesF261RWn7+jP3LNORDvj7ilMD5CZsl0CfzmpjOS+WA8O2
-XszpDa937eOiLCFmqui0vkvTSZCdZHLjMiVTRaQ3iQtP0Al04bCthn8PpXk+zn7D
-+tUjobzKtSpW75umQmODxEeRMT5jpCS+m5l+U4WFKXEBsARDyFoeJc+qMW8+wMWC
-xtUSPEp7xvhIuky2cqWZwgh3SaT3otq/XJOm3X/EEkLDGggQdu7v5X82x8lJw/9z
-tOPjDxsn8/OVmqYk/Unc8/Xy03hS9/JXny6B48/sfrMfwKEYykrExHpk4P4NKbSP
-ARQO1vn+mdxteX/rMJBSu+Dge7jNexQVR8YDHgscMheWueIh/yGsFlS57vUInKHx
-zwfCJhIS+lVyj2SWuSdb/Ye3hmH7lU5q8ksk7xkg3JEr7qmu9FPiYE4bwCwrfPVR
-dU1kHmpluOyYW2OI09pFyofxzQ3iy3WGTjSbU0wnGSjrtpRQ0U6LM5W/RiiLspLW
-pkw/Sz0mGKpolTiWBfHjjrcOl8Nc4khA85WBjQenOTm+zjg+Lgnx0Shv1Fa3fdIm
-rts03QcIM9LVH/ckqJqTuluTtlU9reuHhYqWzMwH/kEvH4zxkd4PdsOJOZ3gM+tI
-N6Z1BrisijRMBdl35SrGXNq2Pj9UGZkrkSYPtPZ3jGsnEVI/IKKBQrGauTbq6SU9
-r9IYNue8ZR+ULaiHew+izCZuwQbGVTYPyfHMbHE1beBweyXJzC3NNYsTkGFmgl3u
-2xE0wEpXENolWaqwedI46ZNuS5kaA4HviwI7h9K7xfv3UQVr0+c6sF4Lzd9tzKUZ
-dYvJ7/+iq7GCI0wq2+uWcBpjGfcANq4hjP72kuUepRyyI8C3D0KUUMzSvXBaiJ+u
-J+4OhX8e6mh0s5Uq2PlNH5z1a/FgYy1wZlRHRjIY/3tYdzGtq0CqEGFPZ7lNzbm2
-Exp7G4GbNwDQtaub66FsB7ZlX58TicL/41ZTIZotqptGigekE0xXK/I1XtyZh2JX
-BgqD2/sthA2xUF128jgOfzfEWsZ0BNB2CStzJhZ7Ze9PWPvRHMv25Rsc4eEVxo3n
-KHdouosKDy3SHjPcYVwlWNH17iJ33IWwxN3aEEee6+JdWZwOAStC+UR7mygBKCti
-W+gvYztxJeTYenp7Jefi8mRGMOadZxepy9tTT6MDt7jZFXp+/SpIzAm2WNPUmM3v
-KhTiqrf7xSJ853lmSYWLK6QvEhvV2ofoB3XddepoSrBt8DFKRE+tic8aNQJtI1a5
-c6miXbFeneGJYrnVI1ZLnFfRU0t3KQyw1KGJTREm8ERKK+QGxBFoLzzg+yyJIotj
-8UEZbEnRg8QYLRom6S8ST+mCol9Ojzby3Zsu4xbTgIi9Cx90SGGecaXwswNUGNw5
-whp8aG+jdBZdtTuNqKR7/dMk7x1doxWQTVvcwOhxkyvPWHc04PbtHdgPXBleyneu
-AwsukpfkZvexkmpD4e4Kjqg8otRixJe8PZbXxm+yg8hg37WXNDphMsToXKHayS3Q
-PMYl1f2t/vfKwIqYh1s//7ew7vjJZBj/PO1bjXRaAa0xqaMiKUSGXJC1L8gBklog
-uLxVfMgUiyGa1HKaCST3/5GW2q4gO113DtFjcjDCFzAd/oECzQvY8MHnl2IZsmMJ
-3lIvNPCfp51MTuWw5oaN1mTVRwwegTHF+66AMFVh/EeS0++qFTCcmeZj/lPQFnTk
-aTtjoR6MapCeFFf4oBXmeSVVxOReD3ACd8KxhVO2I96c7Bkcqb5AvwvmNHxa1NKT
-x7oM8qLaoSRzPI1wcwWOoMoSfR0w1nFJXT34DTjNoLjG7t+zRvRDcdk3jxpRVoAX
-10pSAWLK0qwMU0E13gVFu326v2jnTGtm0nyuI2KPLONH0eJGBMYKUW+XPayL863a
-YTBRTbHQDpv/Hq3Van97F2436Sxz4OHsRdaHu2TgdT8bX3+V5JWnxuAJzLqXJyEv
-AwChk5so+Jl1nrAiGnN3vVPOig20SxLg8g19QqpyzQ0+WpYrIlEmurF4Fc2KPBq7
-nyk4uO24Ek/bw04QR7sCR1hhtVbELq4bSP46HNFKn9q+KZVfuEJ9E5yT/DQVc0JI
-l8eJwzFzm3tR+sZZBRmrzQT1gIwjjG3mVxaBONxuRFk3XhLoupgMSiFBGpYhfs/M
-bmt9771BtxuIRWfst5osgpxt+YrkTfgKACJn62bMzN0eKMZF/UqdiyJbQw0Tn+YV
-s0PT5z7t7D1PuflaZwTlX1s9r/5pgbUdtOyMod0kFl6ZrwsaYD8jClZkjdw1CUH0
-+gprB0eCIsmFeQDBhuUZ9IKnR0VnqigyBwAUXEHxU1LDlyHsC7UyWQQTl8Nub6NO
-pI0XPJb9ikx2m4k2N8hqEyvHKkl3q5lC5qliiEyQqLcZtnUGyU2oCe7GjkwE4jg3
-+4mvoXSx6l8g49o9rb4ZRpdyPh6iiX1hCFA5YEV66x22pm0p6nmbsXBqsKg6FqSj
-jZi8RhKlxSuuD3Vr9h1n3427oJCJmoKoAjX6NpZj2qUXwBN+4aJ1Jw9ao5vEuNDb
-mfMBHtMSZIdoEIFDnN7kshda1BpFnEmzGP+hSo9FyhwvYNAfkrZSpACFmB/CeQOi
-pdlDLnmNC74OcF83RPHilRdbRGmeAhyoDEiOt8z02UaeN5TWfIyD4o6nVq5V0yTh
-RWup+IYcjP3gEho2wnfmJfdnd7AsOHiDhYVm+Wd6LmeYxwijMZ8KbyxDCWcQ4IZj
-xclQB4QHezswsbexBmOOhKN+/RYFQMI+MRSsjtWBf/3yEgbDVYY8/Xag0bs7Gsqg
-6Gpx4apAqHazQSsyMsS0Wrpv9UxiiMrOR3q8aC/dMNI9Urhrsfwf8KCVJO4qOrCp
-1HRwtrdIo34IUaWCHczvUrQv8fWzxKC/IJpcPD66ZZ0g2Bz7sr2a0C8lEVdgWz7X
-wRjZO4gWmEWgpeYQ26iWcA4np3mQsKY87TxtYdUooSzWWRoTctZVr/+ZtuOV5LrO
-vHaIYTgS/6/zN04eRQE/nBBH5kIsbN2v+TgKxDXheEfbpqVIZ7Y6wGki6Qzc/tPN
-DnnWa8O3D8c88Za+zVls4kqIvfUwSSgJN5h6O+XXmhwFygx8LwUQO6FCn3Jqc36r
-wXG6DQ6RZcFGWuwwqfaCdhss9HOa65gLm+YUWBwnbUIvtCCc/yBaILtwIsdG2BWc
-H9f01YOxTgMmxWOu0j299nnXaIWLAXLo1mqNVZLu+++2qF1uEkMmi5iyX4wt6B15
-4m30PwvGsaTxpE6E/oAn8r86f5vsznmfmk8Hddh6cNIpipIst12hnG3b0zOGdpSa
-VtXPMBZsJSicWAxZggmZOCmFIXMcaWXoaRT7h9c8t40cMzGJ80p9oj5TQWurJBN0
-sNtljX53MkB0yNo5LiSEOymbXNemzakVD1jYOuFNUNP9G6FJHb/OpXMQajA4v20y
-PejOz494Uorj93/y+lqQdu0BmcCq+e7mMPw8AfgRr0QvqUjgCJsuv/zddutduRK4
-/BeOG8jX3VqBA6ariDJDLoSC1uDKNs0tIaxqlplJCU2WTrSneZ0GEvGuKPPeYIup
-oCJPyWqtvF6v962aIK2SvHNzITUfPBUT7hQ/MfLobZMRShlVrtuK7CGYJqstetJy
-4M/8rNT4ZP6TCeBNLRjSaOYKRqTCiW0x/fasEcd4CmEtiH6eun4EEo7PUI8N7HBW
-RanJwW+zolZHP1gdkdOW0VFGc2Y1LwLWiPrWUFn1cXZCWBQH55+Vx44Uvw3fYbkq
-NGrOxYckgHLjGTVsmoDRuAyNqQjh75CCbyBOJowTWFlomEDYztV0t988DZZYu8tC
-OzDR5zRHIAhAN9xo97lwoHBp498PoViZ/R1WYpBR9ELHMwfUnA8EOY78NHaQ7cPw
-hIIDSYgqR/GhceKPGpqsfVD6jXeWnBYCeV/sJmWoOS/ICr1GcXgxYlwnHNvKOocd
-wCciExtY88g8CaQWUHYwqfqGiLws/OyL33HxCLHqcOK5KGhYDWkwMcRWPTTeprgB
-0a30iSQJIeUMWDjNdcuo8Wpvcn67gILVxAkhHGcgGxB3HGkbqZOkHi2tlUBHcei9
-KK+bdqjVnf4cJoWskexBBKds8e136iGKXJEykdfh1z360LQVgbJhnr/KRDtO7hIx
-t/rqlEFXJjUbT29vIFhAPrs3YyshZdYLSgkH2fcdKUB0hd4PGWUXB/05AKzU3oEG
-Tt/AGkKpi8ihhSVxPFXq2yxX4wGHDiiMl+aDVeXs8ES87fb8MYcZOarDXdpIrN2t
-P6+099hd/Zel97rAqoM6PCPFL/HM4q58QdZHBg5TZ50p6V3VP5c1q7xPrXI6akvH
-aspsdO9OAKMbM3BoV0PRM2raDZmUaeD2OMnhSN6G/nVT7k81IwrxUgQsLZx+p3Em
-R59RYZnT+c+RppAWH5YbJ3nRyP3iv+d9DFPfcbMDMLaOjtocDck5686SMaVj00ck
-EhA6RIqcdZvzCtibCGwg0DUOgxLGSejEUBGmIDhWX+5CYsjwLI2nQpgVmw8prJDE
-1wl3I/28JwonTXWSBiueCT/9yDn46y9xUFf8nFLaTyqNKh9Dh4R6xY9UWTBbVY/C
-GbfL2tlDEEhqEViNwtGJcWQLqKw6LIkpqLFjjPoF1CAheNiivO2QugHxUgijkTr8
-uIt7+YFcKSQf88b+SkvkoIs5CPPdW69PTzCbyhQo3GBqijS8Qfw76j7KM4+3w/YT
-1HHxFzRbaTg2/LAjd8NaJpWf8n78SYZlTVE8nuohJObeyLBvkog3N7sgrAqs5yBo
-kev5gNpvjO7KZmP2QZrRJ6XRJHS8iAMWke8AQE+Pw+L/Hu+MM+BAd/5JtMKFIaMi
-KXrBzq7cCVhbtxMeDPE36h/Iw7TxLVMLVAos2LeBlbelAH5emOVCecSp/9snhHWh
-UlCdVUE+zYvVQl6hFqN8lRq6+wJX5YtTfZCBFQ2L/ddVKlMHTSWE3RnwaMXvhXX3
-19RPKLnFjZyr0OwROthiYDZQAAOBJdUZWeywygy2Dgbobks0BXfPEW8FKtouki9s
-KwJRzRcRIKd7u/qudLmc0AYXZWCqnySJWdMbZhzWobbVRj8OdfswCXedpYqdPNTt
-i1Xc/OUXf59MTc9MTIgZwm9caFSr7sELYFG1yMs8VYJXDqPAlveFP4waNg684fUY
-BJbReTP/J3TLWaPbSzbWYtOOuiOK1gq29cMhuuDu5y24mmdtjZ6oPl7wn7bIK50/
-3C+I6DP9IJ16nJ54eWdGFX8FWTnWTlYeFOqkGdmWCpCLpCl9Uza7ny3LPPbPjZ3F
-QiwD4SbG6i3L3IObDCWtRMYfrVFW8AN1RS6sU45Cf02ZJgD7k9Y8brk3hROJoBg3
-FWALpfOLc6wZl6c1urh6BRIGGFmTrltzGLetR7I+b/9Bxpu1NccNrKZj+llwOcnz
-dnPl/dSxIlzDTBj32/xK3qBIcLg76KvXN7Lsy5YRbgMCXQyNTzZusmDWcHc1JPRi
-fZ5olscPwFj+58AsmyFLZhhePA7hhdl2za/q9uaNhd+Z4hDGn7m5ye3vlg6qLQ1+
-G6v1vE2Fw5aSrFS/V4OZc10WwKoHXFVIGqVkQ4C8N8R5fEn1bLUOQo/aEMH9v/15
-+xIBQD5ivz+u2mPu96P2Mgq9cXmDhQFjDYwo8PvgwMnaxfMaudwyvWuhC2gUo1g+
-KfAghDJa2DKb4Fjo4AkH3qNV+6GMvPqZEOL6IJSZeGOPYN+NGWTwdM10EASnvIe7
-1PZ7eUZ0Luf3VSR0kQjdSiJO3h8klTMoEqertCwdrI+PUEJjFWKb6o/kAJXnxZBk
-hVJMOksTmdneIK14/+4H3iPnn2JxyVnj1v52K4CqmEWxJowsz2RRGyVn8wVPZkdO
-btn0EGHROmI1OTTVlmpgg9A0cSAHVpnION+lwmYNWTm4Ucw1SaIp6z6yKs2UKz4m
-N2MSvhdUb6Eq+jxLpTYTc9nULjBKJvhE6XVF29UV7EVHJdWw71oVoXnlYPnzbTWB
-tcR3mB6lYqC+stCsoi8LK7hiisXKycY5vs+yBFfg1LM79z1clitKRzu363j7Cqkc
-g7y+eQXHZ5jSK3BNwaUzZ4k4Xj0pMJTaupKUHFJWE9OSNeNoGpKNPMr5upZpEZwu
-/S5gFjaJBo73edLLZNJ0GD0sqBvvPE0TuEo35r7Lu0zu6SOUL2j3f0bApSxYMTFj
-gVWR1vCigbEjSv2lQeVSm0LxEUnvNCXUcQ3HE5W9gaE0DJ5+Vne6gtFOoyJJZtb7
-eVirGjoKAnzcWP04zl9aaekpMD1OwKTl59aU07k/lN5yUPY7QUVdbF2bwVSTUQSm
-zz7g7Iz8nl7CqheJ17IVoNdwzWt/QUGNUsmNvMSI0nDtE/cDuZNW3YOB1XeUz8Ky
-hsuwFq5bd2FnwwSHq241uWAGUz11ApIeRgs6aehGVpWSP6zoxoZGhA5qUNM3hwP+
-87gIz72oVljisqHser2AVa5Fq18DFHVPXvDsYYpsB/AZxwcIKCe3i7Do1XKlC/s8
-r8EqqoNGKWqi5YPD1+MYzhflmjbFLUzyC/W2kI4xKH0lOtlt3ZYmbhsFcNW9kRtf
-qmoAcP/lc1ZDEqN6GT5BLXpH9eLl7+ILrztI6JPpivPeg793l+0Jam9NXPTpCDmJ
-fOJhPo6UZguEDq8YItxdCaPPqAGvkwSE2P5Hkcdqb7XA8lrWSkSmMHa7vWT40/pt
-wEzqbyg5vOG/fDiv8C9gMvwXQLxqfinOw38plMoXCki5OlaQ+ZeCO8qVL5A5il+W
-iS3+erwZODXLdsOqqoQUjOyS9rWP5WyJjJcLuM/UdMZIxcGquE6tV5E11T1GcXpt
-TNVqb2Qs6amlXzFAa7HR8ZEj+bx4dmdA/Jhn24vTcs83uRHEvJMZT1kWrxWEGyY+
-jGhW3STl0M/VfZhZUdQB+TardnG9TGA9pWtcLSq1eYUTzM/m6UtujGGrSMF+WJlK
-Dth9oix5UcfqG/KbXYqCeGg0X3ex+EEWJApbGvA7ST3AXMnQ74RG3KJvbXH1+kHG
-FHCvIiRmbNSLm1NA7hZ8zk2Zeb0HzJl+jrGdSY9UArlQfy8ty9+lwCoescKU8Y0H
-Kz8XzH75EnOKK1fo3bXkp7yxN/S7VeSRp6siA5OVZn4Ah9ci7mBqOa9w5cuWwD+D
-1bjDjpQ5nWK4V9kusboZYWga7s+NuydeI2Uu7ioXN95QltcXnlhijgr2idUE4Ugc
-bQ8DMWrkqzWk7ltV7MNuUy2gbrhx7QerhhYrDSALfYhr6At+q8myjL0pLq8P1aey
-xurEcmsEiDlVmpxh57aSDjpD63PO96m4FGonPgPp1guPq2FfL+rybv3VsUJNv1+o
-I/KhivE0Je/FEBFO5+DjQBI8TLru7+CD5RipDk/t5AvYad96oGHBFDt51v2GUQGF
-lcP6x40wFEwXuVM545G96Fwmg2TnJoUHwCOKjWyQoFJQoY7NvFVX+Q0MpCtg4g7Q
-PUnV3/nL9aScAYFLiJvjR+J9VMbwGBVB4xLGcOvPXMiYLe7kSr0Suljdc8yS2WX8
-WPfNRx5qbrKS3wfRP4LEXFJnWsuq0uvWfmBFnZpb0pH/hgVYIaN4ZYdhAs+zG3SC
-OpA876Gedd3F8hrG0eCs6GIqT+tpE0sveSRdgW3/xMJt7bROSxnSMlPGHxkZqe9X
-yAEoNrAXwglhpqncsWhz45yTJ+OWF+nMGf+BpQwnKyOfhR89+6XpFJMJkQhPRjWe
-C1vaek93uZ4EVSIV1SF8hFI1LPZse8t+r7geVODGwyFp1fFkOckzRD0fLTAGpxpG
-3oiPOvrD1u3OsmD8FZ8y7FQmBK+3HIWspzG3mn17VHoUQHfVrp0V69UAVFaz6RYr
-NbBFZsftpHWAbcVaA6wJo5Uh6Hq09qYPVz+JAd9Ggx/p95nX4Fh2PJGcxB9dAe4Q
-0VTH2o2asTEINnw5WAsTRvl3edi3zP6XYh7uhwVPPnXlz7Bu5woDrC3aSw40+Zkj
-c1rpWs20/p0yApOlRCM1posTCirCzCAc3UVKfUhbUzWa6L5ADU7KHNUbe68nua5v
-W+FMnBai13bXrsRxIKjdzQNKCIi7XCFf08X3L4m5HX0yzak+PD/lZwWugRkEdyO2
-FznlllR06qpn4n1zIUzvJmsCR2pCdSLsvHZ3nAmLnfcB/R4sAz0M9Fz51hh5lAkc
-7ywMlYUXexXYVOWfBCLVta7FB9u3v/WMFATzsaMUUcxJnZKaukR1mggDBRLXC/ja
-ltctWx0ee4l4z7hP7HgbZzswPutTeulUzrvLSxzC9EScX6nAZ6Crr9015JtlO5g7
-1MM1PpPj9kZF1sjwqUGRv8cEqwmrnEsxGSLQCGsyKGYt1QJYSYKFmWQ8jnI8LkrY
-fzarsaCG53PRWGbVxuI4IH1+u+frUxF4uNuq8TT2pEh2fiqS9RC7uM8P/g6CHGO2
-EBAMmGt/fZ1gt3gVHSPGQglVKmyJk8Ohx2YxuoxEfki42vPDh6x6S78nJFC8FsPw
-0qx2DO93arW003K1B6smMB7ZQQpKLeYojB9GfAhcxAZAnR+0A7OWBAcPaEoZ+pTY
-SXbBhD0x0QpLhH3ajAtTQRdcuP/gO1/eDhd4AAzPrFGxBaIHyM0hsUES3lbfUye5
-QunWyjanyuKu865S9byz47JeOTo0x1NVv0s4zFqgul89xKIQOtUeE9ovuKedQlmC
-qPyCzoyGsBlZQFtJjDWEdm5y5cuho8DAhMkneGGiQo7WfL+x9n5ng4H8rQ6e7gwP
-AfZ+wtIGtoThdGL6/uuh9nc3540dOJnN2fumxi4QpvS9/RqzCQ8r8/aHmuiZGW+U
-/2qjRnXNxEMR4J78GSsDMRtzjhxzaYXNJO0YlfKwplQFTIcPcvxSjEVPTqufZkVE
-HGqk7Z7sctrycgp5cvLB1ngm9cMPhNCKNz9jP7l/zaKyGuv/8KVf3dE63eUdu6ad
-x1xp7CkcxJOMoQleOB3qHIXqe1ir7ruxOgHFWBcqmHwChSGsfwIpIVLtae27uwzc
-NxA9ead4RG6krZrgUHKqA7rA+xLC9rzHrEpBYzNMVSN5O5uT7JJgnSSF2XQd2MHm
-66NyI8Otdv8GQ0M//LLzNGNSzndE0ubE4e17K3e2ETxuOWaG/o7dBsSsND+U7y6B
-ykkSGNmg19/RtfkZfPKAQstWa0GrOV44TCA/xsUfb9VDC+/Sgb0ZIJstfaYmMMlv
-ETt0d3y+bBnWcIppqnrUPRDt4wydS+Ml5tp4oNhgl6GZi6D0manrZCM=
+G5GUAKwHeMM5quPQkbXEnOWm0j7miCWE0GKX8LGjXhlKa6WmVu2psp2E1kzK/EX5
+tS/FI+gHWGL2FgSkAAGHHLBeuNUWpekNr3ft46IsIZc6q09THe0BW08oO6QAWU+w
+pvP+R6tMtA4UXXsxZ5kTq9pxSAjWsYo0lV35wz6MYfWIRcw5XNG1hn8PpXk+zn7D
++tUjobzKtSpW75umQmdTH0XG+IyRklicmX5ThYUp3e6CVTCEjDVj3nwAi8WRvpYg
+KS2vQHkbSZfJVq40UxjhLom0P9Tk37W5sf+IjQCBGULLTuu4/l75T+E4Omq5/6Sy
+f3x9i7Pzg547lH5C93z9/aSe1P39q0/nwOFHdr/5AA7lUCwRE+uRgfs3ZKYNAiic
+rPMPR6qvKvhTh4GU2mUH38NtPqCoODIB2n1+R+bCMjfc5T+E1YIa14MuAd9i8C8H
+fBIJCcMquUcKy7wmW/2H94Zh95VOavImkg8MEO7MFQ8se+mn5MFcNoBFVunVe3Vv
+IvNQL8N1xzw3hjhtXaR+mNDcIT5cMnSixJy1nGSgbNpSQkUHLa5U/pRQF8WS1rZM
+vUo9JhpqaJU4lkXx8cRbxZ7DPMWZgOYrAxt3znPa+RbjhLgq6KNR3qivbsekRa7b
+NN8HCAvSNRyPJKiZk7ZbUduanjb0g6GiNXPzgX8wygdjfKT3g/dhZM5n6Vmsyc9M
+6wzSMhFpmAqy78ZNjHlq2/rCUGNkbkSaPNYq3Dl1O4mQ+hIRDRSK1cytUU+v6niR
+zrDtzluOQN2CergXIMpssi/YwLjJ5ik5HpktbqYNHO6vBM3c09w0HYAMCxPscu8P
+oABWuoLQLslThe2j1tGYdFcq1BgIfF8VeHcovVu9fx+VsLZdrhPrqW/hviC9vKDq
+Mfn9X7Q1VqiJkMv3ujVcxljHI4Cdawizv7NgeQ0xh+II0tsHIUIUs3SvnAzx0+3C
+3aHwz0Mdtfvs5AXs/GYMzvq1eLIx9VwZ1ZmRTMb/HtbNzOgs0FSIsOez0qbuXPsJ
+zb3NwN0bAOg61M3tRLYD27FvrolE8X+jbpqJEovqppHiAekE09WLvIuHdOaxWMtA
+YXQHv8WwJe5Ul70snoa/G2bamA4P2jbhZc7M/Kjs/QlbP1pj2T1/jjM8vE5dBI5K
+h5a7qPKQkfaY4Q7zKkkV3U6LzPEqhCUe1oZp5LUuPpRl1yFgRUm+EG8XJQDFIraF
+/jC2FWdChtnTOyglF9cnM4Mx77y6SEPennYaA7jVLa4w8OOXATJn2GpNS2O2vKtQ
+iKveHherCJ2XmSUVri4TfYXYqdY+RD+oG67TQFOibZOPUU/01Jb4UKsRaBcxyp1L
+E+2q9WSKB4rlfIS1xGUXHVt6SGGCpTua3BRhIp3AtEJuQByB9vI9oQ9ZFlkci0/K
+YEeKASTH6NGwSH+FeEkXNPllfLSZ78HmaayJAyL2rnzQIYV1xo08zB5QcfDgCDb4
+0N9GeBZdtXuFaKR7w9Mi7z11o1QQamR5AyePu1x5xLqjCbfv78B+4OrwWnZwHdvS
+ImVJ++x/qqTZULj7kkY0HhG2OOFrzh/Lm+MW7SAy2HcdJY0OmAwxO1eodnELNI9x
+QXN//h+UiRUxD7dx/ldg3fCTaBi/HY6tRgZXSNaYNFARDJEjF+TtC0qApBYILm+V
+ELLEYogmtZJmAskPv6blcijIQdddQnSfnIzwZcyAf6BI8wo2fPT5U7EO2bkEb6lX
+GoTPcSeLUzmspX6jdFn1GYNPwJjifV9AmKYw/iPo9IdqBQwXpvlY/hQ0g468bGc8
+1INTDTKS4gYftMK8rKSJmN0ZAc7gQTh255TtyDejPYMjzRfod8GahsdFDZ8812WQ
+V1ROJZnjaYSbK3AkqSzR1wFjE+fU1eNfgNMCilvs/iNrRD+UlyOnWSPqCtLFrZI0
+gFiyNJZhKkmND0HRbp8eLzo405aZNJ/rjNgnltNH2eJOBM4K0WiXA2yK6606YDBZ
+TVOhAzb/PVqp1X7/NlyfZbDMkYerF9kY7qqet6Nsfv1OkldeGkMgMOtem5R4mQAI
+ndxkwa+s84IV0Zi7251yUWyhnZMA1y/oE9KUa2nw2bJcF4ky0Z2KR9WiyLOx34WC
+k9uOG/G0P+wEcbYbcMQVNmvV1IVtA8lfhzNaGVPbN6XyC1do3gV7kp9iMSeEdAWc
+2Z8zt7UXpW8cyslYbSWoB2ScYWwzv2IE4uS4Mcm68apA18ViUAoJ0rAM8UOW7mrr
+++ANut1ALDpjt81kEeSi9jGRd+EjAIicrVsxM6/2RDGu6FfqXJTZWtKw8GlesDo0
+fxbSrt7zkptvdUZQ/7XX8+qfVtjaQcvOGPpNYuGV9bqgA/YromBF1szdFFlCby0x
+DnAkKpJcWAYQbHieQX/x8KjoShVl5hiQBFdR/JLU8HUIx0KtThbBxPWwO9goybQJ
+gvuyX5HJbivR5hmy2sTKMSHpbjVLyLxUDJEJEvU207bOKLkLNdHdviaRQBzn5jjx
+LZQaq/4MJlx6oMmbZnYp1+MhWtgXhgCVA9ZE77zD3rSZol6OGQOnBouqwyAdbcTi
+NVCUVq+4PdSt2XdcfLdvg0omagqiBtTo21jXsksvgF/5hYvXjTxonW4S50LvMOMD
+PKYl8AGhEJGGGN+0Zy+0qDeKOJMWMf5DlRGL1Dk2YNAfk/ZSpACFmJ+idQOipdlT
+LnmMi74O8Mh6iuLFK6+MyNIyBThSmZA8oM312UaeN5TWfI6D6o6HVq410yThRbZU
+XEcOuT5wCQ2b4YdyksezO1kWnLzBykKz/C4972eY5wijMJ8KbyxDCVcQsA/nitFQ
+B4Q7ewcwcbCxAWOOxKNh/RYFQMI+MRRYx+pIf/3pL+gNVwWm5bdjtcHd2VAGVVer
+izQFTLVbDEqVkSmm1dJ9PpMYorLzkR4vOkq3jPQaKdy1qfwf8KAVZG4uOrBpbumw
+28EcRwUIvlFpB5g/pOhY4tsbicF4QTS5+PTolk2CYHMcyo5qwrCEIm7AdlyukzHy
+dxA9MItAS8shvlGt4RpOTvMgYU152HmaYdUIUTbVGY4pcXav3vALseOF5Lq+9dJB
+TXMg/r/O3xQ9vGf7YUSclSeSYO99yedRIK6JwBv6Nq1FurLVAU6RpCtwR0/Pdsqz
+WUt6+9KYI2/t25rFNs6UsKceIYiSeIOlt8/76fGBp8zAh5oApk6o0J93enN+a8Fx
+uQ1OsGVIjfTYIaoOgnYbGPr5orrjcmbXnAKL86Rd6OURhPOPBHfILlzI8BF2A9fH
+Fb96MtZpxKR4zDW6X1zr5eZRKhcD5Nit1xoTku77D7ZYqtwkpkw2Ycp+MY6gd+TI
+2+p+5oxjSedJgwj9AU/kf3W+m+imzt6VnHZqj/Xg5JNmJ1luu2I5bPvTb+nbUWhG
+VT/DkGzuEnBhMcQEEwpxVh+HrHGkjaGnURytoHlpGzlmYhJnS32iPlNBS6+kC3Tw
+22VKf3UyQHTK2nlaSAh3VrS4rl2bUysesLB1wpuhlvu3fJM6fl1L5yjUYXB+22Z6
+1J2fr/BEKY4f/snLS0Ha6R0KgVXznbJpfh4BfIWnopdUJHCETZf//t249eUcCZz/
+U+IC8i3XlqcBy1VEmaE9hIKmcHmblpYQVrXIdFHCoKUz2fM8w4FkvCvLfDTYaipJ
+kYdktVZfbzXb2kyQVkk+uLmSmg9eigkPik+kcq99kxFKGZV7N4vsIZgmqy160nLg
+v/vpXvXDwicLwNtGcKTRrBWMSIUT+2L6/mkjzvEUwloQ/fz81SOQcH6Gem5gJ7Mq
+S00OfocVtTr8gXVExi0nRxnNmdW8CNhnVHtDZdXH1QlhURxcf1aeO1L+tlyH56rQ
+qLkUHpIAyp1n1LEpAqN5GTpTEcLfI4lvIEYT5gmsLDREELZzM90dNsfBGlt3MbQD
+F32+yOEJAtANNzp8Lu8pXNr490MoVmZ/j5UYZJS9cOeFPerOB4IcZ34eO8n2cXhC
+wbEsRpWjeNk48UeNTWwflH7zgyWmhUDeB4dJHWrOC7LBqFF2vBIxrxOObWWdwwHg
+kcjEBtY8skwCqQWUA0yaviEyL4afffV7QDxDrDqceC0KGlZDGkwMsTUPjbcp7kB0
+K30CJSGknAELl7luHTVeHex3vxOgYDVpYgjHGcgGxD0tpZk6CeqSaa0EOqpD75Py
+uumAWvfTH22NrQhQPnvynYwLUYGHLNqC2EgjCovKd2rzCmCIwc9yhwS9XYa0na/1
+XFfc/bRjZDZN7RVDE2kqRzc4SWYyjzJKRbTMHuD9u3qIInkF/uk6/MECxsiDOmZe
+4cuEX6bbGGy0In3KwszLvsr13BsJTOxnr80dTcjh9YJS0kr2fS8FiPLS+yF0iCJZ
+JAcAW/YdycAFLpgi1N6IpF54rI4nysUbgz4ecLgDxfGXuWB0JSs8EQC8kz/hMKOd
+6nDX1jJ9p/rzwXiP96v/snxjF1jdoQ7P6DlEPrO8K+eUDZGBw+JiJyb9XvXPdSNM
+4LFVxqOOBViRm83uaTwYA72BY7sRirFj0//IxF4DN9+lB46UbRheN+XhVHekkHdF
+BDWGk++aFXL0GVWWJZ3/dlIMafVhyXqSqI32X/33yJiBOSDumAHGttFRr6wxud26
+i2RMaSH1GYlEqE6QIu/h9nwA9jY8OwhMHsKohLUUWkNUyCuIjhW8u5gYMgLL8EIh
+LJrNJl1WjOQ9BEY+/EAQ35rrAAcbTkwh/chlHOp/46iu+zlj2i+7jcoQQ8eEdsXN
+5VlzjUpnYzful3U4jCiAahHpjeJR1gEUC+jQOnGLaczxzqCLCKhBYvCwRb3dYtWA
+GA/FBoEfTwKu3ZNvhySIntjd0EIZfTJkwhGw8+b0ELyp1IXCDRbvSAceBOSjgbE8
+Nnt7bL+EH1d+QfeXxmPjDwdyt60kqjxTwC8fZ0TxnMUH8nKSjXkwcn2cdAaYZ2sy
+V0X6cxBkBnzZY6nPnNyN9cbsg3THz2rm29CCIzuwEoEOAPB8cIL/I96FpODAusBF
+tHwPQ2gGKnrBLizdvj+Y3kl4OFUBoyCDAsyrb1l8oVpgwT4LjLwtBfDp3GIX2iwu
+juARIc4MpYu6WxXkb3mJOpM3KA4p36SF7n7CXuUnpxwiAys6KPtvE9oXV5rSDHsw
+4N5K2MvrFq4p6FCClKMtVKG5U41QyFaz6c3y6Y2Ui2S5gx0ebB0M0KktioO7f4Tb
+gYo+kOQL24pAVDdIBMhpJ6++K+UyJ0VijzIw1eCS5KxpVjM71qE2e6yvhrp9GMTd
+EnlJndzVHYqVAH3vh3yPpqaJJyZVDRE2rjSqd/j4ObCoWWRDWJXolQcr8HZ+5Q8r
+i80Db3g8BoFltAIt/5GnkjXaz2RjLTftvESibG1gWz8copzuf9mC7/vyWL/Xzf2V
+77RH3kj+8Lggos/0g3QKhHry5XczxgoqiRVtRHx2JaHWnpFtqQC5Qo7pu7LZwuxE
+4dmRbm3cfegyEO5ioj5nhXv8tEBJb5MJR1bcCmGg0MnF9XnHTP/IhSYA+1Fr7rf8
+rcKrRVDMPhVgK/vgF1ehM65PU7pAfwUSJhhZl65bcxhfWI0Vf07/g9xba1bZDaym
+hfv34Hyc53Rx4+PUMWvcxEIYt6S8EqKganG4X9BXby1k3ZctIzwPCHQ1dGLZvIlJ
+seFe1dXSK/15KV7uPwZz+Z89J0uByQoj8J5xkjPsjpm+q/Zz3lj4XcgPY41ampvS
+Q3EZoNra4Lex4tMvKLHHMqOV2vdqNEvuywBYNaWrkk2jtm0IkN8Pcx5f0jxbvYzQ
+NDdEdP9vfz5vMgDIZ+z342V7LPX1rP0dhWa9vMPChLEGRlQcvpTg9e3hCo723El7
+09MX0ChGMjAVBBBCGZn+zBY4VpJ0Ygcf0CpGUVZn/UwIcX0QymzOcUAwOMcsRHhA
+azoIgnPew12Lw16bkZ1ruX0RGWYgoVuNxsX7vSx3BkXydIMW4cGGeAUlNFYhtqmG
+TY5QuYIMSVYoxaTVNZEq7o3SKCvY38i71WykqbjqtPGzv18HUFm1qB6FG+qZtG6j
+5Gw/4uX+aJd3b/oJYdHLYnVdNOWf6oKE0DSRPb9ePc7WmNpiYFKfblSXzbJsimVM
+Vjaayg3E5GawKfSCKlWq/pCHFLaZmMvOiIGVNElPhK/rW89uYMA6I1jDsWuVqOaN
+g5VgsM0ErK3vMT1LxUh9Y6FFRV8WVnDDEouVJI5L/IhFDa7AqRd3Hnq4ItcknfXS
+LqbbN0j1HOTtzSM4P8PUXoFrKi5dW0zk8cZJkaHW1tXI5JCylpiM+oxCF0snEafc
+PNNIZoK6NOCAndogDTIBy+T3zunrMHswORwfPE1Xusp/5qHLh0weyBwpwdsPPyCg
+sQ9W3cypgN2oKV50VPZkqbs2qORuU7k+IvmmpqY/bOF4obI3MtSGwfFntcsrGB00
+aiLJEX2/DmuVZ0dRgNMd9qHj8iVbVL8B03UANja/tqa84P2xFOtBf9gZKuviDdwC
+5gWNIlJ+eJ9m5wb5/BZXvUo8liGa4uM1L/0VBS1KpTTyGiNq1XVM3A/kIXTdxOLr
+B8qHYPhxHawFO8sUe2smONx0q1MKC5iXi0sg+DB64kmHOYqqhP6woRundCJ02oeK
+3xwOOPTjKrz0qFplieuGsuv1AlbJH21+LVC0PWnFsydysivgY7IPEFDfbs3U6M3y
+7YuAAVupFeVKo1Q10YPC8euZHudmy+bt8xai/HKTTA0Zl9s3NMhulm2aQHIUwQ13
+Rmm8rcoBwP1Pb7Icgozq0/AItck7q09eQjF+YsuMlHxy7nHZefD3tGzvoZZa4v6Q
+jpCTSHCe5OKJ0mKBWOZ1Q4a7G2GMGTXiTZIIFXtIyRJr+laLLG9lrcxoBmPf+0uG
+P68/D1hI/R0lxzf8l4/nEf6FlAz/BRCPll+a5uG/FErpCxWk3BwryPxLwZ3pxheJ
+OYNflokt/vplU3AqUTyrVWUSKRg5JO1LH8vZGrl3F3CfqXORkRKIiWjJ1ysRm+s+
+RTG+tibKHh65k/r5hV/RQ9bq6AzSgT4vwN4ZEd/n2fZiXB74JlmDnHcy4ynL4s2C
+eEPkw81o1d5Sjv3Buo8zq4o6Id9l1S9uVoj0p3SNG0Vhm23AYH02xy/tY1x/BQb7
+YWVKS+AZi7LkRQOrbfvN2nUuMl3n+2YdnyjEZFPY04DfSdoB5kqGBix04jb51ltZ
+r0FlTAH3BmQ5Y7dn3JoCSrcQcmnCzNt9MGeGOcd2Id1TieRy8722rH+Xk6sEhA0u
+Exp3Vn4um/4KJQ4nV27QTGzJT3lnb+h3E+S5uauqB1OUZn0AJyAj+8EZdbYB5uuW
+wP8WVu0WO5fodInh+8l2yxUGDmVdzHlpnE58BGaubCs5OF5TlzcHXnpjzgqOiUkP
+8VGcjxADMYr2qy2kHlvV1IfDplpE3XDj1g9+H62WOlJWuhCnqCbR1albTr2pLo+X
+CgZOWOYvb0VBHM5SdIaD2woe/AqtlpwfU3Et1EF8BtJZVI+bYd8uqgG8/uZYoabf
+fyoR0+5SeyGXD2KMiKdz8nEsix5Ob/cP8MFyDKwjULs8BXbZtx5pWDHFk6BNt3FU
+QMG2Wv+8Ea6UqRlAlcQexV9dy2SQvLvB8ADpiHIjGySqFFSohTTv1VV+AxPpCph4
+AHQ/ecl34XJNMt8Cwjno4gyb+BiVOTxmRdBJhTnc5jNNPbNPotyoV2IXv4TOWTC7
+zB/rofncTM2z2Dp8KfpnkFhL6sM1e7JLDHe2EUilbZd8ApiuEFuSx3fAHeVYD96n
+/mkV9B5agzyrlTA0JyhHmXpY0UuUtOTl/eHO2mF9xgOgQ0x0OtnlGEBwUi1e+Egd
+WZkHdYQobHNFM2tTqFgWmS9uxYtQ6yj2QcvoZRm+BaAMRFfnabagVKXgBa3yRtg9
+q3/EYPymdQJT0ZTorLXyP54Cm53YaMuDoshRCDmBqw6kUhwqvCZpNGnW5ArCrela
+zaUXmeMxrIiKqtoanW9HB84g6UcLFFnmUMg9oJzzaPm8eoPTW2lBw9K6UYCeFw7O
+0rFP/WnzZE/TEFb8473+jkeVMhmlS1fGp+u25cFrDBlNuG0jd23SFCTnEmAfpSG9
+lCBZFRNoqymPZzDbOU4lgwAeFosrpJGVH1P/te4qvQkVGY/nNx5OYNp6v9tcD6Iq
+0ZLrEF5BqSYre8HSZWCgaT2uwY3pJdIS4vHGkgfZezm4w5+mahz5KH+UqGDctBvn
+rPGvJMvwW5oYvOkH1NSe0b5Vjt6jFakAumv41TnyuhGAypqKnb1nA1uE+lxjWAfY
+jH4bYK0jKkNQk972We+ufpKEjs0G39MfMh/iwXOTWLQaf9SI5gmiad+2G7VgYxDs
+O3hgThjnNdEV4Mii+P+S9OG2R/AUUo0na1NtuwDwvumgM1KGak5ubKMqhtR+bk5F
+JtaYI03Qq+MlFsSZQTi7dp59TDsT1aJ3P0GTWMo92Zt7r2q+brJA4cycVKLHtqdn
+YkmSpJ1yj/oEyH65TtOmzvRfEpdlr13osq/2LE/lWYFrYAbR3Y7tVU7ZqYPk1LV3
+5d07W0iN1bof0n5xpSqlobPMlx+70qXdP43onBMF0oQyVNWDwbXtzkAawRzX8hAe
+EbpTS38VjtbYeJyjimFiXRZ5q7civ/DJ1c2R+/ee6JmY3h2XaWTvVcDIHT4KDAM9
+1ww5Rp4CCdeoLA4tApkE82VU+IQnmuqIgYTgk6/YeUDa6/nEhrqSSIOAkfyzj/Nt
+6WCa/THJbTv26hBmX4uxZOoKoZULcKQeaq0NdBXyxdiixrcF8221vWjs7fSg+gpI
+54FSSsNgQfOvM8khogEaSt/CPSHaMYxvbeqrojutYTzCaKYiNGxt9JDWI0H2XaIP
+Ozjw9udDe8Z6JIoaDTo8jhRCF1ZAGRCCwV6wxNl7NAnNgL8fzMcMieW78APRFn8B
+o/TRnXRWEMPph+PslWxYWk2sIFVTn1OL6nB7DgFLiYoJOu1N+cVnizz0KqidxlWx
+Xc7JANISqdMYacuPlrX6gWFmHMWuvOlrdthk14FLYfesM4hnneNoF2I2PtURxzr0
+/Mo9TmB6z7G8VErPQDc/WdCY75btYO6phmt+Zuv5iYr8A+OL9SP/siAmDfwOkb5x
+iEijVJOLX9Om9roVFKxMNTHhuiOgKsWDhp1yDEnTg/wNPwrWZvTpmYT7X52OyMPj
+VN0Zs5cptfNTE1mPsUvaEW8lCOL2qSxYGTA3//ISYURPXyjCZSg182EXwwdLnoxU
+XEGiPCReJSTgQ/xQoN8LFkm8GU3zt/nRG74+pNWag5Z7KPgZJOQtUbA7Y98+ahhO
++BBpEa9cLT+a0lMbCo4vaLoS+Tqxs6wJMzsGhG/wHjfjXCyoCbQf7n1ni2vqE3er
+CMydRYtEL1kBx8QuAnnv2T9/nCuUrv3eNMnE1VXuGB7vbbl4EIL58Rc1tSs5LVkc
+pAEOPem5EDq1HjPKL6T1vIciFzzlU5xfm2E3soLeSxn/ZC0v3MaXk7mCyzczD9IF
+R/XEgdqjRva0nFc08u+seb4zPETY+wnfd9g3nS8mupdfd1W4U16u7MDJkeXeN3U/
+h1JK37sfcelUz8bl9p/U0ScWvDHHoZ0atTUz91WACUPfslIISSw52plrK7yYameN
+l8c1p6pgOsuRMwrkVPSUtIZpfv2EsYYmq8lTvh0nCQuz+xDsH3PSPnxE8K1682No
+lYfXIioblvkPN/30htbpOm841R08emNFQ7KmNyt1/cYrQ4KCdeEyOEnX7TDWXcCh
+oKbDZh9AYQgXPoEyHRAdrMel1wB1+3uIOn1IEjcyfgZxLDkRG/P+IynB9kokTaSg
+sWPUaiOoXV9V3pNgXSTJkdGe1MENo7PyTK4U7v8zXH9++cvB09y7uvQBgVoSJ8f3
+Wu80HJNAHj/uH9htgS7NWIX6hEqgcgo3ZjYY9XcMbT4FPzyi0NfsWtTqICNO3M2T
+TPHH+9nT4ru652gGic2MEatTevJbTB2GO75cdlLWeIo4hRorAInHOEOX0niBA2Ue
+KDZYw5BLIUp/ru6dbAQ=
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /locales/es.po
@@ -37110,194 +37121,205 @@ Hy/ctGTkY8Spjz8NIOoAVHUrFTUR+mKgfIMA8LRcD8rXi7936kY=
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /locales/fr.po
-Size: 39870
+Size: 42979
 
-G72bADwN0GPDXSpKtMOIOpoWy3VwJS/9fISi8bLU6diI4N/SLKP0lR1NFdlyvHcS
-OTox5JcEL0VoGug98tQdZba++WaIFrufrfuioCCW5x2NnM6Nytqqbp12OF3Ejuf/
-vQHr1zha9E5Q/y6YZFuaS39GPYxYjtO0fPSXXkbqGdW8WpVbiJiZpq+3PEO3IjtN
-KXIp5c3Dgne6gBAtiBrn/7UmDaJSxhc+/b35PATdVCe/NMBqA3QUHen5t1k56xSO
-jdjGXICo21JdETQc/49xjqmaxet9NW0dQipVOhR9Tp1cu2l0G/7O4X8QwwBiDIKn
-0YGgEqlwQfE02rfv7T/wE6R5cUDypAsKMTiHzpVbj4s6pFg0bjrauSj9GKV1TdOk
-7+aeZMQPERHQ7O3VfyWavL6fFMp3py/aZlcXXsVd/0rb13ucwq/00Db/DPvXL1O3
-it3N+ydU3twBj1O6fO/erOf4X/NfyfPnE4pb1bbrQx816+69cHATuK8AdN+Fv/r9
-tf9squ+nZmyDnj85gtLkV2FEAD818ysi3szlnRx+g4xMWXu2uy/wZfLXwpEtlEI9
-lj/u/G3N6nkG+TX1a8KmI7fFh+7j0Brlc2F+0X3xEFJ0Y2d93PQeWWr7ExnmowY1
-GLjJdtd44IJifnPzlYXGf7Sz+ttzpPrWilrsXfDRy2MzlKjdNcjq7/6kMAfNDOlP
-1zddWAuJyy8N81u97HaJe6vLCrjul0Hdub39O2Rj1UfrvlvsLnP5kec/P+jHyfX7
-4x1+XzufdL/eTqc+LlbxGBCM9mI5UgF/o+NPOOix92MPJ5Ys99BRkkYLaLCp0rjA
-DJTIxRHf3VZhR/+3vdBPKRm2jitOfQSPVW3hyE+WOj67LzwQVfnUme8KP0lfB3ro
-lRGYbak4h+vo+HwLOIlNqb2rsC/tSNc0B0wCZELY+ZEz/tUqsgyX2u67PjnoxeB5
-jjGdKBPqN5/gKHUqczvUqXHoIQkCEkNgWJAMBQn945yiizFIjFZGUk1trLCgII/V
-Piq9dv0xcobSwPa1MWpOX/2Dlbx3x+Ay/tTEFHZjZtGQ4J2ey4GG90NMunGf0z6k
-Fjt06SKGjcXcDK2M1QGa9MS+juxgn94wUZ7Z95qKE9Seb59v4ugojl8FVaC9HvvY
-TPwLDGPWMehotpqnHhtLz8xgFYzVfR6F8Q1dHGp0Vtdkrt3CDM4uRCcASU7BxGQY
-ys27eO8OOdQoxk9IeQfOYdj1y5GYJye0agKgUNCDtaQNzxhvOVX8uqmZIBj+jPuG
-cIiHKo60M/aC6qVfwUwLB32mJij5ZiF7DAlJUmKu3i1XHTAKAIjv2SegLpE5YK5m
-V8NnZYQldi4MJcaXlTqe3RyqV74zdjSBQdkDji75/zEYMhzhRzfHqGorbCl/qSUF
-XBMTxhqCOo24ZX66YML8Fh8TkhTP15ZMJDtZ7mt2Xm13U8vHaOBffx99Yi0ILIiD
-EYeGurHu7HqWUG1sIX4kbY/ZavoaGe6k6qhVULd0ycRsk6jEmga0lr8hRCaTcjJ3
-9RKcGAiqzYcExEQwsNO7WBC0s33Zz8HXI2kLj8M86uLJzR91NfShxvfhTE1gbiSZ
-MczJ2Lf9f8ZgDORiV5ASG+gPbiugIzt2RehY8xEksuuavuPNMw2QXblAsy74b5Qo
-QKo7qONmyAR3X1MMtVslUPqLnvOJU8RgrvPkqEfSfC5NhEHhQYDhqXcwp5vruxUh
-d5kXUgMD1yFQdN9d6w5gtFw1Gy4D7y2dsVFcks8r7FYBI40Q6kWBB6+Cx8lYkBDY
-RKE6NDk/hPCnGtG0zbZeHycR9zzXAovnvM2aOntbx7MXDBgjqHPdx8/N+xwY5bgm
-E3lvbORSNUS4GsfU1dBZ48yX9UBkSqZr3L8Vs2lC9rq2s70F/rqTS927kob75JS9
-HTJadJ7vYjbZQoYxqLGkatgvBZMS1zN1yKBM1qUmfbga3Ap04N0Jir+QQ14U/gJz
-tDkAwRN+JTFGlpFF+bRKfun2FUd/9M2qTgsTnUk+v8NeUdepR9Xy5ts3GfOHuJSa
-QrMXh+ns78rlr+huvl27/BLcalpoBDYtpECbgLnJ6gea/s5DdhYo6muOs0rdD1xS
-I6XBPc4sWIkHE6hCtG7rg5tQ/Agi2bh3SZBtojoVEW8bbWPBHCvtD6ozw34ECrMF
-+dWxzIJjsHsSP2I7AAHW8FMBHQ2npxRErwL7DqzyaK1+TRj+r6eZvnWuv3osS62U
-hPCq9q+Ad8Gkkt94ZB8slPEi0oSlgCoYQwVFMfuJC3iM4HsTAW49f5GnQAoEpZAt
-YX8NCQmhkMXUetOcyc32ll0AfDkO7WM5uaajW+cevaaHsjAEyaGKEnhNXtCTOCku
-4jibW0O9Hap/ggA6I8eaJWuklC0BaJKd7UXhnHrdnQSqqXgWdu9EoWYNWVlD28cb
-CpTcSaLxGRyzURJHgB+bpMMPUup/527WKreeCkXHJfwVdrdBElx5ZzlmmGnR8lmn
-wOOiD+JbjT5g1+CM5e/XFv0hdqltX1eeQ6JdAzWempx5oQtDfH41sCOfe6Ess70I
-PPTYXMASh/Y8tJ9ImPGaasg81mtEqB7FR4jEKOHt0owcKKk9xu9WA2PrfjRgo556
-pwK5OG0RdpG7qrBEy0qDKqSNlxrme/JYnAippTS6imJY+DsMy0Cnd9HRopQv8K2C
-90elAPfSZPGT/qFjPEnNxh+7C46i1PbPfm4hePDAQ9QwsOAp6XDCWv2SgsmsIyHJ
-Ws3umBXfFhghnWXCHRlTMwanAOkTTSuktA1qoRUnbFuMSnTYdcNpiZQSwqqKw2OS
-24MjeaI2chscC7NkxuqsBDBKJkIPkxXqNCcVzpEsRe0BRklHQ+dUQJNY9h52hdO3
-F6h2xUrPk962L8yEZBAdb0L5IM3s6yKdJFSPUU+kxng3XPT5hnDvWlJvU4N6ycrY
-7ZEHZn6RS/+AB7qH7JBJCOz4Ftob5NLOvDBOZnriQzenEMZ+HzguQEzTbgcnuUDy
-liG+3O+LUiQ0AqCpSz2Y7I1D4nBw4nkF4OwddJPr++9fvJac2n/WsCG9bDYIWvDT
-nrd7QAczkggsrfv739ZflAiT+JeQdJtWNiNqhERk4eRDIJuBV+Fm81CMr1IZoFD2
-fgA8y4dSglpF/UNaCRut5TmJe1iIKm0vczK4XxNsKov0GQFaYmg9n0r/eKi6c4f4
-Ebkdbzhg3f/yGSL7XEDIPTw9nDtK6J+xyAN1N1YsauKMXUCHD7Cfuj+iMnXpUMip
-Q6Ceoa4XO7jWbpF5NcTLXes4dRDbaEy1D0w6WdvGnDUmIpwaWCuNoqpH2ADz4xaU
-CcthXBzuPHCrBGNpsc61fmsIcM/Azd7HElZbDVkLDJ6OSkvw4zn+PpQKZ5jVh3PS
-qbvTvBZzl4MEv1U9M5JmqqimlZTlQy/zmQ9gCTetPSsIkvv06DVa0TT2bkUuajBO
-dHXCiWJoetCjjsQtEzmURjwYuQbJFKJMaa5gx81KSpAdMwAmTCGagNNXP8bxLKvc
-UsLEb2LsKJlXMa87bn48mEAplSZboAlcBnzBV2s1cnPCf/JcUN3fWzVnfmxahJ1J
-lpfTly0DzZVDhDq2Rn00J1YuTFhZjQHoaRTx7F+c6viLXaPv27EN45xORIJKS8et
-ElCOgyaMW3jjzY7nNIxeEg5mu35K/5qmDvL+ECqA6E2X2kv2U++laUJiUs6YukkG
-aPVuC2WFMmiA6CO8SyJS6ffAXReo6tlzNTr2I9XkyQJd8k8dYvVszJjLsUKXxq26
-uBUFUcnUjURIcygT5KyraQ5gXONzZjIogzCBbkZeUXmZS8zmPUTMbTIMpw0eQeg1
-yBGZlSOoKtn+4jhWtEQKMrU0fiYita3zuJT89TvM4/Vc1e0TmzgGTwluSNF5JM03
-lZNDvxqFHXD8QtVNsRasdBTNw+F07j5ixM2LPvpykQ7oPp6Vejpvc9VLegIgeKav
-IZ6DMXIiMjXiElJq7t6P6Ppw3AS05DbdhPmM3lyFUVoIQ7dxMKS9MBh6WmqdnTIp
-JudFJgR+yjH2QT21iwXOIlHUOu2C97TLelzgomIkb2ZheuWRGke2dimDaJ7KFFDR
-QUHXTQNilh9B7m+pZ39mgxUYD9Rej0j0+ZpM1ZEPmUJfxrcR4xhstPckZzEp2EfI
-FILDSGJoFk26TCnkyYZ2S2bXFlaOFEQqkOFDXxea2vwIqx370WrtgP478TWxTCtA
-ld1WuFCk6rZ7TthKwoSlFXR8yCkS3T5wEBbIwuvvEULLGCAFPpW/X6+jNwYn9qA/
-4b+VkoKUfNjV5NXtqLy/ITN4a55+gar1U5mjTVtlm021zs1VXTzvMf5arerfRiqJ
-jTGLGYYq2UbuVk7NvwdgxC8KKJ7POs5b58qiUv10a/7V7akNcCvZjRT/d3I6ODRQ
-RQqOQsNTjgS5dhkz4iSeAFXivRXCoI20fnvZy9iDtJtl2MiwtBegSXbT+0x0wJsT
-O4RSq3i53vLp61bNP8pEJnERbOww//teuxloNFbB2tY1c81EbwX3cWNSnOAt1SgV
-Aog56a1zAPYxZPoEMhYV0X9B9TPVkFtVHTHNIMbJ/7VJRNRqohDSmsYUdQzxmljP
-SLPKVJcjTWSvTaxJdWgbvJOn0ycvHilMv3XmHcnzvqnSB145qnf0xloSJj7Eq7N6
-xc5Th7XOav86h6gS/AVltqHvYHVDmcLjrUcxs4Fdgxz1mJVauU4SyiUpOOSc8R9B
-JCbk1XZnHdyht601gT6+msfni8+uktlSxTlqZ9sxdli91X7+7Xgq9up3U1iyEMvP
-aiY/IGTxQzG3g0yrIhDenz6/Cb5EIvowlEDI5wk3PQUNGs4d7zr+2JxYZHSQhSTZ
-O8AMFYt04dYLdXzcl875q33J5hukZLOyTCs8bNaWqLbZ7IktoX2tvpieNJLuK0S6
-uGmpL5w2NVt0n55faXTbnOQe/deQ1VWioWWJ++gLuMzNDLl4jUdyx5vXkf/XEz6u
-WPIhs4Gxvx6SBfnGdjllDqQCdm47HoUxpuc7ApjqVN47SstWkLYTJ1Qx7RMogOQa
-J3YdvXccgj3fjosCSAc6tHnHDSeawEPtGKFsfywEQlRW8JXzB3BR3Cs1wn5vTy2y
-z3bvGtnUMiJiRTh1zACldfOVFGrmgGhKnYb5Vm1oi5IZQHxMaDiFuYJJbnCjtUR4
-NK5xpS5oxwm+2iButmQOp2W3s9DTk0utr/P1U9EkbYx9HxIglB1PLdi+ncbTUIzC
-NAn7YohXcEQGr81ZcFqAPAPojCLNAzEHvRKml2WXCo+R0dG7XcYT2aUyNFZOD24X
-ZSE7bNPI569zx+nw4OvpmtAW2AWrB6dYLApz6x0ZpXMiLrS3NGEa0qZGerg0c68P
-Rjb3ZplbSOxfSdDtwhkUJVJ2XKZsfkktcrGYfSXuksotMClF+I2854GVkpDaVg1x
-Vo4BlDTUVLDeHwQY+zEyG670tLaxmrC0L1XW1KoBvPmz6X74sd9LyArtCCIJlSHO
-O7xto8eAaM9M1zPMW0RiTwsoe/QjS+1DLXGOlYvKBGNr2dKQNNtD2dTsxxBJ7S5j
-zRqO+FLgZs5n2JeCisUAc8xlm9YlhpiyWLjOlHwwaqXGuZMEwWTLMrKqkEXGfkRz
-J4ws5jdDw5J67M/x09ptWtx8QUMKMtIPuzbTemE7DSG1q9m9uKCSHTtbt/jjyNFu
-qqzgJDe8+gSl0bB6BWWbAtvkSLpWXvkCJ7zDWMPyyrZ4RyIK9GQyATTlyBvLPdcF
-Oy2sWZEaJe9txL5qhfr3I/OcRy2mQiNGdx3n7YdHcKFMKhUa7S3EJWdLhsLbCfEV
-JbFlv8aZQqdwkIZb8BwIP35rD0VqacUQfiMNnfjQI9jFjvHWjRBI8sZwCf9uVrBy
-uBd0vfOxcMX+zvKPMITzhh6nfZDpUCdI5X2Kshn+0N2BEucEM9R6fYLIdmn+UuXj
-vV8jF/bUYXn5yzROD44i6srMIGbeSo6SrL/Tec7MRdeq/uH5Rney9RUd5QVJlZ2M
-CX5Q4vybZivIh0gCaDqs8S1U8S1AelR7uXUsITeUHkOAgLsEl04HOw8YN5OkjQ5P
-gph4As008eIqus+plKbJPDg1Y2dJUBqf3yJaF9rjiGTzxEzLOic1XNHW+CIVhcaV
-ju0jsVXAziJuy1JStOgamJ3SidG1NWPtjXUXD4wfE+LP42mct97GwtQ88zAy0APe
-ZeJIAWHrt+vST9RpItaWYAe92d73i6LQAAB9homXCrpv6KEsY2nDCZvNA1e7+CDB
-fEsan2bELl2QEmgoAcs0Fnkl/MsGBx+2Lbz3TznwkaUJ+qzYkZrxsxKQVCBPodjj
-G7HT5Fqig+HWoDSVAt+ALKroIljXYEV0q/gxfzQJyqwIMaKNBZaQTzhtHBjwpfOq
-2IpadQnBm2yzvFChI5wbBg/L7H7JmGpKwiFtmy3G6/N9QcpS8rXeCdPULJskiyTQ
-E9b6M2nFqlaAK9ID00ob2v635EoZ4QzjoWENvuHNVNPFVRqC4A22EpoICdxSg2Op
-4K3Zp3Pz6zZq6ATuTCvySLrT6oeyKlAK9GoFh0KTykYECfB4a64T/KXsw6FU6527
-ptak7MRozgHspTQTEjLT6TGtFH/iWoGbLhQBu9gUjXLewOu2dWEPWSPRdOjXNLg/
-VN/nIn6L+EHKmQDiDPLeXmX+/Nt7Gfg2wntRLZUHwPlphFwBtXx3BNfc8rirjFGq
-/YHvp/e+euxF2Cvs/pfAGVo0mnpSv10Gnyaa1/Rj5i9OiwVwYLoUBx0+nvmrSNvI
-YHUmmRtzQwyeaI98ar/+eyJimBzzcQDSBdzsJWZ2M4fcqTYLyZCOark3eHoLuMCX
-sLX2pW0oEnKVp4Cjcz7SDiwdpDjR02ADF/6lfbMXQX0J5gf3AlScvEDF72GA1FDl
-87S0AJx5JlzGSvBkZz8Di6tAt3TjGAHtOQ/nONIK3fnSRnLQl+b/zxZ/lV/m2NIW
-5S1Dhk1HND80i0gX8dSqJyAriK7R1/YEQmp/O6gM8jFzeMfDyyJoytXmNf42bYII
-Oqc/s/dgFdr7pHwfPWfZc37SPCTfi1Ru6SG/bLYy7N0y5cyUxRM+ygo0sOtf1nwT
-2IGPzQAX2SytA7ef4NhS0ZNcd+JTkdLx5HBfwREOKKtKT3qF96SH6eSu5xLdvvHS
-Fwglheg4FC4OUOlt1BMcHJ7qVM/MvW2TswXzb64uij2jBtGf+NdYDXBe3h6wVqoP
-y+TkMZ6ggwPTIdZiIEC/WaxB1bLjFVFN8eE3D0Aj/IOMx1KAbB+qPRTbv8A2MrPd
-j+hmQnf2WL6RgbQX0sK7n8NCSX3Lg1K7zstrcgh3lfjKvoSPLumBgiRiLxFekQ5D
-A7MevrdMWLfs5j0trjicwgfSAX72Vrd2Td7aAzuv4ecShl6PNU6SzUbDeLzCxzri
-GKLrpu8wa5WxMxBmkO2uCQZkY+z/XVjVj4RCM+vsY6J7q3KC8Xh7I748u9rG/+3g
-n316DkDnGPz5uHiBXklt5wRMPQFpoL7CyYjjWUZ8/39/D6/y4Idd/u00ruXxcN14
-r3n6uNYTtzz29faANjzyOv7KIluFRLsG61hYTP8oyyHaNYw2Tw3inMsITVJe8LMc
-SJ4yvaaVwHu1FVg75rNNOBYHYXIiEL/5hh00NNwQnbrHqy1gNncy6Mf10KMs6B6w
-ioqEemSpE8/metG8kL8NLh+HD6sxVHDEMYj9Q7k9YOyUkQ4zQOnvTgTcqBJBEZsy
-cWsavnZ9z5ZoXqKsDD3oY/ymF6HyUyJwFm2/Et6fepdNy0vLNVBjUWpaNFZJ5vVp
-+qEcG/bfvT9A7mM39iRFOjPsBm1S1jwhn/piMCfmCovd1PRbzDk21qYRz11hlmkB
-fFxTIIZsaOOMIjsiNQgn+ezHtHhYP8Y1x6iR27MXcMYyXEloTeXi729jFBI1Zb0y
-skk+XttkBXO60MQhJz+uD+9NR5yc9OXzOmcgCuq4nEFbMGnWS7t+sCu/cCibNOPl
-BJuODM7w5SNEmMbd91ng4k2qm1L5E61v0eQD0cDb7j+Vg8xPJmasJBNir6Xcbbhj
-jqNv6BnHdhjigiwEOyx+UtHMXQXT2NHyoIF7OaqJ+C1fYiH9/bzLTk4PhSL1S8DZ
-MeW9nFSjQpLNouANSdgNLS+HzqTPSaTA8AIYh+VvXfFg/kbV7WjSzOtkygwVif+c
-0DuN/EPpkOg4swXeGQmDE3X7Uy6OdBTUloIYty6otQQ7QChoitsTlyCdXfRLVaHr
-1esFnK2UsHhfoaESREvoEkzOg21YeTMaNrrQMgZC2lcUrFrXEjMysX1Mj8iNS+mh
-ByrNbIk4LHTx2mnNjcDdM4ZcY5roHfxZElIxyHblUcDlQqZMU1Hse3IaNbYBfls9
-u78qy+b846COcZCeqbNuW5oHa1VOztjexLxbGo6KReOCeVKeS5vyMybJ21tE9Q80
-4V0DlJqlF9uhpfRaM8l0qyqLzf4n5R6Hw2Y6dqs4tP8rDYG0cZvyWzJstm2M43Iq
-hlR406UPhbmaL8gQ3Qi9BFlDxaaiGAPJJL6Q7E1GTju5iY7WPiHZk8z4mCRamYPq
-ScF2bNA6h2bZz1FCSG8fnjiY5iqayDNhJ7msWbUHePJRLe9MLoKd/vK2uJbKRZcs
-nPTNf9KJ3KgvoU23/VKQ2nyWk+5QFn2MshhcoMIYtI7ATfbjYe3vlifLI8rOtZBS
-+jbSF1QcFXbNbXdlv115uIh9NmDGwTLRJvgaMC5s62kJdailrStutvfORNpEPs2O
-PwautG7fBOnv/3V8/m9PWPvbTJmbCWCmO8YM0EvijRL1j+6bk1r+dwjoH/W35KH8
-b4GS/B3HQH/PwxGkfdvA/X3O7u/JOXkb8VvpjKb7TSKTHkBQXKmXXOcnwrM9IJWp
-fWorzI7D4lrxPBBflYQHqLSC6N6FSAeqEm2X7a9LgCMIQrEKtYi6n5puiqJrbybG
-gveFqrR2oS9kwzgqjzkJEW8YLzldWAfLpSBWTVTMLcGrWuaVirpGSZKzNperSkxM
-aiOy74q42P156JAzNGwXUYSsC+KsP6t94BKQpBYTrzJZEDJsJFIf6QBjpw7S7Gm0
-miz7xTNpDln8Z8sHjYylacgCFsCIskTcEhBV08bZeZodiT5sdzpCCXoNQi4q6WrN
-LGGFMmHoWYLiH5ks6eApUtxsW2i8fgkKVbAjbnno/ECsKtpdAB/He85dNyilpLhW
-Xtx3zoQ0m+53heTlnzWOiIMWV/B93D2pvLjC0aLNWvzpYH4atCJdk9nn01RZx9PT
-uWuNEm3FbYeqJDBtEZhGavd5gYBbQlGOTpvxPTqkm/yWWS3HumzLuWTUYp3omOia
-Gum1dfnM4SI7Q2WvS5i9hqVG1Kq5hCcvT9vFOIJpaE5Ukjp5uMsklZNjFoaaCNKw
-35t1FB2/uVUTL0u/VZhgatm6N382g0lpK+Hdg66LZt+GR72NVywVh/wj5qsTKq7J
-eEpwQ6OP1eOEplhLDE2onXxykUDSZ5xD/aEqDlNM7iieUK9BshCyn4jeizMLSiCD
-TYKbvUKMLEfJ8QE44HYPcVw8RhZJnPsW/xw6huocvSFsWlKLlzdy5xPFj0xnOvq9
-ukkjo5ahfagP4U+AibtFEtvKSAwuaLTsc5CT0tmLMbyv6ZCryGzPlK/Cvja19ifM
-yuFCBzN7Ny6mI3RBu6iMQYzNasCzA1k1OPkKR/5LWULG3anteOy17HxVZPxEE8mX
-IXkrZ/eSSPF6ZmK5JFsoJyx1xE6+ONCiSp14IxQHLgHAJyiu3oiFdJ08o/br4QsO
-Cm09aT+fLdWr4lEMm4oSl4V7Mdi7u4rXHOw+z58Eqni3uMcG4/IzSR4dxZySKIAk
-25ySL6Cv05l8MtE6aWKRrFnNlsRKDYGnyGVp6bfNKRdl8BZE3JYnb6uJ6tAWEeyg
-ZMVHdpVdzpjHROBFoz5BrByjqif/S3WerZxoa9PxBp49A8fazzCmvv6uFVa4Lg0c
-lYrTIEqiO0anfNAP49VKw81ZwQMQa9bcCzxlqp8mrZ/fNUUdooZ3xDC9bo/YIJLX
-zflJacvZ/aU6GXGWIkdHaU1sbC6KV8q4bNo0lR+D1XMEde1qlgn6wIEpNZhk51OO
-qJKoeRohPwAHFLZ1E+yfWoNmy3WxIeRzI1+84LMd9QWg6V4vBNkvn3oDJGkiFxxO
-KLCNVfXDZjqewPHuYxU7iLr6ykJmLn6avStT+8+8nql4no7nIgBxt16rVbsd8e3V
-x9v4qRlkUSBIh1p0pLoIqraRQO0+1TQcuXz1dC7BlH9Bd3us9haOTCYtyhvd4oMd
-NfjBNV3X90EhHUo0L39/e2AIU9DUHjtZL5ve4ZCwipUqWFztMbmQaOkN/+IuNqTK
-W2Tst97v7PlGOwF0UOCpWN4z98SPFurS18+1yUu92vsTP3rgGpYePdfZia2WPEQx
-duTUjZpOmN+VmrHcGWw3DjZQnNuzxrC8TdDDswBmBf8o1sek7KXXS+eHD/C2Rz3o
-mK7Zfde0GuzQlmYePJaHjSK1rvn2rUQna+I9IEjfEpfkJHdP2/osBStfCm3Lj0mo
-iPlNgmZQ2SuufM1P9TylkFz+L9qxXHzISNuXhZ2Y1EwBPlMTpJ30s+nrsdbbup+e
-Cos8juyqTQUsjxNijjFgFGpk0AvuqFDqOQo1UbNcPba8B5lvk5hxRCc8C8M0+LG+
-YGLwZvpkyFW89yAh61UxjuRa+eaE+b9qd0uPMJM1cCLnDMahwdkUPNZl+2laDyEL
-w/p6ute6SKg+/cmx3ZUrubradenl/r/WlwRJwv3xJtq80LsPxsmPPCyKUYAO4OKi
-KINU80pTY9Nov9lnkUKGWQSQIpPyJw43GB18Sr2Y5hWyo48LMm+/jZ8mSZhd/JFc
-SI7xFP/J+2MZX9nGqK0rTbi3fT3BiS9PfvLB57otC7Y5rLrO8iE5NkRMmTyiiVDu
-gwyKjHZgvOgzyylEyQ1NpHJvrGfc4bEoG6iNMPFekBS4cCKBlwe5xuNHG17tb2g8
-Qlhx2Dlk+KnZFGcLN3Q0pHJcxIqaansKqOPwhZQb3q5KBJSCUmx8NvBudPT+tGy5
-wrmGXvYz9mvF37FRYXKJTPRiOlM7TNzaVxyJIw/7a55aogW6VV23M8A5pDjQBMrr
-TBYbimFclBiazhtjfVsK0iPizRqlmvy0V7Dz5Fke4Aj2qfCTyhs7aXZsY2o8WNK8
-ibjKIkO890nak/Ni16taBRttoj+604P9Do9jTP3i7VSB7xrgIosQ6HJelP8gw8bI
-U99lO1OQzE0/m9cP3qRV4/L4da283oRH73mws9LzXbB5ml3Lx32rmQxqm5NKJXoa
-GYtNVa1mgR7jk2Gtndwqn1Qz6PSVY8+IaTnKxVtaK8rukj63jC5GB0UALU5s2T/N
-qxmJuSZ4Xns59uAa3n73Th0eN2tuL1tPugeXI1YtgcJK9a+D0i2LJj67O8W1Jnlt
-2LV7wTbXppiL1efd3Rwhad2JDxAKwP73qp42l4T2Epav2HxMDoD2lklw+BAY2AcW
-WxPHEyOqC2AIqPWiO9UynYYzpeDJgBHVq6uZGSlC6GW6EB9gSXF+sU8ujDMuM2LD
-4GZkNl6rwrXMRN2pFkCnn/YxQMk2D4ztJEM7rT84ZNitM1mfDOJU8/bCNtZbjWcK
-tQGvvNf1jfQXe4TfeCdVi/s83Ps016zBmF9P5SqdV76Nx37uvFhyHzQZM9ocIm/5
-YsCDVbTYwXPhDrVSsrQWv+wWtfJg0BUut9PKzN8W2uL4Xo+ZblxO9RtOHDqTyswh
-V1f80wcn2z2rXIUtpJ/yK3D8kT0GhoBvFbQaj7Eu7BFOpTd99TldHaMCO2p6D4Wx
-Ew==
+G+KnADwNcHJL/Rw4VMuOOdkVhqvVi7f8fEK06WGwoz4S/EtqadU+h0yOQqncVK4i
+jvy3C4tL7A0wkty3nqqT9c03Q7TYfa37oqAglmePRk5vRmVtVbdOO5wuYsfz/96A
+9WscLXonqH8XTLItrqWvUT9EOU5zxyldrh2pZxRC7JVbiPi+zex0Ju85rZBsI4WU
+Us4efTHDrCw8CLP1flreNohKGV+oZO8rN0FO3XTAawN0FY30Lm2/Lj4Xjg8xl8tc
+gKjbUl0RNIj/xzjnqZrF6321LJXx0UqRwg1lgkSRsXc+1sWXJDtt3qvB/yDqAHyi
+igRmSwOCcqQMh+dm5mq7+73+A34CPNotDjm7Y+S8yS5SenVBbJwNkksy7vkg1GN8
++jVN2/RKfuZInqiIighouvum3xFHvL6/OJSvTj9UW11deDd3/ZC2j9c4hb3oXV3/
+9vvHD+ObxWhb7O9I+XwFvFv58n18d74X/mv9K8X87wnFXde27dDPmHX1Xji6k9V3
+ALrvyq9+f+j/NdXl8eEbMPM/TqBU7CEjAfjxET8Q8zCXd3L8BXI2dWPP7r7sw+iw
+cGQNpVAP55928brx6OcZZG8crwmbjtyIN93HoTXK18Ls0X3pEBF13Ys5brRHYu0w
+kWG+qOzBwF21q8YDl4vp/4uvzB3+x1JWf7+LPLUW1Havgv/C5bGBJFo3DbL2q/+n
+MKtqhu3P2DddVAuJK55VzN/ps+1K8Wz92RK48Zde33mp/TNkY9VHG7+anc5r+Zb9
+n5/17ST7b+/x9423Fz+s99PLitl59hg0GEuzc9dUwN/o+HsOevhD97FjCbmHjpI0
+WkCDTWDjsomQ49oc8X3IIWzpP98J/biWYeu469SXeqxpC0d+ssTx4T59IKryiTe+
+S3+Tvg700LsDMJes4hzeSsvnW8BJbEr1XYR9yop0TWvAREAmBL2ritEPrSJLvdT2
+1PXNQe8Dz3OM6USZEL98gts0qcxtqlPj0EMxCEgMgWHBZkgl9J/nFF0MQbRaG4k9
+tbXCgoI81tJJ63Xs95EzlAa1n4xRc/qN31nJbDr6lPGnJuawGwuLmg3eK3LZUfH+
+GJN23ea0D6nFDl16FMOmYq7klbGGwDQ9qZ9bO9inF0yUZ/a9JuL8/SKr85M4OrLj
+r4M60L4njw3iX2AYQ8cgo7kYnnqsm56Z2QoY13d1IOO3dPa1Rmd1TabeLUyf7EJI
+AhDtFMxM+qXavIvZdMhtDTR+Raob5ByGXd+eiXkKIqsKAAVEz9aSdnzCeC+44E9N
+zQTB8KfnG8EhHYo48t6wFxQv0wpmXjjoM2WDUmwWshMJSZILBHT2z3Bk9BnE9+wT
+UGJkDViq2rXw3RhhiZ3ToaLxZaOOZzeH4pXvTB1NYFD2gKNL/t8YDBkO/TXOMarY
+SlvKP2hJBtekhO6haJ0WXDO/XjBhfoqPCdGK54dLIlKdLHZ9dj5en6ZW99HAP/4+
++sRGEJgTByMNHWvXurOnWSK17kL82LQ9bGvpZ6G/k4qjVUC90FYmZkOkEqsaUFv+
+AyESGbWTaaqX4MRA5dp8SMBMBIM4vYs5wSfbl/0c/GYkTeF5mXtdvKT5va6Gvq3x
+fblSE4Qb0WYIUzL2jf/PGAyBXG4QGWMD/cGNAlqyU1eiHaueISK7rOmSrp55gOzC
+hTbr8n+jRAZi2UEZVyET3IOmGFq/FwKlv+w5759qDNY67571SJLPpYkwQB4EOD71
+DuYVlvpuKOQu8wo1ULgOAdT9/lqOAFarVbPRMvDeoTM20RXyWbq64IOR1xDKRYFn
+L8TjZCxICOxGoVmanJ9D+FONENpmW6+PkIR7nrcAi9e8rZo6e13HNy8YMEYQb20f
+P1fvX4JBrg9HI++LjVyqaoJrhZjGKp8lznzZBESmZFQK/Vs5qyZkb2wn22vg33ZK
+qXtXUnOfXLLHIZPF8PUqZpMtYuhCjSVFxX4KmOR4G9OHDMpkXVrkw9XgVqADH09Q
++oUc8qLwl03R5gANXuBXcmNkGVmST2sML+Ou4+iPfruu08KEZDafv8de0dSpe5Xy
++d8vZMyvaSk3hWYvDtPZvy8XP4MO3x67/Etwq2qhEdhICEIrwNyE8oGq/4v76iyA
+6jcfZrW6HzjnRkqDe5xZsBIPJlCl2rqLd24i8VuIZOPeNUG2G9WvGBNKuxoLIkv7
+gxpOsB+B0mxBcXUsq+AY7F6MH6kdgABr+LUEXQ2npxQkrxL7DmzyZC3+9A3/p6cZ
+3SfXX72TpdaWhOiq9QvBV2Fiy088sg8WyniRaDQWUAXjWEa1mNPEBTxM8LOCwJ3m
+L/IU2AIBFsIS9m8mIRIKWUytN81BbrZfMgL4fDfax7Ja0urWQ4/e0kNZGILNoYgS
+eE1e0JM4KUZxms1todxu1D9BAJ2RO02KNVIKSwCazc6l4nBOve4vMqgn9Gyd3olC
+rRoyXEPdxxsKlNxJovEZHHNWEkeAHx5jh69S6v/kbtbC20TJ0XFF/gq7W5UEV95Z
+jqkzHbV8TsmEcdFn8a1GH7BrcMby97cU8iF2qUu+rjzrRruF1nh5cuZju3CMf18J
+bObfXrhwto/AQ3fnApY4tCeh/V7CjNdyg/LYrhGheBQfoSZGCG/nM3GgpPYOv7sG
+xbb9aMAmPfFJCLkvHRF2kboqjdG60iCQdPZSw3xPEYuTIKWURhZRigr/AcMipNO7
+aGlRyl/gW4j3RyUAT7Ji8ZP+oWM6SVXtr2sFR7TU9vWQRwgePPCQNAwqeFw6nLBU
+v6dgMplIyLJWsztmxTcCI6SzTLgjMDVdOAXYPtG0Qk7doBracMa2pVqJIbtuOC2R
+gyEsqjQ8bnInSCRPtITaBseBWbJjdRYCGCVTQw+TFeK0Rg7nSJai9gCjpKOhcy6g
+RSx6D3v907dfoIaCtXue/Lp9JROygTreDPxgmznVJrqYUDlGvZca41296PPbw71r
+Sb3dGrRrVsaujzww84tcpns6kD3kkFxCYMe31d4hl3bmA+Nkpyc9dHMKYezPmXWG
+xjTvdv8kZ0jeDujH/bktKKERAE1dysHkZBwSh4MTz7sAZ+9oN7m8H/riNUdq/2tG
+DQ7cnA2y4Kc9b/eADmYkE1he9/f/W39RIszGv4ak221lFVMjJCELJx8CYQZehFst
+5Bhf5TJAWvZ+BF7lQzlBLVT/Ma2FrTbynMQ9LESNdS84GTzUBJtwkT8jQEsMneZT
+6e+FirtwhJ+Q2/GGA079P+8hss8FhDzBy825o4TpGUt8oO3KiqgmztgF9PgR9tP4
+LSpTlw+FnDoo9QzxcZ9d1NotMq+GeHlsE6cO4hIGU+0zk07WtjFnjakRzg0slUZR
+1UNXwFedhFNYDuNivfPAixJMpeU61/o7Q4DbwMPexxJWFw1ZDVRPR2Ug+PHsvQ+l
+whVm9eFc6NT9aT6JuctB1K+qZ0XSTBWVtJCyfO5luvMGrOBOa68KguQ+P3pJVuY0
+dv3ExRXGSa5OOCkKdQR9lyfmphEMsZF+IdcgQSHKluYG6niXUhJkxwxACcvQNOD0
+M41xPMsqL5Qw8ZsZO0rmRcynDpsfDyZQQqXJFmgClwE/8DNYrrm55z95Lqjt722a
+Mz92W4SdScjLK5Y1g8yFQ4Q2tkZ9OyeGF25YWY0B2tMk4dl/ONXpF7tEf/6KbRjn
+dBISVFo67joBeJw1YbybDx523Kdh5JJwMNv15/SPaeqg7DehAIjedKm+hGu7k6a+
+aFLOmLrJBmj1blupQBk0QPQ1vPMRaej3wF0XqOrZczUy9ls15MkCPfBPHWLzZMxY
+2LHCmMatuLgWqaji1E2MkOZQ+pSsi2kOYFzTc2ZxUAZhlG5GUbTycS4xzHtEMbfJ
+MLy8zwhCb0GOyKwcQRXJ9qPjTiFSUxDU0viZiLS2zuNB8tcfMF+k46qVLrGJY1CV
+dENKziNJvqmeHPrVKOyAvStVN8VSsNJR1g/r6dwDYsTNiz46cuEC9FFetHo6L3PV
+cy0A1DN91XQOxsiZxDSls67c1L3f0s7htAlkyXW6gvmM8VxFfbQFQ9ZxMKS9Egw9
+LbXOTpktJuclTgj8OcfaF/3ULhY4q4mi2mkj3lMv2zrDWcRI3sx0euMjLY7s5FIG
+kTyVKaCig1TXTQNilh9B7t9dx37PBivQqyi9CZHo81VM1ZHPmULXxqcR4xhsLG9J
+zhJSsC+QKFQJI4mhWbTYZUYkL9a0WzK7Nl04ERG5QI4f5zrT1OYXWO7kr8uNHfrv
+zNdMnDZAKtcMuYBScbs2J6wlOmGZiE4POYNEdwochAWy9Pp7RNBxDJADn/Dv1+t4
+1RDc6agn6qhGSUFOPqxi8ut2NN7ekRl8T15+gGpwKnMs0RRuw1Tr2lw1iue9wx+r
+Vf3bSCWxMSaaYagSNnK3e6r+EwBr/JKA0vls47x1oSwqlc+45l/dntgAt5TdBPT/
+Xo4XlxaKSMFRqD4V2CAvP6NQch0QQIV4b5cwaCOt30n1MvVg280ybGRYlmagSo7T
++0y04s2JHUKpVRqv7+78pWu8PVMi87gINnZY/2OnbBtodFbB2sU1cc3EZIVu48as
+OMFbqoEVAog5maxTAezDCPoEcSwaRf8lxc+tRrw1lRHTDGK6+X9LEgG1miSEvKqx
+zBNDvArrGUlWmcpyoY7suYk1qQ51g3fy9IrJ5zxSGD0m847N88EU6QOvHM1bemMD
+kYkP8eqsXvGLpw4bvYn969ygSvC35NmGvoPVDeMUHm89ipkN7BriUQ9bqZbLJJFc
+EoNDzpn+EURmQp5te7WCO/QlG02g95bz+Hzf2dUyG4q4QOlsHGuH1Vsd8m/H07BT
+vufCkoVYcRYz+QEhix+KeUlWWhVdKbI4zeAvkQR9GE4g5POem5yCBg3noXcdf2dO
+LDI6yCKS8AkwtWKRRG67SMfHfcmcP9unMN8QMRtwmYc8rNaWqLaq98TWUL+uvxqf
+bSTdV6rp4qolfnDa1KzRU3p+pdNuc5J79L+FrK4SNS1L3EdfwAU3M+TiNR3J+9+8
+jvxaT/i0YsnnzAfG/nBIFs031stlSxAVsHOXcC8MMT3fDGCuU3nvNi1rQdov4oQ6
+pn2UAkihaeLqwfvEIdjz7fi1ADKBFm3enuFEE3iozRHK9sdMIES4gp+Cv4CL4l6p
+I/u9vVpkn0tdamTTyoiIFeHUMQOU1803gtTggGhZk4b5VmlIi5IVQHz1VU5hXs9o
+N7jJUiI66qk+qAvaPMFXG42bLZnDadlLTH56cqntdb5+WcOmjanvcwJUbcddC7Zv
+p/E0oDEyTZF9McQrOCKD12ryE6cFxDODzijSPBBz0Lthelk2VniMjI7ebRz3q0tl
+aKycH9xGZUkdtmnk8+/zxOnw4OvumtAU2AWrB6dYrBbmPa/IKJ0Tcdre0oRpSJs6
+6eHSzL06+LcZbZhbSOxfTdBt5MyKEik7LlM2P1eLPFrMPhOviu0WmC2FviDvebRS
+EnLrqiHOKjCAihXVAdZ1RYCpq5FZvdLTycaqwrF+CVxTrQbw5vXc/XC1P2vICu0I
+IouUIc73e9tGjwHRnplu55S3jcSeFlD26EeW2jda4hwro8oEY2vZ0pA07KFsefZt
+iCR2l3FiCUd8OXCD8xn2pSBiMcDccVmXdYkhpiwXrjMnH0xauXH+IgJVyJaFZlUQ
+Sxj7cZvbN7KYvx1qltRjv49r7IGkubktLYjQqXHcwgAecIweccWehmQfYYVae9Tt
+gMweF5tCLaRP9fQ6+0Em3KxGr0IGDGzN1g2S1hrJ49UZVbc92FyV3vmMdifk00Bz
+AqaxxyUqI45n3n1cUMnsn42B/HEUKIM1VnASs77pBKWNYW0UwgUFZpSkUM0LhaB+
+gI5Vk1fYER9JdNDxSx8oFpLzmg9fF+y0sCJKbpS8FRT7Q9ofXIpEooPoc6HRuOAU
+5+XKA14twsuFRlsxcYkls6Hw7kt8qCQu9m9xotA6HKTmFjxH+9C7j0MnsRKlht+J
+I00+9BZ2scG+UyMEkpxXPMC/6xVsPNwLut26pHj9/k7yLx3CeUMH3T7IdKgTpHDW
+RdnUV7pb6bz2maFO6xNENuPzY5WP9/4sXJmfa3z5cZpuD24j6srMLOZ1a46SjOXz
+WfTg0ey67ub+TneysRod5QVJhe2gBC+o6CudJnfI5UoGaDqs8y1U+S1AZlREHzoW
+zTzmx6AI8KoqpdPBvhZ6Zk55esID45hOoJkmXotG9jmNUsxZB6dm7Cw4yxsWDQjG
+mPawK9uaMyilF2wNdzU1HMsloZ5yHYBEbA0wS0mb/tQULXpSZh9+0UbdmuD3xnqV
+B9bbpvFn8QNO82+wMDXfeNSt1KavGiVSgEwjr166iSZNIj0QzMbP2+ehyJAGAPhb
+Jz4U0EeLbsoylvJgGJXwON9GHySYb1nD+dDYOeROUqELWKZu5AfRXxhLfd6mMJuf
+auAjsQnqv9iRmvGzzlQowOBh0WZxWRrApUQHw61DaaoFvgU5aO7HeQgJ1mRPa4km
+Q/cXISaU18Bw9FHnnSN7x3xeFWvRoK45g4ptxaj1X/RUOjikZm9VxsxcFg1JU/Zo
+67/eF8iGpc/1RpQmJyVDskhg37dRN8pDq1gwr0yHVbttGEe8u1TKCGeYDg1LFt6y
+mfb38joN6qXDzkszIYEXb/DDpd6rLn3Bv3Wjhk7g/bUhDXs2ubmzXM2iwAlgD2VG
+G0YEGfB4J7N9vrfsu0Ov3fhSKgbco8wwTpnsU5o40sx0fky7Jd+4tOK5M0XA4zih
+gM/7nd1YF3aTNXDPh/7mBvebpcBazE8RV2w5M0C8krK3hykS/m1oKldQeC9q8bK8
+oDhtthtgxeCO4M03P67CMU4C/Pr30899jLGXUa9w7V+U77hkNO2orbwDPvXr12xt
+cK8npSg4MJ3HQY8f9/xTlimpWswqTiW6IarnJRS/5TIIe6EYFod8HUE6g1fCzMye
+55APqM1CMqTbWpbBkzvmBb6EjdsfbEORkGdBARx9GZIyZe0go89BCVateFrfhZ0u
+yrOaTt0HaIR5gUY3kYqoocjXaWkBODhy3MFK8GLX9g+2F0IvtOuYCNrzdtzHkVbo
+zucbyUHXoz86W/yNv+AH1JZ87kCGdRCaG5rVSJfJTLQnIOvTntDX9nxLWn/781T5
+WDm84+EdETThmfTN/jbbBBFUdP/C3qpQobNPqvfRcxaeIpXkIflebOXmr/LLVj7H
+vVsEHyx/POGTrEAHu/6dzfcAW7kkVbTIVnxDuF3VsbWSJ3k6xWduJeMp4L6SIxxQ
+rit7tld4T36Yoe966tXv/qLXWwYlhehnFc4OUI466ggO/mFlqlf23o657JL5N1cX
+xY5kVfT3/jEWA7ztbAdY2iBonLxkrCdoeaADYisGAvyLsZVFy35qgiaPk755AJri
+H8J4LAfIpVW3m8X2L7DrzrBZFFlN6M4Ji3e2J/dC2np1C1kqqW99UFqPagyyOYS7
+anxl18u3l3QjQRKx1wivTP+qygqK760T1ruP5j0tPnA4hQ/kA/zmjS7t0XlpN9n5
+GH7qZegkWtIkmbh0jMcrfawjjmP0s6mHrFplbKSEGWS7a4IBWZf9v0trRpJQaGWd
+fegFXHROMB5pb8Svy25t4/82+WefngPQNQb/u529QN9AbdcJmHoCUth9upMRx72O
++H70/u5f5sEPu/7by7mW238fZ++1SJfgcp6bx752D+iFR07an1lk2pFpBmIdO3yp
+p9Nx2XYdR5tji+jLzAhNUl5wS60kT0ENbDdw9m0Fln4MbYuX7UGYnAnEb+1iB412
+LloFcUF+xGA2dzHo9vbGoyzonrGIioR6ZNiUzuZpITyTexLGj8PlVxcFHNuPSrxS
+bo+MLRzJMLPk7gGDgBs1SChiQyZua5O1bu+5EM0xyrrjsz7Fbzpdqj8lEc627U/G
+5+MfkmmoanlS6iw6YNuGIglOskY35dhw+uYsA3KfupHjLVYxYq9xi7aiDi1BIO0L
+CQUH6XerhgFzjo2Vj6KjM51l2i8orsCUIDY0CUeRHTU1CCf7zU9p6bB+iquGaN3b
+sxfwhjjcTSiZFeIe8WwgiaqyXEjabD6e22R9fDrTxCEnP20+4E1HujmZKuZ1Xolg
+qJ93Bm3BpFkv6SnDLvyyItmsGS8vWAcxuMLXTxA6jdfuu8TZmVR/S+VPtLwlkw+N
+Bt6u/akeYn4sMWMVMxHM26R3EnfMafLVjoRs/youyLHB1ugnva/CRTDCllZTld74
+uCTSt2KJhcwdijY7ORoOvfMng7Njyic5qURjk2yigvdvYVe0oh46k/orNQWG08Q0
+LH/tSgfzV6pxS5Mi4zBRVrvY+BdemR7yrKVDUSWcDRa3pFreIcrocJCgNKzEuCWi
+ThLsL6KkKW5PXJHobNTPK6TLxf4COFspYfuuQLUSxEDoEkzOg01+ee8eNrnQqg+x
+ad+VMQI+0czIgqmoIyIHLTlDz5RbJVPjsNXotdNaWAP34bGUGtNE7+wvkpBLQbbn
+kxIeKoIyTUOx79lplNQG9G317P6irJvzT4O6w1G8p4q/bZivlvZcnLAbjHUXlV/n
+qHHBPCnPpS37BZPkS1tE8c804d0ClJylD6ZW8/RSM5vpwb4MXKef4T0Nh62a7Fpx
+Y/9XKgJp41b2ezZsNgVN03IuhTR4S6/Pg6WaL5AW69JOlayhYqUoxkAyiS8k85yF
+06yw31Lb+5L5zUqOSaIV/HkvCqZ2s5Y5NHG/xgUhvVN4nmWSq6iQJw5PclmzaI94
+9rNYfha5CLbj5afimpezxCyc5M1/kok8qy/aBN5+KdnKIORkpW+LPiaqK28RMmYt
+I3A3++mw9mXgyfJEZedWlVK6GOmTBcfIbrndwRzaxYersQ8DZhosQ6uCPzPqzKax
+llCHatqpxs1VgTORdiOf5/YgBa62bt8E6e//ZXz+iyesfTFT5mYCmOlOMQP0knmj
+RP1nd+Gk1n/RgP7TvoQ81H+JULIvaQr09zwcQd7FBu7vc659T87JO4sXoTOa72aK
+THqAQFEhkfYimQnPdhhVq/apbctVBHFtdNSQXsSFB6i04Or+QqQzFYm2cfu3ReII
+AjlWoRRT91PTq1NyqdLMWPA+rUprI31rsCMkfKxJiHnDNOYksu4vNwWpYiI0DwQn
+dMGJF3WNMUnO0typIjEpqU2UfTfobPfn2n+p9gMQRRFxGRVn+Vn1A1fMZLWYdJGF
+9TN1JYnl4QCYOA2RZk8j1WTZjaDZ5pCDhLDa0sJYyYcMhgFMVJZIWwKialqPnafZ
+TPzTdqffGNVrEHERpps1s0QVwoRhYgWKf2G0AoYHpbg3OW3r/wAKRbBb7rnr7eOx
+6NGuAvh6kdfa9XZllBTX7qvHzpmI5tz9rpC8WrakkejPxhX8gIcXlRdXOFrjWoo/
+HcxPhxbwq5h9Pk2VDT09nVeXuNBU/L6hVxKYDghKI7X7IiPAC5EpR6e9C98e0u/y
+W2a1HMvY7eSSUYt1omMSS5B4Sut1C4dR9kpVvS5h9gmWKlFV8qAfvBhfEuMIpl0+
+tZLUycNdZlO5OGQdrX5lDfv9bKIY+s2tmngV/4vCDFPK1r35sxlMSlsNnx5y3Ta5
+grztabxiZT3kHzFfw1BxTcYzqDs2+lhsL7Yp1opMfY1PVEYJJH3FOdQfCnSYYnIP
+erReQ8iCZj+RvIUFfAqk2lSh3SukmuVkc3wEF7jdQ9ydrFFlNs5TizsTGUNzit4Q
+Ns3V4uV97/lE8QvjmY5pLwbTyajj0F7rQ/gTYNJumca2OxCDCxqtkq1yUjt70cW7
+5tZcRbA9E64dp5qttT9hVg63VjDDp3E2/cYHskvLGKKxWQt0dhRKcPFHj/znWUKm
+vc9tPsmi+wvK+Hk5kutHcu7O3jixxZtYiOVS3HE6UakjdnJdghZV4sT7xji6BACf
+z7l4JxbSdfKM2t8GX3Ch4Ob3bz9lqNGwXQRQqVW9e2cYt7393fcJtKM0PQCy3AmS
+P0uhVlM6YbRItfJqico0TH2xsC/K6pWskrkvbTpxkkq+xPTcYtzWXrQ1ssaCAK7b
++el6I7IhGhDRzuStdEwvIz22/2QTfCQJrh/jdmAntkdVXW7i+rARcHzlGXcT0+Tf
+5CGLbdqI1iFfI7RuCoN0toSmfOHOLPZ3t2Cn9DFL505CKJ+0NNMPxlFSwVqYkRWT
+bWqclMDKyUw+lsKqiWxwL0dSA9G6LbqW1ZJ+21p42wA+B6LapGpSPBE8FdgLSxpd
+jzeGrBur5E1LXJkL25wOzoRwKzTn083mZ9sY+d8Iu+g97HEIicKEkkbevUCcD0eq
+NviFsvYbmalMhluj5a2NEcptueMmJSs+0CuM/boe2gW/Z1GfIFECWmhevdZW0eVN
+lHukUa1f2Uh7/c1BNriP1s6ig+M2SqI7Ruekgx/Gs+WGq8mSpRqWKo4XeI7+EGnC
+PLFrRl8lVO8Lk55cOy0aNpPn4/VRa0uVoXmdjPQ4pUBnlRXWNnjGqxW9djo0NarV
+CmaR+O1ijlo/cfgQa1K2A0BHVFksYh53eAQXKGytSe1hXYJmdxixG+OmuJPvXvBh
+V5MSNN/rhRD3LCnegUgq5NfHCQW2EiyubPvnCZzmSa8Lia5U/ISQwW9Y1aUwpQ/j
+tzEVz9P5ZwIg7pjY2r5G4Xyp3dBPwyDbgkCGPGpHmrOgYisfVO9z/U2g6EA8pVbw
+D7Klu54X+7uHnoQXRje3WZKOGnyRm8uHTAGSbiSE54fePkR0Cqr79D7Wy7lPOEQX
+sdAvTetSZyOJlj/yL7BlQ2q8J8Zp64HUVmKwE0AHaW/x4ZNdxMMmZy7r+n9rnc/K
+HTc8+q0HrmE+NkmdvbGV4swkxS6cu7KUCfO7s0wzKDgDZ68tdLon01/JlRcaRJec
+9NHDE97vSOaGJEcrKPREjTTCvNAI9NYXSHIecWXzLpmy1+JJ5scNKxK2zb5Fl1w5
+rp6M9T1hf42wY/CW9aTNdodJD68CmB+TJZsjwUu9hOcH55sN8LYL2ZKH+ns17b6H
+NKVbDY8VsjIn7K83jxK9ikb/Lyp9My3JAZ6jyOe0k+nv8yt4+CwFCzMkwG9LmM0r
+ffXO0zGVO6aY3/SVCZWcSAbQPbzn7rv2nw4QLPTMLM+6BZOjSls0nkFMe8OtPDMP
+tTQPFXHj3FQ0daIDqDUAqSUWQoXrWsovgKoM7op0fDwTM+pu7vbUasF+JBHCGPNx
+01folyiwbTxoD4B5eOJqd22+Q8/qjyMiqYI9VDu2QrRZGNIikSAy0Tstmlrq3XOK
+jsJHcKETo6L5c0f7zLLfGLjjRhB2oH87MkFq1dR8CPGrjxakDMukh0XPCByyNB/s
+dEVRsjpT0sWfduYPMAvQ5KhMuUOJw505lyY8e/zEBQh9geCr7NbZHxOzufaF1CvA
+UKW8inV97OcpM7z6o6NtjaYnSmiP47Bdq5bpdJ6gSZOcfH0cc3PKW/fTnTnJLteA
+xsS5Q04Ij2T0kqg6g15wt1WtniNtfxVy9fD8w1A9JjHjSKr5sRAerlb3DOpw76JL
++lontT9BKHpQjCO5Vr45Yf6f1sP6hCwFmDmJc4x12C2Zbcvjxn6Q7Fejff47IZAo
+ofL0J8dsIORG2cTWrF/n/2t9ucaE++PNtPSmTx8M2tU7TUAKQEe4vESlSjUvR9ud
+BI9VlyiFDAdpZHom1p84YqdUAcdyMY2K47afLmc6fho/bZKwyh7JheQYzwOeXcTX
+8RN2T2t8kJrpkq8nuODwn3kB7FLlkw2qUN02ZGENYWmYhauQjut+Biijbdpv+yoT
+CY2SH1qci35hveI28IOKrdgsN28YT4DT6jO8huCbPb+30fUm6HqBhhXloscMP3+z
+8mJ1txUPeZaGlt0Xe9hBhu87aTe8PSoRkAt3jt2RK5+eo/1uAwJTtKKX4grygV1/
+xm7mad0Uai9GidqGLnD1kDhahuvEU0u00G411+2V4BxSl62AySY3ix3H0BMnhpTY
+uqyLZRa4IEveIOPMz42L+CHSbYJR1IGKxRR491dVy14He0FM805DG7MM8QaJaeP+
+290ufat240f///6e7Q94HGPuD++5EDw2gpijrAK9js9U/0GG3RNnfsY9D0Iyz13P
+r1+8k8POs8ff2srrRXR04sGWoEL+CdQ8Ytca07/TRHq3zUlhCDhCJgOioha6Tw/z
+S2Cj7Z4LT6wr6PTtJbwylOUot29pbci7S/q+MLoYHZRRDzip5XCaH3Yk1pKxRePl
+zn1qLAmyP2V4fEYX9t5WSOP2dYhVSyBdqP7FEu/KkzC/86FUrjWa14rduiG2Wms0
+l6un5w9xhKR1y79Aag2bZG162YEezjFbKyQUQyUGbBasBocOISmT8lPQP+4U0ZwB
+Q0CDN93OormyELcUrFCxoNYkLTMjZczKmOsMzbCkuLjaTCPGmZ7UYHc4lSobz1V6
+weOo5N8S0NHLRYzPwg7jsZ4EspNWM8cMr/1CNtczONW8Bekz9d7i6QSewQ9+Qrxn
+6i9eNursnUQpHnh8sfCRZA26eT3fw3xe+b08+cyFJfdBs8eMkUPkfSHNeLCKFjv4
+y3C/1krJfC3+uKXsxqNBl16Tc5CYvws0xfE9HzPfpRKVr1aXcyaVmUMurvS3D07Y
+Ynf8iGwhXesvwN4zG5HVgN8jaDXuY/MItziVS26J79H+GAU41NBnPoydAA==
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /locales/ja.po
@@ -37696,13 +37718,14 @@ qgCZhRg=
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /mails/layout.mjml
-Size: 459
+Size: 685
 
-G8oBIIzTFfdOSJMQXV3je6Gdfc4WKI/q7GNKgv+2GXKWd/8ERewGQ7KZFselxYW4
-FpzqXCBp/Lxw1M0y0cfo4cXum75zKbIWhpUqkPWzuja3pL6dA4UMiW7pfxykC6VQ
-Cw13qSmF0Pbcwfdlbx3+H6G/0/G5Lxz4FMP5Ui/29C6KN+2fmSXO6n11UJ8u/HcZ
-Kx8G8NTKZp6NGcADh37ApLNNk7zvpNki0VYErJ/w4KAqP4TfOeTD0VkQa+G5jaXV
-XqE3yojvA3H/KgEbxUIB
+G6wCQIzDOEa8ii+ljQ3btuEsY4MZY7GMH9UlYnZwOYEHpNu/ZmOBRXMdZV9gEcaY
+RnqFpm6nR0oe2H3Tdy4EbYyMIKNShF+ra3M1qBZcSSn1IN4c/Q8HW6nWNKvgfeuC
+wv33ZT2UZCzH//dIYiw/GmMm3RB+w1PHrJA1ZRwXYlBJEX68bsOn93X6Dld07NnK
+wjuv9Ky3A5tzlL185cqezQWUo4M9hEVBxpSEeJIHKCEEBmWjv9PxuaeH5JEYiEvD
+ISuk9/ChfC+KWwn4Cy1xVu+rQ5+uyAhWLqKBKGd64aQL8L5ThSzqKyYRhcP2HA6n
+7Nlc8LXnkcHcB0UHXhLonnzL0CP/DxGba5/2eNsF3JvGEA==
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /mails/magic_link.mjml
@@ -37906,6 +37929,39 @@ Ca2iLPAssEAK/MeT3G5Im4HMb7kZ6VxIh8e0ePZlHoZYeOOgUAS6OQio/Bm+oDn/
 ed+xJFGhYnHRd4u0UGP2nkwxncBPZaiXRKFdx6w2tYMA
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
+Name: /mails/sharing_expiration.mjml
+Size: 487
+
+G+YBYOTpVBejCJ6S6eemxDmfMG4z5Mq7jdDA35yJ5r1Rc9fL13Nas8OQJAunOomx
+lBCRGURTz6wSI+1rcXdCmQxfIvQb3CQeWRY+GTEplv/zJc77opBCM1w9dTnOrBgE
+t2ad24osA4iA4FbZpW3zuPKQJHnakVL1RFrlobs2qvRdu31EoR8j4om+eBFIK2E3
+wduJdEwuLYcXbiCxqJUME932QQEbjNnPcUI20kYFqZ/srLSIVKu5NAM=
+-----END COZY ASSET-----
+-----BEGIN COZY ASSET-----
+Name: /mails/sharing_expiration.text
+Size: 174
+
+G60AIB0J2anMbVTxhTQOlApNey3iUpTEbWxdab+mEBXS6KiTA/Z/tygMNODgYAkE
+mtvYmopC0YpqNP9AyVp13P1SdVjvBLGhqbsN4e0+TSD8sD4mQWg2EeLuaglbmsoG
+-----END COZY ASSET-----
+-----BEGIN COZY ASSET-----
+Name: /mails/sharing_owner_deletion.mjml
+Size: 504
+
+G/cBYOTpVBejCJ6S6aemzDmfMDUv5PrwwJDAuFv6NNrc9fLdc1qzYxBSIlQdxFgU
+oZEZRFPPohKJtrW4OaFCJiuJKQFXK3qWKvDJiGmx/N9d4mJfFJJpJhdPXY4zKwbB
+bbDNXUPWAUTA8FrZZ23zuPKQJHnakUr1RJrlobs28PxSlFZj1U3TzxHho6ew2g9C
+Qk6G0FoSDhPgvZCnJte5/cIDpBq5zAT1bScZAvRGLwC5v+zEqKlWc2kG
+-----END COZY ASSET-----
+-----BEGIN COZY ASSET-----
+Name: /mails/sharing_owner_deletion.text
+Size: 191
+
+G74AgBwFbjtDbuj08YR+QiDlNrautL8jkALxRanQFNYuRCJJdXLA/u+WBRYG3tYW
+SCIB5jZ2tkqFI2jUqd4F69a9Y45mIoodTn8F4WCWeYcQ/Ln9I3//xFvUXv0UbQOe
+0EkA
+-----END COZY ASSET-----
+-----BEGIN COZY ASSET-----
 Name: /mails/sharing_request.mjml
 Size: 661
 
@@ -37941,6 +37997,23 @@ G7IAOKyOd1hOjBOhqLBXjmv1SFsrgOz1KRe6FEmi6qawNDf5JteXImx9Ojlg/vdL
 nkRckECAucFRxEUvPo4y2vgTP6uwFmTVMjci+x3E+8FpPdQQMfn+cl/8RDaBEFAP
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
+Name: /mails/sharing_verification.mjml
+Size: 548
+
+GyMCYBQhSefTqV6NavCMbPbc+Al9zidM3QR/QFrbHmw18C+K1rIwS6iyaMxdL8rH
+V6vdGRIS4Zk7MQ4SeiCi3KlHUaUja2tJc8KELB4i9FkZnXhcs8jOiKlY/u8uccEs
+Cso0i+Yp6TizYiDeXxyqD8bRIggh6uQU1u5x5Q6Q/7AjLfOpYYyHrdkYjaywjxFh
+9GET7L4JEi5gmKkjd+uTnqRLlGGjLlY4uvsC8kNjrtHEcvcVWztMzmv9gtlMlhL7
+YtwgvSagwlNUcymiAA==
+-----END COZY ASSET-----
+-----BEGIN COZY ASSET-----
+Name: /mails/sharing_verification.text
+Size: 104
+
+G2cA+D0UcIdMwk/KigYng0E89YV7MfvLPTqXBFHoS5Gkp2jKIbe6CnvLNDK6FGHr
+67I3uT4wkRP1tiC1kzz9yeQkM7TEcTDrpHgfGV8MrXE88E8f
+-----END COZY ASSET-----
+-----BEGIN COZY ASSET-----
 Name: /mails/support_request.mjml
 Size: 368
 
@@ -39146,6 +39219,21 @@ bXWzMzDARkkssdcs61NAL0n1QtaCyGY23yIgCkF2y2zKWQTnoeiu/isFrFOtYwvd
 XFrtR+aavtcw/0xFIYOvEPAWCTsmsKXAN+uFgcZeRx0iDQ==
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
+Name: /templates/instance_maintenance.html
+Size: 1458
+
+G7EFIBwHdqMP2V4GgrQeGR/yzblXNlf/MrT7qFRhjLkmCNVe9ynsibSv/RYrIdST
+RdQizeT9Q62TxKpPZwi1UiIqsgncpRNLg1gXrYEayyIiPChRS+7tFSOI7ADwPUZ7
+kn66ccRnMttpxkJE2GVab8oiu0QKyLxPT2KEG8gjWOkL93nZU9fdpB3mGNIootc1
+34hprlsFWca6HvXzmLPx1JZ4zty6N3tFidSx43PD/ElfD3ZLMUsQS79l8U1tvSz7
+uostPIm0vBd+rW3FlDZZKSWxRn7xLXd+E45Clmg88QSdUUlYgD+QGg/eeVSfcj0G
+itR9nhBzWHsM45Cf5FPdL0wdFfpyyoujGSW8mNejVKDkl//43PTvxt25JvFkOPCg
+P9A3g/7AT5rS6HdY9lkzvVvB3gXkWgAINrDE8t6gd0hC0PseWsYCRFDcDD4nYz29
+rceBeoPkQSGsrkqpitE7Od5L0Q7UL1w2Uh1oKXkR5dKsdstVZLF92lKb+MMcW2dj
+BOcGZ5i23TsPtsYOJK+ApMUWViFCxfB8rf6VT/7V4Am9asZ3sEvHa3r+Uop7AV/B
+5LpJJClgKGpXm1UxVNfacBc=
+-----END COZY ASSET-----
+-----BEGIN COZY ASSET-----
 Name: /templates/login.html
 Size: 5878
 
@@ -39423,27 +39511,29 @@ DXeBFa8XOkRk4LPxW+5ucvHqiEDaA3kh262jnu+ZDhY=
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /templates/sharing_discovery.html
-Size: 3163
+Size: 3936
 
-G1oMIBwHdqMP2X4YRx4WcZHzVZu/d5ms7M8pjvAZtR9iciXLCQKzl317TH62/Nmv
-CBqjEMLelJuQ1uu+nf206kpz3SE0xCOkwUhUhvPuUGShDbNbQjUQhHWKcK9EOxJl
-djMGELkDmh6/CmnOxxsXxExgB0MhatqlWV+3XcjiJiDYD7c8wI2612QNLPx3/6Iy
-1wch3bOkW0UC5xJPTHMbjIVMldvk7zFXzWNbImQ+uDJyuUSWi7rLGeE/aYpWtjir
-tLn0twR/aVSM4+SW3QuPIm1EzfBrrGKKJPUVASKTCSsLWvSWOCvCvw9nn++wpciA
-3BwDCyqa1icp2DoXAisBtKXnPqsMWQFcvqjQoBB6vnAbE8R5qNEMDLhelJ/F3FRC
-oZq7o1ksQs9LLjpreOrGHksxXAONKFu7xDvwOc1XtQ/pmErogeXsDplR1f0/3HaX
-M93W3RQHKFrysI3lBRs8Y2PGt2dB1SyMkdbJiW6rUDVhe1IJbVcNCvy8CbFJSKg5
-N+RrypdoYncNS0isgbGZFvFk4KJvu97hO0pJl1GtSNol0H4myIJHadbiFr7SRpch
-HoeaFAEyzbT2EsxQqgTnIrhX4f/vGMwDBzvDhHfiiEWFfniVcpfiqHgWqRU+ePwb
-NDHqjESKlLqR+P+nNsCD/NF5C8rrxapwKNp4rJaTNlY4H6inzHTNZkMSgt16q634
-dUV+0CDVRfWWCgdHm34Un5umsQZMjU7xEp5Yn0jK1E348BskbUxHNEVb3gVGxA+u
-wjzfjlK1gcgL/LPjtTt+xQxtEUK3mN315MeEEnCCxKMZWnwBTa8msDEY+ZGSPfQB
-lpqaTRo8ia6yWWe0s0cUViwowAdiWaFSDRZLYC1Z+H7UraYtINhpeUE1ILqtRM2w
-N8zwTiZuxliCbHNZzbJXwsxhApTNFOmeLMwMX2DmpIGSZfrMSyq6xJWfd6IQiQlW
-grFBRrsWQT/4KVkG/daWCzmK7GFpn+qwY8IdY6CRcV+W+aRluFwb7CKIzwRLZe8a
-Y9FdjmKXh81NvK3Gp3gsTgW7ehBTUPuh0hPyxi8g7EuTHIeu78kPJ55bqPzzmllp
-ETORrwJHR2Od3VSD0tND0ddgAmKdCxLzIoS4VNsi8bUqmm3trWZyR6S95BC0sqgx
-8HUSa5CDccLG0uWq19PxkSrZ
+G18PIIzDuOFb2sVQIobfLOev76+pNpSXDHxxrU4MnhvZBNnr8/32+7SrVukVwv7c
+5GcRYDKZt4QOyAG3Fbo9vkIaMKrLmNp/FyKBXLW4lxAGGmRt1spRiTYZXlyM+IDI
+NVB7+KqhOd9uXJAzZjvzKUShnev6ovNtXKgB5v1wjw/cCLyQ1ZuVf89P8+Y6pe6I
+K4lSnnREPUk3t1Yolikvn+SnMVchW1sizrx1XuCFRBbZpEOP9X8S+wluBitTpfRn
+If6hG78o6nLdkZVNpA3yI/61DTEZk6SKMCKcCZUFEb15pbJW/r6cer5jVlKkjNyg
+wQuMGtvD+N46hEAlgPb03lt5QQoB5IuExiKh9wtuY4hQhpLNwIDLTfyzGEwZFKrC
+7c9iEfc8ln6qhJ+6OsMOaZQxNCLv9RYfwOfUr2gf0jFlaAd0Qdm4Ytb9v7hNh55u
+o7TWHWQtuVfl8pRavaMt4+u7RtXM1nAi09FjOUIT2JMyaLsKuMAP4zX2CQk15ypv
+j7wdxBqudoc4sRLGZsLaigS7yGTXW6uUKGkXcyCpt0D7KSLtvMWmPW7Nj7TRLsg2
+1FgEyDRj6xAMViqDz0XsXo6/f0eftyphZ+DwjrbY3trq+t5dyl0XR9ADpQR85vXv
+INaIXLLWdygtSP7/vPUB7pMfaWVBsZ3L+yX8JB9LbSbRPJ+PRrUrmDMYkpDZdbTa
+kl8oSmMNUvUm2pNwINv0S/G5rC4ihqk0KJ67x9YnQpnAhC9/ApNoahH7ibwzG5F/
+cB62ym0/oY3JPLM/aa6LpP2KGtoMSNeJi+u6KgwRcAiTUA2t/YI1vUJg3arwj8TZ
+symMpUbdJLEnuasw6+B2JLTIsjIFUri8LKxSAS+WmLVw208jsEJb4GCnlQVFQPRY
+hsiwa+1iSiZuwShBujvLL3JfCQsHDlCHmDndw2ULw0eYA6kls05feKRaSH8jmSAb
+ws1NXswrKtYQNnNm6BHhKKVWXtP10t+mi4TARNWD4CkHxEqIX/p9R8cSg8p3AGN6
+pjWp43aJ5Z9s8psmWziejTVUke2d3b39g0MqGQP2LKWcTc6E4H+uWKXTLsy/81yv
+UD6x7BVQOFSGsAUlk+oWyXc/S+6R/Oiis+Vmo5od9VarKkwAFatYbgC2tTKJfKM6
+L1xdZNm+E6wlhJUcs9w43g2/bIj1vgLfymY2P8SVQUtB1Ydfk1A2vpVAKiE5zmt+
+Ir87sdKKKhsOWCHUiGb3Q9hJHmvuoQJxLV5CVxj1Extm5pSFZwHLf8FjnMcZCq46
+vaU8EJlwnILe9pVaIEhynfmkgVFdUJaqN+b9vvo0AQ==
 -----END COZY ASSET-----
 -----BEGIN COZY ASSET-----
 Name: /templates/twofactor.html
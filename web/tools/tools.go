@@ -1,9 +1,12 @@
 package tools
 
 import (
+	"net/http"
 	"runtime"
 	"runtime/pprof"
 
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/jsonapi"
 	"github.com/labstack/echo/v4"
 )
 
@@ -15,7 +18,17 @@ func HeapProfiling(c echo.Context) error {
 	return pprof.WriteHeapProfile(res)
 }
 
+// ReloadSecrets fetches again the secrets of the configuration from Vault and
+// the SOPS files, to use them without restarting the stack.
+func ReloadSecrets(c echo.Context) error {
+	if err := config.ReloadSecrets(); err != nil {
+		return jsonapi.InternalServerError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
 // Routes sets the routing for the tools (like profiling).
 func Routes(router *echo.Group) {
 	router.GET("/pprof/heap", HeapProfiling)
+	router.POST("/secrets/reload", ReloadSecrets)
 }
@@ -23,4 +23,22 @@ func init() {
 		Timeout:      30 * time.Second,
 		WorkerFunc:   WorkerUnzip,
 	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "prepare-archive",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerPrepareArchive,
+	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "clean-prepared-archives",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      30 * time.Minute,
+		WorkerFunc:   WorkerCleanPreparedArchives,
+	})
 }
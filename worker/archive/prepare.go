@@ -0,0 +1,30 @@
+package archive
+
+import (
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+)
+
+type prepareArchiveMessage struct {
+	ID string `json:"id"`
+}
+
+// WorkerPrepareArchive is a worker that builds a zip archive in the
+// temporary storage, for an asynchronous download.
+func WorkerPrepareArchive(ctx *job.WorkerContext) error {
+	msg := &prepareArchiveMessage{}
+	if err := ctx.UnmarshalMessage(msg); err != nil {
+		return err
+	}
+	return vfs.BuildPreparedArchive(ctx, ctx.Instance.VFS(), ctx.Instance, msg.ID)
+}
+
+// WorkerCleanPreparedArchives is a worker that removes the prepared archives
+// that have expired, with their content in the temporary storage.
+func WorkerCleanPreparedArchives(ctx *job.WorkerContext) error {
+	count, err := vfs.CleanExpiredPreparedArchives(ctx.Instance)
+	if count > 0 {
+		ctx.Logger().Infof("%d prepared archives removed", count)
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package audit
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/accesslog"
+	"github.com/cozy/cozy-stack/model/job"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "clean-access-logs",
+		Concurrency:  runtime.NumCPU() * 4,
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      1 * time.Hour,
+		WorkerFunc:   WorkerCleanAccessLogs,
+	})
+}
+
+// WorkerCleanAccessLogs is a worker used to delete the entries of the access
+// logs that are older than the retention period (access_logs.retention in the
+// config file).
+func WorkerCleanAccessLogs(ctx *job.WorkerContext) error {
+	count, err := accesslog.CleanOld(ctx.Instance)
+	if count > 0 {
+		ctx.Logger().Infof("%d access logs deleted", count)
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package audit
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/audit"
+	"github.com/cozy/cozy-stack/model/job"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "clean-audit",
+		Concurrency:  runtime.NumCPU() * 4,
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      1 * time.Hour,
+		WorkerFunc:   WorkerCleanAudit,
+	})
+}
+
+// WorkerCleanAudit is a worker used to delete the entries of the audit trail
+// that are older than the retention period (audit.retention in the config
+// file).
+func WorkerCleanAudit(ctx *job.WorkerContext) error {
+	count, err := audit.CleanOld(ctx.Instance)
+	if count > 0 {
+		ctx.Logger().Infof("%d audit entries deleted", count)
+	}
+	return err
+}
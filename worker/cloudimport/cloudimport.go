@@ -0,0 +1,31 @@
+package cloudimport
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/cloudimport"
+	"github.com/cozy/cozy-stack/model/job"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   cloudimport.WorkerType,
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      6 * time.Hour,
+		WorkerFunc:   Worker,
+	})
+}
+
+// Worker is the worker that imports the files from Google Drive or OneDrive.
+// When the import is not finished before the timeout, it pushes a new job to
+// continue it.
+func Worker(ctx *job.WorkerContext) error {
+	var msg cloudimport.Message
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	return cloudimport.Run(ctx, ctx.Instance, msg.ImportID)
+}
@@ -0,0 +1,33 @@
+// Package contacts is for the workers that maintain the io.cozy.contacts
+// documents.
+package contacts
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/job"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "contacts-dedup",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      30 * time.Minute,
+		WorkerFunc:   WorkerDedup,
+	})
+}
+
+// WorkerDedup is a worker that looks for the contacts that may be duplicates,
+// and deletes the merges that can no longer be undone.
+func WorkerDedup(ctx *job.WorkerContext) error {
+	count, err := contact.ScanDuplicates(ctx.Instance)
+	if err != nil {
+		return err
+	}
+	ctx.Logger().Debugf("%d pairs of duplicate contacts", count)
+	return contact.CleanExpiredMerges(ctx.Instance)
+}
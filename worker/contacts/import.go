@@ -0,0 +1,37 @@
+package contacts
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/contact"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/usage"
+	"github.com/cozy/cozy-stack/pkg/consts"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:  "contacts-import",
+		Concurrency: runtime.NumCPU(),
+		// An import is not retried, as the contacts created before the error
+		// would be created again with the duplicate strategy
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      30 * time.Minute,
+		WorkerFunc:   WorkerImport,
+	})
+}
+
+// WorkerImport is a worker that parses a file of contacts (vCard or CSV), and
+// saves them with the conflict strategy chosen for the import.
+func WorkerImport(ctx *job.WorkerContext) error {
+	var msg contact.ImportMessage
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	inst := ctx.Instance
+	return contact.RunImport(inst, msg.ImportID, func(count int) error {
+		return usage.CheckDocumentsQuota(inst, consts.Contacts, count)
+	})
+}
@@ -5,12 +5,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"math"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/cozy/cozy-stack/model/app"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/pkg/logger"
@@ -23,6 +26,8 @@ import (
 var defaultTimeout = 300 * time.Second
 
 func init() {
+	job.KonnectorNextAvailable = app.KonnectorNextAvailable
+
 	job.AddWorker(&job.WorkerConfig{
 		WorkerType: "konnector",
 		WorkerStart: func(ctx *job.WorkerContext) (*job.WorkerContext, error) {
@@ -30,6 +35,8 @@ func init() {
 		},
 		BeforeHook:   beforeHookKonnector,
 		ErrorHook:    jobHookErrorCheckerKonnector,
+		ErrorClass:   konnectorErrorClass,
+		Retries:      konnectorRetries,
 		WorkerFunc:   worker,
 		WorkerCommit: commit,
 		Concurrency:  runtime.NumCPU() * 2,
@@ -60,6 +67,24 @@ type execWorker interface {
 	Commit(ctx *job.WorkerContext, errjob error) error
 }
 
+// stderrScanner is implemented by the workers that keep the lines written by
+// the process on stderr.
+type stderrScanner interface {
+	ScanStderr(ctx *job.WorkerContext, i *instance.Instance, line string)
+}
+
+// outputMasker is implemented by the workers that hide some values, like
+// secrets, in the output of the process before it is logged.
+type outputMasker interface {
+	Mask(msg string) string
+}
+
+// stdinWriter is implemented by the workers that write on the stdin of the
+// process, like the konnectors for relaying the inputs of the user.
+type stdinWriter interface {
+	SetStdin(w io.Writer)
+}
+
 func worker(ctx *job.WorkerContext) (err error) {
 	worker := ctx.Cookie().(execWorker)
 
@@ -80,30 +105,28 @@ func worker(ctx *job.WorkerContext) (err error) {
 		return err
 	}
 
-	var stderrBuf bytes.Buffer
-	cmd := CreateCmd(cmdStr, workDir)
-	cmd.Env = env
-
 	// set stderr writable with a bytes.Buffer limited total size of 256Ko
-	cmd.Stderr = utils.LimitWriterDiscard(&stderrBuf, 256*1024)
+	var stderrBuf bytes.Buffer
+	stderr := utils.LimitWriterDiscard(&stderrBuf, 256*1024)
 
 	// Log out all things printed in stderr, whatever the result of the
 	// konnector is.
 	log := worker.Logger(ctx)
 	defer func() {
 		if stderrBuf.Len() > 0 {
-			log.Errorf("Stderr: %s", stderrBuf.String())
+			out := stderrBuf.String()
+			if masker, ok := worker.(outputMasker); ok {
+				out = masker.Mask(out)
+			}
+			log.Errorf("Stderr: %s", out)
+			if scanner, ok := worker.(stderrScanner); ok {
+				for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+					scanner.ScanStderr(ctx, ctx.Instance, line)
+				}
+			}
 		}
 	}()
 
-	cmdOut, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	scanBuf := make([]byte, 16*1024)
-	scanOut := bufio.NewScanner(cmdOut)
-	scanOut.Buffer(scanBuf, 64*1024)
-
 	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
 		var result string
 		if err != nil {
@@ -117,6 +140,32 @@ func worker(ctx *job.WorkerContext) (err error) {
 	}))
 	defer timer.ObserveDuration()
 
+	// The konnectors can be executed on remote agents, to not run untrusted
+	// code on the same host as the stack.
+	if runner, ok := worker.(remoteRunner); ok && useRemoteAgents() {
+		err = runRemote(ctx, getRemotePool(), worker, runner.RootDir(), workDir, env, stderr)
+		return worker.Error(ctx.Instance, err)
+	}
+
+	cmd := CreateCmd(cmdStr, workDir)
+	cmd.Env = env
+	cmd.Stderr = stderr
+
+	cmdOut, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if w, ok := worker.(stdinWriter); ok {
+		cmdIn, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		w.SetStdin(cmdIn)
+	}
+	scanBuf := make([]byte, 16*1024)
+	scanOut := bufio.NewScanner(cmdOut)
+	scanOut.Buffer(scanBuf, 64*1024)
+
 	if err = cmd.Start(); err != nil {
 		return wrapErr(ctx, err)
 	}
@@ -6,16 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cozy/cozy-stack/model/account"
 	"github.com/cozy/cozy-stack/model/app"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/instance/lifecycle"
 	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/konnectorinput"
+	"github.com/cozy/cozy-stack/model/konnectorlog"
+	"github.com/cozy/cozy-stack/model/konnectorsummary"
+	"github.com/cozy/cozy-stack/model/konnectortelemetry"
 	"github.com/cozy/cozy-stack/model/permission"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/pkg/appfs"
@@ -35,13 +43,51 @@ const (
 	konnErrorLoginFailed         = "LOGIN_FAILED"
 	konnErrorUserActionNeeded    = "USER_ACTION_NEEDED"
 	konnErrorUserActionNeededCgu = "USER_ACTION_NEEDED.CGU_FORM"
+	konnErrorVendorDown          = "VENDOR_DOWN"
+
+	// konnErrorClassNetwork is the error class for the network errors, that
+	// are not sent with an error code by the konnectors.
+	konnErrorClassNetwork = "NETWORK"
 )
 
+// konnectorRetries are the default retry policies of the failed konnector
+// jobs: the network errors are retried quickly, the provider in maintenance
+// is retried the next day, and the errors that need an action of the user are
+// never retried automatically.
+var konnectorRetries = map[string]config.RetryPolicy{
+	konnErrorClassNetwork:     {MaxRetries: 3, Delay: 5 * time.Minute, MaxDelay: time.Hour},
+	konnErrorVendorDown:       {MaxRetries: 1, Delay: 24 * time.Hour},
+	konnErrorLoginFailed:      {MaxRetries: 0},
+	konnErrorUserActionNeeded: {MaxRetries: 0},
+}
+
+// konnNetworkErrors are the codes of the node.js network errors that can be
+// found in the messages of the konnectors.
+var konnNetworkErrors = []string{
+	"ECONNRESET",
+	"ECONNREFUSED",
+	"ETIMEDOUT",
+	"ESOCKETTIMEDOUT",
+	"ENOTFOUND",
+	"EAI_AGAIN",
+}
+
+// konnErrorCodeRegexp matches the error codes sent by the konnectors, like
+// LOGIN_FAILED or VENDOR_DOWN.BANK_DOWN.
+var konnErrorCodeRegexp = regexp.MustCompile(`^[A-Z_]+(\.[A-Z_]+)*$`)
+
 type konnectorWorker struct {
 	slug    string
 	msg     *KonnectorMessage
 	man     *app.KonnManifest
 	workDir string
+	logs    *konnectorlog.Recorder
+	stdin   io.Writer
+	stdinMu sync.Mutex
+	env     *konnectorEnv
+
+	startedAt time.Time
+	summary   *konnectorsummary.Summary
 
 	err     error
 	lastErr error
@@ -53,6 +99,16 @@ const (
 	konnectorMsgTypeWarning  = "warning"
 	konnectorMsgTypeError    = "error"
 	konnectorMsgTypeCritical = "critical"
+
+	// konnectorMsgTypeInputRequest is used by a konnector to ask the user for
+	// an input, like a 2FA code. The answer is written on its stdin, as a JSON
+	// line with the input_response type.
+	konnectorMsgTypeInputRequest  = "input_request"
+	konnectorMsgTypeInputResponse = "input_response"
+
+	// konnectorMsgTypeSummary is used by a konnector to send the summary of
+	// its execution for the timeline of the Home app.
+	konnectorMsgTypeSummary = "summary"
 )
 
 // KonnectorMessage is the message structure sent to the konnector worker.
@@ -117,6 +173,26 @@ func jobHookErrorCheckerKonnector(err error) bool {
 	return true
 }
 
+// konnectorErrorClass returns the class of the error of a konnector job, used
+// to choose its retry policy: the error code sent by the konnector, or
+// NETWORK for the network errors.
+func konnectorErrorClass(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return konnErrorClassNetwork
+	}
+	msg := err.Error()
+	for _, code := range konnNetworkErrors {
+		if strings.Contains(msg, code) {
+			return konnErrorClassNetwork
+		}
+	}
+	if konnErrorCodeRegexp.MatchString(msg) {
+		return msg
+	}
+	return job.DefaultErrorClass
+}
+
 // beforeHookKonnector skips jobs from trigger that are failing on certain
 // errors.
 func beforeHookKonnector(j *job.Job) (bool, error) {
@@ -185,6 +261,9 @@ func (w *konnectorWorker) PrepareWorkDir(ctx *job.WorkerContext, i *instance.Ins
 	// Reset the errors from previous runs on retries
 	w.err = nil
 	w.lastErr = nil
+	w.logs = nil
+	w.summary = nil
+	w.startedAt = time.Now().UTC()
 
 	var err error
 	var data json.RawMessage
@@ -217,6 +296,23 @@ func (w *konnectorWorker) PrepareWorkDir(ctx *job.WorkerContext, i *instance.Ins
 		if couchdb.IsNotFoundError(err) {
 			return "", cleanDir, job.BadTriggerError{Err: err}
 		}
+		if err == nil {
+			secrets := acc.Secrets()
+			// The secrets of a shared aggregator account must not appear in
+			// the logs either
+			if aggID := acc.AggregatorID(); aggID != "" {
+				agg := &account.Account{}
+				if couchdb.GetDoc(i, consts.Accounts, aggID, agg) == nil {
+					secrets = append(secrets, agg.Secrets()...)
+				}
+			}
+			w.logs = konnectorlog.NewRecorder(ctx.JobID(), slug, msg.Account, secrets)
+		}
+		// An account received via a sharing has no credentials until the
+		// member fills them
+		if err == nil && acc.CredentialsNeeded {
+			return "", cleanDir, errors.New(konnErrorLoginFailed)
+		}
 	}
 
 	man := w.man
@@ -522,6 +618,20 @@ func (w *konnectorWorker) Slug() string {
 	return w.slug
 }
 
+// RootDir returns the directory with the files of the konnector, that is sent
+// to the remote agents.
+func (w *konnectorWorker) RootDir() string {
+	return w.workDir
+}
+
+// AddArtifact keeps an artifact produced by a remote execution in the logs of
+// the execution.
+func (w *konnectorWorker) AddArtifact(name, mime string, data []byte) {
+	if w.logs != nil {
+		w.logs.AddArtifact(name, mime, data)
+	}
+}
+
 func (w *konnectorWorker) PrepareCmdEnv(ctx *job.WorkerContext, i *instance.Instance) (cmd string, env []string, err error) {
 	parameters := w.man.Parameters()
 
@@ -575,9 +685,17 @@ func (w *konnectorWorker) PrepareCmdEnv(ctx *job.WorkerContext, i *instance.Inst
 	if triggerID, ok := ctx.TriggerID(); ok {
 		env = append(env, "COZY_TRIGGER_ID="+triggerID)
 	}
+	w.env = contextKonnectorEnv(i.ContextName, w.slug)
+	env = append(env, w.env.Env...)
 	return
 }
 
+// Mask replaces the values of the secrets from the context in a message
+// written by the konnector.
+func (w *konnectorWorker) Mask(msg string) string {
+	return w.env.Mask(msg)
+}
+
 func (w *konnectorWorker) Logger(ctx *job.WorkerContext) logger.Logger {
 	return ctx.Logger().WithField("slug", w.slug)
 }
@@ -589,7 +707,20 @@ func (w *konnectorWorker) ScanOutput(ctx *job.WorkerContext, i *instance.Instanc
 		NoRetry bool   `json:"no_retry"`
 	}
 	if err := json.Unmarshal(line, &msg); err != nil {
-		return fmt.Errorf("Could not parse stdout as JSON: %q", string(line))
+		return fmt.Errorf("Could not parse stdout as JSON: %q", w.Mask(string(line)))
+	}
+	msg.Message = w.Mask(msg.Message)
+	if msg.Type == konnectorMsgTypeInputRequest {
+		return w.relayInput(ctx, i, line)
+	}
+	if msg.Type == konnectorMsgTypeSummary {
+		summary, err := konnectorsummary.Parse(line)
+		if err != nil {
+			w.Logger(ctx).Warnf("Invalid summary: %s", err)
+			return nil
+		}
+		w.summary = summary
+		return nil
 	}
 
 	// Truncate very long messages
@@ -597,6 +728,10 @@ func (w *konnectorWorker) ScanOutput(ctx *job.WorkerContext, i *instance.Instanc
 		msg.Message = msg.Message[:4000]
 	}
 
+	if w.logs != nil {
+		w.logs.Add(msg.Type, msg.Message)
+	}
+
 	log := w.Logger(ctx)
 	switch msg.Type {
 	case konnectorMsgTypeDebug, konnectorMsgTypeInfo:
@@ -627,6 +762,72 @@ func (w *konnectorWorker) ScanOutput(ctx *job.WorkerContext, i *instance.Instanc
 	return nil
 }
 
+// SetStdin is used to write the inputs of the user on the stdin of the
+// konnector.
+func (w *konnectorWorker) SetStdin(stdin io.Writer) {
+	w.stdin = stdin
+}
+
+// relayInput asks the user for the input requested by the konnector, and
+// writes the answer on the stdin of the konnector. The konnector receives an
+// error instead of the value if the user has not answered in time. The answer
+// is waited in another goroutine, as the konnector can continue to write on
+// its stdout in the meantime.
+func (w *konnectorWorker) relayInput(ctx *job.WorkerContext, i *instance.Instance, line []byte) error {
+	if w.stdin == nil {
+		return errors.New("Inputs cannot be relayed to a remote execution")
+	}
+	var msg struct {
+		ID      string `json:"id"`
+		Kind    string `json:"kind"`
+		Label   string `json:"label"`
+		Image   string `json:"image"`
+		Timeout int    `json:"timeout"` // in seconds
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return fmt.Errorf("Could not parse input request: %s", err)
+	}
+	if w.logs != nil {
+		w.logs.Add(konnectorMsgTypeInfo, "Input requested: "+msg.Kind)
+	}
+
+	req := &konnectorinput.Request{
+		JobID:     ctx.ID(),
+		Konnector: w.slug,
+		Kind:      msg.Kind,
+		Label:     msg.Label,
+		Image:     msg.Image,
+	}
+	if w.msg != nil {
+		req.Account = w.msg.Account
+	}
+	res := map[string]interface{}{
+		"type": konnectorMsgTypeInputResponse,
+		"id":   msg.ID,
+	}
+	timeout := konnectorinput.Timeout(time.Duration(msg.Timeout) * time.Second)
+	go func() {
+		value, err := konnectorinput.Ask(ctx, i, req, timeout)
+		if err != nil {
+			w.Logger(ctx).Infof("Input not received: %s", err)
+			res["error"] = err.Error()
+		} else {
+			res["value"] = value
+		}
+		buf, err := json.Marshal(res)
+		if err != nil {
+			w.Logger(ctx).Warnf("Cannot serialize the input response: %s", err)
+			return
+		}
+		w.stdinMu.Lock()
+		defer w.stdinMu.Unlock()
+		if _, err := w.stdin.Write(append(buf, '\n')); err != nil {
+			w.Logger(ctx).Infof("Cannot write the input response: %s", err)
+		}
+	}()
+	return nil
+}
+
 func (w *konnectorWorker) Error(i *instance.Instance, err error) error {
 	if w.err != nil {
 		return w.err
@@ -666,5 +867,55 @@ func (w *konnectorWorker) Commit(ctx *job.WorkerContext, errjob error) error {
 	} else {
 		log.Infof("Konnector failure: %s", errjob)
 	}
+	if w.man != nil {
+		class := ""
+		if errjob != nil {
+			class = konnectorErrorClass(errjob)
+		}
+		konnectortelemetry.Record(ctx.Instance.ContextName, w.slug, w.man.Version(), class)
+	}
+	if w.logs != nil {
+		if err := w.logs.Save(ctx.Instance, errjob); err != nil {
+			log.Warnf("Cannot save the logs of the execution: %s", err)
+		}
+	}
+	if err := w.saveSummary(ctx, errjob); err != nil {
+		log.Warnf("Cannot save the summary of the execution: %s", err)
+	}
 	return nil
 }
+
+// saveSummary persists the summary of the execution, with a default one
+// generated from the files created for the account when the konnector has not
+// sent its own summary.
+func (w *konnectorWorker) saveSummary(ctx *job.WorkerContext, errjob error) error {
+	if w.msg == nil || w.man == nil || w.msg.AccountDeleted {
+		return nil
+	}
+	summary := w.summary
+	if summary == nil {
+		var err error
+		summary, err = konnectorsummary.Default(ctx.Instance, w.msg.Account, w.startedAt)
+		if err != nil {
+			return err
+		}
+	}
+	summary.DocID = ctx.JobID()
+	summary.Slug = w.slug
+	summary.Account = w.msg.Account
+	summary.StartedAt = w.startedAt
+	summary.FinishedAt = time.Now().UTC()
+	summary.State = konnectorsummary.StateDone
+	if errjob != nil {
+		summary.State = konnectorsummary.StateErrored
+	}
+	return konnectorsummary.Save(ctx.Instance, summary)
+}
+
+// ScanStderr keeps the lines written by the konnector on stderr in the logs
+// of the execution.
+func (w *konnectorWorker) ScanStderr(ctx *job.WorkerContext, i *instance.Instance, line string) {
+	if w.logs != nil {
+		w.logs.Add(konnectorMsgTypeError, line)
+	}
+}
@@ -0,0 +1,98 @@
+package exec
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+)
+
+// secretMask replaces the values of the secrets in the logs of a konnector.
+const secretMask = "********"
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// konnectorEnv is the list of environment variables added by the context of
+// an instance to the executions of a konnector. They are configured with:
+//
+//	contexts:
+//	  my-context:
+//	    konnectors_env:
+//	      my-konnector:
+//	        env:
+//	          API_URL: https://api.example.net
+//	        secrets:
+//	          API_TOKEN: '{{ vault "secret/data/cozy/konnectors" "token" }}'
+//
+// The names are uppercased, as the keys are case-insensitive in the config
+// file. The secrets are injected like the other variables, but their values
+// are masked in the logs of the executions.
+type konnectorEnv struct {
+	Env     []string
+	Secrets []string
+}
+
+// contextKonnectorEnv returns the environment variables for the given
+// konnector in the given context, from the config file. The variables are
+// sorted by name, and the secrets come after the other variables.
+func contextKonnectorEnv(contextName, slug string) *konnectorEnv {
+	env := &konnectorEnv{}
+	context, _ := config.GetConfig().Contexts[contextName].(map[string]interface{})
+	konnectors, _ := context["konnectors_env"].(map[string]interface{})
+	vars, _ := konnectors[slug].(map[string]interface{})
+	for _, kv := range envVars(slug, vars["env"]) {
+		env.Env = append(env.Env, kv[0]+"="+kv[1])
+	}
+	for _, kv := range envVars(slug, vars["secrets"]) {
+		env.Env = append(env.Env, kv[0]+"="+kv[1])
+		if kv[1] != "" {
+			env.Secrets = append(env.Secrets, kv[1])
+		}
+	}
+	return env
+}
+
+func envVars(slug string, raw interface{}) [][2]string {
+	vars, _ := raw.(map[string]interface{})
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([][2]string, 0, len(names))
+	for _, key := range names {
+		name := strings.ToUpper(key)
+		// The COZY_* variables are set by the stack and can't be overridden
+		if !envNameRegexp.MatchString(name) || strings.HasPrefix(name, "COZY_") {
+			logger.WithNamespace("konnectors").
+				Warnf("Invalid environment variable %q for the konnector %s", name, slug)
+			continue
+		}
+		var value string
+		switch v := vars[key].(type) {
+		case string:
+			value = v
+		case nil:
+		default:
+			value = fmt.Sprintf("%v", v)
+		}
+		res = append(res, [2]string{name, value})
+	}
+	return res
+}
+
+// Mask replaces the values of the secrets in a message written by the
+// konnector.
+func (e *konnectorEnv) Mask(msg string) string {
+	if e == nil {
+		return msg
+	}
+	for _, secret := range e.Secrets {
+		msg = strings.ReplaceAll(msg, secret, secretMask)
+	}
+	return msg
+}
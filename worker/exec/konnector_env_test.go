@@ -0,0 +1,52 @@
+package exec
+
+import (
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKonnectorEnv(t *testing.T) {
+	config.UseTestFile(t)
+	cfg := config.GetConfig()
+	cfg.Contexts = map[string]interface{}{
+		"beta": map[string]interface{}{
+			"konnectors_env": map[string]interface{}{
+				"bank": map[string]interface{}{
+					"env": map[string]interface{}{
+						"api_url":  "https://api.example.net",
+						"retries":  3,
+						"cozy_url": "https://evil.example.net",
+						"bad-name": "x",
+					},
+					"secrets": map[string]interface{}{
+						"api_token": "s3cr3t",
+					},
+				},
+			},
+		},
+	}
+	defer func() { cfg.Contexts = nil }()
+
+	t.Run("Env", func(t *testing.T) {
+		env := contextKonnectorEnv("beta", "bank")
+		assert.Equal(t, []string{
+			"API_URL=https://api.example.net",
+			"RETRIES=3",
+			"API_TOKEN=s3cr3t",
+		}, env.Env)
+		assert.Equal(t, []string{"s3cr3t"}, env.Secrets)
+
+		assert.Empty(t, contextKonnectorEnv("beta", "other").Env)
+		assert.Empty(t, contextKonnectorEnv("default", "bank").Env)
+	})
+
+	t.Run("Mask", func(t *testing.T) {
+		env := contextKonnectorEnv("beta", "bank")
+		assert.Equal(t, "token is ********", env.Mask("token is s3cr3t"))
+
+		var none *konnectorEnv
+		assert.Equal(t, "token is s3cr3t", none.Mask("token is s3cr3t"))
+	})
+}
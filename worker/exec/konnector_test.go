@@ -3,6 +3,7 @@ package exec
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path"
 	"strings"
@@ -448,3 +449,11 @@ func loadLocale() error {
 	}
 	return nil
 }
+
+func TestKonnectorErrorClass(t *testing.T) {
+	assert.Equal(t, "LOGIN_FAILED", konnectorErrorClass(errors.New("LOGIN_FAILED")))
+	assert.Equal(t, "VENDOR_DOWN.BANK_DOWN", konnectorErrorClass(errors.New("VENDOR_DOWN.BANK_DOWN")))
+	assert.Equal(t, "NETWORK", konnectorErrorClass(errors.New("request failed: read ECONNRESET")))
+	assert.Equal(t, "NETWORK", konnectorErrorClass(&net.OpError{Op: "dial", Err: errors.New("refused")}))
+	assert.Equal(t, job.DefaultErrorClass, konnectorErrorClass(errors.New("exit status 1")))
+}
@@ -0,0 +1,31 @@
+package exec
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/konnectorlog"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "clean-konnector-logs",
+		Concurrency:  runtime.NumCPU() * 4,
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      1 * time.Hour,
+		WorkerFunc:   WorkerCleanKonnectorLogs,
+	})
+}
+
+// WorkerCleanKonnectorLogs is a worker used to delete the logs of the
+// executions of the konnectors that are older than the retention period
+// (konnectors.logs_retention in the config file).
+func WorkerCleanKonnectorLogs(ctx *job.WorkerContext) error {
+	count, err := konnectorlog.CleanOld(ctx.Instance)
+	if count > 0 {
+		ctx.Logger().Infof("%d konnector logs deleted", count)
+	}
+	return err
+}
@@ -0,0 +1,408 @@
+package exec
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	build "github.com/cozy/cozy-stack/pkg/config"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+)
+
+// ErrNoRemoteAgent is used when the konnectors must be executed on remote
+// agents, but none of them is available.
+var ErrNoRemoteAgent = errors.New("No remote agent is available for executing the konnector")
+
+// errRemoteStreamTooLarge is used when an agent sends more events than
+// accepted for an execution.
+var errRemoteStreamTooLarge = errors.New("the events sent by the remote agent are too large")
+
+const (
+	// maxRemoteEventSize is the maximal size of an event sent by an agent. It
+	// is enough for the largest artifact kept, encoded in base64.
+	maxRemoteEventSize = 2 << 20
+	// maxRemoteStreamSize is the maximal size of all the events sent by an
+	// agent for an execution.
+	maxRemoteStreamSize = 64 << 20
+)
+
+// Types of the events sent by a remote agent
+const (
+	remoteEventStdout   = "stdout"
+	remoteEventStderr   = "stderr"
+	remoteEventArtifact = "artifact"
+	remoteEventExit     = "exit"
+)
+
+// remoteRunner is implemented by the workers whose executions can be
+// dispatched to a remote agent. RootDir is the directory sent to the agent,
+// that contains the working directory of the execution.
+type remoteRunner interface {
+	RootDir() string
+}
+
+// artifactRecorder is implemented by the workers that keep the artifacts
+// produced by a remote execution.
+type artifactRecorder interface {
+	AddArtifact(name, mime string, data []byte)
+}
+
+// remoteExecution is the description of an execution sent to an agent.
+type remoteExecution struct {
+	JobID      string   `json:"job_id"`
+	Slug       string   `json:"slug"`
+	Entrypoint string   `json:"entrypoint"`
+	Env        []string `json:"env"`
+}
+
+// remoteEvent is an event streamed back by an agent, as a line of JSON.
+type remoteEvent struct {
+	Type string `json:"type"`
+	// Data is the line written on stdout or stderr
+	Data string `json:"data,omitempty"`
+	// Name, Mime and Content are used for the artifacts
+	Name    string `json:"name,omitempty"`
+	Mime    string `json:"mime,omitempty"`
+	Content []byte `json:"content,omitempty"`
+	// Code and Error are used for the exit event
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+// remoteClient is used for the executions. There is no timeout, as the
+// response is streamed during the whole execution, but the requests are made
+// with the context of the job.
+var remoteClient = &http.Client{}
+
+// healthClient is used for the health checks of the agents.
+var healthClient = &http.Client{Timeout: 10 * time.Second}
+
+type remoteAgent struct {
+	url     string
+	healthy int32
+}
+
+func (a *remoteAgent) isHealthy() bool { return atomic.LoadInt32(&a.healthy) == 1 }
+
+func (a *remoteAgent) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&a.healthy, v)
+}
+
+// remotePool is the pool of the agents that can execute the konnectors. The
+// executions are dispatched to the healthy agents with a round-robin.
+type remotePool struct {
+	agents []*remoteAgent
+	secret string
+	next   uint32
+}
+
+var (
+	remotePoolOnce sync.Once
+	globalPool     *remotePool
+)
+
+func useRemoteAgents() bool {
+	return len(config.GetConfig().Konnectors.Remote.Agents) > 0
+}
+
+func getRemotePool() *remotePool {
+	remotePoolOnce.Do(func() {
+		cfg := config.GetConfig().Konnectors.Remote
+		globalPool = newRemotePool(cfg.Agents, cfg.Secret)
+		go globalPool.healthCheckLoop(cfg.HealthCheckInterval)
+	})
+	return globalPool
+}
+
+func newRemotePool(urls []string, secret string) *remotePool {
+	p := &remotePool{secret: secret}
+	for _, u := range urls {
+		if err := checkAgentURL(u); err != nil {
+			logger.WithNamespace("konnectors").
+				Errorf("Remote agent %s is ignored: %s", u, err)
+			continue
+		}
+		// The agents are considered healthy until a check says otherwise
+		p.agents = append(p.agents, &remoteAgent{
+			url:     strings.TrimSuffix(u, "/"),
+			healthy: 1,
+		})
+	}
+	return p
+}
+
+// checkAgentURL returns an error if the URL can't be used for an agent: the
+// secret is sent with the requests, so only the https URLs are accepted,
+// except for the development releases.
+func checkAgentURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid URL")
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || !build.IsDevRelease()) {
+		return errors.New("https is required")
+	}
+	return nil
+}
+
+// candidates returns the healthy agents, starting with the next one for the
+// round-robin.
+func (p *remotePool) candidates() []*remoteAgent {
+	n := len(p.agents)
+	if n == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint32(&p.next, 1) % uint32(n))
+	var agents []*remoteAgent
+	for i := 0; i < n; i++ {
+		agent := p.agents[(start+i)%n]
+		if agent.isHealthy() {
+			agents = append(agents, agent)
+		}
+	}
+	return agents
+}
+
+func (p *remotePool) healthCheckLoop(interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.checkAgents()
+	}
+}
+
+func (p *remotePool) checkAgents() {
+	for _, agent := range p.agents {
+		healthy := p.checkAgent(agent)
+		if healthy != agent.isHealthy() {
+			logger.WithNamespace("konnectors").
+				Infof("Remote agent %s is now healthy=%t", agent.url, healthy)
+		}
+		agent.setHealthy(healthy)
+	}
+}
+
+func (p *remotePool) checkAgent(agent *remoteAgent) bool {
+	req, err := http.NewRequest(http.MethodGet, agent.url+"/health", nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secret)
+	res, err := healthClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	return res.StatusCode == http.StatusOK
+}
+
+// runRemote dispatches an execution to a remote agent, and processes the
+// events streamed back by the agent until the end of the execution.
+func runRemote(ctx *job.WorkerContext, pool *remotePool, worker execWorker, rootDir, workDir string, env []string, stderr io.Writer) error {
+	entrypoint, err := filepath.Rel(rootDir, workDir)
+	if err != nil {
+		return err
+	}
+	execution := &remoteExecution{
+		JobID:      ctx.JobID(),
+		Slug:       worker.Slug(),
+		Entrypoint: filepath.ToSlash(entrypoint),
+		Env:        env,
+	}
+
+	log := worker.Logger(ctx)
+	agents := pool.candidates()
+	if len(agents) == 0 {
+		return ErrNoRemoteAgent
+	}
+	var lastErr error
+	for _, agent := range agents {
+		res, err := pool.dispatch(ctx, agent, execution, rootDir)
+		if err != nil {
+			if ctx.Err() != nil {
+				return wrapErr(ctx, ctx.Err())
+			}
+			log.Warnf("Cannot dispatch the execution to %s: %s", agent.url, err)
+			lastErr = err
+			continue
+		}
+		defer res.Body.Close()
+		log.Debugf("Execution dispatched to %s", agent.url)
+		err = readRemoteEvents(ctx, worker, res.Body, stderr)
+		return wrapErr(ctx, err)
+	}
+	return lastErr
+}
+
+// dispatch sends the execution to the agent: the description of the
+// execution and an archive of the directory, in a multipart body.
+func (p *remotePool) dispatch(ctx *job.WorkerContext, agent *remoteAgent, execution *remoteExecution, rootDir string) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := writeExecution(mw, execution, rootDir)
+		if errc := mw.Close(); err == nil {
+			err = errc
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agent.url+"/executions", pr)
+	if err != nil {
+		_ = pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secret)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	res, err := remoteClient.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			agent.setHealthy(false)
+		}
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		_ = pr.Close()
+		return nil, fmt.Errorf("the agent has responded with %d: %s", res.StatusCode, body)
+	}
+	return res, nil
+}
+
+func writeExecution(mw *multipart.Writer, execution *remoteExecution, rootDir string) error {
+	part, err := mw.CreateFormField("execution")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(part).Encode(execution); err != nil {
+		return err
+	}
+	part, err = mw.CreateFormFile("workdir", "workdir.tar.gz")
+	if err != nil {
+		return err
+	}
+	return writeTarGz(part, rootDir)
+}
+
+// writeTarGz writes the content of the directory as a gzipped tar archive.
+func writeTarGz(w io.Writer, rootDir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err := filepath.Walk(rootDir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootDir, name)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		if errc := f.Close(); err == nil {
+			err = errc
+		}
+		return err
+	})
+	if errc := tw.Close(); err == nil {
+		err = errc
+	}
+	if errc := gw.Close(); err == nil {
+		err = errc
+	}
+	return err
+}
+
+// readRemoteEvents processes the events sent by the agent, as lines of JSON,
+// until the exit event. The size of the events is capped.
+func readRemoteEvents(ctx *job.WorkerContext, worker execWorker, body io.Reader, stderr io.Writer) error {
+	log := worker.Logger(ctx)
+	limited := &io.LimitedReader{R: body, N: maxRemoteStreamSize}
+	scanner := bufio.NewScanner(limited)
+	scanner.Buffer(make([]byte, 64*1024), maxRemoteEventSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event remoteEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			if limited.N <= 0 {
+				return errRemoteStreamTooLarge
+			}
+			return err
+		}
+		switch event.Type {
+		case remoteEventStdout:
+			if err := worker.ScanOutput(ctx, ctx.Instance, []byte(event.Data)); err != nil {
+				log.Debug(err.Error())
+			}
+		case remoteEventStderr:
+			_, _ = io.WriteString(stderr, event.Data+"\n")
+		case remoteEventArtifact:
+			if recorder, ok := worker.(artifactRecorder); ok {
+				recorder.AddArtifact(event.Name, event.Mime, event.Content)
+			}
+		case remoteEventExit:
+			if event.Error != "" {
+				return errors.New(event.Error)
+			}
+			if event.Code != 0 {
+				return fmt.Errorf("exit status %d", event.Code)
+			}
+			return nil
+		default:
+			log.Debugf("Unknown event from the remote agent: %q", event.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return errRemoteStreamTooLarge
+		}
+		return err
+	}
+	if limited.N <= 0 {
+		return errRemoteStreamTooLarge
+	}
+	return errors.New("the remote agent has closed the connection before the end of the execution")
+}
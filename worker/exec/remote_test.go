@@ -0,0 +1,204 @@
+package exec
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	build "github.com/cozy/cozy-stack/pkg/config"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRemoteWorker struct {
+	lines     []string
+	artifacts []string
+}
+
+func (w *fakeRemoteWorker) Slug() string { return "fake" }
+func (w *fakeRemoteWorker) PrepareWorkDir(ctx *job.WorkerContext, i *instance.Instance) (string, func(), error) {
+	return "", func() {}, nil
+}
+func (w *fakeRemoteWorker) PrepareCmdEnv(ctx *job.WorkerContext, i *instance.Instance) (string, []string, error) {
+	return "", nil, nil
+}
+func (w *fakeRemoteWorker) ScanOutput(ctx *job.WorkerContext, i *instance.Instance, line []byte) error {
+	w.lines = append(w.lines, string(line))
+	return nil
+}
+func (w *fakeRemoteWorker) Error(i *instance.Instance, err error) error       { return err }
+func (w *fakeRemoteWorker) Logger(ctx *job.WorkerContext) logger.Logger       { return ctx.Logger() }
+func (w *fakeRemoteWorker) Commit(ctx *job.WorkerContext, errjob error) error { return nil }
+func (w *fakeRemoteWorker) AddArtifact(name, mime string, data []byte) {
+	w.artifacts = append(w.artifacts, name+":"+string(data))
+}
+
+func TestRemoteExecution(t *testing.T) {
+	config.UseTestFile(t)
+	// The agents of the tests are not using https
+	build.BuildMode = build.ModeDev
+	rootDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "lib"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "index.js"), []byte("main"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "lib", "delete.js"), []byte("delete"), 0640))
+
+	j := &job.Job{JobID: "job-id", Domain: "cozy.example.net"}
+	ctx := job.NewWorkerContext("id", j, nil)
+
+	t.Run("Success", func(t *testing.T) {
+		var received remoteExecution
+		files := map[string]string{}
+		agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/executions", r.URL.Path)
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			mr, err := r.MultipartReader()
+			require.NoError(t, err)
+			part, err := mr.NextPart()
+			require.NoError(t, err)
+			assert.Equal(t, "execution", part.FormName())
+			require.NoError(t, json.NewDecoder(part).Decode(&received))
+			part, err = mr.NextPart()
+			require.NoError(t, err)
+			assert.Equal(t, "workdir", part.FormName())
+			gr, err := gzip.NewReader(part)
+			require.NoError(t, err)
+			tr := tar.NewReader(gr)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				content, _ := io.ReadAll(tr)
+				files[hdr.Name] = string(content)
+			}
+
+			_, _ = w.Write([]byte(`{"type":"stdout","data":"{\"type\":\"info\",\"message\":\"hello\"}"}
+{"type":"stderr","data":"oops"}
+{"type":"artifact","name":"page.html","mime":"text/html","content":"PGh0bWw+"}
+{"type":"exit","code":0}
+`))
+		}))
+		defer agent.Close()
+
+		pool := newRemotePool([]string{agent.URL + "/"}, "secret")
+		worker := &fakeRemoteWorker{}
+		var stderr bytes.Buffer
+		workDir := filepath.Join(rootDir, "lib", "delete.js")
+		err := runRemote(ctx, pool, worker, rootDir, workDir, []string{"COZY_URL=https://cozy.example.net/"}, &stderr)
+		require.NoError(t, err)
+
+		assert.Equal(t, "job-id", received.JobID)
+		assert.Equal(t, "fake", received.Slug)
+		assert.Equal(t, "lib/delete.js", received.Entrypoint)
+		assert.Equal(t, []string{"COZY_URL=https://cozy.example.net/"}, received.Env)
+		assert.Equal(t, "main", files["index.js"])
+		assert.Equal(t, "delete", files["lib/delete.js"])
+		assert.Equal(t, []string{`{"type":"info","message":"hello"}`}, worker.lines)
+		assert.Equal(t, "oops\n", stderr.String())
+		assert.Equal(t, []string{"page.html:<html>"}, worker.artifacts)
+	})
+
+	t.Run("ExitCode", func(t *testing.T) {
+		agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"type":"exit","code":1}`))
+		}))
+		defer agent.Close()
+
+		pool := newRemotePool([]string{agent.URL}, "secret")
+		err := runRemote(ctx, pool, &fakeRemoteWorker{}, rootDir, rootDir, nil, io.Discard)
+		assert.EqualError(t, err, "exit status 1")
+	})
+
+	t.Run("ConnectionClosed", func(t *testing.T) {
+		agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"type":"stdout","data":"{}"}`))
+		}))
+		defer agent.Close()
+
+		pool := newRemotePool([]string{agent.URL}, "secret")
+		err := runRemote(ctx, pool, &fakeRemoteWorker{}, rootDir, rootDir, nil, io.Discard)
+		assert.Error(t, err)
+	})
+
+	t.Run("EventTooLarge", func(t *testing.T) {
+		agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data := strings.Repeat("a", maxRemoteEventSize)
+			_, _ = w.Write([]byte(`{"type":"stdout","data":"` + data + `"}` + "\n"))
+			_, _ = w.Write([]byte(`{"type":"exit","code":0}`))
+		}))
+		defer agent.Close()
+
+		pool := newRemotePool([]string{agent.URL}, "secret")
+		err := runRemote(ctx, pool, &fakeRemoteWorker{}, rootDir, rootDir, nil, io.Discard)
+		assert.ErrorIs(t, err, errRemoteStreamTooLarge)
+	})
+
+	t.Run("HTTPSRequired", func(t *testing.T) {
+		build.BuildMode = build.ModeProd
+		defer func() { build.BuildMode = build.ModeDev }()
+
+		pool := newRemotePool([]string{"http://agent.example.net", "https://agent.example.net"}, "secret")
+		require.Len(t, pool.agents, 1)
+		assert.Equal(t, "https://agent.example.net", pool.agents[0].url)
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer busy.Close()
+		down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		down.Close()
+		ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"type":"exit","code":0}`))
+		}))
+		defer ok.Close()
+
+		pool := newRemotePool([]string{busy.URL, down.URL, ok.URL}, "secret")
+		for i := 0; i < 3; i++ {
+			err := runRemote(ctx, pool, &fakeRemoteWorker{}, rootDir, rootDir, nil, io.Discard)
+			assert.NoError(t, err)
+		}
+		assert.True(t, pool.agents[0].isHealthy())
+		assert.False(t, pool.agents[1].isHealthy())
+
+		pool = newRemotePool([]string{down.URL}, "secret")
+		err := runRemote(ctx, pool, &fakeRemoteWorker{}, rootDir, rootDir, nil, io.Discard)
+		assert.Error(t, err)
+		err = runRemote(ctx, pool, &fakeRemoteWorker{}, rootDir, rootDir, nil, io.Discard)
+		assert.ErrorIs(t, err, ErrNoRemoteAgent)
+	})
+
+	t.Run("HealthCheck", func(t *testing.T) {
+		healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" && r.Header.Get("Authorization") == "Bearer secret" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer healthy.Close()
+
+		pool := newRemotePool([]string{healthy.URL}, "secret")
+		pool.agents[0].setHealthy(false)
+		pool.checkAgents()
+		assert.True(t, pool.agents[0].isHealthy())
+
+		pool = newRemotePool([]string{healthy.URL}, "wrong")
+		pool.checkAgents()
+		assert.False(t, pool.agents[0].isHealthy())
+	})
+}
@@ -0,0 +1,84 @@
+package fsck
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+func init() {
+	// Those workers scan the whole databases of an instance, and their
+	// concurrency is kept low to not saturate CouchDB.
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "fsck",
+		Concurrency:  1,
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerFsck,
+	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "clean-references",
+		Concurrency:  1,
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerCleanReferences,
+	})
+}
+
+// Message is the message for the fsck worker.
+type Message struct {
+	Mode vfs.FsckMode `json:"mode"`
+}
+
+// WorkerFsck is a worker that looks for the orphan objects (in the storage,
+// but without a document in the index) and the ghosts (documents in the
+// index without an object in the storage). The orphans can be reclaimed or
+// restored, and a report is persisted with the job ID as its identifier.
+func WorkerFsck(ctx *job.WorkerContext) error {
+	var msg Message
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	if msg.Mode == "" {
+		msg.Mode = vfs.FsckModeReport
+	}
+	if !msg.Mode.Valid() {
+		return fmt.Errorf("fsck: invalid mode %q", msg.Mode)
+	}
+
+	report := vfs.NewFsckReport(ctx.ID(), msg.Mode)
+	if err := report.Run(ctx.Instance.VFS()); err != nil {
+		return err
+	}
+	ctx.Logger().Infof("fsck %s: %d orphans (%d bytes), %d ghosts, %d reclaimed, %d restored, %d failures",
+		report.Mode, report.Orphans, report.OrphansSize, report.Ghosts,
+		report.Reclaimed, report.Restored, report.Failures)
+	return couchdb.CreateNamedDocWithDB(ctx.Instance, report)
+}
+
+// ReferencesMessage is the message for the clean-references worker.
+type ReferencesMessage struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// WorkerCleanReferences is a worker that removes the references on the files
+// to the albums and sharings that have been deleted.
+func WorkerCleanReferences(ctx *job.WorkerContext) error {
+	var msg ReferencesMessage
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	report, err := vfs.CleanDanglingReferences(ctx.Instance.VFS(), msg.DryRun)
+	if err != nil {
+		return err
+	}
+	ctx.Logger().Infof("clean-references: %d files scanned, %d files updated, dangling references: %v (dry run: %v)",
+		report.FilesScanned, report.FilesUpdated, report.Dangling, report.DryRun)
+	return nil
+}
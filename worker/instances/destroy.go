@@ -0,0 +1,28 @@
+package instances
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance/lifecycle"
+	"github.com/cozy/cozy-stack/model/job"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   lifecycle.DestroyWorkerType,
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerDestroy,
+	})
+}
+
+// WorkerDestroy is a worker that destroys an instance at the end of the
+// grace period after the deletion has been requested.
+func WorkerDestroy(ctx *job.WorkerContext) error {
+	domain := ctx.Instance.Domain
+	ctx.Logger().Infof("Destroying the instance %s", domain)
+	return lifecycle.DestroyIfScheduled(domain)
+}
@@ -0,0 +1,31 @@
+package instances
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/feature"
+	"github.com/cozy/cozy-stack/model/job"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   feature.PublishWorkerType,
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      time.Hour,
+		WorkerFunc:   WorkerPublishFlags,
+	})
+}
+
+// WorkerPublishFlags is a worker that sends the feature flags on the realtime
+// hub for the instances of a context, after the flags of this context or the
+// default flags have been modified.
+func WorkerPublishFlags(ctx *job.WorkerContext) error {
+	var msg feature.PublishMessage
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	return feature.PublishAllChanges(ctx, msg.ContextName)
+}
@@ -0,0 +1,35 @@
+package mails
+
+import (
+	"net/url"
+	"path"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/assets"
+)
+
+// brandingLogo is the name of the asset that can be added to a context to
+// replace the Cozy header of the mails by the logo of a partner.
+const brandingLogo = "/mails/logo.png"
+
+// addBrandingValues adds to the data of a mail template the values used to
+// brand the mail for the context of the instance. The values already in the
+// data are not overridden.
+func addBrandingValues(inst *instance.Instance, data map[string]interface{}) {
+	if inst == nil {
+		return
+	}
+	if _, ok := data["BrandingLogo"]; ok {
+		return
+	}
+	f, ok := assets.Head(brandingLogo, inst.ContextName)
+	if !ok || !f.IsCustom {
+		return
+	}
+	name := f.NameWithSum
+	if name == "" {
+		name = f.Name
+	}
+	p := path.Join("/assets/ext", url.PathEscape(f.Context), name)
+	data["BrandingLogo"] = inst.PageURL(p, nil)
+}
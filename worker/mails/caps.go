@@ -0,0 +1,189 @@
+package mails
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/notification"
+	"github.com/cozy/cozy-stack/model/notification/center"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/consts"
+	"github.com/cozy/cozy-stack/pkg/limits"
+	"github.com/cozy/cozy-stack/pkg/mail"
+	"github.com/cozy/cozy-stack/pkg/metrics"
+)
+
+// ErrMailCapExceeded is used when a mail is dropped because the daily cap has
+// been reached, and the overflow queue is full.
+var ErrMailCapExceeded = errors.New("The daily cap of mails has been exceeded")
+
+// uncappedTemplates are the templates of the mails sent by the stack to the
+// user that are not counted in the daily caps, as the user may need them to
+// log in or to secure their account.
+var uncappedTemplates = map[string]bool{
+	"passphrase_hint":              true,
+	"passphrase_reset":             true,
+	"magic_link":                   true,
+	"two_factor":                   true,
+	"two_factor_mail_confirmation": true,
+	"confirm_flagship":             true,
+	"update_email":                 true,
+}
+
+// mailCap is a cap on the number of mails sent during a day.
+type mailCap struct {
+	name  string // "instance" or "context", for the logs and metrics
+	ct    limits.CounterType
+	key   string
+	limit int64
+}
+
+// dailyCaps returns the caps that apply to the mails sent by the instance on
+// the given day. The limits from the config can be overridden per context.
+func dailyCaps(inst *instance.Instance, now time.Time) []mailCap {
+	cfg := config.GetConfig()
+	perInstance := cfg.MailLimits.PerInstance
+	perContext := cfg.MailLimits.PerContext
+	if ctxConfig, ok := cfg.MailPerContext[inst.ContextName].(map[string]interface{}); ok {
+		if limit, ok := limitFromConfig(ctxConfig["daily_limit"]); ok {
+			perInstance = limit
+		}
+		if limit, ok := limitFromConfig(ctxConfig["context_daily_limit"]); ok {
+			perContext = limit
+		}
+	}
+
+	day := now.UTC().Format("2006-01-02")
+	var caps []mailCap
+	if perInstance > 0 {
+		caps = append(caps, mailCap{
+			name:  "instance",
+			ct:    limits.MailDailyType,
+			key:   inst.Domain + ":" + day,
+			limit: perInstance,
+		})
+	}
+	if perContext > 0 {
+		contextName := inst.ContextName
+		if contextName == "" {
+			contextName = config.DefaultInstanceContext
+		}
+		caps = append(caps, mailCap{
+			name:  "context",
+			ct:    limits.MailContextDailyType,
+			key:   contextName + ":" + day,
+			limit: perContext,
+		})
+	}
+	return caps
+}
+
+func limitFromConfig(raw interface{}) (int64, bool) {
+	switch limit := raw.(type) {
+	case int:
+		return int64(limit), true
+	case int64:
+		return limit, true
+	case float64:
+		return int64(limit), true
+	case string:
+		l, err := strconv.ParseInt(limit, 10, 64)
+		return l, err == nil
+	}
+	return 0, false
+}
+
+// isCapped returns false for the mails that are not counted in the daily caps.
+func isCapped(opts *mail.Options) bool {
+	switch opts.Mode {
+	case mail.ModeFromStack, mail.ModePendingEmail:
+		return !uncappedTemplates[opts.TemplateName]
+	}
+	return true
+}
+
+// overflowTime returns when a mail from the overflow queue will be sent. The
+// mails of the overflow queue are spread over the next day, so that they
+// trickle instead of being all sent at midnight.
+func overflowTime(now time.Time, position, limit int64) time.Time {
+	y, m, d := now.UTC().Date()
+	tomorrow := time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+	interval := 24 * time.Hour / time.Duration(limit)
+	return tomorrow.Add(time.Duration(position) * interval)
+}
+
+// checkDailyCaps counts the mail in the daily caps. When a cap has been
+// reached, the mail is put in the overflow queue (an @at trigger) and true is
+// returned. The overflow queue has the same size as the cap: when it is full,
+// the mail is dropped.
+func checkDailyCaps(ctx *job.WorkerContext, opts *mail.Options) (bool, error) {
+	if !isCapped(opts) {
+		return false, nil
+	}
+	now := time.Now()
+	limiter := config.GetRateLimiter()
+	for _, c := range dailyCaps(ctx.Instance, now) {
+		val, err := limiter.CheckRateLimitKeyWithLimit(c.key, c.ct, c.limit)
+		if !limits.IsLimitReachedOrExceeded(err) {
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		if errors.Is(err, limits.ErrRateLimitReached) {
+			ctx.Logger().Warnf("The daily cap of mails per %s has been reached (%d)", c.name, c.limit)
+			if c.name == "instance" {
+				notifyDailyCapReached(ctx.Instance, c.limit)
+			}
+		}
+
+		position := val - c.limit - 1
+		if position >= c.limit {
+			metrics.MailsCapsCounter.WithLabelValues(metrics.MailCapDropped, c.name).Inc()
+			return false, ErrMailCapExceeded
+		}
+		if err := deferMail(ctx.Instance, opts, overflowTime(now, position, c.limit)); err != nil {
+			return false, err
+		}
+		metrics.MailsCapsCounter.WithLabelValues(metrics.MailCapDeferred, c.name).Inc()
+		return true, nil
+	}
+	metrics.MailsCapsCounter.WithLabelValues(metrics.MailCapAccepted, "none").Inc()
+	return false, nil
+}
+
+func deferMail(inst *instance.Instance, opts *mail.Options, at time.Time) error {
+	msg, err := job.NewMessage(opts)
+	if err != nil {
+		return err
+	}
+	t, err := job.NewTrigger(inst, job.TriggerInfos{
+		Type:       "@at",
+		WorkerType: "sendmail",
+		Arguments:  at.Format(time.RFC3339),
+	}, msg)
+	if err != nil {
+		return err
+	}
+	return job.System().AddTrigger(t)
+}
+
+// notifyDailyCapReached sends a notification to the user, that can also be
+// seen by the apps, when the daily cap of mails has been reached.
+func notifyDailyCapReached(inst *instance.Instance, limit int64) {
+	n := &notification.Notification{
+		Title:             inst.Translate("Notifications Mails Limit Title"),
+		Message:           inst.Translate("Notifications Mails Limit Message"),
+		Slug:              consts.SettingsSlug,
+		Data:              map[string]interface{}{"limit": limit},
+		PreferredChannels: []string{"mobile"},
+	}
+	if err := center.PushStack(inst.Domain, center.NotificationMailsLimit, n); err != nil {
+		inst.Logger().WithNamespace("mails").
+			Warnf("Cannot notify that the daily cap of mails has been reached: %s", err)
+	}
+}
@@ -0,0 +1,66 @@
+package mails
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/limits"
+	"github.com/cozy/cozy-stack/pkg/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDailyCaps(t *testing.T) {
+	config.UseTestFile(t)
+	now := time.Date(2023, 6, 12, 15, 4, 5, 0, time.UTC)
+
+	t.Run("IsCapped", func(t *testing.T) {
+		assert.True(t, isCapped(&mail.Options{Mode: mail.ModeFromUser}))
+		assert.True(t, isCapped(&mail.Options{Mode: mail.ModeFromStack, TemplateName: "archiver"}))
+		assert.False(t, isCapped(&mail.Options{Mode: mail.ModeFromStack, TemplateName: "two_factor"}))
+		assert.True(t, isCapped(&mail.Options{Mode: mail.ModeFromUser, TemplateName: "two_factor"}))
+	})
+
+	t.Run("Caps", func(t *testing.T) {
+		cfg := config.GetConfig()
+		cfg.MailLimits = config.MailLimits{PerInstance: 100}
+		cfg.MailPerContext = map[string]interface{}{
+			"beta": map[string]interface{}{
+				"daily_limit":         20,
+				"context_daily_limit": "1000",
+			},
+		}
+		defer func() {
+			cfg.MailLimits = config.MailLimits{}
+			cfg.MailPerContext = nil
+		}()
+
+		inst := &instance.Instance{Domain: "alice.cozy.example"}
+		caps := dailyCaps(inst, now)
+		require.Len(t, caps, 1)
+		assert.Equal(t, limits.MailDailyType, caps[0].ct)
+		assert.Equal(t, "alice.cozy.example:2023-06-12", caps[0].key)
+		assert.EqualValues(t, 100, caps[0].limit)
+
+		inst.ContextName = "beta"
+		caps = dailyCaps(inst, now)
+		require.Len(t, caps, 2)
+		assert.EqualValues(t, 20, caps[0].limit)
+		assert.Equal(t, limits.MailContextDailyType, caps[1].ct)
+		assert.Equal(t, "beta:2023-06-12", caps[1].key)
+		assert.EqualValues(t, 1000, caps[1].limit)
+
+		cfg.MailLimits = config.MailLimits{}
+		inst.ContextName = ""
+		assert.Empty(t, dailyCaps(inst, now))
+	})
+
+	t.Run("OverflowTime", func(t *testing.T) {
+		tomorrow := time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, tomorrow, overflowTime(now, 0, 100))
+		assert.Equal(t, tomorrow.Add(6*time.Hour), overflowTime(now, 1, 4))
+		assert.Equal(t, tomorrow.Add(18*time.Hour), overflowTime(now, 3, 4))
+	})
+}
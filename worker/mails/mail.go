@@ -1,10 +1,13 @@
 package mails
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	netmail "net/mail"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,30 +39,39 @@ func SendMail(ctx *job.WorkerContext) error {
 	if err != nil {
 		return err
 	}
+	deferred, err := checkDailyCaps(ctx, &opts)
+	if err != nil {
+		if errors.Is(err, ErrMailCapExceeded) {
+			ctx.SetNoRetry()
+		}
+		return err
+	}
+	if deferred {
+		ctx.Logger().Infof("The mail has been put in the overflow queue")
+		return nil
+	}
 	from := config.GetConfig().NoReplyAddr
 	name := config.GetConfig().NoReplyName
 	replyTo := config.GetConfig().ReplyTo
 	if from == "" {
 		from = "noreply@" + utils.StripPort(ctx.Instance.Domain)
 	}
-	if ctxSettings, ok := ctx.Instance.SettingsContext(); ok {
-		if addr, ok := ctxSettings["noreply_address"].(string); ok && addr != "" {
+	ctxName := ctx.Instance.ContextName
+	cfgPerContext := config.GetConfig().MailPerContext
+	if ctxConfig, ok := cfgPerContext[ctxName].(map[string]interface{}); ok {
+		if addr, ok := ctxConfig["noreply_address"].(string); ok && addr != "" {
 			from = addr
 		}
-		if nname, ok := ctxSettings["noreply_name"].(string); ok && nname != "" {
+		if nname, ok := ctxConfig["noreply_name"].(string); ok && nname != "" {
 			name = nname
 		}
-		if reply, ok := ctxSettings["reply_to"].(string); ok && reply != "" {
+		if reply, ok := ctxConfig["reply_to"].(string); ok && reply != "" {
 			replyTo = reply
 		}
-	}
-	ctxName := ctx.Instance.ContextName
-	cfgPerContext := config.GetConfig().MailPerContext
-	if ctxConfig, ok := cfgPerContext[ctxName].(map[string]interface{}); ok {
 		if host, ok := ctxConfig["host"].(string); ok && host != "" {
-			port, _ := ctxConfig["port"].(int)
+			port := portFromConfig(ctxConfig["port"])
 			username, _ := ctxConfig["username"].(string)
-			password, _ := ctxConfig["username"].(string)
+			password, _ := ctxConfig["password"].(string)
 			disableTLS, _ := ctxConfig["disable_tls"].(bool)
 			skipCertValid, _ := ctxConfig["skip_certificate_validation"].(bool)
 			opts.Dialer = &gomail.DialerOptions{
@@ -72,6 +84,17 @@ func SendMail(ctx *job.WorkerContext) error {
 			}
 		}
 	}
+	if ctxSettings, ok := ctx.Instance.SettingsContext(); ok {
+		if addr, ok := ctxSettings["noreply_address"].(string); ok && addr != "" {
+			from = addr
+		}
+		if nname, ok := ctxSettings["noreply_name"].(string); ok && nname != "" {
+			name = nname
+		}
+		if reply, ok := ctxSettings["reply_to"].(string); ok && reply != "" {
+			replyTo = reply
+		}
+	}
 	switch opts.Mode {
 	case mail.ModeFromStack:
 		toAddr, err := addressFromInstance(ctx.Instance)
@@ -129,6 +152,19 @@ func SendMail(ctx *job.WorkerContext) error {
 	return err
 }
 
+func portFromConfig(raw interface{}) int {
+	switch port := raw.(type) {
+	case int:
+		return port
+	case float64:
+		return int(port)
+	case string:
+		p, _ := strconv.Atoi(port)
+		return p
+	}
+	return 0
+}
+
 func pendingAddress(i *instance.Instance) (*mail.Address, error) {
 	doc, err := i.SettingsDocument()
 	if err != nil {
@@ -185,18 +221,27 @@ func doSendMail(ctx *job.WorkerContext, opts *mail.Options, domain string) error
 	} else {
 		date = *opts.Date
 	}
-	toAddresses := make([]string, len(opts.To))
-	for i, to := range opts.To {
+	toAddresses := make([]string, 0, len(opts.To))
+	for _, to := range opts.To {
 		// See https://tools.ietf.org/html/rfc5322#section-3.4
 		// We want to use an email address in the "display-name <addr-spec>"
 		// format. If it is the case, the address is taken as is. Else, gomail
 		// is used to format it.
+		var addr string
 		to.Email = strings.TrimSpace(to.Email)
 		if strings.HasSuffix(to.Email, ">") {
-			toAddresses[i] = to.Email
+			addr = to.Email
 		} else {
-			toAddresses[i] = email.FormatAddress(to.Email, to.Name)
+			addr = email.FormatAddress(to.Email, to.Name)
 		}
+		if isBouncing(addr) {
+			ctx.Logger().Infof("sendmail: skip %s as previous mails have bounced", to.Email)
+			continue
+		}
+		toAddresses = append(toAddresses, addr)
+	}
+	if len(toAddresses) == 0 {
+		return nil
 	}
 
 	var parts []*mail.Part
@@ -243,11 +288,69 @@ func doSendMail(ctx *job.WorkerContext, opts *mail.Options, domain string) error
 		}))
 	}
 
+	return dialAndSend(ctx, dialerOptions, email)
+}
+
+// dialAndSend sends the mail to the SMTP server, after having signed it with
+// DKIM if it is configured for the context of the instance.
+func dialAndSend(ctx *job.WorkerContext, dialerOptions *gomail.DialerOptions, email *gomail.Message) error {
 	dialer := gomail.NewDialer(dialerOptions)
 	if deadline, ok := ctx.Deadline(); ok {
 		dialer.SetDeadline(deadline)
 	}
-	return dialer.DialAndSend(email)
+	dkim, err := config.GetMailDKIM(ctx.Instance.ContextName)
+	if err != nil {
+		return err
+	}
+	if dkim == nil {
+		return dialer.DialAndSend(email)
+	}
+
+	from, err := netmail.ParseAddress(strings.Join(email.GetHeader("From"), ","))
+	if err != nil {
+		return err
+	}
+	recipients, err := netmail.ParseAddressList(strings.Join(email.GetHeader("To"), ","))
+	if err != nil {
+		return err
+	}
+	to := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		to[i] = recipient.Address
+	}
+
+	key, err := mail.ParseDKIMPrivateKey(dkim.PrivateKey)
+	if err != nil {
+		return err
+	}
+	domain := dkim.Domain
+	if domain == "" {
+		domain = from.Address[strings.LastIndex(from.Address, "@")+1:]
+	}
+	var buf bytes.Buffer
+	if _, err := email.WriteTo(&buf); err != nil {
+		return err
+	}
+	signed, err := mail.SignDKIM(buf.Bytes(), domain, dkim.Selector, key, time.Now())
+	if err != nil {
+		return err
+	}
+
+	sender, err := dialer.Dial()
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+	return sender.Send(from.Address, to, bytes.NewReader(signed))
+}
+
+// isBouncing returns true if the mails sent to this address have bounced.
+func isBouncing(addr string) bool {
+	parsed, err := netmail.ParseAddress(addr)
+	if err != nil {
+		return false
+	}
+	return mail.IsBouncing(parsed.Address)
 }
 
 func addPart(mail *gomail.Message, part *mail.Part) error {
@@ -292,9 +395,5 @@ func sendSupportMail(ctx *job.WorkerContext, opts *mail.Options, domain string)
 	body, _ := opts.TemplateValues["Body"].(string)
 	email.AddAlternative("text/plain", intro+body+"\n")
 
-	dialer := gomail.NewDialer(dialerOptions)
-	if deadline, ok := ctx.Deadline(); ok {
-		dialer.SetDeadline(deadline)
-	}
-	return dialer.DialAndSend(email)
+	return dialAndSend(ctx, dialerOptions, email)
 }
@@ -36,6 +36,9 @@ func initMailTemplates() {
 		"support_request":              subjectEntry{"Mail Support Confirmation Subject", nil},
 		"sharing_request":              subjectEntry{"Mail Sharing Request Subject", []string{"SharerPublicName"}},
 		"sharing_to_confirm":           subjectEntry{"Mail Sharing Member To Confirm Subject", nil},
+		"sharing_owner_deletion":       subjectEntry{"Mail Sharing Owner Deletion Subject", []string{"SharerPublicName"}},
+		"sharing_expiration":           subjectEntry{"Mail Sharing Expiration Subject", []string{"Description"}},
+		"sharing_verification":         subjectEntry{"Mail Sharing Verification Subject", []string{"SharerPublicName"}},
 		"notifications_sharing":        subjectEntry{"Notification Sharing Subject", nil},
 		"notifications_diskquota":      subjectEntry{"Notifications Disk Quota Subject", nil},
 		"notifications_oauthclients":   subjectEntry{"Notifications OAuth Clients Subject", nil},
@@ -88,6 +91,7 @@ func (m MailTemplater) Execute(ctx *job.WorkerContext, name, layout, locale stri
 	}
 	if ctx.Instance != nil {
 		data["InstanceURL"] = ctx.Instance.PageURL("/", nil)
+		addBrandingValues(ctx.Instance, data)
 	}
 
 	txt, err := buildText(name, context, locale, data)
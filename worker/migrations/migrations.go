@@ -11,6 +11,7 @@ import (
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/job"
 	"github.com/cozy/cozy-stack/model/note"
+	"github.com/cozy/cozy-stack/model/schema"
 	"github.com/cozy/cozy-stack/model/vfs"
 	"github.com/cozy/cozy-stack/model/vfs/vfsswift"
 	"github.com/cozy/cozy-stack/pkg/config/config"
@@ -40,6 +41,7 @@ const (
 	accountsToOrganization = "accounts-to-organization"
 	notesMimeType          = "notes-mime-type"
 	unwantedFolders        = "remove-unwanted-folders"
+	doctypeSchema          = "doctype-schema"
 )
 
 // maxSimultaneousCalls is the maximal number of simultaneous calls to Swift
@@ -59,7 +61,8 @@ func init() {
 }
 
 type message struct {
-	Type string `json:"type"`
+	Type    string `json:"type"`
+	Doctype string `json:"doctype,omitempty"`
 }
 
 func worker(ctx *job.WorkerContext) error {
@@ -82,6 +85,8 @@ func worker(ctx *job.WorkerContext) error {
 		return migrateNotesMimeType(ctx.Instance.Domain)
 	case unwantedFolders:
 		return removeUnwantedFolders(ctx.Instance.Domain)
+	case doctypeSchema:
+		return upgradeDoctypeSchema(ctx.Instance, msg.Doctype)
 	default:
 		return fmt.Errorf("unknown migration type %q", msg.Type)
 	}
@@ -106,6 +111,19 @@ func commit(ctx *job.WorkerContext, err error) error {
 	return err
 }
 
+func upgradeDoctypeSchema(inst *instance.Instance, doctype string) error {
+	if doctype == "" {
+		return errors.New("the doctype is missing")
+	}
+	if schema.LatestVersion(doctype) == 0 {
+		return fmt.Errorf("no schema migration for %s", doctype)
+	}
+	upgraded, err := schema.UpgradeAll(inst, doctype)
+	inst.Logger().WithNamespace("migration").
+		Infof("%d documents of %s have been upgraded", upgraded, doctype)
+	return err
+}
+
 func pushTrashJob(fs vfs.VFS) func(vfs.TrashJournal) error {
 	return func(journal vfs.TrashJournal) error {
 		return fs.EnsureErased(journal)
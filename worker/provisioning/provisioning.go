@@ -0,0 +1,82 @@
+package provisioning
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/app"
+	"github.com/cozy/cozy-stack/model/instance"
+	"github.com/cozy/cozy-stack/model/job"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "provisioning",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      30 * time.Minute,
+		WorkerFunc:   Worker,
+	})
+}
+
+// Options is the message of the provisioning jobs. Initial is true for the
+// provisioning made at the creation of the instance.
+type Options struct {
+	Initial bool `json:"initial,omitempty"`
+}
+
+// Worker installs the apps and konnectors of the provisioning profile of the
+// context of the instance, and keeps a report of what has been done.
+func Worker(ctx *job.WorkerContext) error {
+	var opts Options
+	if err := ctx.UnmarshalMessage(&opts); err != nil {
+		return err
+	}
+	inst := ctx.Instance
+	profile, ok := app.GetProvisioningProfile(inst)
+	if !ok {
+		ctx.Logger().Infof("No provisioning profile for the context %s", inst.ContextName)
+		return nil
+	}
+
+	report, err := app.Provision(inst, profile, opts.Initial)
+	if err != nil {
+		return err
+	}
+	for _, result := range report.Results {
+		if result.Action == app.ProvisioningFailed {
+			ctx.Logger().Warnf("Cannot provision %s: %s", result.Slug, result.Error)
+		}
+	}
+
+	ensureTrigger(inst, profile)
+	return nil
+}
+
+// ensureTrigger creates the trigger for converging the instance toward the
+// profile on a schedule, if the profile has one.
+func ensureTrigger(inst *instance.Instance, profile *app.ProvisioningProfile) {
+	if profile.Schedule == "" {
+		return
+	}
+	sched := job.System()
+	infos := job.TriggerInfos{
+		Type:       "@cron",
+		WorkerType: "provisioning",
+	}
+	if sched.HasTrigger(inst, infos) {
+		return
+	}
+	infos.Arguments = profile.Schedule
+	trigger, err := job.NewTrigger(inst, infos, nil)
+	if err != nil {
+		inst.Logger().WithNamespace("provisioning").
+			Errorf("Cannot create provisioning trigger: %s", err)
+		return
+	}
+	if err = sched.AddTrigger(trigger); err != nil {
+		inst.Logger().WithNamespace("provisioning").
+			Errorf("Cannot create provisioning trigger: %s", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/cozy/cozy-stack/model/account"
@@ -32,6 +33,9 @@ import (
 )
 
 var (
+	// clientsMu protects the clients, as they are initialized again when the
+	// secrets are reloaded, while the workers are running.
+	clientsMu    sync.RWMutex
 	fcmClient    *fcm.Client
 	iosClient    *apns.Client
 	huaweiClient *huawei.Client
@@ -46,17 +50,28 @@ func init() {
 		WorkerInit:   Init,
 		WorkerFunc:   Worker,
 	})
+	config.OnSecretsReload(Init)
 }
 
 // Init initializes the necessary global clients
 func Init() (err error) {
 	conf := config.GetConfig().Notifications
+	var fcmC *fcm.Client
+	var iosC *apns.Client
+	var huaweiC *huawei.Client
+	defer func() {
+		if err == nil {
+			clientsMu.Lock()
+			fcmClient, iosClient, huaweiClient = fcmC, iosC, huaweiC
+			clientsMu.Unlock()
+		}
+	}()
 
 	if conf.AndroidAPIKey != "" {
 		if conf.FCMServer != "" {
-			fcmClient, err = fcm.NewClient(conf.AndroidAPIKey, fcm.WithEndpoint(conf.FCMServer))
+			fcmC, err = fcm.NewClient(conf.AndroidAPIKey, fcm.WithEndpoint(conf.FCMServer))
 		} else {
-			fcmClient, err = fcm.NewClient(conf.AndroidAPIKey)
+			fcmC, err = fcm.NewClient(conf.AndroidAPIKey)
 		}
 		logger.WithNamespace("push").Infof("Initialized FCM client with Android API Key")
 		if err != nil {
@@ -91,19 +106,19 @@ func Init() (err error) {
 				KeyID:   conf.IOSKeyID,
 				TeamID:  conf.IOSTeamID,
 			}
-			iosClient = apns.NewTokenClient(t)
+			iosC = apns.NewTokenClient(t)
 		} else {
-			iosClient = apns.NewClient(certificateKey)
+			iosC = apns.NewClient(certificateKey)
 		}
 		if conf.Development {
-			iosClient = iosClient.Development()
+			iosC = iosC.Development()
 		} else {
-			iosClient = iosClient.Production()
+			iosC = iosC.Production()
 		}
 	}
 
 	if conf.HuaweiSendMessagesURL != "" {
-		huaweiClient, err = huawei.NewClient(conf)
+		huaweiC, err = huawei.NewClient(conf)
 		if err != nil {
 			return err
 		}
@@ -292,6 +307,9 @@ func prepareAndroidData(msg *center.PushMessage, hashedSource []byte) map[string
 }
 
 func getFirebaseClient(slug, contextName string) *fcm.Client {
+	clientsMu.RLock()
+	fcmClient := fcmClient
+	clientsMu.RUnlock()
 	if slug == "" {
 		return fcmClient
 	}
@@ -307,6 +325,9 @@ func getFirebaseClient(slug, contextName string) *fcm.Client {
 }
 
 func pushToAPNS(ctx *job.WorkerContext, c *oauth.Client, msg *center.PushMessage) error {
+	clientsMu.RLock()
+	iosClient := iosClient
+	clientsMu.RUnlock()
 	if iosClient == nil {
 		ctx.Logger().Warn("Could not send iOS notification: not configured")
 		return nil
@@ -349,6 +370,9 @@ func pushToAPNS(ctx *job.WorkerContext, c *oauth.Client, msg *center.PushMessage
 }
 
 func pushToHuawei(ctx *job.WorkerContext, c *oauth.Client, msg *center.PushMessage) error {
+	clientsMu.RLock()
+	huaweiClient := huaweiClient
+	clientsMu.RUnlock()
 	if huaweiClient == nil {
 		ctx.Logger().Warn("Could not send Huawei notification: not configured")
 		return nil
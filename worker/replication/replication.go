@@ -0,0 +1,90 @@
+// Package replication is for the worker that replicates the Swift objects of
+// an instance to a secondary endpoint, in another region.
+package replication
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/model/vfs/vfsswift"
+	"github.com/cozy/cozy-stack/pkg/consts"
+)
+
+// WorkerType is the type of the jobs for the replication.
+const WorkerType = "swift-replication"
+
+// debounce is the delay between a write and its replication, to regroup the
+// writes of an instance in a single job.
+const debounce = "1m"
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   WorkerType,
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 3,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   Worker,
+	})
+	vfsswift.ScheduleReplication = scheduleReplication
+}
+
+// Message is the message of the replication jobs. By default, the journal is
+// processed, and the reconcile option can be used to compare all the objects
+// of the instance on the two endpoints.
+type Message struct {
+	Reconcile bool `json:"reconcile"`
+}
+
+// Worker is the worker that replicates the Swift objects.
+func Worker(ctx *job.WorkerContext) error {
+	var msg Message
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	var report *vfsswift.ReplicationReport
+	var err error
+	if msg.Reconcile {
+		report, err = vfsswift.Reconcile(ctx, ctx.Instance)
+	} else {
+		report, err = vfsswift.Replicate(ctx, ctx.Instance)
+	}
+	if report != nil {
+		ctx.Logger().Infof("Replication: %d copied, %d deleted, %d errors",
+			report.Copied, report.Deleted, report.Errors)
+	}
+	return err
+}
+
+// scheduled is the set of the instances for which the trigger is known to
+// exist, to avoid looking for it on each write.
+var scheduled sync.Map
+
+// scheduleReplication ensures that the instance has a trigger for the
+// replication, with a debounce on the entries of the journal.
+func scheduleReplication(db vfs.Prefixer) error {
+	if _, ok := scheduled.Load(db.DBPrefix()); ok {
+		return nil
+	}
+	sched := job.System()
+	infos := job.TriggerInfos{
+		Type:       "@event",
+		WorkerType: WorkerType,
+		Arguments:  consts.FilesJournal + ":CREATED",
+		Debounce:   debounce,
+	}
+	if !sched.HasTrigger(db, infos) {
+		t, err := job.NewTrigger(db, infos, Message{})
+		if err != nil {
+			return err
+		}
+		if err = sched.AddTrigger(t); err != nil {
+			return err
+		}
+	}
+	scheduled.Store(db.DBPrefix(), true)
+	return nil
+}
@@ -41,6 +41,43 @@ func init() {
 		Timeout:      1 * time.Hour,
 		WorkerFunc:   WorkerUpload,
 	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "share-identity",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      10 * time.Minute,
+		WorkerFunc:   WorkerIdentity,
+	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "sharing-suggestions",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      5 * time.Minute,
+		WorkerFunc:   WorkerSuggestions,
+	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "share-webhook",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 5,
+		RetryDelay:   30 * time.Second,
+		Reserved:     true,
+		Timeout:      30 * time.Second,
+		WorkerFunc:   WorkerWebhook,
+	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "share-expire",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      5 * time.Minute,
+		WorkerFunc:   WorkerExpire,
+	})
 }
 
 // WorkerTrack is used to update the io.cozy.shared database when a document
@@ -75,6 +112,13 @@ func WorkerReplicate(ctx *job.WorkerContext) error {
 	if !s.Active {
 		return nil
 	}
+	if msg.ResetMember != nil {
+		idx := *msg.ResetMember
+		if idx < 0 || idx >= len(s.Members) {
+			return sharing.ErrMemberNotFound
+		}
+		return s.ResetCheckpoints(ctx.Instance, &s.Members[idx])
+	}
 	return s.Replicate(ctx.Instance, msg.Errors)
 }
 
@@ -95,3 +139,49 @@ func WorkerUpload(ctx *job.WorkerContext) error {
 	}
 	return s.Upload(ctx.Instance, msg.Errors)
 }
+
+// WorkerIdentity is used to inform the other members of the sharings that
+// the email of the instance has changed.
+func WorkerIdentity(ctx *job.WorkerContext) error {
+	var msg sharing.IdentityMsg
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	ctx.Instance.Logger().WithNamespace("share").
+		Debugf("Identity %#v", msg)
+	return sharing.ChangeIdentity(ctx.Instance, msg.OldEmail)
+}
+
+// WorkerSuggestions is used to compute the recipients that are suggested for
+// the new sharings, from the previous sharings and the contacts.
+func WorkerSuggestions(ctx *job.WorkerContext) error {
+	doc, err := sharing.ComputeSuggestions(ctx.Instance)
+	if err != nil {
+		return err
+	}
+	ctx.Logger().Debugf("%d candidates for the sharing suggestions", len(doc.Candidates))
+	return nil
+}
+
+// WorkerWebhook is used to send the events of a sharing to the webhook
+// registered by the owner. The failed deliveries are retried with an
+// exponential backoff.
+func WorkerWebhook(ctx *job.WorkerContext) error {
+	var msg sharing.WebhookMsg
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	return sharing.DeliverWebhook(ctx, &msg)
+}
+
+// WorkerExpire is used to revoke a sharing when its expiration date has been
+// reached, and to remind it to the owner and the members a few days before.
+func WorkerExpire(ctx *job.WorkerContext) error {
+	var msg sharing.ExpireMessage
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	ctx.Instance.Logger().WithNamespace("share").
+		Debugf("Expire %#v", msg)
+	return sharing.Expire(ctx.Instance, &msg)
+}
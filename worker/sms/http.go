@@ -0,0 +1,95 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultBodyTemplate is the body sent by the generic HTTP provider when no
+// template is configured.
+const defaultBodyTemplate = `{"to":{{json .Number}},"message":{{json .Message}},"callback_url":{{json .CallbackURL}}}`
+
+var bodyFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// httpProvider sends SMS with a POST request to a configurable URL. The body
+// of the request is made from a template, where the phone number, the message
+// and the callback URL can be used.
+type httpProvider struct {
+	cfg  *config.SMS
+	body *template.Template
+}
+
+type httpBodyValues struct {
+	Number      string
+	Message     string
+	CallbackURL string
+}
+
+func newHTTPProvider(cfg *config.SMS) (*httpProvider, error) {
+	tmpl := cfg.BodyTemplate
+	if tmpl == "" {
+		tmpl = defaultBodyTemplate
+	}
+	body, err := template.New("sms").Funcs(bodyFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid body_template for sending SMS: %w", err)
+	}
+	return &httpProvider{cfg: cfg, body: body}, nil
+}
+
+func (p *httpProvider) Send(number, message, callbackURL string) (string, error) {
+	var payload bytes.Buffer
+	err := p.body.Execute(&payload, httpBodyValues{
+		Number:      number,
+		Message:     message,
+		CallbackURL: callbackURL,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.cfg.URL, &payload)
+	if err != nil {
+		return "", err
+	}
+	contentType := p.cfg.ContentType
+	if contentType == "" {
+		contentType = echo.MIMEApplicationJSON
+	}
+	req.Header.Add(echo.HeaderContentType, contentType)
+	if p.cfg.Token != "" {
+		req.Header.Add(echo.HeaderAuthorization, "Bearer "+p.cfg.Token)
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := smsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("Unexpected status code: %d", res.StatusCode)
+	}
+	// The identifier of the SMS is taken from the response if it is a JSON
+	// object with an id field.
+	var result struct {
+		ID interface{} `json:"id"`
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err == nil && json.Unmarshal(body, &result) == nil && result.ID != nil {
+		return fmt.Sprintf("%v", result.ID), nil
+	}
+	return "", nil
+}
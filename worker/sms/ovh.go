@@ -0,0 +1,106 @@
+package sms
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/labstack/echo/v4"
+)
+
+const ovhDefaultURL = "https://eu.api.ovh.com/1.0"
+
+// ovhProvider sends SMS with the OVHcloud API.
+// Cf https://help.ovhcloud.com/csm/en-sms-sending-via-api
+type ovhProvider struct {
+	cfg *config.SMS
+}
+
+type ovhJob struct {
+	Message           string   `json:"message"`
+	Receivers         []string `json:"receivers"`
+	Sender            string   `json:"sender,omitempty"`
+	SenderForResponse bool     `json:"senderForResponse,omitempty"`
+	NoStopClause      bool     `json:"noStopClause"`
+	Charset           string   `json:"charset"`
+	CallBack          string   `json:"callBack,omitempty"`
+}
+
+type ovhJobResult struct {
+	IDs              []int64  `json:"ids"`
+	InvalidReceivers []string `json:"invalidReceivers"`
+}
+
+func (p *ovhProvider) Send(number, message, callbackURL string) (string, error) {
+	if p.cfg.ServiceName == "" {
+		return "", errors.New("OVH: the service_name is missing in the config")
+	}
+	base := p.cfg.URL
+	if base == "" {
+		base = ovhDefaultURL
+	}
+	u := strings.TrimSuffix(base, "/") + "/sms/" + url.PathEscape(p.cfg.ServiceName) + "/jobs"
+	job := ovhJob{
+		Message:           message,
+		Receivers:         []string{number},
+		Sender:            p.cfg.Sender,
+		SenderForResponse: p.cfg.Sender == "",
+		NoStopClause:      p.cfg.Sender != "",
+		Charset:           "UTF-8",
+		CallBack:          callbackURL,
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Add(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add("X-Ovh-Application", p.cfg.ApplicationKey)
+	req.Header.Add("X-Ovh-Consumer", p.cfg.ConsumerKey)
+	req.Header.Add("X-Ovh-Timestamp", timestamp)
+	req.Header.Add("X-Ovh-Signature", p.signature(http.MethodPost, u, payload, timestamp))
+	res, err := smsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OVH: unexpected status code: %d", res.StatusCode)
+	}
+	var result ovhJobResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.IDs) == 0 {
+		return "", fmt.Errorf("OVH: invalid receivers %v", result.InvalidReceivers)
+	}
+	return strconv.FormatInt(result.IDs[0], 10), nil
+}
+
+// signature computes the signature of a request for the OVHcloud API.
+func (p *ovhProvider) signature(method, u string, body []byte, timestamp string) string {
+	parts := []string{
+		p.cfg.ApplicationSecret,
+		p.cfg.ConsumerKey,
+		method,
+		u,
+		string(body),
+		timestamp,
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, "+")))
+	return "$1$" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrUnknownProvider is used when the provider for sending SMS in the config
+// is not supported.
+var ErrUnknownProvider = errors.New("Unknown provider for sending SMS")
+
+var smsClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// Provider is the interface implemented by the gateways that can send SMS.
+type Provider interface {
+	// Send sends the message to the given phone number. The callbackURL can
+	// be given to the gateway for reporting the delivery status. It returns
+	// the identifier of the SMS for the gateway, if any.
+	Send(number, message, callbackURL string) (string, error)
+}
+
+// NewProvider returns the provider for the given configuration.
+func NewProvider(cfg *config.SMS, log logger.Logger) (Provider, error) {
+	switch cfg.Provider {
+	case "api_sen":
+		return &senProvider{cfg: cfg, log: log}, nil
+	case "ovh":
+		return &ovhProvider{cfg: cfg}, nil
+	case "http":
+		return newHTTPProvider(cfg)
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
+
+// senProvider sends SMS with the SEN API.
+type senProvider struct {
+	cfg *config.SMS
+	log logger.Logger
+}
+
+func (p *senProvider) Send(number, message, callbackURL string) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"content":  message,
+		"receiver": []interface{}{number},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.cfg.URL, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Add(echo.HeaderAuthorization, "Bearer "+p.cfg.Token)
+	res, err := smsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 200 {
+		return "", nil
+	}
+
+	log := p.log
+	var body map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err == nil {
+		if t, ok := body["type"].(string); ok {
+			log = log.WithField("type", t)
+		}
+		if detail, ok := body["detail"].(string); ok {
+			log = log.WithField("detail", detail)
+		}
+		log.WithField("status_code", res.StatusCode).Warnf("Cannot send SMS")
+	}
+	return "", fmt.Errorf("Unexpected status code: %d", res.StatusCode)
+}
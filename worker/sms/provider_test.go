@@ -0,0 +1,104 @@
+package sms
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cozy/cozy-stack/pkg/config/config"
+	"github.com/cozy/cozy-stack/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviders(t *testing.T) {
+	t.Run("UnknownProvider", func(t *testing.T) {
+		_, err := NewProvider(&config.SMS{Provider: "foo"}, logger.WithNamespace("sms"))
+		assert.ErrorIs(t, err, ErrUnknownProvider)
+	})
+
+	t.Run("OVH", func(t *testing.T) {
+		var received ovhJob
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/1.0/sms/sms-ab12345-1/jobs", r.URL.Path)
+			assert.Equal(t, "app-key", r.Header.Get("X-Ovh-Application"))
+			assert.Equal(t, "consumer-key", r.Header.Get("X-Ovh-Consumer"))
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			toSign := strings.Join([]string{
+				"app-secret",
+				"consumer-key",
+				http.MethodPost,
+				"http://" + r.Host + r.URL.Path,
+				string(body),
+				r.Header.Get("X-Ovh-Timestamp"),
+			}, "+")
+			sum := sha1.Sum([]byte(toSign))
+			assert.Equal(t, "$1$"+hex.EncodeToString(sum[:]), r.Header.Get("X-Ovh-Signature"))
+			require.NoError(t, json.Unmarshal(body, &received))
+			_, _ = w.Write([]byte(`{"ids":[123456],"invalidReceivers":[],"validReceivers":["+33612345678"]}`))
+		}))
+		defer ts.Close()
+
+		provider, err := NewProvider(&config.SMS{
+			Provider:          "ovh",
+			URL:               ts.URL + "/1.0",
+			ApplicationKey:    "app-key",
+			ApplicationSecret: "app-secret",
+			ConsumerKey:       "consumer-key",
+			ServiceName:       "sms-ab12345-1",
+			Sender:            "Cozy",
+		}, logger.WithNamespace("sms"))
+		require.NoError(t, err)
+		id, err := provider.Send("+33612345678", "Hello", "https://alice.cozy.localhost/callback")
+		require.NoError(t, err)
+		assert.Equal(t, "123456", id)
+		assert.Equal(t, "Hello", received.Message)
+		assert.Equal(t, []string{"+33612345678"}, received.Receivers)
+		assert.Equal(t, "Cozy", received.Sender)
+		assert.Equal(t, "https://alice.cozy.localhost/callback", received.CallBack)
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		var received map[string]interface{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer some-token", r.Header.Get("Authorization"))
+			assert.Equal(t, "bar", r.Header.Get("X-Foo"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			_, _ = w.Write([]byte(`{"id":"sms-42"}`))
+		}))
+		defer ts.Close()
+
+		provider, err := NewProvider(&config.SMS{
+			Provider:     "http",
+			URL:          ts.URL,
+			Token:        "some-token",
+			BodyTemplate: `{"phone":{{json .Number}},"text":{{json .Message}}}`,
+			Headers:      map[string]string{"X-Foo": "bar"},
+		}, logger.WithNamespace("sms"))
+		require.NoError(t, err)
+		id, err := provider.Send("+33612345678", `Say "hello"`, "")
+		require.NoError(t, err)
+		assert.Equal(t, "sms-42", id)
+		assert.Equal(t, "+33612345678", received["phone"])
+		assert.Equal(t, `Say "hello"`, received["text"])
+	})
+
+	t.Run("HTTPError", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer ts.Close()
+
+		provider, err := NewProvider(&config.SMS{Provider: "http", URL: ts.URL}, logger.WithNamespace("sms"))
+		require.NoError(t, err)
+		_, err = provider.Send("+33612345678", "Hello", "")
+		assert.Error(t, err)
+	})
+}
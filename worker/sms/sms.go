@@ -1,22 +1,17 @@
 package sms
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
-	"fmt"
-	"net/http"
 	"runtime"
 	"time"
 
 	"github.com/cozy/cozy-stack/model/contact"
 	"github.com/cozy/cozy-stack/model/instance"
 	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/notification"
 	"github.com/cozy/cozy-stack/model/notification/center"
 	"github.com/cozy/cozy-stack/pkg/config/config"
-	"github.com/cozy/cozy-stack/pkg/logger"
 	"github.com/cozy/cozy-stack/pkg/mail"
-	"github.com/labstack/echo/v4"
 )
 
 func init() {
@@ -55,50 +50,29 @@ func sendSMS(ctx *job.WorkerContext, msg *center.SMS) error {
 	if err != nil {
 		return err
 	}
-	switch cfg.Provider {
-	case "api_sen":
-		log := ctx.Logger()
-		return sendSenAPI(cfg, msg, number, log)
-	default:
-		return errors.New("Unknown provider for sending SMS")
-	}
-}
-
-func sendSenAPI(cfg *config.SMS, msg *center.SMS, number string, log logger.Logger) error {
-	payload, err := json.Marshal(map[string]interface{}{
-		"content":  msg.Message,
-		"receiver": []interface{}{number},
-	})
+	provider, err := NewProvider(cfg, ctx.Logger())
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest(http.MethodPost, cfg.URL, bytes.NewReader(payload))
-	if err != nil {
-		return err
+	var callbackURL string
+	if msg.NotificationID != "" {
+		callbackURL = center.SMSStatusURL(inst, msg.NotificationID)
 	}
-	req.Header.Add(echo.HeaderAccept, echo.MIMEApplicationJSON)
-	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Add(echo.HeaderAuthorization, "Bearer "+cfg.Token)
-	res, err := http.DefaultClient.Do(req)
+	messageID, err := provider.Send(number, msg.Message, callbackURL)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
-	if res.StatusCode == 200 {
-		return nil
-	}
-
-	var body map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&body); err == nil {
-		if t, ok := body["type"].(string); ok {
-			log = log.WithField("type", t)
-		}
-		if detail, ok := body["detail"].(string); ok {
-			log = log.WithField("detail", detail)
+	if msg.NotificationID != "" {
+		err := center.RecordSMSDelivery(inst, msg.NotificationID, &notification.SMSDelivery{
+			Provider:  cfg.Provider,
+			MessageID: messageID,
+			Status:    center.SMSStatusSent,
+		})
+		if err != nil {
+			ctx.Logger().Warnf("could not record the SMS delivery: %s", err)
 		}
-		log.WithField("status_code", res.StatusCode).Warnf("Cannot send SMS")
 	}
-	return fmt.Errorf("Unexpected status code: %d", res.StatusCode)
+	return nil
 }
 
 func getMyselfPhoneNumber(inst *instance.Instance) (string, error) {
@@ -0,0 +1,60 @@
+package snapshot
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "snapshot",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerSnapshot,
+	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "snapshot-restore",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerRestore,
+	})
+}
+
+type snapshotMessage struct {
+	ID string `json:"id"`
+}
+
+// RestoreMessage is the message for the snapshot-restore worker.
+type RestoreMessage struct {
+	ID   string `json:"id"`
+	Path string `json:"path,omitempty"`
+}
+
+// WorkerSnapshot is a worker that saves the entries of a snapshot, for the
+// files and directories of its tree. The old versions referenced by those
+// entries are then kept by the versions worker.
+func WorkerSnapshot(ctx *job.WorkerContext) error {
+	msg := &snapshotMessage{}
+	if err := ctx.UnmarshalMessage(msg); err != nil {
+		return err
+	}
+	return vfs.BuildSnapshot(ctx, ctx.Instance.VFS(), msg.ID)
+}
+
+// WorkerRestore is a worker that restores the files and directories from a
+// snapshot. The result is saved in the snapshot document.
+func WorkerRestore(ctx *job.WorkerContext) error {
+	msg := &RestoreMessage{}
+	if err := ctx.UnmarshalMessage(msg); err != nil {
+		return err
+	}
+	return vfs.RunSnapshotRestore(ctx.Instance.VFS(), msg.ID, msg.Path)
+}
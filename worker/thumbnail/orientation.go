@@ -0,0 +1,111 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+)
+
+// originalOrientationTag is the tag of the version that keeps the original
+// content of an image, before its orientation was normalized. The tagged
+// versions are never cleaned by the versioning policy.
+const originalOrientationTag = "original-orientation"
+
+// needsNormalization returns true if the context of the instance asks to
+// normalize the orientation of the images, and the EXIF of the image says
+// that it must be rotated or flipped to be displayed.
+func needsNormalization(ctx *job.WorkerContext, img *vfs.FileDoc) bool {
+	if img.Mime != "image/jpeg" || !checkByteSize(img) {
+		return false
+	}
+	orientation, ok := img.Metadata["orientation"].(float64)
+	if !ok {
+		if o, ok := img.Metadata["orientation"].(int); ok {
+			orientation = float64(o)
+		}
+	}
+	if orientation < 2 || orientation > 8 {
+		return false
+	}
+	ctxSettings, ok := ctx.Instance.SettingsContext()
+	if !ok {
+		return false
+	}
+	normalize, _ := ctxSettings["normalize_image_orientation"].(bool)
+	return normalize
+}
+
+// normalizeOrientation rotates the image according to its EXIF orientation,
+// and replaces the content of the file by the rotated image. The original
+// content is kept as a version of the file. The thumbnails will be generated
+// for the new content by the job for the update of the file.
+func normalizeOrientation(ctx *job.WorkerContext, img *vfs.FileDoc) error {
+	fs := ctx.Instance.VFS()
+	content, err := fs.OpenFile(img)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	convertCmd := config.GetConfig().Jobs.ImageMagickConvertCmd
+	if convertCmd == "" {
+		convertCmd = "convert"
+	}
+	args := []string{
+		"-limit", "Memory", "2GB",
+		"-limit", "Map", "3GB",
+		"-",            // Takes the input from stdin
+		"-auto-orient", // Rotate image and reset the EXIF orientation
+		"jpg:-",        // Send the output on stdout, in JPEG format
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, convertCmd, args...)
+	cmd.Stdin = content
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		ctx.Logger().
+			WithField("stderr", stderr.String()).
+			WithField("file_id", img.ID()).
+			Errorf("imagemagick failed: %s", err)
+		return err
+	}
+
+	// Check that the EXIF orientation has been reset, to avoid normalizing
+	// the image again and again.
+	exif := vfs.NewExifExtractor(img.CreatedAt, false)
+	_, _ = io.Copy(exif, io.LimitReader(bytes.NewReader(stdout.Bytes()), 128*1024))
+	_ = exif.Close()
+	if o, ok := exif.Result()["orientation"].(int); ok && o > 1 {
+		return errors.New("the orientation of the image has not been reset")
+	}
+
+	// The tag on the old document is copied to the version with the original
+	// content, so that it is never cleaned.
+	olddoc := img.Clone().(*vfs.FileDoc)
+	olddoc.Tags = append(olddoc.Tags, originalOrientationTag)
+	newdoc := img.Clone().(*vfs.FileDoc)
+	newdoc.ByteSize = int64(stdout.Len())
+	newdoc.MD5Sum = nil
+	newdoc.Metadata = nil
+	newdoc.UpdatedAt = time.Now()
+	if newdoc.CozyMetadata != nil {
+		newdoc.CozyMetadata.UpdatedAt = newdoc.UpdatedAt
+	}
+
+	file, err := fs.CreateFile(newdoc, olddoc)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(stdout.Bytes())
+	if cerr := file.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
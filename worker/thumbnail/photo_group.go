@@ -0,0 +1,39 @@
+package thumbnail
+
+import (
+	"os"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+	"github.com/cozy/cozy-stack/pkg/config/config"
+)
+
+// WorkerPhotoGroup is a worker that groups the files of a live photo (an image
+// and a short video) or of a burst, when one of them is created or renamed.
+func WorkerPhotoGroup(ctx *job.WorkerContext) error {
+	var img imageEvent
+	if err := ctx.UnmarshalEvent(&img); err != nil {
+		return err
+	}
+	if img.Doc.Trashed {
+		return nil
+	}
+
+	// The files of a group are often uploaded at the same time, so the jobs
+	// for the same directory are serialized.
+	mutex := config.Lock().ReadWrite(ctx.Instance, "photo-group/"+img.Doc.DirID)
+	if err := mutex.Lock(); err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	fs := ctx.Instance.VFS()
+	doc, err := fs.FileByID(img.Doc.ID())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return vfs.GroupPhotos(fs, doc)
+}
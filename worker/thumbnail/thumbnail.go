@@ -60,6 +60,15 @@ func init() {
 		Timeout:      3 * time.Hour,
 		WorkerFunc:   WorkerCheck,
 	})
+
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "photo-group",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      30 * time.Second,
+		WorkerFunc:   WorkerPhotoGroup,
+	})
 }
 
 // Worker is a worker that creates thumbnails for photos and images.
@@ -83,6 +92,9 @@ func Worker(ctx *job.WorkerContext) error {
 		if _, ok := formats[msg.Format]; !ok {
 			return errors.New("invalid format")
 		}
+		if msg.File.Quarantined() {
+			return nil
+		}
 		return generateSingleThumbnail(ctx, msg.File, msg.Format)
 	}
 
@@ -93,6 +105,10 @@ func Worker(ctx *job.WorkerContext) error {
 	if img.Verb != "DELETED" && img.Doc.Trashed {
 		return nil
 	}
+	// The thumbnails of a quarantined image would show its content
+	if img.Verb != "DELETED" && img.Doc.Quarantined() {
+		return removeThumbnails(ctx.Instance, &img.Doc)
+	}
 	if img.OldDoc != nil && sameImg(&img.Doc, img.OldDoc) {
 		return nil
 	}
@@ -104,6 +120,15 @@ func Worker(ctx *job.WorkerContext) error {
 	defer mutex.Unlock()
 	log.Debugf("%s %s", img.Verb, img.Doc.ID())
 
+	if img.Verb != "DELETED" && needsNormalization(ctx, &img.Doc) {
+		err := normalizeOrientation(ctx, &img.Doc)
+		if err == nil {
+			// The thumbnails will be generated for the normalized image
+			return nil
+		}
+		log.Warnf("cannot normalize the orientation of %s: %s", img.Doc.ID(), err)
+	}
+
 	switch img.Verb {
 	case "CREATED":
 		return generateThumbnails(ctx, &img.Doc)
@@ -0,0 +1,49 @@
+package trash
+
+import (
+	"errors"
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "tiering",
+		Concurrency:  runtime.NumCPU() * 4,
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerTiering,
+	})
+}
+
+// TieringMessage is the message of the tiering jobs. When RetrieveID is set,
+// the content of the file, or of the files inside the directory, with this
+// identifier is moved back from the cold storage.
+type TieringMessage struct {
+	RetrieveID string `json:"retrieve_id,omitempty"`
+}
+
+// WorkerTiering is a worker used to move the old versions and the files in the
+// trash for too long to the cold storage, and to move back the files that have
+// been restored. The thresholds are configurable per context via the
+// fs.tiering parameters of the config file.
+func WorkerTiering(ctx *job.WorkerContext) error {
+	var msg TieringMessage
+	if err := ctx.UnmarshalMessage(&msg); err != nil && !errors.Is(err, job.ErrMessageNil) {
+		return err
+	}
+	fs := ctx.Instance.VFS()
+	if msg.RetrieveID != "" {
+		return vfs.RetrieveFromColdStorage(fs, msg.RetrieveID)
+	}
+	policy := vfs.ContextTieringPolicy(ctx.Instance.ContextName)
+	moved, err := vfs.ApplyTieringPolicy(fs, policy)
+	if moved > 0 {
+		ctx.Logger().Infof("%d bytes moved to the cold storage", moved)
+	}
+	return err
+}
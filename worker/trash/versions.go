@@ -0,0 +1,33 @@
+package trash
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/vfs"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "clean-old-versions",
+		Concurrency:  runtime.NumCPU() * 4,
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      2 * time.Hour,
+		WorkerFunc:   WorkerCleanOldVersions,
+	})
+}
+
+// WorkerCleanOldVersions is a worker used to enforce the versioning policy of
+// an instance: it deletes the old versions of the files that are too old, and
+// the oldest versions when they take too much space. The policy is
+// configurable per context via the fs.versioning parameters of the config
+// file, and per instance.
+func WorkerCleanOldVersions(ctx *job.WorkerContext) error {
+	reclaimed, err := vfs.CleanVersionsByPolicy(ctx.Instance.VFS())
+	if reclaimed > 0 {
+		ctx.Logger().Infof("%d bytes reclaimed by cleaning old versions", reclaimed)
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package usage
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/usage"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "usage",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 2,
+		Reserved:     true,
+		Timeout:      30 * time.Minute,
+		WorkerFunc:   WorkerUsage,
+	})
+}
+
+// WorkerUsage is a worker used to compute the usage metrics of an instance,
+// and to save them in the io.cozy.settings.usage document.
+func WorkerUsage(ctx *job.WorkerContext) error {
+	_, err := usage.Compute(ctx.Instance)
+	return err
+}
@@ -0,0 +1,31 @@
+package warmup
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/pkg/couchdb"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   "warmup",
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 1,
+		Reserved:     true,
+		Timeout:      time.Hour,
+		WorkerFunc:   WorkerWarmUp,
+	})
+}
+
+// WorkerWarmUp is a worker used to build the CouchDB indexes and views in
+// background, after they have been defined, so that the first queries are not
+// slowed down by the lazy building of the indexes.
+func WorkerWarmUp(ctx *job.WorkerContext) error {
+	var msg couchdb.WarmUpMessage
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	return couchdb.WarmUp(ctx.Instance, &msg)
+}
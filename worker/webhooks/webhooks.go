@@ -0,0 +1,35 @@
+package webhooks
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/cozy/cozy-stack/model/job"
+	"github.com/cozy/cozy-stack/model/webhook"
+)
+
+func init() {
+	job.AddWorker(&job.WorkerConfig{
+		WorkerType:   webhook.WorkerType,
+		Concurrency:  runtime.NumCPU(),
+		MaxExecCount: 5,
+		RetryDelay:   30 * time.Second,
+		Reserved:     true,
+		Timeout:      30 * time.Second,
+		WorkerFunc:   Worker,
+	})
+}
+
+// Worker is the worker that delivers the payloads of the outbound webhooks.
+// The failed deliveries are retried with an exponential backoff.
+func Worker(ctx *job.WorkerContext) error {
+	var msg webhook.Message
+	if err := ctx.UnmarshalMessage(&msg); err != nil {
+		return err
+	}
+	var evt webhook.Event
+	if err := ctx.UnmarshalEvent(&evt); err != nil {
+		return err
+	}
+	return webhook.Deliver(ctx, msg.SubscriptionID, &evt)
+}